@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"gokit_foundation/gateway"
+	"hello/pb/gen-go/pbcommon"
+	helloservice "hello/pkg/service"
+	"net/http"
+	addservice "new_addsvc/pkg/service"
+	"strconv"
+	"strings"
+	userendpoint "usersvc/pkg/endpoint"
+	userservice "usersvc/pkg/service"
+)
+
+/*
+聚合接口，与gateway的/composite相同，依次调用三个服务：
+	GET /composite/{name}?a=1&b=2&user_id=1  => {"hi": "...", "sum": 3, "user": {...}}
+参数中的hello、add、users是client侧的接口，这里传入的是进程内的endpoints(见Services)，
+传入网络client(如hello/client.New)时就是gateway的做法，handler不需要修改
+一个服务失败时在errors中给出，不影响其他部分；没有user_id时不查询用户
+*/
+
+type compositeRsp struct {
+	Hi     string                 `json:"hi,omitempty"`
+	Sum    *int                   `json:"sum,omitempty"`
+	User   *userendpoint.UserInfo `json:"user,omitempty"`
+	Errors map[string]string      `json:"errors,omitempty"`
+}
+
+func compositeHandler(hello helloservice.HelloService, add addservice.Service, users userservice.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/composite/")
+		q := r.URL.Query()
+		a, errA := strconv.Atoi(q.Get("a"))
+		b, errB := strconv.Atoi(q.Get("b"))
+		if name == "" || errA != nil || errB != nil {
+			gateway.WriteError(w, http.StatusBadRequest, "invalid name, a or b")
+			return
+		}
+		var userID int64
+		if s := q.Get("user_id"); s != "" {
+			id, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				gateway.WriteError(w, http.StatusBadRequest, "invalid user_id")
+				return
+			}
+			userID = id
+		}
+
+		ctx := r.Context()
+		rsp := &compositeRsp{Errors: map[string]string{}}
+		if reply, code := hello.SayHi(ctx, name); code == pbcommon.R_OK {
+			rsp.Hi = reply
+		} else {
+			rsp.Errors["hi"] = code.String()
+		}
+		if v, err := add.Sum(ctx, a, b); err == nil {
+			rsp.Sum = &v
+		} else {
+			rsp.Errors["sum"] = err.Error()
+		}
+		if userID != 0 {
+			if u, err := users.GetUser(ctx, userID); err == nil {
+				rsp.User = &userendpoint.UserInfo{ID: u.ID, Name: u.Name, Email: u.Email, CreatedAt: u.CreatedAt, UpdatedAt: u.UpdatedAt}
+			} else {
+				rsp.Errors["user"] = err.Error()
+			}
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(rsp)
+	})
+}
@@ -0,0 +1,23 @@
+module allinone
+
+go 1.12
+
+require (
+	github.com/go-kit/kit v0.10.0
+	github.com/opentracing/opentracing-go v1.2.0
+	github.com/prometheus/client_golang v1.7.1
+	go-util v0.0.0-00010101000000-000000000000
+	gokit_foundation v0.0.0-00010101000000-000000000000
+	google.golang.org/grpc v1.32.0
+	hello v0.0.0-00010101000000-000000000000
+	new_addsvc v0.0.0-00010101000000-000000000000
+	usersvc v0.0.0-00010101000000-000000000000
+)
+
+replace (
+	go-util => ../../go-util
+	gokit_foundation => ../../gokit_foundation
+	hello => ../../demo_project/hello
+	new_addsvc => ../../demo_project/new_addsvc
+	usersvc => ../../demo_project/usersvc
+)
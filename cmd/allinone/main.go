@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"github.com/go-kit/kit/log"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"go-util/_go"
+	"go-util/_util"
+	"gokit_foundation"
+	"gokit_foundation/reqid"
+	"google.golang.org/grpc"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+/*
+allinone 单进程模式(monolith)：在一个进程中运行new_addsvc、hello和usersvc，用于本地开发，不需要consul、redis、mysql、postgres
+-	三个服务的service层和endpoint层与独立部署时相同，外部依赖替换为进程内的实现(见services.go)：
+	addsvc不使用redis缓存，hello的问候记录和usersvc的用户保存在内存中，重启后丢失
+-	一个http端口：/addsvc/、/usersvc/下分别为两个服务的HTTP/JSON接口，/composite/为聚合接口(见composite.go)
+-	一个grpc端口：addsvc的pb.Add和hello的pb.Hello，client直接连接这个地址(不经过consul)
+-	服务之间的调用使用进程内的transport：client侧的接口直接由对方的endpoints实现，不经过网络和编解码，
+	endpoint层的中间件(指标、日志、限流、断路器等)仍然生效；拆分为微服务时换成网络client即可，调用方不变
+-	一个管理端口：三个服务的指标在同一个/metrics上(subsystem为各自的服务名)，以及pprof、日志级别、/tasks等
+不注册到consul，只有一个实例
+
+	go run . -http.addr :8000 -grpc.addr :8080 -admin.addr :8001
+	curl -d '{"a":1,"b":2}' localhost:8000/addsvc/sum
+	curl -d '{"name":"Jack","email":"jack@example.com"}' localhost:8000/usersvc/users
+	curl "localhost:8000/composite/Jack?a=1&b=2&user_id=1"
+	curl localhost:8001/metrics
+*/
+
+var (
+	fs          = flag.NewFlagSet("allinone", flag.ExitOnError)
+	httpAddr    = fs.String("http.addr", ":8000", "HTTP listen address of addsvc(/addsvc/), usersvc(/usersvc/) and /composite/")
+	grpcAddr    = fs.String("grpc.addr", ":8080", "gRPC listen address of addsvc and hello")
+	adminAddr   = fs.String("admin.addr", ":8001", "Admin listen address(metrics of all services, pprof, log level, tasks, shutdown), empty to disable")
+	stopTimeout = fs.Duration("stop.timeout", 5*time.Second, "max time to wait for in-flight calls on shutdown, force stop after it")
+)
+
+var (
+	logger  log.Logger
+	drainer *gokit_foundation.Drainer
+)
+
+func main() {
+	_ = fs.Parse(os.Args[1:])
+
+	logger = gokit_foundation.NewKvLogger(nil)
+	gokit_foundation.RegisterLogContextKey("request_id", gokit_foundation.CtxKeyRequestID)
+	// 添加任务之前的准备步骤通过tg.Setup执行，失败时不启动任何任务，由tg.Err报告是哪一步失败
+	tg := _go.NewTaskGroup()
+	var metricsObj *Metrics
+	if !tg.Setup("metrics", func() (err error) { metricsObj, err = NewMetrics(); return }) {
+		logger.Log("main", "startup failed", "err", tg.Err())
+		os.Exit(1)
+	}
+	tracer := stdopentracing.GlobalTracer()
+	svcs := NewServices(logger, metricsObj, tracer)
+
+	grpcSrv := gokit_foundation.NewGRPCServerBuilder(gokit_foundation.DefaultGRPCServerConfig()).
+		Unary(gokit_foundation.StageRecovery, gokit_foundation.RecoveryUnaryInterceptor(logger, metricsObj.Panics)).
+		Stream(gokit_foundation.StageRecovery, gokit_foundation.RecoveryStreamInterceptor(logger, metricsObj.Panics)).
+		Unary(gokit_foundation.StageRequestID, reqid.UnaryServerInterceptor()).
+		Unary(gokit_foundation.StageMetrics, metricsObj.GRPC.UnaryServerInterceptor()).
+		Stream(gokit_foundation.StageMetrics, metricsObj.GRPC.StreamServerInterceptor()).
+		Unary(gokit_foundation.StageLogging, gokit_foundation.AccessLogUnaryInterceptor(logger)).
+		Build()
+	healthSrv := gokit_foundation.RegisterGRPCHealthSrv(grpcSrv)
+	svcs.RegisterGRPC(grpcSrv, tracer, logger)
+	drainer = &gokit_foundation.Drainer{Logger: logger, Health: healthSrv, StopTimeout: *stopTimeout}
+
+	httpHandler := newHTTPHandler(svcs.HTTPHandler(tracer, logger), healthSrv)
+	httpHandler = gokit_foundation.RecoveryHTTPHandler(logger, metricsObj.Panics)(httpHandler)
+	httpHandler = gokit_foundation.AccessLogHandler(logger, "/healthz", "/readyz")(httpHandler)
+	httpSrv := gokit_foundation.NewHTTPServer(reqid.HTTPMiddleware(httpHandler), gokit_foundation.DefaultHTTPServerConfig())
+
+	addTaskListenSignal(tg)
+	if *adminAddr != "" {
+		addTaskAdminSrv(tg, *adminAddr, metricsObj)
+	}
+	addTaskHttpSrv(tg, *httpAddr, httpSrv)
+	addTaskGRPCSrv(tg, *grpcAddr, grpcSrv)
+	tg.OnReady(func() {
+		logger.Log("main", "all tasks ready")
+	})
+	tg.Run()
+	if err := tg.Err(); err != nil {
+		logger.Log("main", "startup failed", "err", err)
+		os.Exit(1)
+	}
+}
+
+func newHTTPHandler(apiHandler http.Handler, healthSrv *gokit_foundation.HealthCheckServer) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/", apiHandler)
+	mux.Handle("/healthz", healthSrv.HealthzHandler())
+	mux.Handle("/readyz", healthSrv.ReadyzHandler())
+	return mux
+}
+
+// 只有一个实例，不需要等待client刷新实例列表，退出时只将健康状态置为NOT_SERVING
+func onClose() {
+	_ = drainer.Drain()
+}
+
+// 添加后台任务：监听退出信号（第一个添加）
+func addTaskListenSignal(tg *_go.TaskGroup) {
+	tk, _ := _util.ListenSignalTask(logger, onClose)
+	tg.Add(tk).Name("signal").Interrupt(func(err error) {
+		logger.Log("signalTask", "exited", "clean", err)
+	})
+}
+
+// 添加后台任务：管理端口(见gokit_foundation.AdminServer)，在其他服务之前添加，退出时最后关闭
+func addTaskAdminSrv(tg *_go.TaskGroup, addr string, metricsObj *Metrics) {
+	adminSrv := gokit_foundation.NewAdminServer(nil)
+	adminSrv.Handle("/metrics", metricsObj.Handler())
+	adminSrv.Handle("/tasks", tg.Handler())
+	adminSrvTask := func(ctx context.Context) error {
+		logger.Log("NewTaskGroup", "adminSrvTask", "adminSrvAddr", addr)
+
+		lis, err := net.Listen("tcp", addr)
+		if err != nil {
+			return err
+		}
+		_go.TaskReady(ctx)
+		return adminSrv.Serve(lis)
+	}
+	tg.Add(adminSrvTask).Name("adminSrv").WaitReady().Interrupt(func(err error) {
+		closeCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		logger.Log("adminSrvTask", "exited", "err", err, "clean", adminSrv.Shutdown(closeCtx))
+	})
+}
+
+func addTaskHttpSrv(tg *_go.TaskGroup, addr string, httpSrv *gokit_foundation.HTTPServer) {
+	httpSrvTask := func(ctx context.Context) error {
+		logger.Log("NewTaskGroup", "httpSrvTask", "httpSrvAddr", addr)
+
+		lis, err := net.Listen("tcp", addr)
+		if err != nil {
+			return err
+		}
+		_go.TaskReady(ctx)
+		return httpSrv.Serve(lis)
+	}
+	tg.Add(httpSrvTask).Name("httpSrv").WaitReady().Interrupt(func(err error) {
+		if err != nil {
+			logger.Log("httpSrvTask", "exited", "err", err)
+		} else {
+			logger.Log("httpSrvTask", "exited", "clean", drainer.ShutdownHTTP(httpSrv.Server))
+		}
+	})
+}
+
+func addTaskGRPCSrv(tg *_go.TaskGroup, addr string, grpcSrv *grpc.Server) {
+	grpcSrvTask := func(ctx context.Context) error {
+		logger.Log("NewTaskGroup", "grpcSrvTask", "grpcSrvAddr", addr)
+
+		lis, err := net.Listen("tcp", addr)
+		if err != nil {
+			return err
+		}
+		_go.TaskReady(ctx)
+		return grpcSrv.Serve(lis)
+	}
+	tg.Add(grpcSrvTask).Name("grpcSrv").WaitReady().Interrupt(func(err error) {
+		if err != nil {
+			logger.Log("grpcSrvTask", "exited", "err", err)
+		} else {
+			logger.Log("grpcSrvTask", "exited", "clean", nil, "graceful", drainer.StopGRPC(grpcSrv))
+		}
+	})
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-kit/kit/log"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"google.golang.org/grpc"
+	hellopb "hello/pb/gen-go/pb"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	addtransport "new_addsvc/pkg/transport"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestServices(t *testing.T) (Services, *Metrics) {
+	m, err := NewMetrics()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewServices(log.NewNopLogger(), m, stdopentracing.NoopTracer{}), m
+}
+
+func postJSON(t *testing.T, url, body string, rsp interface{}) {
+	r, err := http.Post(url, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(rsp); err != nil {
+		t.Fatalf("url:%s status:%d err:%v", url, r.StatusCode, err)
+	}
+}
+
+// 两个服务的HTTP接口挂在各自的前缀下，聚合接口通过进程内的endpoints调用三个服务
+func TestHTTPHandler(t *testing.T) {
+	svcs, m := newTestServices(t)
+	srv := httptest.NewServer(svcs.HTTPHandler(stdopentracing.NoopTracer{}, log.NewNopLogger()))
+	defer srv.Close()
+
+	var sum struct {
+		V int `json:"v"`
+	}
+	postJSON(t, srv.URL+"/addsvc/sum", `{"a":1,"b":2}`, &sum)
+	if sum.V != 3 {
+		t.Errorf("got sum:%+v", sum)
+	}
+	var created struct {
+		User struct {
+			ID int64 `json:"id"`
+		} `json:"user"`
+		RetCode int `json:"ret_code"`
+	}
+	postJSON(t, srv.URL+"/usersvc/users", `{"name":"Jack","email":"jack@example.com"}`, &created)
+	if created.User.ID == 0 || created.RetCode != 0 {
+		t.Fatalf("got created:%+v", created)
+	}
+
+	r, err := http.Get(srv.URL + "/composite/Jack?a=1&b=2&user_id=" + strconv.FormatInt(created.User.ID, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rsp compositeRsp
+	err = json.NewDecoder(r.Body).Decode(&rsp)
+	r.Body.Close()
+	if err != nil || rsp.Hi == "" || rsp.Sum == nil || *rsp.Sum != 3 || rsp.User == nil || rsp.User.Name != "Jack" || len(rsp.Errors) != 0 {
+		t.Errorf("got composite:%+v err:%v", rsp, err)
+	}
+	// 用户不存在时只有user部分失败
+	r, err = http.Get(srv.URL + "/composite/Jack?a=1&b=2&user_id=999")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsp = compositeRsp{}
+	err = json.NewDecoder(r.Body).Decode(&rsp)
+	r.Body.Close()
+	if err != nil || rsp.Hi == "" || rsp.User != nil || rsp.Errors["user"] == "" {
+		t.Errorf("got composite:%+v err:%v", rsp, err)
+	}
+	if r, err := http.Get(srv.URL + "/composite/Jack?a=x"); err != nil || r.StatusCode != http.StatusBadRequest {
+		t.Errorf("got rsp:%v err:%v", r, err)
+	}
+
+	// 三个服务的指标在同一个/metrics上
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := ioutil.ReadAll(rec.Body)
+	for _, name := range []string{"example_addsvc_request_duration_seconds", "example_hello_request_duration_seconds", "example_usersvc_request_duration_seconds"} {
+		if !strings.Contains(string(body), name) {
+			t.Errorf("metric %s not found", name)
+		}
+	}
+}
+
+// addsvc和hello的grpc服务在同一个端口上
+func TestRegisterGRPC(t *testing.T) {
+	svcs, _ := newTestServices(t)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer()
+	svcs.RegisterGRPC(srv, stdopentracing.NoopTracer{}, log.NewNopLogger())
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	add := addtransport.NewGRPCClient(conn, stdopentracing.NoopTracer{}, log.NewNopLogger())
+	if v, err := add.Sum(ctx, 1, 2); err != nil || v != 3 {
+		t.Errorf("Sum got v:%d err:%v", v, err)
+	}
+	rsp, err := hellopb.NewHelloClient(conn).SayHi(ctx, &hellopb.SayHiRequest{Name: "Jack"})
+	if err != nil || rsp.Reply == "" {
+		t.Errorf("SayHi got rsp:%v err:%v", rsp, err)
+	}
+}
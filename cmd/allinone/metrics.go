@@ -0,0 +1,78 @@
+package main
+
+import (
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/prometheus"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"gokit_foundation"
+	"net/http"
+)
+
+// 三个服务的指标注册在同一个registry上，由管理端口的/metrics上报，指标名与独立部署时相同(subsystem为服务名)
+type Metrics struct {
+	Add     ServiceMetrics
+	Hello   ServiceMetrics
+	Users   ServiceMetrics
+	GRPC    *gokit_foundation.GRPCServerMetrics
+	Panics  metrics.Counter // transport层(grpc拦截器、http handler)被recover的panic数，labels: layer、method
+	handler http.Handler
+}
+
+type ServiceMetrics struct {
+	Duration metrics.Histogram // labels: method、success
+	Panics   metrics.Counter   // endpoint层被recover的panic数，labels: layer、method
+}
+
+func NewMetrics() (*Metrics, error) {
+	reg := stdprometheus.NewRegistry()
+	reg.MustRegister(stdprometheus.NewGoCollector(), stdprometheus.NewProcessCollector(stdprometheus.ProcessCollectorOpts{}))
+	m := &Metrics{handler: promhttp.HandlerFor(reg, promhttp.HandlerOpts{})}
+	for svc, sm := range map[string]*ServiceMetrics{"addsvc": &m.Add, "hello": &m.Hello, "usersvc": &m.Users} {
+		durationVec := stdprometheus.NewHistogramVec(stdprometheus.HistogramOpts{
+			Namespace: "example",
+			Subsystem: svc,
+			Name:      "request_duration_seconds",
+			Help:      "Request duration in seconds.",
+		}, []string{"method", "success"})
+		panicsVec := stdprometheus.NewCounterVec(stdprometheus.CounterOpts{
+			Namespace: "example",
+			Subsystem: svc,
+			Name:      "panics_total",
+			Help:      "Total count of recovered panics by layer and method.",
+		}, []string{"layer", "method"})
+		if err := registerAll(reg, durationVec, panicsVec); err != nil {
+			return nil, err
+		}
+		sm.Duration, sm.Panics = prometheus.NewHistogram(durationVec), prometheus.NewCounter(panicsVec)
+	}
+	panicsVec := stdprometheus.NewCounterVec(stdprometheus.CounterOpts{
+		Namespace: "example",
+		Subsystem: "allinone",
+		Name:      "panics_total",
+		Help:      "Total count of recovered panics in transports by layer and method.",
+	}, []string{"layer", "method"})
+	if err := reg.Register(panicsVec); err != nil {
+		return nil, err
+	}
+	m.Panics = prometheus.NewCounter(panicsVec)
+	grpcMetrics, err := gokit_foundation.NewGRPCServerMetrics(reg, "example", "allinone")
+	if err != nil {
+		return nil, err
+	}
+	m.GRPC = grpcMetrics
+	return m, nil
+}
+
+func registerAll(reg stdprometheus.Registerer, cs ...stdprometheus.Collector) error {
+	for _, c := range cs {
+		if err := reg.Register(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Metrics) Handler() http.Handler {
+	return m.handler
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	endpoint1 "github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"gokit_foundation/idempotency"
+	"gokit_foundation/mwchain"
+	"gokit_foundation/tenant"
+	"google.golang.org/grpc"
+	"hello/db"
+	hellopb "hello/pb/gen-go/pb"
+	helloendpoint "hello/pkg/endpoint"
+	hellogrpc "hello/pkg/grpc"
+	helloservice "hello/pkg/service"
+	"net/http"
+	"new_addsvc/pb/gen-go/addsvcpb"
+	addendpoint "new_addsvc/pkg/endpoint"
+	addservice "new_addsvc/pkg/service"
+	addtransport "new_addsvc/pkg/transport"
+	userendpoint "usersvc/pkg/endpoint"
+	"usersvc/pkg/repository/repotest"
+	userservice "usersvc/pkg/service"
+	usertransport "usersvc/pkg/transport"
+)
+
+// 三个服务的endpoints，service层和endpoint层与独立部署时相同，外部依赖替换为进程内的实现(见main.go)
+type Services struct {
+	Add   addendpoint.AddSvcEndpoints
+	Hello helloendpoint.Endpoints
+	Users userendpoint.UserSvcEndpoints
+}
+
+func NewServices(logger log.Logger, m *Metrics, tracer stdopentracing.Tracer) Services {
+	return Services{
+		Add:   newAddEndpoints(log.With(logger, "svc", "addsvc"), m.Add, tracer),
+		Hello: newHelloEndpoints(log.With(logger, "svc", "hello"), m.Hello),
+		Users: newUserEndpoints(log.With(logger, "svc", "usersvc"), m.Users, tracer),
+	}
+}
+
+// 不使用redis：没有response缓存，service层的计数指标不上报
+func newAddEndpoints(logger log.Logger, m ServiceMetrics, tracer stdopentracing.Tracer) addendpoint.AddSvcEndpoints {
+	svc := addservice.New(logger, nil, nil, nil, nil)
+	return addendpoint.New(svc, logger, tracer, addendpoint.Deps{Duration: m.Duration, Panics: m.Panics})
+}
+
+// 问候记录保存在内存中，中间件与hello/cmd/service的getEndpointMiddleware相同
+func newHelloEndpoints(logger log.Logger, m ServiceMetrics) helloendpoint.Endpoints {
+	svc := helloservice.New([]helloservice.Middleware{helloservice.LoggingMiddleware(logger)}, logger,
+		db.NewMemGreetingRepo(db.DefMaxGreetingsPerKey))
+	mw, err := mwchain.New().
+		WithMetrics(func(method string) endpoint1.Middleware {
+			return helloendpoint.InstrumentingMiddleware(m.Duration.With("method", method))
+		}).
+		WithLogging(func(method string) endpoint1.Middleware {
+			return helloendpoint.LoggingMiddleware(log.With(logger, "method", method))
+		}).
+		WithRecovery(logger, m.Panics).
+		Middlewares("SayHi", "MakeADate", "UpdateUserInfo", "ListGreetings")
+	if err != nil {
+		panic(err)
+	}
+	return helloendpoint.New(svc, mw)
+}
+
+// 用户保存在内存中(repotest.Memory)，不发布领域事件、不写审计日志、不启用JWT认证
+func newUserEndpoints(logger log.Logger, m ServiceMetrics, tracer stdopentracing.Tracer) userendpoint.UserSvcEndpoints {
+	svc := userservice.New(logger, repotest.NewMemory(), false)
+	return userendpoint.New(svc, m.Duration, m.Panics, tracer, idempotency.NewMemStore(10000), nil, tenant.Config{}, nil, logger)
+}
+
+// 两个服务的HTTP/JSON接口分别挂在/addsvc/和/usersvc/下，路径与独立部署时相同
+func (s Services) HTTPHandler(tracer stdopentracing.Tracer, logger log.Logger) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/addsvc/", http.StripPrefix("/addsvc", addtransport.NewHTTPHandler(s.Add, tracer, logger)))
+	mux.Handle("/usersvc/", http.StripPrefix("/usersvc", usertransport.NewHTTPHandler(s.Users, tracer, logger)))
+	mux.Handle("/composite/", compositeHandler(s.Hello, s.Add, s.Users))
+	return mux
+}
+
+// addsvc的pb.Add和hello的pb.Hello注册到同一个grpc server
+func (s Services) RegisterGRPC(srv *grpc.Server, tracer stdopentracing.Tracer, logger log.Logger) {
+	addsvcpb.RegisterAddServer(srv, addtransport.NewGRPCServer(s.Add, tracer, logger))
+	hellopb.RegisterHelloServer(srv, hellogrpc.NewGRPCServer(s.Hello, nil))
+}
+
+// 客户端侧的接口直接由endpoints实现，与网络client(如new_addsvc/client.New)可以互相替换
+var (
+	_ helloservice.HelloService = helloendpoint.Endpoints{}
+	_ addservice.Service        = addendpoint.AddSvcEndpoints{}
+	_ userservice.Service       = userendpoint.UserSvcEndpoints{}
+)
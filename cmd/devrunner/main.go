@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+/*
+devrunner 在本地同时启动多个new_addsvc、hello实例，用于演示负载均衡和故障转移：
+-	先go build各服务，再为每个实例分配空闲端口启动，不需要手动指定各实例的端口
+-	各实例自己注册到consul(地址见-consul.addr，通过环境变量CONSUL_ADDR传给实例)，gateway、addcli等通过consul发现所有实例
+-	所有实例的日志输出到devrunner的stdout，每行带上实例名前缀，如[addsvc-2]
+-	某个实例退出(如通过其管理端口POST /quitquitquit)后其他实例继续运行，可以观察client的重试和实例列表的刷新
+
+	go run ./cmd/devrunner -addsvc 3 -hello 2
+	curl -X POST localhost:<admin port>/quitquitquit  # 下线其中一个实例
+
+Ctrl+C或SIGTERM时所有实例优雅退出，超过-stop.timeout仍未退出的实例被kill，再次Ctrl+C立即kill
+注意：空闲端口在启动实例前释放，极少数情况下会被其他进程抢占，此时该实例启动失败，重新运行即可
+*/
+
+// 一种可以启动多个实例的服务
+type service struct {
+	name  string
+	dir   string   // 服务的go module目录，相对仓库根目录
+	pkg   string   // main包，相对dir
+	ports []string // 需要分配的端口，仅用于打印
+	// host为-advertise，ports与上面一一对应
+	args func(host string, ports []int) []string
+}
+
+var services = []service{
+	{
+		name: "addsvc", dir: "demo_project/new_addsvc", pkg: "./cmd/addsvc", ports: []string{"grpc", "http", "admin"},
+		args: func(host string, ports []int) []string {
+			args := []string{"serve", "-grpc.port", strconv.Itoa(ports[0]), "-http.port", strconv.Itoa(ports[1]), "-admin.port", strconv.Itoa(ports[2])}
+			if host != "" {
+				args = append(args, "-advertise", host)
+			}
+			return args
+		},
+	},
+	{
+		// hello注册到consul的地址为-grpc-addr的host，为空时为localhost
+		name: "hello", dir: "demo_project/hello", pkg: "./cmd", ports: []string{"grpc", "debug", "admin", "ws"},
+		args: func(host string, ports []int) []string {
+			return []string{"-grpc-addr", net.JoinHostPort(host, strconv.Itoa(ports[0])),
+				"-debug.addr", ":" + strconv.Itoa(ports[1]), "-admin.addr", ":" + strconv.Itoa(ports[2]), "-ws.addr", ":" + strconv.Itoa(ports[3])}
+		},
+	},
+}
+
+type instance struct {
+	name  string
+	svc   service
+	ports []int
+	cmd   *exec.Cmd
+}
+
+func main() {
+	fs := flag.NewFlagSet("devrunner", flag.ExitOnError)
+	var (
+		root        = fs.String("root", ".", "repository root")
+		consulAddr  = fs.String("consul.addr", "", "consul agent address passed to instances as CONSUL_ADDR, default taken from the environment")
+		advertise   = fs.String("advertise", "", "host registered to consul, default auto detected by addsvc and localhost for hello")
+		stopTimeout = fs.Duration("stop.timeout", 15*time.Second, "max time to wait for instances to exit gracefully, kill them after it")
+	)
+	counts := make(map[string]*int, len(services))
+	for _, svc := range services {
+		def := 3
+		if svc.name == "hello" {
+			def = 1
+		}
+		counts[svc.name] = fs.Int(svc.name, def, "number of "+svc.name+" instances")
+	}
+	fs.Parse(os.Args[1:])
+
+	out := &syncWriter{w: os.Stdout}
+	logf := func(format string, a ...interface{}) { fmt.Fprintf(prefixed(out, "devrunner"), format+"\n", a...) }
+
+	binDir, err := ioutil.TempDir("", "devrunner")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "devrunner:", err)
+		os.Exit(1)
+	}
+	defer os.RemoveAll(binDir)
+
+	env := os.Environ()
+	if *consulAddr != "" {
+		env = append(env, "CONSUL_ADDR="+*consulAddr)
+	}
+	var instances []*instance
+	for _, svc := range services {
+		n := *counts[svc.name]
+		if n <= 0 {
+			continue
+		}
+		bin := filepath.Join(binDir, svc.name)
+		logf("building %s", svc.name)
+		if err := build(filepath.Join(*root, svc.dir), svc.pkg, bin); err != nil {
+			logf("build %s failed: %v", svc.name, err)
+			os.Exit(1)
+		}
+		for i := 1; i <= n; i++ {
+			ports, err := freePorts(len(svc.ports))
+			if err != nil {
+				logf("allocate ports failed: %v", err)
+				os.Exit(1)
+			}
+			name := fmt.Sprintf("%s-%d", svc.name, i)
+			cmd := exec.Command(bin, svc.args(*advertise, ports)...)
+			// 与在服务目录下直接运行一致，如new_addsvc的相对路径配置文件
+			cmd.Dir = filepath.Join(*root, svc.dir)
+			cmd.Env = env
+			cmd.Stdout, cmd.Stderr = prefixed(out, name), prefixed(out, name)
+			instances = append(instances, &instance{name: name, svc: svc, ports: ports, cmd: cmd})
+		}
+	}
+	if len(instances) == 0 {
+		logf("no instance to run")
+		return
+	}
+
+	exited := make(chan *instance, len(instances))
+	var running []*instance
+	for _, ins := range instances {
+		if err := ins.cmd.Start(); err != nil {
+			logf("start %s failed: %v", ins.name, err)
+			continue
+		}
+		running = append(running, ins)
+		go func(ins *instance) {
+			err := ins.cmd.Wait()
+			logf("%s exited: %v", ins.name, err)
+			exited <- ins
+		}(ins)
+	}
+	printInstances(out, running)
+
+	sc := make(chan os.Signal, 2)
+	signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM)
+	var killTimer <-chan time.Time
+	stopping := false
+	for left := len(running); left > 0; {
+		select {
+		case <-exited:
+			left--
+		case s := <-sc:
+			if stopping {
+				logf("received %v again, kill all instances", s)
+				signalAll(running, os.Kill)
+				continue
+			}
+			stopping = true
+			logf("received %v, stopping %d instances", s, left)
+			// 终端中Ctrl+C的SIGINT会发给整个进程组，实例已经收到，再发一次会使其跳过优雅退出直接结束
+			if s != syscall.SIGINT {
+				signalAll(running, syscall.SIGTERM)
+			}
+			killTimer = time.After(*stopTimeout)
+		case <-killTimer:
+			logf("stop timeout, kill all instances")
+			signalAll(running, os.Kill)
+		}
+	}
+}
+
+func build(dir, pkg, bin string) error {
+	cmd := exec.Command("go", "build", "-o", bin, pkg)
+	cmd.Dir = dir
+	cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+	return cmd.Run()
+}
+
+// 同时占用n个端口后再一起释放，保证返回的端口互不相同
+func freePorts(n int) ([]int, error) {
+	ports := make([]int, 0, n)
+	for i := 0; i < n; i++ {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return nil, err
+		}
+		defer lis.Close()
+		ports = append(ports, lis.Addr().(*net.TCPAddr).Port)
+	}
+	return ports, nil
+}
+
+// 已经退出的实例发送信号会失败，忽略即可
+func signalAll(instances []*instance, sig os.Signal) {
+	for _, ins := range instances {
+		_ = ins.cmd.Process.Signal(sig)
+	}
+}
+
+func printInstances(w io.Writer, instances []*instance) {
+	var buf bytes.Buffer
+	tw := tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "INSTANCE\tPID\tPORTS")
+	for _, ins := range instances {
+		ports := make([]string, len(ins.ports))
+		for i, p := range ins.ports {
+			ports[i] = fmt.Sprintf("%s=%d", ins.svc.ports[i], p)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\n", ins.name, ins.cmd.Process.Pid, strings.Join(ports, " "))
+	}
+	tw.Flush()
+	_, _ = w.Write(buf.Bytes())
+}
+
+// 多个实例共用，保证每次Write(一行或多行)不会与其他实例交错
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *syncWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(p)
+}
+
+// 按行在开头加上[name]，不完整的行缓存到下次Write
+type prefixWriter struct {
+	prefix []byte
+	out    io.Writer
+	buf    []byte
+}
+
+func prefixed(out io.Writer, name string) *prefixWriter {
+	return &prefixWriter{prefix: []byte("[" + name + "] "), out: out}
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	var lines []byte
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			break
+		}
+		lines = append(lines, p.prefix...)
+		lines = append(lines, p.buf[:i+1]...)
+		p.buf = p.buf[i+1:]
+	}
+	if len(lines) > 0 {
+		if _, err := p.out.Write(lines); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := prefixed(&buf, "addsvc-1")
+	for _, s := range []string{"ts=1 msg=a\nts=2", " msg=b\n", "ts=3\nts=4\n"} {
+		if n, err := w.Write([]byte(s)); n != len(s) || err != nil {
+			t.Fatalf("got n:%d err:%v", n, err)
+		}
+	}
+	want := "[addsvc-1] ts=1 msg=a\n[addsvc-1] ts=2 msg=b\n[addsvc-1] ts=3\n[addsvc-1] ts=4\n"
+	if buf.String() != want {
+		t.Errorf("got:%q want:%q", buf.String(), want)
+	}
+	// 不完整的行不输出
+	w.Write([]byte("partial"))
+	if buf.String() != want {
+		t.Errorf("got:%q", buf.String())
+	}
+}
+
+func TestFreePorts(t *testing.T) {
+	ports, err := freePorts(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ports) != 3 || ports[0] == ports[1] || ports[1] == ports[2] || ports[0] == ports[2] {
+		t.Errorf("got:%v", ports)
+	}
+}
+
+func TestServiceArgs(t *testing.T) {
+	want := map[string]string{
+		"addsvc": "serve -grpc.port 1 -http.port 2 -admin.port 3 -advertise 10.0.0.1",
+		"hello":  "-grpc-addr 10.0.0.1:1 -debug.addr :2 -admin.addr :3 -ws.addr :4",
+	}
+	for _, svc := range services {
+		if got := strings.Join(svc.args("10.0.0.1", []int{1, 2, 3, 4}), " "); got != want[svc.name] {
+			t.Errorf("%s got:%s want:%s", svc.name, got, want[svc.name])
+		}
+	}
+}
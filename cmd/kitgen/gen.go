@@ -0,0 +1,651 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// Spec 生成一个服务骨架需要的信息
+type Spec struct {
+	Name     string // 服务名，同时是go module名和目录名，如greeter
+	Service  string // pb中的service名，如Greeter
+	Methods  []Method
+	Proto    bool   // 接口使用pb的request/response，见Method
+	PBImport string // pb包的import路径
+	// go.mod中replace的相对路径
+	Foundation string
+	GoUtil     string
+	Cmdline    string // 生成时使用的命令，写入main.go
+}
+
+// service接口名，与hello服务的HelloService一致
+func (s Spec) Iface() string { return s.Service + "Service" }
+
+// 生成的文件，路径相对于服务目录
+type genFile struct {
+	path string
+	tmpl *template.Template
+}
+
+var funcs = template.FuncMap{
+	"inc": func(i int) int { return i + 1 },
+}
+
+func mustTmpl(name, text string) *template.Template {
+	return template.Must(template.New(name).Funcs(funcs).Parse(text))
+}
+
+var files = []genFile{
+	{"go.mod", mustTmpl("go.mod", goModTmpl)},
+	{"cmd/main.go", mustTmpl("main", mainTmpl)},
+	{"cmd/service/service.go", mustTmpl("cmd_service", cmdServiceTmpl)},
+	{"pkg/service/service.go", mustTmpl("service", serviceTmpl)},
+	{"pkg/service/middleware.go", mustTmpl("service_mw", serviceMWTmpl)},
+	{"pkg/endpoint/endpoint.go", mustTmpl("endpoint", endpointTmpl)},
+	{"pkg/endpoint/middleware.go", mustTmpl("endpoint_mw", endpointMWTmpl)},
+	{"pkg/grpc/handler.go", mustTmpl("grpc_handler", grpcHandlerTmpl)},
+	{"pb/proto/compile.sh", mustTmpl("compile", compileTmpl)},
+}
+
+// 签名形式时根据方法生成proto文件
+var protoFile = genFile{"", mustTmpl("proto", protoTmpl)}
+
+// render 返回 路径=>内容，go文件经过gofmt
+func render(spec Spec) (map[string][]byte, error) {
+	out := map[string][]byte{}
+	all := files
+	if !spec.Proto {
+		all = append(all, genFile{"pb/proto/" + spec.Name + ".proto", protoFile.tmpl})
+	}
+	for _, f := range all {
+		var buf bytes.Buffer
+		if err := f.tmpl.Execute(&buf, spec); err != nil {
+			return nil, fmt.Errorf("%s: %v", f.path, err)
+		}
+		b := buf.Bytes()
+		if strings.HasSuffix(f.path, ".go") {
+			formatted, err := format.Source(b)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v\n%s", f.path, err, b)
+			}
+			b = formatted
+		}
+		out[f.path] = b
+	}
+	return out, nil
+}
+
+// write 将文件写入dir，force为false时若有文件已存在则不写入任何文件
+func write(dir string, out map[string][]byte, force bool) error {
+	if !force {
+		for path := range out {
+			if _, err := os.Stat(filepath.Join(dir, path)); err == nil {
+				return fmt.Errorf("%s already exists, use -force to overwrite", filepath.Join(dir, path))
+			}
+		}
+	}
+	for path, b := range out {
+		full := filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			return err
+		}
+		mode := os.FileMode(0644)
+		if strings.HasSuffix(path, ".sh") {
+			mode = 0755
+		}
+		if err := ioutil.WriteFile(full, b, mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const goModTmpl = `module {{.Name}}
+
+go 1.12
+
+require (
+	github.com/go-kit/kit v0.10.0
+	github.com/golang/protobuf v1.4.2
+	github.com/oklog/oklog v0.3.2
+	github.com/opentracing/opentracing-go v1.2.0
+	github.com/prometheus/client_golang v1.7.1
+	go-util v0.0.0-00010101000000-000000000000
+	gokit_foundation v0.0.0-00010101000000-000000000000
+	google.golang.org/grpc v1.32.0
+)
+
+replace (
+	go-util => {{.GoUtil}}
+	gokit_foundation => {{.Foundation}}
+)
+`
+
+const mainTmpl = `package main
+
+import service "{{.Name}}/cmd/service"
+
+// 由kitgen生成：{{.Cmdline}}
+
+/*
+{{.Name}}服务依赖了一些外部中间件如下：
+-	强依赖(若连不上则无法启动)
+	-	consul
+-	弱依赖(不需要连接或连不上也能启动)
+	-	prometheus
+*/
+
+func main() {
+	service.Run()
+}
+`
+
+const cmdServiceTmpl = `package service
+
+import (
+	"flag"
+	"fmt"
+	"gokit_foundation"
+	"gokit_foundation/errs"
+	"gokit_foundation/propagation"
+	pb "{{.PBImport}}"
+	endpoint "{{.Name}}/pkg/endpoint"
+	grpc "{{.Name}}/pkg/grpc"
+	service "{{.Name}}/pkg/service"
+	"net"
+	http1 "net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	endpoint1 "github.com/go-kit/kit/endpoint"
+	log "github.com/go-kit/kit/log"
+	prometheus "github.com/go-kit/kit/metrics/prometheus"
+	opentracing "github.com/go-kit/kit/tracing/opentracing"
+	grpctransport "github.com/go-kit/kit/transport/grpc"
+	group "github.com/oklog/oklog/pkg/group"
+	opentracinggo "github.com/opentracing/opentracing-go"
+	prometheus1 "github.com/prometheus/client_golang/prometheus"
+	promhttp "github.com/prometheus/client_golang/prometheus/promhttp"
+	grpc1 "google.golang.org/grpc"
+)
+
+const svcName = "{{.Name}}"
+
+var fs = flag.NewFlagSet(svcName, flag.ExitOnError)
+var debugAddr = fs.String("debug.addr", ":8080", "Debug and metrics listen address")
+var grpcAddr = fs.String("grpc-addr", ":8081", "gRPC listen address")
+var advertiseHost = fs.String("advertise.host", "127.0.0.1", "host registered to consul, must be reachable by consul and clients")
+var consulAddr = fs.String("consul.addr", "", "consul agent address, default env CONSUL_ADDR or 127.0.0.1:8500")
+
+func Run() {
+	fs.Parse(os.Args[1:])
+
+	_, port, err := net.SplitHostPort(*grpcAddr)
+	if err != nil {
+		panic(fmt.Sprintf("Run: wrong grpc-addr %q", *grpcAddr))
+	}
+	grpcPort, err := strconv.Atoi(port)
+	if err != nil {
+		panic(fmt.Sprintf("Run: wrong grpc-addr %q", *grpcAddr))
+	}
+	gokit_foundation.ConsulAddr = *consulAddr
+
+	logger := gokit_foundation.NewLogger(nil)
+	tracer := opentracinggo.GlobalTracer()
+
+	svc := service.New(getServiceMiddleware(logger), logger)
+	eps := endpoint.New(svc, getEndpointMiddleware(logger))
+	g := &group.Group{}
+	initGRPCHandler(g, eps, logger, tracer, *advertiseHost, grpcPort)
+	initMetricsEndpoint(g, logger)
+	initCancelInterrupt(g)
+
+	logger.Log("exit", g.Run())
+}
+
+func defaultGRPCOptions(logger log.Logger, tracer opentracinggo.Tracer) map[string][]grpctransport.ServerOption {
+	return map[string][]grpctransport.ServerOption{
+	{{- range .Methods}}
+		"{{.Name}}": {grpctransport.ServerErrorHandler(errs.NewLogErrorHandler(logger)), propagation.GRPCServerBefore(), grpctransport.ServerBefore(opentracing.GRPCToContext(tracer, "{{.Name}}", logger))},
+	{{- end}}
+	}
+}
+
+func initGRPCHandler(g *group.Group, endpoints endpoint.Endpoints, logger log.Logger, tracer opentracinggo.Tracer, host string, port int) {
+	options := defaultGRPCOptions(logger, tracer)
+	// Add your GRPC options here
+
+	// grpc层的调用数、耗时等指标，与endpoint层的request_duration_seconds一样在/metrics上报
+	grpcMetrics, err := gokit_foundation.NewGRPCServerMetrics(prometheus1.DefaultRegisterer, "example", svcName)
+	if err != nil {
+		logger.Log("transport", "gRPC", "WARNING", "register grpc metrics failed", "err", err)
+	}
+	baseServer := grpc1.NewServer(
+		grpc1.UnaryInterceptor(grpcMetrics.UnaryServerInterceptor()),
+		grpc1.StreamInterceptor(grpcMetrics.StreamServerInterceptor()),
+	)
+	pb.Register{{.Service}}Server(baseServer, grpc.NewGRPCServer(endpoints, options))
+	// consul通过grpc健康检查判断实例是否存活
+	gokit_foundation.RegisterGRPCHealthSrv(baseServer)
+
+	g.Add(func() error {
+		logger.Log("transport", "gRPC", "addr", *grpcAddr)
+		grpcListener, err := net.Listen("tcp", *grpcAddr)
+		if err != nil {
+			return err
+		}
+		// 开始监听后再注册到consul，否则健康检查会失败
+		if err := gokit_foundation.RegisterSvc(svcName, host, port, nil); err != nil {
+			grpcListener.Close()
+			return err
+		}
+		return baseServer.Serve(grpcListener)
+	}, func(error) {
+		// 先下线，注销失败会重试几次，再等待处理中的请求结束
+		_ = gokit_foundation.ConsulDeregisterWithRetry(logger, 2, time.Millisecond*200)
+		baseServer.GracefulStop()
+	})
+}
+
+func getServiceMiddleware(logger log.Logger) (mw []service.Middleware) {
+	mw = []service.Middleware{service.LoggingMiddleware(logger)}
+	// Append your middleware here
+
+	return
+}
+
+func getEndpointMiddleware(logger log.Logger) (mw map[string][]endpoint1.Middleware) {
+	mw = map[string][]endpoint1.Middleware{}
+	duration := prometheus.NewSummaryFrom(prometheus1.SummaryOpts{
+		Help:      "Request duration in seconds.",
+		Name:      "request_duration_seconds",
+		Namespace: "example",
+		Subsystem: svcName,
+	}, []string{"method", "success"})
+	for _, method := range []string{ {{- range $i, $m := .Methods}}{{if $i}}, {{end}}"{{$m.Name}}"{{end -}} } {
+		mw[method] = []endpoint1.Middleware{
+			endpoint.LoggingMiddleware(log.With(logger, "method", method)),
+			endpoint.InstrumentingMiddleware(duration.With("method", method)),
+		}
+	}
+	// Add you endpoint middleware here
+	return
+}
+
+func initMetricsEndpoint(g *group.Group, logger log.Logger) {
+	http1.DefaultServeMux.Handle("/metrics", promhttp.Handler())
+
+	var debugListener net.Listener
+	var err error
+
+	g.Add(func() error {
+		logger.Log("transport", "debug/HTTP", "addr", *debugAddr)
+		debugListener, err = net.Listen("tcp", *debugAddr)
+		if err != nil {
+			return err
+		}
+		return http1.Serve(debugListener, http1.DefaultServeMux)
+	}, func(error) {
+		if debugListener != nil {
+			debugListener.Close()
+		}
+	})
+}
+
+func initCancelInterrupt(g *group.Group) {
+	cancelInterrupt := make(chan struct{})
+	g.Add(func() error {
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
+		select {
+		case sig := <-c:
+			return fmt.Errorf("received signal %s", sig)
+		case <-cancelInterrupt:
+			return nil
+		}
+	}, func(error) {
+		close(cancelInterrupt)
+	})
+}
+`
+
+const serviceTmpl = `package service
+
+import (
+	"context"
+	{{- if .Proto}}
+	pb "{{.PBImport}}"
+	{{- end}}
+
+	"github.com/go-kit/kit/log"
+)
+
+// {{.Iface}} describes the service.
+type {{.Iface}} interface {
+{{- range .Methods}}
+	{{.Signature}}
+{{- end}}
+}
+
+type basic{{.Iface}} struct {
+	logger log.Logger
+}
+
+// NewBasic{{.Iface}} returns a naive, stateless implementation of {{.Iface}}.
+func NewBasic{{.Iface}}(logger log.Logger) {{.Iface}} {
+	return &basic{{.Iface}}{logger: logger}
+}
+
+// New returns a {{.Iface}} with all of the expected middleware wired in.
+func New(middleware []Middleware, logger log.Logger) {{.Iface}} {
+	var svc {{.Iface}} = NewBasic{{.Iface}}(logger)
+	for _, m := range middleware {
+		svc = m(svc)
+	}
+	return svc
+}
+{{range .Methods}}
+func (svc *basic{{$.Iface}}) {{.Signature}} {
+	{{- if .Proto}}
+	rsp = &pb.{{.PBResponse}}{}
+	{{- end}}
+	// TODO implement the business logic of {{.Name}}
+	return
+}
+{{end}}
+`
+
+const serviceMWTmpl = `package service
+
+import (
+	"context"
+	{{- if .Proto}}
+	pb "{{.PBImport}}"
+	{{- end}}
+
+	log "github.com/go-kit/kit/log"
+)
+
+// Middleware describes a service middleware.
+type Middleware func({{.Iface}}) {{.Iface}}
+
+type loggingMiddleware struct {
+	logger log.Logger
+	next   {{.Iface}}
+}
+
+// LoggingMiddleware takes a logger as a dependency
+// and returns a {{.Iface}} Middleware.
+func LoggingMiddleware(logger log.Logger) Middleware {
+	return func(next {{.Iface}}) {{.Iface}} {
+		return &loggingMiddleware{logger, next}
+	}
+}
+{{range .Methods}}
+func (mw loggingMiddleware) {{.Signature}} {
+	defer func() {
+		mw.logger.Log("method", "{{.Name}}", {{with .LogKVs}}{{.}}, {{end}}"err", err)
+	}()
+	return mw.next.{{.Name}}({{.CallArgs}})
+}
+{{end}}
+`
+
+const endpointTmpl = `package endpoint
+
+import (
+	"context"
+	{{- if .Proto}}
+	pb "{{.PBImport}}"
+	{{- end}}
+	service "{{.Name}}/pkg/service"
+
+	endpoint "github.com/go-kit/kit/endpoint"
+)
+
+// Endpoints collects all of the endpoints that compose a {{.Name}} service. It's
+// meant to be used as a helper struct, to collect all of the endpoints into a
+// single parameter.
+type Endpoints struct {
+{{- range .Methods}}
+	{{.Name}}Endpoint endpoint.Endpoint
+{{- end}}
+}
+
+// New returns a Endpoints struct that wraps the provided service, and wires in all of the
+// expected endpoint middlewares
+func New(s service.{{.Iface}}, mdw map[string][]endpoint.Middleware) Endpoints {
+	eps := Endpoints{
+	{{- range .Methods}}
+		{{.Name}}Endpoint: Make{{.Name}}Endpoint(s),
+	{{- end}}
+	}
+	{{- range .Methods}}
+	for _, m := range mdw["{{.Name}}"] {
+		eps.{{.Name}}Endpoint = m(eps.{{.Name}}Endpoint)
+	}
+	{{- end}}
+	return eps
+}
+
+// Failure is an interface that should be implemented by response types.
+// Response encoders can check if responses are Failer, and if so they've
+// failed, and if so encode them using a separate write path based on the error.
+type Failure interface {
+	Failed() error
+}
+{{range .Methods}}
+// {{.Name}}Request collects the request parameters for the {{.Name}} method.
+type {{.Name}}Request struct {
+	{{- if .Proto}}
+	P1 *pb.{{.PBRequest}} ` + "`json:\"p1\"`" + `
+	{{- else}}
+	{{- range .Params}}
+	{{.Exported}} {{.GoType}} ` + "`json:\"{{.Snake}}\"`" + `
+	{{- end}}
+	{{- end}}
+}
+
+// {{.Name}}Response collects the response parameters for the {{.Name}} method.
+// 业务err放在response中，endpoint返回的err只用于系统级异常(会被断路器等mw捕获)
+type {{.Name}}Response struct {
+	{{- if .Proto}}
+	P0 *pb.{{.PBResponse}} ` + "`json:\"p0\"`" + `
+	{{- else}}
+	{{- range .Results}}
+	{{.Exported}} {{.GoType}} ` + "`json:\"{{.Snake}}\"`" + `
+	{{- end}}
+	{{- end}}
+	Err error ` + "`json:\"-\"`" + `
+}
+
+// Make{{.Name}}Endpoint returns an endpoint that invokes {{.Name}} on the service.
+func Make{{.Name}}Endpoint(svc service.{{$.Iface}}) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		{{- if or .Proto .Params}}
+		req := request.(*{{.Name}}Request)
+		{{- end}}
+		{{- if .Proto}}
+		rsp, err := svc.{{.Name}}(ctx, req.P1)
+		return &{{.Name}}Response{P0: rsp, Err: err}, nil
+		{{- else}}
+		{{range .Results}}{{.Name}}, {{end}}err := svc.{{.Name}}(ctx{{range .Params}}, req.{{.Exported}}{{end}})
+		return &{{.Name}}Response{ {{- range .Results}}{{.Exported}}: {{.Name}}, {{end}}Err: err}, nil
+		{{- end}}
+	}
+}
+
+// Failed implements Failure.
+func (r {{.Name}}Response) Failed() error {
+	return r.Err
+}
+
+// {{.Name}} implements Service. Primarily useful in a client.
+func (eps Endpoints) {{.Signature}} {
+	{{- if .Proto}}
+	response, err := eps.{{.Name}}Endpoint(ctx, &{{.Name}}Request{P1: req})
+	{{- else}}
+	response, err := eps.{{.Name}}Endpoint(ctx, &{{.Name}}Request{ {{- range $i, $f := .Params}}{{if $i}}, {{end}}{{$f.Exported}}: {{$f.Name}}{{end -}} })
+	{{- end}}
+	if err != nil {
+		return
+	}
+	r := response.(*{{.Name}}Response)
+	return {{if .Proto}}r.P0, {{else}}{{range .Results}}r.{{.Exported}}, {{end}}{{end}}r.Err
+}
+{{end}}
+`
+
+const endpointMWTmpl = `package endpoint
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	endpoint "github.com/go-kit/kit/endpoint"
+	log "github.com/go-kit/kit/log"
+	metrics "github.com/go-kit/kit/metrics"
+)
+
+// InstrumentingMiddleware returns an endpoint middleware that records
+// the duration of each invocation to the passed histogram. The middleware adds
+// a single field: "success", which is "true" if no error is returned, and
+// "false" otherwise.
+func InstrumentingMiddleware(duration metrics.Histogram) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+			defer func(begin time.Time) {
+				duration.With("success", fmt.Sprint(err == nil)).Observe(time.Since(begin).Seconds())
+			}(time.Now())
+			return next(ctx, request)
+		}
+	}
+}
+
+// LoggingMiddleware returns an endpoint middleware that logs the
+// duration of each invocation, and the resulting error, if any.
+func LoggingMiddleware(logger log.Logger) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+			defer func(begin time.Time) {
+				logger.Log("transport_error", err, "took", time.Since(begin))
+			}(time.Now())
+			return next(ctx, request)
+		}
+	}
+}
+`
+
+const grpcHandlerTmpl = `package grpc
+
+import (
+	"context"
+	pb "{{.PBImport}}"
+	endpoint "{{.Name}}/pkg/endpoint"
+
+	grpc "github.com/go-kit/kit/transport/grpc"
+)
+
+type grpcServer struct {
+{{- range .Methods}}
+	{{.Lower}} grpc.Handler
+{{- end}}
+}
+
+// NewGRPCServer makes a set of endpoints available as a gRPC {{.Service}}Server
+func NewGRPCServer(endpoints endpoint.Endpoints, options map[string][]grpc.ServerOption) pb.{{.Service}}Server {
+	return &grpcServer{
+	{{- range .Methods}}
+		{{.Lower}}: grpc.NewServer(endpoints.{{.Name}}Endpoint, decode{{.Name}}Request, encode{{.Name}}Response, options["{{.Name}}"]...),
+	{{- end}}
+	}
+}
+{{- if not .Proto}}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+{{- end}}
+{{range .Methods}}
+func decode{{.Name}}Request(_ context.Context, r interface{}) (interface{}, error) {
+	{{- if or .Proto .Params}}
+	req := r.(*pb.{{.PBRequest}})
+	{{- end}}
+	{{- if .Proto}}
+	return &endpoint.{{.Name}}Request{P1: req}, nil
+	{{- else}}
+	return &endpoint.{{.Name}}Request{ {{- range $i, $f := .Params}}{{if $i}}, {{end}}{{$f.Exported}}: {{$f.FromPB (print "req." $f.PBName)}}{{end -}} }, nil
+	{{- end}}
+}
+
+func encode{{.Name}}Response(_ context.Context, r interface{}) (interface{}, error) {
+	rsp := r.(*endpoint.{{.Name}}Response)
+	{{- if .Proto}}
+	// pb的response中没有err字段，业务err作为grpc的err返回
+	if rsp.Err != nil {
+		return nil, rsp.Err
+	}
+	return rsp.P0, nil
+	{{- else}}
+	return &pb.{{.PBResponse}}{ {{- range .Results}}{{.PBName}}: {{.ToPB (print "rsp." .Exported)}}, {{end}}Err: errString(rsp.Err)}, nil
+	{{- end}}
+}
+
+func (g *grpcServer) {{.Name}}(ctx context.Context, req *pb.{{.PBRequest}}) (*pb.{{.PBResponse}}, error) {
+	_, rep, err := g.{{.Lower}}.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return rep.(*pb.{{.PBResponse}}), nil
+}
+{{end}}
+`
+
+const compileTmpl = `#!/usr/bin/env sh
+
+# 需要安装protoc和protoc-gen-go，见demo_project/hello/pb/proto/compile.sh
+# 生成的代码位于{{.PBImport}}(见proto文件的go_package)
+
+cd "$(dirname "$0")" || exit 1
+protoc *.proto --go_out=plugins=grpc:../../../
+`
+
+const protoTmpl = `syntax = "proto3";
+
+package pb;
+
+option go_package = "{{.PBImport}};pb";
+
+service {{.Service}} {
+{{- range .Methods}}
+    rpc {{.Name}} ({{.PBRequest}}) returns ({{.PBResponse}});
+{{- end}}
+}
+{{range .Methods}}
+message {{.PBRequest}} {
+{{- range $i, $f := .Params}}
+    {{$f.ProtoType}} {{$f.Snake}} = {{inc $i}};
+{{- end}}
+}
+
+message {{.PBResponse}} {
+{{- range $i, $f := .Results}}
+    {{$f.ProtoType}} {{$f.Snake}} = {{inc $i}};
+{{- end}}
+    string err = {{inc (len .Results)}};
+}
+{{end -}}
+`
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+/*
+kitgen 生成与demo_project/hello分层一致的go-kit服务骨架(grpc transport)，包括：
+-	pkg/service：接口、基础实现(TODO)、日志mw
+-	pkg/endpoint：Endpoints、request/response、日志和耗时mw
+-	pkg/grpc：grpc handler以及pb与endpoint类型的转换
+-	cmd/service：flag、prometheus指标、grpc健康检查、consul注册/注销
+-	pb/proto：proto文件和编译脚本(需自行执行protoc生成pb包)
+
+接口有两种描述方式：
+	go run ./cmd/kitgen -name greeter -out demo_project -methods 'Greet(name string) (string, error); Add(a, b int) (sum int, err error)'
+	go run ./cmd/kitgen -name greeter -out demo_project -proto greeter.proto
+*/
+
+var nameRe = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+func main() {
+	fs := flag.NewFlagSet("kitgen", flag.ExitOnError)
+	var (
+		name       = fs.String("name", "", "service name, also the go module and directory name, e.g. greeter")
+		methods    = fs.String("methods", "", "method signatures separated by ';' or newline, e.g. 'Sum(a, b int) (int, error)'")
+		protoPath  = fs.String("proto", "", "proto file whose first service defines the methods, instead of -methods")
+		out        = fs.String("out", ".", "parent directory of the generated service")
+		pbImport   = fs.String("pb.import", "", "import path of the generated pb package, default go_package of -proto or <name>/pb/gen-go/pb")
+		foundation = fs.String("foundation", "../../gokit_foundation", "gokit_foundation path relative to the service, used in go.mod replace")
+		goUtil     = fs.String("go-util", "../../go-util", "go-util path relative to the service, used in go.mod replace")
+		force      = fs.Bool("force", false, "overwrite existing files")
+	)
+	fs.Parse(os.Args[1:])
+
+	spec, err := newSpec(*name, *methods, *protoPath, *pbImport)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "kitgen:", err)
+		fs.Usage()
+		os.Exit(2)
+	}
+	spec.Foundation, spec.GoUtil = *foundation, *goUtil
+	spec.Cmdline = "kitgen " + strings.Join(os.Args[1:], " ")
+
+	dir := filepath.Join(*out, spec.Name)
+	if err := generate(spec, dir, *protoPath, *force); err != nil {
+		fmt.Fprintln(os.Stderr, "kitgen:", err)
+		os.Exit(1)
+	}
+	fmt.Printf(`generated %s, next steps:
+	cd %s && sh pb/proto/compile.sh
+	implement the methods in pkg/service/service.go
+	go build ./... && go run ./cmd
+`, dir, dir)
+}
+
+// newSpec 校验参数，methods和protoPath只能指定一个
+func newSpec(name, methods, protoPath, pbImport string) (Spec, error) {
+	if !nameRe.MatchString(name) {
+		return Spec{}, fmt.Errorf("-name %q should be a lower-case identifier", name)
+	}
+	if (methods == "") == (protoPath == "") {
+		return Spec{}, fmt.Errorf("one of -methods and -proto is required")
+	}
+	spec := Spec{Name: name}
+	var goPackage string
+	var err error
+	if methods != "" {
+		spec.Service = pbGoName(name)
+		spec.Methods, err = parseMethods(methods)
+	} else {
+		spec.Proto = true
+		spec.Service, goPackage, spec.Methods, err = parseProto(protoPath)
+	}
+	if err != nil {
+		return Spec{}, err
+	}
+	// 优先级：-pb.import > proto的go_package > 默认路径
+	switch {
+	case pbImport != "":
+		spec.PBImport = pbImport
+	case goPackage != "":
+		spec.PBImport = goPackage
+	default:
+		spec.PBImport = name + "/pb/gen-go/pb"
+	}
+	for i := range spec.Methods {
+		spec.Methods[i].Proto = spec.Proto
+	}
+	return spec, nil
+}
+
+// generate 生成到dir，proto形式时将proto文件复制到pb/proto下
+func generate(spec Spec, dir, protoPath string, force bool) error {
+	out, err := render(spec)
+	if err != nil {
+		return err
+	}
+	if spec.Proto {
+		b, err := ioutil.ReadFile(protoPath)
+		if err != nil {
+			return err
+		}
+		out["pb/proto/"+filepath.Base(protoPath)] = b
+	}
+	return write(dir, out, force)
+}
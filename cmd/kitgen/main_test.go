@@ -0,0 +1,188 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseMethods(t *testing.T) {
+	methods, err := parseMethods(`Sum(ctx context.Context, a, b int) (int, error)
+		Concat(a, b string) (v string, err error); Ping() error`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(methods) != 3 {
+		t.Fatalf("got %d methods", len(methods))
+	}
+	sum := methods[0]
+	if got, want := sum.Signature(), "Sum(ctx context.Context, a int, b int) (v int, err error)"; got != want {
+		t.Errorf("got signature:%s want:%s", got, want)
+	}
+	if sum.Params[0].ProtoType != "int64" || sum.Params[0].ToPB("x") != "int64(x)" || sum.Params[0].FromPB("x") != "int(x)" {
+		t.Errorf("got param:%+v", sum.Params[0])
+	}
+	if got := methods[2].Signature(); got != "Ping(ctx context.Context) (err error)" {
+		t.Errorf("got signature:%s", got)
+	}
+
+	for _, src := range []string{"", "Sum(a int) (map[string]int, error)", "Sum(_ int) error", "Sum(req string) error", "io.Reader", "Sum(a int"} {
+		if _, err := parseMethods(src); err == nil {
+			t.Errorf("%q want err", src)
+		}
+	}
+}
+
+func TestSnake(t *testing.T) {
+	for in, want := range map[string]string{"userID": "user_id", "HTTPAddr": "http_addr", "v": "v", "p0": "p0"} {
+		if got := snake(in); got != want {
+			t.Errorf("snake(%s) got:%s want:%s", in, got, want)
+		}
+	}
+	if got := pbGoName("user_id"); got != "UserId" {
+		t.Errorf("got pb name:%s", got)
+	}
+}
+
+func TestParseProto(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kitgen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "hello.proto")
+	writeFile(t, path, `syntax = "proto3";
+package pb;
+option go_package = "hello/pb/gen-go/pb;pb";
+// service Ignored {}
+service Hello {
+    rpc SayHi (SayHiRequest) returns (SayHiResponse);
+    /* rpc Old (OldRequest) returns (OldResponse); */
+    rpc MakeADate(MakeADateRequest) returns (MakeADateResponse) {}
+}`)
+	service, goPackage, methods, err := parseProto(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if service != "Hello" || goPackage != "hello/pb/gen-go/pb" || len(methods) != 2 ||
+		methods[1].Name != "MakeADate" || methods[1].PBResponse != "MakeADateResponse" {
+		t.Errorf("got service:%s go_package:%s methods:%+v", service, goPackage, methods)
+	}
+
+	writeFile(t, path, `service Hello { rpc Watch (WatchRequest) returns (stream WatchResponse); }`)
+	if _, _, _, err := parseProto(path); err == nil {
+		t.Error("streaming want err")
+	}
+	writeFile(t, path, `service Hello { rpc Ping (google.protobuf.Empty) returns (PingResponse); }`)
+	if _, _, _, err := parseProto(path); err == nil {
+		t.Error("other package want err")
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kitgen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	spec, err := newSpec("greeter", "Greet(name string) (string, error); Add(a, b int) (sum int, err error)", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec.Foundation, spec.GoUtil = "../../gokit_foundation", "../../go-util"
+	out := filepath.Join(dir, "greeter")
+	if err := generate(spec, out, "", false); err != nil {
+		t.Fatal(err)
+	}
+	contains := map[string][]string{
+		"go.mod":                    {"module greeter", "gokit_foundation => ../../gokit_foundation"},
+		"cmd/main.go":               {`service "greeter/cmd/service"`},
+		"cmd/service/service.go":    {"pb.RegisterGreeterServer", "gokit_foundation.RegisterSvc(svcName", "ConsulDeregisterWithRetry", `"Greet", "Add"`},
+		"pkg/service/service.go":    {"type GreeterService interface", "Add(ctx context.Context, a int, b int) (sum int, err error)"},
+		"pkg/service/middleware.go": {`mw.logger.Log("method", "Add", "a", a, "b", b, "sum", sum, "err", err)`},
+		"pkg/endpoint/endpoint.go":  {"Sum int   `json:\"sum\"`", "sum, err := svc.Add(ctx, req.A, req.B)"},
+		"pkg/grpc/handler.go":       {"A: int(req.A)", "Sum: int64(rsp.Sum), Err: errString(rsp.Err)"},
+		"pb/proto/greeter.proto":    {`option go_package = "greeter/pb/gen-go/pb;pb";`, "rpc Add (AddRequest) returns (AddReply);", "int64 sum = 1;\n    string err = 2;"},
+		"pb/proto/compile.sh":       {"protoc"},
+	}
+	for path, subs := range contains {
+		b, err := ioutil.ReadFile(filepath.Join(out, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range subs {
+			if !strings.Contains(string(b), s) {
+				t.Errorf("%s want %q, got:\n%s", path, s, b)
+			}
+		}
+	}
+
+	// 已存在时需要-force
+	if err := generate(spec, out, "", false); err == nil {
+		t.Error("want exists err")
+	}
+	if err := generate(spec, out, "", true); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGenerateProto(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kitgen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "hello.proto")
+	writeFile(t, path, `syntax = "proto3";
+option go_package = "hello/pb/gen-go/pb;pb";
+service Hello {
+    rpc MakeADate (MakeADateRequest) returns (MakeADateResponse);
+}`)
+
+	spec, err := newSpec("hello", "", path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "hello")
+	if err := generate(spec, out, path, false); err != nil {
+		t.Fatal(err)
+	}
+	contains := map[string][]string{
+		"pkg/service/service.go":   {"MakeADate(ctx context.Context, req *pb.MakeADateRequest) (rsp *pb.MakeADateResponse, err error)", `pb "hello/pb/gen-go/pb"`},
+		"pkg/endpoint/endpoint.go": {"P1 *pb.MakeADateRequest", "return &MakeADateResponse{P0: rsp, Err: err}, nil"},
+		"pkg/grpc/handler.go":      {"return &endpoint.MakeADateRequest{P1: req}, nil", "return nil, rsp.Err"},
+		"pb/proto/hello.proto":     {"rpc MakeADate"},
+	}
+	for path, subs := range contains {
+		b, err := ioutil.ReadFile(filepath.Join(out, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range subs {
+			if !strings.Contains(string(b), s) {
+				t.Errorf("%s want %q, got:\n%s", path, s, b)
+			}
+		}
+	}
+}
+
+func TestNewSpec(t *testing.T) {
+	for _, c := range []struct{ name, methods, proto string }{
+		{"Greeter", "Greet() error", ""},
+		{"greeter", "", ""},
+		{"greeter", "Greet() error", "a.proto"},
+	} {
+		if _, err := newSpec(c.name, c.methods, c.proto, ""); err == nil {
+			t.Errorf("%+v want err", c)
+		}
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Field 方法的参数或返回值
+type Field struct {
+	Name      string // go的变量名，如userID
+	GoType    string
+	ProtoType string
+	PBGoType  string // protoc-gen-go生成的字段类型，与GoType不同时需要转换
+}
+
+// 生成的endpoint request/response字段名
+func (f Field) Exported() string { return exported(f.Name) }
+
+// json tag以及proto的字段名
+func (f Field) Snake() string { return snake(f.Name) }
+
+// protoc-gen-go生成的pb字段名
+func (f Field) PBName() string { return pbGoName(snake(f.Name)) }
+
+// 将endpoint的字段值v转为pb的类型
+func (f Field) ToPB(v string) string {
+	if f.PBGoType != f.GoType {
+		return f.PBGoType + "(" + v + ")"
+	}
+	return v
+}
+
+// 将pb的字段值v转为endpoint的类型
+func (f Field) FromPB(v string) string {
+	if f.PBGoType != f.GoType {
+		return f.GoType + "(" + v + ")"
+	}
+	return v
+}
+
+/*
+Method 服务的一个接口，有两种形式：
+-	签名形式(-methods)：参数和返回值都是go的基本类型，最后一个返回值为error，同时生成proto文件
+-	proto形式(-proto)：接口的参数和返回值为 *pb.XxxRequest 和 *pb.XxxResponse，与hello服务的MakeADate相同
+*/
+type Method struct {
+	Name    string
+	Params  []Field
+	Results []Field // 不包括最后的error
+
+	PBRequest, PBResponse string // pb中的message名
+	Proto                 bool   // proto形式
+}
+
+func (m Method) Lower() string {
+	r := []rune(m.Name)
+	r[0] = unicode.ToLower(r[0])
+	return string(r)
+}
+
+// service接口的方法签名，返回值都是命名的，便于mw的defer中读取
+func (m Method) Signature() string {
+	if m.Proto {
+		return fmt.Sprintf("%s(ctx context.Context, req *pb.%s) (rsp *pb.%s, err error)", m.Name, m.PBRequest, m.PBResponse)
+	}
+	params := []string{"ctx context.Context"}
+	for _, f := range m.Params {
+		params = append(params, f.Name+" "+f.GoType)
+	}
+	var results []string
+	for _, f := range m.Results {
+		results = append(results, f.Name+" "+f.GoType)
+	}
+	results = append(results, "err error")
+	return fmt.Sprintf("%s(%s) (%s)", m.Name, strings.Join(params, ", "), strings.Join(results, ", "))
+}
+
+// 调用service方法的参数
+func (m Method) CallArgs() string {
+	if m.Proto {
+		return "ctx, req"
+	}
+	args := []string{"ctx"}
+	for _, f := range m.Params {
+		args = append(args, f.Name)
+	}
+	return strings.Join(args, ", ")
+}
+
+// 日志mw打印的参数和返回值(不包括err)
+func (m Method) LogKVs() string {
+	if m.Proto {
+		return `"req", req, "rsp", rsp`
+	}
+	var kvs []string
+	for _, f := range append(append([]Field{}, m.Params...), m.Results...) {
+		kvs = append(kvs, fmt.Sprintf("%q, %s", f.Snake(), f.Name))
+	}
+	return strings.Join(kvs, ", ")
+}
+
+// go基本类型 => proto类型，以及protoc-gen-go生成的go类型
+var protoTypes = map[string][2]string{
+	"string":  {"string", "string"},
+	"bool":    {"bool", "bool"},
+	"int":     {"int64", "int64"},
+	"int32":   {"int32", "int32"},
+	"int64":   {"int64", "int64"},
+	"uint32":  {"uint32", "uint32"},
+	"uint64":  {"uint64", "uint64"},
+	"float32": {"float", "float32"},
+	"float64": {"double", "float64"},
+	"[]byte":  {"bytes", "[]byte"},
+}
+
+// 生成的代码中与参数同一作用域的变量名和receiver名
+var reserved = map[string]bool{
+	"ctx": true, "err": true, "req": true, "rsp": true, "request": true, "response": true,
+	"r": true, "svc": true, "mw": true, "eps": true,
+}
+
+/*
+parseMethods 解析方法签名，多个方法以;或换行分隔，ctx参数可以省略(生成的代码总是带ctx)，e.g.
+
+	Sum(a, b int) (int, error); Concat(ctx context.Context, a, b string) (v string, err error)
+*/
+func parseMethods(src string) ([]Method, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", "package p; type _ interface {\n"+src+"\n}", 0)
+	if err != nil {
+		return nil, fmt.Errorf("parse methods: %v", err)
+	}
+	iface := f.Decls[0].(*ast.GenDecl).Specs[0].(*ast.TypeSpec).Type.(*ast.InterfaceType)
+	var methods []Method
+	for _, m := range iface.Methods.List {
+		ft, ok := m.Type.(*ast.FuncType)
+		if !ok || len(m.Names) != 1 {
+			return nil, fmt.Errorf("parse methods: embedded interface is not supported")
+		}
+		name := m.Names[0].Name
+		params, err := parseFields(fset, name, ft.Params, "p")
+		if err != nil {
+			return nil, err
+		}
+		if len(params) > 0 && params[0].GoType == "context.Context" {
+			params = params[1:]
+		}
+		results, err := parseFields(fset, name, ft.Results, "v")
+		if err != nil {
+			return nil, err
+		}
+		if len(results) > 0 && results[len(results)-1].GoType == "error" {
+			results = results[:len(results)-1]
+		}
+		if len(results) == 1 && results[0].Name == "v0" {
+			results[0].Name = "v"
+		}
+		for _, fs := range [][]Field{params, results} {
+			for i, fd := range fs {
+				if reserved[fd.Name] {
+					return nil, fmt.Errorf("%s: name %s is reserved by the generated code", name, fd.Name)
+				}
+				t, ok := protoTypes[fd.GoType]
+				if !ok {
+					return nil, fmt.Errorf("%s: unsupported type %s of %s, want one of basic types", name, fd.GoType, fd.Name)
+				}
+				fs[i].ProtoType, fs[i].PBGoType = t[0], t[1]
+			}
+		}
+		methods = append(methods, Method{
+			Name:       name,
+			Params:     params,
+			Results:    results,
+			PBRequest:  name + "Request",
+			PBResponse: name + "Reply",
+		})
+	}
+	if len(methods) == 0 {
+		return nil, fmt.Errorf("parse methods: no method")
+	}
+	return methods, nil
+}
+
+// 未命名的参数依次命名为 prefix0, prefix1...
+func parseFields(fset *token.FileSet, method string, fl *ast.FieldList, prefix string) ([]Field, error) {
+	if fl == nil {
+		return nil, nil
+	}
+	var fields []Field
+	for _, f := range fl.List {
+		var buf bytes.Buffer
+		if err := printer.Fprint(&buf, fset, f.Type); err != nil {
+			return nil, err
+		}
+		typ := buf.String()
+		if len(f.Names) == 0 {
+			fields = append(fields, Field{Name: fmt.Sprintf("%s%d", prefix, len(fields)), GoType: typ})
+			continue
+		}
+		for _, n := range f.Names {
+			if n.Name == "_" {
+				return nil, fmt.Errorf("%s: blank name is not supported", method)
+			}
+			fields = append(fields, Field{Name: n.Name, GoType: typ})
+		}
+	}
+	return fields, nil
+}
+
+var (
+	protoServiceRe = regexp.MustCompile(`(?m)^\s*service\s+(\w+)\s*\{`)
+	protoRPCRe     = regexp.MustCompile(`rpc\s+(\w+)\s*\(\s*(stream\s+)?([\w.]+)\s*\)\s*returns\s*\(\s*(stream\s+)?([\w.]+)\s*\)`)
+	protoGoPkgRe   = regexp.MustCompile(`option\s+go_package\s*=\s*"([^";]+)`)
+)
+
+/*
+parseProto 解析proto文件中第一个service的rpc，只支持一元调用，message必须定义在同一个proto package中，
+goPackage为go_package选项中的import路径(未设置时为空)
+*/
+func parseProto(path string) (service, goPackage string, methods []Method, err error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", "", nil, err
+	}
+	src := stripProtoComments(string(raw))
+	if m := protoGoPkgRe.FindStringSubmatch(src); m != nil {
+		goPackage = m[1]
+	}
+	loc := protoServiceRe.FindStringSubmatchIndex(src)
+	if loc == nil {
+		return "", "", nil, fmt.Errorf("%s: no service found", path)
+	}
+	service = src[loc[2]:loc[3]]
+	body := src[loc[1]:]
+	if end := strings.Index(body, "}"); end >= 0 {
+		body = body[:end]
+	}
+	for _, m := range protoRPCRe.FindAllStringSubmatch(body, -1) {
+		if m[2] != "" || m[4] != "" {
+			return "", "", nil, fmt.Errorf("%s: streaming rpc %s is not supported", path, m[1])
+		}
+		if strings.Contains(m[3], ".") || strings.Contains(m[5], ".") {
+			return "", "", nil, fmt.Errorf("%s: rpc %s uses message of other package", path, m[1])
+		}
+		methods = append(methods, Method{Name: m[1], PBRequest: m[3], PBResponse: m[5]})
+	}
+	if len(methods) == 0 {
+		return "", "", nil, fmt.Errorf("%s: service %s has no rpc", path, service)
+	}
+	return service, goPackage, methods, nil
+}
+
+var protoCommentRe = regexp.MustCompile(`(?s)//[^\n]*|/\*.*?\*/`)
+
+func stripProtoComments(src string) string {
+	return protoCommentRe.ReplaceAllString(src, "")
+}
+
+func exported(name string) string {
+	if name == "" {
+		return name
+	}
+	r := []rune(name)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
+
+// userID => user_id, HTTPAddr => http_addr
+func snake(name string) string {
+	r := []rune(name)
+	var b strings.Builder
+	for i, c := range r {
+		if unicode.IsUpper(c) {
+			if i > 0 && (unicode.IsLower(r[i-1]) || (i+1 < len(r) && unicode.IsLower(r[i+1]))) {
+				b.WriteByte('_')
+			}
+			c = unicode.ToLower(c)
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// 与protoc-gen-go的规则一致：user_id => UserId
+func pbGoName(snakeName string) string {
+	var b strings.Builder
+	for _, p := range strings.Split(snakeName, "_") {
+		b.WriteString(exported(p))
+	}
+	return b.String()
+}
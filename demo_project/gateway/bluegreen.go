@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-kit/kit/metrics"
+	"net/http"
+	addendpoint "new_addsvc/pkg/endpoint"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+/*
+new_addsvc的蓝绿发布(blue/green)：两组实例同时在线，所有调用只发给当前的active组，切换是一次原子的写
+-	服务端 -deploy.color blue|green 启动，注册时带上color tag，并以NewAddSvc-<color>再注册一次(见gokit_foundation.ConsulAlias)，
+	blue、green各是一个client，按tag筛选实例(sdclient.WithTags)，两组的负载均衡、重试互不影响
+-	-bluegreen.active为初始的active组，部署好另一组并确认健康后，通过管理端口切换：
+	curl -X PUT 'localhost:8001/bluegreen?active=green'，有问题时切回blue即可回滚；切换前已发出的调用仍由原来的组处理
+-	指标：example_gateway_bluegreen_requests_total{method,group,success}、example_gateway_bluegreen_request_duration_seconds{method,group}
+*/
+
+const (
+	groupBlue  = "blue"
+	groupGreen = "green"
+)
+
+type blueGreenAdd struct {
+	blue, green addBackend
+	active      atomic.Value // string
+	requests    metrics.Counter
+	duration    metrics.Histogram
+}
+
+func newBlueGreenAdd(blue, green addBackend, requests metrics.Counter, duration metrics.Histogram) *blueGreenAdd {
+	c := &blueGreenAdd{blue: blue, green: green, requests: requests, duration: duration}
+	c.active.Store(groupBlue)
+	return c
+}
+
+func (c *blueGreenAdd) Active() string {
+	return c.active.Load().(string)
+}
+
+// SetActive active需为blue或green
+func (c *blueGreenAdd) SetActive(active string) error {
+	if active != groupBlue && active != groupGreen {
+		return fmt.Errorf("bluegreen active must be %s or %s, got %q", groupBlue, groupGreen, active)
+	}
+	c.active.Store(active)
+	return nil
+}
+
+// 选择这次调用的组，返回的done在调用结束后记录指标
+func (c *blueGreenAdd) pick(method string) (addBackend, func(error)) {
+	svc, group := c.blue, c.Active()
+	if group == groupGreen {
+		svc = c.green
+	}
+	start := time.Now()
+	return svc, func(err error) {
+		c.requests.With("method", method, "group", group, "success", strconv.FormatBool(err == nil)).Add(1)
+		c.duration.With("method", method, "group", group).Observe(time.Since(start).Seconds())
+	}
+}
+
+func (c *blueGreenAdd) Sum(ctx context.Context, a, b int) (int, error) {
+	svc, done := c.pick("Sum")
+	v, err := svc.Sum(ctx, a, b)
+	done(err)
+	return v, err
+}
+
+func (c *blueGreenAdd) Concat(ctx context.Context, a, b string) (string, error) {
+	svc, done := c.pick("Concat")
+	v, err := svc.Concat(ctx, a, b)
+	done(err)
+	return v, err
+}
+
+// BatchSum 整批调用同一个组，只统计整批的err
+func (c *blueGreenAdd) BatchSum(ctx context.Context, items []*addendpoint.SumRequest) ([]int, []error, error) {
+	svc, done := c.pick("BatchSum")
+	vs, itemErrs, err := svc.BatchSum(ctx, items)
+	done(err)
+	return vs, itemErrs, err
+}
+
+// ServeHTTP 管理端口的/bluegreen，GET查看、PUT(POST)切换active组
+func (c *blueGreenAdd) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		if err := c.SetActive(r.FormValue("active")); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, PUT, POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(map[string]string{"active": c.Active()})
+}
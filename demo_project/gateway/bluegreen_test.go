@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"github.com/go-kit/kit/metrics/discard"
+	"net/http"
+	"net/http/httptest"
+	addendpoint "new_addsvc/pkg/endpoint"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestBlueGreenAdd(t *testing.T) {
+	blue, green := &batchingAdd{}, &batchingAdd{}
+	counter := canaryCounter{mu: new(sync.Mutex), counts: map[string]float64{}}
+	c := newBlueGreenAdd(blue, green, counter, discard.NewHistogram())
+
+	// 默认都由blue处理
+	for i := 0; i < 10; i++ {
+		if v, err := c.Sum(context.Background(), 1, 2); err != nil || v != 3 {
+			t.Fatalf("got v:%d err:%v", v, err)
+		}
+	}
+	// 切换后都由green处理
+	if err := c.SetActive(groupGreen); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = c.Sum(context.Background(), 0, 0)
+	_, _, _ = c.BatchSum(context.Background(), []*addendpoint.SumRequest{{A: 1, B: 2}})
+	if blue.sums != 10 || green.sums != 1 || green.batches != 1 || blue.batches != 0 {
+		t.Errorf("got blue sums:%d batches:%d green sums:%d batches:%d", blue.sums, blue.batches, green.sums, green.batches)
+	}
+	if counter.counts["Sum/blue/true"] != 10 || counter.counts["Sum/green/false"] != 1 || counter.counts["BatchSum/green/true"] != 1 {
+		t.Errorf("got counts:%v", counter.counts)
+	}
+
+	if err := c.SetActive("red"); err == nil || c.Active() != groupGreen {
+		t.Errorf("red should be rejected, got active:%s", c.Active())
+	}
+}
+
+func TestBlueGreenAdd_ServeHTTP(t *testing.T) {
+	c := newBlueGreenAdd(&batchingAdd{}, &batchingAdd{}, discard.NewCounter(), discard.NewHistogram())
+	for _, tt := range []struct {
+		method, query string
+		wantCode      int
+		wantBody      string
+	}{
+		{method: http.MethodGet, wantCode: 200, wantBody: `{"active":"blue"}`},
+		{method: http.MethodPut, query: "?active=green", wantCode: 200, wantBody: `{"active":"green"}`},
+		{method: http.MethodPost, query: "?active=", wantCode: 400},
+		{method: http.MethodDelete, wantCode: 405},
+	} {
+		rec := httptest.NewRecorder()
+		c.ServeHTTP(rec, httptest.NewRequest(tt.method, "/bluegreen"+tt.query, nil))
+		if rec.Code != tt.wantCode || (tt.wantBody != "" && strings.TrimSpace(rec.Body.String()) != tt.wantBody) {
+			t.Errorf("%s %s got code:%d body:%s", tt.method, tt.query, rec.Code, rec.Body)
+		}
+	}
+	if c.Active() != groupGreen {
+		t.Errorf("got active:%s", c.Active())
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-kit/kit/metrics"
+	"math/rand"
+	"net/http"
+	addclient "new_addsvc/client"
+	addendpoint "new_addsvc/pkg/endpoint"
+	addservice "new_addsvc/pkg/service"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+/*
+new_addsvc的灰度发布(canary)：按比例把一部分调用分给带canary tag的实例(服务端 -consul.tags canary 启动)
+-	stable、canary各是一个client：stable排除了canary实例(sdclient.WithoutTags)，canary优先调用canary实例，
+	没有健康的canary实例时由其他实例处理(sdclient.WithAffinity)，此时依然记为canary
+-	每次调用按-canary.percent随机选择，管理端口的/canary可以随时调整比例，逐步放量：
+	curl -X PUT 'localhost:8001/canary?percent=20'，观察两个版本的错误率和耗时后再继续放大或改为0回滚
+-	指标：example_gateway_canary_requests_total{method,variant,success}、example_gateway_canary_request_duration_seconds{method,variant}
+*/
+
+const (
+	variantStable = "stable"
+	variantCanary = "canary"
+)
+
+// new_addsvc的client，addclient.New返回的Service都实现了BatchSummer
+type addBackend interface {
+	addservice.Service
+	addclient.BatchSummer
+}
+
+type canaryAdd struct {
+	stable, canary addBackend
+	percent        int32 // 0~100
+	requests       metrics.Counter
+	duration       metrics.Histogram
+}
+
+func newCanaryAdd(stable, canary addBackend, percent int, requests metrics.Counter, duration metrics.Histogram) *canaryAdd {
+	return &canaryAdd{stable: stable, canary: canary, percent: int32(percent), requests: requests, duration: duration}
+}
+
+func (c *canaryAdd) Percent() int {
+	return int(atomic.LoadInt32(&c.percent))
+}
+
+// SetPercent percent需在0~100之间
+func (c *canaryAdd) SetPercent(percent int) error {
+	if percent < 0 || percent > 100 {
+		return fmt.Errorf("canary percent must be in [0, 100], got %d", percent)
+	}
+	atomic.StoreInt32(&c.percent, int32(percent))
+	return nil
+}
+
+// 选择这次调用的版本，返回的done在调用结束后记录指标
+func (c *canaryAdd) pick(method string) (addBackend, func(error)) {
+	svc, variant := c.stable, variantStable
+	if rand.Intn(100) < c.Percent() {
+		svc, variant = c.canary, variantCanary
+	}
+	start := time.Now()
+	return svc, func(err error) {
+		c.requests.With("method", method, "variant", variant, "success", strconv.FormatBool(err == nil)).Add(1)
+		c.duration.With("method", method, "variant", variant).Observe(time.Since(start).Seconds())
+	}
+}
+
+func (c *canaryAdd) Sum(ctx context.Context, a, b int) (int, error) {
+	svc, done := c.pick("Sum")
+	v, err := svc.Sum(ctx, a, b)
+	done(err)
+	return v, err
+}
+
+func (c *canaryAdd) Concat(ctx context.Context, a, b string) (string, error) {
+	svc, done := c.pick("Concat")
+	v, err := svc.Concat(ctx, a, b)
+	done(err)
+	return v, err
+}
+
+// BatchSum 整批调用同一个版本，只统计整批的err
+func (c *canaryAdd) BatchSum(ctx context.Context, items []*addendpoint.SumRequest) ([]int, []error, error) {
+	svc, done := c.pick("BatchSum")
+	vs, itemErrs, err := svc.BatchSum(ctx, items)
+	done(err)
+	return vs, itemErrs, err
+}
+
+// ServeHTTP 管理端口的/canary，GET查看、PUT(POST)修改canary的比例
+func (c *canaryAdd) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		percent, err := strconv.Atoi(r.FormValue("percent"))
+		if err == nil {
+			err = c.SetPercent(percent)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, PUT, POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(map[string]int{"percent": c.Percent()})
+}
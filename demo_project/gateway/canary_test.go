@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
+	"net/http"
+	"net/http/httptest"
+	addendpoint "new_addsvc/pkg/endpoint"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// 按labels计数
+type canaryCounter struct {
+	mu     *sync.Mutex
+	counts map[string]float64
+	labels string
+}
+
+func (c canaryCounter) With(lvs ...string) metrics.Counter {
+	var values []string
+	for i := 1; i < len(lvs); i += 2 {
+		values = append(values, lvs[i])
+	}
+	return canaryCounter{mu: c.mu, counts: c.counts, labels: strings.Join(values, "/")}
+}
+func (c canaryCounter) Add(d float64) {
+	c.mu.Lock()
+	c.counts[c.labels] += d
+	c.mu.Unlock()
+}
+
+func TestCanaryAdd(t *testing.T) {
+	stable, canary := &batchingAdd{}, &batchingAdd{}
+	counter := canaryCounter{mu: new(sync.Mutex), counts: map[string]float64{}}
+	c := newCanaryAdd(stable, canary, 0, counter, discard.NewHistogram())
+
+	// 0%时都由stable处理
+	for i := 0; i < 10; i++ {
+		if v, err := c.Sum(context.Background(), 1, 2); err != nil || v != 3 {
+			t.Fatalf("got v:%d err:%v", v, err)
+		}
+	}
+	if atomic.LoadInt32(&canary.sums) != 0 || atomic.LoadInt32(&stable.sums) != 10 {
+		t.Errorf("got stable:%d canary:%d", stable.sums, canary.sums)
+	}
+	// 100%时都由canary处理，业务错误记为失败
+	if err := c.SetPercent(100); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = c.Sum(context.Background(), 0, 0)
+	_, _, _ = c.BatchSum(context.Background(), []*addendpoint.SumRequest{{A: 1, B: 2}})
+	if canary.sums != 1 || canary.batches != 1 {
+		t.Errorf("got canary sums:%d batches:%d", canary.sums, canary.batches)
+	}
+	if counter.counts["Sum/stable/true"] != 10 || counter.counts["Sum/canary/false"] != 1 || counter.counts["BatchSum/canary/true"] != 1 {
+		t.Errorf("got counts:%v", counter.counts)
+	}
+
+	// 按比例分流
+	_ = c.SetPercent(30)
+	for i := 0; i < 1000; i++ {
+		_, _ = c.Concat(context.Background(), "a", "b")
+	}
+	if n := counter.counts["Concat/canary/true"]; n < 200 || n > 400 {
+		t.Errorf("got canary calls:%v of 1000", n)
+	}
+
+	if err := c.SetPercent(101); err == nil {
+		t.Error("percent 101 should be rejected")
+	}
+}
+
+func TestCanaryAdd_ServeHTTP(t *testing.T) {
+	c := newCanaryAdd(&batchingAdd{}, &batchingAdd{}, 5, discard.NewCounter(), discard.NewHistogram())
+	for _, tt := range []struct {
+		method, query string
+		wantCode      int
+		wantBody      string
+	}{
+		{method: http.MethodGet, wantCode: 200, wantBody: `{"percent":5}`},
+		{method: http.MethodPut, query: "?percent=20", wantCode: 200, wantBody: `{"percent":20}`},
+		{method: http.MethodPut, query: "?percent=-1", wantCode: 400},
+		{method: http.MethodPut, query: "?percent=abc", wantCode: 400},
+		{method: http.MethodDelete, wantCode: 405},
+	} {
+		rec := httptest.NewRecorder()
+		c.ServeHTTP(rec, httptest.NewRequest(tt.method, "/canary"+tt.query, nil))
+		if rec.Code != tt.wantCode || (tt.wantBody != "" && strings.TrimSpace(rec.Body.String()) != tt.wantBody) {
+			t.Errorf("%s %s got code:%d body:%s", tt.method, tt.query, rec.Code, rec.Body)
+		}
+	}
+	if c.Percent() != 20 {
+		t.Errorf("got percent:%d", c.Percent())
+	}
+}
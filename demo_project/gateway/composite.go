@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"gateway/routes"
+	"github.com/gorilla/mux"
+	"gokit_foundation/gateway"
+	"hello/pb/gen-go/pb"
+	"hello/pb/gen-go/pbcommon"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/*
+聚合接口：一次请求并发调用多个后端服务，合并结果后返回
+-	每个后端调用单独设置超时，某个服务慢或不可用不会拖慢整个请求
+-	部分失败时仍返回http 200，失败的部分在errors中给出，全部失败时返回503
+-	SayHi与ListGreetings并发执行，greetings中不一定包含本次SayHi的记录
+*/
+
+// 每个后端调用的超时
+var compositeCallTimeout = time.Second * 2
+
+// hello的SayHi不返回err，调用失败时只能得到R_RPC_ERR
+var errRPC = errors.New("rpc call failed")
+
+type compositeRsp struct {
+	Hi        *compositeHi      `json:"hi,omitempty"`
+	Sum       *routes.SumRsp    `json:"sum,omitempty"`
+	Greetings []*pb.Greeting    `json:"greetings,omitempty"`
+	Errors    map[string]string `json:"errors,omitempty"`
+}
+
+type compositeHi struct {
+	Reply   string `json:"reply"`
+	ErrCode int32  `json:"err_code"`
+}
+
+// GET /composite/{name}?a=1&b=2
+func (gw *MyGateWay) Composite(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	a, errA := strconv.Atoi(r.URL.Query().Get("a"))
+	b, errB := strconv.Atoi(r.URL.Query().Get("b"))
+	if errA != nil || errB != nil {
+		gateway.WriteError(w, http.StatusBadRequest, "invalid a or b")
+		return
+	}
+
+	var (
+		rsp   = &compositeRsp{Errors: map[string]string{}}
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+		parts = map[string]func(ctx context.Context) error{
+			"hi": func(ctx context.Context) error {
+				reply, code := gw.hello.SayHi(ctx, name)
+				if code == pbcommon.R_RPC_ERR {
+					return errRPC
+				}
+				mu.Lock()
+				rsp.Hi = &compositeHi{Reply: reply, ErrCode: int32(code)}
+				mu.Unlock()
+				return nil
+			},
+			"sum": func(ctx context.Context) error {
+				v, err := gw.add.Sum(ctx, a, b)
+				if err != nil {
+					return err
+				}
+				mu.Lock()
+				rsp.Sum = &routes.SumRsp{V: v}
+				mu.Unlock()
+				return nil
+			},
+			"greetings": func(ctx context.Context) error {
+				lr, err := gw.hello.ListGreetings(ctx, &pb.ListGreetingsRequest{
+					BaseReq: &pbcommon.BaseReq{},
+					Name:    name,
+				})
+				if err != nil {
+					return err
+				}
+				mu.Lock()
+				rsp.Greetings = lr.Greetings
+				mu.Unlock()
+				return nil
+			},
+		}
+	)
+	for part, call := range parts {
+		wg.Add(1)
+		go func(part string, call func(ctx context.Context) error) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(r.Context(), compositeCallTimeout)
+			defer cancel()
+			if err := call(ctx); err != nil {
+				gw.Log("Composite->err", err, "part", part)
+				mu.Lock()
+				rsp.Errors[part] = err.Error()
+				mu.Unlock()
+			}
+		}(part, call)
+	}
+	wg.Wait()
+
+	if len(rsp.Errors) == len(parts) {
+		gateway.WriteError(w, http.StatusServiceUnavailable, "all backend services unavailable")
+		return
+	}
+	gw.JSON(w, rsp)
+}
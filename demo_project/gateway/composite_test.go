@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"gokit_foundation"
+	"gokit_foundation/errs"
+	"gokit_foundation/gateway"
+	"hello/pb/gen-go/pb"
+	"hello/pb/gen-go/pbcommon"
+	"net/http"
+	"net/http/httptest"
+	addendpoint "new_addsvc/pkg/endpoint"
+	addservice "new_addsvc/pkg/service"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 以下测试使用假的后端服务，不依赖consul以及hello、new_addsvc服务
+type stubHello struct {
+	down bool
+}
+
+func (s stubHello) SayHi(ctx context.Context, name string) (string, pbcommon.R) {
+	if s.down {
+		return "", pbcommon.R_RPC_ERR
+	}
+	return "Hi," + name, pbcommon.R_OK
+}
+
+func (s stubHello) MakeADate(context.Context, *pb.MakeADateRequest) (*pb.MakeADateResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (s stubHello) UpdateUserInfo(context.Context, *pb.UpdateUserInfoRequest) (*pb.UpdateUserInfoResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (s stubHello) ListGreetings(ctx context.Context, req *pb.ListGreetingsRequest) (*pb.ListGreetingsResponse, error) {
+	if s.down {
+		return nil, errors.New("hello down")
+	}
+	return &pb.ListGreetingsResponse{
+		BaseRsp:   &pbcommon.BaseRsp{},
+		Greetings: []*pb.Greeting{{Name: req.Name, Reply: "Hi," + req.Name}},
+	}, nil
+}
+
+type stubAdd struct {
+	slow bool
+}
+
+func (s stubAdd) Sum(ctx context.Context, a, b int) (int, error) {
+	if s.slow {
+		<-ctx.Done()
+		return 0, ctx.Err()
+	}
+	if a == 0 && b == 0 {
+		return 0, addservice.ErrTwoZeroes
+	}
+	return a + b, nil
+}
+
+func (s stubAdd) Concat(ctx context.Context, a, b string) (string, error) {
+	if a == "" && b == "" {
+		return "", addendpoint.ErrInvalidRequest.WithDetails(map[string]string{"a": "required when b is empty"})
+	}
+	return a + b, nil
+}
+
+func newTestServer(hello stubHello, add stubAdd) *httptest.Server {
+	r := mux.NewRouter()
+	gw := &MyGateWay{
+		Gateway: gateway.New(r, "", gokit_foundation.NewLogger(nil)),
+		hello:   hello,
+		add:     add,
+	}
+	if err := setupRoutes(r, gw); err != nil {
+		panic(err)
+	}
+	return httptest.NewServer(r)
+}
+
+func doGet(t *testing.T, url string, auth bool) (*http.Response, []byte) {
+	req, _ := http.NewRequest("GET", url, nil)
+	if auth {
+		req.Header.Set("Authorization", "Bearer "+genJWToken())
+	}
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rsp.Body.Close()
+	var body json.RawMessage
+	_ = json.NewDecoder(rsp.Body).Decode(&body)
+	return rsp, body
+}
+
+func TestMyGateWay_Composite(t *testing.T) {
+	old := compositeCallTimeout
+	compositeCallTimeout = time.Millisecond * 100
+	defer func() { compositeCallTimeout = old }()
+
+	test := []struct {
+		name       string
+		hello      stubHello
+		add        stubAdd
+		query      string
+		auth       bool
+		wantStatus int
+		wantErrs   []string
+	}{
+		{name: "[no token]", query: "?a=1&b=2", wantStatus: 401},
+		{name: "[bad params]", query: "?a=x&b=2", auth: true, wantStatus: 400},
+		{name: "[all ok]", query: "?a=1&b=2", auth: true, wantStatus: 200},
+		{name: "[sum timeout]", add: stubAdd{slow: true}, query: "?a=1&b=2", auth: true, wantStatus: 200, wantErrs: []string{"sum"}},
+		{name: "[hello down]", hello: stubHello{down: true}, query: "?a=1&b=2", auth: true, wantStatus: 200, wantErrs: []string{"greetings", "hi"}},
+		{name: "[all down]", hello: stubHello{down: true}, add: stubAdd{slow: true}, query: "?a=1&b=2", auth: true, wantStatus: 503},
+	}
+	for _, tt := range test {
+		srv := newTestServer(tt.hello, tt.add)
+		rsp, body := doGet(t, srv.URL+"/composite/Tom"+tt.query, tt.auth)
+		srv.Close()
+		if rsp.StatusCode != tt.wantStatus {
+			t.Errorf("name:%s got code:%d want code:%d", tt.name, rsp.StatusCode, tt.wantStatus)
+			continue
+		}
+		if rsp.StatusCode != 200 {
+			continue
+		}
+		got := new(compositeRsp)
+		if err := json.Unmarshal(body, got); err != nil {
+			t.Fatalf("name:%s unmarshal err:%v", tt.name, err)
+		}
+		if len(got.Errors) != len(tt.wantErrs) {
+			t.Errorf("name:%s got errors:%v want:%v", tt.name, got.Errors, tt.wantErrs)
+		}
+		for _, part := range tt.wantErrs {
+			if _, ok := got.Errors[part]; !ok {
+				t.Errorf("name:%s missing error of %s", tt.name, part)
+			}
+		}
+		if got.Errors["sum"] == "" && (got.Sum == nil || got.Sum.V != 3) {
+			t.Errorf("name:%s got sum:%+v", tt.name, got.Sum)
+		}
+		if got.Errors["hi"] == "" && (got.Hi == nil || got.Hi.Reply != "Hi,Tom") {
+			t.Errorf("name:%s got hi:%+v", tt.name, got.Hi)
+		}
+		if got.Errors["greetings"] == "" && len(got.Greetings) != 1 {
+			t.Errorf("name:%s got greetings:%v", tt.name, got.Greetings)
+		}
+	}
+}
+
+func TestMyGateWay_Sum(t *testing.T) {
+	srv := newTestServer(stubHello{}, stubAdd{})
+	defer srv.Close()
+
+	test := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantCode   int
+	}{
+		{name: "[ok]", body: `{"a":1,"b":2}`, wantStatus: 200},
+		{name: "[biz err]", body: `{"a":0,"b":0}`, wantStatus: 400, wantCode: addservice.CodeInvalidInput},
+		{name: "[bad body]", body: `{`, wantStatus: 400},
+	}
+	for _, tt := range test {
+		req, _ := http.NewRequest("POST", srv.URL+"/addsvc/sum", strings.NewReader(tt.body))
+		req.Header.Set("Authorization", "Bearer "+genJWToken())
+		rsp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := new(errs.HTTPBody)
+		_ = json.NewDecoder(rsp.Body).Decode(got)
+		rsp.Body.Close()
+		if ct := rsp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+			t.Errorf("name:%s got Content-Type:%q", tt.name, ct)
+		}
+		if rsp.StatusCode != tt.wantStatus {
+			t.Errorf("name:%s got code:%d want code:%d", tt.name, rsp.StatusCode, tt.wantStatus)
+		} else if got.Code != tt.wantCode {
+			t.Errorf("name:%s got code:%d want:%d", tt.name, got.Code, tt.wantCode)
+		}
+	}
+}
+
+func TestMyGateWay_Concat(t *testing.T) {
+	srv := newTestServer(stubHello{}, stubAdd{})
+	defer srv.Close()
+
+	req, _ := http.NewRequest("POST", srv.URL+"/addsvc/concat", strings.NewReader(`{}`))
+	req.Header.Set("Authorization", "Bearer "+genJWToken())
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rsp.Body.Close()
+	got := new(errs.HTTPBody)
+	_ = json.NewDecoder(rsp.Body).Decode(got)
+	if rsp.StatusCode != http.StatusBadRequest || got.Details["a"] == "" || got.Code != addservice.CodeInvalidArgs {
+		t.Errorf("got code:%d body:%+v", rsp.StatusCode, got)
+	}
+}
@@ -3,17 +3,27 @@ module gateway
 go 1.12
 
 require (
+	github.com/dgrijalva/jwt-go v3.2.0+incompatible
+	github.com/go-kit/kit v0.10.0
 	github.com/go-redis/redis v6.15.7+incompatible
 	github.com/gorilla/mux v1.8.0
+	github.com/graph-gophers/dataloader/v6 v6.0.0
+	github.com/graphql-go/graphql v0.7.9
 	github.com/leigg-go/go-util v0.0.4
+	github.com/opentracing/opentracing-go v1.2.0
+	github.com/prometheus/client_golang v1.7.1
 	go-util v0.0.0-00010101000000-000000000000
 	gokit_foundation v0.0.0-00010101000000-000000000000
-	gopkg.in/jose.v1 v1.0.0-20161127122323-a941c3995164
+	golang.org/x/time v0.0.0-20191024005414-555d28b269f0
 	hello v0.0.0-00010101000000-000000000000
+	new_addsvc v0.0.0-00010101000000-000000000000
+	usersvc v0.0.0-00010101000000-000000000000
 )
 
 replace (
 	go-util => ../../go-util
 	gokit_foundation => ../../gokit_foundation
 	hello => ../hello
+	new_addsvc => ../new_addsvc
+	usersvc => ../usersvc
 )
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/graph-gophers/dataloader/v6"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"gokit_foundation/errs"
+	"gokit_foundation/gateway"
+	"hello/pb/gen-go/pb"
+	"hello/pb/gen-go/pbcommon"
+	"net/http"
+	addclient "new_addsvc/client"
+	addendpoint "new_addsvc/pkg/endpoint"
+	"strconv"
+	"sync"
+	"time"
+	userservice "usersvc/pkg/service"
+)
+
+/*
+GraphQL接口：POST /graphql {"query": "...", "variables": {...}}，字段映射到后端服务的client调用(new_addsvc、hello通过grpc，usersvc通过HTTP)
+	query { sum(a: 1, b: 2) concat(a: "x", b: "y") hi: sayHi(name: "Jack") { reply errCode } greetings(name: "Jack", limit: 5) { name reply createdAt } user(id: "1") { id name email } }
+	mutation { createUser(name: "Jack", email: "jack@a.com") { id } updateUser(id: "1", name: "Tom") { name } deleteUser(id: "1") }
+-	同一个请求中的sum、sayHi、user通过dataloader合并：等待graphqlBatchWait收集同一层的调用，相同的参数只调用一次后端，
+	sum通过new_addsvc的BatchSum一次调用，没有批量接口的后端batch内不同的参数并发调用
+-	每个resolver一个span(graphql.<字段名>)，父span从请求header中提取，dataloader的每个batch也有span
+-	字段的错误不影响其他字段，在errors中返回，extensions中包含kind、code、retryable(与errs.HTTPBody相同)，查询本身的错误(语法等)没有extensions
+-	和/addsvc一样需要登录
+*/
+
+// dataloader收集调用的时间窗口
+var graphqlBatchWait = time.Millisecond * 2
+
+type graphqlReq struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+type gqlHi struct {
+	Reply   string
+	ErrCode int
+}
+
+type gqlUser struct {
+	ID        int64
+	Name      string
+	Email     string
+	CreatedAt string
+	UpdatedAt string
+}
+
+// 字段错误经过graphql的多层封装(dataloader返回的err还会多一层FormattedError)，取出resolver返回的原始err，查询本身的错误返回nil
+func originalError(err error) error {
+	for {
+		switch e := err.(type) {
+		case gqlerrors.FormattedError:
+			err = e.OriginalError()
+		case *gqlerrors.Error:
+			err = e.OriginalError
+		default:
+			return err
+		}
+	}
+}
+
+func errorExtensions(err error) map[string]interface{} {
+	b := errs.NewHTTPBody(err)
+	ext := map[string]interface{}{"kind": b.Kind, "code": b.Code, "retryable": b.Retryable}
+	if len(b.Details) > 0 {
+		ext["details"] = b.Details
+	}
+	return ext
+}
+
+// usersvc的业务错误不是*errs.Error，按Code转换，其他err(如调用失败)由errs.From分类
+func userErr(err error) error {
+	var e *userservice.Error
+	if !errors.As(err, &e) {
+		return err
+	}
+	if e.Code == userservice.CodeNotFound {
+		return errs.NotFound(e.Msg).WithCode(e.Code)
+	}
+	return errs.Invalid(e.Msg).WithCode(e.Code)
+}
+
+type sumKey struct{ a, b int }
+
+func (k sumKey) String() string   { return fmt.Sprintf("%d,%d", k.a, k.b) }
+func (k sumKey) Raw() interface{} { return k }
+
+// 每个请求一组loader，缓存只在请求内有效
+type loaders struct {
+	sum, sayHi, user *dataloader.Loader
+}
+
+type loadersKey struct{}
+
+func loadersFrom(ctx context.Context) *loaders {
+	return ctx.Value(loadersKey{}).(*loaders)
+}
+
+func (gw *MyGateWay) newLoaders() *loaders {
+	opts := []dataloader.Option{dataloader.WithWait(graphqlBatchWait), dataloader.WithOpenTracingTracer()}
+	return &loaders{
+		// BatchSum每次最多100项
+		sum: dataloader.NewBatchedLoader(gw.batchSum, append(opts, dataloader.WithBatchCapacity(100))...),
+		sayHi: dataloader.NewBatchedLoader(func(ctx context.Context, keys dataloader.Keys) []*dataloader.Result {
+			return batchEach(ctx, keys, func(ctx context.Context, key dataloader.Key) (interface{}, error) {
+				reply, code := gw.hello.SayHi(ctx, key.String())
+				if code == pbcommon.R_RPC_ERR {
+					return nil, errRPC
+				}
+				return &gqlHi{Reply: reply, ErrCode: int(code)}, nil
+			})
+		}, opts...),
+		user: dataloader.NewBatchedLoader(func(ctx context.Context, keys dataloader.Keys) []*dataloader.Result {
+			return batchEach(ctx, keys, func(ctx context.Context, key dataloader.Key) (interface{}, error) {
+				id, _ := strconv.ParseInt(key.String(), 10, 64)
+				u, err := gw.users.GetUser(ctx, id)
+				if err != nil {
+					return nil, userErr(err)
+				}
+				return toGQLUser(u.ID, u.Name, u.Email, u.CreatedAt, u.UpdatedAt), nil
+			})
+		}, opts...),
+	}
+}
+
+// new_addsvc的client实现了addclient.BatchSummer时，batch内的sum只调用一次BatchSum，否则与其他loader一样并发调用
+// 整批失败时每个key都返回这个err，否则每个key的err与单独调用Sum时相同
+func (gw *MyGateWay) batchSum(ctx context.Context, keys dataloader.Keys) []*dataloader.Result {
+	bs, ok := gw.add.(addclient.BatchSummer)
+	if !ok {
+		return batchEach(ctx, keys, func(ctx context.Context, key dataloader.Key) (interface{}, error) {
+			k := key.Raw().(sumKey)
+			return gw.add.Sum(ctx, k.a, k.b)
+		})
+	}
+	items := make([]*addendpoint.SumRequest, len(keys))
+	for i, key := range keys {
+		k := key.Raw().(sumKey)
+		items[i] = &addendpoint.SumRequest{A: k.a, B: k.b}
+	}
+	vs, itemErrs, err := bs.BatchSum(ctx, items)
+	results := make([]*dataloader.Result, len(keys))
+	for i := range keys {
+		if err != nil {
+			results[i] = &dataloader.Result{Error: err}
+			continue
+		}
+		results[i] = &dataloader.Result{Data: vs[i], Error: itemErrs[i]}
+	}
+	return results
+}
+
+// 后端没有批量接口时，batch内的key并发调用，结果与keys一一对应
+func batchEach(ctx context.Context, keys dataloader.Keys, load func(ctx context.Context, key dataloader.Key) (interface{}, error)) []*dataloader.Result {
+	results := make([]*dataloader.Result, len(keys))
+	var wg sync.WaitGroup
+	for i, key := range keys {
+		wg.Add(1)
+		go func(i int, key dataloader.Key) {
+			defer wg.Done()
+			v, err := load(ctx, key)
+			results[i] = &dataloader.Result{Data: v, Error: err}
+		}(i, key)
+	}
+	wg.Wait()
+	return results
+}
+
+func toGQLUser(id int64, name, email string, createdAt, updatedAt time.Time) *gqlUser {
+	return &gqlUser{ID: id, Name: name, Email: email, CreatedAt: createdAt.Format(time.RFC3339), UpdatedAt: updatedAt.Format(time.RFC3339)}
+}
+
+// 为resolver创建span，返回thunk(dataloader)时span在thunk执行完后结束
+func traced(field string, resolve graphql.FieldResolveFn) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		span, ctx := opentracing.StartSpanFromContext(p.Context, "graphql."+field)
+		p.Context = ctx
+		finish := func(v interface{}, err error) (interface{}, error) {
+			if err != nil {
+				ext.Error.Set(span, true)
+				span.LogKV("error", err)
+			}
+			span.Finish()
+			return v, err
+		}
+		v, err := resolve(p)
+		if thunk, ok := v.(dataloader.Thunk); ok && err == nil {
+			// graphql只识别未命名的func类型
+			return func() (interface{}, error) {
+				return finish(thunk())
+			}, nil
+		}
+		return finish(v, err)
+	}
+}
+
+func (gw *MyGateWay) newGraphQLSchema() (graphql.Schema, error) {
+	hiType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Hi",
+		Fields: graphql.Fields{
+			"reply":   &graphql.Field{Type: graphql.String},
+			"errCode": &graphql.Field{Type: graphql.Int},
+		},
+	})
+	greetingType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Greeting",
+		Fields: graphql.Fields{
+			"name":      &graphql.Field{Type: graphql.String},
+			"reply":     &graphql.Field{Type: graphql.String},
+			"createdAt": &graphql.Field{Type: graphql.Int},
+		},
+	})
+	userType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "User",
+		Fields: graphql.Fields{
+			"id":        &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+			"name":      &graphql.Field{Type: graphql.String},
+			"email":     &graphql.Field{Type: graphql.String},
+			"createdAt": &graphql.Field{Type: graphql.String},
+			"updatedAt": &graphql.Field{Type: graphql.String},
+		},
+	})
+	nonNull := func(t graphql.Input) *graphql.ArgumentConfig {
+		return &graphql.ArgumentConfig{Type: graphql.NewNonNull(t)}
+	}
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"sum": &graphql.Field{
+				Type: graphql.Int,
+				Args: graphql.FieldConfigArgument{"a": nonNull(graphql.Int), "b": nonNull(graphql.Int)},
+				Resolve: traced("sum", func(p graphql.ResolveParams) (interface{}, error) {
+					k := sumKey{a: p.Args["a"].(int), b: p.Args["b"].(int)}
+					return loadersFrom(p.Context).sum.Load(p.Context, k), nil
+				}),
+			},
+			"concat": &graphql.Field{
+				Type: graphql.String,
+				Args: graphql.FieldConfigArgument{"a": nonNull(graphql.String), "b": nonNull(graphql.String)},
+				Resolve: traced("concat", func(p graphql.ResolveParams) (interface{}, error) {
+					return gw.add.Concat(p.Context, p.Args["a"].(string), p.Args["b"].(string))
+				}),
+			},
+			"sayHi": &graphql.Field{
+				Type: hiType,
+				Args: graphql.FieldConfigArgument{"name": nonNull(graphql.String)},
+				Resolve: traced("sayHi", func(p graphql.ResolveParams) (interface{}, error) {
+					return loadersFrom(p.Context).sayHi.Load(p.Context, dataloader.StringKey(p.Args["name"].(string))), nil
+				}),
+			},
+			"greetings": &graphql.Field{
+				Type: graphql.NewList(greetingType),
+				Args: graphql.FieldConfigArgument{
+					"name":  nonNull(graphql.String),
+					"limit": &graphql.ArgumentConfig{Type: graphql.Int},
+				},
+				Resolve: traced("greetings", func(p graphql.ResolveParams) (interface{}, error) {
+					limit, _ := p.Args["limit"].(int)
+					if limit < 0 {
+						return nil, errs.Invalid("limit must not be negative")
+					}
+					rsp, err := gw.hello.ListGreetings(p.Context, &pb.ListGreetingsRequest{
+						BaseReq: &pbcommon.BaseReq{},
+						Name:    p.Args["name"].(string),
+						Limit:   uint32(limit),
+					})
+					if err != nil {
+						return nil, err
+					}
+					return rsp.Greetings, nil
+				}),
+			},
+			"user": &graphql.Field{
+				Type: userType,
+				Args: graphql.FieldConfigArgument{"id": nonNull(graphql.ID)},
+				Resolve: traced("user", func(p graphql.ResolveParams) (interface{}, error) {
+					id := p.Args["id"].(string)
+					if _, err := strconv.ParseInt(id, 10, 64); err != nil {
+						return nil, errs.Invalid("invalid id")
+					}
+					return loadersFrom(p.Context).user.Load(p.Context, dataloader.StringKey(id)), nil
+				}),
+			},
+		},
+	})
+
+	optString := func(p graphql.ResolveParams, name string) *string {
+		if s, ok := p.Args[name].(string); ok {
+			return &s
+		}
+		return nil
+	}
+	// 修改后清除loader中的缓存，同一个请求中之后的查询读到新的数据
+	parseUserID := func(p graphql.ResolveParams) (int64, error) {
+		id, err := strconv.ParseInt(p.Args["id"].(string), 10, 64)
+		if err != nil {
+			return 0, errs.Invalid("invalid id")
+		}
+		loadersFrom(p.Context).user.Clear(p.Context, dataloader.StringKey(p.Args["id"].(string)))
+		return id, nil
+	}
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createUser": &graphql.Field{
+				Type: userType,
+				Args: graphql.FieldConfigArgument{"name": nonNull(graphql.String), "email": nonNull(graphql.String)},
+				Resolve: traced("createUser", func(p graphql.ResolveParams) (interface{}, error) {
+					u, err := gw.users.CreateUser(p.Context, p.Args["name"].(string), p.Args["email"].(string))
+					if err != nil {
+						return nil, userErr(err)
+					}
+					return toGQLUser(u.ID, u.Name, u.Email, u.CreatedAt, u.UpdatedAt), nil
+				}),
+			},
+			"updateUser": &graphql.Field{
+				Type: userType,
+				Args: graphql.FieldConfigArgument{
+					"id":    nonNull(graphql.ID),
+					"name":  &graphql.ArgumentConfig{Type: graphql.String},
+					"email": &graphql.ArgumentConfig{Type: graphql.String},
+				},
+				Resolve: traced("updateUser", func(p graphql.ResolveParams) (interface{}, error) {
+					id, err := parseUserID(p)
+					if err != nil {
+						return nil, err
+					}
+					u, err := gw.users.UpdateUser(p.Context, id, optString(p, "name"), optString(p, "email"))
+					if err != nil {
+						return nil, userErr(err)
+					}
+					return toGQLUser(u.ID, u.Name, u.Email, u.CreatedAt, u.UpdatedAt), nil
+				}),
+			},
+			"deleteUser": &graphql.Field{
+				Type: graphql.Boolean,
+				Args: graphql.FieldConfigArgument{"id": nonNull(graphql.ID)},
+				Resolve: traced("deleteUser", func(p graphql.ResolveParams) (interface{}, error) {
+					id, err := parseUserID(p)
+					if err != nil {
+						return nil, err
+					}
+					if err = gw.users.DeleteUser(p.Context, id); err != nil {
+						return nil, userErr(err)
+					}
+					return true, nil
+				}),
+			},
+		},
+	})
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query, Mutation: mutation})
+}
+
+// POST /graphql，查询本身的错误(语法、字段不存在等)和字段的错误都在errors中返回，http状态码为200
+func (gw *MyGateWay) GraphQL(w http.ResponseWriter, r *http.Request) {
+	req := new(graphqlReq)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil || req.Query == "" {
+		gateway.WriteError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	tracer := opentracing.GlobalTracer()
+	parent, _ := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(r.Header))
+	span := tracer.StartSpan("graphql", ext.RPCServerOption(parent))
+	defer span.Finish()
+	if req.OperationName != "" {
+		span.SetTag("graphql.operation", req.OperationName)
+	}
+	ctx := opentracing.ContextWithSpan(r.Context(), span)
+	ctx = context.WithValue(ctx, loadersKey{}, gw.newLoaders())
+
+	result := graphql.Do(graphql.Params{
+		Schema:         gw.graphqlSchema,
+		RequestString:  req.Query,
+		OperationName:  req.OperationName,
+		VariableValues: req.Variables,
+		Context:        ctx,
+	})
+	for i, e := range result.Errors {
+		if err := originalError(e); err != nil {
+			result.Errors[i].Extensions = errorExtensions(err)
+			gw.Log(append([]interface{}{"api", "GraphQL", "path", fmt.Sprint(e.Path)}, errs.LogKeyvals(err)...)...)
+		} else {
+			gw.Log("api", "GraphQL", "err", e.Message)
+		}
+	}
+	gw.JSON(w, result)
+}
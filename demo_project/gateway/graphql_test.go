@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"gokit_foundation"
+	"gokit_foundation/gateway"
+	"gokit_foundation/pagination"
+	"net/http"
+	"net/http/httptest"
+	addendpoint "new_addsvc/pkg/endpoint"
+	addservice "new_addsvc/pkg/service"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"usersvc/pkg/repository"
+	userservice "usersvc/pkg/service"
+)
+
+// 记录Sum的调用次数，验证dataloader的去重
+type countingAdd struct {
+	stubAdd
+	sums int32
+}
+
+func (s *countingAdd) Sum(ctx context.Context, a, b int) (int, error) {
+	atomic.AddInt32(&s.sums, 1)
+	return s.stubAdd.Sum(ctx, a, b)
+}
+
+// 实现了addclient.BatchSummer，记录BatchSum的调用次数
+type batchingAdd struct {
+	countingAdd
+	batches int32
+}
+
+func (s *batchingAdd) BatchSum(ctx context.Context, items []*addendpoint.SumRequest) ([]int, []error, error) {
+	atomic.AddInt32(&s.batches, 1)
+	vs, itemErrs := make([]int, len(items)), make([]error, len(items))
+	for i, item := range items {
+		vs[i], itemErrs[i] = s.stubAdd.Sum(ctx, item.A, item.B)
+	}
+	return vs, itemErrs, nil
+}
+
+type stubUsers struct {
+	mu    sync.Mutex
+	users map[int64]*repository.User
+	gets  int32
+}
+
+func (s *stubUsers) CreateUser(_ context.Context, name, email string) (*repository.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := &repository.User{ID: int64(len(s.users) + 1), Name: name, Email: email, CreatedAt: time.Now()}
+	s.users[u.ID] = u
+	return u, nil
+}
+
+func (s *stubUsers) GetUser(_ context.Context, id int64) (*repository.User, error) {
+	atomic.AddInt32(&s.gets, 1)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if u, ok := s.users[id]; ok {
+		c := *u
+		return &c, nil
+	}
+	return nil, userservice.ErrUserNotFound
+}
+
+func (s *stubUsers) UpdateUser(_ context.Context, id int64, name, email *string) (*repository.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[id]
+	if !ok {
+		return nil, userservice.ErrUserNotFound
+	}
+	if name != nil {
+		u.Name = *name
+	}
+	if email != nil {
+		u.Email = *email
+	}
+	c := *u
+	return &c, nil
+}
+
+func (s *stubUsers) DeleteUser(_ context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[id]; !ok {
+		return userservice.ErrUserNotFound
+	}
+	delete(s.users, id)
+	return nil
+}
+
+// graphql没有使用列表接口
+func (s *stubUsers) ListUsers(context.Context, pagination.Params, string) ([]*repository.User, string, error) {
+	return nil, "", nil
+}
+
+type graphqlRsp struct {
+	Data   map[string]json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string                 `json:"message"`
+		Path       []interface{}          `json:"path"`
+		Extensions map[string]interface{} `json:"extensions"`
+	} `json:"errors"`
+}
+
+func newGraphQLTestServer(add addservice.Service, users userservice.Service) *httptest.Server {
+	r := mux.NewRouter()
+	gw := &MyGateWay{
+		Gateway: gateway.New(r, "", gokit_foundation.NewLogger(nil)),
+		hello:   stubHello{},
+		add:     add,
+		users:   users,
+	}
+	if err := setupRoutes(r, gw); err != nil {
+		panic(err)
+	}
+	return httptest.NewServer(r)
+}
+
+func doGraphQL(t *testing.T, url, query string) (int, *graphqlRsp) {
+	body, _ := json.Marshal(graphqlReq{Query: query})
+	req, _ := http.NewRequest("POST", url+"/graphql", strings.NewReader(string(body)))
+	req.Header.Set("Authorization", "Bearer "+genJWToken())
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rsp.Body.Close()
+	got := new(graphqlRsp)
+	_ = json.NewDecoder(rsp.Body).Decode(got)
+	return rsp.StatusCode, got
+}
+
+func TestMyGateWay_GraphQL(t *testing.T) {
+	add := &countingAdd{}
+	users := &stubUsers{users: map[int64]*repository.User{}}
+	srv := newGraphQLTestServer(add, users)
+	defer srv.Close()
+
+	// 相同参数的sum只调用一次后端，sum(0,0)的业务错误只影响这个字段
+	code, rsp := doGraphQL(t, srv.URL, `{
+		s1: sum(a: 1, b: 2)
+		s2: sum(a: 1, b: 2)
+		s3: sum(a: 2, b: 2)
+		bad: sum(a: 0, b: 0)
+		concat(a: "x", b: "y")
+		hi: sayHi(name: "Tom") { reply errCode }
+		greetings(name: "Tom") { name reply }
+	}`)
+	if code != 200 || string(rsp.Data["s1"]) != "3" || string(rsp.Data["s2"]) != "3" || string(rsp.Data["s3"]) != "4" ||
+		string(rsp.Data["concat"]) != `"xy"` || string(rsp.Data["hi"]) != `{"errCode":0,"reply":"Hi,Tom"}` ||
+		string(rsp.Data["greetings"]) != `[{"name":"Tom","reply":"Hi,Tom"}]` {
+		t.Errorf("got code:%d data:%s", code, rsp.Data)
+	}
+	if n := atomic.LoadInt32(&add.sums); n != 3 {
+		t.Errorf("got sum calls:%d", n)
+	}
+	if len(rsp.Errors) != 1 || rsp.Errors[0].Path[0] != "bad" || rsp.Errors[0].Extensions["kind"] != "invalid" ||
+		rsp.Errors[0].Extensions["code"] != float64(addservice.CodeInvalidInput) {
+		t.Errorf("got errors:%+v", rsp.Errors)
+	}
+
+	_, rsp = doGraphQL(t, srv.URL, `mutation { createUser(name: "Jack", email: "jack@a.com") { id name } }`)
+	if string(rsp.Data["createUser"]) != `{"id":"1","name":"Jack"}` {
+		t.Errorf("got data:%s errors:%+v", rsp.Data, rsp.Errors)
+	}
+	_, rsp = doGraphQL(t, srv.URL, `{ u1: user(id: "1") { name } u2: user(id: "1") { email } missing: user(id: "2") { name } }`)
+	if string(rsp.Data["u1"]) != `{"name":"Jack"}` || string(rsp.Data["u2"]) != `{"email":"jack@a.com"}` ||
+		len(rsp.Errors) != 1 || rsp.Errors[0].Extensions["kind"] != "not_found" {
+		t.Errorf("got data:%s errors:%+v", rsp.Data, rsp.Errors)
+	}
+	if n := atomic.LoadInt32(&users.gets); n != 2 {
+		t.Errorf("got GetUser calls:%d", n)
+	}
+	_, rsp = doGraphQL(t, srv.URL, `mutation { updateUser(id: "1", name: "Tom") { name email } deleteUser(id: "1") }`)
+	if string(rsp.Data["updateUser"]) != `{"email":"jack@a.com","name":"Tom"}` || string(rsp.Data["deleteUser"]) != "true" {
+		t.Errorf("got data:%s errors:%+v", rsp.Data, rsp.Errors)
+	}
+
+	// 查询本身的错误
+	code, rsp = doGraphQL(t, srv.URL, `{ nope }`)
+	if code != 200 || len(rsp.Errors) != 1 {
+		t.Errorf("got code:%d errors:%+v", code, rsp.Errors)
+	}
+}
+
+// 后端有BatchSum时同一层的sum只调用一次
+func TestMyGateWay_GraphQLBatchSum(t *testing.T) {
+	add := &batchingAdd{}
+	srv := newGraphQLTestServer(add, &stubUsers{users: map[int64]*repository.User{}})
+	defer srv.Close()
+
+	_, rsp := doGraphQL(t, srv.URL, `{ s1: sum(a: 1, b: 2) s2: sum(a: 2, b: 2) bad: sum(a: 0, b: 0) }`)
+	if string(rsp.Data["s1"]) != "3" || string(rsp.Data["s2"]) != "4" || len(rsp.Errors) != 1 || rsp.Errors[0].Extensions["kind"] != "invalid" {
+		t.Errorf("got data:%s errors:%+v", rsp.Data, rsp.Errors)
+	}
+	if b, n := atomic.LoadInt32(&add.batches), atomic.LoadInt32(&add.sums); b != 1 || n != 0 {
+		t.Errorf("got BatchSum calls:%d Sum calls:%d", b, n)
+	}
+}
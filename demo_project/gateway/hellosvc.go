@@ -1,12 +1,12 @@
 package main
 
 import (
-	"context"
 	"github.com/gorilla/mux"
-	helloclient "hello/client/grpc"
+	"gokit_foundation/gateway"
 	"hello/pb/gen-go/pb"
 	"hello/pb/gen-go/pbcommon"
 	"net/http"
+	"strconv"
 )
 
 /*
@@ -24,11 +24,11 @@ func (gw *MyGateWay) SayHi(w http.ResponseWriter, r *http.Request) {
 	// 这个便利性来自于mux
 	name := v["name"]
 
-	// new一个写好的RPC客户端, 这里演示了一种logger传递方法，实际项目中并不一定需要这样做
-	c := helloclient.MustNew(gw.RawLogger())
+	// 使用带服务发现的RPC客户端(见newMyGW)
+	c := gw.hello
 
 	// 像本地调用一样的远程调用
-	reply, code := c.SayHi(context.Background(), name)
+	reply, code := c.SayHi(r.Context(), name)
 
 	rsp := &pb.SayHiResponse{
 		Reply:   reply,
@@ -44,12 +44,12 @@ func (gw *MyGateWay) SayHi(w http.ResponseWriter, r *http.Request) {
 func (gw *MyGateWay) MakeADate(w http.ResponseWriter, r *http.Request) {
 	v := mux.Vars(r)
 
-	c := helloclient.MustNew(gw.RawLogger())
+	c := gw.hello
 
 	var err error
 	var rsp *pb.MakeADateResponse
 
-	rsp, err = c.MakeADate(context.Background(), &pb.MakeADateRequest{
+	rsp, err = c.MakeADate(r.Context(), &pb.MakeADateRequest{
 		BaseReq: &pbcommon.BaseReq{Plat: pbcommon.Plat_pc},
 		DateStr: v["date"],
 		WantSay: v["want_say"],
@@ -74,7 +74,7 @@ func (gw *MyGateWay) UpdateUserInfo(w http.ResponseWriter, r *http.Request) {
 	// 不再从url中获取参数
 	// v := mux.Vars(r)
 
-	c := helloclient.MustNew(gw.RawLogger())
+	c := gw.hello
 
 	rpcReq := &pb.UpdateUserInfoRequest{
 		BaseReq: &pbcommon.BaseReq{},
@@ -89,7 +89,7 @@ func (gw *MyGateWay) UpdateUserInfo(w http.ResponseWriter, r *http.Request) {
 	var err error
 	var rsp *pb.UpdateUserInfoResponse
 
-	rsp, err = c.UpdateUserInfo(context.Background(), rpcReq)
+	rsp, err = c.UpdateUserInfo(r.Context(), rpcReq)
 	if err != nil {
 		rsp = &pb.UpdateUserInfoResponse{
 			BaseRsp: &pbcommon.BaseRsp{ErrCode: pbcommon.R_RPC_ERR},
@@ -98,3 +98,28 @@ func (gw *MyGateWay) UpdateUserInfo(w http.ResponseWriter, r *http.Request) {
 	}
 	gw.JSON(w, rsp)
 }
+
+// 查询问候记录，limit为空时由hello服务决定默认值
+func (gw *MyGateWay) ListGreetings(w http.ResponseWriter, r *http.Request) {
+	rpcReq := &pb.ListGreetingsRequest{
+		BaseReq: &pbcommon.BaseReq{},
+		Name:    mux.Vars(r)["name"],
+	}
+	if s := r.URL.Query().Get("limit"); s != "" {
+		limit, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			gateway.WriteError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		rpcReq.Limit = uint32(limit)
+	}
+
+	rsp, err := gw.hello.ListGreetings(r.Context(), rpcReq)
+	if err != nil {
+		gw.Log("ListGreetings->err", err)
+		rsp = &pb.ListGreetingsResponse{
+			BaseRsp: &pbcommon.BaseRsp{ErrCode: pbcommon.R_RPC_ERR},
+		}
+	}
+	gw.JSON(w, rsp)
+}
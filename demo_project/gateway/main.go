@@ -1,12 +1,44 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
+	"fmt"
+	"gateway/routes"
+	"github.com/go-kit/kit/log"
 	"github.com/go-redis/redis"
 	"github.com/gorilla/mux"
+	"github.com/graphql-go/graphql"
 	"github.com/leigg-go/go-util/_redis"
+	"github.com/opentracing/opentracing-go"
 	"gokit_foundation"
 	"gokit_foundation/gateway"
+	"gokit_foundation/sdclient"
+	"gokit_foundation/tracing"
+	"golang.org/x/time/rate"
+	helloclient "hello/client"
+	helloservice "hello/pkg/service"
+	"io"
+	addclient "new_addsvc/client"
+	addservice "new_addsvc/pkg/service"
+	"os"
+	"time"
+	userclient "usersvc/client"
+	userservice "usersvc/pkg/service"
+)
+
+var (
+	httpAddr       = flag.String("http.addr", ":8000", "Address for HTTP (JSON) server")
+	consulAddr     = flag.String("consul.addr", ":8500", "Consul address for discovering backend services")
+	adminAddr      = flag.String("admin.addr", ":8001", "Admin listen address(pprof, expvar, runtime stats, log level, shutdown), empty to disable")
+	rateLimitRPS   = flag.Float64("ratelimit.rps", 20, "Requests per second allowed for each client ip")
+	rateLimitBurst = flag.Int("ratelimit.burst", 40, "Burst size of the per client rate limiter")
+	usersvcAddr    = flag.String("usersvc.addr", "", "Address of usersvc instance(HTTP) used by /graphql, discover instances from consul if empty")
+	canaryTag      = flag.String("canary.tag", "", "Consul tag of new_addsvc canary instances, enables traffic splitting if set(see canary.go)")
+	canaryPercent  = flag.Int("canary.percent", 5, "Percentage(0~100) of new_addsvc calls sent to canary instances, can be changed through admin /canary")
+	blueGreen      = flag.String("bluegreen.active", "", "Initial active group(blue or green) of new_addsvc blue/green deployment, can be switched through admin /bluegreen, empty to disable(see bluegreen.go)")
+	jaegerAgent    = flag.String("jaeger.agent", "", "Jaeger agent address(host:port) for reporting spans of gateway and backend clients, empty to disable tracing")
 )
 
 type MyGateWay struct {
@@ -16,31 +48,136 @@ type MyGateWay struct {
 	// 最好将此网关用到的外部服务如redis/mysql...统一放在此处，这样方便一眼看出这个服务使用了哪些外部服务
 	// (目前gw没有使用redis，仅做演示)
 	redisCli *redis.Client
-}
 
-func newMyGW(r *mux.Router) *MyGateWay {
-	var httpAddr = flag.String("http.addr", ":8000", "Address for HTTP (JSON) server")
+	// 后端服务的client，实例地址从consul获取，负载均衡、重试由client内部完成
+	hello helloservice.HelloService
+	add   addservice.Service
+	users userservice.Service
 
+	graphqlSchema graphql.Schema
+	metrics       *Metrics
+}
+
+// 创建client失败时返回err(带上是哪个client)，由main输出后退出
+func newMyGW(r *mux.Router) (*MyGateWay, error) {
 	lgr := gokit_foundation.NewLogger(nil)
 	root := gateway.New(r, *httpAddr, lgr)
 	// Panics if init fail
 	rds := _redis.MustInit(GetRedisConf())
-	gw := MyGateWay{Gateway: root, redisCli: rds}
+	metricsObj := NewMetrics(lgr)
+	// 后端服务的client在创建时读取全局tracer，需要先设置
+	tracer, tracerCloser, err := newTracer(lgr)
+	if err != nil {
+		return nil, fmt.Errorf("tracing: %v", err)
+	}
+	opentracing.SetGlobalTracer(tracer)
+	// 创建client时不会连接后端服务，后端服务晚于网关启动也没有关系
+	add, stopAdd, err := newAddClient(lgr, metricsObj)
+	if err != nil {
+		return nil, fmt.Errorf("addsvc client: %v", err)
+	}
+	users, stopUsers, err := newUserClient(lgr)
+	if err != nil {
+		return nil, fmt.Errorf("usersvc client: %v", err)
+	}
+	hello, err := helloclient.New(*consulAddr, lgr)
+	if err != nil {
+		return nil, fmt.Errorf("hello client: %v", err)
+	}
+	gw := MyGateWay{
+		Gateway:  root,
+		redisCli: rds,
+		hello:    hello,
+		add:      add,
+		users:    users,
+		metrics:  metricsObj,
+	}
 
 	gw.BeforeStop(func() {
 		err := _redis.Close()
 		lgr.Log("redis.close", err)
+		stopAdd()
+		stopUsers()
+		lgr.Log("tracer.close", tracerCloser.Close())
 	})
-	return &gw
+	return &gw, nil
 }
 
-func main() {
-	var ()
-	/*
-		这里使用 https://github.com/gorilla/mux 作为路由器
-	*/
-	r := mux.NewRouter()
-	gw := newMyGW(r)
+// 设置了-usersvc.addr时直连该实例(如本地调试)，否则从consul发现实例
+func newUserClient(lgr log.Logger) (userservice.Service, func(), error) {
+	if *usersvcAddr != "" {
+		users, err := userclient.NewDirect(*usersvcAddr, time.Second*2, lgr)
+		return users, func() {}, err
+	}
+	return userclient.New(*consulAddr, lgr)
+}
+
+// 未设置-jaeger.agent时为NoopTracer
+func newTracer(lgr log.Logger) (opentracing.Tracer, io.Closer, error) {
+	conf := tracing.DefaultConfig()
+	conf.Jaeger.AgentAddr = *jaegerAgent
+	return tracing.New("gateway", conf, lgr)
+}
+
+// 设置了-canary.tag时按比例分给canary实例(见canary.go)，设置了-bluegreen.active时只调用active组(见bluegreen.go)
+// 返回的stop在网关退出时停止所有client的consul watch
+func newAddClient(lgr log.Logger, m *Metrics) (addservice.Service, func(), error) {
+	if *canaryTag != "" && *blueGreen != "" {
+		return nil, nil, errors.New("-canary.tag and -bluegreen.active are mutually exclusive")
+	}
+	if *blueGreen != "" {
+		return newBlueGreenClient(lgr, m)
+	}
+	if *canaryTag == "" {
+		return addclient.New(*consulAddr, lgr)
+	}
+	stable, stopStable, err := addclient.New(*consulAddr, lgr, sdclient.WithoutTags(*canaryTag))
+	if err != nil {
+		return nil, nil, err
+	}
+	canary, stopCanary, err := addclient.New(*consulAddr, lgr, sdclient.WithAffinity(*canaryTag))
+	if err != nil {
+		stopStable()
+		return nil, nil, err
+	}
+	stop := func() {
+		stopStable()
+		stopCanary()
+	}
+	c := newCanaryAdd(stable.(addBackend), canary.(addBackend), 0, m.CanaryRequests, m.CanaryDuration)
+	if err = c.SetPercent(*canaryPercent); err != nil {
+		stop()
+		return nil, nil, err
+	}
+	return c, stop, nil
+}
+
+func newBlueGreenClient(lgr log.Logger, m *Metrics) (addservice.Service, func(), error) {
+	blue, stopBlue, err := addclient.New(*consulAddr, lgr, sdclient.WithTags(groupBlue))
+	if err != nil {
+		return nil, nil, err
+	}
+	green, stopGreen, err := addclient.New(*consulAddr, lgr, sdclient.WithTags(groupGreen))
+	if err != nil {
+		stopBlue()
+		return nil, nil, err
+	}
+	stop := func() {
+		stopBlue()
+		stopGreen()
+	}
+	c := newBlueGreenAdd(blue.(addBackend), green.(addBackend), m.BlueGreenRequests, m.BlueGreenDuration)
+	if err = c.SetActive(*blueGreen); err != nil {
+		stop()
+		return nil, nil, err
+	}
+	return c, stop, nil
+}
+
+// 注册所有路由以及网关层的中间件
+func setupRoutes(r *mux.Router, gw *MyGateWay) error {
+	// 所有路由共用的中间件，见routes.Use
+	routes.Use(r, gw.Gateway, opentracing.GlobalTracer(), gateway.NewRateLimiter(rate.Limit(*rateLimitRPS), *rateLimitBurst, nil))
 
 	{
 		// 声明一个包含path前缀的子路由器
@@ -57,23 +194,94 @@ func main() {
 		helloSvcRoute.HandleFunc("/make_a_date/{date:\\d{4}-\\d\\d-\\d\\d}/{want_say:.*}", gw.MakeADate).Methods("GET", "OPTIONS")
 		// 一个post接口
 		helloSvcRoute.HandleFunc("/update_user_info", gw.UpdateUserInfo).Methods("POST", "OPTIONS")
+		helloSvcRoute.HandleFunc("/greetings/{name}", gw.ListGreetings).Methods("GET", "OPTIONS")
 	}
+	{
+		// addsvc和聚合接口的所有路由都需要登录，在子路由器上统一做身份验证，handler中不再调用Prepare
+		routes.AddSvc(r, gw.Gateway, gw.add)
+
+		compositeRoute := r.PathPrefix("/composite").Subrouter()
+		compositeRoute.Use(gw.AuthMiddleware)
+		compositeRoute.HandleFunc("/{name}", gw.Composite).Methods("GET")
 
-	// 直接运行！(先启动hello服务)
+		// 见graphql.go
+		schema, err := gw.newGraphQLSchema()
+		if err != nil {
+			return fmt.Errorf("graphql schema: %v", err)
+		}
+		gw.graphqlSchema = schema
+		graphqlRoute := r.PathPrefix("/graphql").Subrouter()
+		graphqlRoute.Use(gw.AuthMiddleware)
+		graphqlRoute.HandleFunc("", gw.GraphQL).Methods("POST")
+	}
+	return nil
+}
+
+// 管理端口(见gokit_foundation.AdminServer)，POST /quitquitquit发送SIGTERM，与Ctrl+C一样由gw.Run优雅退出
+// 启动失败(如端口被占用)只打印日志，不影响网关，返回的函数用于在网关停止后关闭管理端口
+func serveAdmin(gw *MyGateWay) (stop func()) {
+	adminSrv := gokit_foundation.NewAdminServer(nil)
+	adminSrv.Handle("/metrics", gw.metrics.Handler())
+	if c, ok := gw.add.(*canaryAdd); ok {
+		adminSrv.Handle("/canary", c)
+	}
+	if c, ok := gw.add.(*blueGreenAdd); ok {
+		adminSrv.Handle("/bluegreen", c)
+	}
+	go func() {
+		gw.Log("adminSrv", "listen", "addr", *adminAddr)
+		if err := adminSrv.ListenAndServe(*adminAddr); err != nil {
+			gw.Log("adminSrv", "exited", "err", err)
+		}
+	}()
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		gw.Log("adminSrv.Shutdown", adminSrv.Shutdown(ctx))
+	}
+}
+
+func main() {
+	flag.Parse()
+	/*
+		这里使用 https://github.com/gorilla/mux 作为路由器
+	*/
+	r := mux.NewRouter()
+	gw, err := newMyGW(r)
+	if err == nil {
+		err = setupRoutes(r, gw)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "startup failed:", err)
+		os.Exit(1)
+	}
+	stopAdmin := func() {}
+	if *adminAddr != "" {
+		stopAdmin = serveAdmin(gw)
+	}
+
+	// 直接运行！(先启动consul，以及hello、new_addsvc服务)
 	_ = gw.Run()
+	stopAdmin()
 }
 
 /*
 如何测试：
-	- 按顺序启动hello、gateway项目
+	- 按顺序启动consul、hello、new_addsvc、gateway项目
 	- shell下curl调用网关地址进行测试
 	curl http://127.0.0.1:8000/hello/sayhi/Hanmeimei
 	# %20 在URL中表示空格
 	curl http://127.0.0.1:8000/hello/make_a_date/2020-10-01/Do%20you%20willing%20to%20date%20with%20me?
+	curl http://127.0.0.1:8000/hello/greetings/Hanmeimei?limit=5
 
 	# 模拟一个服务端错误(12-12是暗号，会被服务端特殊处理)：
 	curl http://127.0.0.1:8000/hello/make_a_date/2020-12-12
 
+	# 需要登录的接口，token的生成见main_test.go的genJWToken
+	curl -H "Authorization: Bearer $TOKEN" -d '{"a":1,"b":2}' http://127.0.0.1:8000/addsvc/sum
+	curl -H "Authorization: Bearer $TOKEN" "http://127.0.0.1:8000/composite/Hanmeimei?a=1&b=2"
+	curl -H "Authorization: Bearer $TOKEN" -d '{"query": "{ sum(a: 1, b: 2) hi: sayHi(name: \"Hanmeimei\") { reply } }"}' http://127.0.0.1:8000/graphql
+
 	update_user_info接口测试参看main_test.go
 
 多次且快速的发送/hello/make_a_date/2020-12-12请求，断路器将会打开, 将会看到错误变更:
@@ -82,4 +290,5 @@ func main() {
 {"caller":"demo_project/gateway/hellosvc.go:77","err":"circuit breaker is open","ts":"2020-09-19 12:07:09"}
 {"caller":"demo_project/gateway/hellosvc.go:77","err":"circuit breaker is open","ts":"2020-09-19 12:07:09"}
 {"caller":"demo_project/gateway/hellosvc.go:77","err":"circuit breaker is open","ts":"2020-09-19 12:07:10"}
+继续快速发送请求，超过限速(-ratelimit.rps)后网关直接返回429
 */
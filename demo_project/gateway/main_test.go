@@ -3,9 +3,8 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"github.com/dgrijalva/jwt-go"
 	"go-util/_util"
-	"gopkg.in/jose.v1/crypto"
-	"gopkg.in/jose.v1/jws"
 	"hello/pb/gen-go/pb"
 	"hello/pb/gen-go/pbcommon"
 	"net/http"
@@ -57,14 +56,13 @@ func TestMyGateWay_MakeADate(t *testing.T) {
 
 func genJWToken() string {
 	// a simplest token
-	cls := jws.Claims{
+	cls := jwt.MapClaims{
 		"aud": "example_aud",
 		"sub": "example_sub",
 		"iss": "example_iss",
 	}
-	token := jws.NewJWT(cls, crypto.SigningMethodHS512)
-	b, _ := token.Serialize([]byte("your_secret"))
-	return string(b)
+	s, _ := jwt.NewWithClaims(jwt.SigningMethodHS512, cls).SignedString([]byte("your_secret"))
+	return s
 }
 
 func TestMyGateWay_UpdateUserInfo(t *testing.T) {
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
+	"github.com/go-kit/kit/metrics/prometheus"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+)
+
+// 网关的指标，由管理端口的/metrics提供给prometheus
+type Metrics struct {
+	// 灰度发布时每个版本的调用数和耗时，见canary.go
+	CanaryRequests metrics.Counter
+	CanaryDuration metrics.Histogram
+	// 蓝绿发布时每个组的调用数和耗时，见bluegreen.go
+	BlueGreenRequests metrics.Counter
+	BlueGreenDuration metrics.Histogram
+
+	registry *stdprometheus.Registry
+}
+
+/*
+与new_addsvc一样，prometheus是弱依赖：指标注册失败时只打印警告，对应指标退化为discard
+*/
+func NewMetrics(logger log.Logger) *Metrics {
+	reg := stdprometheus.NewRegistry()
+	register := func(name string, c stdprometheus.Collector) bool {
+		if err := reg.Register(c); err != nil {
+			logger.Log("NewMetrics", "WARNING", "metric", name, "err", err, "hint", "该指标不会被上报")
+			return false
+		}
+		return true
+	}
+
+	register("go", stdprometheus.NewGoCollector())
+	register("process", stdprometheus.NewProcessCollector(stdprometheus.ProcessCollectorOpts{}))
+
+	m := &Metrics{CanaryRequests: discard.NewCounter(), CanaryDuration: discard.NewHistogram(),
+		BlueGreenRequests: discard.NewCounter(), BlueGreenDuration: discard.NewHistogram(), registry: reg}
+	{
+		vec := stdprometheus.NewCounterVec(stdprometheus.CounterOpts{
+			Namespace: "example",
+			Subsystem: "gateway",
+			Name:      "canary_requests_total",
+			Help:      "Number of backend calls by method, variant(stable/canary) and success.",
+		}, []string{"method", "variant", "success"})
+		if register("canary_requests_total", vec) {
+			m.CanaryRequests = prometheus.NewCounter(vec)
+		}
+	}
+	{
+		vec := stdprometheus.NewSummaryVec(stdprometheus.SummaryOpts{
+			Namespace: "example",
+			Subsystem: "gateway",
+			Name:      "canary_request_duration_seconds",
+			Help:      "Backend call duration in seconds by method and variant(stable/canary).",
+		}, []string{"method", "variant"})
+		if register("canary_request_duration_seconds", vec) {
+			m.CanaryDuration = prometheus.NewSummary(vec)
+		}
+	}
+	{
+		vec := stdprometheus.NewCounterVec(stdprometheus.CounterOpts{
+			Namespace: "example",
+			Subsystem: "gateway",
+			Name:      "bluegreen_requests_total",
+			Help:      "Number of backend calls by method, group(blue/green) and success.",
+		}, []string{"method", "group", "success"})
+		if register("bluegreen_requests_total", vec) {
+			m.BlueGreenRequests = prometheus.NewCounter(vec)
+		}
+	}
+	{
+		vec := stdprometheus.NewSummaryVec(stdprometheus.SummaryOpts{
+			Namespace: "example",
+			Subsystem: "gateway",
+			Name:      "bluegreen_request_duration_seconds",
+			Help:      "Backend call duration in seconds by method and group(blue/green).",
+		}, []string{"method", "group"})
+		if register("bluegreen_request_duration_seconds", vec) {
+			m.BlueGreenDuration = prometheus.NewSummary(vec)
+		}
+	}
+	return m
+}
+
+// Handler 返回提供给prometheus调用的/metrics接口
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,85 @@
+package routes
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"gokit_foundation/errs"
+	"gokit_foundation/gateway"
+	"net/http"
+	addservice "new_addsvc/pkg/service"
+)
+
+/*
+new_addsvc的接口，路由在子路由器上统一做了身份验证(见AddSvc)
+client返回的err都是*errs.Error，不需要区分业务错误(RetCode)和调用错误，统一由errs.EncodeHTTPError响应：
+-	业务错误、参数校验失败：http 400，code为对应的RetCode，details为每个字段的错误
+-	服务不可用、超时、断路器打开等：http 503/504，retryable为true
+*/
+
+type SumReq struct {
+	A int `json:"a"`
+	B int `json:"b"`
+}
+
+type SumRsp struct {
+	V int `json:"v"`
+}
+
+type ConcatReq struct {
+	A string `json:"a"`
+	B string `json:"b"`
+}
+
+type ConcatRsp struct {
+	V string `json:"v"`
+}
+
+type addSvc struct {
+	gw  *gateway.Gateway
+	add addservice.Service
+}
+
+// AddSvc 注册/addsvc下的路由，都需要登录，在子路由器上统一做身份验证，handler中不再调用Prepare
+func AddSvc(r *mux.Router, gw *gateway.Gateway, add addservice.Service) {
+	h := &addSvc{gw: gw, add: add}
+	addSvcRoute := r.PathPrefix("/addsvc").Subrouter()
+	addSvcRoute.Use(gw.AuthMiddleware)
+	addSvcRoute.HandleFunc("/sum", h.Sum).Methods("POST")
+	addSvcRoute.HandleFunc("/concat", h.Concat).Methods("POST")
+}
+
+// 调用失败时记录日志并写入错误响应，返回false
+func (h *addSvc) ok(w http.ResponseWriter, r *http.Request, api string, err error) bool {
+	if err == nil {
+		return true
+	}
+	h.gw.Log(append([]interface{}{"api", api}, errs.LogKeyvals(err)...)...)
+	errs.EncodeHTTPError(r.Context(), err, w)
+	return false
+}
+
+func (h *addSvc) Sum(w http.ResponseWriter, r *http.Request) {
+	req := new(SumReq)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		gateway.WriteError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	v, err := h.add.Sum(r.Context(), req.A, req.B)
+	if !h.ok(w, r, "Sum", err) {
+		return
+	}
+	h.gw.JSON(w, &SumRsp{V: v})
+}
+
+func (h *addSvc) Concat(w http.ResponseWriter, r *http.Request) {
+	req := new(ConcatReq)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		gateway.WriteError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	v, err := h.add.Concat(r.Context(), req.A, req.B)
+	if !h.ok(w, r, "Concat", err) {
+		return
+	}
+	h.gw.JSON(w, &ConcatRsp{V: v})
+}
@@ -0,0 +1,17 @@
+package routes
+
+import (
+	"github.com/gorilla/mux"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"gokit_foundation/gateway"
+)
+
+/*
+网关的路由和中间件，main(见setupRoutes)与integration测试共用，保证测试经过的是与部署相同的链路
+只有不依赖main包状态(flag、MyGateWay)的路由放在这里
+*/
+
+// Use 所有路由共用的中间件：访问日志(最外层，被限速的请求也会记录)、server span、按客户端ip限速
+func Use(r *mux.Router, gw *gateway.Gateway, tracer stdopentracing.Tracer, rl *gateway.RateLimiter) {
+	r.Use(gateway.AccessLog(gw.RawLogger()), gateway.Tracing(tracer), rl.Middleware)
+}
@@ -0,0 +1,63 @@
+package client
+
+import (
+	stdendpoint "github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	"gokit_foundation/deadline"
+	"gokit_foundation/sdclient"
+	"google.golang.org/grpc"
+	"hello/config"
+	"hello/pkg/endpoint"
+	grpctransport "hello/pkg/grpc"
+	"hello/pkg/service"
+	"time"
+)
+
+/*
+hello的client SDK，调用方只需要：
+	svc, err := client.New(consulAddr, logger)
+	reply, code := svc.SayHi(ctx, "Jack")
+服务发现、负载均衡、重试、连接池由gokit_foundation/sdclient完成(与new_addsvc/client相同)，
+每个实例连接上的endpoint带有追踪、限流、断路器(见grpctransport.NewSvc)，不需要调用方再拼装endpoint
+*/
+
+// New 从consul获取hello的健康实例，opts可以覆盖默认的负载均衡方式、重试次数、单次调用超时等
+func New(consulAddr string, logger log.Logger, opts ...sdclient.Option) (service.HelloService, error) {
+	defaults := []sdclient.Option{
+		sdclient.WithTags("gokit_svc"),
+		sdclient.WithPassingOnly(true),
+		sdclient.WithRetry(3, time.Second),
+	}
+	sdc, err := sdclient.New(consulAddr, config.SvcName, logger, append(defaults, opts...)...)
+	if err != nil {
+		return nil, err
+	}
+	return newWithSDClient(sdc), nil
+}
+
+// CallBudget client每次调用的超时预算，在创建client之前修改，调用方没有设置deadline时使用Default，包括所有重试
+var CallBudget = deadline.Budget{Default: 2 * time.Second, Min: 5 * time.Millisecond}
+
+// 每个实例的grpc连接由sdclient的连接池管理，四个接口共用，最外层是超时预算
+// 只有ListGreetings是只读的，设置了sdclient.WithHedging时对冲；SayHi、MakeADate会发布领域事件，不对冲
+func newWithSDClient(sdc *sdclient.Client) service.HelloService {
+	withBudget := func(method string) stdendpoint.Middleware {
+		return deadline.Middleware(method, func(string) (deadline.Budget, bool) { return CallBudget, true }, nil)
+	}
+	return endpoint.Endpoints{
+		SayHiEndpoint:          withBudget("SayHi")(sdc.GRPCEndpoint(endpointFor(endpoint.MakeSayHiEndpoint))),
+		MakeADateEndpoint:      withBudget("MakeADate")(sdc.GRPCEndpoint(endpointFor(endpoint.MakeMakeADateEndpoint))),
+		UpdateUserInfoEndpoint: withBudget("UpdateUserInfo")(sdc.GRPCEndpoint(endpointFor(endpoint.MakeUpdateUserInfoEndpoint))),
+		ListGreetingsEndpoint:  withBudget("ListGreetings")(sdc.HedgedGRPCEndpoint(endpointFor(endpoint.MakeListGreetingsEndpoint))),
+	}
+}
+
+type MakeEndpoint func(service.HelloService) stdendpoint.Endpoint
+
+// 连接池为实例的每个连接调用一次，拨号选项(如TLS)来自sdclient.WithDialOptions
+func endpointFor(makeEndpoint MakeEndpoint) func(*grpc.ClientConn) stdendpoint.Endpoint {
+	return func(conn *grpc.ClientConn) stdendpoint.Endpoint {
+		svc, _ := grpctransport.NewSvc(conn) // 不会返回err
+		return makeEndpoint(svc)
+	}
+}
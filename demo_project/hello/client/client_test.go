@@ -0,0 +1,36 @@
+package client
+
+import (
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/sd"
+	"gokit_foundation/sdclient"
+	"google.golang.org/grpc"
+	"hello/pb/gen-go/pb"
+	"hello/pkg/endpoint"
+	grpctransport "hello/pkg/grpc"
+	"hello/pkg/service/servicetest"
+	"net"
+	"testing"
+	"time"
+)
+
+// 不经过consul，通过sdclient的连接池调用本地的grpc server，client满足service的Contract
+// go test ./client/
+func TestContract(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := &servicetest.Fake{}
+	srv := grpc.NewServer()
+	pb.RegisterHelloServer(srv, grpctransport.NewGRPCServer(endpoint.New(fake, nil), nil))
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	sdc := sdclient.NewWithInstancer(sd.FixedInstancer{lis.Addr().String()}, log.NewNopLogger(), sdclient.WithRetry(3, time.Second), sdclient.WithPoolSize(2))
+	defer sdc.Stop()
+	servicetest.Contract(t, newWithSDClient(sdc))
+	if len(fake.Calls()) == 0 {
+		t.Error("no call reached the service")
+	}
+}
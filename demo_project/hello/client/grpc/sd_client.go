@@ -24,6 +24,7 @@ import (
 /*
 	带服务发现功能的client
 	SD: service discovery
+	直接使用go-kit的sd、lb包，便于了解其工作方式；对外提供的client SDK见hello/client(基于sdclient，带连接池、超时预算)
 */
 
 // 带SD功能的client不需要开发者管理底层conn，交由go-kit管理
@@ -36,6 +37,11 @@ func MustNewClientWithSD(logger *gokit_foundation.Logger) service.HelloService {
 	return svcSDClient
 }
 
+// NewClientWithSD 与MustNewClientWithSD相同，但可以指定consul地址(为空时使用:8500)，每次调用都创建新的client
+func NewClientWithSD(consulAddr string, logger *gokit_foundation.Logger) service.HelloService {
+	return newHelloClientWithSD(consulAddr, logger)
+}
+
 // client从consul获取实例地址
 func newHelloClientWithSD(consulAddr string, logger *gokit_foundation.Logger) service.HelloService {
 	_str.SetDefault(&consulAddr, consulAddr, ":8500")
@@ -76,6 +82,7 @@ func newHelloClientWithSD(consulAddr string, logger *gokit_foundation.Logger) se
 	setEndpointWithSD(endpoint.MakeSayHiEndpoint, "SayHi")
 	setEndpointWithSD(endpoint.MakeMakeADateEndpoint, "MakeADate")
 	setEndpointWithSD(endpoint.MakeUpdateUserInfoEndpoint, "UpdateUserInfo")
+	setEndpointWithSD(endpoint.MakeListGreetingsEndpoint, "ListGreetings")
 
 	return endpoints
 }
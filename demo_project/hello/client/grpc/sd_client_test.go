@@ -41,4 +41,17 @@ func TestSDNew(t *testing.T) {
 		t.Errorf("UpdateUserInfo err %s", err)
 	}
 	lgr.Log("UpdateUserInfo-rsp", rsp3)
+
+	// 0x04 ListGreetings
+	rsp4, err := svc.ListGreetings(context.Background(), &pb.ListGreetingsRequest{
+		BaseReq: pbutil.DefBaseReq(),
+		Name:    "Jack Ma",
+		Limit:   10,
+	})
+	if err != nil {
+		t.Errorf("ListGreetings err %s", err)
+	} else if len(rsp4.Greetings) == 0 {
+		t.Error("ListGreetings got no greetings after SayHi")
+	}
+	lgr.Log("ListGreetings-rsp", rsp4)
 }
@@ -19,7 +19,8 @@ func initFirstly(logger *gokit_foundation.Logger, grpcHost string, grpcPort int)
 }
 
 func onClose() {
-	gokit_foundation.ConsulDeregister() // 先下线
+	// 先下线，注销失败会重试几次
+	_ = gokit_foundation.ConsulDeregisterWithRetry(logger, 2, time.Millisecond*200)
 	crontask.Stop()
 	db.Close() // 最后停止db
 }
@@ -1,20 +1,28 @@
 package service
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"go-util/_str"
 	"gokit_foundation"
+	"gokit_foundation/auth"
+	"gokit_foundation/mwchain"
+	"gokit_foundation/propagation"
+	"hello/db"
 	pb "hello/pb/gen-go/pb"
 	endpoint "hello/pkg/endpoint"
 	grpc "hello/pkg/grpc"
+	"hello/pkg/notify"
 	service "hello/pkg/service"
+	"hello/pkg/ws"
 	"net"
 	http1 "net/http"
 	"os"
 	"os/signal"
 	"strings"
 	"syscall"
+	"time"
 
 	endpoint1 "github.com/go-kit/kit/endpoint"
 	log "github.com/go-kit/kit/log"
@@ -23,17 +31,38 @@ import (
 	opentracinggo "github.com/opentracing/opentracing-go"
 	prometheus1 "github.com/prometheus/client_golang/prometheus"
 	promhttp "github.com/prometheus/client_golang/prometheus/promhttp"
-	grpc1 "google.golang.org/grpc"
+	reflection "google.golang.org/grpc/reflection"
 )
 
 var tracer opentracinggo.Tracer
 var logger *gokit_foundation.Logger
 
+// 被recover的panic数，endpoint层和grpc拦截器共用
+var panics = prometheus.NewCounterFrom(prometheus1.CounterOpts{
+	Help:      "Total count of recovered panics by layer and method.",
+	Name:      "panics_total",
+	Namespace: "example",
+	Subsystem: "hello",
+}, []string{"layer", "method"})
+
+// service层发布的事件经bus推送给WebSocket连接(见pkg/ws)
+var bus = notify.NewBus(prometheus.NewCounterFrom(prometheus1.CounterOpts{
+	Help:      "Total count of events dropped because the subscriber was too slow.",
+	Name:      "notify_dropped_events_total",
+	Namespace: "example",
+	Subsystem: "hello",
+}, []string{"type"}))
+
 // Define our flags. Your service probably won't need to bind listeners for
 // all* supported transports, but we do it here for demonstration purposes.
 var fs = flag.NewFlagSet("hello", flag.ExitOnError)
 var debugAddr = fs.String("debug.addr", ":8080", "Debug and metrics listen address")
 var grpcAddr = fs.String("grpc-addr", ":8081", "gRPC listen address")
+var adminAddr = fs.String("admin.addr", ":8085", "Admin listen address(pprof, expvar, runtime stats, log level, shutdown), empty to disable")
+var grpcReflection = fs.Bool("grpc.reflection", false, "Register gRPC reflection service for grpcurl/evans")
+var greetingStore = fs.String("greeting.store", "redis", "Greeting history store, memory or redis")
+var wsAddr = fs.String("ws.addr", ":8086", "WebSocket listen address(subscribe to greeting/date events), empty to disable")
+var wsJWTKeyFile = fs.String("ws.jwt.key.file", "", "File of the HS256 key to verify WebSocket client tokens, empty to disable auth")
 
 func Run() {
 	fs.Parse(os.Args[1:])
@@ -59,18 +88,39 @@ func Run() {
 	initFirstly(logger, grpcHost, _str.MustToInt(grpcPort))
 	defer onClose()
 
-	svc := service.New(getServiceMiddleware(logger), logger)
+	svc := service.New(getServiceMiddleware(logger), logger, newGreetingRepo(*greetingStore))
 	eps := endpoint.New(svc, getEndpointMiddleware(logger))
 	g := createService(eps)
 	initMetricsEndpoint(g)
+	if *adminAddr != "" {
+		initAdminEndpoint(g)
+	}
+	if *wsAddr != "" {
+		initWSEndpoint(g)
+	}
 	initCancelInterrupt(g)
 
 	logger.Log("exit", g.Run())
 }
 
+// 需在db.Init之后调用
+func newGreetingRepo(store string) db.GreetingRepo {
+	switch store {
+	case "memory":
+		return db.NewMemGreetingRepo(db.DefMaxGreetingsPerKey)
+	case "redis":
+		return db.GRedisDao.NewGreetingRepo(db.DefMaxGreetingsPerKey)
+	}
+	panic(fmt.Sprintf("Run: unknown greeting.store %q, want memory or redis", store))
+}
+
 func initGRPCHandler(endpoints endpoint.Endpoints, g *group.Group) {
 	options := defaultGRPCOptions(logger, tracer)
 	// Add your GRPC options here
+	// request id、租户、x-user-id等跨服务传递的上下文，见propagation.Fields
+	for method := range options {
+		options[method] = append(options[method], propagation.GRPCServerBefore())
+	}
 
 	grpcServer := grpc.NewGRPCServer(endpoints, options)
 
@@ -83,9 +133,22 @@ func initGRPCHandler(endpoints endpoint.Endpoints, g *group.Group) {
 		if err != nil {
 			return err
 		}
-		baseServer := grpc1.NewServer()
+		// grpc层的调用数、耗时等指标，与endpoint层的request_duration_seconds一样在/metrics上报
+		grpcMetrics, err := gokit_foundation.NewGRPCServerMetrics(prometheus1.DefaultRegisterer, "example", "hello")
+		if err != nil {
+			logger.Log("transport", "gRPC", "WARNING", "register grpc metrics failed", "err", err)
+		}
+		baseServer := gokit_foundation.NewGRPCServerBuilder(gokit_foundation.DefaultGRPCServerConfig()).
+			Unary(gokit_foundation.StageRecovery, gokit_foundation.RecoveryUnaryInterceptor(logger, panics)).
+			Stream(gokit_foundation.StageRecovery, gokit_foundation.RecoveryStreamInterceptor(logger, panics)).
+			Unary(gokit_foundation.StageMetrics, grpcMetrics.UnaryServerInterceptor()).
+			Stream(gokit_foundation.StageMetrics, grpcMetrics.StreamServerInterceptor()).
+			Build()
 		pb.RegisterHelloServer(baseServer, grpcServer)
 		gokit_foundation.RegisterGRPCHealthSrv(baseServer)
+		if *grpcReflection {
+			reflection.Register(baseServer)
+		}
 		return baseServer.Serve(grpcListener)
 	}, func(error) {
 		if grpcListener != nil {
@@ -97,24 +160,37 @@ func getServiceMiddleware(logger log.Logger) (mw []service.Middleware) {
 	mw = []service.Middleware{}
 	mw = addDefaultServiceMiddleware(logger, mw)
 	// Append your middleware here
+	mw = append(mw, service.EventsMiddleware(bus, "hello", logger))
 
 	return
 }
 func getEndpointMiddleware(logger log.Logger) (mw map[string][]endpoint1.Middleware) {
-	mw = map[string][]endpoint1.Middleware{}
 	duration := prometheus.NewSummaryFrom(prometheus1.SummaryOpts{
 		Help:      "Request duration in seconds.",
 		Name:      "request_duration_seconds",
 		Namespace: "example",
 		Subsystem: "hello",
 	}, []string{"method", "success"})
-	addDefaultEndpointMiddleware(logger, duration, mw)
+	// 代替gk生成的addDefaultEndpointMiddleware，mwchain按层确定顺序：指标在外层，recovery在最内层，panic的调用在日志和指标中记为失败
+	mw, err := mwchain.New().
+		WithMetrics(func(method string) endpoint1.Middleware {
+			return endpoint.InstrumentingMiddleware(duration.With("method", method))
+		}).
+		WithLogging(func(method string) endpoint1.Middleware {
+			return endpoint.LoggingMiddleware(log.With(logger, "method", method))
+		}).
+		WithRecovery(logger, panics).
+		Middlewares("SayHi", "MakeADate", "UpdateUserInfo", "ListGreetings")
+	if err != nil {
+		panic(err)
+	}
 	// Add you endpoint middleware here
 	return
 }
 func initMetricsEndpoint(g *group.Group) {
 	http1.DefaultServeMux.Handle("/metrics", promhttp.Handler())
 
+	metricsSrv := gokit_foundation.NewHTTPServer(http1.DefaultServeMux, gokit_foundation.DefaultHTTPServerConfig())
 	var debugListener net.Listener
 	var err error
 
@@ -124,13 +200,59 @@ func initMetricsEndpoint(g *group.Group) {
 		if err != nil {
 			return err
 		}
-		return http1.Serve(debugListener, http1.DefaultServeMux)
+		return metricsSrv.Serve(debugListener)
 	}, func(error) {
 		if debugListener != nil {
 			debugListener.Close()
 		}
 	})
 }
+
+// 管理端口(见gokit_foundation.AdminServer)，POST /quitquitquit发送SIGTERM，由initCancelInterrupt退出
+func initAdminEndpoint(g *group.Group) {
+	adminSrv := gokit_foundation.NewAdminServer(nil)
+
+	g.Add(func() error {
+		logger.Log("transport", "admin/HTTP", "addr", *adminAddr)
+		return adminSrv.ListenAndServe(*adminAddr)
+	}, func(error) {
+		closeCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		adminSrv.Shutdown(closeCtx)
+	})
+}
+
+// WebSocket推送(见pkg/ws)，退出时先停止接收新连接，再断开已经升级的连接
+func initWSEndpoint(g *group.Group) {
+	var options []ws.HandlerOption
+	if *wsJWTKeyFile != "" {
+		options = append(options, ws.HandlerAuth(auth.JWTMiddleware(auth.Config{Key: auth.FileKey(*wsJWTKeyFile)}, "Subscribe")))
+	} else {
+		logger.Log("transport", "WebSocket", "WARNING", "auth disabled, set -ws.jwt.key.file to enable")
+	}
+	wsHandler := ws.NewHandler(bus, logger, options...)
+	mux := http1.NewServeMux()
+	mux.Handle("/ws", wsHandler)
+	wsSrv := gokit_foundation.NewHTTPServer(mux, gokit_foundation.DefaultHTTPServerConfig())
+	var wsListener net.Listener
+	var err error
+
+	g.Add(func() error {
+		logger.Log("transport", "WebSocket", "addr", *wsAddr)
+		wsListener, err = net.Listen("tcp", *wsAddr)
+		if err != nil {
+			return err
+		}
+		return wsSrv.Serve(wsListener)
+	}, func(error) {
+		if wsListener != nil {
+			closeCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			wsSrv.Shutdown(closeCtx)
+		}
+		wsHandler.Close()
+	})
+}
 func initCancelInterrupt(g *group.Group) {
 	cancelInterrupt := make(chan struct{})
 	g.Add(func() error {
@@ -23,6 +23,7 @@ func defaultGRPCOptions(logger log.Logger, tracer opentracinggo.Tracer) map[stri
 		"MakeADate":      {grpc.ServerErrorLogger(logger), grpc.ServerBefore(opentracing.GRPCToContext(tracer, "MakeADate", logger))},
 		"SayHi":          {grpc.ServerErrorLogger(logger), grpc.ServerBefore(opentracing.GRPCToContext(tracer, "SayHi", logger))},
 		"UpdateUserInfo": {grpc.ServerErrorLogger(logger), grpc.ServerBefore(opentracing.GRPCToContext(tracer, "UpdateUserInfo", logger))},
+		"ListGreetings":  {grpc.ServerErrorLogger(logger), grpc.ServerBefore(opentracing.GRPCToContext(tracer, "ListGreetings", logger))},
 	}
 	return options
 }
@@ -30,12 +31,13 @@ func addDefaultEndpointMiddleware(logger log.Logger, duration *prometheus.Summar
 	mw["SayHi"] = []endpoint1.Middleware{endpoint.LoggingMiddleware(log.With(logger, "method", "SayHi")), endpoint.InstrumentingMiddleware(duration.With("method", "SayHi"))}
 	mw["MakeADate"] = []endpoint1.Middleware{endpoint.LoggingMiddleware(log.With(logger, "method", "MakeADate")), endpoint.InstrumentingMiddleware(duration.With("method", "MakeADate"))}
 	mw["UpdateUserInfo"] = []endpoint1.Middleware{endpoint.LoggingMiddleware(log.With(logger, "method", "UpdateUserInfo")), endpoint.InstrumentingMiddleware(duration.With("method", "UpdateUserInfo"))}
+	mw["ListGreetings"] = []endpoint1.Middleware{endpoint.LoggingMiddleware(log.With(logger, "method", "ListGreetings")), endpoint.InstrumentingMiddleware(duration.With("method", "ListGreetings"))}
 }
 func addDefaultServiceMiddleware(logger log.Logger, mw []service.Middleware) []service.Middleware {
 	return append(mw, service.LoggingMiddleware(logger))
 }
 func addEndpointMiddlewareToAllMethods(mw map[string][]endpoint1.Middleware, m endpoint1.Middleware) {
-	methods := []string{"SayHi", "MakeADate", "UpdateUserInfo"}
+	methods := []string{"SayHi", "MakeADate", "UpdateUserInfo", "ListGreetings"}
 	for _, v := range methods {
 		mw[v] = append(mw[v], m)
 	}
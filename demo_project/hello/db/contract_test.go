@@ -0,0 +1,12 @@
+package db_test
+
+import (
+	"hello/db"
+	"hello/db/dbtest"
+	"testing"
+)
+
+// 放在db_test包中，避免dbtest导入db造成循环引用
+func TestGreetingRepoContract(t *testing.T) {
+	dbtest.GreetingRepoContract(t, db.NewMemGreetingRepo(0))
+}
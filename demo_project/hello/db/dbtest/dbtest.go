@@ -0,0 +1,75 @@
+package dbtest
+
+import (
+	"context"
+	"fmt"
+	"hello/db"
+	"testing"
+	"time"
+)
+
+// GreetingRepoContract db.GreetingRepo的所有实现都必须满足的行为(mem、redis)
+// 使用每次不同的名字，repo中已有的记录不影响结果；name为空时返回所有人的记录，只检查包含新写入的记录
+func GreetingRepoContract(t *testing.T, repo db.GreetingRepo) {
+	t.Helper()
+	ctx := context.Background()
+	prefix := fmt.Sprintf("contract-%d-", time.Now().UnixNano())
+	jack, rose := prefix+"jack", prefix+"rose"
+	now := time.Now().Truncate(time.Second)
+	for i := 0; i < 3; i++ {
+		for _, name := range []string{jack, rose} {
+			g := &db.Greeting{Name: name, Reply: fmt.Sprint(i), CreatedAt: now.Add(time.Duration(i) * time.Second)}
+			if err := repo.Save(ctx, g); err != nil {
+				t.Fatalf("Save got err:%v", err)
+			}
+		}
+	}
+	replies := func(name string, limit int) (ret string) {
+		list, err := repo.List(ctx, name, limit)
+		if err != nil {
+			t.Fatalf("List got err:%v", err)
+		}
+		for _, g := range list {
+			if g.Name != name {
+				t.Errorf("List(%q) got greeting:%+v", name, g)
+			}
+			ret += g.Reply
+		}
+		return
+	}
+
+	// 新的在前
+	for _, tt := range []struct {
+		name  string
+		limit int
+		want  string
+	}{
+		{jack, 0, "210"},
+		{jack, 2, "21"},
+		{rose, 1, "2"},
+		{prefix + "nobody", 0, ""},
+	} {
+		if got := replies(tt.name, tt.limit); got != tt.want {
+			t.Errorf("name:%q limit:%d got:%q want:%q", tt.name, tt.limit, got, tt.want)
+		}
+	}
+
+	list, err := repo.List(ctx, "", 2)
+	if err != nil || len(list) != 2 || list[0].Name != rose || list[1].Name != jack {
+		t.Errorf("List all got:%+v err:%v", list, err)
+	}
+	if len(list) > 0 && !list[0].CreatedAt.Equal(now.Add(2*time.Second)) {
+		t.Errorf("got created_at:%v", list[0].CreatedAt)
+	}
+
+	// Save回填id，按写入顺序递增
+	list, err = repo.List(ctx, jack, 0)
+	if err != nil || len(list) != 3 {
+		t.Fatalf("List got:%+v err:%v", list, err)
+	}
+	for i := 1; i < len(list); i++ {
+		if list[i].ID == "" || list[i].ID >= list[i-1].ID {
+			t.Errorf("got ids %q then %q", list[i-1].ID, list[i].ID)
+		}
+	}
+}
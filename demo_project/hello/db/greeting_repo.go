@@ -0,0 +1,153 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+/*
+SayHi的问候记录存储，service层只依赖GreetingRepo接口：
+-	memGreetingRepo：进程内存储，重启后丢失，用于本地开发和测试
+-	redisGreetingRepo：每个name一个list，另有一个list保存所有人的记录，均只保留最新的maxPerKey条
+*/
+
+type Greeting struct {
+	ID        string    `json:"id"` // Save时生成，按写入顺序递增的定长数字
+	Name      string    `json:"name"`
+	Reply     string    `json:"reply"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type GreetingRepo interface {
+	// 回填g.ID
+	Save(ctx context.Context, g *Greeting) error
+	// 按时间倒序返回最多limit条记录，name为空时返回所有人的记录
+	List(ctx context.Context, name string, limit int) ([]*Greeting, error)
+}
+
+// 定长使得id的字符串顺序与数字顺序一致
+func greetingID(n int64) string {
+	return fmt.Sprintf("%020d", n)
+}
+
+// 每个list最多保留的记录数
+const DefMaxGreetingsPerKey = 100
+
+type memGreetingRepo struct {
+	mu        sync.RWMutex
+	maxPerKey int
+	all       []*Greeting            // 新的在前
+	byName    map[string][]*Greeting // 新的在前
+	seq       int64
+}
+
+// maxPerKey<=0时使用DefMaxGreetingsPerKey
+func NewMemGreetingRepo(maxPerKey int) GreetingRepo {
+	if maxPerKey <= 0 {
+		maxPerKey = DefMaxGreetingsPerKey
+	}
+	return &memGreetingRepo{maxPerKey: maxPerKey, byName: map[string][]*Greeting{}}
+}
+
+func (m *memGreetingRepo) push(list []*Greeting, g *Greeting) []*Greeting {
+	list = append([]*Greeting{g}, list...)
+	if len(list) > m.maxPerKey {
+		list = list[:m.maxPerKey]
+	}
+	return list
+}
+
+func (m *memGreetingRepo) Save(_ context.Context, g *Greeting) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.seq++
+	g.ID = greetingID(m.seq)
+	cp := *g
+	m.all = m.push(m.all, &cp)
+	m.byName[g.Name] = m.push(m.byName[g.Name], &cp)
+	return nil
+}
+
+func (m *memGreetingRepo) List(_ context.Context, name string, limit int) ([]*Greeting, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	list := m.all
+	if name != "" {
+		list = m.byName[name]
+	}
+	if limit > 0 && len(list) > limit {
+		list = list[:limit]
+	}
+	ret := make([]*Greeting, len(list))
+	for i, g := range list {
+		cp := *g
+		ret[i] = &cp
+	}
+	return ret, nil
+}
+
+const (
+	greetingKeyPrefix = "hello:greetings:"
+	greetingAllKey    = "hello:greetings_all"
+	greetingSeqKey    = "hello:greetings_seq"
+)
+
+type redisGreetingRepo struct {
+	rds       *RedisType
+	maxPerKey int
+}
+
+// 使用Init中初始化的redis连接，maxPerKey<=0时使用DefMaxGreetingsPerKey
+func (rds *RedisType) NewGreetingRepo(maxPerKey int) GreetingRepo {
+	if maxPerKey <= 0 {
+		maxPerKey = DefMaxGreetingsPerKey
+	}
+	return &redisGreetingRepo{rds: rds, maxPerKey: maxPerKey}
+}
+
+func (r *redisGreetingRepo) Save(_ context.Context, g *Greeting) error {
+	// 所有实例共用一个序号，id全局递增
+	n, err := r.rds.cli.Incr(greetingSeqKey).Result()
+	if err != nil {
+		return err
+	}
+	g.ID = greetingID(n)
+	b, err := json.Marshal(g)
+	if err != nil {
+		return err
+	}
+	pipe := r.rds.cli.TxPipeline()
+	for _, key := range []string{greetingKeyPrefix + g.Name, greetingAllKey} {
+		pipe.LPush(key, b)
+		pipe.LTrim(key, 0, int64(r.maxPerKey-1))
+	}
+	_, err = pipe.Exec()
+	return err
+}
+
+func (r *redisGreetingRepo) List(_ context.Context, name string, limit int) ([]*Greeting, error) {
+	key := greetingAllKey
+	if name != "" {
+		key = greetingKeyPrefix + name
+	}
+	stop := int64(-1)
+	if limit > 0 {
+		stop = int64(limit - 1)
+	}
+	vals, err := r.rds.cli.LRange(key, 0, stop).Result()
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]*Greeting, 0, len(vals))
+	for _, v := range vals {
+		g := new(Greeting)
+		if err := json.Unmarshal([]byte(v), g); err != nil {
+			return nil, err
+		}
+		ret = append(ret, g)
+	}
+	return ret, nil
+}
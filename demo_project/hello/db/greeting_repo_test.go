@@ -0,0 +1,59 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestMemGreetingRepo(t *testing.T) {
+	ctx := context.Background()
+	r := NewMemGreetingRepo(3)
+	now := time.Now()
+	for i := 0; i < 4; i++ {
+		name := "Jack"
+		if i%2 == 1 {
+			name = "Rose"
+		}
+		g := &Greeting{Name: name, Reply: fmt.Sprint(i), CreatedAt: now.Add(time.Duration(i) * time.Second)}
+		if err := r.Save(ctx, g); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	replies := func(name string, limit int) (ret string) {
+		list, err := r.List(ctx, name, limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, g := range list {
+			ret += g.Reply
+		}
+		return
+	}
+	// 新的在前，超过maxPerKey的旧记录被丢弃
+	test := []struct {
+		name  string
+		limit int
+		want  string
+	}{
+		{"", 0, "321"},
+		{"", 2, "32"},
+		{"Jack", 0, "20"},
+		{"Rose", 1, "3"},
+		{"Nobody", 0, ""},
+	}
+	for _, tt := range test {
+		if got := replies(tt.name, tt.limit); got != tt.want {
+			t.Errorf("name:%q limit:%d got:%q want:%q", tt.name, tt.limit, got, tt.want)
+		}
+	}
+
+	// 返回的是副本
+	list, _ := r.List(ctx, "Jack", 1)
+	list[0].Reply = "changed"
+	if got := replies("Jack", 1); got != "2" {
+		t.Errorf("repo modified by caller, got:%q", got)
+	}
+}
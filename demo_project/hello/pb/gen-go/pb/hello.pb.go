@@ -307,6 +307,205 @@ func (m *UpdateUserInfoResponse) GetBaseRsp() *pbcommon.BaseRsp {
 	return nil
 }
 
+// SayHi的问候记录
+type Greeting struct {
+	Name                 string   `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Reply                string   `protobuf:"bytes,2,opt,name=reply,proto3" json:"reply,omitempty"`
+	CreatedAt            int64    `protobuf:"varint,3,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	Id                   string   `protobuf:"bytes,4,opt,name=id,proto3" json:"id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Greeting) Reset()         { *m = Greeting{} }
+func (m *Greeting) String() string { return proto.CompactTextString(m) }
+func (*Greeting) ProtoMessage()    {}
+func (*Greeting) Descriptor() ([]byte, []int) {
+	return fileDescriptor_61ef911816e0a8ce, []int{6}
+}
+
+func (m *Greeting) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Greeting.Unmarshal(m, b)
+}
+func (m *Greeting) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Greeting.Marshal(b, m, deterministic)
+}
+func (m *Greeting) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Greeting.Merge(m, src)
+}
+func (m *Greeting) XXX_Size() int {
+	return xxx_messageInfo_Greeting.Size(m)
+}
+func (m *Greeting) XXX_DiscardUnknown() {
+	xxx_messageInfo_Greeting.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Greeting proto.InternalMessageInfo
+
+func (m *Greeting) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *Greeting) GetReply() string {
+	if m != nil {
+		return m.Reply
+	}
+	return ""
+}
+
+func (m *Greeting) GetCreatedAt() int64 {
+	if m != nil {
+		return m.CreatedAt
+	}
+	return 0
+}
+
+func (m *Greeting) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+// 分页参数见gokit_foundation/pagination
+type ListGreetingsRequest struct {
+	BaseReq              *pbcommon.BaseReq `protobuf:"bytes,1,opt,name=base_req,json=baseReq,proto3" json:"base_req,omitempty"`
+	Name                 string            `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Limit                uint32            `protobuf:"varint,3,opt,name=limit,proto3" json:"limit,omitempty"`
+	PageSize             int32             `protobuf:"varint,4,opt,name=page_size,json=pageSize,proto3" json:"page_size,omitempty"`
+	PageToken            string            `protobuf:"bytes,5,opt,name=page_token,json=pageToken,proto3" json:"page_token,omitempty"`
+	OrderBy              string            `protobuf:"bytes,6,opt,name=order_by,json=orderBy,proto3" json:"order_by,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}          `json:"-"`
+	XXX_unrecognized     []byte            `json:"-"`
+	XXX_sizecache        int32             `json:"-"`
+}
+
+func (m *ListGreetingsRequest) Reset()         { *m = ListGreetingsRequest{} }
+func (m *ListGreetingsRequest) String() string { return proto.CompactTextString(m) }
+func (*ListGreetingsRequest) ProtoMessage()    {}
+func (*ListGreetingsRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_61ef911816e0a8ce, []int{7}
+}
+
+func (m *ListGreetingsRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListGreetingsRequest.Unmarshal(m, b)
+}
+func (m *ListGreetingsRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListGreetingsRequest.Marshal(b, m, deterministic)
+}
+func (m *ListGreetingsRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListGreetingsRequest.Merge(m, src)
+}
+func (m *ListGreetingsRequest) XXX_Size() int {
+	return xxx_messageInfo_ListGreetingsRequest.Size(m)
+}
+func (m *ListGreetingsRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListGreetingsRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListGreetingsRequest proto.InternalMessageInfo
+
+func (m *ListGreetingsRequest) GetBaseReq() *pbcommon.BaseReq {
+	if m != nil {
+		return m.BaseReq
+	}
+	return nil
+}
+
+func (m *ListGreetingsRequest) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *ListGreetingsRequest) GetLimit() uint32 {
+	if m != nil {
+		return m.Limit
+	}
+	return 0
+}
+
+func (m *ListGreetingsRequest) GetPageSize() int32 {
+	if m != nil {
+		return m.PageSize
+	}
+	return 0
+}
+
+func (m *ListGreetingsRequest) GetPageToken() string {
+	if m != nil {
+		return m.PageToken
+	}
+	return ""
+}
+
+func (m *ListGreetingsRequest) GetOrderBy() string {
+	if m != nil {
+		return m.OrderBy
+	}
+	return ""
+}
+
+type ListGreetingsResponse struct {
+	BaseRsp              *pbcommon.BaseRsp `protobuf:"bytes,1,opt,name=base_rsp,json=baseRsp,proto3" json:"base_rsp,omitempty"`
+	Greetings            []*Greeting       `protobuf:"bytes,2,rep,name=greetings,proto3" json:"greetings,omitempty"`
+	NextPageToken        string            `protobuf:"bytes,3,opt,name=next_page_token,json=nextPageToken,proto3" json:"next_page_token,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}          `json:"-"`
+	XXX_unrecognized     []byte            `json:"-"`
+	XXX_sizecache        int32             `json:"-"`
+}
+
+func (m *ListGreetingsResponse) Reset()         { *m = ListGreetingsResponse{} }
+func (m *ListGreetingsResponse) String() string { return proto.CompactTextString(m) }
+func (*ListGreetingsResponse) ProtoMessage()    {}
+func (*ListGreetingsResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_61ef911816e0a8ce, []int{8}
+}
+
+func (m *ListGreetingsResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListGreetingsResponse.Unmarshal(m, b)
+}
+func (m *ListGreetingsResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListGreetingsResponse.Marshal(b, m, deterministic)
+}
+func (m *ListGreetingsResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListGreetingsResponse.Merge(m, src)
+}
+func (m *ListGreetingsResponse) XXX_Size() int {
+	return xxx_messageInfo_ListGreetingsResponse.Size(m)
+}
+func (m *ListGreetingsResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListGreetingsResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListGreetingsResponse proto.InternalMessageInfo
+
+func (m *ListGreetingsResponse) GetBaseRsp() *pbcommon.BaseRsp {
+	if m != nil {
+		return m.BaseRsp
+	}
+	return nil
+}
+
+func (m *ListGreetingsResponse) GetGreetings() []*Greeting {
+	if m != nil {
+		return m.Greetings
+	}
+	return nil
+}
+
+func (m *ListGreetingsResponse) GetNextPageToken() string {
+	if m != nil {
+		return m.NextPageToken
+	}
+	return ""
+}
+
 func init() {
 	proto.RegisterType((*SayHiRequest)(nil), "pb.SayHiRequest")
 	proto.RegisterType((*SayHiResponse)(nil), "pb.SayHiResponse")
@@ -314,6 +513,9 @@ func init() {
 	proto.RegisterType((*MakeADateResponse)(nil), "pb.MakeADateResponse")
 	proto.RegisterType((*UpdateUserInfoRequest)(nil), "pb.UpdateUserInfoRequest")
 	proto.RegisterType((*UpdateUserInfoResponse)(nil), "pb.UpdateUserInfoResponse")
+	proto.RegisterType((*Greeting)(nil), "pb.Greeting")
+	proto.RegisterType((*ListGreetingsRequest)(nil), "pb.ListGreetingsRequest")
+	proto.RegisterType((*ListGreetingsResponse)(nil), "pb.ListGreetingsResponse")
 }
 
 func init() {
@@ -321,33 +523,44 @@ func init() {
 }
 
 var fileDescriptor_61ef911816e0a8ce = []byte{
-	// 405 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x9c, 0x53, 0x41, 0xaf, 0xd2, 0x40,
-	0x10, 0x4e, 0x9f, 0xf2, 0x0a, 0x83, 0xef, 0xe5, 0xb1, 0x79, 0x15, 0xe8, 0x89, 0xf4, 0x60, 0x38,
-	0x60, 0x49, 0xf0, 0x62, 0xe2, 0x49, 0x34, 0x0a, 0x07, 0x3c, 0x94, 0x10, 0x13, 0x2f, 0xcd, 0x2e,
-	0x1d, 0x91, 0x58, 0x76, 0x97, 0xdd, 0x45, 0xd2, 0x7f, 0xe6, 0xcf, 0x33, 0xbb, 0x2d, 0x88, 0xd8,
-	0xc4, 0xc4, 0x53, 0x67, 0xe6, 0x9b, 0x9d, 0x6f, 0xbe, 0x99, 0x29, 0xb4, 0xbf, 0x61, 0x9e, 0x8b,
-	0x58, 0x2a, 0x61, 0x04, 0xb9, 0x91, 0x2c, 0x0c, 0x24, 0x5b, 0x8b, 0xdd, 0x4e, 0xf0, 0x71, 0xf9,
-	0x29, 0xa1, 0xb0, 0x7f, 0x0e, 0x2b, 0xd4, 0x87, 0xdc, 0xac, 0x45, 0x86, 0x25, 0x14, 0x45, 0xf0,
-	0x6c, 0x49, 0x8b, 0xd9, 0x36, 0xc1, 0xfd, 0x01, 0xb5, 0x21, 0x04, 0x9e, 0x72, 0xba, 0xc3, 0x9e,
-	0x37, 0xf0, 0x86, 0xad, 0xc4, 0xd9, 0xd1, 0x02, 0xee, 0xaa, 0x1c, 0x2d, 0x05, 0xd7, 0x48, 0x1e,
-	0xa1, 0xa1, 0x50, 0xe6, 0x45, 0x95, 0x55, 0x3a, 0xe4, 0x05, 0x34, 0x51, 0xa9, 0xd4, 0x16, 0xef,
-	0xdd, 0x0c, 0xbc, 0xe1, 0xfd, 0xa4, 0x1d, 0x9f, 0x88, 0xe3, 0x24, 0xf1, 0x51, 0xa9, 0x77, 0x22,
-	0xc3, 0xe8, 0x07, 0x3c, 0x2c, 0xe8, 0x77, 0x7c, 0xfb, 0x9e, 0x1a, 0x3c, 0xd1, 0x8e, 0xa0, 0xc9,
-	0xa8, 0xc6, 0x54, 0xe1, 0xde, 0x15, 0x6d, 0x4f, 0x3a, 0xbf, 0xdf, 0x4e, 0xa9, 0xb6, 0x89, 0x89,
-	0xcf, 0x4a, 0x83, 0xf4, 0xa1, 0x99, 0x51, 0x83, 0xa9, 0x36, 0xca, 0x31, 0xb5, 0x12, 0xdf, 0xfa,
-	0x4b, 0xa3, 0x2c, 0x74, 0xa4, 0xdc, 0xa4, 0x9a, 0x16, 0xbd, 0x27, 0x25, 0x64, 0xfd, 0x25, 0x2d,
-	0xa2, 0xcf, 0xd0, 0xb9, 0xe0, 0xad, 0xa4, 0x9c, 0x89, 0xb5, 0x74, 0xa5, 0xfe, 0x26, 0xd6, 0xb2,
-	0x22, 0xd6, 0xb2, 0x5e, 0x78, 0x54, 0x40, 0xb0, 0x92, 0xb6, 0x81, 0x95, 0x46, 0x35, 0xe7, 0x5f,
-	0xc5, 0xff, 0xa9, 0xea, 0x82, 0x7f, 0xd0, 0xa8, 0xd2, 0x6d, 0xe6, 0x3a, 0xb9, 0x4b, 0x6e, 0xad,
-	0x3b, 0xcf, 0xac, 0x26, 0x8e, 0xc7, 0xd4, 0xed, 0xa5, 0xd2, 0xc4, 0xf1, 0xf8, 0xc9, 0xae, 0xe6,
-	0x03, 0x3c, 0xbf, 0xa6, 0xae, 0x11, 0xe6, 0xfd, 0x4b, 0xd8, 0xe4, 0xa7, 0x07, 0x8d, 0x99, 0x3d,
-	0x26, 0x32, 0x82, 0x86, 0x5b, 0x36, 0x79, 0x88, 0x25, 0x8b, 0x2f, 0x6f, 0x23, 0xec, 0x5c, 0x44,
-	0x2a, 0x96, 0xd7, 0xd0, 0x3a, 0xcf, 0x94, 0x3c, 0x5a, 0xfc, 0x7a, 0xb5, 0x61, 0x70, 0x15, 0xad,
-	0x5e, 0x7e, 0x84, 0xfb, 0x3f, 0x3b, 0x27, 0x7d, 0x9b, 0x58, 0x3b, 0xc8, 0x30, 0xac, 0x83, 0xca,
-	0x42, 0xd3, 0xee, 0x97, 0xc0, 0xfd, 0x06, 0x63, 0xc9, 0xc6, 0x1b, 0xe4, 0x2f, 0x37, 0xd6, 0x7a,
-	0x23, 0x19, 0xbb, 0x75, 0x17, 0xfe, 0xea, 0x57, 0x00, 0x00, 0x00, 0xff, 0xff, 0x94, 0x84, 0xc3,
-	0x9c, 0x26, 0x03, 0x00, 0x00,
+	// 588 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x9c, 0x54, 0x5d, 0x6b, 0xdb, 0x30,
+	0x14, 0xc5, 0x6e, 0xd3, 0xc4, 0x37, 0x4d, 0xd7, 0x88, 0x64, 0x75, 0x3c, 0x06, 0xc1, 0x0f, 0x25,
+	0x8c, 0x2e, 0x81, 0xec, 0x65, 0xb0, 0xa7, 0x66, 0x65, 0x6d, 0x61, 0x1d, 0xc3, 0x59, 0x19, 0xec,
+	0xc5, 0xc8, 0xf1, 0x5d, 0x66, 0x9a, 0xd8, 0xaa, 0xa4, 0x2c, 0x73, 0xff, 0xc9, 0x7e, 0xd0, 0xfe,
+	0xd6, 0x18, 0x92, 0xed, 0x7c, 0x61, 0x18, 0xe4, 0xc9, 0xbe, 0xf7, 0x5c, 0xdd, 0x73, 0x8e, 0xa4,
+	0x2b, 0xa8, 0xff, 0xc0, 0xd9, 0x2c, 0xe9, 0x33, 0x9e, 0xc8, 0x84, 0x98, 0x2c, 0x70, 0xda, 0x2c,
+	0x98, 0x24, 0xf3, 0x79, 0x12, 0x0f, 0xb2, 0x4f, 0x06, 0x39, 0x9d, 0x55, 0x9a, 0xa3, 0x58, 0xcc,
+	0xe4, 0x24, 0x09, 0x31, 0x83, 0x5c, 0x17, 0x8e, 0xc7, 0x34, 0xbd, 0x89, 0x3c, 0x7c, 0x5c, 0xa0,
+	0x90, 0x84, 0xc0, 0x61, 0x4c, 0xe7, 0x68, 0x1b, 0x5d, 0xa3, 0x67, 0x79, 0xfa, 0xdf, 0xbd, 0x83,
+	0x46, 0x5e, 0x23, 0x58, 0x12, 0x0b, 0x24, 0x2d, 0xa8, 0x70, 0x64, 0xb3, 0x34, 0xaf, 0xca, 0x02,
+	0x72, 0x0e, 0x35, 0xe4, 0xdc, 0x57, 0xcd, 0x6d, 0xb3, 0x6b, 0xf4, 0x4e, 0x86, 0xf5, 0x7e, 0x41,
+	0xdc, 0xf7, 0xbc, 0x2a, 0x72, 0xfe, 0x3e, 0x09, 0xd1, 0xfd, 0x09, 0xa7, 0x77, 0xf4, 0x01, 0x2f,
+	0xaf, 0xa8, 0xc4, 0x82, 0xf6, 0x02, 0x6a, 0x01, 0x15, 0xe8, 0x73, 0x7c, 0xd4, 0x4d, 0xeb, 0xc3,
+	0xe6, 0x7a, 0xed, 0x88, 0x0a, 0x55, 0xe8, 0x55, 0x83, 0xec, 0x87, 0x74, 0xa0, 0x16, 0x52, 0x89,
+	0xbe, 0x90, 0x5c, 0x33, 0x59, 0x5e, 0x55, 0xc5, 0x63, 0xc9, 0x15, 0xb4, 0xa4, 0xb1, 0xf4, 0x05,
+	0x4d, 0xed, 0x83, 0x0c, 0x52, 0xf1, 0x98, 0xa6, 0xee, 0x57, 0x68, 0x6e, 0xf0, 0xe6, 0x56, 0x56,
+	0xc4, 0x82, 0xd9, 0x66, 0x29, 0xb1, 0x60, 0x39, 0xb1, 0x60, 0xe5, 0xc6, 0xdd, 0x14, 0xda, 0xf7,
+	0x4c, 0x09, 0xb8, 0x17, 0xc8, 0x6f, 0xe3, 0xef, 0xc9, 0x7e, 0xae, 0xce, 0xa0, 0xba, 0x10, 0xc8,
+	0xfd, 0x28, 0xd4, 0x4a, 0x1a, 0xde, 0x91, 0x0a, 0x6f, 0x43, 0xe5, 0x29, 0xc6, 0xa5, 0xaf, 0xcf,
+	0x25, 0xf7, 0x14, 0xe3, 0xf2, 0x93, 0x3a, 0x9a, 0x0f, 0xf0, 0x7c, 0x97, 0xba, 0xc4, 0x98, 0xf1,
+	0x3f, 0x63, 0xee, 0x04, 0x6a, 0xd7, 0x1c, 0x51, 0x46, 0xf1, 0xb4, 0xec, 0x0a, 0xac, 0x8d, 0x9b,
+	0x9b, 0x27, 0xfe, 0x12, 0x60, 0xc2, 0x91, 0x4a, 0x0c, 0x7d, 0x2a, 0xb5, 0xb4, 0x03, 0xcf, 0xca,
+	0x33, 0x97, 0x92, 0x9c, 0x80, 0x19, 0x85, 0xf6, 0xa1, 0x5e, 0x61, 0x46, 0xa1, 0xfb, 0xc7, 0x80,
+	0xd6, 0xc7, 0x48, 0xc8, 0x82, 0x49, 0xec, 0xb7, 0x4f, 0x85, 0x3e, 0x73, 0x5b, 0xdf, 0x2c, 0x9a,
+	0x47, 0x99, 0x88, 0x86, 0x97, 0x05, 0xe4, 0x05, 0x58, 0x8c, 0x4e, 0xd1, 0x17, 0xd1, 0x13, 0x6a,
+	0x1d, 0x15, 0xaf, 0xa6, 0x12, 0xe3, 0xe8, 0x09, 0x95, 0x78, 0x0d, 0xca, 0xe4, 0x01, 0x63, 0xbb,
+	0xa2, 0x9b, 0xe9, 0xf2, 0x2f, 0x2a, 0xa1, 0x36, 0x3d, 0xe1, 0x21, 0x72, 0x3f, 0x48, 0xed, 0xa3,
+	0x6c, 0xd3, 0x75, 0x3c, 0x4a, 0xdd, 0xdf, 0x06, 0xb4, 0x77, 0x7c, 0xec, 0xb3, 0xe9, 0xe4, 0x15,
+	0x58, 0xd3, 0xa2, 0x85, 0x6d, 0x76, 0x0f, 0x7a, 0xf5, 0xe1, 0x71, 0x9f, 0x05, 0xfd, 0xa2, 0xaf,
+	0xb7, 0x86, 0xc9, 0x39, 0x3c, 0x8b, 0xf1, 0x97, 0xf4, 0x37, 0x24, 0x67, 0x57, 0xa1, 0xa1, 0xd2,
+	0x9f, 0x0b, 0xd9, 0xc3, 0xbf, 0x06, 0x54, 0x6e, 0xd4, 0xab, 0x40, 0x2e, 0xa0, 0xa2, 0xa7, 0x96,
+	0x9c, 0xaa, 0x9e, 0x9b, 0x43, 0xee, 0x34, 0x37, 0x32, 0xb9, 0xf2, 0xb7, 0x60, 0xad, 0x86, 0x83,
+	0xb4, 0x14, 0xbe, 0x3b, 0xa3, 0x4e, 0x7b, 0x27, 0x9b, 0xaf, 0xbc, 0x86, 0x93, 0xed, 0x2b, 0x48,
+	0x3a, 0xaa, 0xb0, 0x74, 0x22, 0x1c, 0xa7, 0x0c, 0xca, 0x1b, 0x5d, 0x41, 0x63, 0x6b, 0x57, 0x89,
+	0xad, 0x8a, 0xcb, 0x2e, 0x8c, 0xd3, 0x29, 0x41, 0xb2, 0x2e, 0xa3, 0xb3, 0x6f, 0x6d, 0xfd, 0x2a,
+	0x0e, 0x58, 0x30, 0x98, 0x62, 0xfc, 0x7a, 0xaa, 0xfe, 0xde, 0xb1, 0x20, 0x38, 0xd2, 0x0f, 0xde,
+	0x9b, 0x7f, 0x03, 0x00, 0x64, 0x54, 0x13, 0x15, 0x35, 0x05, 0x00, 0x00,
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -365,6 +578,7 @@ type HelloClient interface {
 	SayHi(ctx context.Context, in *SayHiRequest, opts ...grpc.CallOption) (*SayHiResponse, error)
 	MakeADate(ctx context.Context, in *MakeADateRequest, opts ...grpc.CallOption) (*MakeADateResponse, error)
 	UpdateUserInfo(ctx context.Context, in *UpdateUserInfoRequest, opts ...grpc.CallOption) (*UpdateUserInfoResponse, error)
+	ListGreetings(ctx context.Context, in *ListGreetingsRequest, opts ...grpc.CallOption) (*ListGreetingsResponse, error)
 }
 
 type helloClient struct {
@@ -402,11 +616,21 @@ func (c *helloClient) UpdateUserInfo(ctx context.Context, in *UpdateUserInfoRequ
 	return out, nil
 }
 
+func (c *helloClient) ListGreetings(ctx context.Context, in *ListGreetingsRequest, opts ...grpc.CallOption) (*ListGreetingsResponse, error) {
+	out := new(ListGreetingsResponse)
+	err := c.cc.Invoke(ctx, "/pb.Hello/ListGreetings", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // HelloServer is the server API for Hello service.
 type HelloServer interface {
 	SayHi(context.Context, *SayHiRequest) (*SayHiResponse, error)
 	MakeADate(context.Context, *MakeADateRequest) (*MakeADateResponse, error)
 	UpdateUserInfo(context.Context, *UpdateUserInfoRequest) (*UpdateUserInfoResponse, error)
+	ListGreetings(context.Context, *ListGreetingsRequest) (*ListGreetingsResponse, error)
 }
 
 // UnimplementedHelloServer can be embedded to have forward compatible implementations.
@@ -422,6 +646,9 @@ func (*UnimplementedHelloServer) MakeADate(ctx context.Context, req *MakeADateRe
 func (*UnimplementedHelloServer) UpdateUserInfo(ctx context.Context, req *UpdateUserInfoRequest) (*UpdateUserInfoResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method UpdateUserInfo not implemented")
 }
+func (*UnimplementedHelloServer) ListGreetings(ctx context.Context, req *ListGreetingsRequest) (*ListGreetingsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListGreetings not implemented")
+}
 
 func RegisterHelloServer(s *grpc.Server, srv HelloServer) {
 	s.RegisterService(&_Hello_serviceDesc, srv)
@@ -481,6 +708,24 @@ func _Hello_UpdateUserInfo_Handler(srv interface{}, ctx context.Context, dec fun
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Hello_ListGreetings_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListGreetingsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HelloServer).ListGreetings(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.Hello/ListGreetings",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HelloServer).ListGreetings(ctx, req.(*ListGreetingsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _Hello_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "pb.Hello",
 	HandlerType: (*HelloServer)(nil),
@@ -497,6 +742,10 @@ var _Hello_serviceDesc = grpc.ServiceDesc{
 			MethodName: "UpdateUserInfo",
 			Handler:    _Hello_UpdateUserInfo_Handler,
 		},
+		{
+			MethodName: "ListGreetings",
+			Handler:    _Hello_ListGreetings_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "hello.proto",
@@ -3,6 +3,7 @@ package endpoint
 import (
 	"context"
 	endpoint "github.com/go-kit/kit/endpoint"
+	"gokit_foundation/endpointx"
 	"hello/pb/gen-go/pb"
 	"hello/pb/gen-go/pbcommon"
 	service "hello/pkg/service"
@@ -18,24 +19,23 @@ type SayHiResponse struct {
 }
 
 func MakeSayHiEndpoint(s service.HelloService) endpoint.Endpoint {
-	return func(ctx context.Context, request interface{}) (interface{}, error) {
-		req := request.(*SayHiRequest)
+	return endpointx.New(func(ctx context.Context, req *SayHiRequest) (*SayHiResponse, error) {
 		reply, err := s.SayHi(ctx, req.Name)
 		return &SayHiResponse{
 			ErrCode: err,
 			Reply:   reply,
 		}, nil
-	}
+	})
 }
 
 func (e Endpoints) SayHi(ctx context.Context, name string) (reply string, errCode pbcommon.R) {
 	request := &SayHiRequest{Name: name}
-	response, err := e.SayHiEndpoint(ctx, request)
+	response, err := endpointx.Typed[*SayHiRequest, *SayHiResponse](e.SayHiEndpoint)(ctx, request)
 	// 这个err不是svc返回的，而是封装了多个mw的endpoint返回的，属于意料之外的err，此时response可能是nil
 	if err != nil {
 		return "", pbcommon.R_RPC_ERR
 	}
-	return response.(*SayHiResponse).Reply, response.(*SayHiResponse).ErrCode
+	return response.Reply, response.ErrCode
 }
 
 // MakeADateRequest collects the request parameters for the MakeADate method.
@@ -51,23 +51,22 @@ type MakeADateResponse struct {
 
 // MakeMakeADateEndpoint returns an endpoint that invokes MakeADate on the service.
 func MakeMakeADateEndpoint(s service.HelloService) endpoint.Endpoint {
-	return func(c0 context.Context, request interface{}) (interface{}, error) {
-		req := request.(*MakeADateRequest)
+	return endpointx.New(func(c0 context.Context, req *MakeADateRequest) (*MakeADateResponse, error) {
 		p0, err := s.MakeADate(c0, req.P1)
 		return &MakeADateResponse{P0: p0, Err: err}, err
-	}
+	})
 }
 
 // MakeADate implements Service. Primarily useful in a client.
 func (e Endpoints) MakeADate(c0 context.Context, p1 *pb.MakeADateRequest) (p0 *pb.MakeADateResponse, err error) {
 	request := &MakeADateRequest{P1: p1}
-	response, err := e.MakeADateEndpoint(c0, request)
+	response, err := endpointx.Typed[*MakeADateRequest, *MakeADateResponse](e.MakeADateEndpoint)(c0, request)
 	if err != nil {
 		// 注意：endpoint层返回的err会被client端使用的限流、断路器等设施捕获
 		// 所以这个err只有在系统级（如db故障，依赖服务异常）异常时返回，业务err应该放在reply中
 		return nil, err
 	}
-	return response.(*MakeADateResponse).P0, err
+	return response.P0, err
 }
 
 // Failed implements Failer.
@@ -95,14 +94,13 @@ type UpdateUserInfoResponse struct {
 
 // MakeUpdateUserInfoEndpoint returns an endpoint that invokes UpdateUserInfo on the service.
 func MakeUpdateUserInfoEndpoint(s service.HelloService) endpoint.Endpoint {
-	return func(c0 context.Context, request interface{}) (interface{}, error) {
-		req := request.(*UpdateUserInfoRequest)
+	return endpointx.New(func(c0 context.Context, req *UpdateUserInfoRequest) (*UpdateUserInfoResponse, error) {
 		p0, e1 := s.UpdateUserInfo(c0, req.P1)
 		return &UpdateUserInfoResponse{
 			E1: e1,
 			P0: p0,
 		}, nil
-	}
+	})
 }
 
 // Failed implements Failer.
@@ -113,9 +111,44 @@ func (r UpdateUserInfoResponse) Failed() error {
 // UpdateUserInfo implements Service. Primarily useful in a client.
 func (e Endpoints) UpdateUserInfo(c0 context.Context, p1 *pb.UpdateUserInfoRequest) (p0 *pb.UpdateUserInfoResponse, e1 error) {
 	request := &UpdateUserInfoRequest{P1: p1}
-	response, err := e.UpdateUserInfoEndpoint(c0, request)
+	response, err := endpointx.Typed[*UpdateUserInfoRequest, *UpdateUserInfoResponse](e.UpdateUserInfoEndpoint)(c0, request)
+	if err != nil {
+		return nil, err
+	}
+	return response.P0, response.E1
+}
+
+// ListGreetingsRequest collects the request parameters for the ListGreetings method.
+type ListGreetingsRequest struct {
+	P1 *pb.ListGreetingsRequest `json:"p1"`
+}
+
+// ListGreetingsResponse collects the response parameters for the ListGreetings method.
+type ListGreetingsResponse struct {
+	P0 *pb.ListGreetingsResponse `json:"p0"`
+	E1 error                     `json:"e1"`
+}
+
+// MakeListGreetingsEndpoint returns an endpoint that invokes ListGreetings on the service.
+func MakeListGreetingsEndpoint(s service.HelloService) endpoint.Endpoint {
+	return endpointx.New(func(c0 context.Context, req *ListGreetingsRequest) (*ListGreetingsResponse, error) {
+		p0, e1 := s.ListGreetings(c0, req.P1)
+		// 存储故障时返回err，让client侧的断路器能感知到
+		return &ListGreetingsResponse{P0: p0, E1: e1}, e1
+	})
+}
+
+// Failed implements Failer.
+func (r ListGreetingsResponse) Failed() error {
+	return r.E1
+}
+
+// ListGreetings implements Service. Primarily useful in a client.
+func (e Endpoints) ListGreetings(c0 context.Context, p1 *pb.ListGreetingsRequest) (p0 *pb.ListGreetingsResponse, e1 error) {
+	request := &ListGreetingsRequest{P1: p1}
+	response, err := endpointx.Typed[*ListGreetingsRequest, *ListGreetingsResponse](e.ListGreetingsEndpoint)(c0, request)
 	if err != nil {
 		return nil, err
 	}
-	return response.(*UpdateUserInfoResponse).P0, response.(*UpdateUserInfoResponse).E1
+	return response.P0, response.E1
 }
@@ -13,6 +13,7 @@ type Endpoints struct {
 	SayHiEndpoint          endpoint.Endpoint
 	MakeADateEndpoint      endpoint.Endpoint
 	UpdateUserInfoEndpoint endpoint.Endpoint
+	ListGreetingsEndpoint  endpoint.Endpoint
 }
 
 // New returns a Endpoints struct that wraps the provided service, and wires in all of the
@@ -22,6 +23,7 @@ func New(s service.HelloService, mdw map[string][]endpoint.Middleware) Endpoints
 		MakeADateEndpoint:      MakeMakeADateEndpoint(s),
 		SayHiEndpoint:          MakeSayHiEndpoint(s),
 		UpdateUserInfoEndpoint: MakeUpdateUserInfoEndpoint(s),
+		ListGreetingsEndpoint:  MakeListGreetingsEndpoint(s),
 	}
 	for _, m := range mdw["SayHi"] {
 		eps.SayHiEndpoint = m(eps.SayHiEndpoint)
@@ -32,5 +34,8 @@ func New(s service.HelloService, mdw map[string][]endpoint.Middleware) Endpoints
 	for _, m := range mdw["UpdateUserInfo"] {
 		eps.UpdateUserInfoEndpoint = m(eps.UpdateUserInfoEndpoint)
 	}
+	for _, m := range mdw["ListGreetings"] {
+		eps.ListGreetingsEndpoint = m(eps.ListGreetingsEndpoint)
+	}
 	return eps
 }
@@ -10,6 +10,7 @@ import (
 	grpc1 "github.com/go-kit/kit/transport/grpc"
 	stdopentracing "github.com/opentracing/opentracing-go"
 	"github.com/sony/gobreaker"
+	"gokit_foundation/propagation"
 	"golang.org/x/time/rate"
 	grpc "google.golang.org/grpc"
 	"hello/pb/gen-go/pb"
@@ -40,7 +41,7 @@ func NewSvc(conn *grpc.ClientConn) (service.HelloService, error) {
 	//      - grpctransport.ClientAfter(),
 	//      - grpctransport.ClientFinalizer()
 	// Injecting tracing ctx to grpc metadata, optionally.
-	grpcBefore := grpc1.ClientBefore(opentracing.ContextToGRPC(otTracer, log.NewNopLogger()))
+	grpcBefore := grpc1.ClientBefore(opentracing.ContextToGRPC(otTracer, log.NewNopLogger()), propagation.ContextToGRPC())
 	/*
 		Install into endpoints with above measures
 	*/
@@ -71,10 +72,20 @@ func NewSvc(conn *grpc.ClientConn) (service.HelloService, error) {
 		UpdateUserInfoEndpoint = breaker("UpdateUserInfo")(UpdateUserInfoEndpoint)
 	}
 
+	var ListGreetingsEndpoint endpoint.Endpoint
+	{
+		ListGreetingsEndpoint = grpc1.NewClient(conn, "pb.Hello", "ListGreetings",
+			encodeListGreetingsRequest, decodeListGreetingsResponse, pb.ListGreetingsResponse{}, grpcBefore).Endpoint()
+		ListGreetingsEndpoint = opentracing.TraceClient(otTracer, "ListGreetings")(ListGreetingsEndpoint)
+		ListGreetingsEndpoint = limiter(ListGreetingsEndpoint)
+		ListGreetingsEndpoint = breaker("ListGreetings")(ListGreetingsEndpoint)
+	}
+
 	return endpoint1.Endpoints{
 		SayHiEndpoint:          SayHiEndpoint,
 		MakeADateEndpoint:      MakeADateEndpoint,
 		UpdateUserInfoEndpoint: UpdateUserInfoEndpoint,
+		ListGreetingsEndpoint:  ListGreetingsEndpoint,
 	}, nil
 }
 
@@ -89,7 +100,7 @@ func encodeSayHiRequest(_ context.Context, request interface{}) (interface{}, er
 // a gRPC concat reply to a user-domain concat response.
 func decodeSayHiResponse(_ context.Context, reply interface{}) (interface{}, error) {
 	r := reply.(*pb.SayHiResponse)
-	return &endpoint1.SayHiResponse{Reply: r.Reply}, nil
+	return &endpoint1.SayHiResponse{Reply: r.Reply, ErrCode: r.ErrCode}, nil
 }
 
 // encodeMakeADateRequest is a transport/grpc.EncodeRequestFunc that converts a
@@ -119,3 +130,17 @@ func decodeUpdateUserInfoResponse(_ context.Context, reply interface{}) (interfa
 	rsp := reply.(*pb.UpdateUserInfoResponse)
 	return &endpoint1.UpdateUserInfoResponse{P0: rsp}, nil
 }
+
+// encodeListGreetingsRequest is a transport/grpc.EncodeRequestFunc that converts a
+//  user-domain ListGreetings request to a gRPC request.
+func encodeListGreetingsRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(*endpoint1.ListGreetingsRequest)
+	return req.P1, nil
+}
+
+// decodeListGreetingsResponse is a transport/grpc.DecodeResponseFunc that converts
+// a gRPC concat reply to a user-domain concat response.
+func decodeListGreetingsResponse(_ context.Context, reply interface{}) (interface{}, error) {
+	rsp := reply.(*pb.ListGreetingsResponse)
+	return &endpoint1.ListGreetingsResponse{P0: rsp}, nil
+}
@@ -11,6 +11,7 @@ import (
 	grpctransport "github.com/go-kit/kit/transport/grpc"
 	stdopentracing "github.com/opentracing/opentracing-go"
 	"github.com/sony/gobreaker"
+	"gokit_foundation/propagation"
 	"google.golang.org/grpc"
 	pb "hello/pb/gen-go/pb"
 	endpoint2 "hello/pkg/endpoint"
@@ -50,17 +51,20 @@ func MakeClientEndpoints(instance string, otTracer stdopentracing.Tracer, logger
 // implementing the client library pattern.
 // newGRPCClient 返回一个用grpc conn为底层连接的HelloService对象
 func newGRPCClient(conn *grpc.ClientConn, otTracer stdopentracing.Tracer, logger log.Logger) *endpoint2.Endpoints {
-	var options []grpctransport.ClientOption
+	// ctx中的request id、租户、token等传给server，见propagation.Fields
+	options := []grpctransport.ClientOption{propagation.GRPCClientBefore()}
 
 	// 每个endpoint安装统一的mw，也可以在wrappedEndpoint修改逻辑，根据method而设置不同的mw
 	SayHiEndpoint := wrappedEndpoint(conn, otTracer, logger, options, "SayHi")
 	MakeADateEndpoint := wrappedEndpoint(conn, otTracer, logger, options, "MakeADate")
 	UpdateUserInfoEndpoint := wrappedEndpoint(conn, otTracer, logger, options, "UpdateUserInfo")
+	ListGreetingsEndpoint := wrappedEndpoint(conn, otTracer, logger, options, "ListGreetings")
 
 	return &endpoint2.Endpoints{
 		SayHiEndpoint:          SayHiEndpoint,
 		MakeADateEndpoint:      MakeADateEndpoint,
 		UpdateUserInfoEndpoint: UpdateUserInfoEndpoint,
+		ListGreetingsEndpoint:  ListGreetingsEndpoint,
 	}
 }
 
@@ -99,6 +103,10 @@ func getEncDecFuncByMethod(method string) (grpctransport.EncodeRequestFunc, grpc
 		enc = encodeGRPCUpdateUserInfoRequest
 		dec = decodeGRPCUpdateUserInfoResponse
 		grpcResp = pb.UpdateUserInfoResponse{}
+	case "ListGreetings":
+		enc = encodeGRPCListGreetingsRequest
+		dec = decodeGRPCListGreetingsResponse
+		grpcResp = pb.ListGreetingsResponse{}
 	}
 	return enc, dec, grpcResp
 }
@@ -110,7 +118,7 @@ func encodeGRPCSayHiRequest(_ context.Context, request interface{}) (interface{}
 
 func decodeGRPCSayHiResponse(_ context.Context, grpcReply interface{}) (interface{}, error) {
 	reply := grpcReply.(*pb.SayHiResponse)
-	return &endpoint2.SayHiResponse{Reply: reply.Reply}, nil
+	return &endpoint2.SayHiResponse{Reply: reply.Reply, ErrCode: reply.ErrCode}, nil
 }
 
 func encodeGRPCMakeADateRequest(_ context.Context, request interface{}) (interface{}, error) {
@@ -132,3 +140,13 @@ func decodeGRPCUpdateUserInfoResponse(_ context.Context, grpcReply interface{})
 	reply := grpcReply.(*pb.UpdateUserInfoResponse)
 	return &endpoint2.UpdateUserInfoResponse{P0: reply}, nil
 }
+
+func encodeGRPCListGreetingsRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(*endpoint2.ListGreetingsRequest)
+	return req.P1, nil
+}
+
+func decodeGRPCListGreetingsResponse(_ context.Context, grpcReply interface{}) (interface{}, error) {
+	reply := grpcReply.(*pb.ListGreetingsResponse)
+	return &endpoint2.ListGreetingsResponse{P0: reply}, nil
+}
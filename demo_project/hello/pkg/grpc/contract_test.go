@@ -0,0 +1,44 @@
+package grpc
+
+import (
+	"context"
+	"github.com/go-kit/kit/log"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+	"hello/pb/gen-go/pb"
+	"hello/pkg/endpoint"
+	"hello/pkg/service/servicetest"
+	"net"
+	"testing"
+)
+
+// grpc client满足service的Contract，server端为servicetest.Fake
+func TestContract(t *testing.T) {
+	fake := &servicetest.Fake{}
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer()
+	pb.RegisterHelloServer(srv, NewGRPCServer(endpoint.New(fake, nil), nil))
+	go srv.Serve(lis)
+	defer srv.Stop()
+	cc, err := grpc.Dial("bufconn", grpc.WithInsecure(), grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+		return lis.Dial()
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cc.Close()
+	cli, err := NewSvc(cc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	servicetest.Contract(t, cli)
+	if len(fake.Calls()) == 0 {
+		t.Error("no call reached the service")
+	}
+
+	// 两个client：NewSvc以及服务发现使用的newGRPCClient
+	t.Run("sd", func(t *testing.T) {
+		servicetest.Contract(t, newGRPCClient(cc, stdopentracing.NoopTracer{}, log.NewNopLogger()))
+	})
+}
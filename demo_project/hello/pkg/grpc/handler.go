@@ -21,7 +21,8 @@ func decodeSayHiRequest(_ context.Context, r interface{}) (interface{}, error) {
 func encodeSayHiResponse(_ context.Context, r interface{}) (interface{}, error) {
 	rsp := r.(*endpoint.SayHiResponse)
 	return &pb.SayHiResponse{
-		Reply: rsp.Reply,
+		Reply:   rsp.Reply,
+		ErrCode: rsp.ErrCode,
 	}, nil
 }
 
@@ -74,3 +75,24 @@ func (g *grpcServer) UpdateUserInfo(ctx context1.Context, req *pb.UpdateUserInfo
 	}
 	return rep.(*pb.UpdateUserInfoResponse), nil
 }
+
+func makeListGreetingsHandler(endpoints endpoint.Endpoints, options []grpc.ServerOption) grpc.Handler {
+	return grpc.NewServer(endpoints.ListGreetingsEndpoint, decodeListGreetingsRequest, encodeListGreetingsResponse, options...)
+}
+
+func decodeListGreetingsRequest(_ context.Context, req interface{}) (interface{}, error) {
+	r := req.(*pb.ListGreetingsRequest)
+	return &endpoint.ListGreetingsRequest{P1: r}, nil
+}
+
+func encodeListGreetingsResponse(_ context.Context, rsp interface{}) (interface{}, error) {
+	r := rsp.(*endpoint.ListGreetingsResponse)
+	return r.P0, nil
+}
+func (g *grpcServer) ListGreetings(ctx context1.Context, req *pb.ListGreetingsRequest) (*pb.ListGreetingsResponse, error) {
+	_, rep, err := g.listGreetings.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return rep.(*pb.ListGreetingsResponse), nil
+}
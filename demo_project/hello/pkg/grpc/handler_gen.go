@@ -12,6 +12,7 @@ type grpcServer struct {
 	sayHi          grpc.Handler
 	makeADate      grpc.Handler
 	updateUserInfo grpc.Handler
+	listGreetings  grpc.Handler
 }
 
 func NewGRPCServer(endpoints endpoint.Endpoints, options map[string][]grpc.ServerOption) pb.HelloServer {
@@ -19,5 +20,6 @@ func NewGRPCServer(endpoints endpoint.Endpoints, options map[string][]grpc.Serve
 		makeADate:      makeMakeADateHandler(endpoints, options["MakeADate"]),
 		sayHi:          makeSayHiHandler(endpoints, options["SayHi"]),
 		updateUserInfo: makeUpdateUserInfoHandler(endpoints, options["UpdateUserInfo"]),
+		listGreetings:  makeListGreetingsHandler(endpoints, options["ListGreetings"]),
 	}
 }
@@ -0,0 +1,113 @@
+package notify
+
+import (
+	"context"
+	"gokit_foundation/events"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
+)
+
+/*
+进程内的事件总线，service层发布的事件(如greeting)扇出给所有订阅了该类型的订阅者(如WebSocket连接，见pkg/ws)
+-	Bus实现了events.Publisher，service层的中间件只依赖这个接口，也可以换成写入kafka的events.AsyncPublisher
+-	Publish不阻塞：订阅者的缓冲区满时丢弃发给它的事件(计入dropped指标)，慢连接不会拖慢接口
+-	事件只在当前实例内投递，多实例部署时每个client只能收到它所连接的实例上产生的事件
+*/
+
+type Bus struct {
+	mu      sync.RWMutex
+	subs    map[*Subscription]struct{}
+	dropped metrics.Counter
+}
+
+// NewBus dropped为nil时不统计丢弃的事件数
+func NewBus(dropped metrics.Counter) *Bus {
+	if dropped == nil {
+		dropped = discard.NewCounter()
+	}
+	return &Bus{subs: map[*Subscription]struct{}{}, dropped: dropped}
+}
+
+func (b *Bus) Publish(_ context.Context, e events.Event) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for s := range b.subs {
+		if !s.wants(e.Type) {
+			continue
+		}
+		select {
+		case s.c <- e:
+		default:
+			b.dropped.With("type", e.Type).Add(1)
+		}
+	}
+	return nil
+}
+
+// Subscribe 创建一个订阅，buffer为缓冲的事件数，创建后还需要通过Add指定事件类型
+func (b *Bus) Subscribe(buffer int) *Subscription {
+	s := &Subscription{bus: b, c: make(chan events.Event, buffer), types: map[string]bool{}}
+	b.mu.Lock()
+	b.subs[s] = struct{}{}
+	b.mu.Unlock()
+	return s
+}
+
+// 当前的订阅数
+func (b *Bus) Len() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.subs)
+}
+
+type Subscription struct {
+	bus   *Bus
+	c     chan events.Event
+	mu    sync.Mutex
+	types map[string]bool
+	once  sync.Once
+}
+
+// C 订阅的事件，Close后被关闭
+func (s *Subscription) C() <-chan events.Event {
+	return s.c
+}
+
+func (s *Subscription) Add(types ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range types {
+		s.types[t] = true
+	}
+}
+
+func (s *Subscription) Remove(types ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range types {
+		delete(s.types, t)
+	}
+}
+
+func (s *Subscription) wants(typ string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.types[typ]
+}
+
+// Close 取消订阅并关闭C，可以重复调用
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		// 持有写锁，Close时没有正在进行的Publish，关闭c后不会再有发送
+		s.bus.mu.Lock()
+		delete(s.bus.subs, s)
+		s.bus.mu.Unlock()
+		close(s.c)
+	})
+}
@@ -0,0 +1,43 @@
+package notify
+
+import (
+	"context"
+	"gokit_foundation/events"
+	"testing"
+)
+
+func TestBus(t *testing.T) {
+	b := NewBus(nil)
+	greeting := b.Subscribe(1)
+	greeting.Add("greeting")
+	all := b.Subscribe(10)
+	all.Add("greeting", "date")
+
+	for _, typ := range []string{"greeting", "date", "greeting", "other"} {
+		b.Publish(context.Background(), events.Event{Type: typ})
+	}
+	// 缓冲区满时丢弃，不阻塞其他订阅者
+	if n := len(greeting.C()); n != 1 {
+		t.Errorf("got greeting events:%d", n)
+	}
+	if n := len(all.C()); n != 3 {
+		t.Errorf("got all events:%d", n)
+	}
+	if e := <-all.C(); e.Type != "greeting" || e.Time.IsZero() {
+		t.Errorf("got event:%+v", e)
+	}
+
+	all.Remove("greeting")
+	greeting.Close()
+	greeting.Close()
+	b.Publish(context.Background(), events.Event{Type: "greeting"})
+	if _, ok := <-greeting.C(); !ok {
+		t.Error("buffered event lost after Close")
+	}
+	if _, ok := <-greeting.C(); ok {
+		t.Error("got event after Close")
+	}
+	if n := len(all.C()); n != 2 || b.Len() != 1 {
+		t.Errorf("got all events:%d subscriptions:%d", n, b.Len())
+	}
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"gokit_foundation/events"
+	"hello/pb/gen-go/pb"
+	"hello/pb/gen-go/pbcommon"
+
+	log "github.com/go-kit/kit/log"
+)
+
+// 事件类型，WebSocket client按类型订阅(见pkg/ws)
+const (
+	EventGreeting = "greeting"
+	EventDate     = "date"
+)
+
+type GreetingEvent struct {
+	Name  string `json:"name"`
+	Reply string `json:"reply"`
+}
+
+type DateEvent struct {
+	DateStr string `json:"date_str"`
+	WantSay string `json:"want_say"`
+	Reply   string `json:"reply"`
+}
+
+// 事件mw：调用成功后发布事件(如发往进程内的notify.Bus)，发布失败只打印日志，不影响接口返回
+func EventsMiddleware(pub events.Publisher, source string, logger log.Logger) Middleware {
+	return func(next HelloService) HelloService {
+		return eventsMiddleware{pub: pub, source: source, logger: logger, next: next}
+	}
+}
+
+type eventsMiddleware struct {
+	pub    events.Publisher
+	source string
+	logger log.Logger
+	next   HelloService
+}
+
+func (mw eventsMiddleware) publish(ctx context.Context, typ string, payload interface{}) {
+	if err := mw.pub.Publish(ctx, events.Event{Type: typ, Source: mw.source, Payload: payload}); err != nil {
+		mw.logger.Log("eventsMiddleware", "publish failed", "type", typ, "err", err)
+	}
+}
+
+func (mw eventsMiddleware) SayHi(ctx context.Context, name string) (string, pbcommon.R) {
+	rsp, errCode := mw.next.SayHi(ctx, name)
+	if errCode == pbcommon.R_OK {
+		mw.publish(ctx, EventGreeting, GreetingEvent{Name: name, Reply: rsp})
+	}
+	return rsp, errCode
+}
+
+func (mw eventsMiddleware) MakeADate(ctx context.Context, req *pb.MakeADateRequest) (*pb.MakeADateResponse, error) {
+	rsp, err := mw.next.MakeADate(ctx, req)
+	if err == nil && rsp.GetBaseRsp().GetErrCode() == pbcommon.R_OK {
+		mw.publish(ctx, EventDate, DateEvent{DateStr: req.DateStr, WantSay: req.WantSay, Reply: rsp.Reply})
+	}
+	return rsp, err
+}
+
+func (mw eventsMiddleware) UpdateUserInfo(ctx context.Context, req *pb.UpdateUserInfoRequest) (*pb.UpdateUserInfoResponse, error) {
+	return mw.next.UpdateUserInfo(ctx, req)
+}
+
+func (mw eventsMiddleware) ListGreetings(ctx context.Context, req *pb.ListGreetingsRequest) (*pb.ListGreetingsResponse, error) {
+	return mw.next.ListGreetings(ctx, req)
+}
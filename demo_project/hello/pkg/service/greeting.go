@@ -0,0 +1,40 @@
+package service
+
+import (
+	"bytes"
+	"text/template"
+	"time"
+)
+
+// SayHi的问候模板，按时段选择，未匹配到时段时使用defGreetingTpl
+var (
+	defGreetingTpl = template.Must(template.New("default").Parse("Hi,{{.Name}}"))
+	greetingTpls   = []struct {
+		from, to int // 小时区间[from, to)
+		tpl      *template.Template
+	}{
+		{5, 12, template.Must(template.New("morning").Parse("Good morning,{{.Name}}"))},
+		{12, 18, template.Must(template.New("afternoon").Parse("Good afternoon,{{.Name}}"))},
+		{18, 23, template.Must(template.New("evening").Parse("Good evening,{{.Name}}"))},
+	}
+)
+
+type greetingData struct {
+	Name string
+	Time time.Time
+}
+
+func renderGreeting(name string, now time.Time) (string, error) {
+	tpl := defGreetingTpl
+	for _, t := range greetingTpls {
+		if h := now.Hour(); h >= t.from && h < t.to {
+			tpl = t.tpl
+			break
+		}
+	}
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, greetingData{Name: name, Time: now}); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -44,3 +44,10 @@ func (l loggingMiddleware) UpdateUserInfo(c0 context.Context, p1 *pb.UpdateUserI
 	}()
 	return l.next.UpdateUserInfo(c0, p1)
 }
+
+func (l loggingMiddleware) ListGreetings(c0 context.Context, p1 *pb.ListGreetingsRequest) (p0 *pb.ListGreetingsResponse, e1 error) {
+	defer func() {
+		l.logger.Log("method", "ListGreetings", "p1", p1, "count", len(p0.GetGreetings()), "e1", e1)
+	}()
+	return l.next.ListGreetings(c0, p1)
+}
@@ -3,9 +3,13 @@ package service
 import (
 	"context"
 	"fmt"
+	"gokit_foundation/clock"
+	"gokit_foundation/pagination"
+	"hello/db"
 	"hello/pb/gen-go/pb"
 	"hello/pb/gen-go/pbcommon"
 	"hello/pb/pbutil"
+	"sort"
 	"time"
 
 	"github.com/go-kit/kit/log"
@@ -20,20 +24,45 @@ type HelloService interface {
 	MakeADate(context.Context, *pb.MakeADateRequest) (*pb.MakeADateResponse, error)
 
 	UpdateUserInfo(context.Context, *pb.UpdateUserInfoRequest) (*pb.UpdateUserInfoResponse, error)
+
+	// 查询SayHi的问候记录
+	ListGreetings(context.Context, *pb.ListGreetingsRequest) (*pb.ListGreetingsResponse, error)
+}
+
+// ListGreetings的分页约定(见gokit_foundation/pagination)，默认新的在前
+var listGreetingsSpec = pagination.Spec{
+	DefaultSize: 20,
+	MaxSize:     100,
+	Sorts:       []string{"created_at", "name"},
+	DefaultSort: pagination.Sort{Field: "created_at", Desc: true},
 }
 
 type basicHelloService struct {
 	logger log.Logger
+	repo   db.GreetingRepo
+	clock  clock.Clock
+}
+
+type Option func(*basicHelloService)
+
+// 选择问候语的时段以及问候记录的时间，默认clock.Real
+func WithClock(c clock.Clock) Option {
+	return func(b *basicHelloService) { b.clock = c }
 }
 
-// NewBasicHelloService returns a naive, stateless implementation of HelloService.
-func NewBasicHelloService(logger log.Logger) HelloService {
-	return &basicHelloService{logger}
+// NewBasicHelloService returns a basic implementation of HelloService,
+// greetings are saved to repo.
+func NewBasicHelloService(logger log.Logger, repo db.GreetingRepo, options ...Option) HelloService {
+	b := &basicHelloService{logger: logger, repo: repo, clock: clock.Real}
+	for _, opt := range options {
+		opt(b)
+	}
+	return b
 }
 
 // New returns a HelloService with all of the expected middleware wired in.
-func New(middleware []Middleware, logger log.Logger) HelloService {
-	var svc HelloService = NewBasicHelloService(logger)
+func New(middleware []Middleware, logger log.Logger, repo db.GreetingRepo, options ...Option) HelloService {
+	var svc HelloService = NewBasicHelloService(logger, repo, options...)
 	for _, m := range middleware {
 		svc = m(svc)
 	}
@@ -41,10 +70,20 @@ func New(middleware []Middleware, logger log.Logger) HelloService {
 }
 
 func (b *basicHelloService) SayHi(ctx context.Context, name string) (Response string, err pbcommon.R) {
-	if name == "XI" {
+	if name == "" || name == "XI" {
 		return "", pbcommon.R_INVALID_ARGS
 	}
-	return "Hi," + name, err
+	now := b.clock.Now()
+	Response, e := renderGreeting(name, now)
+	if e != nil {
+		b.logger.Log("SayHi - renderGreeting err", e)
+		return "", pbcommon.R_SYS_ERR
+	}
+	// 记录保存失败不影响问候
+	if e = b.repo.Save(ctx, &db.Greeting{Name: name, Reply: Response, CreatedAt: now}); e != nil {
+		b.logger.Log("SayHi - save greeting err", e)
+	}
+	return Response, err
 }
 
 // c0,p1是kit默认的变量命名规则，暂时认为没必要改
@@ -84,3 +123,67 @@ func (b *basicHelloService) UpdateUserInfo(c0 context.Context, p1 *pb.UpdateUser
 	// 不做任何事（请注意一定返回一个非nil的rsp，除非panic）
 	return p0, e1
 }
+
+// 每个name最多保存db.DefMaxGreetingsPerKey条记录，全部取出后在内存中按 (排序值, id) 排序分页
+func (b *basicHelloService) ListGreetings(c0 context.Context, p1 *pb.ListGreetingsRequest) (p0 *pb.ListGreetingsResponse, err error) {
+	p0 = &pb.ListGreetingsResponse{
+		BaseRsp: pbutil.DefBaseRsp(),
+	}
+	size := int(p1.PageSize)
+	if size == 0 {
+		// 兼容旧版本client的limit
+		size = int(p1.Limit)
+	}
+	filter := ""
+	if p1.Name != "" {
+		filter = "name=" + p1.Name
+	}
+	page, e := listGreetingsSpec.Parse(pagination.Params{PageSize: size, PageToken: p1.PageToken, OrderBy: p1.OrderBy}, filter)
+	if e != nil {
+		p0.BaseRsp.ErrCode = pbcommon.R_INVALID_ARGS
+		return p0, nil
+	}
+
+	list, err := b.repo.List(c0, p1.Name, 0)
+	if err != nil {
+		// 存储故障属于系统级错误，返回err
+		p0.BaseRsp.ErrCode = pbcommon.R_SYS_ERR
+		return p0, err
+	}
+	field := page.Sort.Field
+	less := func(a, b pagination.Cursor) bool {
+		if page.Sort.Desc {
+			a, b = b, a
+		}
+		return a.Key < b.Key || (a.Key == b.Key && a.ID < b.ID)
+	}
+	sort.Slice(list, func(i, j int) bool { return less(greetingCursor(field, list[i]), greetingCursor(field, list[j])) })
+	if page.After != nil {
+		i := sort.Search(len(list), func(i int) bool { return less(*page.After, greetingCursor(field, list[i])) })
+		list = list[i:]
+	}
+	if len(list) > page.Size+1 {
+		list = list[:page.Size+1]
+	}
+	list, p0.NextPageToken = pagination.Page(page, list, func(g *db.Greeting) pagination.Cursor { return greetingCursor(field, g) })
+	for _, g := range list {
+		p0.Greetings = append(p0.Greetings, &pb.Greeting{
+			Name:      g.Name,
+			Reply:     g.Reply,
+			CreatedAt: g.CreatedAt.Unix(),
+			Id:        g.ID,
+		})
+	}
+	return p0, nil
+}
+
+// 定长的时间格式，字符串顺序与时间顺序一致
+const cursorTimeLayout = "2006-01-02T15:04:05.000000000Z"
+
+func greetingCursor(field string, g *db.Greeting) pagination.Cursor {
+	key := g.Name
+	if field == "created_at" {
+		key = g.CreatedAt.UTC().Format(cursorTimeLayout)
+	}
+	return pagination.Cursor{Key: key, ID: g.ID}
+}
@@ -0,0 +1,173 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"gokit_foundation/clock"
+	"gokit_foundation/events"
+	"hello/db"
+	"hello/pb/gen-go/pb"
+	"hello/pb/gen-go/pbcommon"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+func newTestService(repo db.GreetingRepo, hour int) *basicHelloService {
+	now := clock.NewFake(time.Date(2020, 10, 1, hour, 0, 0, 0, time.Local))
+	return NewBasicHelloService(log.NewNopLogger(), repo, WithClock(now)).(*basicHelloService)
+}
+
+func TestSayHi(t *testing.T) {
+	test := []struct {
+		name  string
+		hour  int
+		want  string
+		wantR pbcommon.R
+	}{
+		{"Jack", 8, "Good morning,Jack", pbcommon.R_OK},
+		{"Jack", 14, "Good afternoon,Jack", pbcommon.R_OK},
+		{"Jack", 20, "Good evening,Jack", pbcommon.R_OK},
+		{"Jack", 2, "Hi,Jack", pbcommon.R_OK},
+		{"", 8, "", pbcommon.R_INVALID_ARGS},
+		{"XI", 8, "", pbcommon.R_INVALID_ARGS},
+	}
+	for _, tt := range test {
+		svc := newTestService(db.NewMemGreetingRepo(0), tt.hour)
+		got, r := svc.SayHi(context.Background(), tt.name)
+		if got != tt.want || r != tt.wantR {
+			t.Errorf("name:%q hour:%d got:%q %v want:%q %v", tt.name, tt.hour, got, r, tt.want, tt.wantR)
+		}
+	}
+}
+
+func TestListGreetings(t *testing.T) {
+	ctx := context.Background()
+	svc := newTestService(db.NewMemGreetingRepo(0), 8)
+	for _, name := range []string{"Jack", "Rose", "Jack", "XI"} {
+		svc.SayHi(ctx, name)
+	}
+
+	rsp, err := svc.ListGreetings(ctx, &pb.ListGreetingsRequest{Name: "Jack"})
+	if err != nil || len(rsp.Greetings) != 2 {
+		t.Fatalf("got rsp:%v err:%v", rsp, err)
+	}
+	g := rsp.Greetings[0]
+	if g.Name != "Jack" || g.Reply != "Good morning,Jack" || g.CreatedAt != svc.clock.Now().Unix() {
+		t.Errorf("got greeting:%v", g)
+	}
+	// 请求失败的SayHi不记录
+	rsp, _ = svc.ListGreetings(ctx, &pb.ListGreetingsRequest{Limit: 10})
+	if len(rsp.Greetings) != 3 {
+		t.Errorf("got %d greetings, want 3", len(rsp.Greetings))
+	}
+	rsp, _ = svc.ListGreetings(ctx, &pb.ListGreetingsRequest{Limit: 1})
+	if len(rsp.Greetings) != 1 || rsp.Greetings[0].Name != "Jack" {
+		t.Errorf("limit got:%v", rsp.Greetings)
+	}
+
+	// 存储故障时返回err，同时设置ErrCode
+	svc.repo = errRepo{}
+	rsp, err = svc.ListGreetings(ctx, &pb.ListGreetingsRequest{})
+	if err == nil || rsp.BaseRsp.ErrCode != pbcommon.R_SYS_ERR {
+		t.Errorf("got rsp:%v err:%v", rsp, err)
+	}
+	// 保存失败不影响SayHi
+	if _, r := svc.SayHi(ctx, "Jack"); r != pbcommon.R_OK {
+		t.Errorf("SayHi got %v with broken repo", r)
+	}
+}
+
+type errRepo struct{}
+
+func (errRepo) Save(context.Context, *db.Greeting) error { return errors.New("broken") }
+
+func (errRepo) List(context.Context, string, int) ([]*db.Greeting, error) {
+	return nil, errors.New("broken")
+}
+
+type memPublisher struct{ events []events.Event }
+
+func (p *memPublisher) Publish(_ context.Context, e events.Event) error {
+	p.events = append(p.events, e)
+	return nil
+}
+
+func TestEventsMiddleware(t *testing.T) {
+	ctx := context.Background()
+	pub := &memPublisher{}
+	svc := EventsMiddleware(pub, "hello", log.NewNopLogger())(newTestService(db.NewMemGreetingRepo(0), 8))
+	svc.SayHi(ctx, "Jack")
+	svc.SayHi(ctx, "")
+	svc.MakeADate(ctx, &pb.MakeADateRequest{DateStr: "2020-10-01", WantSay: "hi"})
+	svc.MakeADate(ctx, &pb.MakeADateRequest{DateStr: "bad"})
+	// 只发布成功的调用
+	if len(pub.events) != 2 {
+		t.Fatalf("got events:%+v", pub.events)
+	}
+	if e := pub.events[0]; e.Type != EventGreeting || e.Source != "hello" || e.Payload != (GreetingEvent{Name: "Jack", Reply: "Good morning,Jack"}) {
+		t.Errorf("got event:%+v", e)
+	}
+	if e := pub.events[1]; e.Type != EventDate || e.Payload.(DateEvent).Reply != "OK~, I will arrive on 10.1" {
+		t.Errorf("got event:%+v", e)
+	}
+}
+
+// 时间相同(fake clock)时按id排序，与写入顺序一致
+func TestListGreetingsPages(t *testing.T) {
+	ctx := context.Background()
+	svc := newTestService(db.NewMemGreetingRepo(0), 8)
+	for _, name := range []string{"Jack", "Rose", "Jack", "Tom", "Jack"} {
+		svc.SayHi(ctx, name)
+	}
+	list := func(req *pb.ListGreetingsRequest) (got string, next string) {
+		rsp, err := svc.ListGreetings(ctx, req)
+		if err != nil || rsp.BaseRsp.ErrCode != pbcommon.R_OK {
+			t.Fatalf("req:%v got rsp:%v err:%v", req, rsp, err)
+		}
+		for _, g := range rsp.Greetings {
+			got += g.Name + strings.TrimLeft(g.Id, "0") + " "
+		}
+		return got, rsp.NextPageToken
+	}
+	for _, tt := range []struct {
+		orderBy, name string
+		want          string
+	}{
+		{"", "", "Jack5 Tom4 Jack3 Rose2 Jack1 "},
+		{"created_at", "", "Jack1 Rose2 Jack3 Tom4 Jack5 "},
+		{"name", "", "Jack1 Jack3 Jack5 Rose2 Tom4 "},
+		{"name desc", "", "Tom4 Rose2 Jack5 Jack3 Jack1 "},
+		{"", "Jack", "Jack5 Jack3 Jack1 "},
+	} {
+		var all string
+		req := &pb.ListGreetingsRequest{PageSize: 2, OrderBy: tt.orderBy, Name: tt.name}
+		for {
+			got, next := list(req)
+			all += got
+			if next == "" {
+				break
+			}
+			req.PageToken = next
+		}
+		if all != tt.want {
+			t.Errorf("order_by:%q name:%q got:%q want:%q", tt.orderBy, tt.name, all, tt.want)
+		}
+	}
+
+	// limit在page_size为0时生效
+	if got, next := list(&pb.ListGreetingsRequest{Limit: 1, PageSize: 0}); got != "Jack5 " || next == "" {
+		t.Errorf("limit got:%q next:%q", got, next)
+	}
+	for _, req := range []*pb.ListGreetingsRequest{
+		{PageSize: -1},
+		{OrderBy: "reply"},
+		{PageToken: "bad"},
+	} {
+		if rsp, err := svc.ListGreetings(ctx, req); err != nil || rsp.BaseRsp.ErrCode != pbcommon.R_INVALID_ARGS {
+			t.Errorf("req:%v got rsp:%v err:%v", req, rsp, err)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package servicetest
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"gokit_foundation/pagination"
+	"gokit_foundation/pagination/pagetest"
+	"hello/db"
+	"hello/pb/gen-go/pb"
+	"hello/pb/gen-go/pbcommon"
+	"hello/pkg/service"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+/*
+service.HelloService的测试工具(手写，不依赖mockgen)：
+-	Fake：可替换每个方法的实现并记录调用，用于测试middleware、transport，不需要mysql、redis
+-	Contract：所有实现都必须满足的行为，service层的middleware、endpoint以及grpc client都应该通过
+*/
+
+// Fake XxxFunc为nil时使用service.NewBasicHelloService的实现(问候记录保存在内存中，满足Contract)
+type Fake struct {
+	SayHiFunc          func(ctx context.Context, name string) (string, pbcommon.R)
+	MakeADateFunc      func(ctx context.Context, req *pb.MakeADateRequest) (*pb.MakeADateResponse, error)
+	UpdateUserInfoFunc func(ctx context.Context, req *pb.UpdateUserInfoRequest) (*pb.UpdateUserInfoResponse, error)
+	ListGreetingsFunc  func(ctx context.Context, req *pb.ListGreetingsRequest) (*pb.ListGreetingsResponse, error)
+
+	once  sync.Once
+	basic service.HelloService
+	mu    sync.Mutex
+	calls []string
+}
+
+func (f *Fake) def() service.HelloService {
+	f.once.Do(func() {
+		f.basic = service.NewBasicHelloService(log.NewNopLogger(), db.NewMemGreetingRepo(0))
+	})
+	return f.basic
+}
+
+func (f *Fake) record(method string) {
+	f.mu.Lock()
+	f.calls = append(f.calls, method)
+	f.mu.Unlock()
+}
+
+func (f *Fake) SayHi(ctx context.Context, name string) (string, pbcommon.R) {
+	f.record("SayHi")
+	if f.SayHiFunc != nil {
+		return f.SayHiFunc(ctx, name)
+	}
+	return f.def().SayHi(ctx, name)
+}
+
+func (f *Fake) MakeADate(ctx context.Context, req *pb.MakeADateRequest) (*pb.MakeADateResponse, error) {
+	f.record("MakeADate")
+	if f.MakeADateFunc != nil {
+		return f.MakeADateFunc(ctx, req)
+	}
+	return f.def().MakeADate(ctx, req)
+}
+
+func (f *Fake) UpdateUserInfo(ctx context.Context, req *pb.UpdateUserInfoRequest) (*pb.UpdateUserInfoResponse, error) {
+	f.record("UpdateUserInfo")
+	if f.UpdateUserInfoFunc != nil {
+		return f.UpdateUserInfoFunc(ctx, req)
+	}
+	return f.def().UpdateUserInfo(ctx, req)
+}
+
+func (f *Fake) ListGreetings(ctx context.Context, req *pb.ListGreetingsRequest) (*pb.ListGreetingsResponse, error) {
+	f.record("ListGreetings")
+	if f.ListGreetingsFunc != nil {
+		return f.ListGreetingsFunc(ctx, req)
+	}
+	return f.def().ListGreetings(ctx, req)
+}
+
+// Calls 按调用顺序返回调用的方法名
+func (f *Fake) Calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.calls...)
+}
+
+// Contract 查询问候记录时使用每次不同的名字，svc中已有的记录不影响结果
+func Contract(t *testing.T, svc service.HelloService) {
+	t.Helper()
+	ctx := context.Background()
+
+	t.Run("SayHi", func(t *testing.T) {
+		// 问候语随时段变化，只检查以名字结尾
+		if reply, r := svc.SayHi(ctx, "Jack"); r != pbcommon.R_OK || !strings.HasSuffix(reply, ",Jack") {
+			t.Errorf("SayHi got reply:%q r:%v", reply, r)
+		}
+		for _, name := range []string{"", "XI"} {
+			if reply, r := svc.SayHi(ctx, name); r != pbcommon.R_INVALID_ARGS || reply != "" {
+				t.Errorf("SayHi(%q) got reply:%q r:%v want R_INVALID_ARGS", name, reply, r)
+			}
+		}
+	})
+
+	// 参数错误时本地实现返回ErrCode和err，经过grpc只剩err(rpc error)，两者有一个即可
+	t.Run("MakeADate", func(t *testing.T) {
+		for _, tt := range []struct {
+			date, wantReply string
+			wantCode        pbcommon.R
+		}{
+			{"2020-10-01", "OK~, I will arrive on 10.1", pbcommon.R_OK},
+			{"2020-10-02", "Sorry, I am too busy~", pbcommon.R_OK},
+			{"bad date", "", pbcommon.R_INVALID_ARGS},
+		} {
+			rsp, err := svc.MakeADate(ctx, &pb.MakeADateRequest{DateStr: tt.date})
+			if tt.wantCode != pbcommon.R_OK {
+				if err == nil && rsp.GetBaseRsp().GetErrCode() != tt.wantCode {
+					t.Errorf("MakeADate(%q) got rsp:%v err:%v", tt.date, rsp, err)
+				}
+				continue
+			}
+			if err != nil || rsp == nil || rsp.BaseRsp.GetErrCode() != tt.wantCode || rsp.Reply != tt.wantReply {
+				t.Errorf("MakeADate(%q) got rsp:%v err:%v", tt.date, rsp, err)
+			}
+		}
+	})
+
+	t.Run("UpdateUserInfo", func(t *testing.T) {
+		rsp, err := svc.UpdateUserInfo(ctx, &pb.UpdateUserInfoRequest{UserId: 1, NewName: "Jack"})
+		if err != nil || rsp == nil || rsp.BaseRsp.GetErrCode() != pbcommon.R_OK {
+			t.Errorf("UpdateUserInfo got rsp:%v err:%v", rsp, err)
+		}
+	})
+
+	// SayHi成功后可以按名字查到，limit生效
+	t.Run("ListGreetings", func(t *testing.T) {
+		name := fmt.Sprintf("contract-%d", time.Now().UnixNano())
+		for i := 0; i < 3; i++ {
+			if _, r := svc.SayHi(ctx, name); r != pbcommon.R_OK {
+				t.Fatalf("SayHi got r:%v", r)
+			}
+		}
+		rsp, err := svc.ListGreetings(ctx, &pb.ListGreetingsRequest{Name: name, Limit: 2})
+		if err != nil || rsp.BaseRsp.GetErrCode() != pbcommon.R_OK || len(rsp.Greetings) != 2 {
+			t.Fatalf("ListGreetings got rsp:%v err:%v", rsp, err)
+		}
+		for _, g := range rsp.Greetings {
+			if g.Name != name || !strings.HasSuffix(g.Reply, ","+name) || g.CreatedAt == 0 {
+				t.Errorf("got greeting:%v", g)
+			}
+		}
+		rsp, err = svc.ListGreetings(ctx, &pb.ListGreetingsRequest{Name: name + "-nobody"})
+		if err != nil || len(rsp.Greetings) != 0 {
+			t.Errorf("ListGreetings nobody got rsp:%v err:%v", rsp, err)
+		}
+	})
+
+	// 分页约定见gokit_foundation/pagination，只查询本子测试写入的名字
+	t.Run("ListGreetingsPages", func(t *testing.T) {
+		name := fmt.Sprintf("contract-pages-%d", time.Now().UnixNano())
+		const total = 25
+		for i := 0; i < total; i++ {
+			if _, r := svc.SayHi(ctx, name); r != pbcommon.R_OK {
+				t.Fatalf("SayHi got r:%v", r)
+			}
+		}
+		pagetest.Contract(t, func(ctx context.Context, p pagination.Params) ([]string, string, error) {
+			rsp, err := svc.ListGreetings(ctx, &pb.ListGreetingsRequest{Name: name, PageSize: int32(p.PageSize), PageToken: p.PageToken, OrderBy: p.OrderBy})
+			if err != nil {
+				return nil, "", err
+			}
+			if code := rsp.GetBaseRsp().GetErrCode(); code != pbcommon.R_OK {
+				return nil, "", fmt.Errorf("err_code %v", code)
+			}
+			var ids []string
+			for _, g := range rsp.Greetings {
+				ids = append(ids, g.Id)
+			}
+			return ids, rsp.NextPageToken, nil
+		}, pagetest.Config{Total: total, DefaultSize: 20, MaxSize: 100, OrderBy: []string{"", "created_at", "name desc"}})
+
+		// 换了name的token为参数错误
+		rsp, err := svc.ListGreetings(ctx, &pb.ListGreetingsRequest{Name: name, PageSize: 1})
+		if err != nil || rsp.NextPageToken == "" {
+			t.Fatalf("got rsp:%v err:%v", rsp, err)
+		}
+		rsp, err = svc.ListGreetings(ctx, &pb.ListGreetingsRequest{Name: name + "-other", PageToken: rsp.NextPageToken})
+		if err == nil && rsp.GetBaseRsp().GetErrCode() != pbcommon.R_INVALID_ARGS {
+			t.Errorf("got rsp:%v err:%v", rsp, err)
+		}
+	})
+}
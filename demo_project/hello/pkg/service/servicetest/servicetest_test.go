@@ -0,0 +1,46 @@
+package servicetest
+
+import (
+	"context"
+	"github.com/go-kit/kit/log"
+	"gokit_foundation/events"
+	"hello/db"
+	"hello/pb/gen-go/pb"
+	"hello/pb/gen-go/pbcommon"
+	"hello/pkg/service"
+	"reflect"
+	"testing"
+)
+
+type nopPublisher struct{}
+
+func (nopPublisher) Publish(context.Context, events.Event) error { return nil }
+
+func TestContract(t *testing.T) {
+	logger := log.NewNopLogger()
+	for name, svc := range map[string]service.HelloService{
+		"basic": service.NewBasicHelloService(logger, db.NewMemGreetingRepo(0)),
+		"middlewares": service.New([]service.Middleware{
+			service.LoggingMiddleware(logger),
+			service.EventsMiddleware(nopPublisher{}, "hello", logger),
+		}, logger, db.NewMemGreetingRepo(0)),
+		"fake": &Fake{},
+	} {
+		t.Run(name, func(t *testing.T) { Contract(t, svc) })
+	}
+}
+
+func TestFake(t *testing.T) {
+	f := &Fake{SayHiFunc: func(context.Context, string) (string, pbcommon.R) { return "", pbcommon.R_SYS_ERR }}
+	ctx := context.Background()
+	if _, r := f.SayHi(ctx, "Jack"); r != pbcommon.R_SYS_ERR {
+		t.Errorf("SayHi got r:%v", r)
+	}
+	// 没有替换的方法使用默认实现
+	if rsp, err := f.ListGreetings(ctx, &pb.ListGreetingsRequest{}); err != nil || len(rsp.Greetings) != 0 {
+		t.Errorf("ListGreetings got rsp:%v err:%v", rsp, err)
+	}
+	if got := f.Calls(); !reflect.DeepEqual(got, []string{"SayHi", "ListGreetings"}) {
+		t.Errorf("got calls:%v", got)
+	}
+}
@@ -0,0 +1,279 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-util/_go"
+	"gokit_foundation/auth"
+	"gokit_foundation/events"
+	"hello/pkg/notify"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	log "github.com/go-kit/kit/log"
+	"github.com/gorilla/websocket"
+)
+
+/*
+WebSocket transport：client订阅事件，service层发布的事件经notify.Bus推送给订阅了该类型的连接，与grpc的一问一答不同，连接建立后由server主动推送
+	client => server  {"action": "subscribe", "types": ["greeting", "date"]}
+	                  {"action": "unsubscribe", "types": ["date"]}
+	server => client  {"type": "subscribed", "time": "...", "payload": ["greeting", "date"]}  订阅/取消订阅生效后的确认
+	                  {"type": "greeting", "source": "hello", "time": "...", "payload": {"name": "x", "reply": "..."}}
+-	认证在upgrade之前完成：token来自header Authorization: Bearer <token>(浏览器无法设置header时用?token=)，
+	经过与endpoint相同的auth中间件(如auth.JWTMiddleware)，失败时返回HTTP 401，不升级连接
+-	每个连接是一个TaskGroup(读、写两个任务同生共死)：读任务处理订阅消息和pong，写任务是唯一的写者，推送事件和定期ping，
+	任一任务退出(连接断开、写超时、client发送无效消息)时关闭连接并取消订阅
+-	client处理不过来(缓冲区满)时丢弃事件而不是阻塞其他连接，见notify.Bus
+	websocat 'ws://127.0.0.1:8086/ws?token=xxx'
+*/
+
+const (
+	writeWait      = 10 * time.Second
+	pongWait       = 60 * time.Second
+	pingPeriod     = pongWait * 9 / 10
+	maxMessageSize = 4096
+)
+
+type clientMessage struct {
+	Action string   `json:"action"`
+	Types  []string `json:"types"`
+}
+
+type HandlerOption func(*Handler)
+
+// HandlerAuth 连接前认证，mw与endpoint层使用的auth中间件相同，认证通过后ctx中的claims(如sub)会写入日志
+func HandlerAuth(mw endpoint.Middleware) HandlerOption {
+	return func(h *Handler) { h.auth = mw }
+}
+
+// HandlerBuffer 每个连接缓冲的事件数，默认64
+func HandlerBuffer(n int) HandlerOption {
+	return func(h *Handler) { h.buffer = n }
+}
+
+// HandlerCheckOrigin 默认只允许与Host相同的Origin(没有Origin的非浏览器client不受限制)
+func HandlerCheckOrigin(f func(r *http.Request) bool) HandlerOption {
+	return func(h *Handler) { h.upgrader.CheckOrigin = f }
+}
+
+type Handler struct {
+	bus      *notify.Bus
+	logger   log.Logger
+	auth     endpoint.Middleware
+	buffer   int
+	upgrader websocket.Upgrader
+
+	mu     sync.Mutex
+	conns  map[*websocket.Conn]struct{}
+	closed bool
+}
+
+func NewHandler(bus *notify.Bus, logger log.Logger, options ...HandlerOption) *Handler {
+	h := &Handler{
+		bus:      bus,
+		logger:   logger,
+		buffer:   64,
+		upgrader: websocket.Upgrader{HandshakeTimeout: writeWait},
+		conns:    map[*websocket.Conn]struct{}{},
+	}
+	for _, opt := range options {
+		opt(h)
+	}
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	subject, err := h.authenticate(r)
+	if err != nil {
+		code := http.StatusInternalServerError // 如读取key失败
+		if _, ok := err.(auth.Error); ok {
+			code = http.StatusUnauthorized
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade已经返回了HTTP错误
+		return
+	}
+	if !h.add(conn) {
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""), time.Now().Add(writeWait))
+		conn.Close()
+		return
+	}
+	defer h.remove(conn)
+
+	logger := log.With(h.logger, "transport", "WebSocket", "remote", r.RemoteAddr, "subject", subject)
+	logger.Log("msg", "connected")
+	err = h.serve(conn)
+	logger.Log("msg", "disconnected", "err", err)
+}
+
+// 返回认证通过的用户(JWT的sub)，未设置HandlerAuth时为空
+func (h *Handler) authenticate(r *http.Request) (string, error) {
+	if h.auth == nil {
+		return "", nil
+	}
+	ctx := auth.HTTPToContext()(r.Context(), r)
+	if tk := r.URL.Query().Get("token"); tk != "" && !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		ctx = auth.WithToken(ctx, tk)
+	}
+	var subject string
+	_, err := h.auth(func(ctx context.Context, _ interface{}) (interface{}, error) {
+		if claims, ok := auth.ClaimsFromContext(ctx); ok {
+			subject, _ = claims["sub"].(string)
+		}
+		return nil, nil
+	})(ctx, nil)
+	return subject, err
+}
+
+// 读、写任务同生共死，任一退出时关闭连接、取消订阅，等两者都退出后返回
+func (h *Handler) serve(conn *websocket.Conn) error {
+	sub := h.bus.Subscribe(h.buffer)
+	acks := make(chan events.Event, 1)
+	var mu sync.Mutex
+	var exitErr error
+	setErr := func(err error) {
+		mu.Lock()
+		if exitErr == nil {
+			exitErr = err
+		}
+		mu.Unlock()
+	}
+
+	tg := _go.NewTaskGroup()
+	tg.Add(func(ctx context.Context) error {
+		err := h.read(ctx, conn, sub, acks)
+		setErr(err)
+		return err
+	}).Interrupt(func(error) {
+		conn.Close()
+	})
+	tg.Add(func(ctx context.Context) error {
+		err := h.write(ctx, conn, sub, acks)
+		setErr(err)
+		return err
+	}).Interrupt(func(error) {
+		sub.Close()
+	})
+	tg.Run()
+	return exitErr
+}
+
+// 只在连接出错时返回，返回的err一定不为nil(TaskGroup根据它结束写任务)
+func (h *Handler) read(ctx context.Context, conn *websocket.Conn, sub *notify.Subscription, acks chan<- events.Event) error {
+	conn.SetReadLimit(maxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	for {
+		_, b, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		var msg clientMessage
+		var ack events.Event
+		if err = json.Unmarshal(b, &msg); err == nil {
+			ack, err = handleMessage(sub, msg)
+		}
+		if err != nil {
+			// WriteControl可以与写任务并发调用
+			conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseUnsupportedData, err.Error()), time.Now().Add(writeWait))
+			return err
+		}
+		// 确认由写任务发送，写任务已经退出时ctx被取消
+		select {
+		case acks <- ack:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func handleMessage(sub *notify.Subscription, msg clientMessage) (events.Event, error) {
+	ack := events.Event{Time: time.Now(), Payload: msg.Types}
+	if len(msg.Types) == 0 {
+		return ack, errors.New("types is empty")
+	}
+	switch msg.Action {
+	case "subscribe":
+		sub.Add(msg.Types...)
+		ack.Type = "subscribed"
+	case "unsubscribe":
+		sub.Remove(msg.Types...)
+		ack.Type = "unsubscribed"
+	default:
+		return ack, fmt.Errorf("unknown action %q", msg.Action)
+	}
+	return ack, nil
+}
+
+// 连接上唯一的写者，订阅被取消(读任务退出)时返回
+func (h *Handler) write(ctx context.Context, conn *websocket.Conn, sub *notify.Subscription, acks <-chan events.Event) error {
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case e, ok := <-sub.C():
+			if !ok {
+				return nil
+			}
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := conn.WriteJSON(e); err != nil {
+				return err
+			}
+		case ack := <-acks:
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := conn.WriteJSON(ack); err != nil {
+				return err
+			}
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (h *Handler) add(conn *websocket.Conn) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return false
+	}
+	h.conns[conn] = struct{}{}
+	return true
+}
+
+func (h *Handler) remove(conn *websocket.Conn) {
+	h.mu.Lock()
+	delete(h.conns, conn)
+	h.mu.Unlock()
+}
+
+// Close 通知所有连接server正在退出(CloseGoingAway)并断开，之后的连接请求直接关闭
+// http.Server.Shutdown不会关闭已经升级(hijack)的连接，退出时需要调用它
+func (h *Handler) Close() {
+	h.mu.Lock()
+	h.closed = true
+	conns := make([]*websocket.Conn, 0, len(h.conns))
+	for c := range h.conns {
+		conns = append(conns, c)
+	}
+	h.mu.Unlock()
+	for _, c := range conns {
+		c.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutdown"), time.Now().Add(time.Second))
+		c.Close()
+	}
+}
@@ -0,0 +1,109 @@
+package ws
+
+import (
+	"context"
+	"gokit_foundation/auth"
+	"gokit_foundation/events"
+	"hello/pkg/notify"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	log "github.com/go-kit/kit/log"
+	"github.com/gorilla/websocket"
+)
+
+func dial(srv *httptest.Server, query string, header http.Header) (*websocket.Conn, *http.Response, error) {
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/?" + query
+	return websocket.DefaultDialer.Dial(url, header)
+}
+
+// 读取下一个事件，1秒内没有收到时失败
+func next(t *testing.T, conn *websocket.Conn) events.Event {
+	var e events.Event
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if err := conn.ReadJSON(&e); err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestHandler(t *testing.T) {
+	bus := notify.NewBus(nil)
+	key := []byte("secret")
+	h := NewHandler(bus, log.NewNopLogger(), HandlerAuth(auth.JWTMiddleware(auth.Config{Key: auth.StaticKey(key)}, "Subscribe")))
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	// 没有token时不升级连接
+	if _, rsp, err := dial(srv, "", nil); err == nil || rsp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("got rsp:%v err:%v", rsp, err)
+	}
+
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "alice"}).SignedString(key)
+	byQuery, _, err := dial(srv, "token="+token, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer byQuery.Close()
+	byHeader, _, err := dial(srv, "", http.Header{"Authorization": {"Bearer " + token}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer byHeader.Close()
+
+	byQuery.WriteJSON(clientMessage{Action: "subscribe", Types: []string{"greeting"}})
+	byHeader.WriteJSON(clientMessage{Action: "subscribe", Types: []string{"greeting", "date"}})
+	// 收到确认后订阅已经生效
+	for _, c := range []*websocket.Conn{byQuery, byHeader} {
+		if e := next(t, c); e.Type != "subscribed" {
+			t.Fatalf("got event:%+v", e)
+		}
+	}
+
+	bus.Publish(context.Background(), events.Event{Type: "date", Payload: "d"})
+	bus.Publish(context.Background(), events.Event{Type: "greeting", Payload: "g"})
+	if e := next(t, byQuery); e.Type != "greeting" || e.Payload != "g" {
+		t.Errorf("got event:%+v", e)
+	}
+	for _, want := range []string{"date", "greeting"} {
+		if e := next(t, byHeader); e.Type != want {
+			t.Errorf("want:%s got event:%+v", want, e)
+		}
+	}
+	byHeader.WriteJSON(clientMessage{Action: "unsubscribe", Types: []string{"date"}})
+	if e := next(t, byHeader); e.Type != "unsubscribed" {
+		t.Errorf("got event:%+v", e)
+	}
+	bus.Publish(context.Background(), events.Event{Type: "date"})
+	bus.Publish(context.Background(), events.Event{Type: "greeting"})
+	for _, c := range []*websocket.Conn{byQuery, byHeader} {
+		if e := next(t, c); e.Type != "greeting" {
+			t.Errorf("got event:%+v", e)
+		}
+	}
+
+	// 无效消息：server关闭连接并取消订阅
+	byQuery.WriteMessage(websocket.TextMessage, []byte(`{"action": "publish", "types": ["greeting"]}`))
+	_, _, err = byQuery.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseUnsupportedData) {
+		t.Errorf("got err:%v", err)
+	}
+
+	// server退出时通知client
+	h.Close()
+	_, _, err = byHeader.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("got err:%v", err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for bus.Len() != 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := bus.Len(); n != 0 {
+		t.Errorf("got subscriptions:%d", n)
+	}
+}
@@ -0,0 +1,138 @@
+package client
+
+import (
+	"context"
+	"gokit_foundation/errs"
+	endpoint2 "new_addsvc/pkg/endpoint"
+	service2 "new_addsvc/pkg/service"
+	"sync"
+	"time"
+)
+
+// BatchSummer 可以一次计算多组Sum的client，New、NewEtcd、NewK8s返回的Service都实现了它(见endpoint.AddSvcEndpoints.BatchSum)
+type BatchSummer interface {
+	BatchSum(ctx context.Context, items []*endpoint2.SumRequest) ([]int, []error, error)
+}
+
+type BatchOption func(*batchingService)
+
+// BatchWindow 第一个Sum调用之后等待其他调用的时间，默认2ms
+func BatchWindow(d time.Duration) BatchOption {
+	return func(s *batchingService) { s.window = d }
+}
+
+// BatchMaxSize 一个batch最多的调用数，达到时立即发送，默认100(server的上限，见endpoint.BatchSumRequest)
+func BatchMaxSize(n int) BatchOption {
+	return func(s *batchingService) { s.maxSize = n }
+}
+
+/*
+Batching 返回的Service将window内的Sum调用合并为一次BatchSum，减少RPC的次数，适合大量并发的小调用(如api网关)
+  - 每个调用得到自己的结果和err，与直接调用Sum相同；整批失败(网络错误、限流等)时batch内的调用都返回这个err
+  - batch使用第一个调用ctx中的值(token、request id等)，所以只适合同一个身份的调用方；
+    batch的deadline为其中最晚的deadline，某个调用的ctx结束时它立即返回，不影响batch内的其他调用
+  - Concat，以及svc没有实现BatchSummer(如NATS、thrift的client)时直接调用svc
+*/
+func Batching(svc service2.Service, options ...BatchOption) service2.Service {
+	bs, ok := svc.(BatchSummer)
+	if !ok {
+		return svc
+	}
+	s := &batchingService{Service: svc, bs: bs, window: 2 * time.Millisecond, maxSize: 100}
+	for _, opt := range options {
+		opt(s)
+	}
+	return s
+}
+
+type batchingService struct {
+	service2.Service
+	bs      BatchSummer
+	window  time.Duration
+	maxSize int
+
+	mu      sync.Mutex
+	pending *sumBatch // 正在收集调用的batch
+}
+
+type sumBatch struct {
+	ctx        context.Context // 第一个调用的ctx
+	deadline   time.Time
+	noDeadline bool // 有调用的ctx没有deadline
+	items      []*endpoint2.SumRequest
+	timer      *time.Timer
+
+	// done关闭后才能读取
+	done     chan struct{}
+	vs       []int
+	itemErrs []error
+	err      error
+}
+
+func (s *batchingService) Sum(ctx context.Context, a, b int) (int, error) {
+	batch, i := s.add(ctx, a, b)
+	select {
+	case <-batch.done:
+		if batch.err != nil {
+			return 0, batch.err
+		}
+		return batch.vs[i], batch.itemErrs[i]
+	case <-ctx.Done():
+		return 0, errs.From(ctx.Err())
+	}
+}
+
+// 将调用加入正在收集的batch，返回batch以及调用在其中的位置
+func (s *batchingService) add(ctx context.Context, a, b int) (*sumBatch, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	batch := s.pending
+	if batch == nil {
+		batch = &sumBatch{ctx: ctx, done: make(chan struct{})}
+		batch.timer = time.AfterFunc(s.window, func() { s.flush(batch) })
+		s.pending = batch
+	}
+	if d, ok := ctx.Deadline(); !ok {
+		batch.noDeadline = true
+	} else if d.After(batch.deadline) {
+		batch.deadline = d
+	}
+	batch.items = append(batch.items, &endpoint2.SumRequest{A: a, B: b})
+	i := len(batch.items) - 1
+	if len(batch.items) >= s.maxSize {
+		batch.timer.Stop()
+		s.pending = nil
+		go s.send(batch)
+	}
+	return batch, i
+}
+
+// window结束时发送，batch已经因为达到maxSize发送时不做处理
+func (s *batchingService) flush(batch *sumBatch) {
+	s.mu.Lock()
+	if s.pending != batch {
+		s.mu.Unlock()
+		return
+	}
+	s.pending = nil
+	s.mu.Unlock()
+	s.send(batch)
+}
+
+func (s *batchingService) send(batch *sumBatch) {
+	var ctx context.Context = valueOnlyContext{batch.ctx}
+	if !batch.noDeadline {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, batch.deadline)
+		defer cancel()
+	}
+	batch.vs, batch.itemErrs, batch.err = s.bs.BatchSum(ctx, batch.items)
+	close(batch.done)
+}
+
+// 只保留ctx中的值，batch不随第一个调用方取消
+type valueOnlyContext struct{ context.Context }
+
+func (valueOnlyContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (valueOnlyContext) Done() <-chan struct{}       { return nil }
+func (valueOnlyContext) Err() error                  { return nil }
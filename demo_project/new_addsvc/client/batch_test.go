@@ -0,0 +1,112 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"gokit_foundation/errs"
+	endpoint2 "new_addsvc/pkg/endpoint"
+	service2 "new_addsvc/pkg/service"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 记录每次BatchSum的项数
+type stubBatchSummer struct {
+	service2.Service
+	mu    sync.Mutex
+	sizes []int
+	err   error
+	block chan struct{} // 不为nil时BatchSum等待它关闭
+}
+
+func (s *stubBatchSummer) BatchSum(ctx context.Context, items []*endpoint2.SumRequest) ([]int, []error, error) {
+	s.mu.Lock()
+	s.sizes = append(s.sizes, len(items))
+	s.mu.Unlock()
+	if s.block != nil {
+		<-s.block
+	}
+	if s.err != nil {
+		return nil, nil, s.err
+	}
+	vs, itemErrs := make([]int, len(items)), make([]error, len(items))
+	for i, item := range items {
+		vs[i], itemErrs[i] = s.Service.Sum(ctx, item.A, item.B)
+	}
+	return vs, itemErrs, nil
+}
+
+func (s *stubBatchSummer) batchSizes() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]int{}, s.sizes...)
+}
+
+// 并发调用n次Sum(i, 1)，返回每次的结果
+func sumConcurrently(svc service2.Service, n int) ([]int, []error) {
+	vs, itemErrs := make([]int, n), make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			vs[i], itemErrs[i] = svc.Sum(context.Background(), i, 1-i%2)
+		}(i)
+	}
+	wg.Wait()
+	return vs, itemErrs
+}
+
+func TestBatching(t *testing.T) {
+	stub := &stubBatchSummer{Service: service2.NewBasicService(nil)}
+	svc := Batching(stub, BatchWindow(20*time.Millisecond), BatchMaxSize(100))
+
+	// window内的调用合并为一次BatchSum，每个调用得到自己的结果
+	vs, itemErrs := sumConcurrently(svc, 10)
+	for i := range vs {
+		if vs[i] != i+1-i%2 || itemErrs[i] != nil {
+			t.Errorf("call:%d got v:%d err:%v", i, vs[i], itemErrs[i])
+		}
+	}
+	if sizes := stub.batchSizes(); len(sizes) != 1 || sizes[0] != 10 {
+		t.Errorf("got batch sizes:%v", sizes)
+	}
+	if _, err := svc.Sum(context.Background(), 0, 0); err != service2.ErrTwoZeroes {
+		t.Errorf("got err:%v", err)
+	}
+	if v, err := svc.Concat(context.Background(), "a", "b"); err != nil || v != "ab" {
+		t.Errorf("concat got v:%s err:%v", v, err)
+	}
+
+	// 达到maxSize时立即发送，不等待window
+	stub.sizes = nil
+	svc = Batching(stub, BatchWindow(time.Hour), BatchMaxSize(5))
+	if _, itemErrs := sumConcurrently(svc, 10); itemErrs[9] != nil {
+		t.Errorf("got err:%v", itemErrs[9])
+	}
+	if sizes := stub.batchSizes(); len(sizes) != 2 || sizes[0] != 5 || sizes[1] != 5 {
+		t.Errorf("got batch sizes:%v", sizes)
+	}
+
+	// 整批失败时每个调用都返回这个err
+	stub.err = errs.Unavailable("down")
+	if _, itemErrs := sumConcurrently(Batching(stub), 3); !errors.Is(itemErrs[2], stub.err) {
+		t.Errorf("got err:%v", itemErrs[2])
+	}
+
+	// ctx结束的调用立即返回
+	stub.err, stub.block = nil, make(chan struct{})
+	defer close(stub.block)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := Batching(stub).Sum(ctx, 1, 2); errs.KindOf(err) != errs.KindTimeout {
+		t.Errorf("got err:%v", err)
+	}
+
+	// 没有实现BatchSummer时原样返回
+	basic := service2.NewBasicService(nil)
+	if Batching(basic) != basic {
+		t.Error("want the same service")
+	}
+}
@@ -1,85 +1,233 @@
 package client
 
 import (
+	"context"
 	stdendpoint "github.com/go-kit/kit/endpoint"
+	"github.com/nats-io/nats.go"
 	stdopentracing "github.com/opentracing/opentracing-go"
-	"io"
+	"gokit_foundation/deadline"
+	"gokit_foundation/errs"
+	"gokit_foundation/grpcclient"
+	"google.golang.org/grpc"
+	"math/rand"
 	config2 "new_addsvc/config"
+	pb "new_addsvc/pb/gen-go/addsvcpb"
+	"new_addsvc/pb/gen-go/addsvcv2pb"
 	endpoint2 "new_addsvc/pkg/endpoint"
 	service2 "new_addsvc/pkg/service"
 	transport2 "new_addsvc/pkg/transport"
 	"time"
 
-	consulapi "github.com/hashicorp/consul/api"
-
+	"github.com/apache/thrift/lib/go/thrift"
 	"github.com/go-kit/kit/log"
-	"github.com/go-kit/kit/sd"
-	"github.com/go-kit/kit/sd/consul"
-	"github.com/go-kit/kit/sd/lb"
+	"gokit_foundation/sdclient"
 )
 
 // New returns a service that's load-balanced over instances of new_addsvc found
 // in the provided Consul server. The mechanism of looking up new_addsvc
-// instances in Consul is hard-coded into thient.
-// client从consul获取实例地址
-func New(consulAddr string, logger log.Logger) (service2.Service, error) {
-	apiClient, err := consulapi.NewClient(&consulapi.Config{
-		Address: consulAddr,
-	})
+// instances in Consul is hard-coded into the client.
+// client从consul获取实例地址，服务发现、负载均衡、重试由gokit_foundation/sdclient完成
+// opts可以覆盖默认的负载均衡方式、重试次数、单次调用超时等
+// 不再使用时调用stop，停止consul的watch并关闭所有连接(见sdclient.Client.Stop)
+func New(consulAddr string, logger log.Logger, opts ...sdclient.Option) (service2.Service, func(), error) {
+	// As the implementer of new_addsvc, we declare and enforce these
+	// parameters for all of the new_addsvc consumers.
+	defaults := []sdclient.Option{
+		sdclient.WithTags("gokit_svc"),
+		sdclient.WithPassingOnly(true), // 只获取健康的实例地址
+		sdclient.WithRetry(3, 500*time.Millisecond),
+	}
+	sdc, err := sdclient.New(consulAddr, config2.SvcName, logger, append(defaults, opts...)...)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	return newWithSDClient(sdc), sdc.Stop, nil
+}
 
-	// As the implementer of new_addsvc, we declare and enforce these
-	// parameters for all of the new_addsvc consumers.
-	var (
-		consulService = config2.SvcName
-		consulTags    = []string{"gokit_svc"}
-		passingOnly   = true // 只获取健康的实例地址
-		retryMax      = 3
-		retryTimeout  = 500 * time.Millisecond
-	)
-
-	var (
-		sdclient  = consul.NewClient(apiClient)
-		instancer = consul.NewInstancer(sdclient, logger, consulService, consulTags, passingOnly)
-		/*
-			client得到的对象还是endpoint
-		*/
-		endpoints endpoint2.AddSvcEndpoints
-	)
+// NewEtcd 与New相同，但从etcd获取实例地址(服务端需使用 -sd.backend etcd 启动)
+func NewEtcd(etcdAddr string, logger log.Logger, opts ...sdclient.Option) (service2.Service, func()) {
+	defaults := []sdclient.Option{
+		sdclient.WithRetry(3, 500*time.Millisecond),
+	}
+	sdc := sdclient.NewEtcd(etcdAddr, config2.SvcName, logger, append(defaults, opts...)...)
+	return newWithSDClient(sdc), sdc.Stop
+}
+
+// NewK8s 与New相同，但在k8s集群内通过headless service的DNS SRV记录获取实例地址(见deploy/k8s.yaml)
+// svc为headless service名，namespace为空时使用环境变量POD_NAMESPACE或default
+func NewK8s(svc, namespace string, logger log.Logger, opts ...sdclient.Option) (service2.Service, func()) {
+	defaults := []sdclient.Option{
+		sdclient.WithRetry(3, 500*time.Millisecond),
+	}
+	sdc := sdclient.NewK8s(svc, namespace, "grpc", 5*time.Second, logger, append(defaults, opts...)...)
+	return newWithSDClient(sdc), sdc.Stop
+}
+
+// NewMesh 与New相同，但服务发现和负载均衡交给grpc的xDS resolver或Envoy sidecar(见sdclient.NewMesh)，
+// target如xds:///addsvc或sidecar的出站监听地址；默认不重试，避免与Envoy的路由重试相乘
+func NewMesh(target string, logger log.Logger, opts ...sdclient.Option) (service2.Service, func()) {
+	defaults := []sdclient.Option{
+		sdclient.WithRetry(1, 500*time.Millisecond),
+	}
+	sdc := sdclient.NewMesh(target, logger, append(defaults, opts...)...)
+	return newWithSDClient(sdc), sdc.Stop
+}
+
+// NewNATS 通过NATS调用(server需配置 -nats.url)，不需要服务发现，负载均衡由NATS的queue group完成
+// timeout为每次调用等待响应的最长时间，返回的连接由调用方关闭
+func NewNATS(natsURL string, timeout time.Duration) (service2.Service, *nats.Conn, error) {
+	nc, err := nats.Connect(natsURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	return transport2.MakeNATSClientEndpoints(nc, timeout), nc, nil
+}
+
+// NewThrift 通过thrift直连某个实例调用(server需配置 -thrift.port)，不需要服务发现
+// 底层只有一个连接且不是并发安全的，只适合命令行等顺序调用的场景，返回的transport由调用方关闭
+func NewThrift(addr string, timeout time.Duration) (service2.Service, thrift.TTransport, error) {
+	cli, trans, err := transport2.DialThrift(addr, timeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	return transport2.NewThriftClient(cli), trans, nil
+}
+
+// Dial 不经过go-kit，直接返回生成的grpc client，供只想依赖pb的调用方使用(如其他语言风格的grpc代码)，
+// request id、指标、链路、重试、token等由gokit_foundation/grpcclient的拦截器完成，与New得到的一致；
+// conf.Retry.MaxAttempts为0时使用与New相同的默认值(3次，共500ms)，dialOpts为空时不使用TLS，返回的连接由调用方关闭
+func Dial(target string, conf grpcclient.Config, dialOpts ...grpc.DialOption) (pb.AddClient, *grpc.ClientConn, error) {
+	cc, err := dial(target, conf, dialOpts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pb.NewAddClient(cc), cc, nil
+}
+
+// DialV2 与Dial相同，返回v2的grpc client，server没有v2接口时调用返回Unimplemented(不会改用v1，见transport.NewGRPCClientV2)
+func DialV2(target string, conf grpcclient.Config, dialOpts ...grpc.DialOption) (addsvcv2pb.AddClient, *grpc.ClientConn, error) {
+	cc, err := dial(target, conf, dialOpts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return addsvcv2pb.NewAddClient(cc), cc, nil
+}
+
+func dial(target string, conf grpcclient.Config, dialOpts []grpc.DialOption) (*grpc.ClientConn, error) {
+	if conf.Retry.MaxAttempts == 0 {
+		conf.Retry = grpcclient.Retry{MaxAttempts: 3, Timeout: 500 * time.Millisecond}
+	}
+	if len(dialOpts) == 0 {
+		dialOpts = []grpc.DialOption{grpc.WithInsecure()}
+	}
+	return grpc.Dial(target, append(grpcclient.DialOptions(conf), dialOpts...)...)
+}
 
+func newWithSDClient(sdc *sdclient.Client) service2.Service {
 	var tracer stdopentracing.Tracer
 	tracer = stdopentracing.GlobalTracer()
 
-	{
-		// 在client，每个endpoint又依次封装了服务发现、负载均衡、重试，还可以加断路器，限速等
-		// 每个endpoint单独封装，可以非常细粒度的为接口安装基础设施（比如某些接口的限速配置与其他接口并不相同）
-		factory := factoryFor(tracer, log.NewNopLogger(), endpoint2.MakeSumEndpoint)
-		endpointer := sd.NewEndpointer(instancer, factory, logger)
-		balancer := lb.NewRoundRobin(endpointer)
-		retry := lb.Retry(retryMax, retryTimeout, balancer)
-		endpoints.SumEndpoint = retry
+	/*
+		client得到的对象还是endpoint
+	*/
+	// 在client，每个endpoint又依次封装了服务发现、负载均衡、重试，还可以加断路器，限速等
+	// 每个endpoint单独封装，可以非常细粒度的为接口安装基础设施（比如某些接口的限速配置与其他接口并不相同）
+	// 每个实例的grpc连接由sdclient的连接池管理(见sdclient.ConnPool)，Sum、Concat共用，第一次调用时才拨号
+	// 最外层是超时预算：调用方没有设置deadline时使用CallBudget.Default，包括所有重试；剩余时间不足时不再发出请求
+	// Sum、Concat是幂等的，设置了sdclient.WithHedging时对调用慢的实例发起对冲；BatchSum一批较大，不对冲
+	withBudget := budgetMiddleware(CallBudget)
+	if Version == V2 {
+		sum := func(e endpoint2.AddSvcV2Endpoints) stdendpoint.Endpoint { return e.SumEndpoint }
+		concat := func(e endpoint2.AddSvcV2Endpoints) stdendpoint.Endpoint { return e.ConcatEndpoint }
+		return endpoint2.AddSvcV2Endpoints{
+			SumEndpoint:    withBudget("SumV2")(sdc.HedgedGRPCEndpoint(endpointForV2(tracer, log.NewNopLogger(), sum))),
+			ConcatEndpoint: withBudget("ConcatV2")(sdc.HedgedGRPCEndpoint(endpointForV2(tracer, log.NewNopLogger(), concat))),
+		}
+	}
+	return endpoint2.AddSvcEndpoints{
+		SumEndpoint:      withBudget("Sum")(sdc.HedgedGRPCEndpoint(endpointFor(tracer, log.NewNopLogger(), endpoint2.MakeSumEndpoint))),
+		ConcatEndpoint:   withBudget("Concat")(sdc.HedgedGRPCEndpoint(endpointFor(tracer, log.NewNopLogger(), endpoint2.MakeConcatEndpoint))),
+		BatchSumEndpoint: withBudget("BatchSum")(sdc.GRPCEndpoint(endpointFor(tracer, log.NewNopLogger(), batchSumEndpoint))),
 	}
-	{
-		factory := factoryFor(tracer, log.NewNopLogger(), endpoint2.MakeConcatEndpoint)
-		endpointer := sd.NewEndpointer(instancer, factory, logger)
-		balancer := lb.NewRoundRobin(endpointer)
-		retry := lb.Retry(retryMax, retryTimeout, balancer)
-		endpoints.ConcatEndpoint = retry
+}
+
+// APIVersion grpc接口的版本，见pb/proto/addsvc_v2.proto
+type APIVersion int
+
+const (
+	V1 APIVersion = iota + 1
+	V2
+)
+
+// Version New、NewEtcd、NewK8s、NewMesh调用的接口版本，在创建client之前修改；NATS、thrift只有v1
+// V2时返回的Service还实现了OverflowSummer，没有升级到v2的实例改用v1调用(见transport.NewGRPCClientV2)，不支持Batching
+var Version = V1
+
+// OverflowSummer Version为V2时返回的Service实现了它(见endpoint.AddSvcV2Endpoints.SumOverflow)
+type OverflowSummer interface {
+	SumOverflow(ctx context.Context, a, b int64, overflow addsvcv2pb.Overflow) (int64, bool, error)
+}
+
+// CallBudget client每次调用的超时预算，在创建client之前修改
+// 剩余时间通过grpc传给server，server端的预算见config.Dynamic.Deadlines
+var CallBudget = deadline.Budget{Default: 2 * time.Second, Min: 5 * time.Millisecond}
+
+func budgetMiddleware(b deadline.Budget) func(method string) stdendpoint.Middleware {
+	return func(method string) stdendpoint.Middleware {
+		return deadline.Middleware(method, func(string) (deadline.Budget, bool) { return b, true }, nil)
 	}
+}
 
-	return endpoints, nil
+// BatchSum没有对应的service方法，直接使用grpc client的ep，见Batching
+func batchSumEndpoint(s service2.Service) stdendpoint.Endpoint {
+	return s.(endpoint2.AddSvcEndpoints).BatchSumEndpoint
 }
 
 type MakeEndpoint func(service2.Service) stdendpoint.Endpoint
 
-func factoryFor(otTracer stdopentracing.Tracer, logger log.Logger, makeEndpoint MakeEndpoint) sd.Factory {
-	return func(instance string) (stdendpoint.Endpoint, io.Closer, error) {
-		svc, err := transport2.MakeClientEndpoints(instance, otTracer, logger)
-		if err != nil {
-			return nil, nil, err
+// 连接池为实例的每个连接调用一次，拨号选项(如TLS)来自sdclient.WithDialOptions
+func endpointFor(otTracer stdopentracing.Tracer, logger log.Logger, makeEndpoint MakeEndpoint) func(*grpc.ClientConn) stdendpoint.Endpoint {
+	return func(conn *grpc.ClientConn) stdendpoint.Endpoint {
+		return makeEndpoint(transport2.NewGRPCClient(conn, otTracer, logger))
+	}
+}
+
+// 与endpointFor相同，使用v2的grpc client
+func endpointForV2(otTracer stdopentracing.Tracer, logger log.Logger, pick func(endpoint2.AddSvcV2Endpoints) stdendpoint.Endpoint) func(*grpc.ClientConn) stdendpoint.Endpoint {
+	return func(conn *grpc.ClientConn) stdendpoint.Endpoint {
+		return pick(transport2.NewGRPCClientV2(conn, otTracer, logger))
+	}
+}
+
+// Prefer 优先调用可用区为zone、版本为version(如金丝雀版本)的实例，为空的条件不限制，没有这样的健康实例时调用其他实例
+// 服务端注册时带上对应的tag(-zone以及构建时的version，见config.Bootstrap.ConsulRegisterOptions)，只对consul生效
+// 都设置时依次降级：同一可用区的该版本 => 其他可用区的该版本 => 同一可用区的其他版本 => 所有实例，如：
+//
+//	addcli -prefer.zone cn-sh-a -prefer.version v1.3.0 sum 1 2
+func Prefer(zone, version string) []sdclient.Option {
+	zoneTag, versionTag := "zone="+zone, "version="+version
+	switch {
+	case zone != "" && version != "":
+		return []sdclient.Option{sdclient.WithAffinity(versionTag, zoneTag), sdclient.WithAffinity(versionTag), sdclient.WithAffinity(zoneTag)}
+	case zone != "":
+		return []sdclient.Option{sdclient.WithAffinity(zoneTag)}
+	case version != "":
+		return []sdclient.Option{sdclient.WithAffinity(versionTag)}
+	}
+	return nil
+}
+
+// InjectFailures 以rate(0~1)的概率让每次调用直接返回可重试的Unavailable错误，不发出请求
+// 通过sdclient.WithEndpointMiddleware安装在每个实例的endpoint上，用于演示重试，如：
+//
+//	addcli -inject.fail 0.5 -retry.max 5 sum 1 2
+func InjectFailures(rate float64) stdendpoint.Middleware {
+	return func(next stdendpoint.Endpoint) stdendpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			if rand.Float64() < rate {
+				return nil, errs.Unavailable("client: injected failure")
+			}
+			return next(ctx, request)
 		}
-		return makeEndpoint(svc), nil, nil
 	}
 }
@@ -4,8 +4,23 @@ import (
 	"context"
 	"fmt"
 	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/sd"
+	stdopentracing "github.com/opentracing/opentracing-go"
 	"go-util/_util"
+	"gokit_foundation/deadline"
+	"gokit_foundation/errs"
+	"gokit_foundation/grpcclient"
+	"gokit_foundation/sdclient"
+	"google.golang.org/grpc"
+	"math"
+	"net"
+	pb "new_addsvc/pb/gen-go/addsvcpb"
+	"new_addsvc/pb/gen-go/addsvcv2pb"
+	endpoint2 "new_addsvc/pkg/endpoint"
+	service2 "new_addsvc/pkg/service"
+	transport2 "new_addsvc/pkg/transport"
 	"testing"
+	"time"
 )
 
 /*
@@ -15,8 +30,9 @@ import (
 func TestSum(t *testing.T) {
 	consulAddr := "192.168.1.168:8500"
 
-	svc, err := New(consulAddr, log.NewNopLogger())
+	svc, stop, err := New(consulAddr, log.NewNopLogger())
 	_util.PanicIfErr(err, nil)
+	defer stop()
 
 	r, err := svc.Sum(context.Background(), 1, 2)
 	if err != nil {
@@ -24,3 +40,187 @@ func TestSum(t *testing.T) {
 	}
 	fmt.Printf("Sum rsp:%d\n", r)
 }
+
+func TestInjectFailures(t *testing.T) {
+	ok := func(context.Context, interface{}) (interface{}, error) { return "ok", nil }
+	if _, err := InjectFailures(0)(ok)(context.Background(), nil); err != nil {
+		t.Errorf("rate 0 got err:%v", err)
+	}
+	_, err := InjectFailures(1)(ok)(context.Background(), nil)
+	if !errs.IsRetryable(err) {
+		t.Errorf("rate 1 got err:%v, want retryable err", err)
+	}
+}
+
+// 不经过consul，通过连接池调用本地的grpc server
+// go test -run PooledClient ./client/
+func TestPooledClient(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := log.NewNopLogger()
+	tracer := stdopentracing.NoopTracer{}
+	eps := endpoint2.New(service2.NewBasicService(logger), logger, tracer, endpoint2.Deps{})
+	srv := grpc.NewServer()
+	pb.RegisterAddServer(srv, transport2.NewGRPCServer(eps, tracer, logger))
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	sdc := sdclient.NewWithInstancer(sd.FixedInstancer{lis.Addr().String()}, logger, sdclient.WithRetry(3, time.Second), sdclient.WithPoolSize(2))
+	defer sdc.Stop()
+	svc := newWithSDClient(sdc)
+	for i := 0; i < 4; i++ {
+		if v, err := svc.Sum(context.Background(), i, 1); err != nil || v != i+1 {
+			t.Fatalf("sum got v:%d err:%v", v, err)
+		}
+		if v, err := svc.Concat(context.Background(), "a", "b"); err != nil || v != "ab" {
+			t.Fatalf("concat got v:%s err:%v", v, err)
+		}
+	}
+	// 剩余时间不足CallBudget.Min，不发出请求
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if _, err := svc.Sum(ctx, 1, 1); err != deadline.ErrBudgetExhausted {
+		t.Errorf("sum got err:%v", err)
+	}
+	// 经过BatchSum
+	if vs, itemErrs := sumConcurrently(Batching(svc), 4); vs[3] != 3 || itemErrs[0] != nil {
+		t.Errorf("batching got vs:%v errs:%v", vs, itemErrs)
+	}
+}
+
+func TestPrefer(t *testing.T) {
+	for _, tt := range []struct {
+		zone, version string
+		want          int
+	}{{"", "", 0}, {"cn-sh-a", "", 1}, {"", "v1.3.0", 1}, {"cn-sh-a", "v1.3.0", 3}} {
+		if n := len(Prefer(tt.zone, tt.version)); n != tt.want {
+			t.Errorf("zone:%q version:%q got %d options", tt.zone, tt.version, n)
+		}
+	}
+}
+
+// 每次调用等待delay或ctx结束，模拟调用慢的实例
+type slowService struct {
+	service2.Service
+	delay time.Duration
+}
+
+func (s slowService) Sum(ctx context.Context, a, b int) (int, error) {
+	select {
+	case <-time.After(s.delay):
+		return s.Service.Sum(ctx, a, b)
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+func listenAdd(t *testing.T, svc service2.Service) (string, func()) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := log.NewNopLogger()
+	tracer := stdopentracing.NoopTracer{}
+	eps := endpoint2.New(svc, logger, tracer, endpoint2.Deps{})
+	srv := grpc.NewServer()
+	pb.RegisterAddServer(srv, transport2.NewGRPCServer(eps, tracer, logger))
+	go srv.Serve(lis)
+	return lis.Addr().String(), srv.Stop
+}
+
+func TestHedgedClient(t *testing.T) {
+	logger := log.NewNopLogger()
+	fast, stopFast := listenAdd(t, service2.NewBasicService(logger))
+	defer stopFast()
+	slow, stopSlow := listenAdd(t, slowService{Service: service2.NewBasicService(logger), delay: time.Second})
+	defer stopSlow()
+
+	sdc := sdclient.NewWithInstancer(sd.FixedInstancer{fast, slow}, logger,
+		sdclient.WithRetry(1, 500*time.Millisecond), sdclient.WithHedging(20*time.Millisecond, 1, 0))
+	defer sdc.Stop()
+	svc := newWithSDClient(sdc)
+	// 一半的调用先到slow实例，对冲到fast实例后仍然很快返回
+	for i := 0; i < 4; i++ {
+		start := time.Now()
+		if v, err := svc.Sum(context.Background(), i, 1); err != nil || v != i+1 {
+			t.Fatalf("sum got v:%d err:%v", v, err)
+		}
+		if d := time.Since(start); d > 300*time.Millisecond {
+			t.Errorf("sum took %v", d)
+		}
+	}
+}
+
+// 不经过go-kit的grpc client
+// go test -run DialGRPC ./client/
+func TestDialGRPC(t *testing.T) {
+	addr, stop := listenAdd(t, service2.NewBasicService(log.NewNopLogger()))
+	defer stop()
+	cli, cc, err := Dial(addr, grpcclient.Config{Tracer: stdopentracing.NoopTracer{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cc.Close()
+	if rsp, err := cli.Sum(context.Background(), &pb.SumRequest{A: 1, B: 2}); err != nil || rsp.V != 3 {
+		t.Fatalf("sum got rsp:%v err:%v", rsp, err)
+	}
+	if rsp, err := cli.Concat(context.Background(), &pb.ConcatRequest{A: "a", B: "b"}); err != nil || rsp.V != "ab" {
+		t.Fatalf("concat got rsp:%v err:%v", rsp, err)
+	}
+}
+
+// Version为V2时调用v2接口，没有v2接口的实例(只注册了v1)改用v1
+// go test -run VersionV2 ./client/
+func TestVersionV2(t *testing.T) {
+	logger := log.NewNopLogger()
+	tracer := stdopentracing.NoopTracer{}
+	v1Only, stop := listenAdd(t, service2.NewBasicService(logger))
+	defer stop()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer()
+	addsvcv2pb.RegisterAddServer(srv, transport2.NewGRPCServerV2(endpoint2.NewV2(service2.NewBasicService(logger), logger, tracer, endpoint2.Deps{}), tracer, logger))
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	Version = V2
+	defer func() { Version = V1 }()
+	newClient := func(addr string) (service2.Service, func()) {
+		sdc := sdclient.NewWithInstancer(sd.FixedInstancer{addr}, logger, sdclient.WithRetry(1, time.Second))
+		return newWithSDClient(sdc), sdc.Stop
+	}
+
+	svc, stopV2 := newClient(lis.Addr().String())
+	defer stopV2()
+	ovs, ok := svc.(OverflowSummer)
+	if !ok {
+		t.Fatalf("got %T, want OverflowSummer", svc)
+	}
+	if v, saturated, err := ovs.SumOverflow(context.Background(), math.MaxInt64, 1, addsvcv2pb.Overflow_OVERFLOW_SATURATE); err != nil || v != math.MaxInt64 || !saturated {
+		t.Errorf("sum got v:%d saturated:%v err:%v", v, saturated, err)
+	}
+	if _, _, err := ovs.SumOverflow(context.Background(), math.MinInt64, -1, addsvcv2pb.Overflow_OVERFLOW_ERROR); err != service2.ErrSumOverflow {
+		t.Errorf("sum got err:%v", err)
+	}
+	if v, err := svc.Concat(context.Background(), "a", "b"); err != nil || v != "ab" {
+		t.Errorf("concat got v:%s err:%v", v, err)
+	}
+
+	// 只有v1的实例：范围内的调用结果相同，超出v1的范围时返回参数错误
+	svc, stopV1 := newClient(v1Only)
+	defer stopV1()
+	ovs = svc.(OverflowSummer)
+	if v, saturated, err := ovs.SumOverflow(context.Background(), 1, 2, addsvcv2pb.Overflow_OVERFLOW_SATURATE); err != nil || v != 3 || saturated {
+		t.Errorf("fallback sum got v:%d saturated:%v err:%v", v, saturated, err)
+	}
+	if _, _, err := ovs.SumOverflow(context.Background(), math.MaxInt64, 1, addsvcv2pb.Overflow_OVERFLOW_SATURATE); errs.CodeOf(err) != service2.CodeInvalidArgs {
+		t.Errorf("fallback sum got err:%v", err)
+	}
+	if v, err := svc.Concat(context.Background(), "a", "b"); err != nil || v != "ab" {
+		t.Errorf("fallback concat got v:%s err:%v", v, err)
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"gokit_foundation/auth"
+	"gokit_foundation/cache"
+	"gokit_foundation/mesh"
+	"gokit_foundation/mtls"
+	"gokit_foundation/propagation"
+	"gokit_foundation/sdclient"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding/gzip"
+	"io"
+	"new_addsvc/client"
+	"new_addsvc/pb/gen-go/addsvcv2pb"
+	"new_addsvc/pkg/service"
+	"os"
+	"strconv"
+	"time"
+)
+
+/*
+示例client，从consul发现addsvc实例，负载均衡调用Sum/Concat
+	addcli -consul.addr 127.0.0.1:8500 sum 1 2
+	addcli -balancer random -call.timeout 200ms concat a b
+	addcli -sd.backend etcd -etcd.addr 127.0.0.1:2379 sum 1 2
+	addcli -sd.backend k8s -k8s.svc addsvc sum 1 2 (在k8s集群内运行)
+	addcli -sd.backend mesh -mesh.target xds:///addsvc sum 1 2 (服务发现和负载均衡交给xDS/Envoy，需要设置GRPC_XDS_BOOTSTRAP，见gokit_foundation/mesh)
+	addcli -sd.backend mesh -mesh.target 127.0.0.1:15001 -retry.max 1 sum 1 2 (通过Envoy sidecar调用，重试交给Envoy)
+	addcli -nats.url nats://127.0.0.1:4222 sum 1 2 (通过NATS调用，不使用服务发现)
+	addcli -thrift.addr 127.0.0.1:8082 sum 1 2 (通过thrift直连实例调用，不使用服务发现)
+	addcli -tls.ca ca.crt -tls.cert client.crt -tls.key client.key sum 1 2 (server启用mTLS时)
+	addcli -inject.fail 0.5 -retry.max 5 -retry.timeout 1s sum 1 2 (一半的调用失败，观察重试，结束时在stderr输出重试次数)
+	addcli -prefer.zone cn-sh-a -prefer.version v1.3.0 sum 1 2 (优先调用同一可用区、指定版本的实例，没有时调用其他实例，只对consul生效)
+	addcli -hedge.delay 50ms sum 1 2 (50ms没有返回时对冲到另一个实例，结束时在stderr输出对冲次数)
+	addcli -api.version 2 -sum.saturate sum 9223372036854775807 1 (调用v2接口，溢出时返回int64的最大值，见client.Version)
+*/
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("addcli", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var (
+		sdBackend   = fs.String("sd.backend", "consul", "service discovery backend: consul, etcd, k8s or mesh")
+		consulAddr  = fs.String("consul.addr", "127.0.0.1:8500", "consul agent address")
+		etcdAddr    = fs.String("etcd.addr", "127.0.0.1:2379", "etcd address(HTTP/JSON gateway)")
+		k8sSvc      = fs.String("k8s.svc", "addsvc", "headless service name, used when sd.backend is k8s")
+		k8sNS       = fs.String("k8s.namespace", "", "namespace of the headless service, default env POD_NAMESPACE or default")
+		meshTarget  = fs.String("mesh.target", "xds:///addsvc", "grpc dial target resolved by xDS or an Envoy sidecar listener, used when sd.backend is mesh")
+		balancer    = fs.String("balancer", "roundrobin", "load balancer: roundrobin or random")
+		retryMax    = fs.Int("retry.max", 3, "max attempts of each call")
+		retryTotal  = fs.Duration("retry.timeout", 500*time.Millisecond, "total timeout of each call, including retries and backoff")
+		backoff     = fs.Duration("retry.backoff", 10*time.Millisecond, "base backoff between retries, doubled on each retry with jitter, 0 means no backoff")
+		retryCodes  = fs.String("retry.codes", "", "retryable grpc codes separated by comma, e.g. Unavailable,Aborted, default retry temporary errors")
+		injectFail  = fs.Float64("inject.fail", 0, "fail this fraction(0~1) of attempts with Unavailable before sending requests, to demonstrate retries")
+		callTimeout = fs.Duration("call.timeout", 0, "timeout of each attempt, 0 means no limit")
+		hedgeDelay  = fs.Duration("hedge.delay", 0, "send a hedged request to another instance if no response after this delay, 0 means no hedging")
+		hedgeMax    = fs.Int("hedge.max", 1, "max hedged requests of each attempt")
+		hedgeBudget = fs.Float64("hedge.budget", 0.1, "max fraction of calls to hedge in the long run, 0 means no limit")
+		poolSize    = fs.Int("pool.size", 1, "grpc connections per instance, shared by all methods")
+		token       = fs.String("token", "", "JWT bearer token, required when server enables auth")
+		noCache     = fs.Bool("no-cache", false, "skip the response cache of server(grpc only)")
+		natsURL     = fs.String("nats.url", "", "call over NATS instead of grpc if set, sd.backend and balancer are ignored")
+		thriftAddr  = fs.String("thrift.addr", "", "call the instance over thrift instead of grpc if set, sd.backend and balancer are ignored")
+		preferZone  = fs.String("prefer.zone", "", "prefer instances registered with tag zone=xx, fall back to other zones(consul only)")
+		preferVer   = fs.String("prefer.version", "", "prefer instances registered with tag version=xx, e.g. a canary version(consul only)")
+		grpcGzip    = fs.Bool("grpc.gzip", false, "compress grpc requests with gzip, server responds with gzip as well")
+		apiVersion  = fs.Int("api.version", 1, "version of the grpc API: 1 or 2, instances without v2 are called with v1(grpc only)")
+		saturate    = fs.Bool("sum.saturate", false, "saturate to the max/min int64 on overflow instead of failing, requires api.version 2")
+		tlsConf     mtls.Config
+	)
+	// server启用TLS时需要设置，mTLS时还需要client证书
+	fs.StringVar(&tlsConf.CAFile, "tls.ca", "", "CA file(PEM) to verify server certificate, enable TLS(grpc only) if set")
+	fs.StringVar(&tlsConf.CertFile, "tls.cert", "", "client certificate file(PEM) for mTLS")
+	fs.StringVar(&tlsConf.KeyFile, "tls.key", "", "private key file(PEM) of tls.cert")
+	fs.StringVar(&tlsConf.ServerName, "tls.server-name", "", "server name to verify server certificate, default host of instance address")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: addcli [flags] sum <a> <b> | concat <a> <b>")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 3 {
+		fs.Usage()
+		return 2
+	}
+
+	var bt sdclient.BalancerType
+	switch *balancer {
+	case "roundrobin":
+		bt = sdclient.RoundRobin
+	case "random":
+		bt = sdclient.Random
+	default:
+		fmt.Fprintf(stderr, "unknown balancer: %s\n", *balancer)
+		return 2
+	}
+
+	method, a, b := fs.Arg(0), fs.Arg(1), fs.Arg(2)
+	var x, y int
+	switch method {
+	case "sum":
+		var err1, err2 error
+		x, err1 = strconv.Atoi(a)
+		y, err2 = strconv.Atoi(b)
+		if err1 != nil || err2 != nil {
+			fmt.Fprintln(stderr, "sum args must be integers")
+			return 2
+		}
+	case "concat":
+	default:
+		fmt.Fprintf(stderr, "unknown method: %s\n", method)
+		return 2
+	}
+
+	switch {
+	case *apiVersion != 1 && *apiVersion != 2:
+		fmt.Fprintf(stderr, "unknown api version: %d\n", *apiVersion)
+		return 2
+	case *apiVersion == 2 && (*natsURL != "" || *thriftAddr != ""):
+		fmt.Fprintln(stderr, "api version 2 is grpc only")
+		return 2
+	case *saturate && *apiVersion != 2:
+		fmt.Fprintln(stderr, "sum.saturate requires api.version 2")
+		return 2
+	}
+	client.Version = client.APIVersion(*apiVersion)
+
+	stats, hedges := newRetryStats(), newRetryStats()
+	sdOpts := []sdclient.Option{sdclient.WithBalancer(bt), sdclient.WithRetry(*retryMax, *retryTotal), sdclient.WithCallTimeout(*callTimeout),
+		sdclient.WithRetryBackoff(*backoff, 10**backoff), sdclient.WithRetryMetrics(stats), sdclient.WithPoolSize(*poolSize),
+		sdclient.WithHedging(*hedgeDelay, *hedgeMax, *hedgeBudget), sdclient.WithHedgeMetrics(hedges)}
+	if *retryCodes != "" {
+		cs, err := parseCodes(*retryCodes)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+		sdOpts = append(sdOpts, sdclient.WithRetryable(sdclient.RetryOnCodes(cs...)))
+	}
+	sdOpts = append(sdOpts, client.Prefer(*preferZone, *preferVer)...)
+	if *injectFail > 0 {
+		sdOpts = append(sdOpts, sdclient.WithEndpointMiddleware(client.InjectFailures(*injectFail)))
+	}
+	if *grpcGzip {
+		sdOpts = append(sdOpts, sdclient.WithDialOptions(grpc.WithDefaultCallOptions(grpc.UseCompressor(gzip.Name))))
+	}
+	defer stats.print(stderr)
+	defer hedges.printHedges(stderr)
+	if tlsConf.CAFile != "" || tlsConf.CertFile != "" {
+		r, err := mtls.NewReloader(tlsConf, false, log.NewNopLogger())
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+		sdOpts = append(sdOpts, sdclient.WithDialOptions(grpc.WithTransportCredentials(r.ClientCredentials())))
+	}
+	var svc service.Service
+	switch {
+	case *natsURL != "":
+		// 超时使用retry.timeout
+		natsSvc, nc, err := client.NewNATS(*natsURL, *retryTotal)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		defer nc.Close()
+		svc = natsSvc
+	case *thriftAddr != "":
+		thriftSvc, trans, err := client.NewThrift(*thriftAddr, *retryTotal)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		defer trans.Close()
+		svc = thriftSvc
+	case *sdBackend == "consul":
+		consulSvc, stop, err := client.New(*consulAddr, log.NewLogfmtLogger(stderr), sdOpts...)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		defer stop()
+		svc = consulSvc
+	case *sdBackend == "etcd":
+		etcdSvc, stop := client.NewEtcd(*etcdAddr, log.NewLogfmtLogger(stderr), sdOpts...)
+		defer stop()
+		svc = etcdSvc
+	case *sdBackend == "k8s":
+		headlessSvc, stop := client.NewK8s(*k8sSvc, *k8sNS, log.NewLogfmtLogger(stderr), sdOpts...)
+		defer stop()
+		svc = headlessSvc
+	case *sdBackend == "mesh":
+		// 转发Envoy的trace header，路由超时与调用的deadline一致
+		propagation.Fields = append(propagation.Fields, mesh.Field)
+		meshSvc, stop := client.NewMesh(*meshTarget, log.NewLogfmtLogger(stderr), sdOpts...)
+		defer stop()
+		svc = meshSvc
+	default:
+		fmt.Fprintf(stderr, "unknown sd backend: %s\n", *sdBackend)
+		return 2
+	}
+
+	ctx := context.Background()
+	if *token != "" {
+		ctx = auth.WithToken(ctx, *token)
+	}
+	if *noCache {
+		ctx = cache.WithBypass(ctx)
+	}
+
+	// 实例列表是异步从consul获取的，刚创建时可能还是空的，sdclient会在总超时时间内重试
+	switch method {
+	case "sum":
+		if *saturate {
+			v, saturated, err := svc.(client.OverflowSummer).SumOverflow(ctx, int64(x), int64(y), addsvcv2pb.Overflow_OVERFLOW_SATURATE)
+			if err != nil {
+				fmt.Fprintln(stderr, err)
+				return 1
+			}
+			if saturated {
+				fmt.Fprintln(stderr, "saturated")
+			}
+			fmt.Fprintln(stdout, v)
+			break
+		}
+		v, err := svc.Sum(ctx, x, y)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		fmt.Fprintln(stdout, v)
+	case "concat":
+		v, err := svc.Concat(ctx, a, b)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		fmt.Fprintln(stdout, v)
+	}
+	return 0
+}
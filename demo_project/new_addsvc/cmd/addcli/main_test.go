@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"gokit_foundation/sdclient"
+	"google.golang.org/grpc/codes"
+	"testing"
+)
+
+// 参数错误时不会连接consul
+func TestRunBadArgs(t *testing.T) {
+	test := []struct {
+		name string
+		args []string
+	}{
+		{name: "[no args]"},
+		{name: "[unknown method]", args: []string{"mul", "1", "2"}},
+		{name: "[unknown balancer]", args: []string{"-balancer", "xxx", "sum", "1", "2"}},
+		{name: "[sum not int]", args: []string{"sum", "a", "2"}},
+		{name: "[unknown sd backend]", args: []string{"-sd.backend", "zk", "sum", "1", "2"}},
+		{name: "[unknown retry code]", args: []string{"-retry.codes", "Unavailable,Down", "sum", "1", "2"}},
+		{name: "[unknown api version]", args: []string{"-api.version", "3", "sum", "1", "2"}},
+		{name: "[v2 over nats]", args: []string{"-api.version", "2", "-nats.url", "nats://127.0.0.1:4222", "sum", "1", "2"}},
+		{name: "[saturate without v2]", args: []string{"-sum.saturate", "sum", "1", "2"}},
+	}
+	for _, tt := range test {
+		var stdout, stderr bytes.Buffer
+		if code := run(tt.args, &stdout, &stderr); code != 2 {
+			t.Errorf("name:%s got code:%d stderr:%s", tt.name, code, stderr.String())
+		}
+	}
+}
+
+func TestRetryStats(t *testing.T) {
+	var buf bytes.Buffer
+	stats := newRetryStats()
+	stats.print(&buf)
+	if buf.Len() != 0 {
+		t.Errorf("no retry got:%s", buf.String())
+	}
+	stats.With("event", sdclient.RetryEventRetry).Add(1)
+	stats.With("event", sdclient.RetryEventRetry).Add(1)
+	stats.With("event", sdclient.RetryEventBudgetExhausted).Add(1)
+	stats.print(&buf)
+	if want := "retries: retry=2 attempts_exhausted=0 budget_exhausted=1\n"; buf.String() != want {
+		t.Errorf("got:%q want:%q", buf.String(), want)
+	}
+}
+
+func TestHedgeStats(t *testing.T) {
+	var buf bytes.Buffer
+	hedges := newRetryStats()
+	hedges.With("event", sdclient.HedgeEventHedge).Add(1)
+	hedges.With("event", sdclient.HedgeEventWon).Add(1)
+	hedges.printHedges(&buf)
+	if want := "hedges: hedge=1 won=1 budget_exhausted=0\n"; buf.String() != want {
+		t.Errorf("got:%q want:%q", buf.String(), want)
+	}
+}
+
+func TestParseCodes(t *testing.T) {
+	cs, err := parseCodes("Unavailable, aborted")
+	if err != nil || len(cs) != 2 || cs[0] != codes.Unavailable || cs[1] != codes.Aborted {
+		t.Errorf("got:%v err:%v", cs, err)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"github.com/go-kit/kit/metrics"
+	"gokit_foundation/sdclient"
+	"google.golang.org/grpc/codes"
+	"io"
+	"strings"
+	"sync"
+)
+
+// retryStats 实现metrics.Counter，按event记录sdclient的重试(或对冲)次数，结束时输出
+type retryStats struct {
+	event string
+	mu    *sync.Mutex
+	m     map[string]float64
+}
+
+func newRetryStats() retryStats {
+	return retryStats{mu: &sync.Mutex{}, m: map[string]float64{}}
+}
+
+func (s retryStats) With(labelValues ...string) metrics.Counter {
+	for i := 0; i+1 < len(labelValues); i += 2 {
+		if labelValues[i] == "event" {
+			s.event = labelValues[i+1]
+		}
+	}
+	return s
+}
+
+func (s retryStats) Add(delta float64) {
+	s.mu.Lock()
+	s.m[s.event] += delta
+	s.mu.Unlock()
+}
+
+// 没有发生重试时不输出
+func (s retryStats) print(w io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.m) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "retries: %s=%v %s=%v %s=%v\n",
+		sdclient.RetryEventRetry, s.m[sdclient.RetryEventRetry],
+		sdclient.RetryEventAttemptsExhausted, s.m[sdclient.RetryEventAttemptsExhausted],
+		sdclient.RetryEventBudgetExhausted, s.m[sdclient.RetryEventBudgetExhausted])
+}
+
+// printHedges 输出对冲次数，用于WithHedgeMetrics，没有发生对冲时不输出
+func (s retryStats) printHedges(w io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.m) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "hedges: %s=%v %s=%v %s=%v\n",
+		sdclient.HedgeEventHedge, s.m[sdclient.HedgeEventHedge],
+		sdclient.HedgeEventWon, s.m[sdclient.HedgeEventWon],
+		sdclient.HedgeEventBudgetExhausted, s.m[sdclient.HedgeEventBudgetExhausted])
+}
+
+// parseCodes 解析逗号分隔的grpc状态码名，如Unavailable,Aborted
+func parseCodes(s string) ([]codes.Code, error) {
+	var cs []codes.Code
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		found := false
+		for c := codes.OK; c <= codes.Unauthenticated; c++ {
+			if strings.EqualFold(c.String(), name) {
+				cs = append(cs, c)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown grpc code: %s", name)
+		}
+	}
+	return cs, nil
+}
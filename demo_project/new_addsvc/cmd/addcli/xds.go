@@ -0,0 +1,4 @@
+package main
+
+// 注册xds:///的resolver和xDS的负载均衡策略，见-sd.backend mesh
+import _ "google.golang.org/grpc/xds"
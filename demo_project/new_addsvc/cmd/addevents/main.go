@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"github.com/go-redis/redis"
+	"github.com/segmentio/kafka-go"
+	"gokit_foundation/deadletter"
+	"gokit_foundation/dedup"
+	"gokit_foundation/errs"
+	"gokit_foundation/events"
+	"gokit_foundation/idempotency"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+/*
+示例consumer，消费addsvc发布的领域事件(见service.EventsMiddleware)并打印，演示基于go-kit服务的事件驱动集成
+	addsvc serve -kafka.brokers 127.0.0.1:9092
+	addevents -kafka.brokers 127.0.0.1:9092 -topics addsvc.events
+同一个group的多个consumer分摊分区，不同group各自消费全部事件
+使用 -dlq.max.attempts 时同时消费<topic>.retry，无法解析的事件写入<topic>.dlq(见deadletter.RunKafka)，可以用dlq-inspector查看和重放
+使用 -dedup.window 时以事件id(没有id时为partition:offset)在group内去重，rebalance后重新消费、outbox重复投递的事件只打印一次，
+设置 -dedup.redis 时同一个group的多个consumer共用去重记录，否则只在本进程内去重
+*/
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stderr))
+}
+
+func run(args []string, stderr io.Writer) int {
+	fs := flag.NewFlagSet("addevents", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var (
+		brokers = fs.String("kafka.brokers", "127.0.0.1:9092", "kafka brokers separated by comma")
+		topics  = fs.String("topics", "addsvc.events", "topics to consume, separated by comma")
+		group   = fs.String("group", "addevents", "consumer group id")
+		dlq     = fs.Int("dlq.max.attempts", 0, "retry failed events via <topic>.retry and move them to <topic>.dlq after max attempts, 0 disables")
+		window  = fs.Duration("dedup.window", 0, "skip events with the same id within the window, 0 disables")
+		rdAddr  = fs.String("dedup.redis", "", "redis address of dedup records shared by consumers of the group, in-memory if empty")
+	)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	logger := log.NewLogfmtLogger(stderr)
+
+	var store idempotency.Store = idempotency.NewMemStore(100000)
+	if *rdAddr != "" {
+		cli := redis.NewClient(&redis.Options{Addr: *rdAddr})
+		defer cli.Close()
+		store = idempotency.NewRedisStore(cli)
+	}
+	d := dedup.New(store, "addevents:dedup:", dedup.Config{Group: *group, Window: *window}, nil, logger)
+	handle := dedup.Handler(d, eventID, func(_ context.Context, m deadletter.Message) error {
+		return printEvent(m.Topic, m.ID, m.Value, logger)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigCh
+		cancel()
+	}()
+
+	// kafka-go的Reader只能消费一个topic，每个topic一个Reader
+	var wg sync.WaitGroup
+	for _, topic := range strings.Split(*topics, ",") {
+		topic = strings.TrimSpace(topic)
+		if topic == "" {
+			continue
+		}
+		if *dlq > 0 {
+			policy := deadletter.DefaultPolicy()
+			policy.MaxAttempts = *dlq
+			conf := deadletter.KafkaConfig{Brokers: strings.Split(*brokers, ","), GroupID: *group, Topic: topic, Policy: policy}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				deadletter.RunKafka(ctx, conf, handle, logger)
+			}()
+			continue
+		}
+		r := kafka.NewReader(kafka.ReaderConfig{
+			Brokers: strings.Split(*brokers, ","),
+			GroupID: *group,
+			Topic:   topic,
+		})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			consume(ctx, r, handle, logger)
+		}()
+	}
+	wg.Wait()
+	return 0
+}
+
+// 持续读取并处理事件，ctx结束时关闭Reader(提交已读取的offset)
+func consume(ctx context.Context, r *kafka.Reader, h deadletter.HandlerFunc, logger log.Logger) {
+	defer r.Close()
+	for {
+		m, err := r.ReadMessage(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Log("topic", r.Config().Topic, "err", err)
+			}
+			return
+		}
+		dm := deadletter.Message{ID: fmt.Sprintf("%d:%d", m.Partition, m.Offset), Topic: m.Topic, Key: m.Key, Value: m.Value}
+		if err := h(ctx, dm); err != nil {
+			logger.Log("topic", m.Topic, "offset", m.Offset, "err", err)
+		}
+	}
+}
+
+// 事件id在重试(<topic>.retry)和重复投递时不变，无法解析或没有id时使用消息在分区中的位置
+func eventID(m deadletter.Message) string {
+	var e events.Event
+	if err := json.Unmarshal(m.Value, &e); err != nil || e.ID == "" {
+		return m.ID
+	}
+	return e.ID
+}
+
+// 无法解析的事件返回errs.Invalid，使用死信队列时不重试
+func printEvent(topic, id string, value []byte, logger log.Logger) error {
+	var e events.Event
+	if err := json.Unmarshal(value, &e); err != nil {
+		return errs.Invalid("invalid event: " + err.Error())
+	}
+	payload, _ := json.Marshal(e.Payload)
+	logger.Log("topic", topic, "id", id, "type", e.Type, "source", e.Source, "time", e.Time, "payload", string(payload))
+	return nil
+}
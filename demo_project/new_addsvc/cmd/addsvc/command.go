@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"gokit_foundation/buildinfo"
+	"gokit_foundation/mtls"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"io"
+	"new_addsvc/config"
+	"os"
+	"strings"
+	"time"
+)
+
+/*
+addsvc支持以下子命令：
+	addsvc serve [flags]        启动服务，不指定子命令时默认执行serve，与之前的用法保持一致
+	addsvc healthcheck [flags]  调用本地grpc健康检查接口，健康则退出码为0，否则为1，可直接用作Docker HEALTHCHECK
+	addsvc version              打印构建信息
+serve的以下参数只加载配置，不启动服务(见checkConfig)：
+	addsvc -validate-config [flags]  校验所有来源叠加后的配置，有错误时逐条输出，退出码为1
+	addsvc -print-config [flags]     打印生效的配置以及每一项的来源(默认值、文件、环境变量、参数)，敏感信息已隐去
+*/
+
+func main() {
+	os.Exit(runCommand(os.Args[1:]))
+}
+
+func runCommand(args []string) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return serve(args)
+	}
+	switch args[0] {
+	case "serve":
+		return serve(args[1:])
+	case "healthcheck":
+		return healthcheck(args[1:])
+	case "version":
+		printVersion(os.Stdout)
+		return 0
+	}
+	fmt.Fprintf(os.Stderr, "unknown command: %s\nusage: addsvc [serve|healthcheck|version] [flags]\n", args[0])
+	return 2
+}
+
+// 子命令healthcheck
+func healthcheck(args []string) int {
+	fs := flag.NewFlagSet("healthcheck", flag.ExitOnError)
+	var grpcAddr = fs.String("grpc.addr", "127.0.0.1:8080", "grpc address to check")
+	var timeout = fs.Duration("timeout", time.Second*3, "timeout of dialing and checking")
+	// server启用TLS时需要设置，mTLS时还需要client证书
+	var tlsConf mtls.Config
+	fs.StringVar(&tlsConf.CAFile, "tls.ca", "", "CA file(PEM) to verify server certificate, enable TLS if set")
+	fs.StringVar(&tlsConf.CertFile, "tls.cert", "", "client certificate file(PEM) for mTLS")
+	fs.StringVar(&tlsConf.KeyFile, "tls.key", "", "private key file(PEM) of tls.cert")
+	fs.StringVar(&tlsConf.ServerName, "tls.server-name", "", "server name to verify server certificate, default host of grpc.addr")
+	_ = fs.Parse(args)
+
+	var opts []grpc.DialOption
+	if tlsConf.CAFile != "" || tlsConf.CertFile != "" {
+		r, err := mtls.NewReloader(tlsConf, false, log.NewNopLogger())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		opts = append(opts, grpc.WithTransportCredentials(r.ClientCredentials()))
+	}
+	if err := checkHealth(*grpcAddr, *timeout, opts...); err != nil {
+		fmt.Fprintln(os.Stderr, "unhealthy:", err)
+		return 1
+	}
+	fmt.Println("healthy")
+	return 0
+}
+
+// opts为空时不使用TLS
+func checkHealth(grpcAddr string, timeout time.Duration, opts ...grpc.DialOption) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if len(opts) == 0 {
+		opts = []grpc.DialOption{grpc.WithInsecure()}
+	}
+	cc, err := grpc.DialContext(ctx, grpcAddr, append(opts, grpc.WithBlock())...)
+	if err != nil {
+		return err
+	}
+	defer cc.Close()
+
+	rsp, err := grpc_health_v1.NewHealthClient(cc).Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+	if err != nil {
+		return err
+	}
+	if rsp.Status != grpc_health_v1.HealthCheckResponse_SERVING {
+		return fmt.Errorf("status: %s", rsp.Status)
+	}
+	return nil
+}
+
+// -validate-config、-print-config：err为LoadConfig的错误，advertise_host的探测和可热更新配置文件(-dynamic.conf)与启动时一样检查，
+// 有错误时逐条输出到stderr并返回1；ADDSVC_开头的未知环境变量只警告，不影响退出码
+func checkConfig(l *config.Loaded, err error, environ []string, stdout, stderr io.Writer) int {
+	var problems []string
+	if ve, ok := err.(*config.ValidationError); ok {
+		problems = append(problems, ve.Problems...)
+	} else if err != nil {
+		problems = append(problems, err.Error())
+	}
+	conf := l.Bootstrap
+	if err == nil && conf.AdvertiseHost == "" {
+		if err := conf.ResolveAdvertiseHost(); err != nil {
+			problems = append(problems, err.Error())
+		} else {
+			l.Sources["advertise_host"] = "auto detected"
+		}
+	}
+	var dynamic *config.Dynamic
+	if conf.DynamicConf != "" {
+		config.DynamicConfFile = conf.DynamicConf
+		if err := config.ReloadDynamic(); err != nil {
+			problems = append(problems, "dynamic_conf: "+err.Error())
+		} else {
+			dynamic = config.GetDynamic()
+		}
+	}
+	if l.PrintOnly {
+		if err := l.Print(stdout, dynamic); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	for _, name := range config.UnknownEnv(environ) {
+		fmt.Fprintln(stderr, "warning: unknown env", name)
+	}
+	if len(problems) > 0 {
+		fmt.Fprintln(stderr, "invalid config:")
+		for _, p := range problems {
+			fmt.Fprintln(stderr, "  -", p)
+		}
+		return 1
+	}
+	if l.CheckOnly {
+		fmt.Fprintln(stdout, "config ok")
+	}
+	return 0
+}
+
+// 子命令version，构建信息在构建时注入，见gokit_foundation/buildinfo
+func printVersion(w io.Writer) {
+	info := buildinfo.Get()
+	fmt.Fprintf(w, "version: %s\ngit commit: %s\nbuild time: %s\ngo version: %s\n",
+		info.Version, info.GitCommit, info.BuildTime, info.GoVersion)
+}
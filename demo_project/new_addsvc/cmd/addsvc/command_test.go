@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"github.com/go-kit/kit/log"
+	"gokit_foundation"
+	"gokit_foundation/buildinfo"
+	"google.golang.org/grpc"
+	"io/ioutil"
+	"net"
+	"new_addsvc/config"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckHealth(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer()
+	gokit_foundation.RegisterGRPCHealthSrv(srv)
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	if err := checkHealth(lis.Addr().String(), time.Second); err != nil {
+		t.Errorf("want healthy, got err:%v", err)
+	}
+
+	// 找一个没有监听的端口
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := l.Addr().String()
+	l.Close()
+	if err := checkHealth(addr, time.Millisecond*300); err == nil {
+		t.Errorf("want unhealthy on %s", addr)
+	}
+}
+
+func TestPrintVersion(t *testing.T) {
+	buf := &bytes.Buffer{}
+	printVersion(buf)
+	if !strings.Contains(buf.String(), "version: "+buildinfo.Version) {
+		t.Errorf("got:%s", buf.String())
+	}
+}
+
+func TestRunUnknownCommand(t *testing.T) {
+	if code := runCommand([]string{"xxx"}); code != 2 {
+		t.Errorf("want exit code 2, got %d", code)
+	}
+}
+
+func TestPreflightPortInUse(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	_, port, _ := net.SplitHostPort(lis.Addr().String())
+	free, _ := net.Listen("tcp", "127.0.0.1:0")
+	_, httpPort, _ := net.SplitHostPort(free.Addr().String())
+	free.Close()
+
+	upgrader, err = gokit_foundation.NewUpgrader(log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf, err := config.LoadBootstrap([]string{"-listen.host", "127.0.0.1", "-grpc.port", port, "-http.port", httpPort, "-admin.port", "0"}, func(string) string { return "" }, ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = preflight(conf)
+	if err == nil || !strings.Contains(err.Error(), "grpc port: 127.0.0.1:"+port+" already in use") {
+		t.Errorf("want grpc port in use, got %v", err)
+	}
+	// 只有grpc端口失败
+	if e, ok := err.(*gokit_foundation.PreflightError); !ok || len(e.Failures) != 1 {
+		t.Errorf("want 1 failure, got %v", err)
+	}
+}
+
+func TestCheckConfig(t *testing.T) {
+	defer func(f string) { config.DynamicConfFile = f }(config.DynamicConfFile)
+	env := func(string) string { return "" }
+	test := []struct {
+		name       string
+		args       []string
+		wantCode   int
+		wantStdout string
+		wantStderr string
+	}{
+		{name: "[valid]", args: []string{"-validate-config", "-advertise.host", "10.0.0.1"}, wantCode: 0, wantStdout: "config ok"},
+		{name: "[invalid]", args: []string{"-validate-config", "-grpc.port", "8081", "-compress.level", "10"}, wantCode: 1,
+			wantStderr: "  - grpc_port and http_port must be different"},
+		{name: "[print]", args: []string{"-print-config", "-advertise.host", "10.0.0.1"}, wantCode: 0, wantStdout: `advertise_host: "10.0.0.1" # flag -advertise.host`},
+		{name: "[bad dynamic conf]", args: []string{"-validate-config", "-advertise.host", "10.0.0.1", "-dynamic.conf", "not_exist.yaml"}, wantCode: 1,
+			wantStderr: "dynamic_conf: "},
+	}
+	for _, tt := range test {
+		l, err := config.LoadConfig(tt.args, env, ioutil.Discard)
+		stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+		code := checkConfig(l, err, []string{"ADDSVC_GRPC_PROT=1"}, stdout, stderr)
+		if code != tt.wantCode || !strings.Contains(stdout.String(), tt.wantStdout) || !strings.Contains(stderr.String(), tt.wantStderr) {
+			t.Errorf("name:%s got code:%d stdout:%s stderr:%s", tt.name, code, stdout.String(), stderr.String())
+		}
+		if !strings.Contains(stderr.String(), "warning: unknown env ADDSVC_GRPC_PROT(did you mean ADDSVC_GRPC_PORT?)") {
+			t.Errorf("name:%s want unknown env warning, got stderr:%s", tt.name, stderr.String())
+		}
+	}
+}
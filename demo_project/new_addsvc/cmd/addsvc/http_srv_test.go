@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-kit/kit/log"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"go-util/_go"
+	"gokit_foundation"
+	"net/http"
+	"net/http/httptest"
+	"new_addsvc/config"
+	"new_addsvc/internal"
+	"new_addsvc/pkg/endpoint"
+	"new_addsvc/pkg/service"
+	"strings"
+	"testing"
+)
+
+func TestPprofHandler(t *testing.T) {
+	metricsObj = internal.NewMetrics(log.NewNopLogger())
+	defer func() { config.EnablePprof = false }()
+
+	for _, enable := range []bool{false, true} {
+		config.EnablePprof = enable
+		h := newHTTPHandler(http.NotFoundHandler())
+		for _, path := range []string{"/debug/pprof/", "/debug/pprof/cmdline", "/debug/pprof/heap"} {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+			want := http.StatusNotFound
+			if enable {
+				want = http.StatusOK
+			}
+			if w.Code != want {
+				t.Errorf("enable:%v path:%s got status:%d want:%d", enable, path, w.Code, want)
+			}
+		}
+		// metrics不受影响
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("enable:%v /metrics got status:%d", enable, w.Code)
+		}
+	}
+}
+
+func TestRateLimitHandler(t *testing.T) {
+	metricsObj = internal.NewMetrics(log.NewNopLogger())
+	eps := endpoint.New(service.NewBasicService(log.NewNopLogger()), log.NewNopLogger(), stdopentracing.NoopTracer{}, endpoint.Deps{})
+	for _, ep := range []func() error{
+		func() error { _, err := eps.Sum(context.Background(), 1, 2); return err },
+		func() error { _, err := eps.Concat(context.Background(), "a", "b"); return err },
+	} {
+		if err := ep(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	newAdminServer(_go.NewTaskGroup(), _go.NewCron(_go.CronMetrics{}), 8081).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ratelimit", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status:%d", w.Code)
+	}
+	var states map[string]endpoint.RateLimitState
+	if err := json.NewDecoder(w.Body).Decode(&states); err != nil {
+		t.Fatal(err)
+	}
+	// 默认配置见config.defDynamic
+	if st := states["Sum"]; st.Limit != 100 || st.Allowed != 1 {
+		t.Errorf("Sum state got:%+v", st)
+	}
+	if st := states["Concat"]; st.Limit != 50 || st.Allowed != 1 {
+		t.Errorf("Concat state got:%+v", st)
+	}
+}
+
+func TestHealthHandlers(t *testing.T) {
+	metricsObj = internal.NewMetrics(log.NewNopLogger())
+	healthSrv = &gokit_foundation.HealthCheckServer{}
+	defer func() { healthSrv = nil }()
+	healthSrv.AddChecker("test", func(context.Context) error { return nil })
+
+	get := func(path string) int {
+		w := httptest.NewRecorder()
+		newHTTPHandler(http.NotFoundHandler()).ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Code
+	}
+	if c1, c2 := get("/healthz"), get("/readyz"); c1 != http.StatusOK || c2 != http.StatusOK || ttlStatus(context.Background()) != nil {
+		t.Errorf("got healthz:%d readyz:%d", c1, c2)
+	}
+	// lame duck期间不再就绪，但仍然存活，consul TTL检查与readyz一致
+	healthSrv.SetServing(false)
+	if c1, c2 := get("/healthz"), get("/readyz"); c1 != http.StatusOK || c2 != http.StatusServiceUnavailable {
+		t.Errorf("got healthz:%d readyz:%d", c1, c2)
+	}
+	if err := ttlStatus(context.Background()); err == nil || err.Error() != "not serving" {
+		t.Errorf("got ttl status:%v", err)
+	}
+}
+
+// 管理接口只在管理端口上
+func TestAdminHandlers(t *testing.T) {
+	metricsObj = internal.NewMetrics(log.NewNopLogger())
+	httpHandler, adminSrv := newHTTPHandler(http.NotFoundHandler()), newAdminServer(_go.NewTaskGroup(), _go.NewCron(_go.CronMetrics{}), 8081)
+	for _, path := range []string{"/ratelimit", "/chaos", "/featureflags", "/payloadlog", "/tasks", "/loglevel", "/debug/runtime"} {
+		w := httptest.NewRecorder()
+		adminSrv.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("admin path:%s got status:%d", path, w.Code)
+		}
+		w = httptest.NewRecorder()
+		httpHandler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("http path:%s got status:%d", path, w.Code)
+		}
+	}
+}
+
+// 接口文档在http端口和管理端口上都有，管理端口上的server指向http端口
+func TestOpenAPIHandlers(t *testing.T) {
+	metricsObj = internal.NewMetrics(log.NewNopLogger())
+	var spec struct {
+		Paths   map[string]interface{} `json:"paths"`
+		Servers []struct {
+			URL string `json:"url"`
+		} `json:"servers"`
+	}
+	w := httptest.NewRecorder()
+	newHTTPHandler(http.NotFoundHandler()).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if err := json.Unmarshal(w.Body.Bytes(), &spec); err != nil || spec.Paths["/sum"] == nil || len(spec.Servers) != 0 {
+		t.Errorf("got err:%v body:%s", err, w.Body)
+	}
+
+	adminSrv := newAdminServer(_go.NewTaskGroup(), _go.NewCron(_go.CronMetrics{}), 8081)
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/openapi.json", nil)
+	r.Host = "10.0.0.1:8082"
+	adminSrv.ServeHTTP(w, r)
+	if err := json.Unmarshal(w.Body.Bytes(), &spec); err != nil || len(spec.Servers) != 1 || spec.Servers[0].URL != "http://10.0.0.1:8081" {
+		t.Errorf("got err:%v body:%s", err, w.Body)
+	}
+	w = httptest.NewRecorder()
+	adminSrv.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/swagger/", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "swagger-ui") {
+		t.Errorf("got code:%d body:%s", w.Code, w.Body)
+	}
+}
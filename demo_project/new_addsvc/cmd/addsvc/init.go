@@ -1,25 +1,330 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis"
 	"github.com/leigg-go/go-util/_redis"
+	"github.com/nats-io/nats.go"
+	"go-util/_go"
 	"gokit_foundation"
+	"gokit_foundation/mtls"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"net/http"
 	"new_addsvc/config"
 	"new_addsvc/pkg/crontask"
+	"new_addsvc/pkg/endpoint"
+	"strings"
 	"time"
 )
 
-// 短时间的初始化任务，这种不能用g.Add
-func initFirstly(grpcHost string, grpcPort int) {
+// 短时间的初始化任务，这种不能用g.Add，通过tg.Setup执行(MustInitDef的panic转为err)
+// lazy为true(lenient模式下启动探测时redis不可用)时只创建client不连接，go-redis每次调用时重新连接，
+// redis恢复之前相关的调用失败，由健康检查上报
+func initFirstly(lazy bool) error {
+	if lazy {
+		_redis.DefClient = redis.NewClient(config.GetRedisConf())
+		return nil
+	}
 	_redis.MustInitDef(config.GetRedisConf())
-	crontask.Init()
-	// 等一下，待所有内部服务准备就绪后再上线服务
-	// 1s表示所有内部服务需在1s内进入就绪状态，任何影响服务正常运行的错误都应该立即报错， 时间可根据完成具体初始化任务所需的时间来调整
-	time.AfterFunc(time.Second, func() {
-		gokit_foundation.MustRegisterSvc(config.SvcName, grpcHost, grpcPort, []string{"test"})
-	})
+	return nil
 }
+
+// 退出时的下线顺序见gokit_foundation.Drainer，在serve中创建
+var drainer *gokit_foundation.Drainer
+
 func onClose() {
-	gokit_foundation.ConsulDeregister() // 先下线
-	crontask.Stop()
-	_redis.Close()
+	// 先下线并等待client刷新实例列表，返回后各任务的clean才会停止grpc/http服务
+	// redis等依赖在所有任务退出后才关闭(见serve)，drain期间的请求仍可正常处理
+	_ = drainer.Drain()
+}
+
+// 使用consul TTL检查时每次心跳前调用，与grpc健康检查的结果一致：drain期间或依赖不可用时上报critical
+func ttlStatus(ctx context.Context) error {
+	status, results := healthSrv.Ready(ctx)
+	if status == grpc_health_v1.HealthCheckResponse_SERVING {
+		return nil
+	}
+	for name, err := range results {
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	return errors.New("not serving")
+}
+
+// 健康检查(grpc Check、/healthz、/readyz)依赖的检查，任一不可用时为NOT_SERVING
+// consul只在sd_backend为consul时检查，etcd/k8s由各自的机制保证
+func addHealthCheckers(hs *gokit_foundation.HealthCheckServer, sdBackend string) {
+	hs.AddChecker("redis", func(ctx context.Context) error {
+		return _redis.DefClient.WithContext(ctx).Ping().Err()
+	})
+	if sdBackend == gokit_foundation.SDBackendConsul {
+		hs.AddChecker("consul", gokit_foundation.ConsulChecker(""))
+	}
+}
+
+// 启动时探测的外部依赖，与serve上方注释中的强/弱依赖一致；prometheus是拉取的，不需要探测
+// SQS的consumer连不上时自己重试，不在这里声明
+func newDependencies(conf *config.Bootstrap) *gokit_foundation.Dependencies {
+	// 在initFirstly之前探测，使用临时的client
+	deps := gokit_foundation.NewDependencies(conf.DepsMode, logger).
+		Strong("redis", time.Second*2, func(ctx context.Context) error {
+			c := redis.NewClient(config.GetRedisConf())
+			defer c.Close()
+			return c.WithContext(ctx).Ping().Err()
+		})
+	switch conf.SDBackend {
+	case gokit_foundation.SDBackendConsul:
+		deps.Strong("consul", time.Second*3, gokit_foundation.ConsulChecker(""))
+	case gokit_foundation.SDBackendEtcd:
+		deps.Strong("etcd", time.Second*3, gokit_foundation.TCPDialChecker(conf.EtcdAddr))
+	}
+	if conf.NATSURL != "" {
+		deps.Strong("nats", time.Second*3, func(ctx context.Context) error {
+			nc, err := nats.Connect(conf.NATSURL, nats.Name(config.SvcName), nats.Timeout(time.Second*2))
+			if err != nil {
+				return err
+			}
+			nc.Close()
+			return nil
+		})
+	}
+	if conf.KafkaBrokers != "" {
+		deps.Weak("kafka", time.Second*3, gokit_foundation.TCPDialChecker(conf.KafkaBrokerList()...))
+	}
+	if conf.MetricsPush.Enabled() {
+		deps.Weak("pushgateway", time.Second*3, pushgatewayChecker(conf.MetricsPush.URL))
+	}
+	return deps
+}
+
+// pushgateway的健康检查接口
+func pushgatewayChecker(url string) gokit_foundation.HealthChecker {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(url, "/")+"/-/healthy", nil)
+		if err != nil {
+			return err
+		}
+		rsp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		rsp.Body.Close()
+		if rsp.StatusCode != http.StatusOK {
+			return fmt.Errorf("status %d", rsp.StatusCode)
+		}
+		return nil
+	}
+}
+
+// 添加后台任务：在后台重试启动时不可用的弱依赖(lenient模式下包括强依赖)，恢复时打印日志，全部恢复后任务正常结束
+// 重试期间服务照常运行，依赖是否可用仍以健康检查为准
+func addTaskDependencies(tg *_go.TaskGroup, deps *gokit_foundation.Dependencies) {
+	if len(deps.Unavailable()) == 0 {
+		return
+	}
+	tg.Add(deps.RetryFailed).Name("dependencies").Interrupt(func(err error) {
+		logger.Log("dependenciesTask", "exited", "clean", err, "unavailable", strings.Join(deps.Unavailable(), ","))
+	})
+}
+
+// 加载可热更新的配置并使其生效，启动时以及onReload中调用
+func loadDynamic() error {
+	err := config.ReloadDynamic()
+	if err == nil {
+		err = gokit_foundation.SetLogLevel(config.GetDynamic().LogLevel)
+	}
+	if err == nil {
+		err = endpoint.DefaultChaos.Set(config.GetDynamic().GetChaos())
+	}
+	if err == nil {
+		err = endpoint.DefaultFlags.Set(config.GetDynamic().FeatureFlags)
+	}
+	return err
+}
+
+// 收到SIGHUP信号、配置文件或consul KV变化时调用，重新加载可热更新的配置
+func onReload() {
+	err := loadDynamic()
+	logger.Log("onReload", "config.ReloadDynamic", "conf", fmt.Sprintf("%+v", *config.GetDynamic()), "err", err)
+}
+
+// 添加后台任务：监听可热更新的配置文件，变化时重新加载(与SIGHUP的效果相同)
+// 监听失败不影响服务运行，只打印日志，仍可以通过SIGHUP重新加载
+func addTaskWatchDynamic(tg *_go.TaskGroup) {
+	tg.Add(func(ctx context.Context) error {
+		if err := config.WatchDynamic(ctx, logger, time.Millisecond*100, onReload); err != nil {
+			logger.Log("watchDynamicTask", "watch failed, reload on SIGHUP only", "err", err)
+			<-ctx.Done()
+		}
+		return nil
+	}).Name("watchDynamic").Interrupt(func(err error) {
+		logger.Log("watchDynamicTask", "exited", "clean", err)
+	})
+}
+
+// 读取consul KV中prefix下可热更新的配置，之后ReloadDynamic(包括SIGHUP)都从最新的快照加载
+func loadDynamicKV(prefix string) (*gokit_foundation.ConsulKVWatcher, error) {
+	w, err := gokit_foundation.NewConsulKVWatcher(prefix, logger)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	kv, err := w.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	config.SetDynamicKV(kv)
+	return w, nil
+}
+
+// 添加后台任务：监听consul KV中可热更新的配置，变化时重新加载(与SIGHUP的效果相同)
+// consul不可用时Watch内部重试，已生效的配置保持不变
+func addTaskWatchDynamicKV(tg *_go.TaskGroup, w *gokit_foundation.ConsulKVWatcher) {
+	tg.Add(func(ctx context.Context) error {
+		return w.Watch(ctx, func(kv map[string][]byte) {
+			config.SetDynamicKV(kv)
+			onReload()
+		})
+	}).Name("watchDynamicKV").Interrupt(func(err error) {
+		logger.Log("watchDynamicKVTask", "exited", "clean", err)
+	})
+}
+
+// 添加后台任务：定期检查grpc server的证书文件，更新(如证书轮换)后重新加载，新连接使用新证书
+func addTaskTLSReload(tg *_go.TaskGroup, r *mtls.Reloader, interval time.Duration) {
+	tg.Add(func(ctx context.Context) error {
+		return r.Watch(ctx, interval)
+	}).Name("tlsReload").Interrupt(func(err error) {
+		logger.Log("tlsReloadTask", "exited", "clean", err)
+	})
+}
+
+// 添加后台任务：定期检查错误描述翻译目录，文件更新后重新加载，修改翻译不需要重启
+func addTaskI18nReload(tg *_go.TaskGroup, interval time.Duration) {
+	tg.Add(func(ctx context.Context) error {
+		return endpoint.DefaultMessages.Watch(ctx, interval, logger)
+	}).Name("i18nReload").Interrupt(func(err error) {
+		logger.Log("i18nReloadTask", "exited", "clean", err)
+	})
+}
+
+// 添加后台任务：注册服务到consul/etcd(见config.Bootstrap.SDBackend)，之后定期检查注册信息，丢失(如consul agent重启、etcd lease过期)时重新注册
+// 注册失败时服务不可被发现，重试仍失败则返回err使得TaskGroup回滚(GracefulStop等)
+// 注销在onClose中完成(见Drainer.Drain)，所以这里的clean不需要做什么
+// 需要在tg.Stage()之后添加，等grpc/http服务开始监听后再注册
+func addTaskSvcRegister(tg *_go.TaskGroup, grpcHost string, grpcPort int) {
+	svcRegisterTask := func(ctx context.Context) error {
+		logger.Log("svcRegisterTask", "register", "advertiseHost", grpcHost, "grpcPort", grpcPort)
+		if err := registry.Register(config.SvcName, grpcHost, grpcPort, []string{"test"}); err != nil {
+			return err
+		}
+		_go.TaskReady(ctx)
+		return registry.KeepRegistered(ctx, logger, time.Second*10, time.Second)
+	}
+	// 注册中心短暂不可用时按退避重试注册，连续失败5次才停止整个服务
+	tg.Add(svcRegisterTask).Name("svcRegister").WaitReady().Restart(_go.RestartPolicy{
+		MaxFailures: 5,
+		MinBackoff:  time.Second,
+		MaxBackoff:  time.Second * 10,
+		ResetAfter:  time.Minute,
+		OnFailure: func(err error, failures int, willRestart bool) {
+			logger.Log("svcRegisterTask", "failed", "err", err, "failures", failures, "restart", willRestart)
+		},
+	}).Interrupt(func(err error) {
+		logger.Log("svcRegisterTask", "exited", "clean", err)
+	})
+}
+
+// 添加后台任务：服务开始监听后预热(见gokit_foundation.Warmup)：预先建立redis连接、预热Concat缓存，
+// 设置了warmup_requests时经过完整的endpoint中间件自己调用Sum、Concat(计入监控和访问日志，开启认证时会被拒绝，只记录日志)
+// 预热期间健康检查为NOT_SERVING(k8s的readinessProbe同样等待，平滑升级时除外)，结束后才就绪，之后的阶段(注册到consul/etcd)才开始；
+// 预热失败或超时不影响启动。需要在tg.Stage()之后添加，等grpc/http服务开始监听
+func addTaskWarmup(tg *_go.TaskGroup, conf *config.Bootstrap, endpoints endpoint.AddSvcEndpoints) {
+	w := gokit_foundation.NewWarmup(logger, conf.WarmupTimeout)
+	if conf.WarmupConns > 0 {
+		w.Add("redis pool", gokit_foundation.WarmupParallel(conf.WarmupConns, func(ctx context.Context) error {
+			return _redis.DefClient.WithContext(ctx).Ping().Err()
+		}))
+	}
+	if args := config.GetCacheWarmConcat(); len(args) > 0 {
+		w.Add("cache", crontask.WarmCache(endpoints, args))
+	}
+	if conf.WarmupRequests > 0 {
+		w.Add("self requests", gokit_foundation.WarmupRepeat(conf.WarmupRequests, func(ctx context.Context) error {
+			if _, err := endpoints.Sum(ctx, 1, 2); err != nil {
+				return fmt.Errorf("sum: %v", err)
+			}
+			if _, err := endpoints.Concat(ctx, "warm", "up"); err != nil {
+				return fmt.Errorf("concat: %v", err)
+			}
+			return nil
+		}))
+	}
+	if w.Len() == 0 {
+		return
+	}
+	// 平滑升级时监听与旧进程共用，旧进程仍在处理请求，健康检查不能因为新进程预热而失败
+	if !upgrader.Inherited() {
+		healthSrv.SetWarmingUp(true)
+	}
+	warmupTask := func(ctx context.Context) error {
+		w.Run(ctx)
+		healthSrv.SetWarmingUp(false)
+		_go.TaskReady(ctx)
+		return nil
+	}
+	tg.Add(warmupTask).Name("warmup").WaitReady().Interrupt(func(err error) {
+		logger.Log("warmupTask", "exited", "clean", err)
+	})
+}
+
+// 添加后台任务：在consul/etcd上竞选定时任务的leader(见gokit_foundation.Leadership)，返回本实例当前是否为leader
+// 竞选出错时只打印日志并重试，期间不是leader，只需要一个实例执行的job都不执行；退出时放弃leader，其他实例立即当选
+// 创建elector失败时任务组不会启动(见TaskGroup.Setup)，返回nil
+func addTaskLeader(tg *_go.TaskGroup, sdBackend string) func() bool {
+	var elector gokit_foundation.Elector
+	if !tg.Setup("leader", func() (err error) {
+		elector, err = gokit_foundation.NewElector(sdBackend, config.SvcName+"/cron")
+		return
+	}) {
+		return nil
+	}
+	leadership := gokit_foundation.NewLeadership(elector, logger, metricsObj.Leader)
+	tg.Add(leadership.Run).Name("leader").Interrupt(func(err error) {
+		logger.Log("leaderTask", "exited", "clean", err)
+	})
+	return leadership.IsLeader
+}
+
+// 添加后台任务：平滑升级启动的新进程以权重1注册(见serve)，warmup后恢复为weight，设置失败时每10s重试
+// 需要在svcRegister之后的阶段添加，不等它就绪，不影响启动完成(旧进程退出)
+func addTaskConsulWarmup(tg *_go.TaskGroup, warmup time.Duration, weight int) {
+	consulWarmupTask := func(ctx context.Context) error {
+		timer := time.NewTimer(warmup)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-timer.C:
+		}
+		for {
+			err := gokit_foundation.ConsulSetWeight(weight)
+			logger.Log("consulWarmupTask", "set weight", "weight", weight, "err", err)
+			if err == nil {
+				return nil
+			}
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(time.Second * 10):
+			}
+		}
+	}
+	tg.Add(consulWarmupTask).Name("consulWarmup").Interrupt(func(err error) {
+		logger.Log("consulWarmupTask", "exited", "clean", err)
+	})
 }
@@ -2,149 +2,868 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/sqs"
 	"github.com/go-kit/kit/log"
-	kitgrpc "github.com/go-kit/kit/transport/grpc"
 	"github.com/leigg-go/go-util/_redis"
+	"github.com/nats-io/nats.go"
 	stdopentracing "github.com/opentracing/opentracing-go"
 	"go-util/_go"
 	"go-util/_util"
 	"gokit_foundation"
+	"gokit_foundation/blobstore"
+	"gokit_foundation/buildinfo"
+	"gokit_foundation/cache"
+	"gokit_foundation/dedup"
+	"gokit_foundation/errs"
+	"gokit_foundation/events"
+	"gokit_foundation/idempotency"
+	"gokit_foundation/journal"
+	"gokit_foundation/logging"
+	"gokit_foundation/mesh"
+	"gokit_foundation/metricspush"
+	"gokit_foundation/metricsx"
+	"gokit_foundation/mtls"
+	"gokit_foundation/openapi"
+	"gokit_foundation/otel"
+	"gokit_foundation/propagation"
+	"gokit_foundation/reqid"
+	"gokit_foundation/resguard"
+	"gokit_foundation/sqstransport"
+	"gokit_foundation/tracing"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/test/bufconn"
+	"io"
 	"net"
 	"net/http"
+	"net/http/pprof"
+	"new_addsvc/config"
 	"new_addsvc/internal"
 	"new_addsvc/pb/gen-go/addsvcpb"
+	"new_addsvc/pb/gen-go/addsvcthrift"
+	"new_addsvc/pb/gen-go/addsvcv2pb"
+	"new_addsvc/pb/gen-go/blobpb"
+	"new_addsvc/pkg/crontask"
 	"new_addsvc/pkg/endpoint"
 	"new_addsvc/pkg/service"
 	"new_addsvc/pkg/transport"
 	"os"
+	"strconv"
 	"time"
 )
 
-func NewAddSrv(logger log.Logger) addsvcpb.AddServer {
-	metricsObj := internal.NewMetrics()
-	tracer := stdopentracing.GlobalTracer()
-
+// eventPub为nil时不发布领域事件，guard为nil时不因资源超限拒绝请求
+// 返回v1和v2两个版本的endpoints，共用同一个service(见endpoint.NewV2)
+func NewAddEndpoints(logger log.Logger, metricsObj *internal.Metrics, tracer stdopentracing.Tracer, eventPub events.Publisher, guard *resguard.Guard) (endpoint.AddSvcEndpoints, endpoint.AddSvcV2Endpoints) {
 	// 依次创建 svc，endpoint，transport三层的对象，每一层都会在上一层基础上封装
 	// 在svc和endpoint层以中间件的形式添加【指标上传、api日志】功能
+	// grpc和http两个transport共用这里创建的endpoints，所以限流等中间件的状态也是共用的
 
 	// service需要的所有对象都通过New传入
-	svc := service.New(logger, _redis.DefClient, metricsObj.Ints, metricsObj.Chars)
-	// 在endpoint层和transport层添加路径追踪功能
-	endpoints := endpoint.New(svc, logger, metricsObj.Duration, tracer)
-	addSrv := transport.NewGRPCServer(endpoints, tracer, logger)
-	return addSrv
-}
-
-// for test
-func init() {
-	// 配置consul服务地址，必须是一个有效的consul地址
-	os.Setenv("CONSUL_ADDR", "localhost:8500")
+	svc := service.New(logger, _redis.DefClient, metricsObj.Ints, metricsObj.Chars, eventPub)
+	// 在endpoint层和transport层添加路径追踪功能，幂等接口的response缓存在redis中(见config.GetCacheTTLs)
+	deps := endpoint.Deps{
+		Duration:         metricsObj.Duration,
+		BreakerState:     metricsObj.BreakerState,
+		CacheStore:       cache.NewRedisStore(_redis.DefClient),
+		CacheLookups:     metricsObj.CacheLookups,
+		Panics:           metricsObj.Panics,
+		DeadlineExceeded: metricsObj.DeadlineExceeded,
+		LoadShed:         metricsObj.LoadShed,
+		LoadShedLoad:     metricsObj.LoadShedLoad,
+		ResGuard:         guard,
+	}
+	return endpoint.New(svc, logger, tracer, deps), endpoint.NewV2(svc, logger, tracer, deps)
 }
 
 /*
-new_addsvc服务依赖了一些外部中间件如下：
+new_addsvc服务依赖了一些外部中间件如下(启动时的探测见newDependencies，-deps.mode lenient时强依赖同样只打印日志并在后台重试)：
 -	强依赖(若连不上则无法启动)
-	-	consul
+	-	consul(或etcd，见-sd.backend)
 	-	redis
--	弱依赖(不需要连接或连不上也能启动)
+-	弱依赖(不需要连接或连不上也能启动，在后台重试直到可用)
 	-	prometheus
+	-	kafka(见-kafka.brokers)，不可用时领域事件丢失，不影响接口调用
+	-	pushgateway(见-metrics.push.url)
+-	可选(配置了才连接，连不上则无法启动)
+	-	nats(见-nats.url)
+	-	SQS(见-sqs.queue.url)，连不上时只记录日志并重试，不影响启动
 */
 
 var (
-	grpcSrv *grpc.Server
-	httpSrv *http.Server
-	logger  log.Logger
+	grpcSrv    *grpc.Server
+	healthSrv  *gokit_foundation.HealthCheckServer
+	registry   gokit_foundation.Registry
+	httpSrv    *gokit_foundation.HTTPServer
+	logger     log.Logger
+	metricsObj *internal.Metrics
+	// 所有服务的监听都通过它创建，收到SIGUSR2时交给新进程(见addTaskListenSignal)
+	upgrader *gokit_foundation.Upgrader
+	// goroutine数、fd数、内存超过软上限时拒绝请求、打印goroutine堆栈或平滑重启(见addTaskResourceGuard)
+	resGuard *resguard.Guard
 )
 
-func main() {
-	// 服务运行的主机地址，必须能够被你的consul-server访问，否则consul的健康检查会失败
-	srvHost := "127.0.0.1"
-	var grpcPort = flag.Int("grpc.port", 8080, "grpc listen address")
-	var httpPort = flag.Int("http.port", 8081, "http listen address")
-
-	grpcSrvAddr := fmt.Sprintf("%s:%d", srvHost, *grpcPort)
-	httpSrvAddr := fmt.Sprintf("%s:%d", srvHost, *httpPort)
-
-	flag.Parse()
-	logger = gokit_foundation.NewKvLogger(nil)
+// 子命令serve：启动服务
+func serve(args []string) int {
+	// 启动配置的来源和优先级见config.Bootstrap
+	l, err := config.LoadConfig(args, os.Getenv, os.Stderr)
+	if err == flag.ErrHelp {
+		return 0
+	}
+	// -validate-config、-print-config不启动服务
+	if l != nil && (l.CheckOnly || l.PrintOnly) {
+		return checkConfig(l, err, os.Environ(), os.Stdout, os.Stderr)
+	}
+	var conf *config.Bootstrap
+	if err == nil {
+		conf = l.Bootstrap
+		err = conf.ResolveAdvertiseHost()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	config.EnablePprof = conf.Pprof
+	if conf.Mesh {
+		propagation.Fields = append(propagation.Fields, mesh.Field)
+	}
+	// transport层按服务名取得错误映射，见transport.errMapper
+	errs.Register(config.SvcName, conf.ErrorMapper())
+	config.DynamicConfFile = conf.DynamicConf
+	gokit_foundation.ConsulAddr = conf.ConsulAddr
+	gokit_foundation.EtcdAddr = conf.EtcdAddr
+	registry, _ = gokit_foundation.NewRegistry(conf.SDBackend) // backend已在LoadBootstrap中校验
+	grpcSrvAddr := net.JoinHostPort(conf.ListenHost, strconv.Itoa(conf.GRPCPort))
+	httpSrvAddr := net.JoinHostPort(conf.ListenHost, strconv.Itoa(conf.HTTPPort))
 
-	grpcSrv = grpc.NewServer(grpc.UnaryInterceptor(kitgrpc.Interceptor))
-	httpSrv = &http.Server{}
+	logger = gokit_foundation.NewKvLoggerWithOptions(os.Stdout, conf.LogOptions())
+	// 注册需要写入日志的ctx字段，中间件中通过LoggerWithContext取得带这些字段的logger
+	gokit_foundation.RegisterLogContextKey("request_id", gokit_foundation.CtxKeyRequestID)
+	gokit_foundation.RegisterLogContextKey("trace_id", gokit_foundation.CtxKeyTraceID)
+	gokit_foundation.RegisterLogContextKey("tenant", gokit_foundation.CtxKeyTenant)
+	// 没有经过endpoint的调用(如后台任务)通过logging.FromContext取得的logger
+	logging.Default = logger
+	logger.Log(append([]interface{}{"main", "starting"}, buildinfo.Keyvals()...)...)
 
 	/*
 		这里使用 TaskGroup 完成程序的多任务同时启动，同时退出
 		在实际项目中可以参考其思路，自行实现
 	*/
 
-	// 初始化一个TaskGroup对象
+	// 初始化一个TaskGroup对象，添加任务之前的准备步骤通过tg.Setup执行，失败时不启动任何任务，由tg.Err报告是哪一步失败
 	tg := _go.NewTaskGroup()
+	// 由旧进程平滑升级启动时继承它的监听
+	if !tg.Setup("upgrader", func() (err error) { upgrader, err = gokit_foundation.NewUpgrader(logger); return }) {
+		return setupFailed(tg)
+	}
+	// 端口、consul可达性等问题在启动任何服务之前一次性报出来
+	if err = preflight(conf); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	// 并发探测所有依赖，在连接任何依赖(consul KV、redis等)之前执行，严格模式下有强依赖不可用时汇总报告后退出，
+	// 其余不可用的依赖在后台重试(见addTaskDependencies)
+	deps := newDependencies(conf)
+	if _, err = deps.Check(context.Background()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	redisDown := false
+	for _, name := range deps.Unavailable() {
+		redisDown = redisDown || name == "redis"
+	}
+	// 配置了dynamic.consul时从consul KV读取可热更新的配置，读取失败时不启动
+	var kvWatcher *gokit_foundation.ConsulKVWatcher
+	if conf.DynamicConsul != "" {
+		if !tg.Setup("dynamic consul", func() (err error) { kvWatcher, err = loadDynamicKV(conf.DynamicConsul); return }) {
+			return setupFailed(tg)
+		}
+	}
+	if !tg.Setup("dynamic config", loadDynamic) {
+		return setupFailed(tg)
+	}
 
-	addTaskListenSignal(tg)
-	initFirstly(srvHost, *grpcPort)
+	// 新进程的redis连接、缓存都是冷的，先以权重1注册，UpgradeWarmup后恢复(见addTaskConsulWarmup)
+	warmup := upgrader.Inherited() && conf.UpgradeWarmup > 0 && conf.SDBackend == gokit_foundation.SDBackendConsul && conf.ConsulWeight > 1
+
+	// 指标后端为otlp时创建exporter，collector地址无法解析时不启动
+	var metricsProvider metricsx.Provider
+	if !tg.Setup("metrics", func() (err error) { metricsProvider, err = metricsx.New(conf.Metrics, config.SvcName, logger); return }) {
+		return setupFailed(tg)
+	}
+	metricsObj = internal.NewMetricsWith(metricsProvider, logger)
+	if conf.SDBackend == gokit_foundation.SDBackendConsul {
+		opts := conf.ConsulRegisterOptions(buildinfo.Version)
+		opts.TTLStatus, opts.Reregistrations = ttlStatus, metricsObj.ConsulReregistrations
+		if warmup {
+			opts.Weight = 1
+		}
+		registry = gokit_foundation.NewConsulRegistry(opts)
+	}
+	// 设置了OTEL_EXPORTER_OTLP_ENDPOINT时启用OpenTelemetry，与opentracing并存
+	var otelShutdown func(context.Context) error
+	if !tg.Setup("otel", func() (err error) { otelShutdown, err = otel.Setup(config.SvcName, logger); return }) {
+		return setupFailed(tg)
+	}
+
+	// 配置了tls.cert时grpc server启用TLS(设置了tls.client.ca时为mTLS)，证书文件更新后自动重新加载
+	var (
+		tlsReloader *mtls.Reloader
+		grpcCreds   credentials.TransportCredentials
+	)
+	if conf.TLSEnabled() {
+		if !tg.Setup("tls", func() (err error) { tlsReloader, err = mtls.NewReloader(conf.TLSConfig(), true, logger); return }) {
+			return setupFailed(tg)
+		}
+		grpcCreds = tlsReloader.ServerCredentials()
+		gokit_foundation.ConsulCheckTLS = true
+	}
+
+	// 注册了gzip编码，client启用gzip时请求和响应都压缩，见gokit_foundation.SetGRPCGzipLevel
+	if !tg.Setup("grpc gzip", func() error { return gokit_foundation.SetGRPCGzipLevel(conf.GzipLevel()) }) {
+		return setupFailed(tg)
+	}
+	// 拦截器在链中的位置由Stage决定，见gokit_foundation.GRPCServerBuilder
+	grpcSrv = gokit_foundation.NewGRPCServerBuilder(conf.GRPC).
+		Creds(grpcCreds).
+		Options(grpc.StatsHandler(gokit_foundation.NewGRPCCompressionStatsHandler(metricsObj.PayloadBytes.With("transport", "grpc")))).
+		Unary(gokit_foundation.StageRecovery, gokit_foundation.RecoveryUnaryInterceptor(logger, metricsObj.Panics)).
+		Stream(gokit_foundation.StageRecovery, gokit_foundation.RecoveryStreamInterceptor(logger, metricsObj.Panics)).
+		Unary(gokit_foundation.StageRequestID, reqid.UnaryServerInterceptor()).
+		Unary(gokit_foundation.StageMetrics, metricsObj.GRPC.UnaryServerInterceptor()).
+		Stream(gokit_foundation.StageMetrics, metricsObj.GRPC.StreamServerInterceptor()).
+		Unary(gokit_foundation.StageLogging, gokit_foundation.AccessLogUnaryInterceptor(logger)).
+		Build()
+	// 健康检查服务在启动前注册，退出时(onClose)需要先将其置为NOT_SERVING
+	healthSrv = gokit_foundation.RegisterGRPCHealthSrv(grpcSrv)
+	addHealthCheckers(healthSrv, conf.SDBackend)
+	// grpcurl -plaintext 127.0.0.1:8080 list，reflection只暴露接口定义，与其他接口一样受TLS保护
+	if conf.GRPCReflection {
+		reflection.Register(grpcSrv)
+	}
+	drainer = &gokit_foundation.Drainer{
+		Logger: logger,
+		Health: healthSrv,
+		// 注销失败会重试几次
+		Deregister: func() error {
+			return gokit_foundation.DeregisterWithRetry(registry, logger, 2, time.Millisecond*200)
+		},
+		DrainPeriod: conf.LameDuck,
+		StopTimeout: conf.StopTimeout,
+	}
+
+	// 定时任务在endpoints创建后添加(见crontask.Add)，管理端口先注册/cron
+	cronJobs := _go.NewCron(metricsObj.Cron)
+
+	addTaskListenSignal(tg, conf.PreStopDelay, conf.UpgradeTimeout)
+	resGuard = resguard.New(endpoint.DynamicResourceGuard, logger, restartBySignal, metricsObj.ResGuard)
+	addTaskResourceGuard(tg)
+	if conf.AdminPort != 0 {
+		addTaskAdminSrv(tg, cronJobs, net.JoinHostPort(conf.ListenHost, strconv.Itoa(conf.AdminPort)), conf.HTTPPort)
+	}
+	if conf.MetricsPush.Enabled() {
+		addTaskMetricsPush(tg, conf.MetricsPushConfig())
+	}
+	if p := metricsObj.Pusher(); p != nil {
+		addTaskMetricsSend(tg, p, conf.Metrics.Backend)
+	}
+	if conf.MetricsBuffer > 0 {
+		addTaskMetricsFlush(tg, conf.MetricsBuffer)
+	}
+	if config.DynamicConfFile != "" {
+		addTaskWatchDynamic(tg)
+	}
+	if kvWatcher != nil {
+		addTaskWatchDynamicKV(tg, kvWatcher)
+	}
+	if tlsReloader != nil {
+		addTaskTLSReload(tg, tlsReloader, conf.TLSReload)
+	}
+	if conf.I18nDir != "" {
+		if !tg.Setup("i18n", func() error { return endpoint.DefaultMessages.LoadDir(conf.I18nDir) }) {
+			return setupFailed(tg)
+		}
+		addTaskI18nReload(tg, conf.I18nReload)
+	}
+	var eventPub events.Publisher
+	if conf.KafkaBrokers != "" {
+		eventPub = addTaskEvents(tg, conf)
+	}
+	if !tg.Setup("redis", func() error { return initFirstly(redisDown) }) {
+		return setupFailed(tg)
+	}
+	addTaskDependencies(tg, deps)
+
+	// 按tracing.backend选择jaeger、zipkin或otlp，所选后端未配置上报地址时为NoopTracer
+	conf.Tracing.Zipkin.LocalAddr = net.JoinHostPort(conf.AdvertiseHost, strconv.Itoa(conf.GRPCPort))
+	var (
+		tracer       stdopentracing.Tracer
+		tracerCloser io.Closer
+	)
+	if !tg.Setup("tracing", func() (err error) {
+		tracer, tracerCloser, err = tracing.New(config.SvcName, conf.Tracing, logger)
+		return
+	}) {
+		return setupFailed(tg)
+	}
+	stdopentracing.SetGlobalTracer(tracer)
+	endpoints, endpointsV2 := NewAddEndpoints(logger, metricsObj, tracer, eventPub, resGuard)
+
+	// 访问日志跳过prometheus定时拉取的/metrics以及健康检查
+	// 压缩跳过/metrics(prometheus自己处理压缩)以及/debug/pprof/(profile本身已经是gzip格式)
+	apiHandler := transport.NewHTTPHandler(endpoints, tracer, logger)
+	// v2的grpc服务与v1注册在同一个grpc server上，http挂在/v2/下
+	addsvcv2pb.RegisterAddServer(grpcSrv, transport.NewGRPCServerV2(endpointsV2, tracer, logger))
+	{
+		mux := http.NewServeMux()
+		mux.Handle("/", apiHandler)
+		mux.Handle("/v2/", transport.NewHTTPHandlerV2(endpointsV2, tracer, logger))
+		apiHandler = mux
+	}
+	// 配置了-blob.dir或-blob.s3.bucket时提供上传接口，grpc服务在Serve之前注册，http挂在/blobs/下
+	if conf.BlobEnabled() {
+		var store blobstore.Store
+		if !tg.Setup("blob store", func() (err error) { store, err = newBlobStore(conf); return }) {
+			return setupFailed(tg)
+		}
+		blobSvc := service.NewBlobService(blobstore.NewUploader(store, conf.BlobMaxSize, metricsObj.Blob))
+		blobEndpoints := endpoint.NewBlobEndpoints(blobSvc, logger, metricsObj.Duration, tracer, metricsObj.Panics)
+		blobpb.RegisterBlobServer(grpcSrv, transport.NewBlobServer(blobEndpoints, tracer, logger))
+		mux := http.NewServeMux()
+		mux.Handle("/", apiHandler)
+		mux.Handle(transport.BlobPathPrefix, transport.NewHTTPUploadHandler(blobEndpoints, tracer, logger))
+		apiHandler = mux
+	}
+	var gatewayLis *bufconn.Listener
+	if conf.GRPCGateway {
+		gatewayLis = bufconn.Listen(1024 * 1024)
+		if !tg.Setup("grpc gateway", func() (err error) { apiHandler, err = newGRPCGatewayHandler(apiHandler, gatewayLis); return }) {
+			return setupFailed(tg)
+		}
+	}
+	httpHandler := newHTTPHandler(apiHandler)
+	compressMin := conf.CompressMin
+	if compressMin == 0 {
+		compressMin = transport.DefaultCompressMinSize
+	}
+	httpHandler = transport.CompressMiddleware(compressMin, conf.GzipLevel(), metricsObj.PayloadBytes.With("transport", "http"),
+		"/metrics", "/debug/pprof/")(httpHandler)
+	// recovery在访问日志内层，panic的请求也会以500记录
+	httpHandler = gokit_foundation.RecoveryHTTPHandler(logger, metricsObj.Panics)(httpHandler)
+	httpHandler = gokit_foundation.AccessLogHandler(logger, "/metrics", "/healthz", "/readyz")(httpHandler)
+	// request id在访问日志外层写入ctx，访问日志和业务日志都带上request_id
+	httpSrv = gokit_foundation.NewHTTPServer(reqid.HTTPMiddleware(httpHandler), conf.HTTP)
 
 	addTaskHttpSrv(tg, httpSrvAddr)
-	addTaskGRPCSrv(tg, grpcSrvAddr)
+	addTaskGRPCSrv(tg, grpcSrvAddr, transport.NewGRPCServer(endpoints, tracer, logger))
+	// grpc-web使用同一个grpc server(拦截器相同)，在grpc任务之后添加，请求到来时服务已注册
+	if conf.GRPCWebPort != 0 {
+		addTaskGRPCWebSrv(tg, net.JoinHostPort(conf.ListenHost, strconv.Itoa(conf.GRPCWebPort)), conf.GRPCWebConfig(), conf.HTTP)
+	}
+	if conf.ThriftPort != 0 {
+		addTaskThriftSrv(tg, net.JoinHostPort(conf.ListenHost, strconv.Itoa(conf.ThriftPort)), endpoints, conf.StopTimeout)
+	}
+	if conf.NATSURL != "" {
+		addTaskNATS(tg, conf, endpoints)
+	}
+	if conf.SQSQueueURL != "" {
+		addTaskSQS(tg, conf, endpoints)
+	}
+	// grpc server注册服务之后才能Serve，所以在grpc任务就绪之后
+	if gatewayLis != nil {
+		addTaskGRPCGateway(tg.Stage(), gatewayLis)
+	}
+	// 阶段屏障：grpc/http服务开始监听(TaskReady)后再预热，预热结束后才注册到consul/etcd，避免consul健康检查失败、client连不上或最初的请求变慢
+	if conf.WarmupTimeout > 0 {
+		addTaskWarmup(tg.Stage(), conf, endpoints)
+	}
+	addTaskSvcRegister(tg.Stage(), conf.AdvertiseHost, conf.GRPCPort)
+	if warmup {
+		addTaskConsulWarmup(tg.Stage(), conf.UpgradeWarmup, conf.ConsulWeight)
+	}
+	// 注册之后再竞选leader、开始执行定时任务，consul自检需要已注册；k8s没有选主，job在每个实例上执行
+	afterRegister := tg.Stage()
+	var isLeader func() bool
+	if conf.SDBackend == gokit_foundation.SDBackendConsul || conf.SDBackend == gokit_foundation.SDBackendEtcd {
+		isLeader = addTaskLeader(afterRegister, conf.SDBackend)
+	}
+	if !tg.Setup("cron", func() error {
+		return crontask.Add(cronJobs, endpoints, conf.SDBackend == gokit_foundation.SDBackendConsul, isLeader, logger)
+	}) {
+		return setupFailed(tg)
+	}
+	cronJobs.AddTo(afterRegister)
 
+	// 所有任务就绪(服务开始监听并注册到consul/etcd)后才算启动完成，在此之前任一任务失败都会回滚(执行所有clean)
+	// 由平滑升级启动时通知旧进程退出
+	tg.OnReady(func() {
+		logger.Log("main", "all tasks ready", "upgrade_ready", upgrader.Ready())
+	})
 	logger.Log("main", "started")
 	tg.Run()
+	// 所有任务退出后再关闭，保证服务停止前产生的span全部导出
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+	logger.Log("main", "otel shutdown", "err", otelShutdown(shutdownCtx))
+	cancel()
+	logger.Log("main", "tracer close", "err", tracerCloser.Close())
+	// grpc/http服务停止后再关闭依赖，避免drain期间以及进行中的请求访问已关闭的连接
+	_redis.Close()
+	if err := tg.Err(); err != nil {
+		logger.Log("main", "startup failed", "err", err)
+		return 1
+	}
+	return 0
+}
+
+// 准备步骤失败，还没有任务启动，不需要回滚
+func setupFailed(tg *_go.TaskGroup) int {
+	logger.Log("main", "startup failed", "err", tg.Err())
+	return 1
+}
+
+// 添加后台任务：监听退出信号（第一个添加），SIGQUIT(kill -3)打印goroutine堆栈到stderr，不退出
+// SIGUSR1(kill -USR1)打印构建和运行时信息到stderr，不退出(见buildinfo.Dump)
+// SIGUSR2(kill -USR2)平滑升级：以相同的参数启动新的可执行文件并交出监听，新进程在upgradeTimeout内就绪后本进程停止服务并退出，
+// 不下线也不注销(实例地址不变)；新进程启动失败时继续服务
+func addTaskListenSignal(tg *_go.TaskGroup, preStopDelay, upgradeTimeout time.Duration) {
+	onUpgrade := func() error {
+		if err := upgrader.Upgrade(upgradeTimeout); err != nil {
+			return err
+		}
+		drainer.Handover()
+		return nil
+	}
+	// 其他任务退出时，信号监听任务通过ctx结束并调用onClose，这里不需要再关闭信号channel
+	tk, _ := _util.ListenSignalTaskWithOptions(logger, _util.SignalOptions{OnClose: onClose, OnReload: onReload, OnUpgrade: onUpgrade,
+		OnInfo: func() { buildinfo.Dump(nil) }, PreStopDelay: preStopDelay})
+	tg.Add(tk).Name("signal").Interrupt(func(err error) {
+		logger.Log("signalTask", "exited", "clean", err)
+	})
+}
+
+// 添加后台任务：按动态配置中的resource_guard定时采样goroutine数、fd数和内存(见resguard.Guard.Run)
+func addTaskResourceGuard(tg *_go.TaskGroup) {
+	tg.Add(resGuard.Run).Name("resguard").Interrupt(func(err error) {
+		logger.Log("resGuardTask", "exited", "clean", err)
+	})
+}
+
+// 添加后台任务：启动管理端口的http服务(见newAdminServer)
+// 在信号监听之后、其他任务之前添加，退出时最后关闭，drain期间仍可以查看状态
+func addTaskAdminSrv(tg *_go.TaskGroup, cronJobs *_go.Cron, adminSrvAddr string, httpPort int) {
+	adminSrv := newAdminServer(tg, cronJobs, httpPort)
+	adminSrvTask := func(ctx context.Context) error {
+		logger.Log("NewTaskGroup", "adminSrvTask", "adminSrvAddr", adminSrvAddr)
+
+		lis, err := upgrader.Listen("admin", adminSrvAddr)
+		if err != nil {
+			return err
+		}
+		_go.TaskReady(ctx)
+		return adminSrv.Serve(lis)
+	}
+	tg.Add(adminSrvTask).Name("adminSrv").WaitReady().Interrupt(func(err error) {
+		closeCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		logger.Log("adminSrvTask", "exited", "err", err, "clean", adminSrv.Shutdown(closeCtx))
+	})
+}
+
+// 管理端口的路由，除AdminServer自带的pprof、expvar、日志级别、/quitquitquit(发送SIGTERM，与kill的效果相同)等以外，
+// 还有限速器状态、故障注入、功能开关、payload日志、资源软上限(/resguard)以及后台任务(/tasks)和定时任务(/cron)的状态，动态配置重新加载时会被log_level、chaos、feature_flags覆盖，
+// /swagger/为HTTP/JSON接口的Swagger UI，文档中的server为http端口(httpPort)，在页面上"Try it out"是跨域请求，
+// http端口没有开启CORS，浏览器会拒绝，可以复制页面上生成的curl命令调用
+func newAdminServer(tg *_go.TaskGroup, cronJobs *_go.Cron, httpPort int) *gokit_foundation.AdminServer {
+	adminSrv := gokit_foundation.NewAdminServer(nil)
+	adminSrv.Handle("/ratelimit", http.HandlerFunc(rateLimitHandler))
+	adminSrv.Handle("/chaos", endpoint.DefaultChaos.Handler())
+	adminSrv.Handle("/featureflags", endpoint.DefaultFlags.Handler())
+	adminSrv.Handle("/payloadlog", endpoint.DefaultPayloadLog.Handler())
+	adminSrv.Handle("/resguard", resGuard.Handler())
+	adminSrv.Handle("/tasks", tg.Handler())
+	adminSrv.Handle("/cron", cronJobs.Handler())
+	adminSrv.Handle("/openapi.json", adminOpenAPIHandler(transport.OpenAPI(buildinfo.Version), httpPort))
+	adminSrv.Handle("/swagger/", openapi.SwaggerUIHandler(config.SvcName, "/openapi.json"))
+	return adminSrv
+}
+
+// 管理端口上的接口文档，server为请求的host加上http端口
+func adminOpenAPIHandler(doc *openapi.Doc, httpPort int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		doc.WithServers("http://"+net.JoinHostPort(host, strconv.Itoa(httpPort))).Handler().ServeHTTP(w, r)
+	})
+}
+
+// 各接口限速器的当前状态(限速值、突发数、通过/拒绝的调用数)
+func rateLimitHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(endpoint.DefaultRateLimiters.States())
 }
 
-// 添加后台任务：监听退出信号（第一个添加）
-func addTaskListenSignal(tg *_go.TaskGroup) {
-	tk, sc := _util.ListenSignalTask(logger, onClose)
-	tg.Add(tk).Interrupt(func(err error) {
-		close(sc)
+// http服务的路由，不使用http.DefaultServeMux，避免其他pkg往里面注册handler
+// apiHandler为业务接口(HTTP/JSON transport)，其他路径都交给它处理，管理接口在单独的端口上(见newAdminServer)
+func newHTTPHandler(apiHandler http.Handler) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/", apiHandler)
+	mux.Handle("/metrics", metricsObj.Handler())
+	// 接口文档，server为相对路径
+	mux.Handle("/openapi.json", transport.OpenAPI(buildinfo.Version).Handler())
+	if healthSrv != nil {
+		mux.Handle("/healthz", healthSrv.HealthzHandler())
+		mux.Handle("/readyz", healthSrv.ReadyzHandler())
+	}
+	if config.EnablePprof {
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	}
+	return mux
+}
+
+// 添加后台任务：异步写入请求耗时指标
+// 需要在grpc/http服务之前添加，这样退出时会在它们之后清理，保证服务停止前产生的样本全部写入
+func addTaskMetricsFlush(tg *_go.TaskGroup, bufSize int) {
+	bh := internal.NewBufferedHistogram(metricsObj.Duration, bufSize)
+	metricsObj.Duration = bh
+
+	tg.Add(bh.Run).Name("metricsFlush").Interrupt(func(err error) {
+		bh.Flush()
+		logger.Log("metricsFlushTask", "exited", "clean", err)
 	})
 }
 
+// 启动前检查，见gokit_foundation.Preflight
+// 平滑升级时端口由旧进程继承过来，已经通过了检查
+func preflight(conf *config.Bootstrap) error {
+	if upgrader.Inherited() {
+		return nil
+	}
+	grpcSrvAddr := net.JoinHostPort(conf.ListenHost, strconv.Itoa(conf.GRPCPort))
+	p := new(gokit_foundation.Preflight).
+		Add("grpc port", gokit_foundation.CheckPortFree(grpcSrvAddr)).
+		Add("http port", gokit_foundation.CheckPortFree(net.JoinHostPort(conf.ListenHost, strconv.Itoa(conf.HTTPPort))))
+	optional := []struct {
+		name string
+		port int
+	}{{"admin port", conf.AdminPort}, {"thrift port", conf.ThriftPort}, {"grpc-web port", conf.GRPCWebPort}}
+	for _, o := range optional {
+		if o.port != 0 {
+			p.Add(o.name, gokit_foundation.CheckPortFree(net.JoinHostPort(conf.ListenHost, strconv.Itoa(o.port))))
+		}
+	}
+	if conf.ConsulProbe > 0 && conf.SDBackend == gokit_foundation.SDBackendConsul {
+		advertise := net.JoinHostPort(conf.AdvertiseHost, strconv.Itoa(conf.GRPCPort))
+		p.Add("consul probe", gokit_foundation.ConsulProbe(grpcSrvAddr, advertise, conf.ConsulProbe))
+	}
+	return p.Run(context.Background())
+}
+
+// 添加后台任务：定时把指标推送到pushgateway，用于prometheus拉取不到本实例的环境
+// 在addTaskMetricsFlush之前添加，退出时在缓冲的样本写入之后最后推送一次
+func addTaskMetricsPush(tg *_go.TaskGroup, conf metricspush.Config) {
+	p := metricspush.New(conf, metricsObj.Gatherer(), logger)
+	tg.Add(p.Run).Name("metricsPush").Interrupt(func(err error) {
+		logger.Log("metricsPushTask", "exited", "clean", err, "flush", p.Flush())
+	})
+}
+
+// 添加后台任务：定期把指标推送到statsd/dogstatsd/otlp后端(见gokit_foundation/metricsx)
+// 与addTaskMetricsPush一样在addTaskMetricsFlush之前添加，退出时在它Flush之后最后推送一次
+func addTaskMetricsSend(tg *_go.TaskGroup, p metricsx.Pusher, backend string) {
+	tg.Add(p.Run).Name("metricsSend").Interrupt(func(err error) {
+		logger.Log("metricsSendTask", "exited", "backend", backend, "clean", err, "stop", p.Stop())
+	})
+}
+
+// 添加后台任务：攒批发布领域事件到kafka(见gokit_foundation/events)
+// 与addTaskMetricsFlush一样需要在grpc/http服务之前添加，退出时在它们之后Flush，保证服务停止前产生的事件全部写入
+func addTaskEvents(tg *_go.TaskGroup, conf *config.Bootstrap) *events.AsyncPublisher {
+	pub := events.NewAsyncPublisher(events.NewKafkaSink(conf.KafkaBrokerList()), conf.EventsConfig(), logger, metricsObj.EventFailures)
+	tg.Add(pub.Run).Name("events").Interrupt(func(err error) {
+		pub.Flush()
+		logger.Log("eventsTask", "exited", "clean", err, "close", pub.Close())
+	})
+	return pub
+}
+
 func addTaskHttpSrv(tg *_go.TaskGroup, httpSrvAddr string) {
-	// http服务监听8080, 目前只提供metric接口给prometheus调用
-	httpSrvTask := func(_ context.Context) error {
+	// http服务监听8081, 提供HTTP/JSON业务接口以及metric接口给prometheus调用
+	httpSrvTask := func(ctx context.Context) error {
 		logger.Log("NewTaskGroup", "httpSrvTask", "httpSrvAddr", httpSrvAddr)
 
-		httpLis, err := net.Listen("tcp", httpSrvAddr)
-		_util.PanicIfErr(err, nil)
+		httpLis, err := upgrader.Listen("http", httpSrvAddr)
+		if err != nil {
+			return err
+		}
+		_go.TaskReady(ctx)
 
-		// default use http.DefaultServeMux as handler
 		err = httpSrv.Serve(httpLis)
 		return err
 	}
-	tg.Add(httpSrvTask).Interrupt(func(err error) {
+	tg.Add(httpSrvTask).Name("httpSrv").WaitReady().Interrupt(func(err error) {
 		if err != nil {
 			logger.Log("httpSrvTask", "exited", "err", err)
 		} else {
-			closeCtx, _ := context.WithTimeout(context.Background(), time.Second*2)
-			err := httpSrv.Shutdown(closeCtx)
+			err := drainer.ShutdownHTTP(httpSrv.Server)
 			logger.Log("httpSrvTask", "exited", "clean", err)
 		}
 	})
 }
 
-func addTaskGRPCSrv(tg *_go.TaskGroup, grpcSrvAddr string) {
+func addTaskGRPCSrv(tg *_go.TaskGroup, grpcSrvAddr string, addSrv addsvcpb.AddServer) {
 	// 添加后台任务：启动rpc-srv
-	grpcSrvTask := func(_ context.Context) error {
+	grpcSrvTask := func(ctx context.Context) error {
 		logger.Log("NewTaskGroup", "grpcSrvTask", "grpcSrvAddr", grpcSrvAddr)
 
-		grpcLis, err := net.Listen("tcp", grpcSrvAddr)
-		_util.PanicIfErr(err, nil)
+		grpcLis, err := upgrader.Listen("grpc", grpcSrvAddr)
+		if err != nil {
+			return err
+		}
 
-		addSrv := NewAddSrv(logger)
 		addsvcpb.RegisterAddServer(grpcSrv, addSrv)
-		// 这里注册了AddSrv以及healthSrv
-		gokit_foundation.RegisterGRPCHealthSrv(grpcSrv)
+		_go.TaskReady(ctx)
 
 		err = grpcSrv.Serve(grpcLis)
 		return err
 	}
-	tg.Add(grpcSrvTask).Interrupt(func(err error) {
+	tg.Add(grpcSrvTask).Name("grpcSrv").WaitReady().Interrupt(func(err error) {
 		if err != nil {
 			logger.Log("grpcSrvTask", "exited", "err", err)
 		} else {
-			grpcSrv.GracefulStop()
-			logger.Log("grpcSrvTask", "exited", "clean", nil)
+			graceful := drainer.StopGRPC(grpcSrv)
+			logger.Log("grpcSrvTask", "exited", "clean", nil, "graceful", graceful)
+		}
+	})
+}
+
+// 添加后台任务：启动thrift-srv，与grpc服务共用endpoints(见transport.NewThriftServer)
+// 添加后台任务：启动grpc-web的http服务，浏览器通过它调用grpc接口(见web/)，http的超时配置同样生效
+// WriteTimeout不为0时，服务端流的调用最长持续这么久
+func addTaskGRPCWebSrv(tg *_go.TaskGroup, grpcWebSrvAddr string, webConf gokit_foundation.GRPCWebConfig, httpConf gokit_foundation.HTTPServerConfig) {
+	srv := gokit_foundation.NewHTTPServer(gokit_foundation.NewGRPCWebHandler(grpcSrv, webConf, nil), httpConf)
+	grpcWebSrvTask := func(ctx context.Context) error {
+		logger.Log("NewTaskGroup", "grpcWebSrvTask", "grpcWebSrvAddr", grpcWebSrvAddr)
+
+		lis, err := upgrader.Listen("grpc-web", grpcWebSrvAddr)
+		if err != nil {
+			return err
+		}
+		_go.TaskReady(ctx)
+
+		return srv.Serve(lis)
+	}
+	tg.Add(grpcWebSrvTask).Name("grpcWebSrv").WaitReady().Interrupt(func(err error) {
+		if err != nil {
+			logger.Log("grpcWebSrvTask", "exited", "err", err)
+		} else {
+			err := drainer.ShutdownHTTP(srv.Server)
+			logger.Log("grpcWebSrvTask", "exited", "clean", err)
 		}
 	})
 }
+
+// 在/v1/下提供grpc-gateway生成的REST接口，通过lis调用本进程的grpc server，与grpc请求经过相同的拦截器
+func newGRPCGatewayHandler(apiHandler http.Handler, lis *bufconn.Listener) (http.Handler, error) {
+	conn, err := grpc.Dial("bufconn", grpc.WithInsecure(), grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+		return lis.Dial()
+	}))
+	if err != nil {
+		return nil, err
+	}
+	gateway, err := transport.NewGRPCGatewayHandler(context.Background(), conn)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/", apiHandler)
+	mux.Handle("/v1/", gateway)
+	return mux, nil
+}
+
+// 添加后台任务：grpc server在进程内的listener上为grpc-gateway提供服务，见newGRPCGatewayHandler
+func addTaskGRPCGateway(tg *_go.TaskGroup, lis *bufconn.Listener) {
+	grpcGatewayTask := func(ctx context.Context) error {
+		logger.Log("NewTaskGroup", "grpcGatewayTask")
+		_go.TaskReady(ctx)
+
+		return grpcSrv.Serve(lis)
+	}
+	tg.Add(grpcGatewayTask).Name("grpcGateway").WaitReady().Interrupt(func(err error) {
+		logger.Log("grpcGatewayTask", "exited", "err", err, "clean", lis.Close())
+	})
+}
+
+func addTaskThriftSrv(tg *_go.TaskGroup, thriftSrvAddr string, endpoints endpoint.AddSvcEndpoints, stopTimeout time.Duration) {
+	var srv *thrift.TSimpleServer
+	thriftSrvTask := func(ctx context.Context) error {
+		logger.Log("NewTaskGroup", "thriftSrvTask", "thriftSrvAddr", thriftSrvAddr)
+
+		// thrift.TServerSocket不能使用已有的listener，见transport.NewThriftServerTransport
+		lis, err := upgrader.Listen("thrift", thriftSrvAddr)
+		if err != nil {
+			return err
+		}
+		socket := transport.NewThriftServerTransport(lis)
+		processor := addsvcthrift.NewAddServiceProcessor(transport.NewThriftServer(endpoints))
+		srv = thrift.NewTSimpleServer4(processor, socket, transport.ThriftTransportFactory(), transport.ThriftProtocolFactory)
+		if err = srv.Listen(); err != nil {
+			return err
+		}
+		_go.TaskReady(ctx)
+
+		return srv.AcceptLoop()
+	}
+	tg.Add(thriftSrvTask).Name("thriftSrv").WaitReady().Interrupt(func(err error) {
+		if err != nil || srv == nil {
+			logger.Log("thriftSrvTask", "exited", "err", err)
+			return
+		}
+		// Stop会等待所有client断开连接，client长连接不断开时最多等待stopTimeout
+		done := make(chan error, 1)
+		go func() { done <- srv.Stop() }()
+		select {
+		case err = <-done:
+			logger.Log("thriftSrvTask", "exited", "clean", err, "graceful", true)
+		case <-time.After(stopTimeout):
+			logger.Log("thriftSrvTask", "exited", "clean", nil, "graceful", false)
+		}
+	})
+}
+
+// 添加后台任务：连接NATS并订阅Sum/Concat(见transport.SubscribeNATS、SubscribeNATSWithDeadLetter)，与grpc/http服务共用endpoints
+// 连接断开后nats.go会一直重连，所以只有首次连接或订阅失败才返回err
+func addTaskNATS(tg *_go.TaskGroup, conf *config.Bootstrap, endpoints endpoint.AddSvcEndpoints) {
+	natsTask := func(ctx context.Context) error {
+		url := conf.NATSURL
+		logger.Log("NewTaskGroup", "natsTask", "url", url, "dlq", conf.NATSDeadLetter)
+
+		closed := make(chan struct{})
+		nc, err := nats.Connect(url,
+			nats.Name(config.SvcName),
+			nats.MaxReconnects(-1),
+			nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+				logger.Log("natsTask", "disconnected", "err", err)
+			}),
+			nats.ReconnectHandler(func(nc *nats.Conn) {
+				logger.Log("natsTask", "reconnected", "url", nc.ConnectedUrl())
+			}),
+			nats.ClosedHandler(func(*nats.Conn) { close(closed) }),
+		)
+		if err != nil {
+			return err
+		}
+		// 只有带MessageIDHeader、不带reply subject的消息会去重，见transport.SubscribeNATS
+		natsEndpoints := endpoints
+		if d := newDeduper(conf, "nats"); d != nil {
+			natsEndpoints.SumEndpoint = dedup.Middleware(d)(natsEndpoints.SumEndpoint)
+			natsEndpoints.ConcatEndpoint = dedup.Middleware(d)(natsEndpoints.ConcatEndpoint)
+		}
+		if conf.NATSDeadLetter {
+			_, err = transport.SubscribeNATSWithDeadLetter(nc, natsEndpoints, conf.DeadLetterPolicy(), logger)
+		} else {
+			_, err = transport.SubscribeNATS(nc, natsEndpoints, logger)
+		}
+		if err != nil {
+			nc.Close()
+			return err
+		}
+		_go.TaskReady(ctx)
+
+		<-ctx.Done()
+		// 取消订阅并处理完已收到的消息再关闭连接，redis等依赖在所有任务退出后才关闭
+		err = nc.Drain()
+		<-closed
+		return err
+	}
+	tg.Add(natsTask).Name("nats").WaitReady().Interrupt(func(err error) {
+		logger.Log("natsTask", "exited", "clean", err)
+	})
+}
+
+// 队列consumer的去重(见dedup.Deduper)，group没有配置去重窗口时返回nil
+func newDeduper(conf *config.Bootstrap, group string) *dedup.Deduper {
+	c := conf.DedupConfig(group)
+	if c.Window <= 0 {
+		return nil
+	}
+	var store idempotency.Store = idempotency.NewRedisStore(_redis.DefClient)
+	if conf.DedupStore == "memory" {
+		// 超出时淘汰最久未使用的记录，被淘汰的消息重复投递时会再处理一次
+		store = idempotency.NewMemStore(100000)
+	}
+	logger.Log("dedup", group, "window", c.Window, "store", conf.DedupStore)
+	return dedup.New(store, config.SvcName+":dedup:", c, metricsObj.DedupDuplicates, logger)
+}
+
+// 上传的blob保存到本地目录或S3，凭证与sqs一样通过AWS SDK的默认方式获取
+func newBlobStore(conf *config.Bootstrap) (blobstore.Store, error) {
+	if conf.BlobDir != "" {
+		return blobstore.NewFSStore(conf.BlobDir)
+	}
+	awsConf := aws.NewConfig().WithRegion(conf.BlobS3Region)
+	if conf.BlobS3Endpoint != "" {
+		awsConf = awsConf.WithEndpoint(conf.BlobS3Endpoint).WithS3ForcePathStyle(true)
+	}
+	sess, err := session.NewSession(awsConf)
+	if err != nil {
+		return nil, err
+	}
+	return blobstore.NewS3Store(s3.New(sess), conf.BlobS3Bucket, conf.BlobS3Prefix), nil
+}
+
+// 添加后台任务：从SQS队列消费Sum/Concat(见transport.NewSQSConsumer)，与grpc/http服务共用endpoints
+// 退出时停止接收，等待处理中的消息完成(超时时间见sqstransport.ConsumerTimeout)，设置了-sqs.journal时启动时先恢复崩溃前处理中的消息
+func addTaskSQS(tg *_go.TaskGroup, conf *config.Bootstrap, endpoints endpoint.AddSvcEndpoints) {
+	sqsTask := func(ctx context.Context) error {
+		logger.Log("NewTaskGroup", "sqsTask", "queue", conf.SQSQueueURL)
+		awsConf := aws.NewConfig().WithRegion(conf.SQSRegion)
+		if conf.SQSEndpoint != "" {
+			awsConf = awsConf.WithEndpoint(conf.SQSEndpoint)
+		}
+		sess, err := session.NewSession(awsConf)
+		if err != nil {
+			return err
+		}
+		var options []sqstransport.ConsumerOption
+		if conf.SQSDeadLetter != "" {
+			options = append(options, sqstransport.ConsumerDeadLetter(conf.SQSDeadLetter, conf.DLQMaxAttempts))
+		}
+		if conf.SQSJournal != "" {
+			j, err := journal.Open(conf.SQSJournal, metricsObj.Journal)
+			if err != nil {
+				return err
+			}
+			defer j.Close()
+			options = append(options, sqstransport.ConsumerJournal(j))
+		}
+		if d := newDeduper(conf, "sqs"); d != nil {
+			options = append(options, sqstransport.ConsumerDedup(d))
+		}
+		consumer := transport.NewSQSConsumer(sqs.New(sess), conf.SQSQueueURL, endpoints, log.With(logger, "transport", "sqs"), options...)
+		// 开始消费之前完成上次崩溃时处理中的消息
+		if failed, err := consumer.Recover(ctx); err != nil || failed > 0 {
+			logger.Log("sqsTask", "recover", "failed", failed, "err", err)
+		}
+		_go.TaskReady(ctx)
+		consumer.Run(ctx)
+		return nil
+	}
+	tg.Add(sqsTask).Name("sqs").WaitReady().Interrupt(func(err error) {
+		logger.Log("sqsTask", "exited", "clean", err)
+	})
+}
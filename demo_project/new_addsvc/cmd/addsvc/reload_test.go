@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/ratelimit"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"go-util/_util"
+	"io/ioutil"
+	"new_addsvc/config"
+	"new_addsvc/pkg/endpoint"
+	"new_addsvc/pkg/service"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestReloadOnSIGHUP(t *testing.T) {
+	logger = log.NewNopLogger()
+	confFile := filepath.Join(t.TempDir(), "dynamic.json")
+	writeFile := func(s string) {
+		if err := ioutil.WriteFile(confFile, []byte(s), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(`{"rate_limits": {"Sum": {"rps": 1}}}`)
+	config.DynamicConfFile = confFile
+	defer func() {
+		config.DynamicConfFile = ""
+		_ = config.ReloadDynamic()
+	}()
+	_util.PanicIfErr(config.ReloadDynamic(), nil)
+
+	svc := service.NewBasicService(logger)
+	eps := endpoint.New(svc, logger, stdopentracing.NoopTracer{}, endpoint.Deps{})
+
+	ctx := context.Background()
+	if _, err := eps.Sum(ctx, 1, 2); err != nil {
+		t.Fatalf("first call err:%v", err)
+	}
+	if _, err := eps.Sum(ctx, 1, 2); !errors.Is(err, ratelimit.ErrLimited) {
+		t.Fatalf("second call want ErrLimited, got err:%v", err)
+	}
+
+	// 确保SIGHUP在信号监听任务注册之前发出时不会杀死测试进程
+	guard := make(chan os.Signal, 1)
+	signal.Notify(guard, syscall.SIGHUP)
+	defer signal.Stop(guard)
+
+	tk, sc := _util.ListenSignalTask(logger, func() {}, onReload)
+	done := make(chan error)
+	go func() { done <- tk(ctx) }()
+
+	writeFile(`{"rate_limits": {"Sum": {"rps": 1000}}}`)
+	deadline := time.Now().Add(time.Second * 2)
+	sumRPS := func() float64 {
+		r, _ := config.GetDynamic().GetRateLimit("Sum")
+		return r.RPS
+	}
+	for sumRPS() != 1000 {
+		if time.Now().After(deadline) {
+			t.Fatal("config not reloaded after SIGHUP")
+		}
+		_ = syscall.Kill(os.Getpid(), syscall.SIGHUP)
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	// 新的限速值在下一次调用时才会设置到limiter上，在此之前经过的时间仍按旧的速率计算token
+	_, _ = eps.Sum(ctx, 1, 2)
+	// 1000rps下5ms足够获得一个新的token，而1rps下不够
+	time.Sleep(time.Millisecond * 5)
+	if _, err := eps.Sum(ctx, 1, 2); err != nil {
+		t.Fatalf("call after reload err:%v", err)
+	}
+
+	// SIGHUP不应导致任务退出
+	select {
+	case err := <-done:
+		t.Fatalf("signal task exited on SIGHUP: %v", err)
+	default:
+	}
+	close(sc)
+	<-done
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// 资源持续超限时的平滑重启，与kill -USR2相同(见addTaskListenSignal)，新进程没有就绪时本进程继续服务，仍然超限时resguard过一段时间再次调用
+func restartBySignal() error {
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		return err
+	}
+	return p.Signal(syscall.SIGUSR2)
+}
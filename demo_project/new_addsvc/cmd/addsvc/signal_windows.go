@@ -0,0 +1,8 @@
+package main
+
+import "errors"
+
+// windows没有SIGUSR2，不支持平滑重启(见go-util/_util/signal_windows.go)，resguard记录err后继续服务
+func restartBySignal() error {
+	return errors.New("graceful restart is not supported on windows")
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/segmentio/kafka-go"
+	"gokit_foundation/deadletter"
+	"gokit_foundation/events"
+	"sort"
+)
+
+// kafkaStore 读取死信topic各分区从最早到当前最新的消息，不使用consumer group(不提交offset)
+type kafkaStore struct {
+	brokers []string
+	topic   string
+	sink    *events.KafkaSink
+}
+
+func (s *kafkaStore) List(ctx context.Context) ([]deadletter.Message, error) {
+	conn, err := kafka.DialContext(ctx, "tcp", s.brokers[0])
+	if err != nil {
+		return nil, err
+	}
+	partitions, err := conn.ReadPartitions(s.topic)
+	conn.Close()
+	if err != nil {
+		return nil, err
+	}
+	var ms []deadletter.Message
+	for _, p := range partitions {
+		pms, err := s.readPartition(ctx, p.ID)
+		if err != nil {
+			return nil, err
+		}
+		ms = append(ms, pms...)
+	}
+	sort.SliceStable(ms, func(i, j int) bool { return ms[i].FailedAt().Before(ms[j].FailedAt()) })
+	return ms, nil
+}
+
+func (s *kafkaStore) readPartition(ctx context.Context, partition int) ([]deadletter.Message, error) {
+	conn, err := kafka.DialLeader(ctx, "tcp", s.brokers[0], s.topic, partition)
+	if err != nil {
+		return nil, err
+	}
+	first, last, err := conn.ReadOffsets()
+	conn.Close()
+	if err != nil || first >= last {
+		return nil, err
+	}
+	r := kafka.NewReader(kafka.ReaderConfig{Brokers: s.brokers, Topic: s.topic, Partition: partition})
+	defer r.Close()
+	if err := r.SetOffset(first); err != nil {
+		return nil, err
+	}
+	var ms []deadletter.Message
+	for {
+		km, err := r.ReadMessage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		ms = append(ms, deadletter.FromKafka(km))
+		if km.Offset >= last-1 {
+			return ms, nil
+		}
+	}
+}
+
+// Replay 写入最初的topic，死信topic中的消息保留
+func (s *kafkaStore) Replay(ctx context.Context, ids []string) (int, error) {
+	ms, err := s.List(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if s.sink == nil {
+		s.sink = events.NewKafkaSink(s.brokers)
+	}
+	pub := deadletter.SinkPublisher(s.sink)
+	match := idSet(ids)
+	n := 0
+	for _, m := range ms {
+		if !match(m.ID) {
+			continue
+		}
+		if m.Origin() == s.topic {
+			return n, fmt.Errorf("message %s has no %s header", m.ID, deadletter.OriginHeader)
+		}
+		if err := pub.Publish(ctx, m.Origin(), deadletter.Replay(m)); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+func (s *kafkaStore) Close() error {
+	if s.sink == nil {
+		return nil
+	}
+	return s.sink.Close()
+}
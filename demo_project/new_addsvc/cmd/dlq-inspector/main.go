@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/go-kit/kit/log"
+	"gokit_foundation/deadletter"
+	"gokit_foundation/sqstransport"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+/*
+查看和重放死信队列中的消息(见deadletter)，重放时去掉重试和死信的header，发往消息最初的队列/topic
+	dlq-inspector -backend sqs -sqs.dlq.url http://127.0.0.1:9324/queue/addsvc-dlq list
+	dlq-inspector -backend sqs -sqs.dlq.url http://127.0.0.1:9324/queue/addsvc-dlq replay [id...] (不指定id时重放全部)
+	dlq-inspector -backend kafka -kafka.brokers 127.0.0.1:9092 -kafka.topic addsvc.events.dlq list
+	dlq-inspector -backend kafka -kafka.brokers 127.0.0.1:9092 -kafka.topic addsvc.events.dlq replay 0:15 1:3
+SQS重放成功的消息从死信队列删除；Kafka无法删除单条消息，重放后仍留在<topic>.dlq中直到过期，所以一般指定id(partition:offset)重放
+NATS没有持久化，死信消息只能由当时订阅了<subject>.dlq的consumer收到，不支持查看和重放
+*/
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// store 一个死信队列，ids为空时重放全部
+type store interface {
+	List(ctx context.Context) ([]deadletter.Message, error)
+	Replay(ctx context.Context, ids []string) (int, error)
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("dlq-inspector", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var (
+		backend     = fs.String("backend", "sqs", "dead-letter queue backend: sqs or kafka")
+		sqsURL      = fs.String("sqs.dlq.url", "", "url of the SQS dead-letter queue")
+		sqsEndpoint = fs.String("sqs.endpoint", "", "SQS endpoint of a local emulator, e.g. http://127.0.0.1:9324 for ElasticMQ")
+		sqsRegion   = fs.String("sqs.region", "us-east-1", "AWS region of the SQS queue")
+		brokers     = fs.String("kafka.brokers", "127.0.0.1:9092", "kafka brokers separated by comma")
+		topic       = fs.String("kafka.topic", "", "kafka dead-letter topic, e.g. addsvc.events.dlq")
+		timeout     = fs.Duration("timeout", 30*time.Second, "timeout of the whole command")
+	)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: dlq-inspector [flags] list | replay [id...]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 || (fs.Arg(0) != "list" && fs.Arg(0) != "replay") || (fs.Arg(0) == "list" && fs.NArg() > 1) {
+		fs.Usage()
+		return 2
+	}
+
+	var s store
+	switch *backend {
+	case "sqs":
+		if *sqsURL == "" {
+			fmt.Fprintln(stderr, "sqs.dlq.url is required")
+			return 2
+		}
+		awsConf := aws.NewConfig().WithRegion(*sqsRegion)
+		if *sqsEndpoint != "" {
+			awsConf = awsConf.WithEndpoint(*sqsEndpoint)
+		}
+		sess, err := session.NewSession(awsConf)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		s = &sqsStore{api: sqs.New(sess), queueURL: *sqsURL}
+	case "kafka":
+		if *topic == "" {
+			fmt.Fprintln(stderr, "kafka.topic is required")
+			return 2
+		}
+		ks := &kafkaStore{brokers: strings.Split(*brokers, ","), topic: *topic}
+		defer ks.Close()
+		s = ks
+	default:
+		fmt.Fprintf(stderr, "unknown backend: %s\n", *backend)
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	return runCommand(ctx, s, fs.Arg(0), fs.Args()[1:], stdout, stderr)
+}
+
+func runCommand(ctx context.Context, s store, cmd string, ids []string, stdout, stderr io.Writer) int {
+	if cmd == "replay" {
+		n, err := s.Replay(ctx, ids)
+		fmt.Fprintf(stdout, "replayed %d messages\n", n)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		return 0
+	}
+	msgs, err := s.List(ctx)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	logger := log.NewLogfmtLogger(stdout)
+	for _, m := range msgs {
+		logger.Log("id", m.ID, "origin", m.Origin(), "attempt", m.Attempt(), "failed_at", m.FailedAt().Format(time.RFC3339),
+			"error", m.Error(), "body", string(m.Value))
+	}
+	return 0
+}
+
+// 以ids为key，ids为空时匹配全部
+func idSet(ids []string) func(id string) bool {
+	if len(ids) == 0 {
+		return func(string) bool { return true }
+	}
+	set := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return func(id string) bool { return set[id] }
+}
+
+// sqsStore 接收死信队列中的全部消息(接收期间对其他consumer不可见)，处理完后恢复未重放消息的可见性
+type sqsStore struct {
+	api      sqstransport.API
+	queueURL string
+}
+
+// 消息可见时间，需要足够接收完整个队列
+const sqsVisibilityTimeout = 60
+
+func (s *sqsStore) receiveAll(ctx context.Context) ([]*sqs.Message, error) {
+	var all []*sqs.Message
+	seen := map[string]bool{}
+	for {
+		out, err := s.api.ReceiveMessageWithContext(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:              aws.String(s.queueURL),
+			MaxNumberOfMessages:   aws.Int64(10),
+			VisibilityTimeout:     aws.Int64(sqsVisibilityTimeout),
+			MessageAttributeNames: aws.StringSlice([]string{"All"}),
+		})
+		if err != nil {
+			return all, err
+		}
+		if len(out.Messages) == 0 {
+			return all, nil
+		}
+		for _, msg := range out.Messages {
+			if id := aws.StringValue(msg.MessageId); !seen[id] {
+				seen[id] = true
+				all = append(all, msg)
+			}
+		}
+	}
+}
+
+// 恢复可见性，其他consumer(或下一次list)可以立即接收
+func (s *sqsStore) release(ctx context.Context, msgs []*sqs.Message) {
+	for _, msg := range msgs {
+		_, _ = s.api.ChangeMessageVisibilityWithContext(ctx, &sqs.ChangeMessageVisibilityInput{
+			QueueUrl:          aws.String(s.queueURL),
+			ReceiptHandle:     msg.ReceiptHandle,
+			VisibilityTimeout: aws.Int64(0),
+		})
+	}
+}
+
+func (s *sqsStore) List(ctx context.Context) ([]deadletter.Message, error) {
+	msgs, err := s.receiveAll(ctx)
+	defer s.release(ctx, msgs)
+	if err != nil {
+		return nil, err
+	}
+	ms := make([]deadletter.Message, 0, len(msgs))
+	for _, msg := range msgs {
+		ms = append(ms, sqstransport.FromSQS(s.queueURL, msg))
+	}
+	return ms, nil
+}
+
+// Replay 发送到最初的队列后从死信队列删除，发送失败时保留在死信队列中
+func (s *sqsStore) Replay(ctx context.Context, ids []string) (int, error) {
+	msgs, err := s.receiveAll(ctx)
+	if err != nil {
+		s.release(ctx, msgs)
+		return 0, err
+	}
+	match := idSet(ids)
+	var rest []*sqs.Message
+	n := 0
+	for i, msg := range msgs {
+		m := sqstransport.FromSQS(s.queueURL, msg)
+		if !match(m.ID) {
+			rest = append(rest, msg)
+			continue
+		}
+		if m.Origin() == s.queueURL {
+			rest = append(rest, msgs[i:]...)
+			s.release(ctx, rest)
+			return n, fmt.Errorf("message %s has no %s header", m.ID, deadletter.OriginHeader)
+		}
+		r := deadletter.Replay(m)
+		if _, err := s.api.SendMessageWithContext(ctx, &sqs.SendMessageInput{
+			QueueUrl:          aws.String(m.Origin()),
+			MessageBody:       aws.String(string(r.Value)),
+			MessageAttributes: sqstransport.Attributes(r.Headers),
+		}); err != nil {
+			s.release(ctx, append(rest, msgs[i:]...))
+			return n, err
+		}
+		// 删除失败时消息会重新可见，再次重放会重复投递
+		if _, err := s.api.DeleteMessageWithContext(ctx, &sqs.DeleteMessageInput{
+			QueueUrl:      aws.String(s.queueURL),
+			ReceiptHandle: msg.ReceiptHandle,
+		}); err != nil {
+			n++
+			s.release(ctx, append(rest, msgs[i+1:]...))
+			return n, err
+		}
+		n++
+	}
+	s.release(ctx, rest)
+	return n, nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"gokit_foundation/deadletter"
+	"gokit_foundation/sqstransport"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 内存中的SQS队列，接收后不可见，ChangeMessageVisibility为0时恢复
+type fakeSQS struct {
+	queues    map[string][]*sqs.Message
+	invisible map[string]bool
+	n         int
+}
+
+func (f *fakeSQS) ReceiveMessageWithContext(_ aws.Context, in *sqs.ReceiveMessageInput, _ ...request.Option) (*sqs.ReceiveMessageOutput, error) {
+	out := &sqs.ReceiveMessageOutput{}
+	for _, msg := range f.queues[*in.QueueUrl] {
+		if !f.invisible[*msg.ReceiptHandle] && int64(len(out.Messages)) < *in.MaxNumberOfMessages {
+			f.invisible[*msg.ReceiptHandle] = true
+			out.Messages = append(out.Messages, msg)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeSQS) DeleteMessageWithContext(_ aws.Context, in *sqs.DeleteMessageInput, _ ...request.Option) (*sqs.DeleteMessageOutput, error) {
+	q := f.queues[*in.QueueUrl]
+	for i, msg := range q {
+		if *msg.ReceiptHandle == *in.ReceiptHandle {
+			f.queues[*in.QueueUrl] = append(q[:i:i], q[i+1:]...)
+			delete(f.invisible, *in.ReceiptHandle)
+		}
+	}
+	return &sqs.DeleteMessageOutput{}, nil
+}
+
+func (f *fakeSQS) ChangeMessageVisibilityWithContext(_ aws.Context, in *sqs.ChangeMessageVisibilityInput, _ ...request.Option) (*sqs.ChangeMessageVisibilityOutput, error) {
+	if *in.VisibilityTimeout == 0 {
+		delete(f.invisible, *in.ReceiptHandle)
+	}
+	return &sqs.ChangeMessageVisibilityOutput{}, nil
+}
+
+func (f *fakeSQS) SendMessageWithContext(_ aws.Context, in *sqs.SendMessageInput, _ ...request.Option) (*sqs.SendMessageOutput, error) {
+	f.n++
+	id := "m" + strconv.Itoa(f.n)
+	f.queues[*in.QueueUrl] = append(f.queues[*in.QueueUrl], &sqs.Message{
+		MessageId: aws.String(id), ReceiptHandle: aws.String("rh-" + id), Body: in.MessageBody, MessageAttributes: in.MessageAttributes,
+	})
+	return &sqs.SendMessageOutput{MessageId: aws.String(id)}, nil
+}
+
+func TestSQSStore(t *testing.T) {
+	api := &fakeSQS{queues: map[string][]*sqs.Message{}, invisible: map[string]bool{}}
+	dead := deadletter.Dead(deadletter.Message{Topic: "q", Headers: map[string]string{"k": "1", deadletter.AttemptHeader: "5"}},
+		errors.New("db down"), time.Now())
+	for _, body := range []string{"a", "b"} {
+		if _, err := api.SendMessageWithContext(context.Background(), &sqs.SendMessageInput{QueueUrl: aws.String("q-dlq"),
+			MessageBody: aws.String(body), MessageAttributes: sqstransport.Attributes(dead.Headers)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := &sqsStore{api: api, queueURL: "q-dlq"}
+
+	var stdout, stderr bytes.Buffer
+	if code := runCommand(context.Background(), s, "list", nil, &stdout, &stderr); code != 0 {
+		t.Fatalf("list got code:%d stderr:%s", code, stderr.String())
+	}
+	if out := stdout.String(); strings.Count(out, "\n") != 2 || !strings.Contains(out, "id=m1 origin=q attempt=5") || !strings.Contains(out, "error=\"db down\"") {
+		t.Errorf("list got:%s", out)
+	}
+	// list之后消息仍在死信队列中并且可见
+	if len(api.invisible) != 0 {
+		t.Errorf("got invisible:%v", api.invisible)
+	}
+
+	stdout.Reset()
+	if code := runCommand(context.Background(), s, "replay", []string{"m2"}, &stdout, &stderr); code != 0 || stdout.String() != "replayed 1 messages\n" {
+		t.Fatalf("replay got code:%d stdout:%s stderr:%s", code, stdout.String(), stderr.String())
+	}
+	if q := api.queues["q"]; len(q) != 1 || *q[0].Body != "b" || len(q[0].MessageAttributes) != 1 || *q[0].MessageAttributes["k"].StringValue != "1" {
+		t.Errorf("got origin queue:%v", q)
+	}
+	if q := api.queues["q-dlq"]; len(q) != 1 || *q[0].MessageId != "m1" || len(api.invisible) != 0 {
+		t.Errorf("got dlq:%v invisible:%v", q, api.invisible)
+	}
+}
+
+func TestRunBadArgs(t *testing.T) {
+	for _, args := range [][]string{nil, {"get"}, {"list", "x"}, {"-backend", "nats", "list"}, {"list"}, {"-backend", "kafka", "list"}} {
+		var stdout, stderr bytes.Buffer
+		if code := run(args, &stdout, &stderr); code != 2 {
+			t.Errorf("args:%v got code:%d", args, code)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/codahale/hdrhistogram"
+	"gokit_foundation/errs"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 一次调用，err按errs.Kind分类统计
+type call func(ctx context.Context) error
+
+// 压测结果，延迟单位为微秒
+type result struct {
+	hist    *hdrhistogram.Histogram
+	errs    map[string]int64 // errs.Kind => 次数
+	elapsed time.Duration
+}
+
+// 1µs~1min，3位有效数字，超过1min的延迟按1min记录
+func newResult() *result {
+	return &result{hist: hdrhistogram.New(1, int64(time.Minute/time.Microsecond), 3), errs: map[string]int64{}}
+}
+
+func (r *result) record(latency time.Duration, err error) {
+	v := int64(latency / time.Microsecond)
+	if max := r.hist.HighestTrackableValue(); v > max {
+		v = max
+	}
+	_ = r.hist.RecordValue(v)
+	if err != nil {
+		r.errs[errs.KindOf(err).String()]++
+	}
+}
+
+func errCount(r *result) (n int64) {
+	for _, c := range r.errs {
+		n += c
+	}
+	return n
+}
+
+func (r *result) merge(from *result) {
+	r.hist.Merge(from.hist)
+	for k, n := range from.errs {
+		r.errs[k] += n
+	}
+}
+
+/*
+runLoad 使用concurrency个worker在duration内调用do，ctx取消时提前结束
+  - rps>0时为开环压测：第i个请求的计划发送时间为begin+i/rps，延迟从计划时间开始计算，
+    server变慢导致请求排队时，排队的时间也计入延迟(避免coordinated omission)，worker不够时实际速率会低于rps
+  - rps为0时每个worker连续调用，测量最大吞吐
+
+每个worker使用自己的histogram，结束时合并，记录时不需要加锁
+*/
+func runLoad(ctx context.Context, do call, rps float64, concurrency int, duration time.Duration) *result {
+	var (
+		begin = time.Now()
+		seq   = int64(-1)
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		total = newResult()
+	)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := newResult()
+			defer func() {
+				mu.Lock()
+				total.merge(r)
+				mu.Unlock()
+			}()
+			for ctx.Err() == nil {
+				start := time.Now()
+				if rps > 0 {
+					n := atomic.AddInt64(&seq, 1)
+					start = begin.Add(time.Duration(float64(n) / rps * float64(time.Second)))
+					if start.Sub(begin) >= duration {
+						return
+					}
+					select {
+					case <-time.After(time.Until(start)):
+					case <-ctx.Done():
+						return
+					}
+				} else if start.Sub(begin) >= duration {
+					return
+				}
+				err := do(ctx)
+				r.record(time.Since(start), err)
+			}
+		}()
+	}
+	wg.Wait()
+	total.elapsed = time.Since(begin)
+	return total
+}
+
+var quantiles = []float64{50, 90, 99, 99.9}
+
+// 输出格式：
+//
+//	requests: 1000 ok: 998 errors: 2 (resource_exhausted=2)
+//	duration: 1.00s throughput: 999.5 rps
+//	latency(ms): min=0.210 mean=0.452 p50=0.401 p90=0.702 p99=1.203 p99.9=3.101 max=5.003
+func (r *result) print(w io.Writer) {
+	n, failed := r.hist.TotalCount(), errCount(r)
+	var kinds []string
+	for k, c := range r.errs {
+		kinds = append(kinds, fmt.Sprintf("%s=%d", k, c))
+	}
+	sort.Strings(kinds)
+	fmt.Fprintf(w, "requests: %d ok: %d errors: %d", n, n-failed, failed)
+	if len(kinds) > 0 {
+		fmt.Fprintf(w, " (%s)", strings.Join(kinds, " "))
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "duration: %.2fs throughput: %.1f rps\n", r.elapsed.Seconds(), float64(n)/r.elapsed.Seconds())
+	if n == 0 {
+		return
+	}
+	ms := func(us int64) string { return fmt.Sprintf("%.3f", float64(us)/1000) }
+	fmt.Fprintf(w, "latency(ms): min=%s mean=%.3f", ms(r.hist.Min()), r.hist.Mean()/1000)
+	for _, q := range quantiles {
+		fmt.Fprintf(w, " p%g=%s", q, ms(r.hist.ValueAtQuantile(q)))
+	}
+	fmt.Fprintf(w, " max=%s\n", ms(r.hist.Max()))
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"gokit_foundation/auth"
+	"gokit_foundation/cache"
+	"gokit_foundation/loadshed"
+	"io"
+	"net/http"
+	endpoint2 "new_addsvc/pkg/endpoint"
+	"new_addsvc/pkg/transport"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+/*
+压测工具，直连某个addsvc实例(不经过服务发现和client侧的重试)，按固定速率调用Sum/Concat，结束时输出延迟分布(HDR histogram)
+	loadgen -transport grpc -addr 127.0.0.1:8080 -rps 1000 -duration 30s sum
+	loadgen -transport http -addr 127.0.0.1:8081 -rps 0 -concurrency 64 concat (不限速率，测量最大吞吐)
+	loadgen -no-cache concat (跳过server的响应缓存，否则Concat的延迟主要是缓存命中)
+	loadgen -priority low sum (指定优先级，server过载时低优先级的请求先被拒绝，见gokit_foundation/loadshed)
+过载保护的演示：同时以不同优先级压测同一个实例，超过load_shed.max_in_flight后low先返回unavailable，high不受影响
+	loadgen -rps 0 -concurrency 300 -priority low -duration 30s sum &
+	loadgen -rps 200 -priority high -duration 30s sum
+Ctrl+C提前结束，同样输出结果；所有请求都失败时退出码为1
+各层middleware的开销见pkg/endpoint的BenchmarkMiddlewares
+*/
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("loadgen", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var (
+		transportName = fs.String("transport", "grpc", "transport to call: grpc or http")
+		addr          = fs.String("addr", "", "instance address, default 127.0.0.1:8080 for grpc and 127.0.0.1:8081 for http")
+		rps           = fs.Float64("rps", 100, "target requests per second, 0 means as fast as possible")
+		duration      = fs.Duration("duration", 10*time.Second, "duration of the test")
+		concurrency   = fs.Int("concurrency", 16, "number of workers, also the max requests in flight")
+		callTimeout   = fs.Duration("call.timeout", time.Second, "timeout of each call, 0 means no limit")
+		token         = fs.String("token", "", "JWT bearer token, required when server enables auth")
+		noCache       = fs.Bool("no-cache", false, "skip the response cache of server")
+		priority      = fs.String("priority", "normal", "priority of calls: low, normal, high or critical")
+	)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: loadgen [flags] sum | concat")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	if *rps < 0 || *concurrency <= 0 || *duration <= 0 {
+		fmt.Fprintln(stderr, "rps must be >= 0, concurrency and duration must be > 0")
+		return 2
+	}
+
+	p, ok := loadshed.ParsePriority(*priority)
+	if !ok {
+		fmt.Fprintf(stderr, "unknown priority: %s\n", *priority)
+		return 2
+	}
+
+	var eps endpoint2.AddSvcEndpoints
+	var err error
+	tracer := stdopentracing.NoopTracer{}
+	switch *transportName {
+	case "grpc":
+		if *addr == "" {
+			*addr = "127.0.0.1:8080"
+		}
+		// 所有worker共用一个grpc连接(多路复用)
+		eps, err = transport.MakeClientEndpoints(*addr, tracer, log.NewNopLogger())
+	case "http":
+		if *addr == "" {
+			*addr = "127.0.0.1:8081"
+		}
+		// 默认每个host只保留2个空闲连接，并发高时会不断新建连接
+		client := &http.Client{Transport: &http.Transport{MaxIdleConnsPerHost: *concurrency}}
+		eps, err = transport.MakeHTTPClientEndpoints(*addr, client, tracer, log.NewNopLogger())
+	default:
+		fmt.Fprintf(stderr, "unknown transport: %s\n", *transportName)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	var do call
+	switch method := fs.Arg(0); method {
+	case "sum":
+		do = func(ctx context.Context) error { _, err := eps.Sum(ctx, 1, 2); return err }
+	case "concat":
+		do = func(ctx context.Context) error { _, err := eps.Concat(ctx, "a", "b"); return err }
+	default:
+		fmt.Fprintf(stderr, "unknown method: %s\n", method)
+		return 2
+	}
+	do = withCallOptions(do, *callTimeout, *token, *noCache, p)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sig)
+	go func() {
+		select {
+		case <-sig:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	fmt.Fprintf(stderr, "%s %s %s: rps=%g concurrency=%d duration=%s\n", *transportName, *addr, fs.Arg(0), *rps, *concurrency, *duration)
+	r := runLoad(ctx, do, *rps, *concurrency, *duration)
+	r.print(stdout)
+	if n := r.hist.TotalCount(); n > 0 && errCount(r) == n {
+		return 1
+	}
+	return 0
+}
+
+func withCallOptions(do call, timeout time.Duration, token string, noCache bool, priority loadshed.Priority) call {
+	return func(ctx context.Context) error {
+		ctx = loadshed.WithPriority(ctx, priority)
+		if token != "" {
+			ctx = auth.WithToken(ctx, token)
+		}
+		if noCache {
+			ctx = cache.WithBypass(ctx)
+		}
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		return do(ctx)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"github.com/go-kit/kit/log"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"gokit_foundation/chaos"
+	"gokit_foundation/errs"
+	"io/ioutil"
+	"net/http/httptest"
+	"new_addsvc/config"
+	"new_addsvc/pkg/endpoint"
+	"new_addsvc/pkg/service"
+	"new_addsvc/pkg/transport"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 参数错误时不会发出请求
+func TestRunBadArgs(t *testing.T) {
+	test := []struct {
+		name string
+		args []string
+	}{
+		{name: "[no args]"},
+		{name: "[unknown method]", args: []string{"mul"}},
+		{name: "[unknown transport]", args: []string{"-transport", "thrift", "sum"}},
+		{name: "[negative rps]", args: []string{"-rps", "-1", "sum"}},
+		{name: "[zero concurrency]", args: []string{"-concurrency", "0", "sum"}},
+		{name: "[unknown priority]", args: []string{"-priority", "urgent", "sum"}},
+	}
+	for _, tt := range test {
+		var stdout, stderr bytes.Buffer
+		if code := run(tt.args, &stdout, &stderr); code != 2 {
+			t.Errorf("name:%s got code:%d stderr:%s", tt.name, code, stderr.String())
+		}
+	}
+}
+
+// 按计划时间发送，rps*duration个请求
+func TestRunLoadRate(t *testing.T) {
+	r := runLoad(context.Background(), func(context.Context) error { return nil }, 200, 4, 250*time.Millisecond)
+	if n := r.hist.TotalCount(); n != 50 {
+		t.Errorf("got requests:%d", n)
+	}
+}
+
+func TestRunLoadErrors(t *testing.T) {
+	var i int64
+	do := func(context.Context) error {
+		// 只有一个worker，不需要加锁
+		if i++; i%2 == 0 {
+			return errs.ResourceExhausted("limited")
+		}
+		return nil
+	}
+	r := runLoad(context.Background(), do, 1000, 1, 10*time.Millisecond)
+	var buf bytes.Buffer
+	r.print(&buf)
+	if want := "requests: 10 ok: 5 errors: 5 (resource_exhausted=5)\n"; !strings.HasPrefix(buf.String(), want) || !strings.Contains(buf.String(), "p99.9=") {
+		t.Errorf("got:%s", buf.String())
+	}
+
+	// ctx取消时提前结束
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if r := runLoad(ctx, do, 0, 2, time.Minute); r.hist.TotalCount() != 0 {
+		t.Errorf("got requests:%d", r.hist.TotalCount())
+	}
+}
+
+func TestRunHTTP(t *testing.T) {
+	logger := log.NewNopLogger()
+	tracer := stdopentracing.NoopTracer{}
+	eps := endpoint.New(service.NewBasicService(logger), logger, tracer, endpoint.Deps{})
+	srv := httptest.NewServer(transport.NewHTTPHandler(eps, tracer, logger))
+	defer srv.Close()
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"-transport", "http", "-addr", srv.URL, "-rps", "100", "-duration", "100ms", "sum"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("got code:%d stderr:%s", code, stderr.String())
+	}
+	if !strings.HasPrefix(stdout.String(), "requests: 10 ok: 10 errors: 0\n") {
+		t.Errorf("got:%s", stdout.String())
+	}
+}
+
+// 过载保护的演示：low和high同时压测，low超过load_shed的阈值后被拒绝，high不受影响
+func TestRunPriority(t *testing.T) {
+	config.SetDynamicKV(map[string][]byte{
+		"load_shed/max_in_flight": []byte("10"),
+		"rate_limits/Sum":         []byte(`{"rps": 100000}`),
+	})
+	if err := config.ReloadDynamic(); err != nil {
+		t.Fatal(err)
+	}
+	// 每次调用20ms，使得请求处于处理中
+	if err := endpoint.DefaultChaos.Set(map[string]chaos.Fault{"Sum": {Latency: 20 * time.Millisecond, LatencyRate: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		endpoint.DefaultChaos.Set(nil)
+		config.SetDynamicKV(nil)
+		_ = config.ReloadDynamic()
+	}()
+	logger := log.NewNopLogger()
+	tracer := stdopentracing.NoopTracer{}
+	eps := endpoint.New(service.NewBasicService(logger), logger, tracer, endpoint.Deps{})
+	srv := httptest.NewServer(transport.NewHTTPHandler(eps, tracer, logger))
+	defer srv.Close()
+
+	// low最多6个处理中的请求，high最多3个，high被拒绝需要10个
+	var low, high bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		run([]string{"-transport", "http", "-addr", srv.URL, "-rps", "0", "-concurrency", "8", "-duration", "300ms", "-priority", "low", "sum"}, &low, ioutil.Discard)
+	}()
+	run([]string{"-transport", "http", "-addr", srv.URL, "-rps", "0", "-concurrency", "3", "-duration", "300ms", "-priority", "high", "sum"}, &high, ioutil.Discard)
+	<-done
+	if !strings.Contains(low.String(), "(unavailable=") {
+		t.Errorf("low got:%s", low.String())
+	}
+	if !strings.Contains(high.String(), " errors: 0\n") {
+		t.Errorf("high got:%s", high.String())
+	}
+}
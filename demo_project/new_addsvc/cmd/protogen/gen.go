@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"sort"
+	"text/template"
+)
+
+// genData 模板的输入
+type genData struct {
+	Source    string // proto文件名，写入生成文件的头部
+	PBPackage string // proto的package名
+	Service   string
+	Endpoints string // endpoint层Endpoints struct的名字
+	Methods   []method
+	Manual    []string // @kit: manual的rpc名，只生成Endpoints中的字段
+	EPImports []string
+	PBImport  string
+	EPImport  string // endpoint包的import路径
+	SvcImport string // service包的import路径
+}
+
+type method struct {
+	Name     string
+	Req, Rsp *message
+	RetCode  *field   // response中的返回码字段，由service返回的err转换得到(见errToRetCode)
+	Results  []*field // response中除了RetCode的字段，与service方法的返回值一一对应
+}
+
+// 生成的MakeXxxEndpoint中已使用的变量名
+var reservedVars = map[string]bool{"ctx": true, "request": true, "response": true, "req": true, "err": true, "s": true}
+
+// newGenData 收集所有一元rpc，retcode为response中返回码字段的proto名
+func newGenData(f *protoFile, source, retcode, epImport, svcImport string) (*genData, error) {
+	d := &genData{
+		Source:    source,
+		PBPackage: f.Package,
+		Service:   f.Service,
+		Endpoints: f.Service + "SvcEndpoints",
+		PBImport:  f.GoImport,
+		EPImport:  epImport,
+		SvcImport: svcImport,
+	}
+	imports := map[string]bool{}
+	for _, r := range f.RPCs {
+		if r.Streaming {
+			continue
+		}
+		if r.Manual {
+			d.Manual = append(d.Manual, r.Name)
+			continue
+		}
+		m := method{Name: r.Name, Req: f.Messages[r.Request], Rsp: f.Messages[r.Response]}
+		for _, fd := range append(append([]*field{}, m.Req.Fields...), m.Rsp.Fields...) {
+			if fd.Message {
+				return nil, fmt.Errorf("rpc %s: field %s is a message, which is only supported in the rpc with // @kit: manual", r.Name, fd.Name)
+			}
+		}
+		for _, fd := range m.Rsp.Fields {
+			if fd.Name == retcode {
+				m.RetCode = fd
+				continue
+			}
+			if reservedVars[fd.VarName()] {
+				return nil, fmt.Errorf("%s.%s: name is reserved by the generated code", m.Rsp.Name, fd.Name)
+			}
+			m.Results = append(m.Results, fd)
+		}
+		if m.RetCode == nil {
+			return nil, fmt.Errorf("rpc %s: response %s has no field %s", r.Name, m.Rsp.Name, retcode)
+		}
+		for _, fd := range append(append([]*field{}, m.Req.Fields...), m.Rsp.Fields...) {
+			if fd.GoImport != "" && fd.EPType() == fd.GoType {
+				imports[fd.GoImport] = true
+			}
+		}
+		d.Methods = append(d.Methods, m)
+	}
+	if len(d.Methods) == 0 {
+		return nil, fmt.Errorf("service %s has no unary rpc", f.Service)
+	}
+	for imp := range imports {
+		d.EPImports = append(d.EPImports, imp)
+	}
+	sort.Strings(d.EPImports)
+	return d, nil
+}
+
+func render(tmpl *template.Template, d *genData) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, d); err != nil {
+		return nil, err
+	}
+	b, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v\n%s", tmpl.Name(), err, buf.Bytes())
+	}
+	return b, nil
+}
+
+var endpointTmpl = template.Must(template.New("endpoint").Parse(`// Code generated by protogen from {{.Source}}. DO NOT EDIT.
+
+package endpoint
+
+import (
+	"context"
+	"github.com/go-kit/kit/endpoint"
+	"gokit_foundation/endpointx"
+	{{- range .EPImports}}
+	"{{.}}"
+	{{- end}}
+	service2 "{{.SvcImport}}"
+)
+
+// 以下Endpoint简称ep
+// Endpoints内包含的ep对应service每个接口，而且必须一致(流式接口除外，见transport.ConcatStream)
+// ep在RPC调用时，client调用的也是ep，对调用者隐藏了transport层
+type {{.Endpoints}} struct {
+{{- range .Methods}}
+	{{.Name}}Endpoint endpoint.Endpoint
+{{- end}}
+{{- if .Manual}}
+
+	// 以下ep没有对应的service方法，request/response手写
+{{- range .Manual}}
+	{{.}}Endpoint endpoint.Endpoint
+{{- end}}
+{{- end}}
+}
+{{range .Methods}}
+// {{.Name}}Request collects the request parameters for the {{.Name}} method.
+type {{.Name}}Request struct {
+{{- range .Req.Fields}}
+	{{.EPName}} {{.EPType}} {{.EPTag}}
+{{- end}}
+}
+
+// {{.Name}}Response collects the response values for the {{.Name}} method.
+type {{.Name}}Response struct {
+{{- range .Rsp.Fields}}
+	{{.EPName}} {{.EPType}} {{.EPTag}}
+{{- end}}
+}
+
+// Make{{.Name}}Endpoint returns an endpoint that invokes {{.Name}} on the service.
+// service返回的err转换为RetCode，见errToRetCode
+func Make{{.Name}}Endpoint(s service2.Service) endpoint.Endpoint {
+	return endpointx.New(func(ctx context.Context, {{if .Req.Fields}}req{{else}}_{{end}} *{{.Name}}Request) (*{{.Name}}Response, error) {
+		{{range .Results}}{{.VarName}}, {{end}}err := s.{{.Name}}(ctx{{range .Req.Fields}}, req.{{.EPName}}{{end}})
+		return &{{.Name}}Response{ {{- range .Results}}{{.EPName}}: {{.VarName}}, {{end}}{{.RetCode.EPName}}: errToRetCode(err)}, nil
+	})
+}
+
+func (r *{{.Name}}Response) GetRetCode() string {
+	return r.{{.RetCode.EPName}}.String()
+}
+{{end}}`))
+
+var transportTmpl = template.Must(template.New("transport").Parse(`// Code generated by protogen from {{.Source}}. DO NOT EDIT.
+
+package transport
+
+import (
+	"context"
+	pb "{{.PBImport}}"
+	endpoint2 "{{.EPImport}}"
+)
+
+// 由proto文件中的package名和service名组合得到
+const gRPCSvrName = "{{.PBPackage}}.{{.Service}}"
+{{range .Methods}}
+// decodeGRPC{{.Name}}Request is a transport/grpc.DecodeRequestFunc that converts a
+// gRPC {{.Name}} request to a user-domain {{.Name}} request. Primarily useful in a server.
+func decodeGRPC{{.Name}}Request(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	{{- if .Req.Fields}}
+	req := grpcReq.(*pb.{{.Req.Name}})
+	{{- end}}
+	return &endpoint2.{{.Name}}Request{ {{- range $i, $f := .Req.Fields}}{{if $i}}, {{end}}{{$f.EPName}}: {{$f.ToEP (print "req." $f.PBName)}}{{end -}} }, nil
+}
+
+// encodeGRPC{{.Name}}Response is a transport/grpc.EncodeResponseFunc that converts a
+// user-domain {{.Name}} response to a gRPC {{.Name}} reply. Primarily useful in a server.
+func encodeGRPC{{.Name}}Response(_ context.Context, response interface{}) (interface{}, error) {
+	resp := response.(*endpoint2.{{.Name}}Response)
+	return &pb.{{.Rsp.Name}}{ {{- range $i, $f := .Rsp.Fields}}{{if $i}}, {{end}}{{$f.PBName}}: {{$f.ToPB (print "resp." $f.EPName)}}{{end -}} }, nil
+}
+
+// encodeGRPC{{.Name}}Request is a transport/grpc.EncodeRequestFunc that converts a
+// user-domain {{.Name}} request to a gRPC {{.Name}} request. Primarily useful in a client.
+func encodeGRPC{{.Name}}Request(_ context.Context, request interface{}) (interface{}, error) {
+	{{- if .Req.Fields}}
+	req := request.(*endpoint2.{{.Name}}Request)
+	{{- end}}
+	return &pb.{{.Req.Name}}{ {{- range $i, $f := .Req.Fields}}{{if $i}}, {{end}}{{$f.PBName}}: {{$f.ToPB (print "req." $f.EPName)}}{{end -}} }, nil
+}
+
+// decodeGRPC{{.Name}}Response is a transport/grpc.DecodeResponseFunc that converts a
+// gRPC {{.Name}} reply to a user-domain {{.Name}} response. Primarily useful in a client.
+func decodeGRPC{{.Name}}Response(_ context.Context, grpcReply interface{}) (interface{}, error) {
+	reply := grpcReply.(*pb.{{.Rsp.Name}})
+	return &endpoint2.{{.Name}}Response{ {{- range $i, $f := .Rsp.Fields}}{{if $i}}, {{end}}{{$f.EPName}}: {{$f.ToEP (print "reply." $f.PBName)}}{{end -}} }, nil
+}
+{{end}}`))
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+/*
+protogen 根据proto文件生成endpoint层和grpc transport层的重复代码，避免修改proto后手写代码与pb不一致：
+-	endpoint：AddSvcEndpoints、XxxRequest/XxxResponse、MakeXxxEndpoint、GetRetCode
+-	transport：gRPCSvrName，以及server和client侧的decode/encode函数
+
+endpoint struct的字段与proto字段一一对应，字段末尾的 "// @kit: ..." 注释可以指定endpoint中的字段名、go类型和struct tag，见field.Kit
+response中的retcode字段由service返回的err转换得到，其他字段依次对应service方法的返回值
+
+通过go generate调用(见pkg/endpoint/0.protocol.go)：
+	go generate ./pkg/endpoint/
+*/
+
+var fs = flag.NewFlagSet("protogen", flag.ExitOnError)
+var (
+	protoPath    = fs.String("proto", "", "proto file, imported files are searched in the same directory")
+	endpointOut  = fs.String("endpoint", "", "output file of the endpoint package")
+	transportOut = fs.String("transport", "", "output file of the grpc transport package")
+	svcPkg       = fs.String("service.pkg", "", "import path of the service package, default sibling dir 'service' of the endpoint package")
+	retcode      = fs.String("retcode", "retcode", "response field which holds the result code converted from the service error")
+)
+
+func main() {
+	fs.Parse(os.Args[1:])
+	if *protoPath == "" || *endpointOut == "" || *transportOut == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if err := run(*protoPath, *endpointOut, *transportOut, *svcPkg, *retcode); err != nil {
+		fmt.Fprintln(os.Stderr, "protogen:", err)
+		os.Exit(1)
+	}
+}
+
+func run(protoPath, endpointOut, transportOut, svcPkg, retcode string) error {
+	out, err := generate(protoPath, endpointOut, transportOut, svcPkg, retcode)
+	if err != nil {
+		return err
+	}
+	for path, b := range out {
+		if err := ioutil.WriteFile(path, b, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// generate 返回 输出文件=>内容
+func generate(protoPath, endpointOut, transportOut, svcPkg, retcode string) (map[string][]byte, error) {
+	f, err := parseProto(protoPath)
+	if err != nil {
+		return nil, err
+	}
+	epImport, err := importPath(filepath.Dir(endpointOut))
+	if err != nil {
+		return nil, err
+	}
+	if svcPkg == "" {
+		svcPkg = filepath.ToSlash(filepath.Join(filepath.Dir(epImport), "service"))
+	}
+	d, err := newGenData(f, filepath.Base(protoPath), retcode, epImport, svcPkg)
+	if err != nil {
+		return nil, err
+	}
+	ep, err := render(endpointTmpl, d)
+	if err != nil {
+		return nil, err
+	}
+	tp, err := render(transportTmpl, d)
+	if err != nil {
+		return nil, err
+	}
+	return map[string][]byte{endpointOut: ep, transportOut: tp}, nil
+}
+
+var moduleRe = regexp.MustCompile(`(?m)^module\s+(\S+)`)
+
+// importPath 向上查找go.mod，返回dir的import路径
+func importPath(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for root := abs; ; {
+		if b, err := ioutil.ReadFile(filepath.Join(root, "go.mod")); err == nil {
+			m := moduleRe.FindSubmatch(b)
+			if m == nil {
+				return "", fmt.Errorf("%s: no module directive", filepath.Join(root, "go.mod"))
+			}
+			rel, err := filepath.Rel(root, abs)
+			if err != nil {
+				return "", err
+			}
+			return filepath.ToSlash(filepath.Join(string(bytes.TrimSpace(m[1])), rel)), nil
+		}
+		parent := filepath.Dir(root)
+		if parent == root {
+			return "", errors.New("go.mod not found for " + dir)
+		}
+		root = parent
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// 生成的代码与仓库中的一致，修改proto后忘记执行go generate时失败
+func TestGeneratedUpToDate(t *testing.T) {
+	endpointOut, transportOut := "../../pkg/endpoint/0.protocol_gen.go", "../../pkg/transport/grpc_gen.go"
+	out, err := generate("../../pb/proto/addsvc.proto", endpointOut, transportOut, "", "retcode")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range out {
+		got, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s is out of date, run: go generate ./pkg/endpoint/", path)
+		}
+	}
+}
+
+func TestParseProto(t *testing.T) {
+	f, err := parseProto("../../pb/proto/addsvc.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Package != "addsvcpb" || f.Service != "Add" || f.GoImport != "new_addsvc/pb/gen-go/addsvcpb" || len(f.RPCs) != 6 || !f.RPCs[2].Streaming || !f.RPCs[4].Streaming || !f.RPCs[5].Manual {
+		t.Errorf("got file:%+v", f)
+	}
+	retcode := f.Messages["SumReply"].Fields[1]
+	if retcode.GoType != "resultcode.RESULT_CODE" || retcode.GoImport != "new_addsvc/pb/gen-go/resultcode" ||
+		retcode.EPName() != "RetCode" || retcode.EPTag() != "`json:\"ret_code\"`" {
+		t.Errorf("got retcode:%+v", retcode)
+	}
+	a := f.Messages["SumRequest"].Fields[0]
+	if a.ToEP("req.A") != "int(req.A)" || a.ToPB("req.A") != "int64(req.A)" ||
+		a.EPTag() != "`json:\"a\" validate:\"min=-9007199254740991,max=9007199254740991\"`" {
+		t.Errorf("got a:%+v tag:%s", a, a.EPTag())
+	}
+	if items := f.Messages["BatchSumRequest"].Fields[0]; !items.Message || items.GoType != "[]*SumRequest" {
+		t.Errorf("got items:%+v", items)
+	}
+
+	dir, err := ioutil.TempDir("", "protogen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	const head = "syntax = \"proto3\";\npackage p;\noption go_package = \"x/p;p\";\n"
+	for name, src := range map[string]string{
+		"nested":       "message A {\n  message B {}\n}",
+		"map":          "message A {\n  map<string, int64> m = 1;\n}",
+		"message":      "message A {\n  p.B b = 1;\n}\nmessage B {}",
+		"no message":   "service S {\n  rpc Get (GetRequest) returns (GetReply);\n}",
+		"unclosed":     "message A {\n  int64 a = 1;",
+		"two service":  "service S {}\nservice T {}",
+		"rpc body":     "service S {\n  rpc Get (A) returns (A) {\n    int64 a = 1;\n  }\n}\nmessage A {}",
+		"rpc option":   "service S {\n  rpc Get (A) returns (A) {\n    option (google.api.http) = {\n  }\n}\nmessage A {}",
+		"unclosed rpc": "service S {\n  rpc Get (A) returns (A) {\n}\nmessage A {}",
+	} {
+		path := filepath.Join(dir, "a.proto")
+		if err := ioutil.WriteFile(path, []byte(head+src), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := parseProto(path); err == nil {
+			t.Errorf("%s want err", name)
+		}
+	}
+}
+
+func TestGoCamelCase(t *testing.T) {
+	for in, want := range map[string]string{"retcode": "Retcode", "user_id": "UserId", "RESULT_CODE": "RESULT_CODE", "a1b": "A1B", "_x": "XX"} {
+		if got := goCamelCase(in); got != want {
+			t.Errorf("goCamelCase(%s) got:%s want:%s", in, got, want)
+		}
+	}
+}
+
+func TestNewGenData(t *testing.T) {
+	f, err := parseProto("../../pb/proto/addsvc.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newGenData(f, "addsvc.proto", "code", "x/endpoint", "x/service"); err == nil || !strings.Contains(err.Error(), "no field code") {
+		t.Errorf("got err:%v", err)
+	}
+	d, err := newGenData(f, "addsvc.proto", "retcode", "x/endpoint", "x/service")
+	if err != nil || len(d.Methods) != 2 || len(d.Manual) != 1 || d.Manual[0] != "BatchSum" {
+		t.Errorf("got data:%+v err:%v", d, err)
+	}
+
+	// 没有@kit: manual的rpc不能使用message类型的字段
+	f.RPCs[5].Manual = false
+	if _, err := newGenData(f, "addsvc.proto", "retcode", "x/endpoint", "x/service"); err == nil || !strings.Contains(err.Error(), "only supported") {
+		t.Errorf("got err:%v", err)
+	}
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+/*
+只解析本项目proto文件用到的语法子集(每行一条语句)：
+-	package、import、option go_package，google/下的import(如google/api/annotations.proto)不解析
+-	顶层enum和message，message的字段为标量、enum(可以是import的enum)或本文件的message
+-	service和rpc，流式rpc会被跳过(它们不经过grpctransport，见transport.ConcatStream)
+-	rpc的option(如grpc-gateway的google.api.http)写在rpc块中，每个option一行，不影响生成的代码
+-	rpc末尾有 "// @kit: manual" 注释时只生成Endpoints中的字段，其他代码手写(见endpoint.MakeBatchSumEndpoint)，
+	message类型的字段只能在这种rpc中使用
+不支持嵌套message、oneof、map，遇到时返回错误
+*/
+
+// protoFile 一个proto文件的解析结果
+type protoFile struct {
+	Package   string
+	GoImport  string // go_package的import路径
+	GoPkgName string
+	Enums     map[string]bool
+	Messages  map[string]*message
+	Service   string
+	RPCs      []rpc
+	Imports   []*protoFile
+}
+
+type message struct {
+	Name   string
+	Fields []*field
+}
+
+type field struct {
+	Name     string // proto中的字段名
+	Type     string // proto类型
+	Repeated bool
+	Message  bool // 类型为本文件的message
+	// 由字段末尾的 "// @kit: ..." 注释解析得到，格式与struct tag相同：
+	// 	name  endpoint中的字段名，默认与pb字段名相同
+	// 	type  endpoint中的go类型，默认与pb字段类型相同，不同时生成类型转换
+	// 	其他  原样作为endpoint struct的tag，未指定json时使用proto字段名
+	Kit reflect.StructTag
+
+	GoType   string // pb中的go类型
+	GoImport string // GoType需要的import路径，为空表示不需要
+}
+
+type rpc struct {
+	Name              string
+	Request, Response string
+	Streaming         bool
+	Manual            bool // 见 @kit: manual
+}
+
+// pb中的字段名，规则与protoc-gen-go一致
+func (f *field) PBName() string { return goCamelCase(f.Name) }
+
+func (f *field) EPName() string {
+	if n := f.Kit.Get("name"); n != "" {
+		return n
+	}
+	return f.PBName()
+}
+
+func (f *field) EPType() string {
+	if t := f.Kit.Get("type"); t != "" {
+		return t
+	}
+	return f.GoType
+}
+
+// endpoint struct的tag，保持@kit注释中的顺序
+func (f *field) EPTag() string {
+	var tags []string
+	if f.Kit.Get("json") == "" {
+		tags = append(tags, fmt.Sprintf("json:%q", f.Name))
+	}
+	for _, kv := range kitTagRe.FindAllStringSubmatch(string(f.Kit), -1) {
+		if kv[1] != "name" && kv[1] != "type" {
+			tags = append(tags, kv[0])
+		}
+	}
+	return "`" + strings.Join(tags, " ") + "`"
+}
+
+// 调用service方法时使用的变量名，如retcode => retcode，user_id => userId
+func (f *field) VarName() string {
+	n := goCamelCase(f.Name)
+	return strings.ToLower(n[:1]) + n[1:]
+}
+
+// v为pb字段的值，转为endpoint的类型
+func (f *field) ToEP(v string) string {
+	if f.EPType() != f.GoType {
+		return f.EPType() + "(" + v + ")"
+	}
+	return v
+}
+
+// v为endpoint字段的值，转为pb的类型
+func (f *field) ToPB(v string) string {
+	if f.EPType() != f.GoType {
+		return f.GoType + "(" + v + ")"
+	}
+	return v
+}
+
+var kitTagRe = regexp.MustCompile(`(\w+):"((?:[^"\\]|\\.)*)"`)
+
+var scalarTypes = map[string]string{
+	"double": "float64", "float": "float32",
+	"int32": "int32", "int64": "int64", "uint32": "uint32", "uint64": "uint64",
+	"sint32": "int32", "sint64": "int64", "fixed32": "uint32", "fixed64": "uint64",
+	"sfixed32": "int32", "sfixed64": "int64",
+	"bool": "bool", "string": "string", "bytes": "[]byte",
+}
+
+var (
+	packageRe   = regexp.MustCompile(`^package\s+([\w.]+)\s*;`)
+	importRe    = regexp.MustCompile(`^import\s+(?:public\s+|weak\s+)?"([^"]+)"\s*;`)
+	goPackageRe = regexp.MustCompile(`^option\s+go_package\s*=\s*"([^"]+)"\s*;`)
+	blockRe     = regexp.MustCompile(`^(message|enum|service)\s+(\w+)\s*\{\s*(\})?$`)
+	fieldRe     = regexp.MustCompile(`^(repeated\s+)?([\w.]+)\s+(\w+)\s*=\s*\d+\s*(\[[^\]]*\])?\s*;$`)
+	rpcRe       = regexp.MustCompile(`^rpc\s+(\w+)\s*\(\s*(stream\s+)?([\w.]+)\s*\)\s*returns\s*\(\s*(stream\s+)?([\w.]+)\s*\)\s*(\{\s*\}|;|\{)$`)
+)
+
+// parseProto 解析path，import的文件从path所在目录查找
+func parseProto(path string) (*protoFile, error) {
+	f, err := parseFile(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range f.Messages {
+		for _, fd := range m.Fields {
+			if err := f.resolve(fd); err != nil {
+				return nil, fmt.Errorf("%s: %s.%s: %v", path, m.Name, fd.Name, err)
+			}
+		}
+	}
+	for _, r := range f.RPCs {
+		for _, name := range []string{r.Request, r.Response} {
+			if f.Messages[name] == nil {
+				return nil, fmt.Errorf("%s: rpc %s: message %s not found in this file", path, r.Name, name)
+			}
+		}
+	}
+	return f, nil
+}
+
+func parseFile(path string) (*protoFile, error) {
+	fp, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	f := &protoFile{Enums: map[string]bool{}, Messages: map[string]*message{}}
+	var (
+		block     string // 当前所在的块：message、enum、service，以及service中的rpc
+		msg       *message
+		inComment bool
+		lineNo    int
+	)
+	sc := bufio.NewScanner(fp)
+	for sc.Scan() {
+		lineNo++
+		line := strings.TrimSpace(sc.Text())
+		if inComment {
+			end := strings.Index(line, "*/")
+			if end < 0 {
+				continue
+			}
+			inComment = false
+			line = strings.TrimSpace(line[end+2:])
+		}
+		if strings.HasPrefix(line, "/*") {
+			if !strings.Contains(line, "*/") {
+				inComment = true
+			}
+			continue
+		}
+		var comment string
+		if i := strings.Index(line, "//"); i >= 0 {
+			line, comment = strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+2:])
+		}
+		if line == "" {
+			continue
+		}
+		errorf := func(format string, a ...interface{}) error {
+			return fmt.Errorf("%s:%d: %s", path, lineNo, fmt.Sprintf(format, a...))
+		}
+
+		switch block {
+		case "":
+			if m := packageRe.FindStringSubmatch(line); m != nil {
+				f.Package = m[1]
+			} else if m := importRe.FindStringSubmatch(line); m != nil {
+				if strings.HasPrefix(m[1], "google/") {
+					continue
+				}
+				imp, err := parseFile(filepath.Join(filepath.Dir(path), m[1]))
+				if err != nil {
+					return nil, err
+				}
+				f.Imports = append(f.Imports, imp)
+			} else if m := goPackageRe.FindStringSubmatch(line); m != nil {
+				f.GoImport, f.GoPkgName = splitGoPackage(m[1])
+			} else if m := blockRe.FindStringSubmatch(line); m != nil {
+				switch m[1] {
+				case "message":
+					msg = &message{Name: m[2]}
+					f.Messages[m[2]] = msg
+				case "enum":
+					f.Enums[m[2]] = true
+				case "service":
+					if f.Service != "" {
+						return nil, errorf("only one service is supported")
+					}
+					f.Service = m[2]
+				}
+				if m[3] == "" {
+					block = m[1]
+				}
+			} else if !strings.HasPrefix(line, "syntax") && !strings.HasPrefix(line, "option") {
+				return nil, errorf("unsupported statement %q", line)
+			}
+		case "message":
+			if line == "}" {
+				block, msg = "", nil
+				continue
+			}
+			m := fieldRe.FindStringSubmatch(line)
+			if m == nil {
+				return nil, errorf("unsupported message field %q (nested message, oneof and map are not supported)", line)
+			}
+			fd := &field{Repeated: m[1] != "", Type: m[2], Name: m[3]}
+			if strings.HasPrefix(comment, "@kit:") {
+				fd.Kit = reflect.StructTag(strings.TrimSpace(strings.TrimPrefix(comment, "@kit:")))
+			}
+			msg.Fields = append(msg.Fields, fd)
+		case "enum":
+			if line == "}" {
+				block = ""
+			}
+		case "service":
+			if line == "}" {
+				block = ""
+				continue
+			}
+			m := rpcRe.FindStringSubmatch(line)
+			if m == nil {
+				return nil, errorf("unsupported rpc %q", line)
+			}
+			f.RPCs = append(f.RPCs, rpc{Name: m[1], Request: m[3], Response: m[5], Streaming: m[2] != "" || m[4] != "",
+				Manual: comment == "@kit: manual"})
+			if m[6] == "{" {
+				block = "rpc"
+			}
+		case "rpc":
+			if line == "}" {
+				block = "service"
+			} else if !strings.HasPrefix(line, "option") || !strings.HasSuffix(line, ";") {
+				return nil, errorf("unsupported rpc option %q", line)
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if block != "" || inComment {
+		return nil, fmt.Errorf("%s: unexpected EOF", path)
+	}
+	if f.GoImport == "" {
+		return nil, fmt.Errorf("%s: option go_package is required", path)
+	}
+	return f, nil
+}
+
+// resolve 设置字段在pb中的go类型
+func (f *protoFile) resolve(fd *field) error {
+	goType, goImport := scalarTypes[fd.Type], ""
+	if goType == "" && f.Messages[fd.Type] != nil {
+		goType, fd.Message = "*"+goCamelCase(fd.Type), true
+	}
+	if goType == "" {
+		var ok bool
+		goType, goImport, ok = f.enumType(fd.Type)
+		if !ok {
+			return fmt.Errorf("unsupported type %s, want scalar, enum or message", fd.Type)
+		}
+	}
+	if fd.Repeated {
+		if fd.Kit.Get("type") != "" {
+			return fmt.Errorf("@kit type is not supported on repeated field")
+		}
+		goType = "[]" + goType
+	}
+	fd.GoType, fd.GoImport = goType, goImport
+	return nil
+}
+
+// enumType 查找enum，typ为本文件的enum名或 import的package.enum名
+func (f *protoFile) enumType(typ string) (goType, goImport string, ok bool) {
+	if f.Enums[typ] {
+		return goCamelCase(typ), "", true
+	}
+	if i := strings.LastIndex(typ, "."); i > 0 {
+		for _, imp := range f.Imports {
+			if imp.Package == typ[:i] && imp.Enums[typ[i+1:]] {
+				return imp.GoPkgName + "." + goCamelCase(typ[i+1:]), imp.GoImport, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// new_addsvc/pb/gen-go/addsvcpb;addsvcpb => import路径、包名
+func splitGoPackage(s string) (string, string) {
+	if i := strings.Index(s, ";"); i >= 0 {
+		return s[:i], s[i+1:]
+	}
+	return s, filepath.Base(s)
+}
+
+// goCamelCase 与protoc-gen-go的命名规则一致：user_id => UserId，RESULT_CODE => RESULT_CODE
+func goCamelCase(s string) string {
+	var b []byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '.' && i+1 < len(s) && isLower(s[i+1]):
+		case c == '.':
+			b = append(b, '_')
+		case c == '_' && (i == 0 || s[i-1] == '.'):
+			b = append(b, 'X')
+		case c == '_' && i+1 < len(s) && isLower(s[i+1]):
+		case '0' <= c && c <= '9':
+			b = append(b, c)
+		default:
+			if isLower(c) {
+				c -= 'a' - 'A'
+			}
+			b = append(b, c)
+			for ; i+1 < len(s) && isLower(s[i+1]); i++ {
+				b = append(b, s[i+1])
+			}
+		}
+	}
+	return string(b)
+}
+
+func isLower(c byte) bool { return 'a' <= c && c <= 'z' }
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"gokit_foundation/slo"
+	"io/ioutil"
+	"new_addsvc/internal"
+	"new_addsvc/pkg/endpoint"
+	"os"
+)
+
+/*
+slogen 根据endpoint层声明的SLO(见pkg/endpoint.SLOs)生成prometheus的recording/alerting rules，
+告警规则与接口定义放在一起，新增或修改接口的SLO后重新生成，不需要手工维护告警：
+	go generate ./pkg/endpoint/
+生成的文件通过prometheus的rule_files加载，k8s中可以放入prometheus-operator的PrometheusRule
+*/
+
+var fs = flag.NewFlagSet("slogen", flag.ExitOnError)
+var (
+	out   = fs.String("out", "", "output rule file")
+	check = fs.Bool("check", false, "exit with 1 if the output file is out of date instead of writing it")
+)
+
+func main() {
+	fs.Parse(os.Args[1:])
+	if *out == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if err := run(*out, *check); err != nil {
+		fmt.Fprintln(os.Stderr, "slogen:", err)
+		os.Exit(1)
+	}
+}
+
+func run(out string, check bool) error {
+	b, err := generate()
+	if err != nil {
+		return err
+	}
+	if check {
+		old, err := ioutil.ReadFile(out)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(old, b) {
+			return fmt.Errorf("%s is out of date, run: go generate ./pkg/endpoint/", out)
+		}
+		return nil
+	}
+	return ioutil.WriteFile(out, b, 0644)
+}
+
+// service label与指标的subsystem相同
+func generate() ([]byte, error) {
+	return slo.Rules("addsvc", slo.Metric{Name: internal.DurationMetric, Buckets: internal.DurationBuckets}, endpoint.SLOs)
+}
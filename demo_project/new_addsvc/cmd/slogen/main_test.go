@@ -0,0 +1,29 @@
+package main
+
+import (
+	"new_addsvc/pkg/endpoint"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// 生成的规则与仓库中的一致，修改SLO后忘记执行go generate时失败
+func TestGeneratedUpToDate(t *testing.T) {
+	if err := run("../../deploy/slo_rules.yaml", true); err != nil {
+		t.Error(err)
+	}
+}
+
+// 每个接口都声明了SLO
+func TestSLOsCoverEndpoints(t *testing.T) {
+	declared := map[string]bool{}
+	for _, o := range endpoint.SLOs {
+		declared[o.Method] = true
+	}
+	typ := reflect.TypeOf(endpoint.AddSvcEndpoints{})
+	for i := 0; i < typ.NumField(); i++ {
+		if method := strings.TrimSuffix(typ.Field(i).Name, "Endpoint"); !declared[method] {
+			t.Errorf("no SLO declared for %s", method)
+		}
+	}
+}
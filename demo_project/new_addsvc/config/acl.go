@@ -0,0 +1,20 @@
+package config
+
+/*
+接口级别的访问控制规则，与GetRedisConf一样，可以从配置文件/第三方kv存储中读取，这里忽略读取过程...
+*/
+
+// 单个接口的规则，角色在Deny中则拒绝，否则必须在Allow中才允许("*"表示任意角色)
+type ACLRule struct {
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+}
+
+// 接口名 => 规则，未配置规则的接口不做限制
+// 角色由认证中间件从token的role claim中读取(见GetAuthConf)，认证默认关闭，所以默认不配置任何规则，否则配置了规则的接口都会被拒绝
+func GetACLRules() map[string]ACLRule {
+	return map[string]ACLRule{
+		// e.g. 只允许admin调用Concat
+		// "Concat": {Allow: []string{"admin"}},
+	}
+}
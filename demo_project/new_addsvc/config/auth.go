@@ -0,0 +1,28 @@
+package config
+
+/*
+JWT认证配置，与GetRedisConf一样，可以从配置文件/第三方kv存储中读取，这里忽略读取过程...
+*/
+
+type AuthConf struct {
+	// 关闭时不做认证，ctx中也就没有角色，此时配置了ACL规则的接口都会被拒绝
+	Enable bool
+	// 签名key的来源，KeyFile不为空时从文件读取，否则从环境变量KeyEnv读取
+	KeyFile string
+	KeyEnv  string
+	// 不为空时，token中的iss必须与之相等
+	Issuer string
+	// 不需要认证的接口名
+	Allowlist []string
+}
+
+func GetAuthConf() AuthConf {
+	return AuthConf{
+		// 默认关闭，开启后client需要在metadata/header中携带 Authorization: Bearer <token>
+		Enable: false,
+		KeyEnv: "ADDSVC_JWT_KEY",
+		Issuer: "addsvc",
+		// e.g. Sum不需要认证
+		// Allowlist: []string{"Sum"},
+	}
+}
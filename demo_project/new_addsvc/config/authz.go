@@ -0,0 +1,27 @@
+package config
+
+/*
+接口级别的权限(见gokit_foundation/authz)，与ACL的区别是按权限而不是角色声明：
+每个接口需要的权限见endpoint.Permissions，这里配置角色被授予哪些权限，或者交给OPA决定
+*/
+
+type AuthzConf struct {
+	// 需要同时开启认证(GetAuthConf)，否则ctx中没有claims，所有接口都会被拒绝
+	Enable bool
+	// 角色 => 授予的权限，可以使用通配符(如addsvc.*:invoke)；token的permissions/scope中的权限同样有效
+	Roles map[string][]string
+	// 不为空时由OPA的Data API决定，如http://127.0.0.1:8181/v1/data/addsvc/authz/allow
+	OPAURL string
+}
+
+func GetAuthzConf() AuthzConf {
+	return AuthzConf{
+		// 默认关闭
+		Enable: false,
+		Roles: map[string][]string{
+			"admin": {"addsvc.*:invoke"},
+			// e.g. 普通用户只能调用Sum
+			// "user": {"addsvc.sum:invoke"},
+		},
+	}
+}
@@ -0,0 +1,1002 @@
+package config
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"gokit_foundation"
+	"gokit_foundation/deadletter"
+	"gokit_foundation/dedup"
+	"gokit_foundation/errs"
+	"gokit_foundation/events"
+	"gokit_foundation/metricspush"
+	"gokit_foundation/metricsx"
+	"gokit_foundation/mtls"
+	"gokit_foundation/tracing"
+	"gopkg.in/yaml.v2"
+	"io"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+启动配置，只在启动时读取一次，修改后需要重启服务(可热更新的配置见Dynamic)
+每一项都可以通过以下方式设置，优先级从低到高(后者覆盖前者)：
+	1. 默认值，见defBootstrap
+	2. 配置文件(yaml/json，根据扩展名判断)，路径由 -config 或环境变量 ADDSVC_CONFIG 指定
+	3. 环境变量，如 ADDSVC_GRPC_PORT
+	4. 命令行参数，如 -grpc.port
+各项的文件字段名、环境变量、参数名见bootstrapOptions
+*/
+
+type Bootstrap struct {
+	ListenHost     string
+	AdvertiseHost  string // 为空时自动探测，见ResolveAdvertiseHost
+	AdvertiseIface string
+	GRPCPort       int
+	GRPC           gokit_foundation.GRPCServerConfig // keepalive、消息大小限制，见gokit_foundation.GRPCServerBuilder
+	HTTPPort       int
+	HTTP           gokit_foundation.HTTPServerConfig // 超时、最大连接数、h2c，见gokit_foundation.NewHTTPServer
+	CompressLevel  int                               // gzip/deflate的压缩级别(1~9)，为0时使用默认级别，http响应和grpc共用(grpc只在client启用gzip时压缩)
+	CompressMin    int                               // http响应达到这个字节数才压缩，为0时使用transport.DefaultCompressMinSize
+	AdminPort      int                               // 管理端口(pprof、日志级别、故障注入等，见gokit_foundation.AdminServer)，为0时不启用
+	ThriftPort     int                               // 为0时不启用thrift transport
+	GRPCWebPort    int                               // 为0时不启用grpc-web(浏览器直接调用grpc接口)，见gokit_foundation.NewGRPCWebHandler
+	GRPCWebOrigins string                            // 逗号分隔，允许跨域调用grpc-web的Origin，*表示全部，为空时只允许同源的页面
+	GRPCWebSocket  bool                              // grpc-web通过websocket支持客户端流和双向流
+	SDBackend      string                            // consul、etcd或k8s
+	ConsulAddr     string
+	EtcdAddr       string
+	Zone           string        // 实例所在的可用区，注册到consul时作为tag(zone=xx)和meta
+	ConsulTags     string        // 逗号分隔，注册到consul的其他tag
+	ConsulMeta     string        // 逗号分隔的k=v，注册到consul的其他meta
+	ConsulCheckTTL time.Duration // 大于0时使用TTL检查代替grpc健康检查，见gokit_foundation.ConsulRegisterOptions
+	ConsulWeight   int           // 健康时的权重，为0时使用consul的默认值
+	ConsulProbe    time.Duration // 大于0时启动前主动探测consul agent能否访问advertise地址，最多等这么久，见gokit_foundation.ConsulProbe
+	DeployColor    string        // 蓝绿部署的分组(blue或green)，注册到consul时作为tag，并以<SvcName>-<color>再注册一次
+	LameDuck       time.Duration // 注销后等待client刷新实例列表的时间，见gokit_foundation.Drainer
+	StopTimeout    time.Duration
+	PreStopDelay   time.Duration   // 收到退出信号后继续正常服务的时间，等待k8s摘除endpoints后再下线，见_util.SignalOptions
+	UpgradeTimeout time.Duration   // 收到SIGUSR2后等待新进程就绪的最长时间，见gokit_foundation.Upgrader
+	UpgradeWarmup  time.Duration   // 平滑升级启动的新进程先以权重1注册到consul，过了这么久再恢复ConsulWeight，0表示不预热
+	DepsMode       string          // 启动时强依赖不可用：strict不启动，lenient(本地开发)与弱依赖一样只打印日志并在后台重试，见gokit_foundation.Dependencies
+	WarmupTimeout  time.Duration   // 服务开始监听后、注册前预热(预先建立redis连接、预热缓存、自己调用接口)的最长时间，0表示不预热
+	WarmupConns    int             // 预热时预先建立的redis连接数
+	WarmupRequests int             // 预热时自己调用Sum、Concat的次数，0表示不调用
+	Metrics        metricsx.Config // 指标后端，默认为prometheus
+	MetricsBuffer  int
+	MetricsPush    metricspush.Config // pushgateway地址为空时不推送，只提供/metrics拉取
+	Pprof          bool
+	GRPCReflection bool   // 注册grpc reflection服务，grpcurl/evans等工具不需要proto文件即可调用
+	GRPCGateway    bool   // 在http端口的/v1/下提供grpc-gateway生成的REST接口，见transport.NewGRPCGatewayHandler
+	Mesh           bool   // 运行在Envoy sidecar后面，把入站请求的trace header传给下游，见gokit_foundation/mesh
+	ErrorMap       string // 错误到grpc code、http status的映射，覆盖按Kind的默认映射，格式见errs.ParseMapper
+	DynamicConf    string
+	DynamicConsul  string         // consul KV中可热更新配置的prefix，与DynamicConf二选一
+	Tracing        tracing.Config // opentracing后端(jaeger、zipkin或otlp)，所选后端未配置上报地址时不启用
+	NATSURL        string         // 为空时不启用NATS transport
+	SQSQueueURL    string         // 为空时不启用SQS transport
+	SQSEndpoint    string         // 兼容SQS API的本地模拟器(如ElasticMQ)地址，为空时使用AWS
+	SQSRegion      string         // 使用模拟器时可以为任意值
+	SQSDeadLetter  string         // 死信队列url，为空时不转移，由队列的redrive policy处理(见sqstransport.ConsumerDeadLetter)
+	SQSJournal     string         // 本地journal文件，崩溃后恢复处理中的消息(见journal.Journal)，为空时不启用
+	NATSDeadLetter bool           // 不带reply的NATS消息处理失败时重试或发布到<subject>.dlq
+	DLQMaxAttempts int            // 包括第一次处理，超过后进入死信队列
+	DedupWindows   string         // 每个consumer group(sqs、nats)的去重窗口，格式见dedup.ParseWindows，为空时不去重
+	DedupStore     string         // 去重记录的存储：redis(多个实例共同去重)或memory(只在本实例内)
+	KafkaBrokers   string         // 逗号分隔，为空时不发布领域事件
+	KafkaTopic     string         // 默认topic，KafkaTopics中没有映射的事件类型发往这里
+	KafkaTopics    string         // 事件类型到topic的映射，格式见events.ParseTopics
+	TLSCert        string         // 为空时grpc server不启用TLS
+	TLSKey         string
+	TLSClientCA    string        // 设置后要求client出示证书(mTLS)
+	TLSSPIFFEIDs   string        // 逗号分隔，允许的client SPIFFE ID，为空时不检查
+	TLSReload      time.Duration // 检查证书文件是否更新的间隔，见mtls.Reloader.Watch
+	I18nDir        string        // 运行时可修改的错误描述翻译目录，覆盖嵌入的catalog(见endpoint.DefaultMessages)，为空时只使用嵌入的
+	I18nReload     time.Duration // 检查I18nDir中文件是否更新的间隔
+	BlobDir        string        // 上传的blob保存到本地目录(见transport.NewBlobServer)，与BlobS3Bucket都为空时不提供上传接口
+	BlobS3Bucket   string        // 上传的blob保存到S3(或兼容S3的存储)，与BlobDir互斥
+	BlobS3Prefix   string        // 对象key的前缀，如uploads/
+	BlobS3Endpoint string        // 兼容S3 API的存储(如MinIO)地址，设置后使用path style，为空时使用AWS
+	BlobS3Region   string        // 使用BlobS3Endpoint时可以为任意值
+	BlobMaxSize    int64         // 单个blob的最大字节数
+	LogFormat      string        // logfmt或json
+	LogSampleFirst int           // 每秒每个rpc/path输出的日志条数，超出后按LogSampleAfter采样，0表示不采样
+	LogSampleAfter int           // 超出后每多少条输出1条，0表示全部丢弃
+}
+
+func defBootstrap() Bootstrap {
+	return Bootstrap{
+		ListenHost:     DefaultListenHost,
+		GRPCPort:       8080,
+		GRPC:           gokit_foundation.DefaultGRPCServerConfig(),
+		HTTPPort:       8081,
+		HTTP:           gokit_foundation.DefaultHTTPServerConfig(),
+		AdminPort:      8089,
+		SDBackend:      "consul",
+		ConsulAddr:     "127.0.0.1:8500",
+		EtcdAddr:       "127.0.0.1:2379",
+		LameDuck:       5 * time.Second,
+		StopTimeout:    5 * time.Second,
+		UpgradeTimeout: 30 * time.Second,
+		DepsMode:       gokit_foundation.DepsStrict,
+		WarmupTimeout:  5 * time.Second,
+		WarmupConns:    2,
+		Metrics:        metricsx.Config{Backend: metricsx.BackendPrometheus, Interval: 10 * time.Second},
+		MetricsPush:    defMetricsPush(),
+		Tracing:        tracing.DefaultConfig(),
+		KafkaTopic:     "addsvc.events",
+		SQSRegion:      "us-east-1",
+		DLQMaxAttempts: deadletter.DefaultPolicy().MaxAttempts,
+		DedupStore:     "redis",
+		TLSReload:      30 * time.Second,
+		I18nReload:     30 * time.Second,
+		BlobS3Region:   "us-east-1",
+		BlobMaxSize:    100 << 20,
+		LogFormat:      "logfmt",
+	}
+}
+
+// 默认job为服务名，instance在MetricsPushConfig中补全
+func defMetricsPush() metricspush.Config {
+	conf := metricspush.DefaultConfig()
+	conf.Job = "addsvc"
+	return conf
+}
+
+type bootstrapOption struct {
+	key   string // 配置文件中的字段名
+	env   string
+	flag  string
+	alias string // 参数的别名，可为空
+	usage string
+	// 所有来源的值都以字符串形式设置，保证解析规则一致
+	set func(b *Bootstrap, s string) error
+	get func(b *Bootstrap) string
+}
+
+var bootstrapOptions = []bootstrapOption{
+	{"listen_host", "ADDSVC_LISTEN_HOST", "listen.host", "", "listen host of grpc/http server",
+		func(b *Bootstrap, s string) error { b.ListenHost = s; return nil },
+		func(b *Bootstrap) string { return b.ListenHost }},
+	// 必须能够被你的consul-server访问，否则consul的健康检查会失败
+	{"advertise_host", "ADDSVC_ADVERTISE_HOST", "advertise.host", "advertise", "host advertised to consul, must be reachable by consul, auto detect if empty",
+		func(b *Bootstrap, s string) error { b.AdvertiseHost = s; return nil },
+		func(b *Bootstrap) string { return b.AdvertiseHost }},
+	{"advertise_iface", "ADDSVC_ADVERTISE_IFACE", "advertise.iface", "", "preferred network interface when auto detecting advertise host",
+		func(b *Bootstrap, s string) error { b.AdvertiseIface = s; return nil },
+		func(b *Bootstrap) string { return b.AdvertiseIface }},
+	{"grpc_port", "ADDSVC_GRPC_PORT", "grpc.port", "", "grpc listen port",
+		func(b *Bootstrap, s string) (err error) { b.GRPCPort, err = strconv.Atoi(s); return },
+		func(b *Bootstrap) string { return strconv.Itoa(b.GRPCPort) }},
+	{"grpc_max_recv_msg_size", "ADDSVC_GRPC_MAX_RECV_MSG_SIZE", "grpc.max.recv.msg.size", "", "max bytes of a grpc message the server can receive",
+		func(b *Bootstrap, s string) (err error) { b.GRPC.MaxRecvMsgSize, err = strconv.Atoi(s); return },
+		func(b *Bootstrap) string { return strconv.Itoa(b.GRPC.MaxRecvMsgSize) }},
+	{"grpc_max_send_msg_size", "ADDSVC_GRPC_MAX_SEND_MSG_SIZE", "grpc.max.send.msg.size", "", "max bytes of a grpc message the server can send",
+		func(b *Bootstrap, s string) (err error) { b.GRPC.MaxSendMsgSize, err = strconv.Atoi(s); return },
+		func(b *Bootstrap) string { return strconv.Itoa(b.GRPC.MaxSendMsgSize) }},
+	{"grpc_keepalive_max_age", "ADDSVC_GRPC_KEEPALIVE_MAX_AGE", "grpc.keepalive.max.age", "", "send GOAWAY to connections older than this so that clients reconnect and rebalance",
+		func(b *Bootstrap, s string) (err error) {
+			b.GRPC.Keepalive.MaxConnectionAge, err = time.ParseDuration(s)
+			return
+		},
+		func(b *Bootstrap) string { return b.GRPC.Keepalive.MaxConnectionAge.String() }},
+	{"grpc_keepalive_min_ping", "ADDSVC_GRPC_KEEPALIVE_MIN_PING", "grpc.keepalive.min.ping", "", "min interval of client pings, clients pinging more often are disconnected",
+		func(b *Bootstrap, s string) (err error) {
+			b.GRPC.KeepalivePolicy.MinTime, err = time.ParseDuration(s)
+			return
+		},
+		func(b *Bootstrap) string { return b.GRPC.KeepalivePolicy.MinTime.String() }},
+	{"http_port", "ADDSVC_HTTP_PORT", "http.port", "", "http listen port",
+		func(b *Bootstrap, s string) (err error) { b.HTTPPort, err = strconv.Atoi(s); return },
+		func(b *Bootstrap) string { return strconv.Itoa(b.HTTPPort) }},
+	{"http_read_timeout", "ADDSVC_HTTP_READ_TIMEOUT", "http.read.timeout", "", "max duration of reading an entire http request, 0 means no limit",
+		func(b *Bootstrap, s string) (err error) { b.HTTP.ReadTimeout, err = time.ParseDuration(s); return },
+		func(b *Bootstrap) string { return b.HTTP.ReadTimeout.String() }},
+	{"http_write_timeout", "ADDSVC_HTTP_WRITE_TIMEOUT", "http.write.timeout", "", "max duration from reading http request header to writing the response, 0 means no limit",
+		func(b *Bootstrap, s string) (err error) { b.HTTP.WriteTimeout, err = time.ParseDuration(s); return },
+		func(b *Bootstrap) string { return b.HTTP.WriteTimeout.String() }},
+	{"http_idle_timeout", "ADDSVC_HTTP_IDLE_TIMEOUT", "http.idle.timeout", "", "max idle duration of http keep-alive connections, 0 means no limit",
+		func(b *Bootstrap, s string) (err error) { b.HTTP.IdleTimeout, err = time.ParseDuration(s); return },
+		func(b *Bootstrap) string { return b.HTTP.IdleTimeout.String() }},
+	{"http_max_header_bytes", "ADDSVC_HTTP_MAX_HEADER_BYTES", "http.max.header.bytes", "", "max bytes of http request header",
+		func(b *Bootstrap, s string) (err error) { b.HTTP.MaxHeaderBytes, err = strconv.Atoi(s); return },
+		func(b *Bootstrap) string { return strconv.Itoa(b.HTTP.MaxHeaderBytes) }},
+	{"http_max_conns", "ADDSVC_HTTP_MAX_CONNS", "http.max.conns", "", "max concurrent http connections, 0 means no limit",
+		func(b *Bootstrap, s string) (err error) { b.HTTP.MaxConns, err = strconv.Atoi(s); return },
+		func(b *Bootstrap) string { return strconv.Itoa(b.HTTP.MaxConns) }},
+	{"http_h2c", "ADDSVC_HTTP_H2C", "http.h2c", "", "serve HTTP/2 without TLS(h2c) on http port as well",
+		func(b *Bootstrap, s string) (err error) { b.HTTP.H2C, err = strconv.ParseBool(s); return },
+		func(b *Bootstrap) string { return strconv.FormatBool(b.HTTP.H2C) }},
+	{"compress_level", "ADDSVC_COMPRESS_LEVEL", "compress.level", "", "gzip/deflate level of http responses and grpc messages, 1(fastest)~9(best), 0 for default",
+		func(b *Bootstrap, s string) (err error) { b.CompressLevel, err = strconv.Atoi(s); return },
+		func(b *Bootstrap) string { return strconv.Itoa(b.CompressLevel) }},
+	{"compress_min_size", "ADDSVC_COMPRESS_MIN_SIZE", "compress.min.size", "", "min bytes of an http response to compress, 0 for default(1024)",
+		func(b *Bootstrap, s string) (err error) { b.CompressMin, err = strconv.Atoi(s); return },
+		func(b *Bootstrap) string { return strconv.Itoa(b.CompressMin) }},
+	{"admin_port", "ADDSVC_ADMIN_PORT", "admin.port", "", "admin http listen port(pprof, expvar, runtime stats, log level, chaos, shutdown), 0 to disable",
+		func(b *Bootstrap, s string) (err error) { b.AdminPort, err = strconv.Atoi(s); return },
+		func(b *Bootstrap) string { return strconv.Itoa(b.AdminPort) }},
+	{"thrift_port", "ADDSVC_THRIFT_PORT", "thrift.port", "", "thrift listen port, serve Sum/Concat over thrift as well if not 0",
+		func(b *Bootstrap, s string) (err error) { b.ThriftPort, err = strconv.Atoi(s); return },
+		func(b *Bootstrap) string { return strconv.Itoa(b.ThriftPort) }},
+	{"grpc_web_port", "ADDSVC_GRPC_WEB_PORT", "grpc.web.port", "", "grpc-web listen port for browser clients, 0 to disable",
+		func(b *Bootstrap, s string) (err error) { b.GRPCWebPort, err = strconv.Atoi(s); return },
+		func(b *Bootstrap) string { return strconv.Itoa(b.GRPCWebPort) }},
+	{"grpc_web_origins", "ADDSVC_GRPC_WEB_ORIGINS", "grpc.web.origins", "", "comma separated origins allowed to call grpc-web cross-origin(CORS), * for all, empty for same origin only",
+		func(b *Bootstrap, s string) error { b.GRPCWebOrigins = s; return nil },
+		func(b *Bootstrap) string { return b.GRPCWebOrigins }},
+	{"grpc_web_websocket", "ADDSVC_GRPC_WEB_WEBSOCKET", "grpc.web.websocket", "", "serve client/bidi streaming grpc-web calls over websocket",
+		func(b *Bootstrap, s string) (err error) { b.GRPCWebSocket, err = strconv.ParseBool(s); return },
+		func(b *Bootstrap) string { return strconv.FormatBool(b.GRPCWebSocket) }},
+	{"sd_backend", "SD_BACKEND", "sd.backend", "", "service discovery backend: consul, etcd or k8s(headless service, no registration)",
+		func(b *Bootstrap, s string) error { b.SDBackend = s; return nil },
+		func(b *Bootstrap) string { return b.SDBackend }},
+	// 环境变量沿用之前的CONSUL_ADDR
+	{"consul_addr", "CONSUL_ADDR", "consul.addr", "", "consul agent address",
+		func(b *Bootstrap, s string) error { b.ConsulAddr = s; return nil },
+		func(b *Bootstrap) string { return b.ConsulAddr }},
+	{"etcd_addr", "ETCD_ADDR", "etcd.addr", "", "etcd address(HTTP/JSON gateway), used when sd.backend is etcd",
+		func(b *Bootstrap, s string) error { b.EtcdAddr = s; return nil },
+		func(b *Bootstrap) string { return b.EtcdAddr }},
+	{"zone", "ADDSVC_ZONE", "zone", "", "availability zone of this instance, registered to consul as tag zone=xx and meta",
+		func(b *Bootstrap, s string) error { b.Zone = s; return nil },
+		func(b *Bootstrap) string { return b.Zone }},
+	{"consul_tags", "ADDSVC_CONSUL_TAGS", "consul.tags", "", "comma separated extra tags registered to consul",
+		func(b *Bootstrap, s string) error { b.ConsulTags = s; return nil },
+		func(b *Bootstrap) string { return b.ConsulTags }},
+	{"consul_meta", "ADDSVC_CONSUL_META", "consul.meta", "", "comma separated k=v pairs registered to consul as service meta",
+		func(b *Bootstrap, s string) error { b.ConsulMeta = s; return nil },
+		func(b *Bootstrap) string { return b.ConsulMeta }},
+	{"consul_check_ttl", "ADDSVC_CONSUL_CHECK_TTL", "consul.check.ttl", "", "use a TTL check reported by heartbeats instead of the grpc health check, 0 means grpc check",
+		func(b *Bootstrap, s string) (err error) { b.ConsulCheckTTL, err = time.ParseDuration(s); return },
+		func(b *Bootstrap) string { return b.ConsulCheckTTL.String() }},
+	{"deps_mode", "ADDSVC_DEPS_MODE", "deps.mode", "", "startup dependency check mode: strict(exit if a strong dependency is unavailable) or lenient(log and retry in background)",
+		func(b *Bootstrap, s string) error { b.DepsMode = s; return nil },
+		func(b *Bootstrap) string { return b.DepsMode }},
+	{"consul_probe", "ADDSVC_CONSUL_PROBE", "consul.probe", "", "probe whether consul agent can reach advertise.host before starting, wait at most this long, 0 to skip",
+		func(b *Bootstrap, s string) (err error) { b.ConsulProbe, err = time.ParseDuration(s); return },
+		func(b *Bootstrap) string { return b.ConsulProbe.String() }},
+	{"consul_weight", "ADDSVC_CONSUL_WEIGHT", "consul.weight", "", "weight of this instance when passing, 0 means consul default(1)",
+		func(b *Bootstrap, s string) (err error) { b.ConsulWeight, err = strconv.Atoi(s); return },
+		func(b *Bootstrap) string { return strconv.Itoa(b.ConsulWeight) }},
+	{"deploy_color", "ADDSVC_DEPLOY_COLOR", "deploy.color", "", "blue/green group of this instance(blue or green), registered as a consul tag and also as service <name>-<color>",
+		func(b *Bootstrap, s string) error { b.DeployColor = s; return nil },
+		func(b *Bootstrap) string { return b.DeployColor }},
+	{"lame_duck", "ADDSVC_LAME_DUCK", "lame.duck", "", "drain period between deregistering and stopping grpc/http servers on shutdown",
+		func(b *Bootstrap, s string) (err error) { b.LameDuck, err = time.ParseDuration(s); return },
+		func(b *Bootstrap) string { return b.LameDuck.String() }},
+	{"stop_timeout", "ADDSVC_STOP_TIMEOUT", "stop.timeout", "", "max time to wait for in-flight calls on graceful stop, force stop after it, 0 means wait forever",
+		func(b *Bootstrap, s string) (err error) { b.StopTimeout, err = time.ParseDuration(s); return },
+		func(b *Bootstrap) string { return b.StopTimeout.String() }},
+	{"pre_stop_delay", "ADDSVC_PRE_STOP_DELAY", "pre.stop.delay", "", "keep serving for this long after SIGTERM before draining, like a preStop sleep hook, a second signal skips it",
+		func(b *Bootstrap, s string) (err error) { b.PreStopDelay, err = time.ParseDuration(s); return },
+		func(b *Bootstrap) string { return b.PreStopDelay.String() }},
+	{"upgrade_timeout", "ADDSVC_UPGRADE_TIMEOUT", "upgrade.timeout", "", "max time to wait for the new process to be ready on SIGUSR2, the old one keeps serving if exceeded",
+		func(b *Bootstrap, s string) (err error) { b.UpgradeTimeout, err = time.ParseDuration(s); return },
+		func(b *Bootstrap) string { return b.UpgradeTimeout.String() }},
+	{"upgrade_warmup", "ADDSVC_UPGRADE_WARMUP", "upgrade.warmup", "", "register with consul weight 1 for this long after a SIGUSR2 upgrade before restoring consul_weight, 0 means no warmup",
+		func(b *Bootstrap, s string) (err error) { b.UpgradeWarmup, err = time.ParseDuration(s); return },
+		func(b *Bootstrap) string { return b.UpgradeWarmup.String() }},
+	{"warmup_timeout", "ADDSVC_WARMUP_TIMEOUT", "warmup.timeout", "", "max time to warm up (pre-dial redis, prime caches, self requests) after servers listen and before registering, 0 means no warmup",
+		func(b *Bootstrap, s string) (err error) { b.WarmupTimeout, err = time.ParseDuration(s); return },
+		func(b *Bootstrap) string { return b.WarmupTimeout.String() }},
+	{"warmup_conns", "ADDSVC_WARMUP_CONNS", "warmup.conns", "", "number of redis connections to open during warmup",
+		func(b *Bootstrap, s string) (err error) { b.WarmupConns, err = strconv.Atoi(s); return },
+		func(b *Bootstrap) string { return strconv.Itoa(b.WarmupConns) }},
+	{"warmup_requests", "ADDSVC_WARMUP_REQUESTS", "warmup.requests", "", "number of Sum and Concat calls to itself during warmup, 0 means none",
+		func(b *Bootstrap, s string) (err error) { b.WarmupRequests, err = strconv.Atoi(s); return },
+		func(b *Bootstrap) string { return strconv.Itoa(b.WarmupRequests) }},
+	{"metrics_backend", "ADDSVC_METRICS_BACKEND", "metrics.backend", "", "metrics backend: prometheus, statsd, dogstatsd or otlp, backends other than prometheus push metrics and do not serve /metrics",
+		func(b *Bootstrap, s string) error { b.Metrics.Backend = s; return nil },
+		func(b *Bootstrap) string { return b.Metrics.Backend }},
+	{"metrics_addr", "ADDSVC_METRICS_ADDR", "metrics.addr", "", "statsd/dogstatsd udp address(127.0.0.1:8125 if empty) or otlp collector address(OTEL_EXPORTER_OTLP_ENDPOINT if empty)",
+		func(b *Bootstrap, s string) error { b.Metrics.Addr = s; return nil },
+		func(b *Bootstrap) string { return b.Metrics.Addr }},
+	{"metrics_interval", "ADDSVC_METRICS_INTERVAL", "metrics.interval", "", "interval of pushing metrics to statsd, dogstatsd or otlp backend",
+		func(b *Bootstrap, s string) (err error) { b.Metrics.Interval, err = time.ParseDuration(s); return },
+		func(b *Bootstrap) string { return b.Metrics.Interval.String() }},
+	{"metrics_buffer", "ADDSVC_METRICS_BUFFER", "metrics.buffer", "", "buffer size of async metrics observing, 0 means observe synchronously",
+		func(b *Bootstrap, s string) (err error) { b.MetricsBuffer, err = strconv.Atoi(s); return },
+		func(b *Bootstrap) string { return strconv.Itoa(b.MetricsBuffer) }},
+	{"metrics_push_url", "ADDSVC_METRICS_PUSH_URL", "metrics.push.url", "", "prometheus pushgateway url, push metrics periodically if set, e.g. http://pushgateway:9091",
+		func(b *Bootstrap, s string) error { b.MetricsPush.URL = s; return nil },
+		func(b *Bootstrap) string { return b.MetricsPush.URL }},
+	{"metrics_push_job", "ADDSVC_METRICS_PUSH_JOB", "metrics.push.job", "", "job label of pushed metrics",
+		func(b *Bootstrap, s string) error { b.MetricsPush.Job = s; return nil },
+		func(b *Bootstrap) string { return b.MetricsPush.Job }},
+	{"metrics_push_instance", "ADDSVC_METRICS_PUSH_INSTANCE", "metrics.push.instance", "", "instance label of pushed metrics, <advertise.host>:<grpc.port> if empty",
+		func(b *Bootstrap, s string) error { b.MetricsPush.Instance = s; return nil },
+		func(b *Bootstrap) string { return b.MetricsPush.Instance }},
+	{"metrics_push_interval", "ADDSVC_METRICS_PUSH_INTERVAL", "metrics.push.interval", "", "interval of pushing metrics",
+		func(b *Bootstrap, s string) (err error) { b.MetricsPush.Interval, err = time.ParseDuration(s); return },
+		func(b *Bootstrap) string { return b.MetricsPush.Interval.String() }},
+	{"metrics_push_delete", "ADDSVC_METRICS_PUSH_DELETE", "metrics.push.delete", "", "delete pushed metrics from pushgateway on exit instead of pushing them the last time",
+		func(b *Bootstrap, s string) (err error) {
+			b.MetricsPush.DeleteOnStop, err = strconv.ParseBool(s)
+			return
+		},
+		func(b *Bootstrap) string { return strconv.FormatBool(b.MetricsPush.DeleteOnStop) }},
+	{"pprof", "ADDSVC_PPROF", "pprof", "", "serve runtime profiling data on http server at /debug/pprof/",
+		func(b *Bootstrap, s string) (err error) { b.Pprof, err = strconv.ParseBool(s); return },
+		func(b *Bootstrap) string { return strconv.FormatBool(b.Pprof) }},
+	{"grpc_reflection", "ADDSVC_GRPC_REFLECTION", "grpc.reflection", "", "register grpc reflection service for grpcurl/evans",
+		func(b *Bootstrap, s string) (err error) { b.GRPCReflection, err = strconv.ParseBool(s); return },
+		func(b *Bootstrap) string { return strconv.FormatBool(b.GRPCReflection) }},
+	{"grpc_gateway", "ADDSVC_GRPC_GATEWAY", "grpc.gateway", "", "serve REST APIs generated by grpc-gateway under /v1/ on http server",
+		func(b *Bootstrap, s string) (err error) { b.GRPCGateway, err = strconv.ParseBool(s); return },
+		func(b *Bootstrap) string { return strconv.FormatBool(b.GRPCGateway) }},
+	{"mesh", "ADDSVC_MESH", "mesh", "", "running behind an Envoy sidecar: forward Envoy trace headers(b3) to downstream calls",
+		func(b *Bootstrap, s string) (err error) { b.Mesh, err = strconv.ParseBool(s); return },
+		func(b *Bootstrap) string { return strconv.FormatBool(b.Mesh) }},
+	{"error_map", "ADDSVC_ERROR_MAP", "error.map", "", "override error to grpc code/http status mapping, e.g. not_found=:410,1001=FAILED_PRECONDITION:422",
+		func(b *Bootstrap, s string) error { b.ErrorMap = s; return nil },
+		func(b *Bootstrap) string { return b.ErrorMap }},
+	{"dynamic_conf", "ADDSVC_DYNAMIC_CONF", "dynamic.conf", "", "hot-reloadable config file(yaml/json), reload on SIGHUP or file change",
+		func(b *Bootstrap, s string) error { b.DynamicConf = s; return nil },
+		func(b *Bootstrap) string { return b.DynamicConf }},
+	{"dynamic_consul", "ADDSVC_DYNAMIC_CONSUL", "dynamic.consul", "", "consul KV prefix of hot-reloadable config, e.g. addsvc/dynamic/, reload on change",
+		func(b *Bootstrap, s string) error { b.DynamicConsul = s; return nil },
+		func(b *Bootstrap) string { return b.DynamicConsul }},
+	{"tracing_backend", tracing.EnvBackend, "tracing.backend", "", "opentracing backend: jaeger, zipkin or otlp(spans exported by OpenTelemetry only)",
+		func(b *Bootstrap, s string) error { b.Tracing.Backend = s; return nil },
+		func(b *Bootstrap) string { return b.Tracing.Backend }},
+	// 环境变量与jaeger-client的约定一致(JAEGER_AGENT_HOST/PORT合并为一个)
+	{"jaeger_agent", "JAEGER_AGENT_ADDR", "jaeger.agent", "", "jaeger agent address(UDP), e.g. 127.0.0.1:6831",
+		func(b *Bootstrap, s string) error { b.Tracing.Jaeger.AgentAddr = s; return nil },
+		func(b *Bootstrap) string { return b.Tracing.Jaeger.AgentAddr }},
+	{"jaeger_collector", "JAEGER_ENDPOINT", "jaeger.collector", "", "jaeger collector endpoint(HTTP), e.g. http://127.0.0.1:14268/api/traces, preferred over agent",
+		func(b *Bootstrap, s string) error { b.Tracing.Jaeger.CollectorEndpoint = s; return nil },
+		func(b *Bootstrap) string { return b.Tracing.Jaeger.CollectorEndpoint }},
+	{"jaeger_sampler", "JAEGER_SAMPLER_TYPE", "jaeger.sampler", "", "jaeger sampler type: const, probabilistic, ratelimiting or remote",
+		func(b *Bootstrap, s string) error { b.Tracing.Jaeger.SamplerType = s; return nil },
+		func(b *Bootstrap) string { return b.Tracing.Jaeger.SamplerType }},
+	{"jaeger_sampler_param", "JAEGER_SAMPLER_PARAM", "jaeger.sampler.param", "", "jaeger sampler param: 0/1 for const, rate for probabilistic/remote, traces per second for ratelimiting",
+		func(b *Bootstrap, s string) (err error) {
+			b.Tracing.Jaeger.SamplerParam, err = strconv.ParseFloat(s, 64)
+			return
+		},
+		func(b *Bootstrap) string { return strconv.FormatFloat(b.Tracing.Jaeger.SamplerParam, 'g', -1, 64) }},
+	{"zipkin_url", "ZIPKIN_URL", "zipkin.url", "", "zipkin collector endpoint(HTTP), e.g. http://127.0.0.1:9411/api/v2/spans, used when tracing.backend is zipkin",
+		func(b *Bootstrap, s string) error { b.Tracing.Zipkin.URL = s; return nil },
+		func(b *Bootstrap) string { return b.Tracing.Zipkin.URL }},
+	{"zipkin_sample_rate", "ZIPKIN_SAMPLE_RATE", "zipkin.sample.rate", "", "zipkin sample rate: 0, 1 or in [0.0001, 1)",
+		func(b *Bootstrap, s string) (err error) {
+			b.Tracing.Zipkin.SampleRate, err = strconv.ParseFloat(s, 64)
+			return
+		},
+		func(b *Bootstrap) string { return strconv.FormatFloat(b.Tracing.Zipkin.SampleRate, 'g', -1, 64) }},
+	// 环境变量与nats官方工具的约定一致，多个地址以逗号分隔
+	{"nats_url", "NATS_URL", "nats.url", "", "nats server url, e.g. nats://127.0.0.1:4222, also serve Sum/Concat over NATS if set",
+		func(b *Bootstrap, s string) error { b.NATSURL = s; return nil },
+		func(b *Bootstrap) string { return b.NATSURL }},
+	{"sqs_queue_url", "ADDSVC_SQS_QUEUE_URL", "sqs.queue.url", "", "SQS queue url, consume Sum/Concat requests from the queue if set",
+		func(b *Bootstrap, s string) error { b.SQSQueueURL = s; return nil },
+		func(b *Bootstrap) string { return b.SQSQueueURL }},
+	{"sqs_endpoint", "ADDSVC_SQS_ENDPOINT", "sqs.endpoint", "", "SQS endpoint of a local emulator, e.g. http://127.0.0.1:9324 for ElasticMQ",
+		func(b *Bootstrap, s string) error { b.SQSEndpoint = s; return nil },
+		func(b *Bootstrap) string { return b.SQSEndpoint }},
+	// 凭证通过AWS SDK的默认方式(环境变量AWS_ACCESS_KEY_ID等)获取
+	{"sqs_region", "ADDSVC_SQS_REGION", "sqs.region", "", "AWS region of the SQS queue",
+		func(b *Bootstrap, s string) error { b.SQSRegion = s; return nil },
+		func(b *Bootstrap) string { return b.SQSRegion }},
+	{"sqs_dlq_url", "ADDSVC_SQS_DLQ_URL", "sqs.dlq.url", "", "SQS dead-letter queue url, move poison messages and messages exceeding dlq.max.attempts there if set",
+		func(b *Bootstrap, s string) error { b.SQSDeadLetter = s; return nil },
+		func(b *Bootstrap) string { return b.SQSDeadLetter }},
+	{"sqs_journal", "ADDSVC_SQS_JOURNAL", "sqs.journal", "", "local journal file of in-flight SQS messages, recover them after a crash if set, e.g. /var/lib/addsvc/sqs.db",
+		func(b *Bootstrap, s string) error { b.SQSJournal = s; return nil },
+		func(b *Bootstrap) string { return b.SQSJournal }},
+	{"nats_dlq", "ADDSVC_NATS_DLQ", "nats.dlq", "", "retry failed NATS messages without reply subject, publish them to <subject>.dlq after dlq.max.attempts",
+		func(b *Bootstrap, s string) (err error) { b.NATSDeadLetter, err = strconv.ParseBool(s); return },
+		func(b *Bootstrap) string { return strconv.FormatBool(b.NATSDeadLetter) }},
+	{"dlq_max_attempts", "ADDSVC_DLQ_MAX_ATTEMPTS", "dlq.max.attempts", "", "max attempts(including the first one) of a message before moving to the dead-letter queue",
+		func(b *Bootstrap, s string) (err error) { b.DLQMaxAttempts, err = strconv.Atoi(s); return },
+		func(b *Bootstrap) string { return strconv.Itoa(b.DLQMaxAttempts) }},
+	{"dedup_windows", "ADDSVC_DEDUP_WINDOWS", "dedup.windows", "", "dedup window of each consumer group(sqs, nats), skip messages with the same id within it, e.g. sqs=10m,nats=1m",
+		func(b *Bootstrap, s string) error { b.DedupWindows = s; return nil },
+		func(b *Bootstrap) string { return b.DedupWindows }},
+	{"dedup_store", "ADDSVC_DEDUP_STORE", "dedup.store", "", "store of dedup records, redis(shared by instances) or memory",
+		func(b *Bootstrap, s string) error { b.DedupStore = s; return nil },
+		func(b *Bootstrap) string { return b.DedupStore }},
+	{"kafka_brokers", "KAFKA_BROKERS", "kafka.brokers", "", "kafka brokers separated by comma, publish domain events(SumComputed etc.) if set",
+		func(b *Bootstrap, s string) error { b.KafkaBrokers = s; return nil },
+		func(b *Bootstrap) string { return b.KafkaBrokers }},
+	{"kafka_topic", "KAFKA_TOPIC", "kafka.topic", "", "default topic of domain events, events are dropped if empty and not mapped by kafka.topics",
+		func(b *Bootstrap, s string) error { b.KafkaTopic = s; return nil },
+		func(b *Bootstrap) string { return b.KafkaTopic }},
+	{"kafka_topics", "KAFKA_TOPICS", "kafka.topics", "", "topic of each event type, e.g. SumComputed=addsvc.sum,ConcatComputed=addsvc.concat",
+		func(b *Bootstrap, s string) error { b.KafkaTopics = s; return nil },
+		func(b *Bootstrap) string { return b.KafkaTopics }},
+	{"tls_cert", "ADDSVC_TLS_CERT", "tls.cert", "", "certificate file(PEM) of grpc server, enable TLS if set",
+		func(b *Bootstrap, s string) error { b.TLSCert = s; return nil },
+		func(b *Bootstrap) string { return b.TLSCert }},
+	{"tls_key", "ADDSVC_TLS_KEY", "tls.key", "", "private key file(PEM) of tls.cert",
+		func(b *Bootstrap, s string) error { b.TLSKey = s; return nil },
+		func(b *Bootstrap) string { return b.TLSKey }},
+	{"tls_client_ca", "ADDSVC_TLS_CLIENT_CA", "tls.client.ca", "", "CA file(PEM) to verify client certificates, require client certificates(mTLS) if set",
+		func(b *Bootstrap, s string) error { b.TLSClientCA = s; return nil },
+		func(b *Bootstrap) string { return b.TLSClientCA }},
+	{"tls_spiffe_ids", "ADDSVC_TLS_SPIFFE_IDS", "tls.spiffe.ids", "", "allowed client SPIFFE IDs separated by comma, e.g. spiffe://example.org/gateway",
+		func(b *Bootstrap, s string) error { b.TLSSPIFFEIDs = s; return nil },
+		func(b *Bootstrap) string { return b.TLSSPIFFEIDs }},
+	{"tls_reload", "ADDSVC_TLS_RELOAD", "tls.reload", "", "interval of checking certificate files for rotation",
+		func(b *Bootstrap, s string) (err error) { b.TLSReload, err = time.ParseDuration(s); return },
+		func(b *Bootstrap) string { return b.TLSReload.String() }},
+	{"i18n_dir", "ADDSVC_I18N_DIR", "i18n.dir", "", "directory of <locale>.json files overriding the embedded error message translations, reloaded at runtime",
+		func(b *Bootstrap, s string) error { b.I18nDir = s; return nil },
+		func(b *Bootstrap) string { return b.I18nDir }},
+	{"i18n_reload", "ADDSVC_I18N_RELOAD", "i18n.reload", "", "interval of checking i18n.dir for changes",
+		func(b *Bootstrap, s string) (err error) { b.I18nReload, err = time.ParseDuration(s); return },
+		func(b *Bootstrap) string { return b.I18nReload.String() }},
+	{"blob_dir", "ADDSVC_BLOB_DIR", "blob.dir", "", "directory of uploaded blobs, serve Blob.Upload(grpc) and PUT /blobs/<name>(http) if set",
+		func(b *Bootstrap, s string) error { b.BlobDir = s; return nil },
+		func(b *Bootstrap) string { return b.BlobDir }},
+	{"blob_s3_bucket", "ADDSVC_BLOB_S3_BUCKET", "blob.s3.bucket", "", "S3 bucket of uploaded blobs, serve uploads like blob.dir if set",
+		func(b *Bootstrap, s string) error { b.BlobS3Bucket = s; return nil },
+		func(b *Bootstrap) string { return b.BlobS3Bucket }},
+	{"blob_s3_prefix", "ADDSVC_BLOB_S3_PREFIX", "blob.s3.prefix", "", "key prefix of uploaded objects, e.g. uploads/",
+		func(b *Bootstrap, s string) error { b.BlobS3Prefix = s; return nil },
+		func(b *Bootstrap) string { return b.BlobS3Prefix }},
+	{"blob_s3_endpoint", "ADDSVC_BLOB_S3_ENDPOINT", "blob.s3.endpoint", "", "endpoint of an S3 compatible storage(path style), e.g. http://127.0.0.1:9000 for MinIO",
+		func(b *Bootstrap, s string) error { b.BlobS3Endpoint = s; return nil },
+		func(b *Bootstrap) string { return b.BlobS3Endpoint }},
+	// 凭证与sqs一样通过AWS SDK的默认方式获取
+	{"blob_s3_region", "ADDSVC_BLOB_S3_REGION", "blob.s3.region", "", "AWS region of the S3 bucket",
+		func(b *Bootstrap, s string) error { b.BlobS3Region = s; return nil },
+		func(b *Bootstrap) string { return b.BlobS3Region }},
+	{"blob_max_size", "ADDSVC_BLOB_MAX_SIZE", "blob.max.size", "", "max size in bytes of an uploaded blob",
+		func(b *Bootstrap, s string) (err error) { b.BlobMaxSize, err = strconv.ParseInt(s, 10, 64); return },
+		func(b *Bootstrap) string { return strconv.FormatInt(b.BlobMaxSize, 10) }},
+	{"log_format", "ADDSVC_LOG_FORMAT", "log.format", "", "log output format: logfmt or json",
+		func(b *Bootstrap, s string) error { b.LogFormat = s; return nil },
+		func(b *Bootstrap) string { return b.LogFormat }},
+	{"log_sample_first", "ADDSVC_LOG_SAMPLE_FIRST", "log.sample.first", "", "output the first N per-request logs of each rpc/path per second, sample the rest, 0 disables sampling",
+		func(b *Bootstrap, s string) (err error) { b.LogSampleFirst, err = strconv.Atoi(s); return },
+		func(b *Bootstrap) string { return strconv.Itoa(b.LogSampleFirst) }},
+	{"log_sample_after", "ADDSVC_LOG_SAMPLE_AFTER", "log.sample.after", "", "output 1 of every N per-request logs after log.sample.first, 0 drops them all",
+		func(b *Bootstrap, s string) (err error) { b.LogSampleAfter, err = strconv.Atoi(s); return },
+		func(b *Bootstrap) string { return strconv.Itoa(b.LogSampleAfter) }},
+}
+
+// 记录命令行参数的值，所有来源处理完之后才设置到Bootstrap上
+type flagValue struct {
+	def    string
+	isBool bool
+	val    *string
+	// 参数与别名共用同一个flagValue
+	set bool
+}
+
+func (v *flagValue) String() string {
+	if v == nil {
+		return ""
+	}
+	return v.def
+}
+
+// 同一个参数(包括别名)出现多次时报错，而不是悄悄地使用最后一个，常见于脚本中拼接参数
+func (v *flagValue) Set(s string) error {
+	if v.set {
+		return fmt.Errorf("set more than once(including its alias), previous value %q", *v.val)
+	}
+	v.set = true
+	*v.val = s
+	return nil
+}
+
+func (v *flagValue) IsBoolFlag() bool { return v.isBool }
+
+// 可以只写参数名(如 -pprof)的参数
+var boolFlags = map[string]bool{"pprof": true, "grpc.reflection": true, "grpc.gateway": true, "http.h2c": true, "grpc.web.websocket": true, "nats.dlq": true, "mesh": true, "metrics.push.delete": true}
+
+// LoadBootstrap 按优先级加载启动配置并校验，getenv一般为os.Getenv
+// 使用 -h 时返回flag.ErrHelp
+func LoadBootstrap(args []string, getenv func(string) string, output io.Writer) (*Bootstrap, error) {
+	l, err := LoadConfig(args, getenv, output)
+	if err != nil {
+		return nil, err
+	}
+	return l.Bootstrap, nil
+}
+
+// Loaded LoadConfig的结果
+type Loaded struct {
+	Bootstrap  *Bootstrap
+	ConfigFile string            // -config或ADDSVC_CONFIG
+	Sources    map[string]string // 文件字段名 => 来源，如"env ADDSVC_GRPC_PORT"，没有的项为默认值
+	CheckOnly  bool              // -validate-config：校验配置后退出
+	PrintOnly  bool              // -print-config：打印生效的配置后退出，见Print
+}
+
+// LoadConfig 与LoadBootstrap相同，另外返回每一项的来源以及-validate-config、-print-config
+// 参数解析成功后总是返回Loaded，之后的配置文件、环境变量、参数值以及校验的错误同时通过err返回，
+// 此时Bootstrap为出错之前已读取的配置；校验失败时err为*ValidationError
+func LoadConfig(args []string, getenv func(string) string, output io.Writer) (*Loaded, error) {
+	b := defBootstrap()
+	l := &Loaded{Bootstrap: &b, Sources: map[string]string{}}
+
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.SetOutput(output)
+	confFile := fs.String("config", getenv("ADDSVC_CONFIG"), "config file(yaml/json), env ADDSVC_CONFIG")
+	fs.BoolVar(&l.CheckOnly, "validate-config", false, "load and validate the config from all sources, then exit with 1 if invalid")
+	fs.BoolVar(&l.PrintOnly, "print-config", false, "print the effective config with the source of each item and secrets redacted, then exit")
+	flagVals := make(map[string]*string, len(bootstrapOptions))
+	for _, o := range bootstrapOptions {
+		val := new(string)
+		flagVals[o.flag] = val
+		fv := &flagValue{def: o.get(&b), isBool: boolFlags[o.flag], val: val}
+		fs.Var(fv, o.flag, fmt.Sprintf("%s, env %s", o.usage, o.env))
+		if o.alias != "" {
+			flagVals[o.alias] = val
+			fs.Var(fv, o.alias, "alias of -"+o.flag)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	l.ConfigFile = *confFile
+	if *confFile != "" {
+		if err := loadBootstrapFile(&b, *confFile, l.Sources); err != nil {
+			return l, err
+		}
+	}
+	for _, o := range bootstrapOptions {
+		if s := getenv(o.env); s != "" {
+			if err := o.set(&b, s); err != nil {
+				return l, fmt.Errorf("config: invalid env %s=%q: %v", o.env, s, err)
+			}
+			l.Sources[o.key] = "env " + o.env
+		}
+	}
+	var setErr error
+	fs.Visit(func(f *flag.Flag) {
+		val, ok := flagVals[f.Name]
+		if !ok || setErr != nil {
+			return
+		}
+		for _, o := range bootstrapOptions {
+			if o.flag == f.Name || (o.alias != "" && o.alias == f.Name) {
+				if err := o.set(&b, *val); err != nil {
+					setErr = fmt.Errorf("config: invalid flag -%s=%q: %v", f.Name, *val, err)
+				}
+				l.Sources[o.key] = "flag -" + f.Name
+			}
+		}
+	})
+	if setErr != nil {
+		return l, setErr
+	}
+	return l, b.Validate()
+}
+
+// sources记录从文件读取的项
+func loadBootstrapFile(b *Bootstrap, path string, sources map[string]string) error {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: read %s: %v", path, err)
+	}
+	m := map[string]interface{}{}
+	if err = unmarshalByExt(path, raw, &m); err != nil {
+		return fmt.Errorf("config: parse %s: %v", path, err)
+	}
+	var unknown []string
+	for k, v := range m {
+		found := false
+		for _, o := range bootstrapOptions {
+			if o.key == k {
+				found = true
+				if err = o.set(b, fileValue(v)); err != nil {
+					return fmt.Errorf("config: invalid %s in %s: %v", k, path, err)
+				}
+				sources[k] = "file " + path
+			}
+		}
+		if !found {
+			unknown = append(unknown, k)
+		}
+	}
+	// 字段名写错时直接报错，避免配置悄悄地不生效，相近的字段名作为提示
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		keys := make([]string, len(bootstrapOptions))
+		for i, o := range bootstrapOptions {
+			keys[i] = o.key
+		}
+		for i, k := range unknown {
+			if s := suggest(k, keys); s != "" {
+				unknown[i] = fmt.Sprintf("%s(did you mean %s?)", k, s)
+			}
+		}
+		return fmt.Errorf("config: unknown fields in %s: %s", path, strings.Join(unknown, ","))
+	}
+	return nil
+}
+
+// 根据扩展名选择yaml或json，其他扩展名按json处理
+func unmarshalByExt(path string, raw []byte, v interface{}) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return yaml.Unmarshal(raw, v)
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// json中的数字解析为float64，fmt.Sprint对较大的整数会输出1e+06这样的格式
+func fileValue(v interface{}) string {
+	if f, ok := v.(float64); ok {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+// ValidationError Validate发现的所有问题，-validate-config时逐行输出
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "config: " + strings.Join(e.Problems, "; ")
+}
+
+// Validate 检查必须的配置项，启动时调用，失败则不启动，err为*ValidationError
+func (b *Bootstrap) Validate() error {
+	var errs []string
+	if b.ListenHost == "" {
+		errs = append(errs, "listen_host is required")
+	}
+	// 为空时在ResolveAdvertiseHost中自动探测后再校验
+	if b.AdvertiseHost != "" {
+		if err := ValidateAdvertiseHost(b.AdvertiseHost); err != nil {
+			errs = append(errs, "advertise_host: "+err.Error())
+		}
+	}
+	if b.GRPCPort <= 0 || b.GRPCPort > 65535 {
+		errs = append(errs, fmt.Sprintf("grpc_port %d out of range", b.GRPCPort))
+	}
+	if b.HTTPPort <= 0 || b.HTTPPort > 65535 {
+		errs = append(errs, fmt.Sprintf("http_port %d out of range", b.HTTPPort))
+	}
+	if b.GRPCPort == b.HTTPPort {
+		errs = append(errs, "grpc_port and http_port must be different")
+	}
+	if err := b.GRPC.Validate(); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if err := b.HTTP.Validate(); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if b.CompressLevel < 0 || b.CompressLevel > 9 {
+		errs = append(errs, fmt.Sprintf("compress_level %d out of range [0, 9]", b.CompressLevel))
+	}
+	if b.CompressMin < 0 {
+		errs = append(errs, "compress_min_size must not be negative")
+	}
+	if b.AdminPort != 0 {
+		if b.AdminPort < 0 || b.AdminPort > 65535 {
+			errs = append(errs, fmt.Sprintf("admin_port %d out of range", b.AdminPort))
+		}
+		if b.AdminPort == b.GRPCPort || b.AdminPort == b.HTTPPort || b.AdminPort == b.ThriftPort {
+			errs = append(errs, "admin_port must be different from grpc_port, http_port and thrift_port")
+		}
+	}
+	if b.ThriftPort != 0 {
+		if b.ThriftPort < 0 || b.ThriftPort > 65535 {
+			errs = append(errs, fmt.Sprintf("thrift_port %d out of range", b.ThriftPort))
+		}
+		if b.ThriftPort == b.GRPCPort || b.ThriftPort == b.HTTPPort {
+			errs = append(errs, "thrift_port must be different from grpc_port and http_port")
+		}
+	}
+	if b.DLQMaxAttempts < 1 {
+		errs = append(errs, "dlq_max_attempts must be at least 1")
+	}
+	if b.GRPCWebPort != 0 {
+		if b.GRPCWebPort < 0 || b.GRPCWebPort > 65535 {
+			errs = append(errs, fmt.Sprintf("grpc_web_port %d out of range", b.GRPCWebPort))
+		}
+		if b.GRPCWebPort == b.GRPCPort || b.GRPCWebPort == b.HTTPPort || b.GRPCWebPort == b.AdminPort || b.GRPCWebPort == b.ThriftPort {
+			errs = append(errs, "grpc_web_port must be different from grpc_port, http_port, admin_port and thrift_port")
+		}
+		// grpc-web不经过grpc server的TLS，同时启用会绕过TLS(以及mTLS的client认证)，需要时由前面的代理终止TLS
+		if b.TLSEnabled() {
+			errs = append(errs, "grpc_web_port can not be used with tls_cert, terminate TLS at a proxy in front of grpc-web instead")
+		}
+	}
+	// gateway通过进程内的连接调用grpc server，启用TLS时同样需要握手(mTLS时还需要client证书)
+	if b.GRPCGateway && b.TLSEnabled() {
+		errs = append(errs, "grpc_gateway can not be used with tls_cert")
+	}
+	switch b.SDBackend {
+	case "consul":
+		if b.ConsulAddr == "" {
+			errs = append(errs, "consul_addr is required")
+		}
+		if _, err := parseConsulMeta(b.ConsulMeta); err != nil {
+			errs = append(errs, "consul_meta: "+err.Error())
+		}
+		if b.ConsulCheckTTL < 0 {
+			errs = append(errs, "consul_check_ttl must not be negative")
+		}
+		if b.ConsulWeight < 0 {
+			errs = append(errs, "consul_weight must not be negative")
+		}
+		if b.ConsulProbe < 0 {
+			errs = append(errs, "consul_probe must not be negative")
+		}
+		// TTL检查本来就用于consul访问不到实例的部署
+		if b.ConsulProbe > 0 && b.ConsulCheckTTL > 0 {
+			errs = append(errs, "consul_probe can not be used with consul_check_ttl")
+		}
+	case "etcd":
+		if b.EtcdAddr == "" {
+			errs = append(errs, "etcd_addr is required")
+		}
+	case "k8s":
+	default:
+		errs = append(errs, fmt.Sprintf("sd_backend %q must be consul, etcd or k8s", b.SDBackend))
+	}
+	// 别名注册依赖consul的alias check
+	if b.DeployColor != "" && b.DeployColor != "blue" && b.DeployColor != "green" {
+		errs = append(errs, fmt.Sprintf("deploy_color %q must be blue or green", b.DeployColor))
+	} else if b.DeployColor != "" && b.SDBackend != "consul" {
+		errs = append(errs, "deploy_color requires sd_backend consul")
+	}
+	if b.LameDuck < 0 {
+		errs = append(errs, "lame_duck must not be negative")
+	}
+	if b.StopTimeout < 0 {
+		errs = append(errs, "stop_timeout must not be negative")
+	}
+	if b.PreStopDelay < 0 {
+		errs = append(errs, "pre_stop_delay must not be negative")
+	}
+	if b.UpgradeTimeout <= 0 {
+		errs = append(errs, "upgrade_timeout must be positive")
+	}
+	if b.UpgradeWarmup < 0 {
+		errs = append(errs, "upgrade_warmup must not be negative")
+	}
+	if b.DepsMode != gokit_foundation.DepsStrict && b.DepsMode != gokit_foundation.DepsLenient {
+		errs = append(errs, fmt.Sprintf("deps_mode %q must be strict or lenient", b.DepsMode))
+	}
+	if b.WarmupTimeout < 0 || b.WarmupConns < 0 || b.WarmupRequests < 0 {
+		errs = append(errs, "warmup_timeout, warmup_conns and warmup_requests must not be negative")
+	}
+	if b.DynamicConf != "" && b.DynamicConsul != "" {
+		errs = append(errs, "dynamic_conf and dynamic_consul are mutually exclusive")
+	}
+	if err := b.Metrics.Validate(); err != nil {
+		errs = append(errs, err.Error())
+	}
+	// pushgateway推送的是prometheus registry中的指标
+	if b.MetricsPush.Enabled() && !b.Metrics.IsPrometheus() {
+		errs = append(errs, "metrics_push_url can only be used with prometheus metrics backend")
+	}
+	if err := b.MetricsPush.Validate(); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if err := b.Tracing.Validate(); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if windows, err := dedup.ParseWindows(b.DedupWindows); err != nil {
+		errs = append(errs, "dedup_windows: "+err.Error())
+	} else {
+		for group := range windows {
+			if group != "sqs" && group != "nats" {
+				errs = append(errs, fmt.Sprintf("dedup_windows: unknown consumer group %q, must be sqs or nats", group))
+			}
+		}
+	}
+	if b.DedupStore != "redis" && b.DedupStore != "memory" {
+		errs = append(errs, "dedup_store must be redis or memory")
+	}
+	if _, err := events.ParseTopics(b.KafkaTopics); err != nil {
+		errs = append(errs, "kafka_topics: "+err.Error())
+	}
+	if _, err := b.errorMapper(); err != nil {
+		errs = append(errs, "error_map: "+err.Error())
+	}
+	if b.TLSCert != "" || b.TLSKey != "" || b.TLSClientCA != "" || b.TLSSPIFFEIDs != "" {
+		if err := b.TLSConfig().Validate(true); err != nil {
+			errs = append(errs, "tls: "+err.Error())
+		}
+		if b.TLSReload <= 0 {
+			errs = append(errs, "tls_reload must be positive")
+		}
+	}
+	if b.I18nDir != "" && b.I18nReload <= 0 {
+		errs = append(errs, "i18n_reload must be positive")
+	}
+	if b.BlobDir != "" && b.BlobS3Bucket != "" {
+		errs = append(errs, "blob_dir and blob_s3_bucket are mutually exclusive")
+	}
+	if b.BlobMaxSize <= 0 {
+		errs = append(errs, "blob_max_size must be positive")
+	}
+	if b.LogFormat != "logfmt" && b.LogFormat != "json" {
+		errs = append(errs, fmt.Sprintf("log_format %q must be logfmt or json", b.LogFormat))
+	}
+	if b.LogSampleFirst < 0 || b.LogSampleAfter < 0 {
+		errs = append(errs, "log_sample_first and log_sample_after must not be negative")
+	}
+	if len(errs) > 0 {
+		return &ValidationError{Problems: errs}
+	}
+	return nil
+}
+
+// BlobEnabled 是否提供上传接口
+func (b *Bootstrap) BlobEnabled() bool {
+	return b.BlobDir != "" || b.BlobS3Bucket != ""
+}
+
+// ErrorMapper transport层使用的错误映射，ErrorMap已在Validate中校验
+func (b *Bootstrap) ErrorMapper() *errs.Mapper {
+	m, _ := b.errorMapper()
+	return m
+}
+
+func (b *Bootstrap) errorMapper() (*errs.Mapper, error) {
+	return errs.ParseMapper(b.ErrorMap)
+}
+
+// EventsConfig 领域事件的发布配置，KafkaTopics已在Validate中校验
+func (b *Bootstrap) EventsConfig() events.Config {
+	conf := events.DefaultConfig()
+	conf.Topics, _ = events.ParseTopics(b.KafkaTopics)
+	conf.DefaultTopic = b.KafkaTopic
+	return conf
+}
+
+// DeadLetterPolicy 队列transport的重试和死信策略，退避时间使用默认值
+func (b *Bootstrap) DeadLetterPolicy() deadletter.Policy {
+	p := deadletter.DefaultPolicy()
+	p.MaxAttempts = b.DLQMaxAttempts
+	return p
+}
+
+// DedupConfig group(sqs或nats)的去重配置，没有配置窗口时Window为0(不去重)，DedupWindows已在Validate中校验
+func (b *Bootstrap) DedupConfig(group string) dedup.Config {
+	windows, _ := dedup.ParseWindows(b.DedupWindows)
+	return dedup.Config{Group: group, Window: windows[group]}
+}
+
+// TLSEnabled grpc server是否启用TLS
+func (b *Bootstrap) TLSEnabled() bool {
+	return b.TLSCert != ""
+}
+
+// TLSConfig grpc server的TLS配置
+func (b *Bootstrap) TLSConfig() mtls.Config {
+	conf := mtls.Config{CertFile: b.TLSCert, KeyFile: b.TLSKey, CAFile: b.TLSClientCA}
+	for _, s := range strings.Split(b.TLSSPIFFEIDs, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			conf.SPIFFEIDs = append(conf.SPIFFEIDs, s)
+		}
+	}
+	return conf
+}
+
+// MetricsPushConfig 指标推送配置，instance为空时使用注册到服务发现的地址，需在ResolveAdvertiseHost之后调用
+func (b *Bootstrap) MetricsPushConfig() metricspush.Config {
+	conf := b.MetricsPush
+	if conf.Instance == "" {
+		conf.Instance = net.JoinHostPort(b.AdvertiseHost, strconv.Itoa(b.GRPCPort))
+	}
+	return conf
+}
+
+// GRPCWebConfig grpc-web的CORS和websocket配置
+func (b *Bootstrap) GRPCWebConfig() gokit_foundation.GRPCWebConfig {
+	conf := gokit_foundation.GRPCWebConfig{WebSockets: b.GRPCWebSocket}
+	for _, s := range strings.Split(b.GRPCWebOrigins, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			conf.AllowedOrigins = append(conf.AllowedOrigins, s)
+		}
+	}
+	return conf
+}
+
+// KafkaBrokerList 将KafkaBrokers拆分为broker地址列表
+func (b *Bootstrap) KafkaBrokerList() []string {
+	var brokers []string
+	for _, s := range strings.Split(b.KafkaBrokers, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			brokers = append(brokers, s)
+		}
+	}
+	return brokers
+}
+
+// ConsulRegisterOptions 注册到consul的tag、meta(version、zone、DeployColor以及ConsulTags、ConsulMeta)和检查方式，ConsulMeta已在Validate中校验
+// 使用TTL检查时需要再设置TTLStatus
+func (b *Bootstrap) ConsulRegisterOptions(version string) gokit_foundation.ConsulRegisterOptions {
+	opts := gokit_foundation.ConsulRegisterOptions{
+		Tags:     []string{"version=" + version},
+		Meta:     map[string]string{"version": version},
+		Weight:   b.ConsulWeight,
+		CheckTTL: b.ConsulCheckTTL,
+	}
+	if b.Zone != "" {
+		opts.Tags = append(opts.Tags, "zone="+b.Zone)
+		opts.Meta["zone"] = b.Zone
+	}
+	for _, s := range strings.Split(b.ConsulTags, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			opts.Tags = append(opts.Tags, s)
+		}
+	}
+	meta, _ := parseConsulMeta(b.ConsulMeta)
+	for k, v := range meta {
+		opts.Meta[k] = v
+	}
+	// client可以按tag选择分组(见gateway的bluegreen.go)，也可以直接发现<SvcName>-<color>
+	if b.DeployColor != "" {
+		opts.Tags = append(opts.Tags, b.DeployColor)
+		opts.Meta["color"] = b.DeployColor
+		opts.Aliases = []gokit_foundation.ConsulAlias{{Name: SvcName + "-" + b.DeployColor, Tags: []string{b.DeployColor}}}
+	}
+	return opts
+}
+
+// consul的meta key只能包含字母、数字、-和_，最长64个字符
+func parseConsulMeta(s string) (map[string]string, error) {
+	meta := map[string]string{}
+	for _, kv := range strings.Split(s, ",") {
+		if kv = strings.TrimSpace(kv); kv == "" {
+			continue
+		}
+		i := strings.Index(kv, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("%q must be k=v", kv)
+		}
+		k := kv[:i]
+		if len(k) > 64 || strings.TrimLeft(k, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_") != "" {
+			return nil, fmt.Errorf("invalid key %q", k)
+		}
+		meta[k] = kv[i+1:]
+	}
+	return meta, nil
+}
+
+// ResolveAdvertiseHost 未配置advertise地址时自动探测(见gokit_foundation.AdvertiseAddr)，探测结果同样需要通过校验
+func (b *Bootstrap) ResolveAdvertiseHost() error {
+	host, err := gokit_foundation.AdvertiseAddr(b.AdvertiseHost, b.AdvertiseIface)
+	if err != nil {
+		return fmt.Errorf("config: detect advertise host: %v", err)
+	}
+	if err = ValidateAdvertiseHost(host); err != nil {
+		return fmt.Errorf("config: advertise_host: %v", err)
+	}
+	b.AdvertiseHost = host
+	return nil
+}
+
+// LogOptions 日志的输出格式和采样，采样只针对每个请求一行的日志(grpc的rpc字段、http访问日志的path字段)
+func (b *Bootstrap) LogOptions() gokit_foundation.LogOptions {
+	opts := gokit_foundation.LogOptions{JSON: b.LogFormat == "json"}
+	if b.LogSampleFirst > 0 {
+		opts.Sampling = &gokit_foundation.LogSampling{
+			Keys:       []string{"rpc", "path"},
+			First:      b.LogSampleFirst,
+			Thereafter: b.LogSampleAfter,
+			Tick:       time.Second,
+		}
+	}
+	return opts
+}
+
+// GzipLevel compress/gzip和compress/zlib的压缩级别
+func (b *Bootstrap) GzipLevel() int {
+	if b.CompressLevel == 0 {
+		return gzip.DefaultCompression
+	}
+	return b.CompressLevel
+}
@@ -0,0 +1,337 @@
+package config
+
+import (
+	"gokit_foundation"
+	"gokit_foundation/errs"
+	"gokit_foundation/mtls"
+	"google.golang.org/grpc/codes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func tempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func writeTempFile(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func envOf(m map[string]string) func(string) string {
+	return func(k string) string { return m[k] }
+}
+
+func TestLoadBootstrapPrecedence(t *testing.T) {
+	dir, clean := tempDir(t)
+	defer clean()
+	yamlFile := writeTempFile(t, dir, "addsvc.yaml", `
+grpc_port: 9000
+http_port: 9001
+lame_duck: 1s
+stop_timeout: 3s
+pre_stop_delay: 2s
+consul_addr: 10.0.0.1:8500
+jaeger_agent: 10.0.0.2:6831
+jaeger_sampler: ratelimiting
+jaeger_sampler_param: 5
+nats_url: nats://10.0.0.3:4222
+http_write_timeout: 10s
+http_max_conns: 100
+grpc_max_recv_msg_size: 1048576
+`)
+	jsonFile := writeTempFile(t, dir, "addsvc.json", `{"grpc_port": 9000, "http_port": 9001, "lame_duck": "1s", "stop_timeout": "3s", "pre_stop_delay": "2s", "consul_addr": "10.0.0.1:8500", "jaeger_agent": "10.0.0.2:6831", "jaeger_sampler": "ratelimiting", "jaeger_sampler_param": 5, "nats_url": "nats://10.0.0.3:4222", "http_write_timeout": "10s", "http_max_conns": 100, "grpc_max_recv_msg_size": 1048576}`)
+
+	for _, file := range []string{yamlFile, jsonFile} {
+		// 文件 < 环境变量 < 命令行参数
+		env := envOf(map[string]string{"ADDSVC_CONFIG": file, "ADDSVC_HTTP_PORT": "9101", "ADDSVC_GRPC_PORT": "9100"})
+		b, err := LoadBootstrap([]string{"-grpc.port", "9200", "-pprof", "-grpc.reflection", "-grpc.gateway", "-http.h2c", "-mesh"}, env, ioutil.Discard)
+		if err != nil {
+			t.Fatalf("file:%s err:%v", file, err)
+		}
+		want := defBootstrap()
+		want.GRPCPort = 9200
+		want.HTTPPort = 9101
+		want.LameDuck = time.Second
+		want.StopTimeout = time.Second * 3
+		want.PreStopDelay = time.Second * 2
+		want.ConsulAddr = "10.0.0.1:8500"
+		want.Pprof = true
+		want.GRPCReflection = true
+		want.GRPCGateway = true
+		want.Mesh = true
+		want.Tracing.Jaeger.AgentAddr = "10.0.0.2:6831"
+		want.Tracing.Jaeger.SamplerType = "ratelimiting"
+		want.Tracing.Jaeger.SamplerParam = 5
+		want.NATSURL = "nats://10.0.0.3:4222"
+		want.HTTP.WriteTimeout = time.Second * 10
+		want.HTTP.MaxConns = 100
+		want.HTTP.H2C = true
+		want.GRPC.MaxRecvMsgSize = 1 << 20
+		if *b != want {
+			t.Errorf("file:%s got:%+v want:%+v", file, *b, want)
+		}
+	}
+
+	// 没有任何配置时使用默认值
+	b, err := LoadBootstrap(nil, envOf(nil), ioutil.Discard)
+	if err != nil || *b != defBootstrap() {
+		t.Errorf("got:%+v err:%v", b, err)
+	}
+}
+
+func TestLoadBootstrapInvalid(t *testing.T) {
+	dir, clean := tempDir(t)
+	defer clean()
+	test := []struct {
+		name    string
+		args    []string
+		env     map[string]string
+		wantErr string
+	}{
+		{name: "[unknown field]", args: []string{"-config", writeTempFile(t, dir, "a.yaml", "grpc_prot: 1")}, wantErr: "unknown fields in " + filepath.Join(dir, "a.yaml") + ": grpc_prot(did you mean grpc_port?)"},
+		{name: "[bad env]", env: map[string]string{"ADDSVC_GRPC_PORT": "abc"}, wantErr: "ADDSVC_GRPC_PORT"},
+		{name: "[bad flag]", args: []string{"-lame.duck", "5"}, wantErr: "-lame.duck"},
+		{name: "[same port]", args: []string{"-grpc.port", "8081"}, wantErr: "must be different"},
+		{name: "[negative grpc msg size]", args: []string{"-grpc.max.send.msg.size", "-1"}, wantErr: "must not be negative"},
+		{name: "[negative http timeout]", env: map[string]string{"ADDSVC_HTTP_IDLE_TIMEOUT": "-1s"}, wantErr: "must not be negative"},
+		{name: "[bad compress level]", args: []string{"-compress.level", "10"}, wantErr: "compress_level 10"},
+		{name: "[negative compress min size]", env: map[string]string{"ADDSVC_COMPRESS_MIN_SIZE": "-1"}, wantErr: "compress_min_size must not be negative"},
+		{name: "[bad compress level]", args: []string{"-compress.level", "10"}, wantErr: "compress_level 10 out of range"},
+		{name: "[negative compress min size]", env: map[string]string{"ADDSVC_COMPRESS_MIN_SIZE": "-1"}, wantErr: "compress_min_size must not be negative"},
+		{name: "[bad consul meta]", args: []string{"-consul.meta", "team=math,bad key=1"}, wantErr: "consul_meta"},
+		{name: "[negative consul weight]", env: map[string]string{"ADDSVC_CONSUL_WEIGHT": "-1"}, wantErr: "consul_weight must not be negative"},
+		{name: "[bad deploy color]", env: map[string]string{"ADDSVC_DEPLOY_COLOR": "red"}, wantErr: `deploy_color "red" must be blue or green`},
+		{name: "[deploy color without consul]", args: []string{"-sd.backend", "etcd", "-deploy.color", "blue"}, wantErr: "deploy_color requires sd_backend consul"},
+		{name: "[negative pre stop delay]", args: []string{"-pre.stop.delay", "-1s"}, wantErr: "pre_stop_delay must not be negative"},
+		{name: "[zero upgrade timeout]", args: []string{"-upgrade.timeout", "0s"}, wantErr: "upgrade_timeout must be positive"},
+		{name: "[negative upgrade warmup]", env: map[string]string{"ADDSVC_UPGRADE_WARMUP": "-1s"}, wantErr: "upgrade_warmup must not be negative"},
+		{name: "[bad deps mode]", env: map[string]string{"ADDSVC_DEPS_MODE": "loose"}, wantErr: `deps_mode "loose" must be strict or lenient`},
+		{name: "[negative warmup requests]", args: []string{"-warmup.requests", "-1"}, wantErr: "warmup_requests must not be negative"},
+		{name: "[unknown metrics backend]", args: []string{"-metrics.backend", "graphite"}, wantErr: "unknown backend \"graphite\""},
+		{name: "[metrics push with statsd]", env: map[string]string{"ADDSVC_METRICS_BACKEND": "statsd", "ADDSVC_METRICS_PUSH_URL": "http://pushgateway:9091"},
+			wantErr: "metrics_push_url can only be used with prometheus metrics backend"},
+		{name: "[same admin port]", args: []string{"-admin.port", "8081"}, wantErr: "admin_port must be different"},
+		{name: "[same thrift port]", args: []string{"-thrift.port", "8080"}, wantErr: "thrift_port must be different"},
+		{name: "[same grpc web port]", args: []string{"-grpc.web.port", "8089"}, wantErr: "grpc_web_port must be different"},
+		{name: "[grpc gateway with tls]", args: []string{"-grpc.gateway", "-tls.cert", "a", "-tls.key", "b"}, wantErr: "grpc_gateway can not be used with tls_cert"},
+		{name: "[grpc web with tls]", args: []string{"-grpc.web.port", "8082", "-tls.cert", "a", "-tls.key", "b"}, wantErr: "grpc_web_port can not be used with tls_cert"},
+		{name: "[advertise 0.0.0.0]", env: map[string]string{"ADDSVC_ADVERTISE_HOST": "0.0.0.0"}, wantErr: "advertise_host"},
+		{name: "[empty consul]", args: []string{"-consul.addr", ""}, wantErr: "consul_addr is required"},
+		{name: "[empty etcd]", args: []string{"-sd.backend", "etcd", "-etcd.addr", ""}, wantErr: "etcd_addr is required"},
+		{name: "[unknown backend]", env: map[string]string{"SD_BACKEND": "zk"}, wantErr: "must be consul, etcd or k8s"},
+		{name: "[bad sampler param]", args: []string{"-jaeger.agent", "127.0.0.1:6831", "-jaeger.sampler.param", "2"}, wantErr: "must be in [0, 1]"},
+		{name: "[dynamic conf and consul]", args: []string{"-dynamic.conf", "dynamic.yaml", "-dynamic.consul", "addsvc/dynamic/"}, wantErr: "mutually exclusive"},
+		{name: "[bad dedup windows]", args: []string{"-dedup.windows", "sqs=10"}, wantErr: "dedup_windows"},
+		{name: "[unknown dedup group]", env: map[string]string{"ADDSVC_DEDUP_WINDOWS": "sqs=10m,kafka=1m"}, wantErr: `unknown consumer group "kafka"`},
+		{name: "[unknown dedup store]", args: []string{"-dedup.store", "etcd"}, wantErr: "dedup_store must be redis or memory"},
+		{name: "[bad kafka topics]", env: map[string]string{"KAFKA_TOPICS": "SumComputed"}, wantErr: "kafka_topics"},
+		{name: "[bad error map]", args: []string{"-error.map", "1001=:200"}, wantErr: "error_map"},
+		{name: "[tls cert without key]", env: map[string]string{"ADDSVC_TLS_CERT": "server.crt"}, wantErr: "cert and key must be set together"},
+		{name: "[tls client ca only]", args: []string{"-tls.client.ca", "ca.crt"}, wantErr: "cert is required"},
+		{name: "[tls spiffe without ca]", args: []string{"-tls.cert", "a", "-tls.key", "b", "-tls.spiffe.ids", "spiffe://example.org/gateway"}, wantErr: "client ca is required"},
+		{name: "[tls bad spiffe id]", args: []string{"-tls.cert", "a", "-tls.key", "b", "-tls.client.ca", "c", "-tls.spiffe.ids", "gateway"}, wantErr: "invalid spiffe id"},
+		{name: "[tls bad reload]", args: []string{"-tls.cert", "a", "-tls.key", "b", "-tls.reload", "0s"}, wantErr: "tls_reload must be positive"},
+		{name: "[blob dir and s3]", args: []string{"-blob.dir", "/tmp/blobs", "-blob.s3.bucket", "blobs"}, wantErr: "blob_dir and blob_s3_bucket are mutually exclusive"},
+		{name: "[zero blob max size]", env: map[string]string{"ADDSVC_BLOB_MAX_SIZE": "0"}, wantErr: "blob_max_size must be positive"},
+		{name: "[bad log format]", args: []string{"-log.format", "text"}, wantErr: "log_format"},
+		{name: "[negative log sample]", env: map[string]string{"ADDSVC_LOG_SAMPLE_FIRST": "-1"}, wantErr: "log_sample_first"},
+		{name: "[unknown sampler]", env: map[string]string{"JAEGER_ENDPOINT": "http://127.0.0.1:14268/api/traces", "JAEGER_SAMPLER_TYPE": "all"}, wantErr: "unknown sampler type"},
+		{name: "[unknown tracing backend]", env: map[string]string{"TRACING_BACKEND": "xray"}, wantErr: "unknown backend"},
+		{name: "[duplicate flag]", args: []string{"-grpc.port", "9000", "-grpc.port", "9001"}, wantErr: "-grpc.port: set more than once"},
+		{name: "[flag and alias]", args: []string{"-advertise.host", "10.0.0.1", "-advertise", "10.0.0.2"}, wantErr: "set more than once"},
+		{name: "[duplicate bool flag]", args: []string{"-pprof", "-pprof=false"}, wantErr: "-pprof: set more than once"},
+		{name: "[negative consul probe]", args: []string{"-consul.probe", "-1s"}, wantErr: "consul_probe must not be negative"},
+		{name: "[consul probe with ttl]", args: []string{"-consul.probe", "3s", "-consul.check.ttl", "10s"}, wantErr: "consul_probe can not be used with consul_check_ttl"},
+		{name: "[bad metrics push url]", args: []string{"-metrics.push.url", "pushgateway:9091"}, wantErr: "metricspush: url"},
+		{name: "[zero metrics push interval]", env: map[string]string{"ADDSVC_METRICS_PUSH_URL": "http://pushgateway:9091", "ADDSVC_METRICS_PUSH_INTERVAL": "0s"}, wantErr: "interval and timeout must be positive"},
+		{name: "[bad zipkin rate]", args: []string{"-tracing.backend", "zipkin", "-zipkin.url", "http://127.0.0.1:9411/api/v2/spans", "-zipkin.sample.rate", "2"}, wantErr: "zipkin: sample rate"},
+	}
+	for _, tt := range test {
+		_, err := LoadBootstrap(tt.args, envOf(tt.env), ioutil.Discard)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("name:%s got err:%v want contain:%s", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestMetricsPushConfig(t *testing.T) {
+	b, err := LoadBootstrap([]string{"-advertise.host", "10.0.0.8", "-metrics.push.url", "http://pushgateway:9091", "-metrics.push.delete"}, envOf(nil), ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := b.MetricsPushConfig()
+	if conf.Instance != "10.0.0.8:8080" || conf.Job != "addsvc" || !conf.DeleteOnStop {
+		t.Errorf("got %+v", conf)
+	}
+	b.MetricsPush.Instance = "addsvc-1"
+	if conf = b.MetricsPushConfig(); conf.Instance != "addsvc-1" {
+		t.Errorf("want instance addsvc-1, got %s", conf.Instance)
+	}
+}
+
+func TestErrorMapper(t *testing.T) {
+	b, err := LoadBootstrap(nil, envOf(map[string]string{"ADDSVC_ERROR_MAP": "1001=FAILED_PRECONDITION:422"}), ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := b.ErrorMapper()
+	if e := errs.Invalid("x").WithCode(1001); m.GRPCCode(e) != codes.FailedPrecondition || m.HTTPStatus(e) != 422 {
+		t.Errorf("got grpc code:%v http status:%d", m.GRPCCode(e), m.HTTPStatus(e))
+	}
+	// 其他错误仍按Kind映射
+	if m.HTTPStatus(errs.Invalid("x")) != 400 {
+		t.Error("want default mapping")
+	}
+}
+
+func TestResolveAdvertiseHost(t *testing.T) {
+	os.Setenv("ADVERTISE_ADDR", "10.0.0.8")
+	defer os.Unsetenv("ADVERTISE_ADDR")
+
+	// 未配置时使用ADVERTISE_ADDR，显式配置的优先
+	b, err := LoadBootstrap(nil, envOf(nil), ioutil.Discard)
+	if err != nil || b.AdvertiseHost != "" {
+		t.Fatalf("got:%+v err:%v", b, err)
+	}
+	if err = b.ResolveAdvertiseHost(); err != nil || b.AdvertiseHost != "10.0.0.8" {
+		t.Errorf("got:%s err:%v", b.AdvertiseHost, err)
+	}
+	b, err = LoadBootstrap([]string{"-advertise", "192.168.0.2"}, envOf(nil), ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = b.ResolveAdvertiseHost(); err != nil || b.AdvertiseHost != "192.168.0.2" {
+		t.Errorf("got:%s err:%v", b.AdvertiseHost, err)
+	}
+
+	// 探测到的地址同样需要校验
+	os.Setenv("ADVERTISE_ADDR", "127.0.0.1111")
+	b = &Bootstrap{}
+	if err = b.ResolveAdvertiseHost(); err == nil {
+		t.Error("want err for invalid ADVERTISE_ADDR")
+	}
+}
+
+func TestEventsConfig(t *testing.T) {
+	env := envOf(map[string]string{"KAFKA_BROKERS": "10.0.0.1:9092, 10.0.0.2:9092", "KAFKA_TOPICS": "SumComputed=addsvc.sum"})
+	b, err := LoadBootstrap(nil, env, ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := b.KafkaBrokerList(); !reflect.DeepEqual(got, []string{"10.0.0.1:9092", "10.0.0.2:9092"}) {
+		t.Errorf("got brokers:%v", got)
+	}
+	conf := b.EventsConfig()
+	if conf.DefaultTopic != "addsvc.events" || conf.Topics["SumComputed"] != "addsvc.sum" {
+		t.Errorf("got conf:%+v", conf)
+	}
+}
+
+func TestDedupConfig(t *testing.T) {
+	b, err := LoadBootstrap([]string{"-dedup.windows", "sqs=10m", "-dedup.store", "memory"}, envOf(nil), ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := b.DedupConfig("sqs"); c.Group != "sqs" || c.Window != 10*time.Minute || b.DedupStore != "memory" {
+		t.Errorf("got sqs:%+v store:%s", c, b.DedupStore)
+	}
+	// 没有配置窗口的group不去重
+	if c := b.DedupConfig("nats"); c.Window != 0 {
+		t.Errorf("got nats:%+v", c)
+	}
+}
+
+func TestDeadLetterPolicy(t *testing.T) {
+	b, err := LoadBootstrap([]string{"-nats.dlq", "-dlq.max.attempts", "3", "-sqs.journal", "/tmp/sqs.db"}, envOf(map[string]string{"ADDSVC_SQS_DLQ_URL": "http://q/dlq"}), ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := b.DeadLetterPolicy(); !b.NATSDeadLetter || b.SQSDeadLetter != "http://q/dlq" || b.SQSJournal != "/tmp/sqs.db" || p.MaxAttempts != 3 || p.BackoffBase != time.Second {
+		t.Errorf("got:%+v policy:%+v", b, p)
+	}
+	if _, err := LoadBootstrap([]string{"-dlq.max.attempts", "0"}, envOf(nil), ioutil.Discard); err == nil {
+		t.Error("want err for dlq.max.attempts 0")
+	}
+}
+
+func TestConsulRegisterOptions(t *testing.T) {
+	env := envOf(map[string]string{"ADDSVC_ZONE": "cn-sh-a", "ADDSVC_CONSUL_META": "team=math, owner=alice"})
+	b, err := LoadBootstrap([]string{"-consul.tags", "canary, ", "-consul.check.ttl", "10s", "-consul.weight", "5"}, env, ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := b.ConsulRegisterOptions("v1.2.0")
+	if !reflect.DeepEqual(opts.Tags, []string{"version=v1.2.0", "zone=cn-sh-a", "canary"}) ||
+		!reflect.DeepEqual(opts.Meta, map[string]string{"version": "v1.2.0", "zone": "cn-sh-a", "team": "math", "owner": "alice"}) ||
+		opts.CheckTTL != 10*time.Second || opts.Weight != 5 || opts.Aliases != nil {
+		t.Errorf("got opts:%+v", opts)
+	}
+
+	b, err = LoadBootstrap([]string{"-deploy.color", "green"}, envOf(nil), ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts = b.ConsulRegisterOptions("v1.2.0")
+	if !reflect.DeepEqual(opts.Tags, []string{"version=v1.2.0", "green"}) || opts.Meta["color"] != "green" ||
+		!reflect.DeepEqual(opts.Aliases, []gokit_foundation.ConsulAlias{{Name: "NewAddSvc-green", Tags: []string{"green"}}}) {
+		t.Errorf("got opts:%+v", opts)
+	}
+}
+
+func TestGRPCWebConfig(t *testing.T) {
+	b, err := LoadBootstrap([]string{"-grpc.web.port", "8082", "-grpc.web.origins", "http://localhost:3000, https://a.com,", "-grpc.web.websocket"}, envOf(nil), ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := b.GRPCWebConfig()
+	if !reflect.DeepEqual(conf.AllowedOrigins, []string{"http://localhost:3000", "https://a.com"}) || !conf.WebSockets {
+		t.Errorf("got:%+v", conf)
+	}
+}
+
+func TestTLSConfig(t *testing.T) {
+	b, err := LoadBootstrap(nil, envOf(nil), ioutil.Discard)
+	if err != nil || b.TLSEnabled() {
+		t.Fatalf("got:%+v err:%v", b, err)
+	}
+	args := []string{"-tls.cert", "server.crt", "-tls.key", "server.key", "-tls.client.ca", "ca.crt",
+		"-tls.spiffe.ids", "spiffe://example.org/gateway, spiffe://example.org/addcli"}
+	if b, err = LoadBootstrap(args, envOf(nil), ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	want := mtls.Config{CertFile: "server.crt", KeyFile: "server.key", CAFile: "ca.crt",
+		SPIFFEIDs: []string{"spiffe://example.org/gateway", "spiffe://example.org/addcli"}}
+	if conf := b.TLSConfig(); !b.TLSEnabled() || !reflect.DeepEqual(conf, want) {
+		t.Errorf("got conf:%+v", conf)
+	}
+}
+
+func TestLogOptions(t *testing.T) {
+	b, err := LoadBootstrap(nil, envOf(nil), ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts := b.LogOptions(); opts.JSON || opts.Sampling != nil {
+		t.Errorf("default got:%+v", opts)
+	}
+	if b, err = LoadBootstrap([]string{"-log.format", "json", "-log.sample.first", "100", "-log.sample.after", "10"}, envOf(nil), ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	opts := b.LogOptions()
+	if !opts.JSON || opts.Sampling == nil || opts.Sampling.First != 100 || opts.Sampling.Thereafter != 10 {
+		t.Errorf("got:%+v", opts)
+	}
+}
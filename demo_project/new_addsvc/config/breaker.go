@@ -0,0 +1,39 @@
+package config
+
+import "time"
+
+/*
+接口级别的断路器配置，与GetRedisConf一样，可以从配置文件/第三方kv存储中读取，这里忽略读取过程...
+*/
+
+type BreakerConf struct {
+	// 半开状态下允许通过的请求数，这些请求都成功后断路器关闭，为0时允许1个
+	MaxRequests uint32
+	// 关闭状态下的统计周期，每个周期结束时清零计数，为0时不清零
+	Interval time.Duration
+	// 打开状态持续多久后进入半开状态，为0时为60s
+	Timeout time.Duration
+	// 连续失败达到该次数时打开断路器
+	ConsecutiveFailures uint32
+	// 统计周期内请求数不少于MinRequests且失败率不低于FailureRatio时也会打开断路器，FailureRatio为0时不启用
+	MinRequests  uint32
+	FailureRatio float64
+}
+
+// 接口名 => 配置，未配置的接口不安装断路器
+func GetBreakerConf() map[string]BreakerConf {
+	return map[string]BreakerConf{
+		"Sum": {
+			Interval:            time.Minute,
+			Timeout:             30 * time.Second,
+			ConsecutiveFailures: 5,
+		},
+		"Concat": {
+			Interval:            time.Minute,
+			Timeout:             30 * time.Second,
+			ConsecutiveFailures: 5,
+			MinRequests:         20,
+			FailureRatio:        0.5,
+		},
+	}
+}
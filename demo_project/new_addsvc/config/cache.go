@@ -0,0 +1,21 @@
+package config
+
+import "time"
+
+/*
+接口级别的响应缓存配置，与GetRedisConf一样，可以从配置文件/第三方kv存储中读取，这里忽略读取过程...
+*/
+
+// 接口名 => 缓存时间，未配置的接口不缓存，只能为幂等(结果只与参数有关)的接口配置
+func GetCacheTTLs() map[string]time.Duration {
+	return map[string]time.Duration{
+		"Concat": 10 * time.Minute,
+	}
+}
+
+// 定时以及启动时预热的Concat参数(见crontask.WarmCache)，缓存时间内总是命中缓存，为空时不预热
+func GetCacheWarmConcat() [][2]string {
+	return [][2]string{
+		{"hello", "world"},
+	}
+}
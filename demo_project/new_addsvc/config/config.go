@@ -1,3 +1,6 @@
 package config
 
 const SvcName = "NewAddSvc"
+
+// 是否在http服务上开启/debug/pprof/，生产环境排查问题时再开启(启动参数-pprof)，管理端口(-admin.port)上始终开启
+var EnablePprof bool
@@ -0,0 +1,311 @@
+package config
+
+import (
+	"fmt"
+	"gokit_foundation"
+	"gokit_foundation/chaos"
+	"gokit_foundation/deadline"
+	"gokit_foundation/featureflag"
+	"gokit_foundation/loadshed"
+	"gokit_foundation/resguard"
+	"io/ioutil"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+可以在运行时热更新的配置，进程收到SIGHUP信号或配置文件发生变化(见WatchDynamic)时重新加载，
+也可以保存在consul KV中(见SetDynamicKV)，key的格式见gokit_foundation.DecodeConsulKV
+使用者每次都应通过GetDynamic()读取，不要把其中的值缓存起来，否则热更新不会生效
+grpc keepalive(见Bootstrap.GRPC)和断路器(见GetBreakerConf)的超时在创建grpc.Server/断路器时确定，不在这里
+*/
+type Dynamic struct {
+	// 接口名 => 限速配置，未配置的接口不限速
+	// e.g. {"rate_limits": {"Sum": {"rps": 100}, "Concat": {"rps": 50, "burst": 10}}}
+	RateLimits map[string]RateLimit `json:"rate_limits" yaml:"rate_limits"`
+	// 日志级别：debug/info/warn/error，只影响指定了级别的日志，见gokit_foundation.SetLogLevel
+	LogLevel string `json:"log_level" yaml:"log_level"`
+	// 接口名 => 处理超时(time.ParseDuration格式)，写入endpoint的ctx deadline(见endpoint.TimeoutMiddleware)，未配置的接口不设置
+	// e.g. {"timeouts": {"Sum": "500ms", "Concat": "1s"}}
+	Timeouts map[string]string `json:"timeouts" yaml:"timeouts"`
+	// 接口名 => 超时预算：调用方没有传递deadline时的默认超时，以及剩余时间少于min时直接拒绝(见gokit_foundation/deadline)，未配置的接口不启用
+	// 处理时间仍受timeouts限制
+	// e.g. {"deadlines": {"Sum": {"default": "300ms", "min": "5ms"}}}
+	Deadlines map[string]Deadline `json:"deadlines" yaml:"deadlines"`
+	// 按优先级的过载保护，所有接口共用(见gokit_foundation/loadshed)，max_in_flight和target_latency都为0时不启用
+	// e.g. {"load_shed": {"max_in_flight": 200, "target_latency": "100ms", "retry_after": "500ms"}}
+	LoadShed LoadShed `json:"load_shed" yaml:"load_shed"`
+	// goroutine数、fd数、内存的软上限，超限时执行actions(reject、dump、restart)，见gokit_foundation/resguard
+	// e.g. {"resource_guard": {"max_goroutines": 10000, "max_memory_mb": 1024, "actions": ["reject", "dump", "restart"], "restart_after": "1m"}}
+	ResourceGuard ResourceGuard `json:"resource_guard" yaml:"resource_guard"`
+	// 接口名 => 故障注入，默认不注入，见gokit_foundation/chaos
+	// e.g. {"chaos": {"Sum": {"latency": "300ms", "latency_rate": 0.5, "error_rate": 0.1}}}
+	Chaos map[string]Chaos `json:"chaos" yaml:"chaos"`
+	// 功能开关名 => 配置，未配置的开关关闭，见gokit_foundation/featureflag
+	// e.g. {"feature_flags": {"concat_separator": {"enabled": true, "users": ["alice"], "percent": 10}}}
+	FeatureFlags map[string]featureflag.Flag `json:"feature_flags" yaml:"feature_flags"`
+	// 请求字段的上限，在validate tag之外按部署收紧(见endpoint.LimitsMiddleware)，为0时不限制
+	// e.g. {"limits": {"max_operand": 2147483647, "max_str_len": 5}}
+	Limits Limits `json:"limits" yaml:"limits"`
+
+	timeouts  map[string]time.Duration   // 由Timeouts解析得到，见ReloadDynamic
+	deadlines map[string]deadline.Budget // 由Deadlines解析得到
+	loadShed  loadshed.Config            // 由LoadShed解析得到
+	resGuard  resguard.Config            // 由ResourceGuard解析得到
+	chaos     map[string]chaos.Fault     // 由Chaos解析得到
+}
+
+// 各比例为0~1
+type Chaos struct {
+	Latency     string  `json:"latency" yaml:"latency"` // time.ParseDuration格式
+	LatencyRate float64 `json:"latency_rate" yaml:"latency_rate"`
+	ErrorRate   float64 `json:"error_rate" yaml:"error_rate"`
+	PanicRate   float64 `json:"panic_rate" yaml:"panic_rate"`
+}
+
+// time.ParseDuration格式，为空时不启用
+type Deadline struct {
+	Default string `json:"default" yaml:"default"`
+	Min     string `json:"min" yaml:"min"`
+}
+
+// 时间为time.ParseDuration格式，为空时不启用(retry_after为空时使用1s)
+type LoadShed struct {
+	MaxInFlight   int    `json:"max_in_flight" yaml:"max_in_flight"`
+	TargetLatency string `json:"target_latency" yaml:"target_latency"`
+	RetryAfter    string `json:"retry_after" yaml:"retry_after"`
+}
+
+// max_fds、max_memory_mb为0时使用系统上限(RLIMIT_NOFILE、cgroup内存上限)的limit_ratio，时间为time.ParseDuration格式
+type ResourceGuard struct {
+	MaxGoroutines int      `json:"max_goroutines" yaml:"max_goroutines"`
+	MaxFDs        int      `json:"max_fds" yaml:"max_fds"`
+	MaxMemoryMB   int      `json:"max_memory_mb" yaml:"max_memory_mb"`
+	LimitRatio    float64  `json:"limit_ratio" yaml:"limit_ratio"`
+	Interval      string   `json:"interval" yaml:"interval"`           // 采样间隔，为空时使用5s
+	RestartAfter  string   `json:"restart_after" yaml:"restart_after"` // 持续超限多久后平滑重启，为空时使用30s
+	Actions       []string `json:"actions" yaml:"actions"`
+}
+
+// 与upstream addsvc的intMax、maxLen相同的作用，后者对应service层对结果长度的限制(见service.ErrMaxSizeExceeded)
+type Limits struct {
+	MaxOperand int `json:"max_operand" yaml:"max_operand"` // Sum(包括BatchSum的每一项)的a、b的绝对值上限
+	MaxStrLen  int `json:"max_str_len" yaml:"max_str_len"` // Concat的a、b各自的长度上限(字节)
+}
+
+type RateLimit struct {
+	RPS   float64 `json:"rps" yaml:"rps"`     // 每秒允许的请求数
+	Burst int     `json:"burst" yaml:"burst"` // 允许的突发请求数，<=0时与RPS相同(至少为1)
+}
+
+func (r RateLimit) GetBurst() int {
+	if r.Burst > 0 {
+		return r.Burst
+	}
+	if r.RPS >= 1 {
+		return int(r.RPS)
+	}
+	return 1
+}
+
+func (d *Dynamic) GetRateLimit(method string) (RateLimit, bool) {
+	r, ok := d.RateLimits[method]
+	return r, ok
+}
+
+func (d *Dynamic) GetTimeout(method string) (time.Duration, bool) {
+	t, ok := d.timeouts[method]
+	return t, ok
+}
+
+func (d *Dynamic) GetDeadline(method string) (deadline.Budget, bool) {
+	b, ok := d.deadlines[method]
+	return b, ok
+}
+
+func (d *Dynamic) GetLoadShed() loadshed.Config {
+	return d.loadShed
+}
+
+func (d *Dynamic) GetResourceGuard() resguard.Config {
+	return d.resGuard
+}
+
+// GetChaos 各接口的故障注入配置，不要修改返回的map
+func (d *Dynamic) GetChaos() map[string]chaos.Fault {
+	return d.chaos
+}
+
+// yaml/json格式的配置文件路径(根据扩展名判断)，为空时使用默认值
+var DynamicConfFile string
+
+var dynamic atomic.Value
+
+// consul KV中配置的快照，设置后ReloadDynamic从快照加载，与DynamicConfFile二选一
+var (
+	dynamicKVMu sync.Mutex
+	dynamicKV   map[string][]byte
+)
+
+// SetDynamicKV 更新consul KV中配置的快照(见gokit_foundation.ConsulKVWatcher)，需要再调用ReloadDynamic才会生效
+func SetDynamicKV(kv map[string][]byte) {
+	dynamicKVMu.Lock()
+	dynamicKV = kv
+	dynamicKVMu.Unlock()
+}
+
+func init() {
+	_ = ReloadDynamic()
+}
+
+// s为空时返回0
+func parseOptionalDuration(name, s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	t, err := time.ParseDuration(s)
+	if err != nil || t <= 0 {
+		return 0, fmt.Errorf("config: invalid %s %q, want positive duration", name, s)
+	}
+	return t, nil
+}
+
+func defDynamic() *Dynamic {
+	return &Dynamic{
+		RateLimits: map[string]RateLimit{
+			"Sum":    {RPS: 100},
+			"Concat": {RPS: 50},
+			// 每次最多100项，按项数计算相当于Sum的20倍
+			"BatchSum": {RPS: 20},
+		},
+		LogLevel: "debug",
+		Timeouts: map[string]string{
+			"Sum":      "1s",
+			"Concat":   "1s",
+			"BatchSum": "2s",
+		},
+		Deadlines: map[string]Deadline{
+			"Sum":      {Default: "500ms", Min: "5ms"},
+			"Concat":   {Default: "500ms", Min: "5ms"},
+			"BatchSum": {Default: "1s", Min: "20ms"},
+		},
+		// 默认只按处理中的请求数判断，每个接口另有maxInFlight的硬上限
+		LoadShed: LoadShed{MaxInFlight: 200, RetryAfter: "500ms"},
+		// 默认不自动重启，平滑重启需要进程由Upgrader启动(见gokit_foundation.Upgrader)
+		ResourceGuard: ResourceGuard{MaxGoroutines: 10000, LimitRatio: 0.9, Actions: []string{"reject", "dump"}},
+	}
+}
+
+func GetDynamic() *Dynamic {
+	return dynamic.Load().(*Dynamic)
+}
+
+// ReloadDynamic 重新读取配置文件或consul KV的快照，未配置的项使用默认值(rate_limits、timeouts、deadlines按接口名合并)，读取失败时保持原配置不变
+func ReloadDynamic() error {
+	d := defDynamic()
+	if DynamicConfFile != "" {
+		b, err := ioutil.ReadFile(DynamicConfFile)
+		if err != nil {
+			return err
+		}
+		if err = unmarshalByExt(DynamicConfFile, b, d); err != nil {
+			return err
+		}
+	}
+	dynamicKVMu.Lock()
+	kv := dynamicKV
+	dynamicKVMu.Unlock()
+	if kv != nil {
+		if err := gokit_foundation.DecodeConsulKV(kv, d); err != nil {
+			return err
+		}
+	}
+	switch d.LogLevel {
+	case "debug", "info", "warn", "error":
+	default:
+		return fmt.Errorf("config: invalid log_level %q", d.LogLevel)
+	}
+	d.timeouts = make(map[string]time.Duration, len(d.Timeouts))
+	for method, s := range d.Timeouts {
+		t, err := time.ParseDuration(s)
+		if err != nil || t <= 0 {
+			return fmt.Errorf("config: invalid timeouts.%s %q, want positive duration", method, s)
+		}
+		d.timeouts[method] = t
+	}
+	d.deadlines = make(map[string]deadline.Budget, len(d.Deadlines))
+	for method, c := range d.Deadlines {
+		def, err := parseOptionalDuration("deadlines."+method+".default", c.Default)
+		if err != nil {
+			return err
+		}
+		min, err := parseOptionalDuration("deadlines."+method+".min", c.Min)
+		if err != nil {
+			return err
+		}
+		d.deadlines[method] = deadline.Budget{Default: def, Min: min}
+	}
+	if d.LoadShed.MaxInFlight < 0 {
+		return fmt.Errorf("config: invalid load_shed.max_in_flight %d", d.LoadShed.MaxInFlight)
+	}
+	d.loadShed.MaxInFlight = d.LoadShed.MaxInFlight
+	var err error
+	if d.loadShed.TargetLatency, err = parseOptionalDuration("load_shed.target_latency", d.LoadShed.TargetLatency); err != nil {
+		return err
+	}
+	if d.loadShed.RetryAfter, err = parseOptionalDuration("load_shed.retry_after", d.LoadShed.RetryAfter); err != nil {
+		return err
+	}
+	if d.resGuard, err = parseResourceGuard(d.ResourceGuard); err != nil {
+		return err
+	}
+	d.chaos = make(map[string]chaos.Fault, len(d.Chaos))
+	for method, c := range d.Chaos {
+		f := chaos.Fault{LatencyRate: c.LatencyRate, ErrorRate: c.ErrorRate, PanicRate: c.PanicRate}
+		if c.Latency != "" {
+			var err error
+			if f.Latency, err = time.ParseDuration(c.Latency); err != nil {
+				return fmt.Errorf("config: invalid chaos.%s.latency %q", method, c.Latency)
+			}
+		}
+		if err := f.Validate(); err != nil {
+			return fmt.Errorf("config: chaos.%s: %v", method, err)
+		}
+		d.chaos[method] = f
+	}
+	for name, f := range d.FeatureFlags {
+		if err := f.Validate(); err != nil {
+			return fmt.Errorf("config: feature_flags.%s: %v", name, err)
+		}
+	}
+	if d.Limits.MaxOperand < 0 || d.Limits.MaxStrLen < 0 {
+		return fmt.Errorf("config: limits.max_operand and limits.max_str_len must not be negative")
+	}
+	dynamic.Store(d)
+	return nil
+}
+
+func parseResourceGuard(r ResourceGuard) (c resguard.Config, err error) {
+	if r.MaxMemoryMB < 0 {
+		return c, fmt.Errorf("config: invalid resource_guard.max_memory_mb %d", r.MaxMemoryMB)
+	}
+	c = resguard.Config{MaxGoroutines: r.MaxGoroutines, MaxFDs: r.MaxFDs, MaxMemory: uint64(r.MaxMemoryMB) << 20, LimitRatio: r.LimitRatio}
+	if c.Interval, err = parseOptionalDuration("resource_guard.interval", r.Interval); err != nil {
+		return c, err
+	}
+	if c.RestartAfter, err = parseOptionalDuration("resource_guard.restart_after", r.RestartAfter); err != nil {
+		return c, err
+	}
+	for _, s := range r.Actions {
+		a, err := resguard.ParseAction(s)
+		if err != nil {
+			return c, fmt.Errorf("config: resource_guard.actions: %v", err)
+		}
+		c.Actions = append(c.Actions, a)
+	}
+	if err = c.Validate(); err != nil {
+		return c, fmt.Errorf("config: %v", err)
+	}
+	return c, nil
+}
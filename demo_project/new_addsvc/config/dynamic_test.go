@@ -0,0 +1,89 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReloadDynamicKV(t *testing.T) {
+	defer func() {
+		SetDynamicKV(nil)
+		_ = ReloadDynamic()
+	}()
+	SetDynamicKV(map[string][]byte{
+		"log_level":                      []byte("warn"),
+		"rate_limits/Sum":                []byte(`{"rps": 10}`),
+		"timeouts/Sum":                   []byte("200ms"),
+		"deadlines/Sum":                  []byte(`{"default": "100ms"}`),
+		"load_shed/target_latency":       []byte("50ms"),
+		"feature_flags/concat_separator": []byte(`{"enabled": true, "percent": 10}`),
+		"limits/max_operand":             []byte("1000"),
+		"resource_guard/max_memory_mb":   []byte("512"),
+	})
+	if err := ReloadDynamic(); err != nil {
+		t.Fatal(err)
+	}
+	d := GetDynamic()
+	if d.LogLevel != "warn" {
+		t.Errorf("got level:%s", d.LogLevel)
+	}
+	// 未配置的接口使用默认值
+	if r, _ := d.GetRateLimit("Sum"); r.RPS != 10 {
+		t.Errorf("got Sum rate limit:%+v", r)
+	}
+	if r, _ := d.GetRateLimit("Concat"); r.RPS != 50 {
+		t.Errorf("got Concat rate limit:%+v", r)
+	}
+	if to, _ := d.GetTimeout("Sum"); to != 200*time.Millisecond {
+		t.Errorf("got Sum timeout:%v", to)
+	}
+	if b, _ := d.GetDeadline("Sum"); b.Default != 100*time.Millisecond || b.Min != 0 {
+		t.Errorf("got Sum deadline:%+v", b)
+	}
+	if b, _ := d.GetDeadline("Concat"); b.Default != 500*time.Millisecond || b.Min != 5*time.Millisecond {
+		t.Errorf("got Concat deadline:%+v", b)
+	}
+	// 未配置的字段使用默认值
+	if c := d.GetLoadShed(); c.TargetLatency != 50*time.Millisecond || c.MaxInFlight != 200 || c.RetryAfter != 500*time.Millisecond {
+		t.Errorf("got load shed:%+v", c)
+	}
+	if c := d.GetResourceGuard(); c.MaxMemory != 512<<20 || c.MaxGoroutines != 10000 || c.LimitRatio != 0.9 || len(c.Actions) != 2 {
+		t.Errorf("got resource guard:%+v", c)
+	}
+	if f := d.FeatureFlags["concat_separator"]; !f.Enabled || f.Percent != 10 {
+		t.Errorf("got feature flag:%+v", f)
+	}
+	if d.Limits.MaxOperand != 1000 || d.Limits.MaxStrLen != 0 {
+		t.Errorf("got limits:%+v", d.Limits)
+	}
+
+	// 不合法的配置不生效
+	SetDynamicKV(map[string][]byte{"log_level": []byte("verbose")})
+	if err := ReloadDynamic(); err == nil || GetDynamic().LogLevel != "warn" {
+		t.Errorf("got level:%s err:%v", GetDynamic().LogLevel, err)
+	}
+	SetDynamicKV(map[string][]byte{"feature_flags/f": []byte(`{"enabled": true, "percent": 200}`)})
+	if err := ReloadDynamic(); err == nil {
+		t.Error("want err for percent 200")
+	}
+	SetDynamicKV(map[string][]byte{"limits/max_str_len": []byte("-1")})
+	if err := ReloadDynamic(); err == nil {
+		t.Error("want err for negative max_str_len")
+	}
+	SetDynamicKV(map[string][]byte{"deadlines/Sum": []byte(`{"min": "5"}`)})
+	if err := ReloadDynamic(); err == nil {
+		t.Error("want err for min 5")
+	}
+	SetDynamicKV(map[string][]byte{"load_shed/max_in_flight": []byte("-1")})
+	if err := ReloadDynamic(); err == nil {
+		t.Error("want err for max_in_flight -1")
+	}
+	SetDynamicKV(map[string][]byte{"resource_guard/actions": []byte(`["reject", "kill"]`)})
+	if err := ReloadDynamic(); err == nil {
+		t.Error("want err for action kill")
+	}
+	SetDynamicKV(map[string][]byte{"rate_limit/Sum": []byte(`{"rps": 1}`)})
+	if err := ReloadDynamic(); err == nil {
+		t.Error("want err for unknown key")
+	}
+}
@@ -0,0 +1,46 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+)
+
+/*
+服务的监听地址与注册到consul的地址(advertise)分开配置：
+-	监听地址默认0.0.0.0，即监听所有网卡
+-	advertise地址是consul及其他服务访问本服务使用的地址，必须是一个可达的IP或主机名
+	未配置时自动探测本机网卡地址，见Bootstrap.ResolveAdvertiseHost
+*/
+
+const DefaultListenHost = "0.0.0.0"
+
+// RFC 1123 主机名
+var hostnameRegexp = regexp.MustCompile(`^([a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)(\.[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$`)
+
+// 校验advertise地址，不能是0.0.0.0这类未指定地址，也不能是非法的IP(如127.0.0.1111)
+func ValidateAdvertiseHost(host string) error {
+	if host == "" {
+		return fmt.Errorf("advertise host is empty")
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		if ip.IsUnspecified() {
+			return fmt.Errorf("advertise host %q is an unspecified address, consul can't reach it", host)
+		}
+		return nil
+	}
+	// 全是数字和点的不是合法主机名，而是写错的IP
+	if isDottedDigits(host) || len(host) > 253 || !hostnameRegexp.MatchString(host) {
+		return fmt.Errorf("advertise host %q is neither a valid IP nor a valid hostname", host)
+	}
+	return nil
+}
+
+func isDottedDigits(s string) bool {
+	for _, c := range s {
+		if c != '.' && (c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,31 @@
+package config
+
+import "testing"
+
+func TestValidateAdvertiseHost(t *testing.T) {
+	test := []struct {
+		host    string
+		wantErr bool
+	}{
+		{host: "127.0.0.1"},
+		{host: "192.168.1.10"},
+		{host: "::1"},
+		{host: "addsvc-1.internal"},
+		{host: "localhost"},
+		{host: "", wantErr: true},
+		{host: "127.0.0.1111", wantErr: true},
+		{host: "256.1.1.1", wantErr: true},
+		{host: "0.0.0.0", wantErr: true},
+		{host: "::", wantErr: true},
+		{host: "bad_host", wantErr: true},
+		{host: "-addsvc", wantErr: true},
+		{host: "addsvc..internal", wantErr: true},
+		{host: "127.0.0.1:8080", wantErr: true},
+	}
+	for _, tt := range test {
+		err := ValidateAdvertiseHost(tt.host)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("host:%q wantErr:%v got err:%v", tt.host, tt.wantErr, err)
+		}
+	}
+}
@@ -2,9 +2,17 @@ package config
 
 import (
 	"github.com/go-redis/redis"
+	"os"
 	"time"
 )
 
+// 覆盖redis地址和密码的环境变量
+const (
+	EnvRedisAddr     = "ADDSVC_REDIS_ADDR"
+	EnvRedisPassword = "ADDSVC_REDIS_PASSWORD"
+)
+
+// 环境变量EnvRedisAddr、EnvRedisPassword优先(密码可以设为空)，未设置时使用本地开发环境的默认值
 func GetRedisConf() *redis.Options {
 	var opt *redis.Options
 
@@ -22,6 +30,12 @@ func GetRedisConf() *redis.Options {
 		MinIdleConns: 1,
 		IdleTimeout:  3 * time.Second,
 	}
+	if addr := os.Getenv(EnvRedisAddr); addr != "" {
+		opt.Addr = addr
+	}
+	if password, ok := os.LookupEnv(EnvRedisPassword); ok {
+		opt.Password = password
+	}
 
 	return opt
 }
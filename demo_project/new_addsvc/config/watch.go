@@ -0,0 +1,67 @@
+package config
+
+import (
+	"context"
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-kit/kit/log"
+	"path/filepath"
+	"time"
+)
+
+// WatchDynamic 监听DynamicConfFile，文件变化时调用onChange(一般为重新加载配置)，直到ctx结束
+// 监听的是文件所在目录而不是文件本身，因为很多编辑器是通过rename替换文件的，直接监听文件会丢失后续事件
+// k8s configmap挂载的文件是指向..data/下的symlink，kubelet更新时把..data这个symlink整体替换(rename)为新的目录，
+// 文件本身没有事件，所以..data的Create/Rename也视为文件变化
+// 短时间内的多次变化(如先清空再写入)合并为一次，debounce为合并的时间窗口
+// 热更新不是关键功能，监听过程中的err只打印，不退出
+func WatchDynamic(ctx context.Context, logger log.Logger, debounce time.Duration, onChange func()) error {
+	if DynamicConfFile == "" {
+		<-ctx.Done()
+		return nil
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	file := filepath.Clean(DynamicConfFile)
+	if err = watcher.Add(filepath.Dir(file)); err != nil {
+		return err
+	}
+
+	var fire <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if !dynamicChanged(ev, file) {
+				continue
+			}
+			fire = time.After(debounce)
+		case <-fire:
+			fire = nil
+			onChange()
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			logger.Log("WatchDynamic", "watch err", "file", file, "err", err)
+		}
+	}
+}
+
+// configmap挂载目录中由kubelet原子替换的symlink
+const configMapDataDir = "..data"
+
+func dynamicChanged(ev fsnotify.Event, file string) bool {
+	name := filepath.Clean(ev.Name)
+	if name == file {
+		return ev.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) != 0
+	}
+	return name == filepath.Join(filepath.Dir(file), configMapDataDir) && ev.Op&(fsnotify.Create|fsnotify.Rename) != 0
+}
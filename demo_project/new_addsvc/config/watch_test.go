@@ -0,0 +1,148 @@
+package config
+
+import (
+	"context"
+	"github.com/go-kit/kit/log"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatchDynamic(t *testing.T) {
+	dir, clean := tempDir(t)
+	DynamicConfFile = writeTempFile(t, dir, "dynamic.yaml", "log_level: info\n")
+	defer func() {
+		clean()
+		DynamicConfFile = ""
+		_ = ReloadDynamic()
+	}()
+	if err := ReloadDynamic(); err != nil || GetDynamic().LogLevel != "info" {
+		t.Fatalf("got level:%s err:%v", GetDynamic().LogLevel, err)
+	}
+
+	changed := make(chan struct{}, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- WatchDynamic(ctx, log.NewNopLogger(), 10*time.Millisecond, func() {
+			_ = ReloadDynamic()
+			changed <- struct{}{}
+		})
+	}()
+	// 等待watcher启动
+	time.Sleep(50 * time.Millisecond)
+
+	if err := ioutil.WriteFile(DynamicConfFile, []byte("log_level: warn\nrate_limits:\n  Sum: {rps: 10}\ntimeouts:\n  Sum: 200ms\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("onChange not called after file changed")
+	}
+	d := GetDynamic()
+	if r, _ := d.GetRateLimit("Sum"); d.LogLevel != "warn" || r.RPS != 10 {
+		t.Errorf("got:%+v", *d)
+	}
+	if to, ok := d.GetTimeout("Sum"); !ok || to != 200*time.Millisecond {
+		t.Errorf("Sum timeout got:%v", to)
+	}
+	// 文件中未配置的接口使用默认值
+	if r, ok := d.GetRateLimit("Concat"); !ok || r.RPS != 50 {
+		t.Errorf("Concat got:%+v", r)
+	}
+	if to, ok := d.GetTimeout("Concat"); !ok || to != time.Second {
+		t.Errorf("Concat timeout got:%v", to)
+	}
+
+	// 非法的级别不生效，保持原配置
+	if err := ioutil.WriteFile(DynamicConfFile, []byte("log_level: verbose\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	<-changed
+	if GetDynamic().LogLevel != "warn" {
+		t.Errorf("invalid log_level applied: %s", GetDynamic().LogLevel)
+	}
+	// 非法的超时同样不生效
+	if err := ioutil.WriteFile(DynamicConfFile, []byte("timeouts:\n  Sum: 5\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	<-changed
+	if to, _ := GetDynamic().GetTimeout("Sum"); to != 200*time.Millisecond {
+		t.Errorf("invalid timeout applied: %v", to)
+	}
+
+	// 故障注入配置
+	if err := ioutil.WriteFile(DynamicConfFile, []byte("chaos:\n  Sum: {latency: 300ms, latency_rate: 0.5, error_rate: 0.1}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	<-changed
+	if f := GetDynamic().GetChaos()["Sum"]; f.Latency != 300*time.Millisecond || f.LatencyRate != 0.5 || f.ErrorRate != 0.1 {
+		t.Errorf("chaos got:%+v", f)
+	}
+	if err := ioutil.WriteFile(DynamicConfFile, []byte("chaos:\n  Sum: {error_rate: 2}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	<-changed
+	if f := GetDynamic().GetChaos()["Sum"]; f.ErrorRate != 0.1 {
+		t.Errorf("invalid chaos applied: %+v", f)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("WatchDynamic got err:%v", err)
+	}
+}
+
+// 模拟kubelet更新configmap：文件是指向..data/的symlink，更新时把..data原子替换为新目录
+func TestWatchDynamicConfigMap(t *testing.T) {
+	dir, clean := tempDir(t)
+	defer func() {
+		clean()
+		DynamicConfFile = ""
+		_ = ReloadDynamic()
+	}()
+	version := func(name, content string) {
+		if err := os.Mkdir(filepath.Join(dir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		writeTempFile(t, filepath.Join(dir, name), "dynamic.yaml", content)
+		tmp := filepath.Join(dir, "..data_tmp")
+		if err := os.Symlink(name, tmp); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(tmp, filepath.Join(dir, configMapDataDir)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	version("..2020_10_01", "log_level: info\n")
+	DynamicConfFile = filepath.Join(dir, "dynamic.yaml")
+	if err := os.Symlink(filepath.Join(configMapDataDir, "dynamic.yaml"), DynamicConfFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReloadDynamic(); err != nil || GetDynamic().LogLevel != "info" {
+		t.Fatalf("got level:%s err:%v", GetDynamic().LogLevel, err)
+	}
+
+	changed := make(chan struct{}, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go WatchDynamic(ctx, log.NewNopLogger(), 10*time.Millisecond, func() {
+		_ = ReloadDynamic()
+		changed <- struct{}{}
+	})
+	// 等待watcher启动
+	time.Sleep(50 * time.Millisecond)
+
+	version("..2020_10_02", "log_level: warn\n")
+	select {
+	case <-changed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("onChange not called after ..data swapped")
+	}
+	if GetDynamic().LogLevel != "warn" {
+		t.Errorf("got level:%s", GetDynamic().LogLevel)
+	}
+}
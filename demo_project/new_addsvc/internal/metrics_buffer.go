@@ -0,0 +1,72 @@
+package internal
+
+import (
+	"context"
+	"github.com/go-kit/kit/metrics"
+)
+
+type bufferedSample struct {
+	lvs   []string
+	value float64
+}
+
+// BufferedHistogram 带缓冲的Histogram，Observe仅将样本放入channel，由后台任务(Run)异步写入next，
+// 以减少高并发下next(如prometheus summary)内部的锁竞争
+type BufferedHistogram struct {
+	next metrics.Histogram
+	lvs  []string
+	ch   chan bufferedSample
+}
+
+func NewBufferedHistogram(next metrics.Histogram, size int) *BufferedHistogram {
+	return &BufferedHistogram{
+		next: next,
+		ch:   make(chan bufferedSample, size),
+	}
+}
+
+func (h *BufferedHistogram) With(labelValues ...string) metrics.Histogram {
+	return &BufferedHistogram{
+		next: h.next,
+		lvs:  append(h.lvs[:len(h.lvs):len(h.lvs)], labelValues...),
+		ch:   h.ch,
+	}
+}
+
+func (h *BufferedHistogram) Observe(value float64) {
+	s := bufferedSample{lvs: h.lvs, value: value}
+	select {
+	case h.ch <- s:
+	default:
+		// 缓冲区满时同步写入，保证不丢失样本
+		h.observe(s)
+	}
+}
+
+func (h *BufferedHistogram) observe(s bufferedSample) {
+	h.next.With(s.lvs...).Observe(s.value)
+}
+
+// Run 在后台将缓冲区中的样本写入next，ctx结束时返回，返回后需调用Flush写入剩余样本
+func (h *BufferedHistogram) Run(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case s := <-h.ch:
+			h.observe(s)
+		}
+	}
+}
+
+// Flush 写入缓冲区中剩余的样本
+func (h *BufferedHistogram) Flush() {
+	for {
+		select {
+		case s := <-h.ch:
+			h.observe(s)
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package internal
+
+import (
+	"context"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+type countingHistogram struct {
+	n *int64
+}
+
+func (h countingHistogram) With(...string) metrics.Histogram { return h }
+func (h countingHistogram) Observe(float64)                  { atomic.AddInt64(h.n, 1) }
+
+func TestBufferedHistogramNoLoss(t *testing.T) {
+	for _, size := range []int{1, 1024} {
+		var n int64
+		bh := NewBufferedHistogram(countingHistogram{n: &n}, size)
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			_ = bh.Run(ctx)
+			close(done)
+		}()
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 1000; j++ {
+					bh.With("method", "Sum").With("success", "true").Observe(1)
+				}
+			}()
+		}
+		wg.Wait()
+		// 模拟退出：先停止后台任务，再flush剩余样本
+		cancel()
+		<-done
+		bh.Flush()
+
+		if n != 10*1000 {
+			t.Errorf("size:%d got samples:%d want:%d", size, n, 10*1000)
+		}
+	}
+}
+
+func BenchmarkHistogram(b *testing.B) {
+	b.Run("sync", func(b *testing.B) {
+		duration := NewMetrics(log.NewNopLogger()).Duration
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				duration.With("method", "Sum").With("success", "true").Observe(0.001)
+			}
+		})
+	})
+	b.Run("buffered", func(b *testing.B) {
+		bh := NewBufferedHistogram(NewMetrics(log.NewNopLogger()).Duration, 4096)
+		ctx, cancel := context.WithCancel(context.Background())
+		go bh.Run(ctx)
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				bh.With("method", "Sum").With("success", "true").Observe(0.001)
+			}
+		})
+		cancel()
+		bh.Flush()
+	})
+}
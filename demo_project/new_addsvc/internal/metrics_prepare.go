@@ -1,51 +1,158 @@
 package internal
 
 import (
+	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/metrics"
-	"github.com/go-kit/kit/metrics/prometheus"
 	stdprometheus "github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go-util/_go"
+	"gokit_foundation"
+	"gokit_foundation/blobstore"
+	"gokit_foundation/journal"
+	"gokit_foundation/metricsx"
+	"gokit_foundation/resguard"
 	"net/http"
 )
 
+// endpoint层耗时histogram的名字和bucket，pkg/endpoint.SLOs的告警规则基于此生成
+const DurationMetric = "example_addsvc_request_duration_seconds"
+
+var DurationBuckets = stdprometheus.DefBuckets
+
 type Metrics struct {
 	Ints, Chars metrics.Counter
 	Duration    metrics.Histogram
+	// grpc拦截器记录的调用数、耗时、处理中的调用数等，包括decode失败的调用
+	GRPC *gokit_foundation.GRPCServerMetrics
+	// 各接口断路器的状态：0关闭 1半开 2打开
+	BreakerState metrics.Gauge
+	// 丢弃或投递失败的领域事件数，见gokit_foundation/events
+	EventFailures metrics.Counter
+	// 响应缓存的查询次数，labels: method、result(hit、miss、bypass、error)，见gokit_foundation/cache
+	CacheLookups metrics.Counter
+	// 被recover的panic数，labels: layer(endpoint、grpc、http)、method，见gokit_foundation.RecoveryMiddleware
+	Panics metrics.Counter
+	// 超时预算不足被拒绝(stage=rejected)以及处理过程中超时(stage=exceeded)的调用数，labels: method、stage，见gokit_foundation/deadline
+	DeadlineExceeded metrics.Counter
+	// 过载保护拒绝的调用数(labels: method、priority)以及最近一次调用时的负载(1为饱和)，见gokit_foundation/loadshed
+	LoadShed     metrics.Counter
+	LoadShedLoad metrics.Gauge
+	// goroutine数、fd数、内存的使用量、生效的软上限、是否超限(labels: resource)以及执行的保护动作数(labels: action)，见gokit_foundation/resguard
+	ResGuard resguard.Metrics
+	// 发现consul中的注册信息丢失后重新注册的次数(labels: result)，见gokit_foundation.ConsulKeepRegistered
+	ConsulReregistrations metrics.Counter
+	// 请求/响应body(grpc为消息)压缩前和线路上的字节数，labels: transport(grpc、http)、direction(in、out)、kind(wire、uncompressed)，
+	// 见gokit_foundation.NewGRPCCompressionStatsHandler
+	PayloadBytes metrics.Counter
+	// 定时任务的执行次数(labels: job、result)和耗时(labels: job)，见go-util/_go.Cron
+	Cron _go.CronMetrics
+	// 为1表示本实例是定时任务的leader，见gokit_foundation.Leadership
+	Leader metrics.Gauge
+	// SQS journal中处理中的消息数、启动时恢复的消息数(labels: result)和恢复耗时，见gokit_foundation/journal
+	Journal journal.Metrics
+	// 上传接收的字节数、进行中的上传数以及上传数(labels: result)，见gokit_foundation/blobstore
+	Blob blobstore.Metrics
+	// 去重窗口内被跳过的重复消息数，labels: group(sqs、nats)、state(done、in_progress)，见gokit_foundation/dedup
+	DedupDuplicates metrics.Counter
+
+	// 所有指标都由provider创建，为prometheus时注册在它自己的registry上，而不是prometheus的全局registry
+	provider metricsx.Provider
 }
 
-func NewMetrics() *Metrics {
-	// 创建监控指标
-	var ints, chars metrics.Counter
-	{
-		// Business-level metrics.
-		ints = prometheus.NewCounterFrom(stdprometheus.CounterOpts{
-			Namespace: "example",
-			Subsystem: "addsvc",
-			Name:      "integers_summed",
-			Help:      "Total count of integers summed via the Sum method.",
-		}, []string{})
-		chars = prometheus.NewCounterFrom(stdprometheus.CounterOpts{
-			Namespace: "example",
-			Subsystem: "addsvc",
-			Name:      "characters_concatenated",
-			Help:      "Total count of characters concatenated via the Concat method.",
-		}, []string{})
+/*
+指标后端由metricsx.Provider决定(prometheus、statsd、dogstatsd、otlp，见config.Bootstrap.Metrics)，指标名在各后端中相同
+prometheus是弱依赖：指标注册失败时只打印警告，对应指标退化为discard(不做任何事)，不影响服务启动和接口调用
+*/
+func NewMetrics(logger log.Logger) *Metrics {
+	return NewMetricsWith(metricsx.NewPrometheus(nil, logger), logger)
+}
+
+func NewMetricsWith(p metricsx.Provider, logger log.Logger) *Metrics {
+	opts := func(name, help string, labelNames ...string) metricsx.Opts {
+		return metricsx.Opts{Namespace: "example", Subsystem: "addsvc", Name: name, Help: help, LabelNames: labelNames}
+	}
+	// go runtime(goroutine数量、gc统计等)以及进程(cpu、内存、fd等)指标，只有prometheus提供
+	if prom, ok := p.(*metricsx.Prometheus); ok {
+		prom.Register("go", stdprometheus.NewGoCollector())
+		prom.Register("process", stdprometheus.NewProcessCollector(stdprometheus.ProcessCollectorOpts{}))
+	} else {
+		logger.Log("NewMetrics", "runtime metrics disabled", "reason", "only provided by prometheus backend")
 	}
-	// 监控指标
-	var duration metrics.Histogram
-	{
+
+	m := &Metrics{
+		// Business-level metrics.
+		Ints:  p.NewCounter(opts("integers_summed", "Total count of integers summed via the Sum method.")),
+		Chars: p.NewCounter(opts("characters_concatenated", "Total count of characters concatenated via the Concat method.")),
 		// Endpoint-level metrics.
-		duration = prometheus.NewSummaryFrom(stdprometheus.SummaryOpts{
-			Namespace: "example",
-			Subsystem: "addsvc",
-			Name:      "request_duration_seconds",
-			Help:      "Request duration in seconds.",
-		}, []string{"method", "success"})
+		// 为prometheus时histogram的bucket上附带trace_id exemplar，见gokit_foundation/otel.Histogram
+		Duration:      p.NewHistogram(opts("request_duration_seconds", "Request duration in seconds.", "method", "success"), DurationBuckets),
+		GRPC:          gokit_foundation.NewGRPCServerMetricsWith(p, "example", "addsvc"),
+		BreakerState:  p.NewGauge(opts("circuit_breaker_state", "Circuit breaker state of each method: 0 closed, 1 half-open, 2 open.", "method")),
+		EventFailures: p.NewCounter(opts("event_publish_failures_total", "Total count of domain events dropped or failed to deliver.", "topic", "reason")),
+		CacheLookups:  p.NewCounter(opts("cache_lookups_total", "Total count of response cache lookups by result.", "method", "result")),
+		Panics:        p.NewCounter(opts("panics_total", "Total count of recovered panics by layer and method.", "layer", "method")),
+		DeadlineExceeded: p.NewCounter(opts("deadline_exceeded_total",
+			"Total count of calls rejected for insufficient deadline budget or timed out while processing.", "method", "stage")),
+		LoadShed:     p.NewCounter(opts("load_shed_total", "Total count of calls rejected by load shedding by method and priority.", "method", "priority")),
+		LoadShedLoad: p.NewGauge(opts("load_shed_load", "Load observed by load shedding, 1 means saturated.")),
+		ResGuard: resguard.Metrics{
+			Usage:   p.NewGauge(opts("resource_usage", "Goroutines, open file descriptors and memory bytes sampled by the resource guard.", "resource")),
+			Limit:   p.NewGauge(opts("resource_soft_limit", "Effective soft limit of each resource, 0 means not checked.", "resource")),
+			Tripped: p.NewGauge(opts("resource_limit_exceeded", "1 if the resource is over its soft limit.", "resource")),
+			Actions: p.NewCounter(opts("resource_guard_actions_total",
+				"Total count of protective actions by action(reject counts rejected calls, dump, restart).", "action")),
+		},
+		ConsulReregistrations: p.NewCounter(opts("consul_reregistrations_total",
+			"Total count of re-registrations after the instance disappeared from consul, by result.", "result")),
+		PayloadBytes: p.NewCounter(opts("payload_bytes_total",
+			"Total bytes of request and response payloads on the wire and uncompressed, by transport and direction.", "transport", "direction", "kind")),
+		Cron: _go.CronMetrics{
+			Runs:     p.NewCounter(opts("cron_runs_total", "Total count of scheduled job runs by job and result(ok, error, skipped, standby).", "job", "result")),
+			Duration: p.NewHistogram(opts("cron_duration_seconds", "Duration of scheduled job runs in seconds.", "job"), stdprometheus.DefBuckets),
+		},
+		Leader: p.NewGauge(opts("leader", "1 if the instance is the leader of singleton scheduled jobs.")),
+		Journal: journal.Metrics{
+			Size: p.NewGauge(opts("journal_entries", "Number of in-flight SQS messages in the local journal.")),
+			Replayed: p.NewCounter(opts("journal_replayed_total",
+				"Total count of journal entries recovered at startup by result(completed, compensated, requeued, failed).", "result")),
+			ReplayDuration: p.NewHistogram(opts("journal_replay_duration_seconds", "Duration of journal recovery at startup in seconds."), stdprometheus.DefBuckets),
+		},
+		Blob: blobstore.Metrics{
+			Received: p.NewCounter(opts("blob_upload_received_bytes_total", "Total bytes received by blob uploads, including failed ones.")),
+			InFlight: p.NewGauge(opts("blob_uploads_in_flight", "Number of blob uploads in progress.")),
+			Uploads: p.NewCounter(opts("blob_uploads_total",
+				"Total count of blob uploads by result(ok, too_large, size_mismatch, checksum_mismatch, canceled, error).", "result")),
+		},
+		DedupDuplicates: p.NewCounter(opts("dedup_duplicates_total",
+			"Total count of duplicate queue messages suppressed by consumer group and state(done, in_progress).", "group", "state")),
+		provider: p,
 	}
-	http.DefaultServeMux.Handle("/metrics", promhttp.Handler())
-	return &Metrics{
-		Ints:     ints,
-		Chars:    chars,
-		Duration: duration,
+	if prom, ok := p.(*metricsx.Prometheus); ok && prom.Err() != nil {
+		logger.Log("NewMetrics", "WARNING", "err", prom.Err(), "hint", "注册失败的指标不会被上报")
 	}
+	return m
+}
+
+// Handler 返回提供给prometheus调用的/metrics接口，
+// 请求的Accept为OpenMetrics时输出exemplar，否则为原来的text格式；其他后端为推送模式，返回404
+func (m *Metrics) Handler() http.Handler {
+	if prom, ok := m.provider.(*metricsx.Prometheus); ok {
+		return prom.Handler()
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "metrics are pushed, not served on /metrics", http.StatusNotFound)
+	})
+}
+
+// Gatherer 所有指标所在的registry，用于推送模式(见gokit_foundation/metricspush)，后端不是prometheus时为nil
+func (m *Metrics) Gatherer() stdprometheus.Gatherer {
+	if prom, ok := m.provider.(*metricsx.Prometheus); ok {
+		return prom.Gatherer()
+	}
+	return nil
+}
+
+// Pusher 后端为推送模式(statsd、dogstatsd、otlp)时需要运行的推送任务，prometheus时为nil
+func (m *Metrics) Pusher() metricsx.Pusher {
+	p, _ := m.provider.(metricsx.Pusher)
+	return p
 }
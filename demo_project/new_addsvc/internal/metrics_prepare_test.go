@@ -0,0 +1,93 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/api/trace/tracetest"
+	"gokit_foundation/metricsx"
+	"gokit_foundation/otel"
+	"google.golang.org/grpc"
+	"net/http/httptest"
+	"new_addsvc/pkg/service"
+	"strings"
+	"testing"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	m := NewMetrics(log.NewNopLogger())
+	m.Ints.Add(3)
+	m.BreakerState.With("method", "Concat").Set(2)
+	m.Cron.Runs.With("job", "warmCache", "result", "ok").Add(1)
+	_, _ = m.GRPC.UnaryServerInterceptor()(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/addsvcpb.Add/Sum"},
+		func(ctx context.Context, req interface{}) (interface{}, error) { return nil, nil })
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	body := rec.Body.String()
+	for _, name := range []string{"go_goroutines", "go_gc_duration_seconds", "example_addsvc_integers_summed 3", `example_addsvc_circuit_breaker_state{method="Concat"} 2`,
+		`example_addsvc_cron_runs_total{job="warmCache",result="ok"} 1`,
+		`example_addsvc_grpc_server_handled_total{code="OK",method="/addsvcpb.Add/Sum",type="unary"} 1`} {
+		if !strings.Contains(body, name) {
+			t.Errorf("metric %q not found in /metrics", name)
+		}
+	}
+}
+
+// OpenMetrics格式输出耗时的exemplar
+func TestMetricsHandlerExemplar(t *testing.T) {
+	m := NewMetrics(log.NewNopLogger())
+	tracer := &tracetest.MockTracer{Sampled: true, StartSpanID: new(uint64)}
+	ctx, span := tracer.Start(context.Background(), "Sum")
+	otel.ObserveContext(ctx, m.Duration.With("method", "Sum", "success", "true"), 0.01)
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text; version=0.0.1")
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, req)
+	want := fmt.Sprintf(`%s_bucket{method="Sum",success="true",le="0.01"} 1 # {trace_id="%s"} 0.01`, DurationMetric, span.SpanContext().TraceID)
+	if !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("exemplar %q not found in /metrics", want)
+	}
+}
+
+// 所有指标都注册失败的registry
+type failingRegistry struct {
+	*stdprometheus.Registry
+}
+
+func (r failingRegistry) Register(stdprometheus.Collector) error {
+	return errors.New("registry unavailable")
+}
+
+func TestMetricsWithFailingRegistry(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := log.NewLogfmtLogger(buf)
+	m := NewMetricsWith(metricsx.NewPrometheus(failingRegistry{stdprometheus.NewRegistry()}, logger), logger)
+	if !strings.Contains(buf.String(), "WARNING") || !strings.Contains(buf.String(), "registry unavailable") {
+		t.Errorf("want warning logged, got:%s", buf.String())
+	}
+
+	// 指标退化为discard，调用接口不受影响
+	svc := service.New(log.NewNopLogger(), nil, m.Ints, m.Chars, nil)
+	if v, err := svc.Sum(context.Background(), 1, 2); err != nil || v != 3 {
+		t.Errorf("got v:%d err:%v", v, err)
+	}
+	m.Duration.With("method", "Sum", "success", "true").Observe(1)
+	_, _ = m.GRPC.UnaryServerInterceptor()(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/addsvcpb.Add/Sum"},
+		func(ctx context.Context, req interface{}) (interface{}, error) { return nil, nil })
+	m.BreakerState.With("method", "Sum").Set(2)
+	m.EventFailures.With("topic", "addsvc.events", "reason", "write").Add(1)
+	m.CacheLookups.With("method", "Concat", "result", "hit").Add(1)
+	m.Blob.Uploads.With("result", "ok").Add(1)
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Code != 200 {
+		t.Errorf("got status:%d", rec.Code)
+	}
+}
@@ -9,6 +9,7 @@ package addsvcpb
 import (
 	context "context"
 	proto "github.com/golang/protobuf/proto"
+	_ "google.golang.org/genproto/googleapis/api/annotations"
 	grpc "google.golang.org/grpc"
 	codes "google.golang.org/grpc/codes"
 	status "google.golang.org/grpc/status"
@@ -36,8 +37,8 @@ type SumRequest struct {
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	A int64 `protobuf:"varint,1,opt,name=a,proto3" json:"a,omitempty"`
-	B int64 `protobuf:"varint,2,opt,name=b,proto3" json:"b,omitempty"`
+	A int64 `protobuf:"varint,1,opt,name=a,proto3" json:"a,omitempty"` // @kit: type:"int" validate:"min=-9007199254740991,max=9007199254740991"
+	B int64 `protobuf:"varint,2,opt,name=b,proto3" json:"b,omitempty"` // @kit: type:"int" validate:"min=-9007199254740991,max=9007199254740991"
 }
 
 func (x *SumRequest) Reset() {
@@ -92,8 +93,8 @@ type SumReply struct {
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	V       int64                  `protobuf:"varint,1,opt,name=v,proto3" json:"v,omitempty"`
-	Retcode resultcode.RESULT_CODE `protobuf:"varint,2,opt,name=retcode,proto3,enum=resultcode.RESULT_CODE" json:"retcode,omitempty"`
+	V       int64                  `protobuf:"varint,1,opt,name=v,proto3" json:"v,omitempty"`                                         // @kit: type:"int"
+	Retcode resultcode.RESULT_CODE `protobuf:"varint,2,opt,name=retcode,proto3,enum=resultcode.RESULT_CODE" json:"retcode,omitempty"` // @kit: name:"RetCode" json:"ret_code"
 }
 
 func (x *SumReply) Reset() {
@@ -148,8 +149,8 @@ type ConcatRequest struct {
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	A string `protobuf:"bytes,1,opt,name=a,proto3" json:"a,omitempty"`
-	B string `protobuf:"bytes,2,opt,name=b,proto3" json:"b,omitempty"`
+	A string `protobuf:"bytes,1,opt,name=a,proto3" json:"a,omitempty"` // @kit: validate:"required_without=B,max=10"
+	B string `protobuf:"bytes,2,opt,name=b,proto3" json:"b,omitempty"` // @kit: validate:"required_without=A,max=10"
 }
 
 func (x *ConcatRequest) Reset() {
@@ -205,7 +206,7 @@ type ConcatReply struct {
 	unknownFields protoimpl.UnknownFields
 
 	V       string                 `protobuf:"bytes,1,opt,name=v,proto3" json:"v,omitempty"`
-	Retcode resultcode.RESULT_CODE `protobuf:"varint,2,opt,name=retcode,proto3,enum=resultcode.RESULT_CODE" json:"retcode,omitempty"`
+	Retcode resultcode.RESULT_CODE `protobuf:"varint,2,opt,name=retcode,proto3,enum=resultcode.RESULT_CODE" json:"retcode,omitempty"` // @kit: name:"RetCode" json:"ret_code"
 }
 
 func (x *ConcatReply) Reset() {
@@ -254,38 +255,318 @@ func (x *ConcatReply) GetRetcode() resultcode.RESULT_CODE {
 	return resultcode.RESULT_CODE_RET_OK
 }
 
+// The ConcatStream request contains one piece of the strings.
+type ConcatStreamRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Piece string `protobuf:"bytes,1,opt,name=piece,proto3" json:"piece,omitempty"`
+}
+
+func (x *ConcatStreamRequest) Reset() {
+	*x = ConcatStreamRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_addsvc_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ConcatStreamRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ConcatStreamRequest) ProtoMessage() {}
+
+func (x *ConcatStreamRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_addsvc_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ConcatStreamRequest.ProtoReflect.Descriptor instead.
+func (*ConcatStreamRequest) Descriptor() ([]byte, []int) {
+	return file_addsvc_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ConcatStreamRequest) GetPiece() string {
+	if x != nil {
+		return x.Piece
+	}
+	return ""
+}
+
+// The SumStream request contains one number to add.
+type SumStreamRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Num int64 `protobuf:"varint,1,opt,name=num,proto3" json:"num,omitempty"`
+}
+
+func (x *SumStreamRequest) Reset() {
+	*x = SumStreamRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_addsvc_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SumStreamRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SumStreamRequest) ProtoMessage() {}
+
+func (x *SumStreamRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_addsvc_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SumStreamRequest.ProtoReflect.Descriptor instead.
+func (*SumStreamRequest) Descriptor() ([]byte, []int) {
+	return file_addsvc_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *SumStreamRequest) GetNum() int64 {
+	if x != nil {
+		return x.Num
+	}
+	return 0
+}
+
+// The SumSeries request contains all the numbers to add.
+type SumSeriesRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Nums []int64 `protobuf:"varint,1,rep,packed,name=nums,proto3" json:"nums,omitempty"`
+}
+
+func (x *SumSeriesRequest) Reset() {
+	*x = SumSeriesRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_addsvc_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SumSeriesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SumSeriesRequest) ProtoMessage() {}
+
+func (x *SumSeriesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_addsvc_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SumSeriesRequest.ProtoReflect.Descriptor instead.
+func (*SumSeriesRequest) Descriptor() ([]byte, []int) {
+	return file_addsvc_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *SumSeriesRequest) GetNums() []int64 {
+	if x != nil {
+		return x.Nums
+	}
+	return nil
+}
+
+// The BatchSum request contains the pairs to sum.
+type BatchSumRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Items []*SumRequest `protobuf:"bytes,1,rep,name=items,proto3" json:"items,omitempty"`
+}
+
+func (x *BatchSumRequest) Reset() {
+	*x = BatchSumRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_addsvc_proto_msgTypes[7]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *BatchSumRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchSumRequest) ProtoMessage() {}
+
+func (x *BatchSumRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_addsvc_proto_msgTypes[7]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchSumRequest.ProtoReflect.Descriptor instead.
+func (*BatchSumRequest) Descriptor() ([]byte, []int) {
+	return file_addsvc_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *BatchSumRequest) GetItems() []*SumRequest {
+	if x != nil {
+		return x.Items
+	}
+	return nil
+}
+
+// The BatchSum reply contains one result for each pair.
+type BatchSumReply struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Items []*SumReply `protobuf:"bytes,1,rep,name=items,proto3" json:"items,omitempty"`
+}
+
+func (x *BatchSumReply) Reset() {
+	*x = BatchSumReply{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_addsvc_proto_msgTypes[8]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *BatchSumReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchSumReply) ProtoMessage() {}
+
+func (x *BatchSumReply) ProtoReflect() protoreflect.Message {
+	mi := &file_addsvc_proto_msgTypes[8]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchSumReply.ProtoReflect.Descriptor instead.
+func (*BatchSumReply) Descriptor() ([]byte, []int) {
+	return file_addsvc_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *BatchSumReply) GetItems() []*SumReply {
+	if x != nil {
+		return x.Items
+	}
+	return nil
+}
+
 var File_addsvc_proto protoreflect.FileDescriptor
 
 var file_addsvc_proto_rawDesc = []byte{
 	0x0a, 0x0c, 0x61, 0x64, 0x64, 0x73, 0x76, 0x63, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x08,
 	0x61, 0x64, 0x64, 0x73, 0x76, 0x63, 0x70, 0x62, 0x1a, 0x10, 0x72, 0x65, 0x73, 0x75, 0x6c, 0x74,
-	0x63, 0x6f, 0x64, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x28, 0x0a, 0x0a, 0x53, 0x75,
-	0x6d, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x0c, 0x0a, 0x01, 0x61, 0x18, 0x01, 0x20,
-	0x01, 0x28, 0x03, 0x52, 0x01, 0x61, 0x12, 0x0c, 0x0a, 0x01, 0x62, 0x18, 0x02, 0x20, 0x01, 0x28,
-	0x03, 0x52, 0x01, 0x62, 0x22, 0x4b, 0x0a, 0x08, 0x53, 0x75, 0x6d, 0x52, 0x65, 0x70, 0x6c, 0x79,
-	0x12, 0x0c, 0x0a, 0x01, 0x76, 0x18, 0x01, 0x20, 0x01, 0x28, 0x03, 0x52, 0x01, 0x76, 0x12, 0x31,
-	0x0a, 0x07, 0x72, 0x65, 0x74, 0x63, 0x6f, 0x64, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0e, 0x32,
-	0x17, 0x2e, 0x72, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x63, 0x6f, 0x64, 0x65, 0x2e, 0x52, 0x45, 0x53,
-	0x55, 0x4c, 0x54, 0x5f, 0x43, 0x4f, 0x44, 0x45, 0x52, 0x07, 0x72, 0x65, 0x74, 0x63, 0x6f, 0x64,
-	0x65, 0x22, 0x2b, 0x0a, 0x0d, 0x43, 0x6f, 0x6e, 0x63, 0x61, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65,
-	0x73, 0x74, 0x12, 0x0c, 0x0a, 0x01, 0x61, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x01, 0x61,
-	0x12, 0x0c, 0x0a, 0x01, 0x62, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x01, 0x62, 0x22, 0x4e,
-	0x0a, 0x0b, 0x43, 0x6f, 0x6e, 0x63, 0x61, 0x74, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x12, 0x0c, 0x0a,
-	0x01, 0x76, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x01, 0x76, 0x12, 0x31, 0x0a, 0x07, 0x72,
-	0x65, 0x74, 0x63, 0x6f, 0x64, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x17, 0x2e, 0x72,
-	0x65, 0x73, 0x75, 0x6c, 0x74, 0x63, 0x6f, 0x64, 0x65, 0x2e, 0x52, 0x45, 0x53, 0x55, 0x4c, 0x54,
-	0x5f, 0x43, 0x4f, 0x44, 0x45, 0x52, 0x07, 0x72, 0x65, 0x74, 0x63, 0x6f, 0x64, 0x65, 0x32, 0x74,
-	0x0a, 0x03, 0x41, 0x64, 0x64, 0x12, 0x31, 0x0a, 0x03, 0x53, 0x75, 0x6d, 0x12, 0x14, 0x2e, 0x61,
-	0x64, 0x64, 0x73, 0x76, 0x63, 0x70, 0x62, 0x2e, 0x53, 0x75, 0x6d, 0x52, 0x65, 0x71, 0x75, 0x65,
-	0x73, 0x74, 0x1a, 0x12, 0x2e, 0x61, 0x64, 0x64, 0x73, 0x76, 0x63, 0x70, 0x62, 0x2e, 0x53, 0x75,
-	0x6d, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x22, 0x00, 0x12, 0x3a, 0x0a, 0x06, 0x43, 0x6f, 0x6e, 0x63,
-	0x61, 0x74, 0x12, 0x17, 0x2e, 0x61, 0x64, 0x64, 0x73, 0x76, 0x63, 0x70, 0x62, 0x2e, 0x43, 0x6f,
-	0x6e, 0x63, 0x61, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x15, 0x2e, 0x61, 0x64,
-	0x64, 0x73, 0x76, 0x63, 0x70, 0x62, 0x2e, 0x43, 0x6f, 0x6e, 0x63, 0x61, 0x74, 0x52, 0x65, 0x70,
-	0x6c, 0x79, 0x22, 0x00, 0x42, 0x28, 0x5a, 0x26, 0x6e, 0x65, 0x77, 0x5f, 0x61, 0x64, 0x64, 0x73,
-	0x76, 0x63, 0x2f, 0x70, 0x62, 0x2f, 0x67, 0x65, 0x6e, 0x2d, 0x67, 0x6f, 0x2f, 0x61, 0x64, 0x64,
-	0x73, 0x76, 0x63, 0x70, 0x62, 0x3b, 0x61, 0x64, 0x64, 0x73, 0x76, 0x63, 0x70, 0x62, 0x62, 0x06,
-	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x63, 0x6f, 0x64, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x1a, 0x1c, 0x67, 0x6f, 0x6f, 0x67,
+	0x6c, 0x65, 0x2f, 0x61, 0x70, 0x69, 0x2f, 0x61, 0x6e, 0x6e, 0x6f, 0x74, 0x61, 0x74, 0x69, 0x6f,
+	0x6e, 0x73, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x28, 0x0a, 0x0a, 0x53, 0x75, 0x6d, 0x52,
+	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x0c, 0x0a, 0x01, 0x61, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x03, 0x52, 0x01, 0x61, 0x12, 0x0c, 0x0a, 0x01, 0x62, 0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52,
+	0x01, 0x62, 0x22, 0x4b, 0x0a, 0x08, 0x53, 0x75, 0x6d, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x12, 0x0c,
+	0x0a, 0x01, 0x76, 0x18, 0x01, 0x20, 0x01, 0x28, 0x03, 0x52, 0x01, 0x76, 0x12, 0x31, 0x0a, 0x07,
+	0x72, 0x65, 0x74, 0x63, 0x6f, 0x64, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x17, 0x2e,
+	0x72, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x63, 0x6f, 0x64, 0x65, 0x2e, 0x52, 0x45, 0x53, 0x55, 0x4c,
+	0x54, 0x5f, 0x43, 0x4f, 0x44, 0x45, 0x52, 0x07, 0x72, 0x65, 0x74, 0x63, 0x6f, 0x64, 0x65, 0x22,
+	0x2b, 0x0a, 0x0d, 0x43, 0x6f, 0x6e, 0x63, 0x61, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74,
+	0x12, 0x0c, 0x0a, 0x01, 0x61, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x01, 0x61, 0x12, 0x0c,
+	0x0a, 0x01, 0x62, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x01, 0x62, 0x22, 0x4e, 0x0a, 0x0b,
+	0x43, 0x6f, 0x6e, 0x63, 0x61, 0x74, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x12, 0x0c, 0x0a, 0x01, 0x76,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x01, 0x76, 0x12, 0x31, 0x0a, 0x07, 0x72, 0x65, 0x74,
+	0x63, 0x6f, 0x64, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x17, 0x2e, 0x72, 0x65, 0x73,
+	0x75, 0x6c, 0x74, 0x63, 0x6f, 0x64, 0x65, 0x2e, 0x52, 0x45, 0x53, 0x55, 0x4c, 0x54, 0x5f, 0x43,
+	0x4f, 0x44, 0x45, 0x52, 0x07, 0x72, 0x65, 0x74, 0x63, 0x6f, 0x64, 0x65, 0x22, 0x2b, 0x0a, 0x13,
+	0x43, 0x6f, 0x6e, 0x63, 0x61, 0x74, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x52, 0x65, 0x71, 0x75,
+	0x65, 0x73, 0x74, 0x12, 0x14, 0x0a, 0x05, 0x70, 0x69, 0x65, 0x63, 0x65, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x05, 0x70, 0x69, 0x65, 0x63, 0x65, 0x22, 0x24, 0x0a, 0x10, 0x53, 0x75, 0x6d,
+	0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x10, 0x0a,
+	0x03, 0x6e, 0x75, 0x6d, 0x18, 0x01, 0x20, 0x01, 0x28, 0x03, 0x52, 0x03, 0x6e, 0x75, 0x6d, 0x22,
+	0x26, 0x0a, 0x10, 0x53, 0x75, 0x6d, 0x53, 0x65, 0x72, 0x69, 0x65, 0x73, 0x52, 0x65, 0x71, 0x75,
+	0x65, 0x73, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x75, 0x6d, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28,
+	0x03, 0x52, 0x04, 0x6e, 0x75, 0x6d, 0x73, 0x22, 0x3d, 0x0a, 0x0f, 0x42, 0x61, 0x74, 0x63, 0x68,
+	0x53, 0x75, 0x6d, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x2a, 0x0a, 0x05, 0x69, 0x74,
+	0x65, 0x6d, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x14, 0x2e, 0x61, 0x64, 0x64, 0x73,
+	0x76, 0x63, 0x70, 0x62, 0x2e, 0x53, 0x75, 0x6d, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x52,
+	0x05, 0x69, 0x74, 0x65, 0x6d, 0x73, 0x22, 0x39, 0x0a, 0x0d, 0x42, 0x61, 0x74, 0x63, 0x68, 0x53,
+	0x75, 0x6d, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x12, 0x28, 0x0a, 0x05, 0x69, 0x74, 0x65, 0x6d, 0x73,
+	0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x12, 0x2e, 0x61, 0x64, 0x64, 0x73, 0x76, 0x63, 0x70,
+	0x62, 0x2e, 0x53, 0x75, 0x6d, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x52, 0x05, 0x69, 0x74, 0x65, 0x6d,
+	0x73, 0x32, 0xde, 0x03, 0x0a, 0x03, 0x41, 0x64, 0x64, 0x12, 0x43, 0x0a, 0x03, 0x53, 0x75, 0x6d,
+	0x12, 0x14, 0x2e, 0x61, 0x64, 0x64, 0x73, 0x76, 0x63, 0x70, 0x62, 0x2e, 0x53, 0x75, 0x6d, 0x52,
+	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x12, 0x2e, 0x61, 0x64, 0x64, 0x73, 0x76, 0x63, 0x70,
+	0x62, 0x2e, 0x53, 0x75, 0x6d, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x22, 0x12, 0x82, 0xd3, 0xe4, 0x93,
+	0x02, 0x0c, 0x22, 0x07, 0x2f, 0x76, 0x31, 0x2f, 0x73, 0x75, 0x6d, 0x3a, 0x01, 0x2a, 0x12, 0x4f,
+	0x0a, 0x06, 0x43, 0x6f, 0x6e, 0x63, 0x61, 0x74, 0x12, 0x17, 0x2e, 0x61, 0x64, 0x64, 0x73, 0x76,
+	0x63, 0x70, 0x62, 0x2e, 0x43, 0x6f, 0x6e, 0x63, 0x61, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73,
+	0x74, 0x1a, 0x15, 0x2e, 0x61, 0x64, 0x64, 0x73, 0x76, 0x63, 0x70, 0x62, 0x2e, 0x43, 0x6f, 0x6e,
+	0x63, 0x61, 0x74, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x22, 0x15, 0x82, 0xd3, 0xe4, 0x93, 0x02, 0x0f,
+	0x22, 0x0a, 0x2f, 0x76, 0x31, 0x2f, 0x63, 0x6f, 0x6e, 0x63, 0x61, 0x74, 0x3a, 0x01, 0x2a, 0x12,
+	0x4a, 0x0a, 0x0c, 0x43, 0x6f, 0x6e, 0x63, 0x61, 0x74, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x12,
+	0x1d, 0x2e, 0x61, 0x64, 0x64, 0x73, 0x76, 0x63, 0x70, 0x62, 0x2e, 0x43, 0x6f, 0x6e, 0x63, 0x61,
+	0x74, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x15,
+	0x2e, 0x61, 0x64, 0x64, 0x73, 0x76, 0x63, 0x70, 0x62, 0x2e, 0x43, 0x6f, 0x6e, 0x63, 0x61, 0x74,
+	0x52, 0x65, 0x70, 0x6c, 0x79, 0x22, 0x00, 0x28, 0x01, 0x30, 0x01, 0x12, 0x41, 0x0a, 0x09, 0x53,
+	0x75, 0x6d, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x12, 0x1a, 0x2e, 0x61, 0x64, 0x64, 0x73, 0x76,
+	0x63, 0x70, 0x62, 0x2e, 0x53, 0x75, 0x6d, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x52, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x1a, 0x12, 0x2e, 0x61, 0x64, 0x64, 0x73, 0x76, 0x63, 0x70, 0x62, 0x2e,
+	0x53, 0x75, 0x6d, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x22, 0x00, 0x28, 0x01, 0x30, 0x01, 0x12, 0x58,
+	0x0a, 0x09, 0x53, 0x75, 0x6d, 0x53, 0x65, 0x72, 0x69, 0x65, 0x73, 0x12, 0x1a, 0x2e, 0x61, 0x64,
+	0x64, 0x73, 0x76, 0x63, 0x70, 0x62, 0x2e, 0x53, 0x75, 0x6d, 0x53, 0x65, 0x72, 0x69, 0x65, 0x73,
+	0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x12, 0x2e, 0x61, 0x64, 0x64, 0x73, 0x76, 0x63,
+	0x70, 0x62, 0x2e, 0x53, 0x75, 0x6d, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x22, 0x19, 0x82, 0xd3, 0xe4,
+	0x93, 0x02, 0x13, 0x22, 0x0e, 0x2f, 0x76, 0x31, 0x2f, 0x73, 0x75, 0x6d, 0x5f, 0x73, 0x65, 0x72,
+	0x69, 0x65, 0x73, 0x3a, 0x01, 0x2a, 0x30, 0x01, 0x12, 0x58, 0x0a, 0x08, 0x42, 0x61, 0x74, 0x63,
+	0x68, 0x53, 0x75, 0x6d, 0x12, 0x19, 0x2e, 0x61, 0x64, 0x64, 0x73, 0x76, 0x63, 0x70, 0x62, 0x2e,
+	0x42, 0x61, 0x74, 0x63, 0x68, 0x53, 0x75, 0x6d, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a,
+	0x17, 0x2e, 0x61, 0x64, 0x64, 0x73, 0x76, 0x63, 0x70, 0x62, 0x2e, 0x42, 0x61, 0x74, 0x63, 0x68,
+	0x53, 0x75, 0x6d, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x22, 0x18, 0x82, 0xd3, 0xe4, 0x93, 0x02, 0x12,
+	0x22, 0x0d, 0x2f, 0x76, 0x31, 0x2f, 0x62, 0x61, 0x74, 0x63, 0x68, 0x5f, 0x73, 0x75, 0x6d, 0x3a,
+	0x01, 0x2a, 0x42, 0x28, 0x5a, 0x26, 0x6e, 0x65, 0x77, 0x5f, 0x61, 0x64, 0x64, 0x73, 0x76, 0x63,
+	0x2f, 0x70, 0x62, 0x2f, 0x67, 0x65, 0x6e, 0x2d, 0x67, 0x6f, 0x2f, 0x61, 0x64, 0x64, 0x73, 0x76,
+	0x63, 0x70, 0x62, 0x3b, 0x61, 0x64, 0x64, 0x73, 0x76, 0x63, 0x70, 0x62, 0x62, 0x06, 0x70, 0x72,
+	0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -300,26 +581,41 @@ func file_addsvc_proto_rawDescGZIP() []byte {
 	return file_addsvc_proto_rawDescData
 }
 
-var file_addsvc_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_addsvc_proto_msgTypes = make([]protoimpl.MessageInfo, 9)
 var file_addsvc_proto_goTypes = []interface{}{
 	(*SumRequest)(nil),          // 0: addsvcpb.SumRequest
 	(*SumReply)(nil),            // 1: addsvcpb.SumReply
 	(*ConcatRequest)(nil),       // 2: addsvcpb.ConcatRequest
 	(*ConcatReply)(nil),         // 3: addsvcpb.ConcatReply
-	(resultcode.RESULT_CODE)(0), // 4: resultcode.RESULT_CODE
+	(*ConcatStreamRequest)(nil), // 4: addsvcpb.ConcatStreamRequest
+	(*SumStreamRequest)(nil),    // 5: addsvcpb.SumStreamRequest
+	(*SumSeriesRequest)(nil),    // 6: addsvcpb.SumSeriesRequest
+	(*BatchSumRequest)(nil),     // 7: addsvcpb.BatchSumRequest
+	(*BatchSumReply)(nil),       // 8: addsvcpb.BatchSumReply
+	(resultcode.RESULT_CODE)(0), // 9: resultcode.RESULT_CODE
 }
 var file_addsvc_proto_depIdxs = []int32{
-	4, // 0: addsvcpb.SumReply.retcode:type_name -> resultcode.RESULT_CODE
-	4, // 1: addsvcpb.ConcatReply.retcode:type_name -> resultcode.RESULT_CODE
-	0, // 2: addsvcpb.Add.Sum:input_type -> addsvcpb.SumRequest
-	2, // 3: addsvcpb.Add.Concat:input_type -> addsvcpb.ConcatRequest
-	1, // 4: addsvcpb.Add.Sum:output_type -> addsvcpb.SumReply
-	3, // 5: addsvcpb.Add.Concat:output_type -> addsvcpb.ConcatReply
-	4, // [4:6] is the sub-list for method output_type
-	2, // [2:4] is the sub-list for method input_type
-	2, // [2:2] is the sub-list for extension type_name
-	2, // [2:2] is the sub-list for extension extendee
-	0, // [0:2] is the sub-list for field type_name
+	9,  // 0: addsvcpb.SumReply.retcode:type_name -> resultcode.RESULT_CODE
+	9,  // 1: addsvcpb.ConcatReply.retcode:type_name -> resultcode.RESULT_CODE
+	0,  // 2: addsvcpb.BatchSumRequest.items:type_name -> addsvcpb.SumRequest
+	1,  // 3: addsvcpb.BatchSumReply.items:type_name -> addsvcpb.SumReply
+	0,  // 4: addsvcpb.Add.Sum:input_type -> addsvcpb.SumRequest
+	2,  // 5: addsvcpb.Add.Concat:input_type -> addsvcpb.ConcatRequest
+	4,  // 6: addsvcpb.Add.ConcatStream:input_type -> addsvcpb.ConcatStreamRequest
+	5,  // 7: addsvcpb.Add.SumStream:input_type -> addsvcpb.SumStreamRequest
+	6,  // 8: addsvcpb.Add.SumSeries:input_type -> addsvcpb.SumSeriesRequest
+	7,  // 9: addsvcpb.Add.BatchSum:input_type -> addsvcpb.BatchSumRequest
+	1,  // 10: addsvcpb.Add.Sum:output_type -> addsvcpb.SumReply
+	3,  // 11: addsvcpb.Add.Concat:output_type -> addsvcpb.ConcatReply
+	3,  // 12: addsvcpb.Add.ConcatStream:output_type -> addsvcpb.ConcatReply
+	1,  // 13: addsvcpb.Add.SumStream:output_type -> addsvcpb.SumReply
+	1,  // 14: addsvcpb.Add.SumSeries:output_type -> addsvcpb.SumReply
+	8,  // 15: addsvcpb.Add.BatchSum:output_type -> addsvcpb.BatchSumReply
+	10, // [10:16] is the sub-list for method output_type
+	4,  // [4:10] is the sub-list for method input_type
+	4,  // [4:4] is the sub-list for extension type_name
+	4,  // [4:4] is the sub-list for extension extendee
+	0,  // [0:4] is the sub-list for field type_name
 }
 
 func init() { file_addsvc_proto_init() }
@@ -376,6 +672,66 @@ func file_addsvc_proto_init() {
 				return nil
 			}
 		}
+		file_addsvc_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ConcatStreamRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_addsvc_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SumStreamRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_addsvc_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SumSeriesRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_addsvc_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*BatchSumRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_addsvc_proto_msgTypes[8].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*BatchSumReply); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
@@ -383,7 +739,7 @@ func file_addsvc_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_addsvc_proto_rawDesc,
 			NumEnums:      0,
-			NumMessages:   4,
+			NumMessages:   9,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -413,6 +769,18 @@ type AddClient interface {
 	Sum(ctx context.Context, in *SumRequest, opts ...grpc.CallOption) (*SumReply, error)
 	// Concatenates two strings
 	Concat(ctx context.Context, in *ConcatRequest, opts ...grpc.CallOption) (*ConcatReply, error)
+	// Concatenates a stream of strings incrementally,
+	// replies the running concatenation for each piece received.
+	ConcatStream(ctx context.Context, opts ...grpc.CallOption) (Add_ConcatStreamClient, error)
+	// Sums a stream of integers incrementally,
+	// replies the running sum for each number received.
+	SumStream(ctx context.Context, opts ...grpc.CallOption) (Add_SumStreamClient, error)
+	// Sums the numbers one by one,
+	// replies the running sum after each addition.
+	SumSeries(ctx context.Context, in *SumSeriesRequest, opts ...grpc.CallOption) (Add_SumSeriesClient, error)
+	// Sums each pair of integers independently,
+	// replies one result per pair in the same order.
+	BatchSum(ctx context.Context, in *BatchSumRequest, opts ...grpc.CallOption) (*BatchSumReply, error)
 }
 
 type addClient struct {
@@ -441,12 +809,127 @@ func (c *addClient) Concat(ctx context.Context, in *ConcatRequest, opts ...grpc.
 	return out, nil
 }
 
+func (c *addClient) ConcatStream(ctx context.Context, opts ...grpc.CallOption) (Add_ConcatStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Add_serviceDesc.Streams[0], "/addsvcpb.Add/ConcatStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &addConcatStreamClient{stream}
+	return x, nil
+}
+
+type Add_ConcatStreamClient interface {
+	Send(*ConcatStreamRequest) error
+	Recv() (*ConcatReply, error)
+	grpc.ClientStream
+}
+
+type addConcatStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *addConcatStreamClient) Send(m *ConcatStreamRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *addConcatStreamClient) Recv() (*ConcatReply, error) {
+	m := new(ConcatReply)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *addClient) SumStream(ctx context.Context, opts ...grpc.CallOption) (Add_SumStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Add_serviceDesc.Streams[1], "/addsvcpb.Add/SumStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &addSumStreamClient{stream}
+	return x, nil
+}
+
+type Add_SumStreamClient interface {
+	Send(*SumStreamRequest) error
+	Recv() (*SumReply, error)
+	grpc.ClientStream
+}
+
+type addSumStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *addSumStreamClient) Send(m *SumStreamRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *addSumStreamClient) Recv() (*SumReply, error) {
+	m := new(SumReply)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *addClient) SumSeries(ctx context.Context, in *SumSeriesRequest, opts ...grpc.CallOption) (Add_SumSeriesClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Add_serviceDesc.Streams[2], "/addsvcpb.Add/SumSeries", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &addSumSeriesClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Add_SumSeriesClient interface {
+	Recv() (*SumReply, error)
+	grpc.ClientStream
+}
+
+type addSumSeriesClient struct {
+	grpc.ClientStream
+}
+
+func (x *addSumSeriesClient) Recv() (*SumReply, error) {
+	m := new(SumReply)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *addClient) BatchSum(ctx context.Context, in *BatchSumRequest, opts ...grpc.CallOption) (*BatchSumReply, error) {
+	out := new(BatchSumReply)
+	err := c.cc.Invoke(ctx, "/addsvcpb.Add/BatchSum", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // AddServer is the server API for Add service.
 type AddServer interface {
 	// Sums two integers.
 	Sum(context.Context, *SumRequest) (*SumReply, error)
 	// Concatenates two strings
 	Concat(context.Context, *ConcatRequest) (*ConcatReply, error)
+	// Concatenates a stream of strings incrementally,
+	// replies the running concatenation for each piece received.
+	ConcatStream(Add_ConcatStreamServer) error
+	// Sums a stream of integers incrementally,
+	// replies the running sum for each number received.
+	SumStream(Add_SumStreamServer) error
+	// Sums the numbers one by one,
+	// replies the running sum after each addition.
+	SumSeries(*SumSeriesRequest, Add_SumSeriesServer) error
+	// Sums each pair of integers independently,
+	// replies one result per pair in the same order.
+	BatchSum(context.Context, *BatchSumRequest) (*BatchSumReply, error)
 }
 
 // UnimplementedAddServer can be embedded to have forward compatible implementations.
@@ -459,6 +942,18 @@ func (*UnimplementedAddServer) Sum(context.Context, *SumRequest) (*SumReply, err
 func (*UnimplementedAddServer) Concat(context.Context, *ConcatRequest) (*ConcatReply, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Concat not implemented")
 }
+func (*UnimplementedAddServer) ConcatStream(Add_ConcatStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method ConcatStream not implemented")
+}
+func (*UnimplementedAddServer) SumStream(Add_SumStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method SumStream not implemented")
+}
+func (*UnimplementedAddServer) SumSeries(*SumSeriesRequest, Add_SumSeriesServer) error {
+	return status.Errorf(codes.Unimplemented, "method SumSeries not implemented")
+}
+func (*UnimplementedAddServer) BatchSum(context.Context, *BatchSumRequest) (*BatchSumReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchSum not implemented")
+}
 
 func RegisterAddServer(s *grpc.Server, srv AddServer) {
 	s.RegisterService(&_Add_serviceDesc, srv)
@@ -500,6 +995,97 @@ func _Add_Concat_Handler(srv interface{}, ctx context.Context, dec func(interfac
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Add_ConcatStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(AddServer).ConcatStream(&addConcatStreamServer{stream})
+}
+
+type Add_ConcatStreamServer interface {
+	Send(*ConcatReply) error
+	Recv() (*ConcatStreamRequest, error)
+	grpc.ServerStream
+}
+
+type addConcatStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *addConcatStreamServer) Send(m *ConcatReply) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *addConcatStreamServer) Recv() (*ConcatStreamRequest, error) {
+	m := new(ConcatStreamRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Add_SumStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(AddServer).SumStream(&addSumStreamServer{stream})
+}
+
+type Add_SumStreamServer interface {
+	Send(*SumReply) error
+	Recv() (*SumStreamRequest, error)
+	grpc.ServerStream
+}
+
+type addSumStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *addSumStreamServer) Send(m *SumReply) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *addSumStreamServer) Recv() (*SumStreamRequest, error) {
+	m := new(SumStreamRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Add_SumSeries_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SumSeriesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(AddServer).SumSeries(m, &addSumSeriesServer{stream})
+}
+
+type Add_SumSeriesServer interface {
+	Send(*SumReply) error
+	grpc.ServerStream
+}
+
+type addSumSeriesServer struct {
+	grpc.ServerStream
+}
+
+func (x *addSumSeriesServer) Send(m *SumReply) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Add_BatchSum_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchSumRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AddServer).BatchSum(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/addsvcpb.Add/BatchSum",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AddServer).BatchSum(ctx, req.(*BatchSumRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _Add_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "addsvcpb.Add",
 	HandlerType: (*AddServer)(nil),
@@ -512,7 +1098,29 @@ var _Add_serviceDesc = grpc.ServiceDesc{
 			MethodName: "Concat",
 			Handler:    _Add_Concat_Handler,
 		},
+		{
+			MethodName: "BatchSum",
+			Handler:    _Add_BatchSum_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ConcatStream",
+			Handler:       _Add_ConcatStream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "SumStream",
+			Handler:       _Add_SumStream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "SumSeries",
+			Handler:       _Add_SumSeries_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "addsvc.proto",
 }
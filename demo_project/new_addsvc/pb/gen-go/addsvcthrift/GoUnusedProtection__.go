@@ -0,0 +1,7 @@
+// Autogenerated by Thrift Compiler (1.0.0-dev)
+// DO NOT EDIT UNLESS YOU ARE SURE THAT YOU KNOW WHAT YOU ARE DOING
+
+package addsvcthrift
+
+var GoUnusedProtection__ int;
+
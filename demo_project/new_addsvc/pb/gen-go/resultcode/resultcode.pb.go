@@ -37,27 +37,37 @@ const (
 	RESULT_CODE_RET_UNKNOWN_ERR RESULT_CODE = 5
 	// 101...
 	RESULT_CODE_RET_INVALID_ARGS RESULT_CODE = 101
+	// 1001... 业务错误码，与service层错误(errs.Error)的Code一致
+	RESULT_CODE_RET_INVALID_INPUT RESULT_CODE = 1001
+	RESULT_CODE_RET_OVERFLOW      RESULT_CODE = 1002
+	RESULT_CODE_RET_FORBIDDEN     RESULT_CODE = 1003
 )
 
 // Enum value maps for RESULT_CODE.
 var (
 	RESULT_CODE_name = map[int32]string{
-		0:   "RET_OK",
-		1:   "RET_SYS_ERR",
-		2:   "RET_MYSQL_ERR",
-		3:   "RET_REDIS_ERR",
-		4:   "RET_NETWORK_ERR",
-		5:   "RET_UNKNOWN_ERR",
-		101: "RET_INVALID_ARGS",
+		0:    "RET_OK",
+		1:    "RET_SYS_ERR",
+		2:    "RET_MYSQL_ERR",
+		3:    "RET_REDIS_ERR",
+		4:    "RET_NETWORK_ERR",
+		5:    "RET_UNKNOWN_ERR",
+		101:  "RET_INVALID_ARGS",
+		1001: "RET_INVALID_INPUT",
+		1002: "RET_OVERFLOW",
+		1003: "RET_FORBIDDEN",
 	}
 	RESULT_CODE_value = map[string]int32{
-		"RET_OK":           0,
-		"RET_SYS_ERR":      1,
-		"RET_MYSQL_ERR":    2,
-		"RET_REDIS_ERR":    3,
-		"RET_NETWORK_ERR":  4,
-		"RET_UNKNOWN_ERR":  5,
-		"RET_INVALID_ARGS": 101,
+		"RET_OK":            0,
+		"RET_SYS_ERR":       1,
+		"RET_MYSQL_ERR":     2,
+		"RET_REDIS_ERR":     3,
+		"RET_NETWORK_ERR":   4,
+		"RET_UNKNOWN_ERR":   5,
+		"RET_INVALID_ARGS":  101,
+		"RET_INVALID_INPUT": 1001,
+		"RET_OVERFLOW":      1002,
+		"RET_FORBIDDEN":     1003,
 	}
 )
 
@@ -92,7 +102,7 @@ var File_resultcode_proto protoreflect.FileDescriptor
 
 var file_resultcode_proto_rawDesc = []byte{
 	0x0a, 0x10, 0x72, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x63, 0x6f, 0x64, 0x65, 0x2e, 0x70, 0x72, 0x6f,
-	0x74, 0x6f, 0x12, 0x0a, 0x72, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x63, 0x6f, 0x64, 0x65, 0x2a, 0x90,
+	0x74, 0x6f, 0x12, 0x0a, 0x72, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x63, 0x6f, 0x64, 0x65, 0x2a, 0xcf,
 	0x01, 0x0a, 0x0b, 0x52, 0x45, 0x53, 0x55, 0x4c, 0x54, 0x5f, 0x43, 0x4f, 0x44, 0x45, 0x12, 0x0a,
 	0x0a, 0x06, 0x52, 0x45, 0x54, 0x5f, 0x4f, 0x4b, 0x10, 0x00, 0x12, 0x0f, 0x0a, 0x0b, 0x52, 0x45,
 	0x54, 0x5f, 0x53, 0x59, 0x53, 0x5f, 0x45, 0x52, 0x52, 0x10, 0x01, 0x12, 0x11, 0x0a, 0x0d, 0x52,
@@ -102,10 +112,14 @@ var file_resultcode_proto_rawDesc = []byte{
 	0x5f, 0x45, 0x52, 0x52, 0x10, 0x04, 0x12, 0x13, 0x0a, 0x0f, 0x52, 0x45, 0x54, 0x5f, 0x55, 0x4e,
 	0x4b, 0x4e, 0x4f, 0x57, 0x4e, 0x5f, 0x45, 0x52, 0x52, 0x10, 0x05, 0x12, 0x14, 0x0a, 0x10, 0x52,
 	0x45, 0x54, 0x5f, 0x49, 0x4e, 0x56, 0x41, 0x4c, 0x49, 0x44, 0x5f, 0x41, 0x52, 0x47, 0x53, 0x10,
-	0x65, 0x42, 0x2c, 0x5a, 0x2a, 0x6e, 0x65, 0x77, 0x5f, 0x61, 0x64, 0x64, 0x73, 0x76, 0x63, 0x2f,
-	0x70, 0x62, 0x2f, 0x67, 0x65, 0x6e, 0x2d, 0x67, 0x6f, 0x2f, 0x72, 0x65, 0x73, 0x75, 0x6c, 0x74,
-	0x63, 0x6f, 0x64, 0x65, 0x3b, 0x72, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x63, 0x6f, 0x64, 0x65, 0x62,
-	0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x65, 0x12, 0x16, 0x0a, 0x11, 0x52, 0x45, 0x54, 0x5f, 0x49, 0x4e, 0x56, 0x41, 0x4c, 0x49, 0x44,
+	0x5f, 0x49, 0x4e, 0x50, 0x55, 0x54, 0x10, 0xe9, 0x07, 0x12, 0x11, 0x0a, 0x0c, 0x52, 0x45, 0x54,
+	0x5f, 0x4f, 0x56, 0x45, 0x52, 0x46, 0x4c, 0x4f, 0x57, 0x10, 0xea, 0x07, 0x12, 0x12, 0x0a, 0x0d,
+	0x52, 0x45, 0x54, 0x5f, 0x46, 0x4f, 0x52, 0x42, 0x49, 0x44, 0x44, 0x45, 0x4e, 0x10, 0xeb, 0x07,
+	0x42, 0x2c, 0x5a, 0x2a, 0x6e, 0x65, 0x77, 0x5f, 0x61, 0x64, 0x64, 0x73, 0x76, 0x63, 0x2f, 0x70,
+	0x62, 0x2f, 0x67, 0x65, 0x6e, 0x2d, 0x67, 0x6f, 0x2f, 0x72, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x63,
+	0x6f, 0x64, 0x65, 0x3b, 0x72, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x63, 0x6f, 0x64, 0x65, 0x62, 0x06,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
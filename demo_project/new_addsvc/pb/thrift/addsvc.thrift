@@ -0,0 +1,19 @@
+// 与addsvc.proto定义相同的接口，用于对比grpc和thrift两种transport(见pkg/transport/thrift.go)
+// 生成代码：cd script && ./main.sh gen_thrift
+namespace go addsvcthrift
+
+struct SumReply {
+	1: i64 value
+	// 见resultcode.proto
+	2: i32 retcode
+}
+
+struct ConcatReply {
+	1: string value
+	2: i32 retcode
+}
+
+service AddService {
+	SumReply Sum(1: i64 a, 2: i64 b)
+	ConcatReply Concat(1: string a, 2: string b)
+}
@@ -1,37 +1,52 @@
 package crontask
 
 import (
+	"github.com/go-kit/kit/log"
 	"github.com/leigg-go/go-util/_lock"
 	"github.com/leigg-go/go-util/_redis"
-	"github.com/robfig/cron/v3"
-	"go-util/_util"
+	"go-util/_go"
+	"gokit_foundation"
 	"math/rand"
+	"new_addsvc/config"
+	"new_addsvc/pkg/endpoint"
 	"time"
 )
 
-var cronMain = cron.New(cron.WithSeconds())
-
-func Init() {
+// Add 添加定时任务到c，由调用方通过c.AddTo添加到TaskGroup，与其他任务一起退出；job的状态见c.Handler(管理端口/cron)
+// consul为true(sd_backend为consul)时添加consul自检
+// leader不为nil时(多实例选主，见gokit_foundation.Leadership)，只需要一个实例执行的job只在leader上执行
+func Add(c *_go.Cron, endpoints endpoint.AddSvcEndpoints, consul bool, leader func() bool, logger log.Logger) error {
 	initLock()
-	// 定时任务开始前sleep一个随机值，避免多个进程读到相同数据，提高效率
+	// jitter使用随机值，避免多个进程在同一时刻执行
 	rand.Seed(time.Now().UnixNano())
-
-	// 定时任务：打印程序资源消耗统计
-	// 每2s执行
-	_, err := cronMain.AddFunc("*/2 * * * * ?", printStatis)
-	_util.PanicIfErr(err, nil)
-
-	// 定时任务：结算今日活动，并且给满足条件的人发送奖励（使用分布式锁避免多个进程同时执行该任务，造成多发奖励）
-	// 分布式锁可以适用大部分此类场景，也有严谨度更高的方案：将任务状态持久化(不限存储源)
-	// 每min的0s执行
-	_, err = cronMain.AddFunc("0 * * * * ?", endupTodayActivity)
-	_util.PanicIfErr(err, nil)
-
-	cronMain.Start()
-}
-
-func Stop() {
-	cronMain.Stop()
+	onFailure := func(name string) func(error) {
+		return func(err error) { logger.Log("crontask", name, "err", err) }
+	}
+	jobs := []_go.CronJob{
+		// 定时任务：打印程序资源消耗统计，每10s执行(统计cpu需要2s)
+		{Name: "printStatis", Spec: "*/10 * * * * ?", Run: printStatis},
+		// 定时任务：结算今日活动，并且给满足条件的人发送奖励（使用分布式锁避免多个进程同时执行该任务，造成多发奖励）
+		// 分布式锁可以适用大部分此类场景，也有严谨度更高的方案：将任务状态持久化(不限存储源)
+		// 开启选主时只在leader上执行，切换leader期间可能有两个leader，仍需要分布式锁
+		// 每min的0s执行
+		{Name: "endupTodayActivity", Spec: "0 * * * * ?", Run: endupTodayActivity, Leader: leader},
+	}
+	// 开启认证且Concat需要认证时，内部调用没有token，不预热
+	if authConf := config.GetAuthConf(); !authConf.Enable || contains(authConf.Allowlist, "Concat") {
+		// 定时任务：预热Concat的缓存，缓存过期前刷新；缓存在redis中，只需要leader执行，未开启选主时jitter避免多个实例同时访问redis
+		jobs = append(jobs, _go.CronJob{Name: "warmCache", Spec: "@every 5m", Jitter: 30 * time.Second, Run: WarmCache(endpoints, config.GetCacheWarmConcat()), Leader: leader})
+	}
+	if consul {
+		// 定时任务：检查consul上本实例的健康状态，不是passing时打印日志(实例不会被发现)
+		jobs = append(jobs, _go.CronJob{Name: "consulSelfCheck", Spec: "*/30 * * * * ?", Timeout: 5 * time.Second, Run: gokit_foundation.ConsulSelfCheck})
+	}
+	for _, j := range jobs {
+		j.OnFailure = onFailure(j.Name)
+		if err := c.Add(j); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func initLock() {
@@ -39,3 +54,12 @@ func initLock() {
 	expire := time.Second * 2 // key过期时间，略大于任务耗时+网络传输耗时即可
 	etaLock = _lock.NewDistributedLockByRedis(_redis.DefClient, "lock_key_endupTodayActivity", nil, expire, opt)
 }
+
+func contains(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
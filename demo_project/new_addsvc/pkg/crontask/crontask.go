@@ -1,31 +1,36 @@
 package crontask
 
 import (
+	"context"
+	"fmt"
 	"github.com/leigg-go/go-util/_lock"
 	"github.com/shirou/gopsutil/cpu"
 	"github.com/shirou/gopsutil/host"
+	"gokit_foundation/cache"
 	"log"
+	"new_addsvc/pkg/endpoint"
 	"runtime"
 	"time"
 )
 
-func printStatis() {
+func printStatis(ctx context.Context) error {
 	var m runtime.MemStats
 	runtime.ReadMemStats(&m)
 
 	hostInfo, _ := host.Info()
-	utilities, _ := cpu.Percent(time.Duration(time.Second*2), true)
+	utilities, _ := cpu.PercentWithContext(ctx, time.Duration(time.Second*2), true)
 	var cpuUtility float64 // 这个东西貌似不太准确
 	for _, ut := range utilities {
 		cpuUtility += ut
 	}
 	log.Printf("[crontask] hostInfo -- hostname:%s uptime:%d procs:%d hostid:%s, cpu-utility:%.2f", hostInfo.Hostname, hostInfo.Uptime, hostInfo.Procs, hostInfo.HostID, cpuUtility)
+	return nil
 }
 
 // lock的声明建议放在此处，也可以放在base.go
 var etaLock _lock.DistributedLock
 
-func endupTodayActivity() {
+func endupTodayActivity(context.Context) error {
 	acquire := func() bool {
 		// 此任务的内容决定它在同一时间只能运行一次，否则会发送多次奖励，这里使用redis分布式锁实现
 		ok, err := etaLock.Lock()
@@ -43,7 +48,7 @@ func endupTodayActivity() {
 
 	if !acquire() {
 		log.Println("lock missed!")
-		return
+		return nil
 	}
 
 	defer func() {
@@ -55,4 +60,20 @@ func endupTodayActivity() {
 
 	// 发放奖励
 	log.Print("发放奖励(注意应开启多进程测试，同一时刻应只有一个进程执行)。。")
+	return nil
+}
+
+// WarmCache 经过完整的endpoint中间件调用Concat，跳过缓存读取并写入新的结果，返回第一个失败的err
+// 除了定时任务，启动时的预热也会调用(见addsvc的addTaskWarmup)
+func WarmCache(endpoints endpoint.AddSvcEndpoints, args [][2]string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		ctx = cache.WithBypass(ctx)
+		var firstErr error
+		for _, a := range args {
+			if _, err := endpoints.Concat(ctx, a[0], a[1]); err != nil && firstErr == nil {
+				firstErr = fmt.Errorf("concat %q %q: %v", a[0], a[1], err)
+			}
+		}
+		return firstErr
+	}
 }
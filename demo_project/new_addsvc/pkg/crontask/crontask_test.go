@@ -0,0 +1,30 @@
+package crontask
+
+import (
+	"context"
+	"errors"
+	"gokit_foundation/cache"
+	"new_addsvc/pkg/endpoint"
+	"testing"
+)
+
+func TestWarmCache(t *testing.T) {
+	var calls []string
+	var bypass bool
+	eps := endpoint.AddSvcEndpoints{
+		ConcatEndpoint: func(ctx context.Context, request interface{}) (interface{}, error) {
+			req := request.(*endpoint.ConcatRequest)
+			calls = append(calls, req.A+req.B)
+			bypass = cache.BypassFromContext(ctx)
+			if req.A == "x" {
+				return nil, errors.New("redis down")
+			}
+			return &endpoint.ConcatResponse{V: req.A + req.B}, nil
+		},
+	}
+	err := WarmCache(eps, [][2]string{{"a", "b"}, {"x", "y"}, {"c", "d"}})(context.Background())
+	// 失败时继续预热其他参数
+	if err == nil || len(calls) != 3 || calls[2] != "cd" || !bypass {
+		t.Errorf("got err:%v calls:%v bypass:%v", err, calls, bypass)
+	}
+}
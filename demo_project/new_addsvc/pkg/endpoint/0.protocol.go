@@ -1,6 +1,21 @@
 package endpoint
 
-import "new_addsvc/pb/gen-go/resultcode"
+import (
+	"context"
+	"fmt"
+	"github.com/go-kit/kit/endpoint"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"gokit_foundation/endpointx"
+	"gokit_foundation/errs"
+	"new_addsvc/config"
+	"new_addsvc/pb/gen-go/resultcode"
+	service2 "new_addsvc/pkg/service"
+	"sync"
+)
+
+// XxxRequest/XxxResponse、MakeXxxEndpoint以及transport层的grpc decode/encode由proto文件生成，见0.protocol_gen.go
+// 修改pb/proto/addsvc.proto后需要重新生成
+//go:generate go run ../../cmd/protogen -proto ../../pb/proto/addsvc.proto -endpoint 0.protocol_gen.go -transport ../transport/grpc_gen.go
 
 /*
 首先在endpoint层需要定义专门的req和rsp struct, 可称之为ep层的protocol
@@ -19,25 +34,128 @@ import "new_addsvc/pb/gen-go/resultcode"
 	decode rpc-response --> endpoint-response
 
 注：每个接口都需要一个decode.func和encode.func
+字段的参数校验规则(validate tag)在proto文件中通过@kit注释指定，见ValidationMiddleware
+*/
+
+/*
+需要在span上记录的请求参数和返回码，见SpanTagsMiddleware
 */
 
-type SumRequest struct {
-	A, B int
+func (r *SumRequest) SpanTags() stdopentracing.Tags {
+	return stdopentracing.Tags{"sum.a": r.A, "sum.b": r.B}
+}
+
+func (r *ConcatRequest) SpanTags() stdopentracing.Tags {
+	return stdopentracing.Tags{"concat.len": len(r.A) + len(r.B)}
+}
+
+func (r *BatchSumRequest) SpanTags() stdopentracing.Tags {
+	return stdopentracing.Tags{"batch_sum.size": len(r.Items)}
+}
+
+/*
+按部署配置的字段上限(config.Limits)，见LimitsMiddleware，BatchSum的每一项在batchSumItem中检查
+*/
+
+func (r *SumRequest) checkLimits(l config.Limits) map[string]string {
+	var fields map[string]string
+	for name, v := range map[string]int{"a": r.A, "b": r.B} {
+		if l.MaxOperand > 0 && (v > l.MaxOperand || v < -l.MaxOperand) {
+			if fields == nil {
+				fields = map[string]string{}
+			}
+			fields[name] = fmt.Sprintf("magnitude must be at most %d", l.MaxOperand)
+		}
+	}
+	return fields
+}
+
+func (r *ConcatRequest) checkLimits(l config.Limits) map[string]string {
+	var fields map[string]string
+	for name, v := range map[string]string{"a": r.A, "b": r.B} {
+		if l.MaxStrLen > 0 && len(v) > l.MaxStrLen {
+			if fields == nil {
+				fields = map[string]string{}
+			}
+			fields[name] = fmt.Sprintf("length must be at most %d", l.MaxStrLen)
+		}
+	}
+	return fields
+}
+
+/*
+BatchSum 一次请求计算多组Sum，减少RPC的次数(见client.Batching)
+proto中的rpc标记了@kit: manual，request/response以及grpc的decode/encode(见transport.decodeGRPCBatchSumRequest)手写
+-	整个batch与其他接口一样经过endpoint层的中间件(认证、限流、断路器、超时等)，中间件返回err时整批失败
+-	每一项单独做参数校验，再由最多batchSumWorkers个goroutine并发调用service的Sum，
+	某一项失败(参数错误、溢出等)只影响这一项的RetCode，与单独调用Sum得到的RetCode相同
+-	ctx结束(超时)后还没开始计算的项不再调用Sum，RetCode为RET_SYS_ERR，调用方可以重试这些项
+*/
+
+// BatchSum同时计算的最大项数
+const batchSumWorkers = 8
+
+// BatchSumRequest collects the request parameters for the BatchSum method.
+type BatchSumRequest struct {
+	Items []*SumRequest `json:"items" validate:"min=1,max=100"`
 }
 
-// SumResponse collects the response values for the Sum method.
-type SumResponse struct {
-	V       int                    `json:"v"`
-	RetCode resultcode.RESULT_CODE `json:"ret_code"`
+// BatchSumResponse collects the response values for the BatchSum method.
+// Items与request的Items一一对应
+type BatchSumResponse struct {
+	Items []*SumResponse `json:"items"`
 }
 
-// ConcatRequest collects the request parameters for the Concat method.
-type ConcatRequest struct {
-	A, B string
+// MakeBatchSumEndpoint returns an endpoint that invokes Sum on the service for each item.
+// workers为同时计算的最大项数，必须大于0，limits每次调用时读取
+func MakeBatchSumEndpoint(s service2.Service, workers int, limits func() config.Limits) endpoint.Endpoint {
+	return endpointx.New(func(ctx context.Context, req *BatchSumRequest) (*BatchSumResponse, error) {
+		l := limits()
+		items := make([]*SumResponse, len(req.Items))
+		n := workers
+		if n > len(items) {
+			n = len(items)
+		}
+		idx := make(chan int)
+		var wg sync.WaitGroup
+		wg.Add(n)
+		for w := 0; w < n; w++ {
+			go func() {
+				defer wg.Done()
+				for i := range idx {
+					items[i] = batchSumItem(ctx, s, req.Items[i], l)
+				}
+			}()
+		}
+		for i := range items {
+			idx <- i
+		}
+		close(idx)
+		wg.Wait()
+		return &BatchSumResponse{Items: items}, nil
+	})
 }
 
-// ConcatResponse collects the response values for the Concat method.
-type ConcatResponse struct {
-	V       string                 `json:"v"`
-	RetCode resultcode.RESULT_CODE `json:"ret_code"`
+// 计算一项，err都转为这一项的RetCode
+// 在worker goroutine中执行，RecoveryMiddleware捕获不到这里的panic，需要自行recover
+func batchSumItem(ctx context.Context, s service2.Service, item *SumRequest, l config.Limits) (rsp *SumResponse) {
+	defer func() {
+		if r := recover(); r != nil {
+			rsp = &SumResponse{RetCode: errToRetCode(errs.Internal(fmt.Sprint("panic: ", r)))}
+		}
+	}()
+	if item == nil {
+		return &SumResponse{RetCode: errToRetCode(ErrInvalidRequest)}
+	}
+	if fields, _ := validateStruct(item); len(fields) > 0 {
+		return &SumResponse{RetCode: errToRetCode(ErrInvalidRequest.WithDetails(fields))}
+	}
+	if fields := item.checkLimits(l); len(fields) > 0 {
+		return &SumResponse{RetCode: errToRetCode(ErrLimitExceeded.WithDetails(fields))}
+	}
+	if ctx.Err() != nil {
+		return &SumResponse{RetCode: resultcode.RESULT_CODE_RET_SYS_ERR}
+	}
+	v, err := s.Sum(ctx, item.A, item.B)
+	return &SumResponse{V: v, RetCode: errToRetCode(err)}
 }
@@ -1,86 +1,156 @@
 package endpoint
 
 import (
-	"context"
-	"github.com/go-kit/kit/circuitbreaker"
 	"github.com/go-kit/kit/endpoint"
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/metrics"
-	"github.com/go-kit/kit/ratelimit"
-	"github.com/go-kit/kit/tracing/opentracing"
+	"github.com/go-kit/kit/metrics/discard"
 	stdopentracing "github.com/opentracing/opentracing-go"
-	"github.com/sony/gobreaker"
-	"golang.org/x/time/rate"
+	"gokit_foundation/authz"
+	"gokit_foundation/cache"
+	"gokit_foundation/deadline"
+	"gokit_foundation/loadshed"
+	"gokit_foundation/mwchain"
+	"gokit_foundation/otel"
+	"gokit_foundation/resguard"
+	"gokit_foundation/slo"
+	"new_addsvc/config"
 	"new_addsvc/pb/gen-go/resultcode"
 	service2 "new_addsvc/pkg/service"
 	"time"
 )
 
-// 以下Endpoint简称ep
-// Endpoints内包含的ep对应service每个接口，而且必须一致
-// ep在RPC调用时，client调用的也是ep，对调用者隐藏了transport层
-type AddSvcEndpoints struct {
-	SumEndpoint    endpoint.Endpoint
-	ConcatEndpoint endpoint.Endpoint
+//go:generate go run ../../cmd/slogen -out ../../deploy/slo_rules.yaml
+
+// 各接口的SLO，生成prometheus的burn rate告警规则(见cmd/slogen)，修改后执行go generate ./pkg/endpoint/
+// Latency需为耗时histogram的bucket上界(见internal.DurationBuckets)
+var SLOs = []slo.Objective{
+	{Method: "Sum", Target: 0.999, Latency: 50 * time.Millisecond},
+	{Method: "Concat", Target: 0.999, Latency: 100 * time.Millisecond},
+	{Method: "BatchSum", Target: 0.99, Latency: 250 * time.Millisecond},
 }
 
-// 将一个Service对象转为Endpoints对象
-func New(svc service2.Service, logger log.Logger, duration metrics.Histogram, otTracer stdopentracing.Tracer) AddSvcEndpoints {
-	var sumEndpoint endpoint.Endpoint
-	// 使用洋葱模式封装endpoint
-	{
-		sumEndpoint = MakeSumEndpoint(svc)
+// 各接口所需的权限，开启授权(config.GetAuthzConf)时检查，见AuthzMiddleware
+var Permissions = map[string]string{
+	"Sum":      authz.Permission("addsvc", "Sum"),
+	"Concat":   authz.Permission("addsvc", "Concat"),
+	"BatchSum": authz.Permission("addsvc", "BatchSum"),
+	"Upload":   authz.Permission("addsvc", "Upload"),
+	// v2与v1的权限相同，见NewV2
+	"SumV2":    authz.Permission("addsvc", "Sum"),
+	"ConcatV2": authz.Permission("addsvc", "Concat"),
+}
 
-		sumEndpoint = ratelimit.NewErroringLimiter(rate.NewLimiter(rate.Every(time.Second), 1))(sumEndpoint)
-		sumEndpoint = opentracing.TraceServer(otTracer, "Sum")(sumEndpoint)
-		sumEndpoint = InstrumentingMiddleware(duration.With("method", "Sum"))(sumEndpoint)
-	}
+// 每个接口同时执行的最大调用数，见MaxInFlightMiddleware
+const maxInFlight = 100
 
-	var concatEndpoint endpoint.Endpoint
-	{
-		concatEndpoint = MakeConcatEndpoint(svc)
+// Deps New、NewV2的可选依赖，为nil的字段不安装对应的中间件或不上报，新的中间件依赖加在这里而不是New的参数
+type Deps struct {
+	Duration     metrics.Histogram // 各接口的耗时
+	BreakerState metrics.Gauge     // 各接口断路器的状态，见BreakerMiddleware
+	CacheStore   cache.Store       // 为nil时不缓存response，见CacheMiddleware
+	CacheLookups metrics.Counter   // 缓存的查询结果
+	Panics       metrics.Counter   // 被recover的panic数
+	// 超时预算不足被拒绝以及处理超时的调用数
+	DeadlineExceeded metrics.Counter
+	// 过载保护拒绝的调用数和负载，见loadshed.Metrics
+	LoadShed     metrics.Counter
+	LoadShedLoad metrics.Gauge
+	ResGuard     *resguard.Guard // 为nil时不因资源超限拒绝请求，见resguard.Guard.Middleware
+}
 
-		concatEndpoint = ratelimit.NewErroringLimiter(rate.NewLimiter(rate.Limit(1), 100))(concatEndpoint)
-		concatEndpoint = circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(gobreaker.Settings{}))(concatEndpoint)
-		concatEndpoint = opentracing.TraceServer(otTracer, "Concat")(concatEndpoint)
-		concatEndpoint = InstrumentingMiddleware(duration.With("method", "Concat"))(concatEndpoint)
+// 将一个Service对象转为Endpoints对象，deps中为nil的指标不上报(如prometheus不可用、测试)
+func New(svc service2.Service, logger log.Logger, otTracer stdopentracing.Tracer, deps Deps) AddSvcEndpoints {
+	duration := deps.Duration
+	if duration == nil {
+		duration = discard.NewHistogram()
 	}
-	return AddSvcEndpoints{
-		SumEndpoint:    sumEndpoint,
-		ConcatEndpoint: concatEndpoint,
+	aclRules := config.GetACLRules()
+	authzConf := config.GetAuthzConf()
+	authConf := config.GetAuthConf()
+	breakerConf := config.GetBreakerConf()
+	cacheTTLs := config.GetCacheTTLs()
+	// 所有接口共用，负载按整个进程计算
+	shedder := loadshed.New(DynamicLoadShed, loadshed.Metrics{Shed: deps.LoadShed, Load: deps.LoadShedLoad})
+	var resGuard mwchain.MiddlewareFunc // 为nil时不安装
+	if deps.ResGuard != nil {
+		resGuard = deps.ResGuard.Middleware
 	}
-}
-
-// 针对接口：Sum 的转换方法
-func MakeSumEndpoint(s service2.Service) endpoint.Endpoint {
-	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
-		req := request.(*SumRequest)
-		v, err := s.Sum(ctx, req.A, req.B)
-		// err 在logger mw打印出来 以debug
-		// 谨慎处理endpoint层返回的err，这个err会被各种中间件捕获，可能会产生一些影响
-		// 比如断路器就是安装在endpoint层，它会根据返回err次数来判断什么时候打开开关
-		// 所以，业务err应该封装在SumResponse内，如果是你在service层能够读取到接口调用的系统压力过大
-		// 这个时候可以通过endpoint层返出去
-		// 一般情况，这里都返回err
-		return &SumResponse{RetCode: errToRetCode(err), V: v}, nil
+	// 未调用otel.Setup时为noop
+	otelTracer := otel.Tracer()
+	newResponse := map[string]func() interface{}{
+		"Sum":      func() interface{} { return new(SumResponse) },
+		"Concat":   func() interface{} { return new(ConcatResponse) },
+		"BatchSum": func() interface{} { return new(BatchSumResponse) },
 	}
-}
-
-// 针对接口：Concat 的转换方法
-func MakeConcatEndpoint(s service2.Service) endpoint.Endpoint {
-	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
-		req := request.(*ConcatRequest)
-		p, err := s.Concat(ctx, req.A, req.B)
-		return &ConcatResponse{RetCode: errToRetCode(err), V: p}, nil
+	// 使用洋葱模式封装endpoint，封装顺序由mwchain按层确定(与With*的调用顺序无关)，见mwchain.Layer
+	eps := mwchain.New().
+		WithI18n(DefaultMessages).
+		WithPayloadLog(DefaultPayloadLog, logger).
+		WithErrors(mwchain.Static(ErrorsMiddleware())).
+		WithMetrics(func(method string) endpoint.Middleware {
+			return InstrumentingMiddleware(duration.With("method", method))
+		}).
+		// 先添加的在外层
+		Use(mwchain.LayerTracing, func(method string) endpoint.Middleware { return otel.TraceServer(otelTracer, method) }).
+		WithTracing(otTracer).
+		Use(mwchain.LayerTracing, mwchain.Static(SpanTagsMiddleware())).
+		WithAuth(func(method string) endpoint.Middleware { return AuthMiddleware(authConf, method) }).
+		WithACL(func(method string) endpoint.Middleware { return ACLMiddleware(aclRules, method) }).
+		Use(mwchain.LayerAuthz, func(method string) endpoint.Middleware { return AuthzMiddleware(authzConf, method, logger) }).
+		// service层通过logging.FromContext取得带request_id、method、trace_id的logger
+		WithRequestLogger(logger).
+		// validate tag是协议规定的范围，limits在此之内按部署收紧
+		WithValidation(mwchain.Static(endpoint.Chain(ValidationMiddleware(), LimitsMiddleware(DynamicLimits)))).
+		WithFeatureFlags(DefaultFlags, nil).
+		WithCache(func(method string) endpoint.Middleware {
+			return CacheMiddleware(deps.CacheStore, cacheTTLs, method, newResponse[method], logger, deps.CacheLookups)
+		}).
+		// 剩余时间不足的请求不占用限流的配额，被拒绝也不算作断路器的失败
+		WithDeadline(func(method string) endpoint.Middleware {
+			return deadline.Middleware(method, DynamicDeadline, deps.DeadlineExceeded)
+		}).
+		WithResGuard(resGuard).
+		WithLoadShed(shedder.Middleware).
+		WithRateLimit(DefaultRateLimiters.Middleware).
+		WithMaxInFlight(func(string) endpoint.Middleware { return MaxInFlightMiddleware(maxInFlight) }).
+		WithBreaker(func(method string) endpoint.Middleware {
+			return BreakerMiddleware(breakerConf, method, logger, deps.BreakerState)
+		}).
+		WithTimeout(func(method string) endpoint.Middleware { return TimeoutMiddleware(method, DynamicTimeout) }).
+		WithRecovery(logger, deps.Panics).
+		WithChaos(DefaultChaos).
+		MustBuild(map[string]endpoint.Endpoint{
+			"Sum":    MakeSumEndpoint(svc),
+			"Concat": MakeConcatEndpoint(svc),
+			// 每一项调用svc.Sum，不再经过Sum的endpoint中间件
+			"BatchSum": MakeBatchSumEndpoint(svc, batchSumWorkers, DynamicLimits),
+		})
+	return AddSvcEndpoints{
+		SumEndpoint:      eps["Sum"],
+		ConcatEndpoint:   eps["Concat"],
+		BatchSumEndpoint: eps["BatchSum"],
 	}
 }
 
-// 统一处理err
+/*
+统一处理err，映射规则见service.ErrorToRetCode，MakeXxxEndpoint(见0.protocol_gen.go)中使用
+谨慎处理endpoint层返回的err，这个err会被各种中间件捕获，可能会产生一些影响
+比如断路器就是安装在endpoint层，它会根据返回err次数来判断什么时候打开开关
+所以，业务err应该封装在XxxResponse.RetCode内，endpoint层总是返回nil err
+*/
 func errToRetCode(err error) resultcode.RESULT_CODE {
-	switch err {
-	case service2.ErrIntOverflow, service2.ErrMaxSizeExceeded, service2.ErrTwoZeroes:
-		return resultcode.RESULT_CODE_RET_INVALID_ARGS
+	return resultcode.RESULT_CODE(service2.ErrorToRetCode(err))
+}
+
+// 将RetCode还原为service层的err，使得调用endpoint(如client)与直接调用service得到的err一致(errors.Is)
+func retCodeToErr(code resultcode.RESULT_CODE) error {
+	switch int(code) {
+	case service2.CodeOverflow:
+		return service2.ErrSumOverflow
+	case service2.CodeForbidden:
+		return ErrForbidden
 	default:
-		return resultcode.RESULT_CODE_RET_UNKNOWN_ERR
+		return service2.ErrorFromRetCode(int(code), code.String())
 	}
 }
@@ -2,28 +2,74 @@ package endpoint
 
 import (
 	"context"
+	"fmt"
+	"gokit_foundation/endpointx"
+	"gokit_foundation/errs"
 )
 
+/*
+每次调用都新分配request，不能用sync.Pool复用：
+endpoint返回后仍可能有goroutine持有request(如之前使用的lb.Retry，超时后直接返回，而它的goroutine可能仍在encode这个request)，
+此时放回pool的request会被下一次调用改写，导致发出错误的参数；endpoint的各层中间件都不保证返回后不再使用request
+bare路径的2次分配就是request和response(经过interface{}传递，逃逸到堆上)，不复用时无法再减少；
+中间件上减少的分配：InstrumentingMiddleware提前创建success标签的两个histogram，
+TimeoutMiddleware在外层deadline.Middleware的deadline更早时(默认配置下总是如此)不再创建ctx
+
+	go test -run xxx -bench Sum -benchmem ./pkg/endpoint/
+	baseline(加入pool之前)：bare 2 allocs/op(32 B/op)
+	现在：bare 2 allocs/op(32 B/op)；middlewares 24 => 18 allocs/op(1272 => 776 B/op)
+	middlewares剩下的主要是各层写入ctx的值(span、logger、feature flag)和deadline.Middleware的ctx
+*/
+
 // endpoint层的实现不需要用pointer，是func类型
 func (e AddSvcEndpoints) Sum(ctx context.Context, a, b int) (int, error) {
 	// 注意，这里虽然实现了service，但service返回的err已经映射到response.RetCode
-	// 调用时，这里的err 若!=nil，则按顺序应该是grpc.conn错误，断路器等中间件返回的err
-	// 此时api网关应该返回 类似503的server内部错误，而不是再读取response.RetCode，因为读取到的不是被调用方返回的，而是默认的
-	resp, err := e.SumEndpoint(ctx, &SumRequest{A: a, B: b})
-	// 如果这里resp是nil，要么是代码bug，要么是网络导致
+	// 调用时，这里的err 若!=nil，则是grpc.conn错误，断路器、限流、参数校验等中间件返回的err，此时不再读取response.RetCode
+	// 两种err最终都是*errs.Error(中间件的err见ClassifyError，RetCode见retCodeToErr)，
+	// 调用方(如api网关)不需要区分来源，按errs.HTTPStatus/errs.IsRetryable处理即可
+	response, err := endpointx.Typed[*SumRequest, *SumResponse](e.SumEndpoint)(ctx, &SumRequest{A: a, B: b})
+	// 如果这里response是nil，要么是代码bug，要么是网络导致
 	// 我们必须在这里处理nil的情况，因为client调用时会直接调用endpoint层，这里的步骤是 client---grpc-->endpoint-->service
-	if resp == nil {
+	if response == nil {
 		return 0, err
 	}
-	response := resp.(*SumResponse)
+	if err == nil {
+		// service返回的err(如ErrSumOverflow)原样返回，不做任何包装
+		err = retCodeToErr(response.RetCode)
+	}
 	return response.V, err
 }
 
 func (e AddSvcEndpoints) Concat(ctx context.Context, a, b string) (string, error) {
-	resp, err := e.ConcatEndpoint(ctx, &ConcatRequest{A: a, B: b})
-	if resp == nil {
+	response, err := endpointx.Typed[*ConcatRequest, *ConcatResponse](e.ConcatEndpoint)(ctx, &ConcatRequest{A: a, B: b})
+	if response == nil {
 		return "", err
 	}
-	response := resp.(*ConcatResponse)
+	if err == nil {
+		err = retCodeToErr(response.RetCode)
+	}
 	return response.V, err
 }
+
+// ErrBatchUnsupported 调用方的Endpoints没有BatchSumEndpoint(如NATS、thrift的client)
+var ErrBatchUnsupported = errs.Internal("BatchSum is not supported")
+
+// BatchSum 不是service的接口，client通过它一次计算多组Sum(见client.Batching)
+// 返回的err不为nil时整批失败(网络错误、限流等)，否则itemErrs与items一一对应，每一项的err与单独调用Sum时相同
+func (e AddSvcEndpoints) BatchSum(ctx context.Context, items []*SumRequest) (vs []int, itemErrs []error, err error) {
+	if e.BatchSumEndpoint == nil {
+		return nil, nil, ErrBatchUnsupported
+	}
+	response, err := endpointx.Typed[*BatchSumRequest, *BatchSumResponse](e.BatchSumEndpoint)(ctx, &BatchSumRequest{Items: items})
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(response.Items) != len(items) {
+		return nil, nil, errs.Internal(fmt.Sprintf("BatchSum: got %d results for %d items", len(response.Items), len(items)))
+	}
+	vs, itemErrs = make([]int, len(items)), make([]error, len(items))
+	for i, r := range response.Items {
+		vs[i], itemErrs[i] = r.V, retCodeToErr(r.RetCode)
+	}
+	return vs, itemErrs, nil
+}
@@ -2,9 +2,38 @@ package endpoint
 
 import (
 	"context"
+	"embed"
 	"fmt"
+	"github.com/go-kit/kit/circuitbreaker"
 	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
+	"github.com/go-kit/kit/ratelimit"
+	"github.com/go-playground/validator/v10"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"github.com/sony/gobreaker"
+	"gokit_foundation/auth"
+	"gokit_foundation/authz"
+	"gokit_foundation/cache"
+	"gokit_foundation/chaos"
+	"gokit_foundation/clock"
+	"gokit_foundation/deadline"
+	"gokit_foundation/errs"
+	"gokit_foundation/featureflag"
+	"gokit_foundation/i18n"
+	"gokit_foundation/loadshed"
+	"gokit_foundation/otel"
+	"gokit_foundation/payloadlog"
+	"gokit_foundation/resguard"
+	"golang.org/x/time/rate"
+	"new_addsvc/config"
+	"new_addsvc/pb/gen-go/resultcode"
+	service2 "new_addsvc/pkg/service"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -12,15 +41,572 @@ import (
 endpoint层也可以安装中间件
 */
 
-// 创建一个监控mw
+// 创建一个监控mw，duration支持exemplar时附带本次调用的trace id(见otel.ObserveContext)；
+// 监控mw在tracing mw外层，通过otel.CaptureSpan获取内层创建的server span
 func InstrumentingMiddleware(duration metrics.Histogram) endpoint.Middleware {
+	// 指标为nil(如prometheus不可用)时不上报
+	if duration == nil {
+		duration = discard.NewHistogram()
+	}
+	// 标签只有两种取值，提前创建，避免每次调用With时分配标签的slice
+	succeeded, failed := duration.With("success", "true"), duration.With("success", "false")
 	return func(next endpoint.Endpoint) endpoint.Endpoint {
 		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
-
+			ctx = otel.CaptureSpan(ctx)
 			defer func(begin time.Time) {
-				duration.With("success", fmt.Sprint(err == nil)).Observe(time.Since(begin).Seconds())
+				h := succeeded
+				if err != nil {
+					h = failed
+				}
+				otel.ObserveContext(ctx, h, time.Since(begin).Seconds())
 			}(time.Now())
 			return next(ctx, request)
 		}
 	}
 }
+
+// 每个接口一个令牌桶限速器，限速值每次调用时从配置读取，配置热更新后立即生效
+// 各接口的状态可以通过States获取(见http服务的/ratelimit)
+type RateLimiters struct {
+	confFn func(method string) (config.RateLimit, bool)
+	clock  clock.Clock
+
+	mu       sync.RWMutex
+	limiters map[string]*methodLimiter
+}
+
+type methodLimiter struct {
+	limiter  *rate.Limiter
+	allowed  uint64
+	rejected uint64
+}
+
+// 限速器当前的状态
+type RateLimitState struct {
+	Unlimited bool    `json:"unlimited,omitempty"` // 接口没有配置限速
+	Limit     float64 `json:"limit"`
+	Burst     int     `json:"burst"`
+	Allowed   uint64  `json:"allowed"`
+	Rejected  uint64  `json:"rejected"`
+}
+
+type RateLimitersOption func(*RateLimiters)
+
+// 令牌桶补充令牌使用的时间，默认clock.Real
+func RateLimitersClock(c clock.Clock) RateLimitersOption {
+	return func(rl *RateLimiters) { rl.clock = c }
+}
+
+// confFn返回接口的限速配置，返回false表示不限速
+func NewRateLimiters(confFn func(method string) (config.RateLimit, bool), options ...RateLimitersOption) *RateLimiters {
+	rl := &RateLimiters{confFn: confFn, clock: clock.Real, limiters: map[string]*methodLimiter{}}
+	for _, opt := range options {
+		opt(rl)
+	}
+	return rl
+}
+
+// 使用动态配置(config.GetDynamic)中的rate_limits
+var DefaultRateLimiters = NewRateLimiters(func(method string) (config.RateLimit, bool) {
+	return config.GetDynamic().GetRateLimit(method)
+})
+
+func (rl *RateLimiters) limitOf(method string) (rate.Limit, int) {
+	conf, ok := rl.confFn(method)
+	if !ok {
+		return rate.Inf, 1
+	}
+	return rate.Limit(conf.RPS), conf.GetBurst()
+}
+
+// 创建接口method的限速mw，超过限速时返回ratelimit.ErrLimited
+// 同一个method重复创建时(如多次调用New)，使用新的限速器，States返回最后创建的
+func (rl *RateLimiters) Middleware(method string) endpoint.Middleware {
+	ml := &methodLimiter{limiter: rate.NewLimiter(rl.limitOf(method))}
+	rl.mu.Lock()
+	rl.limiters[method] = ml
+	rl.mu.Unlock()
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+			now := rl.clock.Now()
+			limit, burst := rl.limitOf(method)
+			if limit != ml.limiter.Limit() {
+				ml.limiter.SetLimitAt(now, limit)
+			}
+			if burst != ml.limiter.Burst() {
+				ml.limiter.SetBurstAt(now, burst)
+			}
+			if !ml.limiter.AllowN(now, 1) {
+				atomic.AddUint64(&ml.rejected, 1)
+				return nil, ratelimit.ErrLimited
+			}
+			atomic.AddUint64(&ml.allowed, 1)
+			return next(ctx, request)
+		}
+	}
+}
+
+// 接口名 => 限速器当前状态
+func (rl *RateLimiters) States() map[string]RateLimitState {
+	rl.mu.RLock()
+	defer rl.mu.RUnlock()
+	states := make(map[string]RateLimitState, len(rl.limiters))
+	for method, ml := range rl.limiters {
+		st := RateLimitState{
+			Burst:    ml.limiter.Burst(),
+			Allowed:  atomic.LoadUint64(&ml.allowed),
+			Rejected: atomic.LoadUint64(&ml.rejected),
+		}
+		if limit := ml.limiter.Limit(); limit == rate.Inf {
+			st.Unlimited = true
+		} else {
+			st.Limit = float64(limit)
+		}
+		states[method] = st
+	}
+	return states
+}
+
+// 创建一个超时mw，每次调用时通过confFn读取method的超时(热更新立即生效)，写入ctx的deadline，返回false或ctx的deadline更早时不设置
+// 下游(redis、grpc client等)根据deadline提前返回，err为context.DeadlineExceeded时见ClassifyError(KindTimeout)
+func TimeoutMiddleware(method string, confFn func(method string) (time.Duration, bool)) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			timeout, ok := confFn(method)
+			if !ok {
+				return next(ctx, request)
+			}
+			// 外层(deadline.Middleware或调用方)的deadline更早时WithTimeout不会改变deadline，不再创建ctx(省去5次分配)
+			if dl, ok := ctx.Deadline(); ok && time.Until(dl) <= timeout {
+				return next(ctx, request)
+			}
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			return next(ctx, request)
+		}
+	}
+}
+
+// 使用动态配置(config.GetDynamic)中的timeouts
+func DynamicTimeout(method string) (time.Duration, bool) {
+	return config.GetDynamic().GetTimeout(method)
+}
+
+// 使用动态配置(config.GetDynamic)中的deadlines，见deadline.Middleware
+func DynamicDeadline(method string) (deadline.Budget, bool) {
+	return config.GetDynamic().GetDeadline(method)
+}
+
+// 使用动态配置中的load_shed，见loadshed.New
+func DynamicLoadShed() loadshed.Config {
+	return config.GetDynamic().GetLoadShed()
+}
+
+// 使用动态配置中的resource_guard，见resguard.New
+func DynamicResourceGuard() resguard.Config {
+	return config.GetDynamic().GetResourceGuard()
+}
+
+// 故障注入，启动和动态配置重新加载时使用其中的chaos配置(见config.Dynamic.GetChaos)，运行时也可以通过Handler修改
+var DefaultChaos = chaos.NewInjector()
+
+// 功能开关，启动和动态配置重新加载时使用其中的feature_flags配置，运行时也可以通过Handler修改
+// 按featureflag.SubjectFromContext定向，启用JWT认证时为claims中的sub(见AuthMiddleware)，否则为X-User-Id header
+var DefaultFlags = featureflag.NewStore()
+
+// 请求/响应payload日志，默认关闭，开发环境排查问题时通过管理端口的/payloadlog开启(见payloadlog.Recorder.Handler)
+var DefaultPayloadLog = payloadlog.NewRecorder()
+
+//go:embed locales/*.json
+var locales embed.FS
+
+// 错误描述的翻译，按调用方的Accept-Language本地化返回的err(见i18n.Middleware)，
+// 嵌入的locales之外，启动时可以指定运行时可修改的目录(见config.Bootstrap.I18nDir)
+var DefaultMessages = i18n.MustNew(locales)
+
+// 正在执行的调用数超过上限时返回，可重试
+var ErrTooManyRequests = errs.ResourceExhausted("too many requests in flight")
+
+// 创建一个并发数限制mw，同时执行的调用超过n个时直接返回ErrTooManyRequests，不排队
+// 与限速不同，它限制的是同时占用下游资源(如redis连接)的调用数，next发生panic时也会释放占用
+// n<=0时不限制(与load_shed.max_in_flight为0时相同)，否则容量为0的信号量会拒绝所有调用
+func MaxInFlightMiddleware(n int) endpoint.Middleware {
+	if n <= 0 {
+		return func(next endpoint.Endpoint) endpoint.Endpoint { return next }
+	}
+	sem := make(chan struct{}, n)
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+			select {
+			case sem <- struct{}{}:
+			default:
+				return nil, ErrTooManyRequests
+			}
+			defer func() { <-sem }()
+			return next(ctx, request)
+		}
+	}
+}
+
+// 参数校验失败时endpoint返回的err，Details为 字段名=>错误描述
+var ErrInvalidRequest = errs.Invalid("invalid request").WithCode(service2.CodeInvalidArgs)
+
+type requestValidator interface {
+	Validate() map[string]string
+}
+
+/*
+参数校验分两部分，都在业务逻辑执行前完成：
+-	struct tag规则：request字段上的validate tag，规则见 https://github.com/go-playground/validator
+-	requestValidator接口：tag无法表达的规则(如涉及外部数据)，由request实现Validate方法
+两者的结果合并到ErrInvalidRequest的Details，字段名使用json tag，与http/grpc协议中的字段名一致
+*/
+var structValidator = newStructValidator()
+
+func newStructValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterTagNameFunc(jsonFieldName)
+	return v
+}
+
+func jsonFieldName(f reflect.StructField) string {
+	name := strings.SplitN(f.Tag.Get("json"), ",", 2)[0]
+	switch name {
+	case "-":
+		return ""
+	case "":
+		return f.Name
+	}
+	return name
+}
+
+// 校验request的validate tag，request不是struct(或其指针)时不校验，
+// 同时返回用于本地化Details的规则(见i18n.Catalog.LocalizeError)，只包含locales中有翻译的规则
+func validateStruct(request interface{}) (map[string]string, map[string]errs.Violation) {
+	err := structValidator.Struct(request)
+	ves, ok := err.(validator.ValidationErrors)
+	if !ok {
+		return nil, nil
+	}
+	t := reflect.Indirect(reflect.ValueOf(request)).Type()
+	fields := make(map[string]string, len(ves))
+	violations := make(map[string]errs.Violation, len(ves))
+	for _, fe := range ves {
+		fields[fe.Field()] = fieldErrMsg(t, fe)
+		if v, ok := fieldViolation(t, fe); ok {
+			violations[fe.Field()] = v
+		}
+	}
+	return fields, violations
+}
+
+// required_without的param是go的字段名，转为json字段名
+func otherField(t reflect.Type, fe validator.FieldError) string {
+	other := fe.Param()
+	if f, ok := t.FieldByName(other); ok {
+		other = jsonFieldName(f)
+	}
+	return other
+}
+
+func fieldErrMsg(t reflect.Type, fe validator.FieldError) string {
+	prefix := "must be"
+	if fe.Kind() == reflect.String {
+		prefix = "length must be"
+	}
+	switch fe.Tag() {
+	case "required":
+		return "required"
+	case "required_without":
+		return fmt.Sprintf("required when %s is empty", otherField(t, fe))
+	case "min":
+		return fmt.Sprintf("%s at least %s", prefix, fe.Param())
+	case "max":
+		return fmt.Sprintf("%s at most %s", prefix, fe.Param())
+	}
+	return fmt.Sprintf("failed on the '%s' rule", fe.Tag())
+}
+
+// 与fieldErrMsg一一对应，字符串的min、max为长度
+func fieldViolation(t reflect.Type, fe validator.FieldError) (errs.Violation, bool) {
+	switch tag := fe.Tag(); tag {
+	case "required":
+		return errs.Violation{Rule: tag}, true
+	case "required_without":
+		return errs.Violation{Rule: tag, Args: map[string]string{"other": otherField(t, fe)}}, true
+	case "min", "max":
+		if fe.Kind() == reflect.String {
+			tag += "_length"
+		}
+		return errs.Violation{Rule: tag, Args: map[string]string{"param": fe.Param()}}, true
+	}
+	return errs.Violation{}, false
+}
+
+// 创建一个参数校验mw，在业务逻辑执行前校验已经decode的request
+func ValidationMiddleware() endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+			fields, violations := validateStruct(request)
+			if v, ok := request.(requestValidator); ok {
+				for k, msg := range v.Validate() {
+					if fields == nil {
+						fields = map[string]string{}
+					}
+					// 同一字段以tag规则的错误为准
+					if _, ok := fields[k]; !ok {
+						fields[k] = msg
+					}
+				}
+			}
+			if len(fields) > 0 {
+				return nil, ErrInvalidRequest.WithDetails(fields).WithViolations(violations)
+			}
+			return next(ctx, request)
+		}
+	}
+}
+
+// 请求字段超出config.Limits时返回，Details与ErrInvalidRequest相同，为 字段名=>错误描述
+// Kind和Code都与ErrInvalidRequest相同，对client来说也是参数错误(errors.Is(err, ErrInvalidRequest)成立)，只有错误信息不同(翻译通过Key区分)
+var ErrLimitExceeded = errs.Invalid("request exceeds limits").WithCode(service2.CodeInvalidArgs).WithKey("limits.exceeded")
+
+type limitChecker interface {
+	checkLimits(l config.Limits) map[string]string
+}
+
+// 使用动态配置中的limits，见LimitsMiddleware
+func DynamicLimits() config.Limits {
+	return config.GetDynamic().Limits
+}
+
+// 创建一个字段上限mw，安装在ValidationMiddleware内层(validate tag是协议规定的范围，limits在此之内按部署收紧)
+// request实现limitChecker时检查，limits每次调用时读取(热更新立即生效)
+func LimitsMiddleware(limits func() config.Limits) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+			if c, ok := request.(limitChecker); ok {
+				if fields := c.checkLimits(limits()); len(fields) > 0 {
+					return nil, ErrLimitExceeded.WithDetails(fields)
+				}
+			}
+			return next(ctx, request)
+		}
+	}
+}
+
+type spanTagger interface {
+	SpanTags() stdopentracing.Tags
+}
+
+type retCoder interface {
+	GetRetCode() string
+}
+
+// 创建一个span标签mw，需安装在TraceServer内层（此时ctx中已有span）
+// request实现spanTagger接口时将其返回的标签设置到span，response实现retCoder接口时将RetCode记录到span的log
+// tracer为NoopTracer时不做任何处理
+func SpanTagsMiddleware() endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+			span := stdopentracing.SpanFromContext(ctx)
+			if span == nil {
+				return next(ctx, request)
+			}
+			if _, ok := span.Tracer().(stdopentracing.NoopTracer); ok {
+				return next(ctx, request)
+			}
+
+			if t, ok := request.(spanTagger); ok {
+				for k, v := range t.SpanTags() {
+					span.SetTag(k, v)
+				}
+			}
+			response, err = next(ctx, request)
+			if r, ok := response.(retCoder); ok {
+				span.LogKV("ret_code", r.GetRetCode())
+			}
+			return
+		}
+	}
+}
+
+// 没有权限调用接口时返回，与service层的错误一样可以映射为RetCode
+var ErrForbidden = errs.Forbidden("forbidden").WithCode(service2.CodeForbidden)
+
+type ctxKeyRole struct{}
+
+// WithRole 将调用方的角色写入ctx，由认证中间件调用
+func WithRole(ctx context.Context, role string) context.Context {
+	return context.WithValue(ctx, ctxKeyRole{}, role)
+}
+
+func RoleFromContext(ctx context.Context) string {
+	role, _ := ctx.Value(ctxKeyRole{}).(string)
+	return role
+}
+
+// 创建一个访问控制mw，根据ctx中的角色(见WithRole)和method对应的规则决定是否允许调用
+// method没有配置规则时不限制；配置了规则时，ctx中没有角色视为拒绝
+func ACLMiddleware(rules map[string]config.ACLRule, method string) endpoint.Middleware {
+	rule, ok := rules[method]
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		if !ok {
+			return next
+		}
+		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+			if !aclAllow(rule, RoleFromContext(ctx)) {
+				return nil, ErrForbidden
+			}
+			return next(ctx, request)
+		}
+	}
+}
+
+func aclAllow(rule config.ACLRule, role string) bool {
+	if role == "" {
+		return false
+	}
+	for _, r := range rule.Deny {
+		if r == role {
+			return false
+		}
+	}
+	for _, r := range rule.Allow {
+		if r == role || r == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// 创建一个认证mw，校验ctx中的JWT(由transport层从metadata/header中提取)，
+// 并将token中的role claim写入ctx(见WithRole)，所以要安装在ACLMiddleware外层
+// conf.Enable为false时不做认证
+func AuthMiddleware(conf config.AuthConf, method string) endpoint.Middleware {
+	if !conf.Enable {
+		return func(next endpoint.Endpoint) endpoint.Endpoint { return next }
+	}
+	key := auth.EnvKey(conf.KeyEnv)
+	if conf.KeyFile != "" {
+		key = auth.FileKey(conf.KeyFile)
+	}
+	jwtMW := auth.JWTMiddleware(auth.Config{
+		Key:       key,
+		Issuer:    conf.Issuer,
+		Allowlist: conf.Allowlist,
+	}, method)
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return jwtMW(func(ctx context.Context, request interface{}) (response interface{}, err error) {
+			// Allowlist中的接口没有claims
+			if claims, ok := auth.ClaimsFromContext(ctx); ok {
+				if role, ok := claims["role"].(string); ok {
+					ctx = WithRole(ctx, role)
+				}
+				// 认证通过时以token中的用户为准，忽略调用方传入的X-User-Id
+				if sub, ok := claims["sub"].(string); ok && sub != "" {
+					ctx = featureflag.WithSubject(ctx, sub)
+				}
+			}
+			return next(ctx, request)
+		})
+	}
+}
+
+// 创建一个授权mw，检查token中的调用方是否拥有method所需的权限(见Permissions)，安装在AuthMiddleware内层
+// conf.OPAURL不为空时由OPA决定，否则按conf.Roles和token中的permissions/scope判断；拒绝时记录审计日志
+// conf.Enable为false时不做授权
+func AuthzMiddleware(conf config.AuthzConf, method string, logger log.Logger) endpoint.Middleware {
+	if !conf.Enable {
+		return func(next endpoint.Endpoint) endpoint.Endpoint { return next }
+	}
+	policy := authz.Any(authz.Claims(), authz.Roles(conf.Roles))
+	if conf.OPAURL != "" {
+		policy = authz.OPA(conf.OPAURL, nil)
+	}
+	return authz.Middleware(authz.Config{Policy: policy, Permissions: Permissions, Audit: logger}, method)
+}
+
+// 创建一个断路器mw，method没有配置断路器(见config.GetBreakerConf)时不安装
+// 状态变化时打印日志，并通过state(label: method)上报：0关闭 1半开 2打开，与gobreaker.State的值一致
+func BreakerMiddleware(confs map[string]config.BreakerConf, method string, logger log.Logger, state metrics.Gauge) endpoint.Middleware {
+	conf, ok := confs[method]
+	if !ok {
+		return func(next endpoint.Endpoint) endpoint.Endpoint { return next }
+	}
+	if state == nil {
+		state = discard.NewGauge()
+	}
+	state = state.With("method", method)
+	state.Set(float64(gobreaker.StateClosed))
+
+	cb := gobreaker.NewCircuitBreaker(gobreaker.Settings{
+		Name:        method,
+		MaxRequests: conf.MaxRequests,
+		Interval:    conf.Interval,
+		Timeout:     conf.Timeout,
+		ReadyToTrip: func(counts gobreaker.Counts) bool {
+			if conf.ConsecutiveFailures > 0 && counts.ConsecutiveFailures >= conf.ConsecutiveFailures {
+				return true
+			}
+			return conf.FailureRatio > 0 && counts.Requests >= conf.MinRequests &&
+				float64(counts.TotalFailures)/float64(counts.Requests) >= conf.FailureRatio
+		},
+		OnStateChange: func(name string, from, to gobreaker.State) {
+			logger.Log("breaker", name, "from", from, "to", to)
+			state.Set(float64(to))
+		},
+	})
+	return circuitbreaker.Gobreaker(cb)
+}
+
+// 创建一个响应缓存mw(见gokit_foundation/cache)，store为nil或method没有配置缓存时间(见config.GetCacheTTLs)时不安装
+// newResponse返回method的response类型，只缓存RetCode为成功的response
+func CacheMiddleware(store cache.Store, ttls map[string]time.Duration, method string, newResponse func() interface{}, logger log.Logger, lookups metrics.Counter) endpoint.Middleware {
+	ttl, ok := ttls[method]
+	if store == nil || !ok {
+		return func(next endpoint.Endpoint) endpoint.Endpoint { return next }
+	}
+	return cache.Middleware(store, cache.Config{
+		Method: method,
+		TTL:    ttl,
+		Prefix: config.SvcName + ":cache:",
+		New:    newResponse,
+		Cacheable: func(response interface{}) bool {
+			r, ok := response.(retCoder)
+			return ok && r.GetRetCode() == resultcode.RESULT_CODE_RET_OK.String()
+		},
+		// 开启的功能开关不同时response可能不同
+		Vary: featureflag.Fingerprint,
+	}, logger, lookups)
+}
+
+/*
+ClassifyError 将endpoint链路上的err统一转为*errs.Error，transport层据此编码(grpc status、http状态码)
+-	go-kit限速器、断路器返回的err：可重试的ResourceExhausted、Unavailable
+-	其他err见errs.From(如认证失败为Unauthenticated，grpc client得到的status会被还原)
+*/
+func ClassifyError(err error) error {
+	switch err {
+	case nil:
+		return nil
+	case ratelimit.ErrLimited:
+		return errs.ResourceExhausted(err.Error()).Wrap(err)
+	case gobreaker.ErrOpenState, gobreaker.ErrTooManyRequests:
+		return errs.Unavailable(err.Error()).Wrap(err)
+	}
+	return errs.From(err)
+}
+
+// 创建一个错误分类mw(见ClassifyError)，server和client都安装在最外层
+func ErrorsMiddleware() endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			response, err := next(ctx, request)
+			if err != nil {
+				return nil, ClassifyError(err)
+			}
+			return response, nil
+		}
+	}
+}
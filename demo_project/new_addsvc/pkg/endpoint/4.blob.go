@@ -0,0 +1,92 @@
+package endpoint
+
+import (
+	"context"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"gokit_foundation/endpointx"
+	"gokit_foundation/mwchain"
+	"gokit_foundation/otel"
+	"io"
+	"new_addsvc/config"
+	service2 "new_addsvc/pkg/service"
+)
+
+/*
+大文件上传示例(见service.BlobService)，与AddSvcEndpoints分开：
+-	request中的Body为流，transport层(grpc的数据块、http的body)边接收边交给service，endpoint返回后Body不再可用，
+	所以不能安装需要读取或保存整个request的中间件(payload日志、响应缓存、超时后继续执行的重试等)
+-	上传耗时与大小成正比，不安装超时mw，由client的deadline控制；同时进行的上传数由MaxInFlightMiddleware限制
+-	service返回的err(超过大小限制、校验失败等)直接作为endpoint的err，transport映射为grpc status/http状态码
+*/
+
+// 同时进行的最大上传数，每个上传占用的内存见blobstore.S3Store
+const maxUploadsInFlight = 10
+
+type BlobEndpoints struct {
+	UploadEndpoint endpoint.Endpoint
+}
+
+// UploadRequest name为blob的key，规则见blobstore.ValidKey，size、sha256见service.BlobService
+type UploadRequest struct {
+	Name   string    `json:"name" validate:"required,max=255"`
+	Size   int64     `json:"size" validate:"min=0"`
+	SHA256 string    `json:"sha256"`
+	Body   io.Reader `json:"-"`
+}
+
+type UploadResponse struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+func (r *UploadRequest) SpanTags() stdopentracing.Tags {
+	return stdopentracing.Tags{"upload.name": r.Name, "upload.size": r.Size}
+}
+
+func MakeUploadEndpoint(s service2.BlobService) endpoint.Endpoint {
+	return endpointx.New(func(ctx context.Context, req *UploadRequest) (*UploadResponse, error) {
+		info, err := s.Upload(ctx, req.Name, req.Body, req.Size, req.SHA256)
+		if err != nil {
+			return nil, err
+		}
+		return &UploadResponse{Name: info.Key, Size: info.Size, SHA256: info.SHA256}, nil
+	})
+}
+
+// NewBlobEndpoints 中间件与New相同的部分：错误分类、监控、追踪、认证授权、请求日志、参数校验、recover
+func NewBlobEndpoints(svc service2.BlobService, logger log.Logger, duration metrics.Histogram, otTracer stdopentracing.Tracer, panics metrics.Counter) BlobEndpoints {
+	if duration == nil {
+		duration = discard.NewHistogram()
+	}
+	aclRules := config.GetACLRules()
+	authzConf := config.GetAuthzConf()
+	authConf := config.GetAuthConf()
+	otelTracer := otel.Tracer()
+	eps := mwchain.New().
+		WithI18n(DefaultMessages).
+		WithErrors(mwchain.Static(ErrorsMiddleware())).
+		WithMetrics(func(method string) endpoint.Middleware {
+			return InstrumentingMiddleware(duration.With("method", method))
+		}).
+		Use(mwchain.LayerTracing, func(method string) endpoint.Middleware { return otel.TraceServer(otelTracer, method) }).
+		WithTracing(otTracer).
+		Use(mwchain.LayerTracing, mwchain.Static(SpanTagsMiddleware())).
+		WithAuth(func(method string) endpoint.Middleware { return AuthMiddleware(authConf, method) }).
+		WithACL(func(method string) endpoint.Middleware { return ACLMiddleware(aclRules, method) }).
+		Use(mwchain.LayerAuthz, func(method string) endpoint.Middleware { return AuthzMiddleware(authzConf, method, logger) }).
+		WithRequestLogger(logger).
+		WithValidation(mwchain.Static(ValidationMiddleware())).
+		WithMaxInFlight(func(string) endpoint.Middleware { return MaxInFlightMiddleware(maxUploadsInFlight) }).
+		WithRecovery(logger, panics).
+		MustBuild(map[string]endpoint.Endpoint{
+			"Upload": MakeUploadEndpoint(svc),
+		})
+	return BlobEndpoints{
+		UploadEndpoint: eps["Upload"],
+	}
+}
@@ -0,0 +1,163 @@
+package endpoint
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics/discard"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"gokit_foundation/deadline"
+	"gokit_foundation/endpointx"
+	"gokit_foundation/errs"
+	"gokit_foundation/mwchain"
+	"gokit_foundation/otel"
+	"math"
+	"new_addsvc/config"
+	"new_addsvc/pb/gen-go/addsvcv2pb"
+	"new_addsvc/pb/gen-go/resultcode"
+	service2 "new_addsvc/pkg/service"
+)
+
+/*
+v2版本的Add接口(见pb/proto/addsvc_v2.proto)，与v1(New)由同一进程提供，共用同一个service：
+-	Sum的a、b为完整的int64范围(http接口中编码为字符串，与proto3的JSON映射一致，js等client可以精确表示超过2^53的整数)，
+	溢出时按request的Overflow返回RET_OVERFLOW或饱和的结果，
+	service层的规则(如不能两个0相加)不变，v1、v2的区别只在endpoint和transport层
+-	Concat与v1相同，request/response直接使用v1的ConcatRequest/ConcatResponse
+-	接口名为SumV2、ConcatV2，监控、限流、超时、断路器等按接口名与v1分开统计和配置，权限与v1相同(见Permissions)
+-	没有响应缓存和BatchSum，v1的client不受影响，新client通过client.Version选择版本
+request/response手写，不由protogen生成(v2的Sum与service的Sum不是一一对应的)
+*/
+
+type AddSvcV2Endpoints struct {
+	SumEndpoint    endpoint.Endpoint
+	ConcatEndpoint endpoint.Endpoint
+}
+
+// SumV2Request collects the request parameters for the v2 Sum method.
+type SumV2Request struct {
+	A        int64               `json:"a,string"`
+	B        int64               `json:"b,string"`
+	Overflow addsvcv2pb.Overflow `json:"overflow"`
+}
+
+// SumV2Response collects the response values for the v2 Sum method.
+type SumV2Response struct {
+	V         int64                  `json:"v,string"`
+	Saturated bool                   `json:"saturated"`
+	RetCode   resultcode.RESULT_CODE `json:"ret_code"`
+}
+
+func (r *SumV2Response) GetRetCode() string {
+	return r.RetCode.String()
+}
+
+func (r *SumV2Request) SpanTags() stdopentracing.Tags {
+	return stdopentracing.Tags{"sum.a": r.A, "sum.b": r.B, "sum.overflow": r.Overflow.String()}
+}
+
+// 与v1的SumRequest相同，按config.Limits的MaxOperand检查
+func (r *SumV2Request) checkLimits(l config.Limits) map[string]string {
+	var fields map[string]string
+	for name, v := range map[string]int64{"a": r.A, "b": r.B} {
+		if l.MaxOperand > 0 && (v > int64(l.MaxOperand) || v < -int64(l.MaxOperand)) {
+			if fields == nil {
+				fields = map[string]string{}
+			}
+			fields[name] = fmt.Sprintf("magnitude must be at most %d", l.MaxOperand)
+		}
+	}
+	return fields
+}
+
+// MakeSumV2Endpoint 调用service的Sum，溢出且Overflow为OVERFLOW_SATURATE时返回int64的最大/最小值，
+// 其他err与v1一样转换为RetCode
+func MakeSumV2Endpoint(s service2.Service) endpoint.Endpoint {
+	return endpointx.New(func(ctx context.Context, req *SumV2Request) (*SumV2Response, error) {
+		v, err := s.Sum(ctx, int(req.A), int(req.B))
+		if errs.CodeOf(err) == service2.CodeOverflow && req.Overflow == addsvcv2pb.Overflow_OVERFLOW_SATURATE {
+			return req.SaturatedResponse(), nil
+		}
+		return &SumV2Response{V: int64(v), RetCode: errToRetCode(err)}, nil
+	})
+}
+
+// SaturatedResponse 溢出时饱和的结果：只有a、b同号时才会溢出，方向与a相同
+// client调用v1接口时(见transport.NewGRPCClientV2)也用它将RET_OVERFLOW转为饱和的结果
+func (r *SumV2Request) SaturatedResponse() *SumV2Response {
+	v := int64(math.MinInt64)
+	if r.A > 0 {
+		v = math.MaxInt64
+	}
+	return &SumV2Response{V: v, Saturated: true}
+}
+
+// NewV2 与New相同的service，中间件为New的子集(没有响应缓存、过载保护、资源保护和故障注入)
+// 只使用deps中的Duration、BreakerState、Panics、DeadlineExceeded，可以与New传入同一个Deps
+func NewV2(svc service2.Service, logger log.Logger, otTracer stdopentracing.Tracer, deps Deps) AddSvcV2Endpoints {
+	duration := deps.Duration
+	if duration == nil {
+		duration = discard.NewHistogram()
+	}
+	aclRules := config.GetACLRules()
+	authzConf := config.GetAuthzConf()
+	authConf := config.GetAuthConf()
+	breakerConf := config.GetBreakerConf()
+	otelTracer := otel.Tracer()
+	eps := mwchain.New().
+		WithI18n(DefaultMessages).
+		WithErrors(mwchain.Static(ErrorsMiddleware())).
+		WithMetrics(func(method string) endpoint.Middleware {
+			return InstrumentingMiddleware(duration.With("method", method))
+		}).
+		Use(mwchain.LayerTracing, func(method string) endpoint.Middleware { return otel.TraceServer(otelTracer, method) }).
+		WithTracing(otTracer).
+		Use(mwchain.LayerTracing, mwchain.Static(SpanTagsMiddleware())).
+		WithAuth(func(method string) endpoint.Middleware { return AuthMiddleware(authConf, method) }).
+		WithACL(func(method string) endpoint.Middleware { return ACLMiddleware(aclRules, method) }).
+		Use(mwchain.LayerAuthz, func(method string) endpoint.Middleware { return AuthzMiddleware(authzConf, method, logger) }).
+		WithRequestLogger(logger).
+		WithValidation(mwchain.Static(endpoint.Chain(ValidationMiddleware(), LimitsMiddleware(DynamicLimits)))).
+		WithFeatureFlags(DefaultFlags, nil).
+		WithDeadline(func(method string) endpoint.Middleware {
+			return deadline.Middleware(method, DynamicDeadline, deps.DeadlineExceeded)
+		}).
+		WithRateLimit(DefaultRateLimiters.Middleware).
+		WithMaxInFlight(func(string) endpoint.Middleware { return MaxInFlightMiddleware(maxInFlight) }).
+		WithBreaker(func(method string) endpoint.Middleware {
+			return BreakerMiddleware(breakerConf, method, logger, deps.BreakerState)
+		}).
+		WithTimeout(func(method string) endpoint.Middleware { return TimeoutMiddleware(method, DynamicTimeout) }).
+		WithRecovery(logger, deps.Panics).
+		MustBuild(map[string]endpoint.Endpoint{
+			"SumV2":    MakeSumV2Endpoint(svc),
+			"ConcatV2": MakeConcatEndpoint(svc),
+		})
+	return AddSvcV2Endpoints{
+		SumEndpoint:    eps["SumV2"],
+		ConcatEndpoint: eps["ConcatV2"],
+	}
+}
+
+// Sum 实现service，溢出时与v1一样返回ErrSumOverflow
+func (e AddSvcV2Endpoints) Sum(ctx context.Context, a, b int) (int, error) {
+	v, _, err := e.SumOverflow(ctx, int64(a), int64(b), addsvcv2pb.Overflow_OVERFLOW_ERROR)
+	return int(v), err
+}
+
+// SumOverflow 不是service的接口，overflow为OVERFLOW_SATURATE时溢出返回饱和的结果，saturated为true
+func (e AddSvcV2Endpoints) SumOverflow(ctx context.Context, a, b int64, overflow addsvcv2pb.Overflow) (v int64, saturated bool, err error) {
+	response, err := endpointx.Typed[*SumV2Request, *SumV2Response](e.SumEndpoint)(ctx, &SumV2Request{A: a, B: b, Overflow: overflow})
+	if response == nil {
+		return 0, false, err
+	}
+	if err == nil {
+		err = retCodeToErr(response.RetCode)
+	}
+	return response.V, response.Saturated, err
+}
+
+func (e AddSvcV2Endpoints) Concat(ctx context.Context, a, b string) (string, error) {
+	return AddSvcEndpoints{ConcatEndpoint: e.ConcatEndpoint}.Concat(ctx, a, b)
+}
@@ -0,0 +1,357 @@
+package endpoint
+
+import (
+	"context"
+	"errors"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
+	"github.com/go-kit/kit/tracing/opentracing"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"gokit_foundation"
+	"gokit_foundation/chaos"
+	"gokit_foundation/deadline"
+	"gokit_foundation/errs"
+	"gokit_foundation/featureflag"
+	"gokit_foundation/loadshed"
+	"gokit_foundation/resguard"
+	"io/ioutil"
+	"math"
+	"new_addsvc/config"
+	"new_addsvc/pb/gen-go/addsvcv2pb"
+	"new_addsvc/pb/gen-go/resultcode"
+	"new_addsvc/pkg/service"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSumOverflowPassThrough(t *testing.T) {
+	svc := service.NewBasicService(log.NewNopLogger())
+	sumEndpoint := MakeSumEndpoint(svc)
+
+	// endpoint层：err被映射到RetCode，而不是作为endpoint的err返回
+	resp, err := sumEndpoint(context.Background(), &SumRequest{A: math.MaxInt, B: 1})
+	if err != nil {
+		t.Fatalf("endpoint err:%v", err)
+	}
+	if code := resp.(*SumResponse).RetCode; code != resultcode.RESULT_CODE_RET_OVERFLOW {
+		t.Errorf("got RetCode:%v want:%v", code, resultcode.RESULT_CODE_RET_OVERFLOW)
+	}
+
+	// 通过endpoint调用时得到的err与service层一致
+	eps := AddSvcEndpoints{SumEndpoint: sumEndpoint}
+	v, err := eps.Sum(context.Background(), math.MaxInt, 1)
+	if err != service.ErrSumOverflow || v != 0 {
+		t.Errorf("got v:%d err:%v want err:%v", v, err, service.ErrSumOverflow)
+	}
+}
+
+// endpoint返回后仍持有request(如lb.Retry超时后其goroutine还在encode)，之后的调用不能改写它
+func TestRequestNotReused(t *testing.T) {
+	var held []*SumRequest
+	eps := AddSvcEndpoints{SumEndpoint: func(_ context.Context, request interface{}) (interface{}, error) {
+		held = append(held, request.(*SumRequest))
+		return nil, context.DeadlineExceeded
+	}}
+	_, _ = eps.Sum(context.Background(), 1, 2)
+	_, _ = eps.Sum(context.Background(), 3, 4)
+	if len(held) != 2 || held[0] == held[1] || held[0].A != 1 || held[0].B != 2 {
+		t.Errorf("got requests:%+v %+v", held[0], held[1])
+	}
+}
+
+// go test -run xxx -bench Sum -benchmem ./pkg/endpoint/
+func BenchmarkSum(b *testing.B) {
+	logger := log.NewNopLogger()
+	svc := service.NewBasicService(logger)
+	ctx := context.Background()
+
+	b.Run("bare", func(b *testing.B) {
+		eps := AddSvcEndpoints{SumEndpoint: MakeSumEndpoint(svc)}
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := eps.Sum(ctx, 1, 2); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("middlewares", func(b *testing.B) {
+		// 放开限速，避免ErrLimited
+		confFile := filepath.Join(b.TempDir(), "dynamic.json")
+		if err := ioutil.WriteFile(confFile, []byte(`{"rate_limits": {"Sum": {"rps": 1e12}}}`), 0644); err != nil {
+			b.Fatal(err)
+		}
+		config.DynamicConfFile = confFile
+		defer func() {
+			config.DynamicConfFile = ""
+			_ = config.ReloadDynamic()
+		}()
+		if err := config.ReloadDynamic(); err != nil {
+			b.Fatal(err)
+		}
+
+		eps := New(svc, logger, stdopentracing.NoopTracer{}, Deps{})
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := eps.Sum(ctx, 1, 2); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// 每一层middleware单独封装在MakeSumEndpoint外，与bare的差值即该层的开销，各层使用New中的配置(限速放开)
+// go test -run xxx -bench Middlewares -benchmem ./pkg/endpoint/
+func BenchmarkMiddlewares(b *testing.B) {
+	logger := log.NewNopLogger()
+	ctx := context.Background()
+	noLimit := NewRateLimiters(func(string) (config.RateLimit, bool) { return config.RateLimit{RPS: 1e12}, true })
+	layers := []struct {
+		name string
+		mw   endpoint.Middleware
+	}{
+		{"bare", func(next endpoint.Endpoint) endpoint.Endpoint { return next }},
+		{"chaos", DefaultChaos.Middleware("Sum")},
+		{"recovery", gokit_foundation.RecoveryMiddleware(logger, discard.NewCounter(), "Sum")},
+		{"timeout", TimeoutMiddleware("Sum", func(string) (time.Duration, bool) { return time.Second, true })},
+		{"breaker", BreakerMiddleware(config.GetBreakerConf(), "Sum", logger, discard.NewGauge())},
+		{"maxinflight", MaxInFlightMiddleware(maxInFlight)},
+		{"ratelimit", noLimit.Middleware("Sum")},
+		{"featureflag", DefaultFlags.Middleware(nil)},
+		{"validation", ValidationMiddleware()},
+		{"acl", ACLMiddleware(config.GetACLRules(), "Sum")},
+		{"auth", AuthMiddleware(config.GetAuthConf(), "Sum")},
+		{"authz", AuthzMiddleware(config.GetAuthzConf(), "Sum", logger)},
+		{"spantags", SpanTagsMiddleware()},
+		{"opentracing", opentracing.TraceServer(stdopentracing.NoopTracer{}, "Sum")},
+		{"instrumenting", InstrumentingMiddleware(discard.NewHistogram())},
+		{"errors", ErrorsMiddleware()},
+		{"payloadlog", DefaultPayloadLog.Middleware(logger, "Sum")},
+	}
+	for _, l := range layers {
+		ep := l.mw(MakeSumEndpoint(service.NewBasicService(logger)))
+		b.Run(l.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := ep(ctx, &SumRequest{A: 1, B: 2}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// 记录同时执行的Sum数
+type concurrencySvc struct {
+	service.Service
+	mu       sync.Mutex
+	cur, max int
+}
+
+func (s *concurrencySvc) Sum(ctx context.Context, a, b int) (int, error) {
+	s.mu.Lock()
+	if s.cur++; s.cur > s.max {
+		s.max = s.cur
+	}
+	s.mu.Unlock()
+	time.Sleep(time.Millisecond)
+	s.mu.Lock()
+	s.cur--
+	s.mu.Unlock()
+	return s.Service.Sum(ctx, a, b)
+}
+
+func TestBatchSum(t *testing.T) {
+	logger := log.NewNopLogger()
+	svc := &concurrencySvc{Service: service.NewBasicService(logger)}
+	var items []*SumRequest
+	for i := 1; i <= 20; i++ {
+		items = append(items, &SumRequest{A: i, B: i})
+	}
+	// 某一项失败不影响其他项
+	items = append(items, &SumRequest{}, &SumRequest{A: math.MaxInt}, nil, &SumRequest{A: 1001})
+	eps := AddSvcEndpoints{BatchSumEndpoint: MakeBatchSumEndpoint(svc, 4, func() config.Limits { return config.Limits{MaxOperand: 1000} })}
+	vs, itemErrs, err := eps.BatchSum(context.Background(), items)
+	if err != nil || len(vs) != len(items) {
+		t.Fatalf("got vs:%v err:%v", vs, err)
+	}
+	for i := 0; i < 20; i++ {
+		if vs[i] != 2*(i+1) || itemErrs[i] != nil {
+			t.Errorf("item:%d got v:%d err:%v", i, vs[i], itemErrs[i])
+		}
+	}
+	for i, want := range []error{service.ErrTwoZeroes, ErrInvalidRequest, ErrInvalidRequest, ErrLimitExceeded} {
+		if err := itemErrs[20+i]; !errors.Is(err, want) {
+			t.Errorf("item:%d got err:%v want:%v", 20+i, err, want)
+		}
+	}
+	if svc.max > 4 || svc.max < 2 {
+		t.Errorf("got max concurrency:%d", svc.max)
+	}
+
+	// ctx结束后不再计算
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, itemErrs, _ = eps.BatchSum(ctx, items[:2])
+	if errs.KindOf(itemErrs[0]) != errs.KindInternal || errs.CodeOf(itemErrs[0]) != int(resultcode.RESULT_CODE_RET_SYS_ERR) {
+		t.Errorf("got err:%v", itemErrs[0])
+	}
+
+	if _, _, err := (AddSvcEndpoints{}).BatchSum(context.Background(), items); err != ErrBatchUnsupported {
+		t.Errorf("got err:%v", err)
+	}
+}
+
+// 整个batch经过中间件：项数的校验失败时整批失败
+func TestBatchSumInstalled(t *testing.T) {
+	logger := log.NewNopLogger()
+	eps := New(service.NewBasicService(logger), logger, stdopentracing.NoopTracer{}, Deps{})
+	if vs, _, err := eps.BatchSum(context.Background(), []*SumRequest{{A: 1, B: 2}}); err != nil || vs[0] != 3 {
+		t.Errorf("got vs:%v err:%v", vs, err)
+	}
+	for _, n := range []int{0, 101} {
+		if _, _, err := eps.BatchSum(context.Background(), make([]*SumRequest, n)); !errors.Is(err, ErrInvalidRequest) {
+			t.Errorf("items:%d got err:%v", n, err)
+		}
+	}
+}
+
+func TestNewWithNilMetrics(t *testing.T) {
+	logger := log.NewNopLogger()
+	eps := New(service.New(logger, nil, nil, nil, nil), logger, stdopentracing.NoopTracer{}, Deps{})
+	if v, err := eps.Sum(context.Background(), 1, 2); err != nil || v != 3 {
+		t.Errorf("got v:%d err:%v", v, err)
+	}
+}
+
+// 注入的错误经过断路器、ErrorsMiddleware等返回给调用方，可重试
+func TestChaosInstalled(t *testing.T) {
+	if err := DefaultChaos.Set(map[string]chaos.Fault{"Sum": {ErrorRate: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	defer DefaultChaos.Set(nil)
+	logger := log.NewNopLogger()
+	eps := New(service.NewBasicService(logger), logger, stdopentracing.NoopTracer{}, Deps{})
+	if _, err := eps.Sum(context.Background(), 1, 2); errs.KindOf(err) != errs.KindUnavailable || !errs.IsRetryable(err) {
+		t.Errorf("Sum got err:%v", err)
+	}
+	if v, err := eps.Concat(context.Background(), "a", "b"); err != nil || v != "ab" {
+		t.Errorf("Concat got v:%s err:%v", v, err)
+	}
+}
+
+type labelCounter struct{ labels []string }
+
+func (c *labelCounter) With(lvs ...string) metrics.Counter {
+	c.labels = append(c.labels, lvs...)
+	return c
+}
+func (c *labelCounter) Add(float64) {}
+
+// 注入的panic被endpoint层recover，返回errs.Internal并计数，不会导致进程退出
+func TestPanicRecovered(t *testing.T) {
+	if err := DefaultChaos.Set(map[string]chaos.Fault{"Sum": {PanicRate: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	defer DefaultChaos.Set(nil)
+	logger := log.NewNopLogger()
+	panics := &labelCounter{}
+	eps := New(service.NewBasicService(logger), logger, stdopentracing.NoopTracer{}, Deps{Panics: panics})
+	if _, err := eps.Sum(context.Background(), 1, 2); errs.KindOf(err) != errs.KindInternal {
+		t.Errorf("Sum got err:%v", err)
+	}
+	if want := []string{"layer", "endpoint", "method", "Sum"}; !reflect.DeepEqual(panics.labels, want) {
+		t.Errorf("got labels:%v", panics.labels)
+	}
+}
+
+// 功能开关按subject计算，service层据此改变Concat的行为
+func TestFeatureFlagInstalled(t *testing.T) {
+	if err := DefaultFlags.Set(map[string]featureflag.Flag{service.FlagConcatSeparator: {Enabled: true, Users: []string{"alice"}}}); err != nil {
+		t.Fatal(err)
+	}
+	defer DefaultFlags.Set(nil)
+	logger := log.NewNopLogger()
+	eps := New(service.NewBasicService(logger), logger, stdopentracing.NoopTracer{}, Deps{})
+	for subject, want := range map[string]string{"alice": "a-b", "bob": "ab", "": "ab"} {
+		if v, err := eps.Concat(featureflag.WithSubject(context.Background(), subject), "a", "b"); err != nil || v != want {
+			t.Errorf("subject:%q got v:%s err:%v want:%s", subject, v, err, want)
+		}
+	}
+	// 分隔符计入长度限制
+	if _, err := eps.Concat(featureflag.WithSubject(context.Background(), "alice"), "01234", "56789"); !errors.Is(err, service.ErrMaxSizeExceeded) {
+		t.Errorf("got err:%v want ErrMaxSizeExceeded", err)
+	}
+}
+
+// Add时记录labels
+type addedCounter struct {
+	lvs   []string
+	added *[]string
+}
+
+func (c addedCounter) With(lvs ...string) metrics.Counter {
+	return addedCounter{lvs: append(c.lvs[:len(c.lvs):len(c.lvs)], lvs...), added: c.added}
+}
+func (c addedCounter) Add(float64) { *c.added = append(*c.added, strings.Join(c.lvs, ",")) }
+
+// 剩余时间少于config中的deadlines.Min时在endpoint层直接拒绝，不调用service
+func TestDeadlineInstalled(t *testing.T) {
+	logger := log.NewNopLogger()
+	var added []string
+	eps := New(service.NewBasicService(logger), logger, stdopentracing.NoopTracer{}, Deps{DeadlineExceeded: addedCounter{added: &added}})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if _, err := eps.Sum(ctx, 1, 2); err != deadline.ErrBudgetExhausted {
+		t.Errorf("Sum got err:%v", err)
+	}
+	// 没有deadline时使用默认超时
+	if v, err := eps.Sum(context.Background(), 1, 2); err != nil || v != 3 {
+		t.Errorf("Sum got v:%d err:%v", v, err)
+	}
+	if want := []string{"method,Sum,stage,rejected"}; !reflect.DeepEqual(added, want) {
+		t.Errorf("got added:%v", added)
+	}
+}
+
+// 资源超限时拒绝critical以外的请求
+func TestResourceGuardInstalled(t *testing.T) {
+	logger := log.NewNopLogger()
+	// 测试进程的goroutine一定超过1个
+	guard := resguard.New(func() resguard.Config {
+		return resguard.Config{MaxGoroutines: 1, Actions: []resguard.Action{resguard.ActionReject}}
+	}, logger, nil, resguard.Metrics{})
+	eps := New(service.NewBasicService(logger), logger, stdopentracing.NoopTracer{}, Deps{ResGuard: guard})
+	if v, err := eps.Sum(context.Background(), 1, 2); err != nil || v != 3 {
+		t.Fatalf("Sum got v:%d err:%v", v, err)
+	}
+	guard.Check()
+	if _, err := eps.Sum(context.Background(), 1, 2); !errors.Is(err, resguard.ErrOverLimit) || !errs.IsRetryable(err) {
+		t.Errorf("Sum got err:%v", err)
+	}
+	if v, err := eps.Sum(loadshed.WithPriority(context.Background(), loadshed.PriorityCritical), 1, 2); err != nil || v != 3 {
+		t.Errorf("critical Sum got v:%d err:%v", v, err)
+	}
+}
+
+// v2与v1共用service，Sum实现service时溢出返回ErrSumOverflow，SumOverflow可以选择饱和
+func TestNewV2(t *testing.T) {
+	logger := log.NewNopLogger()
+	eps := NewV2(service.NewBasicService(logger), logger, stdopentracing.NoopTracer{}, Deps{})
+	if _, err := eps.Sum(context.Background(), math.MaxInt, 1); err != service.ErrSumOverflow {
+		t.Errorf("sum got err:%v", err)
+	}
+	v, saturated, err := eps.SumOverflow(context.Background(), math.MinInt64, -1, addsvcv2pb.Overflow_OVERFLOW_SATURATE)
+	if err != nil || v != math.MinInt64 || !saturated {
+		t.Errorf("sum overflow got v:%d saturated:%v err:%v", v, saturated, err)
+	}
+	if v, err := eps.Concat(context.Background(), "a", "b"); err != nil || v != "ab" {
+		t.Errorf("concat got v:%s err:%v", v, err)
+	}
+}
@@ -0,0 +1,674 @@
+package endpoint
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/ratelimit"
+	"github.com/go-kit/kit/tracing/opentracing"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	log2 "github.com/opentracing/opentracing-go/log"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+	"github.com/sony/gobreaker"
+	"go.opentelemetry.io/otel/api/trace"
+	"go.opentelemetry.io/otel/api/trace/tracetest"
+	"gokit_foundation/auth"
+	"gokit_foundation/cache"
+	"gokit_foundation/clock"
+	"gokit_foundation/errs"
+	"gokit_foundation/i18n"
+	"gokit_foundation/otel"
+	"new_addsvc/config"
+	"new_addsvc/pb/gen-go/resultcode"
+	"new_addsvc/pkg/service"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestValidationMiddleware(t *testing.T) {
+	called := false
+	ep := ValidationMiddleware()(func(ctx context.Context, request interface{}) (interface{}, error) {
+		called = true
+		return &ConcatResponse{}, nil
+	})
+
+	test := []struct {
+		name       string
+		req        interface{}
+		wantFields map[string]string
+	}{
+		{name: "[valid concat]", req: &ConcatRequest{A: "a"}},
+		{name: "[valid sum]", req: &SumRequest{}},
+		{name: "[not struct]", req: "x"},
+		{name: "[invalid concat]", req: &ConcatRequest{}, wantFields: map[string]string{
+			"a": "required when b is empty",
+			"b": "required when a is empty",
+		}},
+		{name: "[concat too long]", req: &ConcatRequest{A: "a", B: "12345678901"}, wantFields: map[string]string{
+			"b": "length must be at most 10",
+		}},
+		{name: "[sum out of range]", req: &SumRequest{A: 1 << 53, B: -1 << 53}, wantFields: map[string]string{
+			"a": "must be at most 9007199254740991",
+			"b": "must be at least -9007199254740991",
+		}},
+		{name: "[custom rule]", req: &customReq{}, wantFields: map[string]string{"x": "custom"}},
+	}
+	for _, tt := range test {
+		called = false
+		_, err := ep(context.Background(), tt.req)
+		if tt.wantFields == nil {
+			if err != nil || !called {
+				t.Errorf("name:%s got err:%v called:%v", tt.name, err, called)
+			}
+			continue
+		}
+		if !errors.Is(err, ErrInvalidRequest) {
+			t.Fatalf("name:%s want ErrInvalidRequest, got err:%v", tt.name, err)
+		}
+		if called {
+			t.Errorf("name:%s next endpoint should not be called", tt.name)
+		}
+		got, _ := json.Marshal(errs.From(err).Details)
+		want, _ := json.Marshal(tt.wantFields)
+		if string(got) != string(want) {
+			t.Errorf("name:%s got json:%s want:%s", tt.name, got, want)
+		}
+	}
+}
+
+func TestValidationMiddlewareI18n(t *testing.T) {
+	ep := i18n.Middleware(DefaultMessages)(ValidationMiddleware()(func(ctx context.Context, request interface{}) (interface{}, error) {
+		return &ConcatResponse{}, nil
+	}))
+	test := []struct {
+		accept     string
+		req        interface{}
+		wantMsg    string
+		wantFields map[string]string
+	}{
+		{accept: "zh-CN,zh;q=0.9", req: &ConcatRequest{}, wantMsg: "请求参数不合法", wantFields: map[string]string{
+			"a": "b为空时不能为空",
+			"b": "a为空时不能为空",
+		}},
+		{accept: "zh", req: &ConcatRequest{A: "a", B: "12345678901"}, wantMsg: "请求参数不合法", wantFields: map[string]string{
+			"b": "长度不能大于10",
+		}},
+		// requestValidator的描述没有规则，保持原样
+		{accept: "zh-CN", req: &customReq{}, wantMsg: "请求参数不合法", wantFields: map[string]string{"x": "custom"}},
+		// 没有对应的语言时保持原来的描述
+		{accept: "fr", req: &ConcatRequest{}, wantMsg: ErrInvalidRequest.Msg, wantFields: map[string]string{
+			"a": "required when b is empty",
+			"b": "required when a is empty",
+		}},
+	}
+	for _, tt := range test {
+		_, err := ep(i18n.WithAcceptLanguage(context.Background(), tt.accept), tt.req)
+		if e := errs.From(err); !errors.Is(err, ErrInvalidRequest) || e.Msg != tt.wantMsg || !reflect.DeepEqual(e.Details, tt.wantFields) {
+			t.Errorf("accept:%s got err:%v details:%v", tt.accept, err, e.Details)
+		}
+	}
+}
+
+func TestLimitsMiddleware(t *testing.T) {
+	limits := config.Limits{}
+	ep := LimitsMiddleware(func() config.Limits { return limits })(func(ctx context.Context, request interface{}) (interface{}, error) {
+		return &SumResponse{}, nil
+	})
+	// 未配置时不限制
+	if _, err := ep(context.Background(), &SumRequest{A: 1 << 50}); err != nil {
+		t.Fatalf("got err:%v", err)
+	}
+
+	limits = config.Limits{MaxOperand: 100, MaxStrLen: 3}
+	test := []struct {
+		name       string
+		req        interface{}
+		wantFields map[string]string
+	}{
+		{name: "[sum ok]", req: &SumRequest{A: 100, B: -100}},
+		{name: "[sum too large]", req: &SumRequest{A: 101, B: -101}, wantFields: map[string]string{
+			"a": "magnitude must be at most 100",
+			"b": "magnitude must be at most 100",
+		}},
+		{name: "[concat ok]", req: &ConcatRequest{A: "abc", B: "d"}},
+		{name: "[concat too long]", req: &ConcatRequest{A: "abcd", B: "d"}, wantFields: map[string]string{"a": "length must be at most 3"}},
+		{name: "[no limits]", req: &BatchSumRequest{Items: []*SumRequest{{A: 1000}}}},
+	}
+	for _, tt := range test {
+		_, err := ep(context.Background(), tt.req)
+		if tt.wantFields == nil {
+			if err != nil {
+				t.Errorf("name:%s got err:%v", tt.name, err)
+			}
+			continue
+		}
+		if e := errs.From(err); err == nil || e.Msg != ErrLimitExceeded.Msg || !errors.Is(err, ErrInvalidRequest) ||
+			!reflect.DeepEqual(e.Details, tt.wantFields) {
+			t.Errorf("name:%s got err:%v details:%v", tt.name, err, e.Details)
+		}
+	}
+}
+
+// 实现requestValidator接口的request
+type customReq struct{}
+
+func (customReq) Validate() map[string]string {
+	return map[string]string{"x": "custom"}
+}
+
+func TestSpanTagsMiddleware(t *testing.T) {
+	tracer := mocktracer.New()
+	ep := opentracing.TraceServer(tracer, "Sum")(SpanTagsMiddleware()(func(ctx context.Context, request interface{}) (interface{}, error) {
+		return &SumResponse{RetCode: resultcode.RESULT_CODE_RET_OVERFLOW}, nil
+	}))
+	if _, err := ep(context.Background(), &SumRequest{A: 1, B: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := tracer.FinishedSpans()
+	if len(spans) != 1 {
+		t.Fatalf("want 1 span, got %d", len(spans))
+	}
+	tags := spans[0].Tags()
+	if tags["sum.a"] != 1 || tags["sum.b"] != 2 {
+		t.Errorf("got tags:%v", tags)
+	}
+	logs := spans[0].Logs()
+	if len(logs) != 1 || logs[0].Fields[0].Key != "ret_code" ||
+		logs[0].Fields[0].ValueString != resultcode.RESULT_CODE_RET_OVERFLOW.String() {
+		t.Errorf("got logs:%v", logs)
+	}
+}
+
+// noop span(Tracer()为NoopTracer)，记录SetTag/LogFields/LogKV的调用次数
+type recordNoopSpan struct {
+	stdopentracing.Span
+	calls int
+}
+
+func (s *recordNoopSpan) SetTag(key string, value interface{}) stdopentracing.Span {
+	s.calls++
+	return s
+}
+
+func (s *recordNoopSpan) LogFields(fields ...log2.Field) {
+	s.calls++
+}
+
+func (s *recordNoopSpan) LogKV(alternatingKeyValues ...interface{}) {
+	s.calls++
+}
+
+// tracer为NoopTracer时不设置标签，response和err原样返回，nil response也不会panic
+func TestSpanTagsMiddlewareNoopTracer(t *testing.T) {
+	span := &recordNoopSpan{Span: stdopentracing.NoopTracer{}.StartSpan("Sum")}
+	ctx := stdopentracing.ContextWithSpan(context.Background(), span)
+
+	want := &SumResponse{V: 3, RetCode: resultcode.RESULT_CODE_RET_OVERFLOW}
+	ep := SpanTagsMiddleware()(func(ctx context.Context, request interface{}) (interface{}, error) {
+		return want, nil
+	})
+	if rsp, err := ep(ctx, &SumRequest{A: 1, B: 2}); err != nil || rsp != want {
+		t.Errorf("got rsp:%v err:%v", rsp, err)
+	}
+
+	errNext := errors.New("next failed")
+	ep = SpanTagsMiddleware()(func(ctx context.Context, request interface{}) (interface{}, error) {
+		return nil, errNext
+	})
+	if rsp, err := ep(ctx, &SumRequest{A: 1, B: 2}); err != errNext || rsp != nil {
+		t.Errorf("nil response got rsp:%v err:%v", rsp, err)
+	}
+	if span.calls != 0 {
+		t.Errorf("noop span got %d SetTag/LogFields/LogKV calls", span.calls)
+	}
+}
+
+func TestMaxInFlightMiddleware(t *testing.T) {
+	const n = 3
+	release := make(chan struct{})
+	started := make(chan struct{})
+	ep := MaxInFlightMiddleware(n)(func(ctx context.Context, request interface{}) (interface{}, error) {
+		if request == "panic" {
+			panic("endpoint panic")
+		}
+		started <- struct{}{}
+		<-release
+		return nil, nil
+	})
+
+	// 占满n个
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := ep(context.Background(), nil); err != nil {
+				t.Error(err)
+			}
+		}()
+		<-started
+	}
+	if _, err := ep(context.Background(), nil); err != ErrTooManyRequests {
+		t.Errorf("the %dth call want ErrTooManyRequests, got err:%v", n+1, err)
+	}
+	close(release)
+	wg.Wait()
+
+	// panic时也要释放占用
+	for i := 0; i < n+1; i++ {
+		func() {
+			defer func() { recover() }()
+			_, _ = ep(context.Background(), "panic")
+		}()
+	}
+	go func() { <-started }()
+	if _, err := ep(context.Background(), nil); err != nil {
+		t.Errorf("slots not released after panic, got err:%v", err)
+	}
+
+	// n<=0时不限制
+	for _, n := range []int{0, -1} {
+		ep := MaxInFlightMiddleware(n)(func(ctx context.Context, request interface{}) (interface{}, error) { return nil, nil })
+		if _, err := ep(context.Background(), nil); err != nil {
+			t.Errorf("n:%d got err:%v", n, err)
+		}
+	}
+}
+
+func TestACLMiddleware(t *testing.T) {
+	rules := map[string]config.ACLRule{
+		"Concat": {Allow: []string{"admin", "user"}, Deny: []string{"guest"}},
+	}
+	next := func(ctx context.Context, request interface{}) (interface{}, error) {
+		return &ConcatResponse{}, nil
+	}
+	concat := ACLMiddleware(rules, "Concat")(next)
+	sum := ACLMiddleware(rules, "Sum")(next)
+
+	test := []struct {
+		name    string
+		ep      endpoint.Endpoint
+		role    string
+		wantErr error
+	}{
+		{name: "[allowed role]", ep: concat, role: "admin"},
+		{name: "[denied role]", ep: concat, role: "guest", wantErr: ErrForbidden},
+		{name: "[role not in allow]", ep: concat, role: "other", wantErr: ErrForbidden},
+		{name: "[missing role]", ep: concat, wantErr: ErrForbidden},
+		{name: "[method without rule]", ep: sum},
+	}
+	for _, tt := range test {
+		ctx := context.Background()
+		if tt.role != "" {
+			ctx = WithRole(ctx, tt.role)
+		}
+		_, err := tt.ep(ctx, &ConcatRequest{A: "a"})
+		if err != tt.wantErr {
+			t.Errorf("name:%s got err:%v want:%v", tt.name, err, tt.wantErr)
+		}
+	}
+	if code := service.ErrorToRetCode(ErrForbidden); code != int(resultcode.RESULT_CODE_RET_FORBIDDEN) {
+		t.Errorf("ErrForbidden got RetCode:%d", code)
+	}
+}
+
+func TestAuthMiddlewareWithACL(t *testing.T) {
+	os.Setenv("AUTH_MW_TEST_KEY", "secret")
+	defer os.Unsetenv("AUTH_MW_TEST_KEY")
+	conf := config.AuthConf{Enable: true, KeyEnv: "AUTH_MW_TEST_KEY", Issuer: "addsvc"}
+	rules := map[string]config.ACLRule{"Concat": {Allow: []string{"admin"}}}
+	next := func(ctx context.Context, request interface{}) (interface{}, error) {
+		return &ConcatResponse{}, nil
+	}
+	ep := AuthMiddleware(conf, "Concat")(ACLMiddleware(rules, "Concat")(next))
+
+	genToken := func(role string) string {
+		s, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"iss": "addsvc", "role": role}).SignedString([]byte("secret"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	test := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{name: "[admin]", token: genToken("admin")},
+		{name: "[user]", token: genToken("user"), wantErr: ErrForbidden},
+		{name: "[no token]", wantErr: auth.ErrTokenMissing},
+	}
+	for _, tt := range test {
+		ctx := context.Background()
+		if tt.token != "" {
+			ctx = auth.WithToken(ctx, tt.token)
+		}
+		_, err := ep(ctx, &ConcatRequest{A: "a"})
+		if err != tt.wantErr {
+			t.Errorf("name:%s got err:%v want:%v", tt.name, err, tt.wantErr)
+		}
+	}
+
+	// 关闭时不做认证
+	if _, err := AuthMiddleware(config.AuthConf{}, "Concat")(next)(context.Background(), &ConcatRequest{}); err != nil {
+		t.Errorf("disabled auth got err:%v", err)
+	}
+}
+
+func TestAuthMiddlewareWithAuthz(t *testing.T) {
+	os.Setenv("AUTH_MW_TEST_KEY", "secret")
+	defer os.Unsetenv("AUTH_MW_TEST_KEY")
+	authConf := config.AuthConf{Enable: true, KeyEnv: "AUTH_MW_TEST_KEY", Issuer: "addsvc"}
+	authzConf := config.AuthzConf{Enable: true, Roles: map[string][]string{"admin": {"addsvc.*:invoke"}}}
+	next := func(ctx context.Context, request interface{}) (interface{}, error) {
+		return &ConcatResponse{}, nil
+	}
+	buf := &bytes.Buffer{}
+	ep := AuthMiddleware(authConf, "Concat")(AuthzMiddleware(authzConf, "Concat", log.NewLogfmtLogger(buf))(next))
+
+	genToken := func(claims jwt.MapClaims) string {
+		claims["iss"] = "addsvc"
+		s, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	test := []struct {
+		name   string
+		claims jwt.MapClaims
+		denied bool
+	}{
+		{name: "[admin]", claims: jwt.MapClaims{"sub": "jack", "role": "admin"}},
+		{name: "[scope]", claims: jwt.MapClaims{"sub": "rose", "scope": "addsvc.concat:invoke"}},
+		{name: "[user]", claims: jwt.MapClaims{"sub": "tom", "role": "user", "scope": "addsvc.sum:invoke"}, denied: true},
+	}
+	for _, tt := range test {
+		buf.Reset()
+		_, err := ep(auth.WithToken(context.Background(), genToken(tt.claims)), &ConcatRequest{A: "a"})
+		if tt.denied != (errs.KindOf(err) == errs.KindForbidden) || !tt.denied && err != nil {
+			t.Errorf("name:%s got err:%v", tt.name, err)
+		}
+		if tt.denied != strings.Contains(buf.String(), "decision=deny method=Concat permission=addsvc.concat:invoke subject="+tt.claims["sub"].(string)) {
+			t.Errorf("name:%s got audit log:%s", tt.name, buf.String())
+		}
+	}
+
+	// 关闭时不做授权
+	if _, err := AuthzMiddleware(config.AuthzConf{}, "Concat", log.NewNopLogger())(next)(context.Background(), &ConcatRequest{}); err != nil {
+		t.Errorf("disabled authz got err:%v", err)
+	}
+}
+
+func TestTimeoutMiddleware(t *testing.T) {
+	conf := map[string]time.Duration{"Sum": time.Second}
+	ep := TimeoutMiddleware("Sum", func(method string) (time.Duration, bool) {
+		d, ok := conf[method]
+		return d, ok
+	})(func(ctx context.Context, request interface{}) (interface{}, error) {
+		deadline, ok := ctx.Deadline()
+		if !ok {
+			return time.Duration(0), nil
+		}
+		return time.Until(deadline), nil
+	})
+
+	left, _ := ep(context.Background(), nil)
+	if d := left.(time.Duration); d <= 500*time.Millisecond || d > time.Second {
+		t.Errorf("got deadline after:%v want about 1s", d)
+	}
+	// 每次调用都读取配置，修改后立即生效
+	conf["Sum"] = 100 * time.Millisecond
+	left, _ = ep(context.Background(), nil)
+	if d := left.(time.Duration); d <= 0 || d > 100*time.Millisecond {
+		t.Errorf("got deadline after:%v want about 100ms", d)
+	}
+	// 外层的deadline更早时保持不变，更晚时缩短为超时
+	early, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if left, _ = ep(early, nil); left.(time.Duration) > 50*time.Millisecond {
+		t.Errorf("earlier deadline got deadline after:%v", left)
+	}
+	late, cancel2 := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel2()
+	if left, _ = ep(late, nil); left.(time.Duration) > 100*time.Millisecond {
+		t.Errorf("later deadline got deadline after:%v want about 100ms", left)
+	}
+	delete(conf, "Sum")
+	if left, _ = ep(context.Background(), nil); left.(time.Duration) != 0 {
+		t.Errorf("unconfigured method got deadline after:%v", left)
+	}
+}
+
+func TestRateLimiters(t *testing.T) {
+	conf := map[string]config.RateLimit{"Sum": {RPS: 1, Burst: 2}}
+	now := clock.NewFake(time.Now())
+	rl := NewRateLimiters(func(method string) (config.RateLimit, bool) {
+		r, ok := conf[method]
+		return r, ok
+	}, RateLimitersClock(now))
+	next := func(ctx context.Context, request interface{}) (interface{}, error) {
+		return nil, nil
+	}
+	sum := rl.Middleware("Sum")(next)
+	concat := rl.Middleware("Concat")(next)
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		_, err := sum(ctx, nil)
+		if i < 2 && err != nil {
+			t.Fatalf("call %d within burst got err:%v", i, err)
+		}
+		if i == 2 && err != ratelimit.ErrLimited {
+			t.Fatalf("call %d want ErrLimited, got err:%v", i, err)
+		}
+		// 未配置的接口不限速
+		if _, err = concat(ctx, nil); err != nil {
+			t.Fatalf("concat got err:%v", err)
+		}
+	}
+
+	states := rl.States()
+	if st := states["Sum"]; st.Limit != 1 || st.Burst != 2 || st.Allowed != 2 || st.Rejected != 1 {
+		t.Errorf("Sum state got:%+v", st)
+	}
+	if st := states["Concat"]; !st.Unlimited || st.Allowed != 3 {
+		t.Errorf("Concat state got:%+v", st)
+	}
+
+	// 时间不变时不会补充令牌，1s后补充1个
+	if _, err := sum(ctx, nil); err != ratelimit.ErrLimited {
+		t.Errorf("got err:%v want ErrLimited", err)
+	}
+	now.Advance(time.Second)
+	if _, err := sum(ctx, nil); err != nil {
+		t.Errorf("after 1s got err:%v", err)
+	}
+	if _, err := sum(ctx, nil); err != ratelimit.ErrLimited {
+		t.Errorf("got err:%v want ErrLimited", err)
+	}
+}
+
+// 记录Set过的值，With返回自身
+type recordGauge struct {
+	mu     sync.Mutex
+	lvs    []string
+	values []float64
+}
+
+func (g *recordGauge) With(labelValues ...string) metrics.Gauge {
+	g.lvs = append(g.lvs, labelValues...)
+	return g
+}
+
+func (g *recordGauge) Set(value float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.values = append(g.values, value)
+}
+
+func (g *recordGauge) Add(delta float64) {}
+
+func TestBreakerMiddleware(t *testing.T) {
+	confs := map[string]config.BreakerConf{"Concat": {ConsecutiveFailures: 2, Timeout: 50 * time.Millisecond}}
+	buf := &bytes.Buffer{}
+	gauge := &recordGauge{}
+	fail := true
+	ep := BreakerMiddleware(confs, "Concat", log.NewLogfmtLogger(buf), gauge)(func(ctx context.Context, request interface{}) (interface{}, error) {
+		if fail {
+			return nil, errors.New("downstream failed")
+		}
+		return &ConcatResponse{}, nil
+	})
+
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if _, err := ep(ctx, nil); err == nil || err == gobreaker.ErrOpenState {
+			t.Fatalf("call %d got err:%v", i, err)
+		}
+	}
+	if _, err := ep(ctx, nil); err != gobreaker.ErrOpenState {
+		t.Fatalf("want ErrOpenState, got err:%v", err)
+	}
+
+	// Timeout后进入半开状态，成功一次后关闭
+	fail = false
+	time.Sleep(60 * time.Millisecond)
+	if _, err := ep(ctx, nil); err != nil {
+		t.Fatalf("half-open call got err:%v", err)
+	}
+
+	if strings.Join(gauge.lvs, ",") != "method,Concat" {
+		t.Errorf("got label values:%v", gauge.lvs)
+	}
+	// 初始关闭 -> 打开 -> 半开 -> 关闭
+	want := []float64{0, 2, 1, 0}
+	if fmt.Sprint(gauge.values) != fmt.Sprint(want) {
+		t.Errorf("got state values:%v want:%v", gauge.values, want)
+	}
+	for _, s := range []string{"from=closed to=open", "from=open to=half-open", "from=half-open to=closed"} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("log %q not found in:%s", s, buf.String())
+		}
+	}
+
+	// 未配置的接口不安装断路器
+	sum := BreakerMiddleware(confs, "Sum", log.NewNopLogger(), nil)(func(ctx context.Context, request interface{}) (interface{}, error) {
+		return nil, errors.New("downstream failed")
+	})
+	for i := 0; i < 5; i++ {
+		if _, err := sum(ctx, nil); err == gobreaker.ErrOpenState {
+			t.Fatal("breaker installed for method without conf")
+		}
+	}
+}
+
+type mapStore struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+func (s *mapStore) Get(_ context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if b, ok := s.data[key]; ok {
+		return b, nil
+	}
+	return nil, cache.ErrMiss
+}
+
+func (s *mapStore) Set(_ context.Context, key string, value []byte, _ time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[key] = value
+	return nil
+}
+
+func TestCacheMiddleware(t *testing.T) {
+	var calls int
+	next := func(_ context.Context, request interface{}) (interface{}, error) {
+		calls++
+		req := request.(*ConcatRequest)
+		if req.A == "bad" {
+			return &ConcatResponse{RetCode: resultcode.RESULT_CODE_RET_INVALID_INPUT}, nil
+		}
+		return &ConcatResponse{V: req.A + req.B}, nil
+	}
+	store := &mapStore{data: map[string][]byte{}}
+	ttls := map[string]time.Duration{"Concat": time.Minute}
+	newResponse := func() interface{} { return new(ConcatResponse) }
+
+	ep := CacheMiddleware(store, ttls, "Concat", newResponse, log.NewNopLogger(), nil)(next)
+	for i := 0; i < 2; i++ {
+		rsp, err := ep(context.Background(), &ConcatRequest{A: "x", B: "y"})
+		if err != nil || rsp.(*ConcatResponse).V != "xy" {
+			t.Fatalf("#%d got rsp:%+v err:%v", i, rsp, err)
+		}
+		// 业务错误不缓存
+		_, _ = ep(context.Background(), &ConcatRequest{A: "bad"})
+	}
+	if calls != 3 || len(store.data) != 1 {
+		t.Errorf("got calls:%d cached:%d", calls, len(store.data))
+	}
+	for k := range store.data {
+		if !strings.HasPrefix(k, config.SvcName+":cache:Concat:") {
+			t.Errorf("got key:%s", k)
+		}
+	}
+
+	// 未配置缓存时间的接口或没有store时不缓存
+	calls = 0
+	for _, ep := range []endpoint.Endpoint{
+		CacheMiddleware(store, ttls, "Sum", newResponse, log.NewNopLogger(), nil)(next),
+		CacheMiddleware(nil, ttls, "Concat", newResponse, log.NewNopLogger(), nil)(next),
+	} {
+		_, _ = ep(context.Background(), &ConcatRequest{A: "x", B: "y"})
+	}
+	if calls != 2 {
+		t.Errorf("got calls:%d want 2", calls)
+	}
+}
+
+// 监控mw在tracing mw外层，耗时的exemplar为内层创建的server span的trace id
+func TestInstrumentingMiddlewareExemplar(t *testing.T) {
+	reg := stdprometheus.NewRegistry()
+	hv := stdprometheus.NewHistogramVec(stdprometheus.HistogramOpts{Name: "duration"}, []string{"method", "success"})
+	reg.MustRegister(hv)
+
+	tracer := &tracetest.MockTracer{Sampled: true, StartSpanID: new(uint64)}
+	var traceID string
+	ep := InstrumentingMiddleware(otel.NewHistogram(hv).With("method", "Sum"))(otel.TraceServer(tracer, "Sum")(
+		func(ctx context.Context, request interface{}) (interface{}, error) {
+			traceID = trace.SpanFromContext(ctx).SpanContext().TraceID.String()
+			return nil, nil
+		}))
+	if _, err := ep(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, b := range mfs[0].GetMetric()[0].GetHistogram().GetBucket() {
+		if e := b.GetExemplar(); e != nil {
+			got = append(got, e.GetLabel()[0].GetValue())
+		}
+	}
+	if len(got) != 1 || got[0] != traceID {
+		t.Errorf("want exemplar %s, got %v", traceID, got)
+	}
+}
@@ -0,0 +1,35 @@
+package service
+
+import (
+	"context"
+	"gokit_foundation/blobstore"
+	"gokit_foundation/errs"
+	"gokit_foundation/logging"
+	"io"
+)
+
+/*
+大文件上传示例：body为流(grpc的数据块、http的chunked body)，不适合Service的一元接口(request整个解码后再调用)，所以单独定义
+-	body按需读取，存储(见blobstore.Store)写完一块才读下一块，transport的接收随之变慢，即背压
+-	大小限制、client声明的size和sha256由blobstore.Uploader检查，失败时不留下不完整的blob
+*/
+type BlobService interface {
+	// Upload size、sha256为client声明的大小和校验和(hex)，为0或空时不检查
+	Upload(ctx context.Context, name string, body io.Reader, size int64, sha256 string) (blobstore.Info, error)
+}
+
+func NewBlobService(uploader *blobstore.Uploader) BlobService {
+	return blobService{uploader}
+}
+
+type blobService struct {
+	uploader *blobstore.Uploader
+}
+
+func (s blobService) Upload(ctx context.Context, name string, body io.Reader, size int64, sha256 string) (info blobstore.Info, err error) {
+	logger := logging.FromContext(ctx)
+	defer func() {
+		logger.Log(append([]interface{}{"name", name, "size", info.Size, "sha256", info.SHA256}, errs.LogKeyvals(err)...)...)
+	}()
+	return s.uploader.Upload(ctx, name, body, size, sha256)
+}
@@ -0,0 +1,51 @@
+package service
+
+import "gokit_foundation/errs"
+
+/*
+service层的业务错误统一使用errs.Error定义(见gokit_foundation/errs)，Code会被endpoint层映射为response.RetCode
+Code是与client之间的稳定约定，一旦定义就不要修改其含义，需与resultcode.proto保持一致
+*/
+const (
+	CodeOK      = 0
+	CodeUnknown = 5 // 没有Code的err，即意料之外的err
+
+	CodeInvalidArgs = 101 // 参数校验失败，见endpoint.ValidationMiddleware
+
+	// 1001...
+	CodeInvalidInput = 1001
+	CodeOverflow     = 1002
+	CodeForbidden    = 1003
+)
+
+// 每个Code对应的错误类别，client将RetCode还原为err时使用(见ErrorFromRetCode)
+var codeKinds = map[int]errs.Kind{
+	CodeInvalidArgs:  errs.KindInvalid,
+	CodeInvalidInput: errs.KindInvalid,
+	CodeOverflow:     errs.KindInvalid,
+	CodeForbidden:    errs.KindForbidden,
+}
+
+// ErrorToRetCode 统一将service层返回的err转为RetCode
+func ErrorToRetCode(err error) int {
+	if err == nil {
+		return CodeOK
+	}
+	if code := errs.CodeOf(err); code != 0 {
+		return code
+	}
+	return CodeUnknown
+}
+
+// ErrorFromRetCode 是ErrorToRetCode的逆过程，msg一般为RetCode的名称
+// 得到的err与service层返回的err满足errors.Is(Kind和Code相同)
+func ErrorFromRetCode(code int, msg string) error {
+	if code == CodeOK {
+		return nil
+	}
+	kind, ok := codeKinds[code]
+	if !ok {
+		kind = errs.KindInternal
+	}
+	return errs.New(kind, msg).WithCode(code)
+}
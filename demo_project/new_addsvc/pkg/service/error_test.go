@@ -0,0 +1,38 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"math"
+	"testing"
+)
+
+func TestErrorToRetCode(t *testing.T) {
+	svc := NewBasicService(log.NewNopLogger())
+	ctx := context.Background()
+
+	_, errTwoZeroes := svc.Sum(ctx, 0, 0)
+	_, errOverflow := svc.Sum(ctx, math.MaxInt, 1)
+	_, errMaxSize := svc.Concat(ctx, "123456", "789012")
+	_, errNil := svc.Sum(ctx, 1, 2)
+
+	test := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "[nil]", err: errNil, want: CodeOK},
+		{name: "[ErrTwoZeroes]", err: errTwoZeroes, want: CodeInvalidInput},
+		{name: "[ErrSumOverflow]", err: errOverflow, want: CodeOverflow},
+		{name: "[ErrMaxSizeExceeded]", err: errMaxSize, want: CodeInvalidInput},
+		{name: "[wrapped Error]", err: fmt.Errorf("wrap: %w", ErrSumOverflow), want: CodeOverflow},
+		{name: "[unknown err]", err: errors.New("redis: connection refused"), want: CodeUnknown},
+	}
+	for _, tt := range test {
+		if got := ErrorToRetCode(tt.err); got != tt.want {
+			t.Errorf("name:%s got code:%d want code:%d", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"context"
+	"github.com/go-kit/kit/log"
+	"gokit_foundation/events"
+)
+
+// 领域事件的类型，topic映射见config.Bootstrap.KafkaTopics
+const (
+	EventSumComputed    = "SumComputed"
+	EventConcatComputed = "ConcatComputed"
+)
+
+type SumComputed struct {
+	A int `json:"a"`
+	B int `json:"b"`
+	V int `json:"v"`
+}
+
+type ConcatComputed struct {
+	A string `json:"a"`
+	B string `json:"b"`
+	V string `json:"v"`
+}
+
+// 事件mw：调用成功后发布领域事件，发布失败(如缓冲区满)只打印日志，不影响接口返回
+func EventsMiddleware(pub events.Publisher, source string, logger log.Logger) Middleware {
+	return func(next Service) Service {
+		return eventsMiddleware{pub: pub, source: source, logger: logger, next: next}
+	}
+}
+
+type eventsMiddleware struct {
+	pub    events.Publisher
+	source string
+	logger log.Logger
+	next   Service
+}
+
+func (mw eventsMiddleware) publish(ctx context.Context, typ string, payload interface{}) {
+	if err := mw.pub.Publish(ctx, events.Event{Type: typ, Source: mw.source, Payload: payload}); err != nil {
+		mw.logger.Log("eventsMiddleware", "publish failed", "type", typ, "err", err)
+	}
+}
+
+func (mw eventsMiddleware) Sum(ctx context.Context, a, b int) (int, error) {
+	v, err := mw.next.Sum(ctx, a, b)
+	if err == nil {
+		mw.publish(ctx, EventSumComputed, SumComputed{A: a, B: b, V: v})
+	}
+	return v, err
+}
+
+func (mw eventsMiddleware) Concat(ctx context.Context, a, b string) (string, error) {
+	v, err := mw.next.Concat(ctx, a, b)
+	if err == nil {
+		mw.publish(ctx, EventConcatComputed, ConcatComputed{A: a, B: b, V: v})
+	}
+	return v, err
+}
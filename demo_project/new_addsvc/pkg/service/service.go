@@ -2,10 +2,15 @@ package service
 
 import (
 	"context"
-	"errors"
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
 	"github.com/go-redis/redis"
+	"gokit_foundation/errs"
+	"gokit_foundation/events"
+	"gokit_foundation/featureflag"
+	"math"
+	"new_addsvc/config"
 )
 
 type Service interface {
@@ -14,28 +19,36 @@ type Service interface {
 }
 
 // New returns a basic Service with all of the expected middlewares wired in.
-func New(logger log.Logger, redisCli *redis.Client, ints, chars metrics.Counter) Service {
+// pub为nil时不发布领域事件
+func New(logger log.Logger, redisCli *redis.Client, ints, chars metrics.Counter, pub events.Publisher) Service {
+	// 指标为nil(如prometheus不可用)时不上报
+	if ints == nil {
+		ints = discard.NewCounter()
+	}
+	if chars == nil {
+		chars = discard.NewCounter()
+	}
 	var svc Service
 	// 使用洋葱模式封装svc(添加中间件)
 	{
 		svc = NewBasicService(logger)
-		svc = UnifyMiddleware(logger, ints, chars)(svc)
+		if pub != nil {
+			svc = EventsMiddleware(pub, config.SvcName, logger)(svc)
+		}
+		svc = UnifyMiddleware(ints, chars)(svc)
 	}
 	return svc
 }
 
 var (
 	// ErrTwoZeroes is an arbitrary business rule for the Add method.
-	ErrTwoZeroes = errors.New("can't sum two zeroes")
+	ErrTwoZeroes = errs.Invalid("can't sum two zeroes").WithCode(CodeInvalidInput)
 
-	// ErrIntOverflow protects the Add method. We've decided that this error
-	// indicates a misbehaving service and should count against e.g. circuit
-	// breakers. So, we return it directly in endpoints, to illustrate the
-	// difference. In a real service, this probably wouldn't be the case.
-	ErrIntOverflow = errors.New("integer overflow")
+	// ErrSumOverflow protects the Sum method. a+b超出int范围时返回，而不是返回一个溢出回绕后的错误结果
+	ErrSumOverflow = errs.Invalid("integer overflow").WithCode(CodeOverflow)
 
 	// ErrMaxSizeExceeded protects the Concat method.
-	ErrMaxSizeExceeded = errors.New("result exceeds maximum size")
+	ErrMaxSizeExceeded = errs.Invalid("result exceeds maximum size").WithCode(CodeInvalidInput)
 )
 
 // NewBasicService returns a naïve, stateless implementation of Service.
@@ -50,25 +63,33 @@ type basicService struct {
 }
 
 const (
-	intMax = 1<<31 - 1
-	intMin = -(intMax + 1)
 	maxLen = 10
+	// 开启功能开关FlagConcatSeparator时Concat在a、b之间插入的分隔符，计入maxLen
+	concatSeparator = "-"
 )
 
+// 功能开关名，配置见config.Dynamic.FeatureFlags
+const FlagConcatSeparator = "concat_separator"
+
 func (s basicService) Sum(_ context.Context, a, b int) (int, error) {
 	if a == 0 && b == 0 {
 		return 0, ErrTwoZeroes
 	}
-	if (b > 0 && a > (intMax-b)) || (b < 0 && a < (intMin-b)) {
-		return 0, ErrIntOverflow
+	// 有符号整数溢出检测，不能先相加再判断
+	if (b > 0 && a > (math.MaxInt-b)) || (b < 0 && a < (math.MinInt-b)) {
+		return 0, ErrSumOverflow
 	}
 	return a + b, nil
 }
 
 // Concat implements Service.
-func (s basicService) Concat(_ context.Context, a, b string) (string, error) {
-	if len(a)+len(b) > maxLen {
+func (s basicService) Concat(ctx context.Context, a, b string) (string, error) {
+	sep := ""
+	if featureflag.Enabled(ctx, FlagConcatSeparator) {
+		sep = concatSeparator
+	}
+	if len(a)+len(sep)+len(b) > maxLen {
 		return "", ErrMaxSizeExceeded
 	}
-	return a + b, nil
+	return a + sep + b, nil
 }
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+	"github.com/go-kit/kit/log"
+	"gokit_foundation/events"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestSumOverflow(t *testing.T) {
+	svc := NewBasicService(log.NewNopLogger())
+
+	test := []struct {
+		name    string
+		a, b    int
+		want    int
+		wantErr error
+	}{
+		{name: "[MaxInt+1]", a: math.MaxInt, b: 1, wantErr: ErrSumOverflow},
+		{name: "[1+MaxInt]", a: 1, b: math.MaxInt, wantErr: ErrSumOverflow},
+		{name: "[MaxInt+MaxInt]", a: math.MaxInt, b: math.MaxInt, wantErr: ErrSumOverflow},
+		{name: "[MinInt-1]", a: math.MinInt, b: -1, wantErr: ErrSumOverflow},
+		{name: "[MaxInt-1]", a: math.MaxInt, b: -1, want: math.MaxInt - 1},
+		{name: "[MaxInt+MinInt]", a: math.MaxInt, b: math.MinInt, want: -1},
+	}
+	for _, tt := range test {
+		v, err := svc.Sum(context.Background(), tt.a, tt.b)
+		if err != tt.wantErr {
+			t.Errorf("name:%s got err:%v want err:%v", tt.name, err, tt.wantErr)
+		}
+		if v != tt.want {
+			t.Errorf("name:%s got v:%d want v:%d", tt.name, v, tt.want)
+		}
+	}
+}
+
+type recordPublisher []events.Event
+
+func (p *recordPublisher) Publish(_ context.Context, e events.Event) error {
+	*p = append(*p, e)
+	return nil
+}
+
+func TestEventsMiddleware(t *testing.T) {
+	pub := &recordPublisher{}
+	svc := EventsMiddleware(pub, "test", log.NewNopLogger())(NewBasicService(log.NewNopLogger()))
+	ctx := context.Background()
+	_, _ = svc.Sum(ctx, 1, 2)
+	_, _ = svc.Concat(ctx, "a", "b")
+	// 失败的调用不发布事件
+	_, _ = svc.Sum(ctx, 0, 0)
+	_, _ = svc.Concat(ctx, "0123456789", "x")
+
+	want := []events.Event{
+		{Type: EventSumComputed, Source: "test", Payload: SumComputed{A: 1, B: 2, V: 3}},
+		{Type: EventConcatComputed, Source: "test", Payload: ConcatComputed{A: "a", B: "b", V: "ab"}},
+	}
+	if !reflect.DeepEqual([]events.Event(*pub), want) {
+		t.Errorf("got events:%+v", *pub)
+	}
+}
@@ -0,0 +1,143 @@
+package servicetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"new_addsvc/pkg/service"
+	"sync"
+	"testing"
+)
+
+/*
+service.Service的测试工具(手写，不依赖mockgen)：
+-	Fake：可替换每个方法的实现并记录调用，用于测试middleware、transport，不需要redis等依赖
+-	Contract：所有实现都必须满足的行为，service层的middleware、endpoint以及各transport的client都应该通过，
+	保证在任意一层之上替换实现(如grpc client替换本地service)时调用方看到的行为不变
+
+Contract只包含经过endpoint层参数校验之后仍然成立的行为(如不测试溢出，validate tag限制了操作数的范围)
+*/
+
+// Fake SumFunc/ConcatFunc为nil时使用service.NewBasicService的实现(满足Contract)
+type Fake struct {
+	SumFunc    func(ctx context.Context, a, b int) (int, error)
+	ConcatFunc func(ctx context.Context, a, b string) (string, error)
+
+	mu    sync.Mutex
+	calls []Call
+}
+
+type Call struct {
+	Method string
+	Args   []interface{}
+}
+
+var basic = service.NewBasicService(log.NewNopLogger())
+
+func (f *Fake) record(method string, args ...interface{}) {
+	f.mu.Lock()
+	f.calls = append(f.calls, Call{Method: method, Args: args})
+	f.mu.Unlock()
+}
+
+func (f *Fake) Sum(ctx context.Context, a, b int) (int, error) {
+	f.record("Sum", a, b)
+	if f.SumFunc != nil {
+		return f.SumFunc(ctx, a, b)
+	}
+	return basic.Sum(ctx, a, b)
+}
+
+func (f *Fake) Concat(ctx context.Context, a, b string) (string, error) {
+	f.record("Concat", a, b)
+	if f.ConcatFunc != nil {
+		return f.ConcatFunc(ctx, a, b)
+	}
+	return basic.Concat(ctx, a, b)
+}
+
+// Calls 按调用顺序返回所有调用
+func (f *Fake) Calls() []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Call(nil), f.calls...)
+}
+
+// CallCount method为空时返回所有方法的调用次数
+func (f *Fake) CallCount(method string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, c := range f.calls {
+		if method == "" || c.Method == method {
+			n++
+		}
+	}
+	return n
+}
+
+// Contract 业务错误需要能用errors.Is识别(见errs.Error.Is)，经过transport后也一样
+func Contract(t *testing.T, svc service.Service) {
+	t.Helper()
+	ctx := context.Background()
+
+	t.Run("Sum", func(t *testing.T) {
+		for _, tt := range []struct{ a, b, want int }{
+			{1, 2, 3},
+			{-5, 3, -2},
+			{0, 7, 7},
+			{1 << 40, 1 << 40, 1 << 41},
+		} {
+			if v, err := svc.Sum(ctx, tt.a, tt.b); err != nil || v != tt.want {
+				t.Errorf("Sum(%d, %d) got v:%d err:%v want %d", tt.a, tt.b, v, err, tt.want)
+			}
+		}
+		if _, err := svc.Sum(ctx, 0, 0); !errors.Is(err, service.ErrTwoZeroes) {
+			t.Errorf("Sum(0, 0) got err:%v want ErrTwoZeroes", err)
+		}
+	})
+
+	t.Run("Concat", func(t *testing.T) {
+		for _, tt := range []struct{ a, b, want string }{
+			{"x", "y", "xy"},
+			{"abc", "", "abc"},
+			{"", "abc", "abc"},
+			{"01234", "56789", "0123456789"},
+		} {
+			if v, err := svc.Concat(ctx, tt.a, tt.b); err != nil || v != tt.want {
+				t.Errorf("Concat(%q, %q) got v:%q err:%v want %q", tt.a, tt.b, v, err, tt.want)
+			}
+		}
+		if _, err := svc.Concat(ctx, "0123456789", "y"); !errors.Is(err, service.ErrMaxSizeExceeded) {
+			t.Errorf("Concat got err:%v want ErrMaxSizeExceeded", err)
+		}
+	})
+
+	// 可以并发调用，结果互不影响
+	t.Run("Concurrent", func(t *testing.T) {
+		var wg sync.WaitGroup
+		errc := make(chan error, 20)
+		for i := 1; i <= 10; i++ {
+			wg.Add(2)
+			go func(i int) {
+				defer wg.Done()
+				if v, err := svc.Sum(ctx, i, i); err != nil || v != 2*i {
+					errc <- fmt.Errorf("Sum(%d, %d) got v:%d err:%v", i, i, v, err)
+				}
+			}(i)
+			go func(i int) {
+				defer wg.Done()
+				s := fmt.Sprint(i)
+				if v, err := svc.Concat(ctx, s, s); err != nil || v != s+s {
+					errc <- fmt.Errorf("Concat(%q, %q) got v:%q err:%v", s, s, v, err)
+				}
+			}(i)
+		}
+		wg.Wait()
+		close(errc)
+		for err := range errc {
+			t.Error(err)
+		}
+	})
+}
@@ -0,0 +1,47 @@
+package servicetest
+
+import (
+	"context"
+	"errors"
+	"github.com/go-kit/kit/log"
+	"gokit_foundation/events"
+	"new_addsvc/pkg/service"
+	"reflect"
+	"testing"
+)
+
+func TestContract(t *testing.T) {
+	logger := log.NewNopLogger()
+	for name, svc := range map[string]service.Service{
+		"basic": service.NewBasicService(logger),
+		// 完整的service层middleware(日志、指标、领域事件)
+		"middlewares": service.New(logger, nil, nil, nil, nopPublisher{}),
+		"fake":        &Fake{},
+	} {
+		t.Run(name, func(t *testing.T) { Contract(t, svc) })
+	}
+}
+
+func TestFake(t *testing.T) {
+	errBoom := errors.New("boom")
+	f := &Fake{SumFunc: func(context.Context, int, int) (int, error) { return 0, errBoom }}
+	ctx := context.Background()
+	if _, err := f.Sum(ctx, 1, 2); err != errBoom {
+		t.Errorf("Sum got err:%v", err)
+	}
+	// 没有替换的方法使用默认实现
+	if v, err := f.Concat(ctx, "a", "b"); err != nil || v != "ab" {
+		t.Errorf("Concat got v:%q err:%v", v, err)
+	}
+	want := []Call{{"Sum", []interface{}{1, 2}}, {"Concat", []interface{}{"a", "b"}}}
+	if got := f.Calls(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got calls:%v", got)
+	}
+	if f.CallCount("Sum") != 1 || f.CallCount("") != 2 {
+		t.Errorf("got count Sum:%d all:%d", f.CallCount("Sum"), f.CallCount(""))
+	}
+}
+
+type nopPublisher struct{}
+
+func (nopPublisher) Publish(context.Context, events.Event) error { return nil }
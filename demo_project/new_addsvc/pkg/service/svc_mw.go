@@ -2,21 +2,22 @@ package service
 
 import (
 	"context"
-	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/metrics"
+	"gokit_foundation/errs"
+	"gokit_foundation/logging"
 )
 
 type Middleware func(Service) Service
 
-// 统一mw
-func UnifyMiddleware(loggermw log.Logger, ints, chars metrics.Counter) Middleware {
+// 统一mw，日志使用endpoint层放入ctx的请求级别logger(见logging.FromContext)
+func UnifyMiddleware(ints, chars metrics.Counter) Middleware {
 	return func(next Service) Service {
 		instrumw := instrumentingMiddleware{
 			ints:  ints,
 			chars: chars,
 			next:  next,
 		}
-		return unifyMiddleware{loggermw, instrumw, next}
+		return unifyMiddleware{instrumw, next}
 	}
 }
 
@@ -30,14 +31,15 @@ type instrumentingMiddleware struct {
 // mw实体
 type unifyMiddleware struct {
 	// 通过命名规范代码， 不同功能的对象通过嵌套struct添加
-	loggermw log.Logger
 	instrumw instrumentingMiddleware
 	next     Service
 }
 
 func (mw unifyMiddleware) Sum(ctx context.Context, a, b int) (v int, err error) {
+	// 请求级别的logger，已带上request_id、method等字段
+	logger := logging.FromContext(ctx)
 	defer func() {
-		mw.loggermw.Log("method", "Sum", "a", a, "b", b, "v", v, "err", err)
+		logger.Log(append([]interface{}{"a", a, "b", b, "v", v}, errs.LogKeyvals(err)...)...)
 	}()
 	v, err = mw.next.Sum(ctx, a, b)
 	mw.instrumw.ints.Add(float64(v))
@@ -45,8 +47,9 @@ func (mw unifyMiddleware) Sum(ctx context.Context, a, b int) (v int, err error)
 }
 
 func (mw unifyMiddleware) Concat(ctx context.Context, a, b string) (v string, err error) {
+	logger := logging.FromContext(ctx)
 	defer func() {
-		mw.loggermw.Log("method", "Concat", "a", a, "b", b, "v", v, "err", err)
+		logger.Log(append([]interface{}{"a", a, "b", b, "v", v}, errs.LogKeyvals(err)...)...)
 	}()
 	return mw.next.Concat(ctx, a, b)
 }
@@ -0,0 +1,137 @@
+package transport
+
+import (
+	"context"
+	stdendpoint "github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/tracing/opentracing"
+	grpctransport "github.com/go-kit/kit/transport/grpc"
+	httptransport "github.com/go-kit/kit/transport/http"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"gokit_foundation/errs"
+	"gokit_foundation/propagation"
+	"google.golang.org/grpc/metadata"
+	"io"
+	"net/http"
+	"new_addsvc/pb/gen-go/blobpb"
+	endpoint2 "new_addsvc/pkg/endpoint"
+	"strings"
+)
+
+/*
+上传接口(见endpoint.NewBlobEndpoints)，body不解码到内存，而是作为io.Reader交给endpoint，边接收边写入存储：
+-	grpc：client流，第一条消息为UploadHeader，之后为数据块，见blobServer.Upload
+-	http：PUT /blobs/<name>，body为数据(可以是chunked)，Content-Length和X-Content-Sha256为声明的大小和校验和，
+	返回{"name": ..., "size": ..., "sha256": ...}，超过大小限制、校验失败等的http状态码见errs.Mapper
+背压：存储写完一块才读下一块，grpc的流控窗口或TCP窗口满后client的Send/Write阻塞，server的内存占用与body大小无关
+http服务的ReadTimeout(见-http.read.timeout)限制了整个上传的时长，上传大文件时需要调大或使用grpc
+*/
+
+// 上传接口的http路径前缀，之后为blob的name
+const BlobPathPrefix = "/blobs/"
+
+// 第一条消息不是UploadHeader或之后又出现UploadHeader时返回
+var errUploadHeader = errs.Invalid("upload: header must be the first and only the first message")
+
+type blobServer struct {
+	// 与ConcatStream一样不经过grpctransport.Handler，直接调用endpoint
+	uploadEndpoint stdendpoint.Endpoint
+	before         []grpctransport.ServerRequestFunc
+}
+
+func NewBlobServer(endpoints endpoint2.BlobEndpoints, otTracer stdopentracing.Tracer, logger log.Logger) blobpb.BlobServer {
+	return &blobServer{
+		uploadEndpoint: endpoints.UploadEndpoint,
+		before:         streamBefore(otTracer, "Upload", logger),
+	}
+}
+
+// Upload endpoint返回(上传完成或失败)后才SendAndClose，失败时未读完的数据块由grpc丢弃，client的Send返回io.EOF，
+// 通过CloseAndRecv得到err
+func (s *blobServer) Upload(stream blobpb.Blob_UploadServer) error {
+	ctx := stream.Context()
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, f := range s.before {
+			ctx = f(ctx, md)
+		}
+	}
+	first, err := stream.Recv()
+	if err == io.EOF {
+		return errMapper().ToGRPC(errUploadHeader)
+	}
+	if err != nil {
+		return err
+	}
+	header := first.GetHeader()
+	if header == nil {
+		return errMapper().ToGRPC(errUploadHeader)
+	}
+	rsp, err := s.uploadEndpoint(ctx, &endpoint2.UploadRequest{
+		Name:   header.Name,
+		Size:   header.Size,
+		SHA256: header.Sha256,
+		Body:   &chunkReader{stream: stream},
+	})
+	if err != nil {
+		return errMapper().ToGRPC(err)
+	}
+	resp := rsp.(*endpoint2.UploadResponse)
+	return stream.SendAndClose(&blobpb.UploadReply{Name: resp.Name, Size: resp.Size, Sha256: resp.SHA256})
+}
+
+// chunkReader 将数据块转为io.Reader，Read时才接收下一块，client结束发送时返回io.EOF
+type chunkReader struct {
+	stream blobpb.Blob_UploadServer
+	buf    []byte
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		msg, err := r.stream.Recv()
+		if err != nil {
+			return 0, err
+		}
+		if msg.GetHeader() != nil {
+			return 0, errUploadHeader
+		}
+		r.buf = msg.GetChunk()
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// NewHTTPUploadHandler 处理PUT /blobs/<name>，与NewHTTPHandler使用相同的errorEncoder和ServerBefore
+func NewHTTPUploadHandler(endpoints endpoint2.BlobEndpoints, otTracer stdopentracing.Tracer, logger log.Logger) http.Handler {
+	h := httptransport.NewServer(
+		endpoints.UploadEndpoint,
+		decodeHTTPUploadRequest,
+		encodeHTTPGenericResponse,
+		httptransport.ServerErrorEncoder(errorEncoder),
+		httptransport.ServerErrorHandler(errs.NewLogErrorHandler(logger)),
+		propagation.HTTPServerBefore(),
+		httptransport.ServerBefore(opentracing.HTTPToContext(otTracer, "Upload", logger)),
+	)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			w.Header().Set("Allow", http.MethodPut)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Content-Length未知(chunked，或请求body经过CompressMiddleware解压)时不检查大小
+func decodeHTTPUploadRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	size := r.ContentLength
+	if size < 0 {
+		size = 0
+	}
+	return &endpoint2.UploadRequest{
+		Name:   strings.TrimPrefix(r.URL.Path, BlobPathPrefix),
+		Size:   size,
+		SHA256: r.Header.Get("X-Content-Sha256"),
+		Body:   r.Body,
+	}, nil
+}
@@ -0,0 +1,175 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics/discard"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"gokit_foundation/blobstore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"new_addsvc/pb/gen-go/blobpb"
+	endpoint2 "new_addsvc/pkg/endpoint"
+	"new_addsvc/pkg/service"
+	"os"
+	"testing"
+)
+
+func hexSum(b []byte) string {
+	s := sha256.Sum256(b)
+	return hex.EncodeToString(s[:])
+}
+
+// 保存到临时目录，单个blob最大1000字节
+func newTestBlobEndpoints(t *testing.T) (endpoint2.BlobEndpoints, *blobstore.FSStore, func()) {
+	dir, err := ioutil.TempDir("", "blobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := blobstore.NewFSStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := service.NewBlobService(blobstore.NewUploader(store, 1000, blobstore.Metrics{}))
+	eps := endpoint2.NewBlobEndpoints(svc, log.NewNopLogger(), discard.NewHistogram(), stdopentracing.NoopTracer{}, nil)
+	return eps, store, func() { os.RemoveAll(dir) }
+}
+
+func TestBlobUploadOverGRPC(t *testing.T) {
+	eps, store, clean := newTestBlobEndpoints(t)
+	defer clean()
+	logger := log.NewNopLogger()
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer()
+	blobpb.RegisterBlobServer(srv, NewBlobServer(eps, stdopentracing.NoopTracer{}, logger))
+	go srv.Serve(lis)
+	defer srv.Stop()
+	cc, err := grpc.Dial("bufconn", grpc.WithInsecure(), grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+		return lis.Dial()
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cc.Close()
+	client := blobpb.NewBlobClient(cc)
+
+	// 依次发送header和数据块，Send返回io.EOF表示server已结束(上传失败)，err通过CloseAndRecv得到
+	upload := func(header *blobpb.UploadHeader, chunks ...[]byte) (*blobpb.UploadReply, error) {
+		stream, err := client.Upload(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		if header != nil {
+			if err := stream.Send(&blobpb.UploadRequest{Part: &blobpb.UploadRequest_Header{Header: header}}); err != nil && err != io.EOF {
+				return nil, err
+			}
+		}
+		for _, chunk := range chunks {
+			if err := stream.Send(&blobpb.UploadRequest{Part: &blobpb.UploadRequest_Chunk{Chunk: chunk}}); err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, err
+			}
+		}
+		return stream.CloseAndRecv()
+	}
+
+	data := bytes.Repeat([]byte("ab"), 300)
+	rep, err := upload(&blobpb.UploadHeader{Name: "a/b.txt", Size: 600, Sha256: hexSum(data)}, data[:100], data[100:400], data[400:])
+	if err != nil || rep.Size != 600 || rep.Sha256 != hexSum(data) {
+		t.Fatalf("got rep:%v err:%v", rep, err)
+	}
+	if b, _ := ioutil.ReadFile(store.Path("a/b.txt")); !bytes.Equal(b, data) {
+		t.Errorf("got %d bytes", len(b))
+	}
+
+	test := []struct {
+		name     string
+		header   *blobpb.UploadHeader
+		chunks   [][]byte
+		wantCode codes.Code
+	}{
+		{name: "[no header]", chunks: [][]byte{data}, wantCode: codes.InvalidArgument},
+		{name: "[empty name]", header: &blobpb.UploadHeader{}, chunks: [][]byte{data}, wantCode: codes.InvalidArgument},
+		{name: "[checksum mismatch]", header: &blobpb.UploadHeader{Name: "c", Sha256: hexSum([]byte("x"))}, chunks: [][]byte{data}, wantCode: codes.InvalidArgument},
+		{name: "[too large]", header: &blobpb.UploadHeader{Name: "d"}, chunks: [][]byte{data, data}, wantCode: codes.InvalidArgument},
+	}
+	for _, tt := range test {
+		if _, err := upload(tt.header, tt.chunks...); status.Code(err) != tt.wantCode {
+			t.Errorf("name:%s got err:%v want code:%v", tt.name, err, tt.wantCode)
+		}
+	}
+	if _, err := os.Stat(store.Path("d")); !os.IsNotExist(err) {
+		t.Errorf("got err:%v", err)
+	}
+}
+
+func TestBlobUploadOverHTTP(t *testing.T) {
+	eps, store, clean := newTestBlobEndpoints(t)
+	defer clean()
+	srv := httptest.NewServer(NewHTTPUploadHandler(eps, stdopentracing.NoopTracer{}, log.NewNopLogger()))
+	defer srv.Close()
+
+	data := bytes.Repeat([]byte("ab"), 300)
+	// io.Pipe没有长度，client使用chunked编码
+	pr, pw := io.Pipe()
+	go func() {
+		pw.Write(data[:300])
+		pw.Write(data[300:])
+		pw.Close()
+	}()
+	req, _ := http.NewRequest(http.MethodPut, srv.URL+"/blobs/a/b.txt", pr)
+	req.Header.Set("X-Content-Sha256", hexSum(data))
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got endpoint2.UploadResponse
+	json.NewDecoder(rsp.Body).Decode(&got)
+	rsp.Body.Close()
+	if rsp.StatusCode != 200 || got.Name != "a/b.txt" || got.Size != 600 {
+		t.Fatalf("got status:%d rsp:%+v", rsp.StatusCode, got)
+	}
+	if b, _ := ioutil.ReadFile(store.Path("a/b.txt")); !bytes.Equal(b, data) {
+		t.Errorf("got %d bytes", len(b))
+	}
+
+	test := []struct {
+		name, method, path, sha256 string
+		body                       []byte
+		wantStatus                 int
+	}{
+		{name: "[method]", method: http.MethodPost, path: "/blobs/x", body: data, wantStatus: http.StatusMethodNotAllowed},
+		{name: "[invalid name]", method: http.MethodPut, path: "/blobs/.x", body: data, wantStatus: http.StatusBadRequest},
+		{name: "[checksum mismatch]", method: http.MethodPut, path: "/blobs/x", body: data, sha256: hexSum([]byte("x")), wantStatus: http.StatusBadRequest},
+		{name: "[too large]", method: http.MethodPut, path: "/blobs/x", body: append(data, data...), wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range test {
+		req, _ := http.NewRequest(tt.method, srv.URL+tt.path, bytes.NewReader(tt.body))
+		if tt.sha256 != "" {
+			req.Header.Set("X-Content-Sha256", tt.sha256)
+		}
+		rsp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rsp.Body.Close()
+		if rsp.StatusCode != tt.wantStatus {
+			t.Errorf("name:%s got status:%d want:%d", tt.name, rsp.StatusCode, tt.wantStatus)
+		}
+	}
+	if _, err := os.Stat(store.Path("x")); !os.IsNotExist(err) {
+		t.Errorf("got err:%v", err)
+	}
+}
@@ -11,6 +11,8 @@ import (
 	grpctransport "github.com/go-kit/kit/transport/grpc"
 	stdopentracing "github.com/opentracing/opentracing-go"
 	"github.com/sony/gobreaker"
+	"gokit_foundation/otel"
+	"gokit_foundation/propagation"
 	"google.golang.org/grpc"
 	"new_addsvc/pb/gen-go/addsvcpb"
 	endpoint2 "new_addsvc/pkg/endpoint"
@@ -23,18 +25,19 @@ RPC-client侧
 	go-kit的设计不是同一给所有接口安装，而是手动的给每一个接口安装，粒度细了，也多了一点代码量
 */
 
-// 不是随便定，是由proto文件中的package名和service名组合得到
-// 在这里定义这个全局变量也许不是最终方案，待定~
-var gRPCSvrName = "addsvcpb.Add"
+// gRPCSvrName以及各接口的encode/decode函数由proto文件生成，见grpc_gen.go
 
 // client调用, 这个方法接收一个实例地址，以及中间件，然后创建出endpoint
-func MakeClientEndpoints(instance string, otTracer stdopentracing.Tracer, logger log.Logger) (endpoint2.AddSvcEndpoints, error) {
+// dialOpts为空时不使用TLS，server启用TLS时传入grpc.WithTransportCredentials(见mtls.Reloader.ClientCredentials)
+func MakeClientEndpoints(instance string, otTracer stdopentracing.Tracer, logger log.Logger, dialOpts ...grpc.DialOption) (endpoint2.AddSvcEndpoints, error) {
 	if instance == "" {
 		return endpoint2.AddSvcEndpoints{}, errors.New("no instance")
 	}
 
-	// 这里可以设置dial选项
-	conn, err := grpc.Dial(instance, grpc.WithInsecure(), grpc.WithTimeout(time.Second))
+	if len(dialOpts) == 0 {
+		dialOpts = []grpc.DialOption{grpc.WithInsecure()}
+	}
+	conn, err := grpc.Dial(instance, append(dialOpts, grpc.WithTimeout(time.Second))...)
 	if err != nil {
 		// 这种情况很少发生，就是从健康中心获得了一个健康的实例地址，却仍然连不上
 		return endpoint2.AddSvcEndpoints{}, fmt.Errorf("failed: grpc.Dial %s %s", instance, err)
@@ -42,18 +45,23 @@ func MakeClientEndpoints(instance string, otTracer stdopentracing.Tracer, logger
 		//os.Exit(1)
 	}
 
-	return newGRPCClient(conn, otTracer, logger), nil
+	return NewGRPCClient(conn, otTracer, logger), nil
 }
 
-// newGRPCClient returns an AddService backed by a gRPC server at the other end
+// NewGRPCClient returns an AddService backed by a gRPC server at the other end
 // of the conn. The caller is responsible for constructing the conn, and
 // eventually closing the underlying transport. We bake-in certain middlewares,
 // implementing the client library pattern.
-func newGRPCClient(conn *grpc.ClientConn, otTracer stdopentracing.Tracer, logger log.Logger) endpoint2.AddSvcEndpoints {
+func NewGRPCClient(conn *grpc.ClientConn, otTracer stdopentracing.Tracer, logger log.Logger) endpoint2.AddSvcEndpoints {
 	//limiter := ratelimit.NewErroringLimiter(rate.NewLimiter(rate.Every(time.Second), 100))
 
 	// global client middlewares
-	var options []grpctransport.ClientOption
+	// 调用方通过auth.WithToken将token放入ctx，这里写入metadata
+	options := []grpctransport.ClientOption{
+		// request id、租户以及cache.WithBypass、featureflag.WithSubject、loadshed.WithPriority设置的值同样从ctx传给下游，见propagation.Fields
+		propagation.GRPCClientBefore(),
+	}
+	otelTracer := otel.Tracer()
 
 	// Each individual endpoint is an grpc/transport.Client (which implements
 	// endpoint.Endpoint) that gets wrapped with various middlewares. If you
@@ -71,12 +79,15 @@ func newGRPCClient(conn *grpc.ClientConn, otTracer stdopentracing.Tracer, logger
 			append(options, grpctransport.ClientBefore(opentracing.ContextToGRPC(otTracer, logger)))...,
 		).Endpoint()
 		sumEndpoint = opentracing.TraceClient(otTracer, "Sum")(sumEndpoint)
+		sumEndpoint = otel.TraceClient(otelTracer, "Sum")(sumEndpoint)
 		// client侧没必要做限速，server侧已经做了
 		//sumEndpoint = limiter(sumEndpoint)
 		sumEndpoint = circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(gobreaker.Settings{
 			Name:    "Sum",
 			Timeout: 10 * time.Second,
 		}))(sumEndpoint)
+		// 还原server返回的grpc status，断路器等返回的err也转为*errs.Error
+		sumEndpoint = endpoint2.ErrorsMiddleware()(sumEndpoint)
 	}
 
 	// The Concat endpoint is the same thing, with slightly different
@@ -93,47 +104,57 @@ func newGRPCClient(conn *grpc.ClientConn, otTracer stdopentracing.Tracer, logger
 			append(options, grpctransport.ClientBefore(opentracing.ContextToGRPC(otTracer, logger)))...,
 		).Endpoint()
 		concatEndpoint = opentracing.TraceClient(otTracer, "Concat")(concatEndpoint)
+		concatEndpoint = otel.TraceClient(otelTracer, "Concat")(concatEndpoint)
 		//concatEndpoint = limiter(concatEndpoint)
 		concatEndpoint = circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(gobreaker.Settings{
 			Name:    "Concat",
 			Timeout: 10 * time.Second,
 		}))(concatEndpoint)
+		concatEndpoint = endpoint2.ErrorsMiddleware()(concatEndpoint)
 	}
 
-	return endpoint2.AddSvcEndpoints{
-		SumEndpoint:    sumEndpoint,
-		ConcatEndpoint: concatEndpoint,
+	// 断路器与Sum分开，整批失败不影响单独的Sum调用
+	var batchSumEndpoint stdendpoint.Endpoint
+	{
+		batchSumEndpoint = grpctransport.NewClient(
+			conn,
+			gRPCSvrName,
+			"BatchSum",
+			encodeGRPCBatchSumRequest,
+			decodeGRPCBatchSumResponse,
+			addsvcpb.BatchSumReply{},
+			append(options, grpctransport.ClientBefore(opentracing.ContextToGRPC(otTracer, logger)))...,
+		).Endpoint()
+		batchSumEndpoint = opentracing.TraceClient(otTracer, "BatchSum")(batchSumEndpoint)
+		batchSumEndpoint = otel.TraceClient(otelTracer, "BatchSum")(batchSumEndpoint)
+		batchSumEndpoint = circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(gobreaker.Settings{
+			Name:    "BatchSum",
+			Timeout: 10 * time.Second,
+		}))(batchSumEndpoint)
+		batchSumEndpoint = endpoint2.ErrorsMiddleware()(batchSumEndpoint)
 	}
-}
-
-// decodeGRPCSumResponse is a transport/grpc.DecodeResponseFunc that converts a
-// gRPC sum reply to a user-domain sum response. Primarily useful in a client.
-// 负责：grpcReq ==> endpointReq, client使用
-func decodeGRPCSumResponse(_ context.Context, grpcReply interface{}) (interface{}, error) {
-	reply := grpcReply.(*addsvcpb.SumReply)
-	return &endpoint2.SumResponse{V: int(reply.V), RetCode: reply.Retcode}, nil
-}
 
-// decodeGRPCConcatResponse is a transport/grpc.DecodeResponseFunc that converts
-// a gRPC concat reply to a user-domain concat response. Primarily useful in a
-// client.
-func decodeGRPCConcatResponse(_ context.Context, grpcReply interface{}) (interface{}, error) {
-	reply := grpcReply.(*addsvcpb.ConcatReply)
-	return &endpoint2.ConcatResponse{V: reply.V, RetCode: reply.Retcode}, nil
+	return endpoint2.AddSvcEndpoints{
+		SumEndpoint:      sumEndpoint,
+		ConcatEndpoint:   concatEndpoint,
+		BatchSumEndpoint: batchSumEndpoint,
+	}
 }
 
-// encodeGRPCSumRequest is a transport/grpc.EncodeRequestFunc that converts a
-// user-domain sum request to a gRPC sum request. Primarily useful in a client.
-// 负责：endpointReq ==> grpcReq, client使用
-func encodeGRPCSumRequest(_ context.Context, request interface{}) (interface{}, error) {
-	req := request.(*endpoint2.SumRequest)
-	return &addsvcpb.SumRequest{A: int64(req.A), B: int64(req.B)}, nil
+func encodeGRPCBatchSumRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(*endpoint2.BatchSumRequest)
+	items := make([]*addsvcpb.SumRequest, len(req.Items))
+	for i, item := range req.Items {
+		items[i] = &addsvcpb.SumRequest{A: int64(item.A), B: int64(item.B)}
+	}
+	return &addsvcpb.BatchSumRequest{Items: items}, nil
 }
 
-// encodeGRPCConcatRequest is a transport/grpc.EncodeRequestFunc that converts a
-// user-domain concat request to a gRPC concat request. Primarily useful in a
-// client.
-func encodeGRPCConcatRequest(_ context.Context, request interface{}) (interface{}, error) {
-	req := request.(*endpoint2.ConcatRequest)
-	return &addsvcpb.ConcatRequest{A: req.A, B: req.B}, nil
+func decodeGRPCBatchSumResponse(_ context.Context, grpcReply interface{}) (interface{}, error) {
+	reply := grpcReply.(*addsvcpb.BatchSumReply)
+	items := make([]*endpoint2.SumResponse, len(reply.Items))
+	for i, item := range reply.Items {
+		items[i] = &endpoint2.SumResponse{V: int(item.V), RetCode: item.Retcode}
+	}
+	return &endpoint2.BatchSumResponse{Items: items}, nil
 }
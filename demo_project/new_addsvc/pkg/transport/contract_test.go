@@ -0,0 +1,115 @@
+package transport
+
+import (
+	"context"
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/go-kit/kit/log"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"net/http/httptest"
+	pb "new_addsvc/pb/gen-go/addsvcpb"
+	"new_addsvc/pb/gen-go/addsvcthrift"
+	endpoint2 "new_addsvc/pkg/endpoint"
+	"new_addsvc/pkg/service"
+	"new_addsvc/pkg/service/servicetest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 每个transport的client都满足service的Contract，server端为servicetest.Fake
+func TestContractAcrossTransports(t *testing.T) {
+	logger := log.NewNopLogger()
+	tracer := stdopentracing.NoopTracer{}
+	newEndpoints := func(svc service.Service) endpoint2.AddSvcEndpoints {
+		return endpoint2.New(svc, logger, tracer, endpoint2.Deps{})
+	}
+	clients := map[string]func(t *testing.T, eps endpoint2.AddSvcEndpoints) (service.Service, func()){
+		"endpoint": func(t *testing.T, eps endpoint2.AddSvcEndpoints) (service.Service, func()) {
+			return eps, func() {}
+		},
+		"grpc": func(t *testing.T, eps endpoint2.AddSvcEndpoints) (service.Service, func()) {
+			lis := bufconn.Listen(1024 * 1024)
+			srv := grpc.NewServer()
+			pb.RegisterAddServer(srv, NewGRPCServer(eps, tracer, logger))
+			go srv.Serve(lis)
+			cc, err := grpc.Dial("bufconn", grpc.WithInsecure(), grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+				return lis.Dial()
+			}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return NewGRPCClient(cc, tracer, logger), func() {
+				cc.Close()
+				srv.Stop()
+			}
+		},
+		"http": func(t *testing.T, eps endpoint2.AddSvcEndpoints) (service.Service, func()) {
+			srv := httptest.NewServer(NewHTTPHandler(eps, tracer, logger))
+			cli, err := MakeHTTPClientEndpoints(srv.URL, nil, tracer, logger)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return cli, srv.Close
+		},
+		"thrift": func(t *testing.T, eps endpoint2.AddSvcEndpoints) (service.Service, func()) {
+			socket, err := thrift.NewTServerSocket("127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			srv := thrift.NewTSimpleServer4(addsvcthrift.NewAddServiceProcessor(NewThriftServer(eps)), socket, ThriftTransportFactory(), ThriftProtocolFactory)
+			if err = srv.Listen(); err != nil {
+				t.Fatal(err)
+			}
+			go srv.AcceptLoop()
+			client, trans, err := DialThrift(socket.Addr().String(), time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// 底层只有一个连接，不是并发安全的
+			return &serialService{next: NewThriftClient(client)}, func() {
+				trans.Close()
+				srv.Stop()
+			}
+		},
+		"nats": func(t *testing.T, eps endpoint2.AddSvcEndpoints) (service.Service, func()) {
+			nc, cleanup := newTestNATS(t)
+			if _, err := SubscribeNATS(nc, eps, logger); err != nil {
+				cleanup()
+				t.Fatal(err)
+			}
+			return MakeNATSClientEndpoints(nc, time.Second), cleanup
+		},
+	}
+	for name, newClient := range clients {
+		t.Run(name, func(t *testing.T) {
+			fake := &servicetest.Fake{}
+			cli, cleanup := newClient(t, newEndpoints(fake))
+			defer cleanup()
+			servicetest.Contract(t, cli)
+			if fake.CallCount("") == 0 {
+				t.Error("no call reached the service")
+			}
+		})
+	}
+}
+
+// 串行调用next，用于不能并发调用的client
+type serialService struct {
+	mu   sync.Mutex
+	next service.Service
+}
+
+func (s *serialService) Sum(ctx context.Context, a, b int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.next.Sum(ctx, a, b)
+}
+
+func (s *serialService) Concat(ctx context.Context, a, b string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.next.Concat(ctx, a, b)
+}
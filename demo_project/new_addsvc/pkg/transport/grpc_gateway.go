@@ -0,0 +1,96 @@
+package transport
+
+import (
+	"context"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"gokit_foundation/deadline"
+	"gokit_foundation/errs"
+	"gokit_foundation/propagation"
+	"gokit_foundation/reqid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"net/textproto"
+	pb "new_addsvc/pb/gen-go/addsvcpb"
+	service2 "new_addsvc/pkg/service"
+	"strings"
+	"time"
+)
+
+/*
+grpc-gateway：根据addsvc.proto中的google.api.http生成的反向代理(addsvc.pb.gw.go)，把REST请求转为对grpc server的调用，
+REST和grpc的接口定义都来自proto，经过grpc server的全部拦截器和grpc transport
+	POST /v1/sum         {"a": 1, "b": 2}          => {"v": "3", "retcode": 0}
+	POST /v1/concat      {"a": "x", "b": "y"}      => {"v": "xy", "retcode": 0}
+	POST /v1/batch_sum   {"items": [{"a": 1, "b": 2}]}  => {"items": [{"v": "3", "retcode": 0}]}
+	POST /v1/sum_series  {"nums": [1, 2, 3]}       => 每行一个{"result": {"v": "1", "retcode": 0}}，直到流结束
+-	JSON与proto的映射按proto3的规则(jsonpb)：字段名同proto，int64输出为字符串(js无法精确表示超过2^53的整数)，请求中数字和字符串都可以，
+	enum输出为数字，零值字段不省略，与NewHTTPHandler一样忽略未知字段
+-	与/sum等HTTP/JSON接口(见NewHTTPHandler)一样，业务错误通过retcode返回，grpc的status按errs还原后以相同的状态码和body(errs.HTTPBody)响应，
+	请求body无法解析时与参数校验失败的Code相同
+-	Authorization以及propagation.Fields中的header(租户、X-User-Id、X-Priority、追踪等)转为grpc metadata，X-Request-Timeout转为grpc的deadline，
+	request id取自ctx(见reqid.HTTPMiddleware)
+*/
+
+var gatewayMarshaler = &runtime.JSONPb{OrigName: true, EmitDefaults: true, EnumsAsInts: true}
+
+// 原样(小写)转为metadata的header：propagation.GRPCHeaders以及opentracing(jaeger、zipkin)的header，对应grpc server侧的GRPCToContext
+// Authorization由gateway自己转为authorization，request id取自ctx(见NewGRPCGatewayHandler)
+var gatewayHeaders = func() map[string]bool {
+	hs := map[string]bool{}
+	for _, h := range append(propagation.GRPCHeaders(), "Uber-Trace-Id", "X-B3-Traceid", "X-B3-Spanid", "X-B3-Parentspanid", "X-B3-Sampled", "X-B3-Flags") {
+		if h = textproto.CanonicalMIMEHeaderKey(h); h != "Authorization" && h != reqid.Header {
+			hs[h] = true
+		}
+	}
+	return hs
+}()
+
+// NewGRPCGatewayHandler conn为连接到本服务grpc server的连接，handler处理/v1/下的请求
+func NewGRPCGatewayHandler(ctx context.Context, conn *grpc.ClientConn) (http.Handler, error) {
+	mux := runtime.NewServeMux(
+		runtime.WithMarshalerOption(runtime.MIMEWildcard, gatewayMarshaler),
+		runtime.WithIncomingHeaderMatcher(gatewayHeaderMatcher),
+		runtime.WithMetadata(func(ctx context.Context, _ *http.Request) metadata.MD {
+			if id := reqid.FromContext(ctx); id != "" {
+				return metadata.Pairs("x-request-id", id)
+			}
+			return nil
+		}),
+		runtime.WithProtoErrorHandler(gatewayErrorHandler),
+	)
+	if err := pb.RegisterAddHandler(ctx, mux, conn); err != nil {
+		return nil, err
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if d, err := time.ParseDuration(r.Header.Get(deadline.Header)); err == nil && d > 0 {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+			r = r.WithContext(ctx)
+		}
+		mux.ServeHTTP(w, r)
+	}), nil
+}
+
+func gatewayHeaderMatcher(key string) (string, bool) {
+	if key = textproto.CanonicalMIMEHeaderKey(key); gatewayHeaders[key] {
+		return strings.ToLower(key), true
+	}
+	return runtime.DefaultHeaderMatcher(key)
+}
+
+// grpc server返回的status由errs.FromGRPC还原，gateway自己产生的错误(如body不是合法的JSON)为InvalidArgument，没有Code，
+// 没有匹配的路由(以及grpc server没有注册的接口)为Unimplemented，按404响应
+func gatewayErrorHandler(ctx context.Context, _ *runtime.ServeMux, _ runtime.Marshaler, w http.ResponseWriter, r *http.Request, err error) {
+	if status.Code(err) == codes.Unimplemented {
+		errMapper().EncodeHTTPError(ctx, errs.NotFound("no such method: "+r.Method+" "+r.URL.Path), w)
+		return
+	}
+	e := errs.From(errs.FromGRPC(err))
+	if e.Kind == errs.KindInvalid && e.Code == 0 {
+		e = e.WithCode(service2.CodeInvalidArgs)
+	}
+	errMapper().EncodeHTTPError(ctx, e, w)
+}
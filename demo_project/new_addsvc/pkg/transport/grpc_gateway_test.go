@@ -0,0 +1,158 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-kit/kit/log"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"gokit_foundation/errs"
+	"gokit_foundation/reqid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	pb "new_addsvc/pb/gen-go/addsvcpb"
+	endpoint2 "new_addsvc/pkg/endpoint"
+	"new_addsvc/pkg/service"
+	"strings"
+	"testing"
+)
+
+// 返回的handler经过bufconn调用grpc server，mds记录每次一元调用收到的metadata，有deadline时加上test-deadline
+func newTestGateway(t *testing.T) (http.Handler, *[]metadata.MD, func()) {
+	logger := log.NewNopLogger()
+	tracer := stdopentracing.NoopTracer{}
+	eps := endpoint2.New(service.NewBasicService(logger), logger, tracer, endpoint2.Deps{})
+
+	var mds []metadata.MD
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		md = md.Copy()
+		if _, ok := ctx.Deadline(); ok {
+			md.Set("test-deadline", "1")
+		}
+		mds = append(mds, md)
+		return handler(ctx, req)
+	}))
+	pb.RegisterAddServer(srv, NewGRPCServer(eps, tracer, logger))
+	go srv.Serve(lis)
+	cc, err := grpc.Dial("bufconn", grpc.WithInsecure(), grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+		return lis.Dial()
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := NewGRPCGatewayHandler(context.Background(), cc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h, &mds, func() {
+		cc.Close()
+		srv.Stop()
+	}
+}
+
+func TestGRPCGatewayMapping(t *testing.T) {
+	h, _, stop := newTestGateway(t)
+	defer stop()
+
+	test := []struct {
+		name, path, body string
+		want             string
+	}{
+		// int64按proto3 JSON输出为字符串，请求中数字和字符串都可以
+		{name: "[sum]", path: "/v1/sum", body: `{"a": 1, "b": "2"}`, want: `{"v":"3","retcode":0}`},
+		{name: "[sum max]", path: "/v1/sum", body: `{"a": 9007199254740991, "b": 0}`, want: `{"v":"9007199254740991","retcode":0}`},
+		// 业务错误：200，retcode与grpc相同
+		{name: "[sum two zeroes]", path: "/v1/sum", body: `{}`, want: `{"v":"0","retcode":1001}`},
+		{name: "[concat]", path: "/v1/concat", body: `{"a": "x", "b": "y", "unknown": 1}`, want: `{"v":"xy","retcode":0}`},
+		{name: "[batch sum]", path: "/v1/batch_sum", body: `{"items": [{"a": 1, "b": 2}, {"a": 0, "b": 0}]}`,
+			want: `{"items":[{"v":"3","retcode":0},{"v":"0","retcode":1001}]}`},
+		// 服务端流：每条消息一行
+		{name: "[sum series]", path: "/v1/sum_series", body: `{"nums": [1, 2, "3"]}`,
+			want: `{"result":{"v":"1","retcode":0}}` + "\n" + `{"result":{"v":"3","retcode":0}}` + "\n" + `{"result":{"v":"6","retcode":0}}` + "\n"},
+	}
+	for _, tt := range test {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body)))
+		if w.Code != http.StatusOK || w.Body.String() != tt.want {
+			t.Errorf("%s got code:%d body:%s want:%s", tt.name, w.Code, w.Body, tt.want)
+		}
+	}
+}
+
+// grpc的status还原为errs.Error，状态码和body与HTTP/JSON接口相同
+func TestGRPCGatewayErrors(t *testing.T) {
+	h, _, stop := newTestGateway(t)
+	defer stop()
+
+	test := []struct {
+		name, method, path, body string
+		wantCode                 int
+		wantKind                 string
+		wantErrCode              int
+		wantDetail               string
+	}{
+		{name: "[out of range]", method: http.MethodPost, path: "/v1/sum", body: `{"a": 9007199254740992, "b": 1}`,
+			wantCode: http.StatusBadRequest, wantKind: "invalid", wantErrCode: service.CodeInvalidArgs, wantDetail: "a"},
+		{name: "[concat empty]", method: http.MethodPost, path: "/v1/concat", body: `{}`,
+			wantCode: http.StatusBadRequest, wantKind: "invalid", wantErrCode: service.CodeInvalidArgs, wantDetail: "a"},
+		// gateway解析body失败，与参数校验失败的Code相同
+		{name: "[bad json]", method: http.MethodPost, path: "/v1/sum", body: `{"a": `,
+			wantCode: http.StatusBadRequest, wantKind: "invalid", wantErrCode: service.CodeInvalidArgs},
+		{name: "[bad type]", method: http.MethodPost, path: "/v1/sum", body: `{"a": "x"}`,
+			wantCode: http.StatusBadRequest, wantKind: "invalid", wantErrCode: service.CodeInvalidArgs},
+		{name: "[not found]", method: http.MethodPost, path: "/v1/mul", body: `{}`, wantCode: http.StatusNotFound, wantKind: "not_found"},
+	}
+	for _, tt := range test {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+		var body errs.HTTPBody
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s got body:%s err:%v", tt.name, w.Body, err)
+		}
+		if w.Code != tt.wantCode || body.Kind != tt.wantKind || body.Code != tt.wantErrCode || (tt.wantDetail != "" && body.Details[tt.wantDetail] == "") {
+			t.Errorf("%s got code:%d body:%+v", tt.name, w.Code, body)
+		}
+	}
+}
+
+// header转为grpc metadata，request id取自ctx
+func TestGRPCGatewayMetadata(t *testing.T) {
+	h, mds, stop := newTestGateway(t)
+	defer stop()
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/sum", strings.NewReader(`{"a": 1, "b": 2}`))
+	r.Header.Set("Authorization", "Bearer tk")
+	r.Header.Set("X-Priority", "low")
+	r.Header.Set("X-User-Id", "u1")
+	r.Header.Set("Cache-Control", "no-cache")
+	r.Header.Set("Grpc-Metadata-Foo", "bar")
+	w := httptest.NewRecorder()
+	reqid.HTTPMiddleware(h).ServeHTTP(w, r)
+	if w.Code != http.StatusOK || len(*mds) != 1 {
+		t.Fatalf("got code:%d body:%s", w.Code, w.Body)
+	}
+	md := (*mds)[0]
+	for k, want := range map[string]string{"authorization": "Bearer tk", "x-priority": "low", "x-user-id": "u1",
+		"cache-control": "no-cache", "foo": "bar", "x-request-id": w.Header().Get(reqid.Header)} {
+		if got := md.Get(k); len(got) != 1 || got[0] != want {
+			t.Errorf("metadata %s got:%v want:%s", k, got, want)
+		}
+	}
+	if _, ok := md["test-deadline"]; ok {
+		t.Errorf("got deadline without X-Request-Timeout")
+	}
+
+	// X-Request-Timeout转为grpc的deadline
+	r = httptest.NewRequest(http.MethodPost, "/v1/sum", strings.NewReader(`{"a": 1, "b": 2}`))
+	r.Header.Set("X-Request-Timeout", "3s")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || len(*mds) != 2 || len((*mds)[1].Get("test-deadline")) != 1 {
+		t.Errorf("got code:%d body:%s mds:%v", w.Code, w.Body, *mds)
+	}
+}
@@ -0,0 +1,131 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	stdendpoint "github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/tracing/opentracing"
+	httptransport "github.com/go-kit/kit/transport/http"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"gokit_foundation/errs"
+	"gokit_foundation/otel"
+	"gokit_foundation/propagation"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	endpoint2 "new_addsvc/pkg/endpoint"
+	"strings"
+)
+
+/*
+HTTP/JSON client，与NewHTTPHandler对应，用于不方便使用grpc的调用方(如cmd/loadgen压测HTTP transport)
+	非200的响应按errs.HTTPBody解析，得到的err与grpc client一致(errs.KindOf、errs.IsRetryable)
+*/
+
+// MakeHTTPClientEndpoints instance为server的HTTP地址，如127.0.0.1:8081或http://127.0.0.1:8081
+// client为nil时使用http.DefaultClient，需要控制连接数、超时时传入自定义的client
+func MakeHTTPClientEndpoints(instance string, client *http.Client, otTracer stdopentracing.Tracer, logger log.Logger) (endpoint2.AddSvcEndpoints, error) {
+	if instance == "" {
+		return endpoint2.AddSvcEndpoints{}, errors.New("no instance")
+	}
+	if !strings.HasPrefix(instance, "http") {
+		instance = "http://" + instance
+	}
+	base, err := url.Parse(instance)
+	if err != nil {
+		return endpoint2.AddSvcEndpoints{}, err
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	options := []httptransport.ClientOption{
+		httptransport.SetClient(client),
+		// token、request id、租户、优先级等，ctx的剩余时间写入X-Request-Timeout(grpc client自动传递deadline)，见propagation.Fields
+		propagation.HTTPClientBefore(),
+	}
+	otelTracer := otel.Tracer()
+
+	var sumEndpoint stdendpoint.Endpoint
+	{
+		sumEndpoint = httptransport.NewClient(
+			http.MethodPost,
+			copyURL(base, "/sum"),
+			encodeHTTPGenericRequest,
+			decodeHTTPSumResponse,
+			append(options, httptransport.ClientBefore(opentracing.ContextToHTTP(otTracer, logger)))...,
+		).Endpoint()
+		sumEndpoint = opentracing.TraceClient(otTracer, "Sum")(sumEndpoint)
+		sumEndpoint = otel.TraceClient(otelTracer, "Sum")(sumEndpoint)
+		sumEndpoint = endpoint2.ErrorsMiddleware()(sumEndpoint)
+	}
+
+	var concatEndpoint stdendpoint.Endpoint
+	{
+		concatEndpoint = httptransport.NewClient(
+			http.MethodPost,
+			copyURL(base, "/concat"),
+			encodeHTTPGenericRequest,
+			decodeHTTPConcatResponse,
+			append(options, httptransport.ClientBefore(opentracing.ContextToHTTP(otTracer, logger)))...,
+		).Endpoint()
+		concatEndpoint = opentracing.TraceClient(otTracer, "Concat")(concatEndpoint)
+		concatEndpoint = otel.TraceClient(otelTracer, "Concat")(concatEndpoint)
+		concatEndpoint = endpoint2.ErrorsMiddleware()(concatEndpoint)
+	}
+
+	return endpoint2.AddSvcEndpoints{
+		SumEndpoint:    sumEndpoint,
+		ConcatEndpoint: concatEndpoint,
+	}, nil
+}
+
+func copyURL(base *url.URL, path string) *url.URL {
+	next := *base
+	next.Path = path
+	return &next
+}
+
+// encodeHTTPGenericRequest is a transport/http.EncodeRequestFunc that
+// JSON-encodes any request to the request body. Primarily useful in a client.
+func encodeHTTPGenericRequest(_ context.Context, r *http.Request, request interface{}) error {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(request); err != nil {
+		return err
+	}
+	r.Header.Set("Content-Type", "application/json; charset=utf-8")
+	r.Body = ioutil.NopCloser(&buf)
+	r.ContentLength = int64(buf.Len())
+	return nil
+}
+
+func decodeHTTPSumResponse(_ context.Context, r *http.Response) (interface{}, error) {
+	var resp endpoint2.SumResponse
+	if err := decodeHTTPResponse(r, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func decodeHTTPConcatResponse(_ context.Context, r *http.Response) (interface{}, error) {
+	var resp endpoint2.ConcatResponse
+	if err := decodeHTTPResponse(r, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// 业务错误在response.RetCode中(状态码200)，其他状态码的body为errs.HTTPBody
+func decodeHTTPResponse(r *http.Response, response interface{}) error {
+	if r.StatusCode != http.StatusOK {
+		var body errs.HTTPBody
+		if err := json.NewDecoder(r.Body).Decode(&body); err == nil && body.Err() != nil {
+			return body.Err()
+		}
+		return errs.Internal(fmt.Sprintf("unexpected http status %d", r.StatusCode))
+	}
+	return json.NewDecoder(r.Body).Decode(response)
+}
@@ -0,0 +1,46 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"github.com/go-kit/kit/log"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"gokit_foundation/errs"
+	"net/http/httptest"
+	endpoint2 "new_addsvc/pkg/endpoint"
+	"new_addsvc/pkg/service"
+	"testing"
+)
+
+// client得到的结果和err与直接调用service一致
+func TestHTTPClient(t *testing.T) {
+	logger := log.NewNopLogger()
+	tracer := stdopentracing.NoopTracer{}
+	eps := endpoint2.New(service.NewBasicService(logger), logger, tracer, endpoint2.Deps{})
+	srv := httptest.NewServer(NewHTTPHandler(eps, tracer, logger))
+	defer srv.Close()
+
+	cli, err := MakeHTTPClientEndpoints(srv.URL, nil, tracer, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if v, err := cli.Sum(ctx, 1, 2); err != nil || v != 3 {
+		t.Errorf("sum got v:%d err:%v", v, err)
+	}
+	if v, err := cli.Concat(ctx, "x", "y"); err != nil || v != "xy" {
+		t.Errorf("concat got v:%s err:%v", v, err)
+	}
+	// 业务错误(ret_code)
+	if _, err := cli.Concat(ctx, "0123456789", "y"); !errors.Is(err, service.ErrMaxSizeExceeded) {
+		t.Errorf("concat got err:%v want ErrMaxSizeExceeded", err)
+	}
+	// 参数校验失败(400)，还原为*errs.Error
+	if _, err := cli.Concat(ctx, "", ""); errs.KindOf(err) != errs.KindInvalid || errs.From(err).Details["a"] == "" {
+		t.Errorf("concat got err:%#v", err)
+	}
+
+	if _, err := MakeHTTPClientEndpoints("", nil, tracer, logger); err == nil {
+		t.Error("want err")
+	}
+}
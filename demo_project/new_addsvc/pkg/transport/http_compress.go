@@ -0,0 +1,300 @@
+package transport
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+/*
+http服务的压缩：
+-	响应：client请求头带有Accept-Encoding: gzip或deflate时(都接受时优先gzip，q=0表示不接受)，压缩不小于minSize字节的响应，
+	小响应压缩后可能更大，而且浪费cpu，所以不压缩
+-	请求：Content-Encoding为gzip或deflate的请求body透明解压，handler读到的是解压后的内容，
+	其他编码返回415，解压后超过maxDecompressedSize时读取body返回err(防止压缩炸弹)
+-	deflate按HTTP规范(RFC 7230)为zlib格式，不是裸的deflate流
+-	bytes统计body压缩前(uncompressed)和线路上(wire)的字节数，labels与grpc相同(见gokit_foundation.NewGRPCCompressionStatsHandler)：
+	direction(in、out)、kind(wire、uncompressed)，没有压缩的body两者相等
+*/
+
+// 默认压缩阈值
+const DefaultCompressMinSize = 1024
+
+// 请求body解压后的上限
+const maxDecompressedSize = 16 << 20
+
+const (
+	encodingGzip    = "gzip"
+	encodingDeflate = "deflate"
+)
+
+var errDecompressedTooLarge = errors.New("request body too large after decompression")
+
+// 每次Read都计入counter
+type countingReader struct {
+	io.ReadCloser
+	n metrics.Counter
+}
+
+func (r countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n.Add(float64(n))
+	return n, err
+}
+
+// 解压后的body，Close时同时关闭原始body
+type decompressReader struct {
+	io.Reader
+	zr   io.Closer
+	body io.Closer
+	left int64
+}
+
+func (r *decompressReader) Read(p []byte) (int, error) {
+	if r.left <= 0 {
+		return 0, errDecompressedTooLarge
+	}
+	if int64(len(p)) > r.left {
+		p = p[:r.left]
+	}
+	n, err := r.Reader.Read(p)
+	r.left -= int64(n)
+	return n, err
+}
+
+func (r *decompressReader) Close() error {
+	r.zr.Close()
+	return r.body.Close()
+}
+
+type countingWriter struct {
+	w io.Writer
+	n metrics.Counter
+}
+
+func (w countingWriter) Write(b []byte) (int, error) {
+	n, err := w.w.Write(b)
+	w.n.Add(float64(n))
+	return n, err
+}
+
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string // 为空时不压缩
+	level    int
+	minSize  int
+	status   int
+	// 已写出状态码，skip时每次Write都会调用flushHeader
+	wroteHeader bool
+	buf         []byte
+	zw          io.WriteCloser
+	wire        io.Writer // 线路上的字节数计入bytes
+	raw         metrics.Counter
+	skip        bool // handler自行设置了Content-Encoding，不再压缩
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	w.raw.Add(float64(len(b)))
+	if w.zw != nil {
+		return w.zw.Write(b)
+	}
+	if w.skip {
+		w.flushHeader()
+		return w.wire.Write(b)
+	}
+	if w.encoding == "" || w.ResponseWriter.Header().Get("Content-Encoding") != "" {
+		w.skip = true
+		w.flushHeader()
+		return w.wire.Write(b)
+	}
+	w.buf = append(w.buf, b...)
+	if len(w.buf) >= w.minSize {
+		if err := w.startCompress(); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// 写出响应头，把已缓冲的内容写入压缩流
+func (w *compressWriter) startCompress() error {
+	h := w.ResponseWriter.Header()
+	h.Set("Content-Encoding", w.encoding)
+	h.Del("Content-Length")
+	if h.Get("Content-Type") == "" && len(w.buf) > 0 {
+		// 与http.ResponseWriter一样根据内容推断，否则会被推断为gzip
+		h.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+	w.flushHeader()
+	// level已在CompressMiddleware中检查
+	if w.encoding == encodingGzip {
+		w.zw, _ = gzip.NewWriterLevel(w.wire, w.level)
+	} else {
+		w.zw, _ = zlib.NewWriterLevel(w.wire, w.level)
+	}
+	_, err := w.zw.Write(w.buf)
+	w.buf = nil
+	return err
+}
+
+// 压缩流的Flush，gzip.Writer和zlib.Writer都实现
+type flushWriter interface {
+	Flush() error
+}
+
+// Flush 流式响应(如SSE)不再等待压缩阈值，先刷新压缩流再刷新底层的ResponseWriter
+func (w *compressWriter) Flush() {
+	if w.zw == nil && !w.skip {
+		if w.encoding == "" || w.ResponseWriter.Header().Get("Content-Encoding") != "" {
+			w.skip = true
+			w.flushHeader()
+			w.wire.Write(w.buf)
+			w.buf = nil
+		} else if err := w.startCompress(); err != nil {
+			return
+		}
+	}
+	if w.zw != nil {
+		if err := w.zw.(flushWriter).Flush(); err != nil {
+			return
+		}
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *compressWriter) flushHeader() {
+	if w.status != 0 && !w.wroteHeader {
+		w.wroteHeader = true
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+}
+
+// 请求结束时调用，未达到压缩阈值的响应原样写出
+func (w *compressWriter) close() error {
+	if w.zw != nil {
+		return w.zw.Close()
+	}
+	if w.skip {
+		return nil
+	}
+	w.flushHeader()
+	if len(w.buf) > 0 {
+		_, err := w.wire.Write(w.buf)
+		return err
+	}
+	return nil
+}
+
+// 按Accept-Encoding选择响应的编码，q值相同时优先gzip，都不接受时返回空
+func acceptEncoding(r *http.Request) string {
+	var best string
+	var bestQ float64
+	for _, enc := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		parts := strings.Split(enc, ";")
+		name := strings.ToLower(strings.TrimSpace(parts[0]))
+		if name != encodingGzip && name != encodingDeflate {
+			continue
+		}
+		q := 1.0
+		for _, param := range parts[1:] {
+			if v := strings.ToLower(strings.TrimSpace(param)); strings.HasPrefix(v, "q=") {
+				if f, err := strconv.ParseFloat(strings.TrimSpace(v[2:]), 64); err == nil {
+					q = f
+				}
+			}
+		}
+		if q > bestQ || (q == bestQ && q > 0 && name == encodingGzip) {
+			best, bestQ = name, q
+		}
+	}
+	if bestQ <= 0 {
+		return ""
+	}
+	return best
+}
+
+// 按Content-Encoding解压请求body，不支持的编码返回false
+func decompressRequest(r *http.Request, wire, raw metrics.Counter) (bool, error) {
+	body := countingReader{ReadCloser: r.Body, n: wire}
+	var (
+		zr  io.ReadCloser
+		err error
+	)
+	switch enc := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))); enc {
+	case "", "identity":
+		r.Body = countingReader{ReadCloser: body, n: raw}
+		return true, nil
+	case encodingGzip:
+		zr, err = gzip.NewReader(body)
+	case encodingDeflate:
+		zr, err = zlib.NewReader(body)
+	default:
+		return false, nil
+	}
+	if err != nil {
+		return true, err
+	}
+	r.Body = countingReader{ReadCloser: &decompressReader{Reader: zr, zr: zr, body: body, left: maxDecompressedSize}, n: raw}
+	// handler看到的是解压后的body
+	r.Header.Del("Content-Encoding")
+	r.Header.Del("Content-Length")
+	r.ContentLength = -1
+	return true, nil
+}
+
+// 创建一个压缩mw，skipPaths中的路径不处理(以/结尾的按前缀匹配)，如/metrics(prometheus自己处理压缩)
+// level为gzip.DefaultCompression或1~9，不合法时使用默认级别，bytes为nil时不统计
+func CompressMiddleware(minSize, level int, bytes metrics.Counter, skipPaths ...string) func(http.Handler) http.Handler {
+	if level < gzip.DefaultCompression || level > gzip.BestCompression {
+		level = gzip.DefaultCompression
+	}
+	skip := func(path string) bool {
+		for _, p := range skipPaths {
+			if path == p || (strings.HasSuffix(p, "/") && strings.HasPrefix(path, p)) {
+				return true
+			}
+		}
+		return false
+	}
+	if bytes == nil {
+		bytes = discard.NewCounter()
+	}
+	inWire, inRaw := bytes.With("direction", "in", "kind", "wire"), bytes.With("direction", "in", "kind", "uncompressed")
+	outWire, outRaw := bytes.With("direction", "out", "kind", "wire"), bytes.With("direction", "out", "kind", "uncompressed")
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if skip(r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if ok, err := decompressRequest(r, inWire, inRaw); !ok {
+				w.Header().Set("Accept-Encoding", "gzip, deflate")
+				http.Error(w, "unsupported Content-Encoding", http.StatusUnsupportedMediaType)
+				return
+			} else if err != nil {
+				http.Error(w, "invalid compressed body: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			// 响应内容随Accept-Encoding变化，告诉缓存服务器按这个请求头区分缓存
+			w.Header().Add("Vary", "Accept-Encoding")
+			cw := &compressWriter{ResponseWriter: w, encoding: acceptEncoding(r), level: level, minSize: minSize,
+				wire: countingWriter{w: w, n: outWire}, raw: outRaw}
+			defer cw.close()
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package transport
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"github.com/go-kit/kit/metrics"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCompressMiddleware(t *testing.T) {
+	large := strings.Repeat("abcdefgh", 1024)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/large", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// 分多次写入
+		w.Write([]byte(large[:100]))
+		w.Write([]byte(large[100:]))
+	})
+	mux.HandleFunc("/small", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("small"))
+	})
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(large))
+	})
+	h := CompressMiddleware(DefaultCompressMinSize, gzip.DefaultCompression, nil, "/metrics")(mux)
+
+	do := func(path, acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	// 大响应被压缩
+	w := do("/large", "gzip, deflate")
+	if w.Header().Get("Content-Encoding") != "gzip" || w.Header().Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("large: got headers:%v", w.Header())
+	}
+	if w.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("large: got Content-Type:%s", w.Header().Get("Content-Type"))
+	}
+	gr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(gr)
+	if string(body) != large {
+		t.Errorf("large: decompressed body mismatch, len:%d", len(body))
+	}
+
+	// 小响应不压缩，状态码保持不变
+	w = do("/small", "gzip")
+	if w.Header().Get("Content-Encoding") != "" || w.Code != http.StatusCreated || w.Body.String() != "small" {
+		t.Errorf("small: got code:%d headers:%v body:%s", w.Code, w.Header(), w.Body.String())
+	}
+	if w.Header().Get("Vary") != "Accept-Encoding" {
+		t.Errorf("small: want Vary header")
+	}
+
+	// client不接受gzip
+	for _, ae := range []string{"", "gzip;q=0", "gzip; Q=0.0", "gzip;level=1;q=0", "br"} {
+		w = do("/large", ae)
+		if w.Header().Get("Content-Encoding") != "" || w.Body.String() != large {
+			t.Errorf("Accept-Encoding:%q should not be compressed", ae)
+		}
+	}
+	// 只接受deflate或deflate的q值更高
+	for _, ae := range []string{"deflate", "gzip;q=0.5, deflate"} {
+		w = do("/large", ae)
+		if w.Header().Get("Content-Encoding") != "deflate" {
+			t.Errorf("Accept-Encoding:%q got headers:%v", ae, w.Header())
+			continue
+		}
+		zr, err := zlib.NewReader(w.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if body, _ := ioutil.ReadAll(zr); string(body) != large {
+			t.Errorf("deflate: decompressed body mismatch, len:%d", len(body))
+		}
+	}
+
+	// 跳过/metrics
+	w = do("/metrics", "gzip")
+	if w.Header().Get("Content-Encoding") != "" || w.Header().Get("Vary") != "" {
+		t.Errorf("/metrics should be skipped, got headers:%v", w.Header())
+	}
+}
+
+// 流式响应每次Flush都能读到已写入的内容
+func TestCompressMiddlewareFlush(t *testing.T) {
+	for _, ae := range []string{"gzip", "deflate", ""} {
+		rec := httptest.NewRecorder()
+		var flushed []string
+		h := CompressMiddleware(DefaultCompressMinSize, gzip.DefaultCompression, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			for i := 0; i < 2; i++ {
+				fmt.Fprintf(w, "data: %d\n\n", i)
+				w.(http.Flusher).Flush()
+				flushed = append(flushed, readPartial(t, ae, rec.Body.Bytes()))
+			}
+		}))
+		req := httptest.NewRequest(http.MethodGet, "/events", nil)
+		req.Header.Set("Accept-Encoding", ae)
+		h.ServeHTTP(rec, req)
+		if !rec.Flushed || rec.Header().Get("Content-Encoding") != ae {
+			t.Errorf("Accept-Encoding:%q got flushed:%v headers:%v", ae, rec.Flushed, rec.Header())
+		}
+		if want := []string{"data: 0\n\n", "data: 0\n\ndata: 1\n\n"}; strings.Join(flushed, "|") != strings.Join(want, "|") {
+			t.Errorf("Accept-Encoding:%q got flushed:%q", ae, flushed)
+		}
+	}
+}
+
+// 解压还没有结束的压缩流
+func readPartial(t *testing.T, encoding string, b []byte) string {
+	var (
+		r   io.Reader = bytes.NewReader(b)
+		err error
+	)
+	switch encoding {
+	case encodingGzip:
+		r, err = gzip.NewReader(r)
+	case encodingDeflate:
+		r, err = zlib.NewReader(r)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(r)
+	return string(body)
+}
+
+// 按所有label的值分别计数
+type bytesCounter struct {
+	mu     *sync.Mutex
+	counts map[string]float64
+	labels string
+}
+
+func (c bytesCounter) With(lvs ...string) metrics.Counter {
+	return bytesCounter{mu: c.mu, counts: c.counts, labels: c.labels + strings.Join(lvs, "/")}
+}
+
+func (c bytesCounter) Add(d float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts[c.labels] += d
+}
+
+func TestCompressMiddlewareRequest(t *testing.T) {
+	counter := bytesCounter{mu: new(sync.Mutex), counts: map[string]float64{}}
+	h := CompressMiddleware(DefaultCompressMinSize, gzip.BestSpeed, counter)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, "%d:%s", len(body), r.Header.Get("Content-Encoding"))
+	}))
+	do := func(encoding string, body []byte) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/sum", bytes.NewReader(body))
+		r.Header.Set("Content-Encoding", encoding)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+	compress := func(encoding string, b []byte) []byte {
+		var buf bytes.Buffer
+		var zw io.WriteCloser = zlib.NewWriter(&buf)
+		if encoding == "gzip" {
+			zw = gzip.NewWriter(&buf)
+		}
+		zw.Write(b)
+		zw.Close()
+		return buf.Bytes()
+	}
+
+	// 解压后交给handler，handler看不到Content-Encoding
+	raw := []byte(strings.Repeat(`{"a": 1, "b": 2}`, 100))
+	for _, enc := range []string{"gzip", "deflate"} {
+		w := do(enc, compress(enc, raw))
+		if w.Code != http.StatusOK || w.Body.String() != fmt.Sprintf("%d:", len(raw)) {
+			t.Errorf("encoding:%s got code:%d body:%s", enc, w.Code, w.Body)
+		}
+	}
+	counter.mu.Lock()
+	if in, wire := counter.counts["direction/in/kind/uncompressed"], counter.counts["direction/in/kind/wire"]; in != float64(2*len(raw)) || wire <= 0 || wire >= in/10 {
+		t.Errorf("got counts:%v", counter.counts)
+	}
+	counter.mu.Unlock()
+
+	// 不支持的编码、不合法的压缩内容
+	if w := do("br", raw); w.Code != http.StatusUnsupportedMediaType || w.Header().Get("Accept-Encoding") != "gzip, deflate" {
+		t.Errorf("got code:%d headers:%v", w.Code, w.Header())
+	}
+	if w := do("gzip", raw); w.Code != http.StatusBadRequest {
+		t.Errorf("got code:%d", w.Code)
+	}
+	// 解压后超过上限
+	if w := do("gzip", compress("gzip", make([]byte, maxDecompressedSize+1))); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "too large") {
+		t.Errorf("got code:%d body:%.100s", w.Code, w.Body)
+	}
+}
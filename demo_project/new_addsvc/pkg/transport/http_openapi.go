@@ -0,0 +1,26 @@
+package transport
+
+import (
+	"gokit_foundation/errs"
+	"gokit_foundation/openapi"
+	endpoint2 "new_addsvc/pkg/endpoint"
+)
+
+// OpenAPI HTTP/JSON transport的接口文档(见NewHTTPHandler、NewHTTPHandlerV2)，schema由请求/响应的struct生成，
+// 新增或修改接口时同步修改这里，TestOpenAPI检查文档中的路径都能访问
+func OpenAPI(version string) *openapi.Doc {
+	return openapi.New("addsvc HTTP/JSON API", version).
+		Add(
+			openapi.Operation{Path: "/sum", Summary: "a+b，结果超出范围时ret_code不为0",
+				Request: endpoint2.SumRequest{}, Response: endpoint2.SumResponse{}},
+			openapi.Operation{Path: "/concat", Summary: "a和b拼接，a、b至少有一个不为空",
+				Request: endpoint2.ConcatRequest{}, Response: endpoint2.ConcatResponse{}},
+			openapi.Operation{Path: "/batch_sum", Summary: "批量sum，响应的items与请求一一对应",
+				Request: endpoint2.BatchSumRequest{}, Response: endpoint2.BatchSumResponse{}},
+			openapi.Operation{Path: "/v2/sum", Summary: "v2：a+b，int64编码为字符串，溢出时按overflow返回错误或饱和的结果",
+				Request: endpoint2.SumV2Request{}, Response: endpoint2.SumV2Response{}},
+			openapi.Operation{Path: "/v2/concat", Summary: "v2：与/concat相同",
+				Request: endpoint2.ConcatRequest{}, Response: endpoint2.ConcatResponse{}},
+		).
+		ErrorResponse(errs.HTTPBody{})
+}
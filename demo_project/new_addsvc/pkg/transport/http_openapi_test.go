@@ -0,0 +1,55 @@
+package transport
+
+import (
+	"github.com/go-kit/kit/log"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"net/http"
+	"net/http/httptest"
+	endpoint2 "new_addsvc/pkg/endpoint"
+	"new_addsvc/pkg/service"
+	"strings"
+	"testing"
+)
+
+func TestOpenAPI(t *testing.T) {
+	logger := log.NewNopLogger()
+	tracer := stdopentracing.NoopTracer{}
+	eps := endpoint2.New(service.NewBasicService(logger), logger, tracer, endpoint2.Deps{})
+	mux := http.NewServeMux()
+	mux.Handle("/", NewHTTPHandler(eps, tracer, logger))
+	mux.Handle("/v2/", NewHTTPHandlerV2(endpoint2.NewV2(service.NewBasicService(logger), logger, tracer, endpoint2.Deps{}), tracer, logger))
+	h := http.Handler(mux)
+
+	spec := OpenAPI("v1").Spec()
+	if len(spec.Paths) != 5 {
+		t.Errorf("got paths:%v", spec.Paths)
+	}
+	// 文档中的路径都由NewHTTPHandler或NewHTTPHandlerV2处理
+	for p, ops := range spec.Paths {
+		for method := range ops {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(strings.ToUpper(method), p, strings.NewReader(`{}`)))
+			if w.Code == http.StatusNotFound {
+				t.Errorf("%s %s not served", method, p)
+			}
+		}
+	}
+	// 参数校验的范围与validate tag一致
+	a := spec.Components.Schemas["SumRequest"].Properties["a"]
+	if a.Minimum == nil || *a.Minimum != -9007199254740991 || *a.Maximum != 9007199254740991 {
+		t.Errorf("got a:%+v", a)
+	}
+	// v2的int64为字符串
+	if a := spec.Components.Schemas["SumV2Request"].Properties["a"]; a.Type != "string" {
+		t.Errorf("got v2 a:%+v", a)
+	}
+	if items := spec.Components.Schemas["BatchSumRequest"].Properties["items"]; *items.MaxItems != 100 || items.Items.Ref != "#/components/schemas/SumRequest" {
+		t.Errorf("got items:%+v", items)
+	}
+	if rc := spec.Components.Schemas["SumResponse"].Properties["ret_code"]; len(rc.Enum) == 0 {
+		t.Errorf("got ret_code:%+v", rc)
+	}
+	if spec.Components.Schemas["HTTPBody"] == nil {
+		t.Errorf("got schemas:%v", spec.Components.Schemas)
+	}
+}
@@ -0,0 +1,103 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/tracing/opentracing"
+	httptransport "github.com/go-kit/kit/transport/http"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"gokit_foundation/errs"
+	"gokit_foundation/propagation"
+	"net/http"
+	endpoint2 "new_addsvc/pkg/endpoint"
+	service2 "new_addsvc/pkg/service"
+)
+
+/*
+HTTP/JSON transport，与grpc transport共用同一组endpoints，REST client可以不经过api网关直接调用
+	POST /sum     {"a": 1, "b": 2}      => {"v": 3, "ret_code": 0}
+	POST /concat  {"a": "x", "b": "y"}  => {"v": "xy", "ret_code": 0}
+	POST /batch_sum  {"items": [{"a": 1, "b": 2}, {"a": 0, "b": 0}]}  => {"items": [{"v": 3, "ret_code": 0}, {"v": 0, "ret_code": 1001}]}
+与grpc一样，业务错误通过ret_code返回(http状态码为200)，endpoint层返回的err(参数校验、限流、断路器等)才会使用对应的http状态码(见errs.Mapper)
+*/
+
+// NewHTTPHandler returns an HTTP handler that makes a set of endpoints
+// available on predefined paths.
+func NewHTTPHandler(endpoints endpoint2.AddSvcEndpoints, otTracer stdopentracing.Tracer, logger log.Logger) http.Handler {
+	options := []httptransport.ServerOption{
+		httptransport.ServerErrorEncoder(errorEncoder),
+		httptransport.ServerErrorHandler(errs.NewLogErrorHandler(logger)),
+		// JWT、traceparent、X-Request-Id、X-Tenant-Id、X-User-Id、X-Priority、X-Request-Timeout等，见propagation.Fields
+		propagation.HTTPServerBefore(),
+	}
+
+	m := http.NewServeMux()
+	m.Handle("/sum", httptransport.NewServer(
+		endpoints.SumEndpoint,
+		decodeHTTPSumRequest,
+		encodeHTTPGenericResponse,
+		append(options, httptransport.ServerBefore(opentracing.HTTPToContext(otTracer, "Sum", logger)))...,
+	))
+	m.Handle("/concat", httptransport.NewServer(
+		endpoints.ConcatEndpoint,
+		decodeHTTPConcatRequest,
+		encodeHTTPGenericResponse,
+		append(options, httptransport.ServerBefore(opentracing.HTTPToContext(otTracer, "Concat", logger)))...,
+	))
+	// {"items": [{"a": 1, "b": 2}, ...]}，每一项的ret_code见endpoint.MakeBatchSumEndpoint
+	m.Handle("/batch_sum", httptransport.NewServer(
+		endpoints.BatchSumEndpoint,
+		decodeHTTPBatchSumRequest,
+		encodeHTTPGenericResponse,
+		append(options, httptransport.ServerBefore(opentracing.HTTPToContext(otTracer, "BatchSum", logger)))...,
+	))
+	return m
+}
+
+// 请求body无法解析时返回，与参数校验失败的Code相同
+func errBadRequest(err error) error {
+	return errs.Invalid(err.Error()).WithCode(service2.CodeInvalidArgs).Wrap(err)
+}
+
+// endpoint返回的err统一由errs编码，body格式见errs.HTTPBody
+func errorEncoder(ctx context.Context, err error, w http.ResponseWriter) {
+	errMapper().EncodeHTTPError(ctx, endpoint2.ClassifyError(err), w)
+}
+
+// decodeHTTPSumRequest is a transport/http.DecodeRequestFunc that decodes a
+// JSON-encoded sum request from the HTTP request body. Primarily useful in a
+// server.
+func decodeHTTPSumRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req endpoint2.SumRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, errBadRequest(err)
+	}
+	return &req, nil
+}
+
+// decodeHTTPConcatRequest is a transport/http.DecodeRequestFunc that decodes a
+// JSON-encoded concat request from the HTTP request body. Primarily useful in a
+// server.
+func decodeHTTPConcatRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req endpoint2.ConcatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, errBadRequest(err)
+	}
+	return &req, nil
+}
+
+func decodeHTTPBatchSumRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req endpoint2.BatchSumRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, errBadRequest(err)
+	}
+	return &req, nil
+}
+
+// encodeHTTPGenericResponse is a transport/http.EncodeResponseFunc that encodes
+// the response as JSON to the response writer. Primarily useful in a server.
+func encodeHTTPGenericResponse(_ context.Context, w http.ResponseWriter, response interface{}) error {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	return json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,103 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/ratelimit"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"github.com/sony/gobreaker"
+	"gokit_foundation/auth"
+	"gokit_foundation/deadline"
+	"gokit_foundation/errs"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"net/http/httptest"
+	"new_addsvc/config"
+	endpoint2 "new_addsvc/pkg/endpoint"
+	"new_addsvc/pkg/service"
+	"strings"
+	"testing"
+)
+
+func TestHTTPHandler(t *testing.T) {
+	logger := log.NewNopLogger()
+	tracer := stdopentracing.NoopTracer{}
+	eps := endpoint2.New(service.NewBasicService(logger), logger, tracer, endpoint2.Deps{})
+	h := NewHTTPHandler(eps, tracer, logger)
+
+	test := []struct {
+		name       string
+		path, body string
+		header     http.Header
+		wantCode   int
+		wantBody   string
+	}{
+		{name: "[sum]", path: "/sum", body: `{"a": 1, "b": 2}`, wantCode: 200, wantBody: `{"v":3,"ret_code":0}`},
+		{name: "[concat]", path: "/concat", body: `{"a": "x", "b": "y"}`, wantCode: 200, wantBody: `{"v":"xy","ret_code":0}`},
+		{name: "[concat biz err]", path: "/concat", body: `{"a": "0123456789", "b": "y"}`, wantCode: 200, wantBody: `"ret_code":1001`},
+		{name: "[bad json]", path: "/concat", body: `{"a":`, wantCode: 400, wantBody: `"code":101`},
+		{name: "[invalid]", path: "/concat", body: `{}`, wantCode: 400, wantBody: `"details":{"a":`},
+		{name: "[batch sum]", path: "/batch_sum", body: `{"items": [{"a": 1, "b": 2}, {"a": 0, "b": 0}]}`, wantCode: 200,
+			wantBody: `{"items":[{"v":3,"ret_code":0},{"v":0,"ret_code":1001}]}`},
+		{name: "[batch sum empty]", path: "/batch_sum", body: `{"items": []}`, wantCode: 400, wantBody: `"details":{"items":`},
+		// 调用方的剩余时间不足，server直接拒绝
+		{name: "[budget exhausted]", path: "/sum", body: `{"a": 1, "b": 2}`, header: http.Header{deadline.Header: {"1ms"}}, wantCode: 504,
+			wantBody: `deadline budget exhausted`},
+		{name: "[not found]", path: "/xxx", body: `{}`, wantCode: 404},
+	}
+	for _, tt := range test {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+		for k, v := range tt.header {
+			r.Header[k] = v
+		}
+		h.ServeHTTP(w, r)
+		if w.Code != tt.wantCode || !strings.Contains(w.Body.String(), tt.wantBody) {
+			t.Errorf("name:%s got code:%d body:%s, want code:%d body contains:%s", tt.name, w.Code, w.Body.String(), tt.wantCode, tt.wantBody)
+		}
+	}
+}
+
+func TestErrorEncoder(t *testing.T) {
+	test := []struct {
+		err      error
+		wantCode int
+	}{
+		{err: auth.ErrTokenMissing, wantCode: http.StatusUnauthorized},
+		{err: endpoint2.ErrForbidden, wantCode: http.StatusForbidden},
+		{err: endpoint2.ErrTooManyRequests, wantCode: http.StatusTooManyRequests},
+		{err: ratelimit.ErrLimited, wantCode: http.StatusTooManyRequests},
+		{err: gobreaker.ErrOpenState, wantCode: http.StatusServiceUnavailable},
+		{err: endpoint2.ErrInvalidRequest.WithDetails(map[string]string{"a": "empty"}), wantCode: http.StatusBadRequest},
+		{err: service.ErrMaxSizeExceeded, wantCode: http.StatusBadRequest},
+		{err: errors.New("redis: connection refused"), wantCode: http.StatusInternalServerError},
+	}
+	for _, tt := range test {
+		w := httptest.NewRecorder()
+		errorEncoder(context.Background(), tt.err, w)
+		if w.Code != tt.wantCode {
+			t.Errorf("err:%v got code:%d want:%d", tt.err, w.Code, tt.wantCode)
+		}
+		var body errs.HTTPBody
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Error != tt.err.Error() {
+			t.Errorf("err:%v got body:%s", tt.err, w.Body.String())
+		}
+	}
+
+	// 注册的映射优先，未覆盖的错误不变
+	errs.Register(config.SvcName, errs.NewMapper().MapCode(errs.CodeOf(endpoint2.ErrInvalidRequest), codes.FailedPrecondition, http.StatusUnprocessableEntity))
+	defer errs.Register(config.SvcName, nil)
+	for err, wantCode := range map[error]int{endpoint2.ErrInvalidRequest: http.StatusUnprocessableEntity, endpoint2.ErrForbidden: http.StatusForbidden} {
+		w := httptest.NewRecorder()
+		errorEncoder(context.Background(), err, w)
+		if w.Code != wantCode {
+			t.Errorf("err:%v got code:%d want:%d", err, w.Code, wantCode)
+		}
+	}
+	if got := status.Code(errMapper().ToGRPC(endpoint2.ErrInvalidRequest)); got != codes.FailedPrecondition {
+		t.Errorf("got grpc code:%v", got)
+	}
+}
@@ -0,0 +1,111 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/go-kit/kit/log"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"gokit_foundation/errs"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"new_addsvc/config"
+	pb "new_addsvc/pb/gen-go/addsvcpb"
+	"new_addsvc/pb/gen-go/addsvcthrift"
+	endpoint2 "new_addsvc/pkg/endpoint"
+	"new_addsvc/pkg/service"
+	"strings"
+	"testing"
+	"time"
+)
+
+// config.Limits对所有transport生效，错误与参数校验失败相同
+func TestLimitsAcrossTransports(t *testing.T) {
+	config.SetDynamicKV(map[string][]byte{"limits": []byte(`{"max_operand": 100, "max_str_len": 3}`)})
+	if err := config.ReloadDynamic(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		config.SetDynamicKV(nil)
+		_ = config.ReloadDynamic()
+	}()
+
+	logger := log.NewNopLogger()
+	tracer := stdopentracing.NoopTracer{}
+	eps := endpoint2.New(service.NewBasicService(logger), logger, tracer, endpoint2.Deps{})
+	ctx := context.Background()
+
+	// HTTP：400，details为超出上限的字段
+	h := NewHTTPHandler(eps, tracer, logger)
+	for path, body := range map[string]string{"/sum": `{"a": 101, "b": 1}`, "/concat": `{"a": "abcd", "b": "x"}`} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `"code":101`) || !strings.Contains(w.Body.String(), `"a":`) {
+			t.Errorf("http path:%s got code:%d body:%s", path, w.Code, w.Body)
+		}
+	}
+	// BatchSum只有超出上限的项失败
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/batch_sum", strings.NewReader(`{"items": [{"a": 1, "b": 2}, {"a": -101, "b": 1}]}`)))
+	if w.Body.String() != `{"items":[{"v":3,"ret_code":0},{"v":0,"ret_code":101}]}`+"\n" {
+		t.Errorf("http batch_sum got body:%s", w.Body)
+	}
+
+	// grpc：还原为ErrInvalidRequest，details不丢失
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer()
+	pb.RegisterAddServer(srv, NewGRPCServer(eps, tracer, logger))
+	go srv.Serve(lis)
+	defer srv.Stop()
+	cc, err := grpc.Dial("bufconn", grpc.WithInsecure(), grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+		return lis.Dial()
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cc.Close()
+	grpcCli := NewGRPCClient(cc, tracer, logger)
+	if _, err := grpcCli.Sum(ctx, 1, 101); !errors.Is(err, endpoint2.ErrInvalidRequest) || errs.From(err).Details["b"] != "magnitude must be at most 100" {
+		t.Errorf("grpc sum got err:%v", err)
+	}
+	if _, err := grpcCli.Concat(ctx, "x", "abcd"); !errors.Is(err, endpoint2.ErrInvalidRequest) || errs.From(err).Details["b"] != "length must be at most 3" {
+		t.Errorf("grpc concat got err:%v", err)
+	}
+	if v, err := grpcCli.Sum(ctx, 100, -1); err != nil || v != 99 {
+		t.Errorf("grpc sum got v:%d err:%v", v, err)
+	}
+
+	// NATS：err可以识别为参数错误
+	nc, cleanup := newTestNATS(t)
+	defer cleanup()
+	if _, err := SubscribeNATS(nc, eps, logger); err != nil {
+		t.Fatal(err)
+	}
+	natsCli := MakeNATSClientEndpoints(nc, time.Second)
+	if _, err := natsCli.Sum(ctx, 101, 1); errs.KindOf(err) != errs.KindInvalid || errs.CodeOf(err) != service.CodeInvalidArgs {
+		t.Errorf("nats sum got err:%v", err)
+	}
+
+	// thrift：endpoint层的err只保留错误信息
+	socket, err := thrift.NewTServerSocket("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	thriftSrv := thrift.NewTSimpleServer4(addsvcthrift.NewAddServiceProcessor(NewThriftServer(eps)), socket, ThriftTransportFactory(), ThriftProtocolFactory)
+	if err = thriftSrv.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	go thriftSrv.AcceptLoop()
+	client, trans, err := DialThrift(socket.Addr().String(), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewThriftClient(client).Concat(ctx, "abcd", "x"); err == nil || !strings.Contains(err.Error(), "exceeds limits") {
+		t.Errorf("thrift concat got err:%v", err)
+	}
+	trans.Close()
+	thriftSrv.Stop()
+}
@@ -0,0 +1,142 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"github.com/go-kit/kit/log"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"gokit_foundation/auth"
+	"gokit_foundation/memtransport"
+	"gokit_foundation/reqid"
+	"new_addsvc/config"
+	pb "new_addsvc/pb/gen-go/addsvcpb"
+	endpoint2 "new_addsvc/pkg/endpoint"
+	"new_addsvc/pkg/service"
+	"testing"
+)
+
+// 与NewGRPCClient相同的编解码，请求经过memtransport直接交给grpcServer处理(包括errs.ToGRPC)
+func newMemGRPCClient(srv pb.AddServer) endpoint2.AddSvcEndpoints {
+	options := []memtransport.GRPCClientOption{
+		memtransport.GRPCClientBefore(auth.ContextToGRPC(), reqid.ContextToGRPC()),
+		memtransport.GRPCServerInterceptor(reqid.UnaryServerInterceptor()),
+	}
+	sum := memtransport.NewGRPCClient(func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.Sum(ctx, req.(*pb.SumRequest))
+	}, "/addsvcpb.Add/Sum", encodeGRPCSumRequest, decodeGRPCSumResponse, pb.SumReply{}, options...).Endpoint()
+	concat := memtransport.NewGRPCClient(func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.Concat(ctx, req.(*pb.ConcatRequest))
+	}, "/addsvcpb.Add/Concat", encodeGRPCConcatRequest, decodeGRPCConcatResponse, pb.ConcatReply{}, options...).Endpoint()
+	return endpoint2.AddSvcEndpoints{
+		SumEndpoint:    endpoint2.ErrorsMiddleware()(sum),
+		ConcatEndpoint: endpoint2.ErrorsMiddleware()(concat),
+	}
+}
+
+// 不监听端口，覆盖两端的编解码以及完整的endpoint、service中间件链，断言返回值、日志和指标
+func TestFullChainInMemory(t *testing.T) {
+	config.SetDynamicKV(map[string][]byte{"limits": []byte(`{"max_operand": 100}`)})
+	if err := config.ReloadDynamic(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		config.SetDynamicKV(nil)
+		_ = config.ReloadDynamic()
+	}()
+
+	tracer := stdopentracing.NoopTracer{}
+	for _, transport := range []string{"grpc", "http"} {
+		t.Run(transport, func(t *testing.T) {
+			logger := &memtransport.Logger{}
+			duration := memtransport.NewHistogram()
+			ints := memtransport.NewCounter()
+			svc := service.New(logger, nil, ints, nil, nil)
+			eps := endpoint2.New(svc, logger, tracer, endpoint2.Deps{Duration: duration})
+			cli := newMemGRPCClient(NewGRPCServer(eps, tracer, logger))
+			if transport == "http" {
+				var err error
+				cli, err = MakeHTTPClientEndpoints("http://addsvc", memtransport.HTTPClient(NewHTTPHandler(eps, tracer, log.NewNopLogger())), tracer, log.NewNopLogger())
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for _, tt := range []struct {
+				name   string
+				method string
+				call   func(ctx context.Context) (interface{}, error)
+				want   interface{}
+				err    error
+				// service层的日志条数和ints计数(参数校验失败时不会调用service)
+				svcLogs int
+				ints    []float64
+				success string // endpoint层指标的success label
+			}{
+				{
+					name:    "sum",
+					method:  "Sum",
+					call:    func(ctx context.Context) (interface{}, error) { return cli.Sum(ctx, 1, 2) },
+					want:    3,
+					svcLogs: 1,
+					ints:    []float64{3},
+					success: "true",
+				},
+				{
+					name:    "sum two zeroes",
+					method:  "Sum",
+					call:    func(ctx context.Context) (interface{}, error) { return cli.Sum(ctx, 0, 0) },
+					want:    0,
+					err:     service.ErrTwoZeroes,
+					svcLogs: 1,
+					ints:    []float64{0},
+					success: "true",
+				},
+				{
+					name:    "sum exceeds limits",
+					method:  "Sum",
+					call:    func(ctx context.Context) (interface{}, error) { return cli.Sum(ctx, 101, 1) },
+					want:    0,
+					err:     endpoint2.ErrInvalidRequest,
+					success: "false",
+				},
+				{
+					name:    "concat",
+					method:  "Concat",
+					call:    func(ctx context.Context) (interface{}, error) { return cli.Concat(ctx, "a", "b") },
+					want:    "ab",
+					svcLogs: 1,
+					success: "true",
+				},
+				{
+					name:    "concat too long",
+					method:  "Concat",
+					call:    func(ctx context.Context) (interface{}, error) { return cli.Concat(ctx, "0123456789", "y") },
+					want:    "",
+					err:     service.ErrMaxSizeExceeded,
+					svcLogs: 1,
+					success: "true",
+				},
+			} {
+				t.Run(tt.name, func(t *testing.T) {
+					logger.Reset()
+					observed := func() int { return len(duration.Values("method", tt.method, "success", tt.success)) }
+					n, nInts := observed(), len(ints.Values())
+
+					v, err := tt.call(context.Background())
+					if v != tt.want || !errors.Is(err, tt.err) || (tt.err == nil && err != nil) {
+						t.Errorf("got v:%v err:%v want v:%v err:%v", v, err, tt.want, tt.err)
+					}
+					if got := logger.Records("method", tt.method); len(got) != tt.svcLogs {
+						t.Errorf("got service logs:%v", got)
+					}
+					if got := ints.Values()[nInts:]; len(got) != len(tt.ints) || (len(got) > 0 && got[0] != tt.ints[0]) {
+						t.Errorf("got ints:%v want:%v", got, tt.ints)
+					}
+					if got := observed() - n; got != 1 {
+						t.Errorf("got %d observations with success=%s", got, tt.success)
+					}
+				})
+			}
+		})
+	}
+}
@@ -0,0 +1,234 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/transport"
+	natstransport "github.com/go-kit/kit/transport/nats"
+	"github.com/nats-io/nats.go"
+	"gokit_foundation/deadletter"
+	"gokit_foundation/dedup"
+	"gokit_foundation/errs"
+	endpoint2 "new_addsvc/pkg/endpoint"
+	"time"
+)
+
+/*
+NATS transport，与grpc/http transport共用同一组endpoints，同一个服务既可以被RPC调用，也可以作为消息的消费者
+	subject addsvc.sum     {"a": 1, "b": 2}      => {"v": 3, "ret_code": 0}
+	subject addsvc.concat  {"a": "x", "b": "y"}  => {"v": "xy", "ret_code": 0}
+-	以queue group订阅，多个实例之间负载均衡，每条消息只会被其中一个实例处理
+-	消息带reply subject(nc.Request)时返回响应，不带(nc.Publish)时只处理不响应
+-	endpoint层返回的err以errs.HTTPBody的格式响应，client侧还原为*errs.Error，见decodeNATSResponse
+-	NATS(v1.x)的消息没有header，无法传递token和追踪信息，所以server开启auth时NATS调用会被AuthMiddleware拒绝
+-	SubscribeNATSWithDeadLetter：不带reply subject的消息处理失败时没有人知道，可重试的错误退避后重新发布到原来的subject，
+	不可重试的错误以及重试次数用完的消息发布到<subject>.dlq，处理次数等header与body一起编码(见deadletter.Wrap)；
+	NATS没有持久化，等待重试的消息在进程退出时丢失，死信消息也只有当时订阅了<subject>.dlq的consumer才能收到
+-	不带reply subject的消息可以由生产者在header中带上dedup.MessageIDHeader(以deadletter.Wrap编码)，id写入ctx，
+	endpoints包装dedup.Middleware后在去重窗口内只处理一次；重试时重新发布的消息保留该header
+*/
+
+const (
+	NATSSumSubject    = "addsvc.sum"
+	NATSConcatSubject = "addsvc.concat"
+	// 同一个queue group内的订阅者分摊消息
+	NATSQueueGroup = "addsvc"
+)
+
+// SubscribeNATS 在nc上订阅Sum/Concat，任一订阅失败时取消已成功的订阅
+// 返回的订阅由调用方在退出时取消(一般直接nc.Drain，处理完已收到的消息再关闭连接)
+func SubscribeNATS(nc *nats.Conn, endpoints endpoint2.AddSvcEndpoints, logger log.Logger) ([]*nats.Subscription, error) {
+	return subscribeNATS(nc, endpoints, errs.NewLogErrorHandler(logger))
+}
+
+// SubscribeNATSWithDeadLetter 与SubscribeNATS相同，不带reply subject的消息处理失败时按policy重试或发布到<subject>.dlq
+func SubscribeNATSWithDeadLetter(nc *nats.Conn, endpoints endpoint2.AddSvcEndpoints, policy deadletter.Policy, logger log.Logger) ([]*nats.Subscription, error) {
+	router := deadletter.Router{
+		Policy:    policy,
+		Publisher: natsPublisher{nc: nc},
+		// 重新发布到原来的subject，由同一个queue group中的某个实例处理
+		RetryTopic:      func(origin string) string { return origin },
+		DeadLetterTopic: deadletter.DeadLetterTopic,
+	}
+	return subscribeNATS(nc, endpoints, natsDeadLetterHandler{router: router, next: errs.NewLogErrorHandler(logger), logger: logger})
+}
+
+func subscribeNATS(nc *nats.Conn, endpoints endpoint2.AddSvcEndpoints, errorHandler transport.ErrorHandler) ([]*nats.Subscription, error) {
+	options := []natstransport.SubscriberOption{
+		natstransport.SubscriberBefore(natsUnwrap),
+		natstransport.SubscriberErrorEncoder(natsErrorEncoder),
+		natstransport.SubscriberErrorHandler(errorHandler),
+	}
+
+	handlers := map[string]*natstransport.Subscriber{
+		NATSSumSubject: natstransport.NewSubscriber(
+			endpoints.SumEndpoint,
+			decodeNATSSumRequest,
+			natstransport.EncodeJSONResponse,
+			options...,
+		),
+		NATSConcatSubject: natstransport.NewSubscriber(
+			endpoints.ConcatEndpoint,
+			decodeNATSConcatRequest,
+			natstransport.EncodeJSONResponse,
+			options...,
+		),
+	}
+
+	var subs []*nats.Subscription
+	for subject, h := range handlers {
+		sub, err := nc.QueueSubscribe(subject, NATSQueueGroup, h.ServeMsg(nc))
+		if err != nil {
+			for _, s := range subs {
+				_ = s.Unsubscribe()
+			}
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	return subs, nil
+}
+
+type ctxKeyNATSMsg struct{}
+
+// 重试的消息带有处理次数等header(见deadletter.Wrap)，解码前还原body，header写入ctx
+// 带reply subject的消息由调用方等待响应，不去重
+func natsUnwrap(ctx context.Context, msg *nats.Msg) context.Context {
+	headers, data, _ := deadletter.Unwrap(msg.Data)
+	msg.Data = data
+	if id := headers[dedup.MessageIDHeader]; id != "" && msg.Reply == "" {
+		ctx = dedup.WithMessageID(ctx, id)
+	}
+	m := deadletter.Message{Topic: msg.Subject, Value: data, Headers: headers}
+	return context.WithValue(ctx, ctxKeyNATSMsg{}, natsMsg{Message: m, reply: msg.Reply})
+}
+
+type natsMsg struct {
+	deadletter.Message
+	reply string
+}
+
+// 不带reply subject的消息处理失败时交给router，带reply subject的err已经返回给调用方，由调用方决定是否重试
+type natsDeadLetterHandler struct {
+	router deadletter.Router
+	next   transport.ErrorHandler
+	logger log.Logger
+}
+
+func (h natsDeadLetterHandler) Handle(ctx context.Context, err error) {
+	h.next.Handle(ctx, err)
+	m, ok := ctx.Value(ctxKeyNATSMsg{}).(natsMsg)
+	if !ok || m.reply != "" {
+		return
+	}
+	if err := h.router.Route(ctx, m.Message, err); err != nil {
+		h.logger.Log("subject", m.Topic, "err", err, "msg", "route failed")
+	}
+}
+
+type natsPublisher struct {
+	nc *nats.Conn
+}
+
+// 重试的消息在RetryAt之后才发布
+func (p natsPublisher) Publish(_ context.Context, subject string, m deadletter.Message) error {
+	data := deadletter.Wrap(m)
+	if wait := time.Until(m.RetryAt()); wait > 0 {
+		time.AfterFunc(wait, func() { _ = p.nc.Publish(subject, data) })
+		return nil
+	}
+	return p.nc.Publish(subject, data)
+}
+
+// MakeNATSClientEndpoints 返回通过NATS(request-reply)调用server的endpoints，timeout为每次调用等待响应的最长时间
+// 没有server订阅时请求不会失败，而是等到超时，返回KindTimeout
+func MakeNATSClientEndpoints(nc *nats.Conn, timeout time.Duration) endpoint2.AddSvcEndpoints {
+	options := []natstransport.PublisherOption{
+		natstransport.PublisherTimeout(timeout),
+	}
+
+	sumEndpoint := natstransport.NewPublisher(
+		nc,
+		NATSSumSubject,
+		natstransport.EncodeJSONRequest,
+		decodeNATSSumResponse,
+		options...,
+	).Endpoint()
+	concatEndpoint := natstransport.NewPublisher(
+		nc,
+		NATSConcatSubject,
+		natstransport.EncodeJSONRequest,
+		decodeNATSConcatResponse,
+		options...,
+	).Endpoint()
+
+	return endpoint2.AddSvcEndpoints{
+		// 超时等err也转为*errs.Error
+		SumEndpoint:    endpoint2.ErrorsMiddleware()(sumEndpoint),
+		ConcatEndpoint: endpoint2.ErrorsMiddleware()(concatEndpoint),
+	}
+}
+
+// 与http transport一样，err统一由errs编码，body格式见errs.HTTPBody
+func natsErrorEncoder(_ context.Context, err error, reply string, nc *nats.Conn) {
+	b, err := json.Marshal(errs.NewHTTPBody(endpoint2.ClassifyError(err)))
+	if err != nil {
+		return
+	}
+	_ = nc.Publish(reply, b)
+}
+
+// decodeNATSSumRequest is a transport/nats.DecodeRequestFunc that decodes a
+// JSON-encoded sum request from the NATS message. Primarily useful in a server.
+func decodeNATSSumRequest(_ context.Context, msg *nats.Msg) (interface{}, error) {
+	var req endpoint2.SumRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		return nil, errBadRequest(err)
+	}
+	return &req, nil
+}
+
+// decodeNATSConcatRequest is a transport/nats.DecodeRequestFunc that decodes a
+// JSON-encoded concat request from the NATS message. Primarily useful in a
+// server.
+func decodeNATSConcatRequest(_ context.Context, msg *nats.Msg) (interface{}, error) {
+	var req endpoint2.ConcatRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		return nil, errBadRequest(err)
+	}
+	return &req, nil
+}
+
+// decodeNATSSumResponse is a transport/nats.DecodeResponseFunc that decodes a
+// JSON-encoded sum response from the NATS reply. Primarily useful in a client.
+func decodeNATSSumResponse(_ context.Context, msg *nats.Msg) (interface{}, error) {
+	var resp endpoint2.SumResponse
+	if err := decodeNATSResponse(msg, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// decodeNATSConcatResponse is a transport/nats.DecodeResponseFunc that decodes
+// a JSON-encoded concat response from the NATS reply. Primarily useful in a
+// client.
+func decodeNATSConcatResponse(_ context.Context, msg *nats.Msg) (interface{}, error) {
+	var resp endpoint2.ConcatResponse
+	if err := decodeNATSResponse(msg, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// 响应中有error字段时为natsErrorEncoder编码的err，否则为业务响应
+func decodeNATSResponse(msg *nats.Msg, response interface{}) error {
+	var body errs.HTTPBody
+	if err := json.Unmarshal(msg.Data, &body); err != nil {
+		return err
+	}
+	if err := body.Err(); err != nil {
+		return err
+	}
+	return json.Unmarshal(msg.Data, response)
+}
@@ -0,0 +1,190 @@
+package transport
+
+import (
+	"context"
+	"github.com/go-kit/kit/log"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"gokit_foundation/deadletter"
+	"gokit_foundation/dedup"
+	"gokit_foundation/errs"
+	"gokit_foundation/idempotency"
+	endpoint2 "new_addsvc/pkg/endpoint"
+	"new_addsvc/pkg/service"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 启动一个内嵌的nats-server(随机端口)并返回连接
+func newTestNATS(t *testing.T) (*nats.Conn, func()) {
+	s, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: -1, NoLog: true, NoSigs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Start()
+	if !s.ReadyForConnections(2 * time.Second) {
+		t.Fatal("nats server not ready")
+	}
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		s.Shutdown()
+		t.Fatal(err)
+	}
+	return nc, func() {
+		nc.Close()
+		s.Shutdown()
+	}
+}
+
+func TestNATS(t *testing.T) {
+	nc, cleanup := newTestNATS(t)
+	defer cleanup()
+
+	logger := log.NewNopLogger()
+	tracer := stdopentracing.NoopTracer{}
+	eps := endpoint2.New(service.NewBasicService(logger), logger, tracer, endpoint2.Deps{})
+	subs, err := SubscribeNATS(nc, eps, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subs) != 2 {
+		t.Fatalf("got %d subs", len(subs))
+	}
+
+	// client与grpc client一样得到一组endpoints，可以直接当作service调用
+	cli := MakeNATSClientEndpoints(nc, time.Second)
+	ctx := context.Background()
+	if v, err := cli.Sum(ctx, 1, 2); err != nil || v != 3 {
+		t.Errorf("Sum got v:%d err:%v", v, err)
+	}
+	if v, err := cli.Concat(ctx, "x", "y"); err != nil || v != "xy" {
+		t.Errorf("Concat got v:%s err:%v", v, err)
+	}
+	// 参数校验失败，err经过NATS后仍可以识别
+	if _, err := cli.Concat(ctx, "", ""); errs.KindOf(err) != errs.KindInvalid || errs.CodeOf(err) != service.CodeInvalidArgs {
+		t.Errorf("Concat invalid got err:%v", err)
+	}
+
+	// 请求无法解析
+	msg, err := nc.Request(NATSSumSubject, []byte(`{"a":`), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decodeNATSSumResponse(ctx, msg); errs.KindOf(err) != errs.KindInvalid {
+		t.Errorf("bad json got err:%v", err)
+	}
+
+	// 取消订阅后没有消费者，请求等到超时
+	for _, s := range subs {
+		_ = s.Unsubscribe()
+	}
+	cli = MakeNATSClientEndpoints(nc, 50*time.Millisecond)
+	if _, err := cli.Sum(ctx, 1, 2); errs.KindOf(err) != errs.KindTimeout {
+		t.Errorf("no subscriber got err:%v", err)
+	}
+}
+
+// 不带reply的消息：可重试的错误重新发布到原subject，次数用完或不可重试时发布到<subject>.dlq
+func TestNATSDeadLetter(t *testing.T) {
+	nc, cleanup := newTestNATS(t)
+	defer cleanup()
+
+	var mu sync.Mutex
+	calls := 0
+	eps := endpoint2.AddSvcEndpoints{
+		SumEndpoint: func(context.Context, interface{}) (interface{}, error) {
+			mu.Lock()
+			calls++
+			mu.Unlock()
+			return nil, errs.Unavailable("db down")
+		},
+		ConcatEndpoint: func(context.Context, interface{}) (interface{}, error) { return &endpoint2.ConcatResponse{}, nil },
+	}
+	policy := deadletter.Policy{MaxAttempts: 2, BackoffBase: 10 * time.Millisecond, BackoffMax: 10 * time.Millisecond}
+	if _, err := SubscribeNATSWithDeadLetter(nc, eps, policy, log.NewNopLogger()); err != nil {
+		t.Fatal(err)
+	}
+	dlq, err := nc.SubscribeSync(deadletter.DeadLetterTopic(NATSSumSubject))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 不可重试：无法解析
+	if err := nc.Publish(NATSSumSubject, []byte(`{"a":`)); err != nil {
+		t.Fatal(err)
+	}
+	// 可重试：重试1次后进入死信
+	if err := nc.Publish(NATSSumSubject, []byte(`{"a":1,"b":2}`)); err != nil {
+		t.Fatal(err)
+	}
+	var dead []deadletter.Message
+	for len(dead) < 2 {
+		msg, err := dlq.NextMsg(2 * time.Second)
+		if err != nil {
+			t.Fatalf("got dead:%+v err:%v", dead, err)
+		}
+		hs, v, ok := deadletter.Unwrap(msg.Data)
+		if !ok {
+			t.Fatalf("got data:%s", msg.Data)
+		}
+		dead = append(dead, deadletter.Message{Value: v, Headers: hs})
+	}
+	if dead[0].Attempt() != 1 || string(dead[0].Value) != `{"a":` || dead[0].Origin() != NATSSumSubject || dead[0].Error() == "" {
+		t.Errorf("got dead[0]:%+v", dead[0])
+	}
+	mu.Lock()
+	n := calls
+	mu.Unlock()
+	if dead[1].Attempt() != 2 || string(dead[1].Value) != `{"a":1,"b":2}` || n != 2 {
+		t.Errorf("got dead[1]:%+v calls:%d", dead[1], n)
+	}
+
+	// 带reply的请求由调用方处理错误，不进入死信
+	if _, err := MakeNATSClientEndpoints(nc, time.Second).Sum(context.Background(), 1, 2); errs.KindOf(err) != errs.KindUnavailable {
+		t.Errorf("Sum got err:%v", err)
+	}
+	if msg, err := dlq.NextMsg(100 * time.Millisecond); err == nil {
+		t.Errorf("got unexpected dead:%s", msg.Data)
+	}
+}
+
+// 带MessageIDHeader的同一条消息只处理一次，带reply的请求不去重
+func TestNATSDedup(t *testing.T) {
+	nc, cleanup := newTestNATS(t)
+	defer cleanup()
+
+	var mu sync.Mutex
+	calls := 0
+	sum := func(context.Context, interface{}) (interface{}, error) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		return &endpoint2.SumResponse{V: 3}, nil
+	}
+	d := dedup.New(idempotency.NewMemStore(10), "", dedup.Config{Group: "nats", Window: time.Minute}, nil, log.NewNopLogger())
+	eps := endpoint2.AddSvcEndpoints{
+		SumEndpoint:    dedup.Middleware(d)(sum),
+		ConcatEndpoint: func(context.Context, interface{}) (interface{}, error) { return &endpoint2.ConcatResponse{}, nil },
+	}
+	if _, err := SubscribeNATS(nc, eps, log.NewNopLogger()); err != nil {
+		t.Fatal(err)
+	}
+	data := deadletter.Wrap(deadletter.Message{Value: []byte(`{"a":1,"b":2}`), Headers: map[string]string{dedup.MessageIDHeader: "m1"}})
+	for i := 0; i < 2; i++ {
+		if err := nc.Publish(NATSSumSubject, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 同一个订阅中的消息按顺序处理，收到响应时前面的消息已经处理完
+	for i := 0; i < 2; i++ {
+		if _, err := nc.Request(NATSSumSubject, data, time.Second); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if calls != 3 {
+		t.Errorf("got calls:%d", calls)
+	}
+}
@@ -2,26 +2,48 @@ package transport
 
 import (
 	"context"
+	stdendpoint "github.com/go-kit/kit/endpoint"
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/tracing/opentracing"
-	"github.com/go-kit/kit/transport"
 	grpctransport "github.com/go-kit/kit/transport/grpc"
 	stdopentracing "github.com/opentracing/opentracing-go"
+	"gokit_foundation/errs"
+	"gokit_foundation/propagation"
+	"google.golang.org/grpc/metadata"
+	"io"
+	"new_addsvc/config"
 	pb "new_addsvc/pb/gen-go/addsvcpb"
+	"new_addsvc/pb/gen-go/resultcode"
 	endpoint2 "new_addsvc/pkg/endpoint"
 )
 
 // 与endpoint类似，只要在service层添加一个接口，endpoint和transport层都要添加对应的接口，必须保持同步
+// 一元接口的decode/encode函数由proto文件生成，见grpc_gen.go
 type grpcServer struct {
-	sum    grpctransport.Handler
-	concat grpctransport.Handler
+	sum      grpctransport.Handler
+	concat   grpctransport.Handler
+	batchSum grpctransport.Handler
+
+	// 流式接口不经过grpctransport.Handler，直接调用endpoint，见ConcatStream
+	sumEndpoint    stdendpoint.Endpoint
+	concatEndpoint stdendpoint.Endpoint
+	// 各流式接口从metadata中提取信息的函数，key为接口名，见streamContext
+	streamBefore map[string][]grpctransport.ServerRequestFunc
+}
+
+// grpc、http、grpc-gateway共用的错误映射，启动时由errs.Register(config.SvcName, ...)注册(见-error.map)，未注册时为默认映射
+func errMapper() *errs.Mapper {
+	return errs.For(config.SvcName)
 }
 
 // NewGRPCServer makes a set of endpoints available as a gRPC AddServer.
 // 这里也可以返回一个httpSvr(如果使用http作为RPC方式)
 func NewGRPCServer(endpoints endpoint2.AddSvcEndpoints, otTracer stdopentracing.Tracer, logger log.Logger) pb.AddServer {
 	options := []grpctransport.ServerOption{
-		grpctransport.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
+		grpctransport.ServerErrorHandler(errs.NewLogErrorHandler(logger)),
+		// JWT、traceparent、request id、租户、x-user-id、x-priority等，各项见propagation.Fields
+		// request id一般已由reqid.UnaryServerInterceptor写入ctx，这里兼容未安装拦截器的情况
+		propagation.GRPCServerBefore(),
 	}
 
 	return &grpcServer{
@@ -37,13 +59,45 @@ func NewGRPCServer(endpoints endpoint2.AddSvcEndpoints, otTracer stdopentracing.
 			encodeGRPCConcatResponse,
 			append(options, grpctransport.ServerBefore(opentracing.GRPCToContext(otTracer, "Concat", logger)))...,
 		),
+		batchSum: grpctransport.NewServer(
+			endpoints.BatchSumEndpoint,
+			decodeGRPCBatchSumRequest,
+			encodeGRPCBatchSumResponse,
+			append(options, grpctransport.ServerBefore(opentracing.GRPCToContext(otTracer, "BatchSum", logger)))...,
+		),
+		sumEndpoint:    endpoints.SumEndpoint,
+		concatEndpoint: endpoints.ConcatEndpoint,
+		streamBefore: map[string][]grpctransport.ServerRequestFunc{
+			"ConcatStream": streamBefore(otTracer, "ConcatStream", logger),
+			"SumStream":    streamBefore(otTracer, "SumStream", logger),
+			"SumSeries":    streamBefore(otTracer, "SumSeries", logger),
+		},
+	}
+}
+
+// 与一元接口的ServerBefore相同
+func streamBefore(otTracer stdopentracing.Tracer, method string, logger log.Logger) []grpctransport.ServerRequestFunc {
+	return []grpctransport.ServerRequestFunc{
+		// 流式接口不经过unary拦截器，在这里读取或生成request id
+		propagation.GRPCToContext(),
+		opentracing.GRPCToContext(otTracer, method, logger),
+	}
+}
+
+// 与ServerBefore一样，从metadata中提取token和追踪信息
+func (s *grpcServer) streamContext(ctx context.Context, method string) context.Context {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, f := range s.streamBefore[method] {
+			ctx = f(ctx, md)
+		}
 	}
+	return ctx
 }
 
 func (s *grpcServer) Sum(ctx context.Context, req *pb.SumRequest) (*pb.SumReply, error) {
 	_, rep, err := s.sum.ServeGRPC(ctx, req)
 	if err != nil {
-		return nil, err
+		return nil, errMapper().ToGRPC(err)
 	}
 	return rep.(*pb.SumReply), nil
 }
@@ -51,39 +105,152 @@ func (s *grpcServer) Sum(ctx context.Context, req *pb.SumRequest) (*pb.SumReply,
 func (s *grpcServer) Concat(ctx context.Context, req *pb.ConcatRequest) (*pb.ConcatReply, error) {
 	_, rep, err := s.concat.ServeGRPC(ctx, req)
 	if err != nil {
-		return nil, err
+		return nil, errMapper().ToGRPC(err)
 	}
 	return rep.(*pb.ConcatReply), nil
 }
 
-// decodeGRPCSumRequest is a transport/grpc.DecodeRequestFunc that converts a
-// gRPC sum request to a user-domain sum request. Primarily useful in a server.
-// 负责： grpcReq ==> endpointReq，server使用
-func decodeGRPCSumRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
-	req := grpcReq.(*pb.SumRequest)
-	return &endpoint2.SumRequest{A: int(req.A), B: int(req.B)}, nil
+func (s *grpcServer) BatchSum(ctx context.Context, req *pb.BatchSumRequest) (*pb.BatchSumReply, error) {
+	_, rep, err := s.batchSum.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, errMapper().ToGRPC(err)
+	}
+	return rep.(*pb.BatchSumReply), nil
+}
+
+// BatchSum的rpc标记了@kit: manual，decode/encode手写，每一项的转换与Sum相同(见grpc_gen.go)
+
+func decodeGRPCBatchSumRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.BatchSumRequest)
+	items := make([]*endpoint2.SumRequest, len(req.Items))
+	for i, item := range req.Items {
+		items[i] = &endpoint2.SumRequest{A: int(item.A), B: int(item.B)}
+	}
+	return &endpoint2.BatchSumRequest{Items: items}, nil
+}
+
+func encodeGRPCBatchSumResponse(_ context.Context, response interface{}) (interface{}, error) {
+	resp := response.(*endpoint2.BatchSumResponse)
+	items := make([]*pb.SumReply, len(resp.Items))
+	for i, item := range resp.Items {
+		items[i] = &pb.SumReply{V: int64(item.V), Retcode: item.RetCode}
+	}
+	return &pb.BatchSumReply{Items: items}, nil
+}
+
+/*
+ConcatStream 双向流：client依次发送字符串片段，server每收到一个片段就返回当前拼接的结果
+go-kit的grpctransport只支持一元调用(request/response)，所以流式接口不使用grpctransport.Handler，
+而是在这里自行完成收发，对每个片段调用一次ConcatEndpoint(A为当前结果，B为片段)，
+这样endpoint层安装的限流、断路器、参数校验、监控等中间件对每个片段依然生效：
+每个片段都会记录一次request_duration_seconds(method为Concat)，并创建一个Concat span(父span为client的span)，
+流本身的调用数、收发的消息数见gokit_foundation.GRPCServerMetrics.StreamServerInterceptor
+某个片段的endpoint返回err(如限流、参数校验失败)时，只将err转为该片段ConcatReply的Retcode(见streamRetCode)，保留之前的结果，
+不结束整个流，client可以重发该片段；只有ctx结束(client取消或超时)时才结束流
+*/
+func (s *grpcServer) ConcatStream(stream pb.Add_ConcatStreamServer) error {
+	ctx := s.streamContext(stream.Context(), "ConcatStream")
+
+	var running string
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		rsp, err := s.concatEndpoint(ctx, &endpoint2.ConcatRequest{A: running, B: req.Piece})
+		if ctx.Err() != nil {
+			return errMapper().ToGRPC(errs.From(ctx.Err()))
+		}
+		retcode := streamRetCode(err)
+		if err == nil {
+			resp := rsp.(*endpoint2.ConcatResponse)
+			// 拼接失败(如超过最大长度)时保留之前的结果，RetCode返回给client
+			if retcode = resp.RetCode; retcode == resultcode.RESULT_CODE_RET_OK {
+				running = resp.V
+			}
+		}
+		if err = stream.Send(&pb.ConcatReply{V: running, Retcode: retcode}); err != nil {
+			return err
+		}
+	}
+}
+
+// SumStream 双向流：client依次发送整数，server每收到一个就返回当前的和，与ConcatStream一样对每个整数调用一次SumEndpoint
+// 某个整数的endpoint返回err(如限流、溢出)时，该条SumReply的Retcode为对应的错误码，V为之前的和，流继续
+func (s *grpcServer) SumStream(stream pb.Add_SumStreamServer) error {
+	ctx := s.streamContext(stream.Context(), "SumStream")
+
+	var running int
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if running, err = s.addToSum(ctx, running, req.Num, stream.Send); err != nil {
+			return err
+		}
+	}
 }
 
-// decodeGRPCConcatRequest is a transport/grpc.DecodeRequestFunc that converts a
-// gRPC concat request to a user-domain concat request. Primarily useful in a
-// server.
-func decodeGRPCConcatRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
-	req := grpcReq.(*pb.ConcatRequest)
-	return &endpoint2.ConcatRequest{A: req.A, B: req.B}, nil
+// 一次SumSeries最多的整数个数
+const maxSumSeriesLen = 1000
+
+// SumSeries 服务端流：client一次发送所有整数，server依次累加，每加一个就返回当前的和，错误处理与SumStream相同
+func (s *grpcServer) SumSeries(req *pb.SumSeriesRequest, stream pb.Add_SumSeriesServer) error {
+	if len(req.Nums) > maxSumSeriesLen {
+		return errMapper().ToGRPC(errs.Invalid("too many nums"))
+	}
+	ctx := s.streamContext(stream.Context(), "SumSeries")
+
+	var (
+		running int
+		err     error
+	)
+	for _, num := range req.Nums {
+		if running, err = s.addToSum(ctx, running, num, stream.Send); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-// encodeGRPCSumResponse is a transport/grpc.EncodeResponseFunc that converts a
-// user-domain sum response to a gRPC sum reply. Primarily useful in a server.
-// 负责：endpointRsp ==> grpcRsp, server使用
-func encodeGRPCSumResponse(_ context.Context, response interface{}) (interface{}, error) {
-	resp := response.(*endpoint2.SumResponse)
-	return &pb.SumReply{V: int64(resp.V), Retcode: resp.RetCode}, nil
+// 调用SumEndpoint将num加到running上并发送结果，返回新的和，只有ctx结束或发送失败时返回err
+func (s *grpcServer) addToSum(ctx context.Context, running int, num int64, send func(*pb.SumReply) error) (int, error) {
+	rsp, err := s.sumEndpoint(ctx, &endpoint2.SumRequest{A: running, B: int(num)})
+	if ctx.Err() != nil {
+		return running, errMapper().ToGRPC(errs.From(ctx.Err()))
+	}
+	retcode := streamRetCode(err)
+	if err == nil {
+		resp := rsp.(*endpoint2.SumResponse)
+		// 计算失败(如溢出)时保留之前的和
+		if retcode = resp.RetCode; retcode == resultcode.RESULT_CODE_RET_OK {
+			running = resp.V
+		}
+	}
+	return running, send(&pb.SumReply{V: int64(running), Retcode: retcode})
 }
 
-// encodeGRPCConcatResponse is a transport/grpc.EncodeResponseFunc that converts
-// a user-domain concat response to a gRPC concat reply. Primarily useful in a
-// server.
-func encodeGRPCConcatResponse(_ context.Context, response interface{}) (interface{}, error) {
-	resp := response.(*endpoint2.ConcatResponse)
-	return &pb.ConcatReply{V: resp.V, Retcode: resp.RetCode}, nil
+// streamRetCode 将endpoint中间件返回的err转为片段的Retcode：
+// 有业务错误码(如参数校验失败)时使用错误码，否则按类别转换，限流、断路器、超时等为RET_SYS_ERR(client可重发该片段)
+func streamRetCode(err error) resultcode.RESULT_CODE {
+	if err == nil {
+		return resultcode.RESULT_CODE_RET_OK
+	}
+	if code := errs.CodeOf(err); code != 0 {
+		return resultcode.RESULT_CODE(code)
+	}
+	switch errs.KindOf(err) {
+	case errs.KindInvalid:
+		return resultcode.RESULT_CODE_RET_INVALID_ARGS
+	case errs.KindForbidden, errs.KindUnauthenticated:
+		return resultcode.RESULT_CODE_RET_FORBIDDEN
+	}
+	return resultcode.RESULT_CODE_RET_SYS_ERR
 }
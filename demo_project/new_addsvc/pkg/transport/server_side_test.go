@@ -0,0 +1,300 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/ratelimit"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"gokit_foundation/errs"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"io"
+	"net"
+	pb "new_addsvc/pb/gen-go/addsvcpb"
+	"new_addsvc/pb/gen-go/resultcode"
+	endpoint2 "new_addsvc/pkg/endpoint"
+	"new_addsvc/pkg/service"
+	"testing"
+)
+
+func TestConcatStream(t *testing.T) {
+	logger := log.NewNopLogger()
+	tracer := stdopentracing.NoopTracer{}
+	eps := endpoint2.New(service.NewBasicService(logger), logger, tracer, endpoint2.Deps{})
+
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer()
+	pb.RegisterAddServer(srv, NewGRPCServer(eps, tracer, logger))
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	cc, err := grpc.Dial("bufconn", grpc.WithInsecure(), grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+		return lis.Dial()
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cc.Close()
+
+	stream, err := pb.NewAddClient(cc).ConcatStream(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pieces := []string{"ab", "cd", "ef"}
+	want := []string{"ab", "abcd", "abcdef"}
+	for i, piece := range pieces {
+		if err := stream.Send(&pb.ConcatStreamRequest{Piece: piece}); err != nil {
+			t.Fatal(err)
+		}
+		rep, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rep.V != want[i] || rep.Retcode != 0 {
+			t.Errorf("piece:%s got v:%s retcode:%v want v:%s", piece, rep.V, rep.Retcode, want[i])
+		}
+	}
+	if err := stream.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 某个片段被限流或参数校验失败时，该片段返回对应的Retcode，流继续
+func TestConcatStreamPieceError(t *testing.T) {
+	logger := log.NewNopLogger()
+	tracer := stdopentracing.NoopTracer{}
+	eps := endpoint2.New(service.NewBasicService(logger), logger, tracer, endpoint2.Deps{})
+	concat := eps.ConcatEndpoint
+	calls := 0
+	eps.ConcatEndpoint = endpoint2.ErrorsMiddleware()(func(ctx context.Context, request interface{}) (interface{}, error) {
+		if calls++; calls == 3 {
+			return nil, ratelimit.ErrLimited
+		}
+		return concat(ctx, request)
+	})
+
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer()
+	pb.RegisterAddServer(srv, NewGRPCServer(eps, tracer, logger))
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	cc, err := grpc.Dial("bufconn", grpc.WithInsecure(), grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+		return lis.Dial()
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cc.Close()
+
+	stream, err := pb.NewAddClient(cc).ConcatStream(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	test := []struct {
+		piece   string
+		v       string
+		retcode resultcode.RESULT_CODE
+	}{
+		{"", "", resultcode.RESULT_CODE_RET_INVALID_ARGS}, // A、B都为空，参数校验失败
+		{"ab", "ab", resultcode.RESULT_CODE_RET_OK},
+		{"cd", "ab", resultcode.RESULT_CODE_RET_SYS_ERR}, // 限流
+		{"cd", "abcd", resultcode.RESULT_CODE_RET_OK},    // 重发
+	}
+	for _, tt := range test {
+		if err := stream.Send(&pb.ConcatStreamRequest{Piece: tt.piece}); err != nil {
+			t.Fatal(err)
+		}
+		rep, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("piece:%q stream ended: %v", tt.piece, err)
+		}
+		if rep.V != tt.v || rep.Retcode != tt.retcode {
+			t.Errorf("piece:%q got v:%s retcode:%v want v:%s retcode:%v", tt.piece, rep.V, rep.Retcode, tt.v, tt.retcode)
+		}
+	}
+	if err := stream.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 通过bufconn连接NewGRPCServer，返回的函数关闭server和连接
+func dialAddServer(t *testing.T, eps endpoint2.AddSvcEndpoints) (pb.AddClient, func()) {
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer()
+	pb.RegisterAddServer(srv, NewGRPCServer(eps, stdopentracing.NoopTracer{}, log.NewNopLogger()))
+	go srv.Serve(lis)
+
+	cc, err := grpc.Dial("bufconn", grpc.WithInsecure(), grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+		return lis.Dial()
+	}))
+	if err != nil {
+		srv.Stop()
+		t.Fatal(err)
+	}
+	return pb.NewAddClient(cc), func() {
+		cc.Close()
+		srv.Stop()
+	}
+}
+
+// 超过范围的整数参数校验失败，该条返回RET_INVALID_ARGS，和不变，流继续
+var sumSeriesTest = []struct {
+	num     int64
+	v       int64
+	retcode resultcode.RESULT_CODE
+}{
+	{1, 1, resultcode.RESULT_CODE_RET_OK},
+	{2, 3, resultcode.RESULT_CODE_RET_OK},
+	{1 << 53, 3, resultcode.RESULT_CODE_RET_INVALID_ARGS},
+	{-4, -1, resultcode.RESULT_CODE_RET_OK},
+}
+
+func TestSumStream(t *testing.T) {
+	logger := log.NewNopLogger()
+	eps := endpoint2.New(service.NewBasicService(logger), logger, stdopentracing.NoopTracer{}, endpoint2.Deps{})
+	client, closeFn := dialAddServer(t, eps)
+	defer closeFn()
+
+	stream, err := client.SumStream(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range sumSeriesTest {
+		if err := stream.Send(&pb.SumStreamRequest{Num: tt.num}); err != nil {
+			t.Fatal(err)
+		}
+		rep, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("num:%d stream ended: %v", tt.num, err)
+		}
+		if rep.V != tt.v || rep.Retcode != tt.retcode {
+			t.Errorf("num:%d got v:%d retcode:%v want v:%d retcode:%v", tt.num, rep.V, rep.Retcode, tt.v, tt.retcode)
+		}
+	}
+	if err := stream.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); err != io.EOF {
+		t.Errorf("want EOF after CloseSend, got err:%v", err)
+	}
+}
+
+func TestSumSeries(t *testing.T) {
+	logger := log.NewNopLogger()
+	eps := endpoint2.New(service.NewBasicService(logger), logger, stdopentracing.NoopTracer{}, endpoint2.Deps{})
+	client, closeFn := dialAddServer(t, eps)
+	defer closeFn()
+
+	req := &pb.SumSeriesRequest{}
+	for _, tt := range sumSeriesTest {
+		req.Nums = append(req.Nums, tt.num)
+	}
+	stream, err := client.SumSeries(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range sumSeriesTest {
+		rep, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("num:%d stream ended: %v", tt.num, err)
+		}
+		if rep.V != tt.v || rep.Retcode != tt.retcode {
+			t.Errorf("num:%d got v:%d retcode:%v want v:%d retcode:%v", tt.num, rep.V, rep.Retcode, tt.v, tt.retcode)
+		}
+	}
+	if _, err := stream.Recv(); err != io.EOF {
+		t.Errorf("want EOF after all nums, got err:%v", err)
+	}
+
+	// 超过maxSumSeriesLen时直接拒绝
+	stream, err = client.SumSeries(context.Background(), &pb.SumSeriesRequest{Nums: make([]int64, maxSumSeriesLen+1)})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("too many nums got err:%v", err)
+	}
+}
+
+func TestValidationErrorOverGRPC(t *testing.T) {
+	logger := log.NewNopLogger()
+	tracer := stdopentracing.NoopTracer{}
+	eps := endpoint2.New(service.NewBasicService(logger), logger, tracer, endpoint2.Deps{})
+
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer()
+	pb.RegisterAddServer(srv, NewGRPCServer(eps, tracer, logger))
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	cc, err := grpc.Dial("bufconn", grpc.WithInsecure(), grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+		return lis.Dial()
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cc.Close()
+
+	// 直接使用pb client：得到InvalidArgument以及BadRequest详情
+	_, err = pb.NewAddClient(cc).Concat(context.Background(), &pb.ConcatRequest{})
+	st, _ := status.FromError(err)
+	if st.Code() != codes.InvalidArgument {
+		t.Fatalf("got status:%v", st)
+	}
+	var br *errdetails.BadRequest
+	for _, d := range st.Details() {
+		if d, ok := d.(*errdetails.BadRequest); ok {
+			br = d
+		}
+	}
+	if br == nil || len(br.FieldViolations) != 2 || br.FieldViolations[0].Field != "a" {
+		t.Errorf("got details:%v", st.Details())
+	}
+
+	// 使用go-kit client：还原为*errs.Error
+	_, err = NewGRPCClient(cc, tracer, logger).Concat(context.Background(), "", "")
+	if !errors.Is(err, endpoint2.ErrInvalidRequest) {
+		t.Fatalf("want ErrInvalidRequest, got err:%v", err)
+	}
+	if e := errs.From(err); e.Details["a"] != "required when b is empty" || e.Details["b"] != "required when a is empty" {
+		t.Errorf("got details:%v", e.Details)
+	}
+}
+
+func TestBatchSumOverGRPC(t *testing.T) {
+	logger := log.NewNopLogger()
+	tracer := stdopentracing.NoopTracer{}
+	eps := endpoint2.New(service.NewBasicService(logger), logger, tracer, endpoint2.Deps{})
+
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer()
+	pb.RegisterAddServer(srv, NewGRPCServer(eps, tracer, logger))
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	cc, err := grpc.Dial("bufconn", grpc.WithInsecure(), grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+		return lis.Dial()
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cc.Close()
+
+	client := NewGRPCClient(cc, tracer, logger)
+	vs, itemErrs, err := client.BatchSum(context.Background(), []*endpoint2.SumRequest{{A: 1, B: 2}, {}, {A: 1 << 60}})
+	if err != nil || len(vs) != 3 || vs[0] != 3 || itemErrs[0] != nil {
+		t.Fatalf("got vs:%v errs:%v err:%v", vs, itemErrs, err)
+	}
+	if !errors.Is(itemErrs[1], service.ErrTwoZeroes) || !errors.Is(itemErrs[2], endpoint2.ErrInvalidRequest) {
+		t.Errorf("got errs:%v", itemErrs)
+	}
+	// 整批失败时还原为*errs.Error
+	if _, _, err := client.BatchSum(context.Background(), nil); !errors.Is(err, endpoint2.ErrInvalidRequest) {
+		t.Errorf("got err:%v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/go-kit/kit/log"
+	"gokit_foundation/reqid"
+	"gokit_foundation/sqstransport"
+	endpoint2 "new_addsvc/pkg/endpoint"
+)
+
+/*
+SQS transport(见gokit_foundation/sqstransport)，addsvc作为worker从队列中消费Sum/Concat，与grpc/http transport共用同一组endpoints
+	method=Sum     {"a": 1, "b": 2}      => {"v": 3, "ret_code": 0}
+	method=Concat  {"a": "x", "b": "y"}  => {"v": "xy", "ret_code": 0}
+-	消息属性method指定接口，reply_to指定回复的队列(不需要回复时不设置)，MessageId作为request id写入ctx
+-	endpoint返回可重试的错误(如限流、断路器打开)时消息在退避后重新投递，参数错误等直接删除，不回复
+-	与NATS一样，消息不带token，server开启auth时会被AuthMiddleware拒绝
+	aws sqs send-message --queue-url $QUEUE --message-body '{"a": 1, "b": 2}' --message-attributes 'method={DataType=String,StringValue=Sum}'
+*/
+
+func NewSQSConsumer(api sqstransport.API, queueURL string, endpoints endpoint2.AddSvcEndpoints, logger log.Logger,
+	options ...sqstransport.ConsumerOption) *sqstransport.Consumer {
+	ecm := sqstransport.EndpointCodecMap{
+		"Sum": {
+			Endpoint: endpoints.SumEndpoint,
+			Decode:   decodeSQSSumRequest,
+			Encode:   encodeSQSResponse,
+		},
+		"Concat": {
+			Endpoint: endpoints.ConcatEndpoint,
+			Decode:   decodeSQSConcatRequest,
+			Encode:   encodeSQSResponse,
+		},
+	}
+	options = append([]sqstransport.ConsumerOption{sqstransport.ConsumerBefore(sqsRequestID)}, options...)
+	return sqstransport.NewConsumer(api, queueURL, ecm, logger, options...)
+}
+
+// 日志中的request_id与SQS的MessageId对应，重新投递时不变
+func sqsRequestID(ctx context.Context, msg *sqs.Message) context.Context {
+	return reqid.WithRequestID(ctx, aws.StringValue(msg.MessageId))
+}
+
+func decodeSQSSumRequest(_ context.Context, msg *sqs.Message) (interface{}, error) {
+	var req endpoint2.SumRequest
+	if err := json.Unmarshal([]byte(aws.StringValue(msg.Body)), &req); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+func decodeSQSConcatRequest(_ context.Context, msg *sqs.Message) (interface{}, error) {
+	var req endpoint2.ConcatRequest
+	if err := json.Unmarshal([]byte(aws.StringValue(msg.Body)), &req); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+func encodeSQSResponse(_ context.Context, response interface{}) (string, error) {
+	b, err := json.Marshal(response)
+	return string(b), err
+}
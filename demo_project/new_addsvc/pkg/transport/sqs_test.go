@@ -0,0 +1,105 @@
+package transport
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/go-kit/kit/log"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"gokit_foundation/sqstransport"
+	endpoint2 "new_addsvc/pkg/endpoint"
+	"new_addsvc/pkg/service"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 第一次接收时返回msgs，记录删除和发送的消息
+type fakeSQS struct {
+	mu      sync.Mutex
+	msgs    []*sqs.Message
+	deleted []string
+	sent    []*sqs.SendMessageInput
+}
+
+func (f *fakeSQS) ReceiveMessageWithContext(ctx aws.Context, _ *sqs.ReceiveMessageInput, _ ...request.Option) (*sqs.ReceiveMessageOutput, error) {
+	f.mu.Lock()
+	msgs := f.msgs
+	f.msgs = nil
+	f.mu.Unlock()
+	if len(msgs) == 0 {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+	return &sqs.ReceiveMessageOutput{Messages: msgs}, nil
+}
+
+func (f *fakeSQS) DeleteMessageWithContext(_ aws.Context, in *sqs.DeleteMessageInput, _ ...request.Option) (*sqs.DeleteMessageOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.deleted = append(f.deleted, *in.ReceiptHandle)
+	return &sqs.DeleteMessageOutput{}, nil
+}
+
+func (f *fakeSQS) ChangeMessageVisibilityWithContext(aws.Context, *sqs.ChangeMessageVisibilityInput, ...request.Option) (*sqs.ChangeMessageVisibilityOutput, error) {
+	return &sqs.ChangeMessageVisibilityOutput{}, nil
+}
+
+func (f *fakeSQS) SendMessageWithContext(_ aws.Context, in *sqs.SendMessageInput, _ ...request.Option) (*sqs.SendMessageOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sent = append(f.sent, in)
+	return &sqs.SendMessageOutput{}, nil
+}
+
+func sqsMessage(id, method, body, replyTo string) *sqs.Message {
+	attrs := map[string]*sqs.MessageAttributeValue{
+		sqstransport.MethodAttribute: {DataType: aws.String("String"), StringValue: aws.String(method)},
+	}
+	if replyTo != "" {
+		attrs[sqstransport.ReplyToAttribute] = &sqs.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(replyTo)}
+	}
+	return &sqs.Message{MessageId: aws.String(id), ReceiptHandle: aws.String(id), Body: aws.String(body), MessageAttributes: attrs}
+}
+
+func TestSQSConsumer(t *testing.T) {
+	logger := log.NewNopLogger()
+	eps := endpoint2.New(service.NewBasicService(logger), logger, stdopentracing.NoopTracer{}, endpoint2.Deps{})
+	api := &fakeSQS{msgs: []*sqs.Message{
+		sqsMessage("1", "Sum", `{"a": 1, "b": 2}`, "replies"),
+		sqsMessage("2", "Concat", `{"a": "x", "b": "y"}`, ""),
+		// 解码失败，不可重试，直接删除
+		sqsMessage("3", "Sum", `{"a":`, "replies"),
+	}}
+	c := NewSQSConsumer(api, "requests", eps, logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.Run(ctx)
+		close(done)
+	}()
+	for i := 0; i < 200; i++ {
+		api.mu.Lock()
+		n := len(api.deleted)
+		api.mu.Unlock()
+		if n == 3 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	if len(api.deleted) != 3 {
+		t.Errorf("got deleted:%v", api.deleted)
+	}
+	if len(api.sent) != 1 || *api.sent[0].QueueUrl != "replies" || *api.sent[0].MessageBody != `{"v":3,"ret_code":0}` ||
+		*api.sent[0].MessageAttributes[sqstransport.CorrelationIDAttribute].StringValue != "1" {
+		t.Errorf("got sent:%v", api.sent)
+	}
+}
@@ -0,0 +1,158 @@
+package transport
+
+import (
+	"context"
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/go-kit/kit/circuitbreaker"
+	stdendpoint "github.com/go-kit/kit/endpoint"
+	"github.com/sony/gobreaker"
+	"net"
+	"new_addsvc/pb/gen-go/addsvcthrift"
+	"new_addsvc/pb/gen-go/resultcode"
+	endpoint2 "new_addsvc/pkg/endpoint"
+	"time"
+)
+
+/*
+Thrift transport，与grpc transport共用同一组endpoints，可以对比两者的写法(IDL见pb/thrift/addsvc.thrift)
+-	go-kit没有transport/thrift，server直接实现thrift生成的AddService接口，在其中调用endpoint，client同理
+-	与grpc一样，业务错误通过retcode返回；endpoint层返回的err(参数校验、限流等)由thrift编码为TApplicationException，
+	client侧只能拿到错误信息，经ErrorsMiddleware后为KindInternal
+-	thrift请求没有metadata，无法传递token和追踪信息，server开启auth时thrift调用会被AuthMiddleware拒绝
+*/
+
+// ThriftProtocolFactory server和client必须使用相同的protocol和transport(framed)
+var ThriftProtocolFactory thrift.TProtocolFactory = thrift.NewTBinaryProtocolFactoryDefault()
+
+func ThriftTransportFactory() thrift.TTransportFactory {
+	return thrift.NewTFramedTransportFactory(thrift.NewTTransportFactory())
+}
+
+// NewThriftServerTransport 使用已经监听的lis(如从旧进程继承的，见gokit_foundation.Upgrader)，
+// thrift.TServerSocket只能自己监听地址；Listen什么也不做，Close和Interrupt关闭lis
+func NewThriftServerTransport(lis net.Listener) thrift.TServerTransport {
+	return thriftListener{lis}
+}
+
+type thriftListener struct {
+	net.Listener
+}
+
+func (thriftListener) Listen() error {
+	return nil
+}
+
+func (l thriftListener) Accept() (thrift.TTransport, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, thrift.NewTTransportExceptionFromError(err)
+	}
+	return thrift.NewTSocketFromConnTimeout(conn, 0), nil
+}
+
+func (l thriftListener) Interrupt() error {
+	return l.Close()
+}
+
+type thriftServer struct {
+	endpoints endpoint2.AddSvcEndpoints
+}
+
+// NewThriftServer makes a set of endpoints available as a Thrift service.
+// 使用 addsvcthrift.NewAddServiceProcessor 包装后交给thrift server
+func NewThriftServer(endpoints endpoint2.AddSvcEndpoints) addsvcthrift.AddService {
+	return &thriftServer{endpoints: endpoints}
+}
+
+func (s *thriftServer) Sum(ctx context.Context, a int64, b int64) (*addsvcthrift.SumReply, error) {
+	rsp, err := s.endpoints.SumEndpoint(ctx, &endpoint2.SumRequest{A: int(a), B: int(b)})
+	if err != nil {
+		return nil, err
+	}
+	resp := rsp.(*endpoint2.SumResponse)
+	return &addsvcthrift.SumReply{Value: int64(resp.V), Retcode: int32(resp.RetCode)}, nil
+}
+
+func (s *thriftServer) Concat(ctx context.Context, a string, b string) (*addsvcthrift.ConcatReply, error) {
+	rsp, err := s.endpoints.ConcatEndpoint(ctx, &endpoint2.ConcatRequest{A: a, B: b})
+	if err != nil {
+		return nil, err
+	}
+	resp := rsp.(*endpoint2.ConcatResponse)
+	return &addsvcthrift.ConcatReply{Value: resp.V, Retcode: int32(resp.RetCode)}, nil
+}
+
+// DialThrift 连接thrift server，返回的transport由调用方关闭
+// 生成的client不是并发安全的(共用一个连接顺序收发)，并发调用时每个goroutine使用各自的client
+func DialThrift(addr string, timeout time.Duration) (*addsvcthrift.AddServiceClient, thrift.TTransport, error) {
+	socket, err := thrift.NewTSocketTimeout(addr, timeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	trans, err := ThriftTransportFactory().GetTransport(socket)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = trans.Open(); err != nil {
+		return nil, nil, err
+	}
+	return addsvcthrift.NewAddServiceClientFactory(trans, ThriftProtocolFactory), trans, nil
+}
+
+// NewThriftClient returns an AddService backed by a Thrift server described by
+// the provided client. The caller is responsible for constructing the client,
+// and eventually closing the underlying transport.
+// 与NewGRPCClient一样为每个接口安装断路器，最外层还原err
+func NewThriftClient(client *addsvcthrift.AddServiceClient) endpoint2.AddSvcEndpoints {
+	var sumEndpoint stdendpoint.Endpoint
+	{
+		sumEndpoint = makeThriftSumEndpoint(client)
+		sumEndpoint = circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(gobreaker.Settings{
+			Name:    "Sum",
+			Timeout: 10 * time.Second,
+		}))(sumEndpoint)
+		sumEndpoint = endpoint2.ErrorsMiddleware()(sumEndpoint)
+	}
+
+	var concatEndpoint stdendpoint.Endpoint
+	{
+		concatEndpoint = makeThriftConcatEndpoint(client)
+		concatEndpoint = circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(gobreaker.Settings{
+			Name:    "Concat",
+			Timeout: 10 * time.Second,
+		}))(concatEndpoint)
+		concatEndpoint = endpoint2.ErrorsMiddleware()(concatEndpoint)
+	}
+
+	return endpoint2.AddSvcEndpoints{
+		SumEndpoint:    sumEndpoint,
+		ConcatEndpoint: concatEndpoint,
+	}
+}
+
+// makeThriftSumEndpoint returns an endpoint that invokes the passed Thrift client.
+// Useful only in clients, and only until a proper transport/thrift.Client exists.
+func makeThriftSumEndpoint(client *addsvcthrift.AddServiceClient) stdendpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(*endpoint2.SumRequest)
+		reply, err := client.Sum(ctx, int64(req.A), int64(req.B))
+		if err != nil {
+			return nil, err
+		}
+		return &endpoint2.SumResponse{V: int(reply.Value), RetCode: resultcode.RESULT_CODE(reply.Retcode)}, nil
+	}
+}
+
+// makeThriftConcatEndpoint returns an endpoint that invokes the passed Thrift
+// client. Useful only in clients, and only until a proper
+// transport/thrift.Client exists.
+func makeThriftConcatEndpoint(client *addsvcthrift.AddServiceClient) stdendpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(*endpoint2.ConcatRequest)
+		reply, err := client.Concat(ctx, req.A, req.B)
+		if err != nil {
+			return nil, err
+		}
+		return &endpoint2.ConcatResponse{V: reply.Value, RetCode: resultcode.RESULT_CODE(reply.Retcode)}, nil
+	}
+}
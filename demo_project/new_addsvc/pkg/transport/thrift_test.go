@@ -0,0 +1,59 @@
+package transport
+
+import (
+	"context"
+	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/go-kit/kit/log"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"gokit_foundation/errs"
+	"net"
+	"new_addsvc/pb/gen-go/addsvcthrift"
+	endpoint2 "new_addsvc/pkg/endpoint"
+	"new_addsvc/pkg/service"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestThrift(t *testing.T) {
+	logger := log.NewNopLogger()
+	tracer := stdopentracing.NoopTracer{}
+	eps := endpoint2.New(service.NewBasicService(logger), logger, tracer, endpoint2.Deps{})
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := thrift.NewTSimpleServer4(addsvcthrift.NewAddServiceProcessor(NewThriftServer(eps)), NewThriftServerTransport(lis), ThriftTransportFactory(), ThriftProtocolFactory)
+	if err = srv.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	go srv.AcceptLoop()
+
+	client, trans, err := DialThrift(lis.Addr().String(), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli := NewThriftClient(client)
+	ctx := context.Background()
+	if v, err := cli.Sum(ctx, 1, 2); err != nil || v != 3 {
+		t.Errorf("Sum got v:%d err:%v", v, err)
+	}
+	if v, err := cli.Concat(ctx, "x", "y"); err != nil || v != "xy" {
+		t.Errorf("Concat got v:%s err:%v", v, err)
+	}
+	// 业务错误通过retcode还原
+	if _, err := cli.Concat(ctx, "0123456789", "y"); err == nil || errs.CodeOf(err) != service.CodeInvalidInput {
+		t.Errorf("Concat biz err got err:%v", err)
+	}
+	// endpoint层的err只保留了错误信息
+	if _, err := cli.Concat(ctx, "", ""); err == nil || !strings.Contains(err.Error(), "Concat") {
+		t.Errorf("Concat invalid got err:%v", err)
+	}
+
+	// 先关闭client连接，否则Stop会等待连接断开
+	trans.Close()
+	if err := srv.Stop(); err != nil {
+		t.Errorf("Stop got err:%v", err)
+	}
+}
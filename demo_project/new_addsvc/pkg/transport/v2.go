@@ -0,0 +1,224 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-kit/kit/circuitbreaker"
+	stdendpoint "github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/tracing/opentracing"
+	grpctransport "github.com/go-kit/kit/transport/grpc"
+	httptransport "github.com/go-kit/kit/transport/http"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"github.com/sony/gobreaker"
+	"gokit_foundation/errs"
+	"gokit_foundation/otel"
+	"gokit_foundation/propagation"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/http"
+	pb "new_addsvc/pb/gen-go/addsvcpb"
+	"new_addsvc/pb/gen-go/addsvcv2pb"
+	"new_addsvc/pb/gen-go/resultcode"
+	endpoint2 "new_addsvc/pkg/endpoint"
+	"sync/atomic"
+	"time"
+)
+
+/*
+v2版本的Add接口(见endpoint.NewV2)，与v1注册在同一个grpc server和http服务上：
+-	grpc服务名为addsvcpb.v2.Add，与v1的addsvcpb.Add并存
+-	http为POST /v2/sum {"a": "9223372036854775807", "b": "1", "overflow": 1} => {"v": "9223372036854775807", "saturated": true, "ret_code": 0}，
+	POST /v2/concat与/concat相同
+-	client见NewGRPCClientV2，连接的实例没有v2接口(滚动升级期间的旧版本)时改用v1
+*/
+
+const gRPCSvrNameV2 = "addsvcpb.v2.Add"
+
+type grpcServerV2 struct {
+	sum    grpctransport.Handler
+	concat grpctransport.Handler
+}
+
+func NewGRPCServerV2(endpoints endpoint2.AddSvcV2Endpoints, otTracer stdopentracing.Tracer, logger log.Logger) addsvcv2pb.AddServer {
+	options := []grpctransport.ServerOption{
+		grpctransport.ServerErrorHandler(errs.NewLogErrorHandler(logger)),
+		propagation.GRPCServerBefore(),
+	}
+	return &grpcServerV2{
+		sum: grpctransport.NewServer(
+			endpoints.SumEndpoint,
+			decodeGRPCSumV2Request,
+			encodeGRPCSumV2Response,
+			append(options, grpctransport.ServerBefore(opentracing.GRPCToContext(otTracer, "SumV2", logger)))...,
+		),
+		// request/response与v1相同
+		concat: grpctransport.NewServer(
+			endpoints.ConcatEndpoint,
+			decodeGRPCConcatRequest,
+			encodeGRPCConcatResponse,
+			append(options, grpctransport.ServerBefore(opentracing.GRPCToContext(otTracer, "ConcatV2", logger)))...,
+		),
+	}
+}
+
+func (s *grpcServerV2) Sum(ctx context.Context, req *addsvcv2pb.SumRequest) (*addsvcv2pb.SumReply, error) {
+	_, rep, err := s.sum.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, errMapper().ToGRPC(err)
+	}
+	return rep.(*addsvcv2pb.SumReply), nil
+}
+
+func (s *grpcServerV2) Concat(ctx context.Context, req *pb.ConcatRequest) (*pb.ConcatReply, error) {
+	_, rep, err := s.concat.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, errMapper().ToGRPC(err)
+	}
+	return rep.(*pb.ConcatReply), nil
+}
+
+func decodeGRPCSumV2Request(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*addsvcv2pb.SumRequest)
+	return &endpoint2.SumV2Request{A: req.A, B: req.B, Overflow: req.Overflow}, nil
+}
+
+func encodeGRPCSumV2Response(_ context.Context, response interface{}) (interface{}, error) {
+	resp := response.(*endpoint2.SumV2Response)
+	return &addsvcv2pb.SumReply{V: resp.V, Saturated: resp.Saturated, Retcode: resp.RetCode}, nil
+}
+
+func encodeGRPCSumV2RequestClient(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(*endpoint2.SumV2Request)
+	return &addsvcv2pb.SumRequest{A: req.A, B: req.B, Overflow: req.Overflow}, nil
+}
+
+func decodeGRPCSumV2ResponseClient(_ context.Context, grpcReply interface{}) (interface{}, error) {
+	reply := grpcReply.(*addsvcv2pb.SumReply)
+	return &endpoint2.SumV2Response{V: reply.V, Saturated: reply.Saturated, RetCode: reply.Retcode}, nil
+}
+
+// 调用v1的Sum时使用，a、b超出v1的范围(±2^53)时v1返回参数错误
+func encodeGRPCSumV2AsV1Request(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(*endpoint2.SumV2Request)
+	return &pb.SumRequest{A: req.A, B: req.B}, nil
+}
+
+func decodeGRPCSumV1AsV2Response(_ context.Context, grpcReply interface{}) (interface{}, error) {
+	reply := grpcReply.(*pb.SumReply)
+	return &endpoint2.SumV2Response{V: reply.V, RetCode: reply.Retcode}, nil
+}
+
+// v1Fallback 实例返回Unimplemented(没有注册v2服务)后，该连接之后的调用都直接使用v1
+// 实例升级后是新的进程，连接池会重新拨号，新连接重新尝试v2
+type v1Fallback struct {
+	unimplemented int32
+}
+
+func (f *v1Fallback) endpoint(v2, v1 stdendpoint.Endpoint) stdendpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		if atomic.LoadInt32(&f.unimplemented) == 0 {
+			response, err := v2(ctx, request)
+			if status.Code(err) != codes.Unimplemented {
+				return response, err
+			}
+			atomic.StoreInt32(&f.unimplemented, 1)
+		}
+		return v1(ctx, request)
+	}
+}
+
+// NewGRPCClientV2 与NewGRPCClient相同，调用v2接口，实例不支持v2时改用v1(见v1Fallback)：
+// Sum溢出且request的Overflow为OVERFLOW_SATURATE时，将v1返回的RET_OVERFLOW转为饱和的结果，与v2的结果一致
+func NewGRPCClientV2(conn *grpc.ClientConn, otTracer stdopentracing.Tracer, logger log.Logger) endpoint2.AddSvcV2Endpoints {
+	options := []grpctransport.ClientOption{
+		propagation.GRPCClientBefore(),
+		grpctransport.ClientBefore(opentracing.ContextToGRPC(otTracer, logger)),
+	}
+	otelTracer := otel.Tracer()
+	fallback := &v1Fallback{}
+
+	var sumEndpoint stdendpoint.Endpoint
+	{
+		sumV1 := grpctransport.NewClient(conn, gRPCSvrName, "Sum",
+			encodeGRPCSumV2AsV1Request, decodeGRPCSumV1AsV2Response, pb.SumReply{}, options...).Endpoint()
+		sumEndpoint = fallback.endpoint(
+			grpctransport.NewClient(conn, gRPCSvrNameV2, "Sum",
+				encodeGRPCSumV2RequestClient, decodeGRPCSumV2ResponseClient, addsvcv2pb.SumReply{}, options...).Endpoint(),
+			func(ctx context.Context, request interface{}) (interface{}, error) {
+				response, err := sumV1(ctx, request)
+				if err != nil {
+					return nil, err
+				}
+				req := request.(*endpoint2.SumV2Request)
+				if response.(*endpoint2.SumV2Response).RetCode == resultcode.RESULT_CODE_RET_OVERFLOW && req.Overflow == addsvcv2pb.Overflow_OVERFLOW_SATURATE {
+					return req.SaturatedResponse(), nil
+				}
+				return response, nil
+			},
+		)
+		sumEndpoint = opentracing.TraceClient(otTracer, "SumV2")(sumEndpoint)
+		sumEndpoint = otel.TraceClient(otelTracer, "SumV2")(sumEndpoint)
+		sumEndpoint = circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(gobreaker.Settings{
+			Name:    "SumV2",
+			Timeout: 10 * time.Second,
+		}))(sumEndpoint)
+		sumEndpoint = endpoint2.ErrorsMiddleware()(sumEndpoint)
+	}
+
+	var concatEndpoint stdendpoint.Endpoint
+	{
+		concatEndpoint = fallback.endpoint(
+			grpctransport.NewClient(conn, gRPCSvrNameV2, "Concat",
+				encodeGRPCConcatRequest, decodeGRPCConcatResponse, pb.ConcatReply{}, options...).Endpoint(),
+			grpctransport.NewClient(conn, gRPCSvrName, "Concat",
+				encodeGRPCConcatRequest, decodeGRPCConcatResponse, pb.ConcatReply{}, options...).Endpoint(),
+		)
+		concatEndpoint = opentracing.TraceClient(otTracer, "ConcatV2")(concatEndpoint)
+		concatEndpoint = otel.TraceClient(otelTracer, "ConcatV2")(concatEndpoint)
+		concatEndpoint = circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(gobreaker.Settings{
+			Name:    "ConcatV2",
+			Timeout: 10 * time.Second,
+		}))(concatEndpoint)
+		concatEndpoint = endpoint2.ErrorsMiddleware()(concatEndpoint)
+	}
+
+	return endpoint2.AddSvcV2Endpoints{
+		SumEndpoint:    sumEndpoint,
+		ConcatEndpoint: concatEndpoint,
+	}
+}
+
+// NewHTTPHandlerV2 v2的HTTP/JSON接口，路径以/v2/开头，与NewHTTPHandler使用相同的错误编码
+func NewHTTPHandlerV2(endpoints endpoint2.AddSvcV2Endpoints, otTracer stdopentracing.Tracer, logger log.Logger) http.Handler {
+	options := []httptransport.ServerOption{
+		httptransport.ServerErrorEncoder(errorEncoder),
+		httptransport.ServerErrorHandler(errs.NewLogErrorHandler(logger)),
+		propagation.HTTPServerBefore(),
+	}
+
+	m := http.NewServeMux()
+	m.Handle("/v2/sum", httptransport.NewServer(
+		endpoints.SumEndpoint,
+		decodeHTTPSumV2Request,
+		encodeHTTPGenericResponse,
+		append(options, httptransport.ServerBefore(opentracing.HTTPToContext(otTracer, "SumV2", logger)))...,
+	))
+	m.Handle("/v2/concat", httptransport.NewServer(
+		endpoints.ConcatEndpoint,
+		decodeHTTPConcatRequest,
+		encodeHTTPGenericResponse,
+		append(options, httptransport.ServerBefore(opentracing.HTTPToContext(otTracer, "ConcatV2", logger)))...,
+	))
+	return m
+}
+
+// a、b为字符串，见endpoint.SumV2Request
+func decodeHTTPSumV2Request(_ context.Context, r *http.Request) (interface{}, error) {
+	var req endpoint2.SumV2Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, errBadRequest(err)
+	}
+	return &req, nil
+}
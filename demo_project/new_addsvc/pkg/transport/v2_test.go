@@ -0,0 +1,136 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/go-kit/kit/log"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	pb "new_addsvc/pb/gen-go/addsvcpb"
+	"new_addsvc/pb/gen-go/addsvcv2pb"
+	"new_addsvc/pb/gen-go/resultcode"
+	endpoint2 "new_addsvc/pkg/endpoint"
+	"new_addsvc/pkg/service"
+	"testing"
+)
+
+// withV2为false时只注册v1，模拟没有升级的实例
+func dialV2Server(t *testing.T, withV2 bool) (*grpc.ClientConn, func()) {
+	logger := log.NewNopLogger()
+	tracer := stdopentracing.NoopTracer{}
+	svc := service.NewBasicService(logger)
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer()
+	pb.RegisterAddServer(srv, NewGRPCServer(endpoint2.New(svc, logger, tracer, endpoint2.Deps{}), tracer, logger))
+	if withV2 {
+		addsvcv2pb.RegisterAddServer(srv, NewGRPCServerV2(endpoint2.NewV2(svc, logger, tracer, endpoint2.Deps{}), tracer, logger))
+	}
+	go srv.Serve(lis)
+	cc, err := grpc.Dial("bufconn", grpc.WithInsecure(), grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+		return lis.Dial()
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cc, func() {
+		cc.Close()
+		srv.Stop()
+	}
+}
+
+var sumV2Test = []struct {
+	name      string
+	a, b      int64
+	overflow  addsvcv2pb.Overflow
+	v         int64
+	saturated bool
+	retcode   resultcode.RESULT_CODE
+}{
+	{name: "[beyond v1 range]", a: 1 << 60, b: 1, v: 1<<60 + 1},
+	{name: "[overflow error]", a: math.MaxInt64, b: 1, retcode: resultcode.RESULT_CODE_RET_OVERFLOW},
+	{name: "[overflow saturate]", a: math.MaxInt64, b: 1, overflow: addsvcv2pb.Overflow_OVERFLOW_SATURATE, v: math.MaxInt64, saturated: true},
+	{name: "[underflow saturate]", a: math.MinInt64, b: -1, overflow: addsvcv2pb.Overflow_OVERFLOW_SATURATE, v: math.MinInt64, saturated: true},
+	{name: "[two zeroes]", overflow: addsvcv2pb.Overflow_OVERFLOW_SATURATE, retcode: resultcode.RESULT_CODE(service.CodeInvalidInput)},
+}
+
+func TestSumV2OverGRPC(t *testing.T) {
+	cc, closeFn := dialV2Server(t, true)
+	defer closeFn()
+	client := addsvcv2pb.NewAddClient(cc)
+	for _, tt := range sumV2Test {
+		rep, err := client.Sum(context.Background(), &addsvcv2pb.SumRequest{A: tt.a, B: tt.b, Overflow: tt.overflow})
+		if err != nil || rep.V != tt.v || rep.Saturated != tt.saturated || rep.Retcode != tt.retcode {
+			t.Errorf("name:%s got rep:%v err:%v", tt.name, rep, err)
+		}
+	}
+	// v1接口不受影响，仍然限制在±2^53
+	if _, err := pb.NewAddClient(cc).Sum(context.Background(), &pb.SumRequest{A: 1 << 60, B: 1}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("v1 got err:%v", err)
+	}
+}
+
+// 实例没有v2接口时改用v1，范围内的结果与v2相同
+func TestGRPCClientV2Fallback(t *testing.T) {
+	for _, withV2 := range []bool{true, false} {
+		cc, closeFn := dialV2Server(t, withV2)
+		eps := NewGRPCClientV2(cc, stdopentracing.NoopTracer{}, log.NewNopLogger())
+		for i := 0; i < 2; i++ {
+			if v, saturated, err := eps.SumOverflow(context.Background(), 1, 2, addsvcv2pb.Overflow_OVERFLOW_SATURATE); err != nil || v != 3 || saturated {
+				t.Errorf("withV2:%v got v:%d saturated:%v err:%v", withV2, v, saturated, err)
+			}
+			if v, err := eps.Concat(context.Background(), "a", "b"); err != nil || v != "ab" {
+				t.Errorf("withV2:%v concat got v:%s err:%v", withV2, v, err)
+			}
+		}
+		closeFn()
+	}
+}
+
+func TestSumV2OverHTTP(t *testing.T) {
+	logger := log.NewNopLogger()
+	tracer := stdopentracing.NoopTracer{}
+	srv := httptest.NewServer(NewHTTPHandlerV2(endpoint2.NewV2(service.NewBasicService(logger), logger, tracer, endpoint2.Deps{}), tracer, logger))
+	defer srv.Close()
+
+	for _, tt := range sumV2Test {
+		body, _ := json.Marshal(&endpoint2.SumV2Request{A: tt.a, B: tt.b, Overflow: tt.overflow})
+		rsp, err := http.Post(srv.URL+"/v2/sum", "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got endpoint2.SumV2Response
+		err = json.NewDecoder(rsp.Body).Decode(&got)
+		rsp.Body.Close()
+		if err != nil || got.V != tt.v || got.Saturated != tt.saturated || got.RetCode != tt.retcode {
+			t.Errorf("name:%s got rsp:%+v err:%v", tt.name, got, err)
+		}
+	}
+	// int64为字符串，超过2^53的整数不丢失精度
+	rsp, err := http.Post(srv.URL+"/v2/sum", "application/json", bytes.NewReader([]byte(`{"a": "9007199254740993", "b": "1"}`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]interface{}
+	json.NewDecoder(rsp.Body).Decode(&got)
+	rsp.Body.Close()
+	if got["v"] != "9007199254740994" {
+		t.Errorf("got rsp:%v", got)
+	}
+	// 数字不是合法的请求
+	rsp, err = http.Post(srv.URL+"/v2/sum", "application/json", bytes.NewReader([]byte(`{"a": 1, "b": 2}`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusBadRequest {
+		t.Errorf("got status:%d", rsp.StatusCode)
+	}
+}
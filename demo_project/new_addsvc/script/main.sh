@@ -20,7 +20,7 @@ declare CMD_ARRAY=()
 
 fn_init_cmd() {
 	# ------------------- 所有的CMD选项 ----------------------
-	CMD_ARRAY=("gen" "gofmt" "govet")
+	CMD_ARRAY=("gen" "gen_thrift" "gen_kit" "gen_web" "gofmt" "govet")
 	readonly    CMD_ARRAY # 不能在创建数组的时候使用readonly
 
 	# ...CMD_on_ok后缀的指令 表示 CMD指令执行成功后要继续执行的指令，类似的还有_on_fail,  _on_any
@@ -28,9 +28,22 @@ fn_init_cmd() {
 	# 注意：这里定义的变量当做全局变量使用，请不要在此函数外定义xxx_cmd这样的变量，会干扰
 
 	# gen, 关于protoc命令，若后续在pb/proto/下增加目录，就需要适当添加相应目录到命令中(-I=../pb/proto/sub_folder)，仅添加proto文件则无需修改命令
-	readonly    gen_cmd="protoc -I=../pb/proto ../pb/proto/*.proto --go_out=plugins=grpc:$PROTO_OUTPUT_DIR"
+	# 同时生成grpc-gateway的反向代理(*.pb.gw.go)，需要protoc-gen-grpc-gateway(v1)，import的google/api/*.proto在pb/proto/google/下
+	readonly    gen_cmd="protoc -I=../pb/proto ../pb/proto/*.proto --go_out=plugins=grpc:$PROTO_OUTPUT_DIR --grpc-gateway_out=logtostderr=true:$PROTO_OUTPUT_DIR"
 	readonly    gen_cmd_on_ok="echo gen proto ok"
 	readonly    gen_cmd_on_fail="echo gen proto fail"
+	# gen_thrift, 生成pb/thrift/下的thrift文件对应的代码到pb/gen-go/(包名见thrift文件中的namespace)
+	readonly    gen_thrift_cmd="thrift -r --gen go:package_prefix=new_addsvc/pb/gen-go/,thrift_import=github.com/apache/thrift/lib/go/thrift -out ../pb/gen-go ../pb/thrift/addsvc.thrift"
+	readonly    gen_thrift_cmd_on_ok="echo gen thrift ok"
+	readonly    gen_thrift_cmd_on_fail="echo gen thrift fail"
+	# gen_kit, 修改proto后执行(在gen之后)，根据proto生成endpoint层和grpc transport层的重复代码(见cmd/protogen)
+	readonly    gen_kit_cmd="go generate $PROJECT_DIR/pkg/endpoint/"
+	readonly    gen_kit_cmd_on_ok="echo gen kit ok"
+	readonly    gen_kit_cmd_on_fail="echo gen kit fail"
+	# gen_web, 生成浏览器client(web/client.ts)使用的js/ts代码到web/gen/，需要protoc-gen-grpc-web，grpcwebtext模式支持服务端流
+	readonly    gen_web_cmd="protoc -I=../pb/proto ../pb/proto/*.proto --js_out=import_style=commonjs,binary:$PROJECT_DIR/web/gen --grpc-web_out=import_style=typescript,mode=grpcwebtext:$PROJECT_DIR/web/gen"
+	readonly    gen_web_cmd_on_ok="echo gen web ok"
+	readonly    gen_web_cmd_on_fail="echo gen web fail"
 	# gofmt
 	readonly    gofmt_cmd="gofmt -l -s -w $PROJECT_DIR"
 	# govet
@@ -176,6 +189,7 @@ cd /go/go-kit-examples/template/script
 ./main.sh gen ../../../  后面这个是项目根目录所在路径, 如/path/to/new_addsvc，注意proto文件中 "option go_package"最好设置为以项目根目录名开头的pkg名
 ./main.sh gofmt ../../   注意，为避免代码格式化的范围超出你的预期，可以用绝对路径指定，如/path/to/project_root
 ./main.sh govet ../../   这里也可以用绝对路径指定，比如/path/to/project_root
+./main.sh gen_web        生成web/gen/下的grpc-web js/ts代码，见web/client.ts
 
 # 以上命令末尾也可不加路径，默认是new_addsvc所在路径，若要移植脚本适配其他项目，只需修改 fn_init_cmd 函数中定义的cmd即可
 EOF
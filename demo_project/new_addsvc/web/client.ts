@@ -0,0 +1,37 @@
+/*
+浏览器通过grpc-web调用new_addsvc(addsvc需以 -grpc.web.port 8082 -grpc.web.origins http://localhost:3000 启动)：
+  1. 生成代码：cd ../script && ./main.sh gen_web(需要protoc-gen-grpc-web，见 https://github.com/grpc/grpc-web/releases)
+  2. npm install && npm run build，在页面中引入dist/client.js
+开启认证时在metadata中传入JWT，与grpc client相同
+*/
+import {AddClient} from './gen/AddsvcServiceClientPb';
+import {SumRequest, SumSeriesRequest} from './gen/addsvc_pb';
+
+const client = new AddClient('http://localhost:8082');
+
+function metadata(token?: string): {[key: string]: string} {
+  return token ? {authorization: 'Bearer ' + token} : {};
+}
+
+// 一元调用，业务错误在retcode中，调用错误(如参数校验失败、认证失败)在err.code中(grpc状态码)
+export async function sum(a: number, b: number, token?: string): Promise<number> {
+  const req = new SumRequest();
+  req.setA(a);
+  req.setB(b);
+  const rsp = await client.sum(req, metadata(token));
+  return rsp.getV();
+}
+
+// 服务端流：每加一个数返回一次当前的和，客户端流和双向流需要addsvc开启 -grpc.web.websocket
+export function sumSeries(nums: number[], onSum: (v: number) => void, token?: string): Promise<void> {
+  const req = new SumSeriesRequest();
+  req.setNumsList(nums);
+  return new Promise((resolve, reject) => {
+    client.sumSeries(req, metadata(token))
+      .on('data', (rsp) => onSum(rsp.getV()))
+      .on('error', reject)
+      .on('end', () => resolve());
+  });
+}
+
+sum(1, 2).then((v) => console.log('sum:', v), (err) => console.error('sum failed:', err.code, err.message));
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"github.com/go-kit/kit/log"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"go-util/_go"
+	"go-util/_util"
+	"gokit_foundation"
+	"gokit_foundation/errs"
+	"gokit_foundation/logging"
+	"gokit_foundation/sdclient"
+	"net"
+	addclient "new_addsvc/client"
+	"ordersvc/pkg/endpoint"
+	"ordersvc/pkg/service"
+	"ordersvc/pkg/transport"
+	"os"
+	"time"
+	userclient "usersvc/client"
+)
+
+/*
+ordersvc演示使用saga协调多个服务的操作(见pkg/saga、service.Service)，依赖：
+-	usersvc(从consul发现实例，HTTP调用，设置了-usersvc.addr时直连)、new_addsvc(从consul发现实例，gRPC调用)
+	启动时不检查下游是否可用，下单时下游不可用则saga失败并补偿
+测试：
+	curl -XPOST localhost:8092/orders -d '{"order_id":"o1","name":"Jack","email":"jack@example.com","amount":100}'
+	curl -XPOST localhost:8092/orders/o1/cancel
+*/
+
+var (
+	fs           = flag.NewFlagSet("ordersvc", flag.ExitOnError)
+	httpAddr     = fs.String("http.addr", ":8092", "HTTP listen address")
+	usersvcAddr  = fs.String("usersvc.addr", "", "usersvc HTTP address, discover instances from consul if empty")
+	consulAddr   = fs.String("consul.addr", "127.0.0.1:8500", "Consul agent address, used to discover usersvc and new_addsvc")
+	callTimeout  = fs.Duration("call.timeout", time.Second, "timeout of each call to usersvc and new_addsvc")
+	stepTimeout  = fs.Duration("saga.step.timeout", 2*time.Second, "timeout of each saga step, including retries")
+	compRetries  = fs.Int("saga.compensate.retries", 3, "retries of a failed compensation")
+	fee          = fs.Int("order.fee", 10, "fee of each order")
+	creditLimit  = fs.Int("order.credit.limit", 1000, "orders whose total(amount+fee) exceeds this are rejected and compensated")
+	httpMaxConns = fs.Int("http.max.conns", 0, "max concurrent http connections, 0 means no limit")
+	httpH2C      = fs.Bool("http.h2c", false, "serve HTTP/2 without TLS(h2c) as well")
+	errorMap     = fs.String("error.map", "", "override error to http status mapping, e.g. unavailable=:502, see errs.ParseMapper")
+)
+
+var (
+	logger  log.Logger
+	httpSrv *gokit_foundation.HTTPServer
+)
+
+func main() {
+	_ = fs.Parse(os.Args[1:])
+
+	logger = gokit_foundation.NewKvLogger(nil)
+	gokit_foundation.RegisterLogContextKey("request_id", gokit_foundation.CtxKeyRequestID)
+	gokit_foundation.RegisterLogContextKey("trace_id", gokit_foundation.CtxKeyTraceID)
+	gokit_foundation.RegisterLogContextKey("tenant", gokit_foundation.CtxKeyTenant)
+	logging.Default = logger
+	tracer := stdopentracing.GlobalTracer()
+
+	// 添加任务之前的准备步骤通过tg.Setup执行，失败时不启动任何任务，由tg.Err报告是哪一步失败
+	tg := _go.NewTaskGroup()
+	// transport层按服务名取得错误映射，见errs.For
+	tg.Setup("error map", func() error {
+		m, err := errs.ParseMapper(*errorMap)
+		if err == nil {
+			errs.Register(transport.SvcName, m)
+		}
+		return err
+	})
+	var (
+		users     service.UserService
+		add       service.AddService
+		stopUsers func()
+		stopAdd   func()
+	)
+	tg.Setup("usersvc client", func() (err error) { users, stopUsers, err = newUserClient(); return })
+	tg.Setup("addsvc client", func() (err error) {
+		add, stopAdd, err = addclient.New(*consulAddr, logger, sdclient.WithCallTimeout(*callTimeout), sdclient.WithRetry(3, *stepTimeout))
+		return
+	})
+
+	conf := service.DefaultConfig()
+	conf.Fee, conf.CreditLimit = *fee, *creditLimit
+	conf.StepTimeout, conf.CompensateTimeout, conf.CompensateRetries = *stepTimeout, *callTimeout, *compRetries
+
+	// 依次创建 svc，endpoint，transport三层的对象
+	svc := service.New(logger, users, add, conf)
+	endpoints := endpoint.New(svc, tracer, logger)
+	handler := gokit_foundation.RecoveryHTTPHandler(logger, nil)(transport.NewHTTPHandler(endpoints, tracer, logger))
+	httpSrv = gokit_foundation.NewHTTPServer(handler, httpConf())
+
+	// 准备步骤失败时Run直接返回
+	addTaskListenSignal(tg)
+	addTaskHttpSrv(tg, *httpAddr)
+	tg.OnReady(func() {
+		logger.Log("main", "all tasks ready")
+	})
+	tg.Run()
+	// 停止client的consul watch，创建失败时为nil
+	if stopUsers != nil {
+		stopUsers()
+	}
+	if stopAdd != nil {
+		stopAdd()
+	}
+	if err := tg.Err(); err != nil {
+		logger.Log("main", "startup failed", "err", err)
+		os.Exit(1)
+	}
+}
+
+// 超时使用默认值(见gokit_foundation.DefaultHTTPServerConfig)，WriteTimeout需大于saga的最长耗时
+// 设置了-usersvc.addr时直连该实例，否则从consul发现实例，重试与addsvc client相同
+func newUserClient() (service.UserService, func(), error) {
+	if *usersvcAddr != "" {
+		users, err := userclient.NewDirect(*usersvcAddr, *callTimeout, logger)
+		return users, func() {}, err
+	}
+	return userclient.New(*consulAddr, logger, sdclient.WithCallTimeout(*callTimeout), sdclient.WithRetry(3, *stepTimeout))
+}
+
+func httpConf() gokit_foundation.HTTPServerConfig {
+	conf := gokit_foundation.DefaultHTTPServerConfig()
+	conf.MaxConns, conf.H2C = *httpMaxConns, *httpH2C
+	return conf
+}
+
+func onClose() {
+	logger.Log("onClose", "shutting down")
+}
+
+// 添加后台任务：监听退出信号（第一个添加）
+func addTaskListenSignal(tg *_go.TaskGroup) {
+	tk, _ := _util.ListenSignalTask(logger, onClose)
+	tg.Add(tk).Interrupt(func(err error) {
+		logger.Log("signalTask", "exited", "clean", err)
+	})
+}
+
+func addTaskHttpSrv(tg *_go.TaskGroup, addr string) {
+	httpSrvTask := func(ctx context.Context) error {
+		logger.Log("NewTaskGroup", "httpSrvTask", "httpSrvAddr", addr)
+
+		lis, err := net.Listen("tcp", addr)
+		if err != nil {
+			return err
+		}
+		_go.TaskReady(ctx)
+		return httpSrv.Serve(lis)
+	}
+	tg.Add(httpSrvTask).WaitReady().Interrupt(func(err error) {
+		if err != nil {
+			logger.Log("httpSrvTask", "exited", "err", err)
+		} else {
+			// 等待正在执行的saga完成(包括补偿)
+			closeCtx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+			defer cancel()
+			err := httpSrv.Shutdown(closeCtx)
+			logger.Log("httpSrvTask", "exited", "clean", err)
+		}
+	})
+}
@@ -0,0 +1,20 @@
+module ordersvc
+
+go 1.12
+
+require (
+	github.com/go-kit/kit v0.10.0
+	github.com/gorilla/mux v1.7.3
+	github.com/opentracing/opentracing-go v1.1.0
+	go-util v0.0.0-00010101000000-000000000000
+	gokit_foundation v0.0.0-00010101000000-000000000000
+	new_addsvc v0.0.0-00010101000000-000000000000
+	usersvc v0.0.0-00010101000000-000000000000
+)
+
+replace (
+	go-util => ../../go-util
+	gokit_foundation => ../../gokit_foundation
+	new_addsvc => ../new_addsvc
+	usersvc => ../usersvc
+)
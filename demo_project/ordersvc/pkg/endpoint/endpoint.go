@@ -0,0 +1,73 @@
+package endpoint
+
+import (
+	"context"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"gokit_foundation/mwchain"
+	"gokit_foundation/tenant"
+	"ordersvc/pkg/service"
+)
+
+// Endpoints内包含的ep对应service每个接口
+type OrderSvcEndpoints struct {
+	CreateOrderEndpoint endpoint.Endpoint
+	GetOrderEndpoint    endpoint.Endpoint
+	CancelOrderEndpoint endpoint.Endpoint
+}
+
+// 将一个Service对象转为Endpoints对象，每个ep都安装追踪mw，下游调用(usersvc、addsvc)作为子span
+// ordersvc不上报指标，panic只记录日志
+func New(svc service.Service, otTracer stdopentracing.Tracer, logger log.Logger) OrderSvcEndpoints {
+	eps := mwchain.New().
+		WithTracing(otTracer).
+		// ordersvc不做认证，租户来自X-Tenant-Id header，写入ctx后由usersvc client传给下游
+		WithTenant(tenant.Config{}).
+		// service层和saga通过logging.FromContext取得带request_id、tenant的logger
+		WithRequestLogger(logger).
+		WithRecovery(logger, nil).
+		MustBuild(map[string]endpoint.Endpoint{
+			"CreateOrder": MakeCreateOrderEndpoint(svc),
+			"GetOrder":    MakeGetOrderEndpoint(svc),
+			"CancelOrder": MakeCancelOrderEndpoint(svc),
+		})
+	return OrderSvcEndpoints{
+		CreateOrderEndpoint: eps["CreateOrder"],
+		GetOrderEndpoint:    eps["GetOrder"],
+		CancelOrderEndpoint: eps["CancelOrder"],
+	}
+}
+
+// 业务错误映射为RetCode，系统错误作为endpoint的err返回
+func orderResponse(o *service.Order, err error) (*OrderResponse, error) {
+	if err != nil && !service.IsBizError(err) {
+		return nil, err
+	}
+	rsp := &OrderResponse{Order: o, RetCode: service.ErrorToRetCode(err)}
+	if err != nil {
+		rsp.Msg = err.Error()
+	}
+	return rsp, nil
+}
+
+func MakeCreateOrderEndpoint(s service.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(*CreateOrderRequest)
+		return orderResponse(s.CreateOrder(ctx, req.ID, req.Name, req.Email, req.Amount))
+	}
+}
+
+func MakeGetOrderEndpoint(s service.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(*GetOrderRequest)
+		return orderResponse(s.GetOrder(ctx, req.ID))
+	}
+}
+
+func MakeCancelOrderEndpoint(s service.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(*CancelOrderRequest)
+		return orderResponse(s.CancelOrder(ctx, req.ID))
+	}
+}
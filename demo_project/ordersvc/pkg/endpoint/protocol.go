@@ -0,0 +1,30 @@
+package endpoint
+
+import "ordersvc/pkg/service"
+
+/*
+endpoint层的req和rsp，与usersvc一致：业务错误通过RetCode返回，系统错误由endpoint直接返回err
+saga失败不是业务错误，订单的status为compensated等，原因见order.error
+*/
+
+type CreateOrderRequest struct {
+	ID     string `json:"order_id"`
+	Name   string `json:"name"`
+	Email  string `json:"email"`
+	Amount int    `json:"amount"`
+}
+
+type GetOrderRequest struct {
+	ID string `json:"order_id"`
+}
+
+type CancelOrderRequest struct {
+	ID string `json:"order_id"`
+}
+
+// 所有接口的response
+type OrderResponse struct {
+	Order   *service.Order `json:"order,omitempty"`
+	RetCode int            `json:"ret_code"`
+	Msg     string         `json:"msg,omitempty"`
+}
@@ -0,0 +1,132 @@
+package saga
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"strings"
+	"time"
+)
+
+/*
+saga：将跨服务的操作拆分为多个本地事务(Step)依次执行，某一步失败时按相反顺序执行已完成步骤的补偿操作，
+使各服务最终回到操作前的状态(而不是两阶段提交那样锁住所有参与方的资源)：
+-	每一步使用单独的超时(StepTimeout)，避免某个下游服务卡住整个saga
+-	失败的步骤本身不补偿，Action失败时应没有副作用，或由下游的幂等键保证重试不会重复执行
+-	补偿操作必须是幂等的，失败时会重试(CompensateRetries)，也可能被调用方再次调用(如取消订单时)
+-	补偿不受调用方ctx取消的影响(client断开时也要完成补偿)，但保留ctx中的值(如trace、token)
+*/
+
+type Step struct {
+	Name   string
+	Action func(ctx context.Context) error
+	// 为nil时表示该步骤没有需要撤销的副作用(如只读的计算)
+	Compensate func(ctx context.Context) error
+}
+
+type Saga struct {
+	Steps             []Step
+	StepTimeout       time.Duration // 每一步Action的超时，0表示只受调用方ctx限制
+	CompensateTimeout time.Duration // 每一次补偿调用的超时，0表示不限制
+	CompensateRetries int           // 补偿失败后的重试次数，从100ms开始翻倍等待
+	Logger            log.Logger
+}
+
+// Error Run失败时返回，Err为失败步骤的错误，CompensateErrs为补偿失败的步骤(为空表示已全部撤销)
+type Error struct {
+	Step           string
+	Err            error
+	CompensateErrs []error
+}
+
+func (e *Error) Error() string {
+	s := fmt.Sprintf("saga: step %s: %v", e.Step, e.Err)
+	if len(e.CompensateErrs) > 0 {
+		msgs := make([]string, len(e.CompensateErrs))
+		for i, err := range e.CompensateErrs {
+			msgs[i] = err.Error()
+		}
+		s += "; compensate failed: " + strings.Join(msgs, "; ")
+	}
+	return s
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// Compensated 失败前完成的步骤是否都已撤销
+func (e *Error) Compensated() bool { return len(e.CompensateErrs) == 0 }
+
+// Run 依次执行所有步骤，全部成功时返回nil，否则补偿已完成的步骤后返回*Error
+func (s *Saga) Run(ctx context.Context) error {
+	for i, step := range s.Steps {
+		err := s.runAction(ctx, step)
+		if err == nil {
+			continue
+		}
+		s.log("saga", "step failed", "step", step.Name, "err", err)
+		return &Error{Step: step.Name, Err: err, CompensateErrs: s.Compensate(ctx, i)}
+	}
+	return nil
+}
+
+func (s *Saga) runAction(ctx context.Context, step Step) error {
+	if s.StepTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.StepTimeout)
+		defer cancel()
+	}
+	return step.Action(ctx)
+}
+
+// Compensate 按相反顺序补偿前n个步骤，某一步补偿失败(重试后)时继续补偿其余步骤，返回补偿失败的错误
+func (s *Saga) Compensate(ctx context.Context, n int) (errs []error) {
+	ctx = detached{ctx}
+	for i := n - 1; i >= 0; i-- {
+		step := s.Steps[i]
+		if step.Compensate == nil {
+			continue
+		}
+		if err := s.compensate(ctx, step); err != nil {
+			s.log("saga", "compensate failed", "step", step.Name, "err", err)
+			errs = append(errs, fmt.Errorf("%s: %v", step.Name, err))
+		}
+	}
+	return errs
+}
+
+func (s *Saga) compensate(ctx context.Context, step Step) (err error) {
+	backoff := 100 * time.Millisecond
+	for i := 0; ; i++ {
+		err = s.runCompensate(ctx, step)
+		if err == nil || i >= s.CompensateRetries {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (s *Saga) runCompensate(ctx context.Context, step Step) error {
+	if s.CompensateTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.CompensateTimeout)
+		defer cancel()
+	}
+	return step.Compensate(ctx)
+}
+
+func (s *Saga) log(keyvals ...interface{}) {
+	if s.Logger != nil {
+		s.Logger.Log(keyvals...)
+	}
+}
+
+// 保留父ctx中的值，但没有deadline，也不会被取消
+type detached struct {
+	parent context.Context
+}
+
+func (detached) Deadline() (time.Time, bool)         { return time.Time{}, false }
+func (detached) Done() <-chan struct{}               { return nil }
+func (detached) Err() error                          { return nil }
+func (d detached) Value(key interface{}) interface{} { return d.parent.Value(key) }
@@ -0,0 +1,104 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type ctxKey struct{}
+
+// 记录执行顺序，fail中的action失败，compensateFails为补偿前几次调用失败
+type recorder struct {
+	calls           []string
+	fail            map[string]bool
+	compensateFails map[string]int
+}
+
+func (r *recorder) step(name string, withCompensate bool) Step {
+	s := Step{Name: name, Action: func(ctx context.Context) error {
+		r.calls = append(r.calls, name)
+		if r.fail[name] {
+			return errors.New(name + " failed")
+		}
+		return nil
+	}}
+	if withCompensate {
+		s.Compensate = func(ctx context.Context) error {
+			r.calls = append(r.calls, "undo_"+name)
+			if ctx.Err() != nil || ctx.Value(ctxKey{}) == nil {
+				return errors.New("bad ctx")
+			}
+			if r.compensateFails[name] > 0 {
+				r.compensateFails[name]--
+				return errors.New("undo " + name + " failed")
+			}
+			return nil
+		}
+	}
+	return s
+}
+
+func TestRun(t *testing.T) {
+	test := []struct {
+		name            string
+		fail            map[string]bool
+		compensateFails map[string]int
+		wantCalls       []string
+		wantStep        string
+		wantCompensated bool
+	}{
+		{name: "[ok]", wantCalls: []string{"a", "b", "c"}},
+		{name: "[first failed]", fail: map[string]bool{"a": true}, wantCalls: []string{"a"}, wantStep: "a", wantCompensated: true},
+		// b没有补偿操作
+		{name: "[last failed]", fail: map[string]bool{"c": true},
+			wantCalls: []string{"a", "b", "c", "undo_a"}, wantStep: "c", wantCompensated: true},
+		{name: "[compensate retried]", fail: map[string]bool{"c": true}, compensateFails: map[string]int{"a": 1},
+			wantCalls: []string{"a", "b", "c", "undo_a", "undo_a"}, wantStep: "c", wantCompensated: true},
+		{name: "[compensate failed]", fail: map[string]bool{"c": true}, compensateFails: map[string]int{"a": 2},
+			wantCalls: []string{"a", "b", "c", "undo_a", "undo_a"}, wantStep: "c"},
+	}
+	for _, tt := range test {
+		r := &recorder{fail: tt.fail, compensateFails: tt.compensateFails}
+		s := &Saga{Steps: []Step{r.step("a", true), r.step("b", false), r.step("c", true)}, CompensateRetries: 1}
+		// 调用方的ctx已取消，补偿仍使用未取消的ctx，并保留其中的值
+		ctx, cancel := context.WithCancel(context.WithValue(context.Background(), ctxKey{}, 1))
+		if tt.wantStep != "" {
+			s.Steps[len(s.Steps)-1].Action = func(ctx context.Context) error {
+				r.calls = append(r.calls, "c")
+				cancel()
+				if r.fail["c"] {
+					return errors.New("c failed")
+				}
+				return nil
+			}
+		}
+		err := s.Run(ctx)
+		cancel()
+		if !reflect.DeepEqual(r.calls, tt.wantCalls) {
+			t.Errorf("%s got calls:%v want:%v", tt.name, r.calls, tt.wantCalls)
+		}
+		var e *Error
+		if tt.wantStep == "" {
+			if err != nil {
+				t.Errorf("%s got err:%v", tt.name, err)
+			}
+			continue
+		}
+		if !errors.As(err, &e) || e.Step != tt.wantStep || e.Compensated() != tt.wantCompensated {
+			t.Errorf("%s got err:%v", tt.name, err)
+		}
+	}
+}
+
+func TestStepTimeout(t *testing.T) {
+	s := &Saga{StepTimeout: 10 * time.Millisecond, Steps: []Step{{Name: "slow", Action: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}}}}
+	if err := s.Run(context.Background()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got err:%v", err)
+	}
+}
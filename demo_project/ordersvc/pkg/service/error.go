@@ -0,0 +1,49 @@
+package service
+
+import "errors"
+
+/*
+与usersvc一致：业务错误使用Error类型定义，Code会被endpoint层映射为response.RetCode
+非Error类型的err(如store故障)属于系统错误，endpoint层直接返回err
+下游服务的错误不会原样返回，saga失败时记录在Order.Error中
+*/
+const (
+	CodeOK      = 0
+	CodeUnknown = 5
+
+	// 1001...
+	CodeInvalidInput = 1001
+	CodeNotFound     = 1004
+	CodeInProgress   = 1009
+)
+
+type Error struct {
+	Code int
+	Msg  string
+}
+
+func NewError(code int, msg string) *Error {
+	return &Error{Code: code, Msg: msg}
+}
+
+func (e *Error) Error() string {
+	return e.Msg
+}
+
+// IsBizError 是否是service层定义的业务错误
+func IsBizError(err error) bool {
+	var e *Error
+	return errors.As(err, &e)
+}
+
+// ErrorToRetCode 统一将service层返回的err转为RetCode
+func ErrorToRetCode(err error) int {
+	if err == nil {
+		return CodeOK
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return CodeUnknown
+}
@@ -0,0 +1,253 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"gokit_foundation/idempotency"
+	"gokit_foundation/logging"
+	"ordersvc/pkg/saga"
+	"sync"
+	"time"
+	"usersvc/pkg/repository"
+	usersvc "usersvc/pkg/service"
+)
+
+/*
+下单是一个跨服务的saga(见pkg/saga)：
+	1. create_user    在usersvc创建下单用户    补偿：删除该用户
+	2. compute_total  调用addsvc计算总价       只读，无需补偿
+	3. finalize       检查额度并完成订单       超出额度时失败，触发补偿
+任一步失败后按相反顺序补偿，订单状态为compensated(补偿失败时为compensation_failed，可通过CancelOrder重试)
+订单id由client生成，相同id重复下单返回已有的订单，不会重复执行saga；创建用户时使用由订单id派生的幂等键，
+ordersvc在saga执行中途重启后，client重试不会在usersvc重复创建
+*/
+
+type Service interface {
+	CreateOrder(ctx context.Context, id, name, email string, amount int) (*Order, error)
+	GetOrder(ctx context.Context, id string) (*Order, error)
+	// 撤销一个已完成的订单(执行所有补偿)，重复调用返回相同的结果
+	CancelOrder(ctx context.Context, id string) (*Order, error)
+}
+
+type Status string
+
+const (
+	StatusPending            Status = "pending"
+	StatusCompleted          Status = "completed"
+	StatusCompensated        Status = "compensated"
+	StatusCompensationFailed Status = "compensation_failed"
+	StatusCancelled          Status = "cancelled"
+)
+
+type Order struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Email  string `json:"email"`
+	UserID int64  `json:"user_id,omitempty"`
+	Amount int    `json:"amount"`
+	Fee    int    `json:"fee"`
+	Total  int    `json:"total,omitempty"`
+	Status Status `json:"status"`
+	// saga失败的原因
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// saga依赖的下游服务，usersvc/client与new_addsvc/client返回的service均满足
+type UserService interface {
+	CreateUser(ctx context.Context, name, email string) (*repository.User, error)
+	DeleteUser(ctx context.Context, id int64) error
+}
+
+type AddService interface {
+	Sum(ctx context.Context, a, b int) (int, error)
+}
+
+type Config struct {
+	Fee         int // 每个订单的手续费，总价为amount+fee
+	CreditLimit int // 总价超出此值时finalize失败
+	// 见saga.Saga的同名字段
+	StepTimeout       time.Duration
+	CompensateTimeout time.Duration
+	CompensateRetries int
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Fee:               10,
+		CreditLimit:       1000,
+		StepTimeout:       2 * time.Second,
+		CompensateTimeout: 2 * time.Second,
+		CompensateRetries: 3,
+	}
+}
+
+var (
+	ErrInvalidOrder    = NewError(CodeInvalidInput, "order id, name, email are required and amount must be positive")
+	ErrOrderNotFound   = NewError(CodeNotFound, "order not found")
+	ErrOrderInProgress = NewError(CodeInProgress, "order is in progress, retry later")
+	ErrCreditExceeded  = errors.New("credit limit exceeded")
+)
+
+func NewBasicService(lgr log.Logger, users UserService, add AddService, conf Config) Service {
+	return &basicService{
+		logger: lgr,
+		users:  users,
+		add:    add,
+		conf:   conf,
+		orders: map[string]*Order{},
+	}
+}
+
+// 演示使用进程内的map保存订单，重启后丢失
+type basicService struct {
+	logger log.Logger
+	users  UserService
+	add    AddService
+	conf   Config
+
+	mu     sync.Mutex
+	orders map[string]*Order
+}
+
+func (s *basicService) CreateOrder(ctx context.Context, id, name, email string, amount int) (*Order, error) {
+	if id == "" || name == "" || email == "" || amount <= 0 {
+		return nil, ErrInvalidOrder
+	}
+	s.mu.Lock()
+	if o, ok := s.orders[id]; ok {
+		s.mu.Unlock()
+		return s.result(o)
+	}
+	o := &Order{ID: id, Name: name, Email: email, Amount: amount, Fee: s.conf.Fee, Status: StatusPending, CreatedAt: time.Now()}
+	s.orders[id] = o
+	s.mu.Unlock()
+
+	// saga执行期间o只被当前goroutine修改，其他请求看到pending状态时直接返回ErrOrderInProgress
+	done := *o
+	err := s.saga(ctx, &done).Run(ctx)
+	if err == nil {
+		done.Status = StatusCompleted
+	} else {
+		done.Error = err.Error()
+		var e *saga.Error
+		if errors.As(err, &e) && e.Compensated() {
+			done.Status = StatusCompensated
+		} else {
+			done.Status = StatusCompensationFailed
+		}
+	}
+	s.mu.Lock()
+	*o = done
+	s.mu.Unlock()
+	return &done, nil
+}
+
+func (s *basicService) GetOrder(_ context.Context, id string) (*Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.orders[id]
+	if !ok {
+		return nil, ErrOrderNotFound
+	}
+	cp := *o
+	return &cp, nil
+}
+
+func (s *basicService) CancelOrder(ctx context.Context, id string) (*Order, error) {
+	s.mu.Lock()
+	o, ok := s.orders[id]
+	if !ok {
+		s.mu.Unlock()
+		return nil, ErrOrderNotFound
+	}
+	if o.Status != StatusCompleted && o.Status != StatusCompensationFailed {
+		// 已撤销的订单直接返回
+		s.mu.Unlock()
+		return s.result(o)
+	}
+	done := *o
+	o.Status = StatusPending
+	s.mu.Unlock()
+
+	// 补偿是幂等的，补偿失败的订单再次执行所有补偿即可
+	sg := s.saga(ctx, &done)
+	if errs := sg.Compensate(ctx, len(sg.Steps)); len(errs) > 0 {
+		done.Status = StatusCompensationFailed
+		done.Error = fmt.Sprintf("cancel: %v", errs)
+	} else if done.Status == StatusCompleted {
+		done.Status = StatusCancelled
+	} else {
+		done.Status = StatusCompensated
+	}
+	s.mu.Lock()
+	*o = done
+	s.mu.Unlock()
+	return &done, nil
+}
+
+// 调用时需持有s.mu
+func (s *basicService) result(o *Order) (*Order, error) {
+	if o.Status == StatusPending {
+		return nil, ErrOrderInProgress
+	}
+	cp := *o
+	return &cp, nil
+}
+
+// CreateUser的幂等键，同一订单的saga重复执行时usersvc返回同一个用户
+func createUserKey(orderID string) string {
+	return "order:" + orderID + ":create_user"
+}
+
+// saga的日志带上请求级别logger的字段(request_id等)，见logging.FromContext
+func (s *basicService) saga(ctx context.Context, o *Order) *saga.Saga {
+	return &saga.Saga{
+		StepTimeout:       s.conf.StepTimeout,
+		CompensateTimeout: s.conf.CompensateTimeout,
+		CompensateRetries: s.conf.CompensateRetries,
+		Logger:            log.With(logging.FromContext(ctx), "order", o.ID),
+		Steps: []saga.Step{
+			{
+				Name: "create_user",
+				Action: func(ctx context.Context) error {
+					u, err := s.users.CreateUser(idempotency.WithKey(ctx, createUserKey(o.ID)), o.Name, o.Email)
+					if err != nil {
+						return err
+					}
+					o.UserID = u.ID
+					return nil
+				},
+				Compensate: func(ctx context.Context) error {
+					// 用户已被删除(之前的补偿已成功)时视为成功
+					if err := s.users.DeleteUser(ctx, o.UserID); err != nil && err != usersvc.ErrUserNotFound {
+						return err
+					}
+					return nil
+				},
+			},
+			{
+				Name: "compute_total",
+				Action: func(ctx context.Context) error {
+					total, err := s.add.Sum(ctx, o.Amount, o.Fee)
+					if err != nil {
+						return err
+					}
+					o.Total = total
+					return nil
+				},
+			},
+			{
+				Name: "finalize",
+				Action: func(ctx context.Context) error {
+					if o.Total > s.conf.CreditLimit {
+						return ErrCreditExceeded
+					}
+					return nil
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/go-kit/kit/log"
+	"gokit_foundation/idempotency"
+	"sync"
+	"testing"
+	"usersvc/pkg/repository"
+	usersvc "usersvc/pkg/service"
+)
+
+// 内存实现的usersvc，相同幂等键返回同一个用户
+type fakeUsers struct {
+	mu         sync.Mutex
+	users      map[int64]string
+	keys       map[string]int64
+	nextID     int64
+	createErr  error
+	deleteErr  error
+	deleteCall int
+}
+
+func newFakeUsers() *fakeUsers {
+	return &fakeUsers{users: map[int64]string{}, keys: map[string]int64{}}
+}
+
+func (f *fakeUsers) CreateUser(ctx context.Context, name, email string) (*repository.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.createErr != nil {
+		return nil, f.createErr
+	}
+	key := idempotency.KeyFromContext(ctx)
+	if id, ok := f.keys[key]; ok && key != "" {
+		return &repository.User{ID: id, Name: name, Email: email}, nil
+	}
+	f.nextID++
+	f.users[f.nextID] = name
+	f.keys[key] = f.nextID
+	return &repository.User{ID: f.nextID, Name: name, Email: email}, nil
+}
+
+func (f *fakeUsers) DeleteUser(_ context.Context, id int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.deleteCall++
+	if f.deleteErr != nil {
+		return f.deleteErr
+	}
+	if _, ok := f.users[id]; !ok {
+		return usersvc.ErrUserNotFound
+	}
+	delete(f.users, id)
+	return nil
+}
+
+type fakeAdd struct{ err error }
+
+func (f fakeAdd) Sum(_ context.Context, a, b int) (int, error) { return a + b, f.err }
+
+func newTestService(users UserService, add AddService) Service {
+	conf := DefaultConfig()
+	conf.CompensateRetries = 0
+	return NewBasicService(log.NewNopLogger(), users, add, conf)
+}
+
+func TestCreateOrder(t *testing.T) {
+	ctx := context.Background()
+	test := []struct {
+		name       string
+		amount     int
+		createErr  error
+		addErr     error
+		wantStatus Status
+		wantUsers  int
+	}{
+		{name: "[completed]", amount: 100, wantStatus: StatusCompleted, wantUsers: 1},
+		{name: "[create_user failed]", amount: 100, createErr: usersvc.ErrEmailExists, wantStatus: StatusCompensated},
+		{name: "[compute_total failed]", amount: 100, addErr: errors.New("addsvc down"), wantStatus: StatusCompensated},
+		{name: "[credit exceeded]", amount: 1000, wantStatus: StatusCompensated},
+	}
+	for _, tt := range test {
+		users := newFakeUsers()
+		users.createErr = tt.createErr
+		svc := newTestService(users, fakeAdd{tt.addErr})
+		o, err := svc.CreateOrder(ctx, "o1", "Jack", "jack@a.com", tt.amount)
+		if err != nil || o.Status != tt.wantStatus || len(users.users) != tt.wantUsers {
+			t.Errorf("%s got order:%+v err:%v users:%v", tt.name, o, err, users.users)
+			continue
+		}
+		// 相同id重复下单返回已有的订单
+		again, err := svc.CreateOrder(ctx, "o1", "Jack", "jack@a.com", tt.amount)
+		if err != nil || *again != *o || len(users.keys) > 1 {
+			t.Errorf("%s retry got order:%+v err:%v", tt.name, again, err)
+		}
+	}
+
+	svc := newTestService(newFakeUsers(), fakeAdd{})
+	if _, err := svc.CreateOrder(ctx, "", "Jack", "jack@a.com", 1); err != ErrInvalidOrder {
+		t.Errorf("got err:%v want ErrInvalidOrder", err)
+	}
+	if _, err := svc.GetOrder(ctx, "o2"); err != ErrOrderNotFound {
+		t.Errorf("got err:%v want ErrOrderNotFound", err)
+	}
+}
+
+func TestCancelOrder(t *testing.T) {
+	ctx := context.Background()
+	users := newFakeUsers()
+	svc := newTestService(users, fakeAdd{})
+	if _, err := svc.CreateOrder(ctx, "o1", "Jack", "jack@a.com", 100); err != nil {
+		t.Fatal(err)
+	}
+
+	// 补偿失败时可以再次取消
+	users.deleteErr = errors.New("usersvc down")
+	if o, err := svc.CancelOrder(ctx, "o1"); err != nil || o.Status != StatusCompensationFailed {
+		t.Fatalf("got order:%+v err:%v", o, err)
+	}
+	users.deleteErr = nil
+	if o, err := svc.CancelOrder(ctx, "o1"); err != nil || o.Status != StatusCompensated || len(users.users) != 0 {
+		t.Fatalf("got order:%+v err:%v users:%v", o, err, users.users)
+	}
+	// 已撤销的订单不再调用补偿
+	calls := users.deleteCall
+	if o, err := svc.CancelOrder(ctx, "o1"); err != nil || o.Status != StatusCompensated || users.deleteCall != calls {
+		t.Errorf("got order:%+v err:%v", o, err)
+	}
+
+	if _, err := svc.CreateOrder(ctx, "o2", "Rose", "rose@a.com", 100); err != nil {
+		t.Fatal(err)
+	}
+	if o, err := svc.CancelOrder(ctx, "o2"); err != nil || o.Status != StatusCancelled {
+		t.Errorf("got order:%+v err:%v", o, err)
+	}
+	// 用户已被删除时补偿视为成功
+	if err := svc.(*basicService).saga(ctx, &Order{UserID: 100}).Steps[0].Compensate(ctx); err != nil {
+		t.Errorf("got err:%v", err)
+	}
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"github.com/go-kit/kit/log"
+	"gokit_foundation/logging"
+)
+
+type Middleware func(Service) Service
+
+// New returns a basic Service with all of the expected middlewares wired in.
+func New(logger log.Logger, users UserService, add AddService, conf Config) Service {
+	var svc Service
+	{
+		svc = NewBasicService(logger, users, add, conf)
+		svc = LoggingMiddleware()(svc)
+	}
+	return svc
+}
+
+// 日志mw，saga每一步的失败由saga.Saga单独记录
+// 使用endpoint层放入ctx的请求级别logger，已带上request_id、method、tenant等字段(见logging.FromContext)
+func LoggingMiddleware() Middleware {
+	return func(next Service) Service {
+		return loggingMiddleware{next}
+	}
+}
+
+type loggingMiddleware struct {
+	next Service
+}
+
+func status(o *Order) Status {
+	if o == nil {
+		return ""
+	}
+	return o.Status
+}
+
+func (mw loggingMiddleware) CreateOrder(ctx context.Context, id, name, email string, amount int) (o *Order, err error) {
+	logger := logging.FromContext(ctx)
+	defer func() {
+		logger.Log("id", id, "amount", amount, "status", status(o), "err", err)
+	}()
+	return mw.next.CreateOrder(ctx, id, name, email, amount)
+}
+
+func (mw loggingMiddleware) GetOrder(ctx context.Context, id string) (o *Order, err error) {
+	logger := logging.FromContext(ctx)
+	defer func() {
+		logger.Log("id", id, "err", err)
+	}()
+	return mw.next.GetOrder(ctx, id)
+}
+
+func (mw loggingMiddleware) CancelOrder(ctx context.Context, id string) (o *Order, err error) {
+	logger := logging.FromContext(ctx)
+	defer func() {
+		logger.Log("id", id, "status", status(o), "err", err)
+	}()
+	return mw.next.CancelOrder(ctx, id)
+}
@@ -0,0 +1,111 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/tracing/opentracing"
+	"github.com/go-kit/kit/transport"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/gorilla/mux"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"gokit_foundation/errs"
+	"gokit_foundation/propagation"
+	"net/http"
+	endpoint2 "ordersvc/pkg/endpoint"
+)
+
+// SvcName 注册错误映射(errs.Register)时使用的服务名
+const SvcName = "OrderSvc"
+
+/*
+HTTP/JSON transport，与usersvc的约定一致
+	POST /orders              {"order_id": "o1", "name": "Jack", "email": "jack@example.com", "amount": 100}
+	GET  /orders/{id}
+	POST /orders/{id}/cancel
+均返回 {"order": {...}, "ret_code": 0}，order_id由client生成，重复下单返回已有的订单
+请求无法解析时返回400，endpoint层返回的err(系统错误)返回500
+Authorization、X-Tenant-Id、X-Request-Id等header(见propagation.Fields)会透传给usersvc和new_addsvc，租户不合法时返回400
+*/
+
+func NewHTTPHandler(endpoints endpoint2.OrderSvcEndpoints, otTracer stdopentracing.Tracer, logger log.Logger) http.Handler {
+	options := []httptransport.ServerOption{
+		httptransport.ServerErrorEncoder(errorEncoder),
+		httptransport.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
+		propagation.HTTPServerBefore(),
+	}
+	withTrace := func(method string) []httptransport.ServerOption {
+		return append(options, httptransport.ServerBefore(opentracing.HTTPToContext(otTracer, method, logger)))
+	}
+
+	r := mux.NewRouter()
+	r.Methods(http.MethodPost).Path("/orders").Handler(httptransport.NewServer(
+		endpoints.CreateOrderEndpoint,
+		decodeHTTPCreateOrderRequest,
+		encodeHTTPGenericResponse,
+		withTrace("CreateOrder")...,
+	))
+	r.Methods(http.MethodGet).Path("/orders/{id}").Handler(httptransport.NewServer(
+		endpoints.GetOrderEndpoint,
+		decodeHTTPGetOrderRequest,
+		encodeHTTPGenericResponse,
+		withTrace("GetOrder")...,
+	))
+	r.Methods(http.MethodPost).Path("/orders/{id}/cancel").Handler(httptransport.NewServer(
+		endpoints.CancelOrderEndpoint,
+		decodeHTTPCancelOrderRequest,
+		encodeHTTPGenericResponse,
+		withTrace("CancelOrder")...,
+	))
+	return r
+}
+
+// 请求无法解析
+type errBadRequest struct {
+	error
+}
+
+type errorWrapper struct {
+	Error string `json:"error"`
+}
+
+func errorEncoder(_ context.Context, err error, w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(err2code(err))
+	_ = json.NewEncoder(w).Encode(errorWrapper{Error: err.Error()})
+}
+
+func err2code(err error) int {
+	var e errBadRequest
+	if errors.As(err, &e) {
+		return http.StatusBadRequest
+	}
+	// 下游返回的*errs.Error按-error.map注册的映射，见errs.Mapper
+	var typed *errs.Error
+	if errors.As(err, &typed) {
+		return errs.For(SvcName).HTTPStatus(typed)
+	}
+	return http.StatusInternalServerError
+}
+
+func decodeHTTPCreateOrderRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req endpoint2.CreateOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, errBadRequest{err}
+	}
+	return &req, nil
+}
+
+func decodeHTTPGetOrderRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return &endpoint2.GetOrderRequest{ID: mux.Vars(r)["id"]}, nil
+}
+
+func decodeHTTPCancelOrderRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return &endpoint2.CancelOrderRequest{ID: mux.Vars(r)["id"]}, nil
+}
+
+func encodeHTTPGenericResponse(_ context.Context, w http.ResponseWriter, response interface{}) error {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	return json.NewEncoder(w).Encode(response)
+}
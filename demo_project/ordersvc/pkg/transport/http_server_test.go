@@ -0,0 +1,91 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"github.com/go-kit/kit/log"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"ordersvc/pkg/endpoint"
+	"ordersvc/pkg/service"
+	"strings"
+	"testing"
+)
+
+// 订单o1已完成，o500模拟store故障
+type stubService struct{}
+
+var errStore = errors.New("store down")
+
+func (stubService) CreateOrder(_ context.Context, id, name, email string, amount int) (*service.Order, error) {
+	if id == "" {
+		return nil, service.ErrInvalidOrder
+	}
+	return &service.Order{ID: id, Name: name, Email: email, Amount: amount, Status: service.StatusCompleted}, nil
+}
+
+func (stubService) GetOrder(_ context.Context, id string) (*service.Order, error) {
+	switch id {
+	case "o1":
+		return &service.Order{ID: id, Status: service.StatusCompleted}, nil
+	case "o500":
+		return nil, errStore
+	}
+	return nil, service.ErrOrderNotFound
+}
+
+func (s stubService) CancelOrder(ctx context.Context, id string) (*service.Order, error) {
+	o, err := s.GetOrder(ctx, id)
+	if err == nil {
+		o.Status = service.StatusCancelled
+	}
+	return o, err
+}
+
+func TestHTTPHandler(t *testing.T) {
+	eps := endpoint.New(stubService{}, stdopentracing.NoopTracer{}, log.NewNopLogger())
+	srv := httptest.NewServer(NewHTTPHandler(eps, stdopentracing.NoopTracer{}, log.NewNopLogger()))
+	defer srv.Close()
+
+	test := []struct {
+		method, path, body string
+		wantStatus         int
+		wantBody           string
+	}{
+		{"POST", "/orders", `{"order_id":"o1","name":"Jack","email":"jack@a.com","amount":100}`, 200, `"status":"completed"`},
+		{"POST", "/orders", `{"name":"Jack"}`, 200, `"ret_code":1001`},
+		{"POST", "/orders", `{`, 400, `"error"`},
+		{"GET", "/orders/o1", "", 200, `"id":"o1"`},
+		{"GET", "/orders/o2", "", 200, `"ret_code":1004,"msg":"order not found"`},
+		{"GET", "/orders/o500", "", 500, `"error":"store down"`},
+		{"POST", "/orders/o1/cancel", "", 200, `"status":"cancelled"`},
+		{"DELETE", "/orders/o1", "", 405, ""},
+	}
+	for _, tt := range test {
+		req, _ := http.NewRequest(tt.method, srv.URL+tt.path, strings.NewReader(tt.body))
+		rsp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(rsp.Body)
+		rsp.Body.Close()
+		if rsp.StatusCode != tt.wantStatus || !strings.Contains(string(body), tt.wantBody) {
+			t.Errorf("%s %s got status:%d body:%s, want status:%d body contains:%s",
+				tt.method, tt.path, rsp.StatusCode, body, tt.wantStatus, tt.wantBody)
+		}
+	}
+
+	// 不合法的租户id
+	req, _ := http.NewRequest("GET", srv.URL+"/orders/o1", nil)
+	req.Header.Set("X-Tenant-Id", "Bad Tenant")
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode != 400 {
+		t.Errorf("invalid tenant got status:%d", rsp.StatusCode)
+	}
+}
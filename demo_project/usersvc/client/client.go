@@ -0,0 +1,83 @@
+package client
+
+import (
+	"context"
+	stdendpoint "github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/sd"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"gokit_foundation/errs"
+	"gokit_foundation/idempotency"
+	"gokit_foundation/sdclient"
+	"io"
+	"time"
+	"usersvc/config"
+	"usersvc/pkg/endpoint"
+	"usersvc/pkg/service"
+	"usersvc/pkg/transport"
+)
+
+/*
+usersvc的client SDK，调用方只需要：
+	svc, stop, err := client.New(consulAddr, logger)
+	defer stop()
+	u, err := svc.GetUser(ctx, 1)
+服务发现、负载均衡、重试由gokit_foundation/sdclient完成(与hello/client、new_addsvc/client相同)，
+usersvc只有HTTP接口，每个实例的endpoint由transport.MakeHTTPClientEndpoints创建
+返回的err与直接调用service相同(如service.ErrUserNotFound)，调用失败时为*errs.Error，见errs.IsRetryable
+*/
+
+// New 从consul获取usersvc的健康实例(usersvc需要以-consul.register启动)，opts可以覆盖默认的负载均衡方式、重试次数、单次调用超时等
+// 返回的stop停止consul watch，调用方退出时调用
+func New(consulAddr string, logger log.Logger, opts ...sdclient.Option) (service.Service, func(), error) {
+	defaults := []sdclient.Option{
+		sdclient.WithTags("gokit_svc"),
+		sdclient.WithPassingOnly(true),
+		sdclient.WithRetry(3, time.Second*2),
+	}
+	sdc, err := sdclient.New(consulAddr, config.SvcName, logger, append(defaults, opts...)...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return newWithSDClient(sdc, stdopentracing.GlobalTracer(), logger), sdc.Stop, nil
+}
+
+// NewDirect 通过HTTP/JSON直连usersvc的某个实例，不经过服务发现，instance为host:port或http://host:port，timeout为每次调用的超时
+// CreateUser不是幂等的，需要重试时调用方应通过idempotency.WithKey设置幂等键
+func NewDirect(instance string, timeout time.Duration, logger log.Logger) (service.Service, error) {
+	return transport.MakeHTTPClientEndpoints(instance, timeout, stdopentracing.GlobalTracer(), logger)
+}
+
+// 单次调用的超时由sdclient.WithCallTimeout设置，这里的http.Client不再设置超时
+// CreateUser没有幂等键时失败不重试，避免超时后在其他实例上重复创建
+func newWithSDClient(sdc *sdclient.Client, tracer stdopentracing.Tracer, logger log.Logger) service.Service {
+	factoryFor := func(pick func(endpoint.UserSvcEndpoints) stdendpoint.Endpoint) sd.Factory {
+		return func(instance string) (stdendpoint.Endpoint, io.Closer, error) {
+			eps, err := transport.MakeHTTPClientEndpoints(instance, 0, tracer, logger)
+			if err != nil {
+				return nil, nil, err
+			}
+			return pick(eps), nil, nil
+		}
+	}
+	return endpoint.UserSvcEndpoints{
+		CreateUserEndpoint: sdc.Endpoint(factoryFor(func(eps endpoint.UserSvcEndpoints) stdendpoint.Endpoint {
+			return retryOnlyWithKey(eps.CreateUserEndpoint)
+		})),
+		GetUserEndpoint:    sdc.Endpoint(factoryFor(func(eps endpoint.UserSvcEndpoints) stdendpoint.Endpoint { return eps.GetUserEndpoint })),
+		UpdateUserEndpoint: sdc.Endpoint(factoryFor(func(eps endpoint.UserSvcEndpoints) stdendpoint.Endpoint { return eps.UpdateUserEndpoint })),
+		DeleteUserEndpoint: sdc.Endpoint(factoryFor(func(eps endpoint.UserSvcEndpoints) stdendpoint.Endpoint { return eps.DeleteUserEndpoint })),
+		ListUsersEndpoint:  sdc.Endpoint(factoryFor(func(eps endpoint.UserSvcEndpoints) stdendpoint.Endpoint { return eps.ListUsersEndpoint })),
+	}
+}
+
+// 没有幂等键时把err标记为不可重试，sdclient直接返回它
+func retryOnlyWithKey(next stdendpoint.Endpoint) stdendpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		rsp, err := next(ctx, request)
+		if err != nil && idempotency.KeyFromContext(ctx) == "" {
+			return nil, errs.From(err).WithRetryable(false)
+		}
+		return rsp, err
+	}
+}
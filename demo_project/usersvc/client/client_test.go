@@ -0,0 +1,65 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/sd"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"gokit_foundation/errs"
+	"gokit_foundation/idempotency"
+	"gokit_foundation/sdclient"
+	"gokit_foundation/tenant"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"usersvc/pkg/endpoint"
+	"usersvc/pkg/repository/repotest"
+	"usersvc/pkg/service"
+	"usersvc/pkg/transport"
+)
+
+// 不经过consul，两个实例中一个已下线：读接口重试到另一个实例，没有幂等键的CreateUser不重试
+func TestSDClient(t *testing.T) {
+	tracer := stdopentracing.NoopTracer{}
+	svc := service.NewBasicService(log.NewNopLogger(), repotest.NewMemory(), false)
+	eps := endpoint.New(svc, nil, nil, tracer, idempotency.NewMemStore(10), nil, tenant.Config{}, nil, log.NewNopLogger())
+	up := httptest.NewServer(transport.NewHTTPHandler(eps, tracer, log.NewNopLogger()))
+	defer up.Close()
+	down := httptest.NewServer(nil)
+	down.Close()
+
+	sdc := sdclient.NewWithInstancer(sd.FixedInstancer{down.URL, up.URL}, log.NewNopLogger(),
+		sdclient.WithRetry(2, time.Second), sdclient.WithRetryBackoff(0, 0))
+	defer sdc.Stop()
+	cli := newWithSDClient(sdc, tracer, log.NewNopLogger())
+	ctx := context.Background()
+
+	// 轮询到两个实例各一次，带幂等键的都成功且只创建一个用户
+	for i := 0; i < 2; i++ {
+		u, err := cli.CreateUser(idempotency.WithKey(ctx, "k1"), "Jack", "jack@a.com")
+		if err != nil || u.ID != 1 {
+			t.Fatalf("#%d CreateUser got user:%+v err:%v", i, u, err)
+		}
+	}
+	var failures int
+	for i := 0; i < 2; i++ {
+		if _, err := cli.CreateUser(ctx, "Rose", fmt.Sprintf("rose%d@a.com", i)); err != nil {
+			if errs.IsRetryable(err) {
+				t.Errorf("#%d CreateUser without key got retryable err:%v", i, err)
+			}
+			failures++
+		}
+	}
+	if failures != 1 {
+		t.Errorf("CreateUser without key got failures:%d want 1", failures)
+	}
+	for i := 0; i < 2; i++ {
+		if u, err := cli.GetUser(ctx, 1); err != nil || u.Name != "Jack" {
+			t.Errorf("#%d GetUser got user:%+v err:%v", i, u, err)
+		}
+		if _, err := cli.GetUser(ctx, 100); err != service.ErrUserNotFound {
+			t.Errorf("#%d GetUser got err:%v want ErrUserNotFound", i, err)
+		}
+	}
+}
@@ -0,0 +1,569 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"github.com/jmoiron/sqlx"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"go-util/_go"
+	"go-util/_util"
+	"gokit_foundation"
+	"gokit_foundation/audit"
+	"gokit_foundation/auth"
+	"gokit_foundation/errs"
+	"gokit_foundation/events"
+	"gokit_foundation/idempotency"
+	"gokit_foundation/logging"
+	"gokit_foundation/lru"
+	"gokit_foundation/secrets"
+	"gokit_foundation/sqlmw"
+	"gokit_foundation/tenant"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"usersvc/config"
+	"usersvc/internal"
+	"usersvc/pkg/endpoint"
+	"usersvc/pkg/outbox"
+	"usersvc/pkg/repository"
+	"usersvc/pkg/service"
+	"usersvc/pkg/transport"
+)
+
+/*
+usersvc演示go-kit与关系型数据库(PostgreSQL)的结合，依赖：
+-	强依赖(若连不上则无法启动)
+	-	postgres，默认在启动时执行数据库迁移(见repository.Migrate和-migrate)，空的数据库也可以直接启动
+	-	vault(设置了-vault.db.path或-vault.jwt.path时)，地址和认证方式见secrets.ConfigFromEnv
+	-	consul(-consul.register，默认开启)，注册失败时按退避重试，连续失败才退出，gateway、ordersvc通过usersvc/client从consul发现实例
+-	弱依赖
+	-	prometheus
+	-	kafka(设置了-kafka.brokers时)，领域事件先写入outbox表，kafka不可用时堆积在表中，恢复后继续投递
+	-	postgres从库(设置了-dsn.replicas时)，不可用或复制延迟过大时读主库
+	-	consul/etcd(设置了-leader.backend时)，多实例时只有leader投递outbox，不可用时没有实例投递，恢复后继续
+*/
+
+var (
+	fs        = flag.NewFlagSet("usersvc", flag.ExitOnError)
+	httpAddr  = fs.String("http.addr", ":8090", "HTTP listen address")
+	dsn       = fs.String("dsn", config.GetDSN(), "PostgreSQL DSN, env USERSVC_DSN")
+	adminAddr = fs.String("admin.addr", ":8091", "Admin listen address(pprof, expvar, runtime stats, log level, shutdown), empty to disable")
+	migrate   = fs.String("migrate", migrateAuto, "database migrations: auto(run on startup), only(run and exit) or off(refuse to start if the schema is behind)")
+	// 多个实例同时启动时其他实例等待正在执行的迁移完成
+	migrateTimeout = fs.Duration("migrate.timeout", time.Minute, "timeout of database migrations, including waiting for other instances")
+	// 地址和认证方式通过环境变量VAULT_ADDR、VAULT_TOKEN或VAULT_K8S_ROLE配置
+	vaultDBPath  = fs.String("vault.db.path", "", "vault path of database credentials(username, password), e.g. database/creds/usersvc, use credentials in dsn if empty")
+	vaultJWTPath = fs.String("vault.jwt.path", "", "vault path of JWT signing key, e.g. secret/data/usersvc, JWT auth is disabled if empty")
+	vaultJWTKey  = fs.String("vault.jwt.key", "jwt_key", "field of the signing key in vault.jwt.path")
+	// 与new_addsvc的同名参数含义相同
+	kafkaBrokers = fs.String("kafka.brokers", "", "kafka brokers separated by comma, publish domain events(UserCreated etc.) via outbox if set")
+	kafkaTopic   = fs.String("kafka.topic", "usersvc.events", "default topic of domain events, events are dropped if empty and not mapped by kafka.topics")
+	kafkaTopics  = fs.String("kafka.topics", "", "topic of each event type, e.g. UserCreated=usersvc.created,UserDeleted=usersvc.deleted")
+	httpMaxConns = fs.Int("http.max.conns", 0, "max concurrent http connections, 0 means no limit")
+	httpH2C      = fs.Bool("http.h2c", false, "serve HTTP/2 without TLS(h2c) as well")
+	// 启用JWT认证时租户来自claims中的tenant，否则来自X-Tenant-Id header
+	tenantRequired = fs.Bool("tenant.required", false, "reject requests without a tenant id, otherwise they belong to the empty tenant")
+	tenantAllowed  = fs.String("tenant.allowed", "", "allowed tenant ids separated by comma, any valid tenant id is allowed if empty")
+	// consul地址见环境变量CONSUL_ADDR，etcd地址见ETCD_ADDR
+	leaderBackend = fs.String("leader.backend", "", "elect a leader on consul or etcd to dispatch outbox messages, every instance polls the outbox if empty")
+	// 审计CreateUser、UpdateUser、DeleteUser，见gokit_foundation/audit
+	auditSink  = fs.String("audit", "db", "audit log sink of mutating operations: db(audit_log table), file, kafka(kafka.brokers) or none")
+	auditFile  = fs.String("audit.file", "usersvc-audit.log", "audit log file if -audit=file")
+	auditTopic = fs.String("audit.topic", "usersvc.audit", "kafka topic of audit log if -audit=kafka")
+	auditChain = fs.Bool("audit.chain", false, "link audit records with a hash chain(named by hostname) to make them tamper-evident")
+	// GetUser的进程内缓存，见service.CachingMiddleware
+	cacheSize = fs.Int("cache.size", 10000, "max users cached in memory for GetUser, 0 to disable")
+	cacheTTL  = fs.Duration("cache.ttl", time.Minute, "max staleness of cached users, writes on other instances are visible after it")
+	errorMap  = fs.String("error.map", "", "override error to http status mapping, e.g. not_found=:410,1001=:422, see errs.ParseMapper")
+	// 每次查询上报耗时并创建span，见sqlmw
+	dbSlow = fs.Duration("db.slow", 200*time.Millisecond, "log queries slower than it, 0 to disable")
+	// 读写分离，见repository.Replicas
+	dsnReplicas   = fs.String("dsn.replicas", "", "PostgreSQL DSNs of read replicas separated by comma, reads outside transactions go to them if set")
+	replicaMaxLag = fs.Duration("replica.max.lag", 5*time.Second, "exclude replicas lagging behind the primary more than it")
+	replicaSticky = fs.Duration("replica.sticky", 5*time.Second, "read from the primary within it after a write of the same session(X-Session-Id header), 0 to disable")
+	// consul地址见环境变量CONSUL_ADDR，只有HTTP接口，使用TTL检查(见addTaskSvcRegister)
+	consulRegister = fs.Bool("consul.register", true, "register to consul so that clients(usersvc/client) can discover this instance")
+	advertiseHost  = fs.String("advertise.host", "", "host registered to consul, detected from network interfaces if empty")
+)
+
+var (
+	logger  log.Logger
+	db      *sqlx.DB
+	httpSrv *gokit_foundation.HTTPServer
+)
+
+func main() {
+	_ = fs.Parse(os.Args[1:])
+
+	logger = gokit_foundation.NewKvLogger(nil)
+	gokit_foundation.RegisterLogContextKey("request_id", gokit_foundation.CtxKeyRequestID)
+	gokit_foundation.RegisterLogContextKey("trace_id", gokit_foundation.CtxKeyTraceID)
+	gokit_foundation.RegisterLogContextKey("tenant", gokit_foundation.CtxKeyTenant)
+	logging.Default = logger
+
+	// 添加任务之前的准备步骤通过tg.Setup执行，失败时不启动任何任务，由tg.Err报告是哪一步失败
+	tg := _go.NewTaskGroup()
+	// transport层按服务名取得错误映射，见errs.For
+	tg.Setup("error map", func() error {
+		m, err := errs.ParseMapper(*errorMap)
+		if err == nil {
+			errs.Register(config.SvcName, m)
+		}
+		return err
+	})
+	var vault *secrets.Vault
+	if *vaultDBPath != "" || *vaultJWTPath != "" {
+		tg.Setup("vault", func() (err error) { vault, err = initVault(); return })
+	}
+	metricsObj := internal.NewMetrics(logger)
+	tracer := stdopentracing.GlobalTracer()
+	dbMw := sqlmw.Config{Tracer: tracer, Duration: metricsObj.QueryDuration, SlowThreshold: *dbSlow}
+	var mode string
+	tg.Setup("migrate mode", func() (err error) { mode, err = parseMigrateMode(*migrate); return })
+	if !tg.Setup("db", func() error {
+		return initDB(vault, mode, dbMw)
+	}) {
+		setupFailed(tg)
+	}
+	// 用于部署前单独执行迁移(如k8s的init container)，之后的实例使用-migrate=off启动
+	if mode == migrateOnly {
+		logger.Log("main", "migrations done, exit", "close db", db.Close())
+		return
+	}
+	var replicas *repository.Replicas
+	if *dsnReplicas != "" {
+		tg.Setup("replicas", func() (err error) {
+			replicas, err = newReplicas(vault, dbMw, metricsObj)
+			return
+		})
+	}
+	var (
+		sink      audit.Sink
+		closeSink func() error
+		key       auth.KeySource
+	)
+	tg.Setup("audit", func() (err error) { sink, closeSink, err = newAuditSink(); return })
+	cacheConf := lru.Config{Size: *cacheSize, TTL: *cacheTTL}
+	if *cacheSize > 0 {
+		tg.Setup("user cache", cacheConf.Validate)
+	}
+	var (
+		regHost string
+		regPort int
+	)
+	if *consulRegister {
+		tg.Setup("advertise addr", func() (err error) { regHost, regPort, err = advertiseAddr(); return })
+	}
+	// 前面的步骤失败时之后的Setup都不执行，只需要检查最后一个
+	if !tg.Setup("jwt", func() (err error) { key, err = jwtKey(vault); return }) {
+		setupFailed(tg)
+	}
+
+	// 依次创建 svc，endpoint，transport三层的对象
+	repo := repository.NewPostgres(db)
+	if replicas != nil {
+		repo = repository.NewPostgresWithReplicas(db, replicas)
+	}
+	svc := service.New(logger, repo, *kafkaBrokers != "")
+	if *cacheSize > 0 {
+		svc = service.CachingMiddleware(service.NewUserCache(cacheConf, metricsObj.CacheLookups, metricsObj.CacheEvictions))(svc)
+	}
+	// 单实例演示使用进程内的LRU，多实例部署时应使用idempotency.NewRedisStore，client重试到其他实例时也能重放
+	endpoints := endpoint.New(svc, metricsObj.Duration, metricsObj.Panics, tracer, idempotency.NewMemStore(10000), key, tenantConf(metricsObj), sink, logger)
+
+	mux := http.NewServeMux()
+	mux.Handle("/", transport.NewHTTPHandler(endpoints, tracer, logger))
+	mux.Handle("/metrics", metricsObj.Handler())
+	httpSrv = gokit_foundation.NewHTTPServer(gokit_foundation.RecoveryHTTPHandler(logger, metricsObj.Panics)(mux), httpConf())
+
+	addTaskListenSignal(tg)
+	if *adminAddr != "" {
+		addTaskAdminSrv(tg, *adminAddr)
+	}
+	if vault != nil {
+		addTaskVault(tg, vault)
+	}
+	if replicas != nil {
+		addTaskReplicas(tg, replicas)
+	}
+	if *kafkaBrokers != "" {
+		addTaskOutbox(tg, metricsObj)
+	}
+	// addTaskOutbox的准备步骤失败时Run直接返回，与启动失败一样关闭依赖后退出
+	addTaskHttpSrv(tg, *httpAddr)
+	if *consulRegister {
+		// 等http服务开始监听后再注册
+		tg.Stage()
+		addTaskSvcRegister(tg, regHost, regPort)
+	}
+	tg.OnReady(func() {
+		logger.Log("main", "all tasks ready")
+	})
+	tg.Run()
+	// 所有任务(包括http服务)退出后再关闭db，避免正在处理的请求访问已关闭的连接池
+	logger.Log("main", "close audit sink", "err", closeSink())
+	logger.Log("main", "close db", "err", db.Close())
+	if replicas != nil {
+		logger.Log("main", "close replicas", "err", replicas.Close())
+	}
+	if err := tg.Err(); err != nil {
+		logger.Log("main", "startup failed", "err", err)
+		os.Exit(1)
+	}
+}
+
+// 准备步骤失败，还没有任务启动，关闭已打开的db后退出
+func setupFailed(tg *_go.TaskGroup) {
+	logger.Log("main", "startup failed", "err", tg.Err())
+	if db != nil {
+		_ = db.Close()
+	}
+	os.Exit(1)
+}
+
+func initVault() (*secrets.Vault, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	return secrets.New(ctx, secrets.ConfigFromEnv(), logger)
+}
+
+// 从vault读取凭据时旧连接的最长存活时间，凭据轮换后旧连接在此时间内被新凭据的连接替换
+const dbConnMaxLifetime = 5 * time.Minute
+
+// vault不为nil且设置了-vault.db.path时，用户名和密码从vault读取(覆盖dsn中的)
+func initDB(vault *secrets.Vault, mode string, mw sqlmw.Config) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	var err error
+	if creds := dbCredentials(vault); creds != nil {
+		db, err = repository.OpenWithCredentials(ctx, *dsn, creds, mw)
+		if err != nil {
+			return err
+		}
+		db.SetConnMaxLifetime(dbConnMaxLifetime)
+		vault.OnChange(*vaultDBPath, func(*secrets.Secret) {
+			logger.Log("initDB", "database credentials rotated, new connections use the new credentials")
+		})
+	} else {
+		db, err = repository.Open(ctx, *dsn, mw)
+		if err != nil {
+			return err
+		}
+	}
+	return migrateDB(mode)
+}
+
+// 未设置-vault.db.path时返回nil，使用dsn中的用户名和密码
+func dbCredentials(vault *secrets.Vault) repository.Credentials {
+	if vault == nil || *vaultDBPath == "" {
+		return nil
+	}
+	return func(ctx context.Context) (string, string, error) {
+		s, err := vault.Get(ctx, *vaultDBPath)
+		if err != nil {
+			return "", "", err
+		}
+		user, err := s.String("username")
+		if err != nil {
+			return "", "", err
+		}
+		password, err := s.String("password")
+		return user, password, err
+	}
+}
+
+// 从库使用与主库相同的凭据，以在-dsn.replicas中的顺序命名(0、1...)
+func newReplicas(vault *secrets.Vault, mw sqlmw.Config, metricsObj *internal.Metrics) (*repository.Replicas, error) {
+	conf := repository.DefaultReplicaConfig()
+	conf.MaxLag, conf.StickyWindow = *replicaMaxLag, *replicaSticky
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+	creds := dbCredentials(vault)
+	var replicas []repository.Replica
+	for i, d := range strings.Split(*dsnReplicas, ",") {
+		rdb, err := repository.OpenReplica(strings.TrimSpace(d), creds, mw)
+		if err != nil {
+			return nil, err
+		}
+		if creds != nil {
+			rdb.SetConnMaxLifetime(dbConnMaxLifetime)
+		}
+		replicas = append(replicas, repository.Replica{Name: strconv.Itoa(i), DB: rdb})
+	}
+	return repository.NewReplicas(replicas, conf, logger, metricsObj.ReplicaReads, metricsObj.ReplicaLag), nil
+}
+
+// -migrate的取值
+const (
+	migrateAuto = "auto"
+	migrateOnly = "only"
+	migrateOff  = "off"
+)
+
+// true、false兼容之前的bool flag
+func parseMigrateMode(s string) (string, error) {
+	switch s {
+	case migrateAuto, migrateOnly, migrateOff:
+		return s, nil
+	case "true":
+		return migrateAuto, nil
+	case "false":
+		return migrateOff, nil
+	}
+	return "", fmt.Errorf("-migrate must be %s, %s or %s, got %q", migrateAuto, migrateOnly, migrateOff, s)
+}
+
+// 不执行迁移时检查表结构，落后于本程序时拒绝启动，避免运行时才因缺少表或字段而报错
+func migrateDB(mode string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), *migrateTimeout)
+	defer cancel()
+	if mode == migrateOff {
+		current, latest, err := repository.SchemaVersion(ctx, db)
+		if err == nil && current < latest {
+			err = fmt.Errorf("database schema version %d is behind %d, run with -migrate=auto or -migrate=only", current, latest)
+		}
+		return err
+	}
+	n, err := repository.Migrate(ctx, db)
+	if err != nil {
+		return err
+	}
+	logger.Log("initDB", "migrated", "applied", n)
+	return nil
+}
+
+// 设置了-vault.jwt.path时启用JWT认证，启动时读取一次签名key，确保配置正确
+func jwtKey(vault *secrets.Vault) (auth.KeySource, error) {
+	if *vaultJWTPath == "" {
+		return nil, nil
+	}
+	key := vault.KeySource(*vaultJWTPath, *vaultJWTKey)
+	if _, err := key(); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// 超时使用默认值(见gokit_foundation.DefaultHTTPServerConfig)
+func httpConf() gokit_foundation.HTTPServerConfig {
+	conf := gokit_foundation.DefaultHTTPServerConfig()
+	conf.MaxConns, conf.H2C = *httpMaxConns, *httpH2C
+	return conf
+}
+
+// 未设置-tenant.allowed时按租户计数的指标基数取决于调用方，生产环境应启用JWT认证或设置白名单
+func tenantConf(metricsObj *internal.Metrics) tenant.Config {
+	conf := tenant.Config{Required: *tenantRequired, Requests: metricsObj.TenantRequests}
+	if *tenantAllowed != "" {
+		conf.Allowed = strings.Split(*tenantAllowed, ",")
+	}
+	return conf
+}
+
+func onClose() {
+	logger.Log("onClose", "shutting down")
+	// 先下线，注销失败会重试几次，没有注册时什么也不做
+	_ = gokit_foundation.ConsulDeregisterWithRetry(logger, 2, time.Millisecond*200)
+}
+
+// 注册到consul的地址，端口与-http.addr相同
+func advertiseAddr() (string, int, error) {
+	_, p, err := net.SplitHostPort(*httpAddr)
+	if err != nil {
+		return "", 0, err
+	}
+	port, err := strconv.Atoi(p)
+	if err != nil {
+		return "", 0, fmt.Errorf("-http.addr: invalid port %q", p)
+	}
+	host, err := gokit_foundation.AdvertiseAddr(*advertiseHost, "")
+	return host, port, err
+}
+
+// 添加后台任务：监听退出信号（第一个添加）
+func addTaskListenSignal(tg *_go.TaskGroup) {
+	tk, _ := _util.ListenSignalTask(logger, onClose)
+	tg.Add(tk).Interrupt(func(err error) {
+		logger.Log("signalTask", "exited", "clean", err)
+	})
+}
+
+// 添加后台任务：启动管理端口(见gokit_foundation.AdminServer)，POST /quitquitquit与收到SIGTERM的效果相同
+// /payloadlog开关请求/响应payload日志
+func addTaskAdminSrv(tg *_go.TaskGroup, addr string) {
+	adminSrv := gokit_foundation.NewAdminServer(nil)
+	adminSrv.Handle("/payloadlog", endpoint.DefaultPayloadLog.Handler())
+	adminSrvTask := func(ctx context.Context) error {
+		logger.Log("NewTaskGroup", "adminSrvTask", "adminSrvAddr", addr)
+
+		lis, err := net.Listen("tcp", addr)
+		if err != nil {
+			return err
+		}
+		_go.TaskReady(ctx)
+		return adminSrv.Serve(lis)
+	}
+	tg.Add(adminSrvTask).WaitReady().Interrupt(func(err error) {
+		closeCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		logger.Log("adminSrvTask", "exited", "err", err, "clean", adminSrv.Shutdown(closeCtx))
+	})
+}
+
+// 根据-audit创建审计日志的Sink，返回的closeFn在所有任务退出后调用；-audit=none时Sink为nil
+func newAuditSink() (sink audit.Sink, closeFn func() error, err error) {
+	closeFn = func() error { return nil }
+	chain, err := os.Hostname()
+	if err != nil {
+		return nil, nil, err
+	}
+	var last string
+	switch *auditSink {
+	case "none":
+		return nil, closeFn, nil
+	case "db":
+		s := repository.NewPostgresAuditSink(db)
+		if *auditChain {
+			if last, err = s.LastHash(context.Background(), chain); err != nil {
+				return nil, nil, err
+			}
+		}
+		sink = s
+	case "file":
+		if *auditChain {
+			records, err := audit.ReadFile(*auditFile)
+			if err != nil && !os.IsNotExist(err) {
+				return nil, nil, err
+			}
+			last = audit.LastHash(records, chain)
+		}
+		s, err := audit.NewFileSink(*auditFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		sink, closeFn = s, s.Close
+	case "kafka":
+		if *kafkaBrokers == "" {
+			return nil, nil, errors.New("-audit=kafka requires -kafka.brokers")
+		}
+		// 无法从kafka读取上一条hash，每次启动使用新的chain
+		chain += "-" + strconv.FormatInt(time.Now().Unix(), 10)
+		ks := events.NewKafkaSink(strings.Split(*kafkaBrokers, ","))
+		sink, closeFn = audit.EventsSink(ks, *auditTopic), ks.Close
+	default:
+		return nil, nil, fmt.Errorf("unknown -audit %q", *auditSink)
+	}
+	if *auditChain {
+		sink = audit.NewChain(chain, sink, last)
+	}
+	return sink, closeFn, nil
+}
+
+// 添加后台任务：续期vault token和读取过的secret(数据库凭据、JWT key)，失败时只打印日志，下次检查时重试
+func addTaskVault(tg *_go.TaskGroup, vault *secrets.Vault) {
+	tg.Add(func(ctx context.Context) error {
+		return vault.Run(ctx, time.Second*10)
+	}).Interrupt(func(err error) {
+		logger.Log("vaultTask", "exited", "clean", err)
+	})
+}
+
+// 添加后台任务：定期检查从库的复制延迟，排除延迟过大的从库
+func addTaskReplicas(tg *_go.TaskGroup, replicas *repository.Replicas) {
+	tg.Add(replicas.Run).Interrupt(func(err error) {
+		logger.Log("replicasTask", "exited", "clean", err)
+	})
+}
+
+// 添加后台任务：投递outbox表中的领域事件，kafka不可用时只打印日志并重试，不影响接口
+// 设置了-leader.backend时只在leader上投递，其他实例不再轮询outbox表；未设置时每个实例都轮询，由ClaimOutbox的数据库锁保证同一时间只有一个实例投递
+func addTaskOutbox(tg *_go.TaskGroup, metricsObj *internal.Metrics) {
+	var topics map[string]string
+	if !tg.Setup("outbox topics", func() (err error) { topics, err = events.ParseTopics(*kafkaTopics); return }) {
+		return
+	}
+	conf := outbox.DefaultConfig()
+	conf.Topics, conf.DefaultTopic = topics, *kafkaTopic
+	sink := events.NewKafkaSink(strings.Split(*kafkaBrokers, ","))
+	d := outbox.NewDispatcher(repository.NewPostgresOutbox(db), sink, conf, logger, outbox.Metrics{
+		Published: metricsObj.OutboxPublished,
+		Failures:  metricsObj.OutboxFailures,
+		Lag:       metricsObj.OutboxLag,
+	})
+	run := d.Run
+	if *leaderBackend != "" {
+		var elector gokit_foundation.Elector
+		if !tg.Setup("outbox leader", func() (err error) {
+			elector, err = gokit_foundation.NewElector(*leaderBackend, "usersvc/outbox")
+			return
+		}) {
+			return
+		}
+		leadership := gokit_foundation.NewLeadership(elector, logger, metricsObj.OutboxLeader)
+		leadership.OnAcquire(func(ctx context.Context) { _ = d.Run(ctx) })
+		run = leadership.Run
+	}
+	tg.Add(run).Interrupt(func(err error) {
+		logger.Log("outboxTask", "exited", "clean", err, "close", sink.Close())
+	})
+}
+
+func addTaskHttpSrv(tg *_go.TaskGroup, addr string) {
+	httpSrvTask := func(ctx context.Context) error {
+		logger.Log("NewTaskGroup", "httpSrvTask", "httpSrvAddr", addr)
+
+		lis, err := net.Listen("tcp", addr)
+		if err != nil {
+			return err
+		}
+		_go.TaskReady(ctx)
+		return httpSrv.Serve(lis)
+	}
+	tg.Add(httpSrvTask).WaitReady().Interrupt(func(err error) {
+		if err != nil {
+			logger.Log("httpSrvTask", "exited", "err", err)
+		} else {
+			closeCtx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+			defer cancel()
+			err := httpSrv.Shutdown(closeCtx)
+			logger.Log("httpSrvTask", "exited", "clean", err)
+		}
+	})
+}
+
+// 添加后台任务：注册到consul，之后定期检查注册信息，丢失(如consul agent重启)时重新注册
+// consul agent无法对HTTP服务做grpc健康检查，所以使用TTL检查，每次心跳前检查db，不可用时上报critical
+// 注册失败时服务不可被发现，按退避重试，连续失败5次才停止整个服务；注销在onClose中完成
+func addTaskSvcRegister(tg *_go.TaskGroup, host string, port int) {
+	svcRegisterTask := func(ctx context.Context) error {
+		logger.Log("svcRegisterTask", "register", "advertiseHost", host, "httpPort", port)
+		err := gokit_foundation.RegisterSvcWithOptions(config.SvcName, host, port, gokit_foundation.ConsulRegisterOptions{
+			CheckTTL:  time.Second * 15,
+			TTLStatus: db.PingContext,
+		})
+		if err != nil {
+			return err
+		}
+		_go.TaskReady(ctx)
+		return gokit_foundation.ConsulKeepRegistered(ctx, logger, time.Second*10, time.Second)
+	}
+	tg.Add(svcRegisterTask).Name("svcRegister").WaitReady().Restart(_go.RestartPolicy{
+		MaxFailures: 5,
+		MinBackoff:  time.Second,
+		MaxBackoff:  time.Second * 10,
+		ResetAfter:  time.Minute,
+		OnFailure: func(err error, failures int, willRestart bool) {
+			logger.Log("svcRegisterTask", "failed", "err", err, "failures", failures, "restart", willRestart)
+		},
+	}).Interrupt(func(err error) {
+		logger.Log("svcRegisterTask", "exited", "clean", err)
+	})
+}
@@ -0,0 +1,206 @@
+package internal
+
+import (
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
+	"github.com/go-kit/kit/metrics/prometheus"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+)
+
+type Metrics struct {
+	Duration metrics.Histogram
+	// outbox投递，见outbox.Metrics
+	OutboxPublished metrics.Counter
+	OutboxFailures  metrics.Counter
+	OutboxLag       metrics.Gauge
+	// 为1表示本实例是outbox投递的leader，见gokit_foundation.Leadership
+	OutboxLeader metrics.Gauge
+	// 被recover的panic数，见gokit_foundation.RecoveryMiddleware
+	Panics metrics.Counter
+	// 每个租户的调用数，见tenant.Config.Requests
+	TenantRequests metrics.Counter
+	// GetUser缓存的查询和淘汰，见service.CachingMiddleware
+	CacheLookups   metrics.Counter
+	CacheEvictions metrics.Counter
+	// 数据库查询耗时，见sqlmw.Config.Duration
+	QueryDuration metrics.Histogram
+	// 读取的路由和从库的复制延迟，见repository.NewReplicas
+	ReplicaReads metrics.Counter
+	ReplicaLag   metrics.Gauge
+
+	registry *stdprometheus.Registry
+}
+
+/*
+与new_addsvc一样，prometheus是弱依赖：指标注册失败时只打印警告，对应指标退化为discard
+*/
+func NewMetrics(logger log.Logger) *Metrics {
+	reg := stdprometheus.NewRegistry()
+	register := func(name string, c stdprometheus.Collector) bool {
+		if err := reg.Register(c); err != nil {
+			logger.Log("NewMetrics", "WARNING", "metric", name, "err", err, "hint", "该指标不会被上报")
+			return false
+		}
+		return true
+	}
+
+	register("go", stdprometheus.NewGoCollector())
+	register("process", stdprometheus.NewProcessCollector(stdprometheus.ProcessCollectorOpts{}))
+
+	var duration metrics.Histogram = discard.NewHistogram()
+	{
+		durationVec := stdprometheus.NewSummaryVec(stdprometheus.SummaryOpts{
+			Namespace: "example",
+			Subsystem: "usersvc",
+			Name:      "request_duration_seconds",
+			Help:      "Request duration in seconds.",
+		}, []string{"method", "success"})
+		if register("request_duration_seconds", durationVec) {
+			duration = prometheus.NewSummary(durationVec)
+		}
+	}
+	m := &Metrics{Duration: duration, registry: reg}
+
+	m.OutboxPublished = discard.NewCounter()
+	{
+		vec := stdprometheus.NewCounterVec(stdprometheus.CounterOpts{
+			Namespace: "example",
+			Subsystem: "usersvc",
+			Name:      "outbox_published_total",
+			Help:      "Number of outbox messages published.",
+		}, []string{"topic"})
+		if register("outbox_published_total", vec) {
+			m.OutboxPublished = prometheus.NewCounter(vec)
+		}
+	}
+	m.OutboxFailures = discard.NewCounter()
+	{
+		vec := stdprometheus.NewCounterVec(stdprometheus.CounterOpts{
+			Namespace: "example",
+			Subsystem: "usersvc",
+			Name:      "outbox_failures_total",
+			Help:      "Number of outbox messages failed to publish, retried later.",
+		}, []string{"topic"})
+		if register("outbox_failures_total", vec) {
+			m.OutboxFailures = prometheus.NewCounter(vec)
+		}
+	}
+	m.OutboxLag = discard.NewGauge()
+	{
+		vec := stdprometheus.NewGaugeVec(stdprometheus.GaugeOpts{
+			Namespace: "example",
+			Subsystem: "usersvc",
+			Name:      "outbox_lag_seconds",
+			Help:      "Age of the oldest outbox message not yet published.",
+		}, []string{})
+		if register("outbox_lag_seconds", vec) {
+			m.OutboxLag = prometheus.NewGauge(vec)
+		}
+	}
+	m.OutboxLeader = discard.NewGauge()
+	{
+		vec := stdprometheus.NewGaugeVec(stdprometheus.GaugeOpts{
+			Namespace: "example",
+			Subsystem: "usersvc",
+			Name:      "outbox_leader",
+			Help:      "1 if the instance is the leader dispatching outbox messages.",
+		}, []string{})
+		if register("outbox_leader", vec) {
+			m.OutboxLeader = prometheus.NewGauge(vec)
+		}
+	}
+	m.Panics = discard.NewCounter()
+	{
+		vec := stdprometheus.NewCounterVec(stdprometheus.CounterOpts{
+			Namespace: "example",
+			Subsystem: "usersvc",
+			Name:      "panics_total",
+			Help:      "Number of recovered panics by layer and method.",
+		}, []string{"layer", "method"})
+		if register("panics_total", vec) {
+			m.Panics = prometheus.NewCounter(vec)
+		}
+	}
+	m.TenantRequests = discard.NewCounter()
+	{
+		vec := stdprometheus.NewCounterVec(stdprometheus.CounterOpts{
+			Namespace: "example",
+			Subsystem: "usersvc",
+			Name:      "tenant_requests_total",
+			Help:      "Number of requests by method and tenant.",
+		}, []string{"method", "tenant"})
+		if register("tenant_requests_total", vec) {
+			m.TenantRequests = prometheus.NewCounter(vec)
+		}
+	}
+	m.CacheLookups = discard.NewCounter()
+	{
+		vec := stdprometheus.NewCounterVec(stdprometheus.CounterOpts{
+			Namespace: "example",
+			Subsystem: "usersvc",
+			Name:      "user_cache_lookups_total",
+			Help:      "Number of user cache lookups by result(hit or miss).",
+		}, []string{"result"})
+		if register("user_cache_lookups_total", vec) {
+			m.CacheLookups = prometheus.NewCounter(vec)
+		}
+	}
+	m.CacheEvictions = discard.NewCounter()
+	{
+		vec := stdprometheus.NewCounterVec(stdprometheus.CounterOpts{
+			Namespace: "example",
+			Subsystem: "usersvc",
+			Name:      "user_cache_evictions_total",
+			Help:      "Number of user cache evictions by reason(capacity or expired).",
+		}, []string{"reason"})
+		if register("user_cache_evictions_total", vec) {
+			m.CacheEvictions = prometheus.NewCounter(vec)
+		}
+	}
+	m.QueryDuration = discard.NewHistogram()
+	{
+		vec := stdprometheus.NewHistogramVec(stdprometheus.HistogramOpts{
+			Namespace: "example",
+			Subsystem: "usersvc",
+			Name:      "db_query_duration_seconds",
+			Help:      "Database query duration in seconds by statement name.",
+			Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		}, []string{"statement", "success"})
+		if register("db_query_duration_seconds", vec) {
+			m.QueryDuration = prometheus.NewHistogram(vec)
+		}
+	}
+	m.ReplicaReads = discard.NewCounter()
+	{
+		vec := stdprometheus.NewCounterVec(stdprometheus.CounterOpts{
+			Namespace: "example",
+			Subsystem: "usersvc",
+			Name:      "db_reads_total",
+			Help:      "Number of reads by route(replica, sticky or fallback to the primary).",
+		}, []string{"route"})
+		if register("db_reads_total", vec) {
+			m.ReplicaReads = prometheus.NewCounter(vec)
+		}
+	}
+	m.ReplicaLag = discard.NewGauge()
+	{
+		vec := stdprometheus.NewGaugeVec(stdprometheus.GaugeOpts{
+			Namespace: "example",
+			Subsystem: "usersvc",
+			Name:      "db_replica_lag_seconds",
+			Help:      "Replication lag of each read replica.",
+		}, []string{"replica"})
+		if register("db_replica_lag_seconds", vec) {
+			m.ReplicaLag = prometheus.NewGauge(vec)
+		}
+	}
+	return m
+}
+
+// Handler 返回提供给prometheus调用的/metrics接口
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,199 @@
+package endpoint
+
+import (
+	"context"
+	"embed"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"gokit_foundation/audit"
+	"gokit_foundation/auth"
+	"gokit_foundation/i18n"
+	"gokit_foundation/idempotency"
+	"gokit_foundation/mwchain"
+	"gokit_foundation/pagination"
+	"gokit_foundation/payloadlog"
+	"gokit_foundation/tenant"
+	"strconv"
+	"time"
+	"usersvc/pkg/service"
+)
+
+// Endpoints内包含的ep对应service每个接口
+type UserSvcEndpoints struct {
+	CreateUserEndpoint endpoint.Endpoint
+	GetUserEndpoint    endpoint.Endpoint
+	UpdateUserEndpoint endpoint.Endpoint
+	DeleteUserEndpoint endpoint.Endpoint
+	ListUsersEndpoint  endpoint.Endpoint
+}
+
+// 将一个Service对象转为Endpoints对象，每个ep都安装追踪和监控mw(与new_addsvc一致)
+// CreateUser不是幂等的，idemStore不为nil时安装幂等键mw(见gokit_foundation/idempotency)，client带上Idempotency-Key即可安全重试
+// jwtKey不为nil时所有接口都需要JWT认证(见gokit_foundation/auth)，如从vault读取签名key(见secrets.Vault.KeySource)
+// panics记录被recover的panic数，为nil时不上报
+// 每个请求属于一个租户(见gokit_foundation/tenant)，启用JWT认证时来自claims中的tenant，否则来自X-Tenant-Id header
+// auditSink不为nil时修改类接口都记录审计日志(见gokit_foundation/audit)，如repository.NewPostgresAuditSink
+func New(svc service.Service, duration metrics.Histogram, panics metrics.Counter, otTracer stdopentracing.Tracer, idemStore idempotency.Store,
+	jwtKey auth.KeySource, tenantConf tenant.Config, auditSink audit.Sink, logger log.Logger) UserSvcEndpoints {
+	// 指标为nil(如prometheus不可用)时不上报
+	if duration == nil {
+		duration = discard.NewHistogram()
+	}
+	b := mwchain.New().
+		WithI18n(DefaultMessages).
+		WithPayloadLog(DefaultPayloadLog, logger).
+		WithMetrics(func(method string) endpoint.Middleware {
+			return InstrumentingMiddleware(duration.With("method", method))
+		}).
+		WithTracing(otTracer).
+		// 需要读取认证写入的claims，mwchain将它安装在认证内层
+		WithTenant(tenantConf).
+		// service层通过logging.FromContext取得带request_id、method、tenant的logger
+		WithRequestLogger(logger).
+		// panic转为errs.Internal，监控指标中记为失败
+		WithRecovery(logger, panics)
+	if jwtKey != nil {
+		b.WithJWT(auth.Config{Key: jwtKey, Issuer: JWTIssuer})
+	}
+	if idemStore != nil {
+		// 重放的response同样经过追踪和监控mw
+		b.WithIdempotency(mwchain.Only(func(method string) endpoint.Middleware {
+			return idempotency.Middleware(idemStore, idempotency.Config{
+				Method: method,
+				TTL:    IdempotencyTTL,
+				Prefix: "usersvc:idempotency:",
+				New:    func() interface{} { return new(UserResponse) },
+				// 不同租户使用相同的key互不影响
+				Scope: tenant.FromContext,
+			}, logger)
+		}, "CreateUser"))
+	}
+	if auditSink != nil {
+		b.WithAudit(mwchain.Only(func(method string) endpoint.Middleware {
+			return audit.Middleware(audit.Config{Sink: auditSink, Logger: logger, Result: auditResult}, method)
+		}, "CreateUser", "UpdateUser", "DeleteUser"))
+	}
+	// 使用洋葱模式封装endpoint，封装顺序见mwchain.Layer
+	eps := b.MustBuild(map[string]endpoint.Endpoint{
+		"CreateUser": MakeCreateUserEndpoint(svc),
+		"GetUser":    MakeGetUserEndpoint(svc),
+		"UpdateUser": MakeUpdateUserEndpoint(svc),
+		"DeleteUser": MakeDeleteUserEndpoint(svc),
+		"ListUsers":  MakeListUsersEndpoint(svc),
+	})
+	return UserSvcEndpoints{
+		CreateUserEndpoint: eps["CreateUser"],
+		GetUserEndpoint:    eps["GetUser"],
+		UpdateUserEndpoint: eps["UpdateUser"],
+		DeleteUserEndpoint: eps["DeleteUser"],
+		ListUsersEndpoint:  eps["ListUsers"],
+	}
+}
+
+// 请求/响应payload日志，默认关闭，通过管理端口的/payloadlog开启(见payloadlog.Recorder.Handler)
+var DefaultPayloadLog = payloadlog.NewRecorder()
+
+//go:embed locales/*.json
+var locales embed.FS
+
+// 业务错误描述的翻译，key见service.MessageKey
+var DefaultMessages = i18n.MustNew(locales)
+
+// 启用JWT认证时token的iss必须为此值
+const JWTIssuer = "usersvc"
+
+// 成功创建的response保存的时间，client应在此时间内完成重试
+const IdempotencyTTL = 24 * time.Hour
+
+// 业务错误(如邮箱已存在)在response的RetCode中，审计结果记为ret_code=N
+func auditResult(response interface{}, err error) string {
+	code := 0
+	switch resp := response.(type) {
+	case *UserResponse:
+		code = resp.RetCode
+	case *DeleteUserResponse:
+		code = resp.RetCode
+	}
+	if err == nil && code != 0 {
+		return "ret_code=" + strconv.Itoa(code)
+	}
+	return audit.DefaultResult(response, err)
+}
+
+// 业务错误映射为RetCode，系统错误作为endpoint的err返回，使得监控指标(success=false)和http状态码(500)能反映出来
+func bizErr(err error) (code int, msg string, sysErr error) {
+	if err != nil && !service.IsBizError(err) {
+		return 0, "", err
+	}
+	if err != nil {
+		msg = err.Error()
+	}
+	return service.ErrorToRetCode(err), msg, nil
+}
+
+func MakeCreateUserEndpoint(s service.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(*CreateUserRequest)
+		u, err := s.CreateUser(ctx, req.Name, req.Email)
+		code, msg, err := bizErr(err)
+		if err != nil {
+			return nil, err
+		}
+		return &UserResponse{User: toUserInfo(u), RetCode: code, Msg: msg}, nil
+	}
+}
+
+func MakeGetUserEndpoint(s service.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(*GetUserRequest)
+		u, err := s.GetUser(ctx, req.ID)
+		code, msg, err := bizErr(err)
+		if err != nil {
+			return nil, err
+		}
+		return &UserResponse{User: toUserInfo(u), RetCode: code, Msg: msg}, nil
+	}
+}
+
+func MakeUpdateUserEndpoint(s service.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(*UpdateUserRequest)
+		u, err := s.UpdateUser(ctx, req.ID, req.Name, req.Email)
+		code, msg, err := bizErr(err)
+		if err != nil {
+			return nil, err
+		}
+		return &UserResponse{User: toUserInfo(u), RetCode: code, Msg: msg}, nil
+	}
+}
+
+func MakeDeleteUserEndpoint(s service.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(*DeleteUserRequest)
+		code, msg, err := bizErr(s.DeleteUser(ctx, req.ID))
+		if err != nil {
+			return nil, err
+		}
+		return &DeleteUserResponse{RetCode: code, Msg: msg}, nil
+	}
+}
+
+func MakeListUsersEndpoint(s service.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(*ListUsersRequest)
+		page := pagination.Params{PageSize: req.PageSize, PageToken: req.PageToken, OrderBy: req.OrderBy}
+		users, next, err := s.ListUsers(ctx, page, req.NamePrefix)
+		code, msg, err := bizErr(err)
+		if err != nil {
+			return nil, err
+		}
+		resp := &ListUsersResponse{Users: make([]*UserInfo, len(users)), NextPageToken: next, RetCode: code, Msg: msg}
+		for i, u := range users {
+			resp.Users[i] = toUserInfo(u)
+		}
+		return resp, nil
+	}
+}
@@ -0,0 +1,69 @@
+package endpoint
+
+import (
+	"context"
+	"gokit_foundation/pagination"
+	"usersvc/pkg/repository"
+	"usersvc/pkg/service"
+)
+
+/*
+与new_addsvc一样，Endpoints也实现了service.Service，client(见usersvc/client)调用时得到与直接调用service相同的err：
+-	业务错误由response.RetCode还原(见service.ErrorFromRetCode)
+-	endpoint返回的err为调用失败(连接失败、超时、http 4xx/5xx等)，原样返回
+*/
+
+func toUser(u *UserInfo) *repository.User {
+	if u == nil {
+		return nil
+	}
+	return &repository.User{ID: u.ID, Name: u.Name, Email: u.Email, CreatedAt: u.CreatedAt, UpdatedAt: u.UpdatedAt}
+}
+
+func userResult(resp interface{}, err error) (*repository.User, error) {
+	if err != nil {
+		return nil, err
+	}
+	r := resp.(*UserResponse)
+	if err = service.ErrorFromRetCode(r.RetCode, r.Msg); err != nil {
+		return nil, err
+	}
+	return toUser(r.User), nil
+}
+
+func (e UserSvcEndpoints) CreateUser(ctx context.Context, name, email string) (*repository.User, error) {
+	return userResult(e.CreateUserEndpoint(ctx, &CreateUserRequest{Name: name, Email: email}))
+}
+
+func (e UserSvcEndpoints) GetUser(ctx context.Context, id int64) (*repository.User, error) {
+	return userResult(e.GetUserEndpoint(ctx, &GetUserRequest{ID: id}))
+}
+
+func (e UserSvcEndpoints) UpdateUser(ctx context.Context, id int64, name, email *string) (*repository.User, error) {
+	return userResult(e.UpdateUserEndpoint(ctx, &UpdateUserRequest{ID: id, Name: name, Email: email}))
+}
+
+func (e UserSvcEndpoints) DeleteUser(ctx context.Context, id int64) error {
+	resp, err := e.DeleteUserEndpoint(ctx, &DeleteUserRequest{ID: id})
+	if err != nil {
+		return err
+	}
+	r := resp.(*DeleteUserResponse)
+	return service.ErrorFromRetCode(r.RetCode, r.Msg)
+}
+
+func (e UserSvcEndpoints) ListUsers(ctx context.Context, page pagination.Params, namePrefix string) ([]*repository.User, string, error) {
+	resp, err := e.ListUsersEndpoint(ctx, &ListUsersRequest{PageSize: page.PageSize, PageToken: page.PageToken, OrderBy: page.OrderBy, NamePrefix: namePrefix})
+	if err != nil {
+		return nil, "", err
+	}
+	r := resp.(*ListUsersResponse)
+	if err = service.ErrorFromRetCode(r.RetCode, r.Msg); err != nil {
+		return nil, "", err
+	}
+	users := make([]*repository.User, len(r.Users))
+	for i, u := range r.Users {
+		users[i] = toUser(u)
+	}
+	return users, r.NextPageToken, nil
+}
@@ -0,0 +1,106 @@
+package endpoint
+
+import (
+	"time"
+	"usersvc/pkg/repository"
+	"usersvc/pkg/service"
+)
+
+/*
+endpoint层的req和rsp，transport层负责与http请求/响应相互转换
+业务错误通过RetCode返回(见service.ErrorToRetCode)，系统错误(如数据库故障)由endpoint直接返回err
+response实现i18n.Response，Msg按调用方的Accept-Language本地化(见DefaultMessages)
+*/
+
+type UserInfo struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func toUserInfo(u *repository.User) *UserInfo {
+	if u == nil {
+		return nil
+	}
+	return &UserInfo{ID: u.ID, Name: u.Name, Email: u.Email, CreatedAt: u.CreatedAt, UpdatedAt: u.UpdatedAt}
+}
+
+type CreateUserRequest struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+type GetUserRequest struct {
+	ID int64 `json:"id"`
+}
+
+// Name或Email为nil(json中没有该字段)时不修改
+type UpdateUserRequest struct {
+	ID    int64   `json:"id"`
+	Name  *string `json:"name"`
+	Email *string `json:"email"`
+}
+
+type DeleteUserRequest struct {
+	ID int64 `json:"id"`
+}
+
+// 分页参数见service.ListUsersSpec
+type ListUsersRequest struct {
+	PageSize   int    `json:"page_size"`
+	PageToken  string `json:"page_token"`
+	OrderBy    string `json:"order_by"`
+	NamePrefix string `json:"name_prefix"`
+}
+
+// CreateUser、GetUser、UpdateUser的response
+type UserResponse struct {
+	User    *UserInfo `json:"user,omitempty"`
+	RetCode int       `json:"ret_code"`
+	Msg     string    `json:"msg,omitempty"` // RetCode不为0时的错误描述
+}
+
+type DeleteUserResponse struct {
+	RetCode int    `json:"ret_code"`
+	Msg     string `json:"msg,omitempty"`
+}
+
+type ListUsersResponse struct {
+	Users         []*UserInfo `json:"users"`
+	NextPageToken string      `json:"next_page_token,omitempty"` // 为空表示没有下一页
+	RetCode       int         `json:"ret_code"`
+	Msg           string      `json:"msg,omitempty"`
+}
+
+func (r *UserResponse) ErrorMessage() (string, string) {
+	return service.MessageKey(r.RetCode, r.Msg), r.Msg
+}
+
+// 幂等键mw可能重放同一个response，返回副本
+func (r *UserResponse) WithErrorMessage(msg string) interface{} {
+	c := *r
+	c.Msg = msg
+	return &c
+}
+
+func (r *DeleteUserResponse) ErrorMessage() (string, string) {
+	return service.MessageKey(r.RetCode, r.Msg), r.Msg
+}
+
+func (r *DeleteUserResponse) WithErrorMessage(msg string) interface{} {
+	c := *r
+	c.Msg = msg
+	return &c
+}
+
+func (r *ListUsersResponse) ErrorMessage() (string, string) {
+	return service.MessageKey(r.RetCode, r.Msg), r.Msg
+}
+
+func (r *ListUsersResponse) WithErrorMessage(msg string) interface{} {
+	c := *r
+	c.Msg = msg
+	return &c
+}
@@ -0,0 +1,182 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
+	"gokit_foundation/events"
+	"time"
+	"usersvc/pkg/repository"
+)
+
+/*
+transactional outbox：service层将领域事件与业务数据在同一个事务中写入outbox表(见repository.OutboxMessage)，
+Dispatcher在后台轮询outbox表，事务提交后的事件才会被读到，按事件类型写入对应的topic(Sink，如Kafka)，成功后删除：
+-	at-least-once：写入Sink成功但删除前进程退出(或删除失败)时，下次会再次投递，消费方需按events.Event.ID去重
+-	写入失败的消息保留在outbox表中(attempts+1，记录last_error)，从1s开始翻倍等待(不超过MaxBackoff)后重试
+-	同一时间只有一个实例投递(见repository.OutboxStore.ClaimOutbox)，相同key的事件按写入顺序投递
+-	未映射到topic的事件类型直接删除，与events.AsyncPublisher一致
+*/
+
+type Config struct {
+	Topics       map[string]string // 事件类型 => topic
+	DefaultTopic string
+	BatchSize    int           // 每次最多读取的消息数
+	PollInterval time.Duration // 没有更多待投递的消息时，等待多久后再次读取
+	WriteTimeout time.Duration // 每一批写入Sink的超时
+	MaxBackoff   time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		BatchSize:    100,
+		PollInterval: 500 * time.Millisecond,
+		WriteTimeout: 5 * time.Second,
+		MaxBackoff:   30 * time.Second,
+	}
+}
+
+// Metrics 为nil的指标不上报
+type Metrics struct {
+	Published metrics.Counter // 投递成功的消息数，标签为topic
+	Failures  metrics.Counter // 写入失败的消息数，标签为topic
+	Lag       metrics.Gauge   // 最早的待投递消息已等待的秒数，没有待投递的消息时为0
+}
+
+type Dispatcher struct {
+	store  repository.OutboxStore
+	sink   events.Sink
+	conf   Config
+	logger log.Logger
+	m      Metrics
+	now    func() time.Time
+}
+
+// NewDispatcher conf中为0的字段使用DefaultConfig的值
+func NewDispatcher(store repository.OutboxStore, sink events.Sink, conf Config, logger log.Logger, m Metrics) *Dispatcher {
+	def := DefaultConfig()
+	if conf.BatchSize <= 0 {
+		conf.BatchSize = def.BatchSize
+	}
+	if conf.PollInterval <= 0 {
+		conf.PollInterval = def.PollInterval
+	}
+	if conf.WriteTimeout <= 0 {
+		conf.WriteTimeout = def.WriteTimeout
+	}
+	if conf.MaxBackoff <= 0 {
+		conf.MaxBackoff = def.MaxBackoff
+	}
+	if m.Published == nil {
+		m.Published = discard.NewCounter()
+	}
+	if m.Failures == nil {
+		m.Failures = discard.NewCounter()
+	}
+	if m.Lag == nil {
+		m.Lag = discard.NewGauge()
+	}
+	return &Dispatcher{store: store, sink: sink, conf: conf, logger: logger, m: m, now: time.Now}
+}
+
+func (d *Dispatcher) topicOf(eventType string) string {
+	if t, ok := d.conf.Topics[eventType]; ok {
+		return t
+	}
+	return d.conf.DefaultTopic
+}
+
+// Run 持续投递outbox中的消息，直到ctx结束，正在投递的一批会完成后再返回
+func (d *Dispatcher) Run(ctx context.Context) error {
+	var backoff time.Duration
+	for {
+		n, err := d.dispatch()
+		d.updateLag()
+		wait := d.conf.PollInterval
+		switch {
+		case err != nil:
+			if backoff *= 2; backoff == 0 {
+				backoff = time.Second
+			}
+			if backoff > d.conf.MaxBackoff {
+				backoff = d.conf.MaxBackoff
+			}
+			wait = backoff
+			d.logger.Log("outbox", "dispatch failed", "err", err, "retry_after", backoff)
+		case n >= d.conf.BatchSize:
+			// 可能还有待投递的消息，立即读取下一批
+			backoff, wait = 0, 0
+		default:
+			backoff = 0
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(wait):
+		}
+	}
+}
+
+// 投递一批消息，返回读取到的消息数
+// 不使用Run的ctx，退出时完成当前批次，避免已写入Sink的消息因事务回滚而重复投递
+func (d *Dispatcher) dispatch() (n int, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*d.conf.WriteTimeout)
+	defer cancel()
+	err = d.store.ClaimOutbox(ctx, d.conf.BatchSize, func(msgs []repository.OutboxMessage) (sent []int64, err error) {
+		n = len(msgs)
+		// 按topic分组，组内保持写入顺序
+		var topics []string
+		groups := map[string][]repository.OutboxMessage{}
+		for _, m := range msgs {
+			topic := d.topicOf(m.EventType)
+			if topic == "" {
+				sent = append(sent, m.ID)
+				continue
+			}
+			if _, ok := groups[topic]; !ok {
+				topics = append(topics, topic)
+			}
+			groups[topic] = append(groups[topic], m)
+		}
+		for _, topic := range topics {
+			group := groups[topic]
+			batch := make([]events.Message, len(group))
+			for i, m := range group {
+				batch[i] = events.Message{Key: []byte(m.Key), Value: m.Payload}
+			}
+			wctx, cancel := context.WithTimeout(ctx, d.conf.WriteTimeout)
+			werr := d.sink.Write(wctx, topic, batch)
+			cancel()
+			if werr != nil {
+				d.m.Failures.With("topic", topic).Add(float64(len(group)))
+				if err == nil {
+					err = fmt.Errorf("outbox: write %d messages to %s: %v", len(group), topic, werr)
+				}
+				continue
+			}
+			d.m.Published.With("topic", topic).Add(float64(len(group)))
+			for _, m := range group {
+				sent = append(sent, m.ID)
+			}
+		}
+		return sent, err
+	})
+	return n, err
+}
+
+func (d *Dispatcher) updateLag() {
+	ctx, cancel := context.WithTimeout(context.Background(), d.conf.WriteTimeout)
+	defer cancel()
+	t, err := d.store.OldestOutbox(ctx)
+	if err != nil {
+		d.logger.Log("outbox", "query lag failed", "err", err)
+		return
+	}
+	lag := 0.0
+	if !t.IsZero() {
+		lag = d.now().Sub(t).Seconds()
+	}
+	d.m.Lag.Set(lag)
+}
@@ -0,0 +1,163 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/generic"
+	"gokit_foundation/events"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+	"usersvc/pkg/repository"
+)
+
+// 内存实现的OutboxStore，语义与repository.pgRepository.ClaimOutbox相同
+type memStore struct {
+	mu   sync.Mutex
+	msgs []repository.OutboxMessage
+}
+
+func (s *memStore) add(id int64, typ, key string, created time.Time) {
+	s.msgs = append(s.msgs, repository.OutboxMessage{ID: id, EventType: typ, Key: key, Payload: []byte(typ + key), CreatedAt: created})
+}
+
+func (s *memStore) ClaimOutbox(_ context.Context, limit int, fn func(msgs []repository.OutboxMessage) ([]int64, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := len(s.msgs)
+	if n > limit {
+		n = limit
+	}
+	if n == 0 {
+		return nil
+	}
+	batch := append([]repository.OutboxMessage(nil), s.msgs[:n]...)
+	sent, err := fn(batch)
+	done := map[int64]bool{}
+	for _, id := range sent {
+		done[id] = true
+	}
+	var left []repository.OutboxMessage
+	for i, m := range s.msgs {
+		if done[m.ID] {
+			continue
+		}
+		if i < n && err != nil {
+			m.Attempts++
+		}
+		left = append(left, m)
+	}
+	s.msgs = left
+	return err
+}
+
+func (s *memStore) OldestOutbox(context.Context) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.msgs) == 0 {
+		return time.Time{}, nil
+	}
+	return s.msgs[0].CreatedAt, nil
+}
+
+// 记录写入的消息，fail中的topic写入失败
+type recordSink struct {
+	mu      sync.Mutex
+	fail    map[string]bool
+	written map[string][]string
+}
+
+func (s *recordSink) Write(_ context.Context, topic string, msgs []events.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail[topic] {
+		return errors.New("kafka down")
+	}
+	for _, m := range msgs {
+		s.written[topic] = append(s.written[topic], string(m.Value))
+	}
+	return nil
+}
+
+func (s *recordSink) Close() error { return nil }
+
+// 忽略标签，累加所有的Add
+type sumCounter struct{ v float64 }
+
+func (c *sumCounter) With(...string) metrics.Counter { return c }
+func (c *sumCounter) Add(delta float64)              { c.v += delta }
+
+func TestDispatch(t *testing.T) {
+	now := time.Now()
+	store := &memStore{}
+	store.add(1, "UserCreated", "1", now.Add(-3*time.Second))
+	store.add(2, "UserDeleted", "2", now.Add(-2*time.Second))
+	store.add(3, "UserCreated", "3", now)
+	store.add(4, "Unknown", "4", now)
+	sink := &recordSink{fail: map[string]bool{"usersvc.deleted": true}, written: map[string][]string{}}
+	published, failures, lag := &sumCounter{}, &sumCounter{}, generic.NewGauge("lag")
+	d := NewDispatcher(store, sink, Config{
+		Topics:    map[string]string{"UserCreated": "usersvc.created", "UserDeleted": "usersvc.deleted"},
+		BatchSize: 10,
+	}, log.NewNopLogger(), Metrics{Published: published, Failures: failures, Lag: lag})
+	d.now = func() time.Time { return now }
+
+	// 写入失败的topic保留在outbox中，其他topic的消息以及未映射的消息被删除
+	if n, err := d.dispatch(); n != 4 || err == nil {
+		t.Fatalf("got n:%d err:%v", n, err)
+	}
+	if want := []string{"UserCreated1", "UserCreated3"}; !reflect.DeepEqual(sink.written["usersvc.created"], want) {
+		t.Errorf("got written:%v", sink.written)
+	}
+	if len(store.msgs) != 1 || store.msgs[0].ID != 2 || store.msgs[0].Attempts != 1 {
+		t.Errorf("got left:%+v", store.msgs)
+	}
+	d.updateLag()
+	if published.v != 2 || failures.v != 1 || lag.Value() != 2 {
+		t.Errorf("got published:%v failures:%v lag:%v", published.v, failures.v, lag.Value())
+	}
+
+	// 恢复后重试成功
+	sink.fail = nil
+	if n, err := d.dispatch(); n != 1 || err != nil {
+		t.Fatalf("retry got n:%d err:%v", n, err)
+	}
+	d.updateLag()
+	if len(sink.written["usersvc.deleted"]) != 1 || len(store.msgs) != 0 || lag.Value() != 0 {
+		t.Errorf("got written:%v left:%d lag:%v", sink.written, len(store.msgs), lag.Value())
+	}
+}
+
+func TestRun(t *testing.T) {
+	store := &memStore{}
+	for i := int64(1); i <= 5; i++ {
+		store.add(i, "UserCreated", "1", time.Now())
+	}
+	sink := &recordSink{written: map[string][]string{}}
+	// BatchSize小于待投递的消息数时立即读取下一批，不等待PollInterval
+	d := NewDispatcher(store, sink, Config{DefaultTopic: "usersvc.events", BatchSize: 2, PollInterval: time.Hour}, log.NewNopLogger(), Metrics{})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- d.Run(ctx) }()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		sink.mu.Lock()
+		n := len(sink.written["usersvc.events"])
+		sink.mu.Unlock()
+		if n == 5 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d messages within 1s", n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"github.com/jmoiron/sqlx"
+	"gokit_foundation/audit"
+	"gokit_foundation/sqlmw"
+)
+
+// PostgresAuditSink 审计日志写入audit_log表(需先执行Migrate)，表上的触发器拒绝UPDATE和DELETE
+type PostgresAuditSink struct {
+	db *sqlx.DB
+}
+
+func NewPostgresAuditSink(db *sqlx.DB) *PostgresAuditSink {
+	return &PostgresAuditSink{db: db}
+}
+
+var _ audit.Sink = (*PostgresAuditSink)(nil)
+
+const auditColumns = "chain, time, principal, tenant, method, request_digest, result, error, request_id, trace_id, prev_hash, hash"
+
+func (s *PostgresAuditSink) Write(ctx context.Context, r *audit.Record) error {
+	_, err := s.db.ExecContext(sqlmw.WithStatement(ctx, "audit.write"), "INSERT INTO audit_log ("+auditColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)",
+		r.Chain, r.Time, r.Principal, r.Tenant, r.Method, r.RequestDigest, r.Result, r.Error, r.RequestID, r.TraceID, r.PrevHash, r.Hash)
+	return err
+}
+
+// LastHash chain最后一条记录的hash，没有记录时为空，用于重启后继续audit.NewChain
+func (s *PostgresAuditSink) LastHash(ctx context.Context, chain string) (string, error) {
+	var hash string
+	err := s.db.GetContext(sqlmw.WithStatement(ctx, "audit.last_hash"), &hash, "SELECT hash FROM audit_log WHERE chain = $1 ORDER BY id DESC LIMIT 1", chain)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return hash, err
+}
+
+// Records 按写入顺序返回所有记录，用于audit.Verify
+func (s *PostgresAuditSink) Records(ctx context.Context) ([]audit.Record, error) {
+	rows, err := s.db.QueryContext(sqlmw.WithStatement(ctx, "audit.records"), "SELECT "+auditColumns+" FROM audit_log ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var records []audit.Record
+	for rows.Next() {
+		var r audit.Record
+		err := rows.Scan(&r.Chain, &r.Time, &r.Principal, &r.Tenant, &r.Method, &r.RequestDigest, &r.Result, &r.Error,
+			&r.RequestID, &r.TraceID, &r.PrevHash, &r.Hash)
+		if err != nil {
+			return nil, err
+		}
+		// 读出的时间使用连接的时区，hash按UTC计算
+		r.Time = r.Time.UTC()
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"gokit_foundation/sqlmw"
+	"net/url"
+	"strings"
+)
+
+// Credentials 返回连接数据库使用的用户名和密码，每次建立新连接时调用，如从vault读取动态凭据(见gokit_foundation/secrets)
+type Credentials func(ctx context.Context) (user, password string, err error)
+
+// OpenWithCredentials 与Open相同，但用户名和密码由creds提供(覆盖dsn中的)，凭据轮换后新建的连接自动使用新的凭据，
+// 已有的连接不受影响，需要配合SetConnMaxLifetime让旧连接定期退出
+func OpenWithCredentials(ctx context.Context, dsn string, creds Credentials, mw sqlmw.Config) (*sqlx.DB, error) {
+	return connect(ctx, sqlmw.Wrap(&credConnector{dsn: dsn, creds: creds}, mw))
+}
+
+type credConnector struct {
+	dsn   string
+	creds Credentials
+}
+
+func (c *credConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	user, password, err := c.creds(ctx)
+	if err != nil {
+		return nil, err
+	}
+	dsn, err := dsnWithCredentials(c.dsn, user, password)
+	if err != nil {
+		return nil, err
+	}
+	pc, err := pq.NewConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return pc.Connect(ctx)
+}
+
+func (c *credConnector) Driver() driver.Driver {
+	return &pq.Driver{}
+}
+
+// dsn支持URL(postgres://...)和key=value两种格式，见github.com/lib/pq
+func dsnWithCredentials(dsn, user, password string) (string, error) {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return "", err
+		}
+		u.User = url.UserPassword(user, password)
+		return u.String(), nil
+	}
+	// 后出现的同名参数覆盖前面的
+	quote := func(s string) string {
+		return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+	}
+	return strings.TrimSpace(dsn + " user=" + quote(user) + " password=" + quote(password)), nil
+}
@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"gokit_foundation/pagination"
+	"strconv"
+	"time"
+)
+
+// UserSorts List允许排序的字段，name、email按字节序比较(与数据库的collation无关)
+var UserSorts = []string{"id", "name", "email", "created_at"}
+
+// 精确到微秒(与postgres的timestamptz一致)的定长格式，字符串顺序与时间顺序一致
+const cursorTimeLayout = "2006-01-02T15:04:05.000000Z"
+
+// SortKey u在field排序下的排序值，按id排序时为空(只比较id)
+func SortKey(field string, u *User) string {
+	switch field {
+	case "name":
+		return u.Name
+	case "email":
+		return u.Email
+	case "created_at":
+		return u.CreatedAt.UTC().Format(cursorTimeLayout)
+	}
+	return ""
+}
+
+// UserCursor u在field排序下的游标，用于生成next_page_token
+func UserCursor(field string, u *User) pagination.Cursor {
+	return pagination.Cursor{Key: SortKey(field, u), ID: strconv.FormatInt(u.ID, 10)}
+}
+
+// ParseCursor 解析UserCursor生成的游标，返回排序值(created_at为time.Time，其他为string)和id
+func ParseCursor(field string, c pagination.Cursor) (key interface{}, id int64, err error) {
+	if id, err = strconv.ParseInt(c.ID, 10, 64); err != nil {
+		return nil, 0, pagination.ErrInvalidToken
+	}
+	if field != "created_at" {
+		return c.Key, id, nil
+	}
+	t, err := time.Parse(cursorTimeLayout, c.Key)
+	if err != nil {
+		return nil, 0, pagination.ErrInvalidToken
+	}
+	return t, id, nil
+}
@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+)
+
+/*
+数据库迁移：migrations目录下的sql文件编译进二进制，文件名为 <版本号>_<说明>.sql，版本号从1开始连续，已执行的版本记录在schema_migrations表
+-	已发布的migration不要修改或删除，变更表结构时追加新的文件
+-	一个文件可以包含多条语句，没有参数的Exec由lib/pq作为simple query发送
+-	所有未执行的migration和版本记录在同一个事务中执行(PostgreSQL的DDL支持事务)，失败时不会留下执行了一半的变更
+-	多个实例同时启动时，通过事务级的advisory lock保证只有一个实例执行迁移，其他实例等待其完成后发现没有需要执行的
+*/
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+var migrations = mustLoadMigrations(migrationFiles)
+
+func mustLoadMigrations(fsys fs.FS) []string {
+	m, err := loadMigrations(fsys)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// loadMigrations 按版本号返回migrations目录下的sql，版本号不连续或重复时返回错误
+func loadMigrations(fsys fs.FS) ([]string, error) {
+	names, err := fs.Glob(fsys, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+	m := make([]string, len(names))
+	for _, name := range names {
+		prefix, _, ok := strings.Cut(path.Base(name), "_")
+		v, err := strconv.Atoi(prefix)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("migration %s: name must be <version>_<description>.sql", name)
+		}
+		if v < 1 || v > len(m) || m[v-1] != "" {
+			return nil, fmt.Errorf("migration %s: versions must be 1..%d without gaps or duplicates", name, len(m))
+		}
+		b, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		if m[v-1] = strings.TrimSpace(string(b)); m[v-1] == "" {
+			return nil, fmt.Errorf("migration %s: empty", name)
+		}
+	}
+	return m, nil
+}
+
+// advisory lock的key，任意约定的常量即可
+const migrateLockKey = 20201001
+
+// Migrate 执行所有未执行的migration，返回本次执行的个数
+func Migrate(ctx context.Context, db *sqlx.DB) (n int, err error) {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+			n = 0
+			return
+		}
+		if err = tx.Commit(); err != nil {
+			n = 0
+		}
+	}()
+
+	// 事务结束时自动释放
+	if _, err = tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", migrateLockKey); err != nil {
+		return 0, err
+	}
+	_, err = tx.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INT         PRIMARY KEY,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		return 0, err
+	}
+	var current int
+	if err = tx.GetContext(ctx, &current, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations"); err != nil {
+		return 0, err
+	}
+	if current > len(migrations) {
+		return 0, fmt.Errorf("database schema version %d is newer than this binary (%d)", current, len(migrations))
+	}
+
+	for v := current + 1; v <= len(migrations); v++ {
+		if _, err = tx.ExecContext(ctx, migrations[v-1]); err == nil {
+			_, err = tx.ExecContext(ctx, "INSERT INTO schema_migrations (version) VALUES ($1)", v)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("migration %d: %v", v, err)
+		}
+		n++
+	}
+	return n, nil
+}
+
+// SchemaVersion 返回数据库已执行到的版本和本程序的最新版本，没有执行过迁移时current为0，只读，不加锁
+func SchemaVersion(ctx context.Context, db *sqlx.DB) (current, latest int, err error) {
+	var exists bool
+	if err = db.GetContext(ctx, &exists, "SELECT to_regclass('schema_migrations') IS NOT NULL"); err != nil || !exists {
+		return 0, len(migrations), err
+	}
+	err = db.GetContext(ctx, &current, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations")
+	return current, len(migrations), err
+}
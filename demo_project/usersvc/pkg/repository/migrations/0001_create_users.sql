@@ -0,0 +1,7 @@
+CREATE TABLE users (
+	id         BIGSERIAL    PRIMARY KEY,
+	name       VARCHAR(64)  NOT NULL,
+	email      VARCHAR(255) NOT NULL,
+	created_at TIMESTAMPTZ  NOT NULL DEFAULT now(),
+	updated_at TIMESTAMPTZ  NOT NULL DEFAULT now()
+);
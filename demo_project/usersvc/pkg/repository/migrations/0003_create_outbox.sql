@@ -0,0 +1,11 @@
+-- transactional outbox，投递成功后删除，见outbox.Dispatcher
+CREATE TABLE outbox (
+	id         BIGSERIAL    PRIMARY KEY,
+	event_id   VARCHAR(64)  NOT NULL,
+	event_type VARCHAR(64)  NOT NULL,
+	key        VARCHAR(255) NOT NULL DEFAULT '',
+	payload    JSONB        NOT NULL,
+	attempts   INT          NOT NULL DEFAULT 0,
+	last_error TEXT         NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ  NOT NULL DEFAULT now()
+);
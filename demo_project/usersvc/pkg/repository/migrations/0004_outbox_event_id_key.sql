@@ -0,0 +1 @@
+CREATE UNIQUE INDEX outbox_event_id_key ON outbox (event_id);
@@ -0,0 +1,2 @@
+-- 多租户，已有的用户属于空租户，email只在租户内唯一
+ALTER TABLE users ADD COLUMN tenant VARCHAR(64) NOT NULL DEFAULT '';
@@ -0,0 +1 @@
+CREATE UNIQUE INDEX users_tenant_email_key ON users (tenant, email);
@@ -0,0 +1,16 @@
+-- 审计日志(见gokit_foundation/audit)，只能插入
+CREATE TABLE audit_log (
+	id             BIGSERIAL    PRIMARY KEY,
+	chain          VARCHAR(255) NOT NULL DEFAULT '',
+	time           TIMESTAMPTZ  NOT NULL,
+	principal      VARCHAR(255) NOT NULL DEFAULT '',
+	tenant         VARCHAR(64)  NOT NULL DEFAULT '',
+	method         VARCHAR(64)  NOT NULL,
+	request_digest CHAR(64)     NOT NULL,
+	result         VARCHAR(64)  NOT NULL,
+	error          TEXT         NOT NULL DEFAULT '',
+	request_id     VARCHAR(64)  NOT NULL DEFAULT '',
+	trace_id       VARCHAR(64)  NOT NULL DEFAULT '',
+	prev_hash      VARCHAR(64)  NOT NULL DEFAULT '',
+	hash           VARCHAR(64)  NOT NULL DEFAULT ''
+);
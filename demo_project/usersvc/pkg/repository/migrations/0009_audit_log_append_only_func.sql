@@ -0,0 +1,6 @@
+-- 拒绝UPDATE和DELETE，需要清理时由DBA临时删除触发器
+CREATE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'audit_log is append-only';
+END
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,2 @@
+-- ListUsers按created_at排序翻页(keyset)，按name、email排序时全表排序，用户数多时需要按需加索引
+CREATE INDEX users_tenant_created_at_id ON users (tenant, created_at, id);
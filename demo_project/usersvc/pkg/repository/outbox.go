@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"gokit_foundation/sqlmw"
+	"time"
+)
+
+// NewPostgresOutbox outbox表的投递端，与NewPostgres使用同一个db，需先执行Migrate
+func NewPostgresOutbox(db *sqlx.DB) OutboxStore {
+	return &pgRepository{db: db, q: db}
+}
+
+// 同一时间只有一个实例投递outbox，保证相同key的事件按写入顺序投递，key与migrateLockKey不同即可
+const outboxLockKey = 20201002
+
+func (r *pgRepository) AddOutbox(ctx context.Context, m *OutboxMessage) error {
+	// lib/pq将[]byte参数作为bytea发送，写入JSONB时需要转为string
+	return r.q.QueryRowxContext(sqlmw.WithStatement(ctx, "outbox.add"),
+		"INSERT INTO outbox (event_id, event_type, key, payload) VALUES ($1, $2, $3, $4) RETURNING id, created_at",
+		m.EventID, m.EventType, m.Key, string(m.Payload),
+	).Scan(&m.ID, &m.CreatedAt)
+}
+
+func (r *pgRepository) ClaimOutbox(ctx context.Context, limit int, fn func(msgs []OutboxMessage) (sent []int64, err error)) error {
+	var fnErr error
+	err := r.WithTx(ctx, func(tx Repository) error {
+		q := tx.(*pgRepository).tx
+		// 事务结束时自动释放，其他实例正在投递时直接返回
+		var locked bool
+		if err := q.GetContext(sqlmw.WithStatement(ctx, "outbox.lock"), &locked, "SELECT pg_try_advisory_xact_lock($1)", outboxLockKey); err != nil || !locked {
+			return err
+		}
+		var msgs []OutboxMessage
+		err := q.SelectContext(sqlmw.WithStatement(ctx, "outbox.claim"), &msgs,
+			"SELECT id, event_id, event_type, key, payload, attempts, created_at FROM outbox ORDER BY id LIMIT $1", limit)
+		if err != nil || len(msgs) == 0 {
+			return err
+		}
+
+		var sent []int64
+		sent, fnErr = fn(msgs)
+		if len(sent) > 0 {
+			if _, err := q.ExecContext(sqlmw.WithStatement(ctx, "outbox.delete"), "DELETE FROM outbox WHERE id = ANY($1)", pq.Array(sent)); err != nil {
+				return err
+			}
+		}
+		if fnErr == nil {
+			return nil
+		}
+		done := make(map[int64]bool, len(sent))
+		for _, id := range sent {
+			done[id] = true
+		}
+		var failed []int64
+		for _, m := range msgs {
+			if !done[m.ID] {
+				failed = append(failed, m.ID)
+			}
+		}
+		_, err = q.ExecContext(sqlmw.WithStatement(ctx, "outbox.fail"), "UPDATE outbox SET attempts = attempts + 1, last_error = $1 WHERE id = ANY($2)",
+			fnErr.Error(), pq.Array(failed))
+		return err
+	})
+	// 投递失败时也要提交，删除已投递的消息并记录失败次数
+	if err != nil {
+		return err
+	}
+	return fnErr
+}
+
+func (r *pgRepository) OldestOutbox(ctx context.Context) (time.Time, error) {
+	var t time.Time
+	err := r.q.GetContext(sqlmw.WithStatement(ctx, "outbox.oldest"), &t, "SELECT created_at FROM outbox ORDER BY id LIMIT 1")
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	return t, err
+}
@@ -0,0 +1,230 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"gokit_foundation/pagination"
+	"gokit_foundation/sqlmw"
+	"gokit_foundation/tenant"
+	"strconv"
+	"strings"
+)
+
+// sqlx.DB和sqlx.Tx共有的方法，使得同一套sql既可以在事务外也可以在事务内执行
+type queryer interface {
+	GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowxContext(ctx context.Context, query string, args ...interface{}) *sqlx.Row
+}
+
+type pgRepository struct {
+	db       *sqlx.DB
+	q        queryer
+	tx       *sqlx.Tx  // 不为nil表示在事务中
+	replicas *Replicas // 为nil时读写都在db上
+}
+
+// 使用PostgreSQL存储，需先执行Migrate
+// 所有读写都限定在ctx中的租户内(见tenant.FromContext)，其他租户的用户不可见，没有租户时为空租户
+func NewPostgres(db *sqlx.DB) Repository {
+	return &pgRepository{db: db, q: db}
+}
+
+// NewPostgresWithReplicas 与NewPostgres相同，db为主库，事务外的读取路由到replicas中的从库，见Replicas
+func NewPostgresWithReplicas(db *sqlx.DB, replicas *Replicas) Repository {
+	return &pgRepository{db: db, q: db, replicas: replicas}
+}
+
+// Open 连接PostgreSQL，dsn格式见github.com/lib/pq，每次查询的耗时、span、慢查询日志见sqlmw.Config
+// repository的每个方法通过sqlmw.WithStatement为其sql命名(如users.get)
+func Open(ctx context.Context, dsn string, mw sqlmw.Config) (*sqlx.DB, error) {
+	c, err := pq.NewConnector(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("connect postgres: %v", err)
+	}
+	return connect(ctx, sqlmw.Wrap(c, mw))
+}
+
+func connect(ctx context.Context, c driver.Connector) (*sqlx.DB, error) {
+	db := sqlx.NewDb(sql.OpenDB(c), "postgres")
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("connect postgres: %v", err)
+	}
+	return db, nil
+}
+
+const userColumns = "id, name, email, created_at, updated_at"
+
+// 唯一索引冲突，见https://www.postgresql.org/docs/current/errcodes-appendix.html
+const pqUniqueViolation = "23505"
+
+func mapErr(err error) error {
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if e, ok := err.(*pq.Error); ok && e.Code == pqUniqueViolation {
+		return ErrDuplicateEmail
+	}
+	return err
+}
+
+func (r *pgRepository) Create(ctx context.Context, u *User) error {
+	ctx = sqlmw.WithStatement(ctx, "users.create")
+	err := r.q.QueryRowxContext(ctx,
+		"INSERT INTO users (tenant, name, email) VALUES ($1, $2, $3) RETURNING id, created_at, updated_at",
+		tenant.FromContext(ctx), u.Name, u.Email,
+	).Scan(&u.ID, &u.CreatedAt, &u.UpdatedAt)
+	return r.wrote(ctx, mapErr(err))
+}
+
+// where中的参数从$2开始，$1为租户
+func (r *pgRepository) get(ctx context.Context, where string, arg interface{}) (*User, error) {
+	query := "SELECT " + userColumns + " FROM users WHERE tenant = $1 AND " + where
+	if r.tx != nil {
+		// 事务中读取后一般会修改，锁住该行避免并发更新时丢失修改
+		query += " FOR UPDATE"
+	}
+	u := new(User)
+	if err := r.reader(ctx).GetContext(ctx, u, query, tenant.FromContext(ctx), arg); err != nil {
+		return nil, mapErr(err)
+	}
+	return u, nil
+}
+
+// reader 事务外的读取路由到从库(见Replicas)
+func (r *pgRepository) reader(ctx context.Context) queryer {
+	if r.tx == nil && r.replicas != nil {
+		if db := r.replicas.reader(ctx); db != nil {
+			return db
+		}
+	}
+	return r.q
+}
+
+func (r *pgRepository) Get(ctx context.Context, id int64) (*User, error) {
+	ctx = sqlmw.WithStatement(ctx, "users.get")
+	return r.get(ctx, "id = $2", id)
+}
+
+func (r *pgRepository) GetByEmail(ctx context.Context, email string) (*User, error) {
+	ctx = sqlmw.WithStatement(ctx, "users.get_by_email")
+	return r.get(ctx, "email = $2", email)
+}
+
+// List使用的排序表达式，字符串按字节序比较，与UserCursor、repotest.Memory一致
+var sortColumns = map[string]string{
+	"id":         "id",
+	"name":       `name COLLATE "C"`,
+	"email":      `email COLLATE "C"`,
+	"created_at": "created_at",
+}
+
+// keyset分页：WHERE (排序列, id) > (游标) ORDER BY 排序列, id，翻页不受前面记录的插入、删除影响
+func (r *pgRepository) List(ctx context.Context, f ListFilter, page pagination.Request) ([]*User, error) {
+	ctx = sqlmw.WithStatement(ctx, "users.list")
+	col, ok := sortColumns[page.Sort.Field]
+	if !ok {
+		return nil, fmt.Errorf("list users: unknown sort field %q", page.Sort.Field)
+	}
+	args := []interface{}{tenant.FromContext(ctx)}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+	query := "SELECT " + userColumns + " FROM users WHERE tenant = $1"
+	if f.NamePrefix != "" {
+		query += " AND name LIKE " + arg(likePrefix(f.NamePrefix)) + ` ESCAPE '\'`
+	}
+	op, dir := ">", " ASC"
+	if page.Sort.Desc {
+		op, dir = "<", " DESC"
+	}
+	if page.After != nil {
+		key, id, err := ParseCursor(page.Sort.Field, *page.After)
+		if err != nil {
+			return nil, err
+		}
+		if col == "id" {
+			query += " AND id " + op + " " + arg(id)
+		} else {
+			query += " AND (" + col + ", id) " + op + " (" + arg(key) + ", " + arg(id) + ")"
+		}
+	}
+	if col == "id" {
+		query += " ORDER BY id" + dir
+	} else {
+		query += " ORDER BY " + col + dir + ", id" + dir
+	}
+	query += " LIMIT " + arg(page.Size+1)
+	var users []*User
+	if err := r.reader(ctx).SelectContext(ctx, &users, query, args...); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// LIKE的前缀匹配，转义prefix中的通配符
+func likePrefix(prefix string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(prefix) + "%"
+}
+
+func (r *pgRepository) Update(ctx context.Context, u *User) error {
+	ctx = sqlmw.WithStatement(ctx, "users.update")
+	err := r.q.QueryRowxContext(ctx,
+		"UPDATE users SET name = $1, email = $2, updated_at = now() WHERE tenant = $3 AND id = $4 RETURNING updated_at",
+		u.Name, u.Email, tenant.FromContext(ctx), u.ID,
+	).Scan(&u.UpdatedAt)
+	return r.wrote(ctx, mapErr(err))
+}
+
+func (r *pgRepository) Delete(ctx context.Context, id int64) error {
+	ctx = sqlmw.WithStatement(ctx, "users.delete")
+	res, err := r.q.ExecContext(ctx, "DELETE FROM users WHERE tenant = $1 AND id = $2", tenant.FromContext(ctx), id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return r.wrote(ctx, nil)
+}
+
+// wrote 写入成功(err为nil)且不在事务中时记录会话的写入，事务在提交后记录，返回err
+func (r *pgRepository) wrote(ctx context.Context, err error) error {
+	if err == nil && r.tx == nil && r.replicas != nil {
+		r.replicas.wrote(ctx)
+	}
+	return err
+}
+
+func (r *pgRepository) WithTx(ctx context.Context, fn func(tx Repository) error) (err error) {
+	if r.tx != nil {
+		return fn(r)
+	}
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+		if err != nil {
+			_ = tx.Rollback()
+			return
+		}
+		if err = tx.Commit(); err == nil && r.replicas != nil {
+			r.replicas.wrote(ctx)
+		}
+	}()
+	return fn(&pgRepository{db: r.db, q: tx, tx: tx, replicas: r.replicas})
+}
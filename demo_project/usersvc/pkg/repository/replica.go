@@ -0,0 +1,221 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"gokit_foundation/clock"
+	"gokit_foundation/lru"
+	"gokit_foundation/sqlmw"
+	"gokit_foundation/tenant"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+读写分离：写入和事务都在主库上，事务外的Get、GetByEmail路由到从库(见NewPostgresWithReplicas)
+-	从库轮询使用，Run定期检查每个从库的复制延迟，延迟超过MaxLag或检查失败的从库不参与路由，恢复后重新加入，
+	没有可用的从库(包括Run第一次检查完成之前)时读主库
+-	read-your-writes：同一个会话(见WithSession)写入后StickyWindow内的读取都在主库上，
+	会话最近的写入只记录在本进程内，多实例部署时需要负载均衡按会话粘滞，否则只能依赖MaxLag限制读到的旧数据
+-	从库是弱依赖，连不上时只是不参与路由
+没有会话的请求写入后立即读取可能读到旧数据(最多落后MaxLag)
+*/
+
+type ReplicaConfig struct {
+	MaxLag        time.Duration // 复制延迟超过它的从库不参与路由
+	StickyWindow  time.Duration // 会话写入后读主库的时间，为0时不保证read-your-writes
+	CheckInterval time.Duration // 检查复制延迟的间隔
+	Sessions      int           // 最多记录多少个会话最近的写入
+	Clock         clock.Clock   // 为nil时为clock.Real
+}
+
+func DefaultReplicaConfig() ReplicaConfig {
+	return ReplicaConfig{
+		MaxLag:        5 * time.Second,
+		StickyWindow:  5 * time.Second,
+		CheckInterval: 2 * time.Second,
+		Sessions:      100000,
+	}
+}
+
+func (c ReplicaConfig) Validate() error {
+	if c.MaxLag <= 0 || c.CheckInterval <= 0 || c.Sessions <= 0 {
+		return errors.New("replica: max lag, check interval and sessions must be positive")
+	}
+	if c.StickyWindow < 0 {
+		return errors.New("replica: sticky window must not be negative")
+	}
+	return nil
+}
+
+type Replica struct {
+	Name string // 用于日志和指标
+	DB   *sqlx.DB
+}
+
+// OpenReplica 与Open相同，但不检查连接(由Replicas.Run检查)，creds不为nil时用户名和密码由creds提供，见OpenWithCredentials
+func OpenReplica(dsn string, creds Credentials, mw sqlmw.Config) (*sqlx.DB, error) {
+	var c driver.Connector = &credConnector{dsn: dsn, creds: creds}
+	if creds == nil {
+		pc, err := pq.NewConnector(dsn)
+		if err != nil {
+			return nil, fmt.Errorf("replica dsn: %v", err)
+		}
+		c = pc
+	}
+	return sqlx.NewDb(sql.OpenDB(sqlmw.Wrap(c, mw)), "postgres"), nil
+}
+
+type Replicas struct {
+	conf     ReplicaConfig
+	replicas []Replica
+	logger   log.Logger
+	lag      metrics.Gauge
+	status   map[string]bool // 每个从库上一次检查的结果，只在Run中访问
+
+	mu      sync.RWMutex
+	healthy []*sqlx.DB
+	next    uint64
+
+	writes    *lru.Cache[string, struct{}]
+	toReplica metrics.Counter
+	sticky    metrics.Counter
+	fallback  metrics.Counter
+}
+
+// NewReplicas conf需已通过Validate，reads按route(replica、sticky、fallback)上报读取的路由，lag按replica上报复制延迟(秒)，为nil时不上报
+func NewReplicas(replicas []Replica, conf ReplicaConfig, logger log.Logger, reads metrics.Counter, lag metrics.Gauge) *Replicas {
+	if reads == nil {
+		reads = discard.NewCounter()
+	}
+	if lag == nil {
+		lag = discard.NewGauge()
+	}
+	r := &Replicas{
+		conf:      conf,
+		replicas:  replicas,
+		logger:    logger,
+		lag:       lag,
+		status:    make(map[string]bool, len(replicas)),
+		toReplica: reads.With("route", "replica"),
+		sticky:    reads.With("route", "sticky"),
+		fallback:  reads.With("route", "fallback"),
+	}
+	if conf.StickyWindow > 0 {
+		r.writes = lru.New[string, struct{}](lru.Config{Size: conf.Sessions, TTL: conf.StickyWindow, Clock: conf.Clock}, lru.HashString, nil, nil)
+	}
+	return r
+}
+
+type ctxKeySession struct{}
+
+// WithSession 设置调用方的会话id(如客户端的X-Session-Id header)，同一会话写入后的读取在StickyWindow内读主库
+func WithSession(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKeySession{}, id)
+}
+
+func SessionFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(ctxKeySession{}).(string)
+	return id
+}
+
+// 会话id只在租户内唯一
+func sessionKey(ctx context.Context) (string, bool) {
+	id := SessionFromContext(ctx)
+	if id == "" {
+		return "", false
+	}
+	return tenant.FromContext(ctx) + "\x00" + id, true
+}
+
+// wrote 记录ctx所在会话的写入
+func (r *Replicas) wrote(ctx context.Context) {
+	if key, ok := sessionKey(ctx); ok && r.writes != nil {
+		r.writes.Set(key, struct{}{})
+	}
+}
+
+// reader 返回执行只读查询的从库，需要读主库时返回nil
+func (r *Replicas) reader(ctx context.Context) *sqlx.DB {
+	if key, ok := sessionKey(ctx); ok && r.writes != nil {
+		if _, ok := r.writes.Get(key); ok {
+			r.sticky.Add(1)
+			return nil
+		}
+	}
+	r.mu.RLock()
+	healthy := r.healthy
+	r.mu.RUnlock()
+	if len(healthy) == 0 {
+		r.fallback.Add(1)
+		return nil
+	}
+	r.toReplica.Add(1)
+	return healthy[atomic.AddUint64(&r.next, 1)%uint64(len(healthy))]
+}
+
+// 从库已回放所有收到的WAL时延迟为0，避免主库没有写入时pg_last_xact_replay_timestamp停滞被误判为延迟
+const replicaLagQuery = `SELECT CASE
+	WHEN NOT pg_is_in_recovery() OR pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+	ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+END`
+
+// Run 每CheckInterval检查一次所有从库，直到ctx结束
+func (r *Replicas) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.conf.CheckInterval)
+	defer ticker.Stop()
+	for {
+		r.check(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Replicas) check(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(sqlmw.WithStatement(ctx, "replica.lag"), r.conf.CheckInterval)
+	defer cancel()
+	var healthy []*sqlx.DB
+	for _, rep := range r.replicas {
+		var seconds float64
+		err := rep.DB.GetContext(ctx, &seconds, replicaLagQuery)
+		if err == nil {
+			r.lag.With("replica", rep.Name).Set(seconds)
+		}
+		lag := time.Duration(seconds * float64(time.Second))
+		ok := err == nil && lag <= r.conf.MaxLag
+		if ok {
+			healthy = append(healthy, rep.DB)
+		}
+		// 只在状态变化时输出
+		if prev, seen := r.status[rep.Name]; !seen || prev != ok {
+			r.status[rep.Name] = ok
+			r.logger.Log("replica", rep.Name, "healthy", ok, "lag", lag, "max_lag", r.conf.MaxLag, "err", err)
+		}
+	}
+	r.mu.Lock()
+	r.healthy = healthy
+	r.mu.Unlock()
+}
+
+// Close 关闭所有从库的连接池
+func (r *Replicas) Close() error {
+	var err error
+	for _, rep := range r.replicas {
+		if e := rep.DB.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-kit/kit/log"
+	"gokit_foundation/clock"
+	"testing"
+	"time"
+)
+
+func TestReplicaRouting(t *testing.T) {
+	primary, pm := newMock(t)
+	defer primary.Close()
+	replica, rm := newMock(t)
+	defer replica.Close()
+	fake := clock.NewFake(time.Unix(1600000000, 0))
+	conf := DefaultReplicaConfig()
+	conf.Clock = fake
+	replicas := NewReplicas([]Replica{{Name: "r0", DB: replica}}, conf, log.NewNopLogger(), nil, nil)
+	r := NewPostgresWithReplicas(primary, replicas)
+	now := time.Now()
+	getUser := func(mock sqlmock.Sqlmock) {
+		mock.ExpectQuery("FROM users WHERE tenant").WillReturnRows(sqlmock.NewRows(userRows).AddRow(1, "Jack", "jack@a.com", now, now))
+	}
+	lag := func(seconds float64) {
+		rm.ExpectQuery("pg_last_wal_replay_lsn").WillReturnRows(sqlmock.NewRows([]string{"lag"}).AddRow(seconds))
+		replicas.check(context.Background())
+	}
+	ctx := WithSession(context.Background(), "s1")
+
+	// 第一次检查之前读主库
+	getUser(pm)
+	if _, err := r.Get(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	lag(0.5)
+	getUser(rm)
+	if _, err := r.Get(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// 会话写入后StickyWindow内读主库，其他会话仍读从库
+	pm.ExpectExec("DELETE FROM users").WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := r.Delete(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	getUser(pm)
+	if _, err := r.Get(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	getUser(rm)
+	if _, err := r.Get(WithSession(context.Background(), "s2"), 1); err != nil {
+		t.Fatal(err)
+	}
+	fake.Advance(conf.StickyWindow)
+	getUser(rm)
+	if _, err := r.Get(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// 事务提交后同样记录写入
+	pm.ExpectBegin()
+	pm.ExpectQuery("FOR UPDATE").WillReturnRows(sqlmock.NewRows(userRows).AddRow(1, "Jack", "jack@a.com", now, now))
+	pm.ExpectCommit()
+	if err := r.WithTx(ctx, func(tx Repository) error { _, err := tx.Get(ctx, 1); return err }); err != nil {
+		t.Fatal(err)
+	}
+	getUser(pm)
+	if _, err := r.GetByEmail(ctx, "jack@a.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 延迟超过MaxLag的从库不参与路由，恢复后重新加入
+	lag(10)
+	getUser(pm)
+	if _, err := r.Get(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	lag(0)
+	getUser(rm)
+	if _, err := r.Get(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range []sqlmock.Sqlmock{pm, rm} {
+		if err := m.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestReplicaConfigValidate(t *testing.T) {
+	if err := DefaultReplicaConfig().Validate(); err != nil {
+		t.Error(err)
+	}
+	for _, conf := range []ReplicaConfig{{}, {MaxLag: time.Second, CheckInterval: time.Second, Sessions: 1, StickyWindow: -1}} {
+		if conf.Validate() == nil {
+			t.Errorf("%+v: want err", conf)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"gokit_foundation/pagination"
+	"time"
+)
+
+/*
+repository层只负责数据的读写，不包含业务规则(如邮箱是否允许修改)，业务规则在service层
+service层只依赖Repository接口，测试时可以替换为内存实现
+*/
+
+var (
+	// 记录不存在
+	ErrNotFound = errors.New("user not found")
+	// 违反email的唯一索引
+	ErrDuplicateEmail = errors.New("duplicate email")
+)
+
+type User struct {
+	ID        int64     `db:"id"`
+	Name      string    `db:"name"`
+	Email     string    `db:"email"`
+	CreatedAt time.Time `db:"created_at"`
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+// OutboxMessage 待投递的领域事件，与业务数据在同一个事务中写入outbox表，事务提交后由outbox.Dispatcher投递
+type OutboxMessage struct {
+	ID        int64     `db:"id"`
+	EventID   string    `db:"event_id"`   // 事件的唯一id(events.Event.ID)，消费方据此去重
+	EventType string    `db:"event_type"` // 决定投递到哪个topic
+	Key       string    `db:"key"`        // 分区key，相同key的事件按写入顺序投递
+	Payload   []byte    `db:"payload"`    // events.Event的JSON
+	Attempts  int       `db:"attempts"`   // 已失败的投递次数
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// ListFilter List的过滤条件，零值表示不过滤
+type ListFilter struct {
+	NamePrefix string // name以它开头
+}
+
+type Repository interface {
+	// 写入后回填u.ID、CreatedAt、UpdatedAt
+	Create(ctx context.Context, u *User) error
+	// 在事务中调用时会锁住该行(SELECT ... FOR UPDATE)，直到事务结束
+	Get(ctx context.Context, id int64) (*User, error)
+	GetByEmail(ctx context.Context, email string) (*User, error)
+	// 按u.ID更新name和email，回填u.UpdatedAt
+	Update(ctx context.Context, u *User) error
+	Delete(ctx context.Context, id int64) error
+	// 按page.Sort返回排在page.After之后的最多page.Size+1条记录(多取的一条用于判断是否还有下一页，见pagination.Page)，
+	// 排序字段见UserSorts，游标见UserCursor，游标无效时返回pagination.ErrInvalidToken
+	List(ctx context.Context, f ListFilter, page pagination.Request) ([]*User, error)
+	// 写入outbox表，需要在WithTx中与对应的业务数据一起写入，回填m.ID、CreatedAt
+	AddOutbox(ctx context.Context, m *OutboxMessage) error
+
+	// 在一个事务中执行fn，fn中需使用参数tx而不是当前对象，fn返回err或panic时回滚，否则提交
+	// 已经在事务中时直接使用当前事务执行fn(不支持嵌套事务)
+	WithTx(ctx context.Context, fn func(tx Repository) error) error
+}
+
+// OutboxStore outbox.Dispatcher读取和删除待投递的消息
+type OutboxStore interface {
+	// 在一个事务中锁住最多limit条待投递的消息(按写入顺序，跳过其他实例已锁住的)并调用fn，
+	// fn返回投递成功的消息id和err，成功的消息被删除，其余消息的attempts+1，事务结束后锁释放
+	ClaimOutbox(ctx context.Context, limit int, fn func(msgs []OutboxMessage) (sent []int64, err error)) error
+	// 最早的待投递消息的写入时间，没有待投递的消息时返回零值
+	OldestOutbox(ctx context.Context) (time.Time, error)
+}
@@ -0,0 +1,548 @@
+package repotest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gokit_foundation/pagination"
+	"gokit_foundation/tenant"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"usersvc/pkg/repository"
+)
+
+/*
+repository.Repository的测试工具(手写，不依赖mockgen)：
+-	Memory：内存实现，用于测试service层、transport，不需要postgres
+-	Contract：所有实现都必须满足的行为，Memory和postgres实现(见integration)都应该通过
+*/
+
+// Memory 按租户隔离，email在租户内唯一，事务之间串行执行
+// 事务外的读写不等待事务，可以看到未提交的修改(与postgres不同，测试中一般不会并发)
+type Memory struct {
+	txMu sync.Mutex // 事务之间串行
+	mu   sync.Mutex
+	st   memState
+	err  error
+}
+
+type memState struct {
+	users  map[string]map[int64]repository.User // tenant -> id -> user
+	nextID int64
+	outbox []repository.OutboxMessage
+}
+
+func (s memState) clone() memState {
+	cp := memState{users: make(map[string]map[int64]repository.User, len(s.users)), nextID: s.nextID}
+	for t, users := range s.users {
+		cp.users[t] = make(map[int64]repository.User, len(users))
+		for id, u := range users {
+			cp.users[t][id] = u
+		}
+	}
+	cp.outbox = append([]repository.OutboxMessage(nil), s.outbox...)
+	return cp
+}
+
+func NewMemory() *Memory {
+	return &Memory{st: memState{users: map[string]map[int64]repository.User{}}}
+}
+
+// SetErr err不为nil时所有操作返回该err，模拟数据库故障
+func (m *Memory) SetErr(err error) {
+	m.mu.Lock()
+	m.err = err
+	m.mu.Unlock()
+}
+
+// Outbox 按写入顺序返回已写入(含未提交)的outbox消息
+func (m *Memory) Outbox() []repository.OutboxMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]repository.OutboxMessage(nil), m.st.outbox...)
+}
+
+// 调用时需持有m.mu
+func (m *Memory) tenantUsers(ctx context.Context) map[int64]repository.User {
+	t := tenant.FromContext(ctx)
+	if m.st.users[t] == nil {
+		m.st.users[t] = map[int64]repository.User{}
+	}
+	return m.st.users[t]
+}
+
+func emailTaken(users map[int64]repository.User, email string, except int64) bool {
+	for id, u := range users {
+		if id != except && u.Email == email {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Memory) Create(ctx context.Context, u *repository.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	users := m.tenantUsers(ctx)
+	if emailTaken(users, u.Email, 0) {
+		return repository.ErrDuplicateEmail
+	}
+	m.st.nextID++
+	u.ID = m.st.nextID
+	u.CreatedAt = time.Now()
+	u.UpdatedAt = u.CreatedAt
+	users[u.ID] = *u
+	return nil
+}
+
+func (m *Memory) get(ctx context.Context, match func(u repository.User) bool) (*repository.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return nil, m.err
+	}
+	for _, u := range m.tenantUsers(ctx) {
+		if match(u) {
+			return &u, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (m *Memory) Get(ctx context.Context, id int64) (*repository.User, error) {
+	return m.get(ctx, func(u repository.User) bool { return u.ID == id })
+}
+
+func (m *Memory) GetByEmail(ctx context.Context, email string) (*repository.User, error) {
+	return m.get(ctx, func(u repository.User) bool { return u.Email == email })
+}
+
+func (m *Memory) Update(ctx context.Context, u *repository.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	users := m.tenantUsers(ctx)
+	old, ok := users[u.ID]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	if emailTaken(users, u.Email, u.ID) {
+		return repository.ErrDuplicateEmail
+	}
+	old.Name, old.Email, old.UpdatedAt = u.Name, u.Email, time.Now()
+	users[u.ID] = old
+	u.UpdatedAt = old.UpdatedAt
+	return nil
+}
+
+func (m *Memory) Delete(ctx context.Context, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	users := m.tenantUsers(ctx)
+	if _, ok := users[id]; !ok {
+		return repository.ErrNotFound
+	}
+	delete(users, id)
+	return nil
+}
+
+// 与postgres实现相同按 (排序值, id) 比较，排序值按字节序
+func (m *Memory) List(ctx context.Context, f repository.ListFilter, page pagination.Request) ([]*repository.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return nil, m.err
+	}
+	field := page.Sort.Field
+	less := func(ka string, ida int64, kb string, idb int64) bool {
+		if page.Sort.Desc {
+			ka, ida, kb, idb = kb, idb, ka, ida
+		}
+		return ka < kb || (ka == kb && ida < idb)
+	}
+	var afterID int64
+	if page.After != nil {
+		var err error
+		if _, afterID, err = repository.ParseCursor(field, *page.After); err != nil {
+			return nil, err
+		}
+	}
+	var users []*repository.User
+	for _, u := range m.tenantUsers(ctx) {
+		u := u
+		if !strings.HasPrefix(u.Name, f.NamePrefix) {
+			continue
+		}
+		if page.After != nil && !less(page.After.Key, afterID, repository.SortKey(field, &u), u.ID) {
+			continue
+		}
+		users = append(users, &u)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return less(repository.SortKey(field, users[i]), users[i].ID, repository.SortKey(field, users[j]), users[j].ID)
+	})
+	if len(users) > page.Size+1 {
+		users = users[:page.Size+1]
+	}
+	return users, nil
+}
+
+func (m *Memory) AddOutbox(_ context.Context, msg *repository.OutboxMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	msg.ID = int64(len(m.st.outbox) + 1)
+	msg.CreatedAt = time.Now()
+	m.st.outbox = append(m.st.outbox, *msg)
+	return nil
+}
+
+func (m *Memory) WithTx(ctx context.Context, fn func(tx repository.Repository) error) (err error) {
+	m.txMu.Lock()
+	defer m.txMu.Unlock()
+	m.mu.Lock()
+	if m.err != nil {
+		m.mu.Unlock()
+		return m.err
+	}
+	backup := m.st.clone()
+	m.mu.Unlock()
+
+	rollback := func() {
+		m.mu.Lock()
+		m.st = backup
+		m.mu.Unlock()
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			rollback()
+			panic(p)
+		}
+		if err != nil {
+			rollback()
+		}
+	}()
+	return fn(memTx{m})
+}
+
+// 事务中再调用WithTx时直接使用当前事务
+type memTx struct {
+	*Memory
+}
+
+func (tx memTx) WithTx(_ context.Context, fn func(tx repository.Repository) error) error {
+	return fn(tx)
+}
+
+// Contract 每个子测试使用不同的租户，repo中已有的数据不影响结果
+func Contract(t *testing.T, repo repository.Repository) {
+	t.Helper()
+	prefix := fmt.Sprintf("contract-%d-", time.Now().UnixNano())
+	newCtx := func(t *testing.T) context.Context {
+		name := strings.ToLower(t.Name()[strings.LastIndex(t.Name(), "/")+1:])
+		return tenant.WithTenant(context.Background(), prefix+name)
+	}
+	mustCreate := func(t *testing.T, ctx context.Context, name, email string) *repository.User {
+		t.Helper()
+		u := &repository.User{Name: name, Email: email}
+		if err := repo.Create(ctx, u); err != nil {
+			t.Fatalf("Create got err:%v", err)
+		}
+		return u
+	}
+	mustNotFound := func(t *testing.T, ctx context.Context, id int64) {
+		t.Helper()
+		if u, err := repo.Get(ctx, id); err != repository.ErrNotFound {
+			t.Errorf("Get(%d) got user:%+v err:%v want ErrNotFound", id, u, err)
+		}
+	}
+	errBoom := errors.New("boom")
+
+	t.Run("CreateGet", func(t *testing.T) {
+		ctx := newCtx(t)
+		u := mustCreate(t, ctx, "Jack", "jack@a.com")
+		if u.ID == 0 || u.CreatedAt.IsZero() || u.UpdatedAt.IsZero() {
+			t.Errorf("Create did not fill user:%+v", u)
+		}
+		got, err := repo.Get(ctx, u.ID)
+		if err != nil || got.Name != "Jack" || got.Email != "jack@a.com" || !got.CreatedAt.Equal(u.CreatedAt) {
+			t.Errorf("Get got user:%+v err:%v", got, err)
+		}
+		if got, err = repo.GetByEmail(ctx, "jack@a.com"); err != nil || got.ID != u.ID {
+			t.Errorf("GetByEmail got user:%+v err:%v", got, err)
+		}
+		if got.ID == mustCreate(t, ctx, "Rose", "rose@a.com").ID {
+			t.Error("Create got the same id twice")
+		}
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		ctx := newCtx(t)
+		mustNotFound(t, ctx, 1<<62)
+		if _, err := repo.GetByEmail(ctx, "nobody@a.com"); err != repository.ErrNotFound {
+			t.Errorf("GetByEmail got err:%v want ErrNotFound", err)
+		}
+		if err := repo.Update(ctx, &repository.User{ID: 1 << 62, Name: "x", Email: "x@a.com"}); err != repository.ErrNotFound {
+			t.Errorf("Update got err:%v want ErrNotFound", err)
+		}
+		if err := repo.Delete(ctx, 1<<62); err != repository.ErrNotFound {
+			t.Errorf("Delete got err:%v want ErrNotFound", err)
+		}
+	})
+
+	t.Run("DuplicateEmail", func(t *testing.T) {
+		ctx := newCtx(t)
+		mustCreate(t, ctx, "Jack", "jack@a.com")
+		rose := mustCreate(t, ctx, "Rose", "rose@a.com")
+		if err := repo.Create(ctx, &repository.User{Name: "Jack2", Email: "jack@a.com"}); err != repository.ErrDuplicateEmail {
+			t.Errorf("Create got err:%v want ErrDuplicateEmail", err)
+		}
+		if err := repo.Update(ctx, &repository.User{ID: rose.ID, Name: "Rose", Email: "jack@a.com"}); err != repository.ErrDuplicateEmail {
+			t.Errorf("Update got err:%v want ErrDuplicateEmail", err)
+		}
+		// email不变时不算冲突
+		if err := repo.Update(ctx, &repository.User{ID: rose.ID, Name: "Rose2", Email: "rose@a.com"}); err != nil {
+			t.Errorf("Update got err:%v", err)
+		}
+	})
+
+	t.Run("UpdateDelete", func(t *testing.T) {
+		ctx := newCtx(t)
+		u := mustCreate(t, ctx, "Jack", "jack@a.com")
+		up := &repository.User{ID: u.ID, Name: "Jack Ma", Email: "ma@a.com"}
+		if err := repo.Update(ctx, up); err != nil || up.UpdatedAt.Before(u.UpdatedAt) {
+			t.Fatalf("Update got user:%+v err:%v", up, err)
+		}
+		got, err := repo.Get(ctx, u.ID)
+		if err != nil || got.Name != "Jack Ma" || got.Email != "ma@a.com" || !got.CreatedAt.Equal(u.CreatedAt) {
+			t.Errorf("Get got user:%+v err:%v", got, err)
+		}
+		if _, err = repo.GetByEmail(ctx, "jack@a.com"); err != repository.ErrNotFound {
+			t.Errorf("GetByEmail old email got err:%v want ErrNotFound", err)
+		}
+		if err = repo.Delete(ctx, u.ID); err != nil {
+			t.Fatalf("Delete got err:%v", err)
+		}
+		mustNotFound(t, ctx, u.ID)
+		if err = repo.Delete(ctx, u.ID); err != repository.ErrNotFound {
+			t.Errorf("Delete twice got err:%v want ErrNotFound", err)
+		}
+	})
+
+	// 每种排序按页遍历得到完整且有序的结果，name前缀中的通配符按字面匹配
+	t.Run("List", func(t *testing.T) {
+		ctx := newCtx(t)
+		other := tenant.WithTenant(ctx, tenant.FromContext(ctx)+"-other")
+		mustCreate(t, other, "bob", "bob@a.com")
+		names := []string{"carol", "bob", "al_ice", "bob", "dave", "alan"}
+		ids := map[string][]int64{}
+		for i, name := range names {
+			u := mustCreate(t, ctx, name, fmt.Sprintf("%c%d@a.com", 'z'-i, i))
+			ids[name] = append(ids[name], u.ID)
+		}
+		spec := pagination.Spec{DefaultSize: 2, MaxSize: 2, Sorts: repository.UserSorts, DefaultSort: pagination.Sort{Field: "id"}}
+		list := func(orderBy string, f repository.ListFilter) (got []string) {
+			t.Helper()
+			p := pagination.Params{OrderBy: orderBy}
+			for i := 0; i <= len(names); i++ {
+				page, err := spec.Parse(p, f.NamePrefix)
+				if err != nil {
+					t.Fatal(err)
+				}
+				users, err := repo.List(ctx, f, page)
+				if err != nil {
+					t.Fatalf("List(%q) got err:%v", orderBy, err)
+				}
+				users, p.PageToken = pagination.Page(page, users, func(u *repository.User) pagination.Cursor {
+					return repository.UserCursor(page.Sort.Field, u)
+				})
+				for _, u := range users {
+					got = append(got, fmt.Sprintf("%s%d", u.Name, u.ID-ids[names[0]][0]))
+				}
+				if p.PageToken == "" {
+					return got
+				}
+			}
+			t.Fatalf("List(%q) did not end", orderBy)
+			return nil
+		}
+		for _, tt := range []struct {
+			orderBy, prefix string
+			want            string
+		}{
+			{"", "", "carol0 bob1 al_ice2 bob3 dave4 alan5"},
+			{"id desc", "", "alan5 dave4 bob3 al_ice2 bob1 carol0"},
+			{"name", "", "al_ice2 alan5 bob1 bob3 carol0 dave4"},
+			{"name desc", "", "dave4 carol0 bob3 bob1 alan5 al_ice2"},
+			// email的首字母与写入顺序相反
+			{"email", "", "alan5 dave4 bob3 al_ice2 bob1 carol0"},
+			{"created_at", "", "carol0 bob1 al_ice2 bob3 dave4 alan5"},
+			{"name", "al", "al_ice2 alan5"},
+			{"name", "al_", "al_ice2"},
+			{"", "bob", "bob1 bob3"},
+			{"", "x", ""},
+		} {
+			if got := strings.Join(list(tt.orderBy, repository.ListFilter{NamePrefix: tt.prefix}), " "); got != tt.want {
+				t.Errorf("order_by:%q prefix:%q got:%q want:%q", tt.orderBy, tt.prefix, got, tt.want)
+			}
+		}
+
+		// 游标之后的记录被删除不影响翻页
+		page, _ := spec.Parse(pagination.Params{}, "")
+		first, err := repo.List(ctx, repository.ListFilter{}, page)
+		if err != nil || len(first) != 3 {
+			t.Fatalf("List got %d users err:%v", len(first), err)
+		}
+		_, token := pagination.Page(page, first, func(u *repository.User) pagination.Cursor { return repository.UserCursor("id", u) })
+		if err = repo.Delete(ctx, first[2].ID); err != nil {
+			t.Fatal(err)
+		}
+		page, _ = spec.Parse(pagination.Params{PageToken: token}, "")
+		if next, err := repo.List(ctx, repository.ListFilter{}, page); err != nil || len(next) != 3 || next[0].ID != ids["bob"][1] {
+			t.Errorf("List next page got %+v err:%v", next, err)
+		}
+		if _, err = repo.List(ctx, repository.ListFilter{}, pagination.Request{Size: 1, Sort: pagination.Sort{Field: "created_at"}, After: &pagination.Cursor{Key: "yesterday", ID: "1"}}); err != pagination.ErrInvalidToken {
+			t.Errorf("List with invalid cursor got err:%v", err)
+		}
+	})
+
+	// 其他租户的用户不可见，email只在租户内唯一
+	t.Run("TenantIsolation", func(t *testing.T) {
+		ctx := newCtx(t)
+		other := tenant.WithTenant(ctx, tenant.FromContext(ctx)+"-other")
+		u := mustCreate(t, ctx, "Jack", "jack@a.com")
+		mustNotFound(t, other, u.ID)
+		if _, err := repo.GetByEmail(other, "jack@a.com"); err != repository.ErrNotFound {
+			t.Errorf("GetByEmail got err:%v want ErrNotFound", err)
+		}
+		if err := repo.Update(other, &repository.User{ID: u.ID, Name: "x", Email: "x@a.com"}); err != repository.ErrNotFound {
+			t.Errorf("Update got err:%v want ErrNotFound", err)
+		}
+		if err := repo.Delete(other, u.ID); err != repository.ErrNotFound {
+			t.Errorf("Delete got err:%v want ErrNotFound", err)
+		}
+		mustCreate(t, other, "Jack", "jack@a.com")
+		if got, err := repo.Get(ctx, u.ID); err != nil || got.Name != "Jack" {
+			t.Errorf("Get got user:%+v err:%v", got, err)
+		}
+	})
+
+	t.Run("TxCommit", func(t *testing.T) {
+		ctx := newCtx(t)
+		var id int64
+		err := repo.WithTx(ctx, func(tx repository.Repository) error {
+			u := &repository.User{Name: "Jack", Email: "jack@a.com"}
+			if err := tx.Create(ctx, u); err != nil {
+				return err
+			}
+			id = u.ID
+			m := &repository.OutboxMessage{EventID: prefix + "commit", EventType: "UserCreated", Key: "1", Payload: []byte("{}")}
+			if err := tx.AddOutbox(ctx, m); err != nil {
+				return err
+			}
+			if m.ID == 0 || m.CreatedAt.IsZero() {
+				t.Errorf("AddOutbox did not fill message:%+v", m)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("WithTx got err:%v", err)
+		}
+		if got, err := repo.Get(ctx, id); err != nil || got.Email != "jack@a.com" {
+			t.Errorf("Get got user:%+v err:%v", got, err)
+		}
+	})
+
+	// fn返回err时回滚，err原样返回
+	t.Run("TxRollback", func(t *testing.T) {
+		ctx := newCtx(t)
+		jack := mustCreate(t, ctx, "Jack", "jack@a.com")
+		var id int64
+		err := repo.WithTx(ctx, func(tx repository.Repository) error {
+			u := &repository.User{Name: "Rose", Email: "rose@a.com"}
+			if err := tx.Create(ctx, u); err != nil {
+				return err
+			}
+			id = u.ID
+			if err := tx.Update(ctx, &repository.User{ID: jack.ID, Name: "Jack Ma", Email: "jack@a.com"}); err != nil {
+				return err
+			}
+			if err := tx.Delete(ctx, jack.ID); err != nil {
+				return err
+			}
+			return errBoom
+		})
+		if err != errBoom {
+			t.Fatalf("WithTx got err:%v want boom", err)
+		}
+		mustNotFound(t, ctx, id)
+		if got, err := repo.Get(ctx, jack.ID); err != nil || got.Name != "Jack" {
+			t.Errorf("Get got user:%+v err:%v", got, err)
+		}
+	})
+
+	// fn panic时回滚，panic继续向上传递
+	t.Run("TxPanic", func(t *testing.T) {
+		ctx := newCtx(t)
+		var id int64
+		func() {
+			defer func() {
+				if p := recover(); p != errBoom {
+					t.Errorf("got panic:%v want boom", p)
+				}
+			}()
+			_ = repo.WithTx(ctx, func(tx repository.Repository) error {
+				u := &repository.User{Name: "Jack", Email: "jack@a.com"}
+				if err := tx.Create(ctx, u); err != nil {
+					return err
+				}
+				id = u.ID
+				panic(errBoom)
+			})
+		}()
+		if id == 0 {
+			t.Fatal("Create in tx did not run")
+		}
+		mustNotFound(t, ctx, id)
+	})
+
+	// 嵌套的WithTx使用外层事务，外层回滚时内层的修改也回滚
+	t.Run("NestedTx", func(t *testing.T) {
+		ctx := newCtx(t)
+		var id int64
+		err := repo.WithTx(ctx, func(tx repository.Repository) error {
+			if err := tx.WithTx(ctx, func(inner repository.Repository) error {
+				u := &repository.User{Name: "Jack", Email: "jack@a.com"}
+				if err := inner.Create(ctx, u); err != nil {
+					return err
+				}
+				id = u.ID
+				return nil
+			}); err != nil {
+				return err
+			}
+			// 内层没有单独提交，外层事务中可以看到
+			if _, err := tx.Get(ctx, id); err != nil {
+				return err
+			}
+			return errBoom
+		})
+		if err != errBoom {
+			t.Fatalf("WithTx got err:%v want boom", err)
+		}
+		mustNotFound(t, ctx, id)
+	})
+}
@@ -0,0 +1,40 @@
+package repotest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"usersvc/pkg/repository"
+)
+
+func TestContract(t *testing.T) {
+	Contract(t, NewMemory())
+}
+
+func TestMemory(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	err := m.WithTx(ctx, func(tx repository.Repository) error {
+		return tx.AddOutbox(ctx, &repository.OutboxMessage{EventID: "1"})
+	})
+	if err != nil || len(m.Outbox()) != 1 || m.Outbox()[0].ID != 1 {
+		t.Fatalf("got outbox:%+v err:%v", m.Outbox(), err)
+	}
+	// 回滚时outbox也恢复
+	_ = m.WithTx(ctx, func(tx repository.Repository) error {
+		_ = tx.AddOutbox(ctx, &repository.OutboxMessage{EventID: "2"})
+		return errors.New("boom")
+	})
+	if len(m.Outbox()) != 1 {
+		t.Errorf("got outbox:%+v", m.Outbox())
+	}
+
+	errDown := errors.New("db down")
+	m.SetErr(errDown)
+	if err := m.Create(ctx, &repository.User{Email: "a@a.com"}); err != errDown {
+		t.Errorf("Create got err:%v", err)
+	}
+	if err := m.WithTx(ctx, func(repository.Repository) error { return nil }); err != errDown {
+		t.Errorf("WithTx got err:%v", err)
+	}
+}
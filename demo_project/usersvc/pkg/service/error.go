@@ -0,0 +1,88 @@
+package service
+
+import (
+	"errors"
+	"strconv"
+)
+
+/*
+service层的业务错误统一使用Error类型定义，Code会被endpoint层映射为response.RetCode
+Code是与client之间的稳定约定，一旦定义就不要修改其含义
+非Error类型的err(如数据库故障)属于系统错误，endpoint层会直接返回err，不映射为RetCode
+*/
+const (
+	CodeOK      = 0
+	CodeUnknown = 5
+
+	// 1001...
+	CodeInvalidInput = 1001
+	CodeNotFound     = 1004
+	CodeEmailExists  = 1005
+)
+
+type Error struct {
+	Code int
+	Msg  string
+	Key  string // 错误描述的翻译key，同一Code有多个描述时用于区分，见MessageKey
+}
+
+func NewError(code int, msg string) *Error {
+	return &Error{Code: code, Msg: msg}
+}
+
+// WithKey 返回一个新的Error，可以用于包级别的错误变量
+func (e *Error) WithKey(key string) *Error {
+	c := *e
+	c.Key = key
+	return &c
+}
+
+func (e *Error) Error() string {
+	return e.Msg
+}
+
+// IsBizError 是否是service层定义的业务错误
+func IsBizError(err error) bool {
+	var e *Error
+	return errors.As(err, &e)
+}
+
+// ErrorToRetCode 统一将service层返回的err转为RetCode
+func ErrorToRetCode(err error) int {
+	if err == nil {
+		return CodeOK
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return CodeUnknown
+}
+
+// ErrorFromRetCode ErrorToRetCode的逆映射，client据此还原service层的err，
+// 已定义的错误返回同一个变量(可以直接与ErrUserNotFound等比较)，未知的Code返回新的Error
+func ErrorFromRetCode(code int, msg string) error {
+	switch code {
+	case CodeOK:
+		return nil
+	case CodeNotFound:
+		return ErrUserNotFound
+	case CodeEmailExists:
+		return ErrEmailExists
+	}
+	return NewError(code, msg)
+}
+
+// MessageKey response中RetCode、Msg对应的翻译key(见gokit_foundation/i18n)：已定义的错误为其Key，
+// 其他(如带参数的描述)为code.<Code>，RetCode为0时为空
+func MessageKey(code int, msg string) string {
+	if code == CodeOK {
+		return ""
+	}
+	for _, e := range keyedErrors {
+		if e.Code == code && e.Msg == msg {
+			return e.Key
+		}
+	}
+	return "code." + strconv.Itoa(code)
+}
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"gokit_foundation/events"
+	"strconv"
+	"usersvc/config"
+	"usersvc/pkg/repository"
+)
+
+// 领域事件的类型，topic映射见cmd/usersvc的-kafka.topics
+const (
+	EventUserCreated = "UserCreated"
+	EventUserUpdated = "UserUpdated"
+	EventUserDeleted = "UserDeleted"
+)
+
+// UserCreated、UserUpdated的payload，为修改后的用户
+type UserChanged struct {
+	ID    int64  `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+type UserDeleted struct {
+	ID int64 `json:"id"`
+}
+
+func userChanged(u *repository.User) UserChanged {
+	return UserChanged{ID: u.ID, Name: u.Name, Email: u.Email}
+}
+
+// 在tx中写入outbox，与业务数据一起提交或回滚，事件的key为用户id，同一用户的事件按顺序投递
+func (s basicService) addEvent(ctx context.Context, tx repository.Repository, typ string, userID int64, payload interface{}) error {
+	if !s.withEvents {
+		return nil
+	}
+	e := events.Event{
+		ID:      s.ids.NewID(),
+		Type:    typ,
+		Source:  config.SvcName,
+		Time:    s.clock.Now(),
+		Key:     strconv.FormatInt(userID, 10),
+		Payload: payload,
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return tx.AddOutbox(ctx, &repository.OutboxMessage{EventID: e.ID, EventType: e.Type, Key: e.Key, Payload: b})
+}
@@ -0,0 +1,226 @@
+package service
+
+import (
+	"context"
+	"github.com/go-kit/kit/log"
+	"gokit_foundation/clock"
+	"gokit_foundation/events"
+	"gokit_foundation/idgen"
+	"gokit_foundation/pagination"
+	"net/mail"
+	"strings"
+	"unicode/utf8"
+	"usersvc/pkg/repository"
+)
+
+type Service interface {
+	CreateUser(ctx context.Context, name, email string) (*repository.User, error)
+	GetUser(ctx context.Context, id int64) (*repository.User, error)
+	// name或email为nil时不修改
+	UpdateUser(ctx context.Context, id int64, name, email *string) (*repository.User, error)
+	DeleteUser(ctx context.Context, id int64) error
+	// 分页参数见ListUsersSpec，namePrefix为空时不过滤，最后一页的nextPageToken为空
+	ListUsers(ctx context.Context, page pagination.Params, namePrefix string) (users []*repository.User, nextPageToken string, err error)
+}
+
+// New returns a basic Service with all of the expected middlewares wired in.
+// withEvents为true时领域事件与数据在同一个事务中写入outbox表，需要运行outbox.Dispatcher投递，否则会一直堆积
+func New(logger log.Logger, repo repository.Repository, withEvents bool, options ...Option) Service {
+	var svc Service
+	{
+		svc = NewBasicService(logger, repo, withEvents, options...)
+		svc = LoggingMiddleware()(svc)
+	}
+	return svc
+}
+
+var (
+	ErrInvalidName  = NewError(CodeInvalidInput, "name must be 1-64 characters").WithKey("user.invalid_name")
+	ErrInvalidEmail = NewError(CodeInvalidInput, "invalid email").WithKey("user.invalid_email")
+	ErrUserNotFound = NewError(CodeNotFound, "user not found").WithKey("user.not_found")
+	ErrEmailExists  = NewError(CodeEmailExists, "email already exists").WithKey("user.email_exists")
+)
+
+// 有Key的错误，见MessageKey
+var keyedErrors = []*Error{ErrInvalidName, ErrInvalidEmail, ErrUserNotFound, ErrEmailExists}
+
+const maxNameLen = 64
+
+// ListUsersSpec ListUsers的分页约定(见gokit_foundation/pagination)，默认按id排序
+var ListUsersSpec = pagination.Spec{
+	DefaultSize: 20,
+	MaxSize:     100,
+	Sorts:       repository.UserSorts,
+	DefaultSort: pagination.Sort{Field: "id"},
+}
+
+type Option func(*basicService)
+
+// 领域事件的时间，默认clock.Real
+func WithClock(c clock.Clock) Option {
+	return func(s *basicService) { s.clock = c }
+}
+
+// 领域事件的id，默认与events.NewID相同
+func WithIDGen(g idgen.Generator) Option {
+	return func(s *basicService) { s.ids = g }
+}
+
+func NewBasicService(lgr log.Logger, repo repository.Repository, withEvents bool, options ...Option) Service {
+	s := basicService{
+		logger:     lgr,
+		repo:       repo,
+		withEvents: withEvents,
+		clock:      clock.Real,
+		ids:        idgen.GeneratorFunc(events.NewID),
+	}
+	for _, opt := range options {
+		opt(&s)
+	}
+	return s
+}
+
+type basicService struct {
+	logger     log.Logger
+	repo       repository.Repository
+	withEvents bool
+	clock      clock.Clock
+	ids        idgen.Generator
+}
+
+func validateName(name string) error {
+	if n := utf8.RuneCountInString(name); n == 0 || n > maxNameLen || strings.TrimSpace(name) != name {
+		return ErrInvalidName
+	}
+	return nil
+}
+
+// 只接受不带显示名的地址，如 a@b.com
+func validateEmail(email string) error {
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return ErrInvalidEmail
+	}
+	return nil
+}
+
+// 将repository层的err转为service层的业务错误，其他err(系统错误)原样返回
+func repoErr(err error) error {
+	switch err {
+	case repository.ErrNotFound:
+		return ErrUserNotFound
+	case repository.ErrDuplicateEmail:
+		return ErrEmailExists
+	}
+	return err
+}
+
+// 同一个email只能注册一次：事务中先查再插入，并发插入时由唯一索引兜底(ErrDuplicateEmail)
+func (s basicService) CreateUser(ctx context.Context, name, email string) (u *repository.User, err error) {
+	if err = validateName(name); err != nil {
+		return nil, err
+	}
+	if err = validateEmail(email); err != nil {
+		return nil, err
+	}
+	err = s.repo.WithTx(ctx, func(tx repository.Repository) error {
+		if _, err := tx.GetByEmail(ctx, email); err == nil {
+			return ErrEmailExists
+		} else if err != repository.ErrNotFound {
+			return err
+		}
+		u = &repository.User{Name: name, Email: email}
+		if err := tx.Create(ctx, u); err != nil {
+			return err
+		}
+		return s.addEvent(ctx, tx, EventUserCreated, u.ID, userChanged(u))
+	})
+	if err != nil {
+		return nil, repoErr(err)
+	}
+	return u, nil
+}
+
+func (s basicService) GetUser(ctx context.Context, id int64) (*repository.User, error) {
+	u, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return nil, repoErr(err)
+	}
+	return u, nil
+}
+
+// 读取-修改-写入在同一个事务中完成，Get会锁住该行，并发更新同一个用户时不会丢失修改
+func (s basicService) UpdateUser(ctx context.Context, id int64, name, email *string) (u *repository.User, err error) {
+	if name != nil {
+		if err = validateName(*name); err != nil {
+			return nil, err
+		}
+	}
+	if email != nil {
+		if err = validateEmail(*email); err != nil {
+			return nil, err
+		}
+	}
+	err = s.repo.WithTx(ctx, func(tx repository.Repository) error {
+		if u, err = tx.Get(ctx, id); err != nil {
+			return err
+		}
+		if name != nil {
+			u.Name = *name
+		}
+		if email != nil && *email != u.Email {
+			if _, err := tx.GetByEmail(ctx, *email); err == nil {
+				return ErrEmailExists
+			} else if err != repository.ErrNotFound {
+				return err
+			}
+			u.Email = *email
+		}
+		if err := tx.Update(ctx, u); err != nil {
+			return err
+		}
+		return s.addEvent(ctx, tx, EventUserUpdated, u.ID, userChanged(u))
+	})
+	if err != nil {
+		return nil, repoErr(err)
+	}
+	return u, nil
+}
+
+func (s basicService) DeleteUser(ctx context.Context, id int64) error {
+	if !s.withEvents {
+		return repoErr(s.repo.Delete(ctx, id))
+	}
+	return repoErr(s.repo.WithTx(ctx, func(tx repository.Repository) error {
+		if err := tx.Delete(ctx, id); err != nil {
+			return err
+		}
+		return s.addEvent(ctx, tx, EventUserDeleted, id, UserDeleted{ID: id})
+	}))
+}
+
+// 分页参数错误(包括无效的page_token)为CodeInvalidInput
+func (s basicService) ListUsers(ctx context.Context, p pagination.Params, namePrefix string) ([]*repository.User, string, error) {
+	if utf8.RuneCountInString(namePrefix) > maxNameLen {
+		return nil, "", NewError(CodeInvalidInput, "name_prefix must be at most 64 characters")
+	}
+	filter := ""
+	if namePrefix != "" {
+		filter = "name_prefix=" + namePrefix
+	}
+	page, err := ListUsersSpec.Parse(p, filter)
+	if err != nil {
+		return nil, "", NewError(CodeInvalidInput, err.Error())
+	}
+	users, err := s.repo.List(ctx, repository.ListFilter{NamePrefix: namePrefix}, page)
+	if err == pagination.ErrInvalidToken {
+		return nil, "", NewError(CodeInvalidInput, err.Error())
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	users, next := pagination.Page(page, users, func(u *repository.User) pagination.Cursor {
+		return repository.UserCursor(page.Sort.Field, u)
+	})
+	return users, next, nil
+}
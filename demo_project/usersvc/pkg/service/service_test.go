@@ -0,0 +1,210 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"gokit_foundation/clock"
+	"gokit_foundation/events"
+	"gokit_foundation/idgen"
+	"gokit_foundation/lru"
+	"gokit_foundation/pagination"
+	"gokit_foundation/pagination/pagetest"
+	"gokit_foundation/tenant"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"usersvc/pkg/repository/repotest"
+)
+
+func strp(s string) *string { return &s }
+
+func TestCreateUser(t *testing.T) {
+	ctx := context.Background()
+	repo := repotest.NewMemory()
+	svc := NewBasicService(log.NewNopLogger(), repo, false)
+
+	u, err := svc.CreateUser(ctx, "Jack", "jack@a.com")
+	if err != nil || u.ID != 1 {
+		t.Fatalf("got user:%+v err:%v", u, err)
+	}
+	test := []struct {
+		name, email string
+		want        error
+	}{
+		{"", "a@a.com", ErrInvalidName},
+		{" Jack", "a@a.com", ErrInvalidName},
+		{"Jack", "not-an-email", ErrInvalidEmail},
+		{"Jack", "Jack <a@a.com>", ErrInvalidEmail},
+		{"Jack2", "jack@a.com", ErrEmailExists},
+	}
+	for _, tt := range test {
+		if _, err := svc.CreateUser(ctx, tt.name, tt.email); err != tt.want {
+			t.Errorf("name:%q email:%q got err:%v want:%v", tt.name, tt.email, err, tt.want)
+		}
+	}
+
+	// 系统错误原样返回，不是业务错误
+	errDown := errors.New("db down")
+	repo.SetErr(errDown)
+	if _, err := svc.CreateUser(ctx, "Rose", "rose@a.com"); err != errDown || IsBizError(err) {
+		t.Errorf("got err:%v", err)
+	}
+}
+
+func TestUpdateUser(t *testing.T) {
+	ctx := context.Background()
+	repo := repotest.NewMemory()
+	svc := NewBasicService(log.NewNopLogger(), repo, false)
+	jack, _ := svc.CreateUser(ctx, "Jack", "jack@a.com")
+	_, _ = svc.CreateUser(ctx, "Rose", "rose@a.com")
+
+	u, err := svc.UpdateUser(ctx, jack.ID, strp("Jack Ma"), nil)
+	if err != nil || u.Name != "Jack Ma" || u.Email != "jack@a.com" {
+		t.Fatalf("got user:%+v err:%v", u, err)
+	}
+	// email被占用时整个事务回滚，name也不会被修改
+	if _, err := svc.UpdateUser(ctx, jack.ID, strp("Jack"), strp("rose@a.com")); err != ErrEmailExists {
+		t.Errorf("got err:%v want ErrEmailExists", err)
+	}
+	if got, _ := svc.GetUser(ctx, jack.ID); got.Name != "Jack Ma" {
+		t.Errorf("not rolled back, got user:%+v", got)
+	}
+	// 修改为自己当前的email不算冲突
+	if _, err := svc.UpdateUser(ctx, jack.ID, nil, strp("jack@a.com")); err != nil {
+		t.Errorf("got err:%v", err)
+	}
+	if _, err := svc.UpdateUser(ctx, 100, strp("X"), nil); err != ErrUserNotFound {
+		t.Errorf("got err:%v want ErrUserNotFound", err)
+	}
+}
+
+func TestGetDeleteUser(t *testing.T) {
+	ctx := context.Background()
+	svc := NewBasicService(log.NewNopLogger(), repotest.NewMemory(), false)
+	u, _ := svc.CreateUser(ctx, "Jack", "jack@a.com")
+
+	if err := svc.DeleteUser(ctx, u.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.GetUser(ctx, u.ID); err != ErrUserNotFound {
+		t.Errorf("GetUser got err:%v want ErrUserNotFound", err)
+	}
+	if err := svc.DeleteUser(ctx, u.ID); err != ErrUserNotFound {
+		t.Errorf("DeleteUser got err:%v want ErrUserNotFound", err)
+	}
+	if ErrorToRetCode(ErrUserNotFound) != CodeNotFound || ErrorToRetCode(errors.New("x")) != CodeUnknown {
+		t.Error("wrong ret code")
+	}
+}
+
+func TestListUsers(t *testing.T) {
+	ctx := context.Background()
+	svc := NewBasicService(log.NewNopLogger(), repotest.NewMemory(), false)
+	for i := 0; i < 25; i++ {
+		if _, err := svc.CreateUser(ctx, fmt.Sprintf("user%02d", i%7), fmt.Sprintf("u%d@a.com", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pagetest.Contract(t, func(ctx context.Context, p pagination.Params) ([]string, string, error) {
+		users, next, err := svc.ListUsers(ctx, p, "")
+		var ids []string
+		for _, u := range users {
+			ids = append(ids, strconv.FormatInt(u.ID, 10))
+		}
+		return ids, next, err
+	}, pagetest.Config{Total: 25, DefaultSize: ListUsersSpec.DefaultSize, MaxSize: ListUsersSpec.MaxSize, OrderBy: []string{"", "name", "email desc", "created_at"}})
+
+	users, next, err := svc.ListUsers(ctx, pagination.Params{PageSize: 2, OrderBy: "name"}, "user01")
+	if err != nil || len(users) != 2 || users[0].Name != "user01" || next == "" {
+		t.Fatalf("got %+v next:%q err:%v", users, next, err)
+	}
+	// 换了过滤条件的token、过长的前缀都是参数错误
+	for _, prefix := range []string{"user02", strings.Repeat("x", maxNameLen+1)} {
+		if _, _, err := svc.ListUsers(ctx, pagination.Params{PageToken: next, OrderBy: "name"}, prefix); ErrorToRetCode(err) != CodeInvalidInput {
+			t.Errorf("prefix:%q got err:%v", prefix, err)
+		}
+	}
+}
+
+// 事件与数据在同一个事务中写入outbox，事务回滚时事件也不会写入
+func TestEventsInOutbox(t *testing.T) {
+	ctx := context.Background()
+	repo := repotest.NewMemory()
+	now := clock.NewFake(time.Date(2020, 11, 8, 12, 0, 0, 0, time.UTC))
+	svc := NewBasicService(log.NewNopLogger(), repo, true, WithClock(now), WithIDGen(idgen.NewSequence("evt-")))
+	jack, _ := svc.CreateUser(ctx, "Jack", "jack@a.com")
+	_, _ = svc.CreateUser(ctx, "Rose", "rose@a.com")
+	_, _ = svc.CreateUser(ctx, "Jack2", "jack@a.com")
+	_, _ = svc.UpdateUser(ctx, jack.ID, strp("Jack Ma"), nil)
+	_, _ = svc.UpdateUser(ctx, jack.ID, strp("Jack"), strp("rose@a.com"))
+	_ = svc.DeleteUser(ctx, jack.ID)
+	_ = svc.DeleteUser(ctx, jack.ID)
+
+	var got []string
+	for _, m := range repo.Outbox() {
+		var e events.Event
+		if err := json.Unmarshal(m.Payload, &e); err != nil {
+			t.Fatal(err)
+		}
+		if e.ID != m.EventID || e.Type != m.EventType || e.Key != m.Key || e.Source != "UserSvc" || !e.Time.Equal(now.Now()) {
+			t.Errorf("got message:%+v event:%+v", m, e)
+		}
+		// payload解码为map，重新编码后key按字母排序
+		b, _ := json.Marshal(e.Payload)
+		got = append(got, e.ID+" "+e.Type+" "+string(b))
+	}
+	want := []string{
+		`evt-1 UserCreated {"email":"jack@a.com","id":1,"name":"Jack"}`,
+		`evt-2 UserCreated {"email":"rose@a.com","id":2,"name":"Rose"}`,
+		`evt-3 UserUpdated {"email":"jack@a.com","id":1,"name":"Jack Ma"}`,
+		`evt-4 UserDeleted {"id":1}`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got events:%q", got)
+	}
+}
+
+func TestCachingMiddleware(t *testing.T) {
+	ctx := context.Background()
+	repo := repotest.NewMemory()
+	svc := CachingMiddleware(NewUserCache(lru.Config{Size: 10, TTL: time.Minute}, nil, nil))(NewBasicService(log.NewNopLogger(), repo, false))
+	jack, _ := svc.CreateUser(ctx, "Jack", "jack@a.com")
+	if _, err := svc.GetUser(ctx, jack.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// 命中时不访问repository，返回的是副本
+	repo.SetErr(errors.New("db down"))
+	u, err := svc.GetUser(ctx, jack.ID)
+	if err != nil || u.Name != "Jack" {
+		t.Fatalf("want cached user, got user:%+v err:%v", u, err)
+	}
+	u.Name = "modified"
+	if u, _ = svc.GetUser(ctx, jack.ID); u.Name != "Jack" {
+		t.Errorf("cache modified by caller, got %+v", u)
+	}
+	// 不同租户的相同id不命中
+	if _, err := svc.GetUser(tenant.WithTenant(ctx, "t1"), jack.ID); err == nil {
+		t.Error("want miss for another tenant")
+	}
+	repo.SetErr(nil)
+
+	// 修改后重新查询
+	if _, err := svc.UpdateUser(ctx, jack.ID, strp("Jack Ma"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if u, _ = svc.GetUser(ctx, jack.ID); u.Name != "Jack Ma" {
+		t.Errorf("want updated user, got %+v", u)
+	}
+	if err := svc.DeleteUser(ctx, jack.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.GetUser(ctx, jack.ID); err != ErrUserNotFound {
+		t.Errorf("got err:%v want ErrUserNotFound", err)
+	}
+}
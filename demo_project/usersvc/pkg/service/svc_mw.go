@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"github.com/go-kit/kit/metrics"
+	"gokit_foundation/logging"
+	"gokit_foundation/lru"
+	"gokit_foundation/pagination"
+	"gokit_foundation/tenant"
+	"usersvc/pkg/repository"
+)
+
+type Middleware func(Service) Service
+
+// 日志mw，请求耗时等指标在endpoint层的InstrumentingMiddleware中上报
+// 使用endpoint层放入ctx的请求级别logger，已带上request_id、method、tenant等字段(见logging.FromContext)
+func LoggingMiddleware() Middleware {
+	return func(next Service) Service {
+		return loggingMiddleware{next}
+	}
+}
+
+type loggingMiddleware struct {
+	next Service
+}
+
+func (mw loggingMiddleware) CreateUser(ctx context.Context, name, email string) (u *repository.User, err error) {
+	logger := logging.FromContext(ctx)
+	defer func() {
+		logger.Log("name", name, "email", email, "id", userID(u), "err", err)
+	}()
+	return mw.next.CreateUser(ctx, name, email)
+}
+
+func (mw loggingMiddleware) GetUser(ctx context.Context, id int64) (u *repository.User, err error) {
+	logger := logging.FromContext(ctx)
+	defer func() {
+		logger.Log("id", id, "err", err)
+	}()
+	return mw.next.GetUser(ctx, id)
+}
+
+func (mw loggingMiddleware) UpdateUser(ctx context.Context, id int64, name, email *string) (u *repository.User, err error) {
+	logger := logging.FromContext(ctx)
+	defer func() {
+		logger.Log("id", id, "name", strOrNil(name), "email", strOrNil(email), "err", err)
+	}()
+	return mw.next.UpdateUser(ctx, id, name, email)
+}
+
+func (mw loggingMiddleware) DeleteUser(ctx context.Context, id int64) (err error) {
+	logger := logging.FromContext(ctx)
+	defer func() {
+		logger.Log("id", id, "err", err)
+	}()
+	return mw.next.DeleteUser(ctx, id)
+}
+
+func (mw loggingMiddleware) ListUsers(ctx context.Context, page pagination.Params, namePrefix string) (users []*repository.User, next string, err error) {
+	logger := logging.FromContext(ctx)
+	defer func() {
+		logger.Log("page_size", page.PageSize, "order_by", page.OrderBy, "name_prefix", namePrefix, "count", len(users), "more", next != "", "err", err)
+	}()
+	return mw.next.ListUsers(ctx, page, namePrefix)
+}
+
+func userID(u *repository.User) int64 {
+	if u == nil {
+		return 0
+	}
+	return u.ID
+}
+
+func strOrNil(s *string) interface{} {
+	if s == nil {
+		return nil
+	}
+	return *s
+}
+
+// CacheKey GetUser缓存的key，用户属于租户，不同租户的相同id是不同的用户
+type CacheKey struct {
+	Tenant string
+	ID     int64
+}
+
+func hashCacheKey(k CacheKey) uint64 {
+	return lru.HashString(k.Tenant) ^ lru.HashInt64(k.ID)
+}
+
+// NewUserCache CachingMiddleware使用的缓存，conf需已通过Validate，lookups、evictions见lru.New
+func NewUserCache(conf lru.Config, lookups, evictions metrics.Counter) *lru.Cache[CacheKey, repository.User] {
+	return lru.New[CacheKey, repository.User](conf, hashCacheKey, lookups, evictions)
+}
+
+/*
+CachingMiddleware GetUser优先读取进程内缓存，未命中时查询后写入(用户不存在时不缓存)；
+UpdateUser、DeleteUser执行后(不论成功与否)删除对应的记录，下一次GetUser重新查询
+缓存的是User的值，每次返回一个副本，调用方修改返回值不影响缓存
+多实例部署时其他实例的修改不会删除本实例的缓存，与写入并发的GetUser也可能写回旧值，两种情况下旧数据最多保留TTL
+*/
+func CachingMiddleware(cache *lru.Cache[CacheKey, repository.User]) Middleware {
+	return func(next Service) Service {
+		return cachingMiddleware{next: next, cache: cache}
+	}
+}
+
+type cachingMiddleware struct {
+	next  Service
+	cache *lru.Cache[CacheKey, repository.User]
+}
+
+func cacheKey(ctx context.Context, id int64) CacheKey {
+	return CacheKey{Tenant: tenant.FromContext(ctx), ID: id}
+}
+
+func (mw cachingMiddleware) CreateUser(ctx context.Context, name, email string) (*repository.User, error) {
+	return mw.next.CreateUser(ctx, name, email)
+}
+
+func (mw cachingMiddleware) GetUser(ctx context.Context, id int64) (*repository.User, error) {
+	key := cacheKey(ctx, id)
+	if u, ok := mw.cache.Get(key); ok {
+		return &u, nil
+	}
+	u, err := mw.next.GetUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	mw.cache.Set(key, *u)
+	return u, nil
+}
+
+func (mw cachingMiddleware) UpdateUser(ctx context.Context, id int64, name, email *string) (*repository.User, error) {
+	defer mw.cache.Delete(cacheKey(ctx, id))
+	return mw.next.UpdateUser(ctx, id, name, email)
+}
+
+// 列表不缓存
+func (mw cachingMiddleware) ListUsers(ctx context.Context, page pagination.Params, namePrefix string) ([]*repository.User, string, error) {
+	return mw.next.ListUsers(ctx, page, namePrefix)
+}
+
+func (mw cachingMiddleware) DeleteUser(ctx context.Context, id int64) error {
+	defer mw.cache.Delete(cacheKey(ctx, id))
+	return mw.next.DeleteUser(ctx, id)
+}
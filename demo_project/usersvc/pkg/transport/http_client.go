@@ -0,0 +1,144 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/tracing/opentracing"
+	httptransport "github.com/go-kit/kit/transport/http"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"gokit_foundation/errs"
+	"gokit_foundation/idempotency"
+	"gokit_foundation/pagination"
+	"gokit_foundation/propagation"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	endpoint2 "usersvc/pkg/endpoint"
+	"usersvc/pkg/repository"
+)
+
+// MakeHTTPClientEndpoints 返回调用某个usersvc实例的Endpoints，instance为host:port或http://host:port
+// timeout为每次http调用的超时(包括读取响应)，ctx中的token(auth.WithToken)、租户(tenant.WithTenant)等(见propagation.Fields)以及幂等键(idempotency.WithKey)、会话id(repository.WithSession)会写入header
+func MakeHTTPClientEndpoints(instance string, timeout time.Duration, otTracer stdopentracing.Tracer, logger log.Logger) (endpoint2.UserSvcEndpoints, error) {
+	if !strings.HasPrefix(instance, "http") {
+		instance = "http://" + instance
+	}
+	tgt, err := url.Parse(instance)
+	if err != nil {
+		return endpoint2.UserSvcEndpoints{}, err
+	}
+	tgt.Path = ""
+
+	options := []httptransport.ClientOption{
+		httptransport.SetClient(&http.Client{Timeout: timeout}),
+		propagation.HTTPClientBefore(),
+		httptransport.ClientBefore(idempotency.ContextToHTTP()),
+		httptransport.ClientBefore(sessionToHTTP),
+		httptransport.ClientBefore(opentracing.ContextToHTTP(otTracer, logger)),
+	}
+	// 请求编码时需要修改path，所以每个接口使用单独的encoder
+	newClient := func(method, name string, enc httptransport.EncodeRequestFunc, newResponse func() interface{}) endpoint.Endpoint {
+		ep := httptransport.NewClient(method, tgt, enc, decodeHTTPResponse(newResponse), options...).Endpoint()
+		return opentracing.TraceClient(otTracer, name)(ep)
+	}
+	newUserResponse := func() interface{} { return new(endpoint2.UserResponse) }
+	return endpoint2.UserSvcEndpoints{
+		CreateUserEndpoint: newClient(http.MethodPost, "CreateUser", encodeHTTPCreateUserRequest, newUserResponse),
+		GetUserEndpoint:    newClient(http.MethodGet, "GetUser", encodeHTTPGetUserRequest, newUserResponse),
+		UpdateUserEndpoint: newClient(http.MethodPatch, "UpdateUser", encodeHTTPUpdateUserRequest, newUserResponse),
+		DeleteUserEndpoint: newClient(http.MethodDelete, "DeleteUser", encodeHTTPDeleteUserRequest,
+			func() interface{} { return new(endpoint2.DeleteUserResponse) }),
+		ListUsersEndpoint: newClient(http.MethodGet, "ListUsers", encodeHTTPListUsersRequest,
+			func() interface{} { return new(endpoint2.ListUsersResponse) }),
+	}, nil
+}
+
+func encodeJSONBody(req *http.Request, v interface{}) error {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(v); err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Body = ioutil.NopCloser(&buf)
+	return nil
+}
+
+func userPath(id int64) string {
+	return "/users/" + strconv.FormatInt(id, 10)
+}
+
+func encodeHTTPCreateUserRequest(_ context.Context, req *http.Request, request interface{}) error {
+	req.URL.Path = "/users"
+	return encodeJSONBody(req, request)
+}
+
+func encodeHTTPGetUserRequest(_ context.Context, req *http.Request, request interface{}) error {
+	req.URL.Path = userPath(request.(*endpoint2.GetUserRequest).ID)
+	return nil
+}
+
+func encodeHTTPUpdateUserRequest(_ context.Context, req *http.Request, request interface{}) error {
+	r := request.(*endpoint2.UpdateUserRequest)
+	req.URL.Path = userPath(r.ID)
+	return encodeJSONBody(req, r)
+}
+
+func encodeHTTPDeleteUserRequest(_ context.Context, req *http.Request, request interface{}) error {
+	req.URL.Path = userPath(request.(*endpoint2.DeleteUserRequest).ID)
+	return nil
+}
+
+func encodeHTTPListUsersRequest(_ context.Context, req *http.Request, request interface{}) error {
+	r := request.(*endpoint2.ListUsersRequest)
+	req.URL.Path = "/users"
+	q := url.Values{}
+	pagination.Params{PageSize: r.PageSize, PageToken: r.PageToken, OrderBy: r.OrderBy}.SetQuery(q)
+	if r.NamePrefix != "" {
+		q.Set("name_prefix", r.NamePrefix)
+	}
+	req.URL.RawQuery = q.Encode()
+	return nil
+}
+
+// server返回的http状态码(见err2code)对应的错误类别，409(幂等键的请求正在处理)、5xx可重试
+var httpToKind = map[int]errs.Kind{
+	http.StatusBadRequest:          errs.KindInvalid,
+	http.StatusUnauthorized:        errs.KindUnauthenticated,
+	http.StatusForbidden:           errs.KindForbidden,
+	http.StatusNotFound:            errs.KindNotFound,
+	http.StatusConflict:            errs.KindUnavailable,
+	http.StatusUnprocessableEntity: errs.KindInvalid,
+}
+
+func decodeHTTPResponse(newResponse func() interface{}) httptransport.DecodeResponseFunc {
+	return func(_ context.Context, resp *http.Response) (interface{}, error) {
+		if resp.StatusCode != http.StatusOK {
+			var w errorWrapper
+			_ = json.NewDecoder(resp.Body).Decode(&w)
+			kind, ok := httpToKind[resp.StatusCode]
+			if !ok {
+				kind = errs.KindUnavailable
+			}
+			return nil, errs.New(kind, fmt.Sprintf("usersvc: http %d: %s", resp.StatusCode, w.Error))
+		}
+		response := newResponse()
+		if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+			return nil, err
+		}
+		return response, nil
+	}
+}
+
+func sessionToHTTP(ctx context.Context, r *http.Request) context.Context {
+	if id := repository.SessionFromContext(ctx); id != "" {
+		r.Header.Set(sessionHeader, id)
+	}
+	return ctx
+}
@@ -0,0 +1,126 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"gokit_foundation/errs"
+	"gokit_foundation/idempotency"
+	"gokit_foundation/pagination"
+	"gokit_foundation/pagination/pagetest"
+	"gokit_foundation/tenant"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"usersvc/pkg/endpoint"
+	"usersvc/pkg/repository"
+	"usersvc/pkg/repository/repotest"
+	"usersvc/pkg/service"
+)
+
+func strp(s string) *string { return &s }
+
+// client与server的编解码一致，业务错误还原为service层的err，系统错误为可重试的*errs.Error
+func TestHTTPClient(t *testing.T) {
+	svc := &countingService{}
+	eps := endpoint.New(svc, nil, nil, stdopentracing.NoopTracer{}, idempotency.NewMemStore(10), nil, tenant.Config{}, nil, log.NewNopLogger())
+	srv := httptest.NewServer(NewHTTPHandler(eps, stdopentracing.NoopTracer{}, log.NewNopLogger()))
+	defer srv.Close()
+	cli, err := MakeHTTPClientEndpoints(srv.URL, time.Second, stdopentracing.NoopTracer{}, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// 带上幂等键的重试不会重复创建
+	for i := 0; i < 2; i++ {
+		u, err := cli.CreateUser(idempotency.WithKey(ctx, "k1"), "Jack", "jack@a.com")
+		if err != nil || u.ID != 1 || u.Name != "Jack" {
+			t.Fatalf("#%d CreateUser got user:%+v err:%v", i, u, err)
+		}
+	}
+	if svc.creates != 1 {
+		t.Errorf("got creates:%d want 1", svc.creates)
+	}
+	if u, err := cli.UpdateUser(ctx, 1, strp("Rose"), nil); err != nil || u.Name != "Rose" {
+		t.Errorf("UpdateUser got user:%+v err:%v", u, err)
+	}
+	if _, err := cli.GetUser(ctx, 2); err != service.ErrUserNotFound {
+		t.Errorf("GetUser got err:%v want ErrUserNotFound", err)
+	}
+	if err := cli.DeleteUser(ctx, 2); err != service.ErrUserNotFound {
+		t.Errorf("DeleteUser got err:%v want ErrUserNotFound", err)
+	}
+	if _, err := cli.GetUser(ctx, 500); errs.KindOf(err) != errs.KindUnavailable || !errs.IsRetryable(err) {
+		t.Errorf("GetUser got err:%v want retryable", err)
+	}
+}
+
+// 分页参数经过query string传递，行为与直接调用service相同
+func TestHTTPClientListUsers(t *testing.T) {
+	svc := service.NewBasicService(log.NewNopLogger(), repotest.NewMemory(), false)
+	eps := endpoint.New(svc, nil, nil, stdopentracing.NoopTracer{}, nil, nil, tenant.Config{}, nil, log.NewNopLogger())
+	srv := httptest.NewServer(NewHTTPHandler(eps, stdopentracing.NoopTracer{}, log.NewNopLogger()))
+	defer srv.Close()
+	cli, err := MakeHTTPClientEndpoints(srv.URL, time.Second, stdopentracing.NoopTracer{}, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for i := 0; i < 23; i++ {
+		if _, err := svc.CreateUser(ctx, fmt.Sprintf("Jack %d", i%5), fmt.Sprintf("jack%d@a.com", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pagetest.Contract(t, func(ctx context.Context, p pagination.Params) ([]string, string, error) {
+		users, next, err := cli.ListUsers(ctx, p, "")
+		var ids []string
+		for _, u := range users {
+			ids = append(ids, strconv.FormatInt(u.ID, 10))
+		}
+		return ids, next, err
+	}, pagetest.Config{Total: 23, DefaultSize: service.ListUsersSpec.DefaultSize, MaxSize: service.ListUsersSpec.MaxSize, OrderBy: []string{"", "name desc", "created_at"}})
+
+	// 过滤条件中的空格等经过转义
+	users, next, err := cli.ListUsers(ctx, pagination.Params{PageSize: 10}, "Jack 1")
+	if err != nil || len(users) != 5 || next != "" || users[0].Name != "Jack 1" || users[0].CreatedAt.IsZero() {
+		t.Errorf("got %+v next:%q err:%v", users, next, err)
+	}
+}
+
+// ctx中的租户通过header传给server，server拒绝缺失或不在白名单中的租户
+func TestHTTPClientTenant(t *testing.T) {
+	eps := endpoint.New(stubService{}, nil, nil, stdopentracing.NoopTracer{}, nil, nil,
+		tenant.Config{Required: true, Allowed: []string{"acme"}}, nil, log.NewNopLogger())
+	srv := httptest.NewServer(NewHTTPHandler(eps, stdopentracing.NoopTracer{}, log.NewNopLogger()))
+	defer srv.Close()
+	cli, err := MakeHTTPClientEndpoints(srv.URL, time.Second, stdopentracing.NoopTracer{}, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, want := range map[string]errs.Kind{"": errs.KindInvalid, "other": errs.KindForbidden} {
+		if _, err := cli.GetUser(tenant.WithTenant(context.Background(), id), 1); errs.KindOf(err) != want {
+			t.Errorf("tenant:%q got err:%v want kind:%v", id, err, want)
+		}
+	}
+	if u, err := cli.GetUser(tenant.WithTenant(context.Background(), "acme"), 1); err != nil || u.ID != 1 {
+		t.Errorf("got user:%+v err:%v", u, err)
+	}
+}
+
+// 会话id经sessionToHTTP写入header，server端由sessionToContext还原
+func TestSessionHeader(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+	sessionToHTTP(repository.WithSession(context.Background(), "s1"), req)
+	if got := repository.SessionFromContext(sessionToContext(context.Background(), req)); got != "s1" {
+		t.Errorf("got session:%q", got)
+	}
+	req.Header.Set(sessionHeader, strings.Repeat("x", maxSessionLength+1))
+	if got := repository.SessionFromContext(sessionToContext(context.Background(), req)); got != "" {
+		t.Errorf("too long session should be ignored, got %q", got)
+	}
+}
@@ -0,0 +1,196 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/tracing/opentracing"
+	"github.com/go-kit/kit/transport"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/gorilla/mux"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"gokit_foundation/auth"
+	"gokit_foundation/errs"
+	"gokit_foundation/idempotency"
+	"gokit_foundation/pagination"
+	"gokit_foundation/propagation"
+	"net/http"
+	"strconv"
+	"usersvc/config"
+	endpoint2 "usersvc/pkg/endpoint"
+	"usersvc/pkg/repository"
+)
+
+/*
+HTTP/JSON transport，REST风格的路由
+	POST   /users       {"name": "Jack", "email": "jack@example.com"}  => {"user": {...}, "ret_code": 0}
+	GET    /users/{id}                                                 => {"user": {...}, "ret_code": 0}
+	GET    /users?page_size=20&page_token=...&order_by=name%20desc&name_prefix=J
+	                                                                   => {"users": [...], "next_page_token": "...", "ret_code": 0}
+	PATCH  /users/{id}  {"name": "Rose"}                               => {"user": {...}, "ret_code": 0}
+	DELETE /users/{id}                                                 => {"ret_code": 0}
+与new_addsvc一样，业务错误(如用户不存在)通过ret_code返回(http状态码为200)，
+请求无法解析时返回400，JWT认证失败时返回401，租户缺失或不合法时返回400/403，endpoint层返回的err(系统错误)返回500
+列表接口的分页参数见gokit_foundation/pagination，最后一页没有next_page_token
+带上X-Session-Id header时，同一会话写入后的读取不会读到从库上的旧数据(见repository.Replicas)
+POST /users可以带上Idempotency-Key header，重试时TTL内返回第一次的结果，不会重复创建：
+相同key但body不同时返回422，相同key的请求正在处理时返回409(稍后重试即可)
+*/
+
+func NewHTTPHandler(endpoints endpoint2.UserSvcEndpoints, otTracer stdopentracing.Tracer, logger log.Logger) http.Handler {
+	options := []httptransport.ServerOption{
+		httptransport.ServerErrorEncoder(errorEncoder),
+		httptransport.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
+		// 启用JWT认证时从Authorization header取出bearer token，由endpoint层验证，租户见tenant.Middleware，其他各项见propagation.Fields
+		propagation.HTTPServerBefore(),
+		httptransport.ServerBefore(sessionToContext),
+	}
+	withTrace := func(method string) []httptransport.ServerOption {
+		return append(options, httptransport.ServerBefore(opentracing.HTTPToContext(otTracer, method, logger)))
+	}
+
+	r := mux.NewRouter()
+	r.Methods(http.MethodPost).Path("/users").Handler(httptransport.NewServer(
+		endpoints.CreateUserEndpoint,
+		decodeHTTPCreateUserRequest,
+		encodeHTTPGenericResponse,
+		append(withTrace("CreateUser"), httptransport.ServerBefore(idempotency.HTTPToContext()))...,
+	))
+	r.Methods(http.MethodGet).Path("/users").Handler(httptransport.NewServer(
+		endpoints.ListUsersEndpoint,
+		decodeHTTPListUsersRequest,
+		encodeHTTPGenericResponse,
+		withTrace("ListUsers")...,
+	))
+	r.Methods(http.MethodGet).Path("/users/{id}").Handler(httptransport.NewServer(
+		endpoints.GetUserEndpoint,
+		decodeHTTPGetUserRequest,
+		encodeHTTPGenericResponse,
+		withTrace("GetUser")...,
+	))
+	r.Methods(http.MethodPatch).Path("/users/{id}").Handler(httptransport.NewServer(
+		endpoints.UpdateUserEndpoint,
+		decodeHTTPUpdateUserRequest,
+		encodeHTTPGenericResponse,
+		withTrace("UpdateUser")...,
+	))
+	r.Methods(http.MethodDelete).Path("/users/{id}").Handler(httptransport.NewServer(
+		endpoints.DeleteUserEndpoint,
+		decodeHTTPDeleteUserRequest,
+		encodeHTTPGenericResponse,
+		withTrace("DeleteUser")...,
+	))
+	return r
+}
+
+const (
+	sessionHeader    = "X-Session-Id"
+	maxSessionLength = 128
+)
+
+// 超过最大长度的会话id忽略
+func sessionToContext(ctx context.Context, r *http.Request) context.Context {
+	if id := r.Header.Get(sessionHeader); id != "" && len(id) <= maxSessionLength {
+		return repository.WithSession(ctx, id)
+	}
+	return ctx
+}
+
+// 请求无法解析(body不是合法json，路径中的id不是正整数，或page_size不是整数)
+type errBadRequest struct {
+	error
+}
+
+type errorWrapper struct {
+	Error string `json:"error"`
+}
+
+func errorEncoder(_ context.Context, err error, w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(err2code(err))
+	_ = json.NewEncoder(w).Encode(errorWrapper{Error: err.Error()})
+}
+
+func err2code(err error) int {
+	var e errBadRequest
+	if errors.As(err, &e) {
+		return http.StatusBadRequest
+	}
+	var authErr auth.Error
+	if errors.As(err, &authErr) {
+		return http.StatusUnauthorized
+	}
+	switch {
+	case errors.Is(err, idempotency.ErrKeyReused):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, idempotency.ErrInProgress):
+		return http.StatusConflict
+	}
+	// 租户校验失败等，按-error.map注册的映射，见errs.Mapper
+	var typed *errs.Error
+	if errors.As(err, &typed) {
+		return errs.For(config.SvcName).HTTPStatus(typed)
+	}
+	return http.StatusInternalServerError
+}
+
+func pathID(r *http.Request) (int64, error) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil || id <= 0 {
+		return 0, errBadRequest{errors.New("invalid user id")}
+	}
+	return id, nil
+}
+
+func decodeHTTPCreateUserRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req endpoint2.CreateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, errBadRequest{err}
+	}
+	return &req, nil
+}
+
+func decodeHTTPGetUserRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	id, err := pathID(r)
+	if err != nil {
+		return nil, err
+	}
+	return &endpoint2.GetUserRequest{ID: id}, nil
+}
+
+func decodeHTTPUpdateUserRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	id, err := pathID(r)
+	if err != nil {
+		return nil, err
+	}
+	var req endpoint2.UpdateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, errBadRequest{err}
+	}
+	// 以路径中的id为准
+	req.ID = id
+	return &req, nil
+}
+
+func decodeHTTPDeleteUserRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	id, err := pathID(r)
+	if err != nil {
+		return nil, err
+	}
+	return &endpoint2.DeleteUserRequest{ID: id}, nil
+}
+
+func decodeHTTPListUsersRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	q := r.URL.Query()
+	p, err := pagination.ParamsFromQuery(q)
+	if err != nil {
+		return nil, errBadRequest{err}
+	}
+	return &endpoint2.ListUsersRequest{PageSize: p.PageSize, PageToken: p.PageToken, OrderBy: p.OrderBy, NamePrefix: q.Get("name_prefix")}, nil
+}
+
+func encodeHTTPGenericResponse(_ context.Context, w http.ResponseWriter, response interface{}) error {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	return json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,273 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/go-kit/kit/log"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"gokit_foundation/audit"
+	"gokit_foundation/auth"
+	"gokit_foundation/idempotency"
+	"gokit_foundation/pagination"
+	"gokit_foundation/tenant"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"usersvc/pkg/endpoint"
+	"usersvc/pkg/repository"
+	"usersvc/pkg/service"
+)
+
+// id为1的用户存在，id为500时模拟数据库故障，id为666时panic
+type stubService struct{}
+
+var errDB = errors.New("db down")
+
+func (stubService) CreateUser(_ context.Context, name, email string) (*repository.User, error) {
+	return &repository.User{ID: 1, Name: name, Email: email}, nil
+}
+
+func (stubService) GetUser(_ context.Context, id int64) (*repository.User, error) {
+	switch id {
+	case 1:
+		return &repository.User{ID: 1, Name: "Jack", Email: "jack@a.com"}, nil
+	case 500:
+		return nil, errDB
+	case 666:
+		panic("boom")
+	}
+	return nil, service.ErrUserNotFound
+}
+
+func (s stubService) UpdateUser(ctx context.Context, id int64, name, email *string) (*repository.User, error) {
+	u, err := s.GetUser(ctx, id)
+	if err == nil && name != nil {
+		u.Name = *name
+	}
+	return u, err
+}
+
+func (s stubService) DeleteUser(ctx context.Context, id int64) error {
+	_, err := s.GetUser(ctx, id)
+	return err
+}
+
+// order_by为bad时返回参数错误
+func (s stubService) ListUsers(ctx context.Context, page pagination.Params, namePrefix string) ([]*repository.User, string, error) {
+	if page.OrderBy == "bad" {
+		return nil, "", service.NewError(service.CodeInvalidInput, "invalid order_by: bad")
+	}
+	u, _ := s.GetUser(ctx, 1)
+	return []*repository.User{u}, "next", nil
+}
+
+func TestHTTPHandler(t *testing.T) {
+	eps := endpoint.New(stubService{}, nil, nil, stdopentracing.NoopTracer{}, nil, nil, tenant.Config{}, nil, log.NewNopLogger())
+	srv := httptest.NewServer(NewHTTPHandler(eps, stdopentracing.NoopTracer{}, log.NewNopLogger()))
+	defer srv.Close()
+
+	test := []struct {
+		method, path, body string
+		wantStatus         int
+		wantBody           string
+	}{
+		{"POST", "/users", `{"name":"Jack","email":"jack@a.com"}`, 200, `"id":1,"name":"Jack","email":"jack@a.com"`},
+		{"POST", "/users", `{`, 400, `"error"`},
+		{"GET", "/users/1", "", 200, `"name":"Jack"`},
+		{"GET", "/users/2", "", 200, `"ret_code":1004,"msg":"user not found"`},
+		{"GET", "/users/abc", "", 400, `"error":"invalid user id"`},
+		{"GET", "/users?page_size=1", "", 200, `{"users":[{"id":1,"name":"Jack"`},
+		{"GET", "/users", "", 200, `"next_page_token":"next"`},
+		{"GET", "/users?order_by=bad", "", 200, `"ret_code":1001,"msg":"invalid order_by: bad"`},
+		{"GET", "/users?page_size=ten", "", 400, `"error":"invalid page_size: ten"`},
+		{"GET", "/users/500", "", 500, `"error":"db down"`},
+		// endpoint层recover后与其他系统错误一样返回500
+		{"GET", "/users/666", "", 500, `"error":"panic: boom"`},
+		{"PATCH", "/users/1", `{"name":"Rose"}`, 200, `"name":"Rose"`},
+		{"DELETE", "/users/1", "", 200, `{"ret_code":0}`},
+		{"PUT", "/users/1", "", 405, ""},
+	}
+	for _, tt := range test {
+		req, _ := http.NewRequest(tt.method, srv.URL+tt.path, strings.NewReader(tt.body))
+		rsp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(rsp.Body)
+		rsp.Body.Close()
+		if rsp.StatusCode != tt.wantStatus || !strings.Contains(string(body), tt.wantBody) {
+			t.Errorf("%s %s got status:%d body:%s, want status:%d body contains:%s",
+				tt.method, tt.path, rsp.StatusCode, body, tt.wantStatus, tt.wantBody)
+		}
+	}
+}
+
+func TestHTTPI18n(t *testing.T) {
+	eps := endpoint.New(stubService{}, nil, nil, stdopentracing.NoopTracer{}, nil, nil, tenant.Config{}, nil, log.NewNopLogger())
+	srv := httptest.NewServer(NewHTTPHandler(eps, stdopentracing.NoopTracer{}, log.NewNopLogger()))
+	defer srv.Close()
+
+	test := []struct {
+		path, accept string
+		wantBody     string
+	}{
+		{"/users/2", "zh-CN,en;q=0.8", `"ret_code":1004,"msg":"用户不存在"`},
+		{"/users/2", "en", `"ret_code":1004,"msg":"user not found"`},
+		// 带参数的描述没有翻译，保持原样
+		{"/users?order_by=bad", "zh-CN", `"ret_code":1001,"msg":"invalid order_by: bad"`},
+	}
+	for _, tt := range test {
+		req, _ := http.NewRequest("GET", srv.URL+tt.path, nil)
+		req.Header.Set("Accept-Language", tt.accept)
+		rsp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(rsp.Body)
+		rsp.Body.Close()
+		if !strings.Contains(string(body), tt.wantBody) {
+			t.Errorf("%s accept:%s got body:%s, want body contains:%s", tt.path, tt.accept, body, tt.wantBody)
+		}
+	}
+}
+
+// 每次创建的用户id递增，用于判断是否重复创建
+type countingService struct {
+	stubService
+	creates int64
+}
+
+func (s *countingService) CreateUser(_ context.Context, name, email string) (*repository.User, error) {
+	s.creates++
+	return &repository.User{ID: s.creates, Name: name, Email: email}, nil
+}
+
+func TestCreateUserIdempotency(t *testing.T) {
+	svc := &countingService{}
+	eps := endpoint.New(svc, nil, nil, stdopentracing.NoopTracer{}, idempotency.NewMemStore(10), nil, tenant.Config{}, nil, log.NewNopLogger())
+	srv := httptest.NewServer(NewHTTPHandler(eps, stdopentracing.NoopTracer{}, log.NewNopLogger()))
+	defer srv.Close()
+
+	test := []struct {
+		key, body  string
+		wantStatus int
+		wantBody   string
+	}{
+		{"k1", `{"name":"Jack","email":"jack@a.com"}`, 200, `"id":1,`},
+		{"k1", `{"name":"Jack","email":"jack@a.com"}`, 200, `"id":1,`}, // 重试，重放第一次的结果
+		{"k1", `{"name":"Rose","email":"rose@a.com"}`, 422, `"error"`},
+		{"k2", `{"name":"Jack","email":"jack@a.com"}`, 200, `"id":2,`},
+		{"", `{"name":"Jack","email":"jack@a.com"}`, 200, `"id":3,`}, // 没有key时每次都创建
+	}
+	for _, tt := range test {
+		req, _ := http.NewRequest("POST", srv.URL+"/users", strings.NewReader(tt.body))
+		if tt.key != "" {
+			req.Header.Set(idempotency.Header, tt.key)
+		}
+		rsp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(rsp.Body)
+		rsp.Body.Close()
+		if rsp.StatusCode != tt.wantStatus || !strings.Contains(string(body), tt.wantBody) {
+			t.Errorf("key:%s body:%s got status:%d body:%s, want status:%d body contains:%s",
+				tt.key, tt.body, rsp.StatusCode, body, tt.wantStatus, tt.wantBody)
+		}
+	}
+	if svc.creates != 3 {
+		t.Errorf("got creates:%d", svc.creates)
+	}
+}
+
+func TestHTTPAuth(t *testing.T) {
+	key := []byte("test-key")
+	eps := endpoint.New(stubService{}, nil, nil, stdopentracing.NoopTracer{}, nil, auth.StaticKey(key), tenant.Config{}, nil, log.NewNopLogger())
+	srv := httptest.NewServer(NewHTTPHandler(eps, stdopentracing.NoopTracer{}, log.NewNopLogger()))
+	defer srv.Close()
+
+	sign := func(iss string, key []byte) string {
+		s, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"iss": iss}).SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	test := []struct {
+		name, token string
+		wantStatus  int
+	}{
+		{name: "[no token]", wantStatus: 401},
+		{name: "[valid]", token: sign(endpoint.JWTIssuer, key), wantStatus: 200},
+		{name: "[wrong key]", token: sign(endpoint.JWTIssuer, []byte("other")), wantStatus: 401},
+		{name: "[wrong issuer]", token: sign("addsvc", key), wantStatus: 401},
+	}
+	for _, tt := range test {
+		req, _ := http.NewRequest("GET", srv.URL+"/users/1", nil)
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		rsp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rsp.Body.Close()
+		if rsp.StatusCode != tt.wantStatus {
+			t.Errorf("%s got status:%d want:%d", tt.name, rsp.StatusCode, tt.wantStatus)
+		}
+	}
+}
+
+// 修改类接口记录审计日志，包括业务错误和系统错误，查询接口不记录
+func TestHTTPAudit(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		records []audit.Record
+	)
+	sink := audit.SinkFunc(func(_ context.Context, r *audit.Record) error {
+		mu.Lock()
+		defer mu.Unlock()
+		records = append(records, *r)
+		return nil
+	})
+	eps := endpoint.New(stubService{}, nil, nil, stdopentracing.NoopTracer{}, nil, nil, tenant.Config{}, sink, log.NewNopLogger())
+	srv := httptest.NewServer(NewHTTPHandler(eps, stdopentracing.NoopTracer{}, log.NewNopLogger()))
+	defer srv.Close()
+
+	for _, tt := range []struct{ method, path, body string }{
+		{"POST", "/users", `{"name":"Jack","email":"jack@a.com"}`},
+		{"GET", "/users/1", ""},
+		{"PATCH", "/users/2", `{"name":"Rose"}`},
+		{"DELETE", "/users/500", ""},
+	} {
+		req, _ := http.NewRequest(tt.method, srv.URL+tt.path, strings.NewReader(tt.body))
+		req.Header.Set(tenant.Header, "acme")
+		rsp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rsp.Body.Close()
+	}
+
+	want := []struct{ method, result string }{
+		{"CreateUser", "ok"},
+		{"UpdateUser", "ret_code=1004"},
+		{"DeleteUser", "internal"},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("got records:%+v", records)
+	}
+	for i, w := range want {
+		r := records[i]
+		if r.Method != w.method || r.Result != w.result || r.Tenant != "acme" || len(r.RequestDigest) != 64 {
+			t.Errorf("record %d got:%+v want method:%s result:%s", i, r, w.method, w.result)
+		}
+	}
+	if records[2].Error != "db down" {
+		t.Errorf("got error:%q", records[2].Error)
+	}
+}
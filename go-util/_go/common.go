@@ -2,16 +2,79 @@ package _go
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 )
 
 type Task struct {
-	do    func(context.Context) error
-	clean func(err error)
-	err   error
+	name      string
+	do        func(context.Context) error
+	clean     func(err error)
+	err       error
+	waitReady bool
+	ready     sync.Once
+	readyCh   chan struct{} // 就绪时关闭，用于阶段屏障
+	stage     int
+	started   bool // 未启动(前面的阶段失败)的任务不需要clean
+	restart   *RestartPolicy
+
+	// 以下由TaskGroup.mu保护，见TaskGroup.Tasks
+	state    TaskState
+	since    time.Time
+	lastErr  error // 最近一次失败的err，设置了重启策略时可能还在运行
+	failures int
+}
+
+// TaskState 任务的生命周期：pending => running => stopping(任务组被取消，等待退出) => stopped/failed
+type TaskState string
+
+const (
+	TaskPending  TaskState = "pending" // 未启动，前面阶段的任务失败时一直是pending
+	TaskRunning  TaskState = "running"
+	TaskStopping TaskState = "stopping"
+	TaskStopped  TaskState = "stopped" // do返回nil
+	TaskFailed   TaskState = "failed"  // do返回err或panic(设置了重启策略时为不再重启)
+)
+
+// TaskInfo 任务的状态快照
+type TaskInfo struct {
+	Name     string    `json:"name"`
+	State    TaskState `json:"state"`
+	Since    time.Time `json:"since"`              // 进入当前状态的时间
+	Err      string    `json:"err,omitempty"`      // 最近一次失败的原因
+	Failures int       `json:"failures,omitempty"` // 连续失败的次数，见RestartPolicy
+}
+
+// RestartPolicy 任务失败(返回err或panic)后的重启策略，未设置时任务失败即停止整个任务组
+type RestartPolicy struct {
+	// 连续失败达到MaxFailures次后不再重启，停止整个任务组；<=0时视为1，即不重启
+	MaxFailures int
+	// 第n次重启前等待MinBackoff*2^(n-1)，不超过MaxBackoff；MaxBackoff<=0时不设上限
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// 单次运行超过ResetAfter时，之前的失败不再计入连续失败次数；为0时不重置
+	ResetAfter time.Duration
+	// 每次失败时调用(在重启等待之前)，failures为已连续失败的次数，willRestart表示是否还会重启
+	OnFailure func(err error, failures int, willRestart bool)
+}
+
+func (p *RestartPolicy) backoff(failures int) time.Duration {
+	d := p.MinBackoff
+	for i := 1; i < failures; i++ {
+		d *= 2
+		if p.MaxBackoff > 0 && d >= p.MaxBackoff {
+			break
+		}
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return d
 }
 
 func (tk *Task) Valid() bool {
@@ -19,14 +82,23 @@ func (tk *Task) Valid() bool {
 }
 
 // TaskGroup用于同时在后台启动一组同生命周期的多个任务（保证启动顺序与添加顺序一致），“同生共死”
+// 可以通过Stage将任务分为多个阶段，前一阶段的WaitReady任务全部就绪后才启动下一阶段的任务
 type TaskGroup struct {
 	tasks       []*Task
 	tkBuf       *Task
+	stage       int
 	shareCtx    context.Context
 	cancel      func()
 	canceled    int32
 	wg          sync.WaitGroup
 	isScheduled bool
+
+	// 启动完成(所有任务都进入就绪状态)相关
+	notReady int32
+	isReady  int32
+	onReady  func()
+	mu       sync.Mutex // 保护Task.err和startErr
+	startErr []string   // 启动完成前失败的任务
 }
 
 func NewTaskGroup() *TaskGroup {
@@ -39,37 +111,247 @@ func NewTaskGroup() *TaskGroup {
 }
 
 func (a *TaskGroup) Add(do func(context.Context) error) *TaskGroup {
-	a.tkBuf = &Task{do: do}
+	a.tkBuf = &Task{do: do, readyCh: make(chan struct{}), stage: a.stage}
+	return a
+}
+
+// Name 为上一个Add的任务命名，用于Tasks以及启动失败的err，未命名时为task[i](i为添加顺序)
+func (a *TaskGroup) Name(name string) *TaskGroup {
+	a.tkBuf.name = name
+	return a
+}
+
+// Restart 为上一个Add的任务设置重启策略，用于可以从短暂故障(如consul抖动)中恢复的任务
+// 任务组被取消(ctx结束)后不会再重启
+func (a *TaskGroup) Restart(p RestartPolicy) *TaskGroup {
+	a.tkBuf.restart = &p
 	return a
 }
 
+// Stage 添加一个阶段屏障：之后Add的任务要等之前所有WaitReady的任务就绪后才启动(如服务注册要等server开始监听)
+// 屏障前的任务失败时，之后的任务不会启动，也不会调用它们的clean
+func (a *TaskGroup) Stage() *TaskGroup {
+	a.stage++
+	return a
+}
+
+// WaitReady 标记上一个Add的任务需要在do内调用TaskReady(ctx)才算就绪（如server开始监听、服务注册成功），
+// 未标记的任务启动即就绪。用法：tg.Add(do).WaitReady().Interrupt(clean)
+func (a *TaskGroup) WaitReady() *TaskGroup {
+	a.tkBuf.waitReady = true
+	return a
+}
+
+// OnReady 所有任务都就绪后调用f(只调用一次)，在就绪前有任务失败则不会调用
+func (a *TaskGroup) OnReady(f func()) {
+	a.onReady = f
+}
+
+type readyKey struct{}
+
+// TaskReady 在WaitReady任务的do内调用，通知TaskGroup该任务已就绪
+func TaskReady(ctx context.Context) {
+	if f, ok := ctx.Value(readyKey{}).(func()); ok {
+		f()
+	}
+}
+
+func (a *TaskGroup) taskReady(tk *Task) {
+	tk.ready.Do(func() {
+		close(tk.readyCh)
+		if atomic.AddInt32(&a.notReady, -1) == 0 && atomic.LoadInt32(&a.canceled) == 0 {
+			atomic.StoreInt32(&a.isReady, 1)
+			if a.onReady != nil {
+				a.onReady()
+			}
+		}
+	})
+}
+
+// Err 返回启动完成前失败的任务的错误汇总，启动完成后任务退出(如收到退出信号)不算启动失败
+func (a *TaskGroup) Err() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.startErr) == 0 {
+		return nil
+	}
+	return fmt.Errorf("go-util._go: startup failed, rolled back: %s", strings.Join(a.startErr, "; "))
+}
+
+// Setup 执行添加任务之前的准备步骤(如创建client、打开数据库、加载证书)，代替在准备步骤中PanicIfErr：
+// step返回err(或panic)时记下"setup <name>: err"并取消任务组，之后的Setup不再执行(返回false)，
+// 所有任务都不会启动(也不调用clean)，Run立即返回，Err中可以看到是哪一步失败；调用方在返回false时应停止后续的准备
+func (a *TaskGroup) Setup(name string, step func() error) bool {
+	if a.isScheduled {
+		panic("go-util._go: Setup must be called before Start")
+	}
+	if atomic.LoadInt32(&a.canceled) == 1 {
+		return false
+	}
+	err := runOnce(a.shareCtx, func(context.Context) error { return step() })
+	if err == nil {
+		return true
+	}
+	a.mu.Lock()
+	a.startErr = append(a.startErr, fmt.Sprintf("setup %s: %v", name, err))
+	a.mu.Unlock()
+	// 还没有任务启动，不需要clean
+	atomic.StoreInt32(&a.canceled, 1)
+	a.cancel()
+	return false
+}
+
 func (a *TaskGroup) Interrupt(clean func(err error)) {
 	if clean == nil {
 		clean = func(err error) {}
 	}
 	a.tkBuf.clean = clean
 	if a.tkBuf.Valid() {
+		if a.tkBuf.name == "" {
+			a.tkBuf.name = fmt.Sprintf("task[%d]", len(a.tasks))
+		}
+		a.tkBuf.state, a.tkBuf.since = TaskPending, time.Now()
 		a.tasks = append(a.tasks, a.tkBuf)
 		a.tkBuf = nil
 	}
 }
 
 func (a *TaskGroup) schedule() {
-	for _, f := range a.tasks {
+	for _, tk := range a.tasks {
+		if tk.waitReady {
+			a.notReady++
+		}
+	}
+	// 额外的1表示还在调度中，避免前面的任务就绪时后面的任务还没启动
+	a.notReady++
+	// 有多个阶段时在后台等待屏障，Start不阻塞
+	if len(a.tasks) > 0 && a.tasks[len(a.tasks)-1].stage > 0 {
 		a.wg.Add(1)
+		go func() {
+			defer a.wg.Done()
+			a.scheduleStages()
+		}()
+		return
+	}
+	a.scheduleStages()
+}
+
+func (a *TaskGroup) scheduleStages() {
+	for i, tk := range a.tasks {
+		if i > 0 && tk.stage != a.tasks[i-1].stage && !a.waitStage(a.tasks[i-1].stage) {
+			// 已经有任务失败，后面阶段的任务不再启动
+			return
+		}
+		a.mu.Lock()
+		if atomic.LoadInt32(&a.canceled) == 1 {
+			a.mu.Unlock()
+			return
+		}
+		tk.started = true
+		tk.setState(TaskRunning)
+		a.wg.Add(1)
+		a.mu.Unlock()
 		time.Sleep(time.Millisecond) // Guarantee schedule sequence
-		go func(tk *Task) {
-			defer func() {
-				if err := recover(); err != nil {
-					tk.err = fmt.Errorf("-------------panic: %v", err)
-				}
-				if tk.err != nil {
-					a.cancelAll()
-				}
-				a.wg.Done() // call in last
-			}()
-			tk.err = tk.do(a.shareCtx)
-		}(f)
+		go a.runTask(tk)
+	}
+	a.taskReady(&Task{readyCh: make(chan struct{})})
+}
+
+// 等待stage及之前阶段的WaitReady任务全部就绪，任务组被取消时返回false
+func (a *TaskGroup) waitStage(stage int) bool {
+	for _, tk := range a.tasks {
+		if tk.stage > stage {
+			break
+		}
+		if !tk.waitReady {
+			continue
+		}
+		select {
+		case <-tk.readyCh:
+		case <-a.shareCtx.Done():
+			return false
+		}
+	}
+	return true
+}
+
+func (a *TaskGroup) runTask(tk *Task) {
+	var err error
+	defer func() {
+		a.mu.Lock()
+		tk.err = err
+		if err != nil {
+			tk.lastErr = err
+			tk.setState(TaskFailed)
+			if atomic.LoadInt32(&a.isReady) == 0 {
+				a.startErr = append(a.startErr, fmt.Sprintf("%s: %v", tk.name, err))
+			}
+		} else {
+			tk.setState(TaskStopped)
+		}
+		a.mu.Unlock()
+		if err != nil {
+			a.cancelAll()
+		}
+		a.wg.Done() // call in last
+	}()
+	ctx := a.shareCtx
+	if tk.waitReady {
+		ctx = context.WithValue(ctx, readyKey{}, func() { a.taskReady(tk) })
+	}
+	if tk.restart == nil {
+		err = runOnce(ctx, tk.do)
+		return
+	}
+	err = runWithRestart(ctx, tk.do, tk.restart, func(err error, failures int) {
+		a.mu.Lock()
+		tk.lastErr, tk.failures = err, failures
+		a.mu.Unlock()
+	})
+}
+
+// 调用时需持有TaskGroup.mu
+func (tk *Task) setState(s TaskState) {
+	tk.state, tk.since = s, time.Now()
+}
+
+// 执行一次do，panic转为err
+func runOnce(ctx context.Context, do func(context.Context) error) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("-------------panic: %v", e)
+		}
+	}()
+	return do(ctx)
+}
+
+// 按重启策略执行do，返回nil表示正常退出，返回err表示连续失败次数达到上限，每次失败时调用report
+func runWithRestart(ctx context.Context, do func(context.Context) error, p *RestartPolicy, report func(err error, failures int)) error {
+	failures := 0
+	for {
+		start := time.Now()
+		err := runOnce(ctx, do)
+		// 任务组已取消时的err是退出导致的，不算失败
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+		if p.ResetAfter > 0 && time.Since(start) >= p.ResetAfter {
+			failures = 0
+		}
+		failures++
+		report(err, failures)
+		willRestart := failures < p.MaxFailures
+		if p.OnFailure != nil {
+			p.OnFailure(err, failures, willRestart)
+		}
+		if !willRestart {
+			return fmt.Errorf("%v (failed %d times)", err, failures)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(p.backoff(failures)):
+		}
 	}
 }
 
@@ -94,14 +376,48 @@ func (a *TaskGroup) Run() {
 }
 
 func (a *TaskGroup) cancelAll() {
-	if atomic.LoadInt32(&a.canceled) == 1 {
+	if !atomic.CompareAndSwapInt32(&a.canceled, 0, 1) {
 		return
 	}
-	atomic.CompareAndSwapInt32(&a.canceled, 0, 1)
 	a.cancel()
+	// 此时还在运行的任务err为nil
+	a.mu.Lock()
+	errs := make([]error, len(a.tasks))
+	started := make([]bool, len(a.tasks))
+	for i, tk := range a.tasks {
+		errs[i] = tk.err
+		started[i] = tk.started
+		if tk.state == TaskRunning {
+			tk.setState(TaskStopping)
+		}
+	}
+	a.mu.Unlock()
 	// reverse
 	for i := len(a.tasks) - 1; i >= 0; i-- {
-		tk := a.tasks[i]
-		tk.clean(tk.err)
+		if started[i] {
+			a.tasks[i].clean(errs[i])
+		}
 	}
 }
+
+// Tasks 按添加顺序返回所有任务的状态快照，可以在任意时刻调用(如退出过程中查看哪个任务失败、哪个还没有退出)
+func (a *TaskGroup) Tasks() []TaskInfo {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	infos := make([]TaskInfo, len(a.tasks))
+	for i, tk := range a.tasks {
+		infos[i] = TaskInfo{Name: tk.name, State: tk.state, Since: tk.since, Failures: tk.failures}
+		if tk.lastErr != nil {
+			infos[i].Err = tk.lastErr.Error()
+		}
+	}
+	return infos
+}
+
+// Handler 以JSON返回Tasks，用于管理端口(如/tasks)
+func (a *TaskGroup) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(a.Tasks())
+	})
+}
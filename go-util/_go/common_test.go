@@ -0,0 +1,381 @@
+package _go
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTaskGroupOnReady(t *testing.T) {
+	tg := NewTaskGroup()
+	var ready int32
+	tg.OnReady(func() { atomic.AddInt32(&ready, 1) })
+
+	stop := make(chan struct{})
+	tg.Add(func(ctx context.Context) error {
+		TaskReady(ctx)
+		<-ctx.Done()
+		return nil
+	}).WaitReady().Interrupt(nil)
+	tg.Add(func(ctx context.Context) error {
+		time.Sleep(time.Millisecond * 20)
+		if atomic.LoadInt32(&ready) != 0 {
+			t.Error("OnReady fired before all tasks ready")
+		}
+		TaskReady(ctx)
+		<-stop
+		return errors.New("stop")
+	}).WaitReady().Interrupt(nil)
+
+	tg.Start()
+	time.Sleep(time.Millisecond * 50)
+	if atomic.LoadInt32(&ready) != 1 {
+		t.Errorf("OnReady fired %d times, want 1", ready)
+	}
+	close(stop)
+	tg.Wait()
+	// 就绪后退出不算启动失败
+	if err := tg.Err(); err != nil {
+		t.Errorf("want nil err, got:%v", err)
+	}
+}
+
+func TestTaskGroupRollbackBeforeReady(t *testing.T) {
+	tg := NewTaskGroup()
+	var ready, grpcCleaned int32
+	tg.OnReady(func() { atomic.AddInt32(&ready, 1) })
+
+	// 模拟grpc服务：启动成功并就绪
+	tg.Add(func(ctx context.Context) error {
+		TaskReady(ctx)
+		<-ctx.Done()
+		return nil
+	}).WaitReady().Interrupt(func(err error) {
+		atomic.AddInt32(&grpcCleaned, 1)
+	})
+	// 模拟服务注册：失败
+	tg.Add(func(ctx context.Context) error {
+		return errors.New("consul unreachable")
+	}).WaitReady().Interrupt(nil)
+
+	done := make(chan struct{})
+	go func() {
+		tg.Run()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("TaskGroup not rolled back")
+	}
+
+	if grpcCleaned != 1 {
+		t.Errorf("grpc clean func called %d times, want 1", grpcCleaned)
+	}
+	if ready != 0 {
+		t.Error("OnReady should not fire when startup failed")
+	}
+	err := tg.Err()
+	if err == nil || !strings.Contains(err.Error(), "task[1]: consul unreachable") {
+		t.Errorf("got err:%v", err)
+	}
+}
+
+func TestTaskGroupStage(t *testing.T) {
+	tg := NewTaskGroup()
+	var listening, registered int32
+	stop := make(chan struct{})
+
+	// 模拟grpc服务：20ms后开始监听
+	tg.Add(func(ctx context.Context) error {
+		time.Sleep(time.Millisecond * 20)
+		atomic.StoreInt32(&listening, 1)
+		TaskReady(ctx)
+		<-stop
+		return errors.New("stop")
+	}).WaitReady().Interrupt(nil)
+	// 模拟服务注册：必须在监听之后
+	tg.Stage().Add(func(ctx context.Context) error {
+		if atomic.LoadInt32(&listening) != 1 {
+			t.Error("started before previous stage ready")
+		}
+		atomic.StoreInt32(&registered, 1)
+		<-ctx.Done()
+		return nil
+	}).Interrupt(nil)
+
+	tg.Start()
+	time.Sleep(time.Millisecond * 50)
+	if atomic.LoadInt32(&registered) != 1 {
+		t.Error("task of next stage not started")
+	}
+	close(stop)
+	tg.Wait()
+}
+
+func TestTaskGroupStageRollback(t *testing.T) {
+	tg := NewTaskGroup()
+	var started, cleaned int32
+	tg.Add(func(ctx context.Context) error {
+		return errors.New("listen failed")
+	}).WaitReady().Interrupt(nil)
+	tg.Stage().Add(func(ctx context.Context) error {
+		atomic.AddInt32(&started, 1)
+		return nil
+	}).Interrupt(func(err error) {
+		atomic.AddInt32(&cleaned, 1)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		tg.Run()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("TaskGroup not rolled back")
+	}
+	// 前一阶段失败，后面阶段的任务既不启动也不clean
+	if started != 0 || cleaned != 0 {
+		t.Errorf("got started:%d cleaned:%d, want 0", started, cleaned)
+	}
+	if err := tg.Err(); err == nil || !strings.Contains(err.Error(), "task[0]: listen failed") {
+		t.Errorf("got err:%v", err)
+	}
+}
+
+func TestTaskGroupRestart(t *testing.T) {
+	tg := NewTaskGroup()
+	var runs, fails int32
+	stop := make(chan struct{})
+
+	// 前两次分别返回err和panic，第三次成功并一直运行
+	tg.Add(func(ctx context.Context) error {
+		switch atomic.AddInt32(&runs, 1) {
+		case 1:
+			return errors.New("consul unreachable")
+		case 2:
+			panic("boom")
+		}
+		TaskReady(ctx)
+		<-stop
+		return nil
+	}).WaitReady().Restart(RestartPolicy{
+		MaxFailures: 3,
+		MinBackoff:  time.Millisecond,
+		OnFailure: func(err error, failures int, willRestart bool) {
+			atomic.AddInt32(&fails, 1)
+			if !willRestart {
+				t.Errorf("should restart, failures:%d", failures)
+			}
+		},
+	}).Interrupt(nil)
+
+	var ready int32
+	tg.OnReady(func() { atomic.StoreInt32(&ready, 1) })
+	tg.Start()
+	time.Sleep(time.Millisecond * 50)
+	if r, f := atomic.LoadInt32(&runs), atomic.LoadInt32(&fails); r != 3 || f != 2 || atomic.LoadInt32(&ready) != 1 {
+		t.Errorf("got runs:%d fails:%d ready:%d", r, f, ready)
+	}
+	close(stop)
+	tg.Wait()
+	if err := tg.Err(); err != nil {
+		t.Errorf("want nil err, got:%v", err)
+	}
+}
+
+func TestTaskGroupRestartMaxFailures(t *testing.T) {
+	tg := NewTaskGroup()
+	var runs, cleaned int32
+	tg.Add(func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	}).Interrupt(func(err error) {
+		atomic.AddInt32(&cleaned, 1)
+	})
+	tg.Add(func(ctx context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		return errors.New("consul unreachable")
+	}).WaitReady().Restart(RestartPolicy{MaxFailures: 3, MinBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond}).Interrupt(nil)
+
+	done := make(chan struct{})
+	go func() {
+		tg.Run()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("TaskGroup not stopped after max failures")
+	}
+	if runs != 3 || cleaned != 1 {
+		t.Errorf("got runs:%d cleaned:%d", runs, cleaned)
+	}
+	if err := tg.Err(); err == nil || !strings.Contains(err.Error(), "failed 3 times") {
+		t.Errorf("got err:%v", err)
+	}
+}
+
+func TestRestartPolicyBackoff(t *testing.T) {
+	p := RestartPolicy{MinBackoff: time.Second, MaxBackoff: 5 * time.Second}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, w := range want {
+		if got := p.backoff(i + 1); got != w {
+			t.Errorf("failures:%d got:%v want:%v", i+1, got, w)
+		}
+	}
+}
+
+func TestTaskGroupTasks(t *testing.T) {
+	tg := NewTaskGroup()
+	stop := make(chan struct{})
+	tg.Add(func(ctx context.Context) error {
+		TaskReady(ctx)
+		<-ctx.Done()
+		return nil
+	}).Name("grpcSrv").WaitReady().Interrupt(nil)
+	var runs int32
+	tg.Add(func(ctx context.Context) error {
+		if atomic.AddInt32(&runs, 1) == 1 {
+			return errors.New("consul unreachable")
+		}
+		TaskReady(ctx)
+		<-stop
+		return errors.New("deregistered")
+	}).WaitReady().Restart(RestartPolicy{MaxFailures: 3, MinBackoff: time.Millisecond}).Interrupt(nil)
+	tg.Stage().Add(func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	}).Name("events").Interrupt(nil)
+
+	// 启动前都是pending，没有命名的为task[i]
+	if got := tg.Tasks(); len(got) != 3 || got[0].Name != "grpcSrv" || got[1].Name != "task[1]" || got[2].State != TaskPending {
+		t.Fatalf("got tasks:%+v", got)
+	}
+	ready := make(chan struct{})
+	tg.OnReady(func() { close(ready) })
+	tg.Start()
+	select {
+	case <-ready:
+	case <-time.After(time.Second):
+		t.Fatal("TaskGroup not ready")
+	}
+	got := tg.Tasks()
+	for _, info := range got {
+		if info.State != TaskRunning || info.Since.IsZero() {
+			t.Errorf("got task:%+v", info)
+		}
+	}
+	// 重启过的任务记录最近一次失败
+	if got[1].Err != "consul unreachable" || got[1].Failures != 1 {
+		t.Errorf("got task:%+v", got[1])
+	}
+
+	close(stop)
+	tg.Wait()
+	got = tg.Tasks()
+	if got[0].State != TaskStopped || got[2].State != TaskStopped || got[1].State != TaskFailed || !strings.HasPrefix(got[1].Err, "deregistered") {
+		t.Errorf("got tasks:%+v", got)
+	}
+	rec := httptest.NewRecorder()
+	tg.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/tasks", nil))
+	var infos []TaskInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &infos); err != nil || len(infos) != 3 || infos[1].State != TaskFailed {
+		t.Errorf("got body:%s err:%v", rec.Body, err)
+	}
+}
+
+func TestTaskGroupTasksStopping(t *testing.T) {
+	tg := NewTaskGroup()
+	release := make(chan struct{})
+	tg.Add(func(ctx context.Context) error {
+		<-ctx.Done()
+		<-release // 模拟退出较慢的任务
+		return nil
+	}).Name("slow").Interrupt(nil)
+	tg.Add(func(ctx context.Context) error {
+		return errors.New("listen failed")
+	}).Name("httpSrv").WaitReady().Interrupt(nil)
+	tg.Stage().Add(func(ctx context.Context) error {
+		return nil
+	}).Name("later").Interrupt(nil)
+
+	tg.Start()
+	var got []TaskInfo
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if got = tg.Tasks(); got[0].State == TaskStopping {
+			break
+		}
+	}
+	// 前一阶段失败，后面阶段的任务一直是pending
+	if got[0].State != TaskStopping || got[1].State != TaskFailed || got[1].Err != "listen failed" || got[2].State != TaskPending {
+		t.Errorf("got tasks:%+v", got)
+	}
+	close(release)
+	tg.Wait()
+	if err := tg.Err(); err == nil || !strings.Contains(err.Error(), "httpSrv: listen failed") {
+		t.Errorf("got err:%v", err)
+	}
+}
+
+func TestTaskGroupSetup(t *testing.T) {
+	tg := NewTaskGroup()
+	var started, cleaned int32
+	tg.Add(func(ctx context.Context) error {
+		atomic.AddInt32(&started, 1)
+		<-ctx.Done()
+		return nil
+	}).Interrupt(func(err error) { atomic.AddInt32(&cleaned, 1) })
+
+	if !tg.Setup("config", func() error { return nil }) {
+		t.Fatal("want setup ok")
+	}
+	if tg.Setup("db", func() error { return errors.New("connection refused") }) {
+		t.Fatal("want setup failed")
+	}
+	// 失败之后的步骤不再执行
+	if tg.Setup("cache", func() error { t.Error("setup after failure"); return nil }) {
+		t.Error("want false after failure")
+	}
+	tg.Add(func(ctx context.Context) error {
+		atomic.AddInt32(&started, 1)
+		return nil
+	}).Interrupt(nil)
+
+	done := make(chan struct{})
+	go func() {
+		tg.Run()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run should return immediately after setup failed")
+	}
+	if started != 0 || cleaned != 0 {
+		t.Errorf("tasks started %d, cleaned %d, want 0", started, cleaned)
+	}
+	err := tg.Err()
+	if err == nil || !strings.Contains(err.Error(), "setup db: connection refused") {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestTaskGroupSetupPanic(t *testing.T) {
+	tg := NewTaskGroup()
+	if tg.Setup("tls", func() error { panic("bad cert") }) {
+		t.Fatal("want setup failed")
+	}
+	tg.Run()
+	if err := tg.Err(); err == nil || !strings.Contains(err.Error(), "setup tls") || !strings.Contains(err.Error(), "bad cert") {
+		t.Errorf("got %v", err)
+	}
+}
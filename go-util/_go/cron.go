@@ -0,0 +1,384 @@
+package _go
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-kit/kit/metrics"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+Cron 定时任务，每个job作为TaskGroup的一个任务运行(见AddTo)，与其他任务同生共死：
+-	Spec为cron表达式：5段(分 时 日 月 周)或6段(秒 分 时 日 月 周)，支持 * ? , - /，
+	以及@every <duration>、@hourly、@daily、@weekly、@monthly、@yearly，见ParseCron
+-	Jitter：每次执行前随机等待[0, Jitter)，避免多个实例在同一时刻执行(如同时访问下游)
+-	上一次执行还没有结束时跳过本次(skipped)，不会重叠执行；job返回err或panic只记录，不影响之后的执行和任务组
+-	Leader：多实例部署时只在leader上执行(如gokit_foundation.Leadership.IsLeader)，其他实例跳过(standby)
+-	每个job的执行次数、耗时、最近一次的结果见Status，Handler以JSON返回，用于管理端口(如/cron)
+*/
+
+// CronSchedule 返回t之后的下一次执行时间，没有时返回零值
+type CronSchedule interface {
+	Next(t time.Time) time.Time
+}
+
+// ParseCron 解析cron表达式，日和周都不是*时满足其一即可(与crontab一致)，时间使用Next参数的时区
+func ParseCron(spec string) (CronSchedule, error) {
+	spec = strings.TrimSpace(spec)
+	if strings.HasPrefix(spec, "@every ") {
+		d, err := time.ParseDuration(strings.TrimSpace(spec[len("@every "):]))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("go-util._go: invalid cron spec %q: bad duration", spec)
+		}
+		return everySchedule(d), nil
+	}
+	if s, ok := cronDescriptors[spec]; ok {
+		spec = s
+	}
+	fields := strings.Fields(spec)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, fmt.Errorf("go-util._go: invalid cron spec %q: want 5 or 6 fields", spec)
+	}
+	var s cronSpec
+	var err error
+	for i, b := range cronBounds {
+		if s.fields[i], err = parseCronField(fields[i], b); err != nil {
+			return nil, fmt.Errorf("go-util._go: invalid cron spec %q: %s: %v", spec, b.name, err)
+		}
+	}
+	// 周的7也是周日
+	if s.fields[5]&(1<<7) != 0 {
+		s.fields[5] |= 1
+	}
+	s.domStar, s.dowStar = isCronStar(fields[3]), isCronStar(fields[5])
+	return &s, nil
+}
+
+var cronDescriptors = map[string]string{
+	"@yearly":  "0 0 0 1 1 *",
+	"@monthly": "0 0 0 1 * *",
+	"@weekly":  "0 0 0 * * 0",
+	"@daily":   "0 0 0 * * *",
+	"@hourly":  "0 0 * * * *",
+}
+
+type cronBound struct {
+	name     string
+	min, max int
+}
+
+// 秒 分 时 日 月 周
+var cronBounds = [6]cronBound{{"second", 0, 59}, {"minute", 0, 59}, {"hour", 0, 23}, {"dom", 1, 31}, {"month", 1, 12}, {"dow", 0, 7}}
+
+func isCronStar(f string) bool {
+	return f == "*" || f == "?"
+}
+
+// 返回取值的bitmap，如"1-10/3,20"
+func parseCronField(f string, b cronBound) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(f, ",") {
+		rng, step := part, 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return 0, fmt.Errorf("bad step %q", part)
+			}
+			rng = part[:i]
+		}
+		lo, hi := b.min, b.max
+		switch {
+		case isCronStar(rng):
+		case strings.IndexByte(rng, '-') >= 0:
+			i := strings.IndexByte(rng, '-')
+			var err1, err2 error
+			lo, err1 = strconv.Atoi(rng[:i])
+			hi, err2 = strconv.Atoi(rng[i+1:])
+			if err1 != nil || err2 != nil {
+				return 0, fmt.Errorf("bad range %q", part)
+			}
+		default:
+			v, err := strconv.Atoi(rng)
+			if err != nil {
+				return 0, fmt.Errorf("bad value %q", part)
+			}
+			// 5/10表示从5开始每10个
+			lo, hi = v, v
+			if step > 1 {
+				hi = b.max
+			}
+		}
+		if lo < b.min || hi > b.max || lo > hi {
+			return 0, fmt.Errorf("%q out of range [%d, %d]", part, b.min, b.max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+type cronSpec struct {
+	fields           [6]uint64
+	domStar, dowStar bool
+}
+
+func (s *cronSpec) has(i, v int) bool {
+	return s.fields[i]&(1<<uint(v)) != 0
+}
+
+func (s *cronSpec) dayMatches(t time.Time) bool {
+	dom, dow := s.has(3, t.Day()), s.has(5, int(t.Weekday()))
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// 从t的下一秒开始逐级查找，不匹配的月/日/时/分跳到下一个单位的开头
+func (s *cronSpec) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Second).Add(time.Second)
+	// 最多查找5年(如2月30日永远不会匹配)
+	end := t.AddDate(5, 0, 0)
+	for t.Before(end) {
+		switch {
+		case !s.has(4, int(t.Month())):
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case !s.has(2, t.Hour()):
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case !s.has(1, t.Minute()):
+			t = t.Truncate(time.Minute).Add(time.Minute)
+		case !s.has(0, t.Second()):
+			t = t.Add(time.Second)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+type everySchedule time.Duration
+
+func (e everySchedule) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
+
+type CronJob struct {
+	Name    string
+	Spec    string
+	Jitter  time.Duration // 每次执行前随机等待[0, Jitter)
+	Timeout time.Duration // 单次执行的超时，0表示不限制(任务组退出时ctx仍会结束)
+	Run     func(ctx context.Context) error
+	// 执行返回err或panic时调用，用于打印日志
+	OnFailure func(err error)
+	// 不为nil时每次触发前调用，返回false时跳过本次
+	Leader func() bool
+}
+
+// CronMetrics 为nil的指标不上报
+type CronMetrics struct {
+	Runs     metrics.Counter   // 标签job、result(ok、error、skipped、standby)
+	Duration metrics.Histogram // 标签job，执行耗时(秒)，不包括jitter
+}
+
+// CronStatus job的状态快照
+type CronStatus struct {
+	Name         string    `json:"name"`
+	Spec         string    `json:"spec"`
+	Running      bool      `json:"running"`
+	Next         time.Time `json:"next"`
+	LastStart    time.Time `json:"last_start"`
+	LastDuration string    `json:"last_duration,omitempty"`
+	LastErr      string    `json:"last_err,omitempty"` // 最近一次执行的err，成功时为空
+	Runs         int       `json:"runs"`
+	Failures     int       `json:"failures"`
+	Skipped      int       `json:"skipped"`
+	Standby      int       `json:"standby"` // 不是leader而跳过的次数
+}
+
+type Cron struct {
+	m    CronMetrics
+	mu   sync.Mutex // 保护jobs及其状态
+	jobs []*cronJob
+}
+
+type cronJob struct {
+	CronJob
+	schedule CronSchedule
+	status   CronStatus
+}
+
+func NewCron(m CronMetrics) *Cron {
+	return &Cron{m: m}
+}
+
+// Add 添加job，需要在AddTo之前调用，Spec不合法时返回err
+func (c *Cron) Add(j CronJob) error {
+	if j.Name == "" || j.Run == nil {
+		return errors.New("go-util._go: cron job requires name and run")
+	}
+	schedule, err := ParseCron(j.Spec)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, cj := range c.jobs {
+		if cj.Name == j.Name {
+			return fmt.Errorf("go-util._go: duplicate cron job %s", j.Name)
+		}
+	}
+	c.jobs = append(c.jobs, &cronJob{CronJob: j, schedule: schedule, status: CronStatus{Name: j.Name, Spec: j.Spec}})
+	return nil
+}
+
+// AddTo 每个job添加为tg的一个任务(名为cron:<job>)，任务组退出时等待执行中的job返回
+func (c *Cron) AddTo(tg *TaskGroup) {
+	c.mu.Lock()
+	jobs := append([]*cronJob(nil), c.jobs...)
+	c.mu.Unlock()
+	for _, j := range jobs {
+		j := j
+		tg.Add(func(ctx context.Context) error {
+			c.loop(ctx, j)
+			return nil
+		}).Name("cron:" + j.Name).Interrupt(nil)
+	}
+}
+
+func (c *Cron) loop(ctx context.Context, j *cronJob) {
+	var running sync.WaitGroup
+	defer running.Wait()
+	for {
+		next := j.schedule.Next(time.Now())
+		c.mu.Lock()
+		j.status.Next = next
+		c.mu.Unlock()
+		if next.IsZero() {
+			<-ctx.Done()
+			return
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if j.Leader != nil && !j.Leader() {
+			c.mu.Lock()
+			j.status.Standby++
+			c.mu.Unlock()
+			c.count(j.Name, "standby")
+			continue
+		}
+		c.mu.Lock()
+		if j.status.Running {
+			j.status.Skipped++
+			c.mu.Unlock()
+			c.count(j.Name, "skipped")
+			continue
+		}
+		j.status.Running = true
+		c.mu.Unlock()
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			c.run(ctx, j)
+		}()
+	}
+}
+
+func (c *Cron) run(ctx context.Context, j *cronJob) {
+	if j.Jitter > 0 {
+		select {
+		case <-ctx.Done():
+			// 任务组退出时还没有开始执行，不算一次执行
+			c.mu.Lock()
+			j.status.Running = false
+			c.mu.Unlock()
+			return
+		case <-time.After(time.Duration(rand.Int63n(int64(j.Jitter)))):
+		}
+	}
+	start := time.Now()
+	err := runCronJob(ctx, j.CronJob)
+	d := time.Since(start)
+
+	c.mu.Lock()
+	j.status.Running = false
+	j.status.LastStart, j.status.LastDuration = start, d.String()
+	j.status.Runs++
+	j.status.LastErr = ""
+	if err != nil {
+		j.status.Failures++
+		j.status.LastErr = err.Error()
+	}
+	c.mu.Unlock()
+
+	if c.m.Duration != nil {
+		c.m.Duration.With("job", j.Name).Observe(d.Seconds())
+	}
+	if err != nil {
+		c.count(j.Name, "error")
+		if j.OnFailure != nil {
+			j.OnFailure(err)
+		}
+		return
+	}
+	c.count(j.Name, "ok")
+}
+
+// panic转为err
+func runCronJob(ctx context.Context, j CronJob) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("go-util._go: cron job %s: panic: %v", j.Name, e)
+		}
+	}()
+	if j.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, j.Timeout)
+		defer cancel()
+	}
+	return j.Run(ctx)
+}
+
+func (c *Cron) count(job, result string) {
+	if c.m.Runs != nil {
+		c.m.Runs.With("job", job, "result", result).Add(1)
+	}
+}
+
+// Status 按添加顺序返回所有job的状态快照
+func (c *Cron) Status() []CronStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ss := make([]CronStatus, len(c.jobs))
+	for i, j := range c.jobs {
+		ss[i] = j.status
+	}
+	return ss
+}
+
+// Handler 以JSON返回Status，用于管理端口(如/cron)
+func (c *Cron) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(c.Status())
+	})
+}
@@ -0,0 +1,118 @@
+package _go
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/go-kit/kit/metrics/generic"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	// 2020-10-01是周四
+	from := time.Date(2020, 10, 1, 10, 20, 30, 0, time.UTC)
+	test := []struct {
+		spec string
+		want time.Time
+	}{
+		{"*/2 * * * * ?", time.Date(2020, 10, 1, 10, 20, 32, 0, time.UTC)},
+		{"0 * * * * ?", time.Date(2020, 10, 1, 10, 21, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2020, 10, 1, 10, 30, 0, 0, time.UTC)},
+		{"5/20 9-11 * * *", time.Date(2020, 10, 1, 10, 25, 0, 0, time.UTC)},
+		{"0 3 * * 1,6", time.Date(2020, 10, 3, 3, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2020, 10, 4, 0, 0, 0, 0, time.UTC)},
+		// 日和周都指定时满足其一即可
+		{"0 0 15 * 5", time.Date(2020, 10, 2, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2020, 10, 2, 0, 0, 0, 0, time.UTC)},
+		{"@every 90s", from.Add(90 * time.Second)},
+	}
+	for _, tt := range test {
+		s, err := ParseCron(tt.spec)
+		if err != nil {
+			t.Errorf("spec:%q err:%v", tt.spec, err)
+			continue
+		}
+		if got := s.Next(from); !got.Equal(tt.want) {
+			t.Errorf("spec:%q got:%v want:%v", tt.spec, got, tt.want)
+		}
+	}
+	s, _ := ParseCron("0 0 30 2 *")
+	if got := s.Next(from); !got.IsZero() {
+		t.Errorf("Feb 30 got:%v", got)
+	}
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "x * * * *", "@every -1s", "@weekday"} {
+		if _, err := ParseCron(spec); err == nil {
+			t.Errorf("spec:%q want err", spec)
+		}
+	}
+}
+
+func TestCron(t *testing.T) {
+	c := NewCron(CronMetrics{Runs: generic.NewCounter("runs"), Duration: generic.NewHistogram("duration", 10)})
+	var okRuns, slowRuns, failures int32
+	jobs := []CronJob{
+		{Name: "ok", Spec: "@every 10ms", Run: func(context.Context) error { atomic.AddInt32(&okRuns, 1); return nil }},
+		// 执行时间超过间隔，期间的触发被跳过
+		{Name: "slow", Spec: "@every 10ms", Run: func(ctx context.Context) error {
+			atomic.AddInt32(&slowRuns, 1)
+			select {
+			case <-ctx.Done():
+			case <-time.After(100 * time.Millisecond):
+			}
+			return nil
+		}},
+		{Name: "panic", Spec: "@every 10ms", Jitter: 5 * time.Millisecond, Run: func(context.Context) error { panic("boom") },
+			OnFailure: func(error) { atomic.AddInt32(&failures, 1) }},
+		// 不是leader时不执行
+		{Name: "standby", Spec: "@every 10ms", Leader: func() bool { return false }, Run: func(context.Context) error { panic("never") }},
+	}
+	for _, j := range jobs {
+		if err := c.Add(j); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Add(CronJob{Name: "ok", Spec: "@hourly", Run: jobs[0].Run}); err == nil {
+		t.Error("want err for duplicate job")
+	}
+	if err := c.Add(CronJob{Name: "bad", Spec: "* *", Run: jobs[0].Run}); err == nil {
+		t.Error("want err for bad spec")
+	}
+
+	tg := NewTaskGroup()
+	c.AddTo(tg)
+	tg.Add(func(context.Context) error {
+		time.Sleep(150 * time.Millisecond)
+		return errors.New("stop")
+	}).Interrupt(nil)
+	if got := tg.Tasks(); len(got) != 5 || got[0].Name != "cron:ok" {
+		t.Fatalf("got tasks:%+v", got)
+	}
+	tg.Run()
+
+	ss := c.Status()
+	if ok := ss[0]; ok.Runs < 5 || int32(ok.Runs) != atomic.LoadInt32(&okRuns) || ok.Failures != 0 || ok.Running || ok.Next.IsZero() {
+		t.Errorf("got ok:%+v", ok)
+	}
+	// 不会重叠执行，退出时等待执行中的job返回
+	if slow := ss[1]; slow.Runs != int(atomic.LoadInt32(&slowRuns)) || slow.Runs > 2 || slow.Skipped == 0 || slow.Running {
+		t.Errorf("got slow:%+v", slow)
+	}
+	if p := ss[2]; p.Runs == 0 || p.Failures != p.Runs || p.LastErr == "" || int32(p.Failures) != atomic.LoadInt32(&failures) {
+		t.Errorf("got panic:%+v", p)
+	}
+	if s := ss[3]; s.Runs != 0 || s.Standby == 0 {
+		t.Errorf("got standby:%+v", s)
+	}
+
+	rec := httptest.NewRecorder()
+	c.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/cron", nil))
+	var got []CronStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || len(got) != 4 || got[1].Name != "slow" {
+		t.Errorf("got body:%s err:%v", rec.Body, err)
+	}
+}
@@ -0,0 +1,162 @@
+package _go
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-kit/kit/metrics"
+	"runtime"
+	"runtime/pprof"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+Pool 固定数量worker的执行器，用于CPU密集的接口(如哈希、压缩、图片处理)：
+-	每个请求一个goroutine直接计算时，并发请求越多，每个请求被调度到的时间片越少，所有请求一起变慢，
+	其他接口(包括健康检查)也抢不到CPU；Pool限制同时计算的数量(一般为GOMAXPROCS)，其余请求排队
+-	队列有上限，满时立即返回ErrPoolFull(http为503)，而不是让等待时间无限增长
+-	排队中的请求ctx结束(client断开、超时)时从队列中跳过，不再占用worker
+-	worker的goroutine带上pprof label pool=<name>，CPU profile中可以按pool过滤，据此调整worker和队列的大小
+*/
+
+var (
+	ErrPoolFull   = errors.New("go-util._go: pool queue is full")
+	ErrPoolClosed = errors.New("go-util._go: pool is closed")
+)
+
+// PoolMetrics 为nil的指标不上报
+type PoolMetrics struct {
+	WaitTime    metrics.Histogram // 排队等待的时间(秒)
+	QueueLength metrics.Gauge     // 排队中的任务数
+	Rejected    metrics.Counter   // 因队列已满被拒绝的任务数
+}
+
+type Pool struct {
+	name     string
+	tasks    chan *poolTask
+	m        PoolMetrics
+	capacity int64 // workers+queue
+	admitted int64 // 排队和执行中的任务数
+	queued   int64
+	mu       sync.RWMutex // 保护closed，避免Close后写入tasks
+	closed   bool
+	workers  sync.WaitGroup
+}
+
+type poolTask struct {
+	ctx      context.Context
+	fn       func(ctx context.Context) error
+	enqueued time.Time
+	done     chan error
+}
+
+// NewPool 启动workers个worker(<=0时为GOMAXPROCS)，最多queue个任务排队，name用于pprof label
+func NewPool(name string, workers, queue int, m PoolMetrics) *Pool {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if queue < 0 {
+		queue = 0
+	}
+	capacity := workers + queue
+	p := &Pool{name: name, tasks: make(chan *poolTask, capacity), m: m, capacity: int64(capacity)}
+	labels := pprof.Labels("pool", name)
+	for i := 0; i < workers; i++ {
+		p.workers.Add(1)
+		go pprof.Do(context.Background(), labels, func(context.Context) {
+			defer p.workers.Done()
+			p.work()
+		})
+	}
+	return p
+}
+
+// Do 在worker中执行fn并返回它的err：
+// 队列已满时返回ErrPoolFull，排队或执行中ctx结束时返回ctx.Err()(已开始的fn继续执行完，fn应自行检查ctx)
+func (p *Pool) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	t := &poolTask{ctx: ctx, fn: fn, enqueued: time.Now(), done: make(chan error, 1)}
+	if err := p.enqueue(t); err != nil {
+		return err
+	}
+	select {
+	case err := <-t.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// 按排队和执行中的任务数判断是否已满，不依赖worker是否已经在等待接收(如刚启动时)
+func (p *Pool) enqueue(t *poolTask) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrPoolClosed
+	}
+	if atomic.AddInt64(&p.admitted, 1) > p.capacity {
+		atomic.AddInt64(&p.admitted, -1)
+		if p.m.Rejected != nil {
+			p.m.Rejected.Add(1)
+		}
+		return ErrPoolFull
+	}
+	p.setQueued(1)
+	// 容量为capacity，不会阻塞
+	p.tasks <- t
+	return nil
+}
+
+func (p *Pool) setQueued(delta int64) {
+	n := atomic.AddInt64(&p.queued, delta)
+	if p.m.QueueLength != nil {
+		p.m.QueueLength.Set(float64(n))
+	}
+}
+
+func (p *Pool) work() {
+	for t := range p.tasks {
+		p.setQueued(-1)
+		if err := t.ctx.Err(); err != nil {
+			atomic.AddInt64(&p.admitted, -1)
+			t.done <- err
+			continue
+		}
+		if p.m.WaitTime != nil {
+			p.m.WaitTime.Observe(time.Since(t.enqueued).Seconds())
+		}
+		err := p.run(t)
+		atomic.AddInt64(&p.admitted, -1)
+		t.done <- err
+	}
+}
+
+// panic转为err，不影响worker
+func (p *Pool) run(t *poolTask) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("go-util._go: pool %s: panic: %v", p.name, e)
+		}
+	}()
+	return t.fn(t.ctx)
+}
+
+// Queued 排队中的任务数
+func (p *Pool) Queued() int {
+	return int(atomic.LoadInt64(&p.queued))
+}
+
+// Close 不再接收新任务，等待已排队的任务执行完(ctx已结束的直接跳过)
+func (p *Pool) Close() {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.tasks)
+	}
+	p.mu.Unlock()
+	p.workers.Wait()
+}
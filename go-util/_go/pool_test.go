@@ -0,0 +1,101 @@
+package _go
+
+import (
+	"context"
+	"errors"
+	"github.com/go-kit/kit/metrics/generic"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPoolDo(t *testing.T) {
+	waitTime := generic.NewHistogram("wait", 10)
+	p := NewPool("test", 2, 1, PoolMetrics{WaitTime: waitTime})
+	defer p.Close()
+
+	errFn := errors.New("fn failed")
+	if err := p.Do(context.Background(), func(context.Context) error { return errFn }); err != errFn {
+		t.Errorf("got err:%v want errFn", err)
+	}
+	// panic转为err，worker继续工作
+	if err := p.Do(context.Background(), func(context.Context) error { panic("boom") }); err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("got err:%v want panic", err)
+	}
+	if err := p.Do(context.Background(), func(context.Context) error { return nil }); err != nil {
+		t.Error(err)
+	}
+	if n := waitTime.Quantile(1); n < 0 {
+		t.Errorf("got wait time:%v", n)
+	}
+}
+
+// 2个worker都在执行、队列(1)已满时拒绝
+func TestPoolFull(t *testing.T) {
+	rejected := generic.NewCounter("rejected")
+	queueLen := generic.NewGauge("queue")
+	p := NewPool("test", 2, 1, PoolMetrics{Rejected: rejected, QueueLength: queueLen})
+	block := make(chan struct{})
+	started := make(chan struct{}, 2)
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = p.Do(context.Background(), func(context.Context) error {
+				started <- struct{}{}
+				<-block
+				return nil
+			})
+		}()
+	}
+	<-started
+	<-started
+	for p.Queued() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := p.Do(context.Background(), func(context.Context) error { return nil }); err != ErrPoolFull {
+		t.Errorf("got err:%v want ErrPoolFull", err)
+	}
+	if rejected.Value() != 1 || queueLen.Value() != 1 {
+		t.Errorf("got rejected:%v queue:%v", rejected.Value(), queueLen.Value())
+	}
+	close(block)
+	wg.Wait()
+	p.Close()
+	if err := p.Do(context.Background(), func(context.Context) error { return nil }); err != ErrPoolClosed {
+		t.Errorf("got err:%v want ErrPoolClosed", err)
+	}
+}
+
+// 排队中的任务ctx结束时立即返回，worker跳过它
+func TestPoolCancelQueued(t *testing.T) {
+	p := NewPool("test", 1, 1, PoolMetrics{})
+	defer p.Close()
+	block := make(chan struct{})
+	started := make(chan struct{})
+	go func() {
+		_ = p.Do(context.Background(), func(context.Context) error {
+			close(started)
+			<-block
+			return nil
+		})
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+	ran := false
+	if err := p.Do(ctx, func(context.Context) error { ran = true; return nil }); err != context.DeadlineExceeded {
+		t.Errorf("got err:%v want DeadlineExceeded", err)
+	}
+	close(block)
+	// 被取消的任务在worker取出前仍占用队列
+	for p.Queued() != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := p.Do(context.Background(), func(context.Context) error { return nil }); err != nil || ran {
+		t.Errorf("got err:%v ran:%v", err, ran)
+	}
+}
@@ -2,38 +2,158 @@ package _util
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/go-kit/kit/log"
+	"io"
 	"math/rand"
 	"os"
 	"os/signal"
 	"reflect"
 	"runtime"
+	"runtime/pprof"
 	"strings"
-	"syscall"
 	"time"
 )
 
-func ListenSignalTask(logger log.Logger, onClose func()) (func(context.Context) error, chan os.Signal) {
-	sc := make(chan os.Signal)
-	return func(_ context.Context) error {
+// onReload可选，传入后收到SIGHUP信号不会退出，而是调用onReload(如重新加载配置)
+// 收到退出信号、ctx结束(其他任务退出)或sc被关闭时都会调用onClose并返回，返回前注销信号监听，不会残留goroutine
+// 整个进程只应该调用一次，否则多个监听都会收到同一个信号，其他选项见ListenSignalTaskWithOptions
+func ListenSignalTask(logger log.Logger, onClose func(), onReload ...func()) (func(context.Context) error, chan os.Signal) {
+	opts := SignalOptions{OnClose: onClose}
+	if len(onReload) > 0 {
+		opts.OnReload = func() {
+			for _, f := range onReload {
+				f()
+			}
+		}
+	}
+	return ListenSignalTaskWithOptions(logger, opts)
+}
+
+type SignalOptions struct {
+	OnClose func()
+	// 可选，设置后收到SIGHUP信号不会退出，而是调用OnReload，windows上没有SIGHUP
+	OnReload func()
+	// 收到退出信号后等待多久再调用OnClose，期间正常处理请求：k8s删除pod时发送SIGTERM与从Service的endpoints中摘除是同时进行的，
+	// 立即下线会导致kube-proxy、ingress更新之前转发过来的请求失败，作用与preStop中的sleep相同(镜像中不需要有sleep)，
+	// 它与OnClose中drain的时间之和需要小于terminationGracePeriodSeconds；等待期间再次收到退出信号时立即结束等待
+	PreStopDelay time.Duration
+	// 收到SIGQUIT时写入所有goroutine的堆栈(进程不退出)，为nil时写入os.Stderr，windows上没有SIGQUIT
+	DumpTo io.Writer
+	// 可选，收到SIGUSR2时调用(如启动新进程并交接监听的socket，见gokit_foundation.Upgrader)，windows上没有SIGUSR2
+	// 返回nil表示新进程已接管，任务不等待PreStopDelay，调用OnClose后返回ErrUpgraded；返回err时继续运行
+	OnUpgrade func() error
+	// 可选，收到SIGUSR1时调用(如打印构建和运行时信息，见gokit_foundation/buildinfo.Dump)，进程不退出，windows上没有SIGUSR1
+	OnInfo func()
+}
+
+// 见SignalOptions.OnUpgrade
+var ErrUpgraded = errors.New("go-util._util: upgraded to a new process")
+
+// ListenSignalTaskWithOptions 退出信号：unix为SIGINT、SIGTERM，windows只有os.Interrupt
+// 返回的sc用于测试：关闭后任务与ctx结束时一样调用OnClose并返回nil
+func ListenSignalTaskWithOptions(logger log.Logger, opts SignalOptions) (func(context.Context) error, chan os.Signal) {
+	sc := make(chan os.Signal, 1)
+	return func(ctx context.Context) error {
 		logger.Log("NewTaskGroup", "ListenSignal")
-		signal.Notify(sc,
-			syscall.SIGINT,  // 键盘中断
-			syscall.SIGTERM, // 软件终止
-		)
-		s := <-sc
-		if s != nil {
-			fmt.Fprint(os.Stdout, "\n")
-			//logger.Log("ListenSignalTask", "===================== Closing ======================")
-			logger.Log("ListenSignalTask", fmt.Sprintf("recv-signal=>%s", s))
+		sigCtx, stop := signal.NotifyContext(ctx, exitSignals...)
+		defer stop()
+		// 不退出的信号，不传信号时Notify会监听所有信号
+		var signals []os.Signal
+		if opts.OnReload != nil && reloadSignal != nil {
+			signals = append(signals, reloadSignal)
+		}
+		if dumpSignal != nil {
+			signals = append(signals, dumpSignal)
+		}
+		if opts.OnUpgrade != nil && upgradeSignal != nil {
+			signals = append(signals, upgradeSignal)
+		}
+		if opts.OnInfo != nil && infoSignal != nil {
+			signals = append(signals, infoSignal)
+		}
+		if len(signals) > 0 {
+			signal.Notify(sc, signals...)
+		}
+
+		closed, upgraded := false, false
+	loop:
+		for {
+			select {
+			case <-sigCtx.Done():
+				break loop
+			case s, ok := <-sc:
+				if !ok {
+					closed = true
+					break loop
+				}
+				if s == dumpSignal {
+					logger.Log("ListenSignalTask", fmt.Sprintf("recv-signal=>%s", s), "action", "dump")
+					dumpGoroutines(opts.DumpTo)
+					continue
+				}
+				if s == infoSignal {
+					logger.Log("ListenSignalTask", fmt.Sprintf("recv-signal=>%s", s), "action", "info")
+					opts.OnInfo()
+					continue
+				}
+				if s == upgradeSignal {
+					logger.Log("ListenSignalTask", fmt.Sprintf("recv-signal=>%s", s), "action", "upgrade")
+					if err := opts.OnUpgrade(); err != nil {
+						logger.Log("ListenSignalTask", "upgrade failed, keep running", "err", err)
+						continue
+					}
+					upgraded = true
+					break loop
+				}
+				logger.Log("ListenSignalTask", fmt.Sprintf("recv-signal=>%s", s), "action", "reload")
+				opts.OnReload()
+			}
 		}
 		signal.Stop(sc)
-		onClose()
-		return fmt.Errorf("recv-signal:%v", s)
+
+		if upgraded {
+			// 新进程已经在处理新的请求，不需要等待
+			opts.OnClose()
+			return ErrUpgraded
+		}
+		if closed || ctx.Err() != nil {
+			// ctx结束或sc被关闭，不是收到信号退出
+			opts.OnClose()
+			return nil
+		}
+		// 如"terminated signal received"
+		err := context.Cause(sigCtx)
+		fmt.Fprint(os.Stdout, "\n")
+		logger.Log("ListenSignalTask", "recv-signal", "err", err)
+		if opts.PreStopDelay > 0 {
+			// 先开始新的监听再停止之前的，中间收到的信号不会按默认行为直接杀死进程
+			again, stopAgain := signal.NotifyContext(ctx, exitSignals...)
+			stop()
+			logger.Log("ListenSignalTask", "pre-stop", "delay", opts.PreStopDelay)
+			t := time.NewTimer(opts.PreStopDelay)
+			select {
+			case <-t.C:
+			case <-again.Done():
+				logger.Log("ListenSignalTask", "pre-stop", "skipped", context.Cause(again))
+			}
+			t.Stop()
+			stopAgain()
+		}
+		opts.OnClose()
+		return err
 	}, sc
 }
 
+func dumpGoroutines(w io.Writer) {
+	if w == nil {
+		w = os.Stderr
+	}
+	// 与未捕获SIGQUIT时的输出格式相同
+	_ = pprof.Lookup("goroutine").WriteTo(w, 2)
+}
+
 func InCollection(elem interface{}, coll []interface{}) bool {
 	for _, e := range coll {
 		if e == elem {
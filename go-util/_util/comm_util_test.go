@@ -0,0 +1,207 @@
+//go:build !windows
+// +build !windows
+
+package _util
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/go-kit/kit/log"
+	"os"
+	"os/signal"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestListenSignalTask(t *testing.T) {
+	// 确保SIGHUP在任务注册监听之前发出时不会杀死测试进程
+	guard := make(chan os.Signal, 1)
+	signal.Notify(guard, syscall.SIGHUP)
+	defer signal.Stop(guard)
+
+	baseGoroutines := runtime.NumGoroutine()
+	var reloaded, closed int32
+	tk, _ := ListenSignalTask(log.NewNopLogger(), func() {
+		atomic.AddInt32(&closed, 1)
+	}, func() {
+		atomic.AddInt32(&reloaded, 1)
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- tk(ctx) }()
+
+	time.Sleep(time.Millisecond * 100)
+	_ = syscall.Kill(os.Getpid(), syscall.SIGHUP)
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&reloaded) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("SIGHUP not handled")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	// 一个信号只被处理一次
+	time.Sleep(time.Millisecond * 50)
+	if n := atomic.LoadInt32(&reloaded); n != 1 {
+		t.Errorf("SIGHUP handled %d times, want 1", n)
+	}
+
+	// ctx结束后任务返回，并调用onClose
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("want nil err after ctx done, got:%v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("task not exit after ctx canceled")
+	}
+	if n := atomic.LoadInt32(&closed); n != 1 {
+		t.Errorf("onClose called %d times, want 1", n)
+	}
+
+	deadline = time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > baseGoroutines {
+		if time.Now().After(deadline) {
+			t.Errorf("goroutine leaked, got %d want <= %d", runtime.NumGoroutine(), baseGoroutines)
+			break
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+// SIGQUIT只打印goroutine堆栈，不退出
+func TestListenSignalTaskDump(t *testing.T) {
+	buf := new(bytes.Buffer)
+	tk, _ := ListenSignalTaskWithOptions(log.NewNopLogger(), SignalOptions{OnClose: func() {}, DumpTo: buf})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- tk(ctx) }()
+
+	time.Sleep(time.Millisecond * 100)
+	_ = syscall.Kill(os.Getpid(), syscall.SIGQUIT)
+	time.Sleep(time.Millisecond * 100)
+	select {
+	case err := <-done:
+		t.Fatalf("task exited on SIGQUIT: %v", err)
+	default:
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("want nil err after ctx done, got:%v", err)
+	}
+	if !strings.Contains(buf.String(), "goroutine ") || !strings.Contains(buf.String(), "TestListenSignalTaskDump") {
+		t.Errorf("got dump:%q", buf.String())
+	}
+}
+
+// SIGUSR1调用OnInfo，不退出
+func TestListenSignalTaskInfo(t *testing.T) {
+	var infos int32
+	tk, _ := ListenSignalTaskWithOptions(log.NewNopLogger(), SignalOptions{OnClose: func() {}, OnInfo: func() { atomic.AddInt32(&infos, 1) }})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- tk(ctx) }()
+
+	time.Sleep(time.Millisecond * 100)
+	_ = syscall.Kill(os.Getpid(), syscall.SIGUSR1)
+	_ = syscall.Kill(os.Getpid(), syscall.SIGUSR1)
+	time.Sleep(time.Millisecond * 100)
+	select {
+	case err := <-done:
+		t.Fatalf("task exited on SIGUSR1: %v", err)
+	default:
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("want nil err after ctx done, got:%v", err)
+	}
+	// 信号可能被合并
+	if n := atomic.LoadInt32(&infos); n < 1 || n > 2 {
+		t.Errorf("got %d OnInfo calls", n)
+	}
+}
+
+// 收到退出信号后等待PreStopDelay再调用onClose，再次收到信号时立即结束等待
+func TestListenSignalTaskPreStopDelay(t *testing.T) {
+	// 任务注册监听之前、停止监听之后的SIGTERM不会杀死测试进程
+	guard := make(chan os.Signal, 2)
+	signal.Notify(guard, syscall.SIGTERM)
+	defer signal.Stop(guard)
+
+	for _, again := range []bool{false, true} {
+		var closedAt int64
+		tk, _ := ListenSignalTaskWithOptions(log.NewNopLogger(), SignalOptions{
+			OnClose:      func() { atomic.StoreInt64(&closedAt, time.Now().UnixNano()) },
+			PreStopDelay: time.Millisecond * 300,
+		})
+		done := make(chan error)
+		go func() { done <- tk(context.Background()) }()
+
+		time.Sleep(time.Millisecond * 100)
+		start := time.Now()
+		_ = syscall.Kill(os.Getpid(), syscall.SIGTERM)
+		time.Sleep(time.Millisecond * 100)
+		if atomic.LoadInt64(&closedAt) != 0 {
+			t.Fatal("onClose called before pre-stop delay")
+		}
+		if again {
+			_ = syscall.Kill(os.Getpid(), syscall.SIGTERM)
+		}
+		var err error
+		select {
+		case err = <-done:
+		case <-time.After(time.Second):
+			t.Fatal("task not exit after SIGTERM")
+		}
+		if err == nil || !strings.Contains(err.Error(), "terminated") {
+			t.Errorf("got err:%v", err)
+		}
+		elapsed := time.Duration(atomic.LoadInt64(&closedAt) - start.UnixNano())
+		if again && elapsed >= time.Millisecond*250 || !again && elapsed < time.Millisecond*300 {
+			t.Errorf("again:%v onClose called after %v", again, elapsed)
+		}
+	}
+}
+
+// SIGUSR2调用OnUpgrade，失败时继续运行，成功时不等待PreStopDelay，调用onClose后返回ErrUpgraded
+func TestListenSignalTaskUpgrade(t *testing.T) {
+	var upgrades, closed int32
+	tk, _ := ListenSignalTaskWithOptions(log.NewNopLogger(), SignalOptions{
+		OnClose: func() { atomic.AddInt32(&closed, 1) },
+		OnUpgrade: func() error {
+			if atomic.AddInt32(&upgrades, 1) == 1 {
+				return errors.New("child failed")
+			}
+			return nil
+		},
+		PreStopDelay: time.Second * 10,
+	})
+	done := make(chan error)
+	go func() { done <- tk(context.Background()) }()
+
+	time.Sleep(time.Millisecond * 100)
+	_ = syscall.Kill(os.Getpid(), syscall.SIGUSR2)
+	time.Sleep(time.Millisecond * 100)
+	select {
+	case err := <-done:
+		t.Fatalf("task exited on failed upgrade: %v", err)
+	default:
+	}
+	_ = syscall.Kill(os.Getpid(), syscall.SIGUSR2)
+	select {
+	case err := <-done:
+		if err != ErrUpgraded {
+			t.Errorf("got err:%v want ErrUpgraded", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("task not exit after upgrade")
+	}
+	if atomic.LoadInt32(&upgrades) != 2 || atomic.LoadInt32(&closed) != 1 {
+		t.Errorf("got upgrades:%d closed:%d", upgrades, closed)
+	}
+}
@@ -0,0 +1,22 @@
+//go:build !windows
+// +build !windows
+
+package _util
+
+import (
+	"os"
+	"syscall"
+)
+
+var (
+	// 键盘中断、软件终止(docker stop、k8s删除pod)
+	exitSignals = []os.Signal{syscall.SIGINT, syscall.SIGTERM}
+	// 终端挂起，一般用于通知进程重新加载配置
+	reloadSignal os.Signal = syscall.SIGHUP
+	// Ctrl+\，默认行为是打印goroutine堆栈后退出，这里只打印不退出
+	dumpSignal os.Signal = syscall.SIGQUIT
+	// 平滑升级：启动新进程并交接监听的socket
+	upgradeSignal os.Signal = syscall.SIGUSR2
+	// 打印构建、运行时信息等，用于排查问题
+	infoSignal os.Signal = syscall.SIGUSR1
+)
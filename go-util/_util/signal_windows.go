@@ -0,0 +1,12 @@
+package _util
+
+import "os"
+
+// windows只能收到os.Interrupt(Ctrl+C/Ctrl+Break)，没有SIGHUP、SIGQUIT、SIGUSR1、SIGUSR2
+var (
+	exitSignals   = []os.Signal{os.Interrupt}
+	reloadSignal  os.Signal
+	dumpSignal    os.Signal
+	upgradeSignal os.Signal
+	infoSignal    os.Signal
+)
@@ -3,6 +3,6 @@ module go-util
 go 1.12
 
 require (
-	github.com/go-kit/kit v0.10.0 // indirect
+	github.com/go-kit/kit v0.10.0
 	gorm.io/gorm v1.20.6 // indirect
 )
@@ -0,0 +1,122 @@
+package gokit_foundation
+
+import (
+	"context"
+	"github.com/go-kit/kit/log"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"io"
+	"net/http"
+	"time"
+)
+
+/*
+transport层的访问日志，每个调用输出一行kv日志，字段为：
+	grpc: rpc(完整方法名) peer req_bytes resp_bytes code latency err
+	http: method path peer req_bytes resp_bytes status latency
+与service层的日志中间件相比，decode失败、被限速等没有到达service的调用同样会被记录
+日志通过LoggerWithContext输出，会带上request_id等ctx字段；rpc/path字段可用于日志采样(见LogSampling)
+*/
+
+// AccessLogUnaryInterceptor 放在RecoveryUnaryInterceptor之内，panic的调用也会被记录(code=Internal)
+func AccessLogUnaryInterceptor(logger log.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		begin := time.Now()
+		rsp, err := handler(ctx, req)
+		LoggerWithContext(logger, ctx).Log(
+			"rpc", info.FullMethod,
+			"peer", peerAddr(ctx),
+			"req_bytes", protoSize(req),
+			"resp_bytes", protoSize(rsp),
+			"code", status.Code(err).String(),
+			"latency", time.Since(begin),
+			"err", err,
+		)
+		return rsp, err
+	}
+}
+
+func peerAddr(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return p.Addr.String()
+	}
+	return ""
+}
+
+// 编码后的大小，不是proto消息(如rsp为nil)时为0
+func protoSize(v interface{}) int {
+	if m, ok := v.(proto.Message); ok && m != nil {
+		return proto.Size(m)
+	}
+	return 0
+}
+
+// 记录status和写入的字节数
+type accessLogWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (w *accessLogWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *accessLogWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+	return n, err
+}
+
+// 记录handler读取的请求body字节数，chunked请求没有Content-Length
+type countingBody struct {
+	io.ReadCloser
+	bytes int
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.bytes += n
+	return n, err
+}
+
+// AccessLogHandler 创建一个访问日志mw，安装在mux外层，skipPaths中的路径不记录(如prometheus定时拉取的/metrics)
+// req_bytes为handler实际读取的body字节数
+func AccessLogHandler(logger log.Logger, skipPaths ...string) func(http.Handler) http.Handler {
+	skip := make(map[string]bool, len(skipPaths))
+	for _, p := range skipPaths {
+		skip[p] = true
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if skip[r.URL.Path] {
+				next.ServeHTTP(w, r)
+				return
+			}
+			begin := time.Now()
+			body := &countingBody{ReadCloser: r.Body}
+			r.Body = body
+			aw := &accessLogWriter{ResponseWriter: w}
+			next.ServeHTTP(aw, r)
+			if aw.status == 0 {
+				aw.status = http.StatusOK
+			}
+			LoggerWithContext(logger, r.Context()).Log(
+				"access", "http",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"peer", r.RemoteAddr,
+				"req_bytes", body.bytes,
+				"resp_bytes", aw.bytes,
+				"status", aw.status,
+				"latency", time.Since(begin),
+			)
+		})
+	}
+}
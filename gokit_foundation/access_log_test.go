@@ -0,0 +1,88 @@
+package gokit_foundation
+
+import (
+	"bytes"
+	"context"
+	"github.com/go-kit/kit/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAccessLogUnaryInterceptor(t *testing.T) {
+	buf := &bytes.Buffer{}
+	interceptor := AccessLogUnaryInterceptor(log.NewLogfmtLogger(buf))
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 5000}})
+	info := &grpc.UnaryServerInfo{FullMethod: "/grpc.health.v1.Health/Check"}
+	req := &grpc_health_v1.HealthCheckRequest{Service: "addsvc"}
+
+	_, _ = interceptor(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return &grpc_health_v1.HealthCheckResponse{Status: grpc_health_v1.HealthCheckResponse_SERVING}, nil
+	})
+	for _, want := range []string{"rpc=/grpc.health.v1.Health/Check", "peer=10.0.0.1:5000", "req_bytes=8", "resp_bytes=2", "code=OK", "latency="} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("log:%s want contain:%s", buf.String(), want)
+		}
+	}
+
+	buf.Reset()
+	_, _ = interceptor(context.Background(), req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.Unavailable, "down")
+	})
+	for _, want := range []string{`peer= `, "resp_bytes=0", "code=Unavailable", "err="} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("log:%s want contain:%s", buf.String(), want)
+		}
+	}
+}
+
+func TestAccessLogHandler(t *testing.T) {
+	buf := &bytes.Buffer{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("metrics"))
+	})
+	mux.HandleFunc("/teapot", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("tea"))
+	})
+	h := AccessLogHandler(log.NewLogfmtLogger(buf), "/metrics")(mux)
+
+	test := []struct {
+		path    string
+		body    string
+		wantLog []string
+	}{
+		{path: "/teapot", body: "hello", wantLog: []string{"method=POST", "path=/teapot", "peer=", "req_bytes=5", "resp_bytes=3", "status=418", "latency="}},
+		{path: "/not_found", wantLog: []string{"path=/not_found", "req_bytes=0", "status=404"}},
+		{path: "/metrics"},
+	}
+	for _, tt := range test {
+		buf.Reset()
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body)))
+		line := buf.String()
+		if len(tt.wantLog) == 0 {
+			if line != "" {
+				t.Errorf("path:%s should be skipped, got log:%s", tt.path, line)
+			}
+			continue
+		}
+		if strings.Count(line, "\n") != 1 {
+			t.Errorf("path:%s want one log line, got:%q", tt.path, line)
+		}
+		for _, want := range tt.wantLog {
+			if !strings.Contains(line, want) {
+				t.Errorf("path:%s log:%s want contain:%s", tt.path, line, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package gokit_foundation
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"gokit_foundation/buildinfo"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+)
+
+/*
+管理用的http服务，与业务接口分开监听，只应对内网开放(如listen在127.0.0.1或不对外暴露的端口)：
+-	/debug/pprof/		runtime profiling(见net/http/pprof)
+-	/debug/vars			expvar，包括memstats、cmdline以及goroutines、uptime_seconds
+-	/debug/runtime		goroutine数、堆内存、GC次数和暂停时间等
+-	/loglevel			查看/修改日志级别(见LogLevelHandler)
+-	/version			构建信息(见buildinfo.Get)
+-	/quitquitquit		POST触发优雅退出，与收到SIGTERM的效果相同(见ShutdownBySignal)
+-	/					列出所有管理接口
+各服务可通过Handle添加自己的管理接口，如new_addsvc的/chaos、/ratelimit
+*/
+
+var (
+	processStart  = time.Now()
+	publishExpvar sync.Once
+)
+
+type AdminServer struct {
+	mux      *http.ServeMux
+	paths    []string
+	shutdown func()
+	srv      *HTTPServer
+}
+
+// shutdown为/quitquitquit调用的函数，为nil时使用ShutdownBySignal
+func NewAdminServer(shutdown func()) *AdminServer {
+	if shutdown == nil {
+		shutdown = ShutdownBySignal
+	}
+	publishExpvar.Do(func() {
+		expvar.Publish("goroutines", expvar.Func(func() interface{} { return runtime.NumGoroutine() }))
+		expvar.Publish("uptime_seconds", expvar.Func(func() interface{} { return int64(time.Since(processStart).Seconds()) }))
+	})
+	s := &AdminServer{mux: http.NewServeMux(), shutdown: shutdown}
+	// /debug/pprof/profile、trace默认采集30s，不限制写超时
+	conf := DefaultHTTPServerConfig()
+	conf.WriteTimeout = 0
+	s.srv = NewHTTPServer(s.mux, conf)
+	s.mux.HandleFunc("/", s.index)
+	s.Handle("/debug/pprof/", http.HandlerFunc(pprof.Index))
+	s.Handle("/debug/pprof/cmdline", http.HandlerFunc(pprof.Cmdline))
+	s.Handle("/debug/pprof/profile", http.HandlerFunc(pprof.Profile))
+	s.Handle("/debug/pprof/symbol", http.HandlerFunc(pprof.Symbol))
+	s.Handle("/debug/pprof/trace", http.HandlerFunc(pprof.Trace))
+	s.Handle("/debug/vars", expvar.Handler())
+	s.Handle("/debug/runtime", http.HandlerFunc(runtimeStatsHandler))
+	s.Handle("/loglevel", LogLevelHandler())
+	s.Handle("/version", buildinfo.Handler())
+	s.Handle("/quitquitquit", http.HandlerFunc(s.quit))
+	return s
+}
+
+// Handle 添加管理接口，需要在Serve之前调用
+func (s *AdminServer) Handle(pattern string, h http.Handler) {
+	s.mux.Handle(pattern, h)
+	s.paths = append(s.paths, pattern)
+}
+
+func (s *AdminServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Serve 阻塞直到Shutdown，Shutdown后返回nil
+func (s *AdminServer) Serve(lis net.Listener) error {
+	if err := s.srv.Serve(lis); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+func (s *AdminServer) ListenAndServe(addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(lis)
+}
+
+func (s *AdminServer) Shutdown(ctx context.Context) error {
+	return s.srv.Shutdown(ctx)
+}
+
+func (s *AdminServer) index(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	paths := append([]string(nil), s.paths...)
+	sort.Strings(paths)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, p := range paths {
+		fmt.Fprintln(w, p)
+	}
+}
+
+// 先返回响应再触发退出，退出过程中管理端口可能先于业务端口关闭
+func (s *AdminServer) quit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	fmt.Fprintln(w, "shutting down")
+	go s.shutdown()
+}
+
+// ShutdownBySignal 向当前进程发送SIGTERM，由各服务已有的信号处理完成优雅退出(下线、drain、停止服务等)
+func ShutdownBySignal() {
+	if p, err := os.FindProcess(os.Getpid()); err == nil {
+		_ = p.Signal(syscall.SIGTERM)
+	}
+}
+
+type RuntimeStats struct {
+	GoVersion    string    `json:"go_version"`
+	Uptime       string    `json:"uptime"`
+	NumCPU       int       `json:"num_cpu"`
+	GOMAXPROCS   int       `json:"gomaxprocs"`
+	Goroutines   int       `json:"goroutines"`
+	HeapAlloc    uint64    `json:"heap_alloc_bytes"`
+	HeapSys      uint64    `json:"heap_sys_bytes"`
+	HeapObjects  uint64    `json:"heap_objects"`
+	NumGC        uint32    `json:"num_gc"`
+	LastGC       time.Time `json:"last_gc"`
+	LastGCPause  string    `json:"last_gc_pause"`
+	GCPauseTotal string    `json:"gc_pause_total"`
+}
+
+// ReadRuntimeStats ReadMemStats会短暂stop the world，不要频繁调用
+func ReadRuntimeStats() RuntimeStats {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	st := RuntimeStats{
+		GoVersion:    runtime.Version(),
+		Uptime:       time.Since(processStart).Truncate(time.Second).String(),
+		NumCPU:       runtime.NumCPU(),
+		GOMAXPROCS:   runtime.GOMAXPROCS(0),
+		Goroutines:   runtime.NumGoroutine(),
+		HeapAlloc:    ms.HeapAlloc,
+		HeapSys:      ms.HeapSys,
+		HeapObjects:  ms.HeapObjects,
+		NumGC:        ms.NumGC,
+		GCPauseTotal: time.Duration(ms.PauseTotalNs).String(),
+	}
+	if ms.NumGC > 0 {
+		st.LastGC = time.Unix(0, int64(ms.LastGC))
+		st.LastGCPause = time.Duration(ms.PauseNs[(ms.NumGC+255)%256]).String()
+	}
+	return st
+}
+
+func runtimeStatsHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(ReadRuntimeStats())
+}
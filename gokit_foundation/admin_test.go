@@ -0,0 +1,85 @@
+package gokit_foundation
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdminServer(t *testing.T) {
+	quit := make(chan struct{}, 1)
+	s := NewAdminServer(func() { quit <- struct{}{} })
+	s.Handle("/custom", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("custom"))
+	}))
+	do := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	for _, path := range []string{"/debug/pprof/", "/debug/pprof/heap", "/debug/vars", "/debug/runtime", "/loglevel", "/version", "/custom"} {
+		if w := do(http.MethodGet, path); w.Code != http.StatusOK {
+			t.Errorf("path:%s got status:%d", path, w.Code)
+		}
+	}
+	if w := do(http.MethodGet, "/"); !strings.Contains(w.Body.String(), "/custom\n") || !strings.Contains(w.Body.String(), "/quitquitquit\n") {
+		t.Errorf("index got:%s", w.Body.String())
+	}
+	if w := do(http.MethodGet, "/not_found"); w.Code != http.StatusNotFound {
+		t.Errorf("/not_found got status:%d", w.Code)
+	}
+	if w := do(http.MethodGet, "/debug/vars"); !strings.Contains(w.Body.String(), `"goroutines"`) {
+		t.Errorf("/debug/vars got:%s", w.Body.String())
+	}
+
+	var st RuntimeStats
+	if err := json.NewDecoder(do(http.MethodGet, "/debug/runtime").Body).Decode(&st); err != nil || st.Goroutines == 0 || st.GoVersion == "" {
+		t.Errorf("/debug/runtime got:%+v err:%v", st, err)
+	}
+
+	if w := do(http.MethodGet, "/quitquitquit"); w.Code != http.StatusMethodNotAllowed || len(quit) != 0 {
+		t.Errorf("GET /quitquitquit got status:%d", w.Code)
+	}
+	if w := do(http.MethodPost, "/quitquitquit"); w.Code != http.StatusOK {
+		t.Errorf("POST /quitquitquit got status:%d", w.Code)
+	}
+	select {
+	case <-quit:
+	case <-time.After(time.Second):
+		t.Error("shutdown not called")
+	}
+}
+
+func TestAdminServerServe(t *testing.T) {
+	s := NewAdminServer(func() {})
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	errc := make(chan error, 1)
+	go func() { errc <- s.Serve(lis) }()
+
+	rsp, err := http.Get("http://" + lis.Addr().String() + "/loglevel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(rsp.Body)
+	rsp.Body.Close()
+	if !strings.Contains(string(body), `"level"`) {
+		t.Errorf("got:%s", body)
+	}
+
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errc; err != nil {
+		t.Errorf("Serve got err:%v after Shutdown", err)
+	}
+}
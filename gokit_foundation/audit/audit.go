@@ -0,0 +1,154 @@
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"github.com/uber/jaeger-client-go"
+	"go.opentelemetry.io/otel/api/trace"
+	"gokit_foundation"
+	"gokit_foundation/auth"
+	"gokit_foundation/clock"
+	"gokit_foundation/errs"
+	"gokit_foundation/reqid"
+	"gokit_foundation/tenant"
+	"time"
+)
+
+/*
+修改类接口(如usersvc的CreateUser、UpdateUser、DeleteUser)的审计日志，记录谁在什么时候做了什么、结果如何：
+-	Middleware在接口返回后写入一条Record：调用方(JWT的sub)、租户、接口、请求的摘要(JSON的sha256，不记录请求内容本身)、
+	结果、request id和trace id
+-	Sink只追加写入，内置：FileSink(一行一条JSON)、EventsSink(如Kafka，见events.Sink)，
+	数据库见usersvc的repository.NewPostgresAuditSink
+-	防篡改(可选)：Chain将每条记录的hash与上一条串联(见Hash)，修改、删除或插入任何一条都会使之后的校验失败(见Verify)
+写入失败不影响接口的返回，只记录error日志；需要保证不丢失时使用与业务数据同一个事务写入的Sink
+*/
+
+type Record struct {
+	Chain     string    `json:"chain,omitempty"` // 见NewChain，不使用Chain时为空
+	Time      time.Time `json:"time"`
+	Principal string    `json:"principal"` // 未认证时为空
+	Tenant    string    `json:"tenant,omitempty"`
+	Method    string    `json:"method"`
+	// 请求JSON的sha256(十六进制)，可以与调用方保存的请求比对，日志中不会出现请求内容(如邮箱)
+	RequestDigest string `json:"request_digest"`
+	Result        string `json:"result"` // 见Config.Result
+	Error         string `json:"error,omitempty"`
+	RequestID     string `json:"request_id,omitempty"`
+	TraceID       string `json:"trace_id,omitempty"`
+	// 由Chain填写
+	PrevHash string `json:"prev_hash,omitempty"`
+	Hash     string `json:"hash,omitempty"`
+}
+
+// Sink 只追加写入，并发安全
+type Sink interface {
+	Write(ctx context.Context, r *Record) error
+}
+
+type SinkFunc func(ctx context.Context, r *Record) error
+
+func (f SinkFunc) Write(ctx context.Context, r *Record) error {
+	return f(ctx, r)
+}
+
+type Config struct {
+	Sink Sink
+	// 写入失败时记录error日志，为nil时不记录
+	Logger log.Logger
+	// 为nil时使用clock.Real
+	Clock clock.Clock
+	// 根据response和err得到Result，为nil时err为nil是ok，否则为err的分类(见errs.Kind)；
+	// 业务错误放在response中(如RetCode)时需要自己提供
+	Result func(response interface{}, err error) string
+}
+
+// DefaultResult err为nil时为ok，否则为errs.KindOf(err)的名字
+func DefaultResult(_ interface{}, err error) string {
+	if err == nil {
+		return "ok"
+	}
+	return errs.KindOf(err).String()
+}
+
+// Middleware 安装在认证和租户mw内层，method为接口名
+func Middleware(conf Config, method string) endpoint.Middleware {
+	if conf.Sink == nil {
+		panic("audit: Config.Sink is nil")
+	}
+	logger := conf.Logger
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	clk := clock.OrReal(conf.Clock)
+	result := conf.Result
+	if result == nil {
+		result = DefaultResult
+	}
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			r := &Record{
+				// 数据库(如PostgreSQL的TIMESTAMPTZ)只保存到微秒，读出后hash不变
+				Time:          clk.Now().UTC().Truncate(time.Microsecond),
+				Tenant:        tenant.FromContext(ctx),
+				Method:        method,
+				RequestDigest: Digest(request),
+				RequestID:     reqid.FromContext(ctx),
+				TraceID:       TraceID(ctx),
+			}
+			if claims, ok := auth.ClaimsFromContext(ctx); ok {
+				r.Principal, _ = claims["sub"].(string)
+			}
+			response, err := next(ctx, request)
+			r.Result = result(response, err)
+			if err != nil {
+				r.Error = err.Error()
+			}
+			// 接口返回后ctx可能已经取消(如client断开)，审计记录仍需写入
+			if werr := conf.Sink.Write(withoutCancel{ctx}, r); werr != nil {
+				level.Error(gokit_foundation.LoggerWithContext(logger, ctx)).Log("audit", method, "principal", r.Principal,
+					"request_digest", r.RequestDigest, "err", werr)
+			}
+			return response, err
+		}
+	}
+}
+
+// Digest request的JSON的sha256，编码失败时为空
+func Digest(request interface{}) string {
+	b, err := json.Marshal(request)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// TraceID 依次从OpenTelemetry、opentracing(jaeger)的span以及ctx中的gokit_foundation.CtxKeyTraceID中获取，都没有时为空
+func TraceID(ctx context.Context) string {
+	if sc := trace.SpanFromContext(ctx).SpanContext(); sc.IsValid() {
+		return sc.TraceID.String()
+	}
+	if span := stdopentracing.SpanFromContext(ctx); span != nil {
+		if sc, ok := span.Context().(jaeger.SpanContext); ok && sc.IsValid() {
+			return sc.TraceID().String()
+		}
+	}
+	id, _ := ctx.Value(gokit_foundation.CtxKeyTraceID).(string)
+	return id
+}
+
+// 保留ctx中的值，去掉取消和截止时间
+type withoutCancel struct {
+	context.Context
+}
+
+func (withoutCancel) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (withoutCancel) Done() <-chan struct{}       { return nil }
+func (withoutCancel) Err() error                  { return nil }
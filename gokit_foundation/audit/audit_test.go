@@ -0,0 +1,209 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/dgrijalva/jwt-go"
+	kitjwt "github.com/go-kit/kit/auth/jwt"
+	"github.com/go-kit/kit/log"
+	"gokit_foundation/clock"
+	"gokit_foundation/errs"
+	"gokit_foundation/events"
+	"gokit_foundation/reqid"
+	"gokit_foundation/tenant"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type memSink struct {
+	mu      sync.Mutex
+	records []Record
+	err     error
+}
+
+func (s *memSink) Write(ctx context.Context, r *Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if s.err != nil {
+		return s.err
+	}
+	s.records = append(s.records, *r)
+	return nil
+}
+
+type createReq struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+func TestMiddleware(t *testing.T) {
+	sink := &memSink{}
+	now := time.Date(2020, 10, 1, 8, 0, 0, 123456789, time.FixedZone("CST", 8*3600))
+	buf := &bytes.Buffer{}
+	mw := Middleware(Config{Sink: sink, Clock: clock.NewFake(now), Logger: log.NewLogfmtLogger(buf)}, "CreateUser")
+	errDup := errs.Invalid("duplicate email")
+	ep := mw(func(ctx context.Context, request interface{}) (interface{}, error) {
+		if request.(createReq).Email == "dup@example.com" {
+			return nil, errDup
+		}
+		return "ok", nil
+	})
+
+	ctx := context.WithValue(context.Background(), kitjwt.JWTClaimsContextKey, jwt.MapClaims{"sub": "jack"})
+	ctx = reqid.WithRequestID(tenant.WithTenant(ctx, "acme"), "req-1")
+	// 接口返回时ctx已经取消，审计记录仍然写入
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	req := createReq{Name: "rose", Email: "rose@example.com"}
+	if rsp, err := ep(ctx, req); rsp != "ok" || err != nil {
+		t.Fatalf("got rsp:%v err:%v", rsp, err)
+	}
+	if _, err := ep(context.Background(), createReq{Email: "dup@example.com"}); err != errDup {
+		t.Fatalf("got err:%v", err)
+	}
+
+	if len(sink.records) != 2 {
+		t.Fatalf("got records:%+v", sink.records)
+	}
+	r := sink.records[0]
+	want := Record{Time: time.Date(2020, 10, 1, 0, 0, 0, 123456000, time.UTC), Principal: "jack", Tenant: "acme", Method: "CreateUser",
+		RequestDigest: Digest(req), Result: "ok", RequestID: "req-1"}
+	if r != want {
+		t.Errorf("got record:%+v\nwant:%+v", r, want)
+	}
+	// 摘要中不包含请求内容
+	if len(r.RequestDigest) != 64 || strings.Contains(r.RequestDigest, "rose") {
+		t.Errorf("got digest:%s", r.RequestDigest)
+	}
+	if r := sink.records[1]; r.Principal != "" || r.Result != "invalid" || r.Error != "duplicate email" {
+		t.Errorf("got record:%+v", r)
+	}
+
+	// 写入失败不影响接口
+	sink.err = errors.New("disk full")
+	if rsp, err := ep(context.Background(), req); rsp != "ok" || err != nil {
+		t.Errorf("got rsp:%v err:%v", rsp, err)
+	}
+	if !strings.Contains(buf.String(), "disk full") {
+		t.Errorf("got log:%s", buf.String())
+	}
+}
+
+func TestChain(t *testing.T) {
+	sink := &memSink{}
+	a, b := NewChain("a", sink, ""), NewChain("b", sink, "")
+	for i := 0; i < 3; i++ {
+		for _, c := range []*Chain{a, b} {
+			if err := c.Write(context.Background(), &Record{Method: "UpdateUser", Result: "ok"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	records := sink.records
+	if err := Verify(records); err != nil {
+		t.Fatal(err)
+	}
+	if records[0].PrevHash != "" || records[2].PrevHash != records[0].Hash || records[3].Chain != "b" {
+		t.Errorf("got records:%+v", records)
+	}
+
+	// 重启后从最后一条继续
+	c := NewChain("a", sink, LastHash(records, "a"))
+	_ = c.Write(context.Background(), &Record{Method: "DeleteUser"})
+	if err := Verify(sink.records); err != nil {
+		t.Errorf("after restart: %v", err)
+	}
+
+	tamper := map[string]func([]Record) []Record{
+		"modified": func(rs []Record) []Record { rs[2].Principal = "admin"; return rs },
+		"deleted":  func(rs []Record) []Record { return append(rs[:2:2], rs[3:]...) },
+		"inserted": func(rs []Record) []Record {
+			forged := Record{Chain: "a", Method: "DeleteUser", PrevHash: rs[0].Hash}
+			forged.Hash = Hash(&forged)
+			return append(append(rs[:1:1], forged), rs[1:]...)
+		},
+	}
+	for name, f := range tamper {
+		rs := f(append([]Record(nil), sink.records...))
+		if err := Verify(rs); err == nil {
+			t.Errorf("%s: want error", name)
+		}
+	}
+
+	// 写入失败时不前进
+	last := c.last
+	sink.err = errors.New("down")
+	if err := c.Write(context.Background(), &Record{}); err == nil || c.last != last {
+		t.Errorf("got err:%v last:%s", err, c.last)
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+
+	write := func(n int) {
+		s, err := NewFileSink(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+		records, _ := ReadFile(path)
+		c := NewChain("host-1", s, LastHash(records, "host-1"))
+		for i := 0; i < n; i++ {
+			r := &Record{Time: time.Now().UTC().Truncate(time.Microsecond), Method: "CreateUser", Result: "ok"}
+			if err := c.Write(context.Background(), r); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// 第二次打开时追加，链与之前的记录相连
+	write(2)
+	write(1)
+	records, err := ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("got %d records", len(records))
+	}
+	if err := Verify(records); err != nil {
+		t.Error(err)
+	}
+}
+
+type memEventsSink struct {
+	topic string
+	msgs  []events.Message
+}
+
+func (s *memEventsSink) Write(_ context.Context, topic string, msgs []events.Message) error {
+	s.topic = topic
+	s.msgs = append(s.msgs, msgs...)
+	return nil
+}
+
+func (s *memEventsSink) Close() error { return nil }
+
+func TestEventsSink(t *testing.T) {
+	es := &memEventsSink{}
+	c := NewChain("host-1", EventsSink(es, "usersvc.audit"), "")
+	_ = c.Write(context.Background(), &Record{Method: "DeleteUser"})
+	if es.topic != "usersvc.audit" || len(es.msgs) != 1 || string(es.msgs[0].Key) != "host-1" ||
+		!strings.Contains(string(es.msgs[0].Value), `"method":"DeleteUser"`) {
+		t.Errorf("got topic:%s msgs:%v", es.topic, es.msgs)
+	}
+}
@@ -0,0 +1,74 @@
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// Chain 将每条记录的hash与上一条串联后写入sink，写入是串行的
+// 每个Chain是一条独立的链(Record.Chain为name)，多个实例写入同一个Sink时每个实例使用不同的name(如主机名)
+type Chain struct {
+	name string
+	sink Sink
+
+	mu   sync.Mutex
+	last string
+}
+
+// NewChain last为这条链最后一条记录的hash，重启后从Sink中读取(如LastHash)，新的链为空
+func NewChain(name string, sink Sink, last string) *Chain {
+	return &Chain{name: name, sink: sink, last: last}
+}
+
+func (c *Chain) Write(ctx context.Context, r *Record) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r.Chain, r.PrevHash = c.name, c.last
+	r.Hash = Hash(r)
+	if err := c.sink.Write(ctx, r); err != nil {
+		return err
+	}
+	c.last = r.Hash
+	return nil
+}
+
+// Hash 除Hash外所有字段(包括PrevHash)的JSON的sha256
+func Hash(r *Record) string {
+	c := *r
+	c.Hash = ""
+	// 只包含基本类型的字段，不会编码失败
+	b, _ := json.Marshal(c)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// Verify 按写入顺序校验每条链，返回第一条被篡改(内容与hash不一致)或断开(prev_hash不是上一条的hash)的记录；
+// 不同链的记录可以交错，每条链的第一条记录的prev_hash不校验(可能是截断后保留的部分)
+func Verify(records []Record) error {
+	last := map[string]string{}
+	for i := range records {
+		r := &records[i]
+		if Hash(r) != r.Hash {
+			return fmt.Errorf("audit: record %d (chain %q) has been modified", i, r.Chain)
+		}
+		if prev, ok := last[r.Chain]; ok && r.PrevHash != prev {
+			return fmt.Errorf("audit: record %d (chain %q) does not follow the previous record", i, r.Chain)
+		}
+		last[r.Chain] = r.Hash
+	}
+	return nil
+}
+
+// LastHash records中chain的最后一条记录的hash，用于NewChain
+func LastHash(records []Record, chain string) string {
+	for i := len(records) - 1; i >= 0; i-- {
+		if records[i].Chain == chain {
+			return records[i].Hash
+		}
+	}
+	return ""
+}
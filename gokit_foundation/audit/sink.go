@@ -0,0 +1,74 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"gokit_foundation/events"
+	"os"
+	"sync"
+)
+
+// FileSink 每条记录一行JSON，以O_APPEND打开，只追加不修改
+type FileSink struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+func NewFileSink(path string) (*FileSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{f: f}, nil
+}
+
+// Write 每次写入后Sync，进程崩溃也不会丢失已返回的记录
+func (s *FileSink) Write(_ context.Context, r *Record) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err = s.f.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	return s.f.Sync()
+}
+
+func (s *FileSink) Close() error {
+	return s.f.Close()
+}
+
+// ReadFile 读取FileSink写入的所有记录，用于Verify和LastHash
+func ReadFile(path string) ([]Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var records []Record
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		var r Record
+		if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	return records, sc.Err()
+}
+
+// EventsSink 写入events.Sink(如Kafka)的topic，key为Record.Chain，同一条链的记录进入同一个分区，保持顺序
+// 每条记录同步写入一次，不经过events.AsyncPublisher的攒批(缓冲区满时会丢弃)
+func EventsSink(sink events.Sink, topic string) Sink {
+	return SinkFunc(func(ctx context.Context, r *Record) error {
+		b, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		return sink.Write(ctx, topic, []events.Message{{Key: []byte(r.Chain), Value: b}})
+	})
+}
@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	kitjwt "github.com/go-kit/kit/auth/jwt"
+	"github.com/go-kit/kit/endpoint"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+/*
+endpoint层的JWT认证
+	transport层只负责把bearer token从gRPC metadata/HTTP header中取出放入ctx(见GRPCToContext、HTTPToContext)，
+	由JWTMiddleware完成验签和claims校验，并将claims写入ctx(见ClaimsFromContext)，
+	这样grpc和http两种transport共用同一套认证逻辑
+*/
+
+// 认证失败的err，实现了GRPCStatus方法，通过grpc返回时状态码为Unauthenticated
+type Error struct {
+	msg string
+}
+
+func (e Error) Error() string {
+	return e.msg
+}
+
+func (e Error) GRPCStatus() *status.Status {
+	return status.New(codes.Unauthenticated, e.msg)
+}
+
+var (
+	ErrTokenMissing = Error{"auth: token missing"}
+	ErrTokenInvalid = Error{"auth: token invalid"}
+	ErrTokenExpired = Error{"auth: token expired"}
+)
+
+// KeySource 提供验签使用的key，每次验证都会调用，所以key可以在不重启服务的情况下更换
+type KeySource func() ([]byte, error)
+
+// 固定的key
+func StaticKey(key []byte) KeySource {
+	return func() ([]byte, error) {
+		return key, nil
+	}
+}
+
+// 从环境变量读取key
+func EnvKey(name string) KeySource {
+	return func() ([]byte, error) {
+		v := os.Getenv(name)
+		if v == "" {
+			return nil, fmt.Errorf("auth: env %s is empty", name)
+		}
+		return []byte(v), nil
+	}
+}
+
+// 从文件读取key，首尾的空白字符会被去掉
+func FileKey(path string) KeySource {
+	return func() ([]byte, error) {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("auth: read key file err:%v", err)
+		}
+		return []byte(strings.TrimSpace(string(b))), nil
+	}
+}
+
+type Config struct {
+	Key KeySource
+	// 签名算法，默认HS256，token的alg与之不一致时认证失败
+	Method jwt.SigningMethod
+	// 不为空时，token中的iss/aud必须与之相等
+	Issuer   string
+	Audience string
+	// 不需要认证的接口名，如健康检查
+	Allowlist []string
+}
+
+func (c Config) allowed(method string) bool {
+	for _, m := range c.Allowlist {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// 创建一个JWT认证mw，method为接口名，在Config.Allowlist中的接口不做认证
+// 验签使用go-kit的auth/jwt.NewParser，认证通过后claims写入ctx，见ClaimsFromContext
+func JWTMiddleware(cfg Config, method string) endpoint.Middleware {
+	if cfg.Key == nil {
+		panic("auth: Config.Key is nil")
+	}
+	if cfg.Method == nil {
+		cfg.Method = jwt.SigningMethodHS256
+	}
+	keyFunc := func(*jwt.Token) (interface{}, error) {
+		return cfg.Key()
+	}
+	parser := kitjwt.NewParser(keyFunc, cfg.Method, kitjwt.MapClaimsFactory)
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		if cfg.allowed(method) {
+			return next
+		}
+		verify := func(ctx context.Context, request interface{}) (interface{}, error) {
+			claims, _ := ClaimsFromContext(ctx)
+			if cfg.Issuer != "" && !claims.VerifyIssuer(cfg.Issuer, true) {
+				return nil, ErrTokenInvalid
+			}
+			if cfg.Audience != "" && !claims.VerifyAudience(cfg.Audience, true) {
+				return nil, ErrTokenInvalid
+			}
+			return next(ctx, request)
+		}
+		parsed := parser(verify)
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			if tk, _ := ctx.Value(kitjwt.JWTTokenContextKey).(string); tk == "" {
+				return nil, ErrTokenMissing
+			}
+			rsp, err := parsed(ctx, request)
+			return rsp, convertErr(err)
+		}
+	}
+}
+
+// 将kitjwt返回的err统一转为Error，key读取失败等服务端的err原样返回方便排查
+func convertErr(err error) error {
+	switch err {
+	case kitjwt.ErrTokenExpired:
+		return ErrTokenExpired
+	case kitjwt.ErrTokenInvalid, kitjwt.ErrTokenMalformed, kitjwt.ErrTokenNotActive, kitjwt.ErrUnexpectedSigningMethod,
+		jwt.ErrSignatureInvalid:
+		return ErrTokenInvalid
+	}
+	return err
+}
+
+// 获取JWTMiddleware写入ctx的claims
+func ClaimsFromContext(ctx context.Context) (jwt.MapClaims, bool) {
+	c, ok := ctx.Value(kitjwt.JWTClaimsContextKey).(jwt.MapClaims)
+	return c, ok
+}
+
+// 将token放入ctx，client侧调用endpoint前使用它设置token，再由ContextToGRPC/ContextToHTTP发送出去
+func WithToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, kitjwt.JWTTokenContextKey, token)
+}
+
+// 获取WithToken(或server侧GRPCToContext/HTTPToContext)放入ctx的token
+func TokenFromContext(ctx context.Context) (string, bool) {
+	token, ok := ctx.Value(kitjwt.JWTTokenContextKey).(string)
+	return token, ok && token != ""
+}
+
+// 以下transport层的func直接使用go-kit的实现，header格式为 Authorization: Bearer <token>
+var (
+	// server侧，从gRPC metadata/HTTP header中提取token放入ctx
+	GRPCToContext = kitjwt.GRPCToContext
+	HTTPToContext = kitjwt.HTTPToContext
+	// client侧，将ctx中的token写入gRPC metadata/HTTP header
+	ContextToGRPC = kitjwt.ContextToGRPC
+	ContextToHTTP = kitjwt.ContextToHTTP
+)
@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"context"
+	"github.com/dgrijalva/jwt-go"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var testKey = []byte("test_secret")
+
+func genToken(t *testing.T, cls jwt.MapClaims, key []byte) string {
+	s, err := jwt.NewWithClaims(jwt.SigningMethodHS256, cls).SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestJWTMiddleware(t *testing.T) {
+	cfg := Config{
+		Key:       StaticKey(testKey),
+		Issuer:    "addsvc",
+		Allowlist: []string{"Health"},
+	}
+	var gotClaims jwt.MapClaims
+	next := func(ctx context.Context, request interface{}) (interface{}, error) {
+		gotClaims, _ = ClaimsFromContext(ctx)
+		return "ok", nil
+	}
+
+	expired := jwt.MapClaims{"iss": "addsvc", "exp": time.Now().Add(-time.Hour).Unix()}
+	hs512, err := jwt.NewWithClaims(jwt.SigningMethodHS512, jwt.MapClaims{"iss": "addsvc"}).SignedString(testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		method  string
+		token   string
+		wantErr error
+	}{
+		{"valid", "Sum", genToken(t, jwt.MapClaims{"iss": "addsvc", "role": "admin"}, testKey), nil},
+		{"missing", "Sum", "", ErrTokenMissing},
+		{"malformed", "Sum", "xxx", ErrTokenInvalid},
+		{"wrong key", "Sum", genToken(t, jwt.MapClaims{"iss": "addsvc"}, []byte("other")), ErrTokenInvalid},
+		{"wrong iss", "Sum", genToken(t, jwt.MapClaims{"iss": "other"}, testKey), ErrTokenInvalid},
+		{"expired", "Sum", genToken(t, expired, testKey), ErrTokenExpired},
+		{"wrong alg", "Sum", hs512, ErrTokenInvalid},
+		{"allowlist", "Health", "", nil},
+	}
+	for _, tt := range tests {
+		gotClaims = nil
+		ctx := context.Background()
+		if tt.token != "" {
+			ctx = WithToken(ctx, tt.token)
+		}
+		_, err := JWTMiddleware(cfg, tt.method)(next)(ctx, nil)
+		if err != tt.wantErr {
+			t.Errorf("name:%s got err:%v want:%v", tt.name, err, tt.wantErr)
+		}
+		if tt.name == "valid" && gotClaims["role"] != "admin" {
+			t.Errorf("name:%s claims not injected, got:%v", tt.name, gotClaims)
+		}
+	}
+}
+
+func TestErrorGRPCStatus(t *testing.T) {
+	if c := status.Code(ErrTokenInvalid); c != codes.Unauthenticated {
+		t.Errorf("got code:%v", c)
+	}
+}
+
+func TestKeySource(t *testing.T) {
+	os.Setenv("AUTH_TEST_KEY", "env_secret")
+	defer os.Unsetenv("AUTH_TEST_KEY")
+	if k, err := EnvKey("AUTH_TEST_KEY")(); err != nil || string(k) != "env_secret" {
+		t.Errorf("EnvKey got:%s err:%v", k, err)
+	}
+	if _, err := EnvKey("AUTH_TEST_KEY_NOT_EXIST")(); err == nil {
+		t.Error("EnvKey want err for empty env")
+	}
+
+	dir, err := ioutil.TempDir("", "auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "key")
+	if err = ioutil.WriteFile(path, []byte("file_secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if k, err := FileKey(path)(); err != nil || string(k) != "file_secret" {
+		t.Errorf("FileKey got:%s err:%v", k, err)
+	}
+}
+
+// client侧写入的token经过metadata传到server侧
+func TestGRPCTokenRoundTrip(t *testing.T) {
+	md := metadata.MD{}
+	ContextToGRPC()(WithToken(context.Background(), "abc"), &md)
+	if v := md.Get("authorization"); len(v) != 1 || v[0] != "Bearer abc" {
+		t.Errorf("ContextToGRPC got:%v", v)
+	}
+	ctx := GRPCToContext()(context.Background(), md)
+	if tok, ok := TokenFromContext(ctx); !ok || tok != "abc" {
+		t.Errorf("TokenFromContext got:%q", tok)
+	}
+	_, err := JWTMiddleware(Config{Key: StaticKey(testKey)}, "Sum")(func(context.Context, interface{}) (interface{}, error) {
+		return nil, nil
+	})(ctx, nil)
+	// abc不是合法的token，但说明token已经传到了ctx中
+	if err != ErrTokenInvalid {
+		t.Errorf("got err:%v", err)
+	}
+}
@@ -0,0 +1,147 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	"gokit_foundation/auth"
+	"gokit_foundation/errs"
+	"gokit_foundation/reqid"
+	"path"
+	"strings"
+)
+
+/*
+接口级别的授权，在JWT认证(见auth.JWTMiddleware)之后检查调用方是否拥有接口所需的权限：
+-	权限的格式为 <服务>.<资源>:<动作>，如addsvc.sum:invoke，每个接口声明所需的权限(Config.Permissions)
+-	调用方(Principal)来自token的claims：sub、role/roles、permissions/scope(空格分隔，与OAuth2相同)
+-	Policy决定是否允许，内置：Claims(token中直接包含权限)、Roles(角色=>权限)、Casbin、OPA，可以用Any组合
+	授予的权限可以使用通配符，如addsvc.*:invoke、*
+-	拒绝时返回ErrPermissionDenied(grpc为PermissionDenied，http为403)，Policy出错时拒绝并返回Unavailable；
+	每次拒绝都记录审计日志(Config.Audit)，包括调用方、接口、所需权限、request id和原因
+*/
+
+var (
+	ErrPermissionDenied = errs.Forbidden("authz: permission denied")
+	// 没有认证信息，如接口在auth.Config.Allowlist中却声明了权限
+	ErrNoPrincipal = errs.Unauthenticated("authz: no principal")
+	// Policy出错(如OPA不可用)，拒绝请求
+	ErrPolicyUnavailable = errs.Unavailable("authz: policy unavailable")
+)
+
+// Principal 调用方
+type Principal struct {
+	Subject     string
+	Roles       []string
+	Permissions []string
+	Claims      jwt.MapClaims
+}
+
+// FromClaims 读取sub、role(单个角色)/roles、permissions/scope
+func FromClaims(claims jwt.MapClaims) Principal {
+	p := Principal{Claims: claims}
+	p.Subject, _ = claims["sub"].(string)
+	if role, ok := claims["role"].(string); ok && role != "" {
+		p.Roles = append(p.Roles, role)
+	}
+	p.Roles = append(p.Roles, stringList(claims["roles"])...)
+	p.Permissions = stringList(claims["permissions"])
+	if scope, ok := claims["scope"].(string); ok {
+		p.Permissions = append(p.Permissions, strings.Fields(scope)...)
+	}
+	return p
+}
+
+// claims经过json解码，数组为[]interface{}
+func stringList(v interface{}) []string {
+	var list []string
+	switch v := v.(type) {
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok && s != "" {
+				list = append(list, s)
+			}
+		}
+	case []string:
+		list = append(list, v...)
+	}
+	return list
+}
+
+// PrincipalFromContext 从JWTMiddleware写入ctx的claims中获取调用方
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	claims, ok := auth.ClaimsFromContext(ctx)
+	if !ok {
+		return Principal{}, false
+	}
+	return FromClaims(claims), true
+}
+
+// Permission 接口的调用权限，如Permission("addsvc", "Sum")为addsvc.sum:invoke
+func Permission(service, method string) string {
+	return strings.ToLower(service + "." + method + ":invoke")
+}
+
+// Match granted可以使用通配符(规则与path.Match相同)，如addsvc.*:invoke匹配addsvc.sum:invoke
+func Match(granted, required string) bool {
+	if granted == required || granted == "*" {
+		return true
+	}
+	ok, _ := path.Match(granted, required)
+	return ok
+}
+
+type Config struct {
+	Policy Policy
+	// 接口名 => 所需权限，没有配置的接口不做检查
+	Permissions map[string]string
+	// 审计日志，为nil时不记录
+	Audit log.Logger
+	// 为true时允许的调用也记录审计日志
+	AuditAllowed bool
+}
+
+// Middleware 安装在认证mw内层，method为接口名
+func Middleware(conf Config, method string) endpoint.Middleware {
+	permission, ok := conf.Permissions[method]
+	if conf.Policy == nil {
+		panic("authz: Config.Policy is nil")
+	}
+	audit := conf.Audit
+	if audit == nil {
+		audit = log.NewNopLogger()
+	}
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		if !ok {
+			return next
+		}
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			p, found := PrincipalFromContext(ctx)
+			var err error
+			if !found {
+				err = ErrNoPrincipal
+			} else if allowed, perr := conf.Policy.Allow(ctx, p, permission); perr != nil {
+				err = ErrPolicyUnavailable.Wrap(perr)
+			} else if !allowed {
+				err = ErrPermissionDenied
+			}
+			if err != nil || conf.AuditAllowed {
+				decision, reason := "allow", ""
+				if err != nil {
+					decision, reason = "deny", err.Error()
+					if cause := errors.Unwrap(err); cause != nil {
+						reason += ": " + cause.Error()
+					}
+				}
+				audit.Log("audit", "authz", "decision", decision, "method", method, "permission", permission,
+					"subject", p.Subject, "roles", strings.Join(p.Roles, ","), "request_id", reqid.FromContext(ctx), "reason", reason)
+			}
+			if err != nil {
+				return nil, err
+			}
+			return next(ctx, request)
+		}
+	}
+}
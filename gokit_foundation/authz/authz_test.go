@@ -0,0 +1,184 @@
+package authz
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/dgrijalva/jwt-go"
+	kitjwt "github.com/go-kit/kit/auth/jwt"
+	"github.com/go-kit/kit/log"
+	"gokit_foundation/errs"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func withClaims(claims jwt.MapClaims) context.Context {
+	return context.WithValue(context.Background(), kitjwt.JWTClaimsContextKey, claims)
+}
+
+func TestFromClaims(t *testing.T) {
+	// 与经过json解码的claims相同
+	var claims jwt.MapClaims
+	_ = json.Unmarshal([]byte(`{"sub":"jack","role":"admin","roles":["ops",1],"permissions":["addsvc.sum:invoke"],"scope":"addsvc.concat:invoke  addsvc.*:read"}`), &claims)
+	p := FromClaims(claims)
+	if p.Subject != "jack" || !reflect.DeepEqual(p.Roles, []string{"admin", "ops"}) ||
+		!reflect.DeepEqual(p.Permissions, []string{"addsvc.sum:invoke", "addsvc.concat:invoke", "addsvc.*:read"}) {
+		t.Errorf("got principal:%+v", p)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	test := []struct {
+		granted, required string
+		want              bool
+	}{
+		{"addsvc.sum:invoke", "addsvc.sum:invoke", true},
+		{"addsvc.*:invoke", "addsvc.sum:invoke", true},
+		{"addsvc.*", "addsvc.sum:invoke", true},
+		{"*", "usersvc.user:delete", true},
+		{"addsvc.*:invoke", "addsvc.sum:read", false},
+		{"addsvc.sum:invoke", "addsvc.summary:invoke", false},
+		{"[", "addsvc.sum:invoke", false},
+	}
+	for _, tt := range test {
+		if got := Match(tt.granted, tt.required); got != tt.want {
+			t.Errorf("Match(%q, %q) = %v", tt.granted, tt.required, got)
+		}
+	}
+	if got := Permission("addsvc", "BatchSum"); got != "addsvc.batchsum:invoke" {
+		t.Errorf("got permission:%s", got)
+	}
+}
+
+type fakeEnforcer struct {
+	policies map[[3]string]bool
+	calls    [][]interface{}
+}
+
+func (e *fakeEnforcer) Enforce(rvals ...interface{}) (bool, error) {
+	e.calls = append(e.calls, rvals)
+	return e.policies[[3]string{rvals[0].(string), rvals[1].(string), rvals[2].(string)}], nil
+}
+
+func TestPolicies(t *testing.T) {
+	admin := Principal{Subject: "jack", Roles: []string{"admin"}}
+	reader := Principal{Subject: "rose", Permissions: []string{"addsvc.sum:invoke"}}
+	enforcer := &fakeEnforcer{policies: map[[3]string]bool{{"admin", "addsvc.concat", "invoke"}: true}}
+	failing := PolicyFunc(func(context.Context, Principal, string) (bool, error) { return false, errors.New("down") })
+	test := []struct {
+		name       string
+		policy     Policy
+		p          Principal
+		permission string
+		want       bool
+		err        bool
+	}{
+		{"claims allow", Claims(), reader, "addsvc.sum:invoke", true, false},
+		{"claims deny", Claims(), reader, "addsvc.concat:invoke", false, false},
+		{"roles allow", Roles(map[string][]string{"admin": {"addsvc.*:invoke"}}), admin, "addsvc.concat:invoke", true, false},
+		{"roles deny", Roles(map[string][]string{"admin": {"addsvc.*:invoke"}}), reader, "addsvc.sum:read", false, false},
+		{"casbin role", Casbin(enforcer), admin, "addsvc.concat:invoke", true, false},
+		{"casbin deny", Casbin(enforcer), admin, "addsvc.sum:invoke", false, false},
+		{"any", Any(Roles(nil), Claims()), reader, "addsvc.sum:invoke", true, false},
+		{"any err", Any(failing, Claims()), reader, "addsvc.sum:invoke", false, true},
+	}
+	for _, tt := range test {
+		got, err := tt.policy.Allow(context.Background(), tt.p, tt.permission)
+		if got != tt.want || (err != nil) != tt.err {
+			t.Errorf("%s: got %v err:%v", tt.name, got, err)
+		}
+	}
+	// 先以subject再以角色调用
+	if first := enforcer.calls[0]; first[0] != "jack" || first[1] != "addsvc.concat" || first[2] != "invoke" {
+		t.Errorf("got enforce calls:%v", enforcer.calls)
+	}
+}
+
+func TestOPA(t *testing.T) {
+	var input opaInput
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct{ Input opaInput }
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		input = body.Input
+		switch input.Subject {
+		case "jack":
+			w.Write([]byte(`{"result": true}`))
+		case "rose":
+			w.Write([]byte(`{"result": false}`))
+		case "error":
+			http.Error(w, "boom", http.StatusInternalServerError)
+		default:
+			// 规则未定义
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer srv.Close()
+	policy := OPA(srv.URL+"/v1/data/addsvc/authz/allow", nil)
+
+	for sub, want := range map[string]bool{"jack": true, "rose": false, "nobody": false} {
+		ok, err := policy.Allow(context.Background(), Principal{Subject: sub, Roles: []string{"admin"}, Claims: jwt.MapClaims{"sub": sub}}, "addsvc.sum:invoke")
+		if ok != want || err != nil {
+			t.Errorf("%s: got %v err:%v", sub, ok, err)
+		}
+	}
+	if input.Permission != "addsvc.sum:invoke" || input.Roles[0] != "admin" || input.Claims["sub"] != input.Subject {
+		t.Errorf("got input:%+v", input)
+	}
+	if _, err := policy.Allow(context.Background(), Principal{Subject: "error"}, "addsvc.sum:invoke"); err == nil {
+		t.Error("want error for status 500")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	buf := &bytes.Buffer{}
+	conf := Config{
+		Policy:      Roles(map[string][]string{"admin": {"addsvc.*:invoke"}}),
+		Permissions: map[string]string{"Sum": "addsvc.sum:invoke"},
+		Audit:       log.NewLogfmtLogger(buf),
+	}
+	next := func(context.Context, interface{}) (interface{}, error) { return "ok", nil }
+	unavailable := conf
+	unavailable.Policy = PolicyFunc(func(context.Context, Principal, string) (bool, error) { return false, errors.New("opa down") })
+	test := []struct {
+		name   string
+		conf   Config
+		method string
+		ctx    context.Context
+		kind   errs.Kind
+		audit  string
+	}{
+		{"allowed", conf, "Sum", withClaims(jwt.MapClaims{"sub": "jack", "role": "admin"}), -1, ""},
+		{"denied", conf, "Sum", withClaims(jwt.MapClaims{"sub": "rose", "role": "guest"}), errs.KindForbidden,
+			"decision=deny method=Sum permission=addsvc.sum:invoke subject=rose roles=guest"},
+		{"no principal", conf, "Sum", context.Background(), errs.KindUnauthenticated, "reason=\"authz: no principal\""},
+		{"policy error", unavailable, "Sum", withClaims(jwt.MapClaims{"sub": "jack"}), errs.KindUnavailable, "opa down"},
+		// 没有声明权限的接口不检查
+		{"undeclared", conf, "Concat", context.Background(), -1, ""},
+	}
+	for _, tt := range test {
+		buf.Reset()
+		rsp, err := Middleware(tt.conf, tt.method)(next)(tt.ctx, nil)
+		if tt.kind == -1 {
+			if err != nil || rsp != "ok" {
+				t.Errorf("%s: got rsp:%v err:%v", tt.name, rsp, err)
+			}
+		} else if errs.KindOf(err) != tt.kind {
+			t.Errorf("%s: got err:%v", tt.name, err)
+		}
+		if tt.audit == "" && buf.Len() > 0 || !strings.Contains(buf.String(), tt.audit) {
+			t.Errorf("%s: got audit log:%s", tt.name, buf.String())
+		}
+	}
+
+	// AuditAllowed时允许的调用也记录
+	buf.Reset()
+	conf.AuditAllowed = true
+	_, _ = Middleware(conf, "Sum")(next)(withClaims(jwt.MapClaims{"sub": "jack", "role": "admin"}), nil)
+	if !strings.Contains(buf.String(), "decision=allow") {
+		t.Errorf("got audit log:%s", buf.String())
+	}
+}
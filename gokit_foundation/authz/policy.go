@@ -0,0 +1,137 @@
+package authz
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Policy 判断p是否拥有permission，返回err时请求被拒绝
+type Policy interface {
+	Allow(ctx context.Context, p Principal, permission string) (bool, error)
+}
+
+type PolicyFunc func(ctx context.Context, p Principal, permission string) (bool, error)
+
+func (f PolicyFunc) Allow(ctx context.Context, p Principal, permission string) (bool, error) {
+	return f(ctx, p, permission)
+}
+
+// Claims token的permissions/scope中包含所需权限时允许
+func Claims() Policy {
+	return PolicyFunc(func(_ context.Context, p Principal, permission string) (bool, error) {
+		return matchAny(p.Permissions, permission), nil
+	})
+}
+
+// Roles 角色 => 授予的权限，调用方的任一角色拥有所需权限时允许
+func Roles(grants map[string][]string) Policy {
+	return PolicyFunc(func(_ context.Context, p Principal, permission string) (bool, error) {
+		for _, role := range p.Roles {
+			if matchAny(grants[role], permission) {
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+}
+
+// Any 依次检查，任一policy允许即允许；出错时立即返回err
+func Any(policies ...Policy) Policy {
+	return PolicyFunc(func(ctx context.Context, p Principal, permission string) (bool, error) {
+		for _, policy := range policies {
+			if ok, err := policy.Allow(ctx, p, permission); err != nil || ok {
+				return ok, err
+			}
+		}
+		return false, nil
+	})
+}
+
+func matchAny(granted []string, permission string) bool {
+	for _, g := range granted {
+		if Match(g, permission) {
+			return true
+		}
+	}
+	return false
+}
+
+// Enforcer 与casbin的*casbin.Enforcer.Enforce签名相同，不需要在这里引入casbin
+type Enforcer interface {
+	Enforce(rvals ...interface{}) (bool, error)
+}
+
+// Casbin 权限addsvc.sum:invoke拆分为obj(addsvc.sum)和act(invoke)，
+// 依次以subject和token中的每个角色作为sub调用Enforce(sub, obj, act)，任一允许即允许；
+// 角色也可以在casbin的g中配置，此时只需要subject
+func Casbin(e Enforcer) Policy {
+	return PolicyFunc(func(_ context.Context, p Principal, permission string) (bool, error) {
+		obj, act := permission, ""
+		if i := strings.LastIndex(permission, ":"); i >= 0 {
+			obj, act = permission[:i], permission[i+1:]
+		}
+		subs := append([]string{p.Subject}, p.Roles...)
+		for _, sub := range subs {
+			if sub == "" {
+				continue
+			}
+			if ok, err := e.Enforce(sub, obj, act); err != nil || ok {
+				return ok, err
+			}
+		}
+		return false, nil
+	})
+}
+
+// OPA的input，policy中通过input.subject、input.permission等读取
+type opaInput struct {
+	Subject     string                 `json:"subject"`
+	Roles       []string               `json:"roles"`
+	Permissions []string               `json:"permissions"`
+	Permission  string                 `json:"permission"`
+	Claims      map[string]interface{} `json:"claims"`
+}
+
+// OPA 调用OPA的Data API，url为规则的地址(如http://127.0.0.1:8181/v1/data/addsvc/authz/allow)，
+// 规则的结果为true时允许，未定义(没有result)时拒绝；client为nil时使用http.DefaultClient，超时由ctx控制
+func OPA(url string, client *http.Client) Policy {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return PolicyFunc(func(ctx context.Context, p Principal, permission string) (bool, error) {
+		body, err := json.Marshal(map[string]opaInput{"input": {
+			Subject:     p.Subject,
+			Roles:       p.Roles,
+			Permissions: p.Permissions,
+			Permission:  permission,
+			Claims:      p.Claims,
+		}})
+		if err != nil {
+			return false, err
+		}
+		req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return false, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		rsp, err := client.Do(req.WithContext(ctx))
+		if err != nil {
+			return false, err
+		}
+		defer rsp.Body.Close()
+		if rsp.StatusCode != http.StatusOK {
+			return false, fmt.Errorf("authz: opa returned status %d", rsp.StatusCode)
+		}
+		var result struct {
+			Result *bool `json:"result"`
+		}
+		if err := json.NewDecoder(rsp.Body).Decode(&result); err != nil {
+			return false, fmt.Errorf("authz: decode opa response err:%v", err)
+		}
+		return result.Result != nil && *result.Result, nil
+	})
+}
@@ -0,0 +1,205 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
+	"gokit_foundation/errs"
+	"hash"
+	"io"
+	"regexp"
+	"strings"
+)
+
+/*
+大文件(blob)的流式存储，用于上传等payload较大的接口：
+-	Store按key写入，从r中边读边写，不把整个payload读入内存，实现有本地目录(FSStore)和S3及兼容S3的存储(S3Store，如MinIO)
+-	Put在r返回err时放弃写入，不留下不完整的文件/对象，所以大小限制和校验由r完成(见Uploader)：
+	超过最大大小、实际大小或sha256与声明的不一致时r返回err，Store据此放弃写入
+-	背压：Store写完一块才读下一块，读取又驱动transport的接收(grpc的流控窗口、http的TCP窗口)，
+	所以存储慢时client的发送随之变慢，server不会积压数据
+-	Uploader记录收到的字节数(上传进度)、进行中的上传数以及各结果的上传数，见Metrics
+*/
+
+type Store interface {
+	// Put 读取r直到EOF并写入key，已存在时覆盖，返回写入的字节数；r返回err时放弃写入并返回该err
+	Put(ctx context.Context, key string, r io.Reader) (int64, error)
+}
+
+var (
+	ErrInvalidKey       = errs.Invalid("blobstore: invalid key")
+	ErrInvalidChecksum  = errs.Invalid("blobstore: sha256 must be 64 hex characters")
+	ErrTooLarge         = errs.Invalid("blobstore: payload too large")
+	ErrSizeMismatch     = errs.Invalid("blobstore: size does not match the declared size")
+	ErrChecksumMismatch = errs.Invalid("blobstore: sha256 does not match the declared sha256")
+)
+
+// key由/分隔的多段组成，每段以字母或数字开头，所以不会出现..、空段以及开头、结尾的/
+var keyPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*(/[A-Za-z0-9][A-Za-z0-9._-]*)*$`)
+
+const maxKeyLen = 255
+
+// ValidKey 检查key是否可以用于所有Store(文件路径、S3对象key)
+func ValidKey(key string) error {
+	if len(key) > maxKeyLen || !keyPattern.MatchString(key) {
+		return ErrInvalidKey
+	}
+	return nil
+}
+
+type Metrics struct {
+	Received metrics.Counter // 收到的字节数，上传过程中持续增加，即上传进度
+	InFlight metrics.Gauge   // 进行中的上传数
+	Uploads  metrics.Counter // 标签result(ok、too_large、size_mismatch、checksum_mismatch、canceled、error)
+}
+
+type Info struct {
+	Key    string
+	Size   int64
+	SHA256 string // hex
+}
+
+type Uploader struct {
+	store   Store
+	maxSize int64
+	m       Metrics
+}
+
+// NewUploader maxSize为单个blob的最大字节数，0表示不限制，Metrics中为nil的指标不上报
+func NewUploader(store Store, maxSize int64, m Metrics) *Uploader {
+	if m.Received == nil {
+		m.Received = discard.NewCounter()
+	}
+	if m.InFlight == nil {
+		m.InFlight = discard.NewGauge()
+	}
+	if m.Uploads == nil {
+		m.Uploads = discard.NewCounter()
+	}
+	return &Uploader{store: store, maxSize: maxSize, m: m}
+}
+
+// Upload 校验并写入key，size、sha256(hex)为调用方声明的大小和校验和，为0或空时不检查，
+// 声明的size已超过最大大小时不读取r直接返回ErrTooLarge
+func (u *Uploader) Upload(ctx context.Context, key string, r io.Reader, size int64, sha256Hex string) (Info, error) {
+	if err := ValidKey(key); err != nil {
+		return Info{}, err
+	}
+	var want []byte
+	if sha256Hex != "" {
+		b, err := hex.DecodeString(sha256Hex)
+		if err != nil || len(b) != sha256.Size {
+			return Info{}, ErrInvalidChecksum
+		}
+		want = b
+	}
+	if u.maxSize > 0 && size > u.maxSize {
+		u.m.Uploads.With("result", "too_large").Add(1)
+		return Info{}, ErrTooLarge
+	}
+
+	u.m.InFlight.Add(1)
+	defer u.m.InFlight.Add(-1)
+	v := &verifier{r: r, maxSize: u.maxSize, size: size, want: want, h: sha256.New(), received: u.m.Received}
+	n, err := u.store.Put(ctx, key, v)
+	u.m.Uploads.With("result", result(ctx, err)).Add(1)
+	if err != nil {
+		return Info{}, err
+	}
+	return Info{Key: key, Size: n, SHA256: hex.EncodeToString(v.h.Sum(nil))}, nil
+}
+
+func result(ctx context.Context, err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, ErrTooLarge):
+		return "too_large"
+	case errors.Is(err, ErrSizeMismatch):
+		return "size_mismatch"
+	case errors.Is(err, ErrChecksumMismatch):
+		return "checksum_mismatch"
+	case ctx.Err() != nil:
+		return "canceled"
+	}
+	return "error"
+}
+
+// 边读边计算大小和sha256，超过限制或EOF时校验失败返回err(代替io.EOF)，之后的Read都返回同一个err
+type verifier struct {
+	r        io.Reader
+	maxSize  int64
+	size     int64
+	want     []byte
+	h        hash.Hash
+	n        int64
+	err      error
+	received metrics.Counter
+}
+
+func (v *verifier) Read(p []byte) (int, error) {
+	if v.err != nil {
+		return 0, v.err
+	}
+	n, err := v.r.Read(p)
+	if n > 0 {
+		v.n += int64(n)
+		v.h.Write(p[:n])
+		v.received.Add(float64(n))
+	}
+	switch {
+	case v.maxSize > 0 && v.n > v.maxSize:
+		err = ErrTooLarge
+	case v.size > 0 && v.n > v.size:
+		err = ErrSizeMismatch
+	case err == io.EOF && v.size > 0 && v.n != v.size:
+		err = ErrSizeMismatch
+	case err == io.EOF && v.want != nil && !bytes.Equal(v.h.Sum(nil), v.want):
+		err = ErrChecksumMismatch
+	}
+	if err != nil {
+		v.err = err
+	}
+	return n, err
+}
+
+// ctx结束后Read返回ctx.Err()，用于Put中不关心ctx的读写循环(如io.Copy)
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// 统计读取的字节数，并记录r返回的第一个err(io.EOF除外)，用于区分上传失败是r的err还是存储的err
+type countingReader struct {
+	r   io.Reader
+	n   int64
+	err error
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	if err != nil && err != io.EOF && r.err == nil {
+		r.err = err
+	}
+	return n, err
+}
+
+// 文件路径和S3对象key都使用/分隔
+func join(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return strings.TrimSuffix(prefix, "/") + "/" + key
+}
@@ -0,0 +1,139 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/go-kit/kit/metrics/generic"
+	"gokit_foundation/memtransport"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func sum(b []byte) string {
+	s := sha256.Sum256(b)
+	return hex.EncodeToString(s[:])
+}
+
+func TestValidKey(t *testing.T) {
+	for key, want := range map[string]bool{
+		"a.txt":                  true,
+		"2020/10/report-1_a.csv": true,
+		"":                       false,
+		"../etc/passwd":          false,
+		"a/../b":                 false,
+		"/abs":                   false,
+		"a//b":                   false,
+		"a/":                     false,
+		".hidden":                false,
+		"a b":                    false,
+		strings.Repeat("a", 256): false,
+	} {
+		if got := ValidKey(key) == nil; got != want {
+			t.Errorf("%q got %v want %v", key, got, want)
+		}
+	}
+}
+
+func TestUpload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blobstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := NewFSStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	received, inFlight, uploads := generic.NewCounter("received"), generic.NewGauge("in_flight"), memtransport.NewCounter()
+	u := NewUploader(store, 1000, Metrics{Received: received, InFlight: inFlight, Uploads: uploads})
+	data := bytes.Repeat([]byte("x"), 600)
+
+	info, err := u.Upload(context.Background(), "a/b.txt", bytes.NewReader(data), 600, sum(data))
+	if err != nil || info.Size != 600 || info.SHA256 != sum(data) {
+		t.Fatalf("got info:%+v err:%v", info, err)
+	}
+	if b, _ := ioutil.ReadFile(store.Path("a/b.txt")); !bytes.Equal(b, data) {
+		t.Errorf("got %d bytes", len(b))
+	}
+	// 不声明size、sha256时不检查
+	if info, err := u.Upload(context.Background(), "c.txt", bytes.NewReader(data), 0, ""); err != nil || info.SHA256 != sum(data) {
+		t.Errorf("got info:%+v err:%v", info, err)
+	}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	test := []struct {
+		name, key, sha256 string
+		ctx               context.Context
+		body              []byte
+		size              int64
+		wantErr           error
+	}{
+		{name: "[invalid key]", key: "../x", body: data, wantErr: ErrInvalidKey},
+		{name: "[invalid checksum]", key: "x", body: data, sha256: "abc", wantErr: ErrInvalidChecksum},
+		{name: "[declared too large]", key: "x", body: data, size: 1001, wantErr: ErrTooLarge},
+		{name: "[too large]", key: "x", body: bytes.Repeat([]byte("x"), 1001), wantErr: ErrTooLarge},
+		{name: "[shorter than declared]", key: "x", body: data, size: 601, wantErr: ErrSizeMismatch},
+		{name: "[longer than declared]", key: "x", body: data, size: 599, wantErr: ErrSizeMismatch},
+		{name: "[checksum mismatch]", key: "x", body: data, sha256: sum([]byte("y")), wantErr: ErrChecksumMismatch},
+		{name: "[canceled]", key: "x", body: data, ctx: canceled, wantErr: context.Canceled},
+	}
+	for _, tt := range test {
+		ctx := tt.ctx
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		if _, err := u.Upload(ctx, tt.key, bytes.NewReader(tt.body), tt.size, tt.sha256); !errors.Is(err, tt.wantErr) {
+			t.Errorf("name:%s got err:%v want:%v", tt.name, err, tt.wantErr)
+		}
+	}
+	// 失败的上传不留下文件(包括临时文件)
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	if len(files) != 2 {
+		t.Errorf("got files:%v", files)
+	}
+
+	for result, want := range map[string]int{"ok": 2, "too_large": 2, "size_mismatch": 2, "checksum_mismatch": 1, "canceled": 1} {
+		if n := len(uploads.Values("result", result)); n != want {
+			t.Errorf("uploads result:%s got:%d want:%d", result, n, want)
+		}
+	}
+	if inFlight.Value() != 0 || received.Value() < 1200 {
+		t.Errorf("in flight:%v received:%v", inFlight.Value(), received.Value())
+	}
+}
+
+// r为流(如grpc的数据块)时边读边写，Pipe没有缓冲，Write在Put读走数据之后才返回
+func TestUploadPipe(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blobstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, _ := NewFSStore(dir)
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		_, err := NewUploader(store, 0, Metrics{}).Upload(context.Background(), "p", pr, 0, "")
+		done <- err
+	}()
+	for i := 0; i < 3; i++ {
+		if _, err := pw.Write(bytes.Repeat([]byte("x"), 1<<16)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pw.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(store.Path("p")); err != nil || fi.Size() != 3<<16 {
+		t.Errorf("got %v err:%v", fi, err)
+	}
+}
@@ -0,0 +1,58 @@
+package blobstore
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// FSStore 保存在本地目录中，key中的/为子目录
+// 先写入同目录下的临时文件，成功后rename为目标文件，所以读到的文件总是完整的，失败时删除临时文件
+type FSStore struct {
+	dir string
+}
+
+// NewFSStore dir不存在时创建
+func NewFSStore(dir string) (*FSStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FSStore{dir: dir}, nil
+}
+
+func (s *FSStore) Put(ctx context.Context, key string, r io.Reader) (n int64, err error) {
+	if err := ValidKey(key); err != nil {
+		return 0, err
+	}
+	path := s.Path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return 0, err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			_ = f.Close()
+			_ = os.Remove(f.Name())
+		}
+	}()
+	if n, err = io.Copy(f, ctxReader{ctx, r}); err != nil {
+		return n, err
+	}
+	if err = f.Sync(); err != nil {
+		return n, err
+	}
+	if err = f.Close(); err != nil {
+		return n, err
+	}
+	return n, os.Rename(f.Name(), path)
+}
+
+// Path key对应的文件路径
+func (s *FSStore) Path(key string) string {
+	return filepath.Join(s.dir, filepath.FromSlash(key))
+}
@@ -0,0 +1,41 @@
+package blobstore
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"io"
+)
+
+// S3Store 保存在S3(或兼容S3的存储，如MinIO)的bucket中，对象key为prefix/key
+// 通过s3manager分片上传：每次读取一个分片(默认5MB)到内存，最多Concurrency(默认5)个分片同时上传，
+// 所以每个上传占用的内存不超过PartSize*Concurrency；r返回err时s3manager放弃上传(分片上传会abort)，不留下对象
+type S3Store struct {
+	uploader *s3manager.Uploader
+	bucket   string
+	prefix   string
+}
+
+// NewS3Store client一般为s3.New(sess)，兼容S3的存储创建session时设置Endpoint和S3ForcePathStyle，
+// options调整s3manager.Uploader，如分片大小、并发数
+func NewS3Store(client s3iface.S3API, bucket, prefix string, options ...func(*s3manager.Uploader)) *S3Store {
+	return &S3Store{uploader: s3manager.NewUploaderWithClient(client, options...), bucket: bucket, prefix: prefix}
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader) (int64, error) {
+	if err := ValidKey(key); err != nil {
+		return 0, err
+	}
+	cr := &countingReader{r: r}
+	_, err := s.uploader.UploadWithContext(ctx, &s3manager.UploadInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(join(s.prefix, key)),
+		Body:   cr,
+	})
+	// s3manager包装了r的err，返回原来的err，使得errors.Is(err, ErrTooLarge)等成立
+	if cr.err != nil {
+		return cr.n, cr.err
+	}
+	return cr.n, err
+}
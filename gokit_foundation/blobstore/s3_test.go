@@ -0,0 +1,69 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// 只支持PutObject(path style: PUT /bucket/key)，数据小于一个分片时s3manager只调用PutObject
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "PUT" {
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	f.objects[r.URL.Path] = b
+	f.mu.Unlock()
+	w.Header().Set("ETag", `"etag"`)
+}
+
+func TestS3Store(t *testing.T) {
+	fake := &fakeS3{objects: map[string][]byte{}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	sess, err := session.NewSession(aws.NewConfig().
+		WithEndpoint(srv.URL).
+		WithRegion("us-east-1").
+		WithS3ForcePathStyle(true).
+		WithCredentials(credentials.NewStaticCredentials("id", "secret", "")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := NewUploader(NewS3Store(s3.New(sess), "bucket", "uploads/"), 1000, Metrics{})
+	data := []byte("hello blob")
+
+	info, err := u.Upload(context.Background(), "a/b.txt", bytes.NewReader(data), int64(len(data)), sum(data))
+	if err != nil || info.Size != int64(len(data)) {
+		t.Fatalf("got info:%+v err:%v", info, err)
+	}
+	if got := fake.objects["/bucket/uploads/a/b.txt"]; !bytes.Equal(got, data) {
+		t.Errorf("got objects:%v", fake.objects)
+	}
+	// 校验失败时返回原来的err，不上传
+	if _, err := u.Upload(context.Background(), "c.txt", bytes.NewReader(data), 0, sum([]byte("x"))); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("got err:%v", err)
+	}
+	if _, ok := fake.objects["/bucket/uploads/c.txt"]; ok || len(fake.objects) != 1 {
+		t.Errorf("got objects:%v", fake.objects)
+	}
+}
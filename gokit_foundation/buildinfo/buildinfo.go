@@ -0,0 +1,127 @@
+package buildinfo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+/*
+构建信息，由构建时的ldflags注入，各服务共用，不需要在自己的main中声明：
+	go build -ldflags "-X gokit_foundation/buildinfo.Version=v1.0.0 \
+		-X gokit_foundation/buildinfo.GitCommit=$(git rev-parse --short HEAD) \
+		-X gokit_foundation/buildinfo.BuildTime=$(date +%FT%T%z)"
+-	没有注入时从go build自动记录的vcs信息(vcs.revision、vcs.time，go1.18+，见debug.ReadBuildInfo)补充，
+	go run、go test以及不在git仓库中构建时为默认值
+-	Get 用于启动日志(见Keyvals)、管理接口/version(见Handler)、addsvc version子命令
+-	Dump 写入完整的构建信息(依赖的module、构建参数)和运行时信息，用于排查问题(如收到SIGUSR1时，见_util.SignalOptions.OnInfo)
+*/
+
+var (
+	Version   = "dev"
+	GitCommit = "unknown"
+	BuildTime = "unknown"
+)
+
+var processStart = time.Now()
+
+type Info struct {
+	Version   string `json:"version"`
+	GitCommit string `json:"git_commit"`
+	BuildTime string `json:"build_time"`
+	Modified  bool   `json:"modified,omitempty"` // 构建时工作区有未提交的修改，只在vcs信息中有
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"`       // GOOS/GOARCH
+	Path      string `json:"path,omitempty"` // main package的import path
+}
+
+func Get() Info {
+	info := Info{
+		Version:   Version,
+		GitCommit: GitCommit,
+		BuildTime: BuildTime,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	info.Path = bi.Path
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			if info.GitCommit == "unknown" {
+				info.GitCommit = shortRevision(s.Value)
+			}
+		case "vcs.time":
+			if info.BuildTime == "unknown" {
+				info.BuildTime = s.Value
+			}
+		case "vcs.modified":
+			info.Modified = s.Value == "true"
+		}
+	}
+	return info
+}
+
+// 与git rev-parse --short的长度相同
+func shortRevision(rev string) string {
+	if len(rev) > 7 {
+		return rev[:7]
+	}
+	return rev
+}
+
+// Keyvals 用于启动日志，如logger.Log(append([]interface{}{"msg", "starting"}, buildinfo.Keyvals()...)...)
+func Keyvals() []interface{} {
+	info := Get()
+	return []interface{}{"version", info.Version, "git_commit", info.GitCommit, "build_time", info.BuildTime, "go_version", info.GoVersion}
+}
+
+// Handler 以JSON返回Get的结果
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(Get())
+	})
+}
+
+// Dump 写入构建信息、运行时信息以及依赖的module和构建参数，格式为文本，便于直接贴到工单中
+// w为nil时写入os.Stderr；ReadMemStats会短暂stop the world
+func Dump(w io.Writer) {
+	if w == nil {
+		w = os.Stderr
+	}
+	info := Get()
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	host, _ := os.Hostname()
+	fmt.Fprintf(w, "version: %s\ngit commit: %s\nbuild time: %s\nmodified: %v\ngo version: %s\nplatform: %s\npath: %s\n",
+		info.Version, info.GitCommit, info.BuildTime, info.Modified, info.GoVersion, info.Platform, info.Path)
+	fmt.Fprintf(w, "hostname: %s\npid: %d\nargs: %q\nuptime: %s\n",
+		host, os.Getpid(), os.Args, time.Since(processStart).Truncate(time.Second))
+	fmt.Fprintf(w, "num cpu: %d\ngomaxprocs: %d\ngoroutines: %d\nheap alloc: %d\nheap sys: %d\nnum gc: %d\n",
+		runtime.NumCPU(), runtime.GOMAXPROCS(0), runtime.NumGoroutine(), ms.HeapAlloc, ms.HeapSys, ms.NumGC)
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+	fmt.Fprintln(w, "build settings:")
+	for _, s := range bi.Settings {
+		fmt.Fprintf(w, "\t%s=%s\n", s.Key, s.Value)
+	}
+	fmt.Fprintln(w, "deps:")
+	for _, d := range bi.Deps {
+		fmt.Fprintf(w, "\t%s %s", d.Path, d.Version)
+		if d.Replace != nil {
+			fmt.Fprintf(w, " => %s %s", d.Replace.Path, d.Replace.Version)
+		}
+		fmt.Fprintln(w)
+	}
+}
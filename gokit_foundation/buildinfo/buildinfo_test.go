@@ -0,0 +1,50 @@
+package buildinfo
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// 测试程序没有vcs信息，ldflags注入的值原样返回
+func TestGet(t *testing.T) {
+	defer func(v, c, b string) { Version, GitCommit, BuildTime = v, c, b }(Version, GitCommit, BuildTime)
+	Version, GitCommit, BuildTime = "v1.2.3", "abc1234", "2026-01-02T03:04:05+0800"
+
+	info := Get()
+	if info.Version != "v1.2.3" || info.GitCommit != "abc1234" || info.BuildTime != "2026-01-02T03:04:05+0800" || info.GoVersion != runtime.Version() {
+		t.Errorf("got %+v", info)
+	}
+	if kv := Keyvals(); len(kv) != 8 || kv[1] != "v1.2.3" {
+		t.Errorf("got keyvals:%v", kv)
+	}
+
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest("GET", "/version", nil))
+	var got Info
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || got != info {
+		t.Errorf("got body:%s err:%v", w.Body.String(), err)
+	}
+}
+
+func TestShortRevision(t *testing.T) {
+	if got := shortRevision("0123456789abcdef"); got != "0123456" {
+		t.Errorf("got %s", got)
+	}
+	if got := shortRevision("0123"); got != "0123" {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestDump(t *testing.T) {
+	buf := new(bytes.Buffer)
+	Dump(buf)
+	for _, want := range []string{"version: ", "go version: " + runtime.Version(), "goroutines: ", "deps:"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("want %q in dump:\n%s", want, buf.String())
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
+	"time"
+)
+
+/*
+endpoint层的响应缓存，只适用于幂等(相同request总是得到相同response)的接口：
+-	key为 前缀+method+request的JSON的sha1，value为response的JSON，存储在Store中(如Redis，见NewRedisStore)
+-	只缓存endpoint成功返回的response，还可以通过Config.Cacheable排除部分response(如业务错误)
+-	ctx中设置了bypass(见WithBypass)时不读取缓存，但会用新的response刷新缓存
+-	Store不可用时退化为直接调用next，不影响接口调用
+-	每次查询的结果记录在lookups指标上，标签为method和result(hit、miss、bypass、error)
+缓存命中时不会调用next，所以安装在内层的mw(如断路器、service层的mw)不会执行
+*/
+
+// Store Get在key不存在时返回ErrMiss
+type Store interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+var ErrMiss = errors.New("cache: miss")
+
+type ctxKeyBypass struct{}
+
+// WithBypass 使本次调用跳过缓存，由transport层根据请求(如Cache-Control: no-cache)设置，见HTTPToContext
+func WithBypass(ctx context.Context) context.Context {
+	return context.WithValue(ctx, ctxKeyBypass{}, true)
+}
+
+func BypassFromContext(ctx context.Context) bool {
+	b, _ := ctx.Value(ctxKeyBypass{}).(bool)
+	return b
+}
+
+type Config struct {
+	Method string
+	TTL    time.Duration
+	Prefix string // key前缀，多个服务共用一个Store时避免冲突
+	// 返回response类型的零值(指针)，命中时将缓存的JSON解析到其中，它必须与next返回的类型一致
+	New func() interface{}
+	// 为nil时缓存所有成功的response
+	Cacheable func(response interface{}) bool
+	// 可选，返回值追加到key中，用于response除request外还取决于ctx的情况(如featureflag.Fingerprint)
+	Vary func(ctx context.Context) string
+}
+
+// Key 返回request的缓存key，request需要可以编码为JSON(字段顺序固定，相同的request得到相同的key)
+func Key(prefix, method string, request interface{}) (string, error) {
+	b, err := json.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+	sum := sha1.Sum(b)
+	return prefix + method + ":" + hex.EncodeToString(sum[:]), nil
+}
+
+// Middleware 创建一个响应缓存mw，lookups为nil时不上报
+func Middleware(store Store, conf Config, logger log.Logger, lookups metrics.Counter) endpoint.Middleware {
+	if lookups == nil {
+		lookups = discard.NewCounter()
+	}
+	lookups = lookups.With("method", conf.Method)
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			key, err := Key(conf.Prefix, conf.Method, request)
+			if err != nil {
+				lookups.With("result", "error").Add(1)
+				logger.Log("cache", conf.Method, "err", err)
+				return next(ctx, request)
+			}
+			if conf.Vary != nil {
+				if v := conf.Vary(ctx); v != "" {
+					key += ":" + v
+				}
+			}
+
+			if BypassFromContext(ctx) {
+				lookups.With("result", "bypass").Add(1)
+			} else {
+				response, result, err := get(ctx, store, key, conf.New)
+				lookups.With("result", result).Add(1)
+				if err != nil {
+					logger.Log("cache", conf.Method, "op", "get", "err", err)
+				}
+				if result == "hit" {
+					return response, nil
+				}
+			}
+
+			response, err := next(ctx, request)
+			if err != nil || (conf.Cacheable != nil && !conf.Cacheable(response)) {
+				return response, err
+			}
+			if err := set(ctx, store, key, response, conf.TTL); err != nil {
+				logger.Log("cache", conf.Method, "op", "set", "err", err)
+			}
+			return response, nil
+		}
+	}
+}
+
+// 返回缓存的response以及查询结果(hit、miss、error)，缓存的数据无法解析时视为miss
+func get(ctx context.Context, store Store, key string, newResponse func() interface{}) (interface{}, string, error) {
+	b, err := store.Get(ctx, key)
+	if err == ErrMiss {
+		return nil, "miss", nil
+	}
+	if err != nil {
+		return nil, "error", err
+	}
+	response := newResponse()
+	if err := json.Unmarshal(b, response); err != nil {
+		return nil, "miss", err
+	}
+	return response, "hit", nil
+}
+
+func set(ctx context.Context, store Store, key string, response interface{}, ttl time.Duration) error {
+	b, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+	return store.Set(ctx, key, b, ttl)
+}
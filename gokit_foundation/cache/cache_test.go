@@ -0,0 +1,221 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+	"google.golang.org/grpc/metadata"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type memStore struct {
+	mu   sync.Mutex
+	data map[string][]byte
+	ttls map[string]time.Duration
+	err  error
+}
+
+func newMemStore() *memStore {
+	return &memStore{data: map[string][]byte{}, ttls: map[string]time.Duration{}}
+}
+
+func (s *memStore) Get(_ context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return nil, s.err
+	}
+	b, ok := s.data[key]
+	if !ok {
+		return nil, ErrMiss
+	}
+	return b, nil
+}
+
+func (s *memStore) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.data[key] = value
+	s.ttls[key] = ttl
+	return nil
+}
+
+// 记录每次Add的标签
+type labelCounter struct {
+	mu   *sync.Mutex
+	lvs  []string
+	adds *[]string
+}
+
+func newLabelCounter() labelCounter {
+	return labelCounter{mu: &sync.Mutex{}, adds: new([]string)}
+}
+
+func (c labelCounter) With(lvs ...string) metrics.Counter {
+	return labelCounter{mu: c.mu, lvs: append(c.lvs[:len(c.lvs):len(c.lvs)], lvs...), adds: c.adds}
+}
+
+func (c labelCounter) Add(float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	*c.adds = append(*c.adds, strings.Join(c.lvs, ","))
+}
+
+type request struct {
+	A, B string
+}
+
+type response struct {
+	V    string
+	Code int
+}
+
+func TestMiddleware(t *testing.T) {
+	store := newMemStore()
+	lookups := newLabelCounter()
+	calls := 0
+	next := func(_ context.Context, req interface{}) (interface{}, error) {
+		calls++
+		r := req.(request)
+		if r.A == "" {
+			return nil, errors.New("empty")
+		}
+		if r.A == "x" {
+			return &response{Code: 1}, nil
+		}
+		return &response{V: r.A + r.B}, nil
+	}
+	ep := Middleware(store, Config{
+		Method:    "Concat",
+		TTL:       time.Minute,
+		Prefix:    "addsvc:",
+		New:       func() interface{} { return new(response) },
+		Cacheable: func(r interface{}) bool { return r.(*response).Code == 0 },
+	}, log.NewNopLogger(), lookups)(next)
+
+	ctx := context.Background()
+	call := func(ctx context.Context, a, b string) *response {
+		rsp, err := ep(ctx, request{A: a, B: b})
+		if err != nil {
+			return nil
+		}
+		return rsp.(*response)
+	}
+
+	// 第二次命中缓存，不调用next
+	for i := 0; i < 2; i++ {
+		if got := call(ctx, "a", "b"); got == nil || got.V != "ab" {
+			t.Fatalf("#%d got:%+v", i, got)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("got calls:%d want 1", calls)
+	}
+	key, _ := Key("addsvc:", "Concat", request{A: "a", B: "b"})
+	if store.ttls[key] != time.Minute {
+		t.Errorf("got ttl:%v", store.ttls[key])
+	}
+
+	// bypass时调用next并刷新缓存
+	if got := call(WithBypass(ctx), "a", "b"); got == nil || calls != 2 {
+		t.Errorf("bypass got:%+v calls:%d", got, calls)
+	}
+	// err和不可缓存的response不写入缓存
+	call(ctx, "", "b")
+	call(ctx, "x", "b")
+	call(ctx, "x", "b")
+	if calls != 5 || len(store.data) != 1 {
+		t.Errorf("got calls:%d cached:%d", calls, len(store.data))
+	}
+	// store不可用时直接调用next
+	store.err = errors.New("redis down")
+	if got := call(ctx, "a", "b"); got == nil || got.V != "ab" || calls != 6 {
+		t.Errorf("store down got:%+v calls:%d", got, calls)
+	}
+
+	want := []string{
+		"method,Concat,result,miss", "method,Concat,result,hit", "method,Concat,result,bypass",
+		"method,Concat,result,miss", "method,Concat,result,miss", "method,Concat,result,miss",
+		"method,Concat,result,error",
+	}
+	if !reflect.DeepEqual(*lookups.adds, want) {
+		t.Errorf("got lookups:%v", *lookups.adds)
+	}
+}
+
+func TestMiddlewareVary(t *testing.T) {
+	type ctxKey struct{}
+	store := newMemStore()
+	calls := 0
+	next := func(ctx context.Context, req interface{}) (interface{}, error) {
+		calls++
+		sep, _ := ctx.Value(ctxKey{}).(string)
+		r := req.(request)
+		return &response{V: r.A + sep + r.B}, nil
+	}
+	ep := Middleware(store, Config{
+		Method: "Concat",
+		TTL:    time.Minute,
+		New:    func() interface{} { return new(response) },
+		Vary:   func(ctx context.Context) string { s, _ := ctx.Value(ctxKey{}).(string); return s },
+	}, log.NewNopLogger(), nil)(next)
+
+	// Vary不同时使用不同的key，相同时命中
+	ctx := context.Background()
+	for _, c := range []struct{ sep, want string }{{"", "ab"}, {"-", "a-b"}, {"", "ab"}, {"-", "a-b"}} {
+		rsp, err := ep(context.WithValue(ctx, ctxKey{}, c.sep), request{A: "a", B: "b"})
+		if err != nil || rsp.(*response).V != c.want {
+			t.Errorf("sep:%q got:%+v err:%v", c.sep, rsp, err)
+		}
+	}
+	if calls != 2 || len(store.data) != 2 {
+		t.Errorf("got calls:%d cached:%d", calls, len(store.data))
+	}
+}
+
+func TestKey(t *testing.T) {
+	k1, _ := Key("p:", "Sum", map[string]int{"a": 1, "b": 2})
+	k2, _ := Key("p:", "Sum", map[string]int{"b": 2, "a": 1})
+	k3, _ := Key("p:", "Concat", map[string]int{"a": 1, "b": 2})
+	if k1 != k2 || k1 == k3 || !strings.HasPrefix(k1, "p:Sum:") {
+		t.Errorf("got keys:%s %s %s", k1, k2, k3)
+	}
+	if _, err := Key("", "Sum", func() {}); err == nil {
+		t.Error("want err")
+	}
+}
+
+func TestTransport(t *testing.T) {
+	r := httptest.NewRequest("POST", "/concat", nil)
+	r.Header.Set("Cache-Control", "max-age=0, No-Cache")
+	if !BypassFromContext(HTTPToContext()(context.Background(), r)) {
+		t.Error("http want bypass")
+	}
+	r.Header.Set("Cache-Control", "max-age=0")
+	if BypassFromContext(HTTPToContext()(context.Background(), r)) {
+		t.Error("http want no bypass")
+	}
+	r = httptest.NewRequest("POST", "/concat", nil)
+	ContextToHTTP()(WithBypass(context.Background()), r)
+	if !BypassFromContext(HTTPToContext()(context.Background(), r)) {
+		t.Errorf("http client want bypass, header:%v", r.Header)
+	}
+
+	md := metadata.MD{}
+	ContextToGRPC()(WithBypass(context.Background()), &md)
+	if !BypassFromContext(GRPCToContext()(context.Background(), md)) {
+		t.Errorf("grpc want bypass, md:%v", md)
+	}
+	if BypassFromContext(GRPCToContext()(context.Background(), metadata.MD{})) {
+		t.Error("grpc want no bypass")
+	}
+}
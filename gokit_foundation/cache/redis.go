@@ -0,0 +1,27 @@
+package cache
+
+import (
+	"context"
+	"github.com/go-redis/redis"
+	"time"
+)
+
+type RedisStore struct {
+	cli *redis.Client
+}
+
+func NewRedisStore(cli *redis.Client) *RedisStore {
+	return &RedisStore{cli: cli}
+}
+
+func (s *RedisStore) Get(ctx context.Context, key string) ([]byte, error) {
+	b, err := s.cli.WithContext(ctx).Get(key).Bytes()
+	if err == redis.Nil {
+		return nil, ErrMiss
+	}
+	return b, err
+}
+
+func (s *RedisStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return s.cli.WithContext(ctx).Set(key, value, ttl).Err()
+}
@@ -0,0 +1,67 @@
+package cache
+
+import (
+	"context"
+	grpctransport "github.com/go-kit/kit/transport/grpc"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"google.golang.org/grpc/metadata"
+	"net/http"
+	"strings"
+)
+
+// 与http一样，client通过Cache-Control: no-cache跳过缓存，grpc metadata的key是小写的
+const (
+	headerCacheControl = "Cache-Control"
+	noCache            = "no-cache"
+)
+
+func isNoCache(v string) bool {
+	for _, d := range strings.Split(v, ",") {
+		if strings.EqualFold(strings.TrimSpace(d), noCache) {
+			return true
+		}
+	}
+	return false
+}
+
+// HTTPToContext 请求header中有Cache-Control: no-cache时跳过缓存，用于httptransport.ServerBefore
+func HTTPToContext() httptransport.RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		if isNoCache(r.Header.Get(headerCacheControl)) {
+			return WithBypass(ctx)
+		}
+		return ctx
+	}
+}
+
+// GRPCToContext 与HTTPToContext相同，从metadata中读取，用于grpctransport.ServerBefore
+func GRPCToContext() grpctransport.ServerRequestFunc {
+	return func(ctx context.Context, md metadata.MD) context.Context {
+		for _, v := range md.Get(headerCacheControl) {
+			if isNoCache(v) {
+				return WithBypass(ctx)
+			}
+		}
+		return ctx
+	}
+}
+
+// ContextToGRPC ctx中设置了bypass时在metadata中写入cache-control: no-cache，用于grpctransport.ClientBefore
+func ContextToGRPC() grpctransport.ClientRequestFunc {
+	return func(ctx context.Context, md *metadata.MD) context.Context {
+		if BypassFromContext(ctx) {
+			md.Set(headerCacheControl, noCache)
+		}
+		return ctx
+	}
+}
+
+// ContextToHTTP 与ContextToGRPC相同，写入header，用于httptransport.ClientBefore
+func ContextToHTTP() httptransport.RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		if BypassFromContext(ctx) {
+			r.Header.Set(headerCacheControl, noCache)
+		}
+		return ctx
+	}
+}
@@ -0,0 +1,163 @@
+package chaos
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-kit/kit/endpoint"
+	"gokit_foundation/errs"
+	"math/rand"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+/*
+故障注入，按比例让接口变慢、返回错误或panic，用于演示断路器、client重试、超时等在故障下的表现：
+-	Injector.Middleware安装在endpoint的最内层，注入的延迟会被超时中间件截断，注入的错误会被断路器统计
+-	故障配置按接口名设置，可以来自配置文件(如new_addsvc的dynamic配置中的chaos)，也可以在运行时通过Injector.Handler修改
+-	注入的错误为errs.Unavailable，client可重试
+注意：注入的panic需要被recover，Middleware之外应安装gokit_foundation.RecoveryMiddleware，
+否则NATS、thrift等transport层没有recover的调用发生panic会导致进程退出
+*/
+
+var ErrInjected = errs.Unavailable("chaos: injected failure")
+
+// Fault 一个接口的故障配置，各项独立按比例(0~1)触发，零值表示不注入
+type Fault struct {
+	Latency     time.Duration // 注入的延迟
+	LatencyRate float64
+	ErrorRate   float64
+	PanicRate   float64
+}
+
+func (f Fault) Validate() error {
+	if f.Latency < 0 {
+		return fmt.Errorf("chaos: negative latency %v", f.Latency)
+	}
+	for name, r := range map[string]float64{"latency_rate": f.LatencyRate, "error_rate": f.ErrorRate, "panic_rate": f.PanicRate} {
+		if r < 0 || r > 1 {
+			return fmt.Errorf("chaos: %s %v must be in [0, 1]", name, r)
+		}
+	}
+	return nil
+}
+
+// json中latency为time.ParseDuration格式的字符串，如"200ms"
+type faultJSON struct {
+	Latency     string  `json:"latency,omitempty"`
+	LatencyRate float64 `json:"latency_rate,omitempty"`
+	ErrorRate   float64 `json:"error_rate,omitempty"`
+	PanicRate   float64 `json:"panic_rate,omitempty"`
+}
+
+func (f Fault) MarshalJSON() ([]byte, error) {
+	j := faultJSON{LatencyRate: f.LatencyRate, ErrorRate: f.ErrorRate, PanicRate: f.PanicRate}
+	if f.Latency > 0 {
+		j.Latency = f.Latency.String()
+	}
+	return json.Marshal(j)
+}
+
+func (f *Fault) UnmarshalJSON(b []byte) error {
+	var j faultJSON
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+	*f = Fault{LatencyRate: j.LatencyRate, ErrorRate: j.ErrorRate, PanicRate: j.PanicRate}
+	if j.Latency != "" {
+		d, err := time.ParseDuration(j.Latency)
+		if err != nil {
+			return fmt.Errorf("chaos: invalid latency %q", j.Latency)
+		}
+		f.Latency = d
+	}
+	return nil
+}
+
+type Injector struct {
+	faults atomic.Value // map[string]Fault，整体替换，不修改
+}
+
+func NewInjector() *Injector {
+	i := &Injector{}
+	i.faults.Store(map[string]Fault{})
+	return i
+}
+
+// Set 替换全部接口的故障配置，faults为空时停止注入
+func (i *Injector) Set(faults map[string]Fault) error {
+	cp := make(map[string]Fault, len(faults))
+	for method, f := range faults {
+		if err := f.Validate(); err != nil {
+			return fmt.Errorf("%s: %v", method, err)
+		}
+		cp[method] = f
+	}
+	i.faults.Store(cp)
+	return nil
+}
+
+// Faults 当前的故障配置，不要修改返回的map
+func (i *Injector) Faults() map[string]Fault {
+	return i.faults.Load().(map[string]Fault)
+}
+
+// Middleware 每次调用时读取method的当前配置
+func (i *Injector) Middleware(method string) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			f, ok := i.Faults()[method]
+			if !ok {
+				return next(ctx, request)
+			}
+			if f.PanicRate > 0 && rand.Float64() < f.PanicRate {
+				panic("chaos: injected panic in " + method)
+			}
+			if f.Latency > 0 && f.LatencyRate > 0 && rand.Float64() < f.LatencyRate {
+				t := time.NewTimer(f.Latency)
+				select {
+				case <-ctx.Done():
+					t.Stop()
+					return nil, ctx.Err()
+				case <-t.C:
+				}
+			}
+			if f.ErrorRate > 0 && rand.Float64() < f.ErrorRate {
+				return nil, ErrInjected
+			}
+			return next(ctx, request)
+		}
+	}
+}
+
+// Handler 运行时查看/修改故障配置，安装在管理用的http端口上：
+//
+//	GET /chaos                                                     返回当前配置
+//	PUT /chaos -d '{"Sum": {"latency": "300ms", "latency_rate": 0.5}}' 替换全部配置
+//	DELETE /chaos                                                  停止注入
+func (i *Injector) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut, http.MethodPost:
+			var faults map[string]Fault
+			if err := json.NewDecoder(r.Body).Decode(&faults); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := i.Set(faults); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		case http.MethodDelete:
+			_ = i.Set(nil)
+		default:
+			w.Header().Set("Allow", "GET, PUT, POST, DELETE")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(i.Faults())
+	})
+}
@@ -0,0 +1,88 @@
+package chaos
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func ok(context.Context, interface{}) (interface{}, error) { return "ok", nil }
+
+func TestMiddleware(t *testing.T) {
+	inj := NewInjector()
+	ep := inj.Middleware("Sum")(ok)
+	if rsp, err := ep(context.Background(), nil); err != nil || rsp != "ok" {
+		t.Fatalf("no fault got rsp:%v err:%v", rsp, err)
+	}
+
+	_ = inj.Set(map[string]Fault{"Sum": {ErrorRate: 1}})
+	if _, err := ep(context.Background(), nil); err != ErrInjected {
+		t.Errorf("error_rate 1 got err:%v", err)
+	}
+	// 其他接口不受影响
+	if _, err := inj.Middleware("Concat")(ok)(context.Background(), nil); err != nil {
+		t.Errorf("Concat got err:%v", err)
+	}
+
+	// 延迟被ctx的deadline截断
+	_ = inj.Set(map[string]Fault{"Sum": {Latency: time.Second, LatencyRate: 1}})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := ep(ctx, nil); err != context.DeadlineExceeded || time.Since(start) > 500*time.Millisecond {
+		t.Errorf("latency got err:%v cost:%v", err, time.Since(start))
+	}
+
+	_ = inj.Set(map[string]Fault{"Sum": {PanicRate: 1}})
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("panic_rate 1 want panic")
+			}
+		}()
+		_, _ = ep(context.Background(), nil)
+	}()
+}
+
+func TestSetInvalid(t *testing.T) {
+	inj := NewInjector()
+	_ = inj.Set(map[string]Fault{"Sum": {ErrorRate: 0.5}})
+	for _, f := range []Fault{{ErrorRate: 2}, {PanicRate: -0.1}, {Latency: -time.Second}} {
+		if err := inj.Set(map[string]Fault{"Sum": f}); err == nil {
+			t.Errorf("%+v want err", f)
+		}
+	}
+	// 非法配置不生效
+	if f := inj.Faults()["Sum"]; f.ErrorRate != 0.5 {
+		t.Errorf("got:%+v", f)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	inj := NewInjector()
+	h := inj.Handler()
+	do := func(method, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, "/chaos", strings.NewReader(body)))
+		return w
+	}
+
+	w := do(http.MethodPut, `{"Sum": {"latency": "300ms", "latency_rate": 0.5, "error_rate": 0.1}}`)
+	if f := inj.Faults()["Sum"]; w.Code != http.StatusOK || f.Latency != 300*time.Millisecond || f.LatencyRate != 0.5 || f.ErrorRate != 0.1 {
+		t.Fatalf("put got code:%d fault:%+v", w.Code, f)
+	}
+	if w := do(http.MethodGet, ""); !strings.Contains(w.Body.String(), `"latency":"300ms"`) {
+		t.Errorf("get got:%s", w.Body.String())
+	}
+	for _, body := range []string{`{"Sum": {"latency": "abc"}}`, `{"Sum": {"error_rate": 3}}`, `[]`} {
+		if w := do(http.MethodPut, body); w.Code != http.StatusBadRequest {
+			t.Errorf("body:%s got code:%d", body, w.Code)
+		}
+	}
+	if w := do(http.MethodDelete, ""); w.Code != http.StatusOK || len(inj.Faults()) != 0 {
+		t.Errorf("delete got code:%d faults:%v", w.Code, inj.Faults())
+	}
+}
@@ -0,0 +1,25 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFake(t *testing.T) {
+	start := time.Date(2020, 10, 1, 8, 0, 0, 0, time.UTC)
+	f := NewFake(start)
+	if !f.Now().Equal(start) || f.Since(start) != 0 {
+		t.Fatalf("got now:%v", f.Now())
+	}
+	f.Advance(90 * time.Second)
+	if f.Since(start) != 90*time.Second {
+		t.Errorf("got since:%v", f.Since(start))
+	}
+	f.Set(start)
+	if !f.Now().Equal(start) {
+		t.Errorf("got now:%v", f.Now())
+	}
+	if OrReal(nil) != Real || OrReal(f) != Clock(f) {
+		t.Error("OrReal")
+	}
+}
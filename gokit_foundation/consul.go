@@ -1,30 +1,105 @@
 package gokit_foundation
 
 import (
+	"context"
 	"fmt"
 	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
 	"github.com/go-kit/kit/sd/consul"
 	stdconsul "github.com/hashicorp/consul/api"
 	"go-util/_util"
 	"net/http"
 	"os"
+	"strings"
+	"sync"
 	"time"
 )
 
 var DefaultRegister *consul.Registrar
 
+// 注销时需要使用注册时的client和registration（Registrar.Deregister不会返回err，所以这里保存一份直接调用）
+var (
+	defConsulClient consul.Client
+	defRegistration *stdconsul.AgentServiceRegistration
+	// 使用TTL检查时由ConsulKeepRegistered上报状态
+	defTTLUpdater consulTTLUpdater
+	defTTLStatus  func(ctx context.Context) error
+	// 见ConsulRegisterOptions.Reregistrations
+	defReregistrations metrics.Counter = discard.NewCounter()
+	// ConsulSetWeight修改defRegistration.Weights，与consulReassert的重新注册互斥
+	defRegistrationMu sync.Mutex
+	// 见ConsulRegisterOptions.Aliases，与defRegistration一起注册、注销
+	defAliases []*stdconsul.AgentServiceRegistration
+)
+
+// stdconsul.Agent实现了它
+type consulTTLUpdater interface {
+	UpdateTTL(checkID, output, status string) error
+}
+
+// ConsulRegisterOptions 注册到consul时的可选项，见RegisterSvcWithOptions
+type ConsulRegisterOptions struct {
+	// 如version=v1.2.0、zone=cn-sh-a，client可以按tag筛选实例(见consul.NewInstancer的tags)
+	Tags []string
+	// 实例的元数据(版本、可用区、构建信息等)，不参与筛选，key只能包含字母、数字、-和_
+	Meta map[string]string
+	// 健康状态为passing时的权重(DNS SRV、按权重负载均衡的client使用)，为0时使用consul的默认值1，warning时固定为1
+	Weight int
+	// 大于0时使用TTL检查代替grpc健康检查：由ConsulKeepRegistered每CheckTTL/3上报一次，超过CheckTTL没有上报时为critical，
+	// 适用于consul agent访问不到实例地址的部署(如NAT、跨网络的容器)，进程卡住(而不是退出)时也能被发现
+	CheckTTL time.Duration
+	// 使用TTL检查时每次上报前调用，返回err时上报critical(输出为err)，为nil时总是passing；
+	// 一般为HealthCheckServer的依赖检查，与grpc健康检查的结果一致
+	TTLStatus func(ctx context.Context) error
+	// 发现注册信息丢失(如本地consul agent重启)后重新注册的次数，labels: result(ok、failed)，为nil时不统计
+	Reregistrations metrics.Counter
+	// 同一个实例再以其他服务名注册(如蓝绿部署时的NewAddSvc-blue)，地址、meta、权重与主注册相同，
+	// 健康状态跟随主注册(consul的alias检查)，不需要单独的健康检查或心跳
+	Aliases []ConsulAlias
+}
+
+// ConsulAlias 见ConsulRegisterOptions.Aliases，Tags不包括主注册的tag
+type ConsulAlias struct {
+	Name string
+	Tags []string
+}
+
 // protocol-svc_name-addr, e.g. grpc-UserServer-127.0.0.1:8888
 const consulSvcIDFormat = "%s-%s-%s:%d"
 
 func MustRegisterSvc(svcName, svcHost string, port int, tags []string) {
+	err := RegisterSvc(svcName, svcHost, port, tags)
+	_util.PanicIfErr(err, nil)
+}
+
+func RegisterSvc(svcName, svcHost string, port int, tags []string) error {
+	return RegisterSvcWithOptions(svcName, svcHost, port, ConsulRegisterOptions{Tags: tags})
+}
+
+func RegisterSvcWithOptions(svcName, svcHost string, port int, opts ConsulRegisterOptions) error {
+	reg := consulRegistration(svcName, svcHost, port, opts)
+	if err := RegisterWithConsul(reg, consulAliasRegistrations(reg, opts.Aliases)...); err != nil {
+		return err
+	}
+	defTTLStatus = opts.TTLStatus
+	if opts.Reregistrations != nil {
+		defReregistrations = opts.Reregistrations
+	}
+	return nil
+}
+
+func consulRegistration(svcName, svcHost string, port int, opts ConsulRegisterOptions) *stdconsul.AgentServiceRegistration {
 	// consul agent配置，根据实际的填写
-	tags = append(tags, "gokit_svc")
+	tags := append(append([]string{}, opts.Tags...), "gokit_svc")
+	id := fmt.Sprintf(consulSvcIDFormat, "grpc", svcName, svcHost, port)
 	reg := &stdconsul.AgentServiceRegistration{
-		ID:                fmt.Sprintf(consulSvcIDFormat, "grpc", svcName, svcHost, port),
+		ID:                id,
 		Name:              svcName,
 		Tags:              tags,
 		Port:              port,
 		Address:           svcHost,
+		Meta:              opts.Meta,
 		EnableTagOverride: false,
 		// 配置实例本身的健康检查
 		Check: &stdconsul.AgentServiceCheck{
@@ -33,24 +108,73 @@ func MustRegisterSvc(svcName, svcHost string, port int, tags []string) {
 			Timeout:                        "5s",
 			Interval:                       "5s",
 			DeregisterCriticalServiceAfter: "15s", //check失败后多久删除本服务（位于consul中的服务条目）
+			GRPCUseTLS:                     ConsulCheckTLS,
+			TLSSkipVerify:                  ConsulCheckTLS,
 		},
 	}
-	err := RegisterWithConsul(reg)
-	_util.PanicIfErr(err, nil)
+	if opts.Weight > 0 {
+		reg.Weights = &stdconsul.AgentWeights{Passing: opts.Weight, Warning: 1}
+	}
+	if opts.CheckTTL > 0 {
+		deregisterAfter := 15 * time.Second
+		if d := 3 * opts.CheckTTL; d > deregisterAfter {
+			deregisterAfter = d
+		}
+		reg.Check = &stdconsul.AgentServiceCheck{
+			CheckID:                        id + ":ttl",
+			TTL:                            opts.CheckTTL.String(),
+			DeregisterCriticalServiceAfter: deregisterAfter.String(),
+		}
+	}
+	return reg
+}
+
+// 别名的ID为grpc-<alias>-addr，检查为alias检查(状态与主注册的所有检查一致)
+func consulAliasRegistrations(reg *stdconsul.AgentServiceRegistration, aliases []ConsulAlias) []*stdconsul.AgentServiceRegistration {
+	var regs []*stdconsul.AgentServiceRegistration
+	for _, a := range aliases {
+		regs = append(regs, &stdconsul.AgentServiceRegistration{
+			ID:      fmt.Sprintf(consulSvcIDFormat, "grpc", a.Name, reg.Address, reg.Port),
+			Name:    a.Name,
+			Tags:    append(append([]string{}, a.Tags...), "gokit_svc"),
+			Port:    reg.Port,
+			Address: reg.Address,
+			Meta:    reg.Meta,
+			Weights: reg.Weights,
+			Check: &stdconsul.AgentServiceCheck{
+				AliasService:                   reg.ID,
+				DeregisterCriticalServiceAfter: reg.Check.DeregisterCriticalServiceAfter,
+			},
+		})
+	}
+	return regs
 }
 
-func RegisterWithConsul(svcRegistration *stdconsul.AgentServiceRegistration) error {
+// grpc server启用TLS时设为true，consul的grpc健康检查使用TLS(不校验server证书)
+// server要求client证书(mTLS)时，consul agent还需要配置自己的证书(agent的tls配置)，否则检查失败
+var ConsulCheckTLS bool
+
+// consul agent地址，为空时读取环境变量CONSUL_ADDR，仍为空时使用127.0.0.1:8500
+var ConsulAddr string
+
+func consulAddr() string {
+	if ConsulAddr != "" {
+		return ConsulAddr
+	}
+	if addr := os.Getenv("CONSUL_ADDR"); addr != "" {
+		return addr
+	}
+	return "127.0.0.1:8500"
+}
+
+// RegisterWithConsul aliases在svcRegistration之后注册，见ConsulRegisterOptions.Aliases
+func RegisterWithConsul(svcRegistration *stdconsul.AgentServiceRegistration, aliases ...*stdconsul.AgentServiceRegistration) error {
 	if DefaultRegister != nil {
 		return nil
 	}
-	consulAddr := os.Getenv("CONSUL_ADDR")
-	if consulAddr == "" {
-		//panic(fmt.Sprintf("%s CONSUL_ADDR not set", time.Now().String()[:19]))
-		consulAddr = "127.0.0.1:8500"
-	}
 	// 这个client是针对consul，不是服务
 	consulClient, err := stdconsul.NewClient(&stdconsul.Config{
-		Address: consulAddr,
+		Address: consulAddr(),
 		HttpClient: &http.Client{
 			Timeout: time.Second * 2,
 		},
@@ -60,17 +184,217 @@ func RegisterWithConsul(svcRegistration *stdconsul.AgentServiceRegistration) err
 		return err
 	}
 
-	kitConsulClient := consul.NewClient(consulClient)
+	if err = registerWithClient(consul.NewClient(consulClient), svcRegistration, aliases...); err != nil {
+		return err
+	}
+	defTTLUpdater = consulClient.Agent()
+	return nil
+}
+
+func registerWithClient(kitConsulClient consul.Client, svcRegistration *stdconsul.AgentServiceRegistration, aliases ...*stdconsul.AgentServiceRegistration) error {
 	logger := log.NewLogfmtLogger(os.Stderr)
 
+	// Registrar.Register只打印注册失败的err，不会返回，所以这里直接调用client注册
+	if err := kitConsulClient.Register(svcRegistration); err != nil {
+		return err
+	}
+	// 别名注册失败时注销已注册的，不留下一半的注册信息
+	for i, a := range aliases {
+		if err := kitConsulClient.Register(a); err != nil {
+			for _, r := range append(aliases[:i:i], svcRegistration) {
+				_ = kitConsulClient.Deregister(r)
+			}
+			return err
+		}
+	}
 	registrar := consul.NewRegistrar(kitConsulClient, svcRegistration, log.With(logger, "component", "register"))
-	registrar.Register()
 	DefaultRegister = registrar
+	defConsulClient = kitConsulClient
+	defRegistration = svcRegistration
+	defAliases = aliases
 	return nil
 }
 
-func ConsulDeregister() {
-	if DefaultRegister != nil {
-		DefaultRegister.Deregister()
+// 先注销别名再注销主注册，别名的alias检查不会因为主注册不存在而变为critical；重试时已注销的再次注销也会成功
+func ConsulDeregister() error {
+	if defConsulClient == nil || defRegistration == nil {
+		return nil
+	}
+	for _, a := range defAliases {
+		if err := defConsulClient.Deregister(a); err != nil {
+			return err
+		}
+	}
+	return defConsulClient.Deregister(defRegistration)
+}
+
+// ConsulSetWeight 修改已注册实例passing时的权重(重新注册，warning时仍为1)，之后重新注册(见ConsulKeepRegistered)也使用新的权重；
+// 用于平滑升级后的预热：新进程先以较低的权重注册，缓存、连接池预热后再恢复(见Upgrader)
+func ConsulSetWeight(passing int) error {
+	if defConsulClient == nil || defRegistration == nil {
+		return nil
+	}
+	defRegistrationMu.Lock()
+	defer defRegistrationMu.Unlock()
+	prev := defRegistration.Weights
+	regs := append([]*stdconsul.AgentServiceRegistration{defRegistration}, defAliases...)
+	for _, reg := range regs {
+		reg.Weights = &stdconsul.AgentWeights{Passing: passing, Warning: 1}
+		if err := defConsulClient.Register(reg); err != nil {
+			// 恢复为之前的权重，调用方重试时全部重新注册
+			for _, r := range regs {
+				r.Weights = prev
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// 见DeregisterWithRetry
+func ConsulDeregisterWithRetry(logger log.Logger, retry int, backoff time.Duration) error {
+	return DeregisterWithRetry(consulRegistry{}, logger, retry, backoff)
+}
+
+// 定期检查本实例是否还在consul中，consul agent重启等情况下注册信息可能丢失，此时重新注册，直到ctx结束
+// interval为检查间隔，检查或重新注册失败时从backoff开始翻倍等待(不超过interval)后重试
+// 使用TTL检查时同时启动心跳goroutine(见ConsulRegisterOptions.CheckTTL)，返回前等待它退出；
+// 心跳上报失败(agent重启后check不存在)时立即检查，不用等到下一个interval
+func ConsulKeepRegistered(ctx context.Context, logger log.Logger, interval, backoff time.Duration) error {
+	if defConsulClient == nil || defRegistration == nil {
+		return nil
+	}
+	lost := make(chan struct{}, 1)
+	if checkID, ttl, ok := consulTTLCheck(); ok && defTTLUpdater != nil {
+		ctx, cancel := context.WithCancel(ctx)
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			consulHeartbeat(ctx, logger, checkID, ttl/3, lost)
+		}()
+		defer wg.Wait()
+		defer cancel()
+	}
+	wait, nextBackoff := interval, backoff
+	for {
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		case <-lost:
+			timer.Stop()
+		}
+		if err := consulReassert(logger); err != nil {
+			wait = nextBackoff
+			if nextBackoff *= 2; nextBackoff > interval {
+				nextBackoff = interval
+			}
+			logger.Log("ConsulKeepRegistered", "failed", "svc_id", defRegistration.ID, "err", err, "retry_after", wait)
+			continue
+		}
+		wait, nextBackoff = interval, backoff
+	}
+}
+
+func consulReassert(logger log.Logger) error {
+	defRegistrationMu.Lock()
+	defer defRegistrationMu.Unlock()
+	// 先检查主注册，别名的alias检查依赖它
+	for _, reg := range append([]*stdconsul.AgentServiceRegistration{defRegistration}, defAliases...) {
+		if err := consulReassertOne(logger, reg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func consulReassertOne(logger log.Logger, reg *stdconsul.AgentServiceRegistration) error {
+	entries, _, err := defConsulClient.Service(reg.Name, "", false, nil)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.Service != nil && e.Service.ID == reg.ID {
+			return nil
+		}
+	}
+	logger.Log("ConsulKeepRegistered", "registration lost, re-register", "svc_id", reg.ID)
+	if err = defConsulClient.Register(reg); err != nil {
+		defReregistrations.With("result", "failed").Add(1)
+		return err
+	}
+	defReregistrations.With("result", "ok").Add(1)
+	logger.Log("ConsulKeepRegistered", "re-registered", "svc_id", reg.ID)
+	return nil
+}
+
+// ConsulSelfCheck 从consul查询本实例的健康检查结果，没有注册或不是passing时返回err(带上未通过的检查的output)
+// 本地的健康检查正常而consul的检查失败(如advertise地址不可达、agent的TLS配置不对)时实例不会被发现，用于定期自检
+func ConsulSelfCheck(ctx context.Context) error {
+	if defConsulClient == nil || defRegistration == nil {
+		return nil
+	}
+	defRegistrationMu.Lock()
+	name, id := defRegistration.Name, defRegistration.ID
+	defRegistrationMu.Unlock()
+	entries, _, err := defConsulClient.Service(name, "", false, (&stdconsul.QueryOptions{}).WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.Service == nil || e.Service.ID != id {
+			continue
+		}
+		status := e.Checks.AggregatedStatus()
+		if status == stdconsul.HealthPassing {
+			return nil
+		}
+		var failed []string
+		for _, c := range e.Checks {
+			if c.Status != stdconsul.HealthPassing {
+				failed = append(failed, fmt.Sprintf("%s(%s): %s", c.Name, c.Status, c.Output))
+			}
+		}
+		return fmt.Errorf("consul: %s is %s: %s", id, status, strings.Join(failed, "; "))
+	}
+	return fmt.Errorf("consul: %s is not registered", id)
+}
+
+func consulTTLCheck() (checkID string, ttl time.Duration, ok bool) {
+	if c := defRegistration.Check; c != nil && c.TTL != "" {
+		ttl, err := time.ParseDuration(c.TTL)
+		return c.CheckID, ttl, err == nil && ttl > 0
+	}
+	return "", 0, false
+}
+
+// 立即上报一次，之后每interval上报一次直到ctx结束；上报失败(如注册信息丢失)时通知lost，由consulReassert重新注册
+func consulHeartbeat(ctx context.Context, logger log.Logger, checkID string, interval time.Duration, lost chan<- struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		status, output := stdconsul.HealthPassing, "ok"
+		if defTTLStatus != nil {
+			checkCtx, cancel := context.WithTimeout(ctx, interval)
+			if err := defTTLStatus(checkCtx); err != nil {
+				status, output = stdconsul.HealthCritical, err.Error()
+			}
+			cancel()
+		}
+		if err := defTTLUpdater.UpdateTTL(checkID, output, status); err != nil {
+			logger.Log("ConsulHeartbeat", "failed", "check_id", checkID, "err", err)
+			select {
+			case lost <- struct{}{}:
+			default:
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
 	}
 }
@@ -0,0 +1,174 @@
+package gokit_foundation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	stdconsul "github.com/hashicorp/consul/api"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+/*
+监听consul KV中某个prefix下的所有key，用于运行时调整的配置(限速、开关、日志级别等)，修改后不需要重启服务：
+-	Watch通过blocking query等待变化，每次变化以prefix下完整的快照回调
+-	DecodeConsulKV将快照解码到类型化的结构体，key(去掉prefix)按/分层对应结构体的json字段
+	e.g. prefix为addsvc/dynamic/时，addsvc/dynamic/log_level = info、addsvc/dynamic/rate_limits/Sum = {"rps": 10}
+	等价于 {"log_level": "info", "rate_limits": {"Sum": {"rps": 10}}}
+*/
+
+// consul KV的查询接口，*stdconsul.KV实现了它，测试时可以替换
+type consulKV interface {
+	List(prefix string, q *stdconsul.QueryOptions) (stdconsul.KVPairs, *stdconsul.QueryMeta, error)
+}
+
+type ConsulKVWatcher struct {
+	kv     consulKV
+	prefix string
+	logger log.Logger
+	// 每次blocking query最长等待的时间，超时后没有变化则重新发起
+	WaitTime time.Duration
+
+	index uint64
+	last  map[string][]byte
+}
+
+// NewConsulKVWatcher consul地址见ConsulAddr，prefix不以/结尾时自动加上，避免匹配到addsvc/dynamic2/这样的key
+func NewConsulKVWatcher(prefix string, logger log.Logger) (*ConsulKVWatcher, error) {
+	const waitTime = time.Minute
+	cli, err := stdconsul.NewClient(&stdconsul.Config{
+		Address: consulAddr(),
+		// 需要大于blocking query的等待时间
+		HttpClient: &http.Client{Timeout: waitTime + 10*time.Second},
+		Scheme:     "http",
+	})
+	if err != nil {
+		return nil, err
+	}
+	w := newConsulKVWatcher(cli.KV(), prefix, logger)
+	w.WaitTime = waitTime
+	return w, nil
+}
+
+func newConsulKVWatcher(kv consulKV, prefix string, logger log.Logger) *ConsulKVWatcher {
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return &ConsulKVWatcher{kv: kv, prefix: prefix, logger: logger, WaitTime: time.Minute}
+}
+
+func (w *ConsulKVWatcher) Prefix() string {
+	return w.prefix
+}
+
+// Get 读取prefix下的所有key(去掉prefix)，同时作为Watch的起点，之后Watch只在发生变化时回调
+// 一般在启动时调用，读取失败时由调用方决定是否继续启动
+func (w *ConsulKVWatcher) Get(ctx context.Context) (map[string][]byte, error) {
+	kv, index, err := w.list(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+	w.index, w.last = index, kv
+	return kv, nil
+}
+
+// Watch 等待prefix下的key发生变化(增删改)，每次以完整的快照调用onChange，直到ctx结束
+// 没有调用过Get时首次读取成功后立即回调一次
+// 出错时从100ms开始翻倍等待(不超过5s)后重试，期间不会回调，已生效的配置保持不变
+func (w *ConsulKVWatcher) Watch(ctx context.Context, onChange func(kv map[string][]byte)) error {
+	backoff := 100 * time.Millisecond
+	for {
+		kv, index, err := w.list(ctx, w.index)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			w.logger.Log("ConsulKVWatcher", "failed", "prefix", w.prefix, "err", err, "retry_after", backoff)
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(backoff):
+			}
+			if backoff *= 2; backoff > 5*time.Second {
+				backoff = 5 * time.Second
+			}
+			continue
+		}
+		backoff = 100 * time.Millisecond
+		// index变小(如consul重建数据)时需要从0重新开始，见consul blocking query的文档
+		if index < w.index {
+			index = 0
+		}
+		w.index = index
+		// 超时返回或prefix外的key变化时index也会变，内容不变时不回调
+		if w.last != nil && reflect.DeepEqual(kv, w.last) {
+			continue
+		}
+		w.last = kv
+		onChange(kv)
+	}
+}
+
+func (w *ConsulKVWatcher) list(ctx context.Context, waitIndex uint64) (map[string][]byte, uint64, error) {
+	q := &stdconsul.QueryOptions{WaitIndex: waitIndex, WaitTime: w.WaitTime}
+	pairs, meta, err := w.kv.List(w.prefix, q.WithContext(ctx))
+	if err != nil {
+		return nil, 0, err
+	}
+	kv := make(map[string][]byte, len(pairs))
+	for _, p := range pairs {
+		key := strings.TrimPrefix(p.Key, w.prefix)
+		// 目录(在consul UI中创建的以/结尾的key)
+		if key == "" || strings.HasSuffix(key, "/") {
+			continue
+		}
+		kv[key] = p.Value
+	}
+	return kv, meta.LastIndex, nil
+}
+
+// DecodeConsulKV 将Watch/Get返回的快照解码到v(结构体指针)，未出现的字段保持v中原来的值，map按key合并
+// value是合法的JSON时按JSON解析，否则作为字符串，所以字符串字段可以直接写 info 而不是 "info"
+// 出现v中没有的字段时返回err，避免拼写错误的key被静默忽略
+func DecodeConsulKV(kv map[string][]byte, v interface{}) error {
+	tree := map[string]interface{}{}
+	for key, value := range kv {
+		parts := strings.Split(key, "/")
+		node := tree
+		for _, p := range parts[:len(parts)-1] {
+			child, ok := node[p].(map[string]interface{})
+			if !ok {
+				if _, exist := node[p]; exist {
+					return fmt.Errorf("consul kv: %s conflicts with %s", key, strings.Join(parts[:len(parts)-1], "/"))
+				}
+				child = map[string]interface{}{}
+				node[p] = child
+			}
+			node = child
+		}
+		leaf := parts[len(parts)-1]
+		if _, exist := node[leaf]; exist {
+			return fmt.Errorf("consul kv: %s conflicts with keys under it", key)
+		}
+		value = bytes.TrimSpace(value)
+		if json.Valid(value) {
+			node[leaf] = json.RawMessage(value)
+		} else {
+			node[leaf] = string(value)
+		}
+	}
+	b, err := json.Marshal(tree)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(v); err != nil {
+		return fmt.Errorf("consul kv: %v", err)
+	}
+	return nil
+}
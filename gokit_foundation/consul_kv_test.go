@@ -0,0 +1,166 @@
+package gokit_foundation
+
+import (
+	"context"
+	"errors"
+	"github.com/go-kit/kit/log"
+	stdconsul "github.com/hashicorp/consul/api"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 模拟consul KV的blocking query，WaitIndex与当前index相同时等待变化或WaitTime超时
+type memConsulKV struct {
+	mu      sync.Mutex
+	changed chan struct{}
+	index   uint64
+	pairs   map[string]string
+	fail    int // 接下来的几次查询失败
+}
+
+func newMemConsulKV() *memConsulKV {
+	return &memConsulKV{changed: make(chan struct{}), index: 1, pairs: map[string]string{}}
+}
+
+func (m *memConsulKV) put(key, value string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pairs[key] = value
+	m.index++
+	close(m.changed)
+	m.changed = make(chan struct{})
+}
+
+func (m *memConsulKV) List(prefix string, q *stdconsul.QueryOptions) (stdconsul.KVPairs, *stdconsul.QueryMeta, error) {
+	m.mu.Lock()
+	if m.fail > 0 {
+		m.fail--
+		m.mu.Unlock()
+		return nil, nil, errors.New("fake consul: unavailable")
+	}
+	if q.WaitIndex == m.index {
+		changed := m.changed
+		m.mu.Unlock()
+		select {
+		case <-changed:
+		case <-time.After(q.WaitTime):
+		case <-q.Context().Done():
+			return nil, nil, q.Context().Err()
+		}
+		m.mu.Lock()
+	}
+	defer m.mu.Unlock()
+	var pairs stdconsul.KVPairs
+	for k, v := range m.pairs {
+		if strings.HasPrefix(k, prefix) {
+			pairs = append(pairs, &stdconsul.KVPair{Key: k, Value: []byte(v)})
+		}
+	}
+	return pairs, &stdconsul.QueryMeta{LastIndex: m.index}, nil
+}
+
+func TestConsulKVWatcher(t *testing.T) {
+	kv := newMemConsulKV()
+	kv.put("svc/dynamic/", "") // 目录
+	kv.put("svc/dynamic/log_level", "info")
+	kv.put("svc/dynamic2/log_level", "error")
+	w := newConsulKVWatcher(kv, "svc/dynamic", log.NewNopLogger())
+	w.WaitTime = time.Millisecond * 20
+
+	got, err := w.Get(context.Background())
+	if err != nil || !reflect.DeepEqual(got, map[string][]byte{"log_level": []byte("info")}) {
+		t.Fatalf("Get got:%s err:%v", got, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	changes := make(chan map[string][]byte, 10)
+	done := make(chan error)
+	go func() { done <- w.Watch(ctx, func(kv map[string][]byte) { changes <- kv }) }()
+
+	// 等待超时以及prefix外的变化都不回调
+	time.Sleep(time.Millisecond * 50)
+	kv.put("other/key", "1")
+	select {
+	case c := <-changes:
+		t.Fatalf("unexpected change:%s", c)
+	case <-time.After(time.Millisecond * 50):
+	}
+
+	// 查询失败后重试，恢复后仍能收到变化
+	kv.mu.Lock()
+	kv.fail = 2
+	kv.mu.Unlock()
+	kv.put("svc/dynamic/rate_limits/Sum", `{"rps": 10}`)
+	select {
+	case c := <-changes:
+		if string(c["rate_limits/Sum"]) != `{"rps": 10}` || len(c) != 2 {
+			t.Errorf("got change:%s", c)
+		}
+	case <-time.After(time.Second * 2):
+		t.Fatal("change not received")
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Watch not return after ctx done")
+	}
+}
+
+func TestDecodeConsulKV(t *testing.T) {
+	type limit struct {
+		RPS   float64 `json:"rps"`
+		Burst int     `json:"burst"`
+	}
+	type conf struct {
+		LogLevel   string           `json:"log_level"`
+		Enabled    bool             `json:"enabled"`
+		RateLimits map[string]limit `json:"rate_limits"`
+	}
+	def := func() conf {
+		return conf{LogLevel: "debug", RateLimits: map[string]limit{"Sum": {RPS: 100}, "Concat": {RPS: 50}}}
+	}
+
+	test := []struct {
+		name    string
+		kv      map[string]string
+		want    conf
+		wantErr string
+	}{
+		{name: "[empty]", want: def()},
+		{name: "[plain string and bool]", kv: map[string]string{"log_level": "info", "enabled": "true"},
+			want: conf{LogLevel: "info", Enabled: true, RateLimits: def().RateLimits}},
+		{name: "[json string]", kv: map[string]string{"log_level": `"warn"`}, want: conf{LogLevel: "warn", RateLimits: def().RateLimits}},
+		{name: "[nested key merged]", kv: map[string]string{"rate_limits/Sum": `{"rps": 10, "burst": 2}`},
+			want: conf{LogLevel: "debug", RateLimits: map[string]limit{"Sum": {RPS: 10, Burst: 2}, "Concat": {RPS: 50}}}},
+		{name: "[whole map]", kv: map[string]string{"rate_limits": `{"Sum": {"rps": 1}}`},
+			want: conf{LogLevel: "debug", RateLimits: map[string]limit{"Sum": {RPS: 1}, "Concat": {RPS: 50}}}},
+		{name: "[unknown field]", kv: map[string]string{"log_levle": "info"}, wantErr: "unknown field"},
+		{name: "[bad type]", kv: map[string]string{"enabled": "yes"}, wantErr: "consul kv"},
+		{name: "[conflict]", kv: map[string]string{"rate_limits": `{}`, "rate_limits/Sum": `{"rps": 1}`}, wantErr: "conflicts"},
+	}
+	for _, tt := range test {
+		kv := make(map[string][]byte, len(tt.kv))
+		for k, v := range tt.kv {
+			kv[k] = []byte(v)
+		}
+		got := def()
+		err := DecodeConsulKV(kv, &got)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: got err:%v want contain:%s", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got:%+v err:%v want:%+v", tt.name, got, err, tt.want)
+		}
+	}
+}
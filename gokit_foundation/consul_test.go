@@ -0,0 +1,416 @@
+package gokit_foundation
+
+import (
+	"context"
+	"errors"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
+	stdconsul "github.com/hashicorp/consul/api"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 模拟consul agent，前failTimes次注销都会失败
+type fakeConsulClient struct {
+	failTimes    int
+	deregistered int
+}
+
+func (c *fakeConsulClient) Register(_ *stdconsul.AgentServiceRegistration) error {
+	return nil
+}
+
+func (c *fakeConsulClient) Deregister(_ *stdconsul.AgentServiceRegistration) error {
+	c.deregistered++
+	if c.deregistered <= c.failTimes {
+		return errors.New("fake consul: deregister rejected")
+	}
+	return nil
+}
+
+func (c *fakeConsulClient) Service(_, _ string, _ bool, _ *stdconsul.QueryOptions) ([]*stdconsul.ServiceEntry, *stdconsul.QueryMeta, error) {
+	return nil, nil, nil
+}
+
+func TestConsulDeregisterWithRetry(t *testing.T) {
+	defer func() { DefaultRegister, defConsulClient, defRegistration = nil, nil, nil }()
+
+	test := []struct {
+		name      string
+		failTimes int
+		wantCalls int
+		wantErr   bool
+	}{
+		{name: "[success at once]", failTimes: 0, wantCalls: 1},
+		{name: "[success on retry]", failTimes: 1, wantCalls: 2},
+		{name: "[always fail]", failTimes: 10, wantCalls: 3, wantErr: true},
+	}
+	for _, tt := range test {
+		cli := &fakeConsulClient{failTimes: tt.failTimes}
+		registerWithClient(cli, &stdconsul.AgentServiceRegistration{ID: "grpc-TestSvc-127.0.0.1:8080", Name: "TestSvc"})
+
+		err := ConsulDeregisterWithRetry(log.NewNopLogger(), 2, time.Millisecond)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("name:%s got err:%v wantErr:%v", tt.name, err, tt.wantErr)
+		}
+		if cli.deregistered != tt.wantCalls {
+			t.Errorf("name:%s got calls:%d want calls:%d", tt.name, cli.deregistered, tt.wantCalls)
+		}
+	}
+}
+
+// 模拟consul agent，保存已注册的实例，drop()模拟agent重启后丢失注册信息
+type memConsulClient struct {
+	mu         sync.Mutex
+	services   map[string]*stdconsul.AgentServiceRegistration
+	failTimes  int // drop后前failTimes次注册会失败
+	registered int
+	checks     stdconsul.HealthChecks // 所有实例的健康检查结果
+	rejectID   string                 // 总是拒绝注册这个ID
+}
+
+func (c *memConsulClient) Register(reg *stdconsul.AgentServiceRegistration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.registered++
+	if reg.ID == c.rejectID && reg.ID != "" {
+		return errors.New("fake consul: register rejected")
+	}
+	if c.failTimes > 0 {
+		c.failTimes--
+		return errors.New("fake consul: register rejected")
+	}
+	c.services[reg.ID] = reg
+	return nil
+}
+
+func (c *memConsulClient) Deregister(reg *stdconsul.AgentServiceRegistration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.services, reg.ID)
+	return nil
+}
+
+func (c *memConsulClient) Service(service, _ string, _ bool, _ *stdconsul.QueryOptions) ([]*stdconsul.ServiceEntry, *stdconsul.QueryMeta, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var entries []*stdconsul.ServiceEntry
+	for _, reg := range c.services {
+		if reg.Name == service {
+			entries = append(entries, &stdconsul.ServiceEntry{Service: &stdconsul.AgentService{ID: reg.ID, Service: reg.Name}, Checks: c.checks})
+		}
+	}
+	return entries, &stdconsul.QueryMeta{}, nil
+}
+
+func (c *memConsulClient) drop(failTimes int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.services = map[string]*stdconsul.AgentServiceRegistration{}
+	c.failTimes = failTimes
+}
+
+func (c *memConsulClient) has(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.services[id]
+	return ok
+}
+
+// 按result标签计数
+type resultCounter struct {
+	mu     *sync.Mutex
+	counts map[string]float64
+	result string
+}
+
+func newResultCounter() resultCounter {
+	return resultCounter{mu: new(sync.Mutex), counts: map[string]float64{}}
+}
+
+func (c resultCounter) With(lvs ...string) metrics.Counter {
+	return resultCounter{mu: c.mu, counts: c.counts, result: lvs[1]}
+}
+
+func (c resultCounter) Add(d float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts[c.result] += d
+}
+
+func (c resultCounter) get(result string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.counts[result]
+}
+
+func TestConsulKeepRegistered(t *testing.T) {
+	defer func() {
+		DefaultRegister, defConsulClient, defRegistration = nil, nil, nil
+		defReregistrations = discard.NewCounter()
+	}()
+	reregs := newResultCounter()
+	defReregistrations = reregs
+
+	const id = "grpc-TestSvc-127.0.0.1:8080"
+	cli := &memConsulClient{services: map[string]*stdconsul.AgentServiceRegistration{}}
+	registerWithClient(cli, &stdconsul.AgentServiceRegistration{ID: id, Name: "TestSvc"})
+	if !cli.has(id) {
+		t.Fatal("not registered")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- ConsulKeepRegistered(ctx, log.NewNopLogger(), time.Millisecond*20, time.Millisecond*5) }()
+
+	// 丢失注册信息，且前2次重新注册失败，需要在有限时间内通过退避重试注册回来
+	cli.drop(2)
+	deadline := time.Now().Add(time.Second)
+	for !cli.has(id) {
+		if time.Now().After(deadline) {
+			t.Fatal("not re-registered within 1s")
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("ConsulKeepRegistered not return after ctx done")
+	}
+	// 初次注册1次 + 失败2次 + 成功1次
+	if cli.registered != 4 {
+		t.Errorf("got register calls:%d want:4", cli.registered)
+	}
+	if reregs.get("ok") != 1 || reregs.get("failed") != 2 {
+		t.Errorf("got re-registrations:%v", reregs.counts)
+	}
+}
+
+func TestConsulRegistration(t *testing.T) {
+	reg := consulRegistration("TestSvc", "127.0.0.1", 8080, ConsulRegisterOptions{
+		Tags:   []string{"version=v1.2.0", "zone=cn-sh-a"},
+		Meta:   map[string]string{"version": "v1.2.0"},
+		Weight: 10,
+	})
+	if reg.ID != "grpc-TestSvc-127.0.0.1:8080" || strings.Join(reg.Tags, ",") != "version=v1.2.0,zone=cn-sh-a,gokit_svc" ||
+		reg.Meta["version"] != "v1.2.0" || reg.Weights == nil || reg.Weights.Passing != 10 || reg.Weights.Warning != 1 {
+		t.Errorf("got registration:%+v", reg)
+	}
+	if reg.Check.GRPC != "127.0.0.1:8080/grpc_health" || reg.Check.TTL != "" {
+		t.Errorf("got check:%+v", reg.Check)
+	}
+
+	// TTL检查代替grpc检查，删除时间至少是3个TTL
+	reg = consulRegistration("TestSvc", "127.0.0.1", 8080, ConsulRegisterOptions{CheckTTL: 10 * time.Second})
+	if c := reg.Check; c.GRPC != "" || c.TTL != "10s" || c.CheckID != reg.ID+":ttl" || c.DeregisterCriticalServiceAfter != "30s" || reg.Weights != nil {
+		t.Errorf("got check:%+v", c)
+	}
+}
+
+// 记录TTL检查的上报，设置了cli时与consul agent一样，实例不存在(如agent重启后)的check上报失败
+type ttlRecorder struct {
+	mu       sync.Mutex
+	statuses []string
+	cli      *memConsulClient
+}
+
+func (r *ttlRecorder) UpdateTTL(checkID, output, status string) error {
+	if r.cli != nil && !r.cli.has(strings.TrimSuffix(checkID, ":ttl")) {
+		return errors.New(`Unexpected response code: 500 (CheckID "` + checkID + `" does not have associated TTL)`)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.statuses = append(r.statuses, status+":"+output)
+	return nil
+}
+
+func (r *ttlRecorder) last() (string, int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.statuses) == 0 {
+		return "", 0
+	}
+	return r.statuses[len(r.statuses)-1], len(r.statuses)
+}
+
+func TestConsulKeepRegisteredHeartbeat(t *testing.T) {
+	defer func() {
+		DefaultRegister, defConsulClient, defRegistration = nil, nil, nil
+		defTTLUpdater, defTTLStatus = nil, nil
+	}()
+
+	var unhealthy int32
+	cli := &memConsulClient{services: map[string]*stdconsul.AgentServiceRegistration{}}
+	registerWithClient(cli, consulRegistration("TestSvc", "127.0.0.1", 8080, ConsulRegisterOptions{CheckTTL: 30 * time.Millisecond}))
+	rec := &ttlRecorder{}
+	defTTLUpdater = rec
+	defTTLStatus = func(context.Context) error {
+		if atomic.LoadInt32(&unhealthy) == 1 {
+			return errors.New("redis: connection refused")
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- ConsulKeepRegistered(ctx, log.NewNopLogger(), time.Second, time.Millisecond*5) }()
+
+	waitFor := func(want string, minCalls int) {
+		deadline := time.Now().Add(time.Second)
+		for {
+			if got, n := rec.last(); got == want && n >= minCalls {
+				return
+			}
+			if time.Now().After(deadline) {
+				got, n := rec.last()
+				t.Fatalf("got last:%q calls:%d, want:%q", got, n, want)
+			}
+			time.Sleep(time.Millisecond * 5)
+		}
+	}
+	// 启动时立即上报，之后每TTL/3上报一次
+	waitFor("passing:ok", 3)
+	atomic.StoreInt32(&unhealthy, 1)
+	waitFor("critical:redis: connection refused", 4)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("ConsulKeepRegistered not return after ctx done")
+	}
+	// 返回后心跳goroutine已经退出
+	_, n := rec.last()
+	time.Sleep(time.Millisecond * 30)
+	if _, m := rec.last(); m != n {
+		t.Errorf("heartbeat after return, calls:%d => %d", n, m)
+	}
+}
+
+// agent重启后心跳失败，不等检查间隔立即重新注册
+func TestConsulKeepRegisteredHeartbeatLost(t *testing.T) {
+	defer func() {
+		DefaultRegister, defConsulClient, defRegistration = nil, nil, nil
+		defTTLUpdater, defReregistrations = nil, discard.NewCounter()
+	}()
+
+	cli := &memConsulClient{services: map[string]*stdconsul.AgentServiceRegistration{}}
+	reg := consulRegistration("TestSvc", "127.0.0.1", 8080, ConsulRegisterOptions{CheckTTL: 30 * time.Millisecond})
+	registerWithClient(cli, reg)
+	defTTLUpdater = &ttlRecorder{cli: cli}
+	reregs := newResultCounter()
+	defReregistrations = reregs
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error)
+	// 检查间隔远大于测试时间，只能由心跳失败触发
+	go func() { done <- ConsulKeepRegistered(ctx, log.NewNopLogger(), time.Minute, time.Millisecond*5) }()
+
+	time.Sleep(time.Millisecond * 20)
+	cli.drop(0)
+	deadline := time.Now().Add(time.Second)
+	for !cli.has(reg.ID) || reregs.get("ok") != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("not re-registered after heartbeat lost, re-registrations:%v", reregs.counts)
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+	cancel()
+	<-done
+}
+
+// 修改权重后重新注册(包括之后的ConsulKeepRegistered)都使用新的权重
+func TestConsulSetWeight(t *testing.T) {
+	defer func() { DefaultRegister, defConsulClient, defRegistration = nil, nil, nil }()
+	if err := ConsulSetWeight(10); err != nil {
+		t.Errorf("not registered, got err:%v", err)
+	}
+
+	cli := &memConsulClient{services: map[string]*stdconsul.AgentServiceRegistration{}}
+	reg := consulRegistration("TestSvc", "127.0.0.1", 8080, ConsulRegisterOptions{Weight: 1})
+	registerWithClient(cli, reg)
+	if err := ConsulSetWeight(10); err != nil {
+		t.Fatal(err)
+	}
+	if w := cli.services[reg.ID].Weights; w == nil || w.Passing != 10 || w.Warning != 1 || cli.registered != 2 {
+		t.Errorf("got weights:%+v registered:%d", w, cli.registered)
+	}
+
+	// 注册失败时保留原来的权重
+	cli.failTimes = 1
+	if err := ConsulSetWeight(20); err == nil {
+		t.Error("want err")
+	}
+	if reg.Weights.Passing != 10 {
+		t.Errorf("got weights:%+v", reg.Weights)
+	}
+}
+
+// 别名与主注册一起注册、重新注册、修改权重和注销
+func TestConsulAliases(t *testing.T) {
+	defer func() { DefaultRegister, defConsulClient, defRegistration, defAliases = nil, nil, nil, nil }()
+	cli := &memConsulClient{services: map[string]*stdconsul.AgentServiceRegistration{}}
+	reg := consulRegistration("TestSvc", "127.0.0.1", 8080, ConsulRegisterOptions{Tags: []string{"blue"}, Weight: 1})
+	aliases := consulAliasRegistrations(reg, []ConsulAlias{{Name: "TestSvc-blue", Tags: []string{"blue"}}})
+	if err := registerWithClient(cli, reg, aliases...); err != nil {
+		t.Fatal(err)
+	}
+	const aliasID = "grpc-TestSvc-blue-127.0.0.1:8080"
+	a := cli.services[aliasID]
+	if a == nil || a.Name != "TestSvc-blue" || strings.Join(a.Tags, ",") != "blue,gokit_svc" || a.Check.AliasService != reg.ID || a.Port != 8080 {
+		t.Fatalf("got alias:%+v", a)
+	}
+
+	// 丢失后两个都重新注册
+	cli.drop(0)
+	if err := consulReassert(log.NewNopLogger()); err != nil || !cli.has(reg.ID) || !cli.has(aliasID) {
+		t.Errorf("got err:%v services:%v", err, cli.services)
+	}
+	if err := ConsulSetWeight(10); err != nil || cli.services[aliasID].Weights.Passing != 10 {
+		t.Errorf("got err:%v alias weights:%+v", err, cli.services[aliasID].Weights)
+	}
+	if err := ConsulDeregister(); err != nil || len(cli.services) != 0 {
+		t.Errorf("got err:%v services:%v", err, cli.services)
+	}
+
+	// 别名注册失败时注销已注册的
+	failing := &memConsulClient{services: map[string]*stdconsul.AgentServiceRegistration{}, rejectID: "x"}
+	aliases = append(aliases, &stdconsul.AgentServiceRegistration{ID: "x"})
+	if err := registerWithClient(failing, reg, aliases...); err == nil || len(failing.services) != 0 {
+		t.Errorf("got err:%v services:%v", err, failing.services)
+	}
+}
+
+func TestConsulSelfCheck(t *testing.T) {
+	defer func() { DefaultRegister, defConsulClient, defRegistration = nil, nil, nil }()
+	ctx := context.Background()
+	if err := ConsulSelfCheck(ctx); err != nil {
+		t.Errorf("not registered, got err:%v", err)
+	}
+
+	cli := &memConsulClient{services: map[string]*stdconsul.AgentServiceRegistration{}}
+	reg := consulRegistration("TestSvc", "127.0.0.1", 8080, ConsulRegisterOptions{})
+	registerWithClient(cli, reg)
+	cli.checks = stdconsul.HealthChecks{{Name: "serfHealth", Status: stdconsul.HealthPassing}}
+	if err := ConsulSelfCheck(ctx); err != nil {
+		t.Errorf("passing got err:%v", err)
+	}
+	cli.checks = append(cli.checks, &stdconsul.HealthCheck{Name: "grpc", Status: stdconsul.HealthCritical, Output: "connection refused"})
+	if err := ConsulSelfCheck(ctx); err == nil || !strings.Contains(err.Error(), "grpc(critical): connection refused") {
+		t.Errorf("critical got err:%v", err)
+	}
+	cli.drop(0)
+	if err := ConsulSelfCheck(ctx); err == nil || !strings.Contains(err.Error(), "not registered") {
+		t.Errorf("dropped got err:%v", err)
+	}
+}
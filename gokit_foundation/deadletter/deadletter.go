@@ -0,0 +1,218 @@
+package deadletter
+
+import (
+	"context"
+	"encoding/json"
+	"gokit_foundation/errs"
+	"strconv"
+	"time"
+)
+
+/*
+队列transport(SQS、NATS、Kafka)共用的重试和死信处理：
+-	处理失败的消息按Policy决定重试还是进入死信队列：可重试的错误(包括KindInternal，多数是依赖暂时不可用)在MaxAttempts次以内退避后重试，
+	不可重试的错误(解码失败、参数错误等，即poison message)以及重试次数用完的消息写入死信队列，不再阻塞正常的消息
+-	处理次数、最初的队列、最后一次的错误和失败时间记录在消息头中(见AttemptHeader等)，死信消息可以用cmd/dlq-inspector查看并重放到最初的队列
+-	各transport的做法：
+	SQS：重试通过修改可见时间完成(见sqstransport.ConsumerRetryBackoff)，处理次数为ApproximateReceiveCount，见sqstransport.ConsumerDeadLetter
+	Kafka：重试消息写入<topic>.retry，死信写入<topic>.dlq，见RunKafka
+	NATS：v1.x的消息没有header，重试和死信消息的header与body一起编码(见Wrap)，重试在进程内延迟后重新发布，没有持久化，进程退出时丢失
+*/
+
+const (
+	AttemptHeader  = "x-attempt"       // 第几次处理，没有时为第1次
+	OriginHeader   = "x-dlq-origin"    // 最初的topic/队列
+	ErrorHeader    = "x-dlq-error"     // 最后一次处理的错误
+	FailedAtHeader = "x-dlq-failed-at" // 进入死信队列的时间，RFC3339
+	RetryAtHeader  = "x-retry-at"      // 重试消息在这个时间之后才处理，RFC3339Nano
+)
+
+type Policy struct {
+	MaxAttempts int // 包括第一次处理，<=1时不重试
+	BackoffBase time.Duration
+	BackoffMax  time.Duration
+}
+
+func DefaultPolicy() Policy {
+	return Policy{MaxAttempts: 5, BackoffBase: time.Second, BackoffMax: 15 * time.Minute}
+}
+
+// Backoff 第attempt次处理失败后等待base*2^(attempt-1)，不超过max
+func (p Policy) Backoff(attempt int) time.Duration {
+	d := p.BackoffBase
+	for i := 1; i < attempt && d < p.BackoffMax; i++ {
+		d *= 2
+	}
+	if d > p.BackoffMax {
+		d = p.BackoffMax
+	}
+	return d
+}
+
+// Retry 第attempt次处理返回err后是否重试，false时进入死信队列
+func (p Policy) Retry(err error, attempt int) bool {
+	return Retryable(err) && attempt < p.MaxAttempts
+}
+
+// Retryable worker中的KindInternal也重试，超过次数后进入死信队列
+func Retryable(err error) bool {
+	return errs.IsRetryable(err) || errs.KindOf(err) == errs.KindInternal
+}
+
+// Message 一条消息，Headers为消息头(SQS为String类型的消息属性)
+type Message struct {
+	ID      string // 各transport中消息的id，如SQS的MessageId、Kafka的partition:offset
+	Topic   string
+	Key     []byte
+	Value   []byte
+	Headers map[string]string
+}
+
+func (m Message) header(k string) string {
+	return m.Headers[k]
+}
+
+// Attempt 本次是第几次处理
+func (m Message) Attempt() int {
+	if n, err := strconv.Atoi(m.header(AttemptHeader)); err == nil && n > 0 {
+		return n
+	}
+	return 1
+}
+
+// Origin 最初的topic/队列，没有记录时为当前的Topic
+func (m Message) Origin() string {
+	if o := m.header(OriginHeader); o != "" {
+		return o
+	}
+	return m.Topic
+}
+
+func (m Message) Error() string {
+	return m.header(ErrorHeader)
+}
+
+func (m Message) FailedAt() time.Time {
+	t, _ := time.Parse(time.RFC3339, m.header(FailedAtHeader))
+	return t
+}
+
+func (m Message) RetryAt() time.Time {
+	t, _ := time.Parse(time.RFC3339Nano, m.header(RetryAtHeader))
+	return t
+}
+
+func (m Message) with(kv ...string) Message {
+	hs := make(map[string]string, len(m.Headers)+len(kv)/2)
+	for k, v := range m.Headers {
+		hs[k] = v
+	}
+	for i := 0; i+1 < len(kv); i += 2 {
+		if kv[i+1] == "" {
+			delete(hs, kv[i])
+		} else {
+			hs[kv[i]] = kv[i+1]
+		}
+	}
+	m.Headers = hs
+	return m
+}
+
+// Next 第attempt次处理失败后的重试消息：处理次数加一，RetryAt之后才处理
+func Next(m Message, p Policy, now time.Time) Message {
+	return m.with(
+		AttemptHeader, strconv.Itoa(m.Attempt()+1),
+		OriginHeader, m.Origin(),
+		RetryAtHeader, now.Add(p.Backoff(m.Attempt())).Format(time.RFC3339Nano),
+	)
+}
+
+// Dead 写入死信队列的消息，带上最初的topic、处理次数、最后一次的错误和时间
+func Dead(m Message, err error, now time.Time) Message {
+	return m.with(
+		AttemptHeader, strconv.Itoa(m.Attempt()),
+		OriginHeader, m.Origin(),
+		ErrorHeader, err.Error(),
+		FailedAtHeader, now.UTC().Format(time.RFC3339),
+		RetryAtHeader, "",
+	)
+}
+
+// Replay 重放到最初队列的消息：去掉重试和死信的header，重新从第1次开始
+func Replay(m Message) Message {
+	m = m.with(AttemptHeader, "", OriginHeader, "", ErrorHeader, "", FailedAtHeader, "", RetryAtHeader, "")
+	if len(m.Headers) == 0 {
+		m.Headers = nil
+	}
+	return m
+}
+
+// Publisher 将消息写入重试或死信的topic
+type Publisher interface {
+	Publish(ctx context.Context, topic string, m Message) error
+}
+
+type HandlerFunc func(ctx context.Context, m Message) error
+
+// Router 处理失败的消息按Policy写入RetryTopic或DeadLetterTopic，RetryTopic为空时不重试
+type Router struct {
+	Policy          Policy
+	Publisher       Publisher
+	RetryTopic      func(origin string) string
+	DeadLetterTopic func(origin string) string
+	Now             func() time.Time // 为nil时使用time.Now
+}
+
+// Handle 调用h处理m，处理成功或失败的消息已写入重试/死信的topic时返回nil，可以ack；
+// 写入失败时返回err，消息应该重新投递(不ack)
+func (r Router) Handle(ctx context.Context, m Message, h HandlerFunc) error {
+	err := h(ctx, m)
+	if err == nil {
+		return nil
+	}
+	return r.Route(ctx, m, err)
+}
+
+// Route 处理m返回了err，按Policy写入重试或死信的topic
+func (r Router) Route(ctx context.Context, m Message, err error) error {
+	now := time.Now
+	if r.Now != nil {
+		now = r.Now
+	}
+	if r.RetryTopic != nil && r.Policy.Retry(err, m.Attempt()) {
+		return r.Publisher.Publish(ctx, r.RetryTopic(m.Origin()), Next(m, r.Policy, now()))
+	}
+	return r.Publisher.Publish(ctx, r.DeadLetterTopic(m.Origin()), Dead(m, err, now()))
+}
+
+func RetryTopic(topic string) string {
+	return topic + ".retry"
+}
+
+func DeadLetterTopic(topic string) string {
+	return topic + ".dlq"
+}
+
+// envelope NATS(v1.x)等没有header的transport把header和body一起编码
+type envelope struct {
+	Headers map[string]string `json:"x-dlq-headers"`
+	Value   []byte            `json:"x-dlq-value"`
+}
+
+// Wrap 编码header和body，Headers为空时原样返回body
+func Wrap(m Message) []byte {
+	if len(m.Headers) == 0 {
+		return m.Value
+	}
+	b, _ := json.Marshal(envelope{Headers: m.Headers, Value: m.Value})
+	return b
+}
+
+// Unwrap 解码Wrap的结果，data不是Wrap编码的header时返回false
+func Unwrap(data []byte) (headers map[string]string, value []byte, ok bool) {
+	var e envelope
+	if json.Unmarshal(data, &e) != nil || e.Headers == nil || e.Value == nil {
+		return nil, data, false
+	}
+	return e.Headers, e.Value, true
+}
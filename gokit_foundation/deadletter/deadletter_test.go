@@ -0,0 +1,130 @@
+package deadletter
+
+import (
+	"context"
+	"errors"
+	"gokit_foundation/errs"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPolicy(t *testing.T) {
+	p := Policy{MaxAttempts: 3, BackoffBase: time.Second, BackoffMax: time.Minute}
+	for attempt, want := range map[int]time.Duration{0: time.Second, 1: time.Second, 3: 4 * time.Second, 100: time.Minute} {
+		if got := p.Backoff(attempt); got != want {
+			t.Errorf("attempt:%d got:%v", attempt, got)
+		}
+	}
+	test := []struct {
+		err     error
+		attempt int
+		want    bool
+	}{
+		{errors.New("db down"), 1, true},
+		{errs.Unavailable("db down"), 2, true},
+		{errs.Unavailable("db down"), 3, false},
+		{errs.Invalid("bad request"), 1, false},
+	}
+	for _, tt := range test {
+		if got := p.Retry(tt.err, tt.attempt); got != tt.want {
+			t.Errorf("err:%v attempt:%d got:%v", tt.err, tt.attempt, got)
+		}
+	}
+}
+
+type memPublisher struct {
+	mu   sync.Mutex
+	msgs map[string][]Message
+	err  error
+}
+
+func (p *memPublisher) Publish(_ context.Context, topic string, m Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+	if p.msgs == nil {
+		p.msgs = map[string][]Message{}
+	}
+	p.msgs[topic] = append(p.msgs[topic], m)
+	return nil
+}
+
+func (p *memPublisher) get(topic string) []Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.msgs[topic]
+}
+
+// 可重试的错误写入重试topic，达到MaxAttempts或不可重试时写入死信topic，header中的origin始终是最初的topic
+func TestRouter(t *testing.T) {
+	now := time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC)
+	pub := &memPublisher{}
+	r := Router{
+		Policy:          Policy{MaxAttempts: 2, BackoffBase: time.Second, BackoffMax: time.Second},
+		Publisher:       pub,
+		RetryTopic:      RetryTopic,
+		DeadLetterTopic: DeadLetterTopic,
+		Now:             func() time.Time { return now },
+	}
+	fail := func(context.Context, Message) error { return errs.Unavailable("db down") }
+	ctx := context.Background()
+	if err := r.Handle(ctx, Message{Topic: "t", Value: []byte("v"), Headers: map[string]string{"k": "1"}}, fail); err != nil {
+		t.Fatal(err)
+	}
+	retry := pub.get("t.retry")
+	if len(retry) != 1 || retry[0].Attempt() != 2 || retry[0].Origin() != "t" || !retry[0].RetryAt().Equal(now.Add(time.Second)) {
+		t.Fatalf("got retry:%+v", retry)
+	}
+
+	// 从重试topic消费，第2次仍然失败
+	m := retry[0]
+	m.Topic = "t.retry"
+	if err := r.Handle(ctx, m, fail); err != nil {
+		t.Fatal(err)
+	}
+	dead := pub.get("t.dlq")
+	if len(dead) != 1 || dead[0].Attempt() != 2 || dead[0].Origin() != "t" || dead[0].Error() == "" ||
+		!dead[0].FailedAt().Equal(now) || !dead[0].RetryAt().IsZero() || dead[0].Headers["k"] != "1" {
+		t.Fatalf("got dead:%+v", dead)
+	}
+
+	// 重放时只保留原来的header
+	replay := Replay(dead[0])
+	if replay.Attempt() != 1 || len(replay.Headers) != 1 || replay.Headers["k"] != "1" || string(replay.Value) != "v" {
+		t.Errorf("got replay:%+v", replay)
+	}
+
+	// 不可重试的错误直接进入死信topic，成功时不写入
+	if err := r.Handle(ctx, Message{Topic: "t"}, func(context.Context, Message) error { return errs.Invalid("bad") }); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Handle(ctx, Message{Topic: "t"}, func(context.Context, Message) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(pub.get("t.dlq")); n != 2 {
+		t.Errorf("got dead:%d", n)
+	}
+
+	pub.err = errors.New("broker down")
+	if err := r.Handle(ctx, Message{Topic: "t"}, fail); err == nil {
+		t.Error("want err when publish failed")
+	}
+}
+
+func TestWrap(t *testing.T) {
+	if b := Wrap(Message{Value: []byte(`{"a":1}`)}); string(b) != `{"a":1}` {
+		t.Errorf("got:%s", b)
+	}
+	b := Wrap(Message{Value: []byte(`{"a":1}`), Headers: map[string]string{AttemptHeader: "2"}})
+	hs, v, ok := Unwrap(b)
+	if !ok || hs[AttemptHeader] != "2" || string(v) != `{"a":1}` {
+		t.Errorf("got headers:%v value:%s ok:%v", hs, v, ok)
+	}
+	// 普通的body原样返回
+	if _, v, ok := Unwrap([]byte(`{"a":1}`)); ok || string(v) != `{"a":1}` {
+		t.Errorf("got value:%s ok:%v", v, ok)
+	}
+}
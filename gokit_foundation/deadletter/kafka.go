@@ -0,0 +1,134 @@
+package deadletter
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"github.com/segmentio/kafka-go"
+	"gokit_foundation/events"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type KafkaConfig struct {
+	Brokers []string
+	GroupID string
+	Topic   string
+	Policy  Policy
+}
+
+// RunKafka 消费Topic和<Topic>.retry，h返回err时按Policy写入<Topic>.retry或<Topic>.dlq，写入成功后才提交offset
+// 重试消息等到RetryAt之后才处理，等待期间阻塞该分区，ctx结束后返回
+func RunKafka(ctx context.Context, conf KafkaConfig, h HandlerFunc, logger log.Logger) {
+	sink := events.NewKafkaSink(conf.Brokers)
+	defer sink.Close()
+	router := Router{
+		Policy:          conf.Policy,
+		Publisher:       SinkPublisher(sink),
+		RetryTopic:      RetryTopic,
+		DeadLetterTopic: DeadLetterTopic,
+	}
+	done := make(chan struct{})
+	topics := []string{conf.Topic, RetryTopic(conf.Topic)}
+	for _, topic := range topics {
+		r := kafka.NewReader(kafka.ReaderConfig{Brokers: conf.Brokers, GroupID: conf.GroupID, Topic: topic})
+		go func() {
+			defer func() { done <- struct{}{} }()
+			consumeKafka(ctx, r, router, h, logger)
+		}()
+	}
+	for range topics {
+		<-done
+	}
+}
+
+// KafkaReader *kafka.Reader实现了这个接口，需要使用consumer group(提交offset)
+type KafkaReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+func consumeKafka(ctx context.Context, r KafkaReader, router Router, h HandlerFunc, logger log.Logger) {
+	defer r.Close()
+	for {
+		km, err := r.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Log("err", err, "msg", "fetch failed")
+			}
+			return
+		}
+		m := FromKafka(km)
+		if wait := time.Until(m.RetryAt()); wait > 0 {
+			select {
+			case <-ctx.Done():
+				return // 未提交，重启后重新消费
+			case <-time.After(wait):
+			}
+		}
+		// 写入重试或死信topic失败时不提交，等待后重新处理这条消息
+		for {
+			if err = router.Handle(ctx, m, h); err == nil || ctx.Err() != nil {
+				break
+			}
+			logger.Log("topic", km.Topic, "partition", km.Partition, "offset", km.Offset, "err", err, "msg", "route failed")
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if err := r.CommitMessages(ctx, km); err != nil && ctx.Err() == nil {
+			logger.Log("topic", km.Topic, "partition", km.Partition, "offset", km.Offset, "err", err, "msg", "commit failed")
+		}
+	}
+}
+
+// FromKafka ID为partition:offset
+func FromKafka(km kafka.Message) Message {
+	m := Message{
+		ID:    fmt.Sprintf("%d:%d", km.Partition, km.Offset),
+		Topic: km.Topic,
+		Key:   km.Key,
+		Value: km.Value,
+	}
+	if len(km.Headers) > 0 {
+		m.Headers = make(map[string]string, len(km.Headers))
+		for _, h := range km.Headers {
+			m.Headers[h.Key] = string(h.Value)
+		}
+	}
+	return m
+}
+
+// ParseKafkaID 解析FromKafka的ID
+func ParseKafkaID(id string) (partition int, offset int64, err error) {
+	i := strings.IndexByte(id, ':')
+	if i < 0 {
+		return 0, 0, fmt.Errorf("deadletter: invalid kafka id %q, want partition:offset", id)
+	}
+	if partition, err = strconv.Atoi(id[:i]); err != nil {
+		return 0, 0, fmt.Errorf("deadletter: invalid kafka id %q, want partition:offset", id)
+	}
+	if offset, err = strconv.ParseInt(id[i+1:], 10, 64); err != nil {
+		return 0, 0, fmt.Errorf("deadletter: invalid kafka id %q, want partition:offset", id)
+	}
+	return partition, offset, nil
+}
+
+type sinkPublisher struct {
+	sink events.Sink
+}
+
+// SinkPublisher 通过events.Sink(如events.NewKafkaSink)写入
+func SinkPublisher(sink events.Sink) Publisher {
+	return sinkPublisher{sink: sink}
+}
+
+func (p sinkPublisher) Publish(ctx context.Context, topic string, m Message) error {
+	return p.sink.Write(ctx, topic, []events.Message{{Key: m.Key, Value: m.Value, Headers: m.Headers}})
+}
@@ -0,0 +1,108 @@
+package deadletter
+
+import (
+	"context"
+	"github.com/go-kit/kit/log"
+	"github.com/segmentio/kafka-go"
+	"gokit_foundation/errs"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 按顺序返回msgs，之后阻塞到ctx结束
+type fakeReader struct {
+	mu        sync.Mutex
+	msgs      []kafka.Message
+	committed []int64
+}
+
+func (r *fakeReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	r.mu.Lock()
+	if len(r.msgs) > 0 {
+		m := r.msgs[0]
+		r.msgs = r.msgs[1:]
+		r.mu.Unlock()
+		return m, nil
+	}
+	r.mu.Unlock()
+	<-ctx.Done()
+	return kafka.Message{}, ctx.Err()
+}
+
+func (r *fakeReader) CommitMessages(_ context.Context, msgs ...kafka.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, m := range msgs {
+		r.committed = append(r.committed, m.Offset)
+	}
+	return nil
+}
+
+func (r *fakeReader) Close() error { return nil }
+
+func (r *fakeReader) commits() []int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]int64(nil), r.committed...)
+}
+
+func TestConsumeKafka(t *testing.T) {
+	retryAt := time.Now().Add(50 * time.Millisecond)
+	r := &fakeReader{msgs: []kafka.Message{
+		{Topic: "t", Offset: 1, Value: []byte("ok")},
+		{Topic: "t", Offset: 2, Value: []byte("bad")},
+		{Topic: "t.retry", Offset: 3, Value: []byte("ok"), Headers: []kafka.Header{
+			{Key: AttemptHeader, Value: []byte("2")}, {Key: OriginHeader, Value: []byte("t")}, {Key: RetryAtHeader, Value: []byte(retryAt.Format(time.RFC3339Nano))},
+		}},
+	}}
+	pub := &memPublisher{}
+	router := Router{Policy: DefaultPolicy(), Publisher: pub, RetryTopic: RetryTopic, DeadLetterTopic: DeadLetterTopic}
+	var handled []Message
+	var handledAt time.Time
+	h := func(_ context.Context, m Message) error {
+		handled = append(handled, m)
+		handledAt = time.Now()
+		if string(m.Value) == "bad" {
+			return errs.Invalid("bad message")
+		}
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		consumeKafka(ctx, r, router, h, log.NewNopLogger())
+		close(done)
+	}()
+	deadline := time.Now().Add(3 * time.Second)
+	for len(r.commits()) < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	if got := r.commits(); len(got) != 3 {
+		t.Fatalf("got commits:%v", got)
+	}
+	if len(handled) != 3 || handled[2].Attempt() != 2 || handled[2].Origin() != "t" || handled[1].ID != "0:2" {
+		t.Errorf("got handled:%+v", handled)
+	}
+	// 重试消息等到RetryAt之后才处理
+	if handledAt.Before(retryAt) {
+		t.Errorf("retry handled at %v, before %v", handledAt, retryAt)
+	}
+	if dead := pub.get("t.dlq"); len(dead) != 1 || string(dead[0].Value) != "bad" {
+		t.Errorf("got dead:%+v", dead)
+	}
+}
+
+func TestParseKafkaID(t *testing.T) {
+	if p, o, err := ParseKafkaID("2:15"); err != nil || p != 2 || o != 15 {
+		t.Errorf("got partition:%d offset:%d err:%v", p, o, err)
+	}
+	for _, id := range []string{"", "2", "x:1", "1:x"} {
+		if _, _, err := ParseKafkaID(id); err == nil {
+			t.Errorf("id:%q want err", id)
+		}
+	}
+}
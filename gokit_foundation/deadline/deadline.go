@@ -0,0 +1,104 @@
+package deadline
+
+import (
+	"context"
+	"errors"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"gokit_foundation/errs"
+	"net/http"
+	"time"
+)
+
+/*
+deadline的传递与超时预算：
+-	grpc：client ctx的deadline由grpc自动传给server(grpc-timeout)，不需要处理
+-	HTTP：client将剩余时间写入X-Request-Timeout header(如250ms，使用剩余时间而不是绝对时间，不受两边时钟偏差影响)，
+	server读取后写入ctx，由Middleware设置为ctx的deadline(ServerBefore中无法取消context.WithDeadline)
+-	Middleware：调用方没有传递deadline时使用接口的默认超时；剩余时间少于Min时直接返回ErrBudgetExhausted，
+	这样的请求即使处理完调用方也已经超时，不再占用下游资源
+	labels: method、stage(rejected：剩余时间不足被拒绝，exceeded：处理过程中超时)
+*/
+
+const Header = "X-Request-Timeout"
+
+// 剩余时间少于Budget.Min时返回，调用方的deadline很快就到了，重试也来不及
+var ErrBudgetExhausted = errs.Timeout("deadline budget exhausted").WithRetryable(false)
+
+// Budget 一个接口的超时预算，各项为0时不启用
+type Budget struct {
+	Default time.Duration // 调用方没有传递deadline时的超时
+	Min     time.Duration // 剩余时间少于它时直接拒绝
+}
+
+type ctxKeyTimeout struct{}
+
+// WithTimeout 记录调用方传递的剩余时间，由Middleware设置deadline
+func WithTimeout(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, ctxKeyTimeout{}, d)
+}
+
+func timeoutFromContext(ctx context.Context) (time.Duration, bool) {
+	d, ok := ctx.Value(ctxKeyTimeout{}).(time.Duration)
+	return d, ok
+}
+
+// HTTPToContext 用于httptransport.ServerBefore，header不合法时忽略
+func HTTPToContext() httptransport.RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		if d, err := time.ParseDuration(r.Header.Get(Header)); err == nil && d > 0 {
+			ctx = WithTimeout(ctx, d)
+		}
+		return ctx
+	}
+}
+
+// ContextToHTTP 用于httptransport.ClientBefore，ctx没有deadline时不设置
+func ContextToHTTP() httptransport.RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		if dl, ok := ctx.Deadline(); ok {
+			left := time.Until(dl)
+			if left < time.Millisecond {
+				left = time.Millisecond // 已经超时的请求也要让server知道
+			}
+			r.Header.Set(Header, left.Truncate(time.Millisecond).String())
+		}
+		return ctx
+	}
+}
+
+// Middleware 对method应用budget返回的预算(每次调用时读取，热更新立即生效)，返回false时只统计超时
+// exceeded为nil时不统计
+func Middleware(method string, budget func(method string) (Budget, bool), exceeded metrics.Counter) endpoint.Middleware {
+	if exceeded == nil {
+		exceeded = discard.NewCounter()
+	}
+	rejected, timedOut := exceeded.With("method", method, "stage", "rejected"), exceeded.With("method", method, "stage", "exceeded")
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			b, _ := budget(method)
+			if _, ok := ctx.Deadline(); !ok {
+				d, ok := timeoutFromContext(ctx)
+				if !ok {
+					d = b.Default
+				}
+				if d > 0 {
+					var cancel context.CancelFunc
+					ctx, cancel = context.WithTimeout(ctx, d)
+					defer cancel()
+				}
+			}
+			if dl, ok := ctx.Deadline(); ok && b.Min > 0 && time.Until(dl) < b.Min {
+				rejected.Add(1)
+				return nil, ErrBudgetExhausted
+			}
+			response, err := next(ctx, request)
+			if errors.Is(err, context.DeadlineExceeded) || ctx.Err() == context.DeadlineExceeded {
+				timedOut.Add(1)
+			}
+			return response, err
+		}
+	}
+}
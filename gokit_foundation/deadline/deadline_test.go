@@ -0,0 +1,103 @@
+package deadline
+
+import (
+	"context"
+	"github.com/go-kit/kit/metrics"
+	"gokit_foundation/errs"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type labelCounter struct {
+	counts map[string]float64
+	labels string
+}
+
+func (c *labelCounter) With(lvs ...string) metrics.Counter {
+	return &labelCounter{counts: c.counts, labels: lvs[len(lvs)-1]}
+}
+func (c *labelCounter) Add(d float64) { c.counts[c.labels] += d }
+
+// 返回ctx的剩余时间，没有deadline时为0
+func left(ctx context.Context, _ interface{}) (interface{}, error) {
+	dl, ok := ctx.Deadline()
+	if !ok {
+		return time.Duration(0), nil
+	}
+	return time.Until(dl), nil
+}
+
+func TestMiddleware(t *testing.T) {
+	counter := &labelCounter{counts: map[string]float64{}}
+	budget := Budget{Default: 100 * time.Millisecond, Min: 10 * time.Millisecond}
+	ep := Middleware("Sum", func(string) (Budget, bool) { return budget, true }, counter)(left)
+
+	// 没有deadline时使用默认超时
+	if d, _ := ep(context.Background(), nil); d.(time.Duration) <= 50*time.Millisecond || d.(time.Duration) > 100*time.Millisecond {
+		t.Errorf("got left:%v", d)
+	}
+	// 调用方的deadline优先，即使比默认超时长
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if d, _ := ep(ctx, nil); d.(time.Duration) <= 500*time.Millisecond {
+		t.Errorf("got left:%v", d)
+	}
+	// HTTP header传递的剩余时间
+	if d, _ := ep(WithTimeout(context.Background(), 300*time.Millisecond), nil); d.(time.Duration) <= 200*time.Millisecond || d.(time.Duration) > 300*time.Millisecond {
+		t.Errorf("got left:%v", d)
+	}
+
+	// 剩余时间不足时直接拒绝，不可重试
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	if _, err := ep(ctx, nil); err != ErrBudgetExhausted || errs.KindOf(err) != errs.KindTimeout || errs.IsRetryable(err) {
+		t.Errorf("got err:%v", err)
+	}
+	// 处理过程中超时
+	slow := Middleware("Sum", func(string) (Budget, bool) { return Budget{Default: 10 * time.Millisecond}, true }, counter)(
+		func(ctx context.Context, _ interface{}) (interface{}, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		})
+	if _, err := slow(context.Background(), nil); err != context.DeadlineExceeded {
+		t.Errorf("got err:%v", err)
+	}
+	if counter.counts["rejected"] != 1 || counter.counts["exceeded"] != 1 {
+		t.Errorf("got counts:%v", counter.counts)
+	}
+
+	// 没有配置时不设置deadline
+	ep = Middleware("Sum", func(string) (Budget, bool) { return Budget{}, false }, nil)(left)
+	if d, _ := ep(context.Background(), nil); d.(time.Duration) != 0 {
+		t.Errorf("got left:%v", d)
+	}
+}
+
+func TestHTTP(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	r := httptest.NewRequest(http.MethodPost, "/sum", nil)
+	ContextToHTTP()(ctx, r)
+	d, err := time.ParseDuration(r.Header.Get(Header))
+	if err != nil || d <= 200*time.Millisecond || d > 250*time.Millisecond {
+		t.Fatalf("got header:%q", r.Header.Get(Header))
+	}
+	if got, ok := timeoutFromContext(HTTPToContext()(context.Background(), r)); !ok || got != d {
+		t.Errorf("got timeout:%v", got)
+	}
+
+	// 没有deadline时不设置，不合法的header被忽略
+	r = httptest.NewRequest(http.MethodPost, "/sum", nil)
+	ContextToHTTP()(context.Background(), r)
+	if h := r.Header.Get(Header); h != "" {
+		t.Errorf("got header:%q", h)
+	}
+	for _, h := range []string{"", "abc", "-1s", "0s"} {
+		r.Header.Set(Header, h)
+		if _, ok := timeoutFromContext(HTTPToContext()(context.Background(), r)); ok {
+			t.Errorf("header:%q got timeout", h)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package dedup
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
+	"gokit_foundation/deadletter"
+	"gokit_foundation/errs"
+	"gokit_foundation/idempotency"
+	"strings"
+	"time"
+)
+
+/*
+at-least-once队列consumer的消息去重：SQS的重复投递(可见时间超时、标准队列本身的重复)、Kafka rebalance后重新消费、
+生产者重试等产生的重复消息，在去重窗口内只处理一次(exactly-once-ish)：
+-	key为<prefix><group>:<消息id>，在consumer group内去重，不同的group(各自消费全部消息)互不影响；
+	消息id由transport提供(SQS的MessageId、Kafka事件的id、NATS消息的MessageIDHeader)，没有id的消息不去重
+-	处理前以SetNX占位，已有记录的是重复消息：已处理完成的直接跳过(ack)，不调用handler；
+	仍在处理中的(另一个consumer同时收到了同一条消息)返回ErrInProgress(可重试)，由transport稍后重新投递
+-	处理失败时删除记录，消息按transport原来的重试/死信逻辑重新投递后可以再次处理；处理成功后标记为完成，保留Window
+-	窗口是滑动的：每收到一次重复消息，记录的保留时间重新从当时算起
+-	Store见idempotency.Store：RedisStore(SETNX+TTL)用于多个实例共同消费，MemStore只在单个实例内去重；
+	Store不可用时退化为直接处理(仍然是at-least-once)，只记录日志
+跳过的重复消息数记录在duplicates指标上，标签为group和state(done、in_progress)
+*/
+
+// MessageIDHeader 没有消息id的transport(如NATS v1.x)由生产者在header中设置，见deadletter.Wrap
+const MessageIDHeader = "x-message-id"
+
+var ErrInProgress = errs.Unavailable("dedup: message is being processed by another consumer")
+
+const (
+	stateProcessing = "processing"
+	stateDone       = "done"
+	// 占位的保留时间，处理时间超过它(或consumer处理中崩溃)时重复的消息可以再次处理
+	processingTTL = 5 * time.Minute
+)
+
+type Config struct {
+	Group  string
+	Window time.Duration // <=0时不去重
+}
+
+// ParseWindows 解析每个consumer group的去重窗口，格式为 group=window,...，如 sqs=10m,nats=1m
+func ParseWindows(s string) (map[string]time.Duration, error) {
+	windows := map[string]time.Duration{}
+	for _, kv := range strings.Split(s, ",") {
+		if kv = strings.TrimSpace(kv); kv == "" {
+			continue
+		}
+		i := strings.Index(kv, "=")
+		if i <= 0 || i == len(kv)-1 {
+			return nil, fmt.Errorf("dedup: invalid window %q, want group=duration", kv)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(kv[i+1:]))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("dedup: invalid window %q, want a positive duration", kv)
+		}
+		windows[strings.TrimSpace(kv[:i])] = d
+	}
+	return windows, nil
+}
+
+type Deduper struct {
+	store      idempotency.Store
+	prefix     string
+	conf       Config
+	duplicates metrics.Counter
+	logger     log.Logger
+}
+
+// New prefix为key的前缀(如 addsvc:dedup:)，duplicates为nil时不上报
+func New(store idempotency.Store, prefix string, conf Config, duplicates metrics.Counter, logger log.Logger) *Deduper {
+	if duplicates == nil {
+		duplicates = discard.NewCounter()
+	}
+	return &Deduper{store: store, prefix: prefix, conf: conf, duplicates: duplicates.With("group", conf.Group), logger: logger}
+}
+
+func (d *Deduper) key(id string) string {
+	return d.prefix + d.conf.Group + ":" + id
+}
+
+// Do id为空或者d为nil时直接调用fn；重复消息返回skipped为true，不调用fn；其他情况返回fn的err
+func (d *Deduper) Do(ctx context.Context, id string, fn func(ctx context.Context) error) (skipped bool, err error) {
+	if d == nil || d.conf.Window <= 0 || id == "" {
+		return false, fn(ctx)
+	}
+	key := d.key(id)
+	ttl := processingTTL
+	if d.conf.Window < ttl {
+		ttl = d.conf.Window
+	}
+	ok, err := d.store.SetNX(ctx, key, []byte(stateProcessing), ttl)
+	if err != nil {
+		d.logger.Log("dedup", d.conf.Group, "message_id", id, "err", err, "msg", "store unavailable, process without dedup")
+		return false, fn(ctx)
+	}
+	if !ok {
+		return d.duplicate(ctx, key, id)
+	}
+
+	if err = fn(ctx); err != nil {
+		// 重新投递的消息可以再次处理，ctx可能已经超时
+		if e := d.store.Delete(context.Background(), key); e != nil {
+			d.logger.Log("dedup", d.conf.Group, "message_id", id, "err", e, "msg", "delete failed")
+		}
+		return false, err
+	}
+	if e := d.store.Set(context.Background(), key, []byte(stateDone), d.conf.Window); e != nil {
+		d.logger.Log("dedup", d.conf.Group, "message_id", id, "err", e, "msg", "mark done failed")
+	}
+	return false, nil
+}
+
+func (d *Deduper) duplicate(ctx context.Context, key, id string) (bool, error) {
+	state, err := d.store.Get(ctx, key)
+	if err == idempotency.ErrNotFound {
+		// 刚好被删除(处理失败)或过期，重新投递时再处理
+		return false, ErrInProgress
+	}
+	if err != nil {
+		// 已经有记录，不确定是否处理完成时不处理，退避后重新投递
+		d.logger.Log("dedup", d.conf.Group, "message_id", id, "err", err, "msg", "get failed")
+		return false, ErrInProgress
+	}
+	if string(state) != stateDone {
+		d.duplicates.With("state", "in_progress").Add(1)
+		return false, ErrInProgress
+	}
+	d.duplicates.With("state", stateDone).Add(1)
+	if err := d.store.Set(ctx, key, state, d.conf.Window); err != nil {
+		d.logger.Log("dedup", d.conf.Group, "message_id", id, "err", err, "msg", "extend window failed")
+	}
+	return true, nil
+}
+
+type ctxKey struct{}
+
+func WithMessageID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+func MessageIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(ctxKey{}).(string)
+	return id
+}
+
+// Middleware 以ctx中的消息id(见WithMessageID)去重，重复消息返回nil response，
+// 只能用于不需要回复的消息，transport在需要回复时不应把id写入ctx
+func Middleware(d *Deduper) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+			_, err = d.Do(ctx, MessageIDFromContext(ctx), func(ctx context.Context) error {
+				response, err = next(ctx, request)
+				return err
+			})
+			return response, err
+		}
+	}
+}
+
+// Handler 以id(m)去重后调用h，重复消息返回nil(ack)
+func Handler(d *Deduper, id func(m deadletter.Message) string, h deadletter.HandlerFunc) deadletter.HandlerFunc {
+	return func(ctx context.Context, m deadletter.Message) error {
+		_, err := d.Do(ctx, id(m), func(ctx context.Context) error { return h(ctx, m) })
+		return err
+	}
+}
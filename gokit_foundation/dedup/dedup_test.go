@@ -0,0 +1,189 @@
+package dedup
+
+import (
+	"context"
+	"errors"
+	"github.com/go-kit/kit/log"
+	"gokit_foundation/deadletter"
+	"gokit_foundation/idempotency"
+	"gokit_foundation/memtransport"
+	"testing"
+	"time"
+)
+
+// SetNX总是失败的Store
+type failingStore struct {
+	idempotency.Store
+	err error
+}
+
+func (s failingStore) SetNX(context.Context, string, []byte, time.Duration) (bool, error) {
+	return false, s.err
+}
+
+func TestDo(t *testing.T) {
+	dup := memtransport.NewCounter()
+	d := New(idempotency.NewMemStore(10), "svc:dedup:", Config{Group: "sqs", Window: time.Minute}, dup, log.NewNopLogger())
+	ctx := context.Background()
+	calls := 0
+	fn := func(context.Context) error {
+		calls++
+		return nil
+	}
+
+	for i := 0; i < 3; i++ {
+		skipped, err := d.Do(ctx, "m1", fn)
+		if err != nil || skipped != (i > 0) {
+			t.Errorf("#%d got skipped:%v err:%v", i, skipped, err)
+		}
+	}
+	if n := len(dup.Values("group", "sqs", "state", "done")); calls != 1 || n != 2 {
+		t.Errorf("got calls:%d duplicates:%d", calls, n)
+	}
+
+	// 没有id时不去重
+	for i := 0; i < 2; i++ {
+		if skipped, err := d.Do(ctx, "", fn); skipped || err != nil {
+			t.Errorf("no id got skipped:%v err:%v", skipped, err)
+		}
+	}
+	if calls != 3 {
+		t.Errorf("no id got calls:%d", calls)
+	}
+
+	// 不同group各自去重
+	d2 := New(idempotency.NewMemStore(10), "svc:dedup:", Config{Group: "nats", Window: time.Minute}, nil, log.NewNopLogger())
+	if skipped, err := d2.Do(ctx, "m1", fn); skipped || err != nil || calls != 4 {
+		t.Errorf("other group got skipped:%v err:%v calls:%d", skipped, err, calls)
+	}
+
+	// 为nil或者窗口为0时直接处理
+	var nilD *Deduper
+	d3 := New(idempotency.NewMemStore(10), "", Config{Group: "sqs"}, nil, log.NewNopLogger())
+	for _, d := range []*Deduper{nilD, nilD, d3, d3} {
+		if skipped, err := d.Do(ctx, "m1", fn); skipped || err != nil {
+			t.Errorf("disabled got skipped:%v err:%v", skipped, err)
+		}
+	}
+	if calls != 8 {
+		t.Errorf("disabled got calls:%d", calls)
+	}
+}
+
+func TestDoFailure(t *testing.T) {
+	d := New(idempotency.NewMemStore(10), "", Config{Group: "sqs", Window: time.Minute}, nil, log.NewNopLogger())
+	ctx := context.Background()
+	calls := 0
+	fail := errors.New("db down")
+	fn := func(context.Context) error {
+		calls++
+		if calls == 1 {
+			return fail
+		}
+		return nil
+	}
+	// 失败后重新投递的消息再次处理
+	if _, err := d.Do(ctx, "m1", fn); err != fail {
+		t.Errorf("got err:%v", err)
+	}
+	if skipped, err := d.Do(ctx, "m1", fn); skipped || err != nil || calls != 2 {
+		t.Errorf("retry got skipped:%v err:%v calls:%d", skipped, err, calls)
+	}
+}
+
+func TestDoInProgress(t *testing.T) {
+	dup := memtransport.NewCounter()
+	d := New(idempotency.NewMemStore(10), "", Config{Group: "sqs", Window: time.Minute}, dup, log.NewNopLogger())
+	ctx := context.Background()
+	started, release := make(chan struct{}), make(chan struct{})
+	done := make(chan error)
+	go func() {
+		_, err := d.Do(ctx, "m1", func(context.Context) error {
+			close(started)
+			<-release
+			return nil
+		})
+		done <- err
+	}()
+	<-started
+	// 同时收到的同一条消息稍后重试
+	skipped, err := d.Do(ctx, "m1", func(context.Context) error {
+		t.Error("called while in progress")
+		return nil
+	})
+	if skipped || err != ErrInProgress {
+		t.Errorf("got skipped:%v err:%v", skipped, err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if n := len(dup.Values("group", "sqs", "state", "in_progress")); n != 1 || dup.Count() != 1 {
+		t.Errorf("got in progress duplicates:%d total:%d", n, dup.Count())
+	}
+}
+
+func TestDoStoreUnavailable(t *testing.T) {
+	d := New(failingStore{err: errors.New("redis down")}, "", Config{Group: "sqs", Window: time.Minute}, nil, log.NewNopLogger())
+	calls := 0
+	for i := 0; i < 2; i++ {
+		_, _ = d.Do(context.Background(), "m1", func(context.Context) error {
+			calls++
+			return nil
+		})
+	}
+	if calls != 2 {
+		t.Errorf("got calls:%d", calls)
+	}
+}
+
+func TestParseWindows(t *testing.T) {
+	w, err := ParseWindows(" sqs=10m, nats = 1m ,")
+	if err != nil || len(w) != 2 || w["sqs"] != 10*time.Minute || w["nats"] != time.Minute {
+		t.Errorf("got windows:%v err:%v", w, err)
+	}
+	if w, err := ParseWindows(""); err != nil || len(w) != 0 {
+		t.Errorf("empty got windows:%v err:%v", w, err)
+	}
+	for _, s := range []string{"sqs", "=1m", "sqs=", "sqs=abc", "sqs=-1m", "sqs=0s"} {
+		if _, err := ParseWindows(s); err == nil {
+			t.Errorf("%q want err", s)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	d := New(idempotency.NewMemStore(10), "", Config{Group: "nats", Window: time.Minute}, nil, log.NewNopLogger())
+	calls := 0
+	ep := Middleware(d)(func(ctx context.Context, request interface{}) (interface{}, error) {
+		calls++
+		return request, nil
+	})
+	ctx := WithMessageID(context.Background(), "m1")
+	if rsp, err := ep(ctx, 1); rsp != 1 || err != nil {
+		t.Errorf("got rsp:%v err:%v", rsp, err)
+	}
+	if rsp, err := ep(ctx, 1); rsp != nil || err != nil {
+		t.Errorf("duplicate got rsp:%v err:%v", rsp, err)
+	}
+	if _, err := ep(context.Background(), 1); err != nil || calls != 2 {
+		t.Errorf("no id got err:%v calls:%d", err, calls)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	d := New(idempotency.NewMemStore(10), "", Config{Group: "addevents", Window: time.Minute}, nil, log.NewNopLogger())
+	calls := 0
+	h := Handler(d, func(m deadletter.Message) string { return m.ID }, func(context.Context, deadletter.Message) error {
+		calls++
+		return nil
+	})
+	for i := 0; i < 2; i++ {
+		if err := h(context.Background(), deadletter.Message{ID: "e1"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("got calls:%d", calls)
+	}
+}
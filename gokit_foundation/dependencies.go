@@ -0,0 +1,224 @@
+package gokit_foundation
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+启动时的依赖探测：每个外部依赖声明为强依赖(Strong)或弱依赖(Weak)，在启动任何服务之前并发探测一次：
+-	强依赖(如注册中心、redis)不可用时服务无法工作，严格模式(DepsStrict，默认)下汇总所有不可用的强依赖返回*DependencyError，不启动
+-	弱依赖(如kafka、pushgateway)不可用时只打印日志，由RetryFailed在后台按退避重试，直到可用时记录恢复，不影响服务
+-	宽松模式(DepsLenient，如本地开发时没有consul)下强依赖的失败与弱依赖一样处理
+-	每个依赖有自己的超时，探测时panic视为不可用，后台重试中的panic也不会使任务组退出
+与Preflight(端口、advertise地址)不同，这里检查的是外部依赖；与健康检查(HealthCheckServer.AddChecker)不同，只在启动时执行
+*/
+
+const (
+	DepsStrict  = "strict"
+	DepsLenient = "lenient"
+)
+
+type DependencyKind string
+
+const (
+	DependencyStrong DependencyKind = "strong"
+	DependencyWeak   DependencyKind = "weak"
+)
+
+type Dependency struct {
+	Name    string
+	Kind    DependencyKind
+	Probe   HealthChecker
+	Timeout time.Duration // <=0时为HealthCheckTimeout
+}
+
+func (d Dependency) timeout() time.Duration {
+	if d.Timeout <= 0 {
+		return HealthCheckTimeout
+	}
+	return d.Timeout
+}
+
+// DependencyResult 一个依赖的探测结果
+type DependencyResult struct {
+	Name string
+	Kind DependencyKind
+	Took time.Duration
+	Err  error
+}
+
+// DependencyError 不可用的强依赖
+type DependencyError struct {
+	Failures []DependencyResult
+}
+
+func (e *DependencyError) Error() string {
+	lines := make([]string, 0, len(e.Failures)+1)
+	lines = append(lines, fmt.Sprintf("dependencies: %d strong dependency(s) unavailable", len(e.Failures)))
+	for _, f := range e.Failures {
+		lines = append(lines, fmt.Sprintf("  - %s (took %v): %v", f.Name, f.Took.Round(time.Millisecond), f.Err))
+	}
+	return strings.Join(lines, "\n")
+}
+
+type Dependencies struct {
+	mode   string
+	logger log.Logger
+	deps   []Dependency
+	// 后台重试的退避，每次失败翻倍
+	minBackoff, maxBackoff time.Duration
+
+	mu sync.Mutex
+	// Check中不可用、需要后台重试的依赖
+	failed []Dependency
+}
+
+// NewDependencies mode为DepsStrict或DepsLenient，其他值按DepsStrict处理
+func NewDependencies(mode string, logger log.Logger) *Dependencies {
+	return &Dependencies{mode: mode, logger: logger, minBackoff: time.Second, maxBackoff: time.Second * 30}
+}
+
+// Strong 声明强依赖，name用于日志和报告，如 redis
+func (d *Dependencies) Strong(name string, timeout time.Duration, probe HealthChecker) *Dependencies {
+	d.deps = append(d.deps, Dependency{Name: name, Kind: DependencyStrong, Probe: probe, Timeout: timeout})
+	return d
+}
+
+// Weak 声明弱依赖
+func (d *Dependencies) Weak(name string, timeout time.Duration, probe HealthChecker) *Dependencies {
+	d.deps = append(d.deps, Dependency{Name: name, Kind: DependencyWeak, Probe: probe, Timeout: timeout})
+	return d
+}
+
+// Check 并发探测所有依赖，按声明顺序返回结果；严格模式下有强依赖不可用时返回*DependencyError
+// 其他不可用的依赖由RetryFailed重试
+func (d *Dependencies) Check(ctx context.Context) ([]DependencyResult, error) {
+	results := make([]DependencyResult, len(d.deps))
+	var wg sync.WaitGroup
+	for i, dep := range d.deps {
+		wg.Add(1)
+		go func(i int, dep Dependency) {
+			defer wg.Done()
+			start := time.Now()
+			err := probeDependency(ctx, dep)
+			results[i] = DependencyResult{Name: dep.Name, Kind: dep.Kind, Took: time.Since(start), Err: err}
+		}(i, dep)
+	}
+	wg.Wait()
+
+	var (
+		e      DependencyError
+		failed []Dependency
+	)
+	for i, r := range results {
+		d.logger.Log("dependency", r.Name, "kind", r.Kind, "took", r.Took, "err", r.Err)
+		if r.Err == nil {
+			continue
+		}
+		if r.Kind == DependencyStrong && d.mode != DepsLenient {
+			e.Failures = append(e.Failures, r)
+		} else {
+			failed = append(failed, d.deps[i])
+		}
+	}
+	d.mu.Lock()
+	d.failed = failed
+	d.mu.Unlock()
+	if len(e.Failures) > 0 {
+		return results, &e
+	}
+	return results, nil
+}
+
+// Unavailable Check中不可用、后台重试还没有成功的依赖
+func (d *Dependencies) Unavailable() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	names := make([]string, 0, len(d.failed))
+	for _, dep := range d.failed {
+		names = append(names, dep.Name)
+	}
+	return names
+}
+
+// RetryFailed 在后台重试Check中不可用的依赖，全部恢复或ctx结束时返回，总是返回nil
+// 用法：tg.Add(deps.RetryFailed).Name("dependencies")
+func (d *Dependencies) RetryFailed(ctx context.Context) error {
+	d.mu.Lock()
+	failed := d.failed
+	d.mu.Unlock()
+	var wg sync.WaitGroup
+	for _, dep := range failed {
+		wg.Add(1)
+		go func(dep Dependency) {
+			defer wg.Done()
+			if d.retry(ctx, dep) {
+				d.recovered(dep.Name)
+			}
+		}(dep)
+	}
+	wg.Wait()
+	return nil
+}
+
+// 按退避重试直到可用(返回true)或ctx结束
+func (d *Dependencies) retry(ctx context.Context, dep Dependency) bool {
+	backoff := d.minBackoff
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(backoff):
+		}
+		err := probeDependency(ctx, dep)
+		if err == nil {
+			d.logger.Log("dependency", dep.Name, "kind", dep.Kind, "msg", "recovered", "attempts", attempt)
+			return true
+		}
+		if ctx.Err() != nil {
+			return false
+		}
+		if backoff *= 2; backoff > d.maxBackoff {
+			backoff = d.maxBackoff
+		}
+		d.logger.Log("dependency", dep.Name, "kind", dep.Kind, "err", err, "attempts", attempt, "retry_in", backoff)
+	}
+}
+
+func (d *Dependencies) recovered(name string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i, dep := range d.failed {
+		if dep.Name == name {
+			d.failed = append(d.failed[:i:i], d.failed[i+1:]...)
+			return
+		}
+	}
+}
+
+// 执行一次探测，超时和panic都视为不可用
+func probeDependency(ctx context.Context, dep Dependency) error {
+	ctx, cancel := context.WithTimeout(ctx, dep.timeout())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("probe panic: %v", r)
+			}
+		}()
+		done <- dep.Probe(ctx)
+	}()
+	// 不理会ctx的探测(如没有超时的dial)也在超时后返回
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("probe timeout after %v", dep.timeout())
+	}
+}
@@ -0,0 +1,105 @@
+package gokit_foundation
+
+import (
+	"context"
+	"errors"
+	"github.com/go-kit/kit/log"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDependencies(t *testing.T) {
+	down := errors.New("connection refused")
+	ok := func(context.Context) error { return nil }
+	fail := func(context.Context) error { return down }
+	// 不理会ctx
+	hang := func(context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	}
+	panics := func(context.Context) error { panic("boom") }
+
+	d := NewDependencies(DepsStrict, log.NewNopLogger()).
+		Strong("redis", 0, ok).
+		Strong("consul", 0, fail).
+		Strong("nats", time.Millisecond*50, hang).
+		Weak("kafka", 0, fail).
+		Weak("pushgateway", 0, panics)
+	start := time.Now()
+	results, err := d.Check(context.Background())
+	// 并发探测，总耗时为最慢的一个
+	if took := time.Since(start); took > time.Millisecond*500 {
+		t.Errorf("took %v", took)
+	}
+	e, isDepErr := err.(*DependencyError)
+	if !isDepErr {
+		t.Fatalf("want *DependencyError, got %v", err)
+	}
+	if len(e.Failures) != 2 || e.Failures[0].Name != "consul" || e.Failures[1].Name != "nats" {
+		t.Fatalf("got %+v", e.Failures)
+	}
+	for _, s := range []string{"2 strong dependency(s) unavailable", "consul", "connection refused", "nats", "timeout"} {
+		if !strings.Contains(err.Error(), s) {
+			t.Errorf("report %q does not contain %q", err, s)
+		}
+	}
+	if len(results) != 5 || results[0].Err != nil || results[4].Err == nil || !strings.Contains(results[4].Err.Error(), "panic") {
+		t.Errorf("got results %+v", results)
+	}
+	// 弱依赖的失败不影响启动，在后台重试
+	if got := d.Unavailable(); strings.Join(got, ",") != "kafka,pushgateway" {
+		t.Errorf("got unavailable %v", got)
+	}
+}
+
+func TestDependenciesLenient(t *testing.T) {
+	d := NewDependencies(DepsLenient, log.NewNopLogger()).
+		Strong("consul", 0, func(context.Context) error { return errors.New("no leader") })
+	if _, err := d.Check(context.Background()); err != nil {
+		t.Fatalf("got %v", err)
+	}
+	if got := d.Unavailable(); len(got) != 1 || got[0] != "consul" {
+		t.Errorf("got unavailable %v", got)
+	}
+}
+
+func TestDependenciesRetryFailed(t *testing.T) {
+	var calls int32
+	// 第3次探测时恢复
+	flaky := func(context.Context) error {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			return errors.New("connection refused")
+		}
+		return nil
+	}
+	d := NewDependencies(DepsStrict, log.NewNopLogger()).
+		Weak("kafka", 0, flaky).
+		Weak("pushgateway", 0, func(context.Context) error { panic("boom") })
+	d.minBackoff, d.maxBackoff = time.Millisecond, time.Millisecond*2
+	if _, err := d.Check(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- d.RetryFailed(ctx) }()
+	deadline := time.Now().Add(time.Second)
+	for len(d.Unavailable()) != 1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 5)
+	}
+	// 一直panic的依赖继续重试，直到ctx结束
+	if got := d.Unavailable(); len(got) != 1 || got[0] != "pushgateway" || atomic.LoadInt32(&calls) != 3 {
+		t.Errorf("got unavailable %v calls %d", got, atomic.LoadInt32(&calls))
+	}
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("RetryFailed did not return after ctx done")
+	}
+}
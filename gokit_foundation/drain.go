@@ -0,0 +1,101 @@
+package gokit_foundation
+
+import (
+	"context"
+	"github.com/go-kit/kit/log"
+	"google.golang.org/grpc"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+/*
+服务退出时的下线顺序，避免client继续访问已经停止的实例：
+	1. 健康状态置为NOT_SERVING(k8s readinessProbe、consul健康检查随之失败)
+	2. 从注册中心注销
+	3. 等待DrainPeriod，让consul/LB以及缓存了实例地址的client刷新实例列表，期间仍正常处理请求
+	4. GracefulStop grpc服务(Shutdown http服务)，等待进行中的调用结束，超过StopTimeout后强制关闭
+1~3在Drain中完成，一般在收到退出信号时调用；4由StopGRPC/ShutdownHTTP完成，必须在Drain返回之后调用
+平滑升级(见Upgrader)时新进程使用同一个地址继续服务，调用Handover后Drain跳过1~3，只做4
+*/
+type Drainer struct {
+	Logger log.Logger
+	// 为nil时跳过1
+	Health *HealthCheckServer
+	// 为nil时跳过2，注销失败时仍然继续后面的步骤
+	Deregister  func() error
+	DrainPeriod time.Duration
+	// 为0时一直等待进行中的调用结束
+	StopTimeout time.Duration
+
+	handover int32
+}
+
+// Handover 监听已经交给新进程(Upgrader.Upgrade返回nil)，之后的Drain不修改健康状态、不注销、不等待DrainPeriod
+func (d *Drainer) Handover() {
+	atomic.StoreInt32(&d.handover, 1)
+}
+
+func (d *Drainer) log(keyvals ...interface{}) {
+	if d.Logger != nil {
+		d.Logger.Log(keyvals...)
+	}
+}
+
+// Drain 下线并等待DrainPeriod，返回注销的err
+func (d *Drainer) Drain() error {
+	if atomic.LoadInt32(&d.handover) == 1 {
+		d.log("Drainer", "handed over to new process, skip draining")
+		return nil
+	}
+	if d.Health != nil {
+		d.Health.SetServing(false)
+	}
+	var err error
+	if d.Deregister != nil {
+		err = d.Deregister()
+	}
+	d.log("Drainer", "draining", "health", "NOT_SERVING", "deregister", err, "period", d.DrainPeriod)
+	time.Sleep(d.DrainPeriod)
+	return err
+}
+
+// StopGRPC GracefulStop，超过StopTimeout时强制Stop(进行中的调用返回Unavailable)，返回是否正常结束
+func (d *Drainer) StopGRPC(srv *grpc.Server) (graceful bool) {
+	done := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(done)
+	}()
+	if d.StopTimeout <= 0 {
+		<-done
+		return true
+	}
+	timer := time.NewTimer(d.StopTimeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return true
+	case <-timer.C:
+		d.log("Drainer", "grpc graceful stop timeout, force stop", "timeout", d.StopTimeout)
+		srv.Stop()
+		<-done
+		return false
+	}
+}
+
+// ShutdownHTTP 与StopGRPC相同，超时后调用Close关闭所有连接
+func (d *Drainer) ShutdownHTTP(srv *http.Server) error {
+	ctx := context.Background()
+	if d.StopTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.StopTimeout)
+		defer cancel()
+	}
+	err := srv.Shutdown(ctx)
+	if err == context.DeadlineExceeded {
+		d.log("Drainer", "http shutdown timeout, force close", "timeout", d.StopTimeout)
+		_ = srv.Close()
+	}
+	return err
+}
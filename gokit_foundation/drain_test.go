@@ -0,0 +1,111 @@
+package gokit_foundation
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestDrainerDrain(t *testing.T) {
+	hs := &HealthCheckServer{}
+	var deregisteredAt time.Time
+	d := &Drainer{
+		Health: hs,
+		Deregister: func() error {
+			// 注销时健康状态应该已经是NOT_SERVING
+			if hs.Status() != grpc_health_v1.HealthCheckResponse_NOT_SERVING {
+				t.Errorf("want NOT_SERVING before deregister, got %s", hs.Status())
+			}
+			deregisteredAt = time.Now()
+			return nil
+		},
+		DrainPeriod: time.Millisecond * 200,
+	}
+	begin := time.Now()
+	if err := d.Drain(); err != nil {
+		t.Fatal(err)
+	}
+	// 先注销，再等待DrainPeriod
+	if deregisteredAt.Sub(begin) > d.DrainPeriod/2 {
+		t.Errorf("deregistered after %s, want immediately", deregisteredAt.Sub(begin))
+	}
+	if time.Since(begin) < d.DrainPeriod {
+		t.Errorf("Drain returned after %s, want >= %s", time.Since(begin), d.DrainPeriod)
+	}
+}
+
+// 交给新进程后不下线
+func TestDrainerHandover(t *testing.T) {
+	hs := &HealthCheckServer{}
+	hs.SetServing(true)
+	deregistered := false
+	d := &Drainer{Health: hs, Deregister: func() error { deregistered = true; return nil }, DrainPeriod: time.Minute}
+	d.Handover()
+	begin := time.Now()
+	if err := d.Drain(); err != nil {
+		t.Fatal(err)
+	}
+	if deregistered || hs.Status() != grpc_health_v1.HealthCheckResponse_SERVING || time.Since(begin) > time.Second {
+		t.Errorf("got deregistered:%v health:%s took:%s", deregistered, hs.Status(), time.Since(begin))
+	}
+}
+
+// Check一直阻塞直到release关闭
+type blockingHealthServer struct {
+	HealthCheckServer
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingHealthServer) Check(ctx context.Context, _ *grpc_health_v1.HealthCheckRequest) (*grpc_health_v1.HealthCheckResponse, error) {
+	close(s.entered)
+	<-s.release
+	return &grpc_health_v1.HealthCheckResponse{}, nil
+}
+
+func TestDrainerStopGRPC(t *testing.T) {
+	for _, blocking := range []bool{false, true} {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv := grpc.NewServer()
+		hs := &blockingHealthServer{entered: make(chan struct{}), release: make(chan struct{})}
+		defer close(hs.release)
+		grpc_health_v1.RegisterHealthServer(srv, hs)
+		go srv.Serve(lis)
+
+		callErr := make(chan error, 1)
+		if blocking {
+			conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			go func() {
+				_, err := grpc_health_v1.NewHealthClient(conn).Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+				callErr <- err
+			}()
+			<-hs.entered
+		}
+
+		d := &Drainer{StopTimeout: time.Millisecond * 100}
+		begin := time.Now()
+		graceful := d.StopGRPC(srv)
+		if graceful == blocking {
+			t.Errorf("blocking:%v got graceful:%v", blocking, graceful)
+		}
+		if time.Since(begin) > time.Second {
+			t.Errorf("blocking:%v StopGRPC took %s", blocking, time.Since(begin))
+		}
+		// 强制停止时进行中的调用返回err
+		if blocking {
+			if err := <-callErr; err == nil {
+				t.Error("want err for the in-flight call after force stop")
+			}
+		}
+	}
+}
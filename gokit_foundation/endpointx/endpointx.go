@@ -0,0 +1,51 @@
+package endpointx
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-kit/kit/endpoint"
+	"gokit_foundation/errs"
+)
+
+/*
+带类型的endpoint(需要go1.18)：业务代码按具体的request/response类型编写和调用endpoint，不再手写interface{}的类型断言
+-	New把Endpoint[Req, Resp]转为go-kit的endpoint.Endpoint，之后照常套用中间件(见mwchain)、交给transport
+-	Typed把go-kit的endpoint(通常已经套了中间件，或者是client的endpoint)转回Endpoint[Req, Resp]，用于Endpoints实现service接口
+-	类型不符属于代码bug(如transport的decode返回了其他类型)：request返回errs.Invalid，response返回errs.Internal，不会panic
+transport层的DecodeRequestFunc/EncodeResponseFunc是go-kit的签名，仍然使用interface{}
+*/
+
+// Endpoint 带类型的endpoint.Endpoint
+type Endpoint[Req, Resp any] func(ctx context.Context, req Req) (Resp, error)
+
+// New 转为go-kit的endpoint.Endpoint
+func New[Req, Resp any](e Endpoint[Req, Resp]) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req, ok := request.(Req)
+		if !ok {
+			var want Req
+			return nil, errs.Invalid(fmt.Sprintf("endpointx: got request %T, want %T", request, want))
+		}
+		return e(ctx, req)
+	}
+}
+
+// Typed 转为带类型的endpoint
+// e返回nil response时返回Resp的零值和e的err(err为nil时返回errs.Internal)，调用方按零值判断即可，与直接判断response == nil相同
+func Typed[Req, Resp any](e endpoint.Endpoint) Endpoint[Req, Resp] {
+	return func(ctx context.Context, req Req) (Resp, error) {
+		var zero Resp
+		response, err := e(ctx, req)
+		if response == nil {
+			if err == nil {
+				err = errs.Internal("endpointx: nil response")
+			}
+			return zero, err
+		}
+		resp, ok := response.(Resp)
+		if !ok {
+			return zero, errs.Internal(fmt.Sprintf("endpointx: got response %T, want %T", response, zero))
+		}
+		return resp, err
+	}
+}
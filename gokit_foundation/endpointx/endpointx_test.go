@@ -0,0 +1,67 @@
+package endpointx
+
+import (
+	"context"
+	"errors"
+	"github.com/go-kit/kit/endpoint"
+	"gokit_foundation/errs"
+	"testing"
+)
+
+type sumRequest struct{ A, B int }
+
+type sumResponse struct{ V int }
+
+func TestNew(t *testing.T) {
+	e := New(func(_ context.Context, req *sumRequest) (*sumResponse, error) {
+		return &sumResponse{V: req.A + req.B}, nil
+	})
+	rsp, err := e(context.Background(), &sumRequest{A: 1, B: 2})
+	if err != nil || rsp.(*sumResponse).V != 3 {
+		t.Errorf("got rsp:%v err:%v", rsp, err)
+	}
+	if _, err := e(context.Background(), sumRequest{A: 1}); errs.KindOf(err) != errs.KindInvalid {
+		t.Errorf("got err:%v", err)
+	}
+
+	// 经过go-kit中间件后再转回带类型的endpoint
+	var calls int
+	mw := func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			calls++
+			return next(ctx, request)
+		}
+	}
+	typed := Typed[*sumRequest, *sumResponse](mw(e))
+	if v, err := typed(context.Background(), &sumRequest{A: 2, B: 3}); err != nil || v.V != 5 || calls != 1 {
+		t.Errorf("got v:%v err:%v calls:%d", v, err, calls)
+	}
+}
+
+func TestTyped(t *testing.T) {
+	boom := errors.New("boom")
+	for _, tt := range []struct {
+		name     string
+		response interface{}
+		err      error
+		wantV    *sumResponse
+		wantErr  error
+		internal bool // err为errs.KindInternal
+	}{
+		{name: "ok", response: &sumResponse{V: 1}, wantV: &sumResponse{V: 1}},
+		// 中间件返回err时response可能为nil，也可能不为nil
+		{name: "nil response", err: boom, wantErr: boom},
+		{name: "response with err", response: &sumResponse{V: 2}, err: boom, wantV: &sumResponse{V: 2}, wantErr: boom},
+		{name: "nil response without err", internal: true},
+		{name: "wrong type", response: sumResponse{}, internal: true},
+	} {
+		e := Typed[*sumRequest, *sumResponse](func(context.Context, interface{}) (interface{}, error) { return tt.response, tt.err })
+		v, err := e(context.Background(), &sumRequest{})
+		if (v == nil) != (tt.wantV == nil) || (v != nil && v.V != tt.wantV.V) {
+			t.Errorf("%s got v:%v", tt.name, v)
+		}
+		if tt.internal && (err == nil || errs.KindOf(err) != errs.KindInternal) || !tt.internal && err != tt.wantErr {
+			t.Errorf("%s got err:%v", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package errs
+
+import (
+	"context"
+	"errors"
+	"google.golang.org/grpc/status"
+	"time"
+)
+
+/*
+统一的错误模型，service、endpoint、transport层共用：
+-	Kind：错误类别，决定transport层的映射(grpc code、http status)以及默认是否可重试
+-	Code：业务错误码，是与调用方之间的稳定约定(如new_addsvc的resultcode)，0表示未指定
+-	Msg：错误描述，会返回给调用方
+-	Details：附加信息，如参数校验失败时每个字段的错误
+-	Retryable：调用方是否可以重试(如限流、依赖不可用)，业务错误重试也不会成功
+-	RetryAfter：建议的重试间隔(如过载保护拒绝时)，只对可重试的错误有意义
+-	Key、Violations：按调用方的语言本地化Msg、Details时使用(见gokit_foundation/i18n)，只在进程内有效，不经过transport传递
+
+各transport的编解码见ToGRPC/FromGRPC、HTTPStatus/EncodeHTTPError，日志字段见LogKeyvals
+*/
+
+type Kind int
+
+const (
+	KindInternal          Kind = iota // 意料之外的错误，非*Error类型的err都归为此类
+	KindInvalid                       // 参数或业务规则校验失败
+	KindNotFound                      // 资源不存在
+	KindForbidden                     // 没有权限
+	KindUnauthenticated               // 未认证或认证失败
+	KindResourceExhausted             // 限流、并发数超限
+	KindUnavailable                   // 依赖不可用、断路器打开
+	KindTimeout                       // 超时
+)
+
+var kindNames = map[Kind]string{
+	KindInternal:          "internal",
+	KindInvalid:           "invalid",
+	KindNotFound:          "not_found",
+	KindForbidden:         "forbidden",
+	KindUnauthenticated:   "unauthenticated",
+	KindResourceExhausted: "resource_exhausted",
+	KindUnavailable:       "unavailable",
+	KindTimeout:           "timeout",
+}
+
+func (k Kind) String() string {
+	if s, ok := kindNames[k]; ok {
+		return s
+	}
+	return kindNames[KindInternal]
+}
+
+func kindFromString(s string) Kind {
+	k, _ := parseKind(s)
+	return k
+}
+
+func parseKind(s string) (Kind, bool) {
+	for k, name := range kindNames {
+		if name == s {
+			return k, true
+		}
+	}
+	return KindInternal, false
+}
+
+// 这几类错误一般是暂时的，默认可重试
+func (k Kind) retryable() bool {
+	return k == KindResourceExhausted || k == KindUnavailable || k == KindTimeout
+}
+
+type Error struct {
+	Kind       Kind
+	Code       int
+	Msg        string
+	Details    map[string]string
+	Retryable  bool
+	RetryAfter time.Duration // 0表示没有建议
+
+	Key        string               // Msg的消息key，为空时按Code(或Kind)查找
+	Violations map[string]Violation // Details中字段的结构化描述，key与Details相同
+
+	cause error
+}
+
+// Violation 字段校验失败的规则和参数，如 {Rule: "max", Args: {"param": "10"}}
+type Violation struct {
+	Rule string
+	Args map[string]string
+}
+
+// New 创建一个错误，Retryable由kind决定，可以通过WithRetryable修改
+func New(kind Kind, msg string) *Error {
+	return &Error{Kind: kind, Msg: msg, Retryable: kind.retryable()}
+}
+
+func Internal(msg string) *Error          { return New(KindInternal, msg) }
+func Invalid(msg string) *Error           { return New(KindInvalid, msg) }
+func NotFound(msg string) *Error          { return New(KindNotFound, msg) }
+func Forbidden(msg string) *Error         { return New(KindForbidden, msg) }
+func Unauthenticated(msg string) *Error   { return New(KindUnauthenticated, msg) }
+func ResourceExhausted(msg string) *Error { return New(KindResourceExhausted, msg) }
+func Unavailable(msg string) *Error       { return New(KindUnavailable, msg) }
+func Timeout(msg string) *Error           { return New(KindTimeout, msg) }
+
+func (e *Error) Error() string {
+	return e.Msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// Is 使得errors.Is可以比较经过transport还原的错误：Kind和Code都相同，且Code不为0
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	if !ok {
+		return false
+	}
+	return e == t || (t.Code != 0 && e.Kind == t.Kind && e.Code == t.Code)
+}
+
+// 以下With方法都返回一个新的*Error，不修改原对象，所以可以用于包级别的错误变量
+
+func (e *Error) WithCode(code int) *Error {
+	c := *e
+	c.Code = code
+	return &c
+}
+
+func (e *Error) WithDetails(details map[string]string) *Error {
+	c := *e
+	c.Details = details
+	return &c
+}
+
+func (e *Error) WithKey(key string) *Error {
+	c := *e
+	c.Key = key
+	return &c
+}
+
+func (e *Error) WithViolations(violations map[string]Violation) *Error {
+	c := *e
+	c.Violations = violations
+	return &c
+}
+
+func (e *Error) WithRetryable(retryable bool) *Error {
+	c := *e
+	c.Retryable = retryable
+	return &c
+}
+
+func (e *Error) WithRetryAfter(d time.Duration) *Error {
+	c := *e
+	c.RetryAfter = d
+	return &c
+}
+
+// Wrap 记录引起该错误的底层err，可通过errors.Unwrap/errors.As获取，不会返回给调用方
+func (e *Error) Wrap(cause error) *Error {
+	c := *e
+	c.cause = cause
+	return &c
+}
+
+/*
+From 将任意err转为*Error，nil返回nil
+-	*Error(包括被fmt.Errorf("%w")包装的)：原样返回
+-	context.DeadlineExceeded：KindTimeout
+-	grpc status(包括实现了GRPCStatus方法的err)：见FromGRPC
+-	其他：KindInternal，Msg为err.Error()
+*/
+func From(err error) *Error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return Timeout(err.Error()).Wrap(err)
+	}
+	if _, ok := status.FromError(err); ok {
+		return fromStatus(err)
+	}
+	return Internal(err.Error()).Wrap(err)
+}
+
+func KindOf(err error) Kind {
+	if err == nil {
+		return KindInternal
+	}
+	return From(err).Kind
+}
+
+// CodeOf 返回err的业务错误码，err为nil或未指定时返回0
+func CodeOf(err error) int {
+	if err == nil {
+		return 0
+	}
+	return From(err).Code
+}
+
+func IsRetryable(err error) bool {
+	return err != nil && From(err).Retryable
+}
+
+// RetryAfterOf 返回server建议的重试间隔，err为nil、不可重试或没有建议时返回0
+func RetryAfterOf(err error) time.Duration {
+	if !IsRetryable(err) {
+		return 0
+	}
+	return From(err).RetryAfter
+}
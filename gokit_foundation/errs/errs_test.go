@@ -0,0 +1,198 @@
+package errs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var errTwoZeroes = Invalid("can't sum two zeroes").WithCode(1001)
+
+func TestFrom(t *testing.T) {
+	plain := errors.New("redis: connection refused")
+	test := []struct {
+		name          string
+		err           error
+		wantKind      Kind
+		wantCode      int
+		wantRetryable bool
+	}{
+		{name: "[biz err]", err: errTwoZeroes, wantKind: KindInvalid, wantCode: 1001},
+		{name: "[wrapped]", err: fmt.Errorf("sum: %w", errTwoZeroes), wantKind: KindInvalid, wantCode: 1001},
+		{name: "[plain]", err: plain, wantKind: KindInternal},
+		{name: "[deadline]", err: context.DeadlineExceeded, wantKind: KindTimeout, wantRetryable: true},
+		{name: "[grpc status]", err: status.Error(codes.Unavailable, "no instance"), wantKind: KindUnavailable, wantRetryable: true},
+		{name: "[override retryable]", err: Unavailable("maintaining").WithRetryable(false), wantKind: KindUnavailable},
+	}
+	for _, tt := range test {
+		e := From(tt.err)
+		if e.Kind != tt.wantKind || e.Code != tt.wantCode || e.Retryable != tt.wantRetryable {
+			t.Errorf("name:%s got kind:%v code:%d retryable:%v", tt.name, e.Kind, e.Code, e.Retryable)
+		}
+	}
+	if From(nil) != nil || CodeOf(nil) != 0 || IsRetryable(nil) {
+		t.Error("nil err should be nil")
+	}
+	if !errors.Is(From(plain), plain) {
+		t.Error("cause should be kept")
+	}
+	// With方法不修改原对象
+	if errTwoZeroes.WithCode(1).Code != 1 || errTwoZeroes.Code != 1001 {
+		t.Error("WithCode should return a copy")
+	}
+}
+
+func TestGRPC(t *testing.T) {
+	test := []struct {
+		name string
+		err  *Error
+	}{
+		{name: "[biz err]", err: errTwoZeroes},
+		{name: "[validation]", err: Invalid("invalid request").WithCode(101).WithDetails(map[string]string{"a": "required", "b": "too long"})},
+		{name: "[retryable]", err: ResourceExhausted("too many requests")},
+		{name: "[retry after]", err: Unavailable("overloaded").WithRetryAfter(1500 * time.Millisecond)},
+		{name: "[not found]", err: NotFound("user not found")},
+	}
+	for _, tt := range test {
+		gerr := ToGRPC(tt.err)
+		st, _ := status.FromError(gerr)
+		if st.Code() != kindToGRPC[tt.err.Kind] || st.Message() != tt.err.Msg {
+			t.Errorf("name:%s got status:%v", tt.name, st)
+		}
+		got := From(FromGRPC(gerr))
+		if got.Kind != tt.err.Kind || got.Code != tt.err.Code || got.Msg != tt.err.Msg ||
+			got.Retryable != tt.err.Retryable || got.RetryAfter != tt.err.RetryAfter || !reflect.DeepEqual(got.Details, tt.err.Details) {
+			t.Errorf("name:%s got %+v want %+v", tt.name, got, tt.err)
+		}
+		if tt.err.Code != 0 && !errors.Is(got, tt.err) {
+			t.Errorf("name:%s errors.Is should match after round trip", tt.name)
+		}
+	}
+
+	if ToGRPC(nil) != nil || FromGRPC(nil) != nil {
+		t.Error("nil err should be nil")
+	}
+	plain := errors.New("x")
+	if FromGRPC(plain) != plain {
+		t.Error("non status err should be returned as is")
+	}
+	// 非ToGRPC生成的status
+	e := From(FromGRPC(status.Error(codes.PermissionDenied, "denied")))
+	if e.Kind != KindForbidden || e.Msg != "denied" || e.Retryable {
+		t.Errorf("got %+v", e)
+	}
+}
+
+func TestHTTP(t *testing.T) {
+	err := Invalid("invalid request").WithCode(101).WithDetails(map[string]string{"a": "required"})
+	w := httptest.NewRecorder()
+	EncodeHTTPError(context.Background(), err, w)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("got code:%d", w.Code)
+	}
+	var body HTTPBody
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	want := HTTPBody{Error: "invalid request", Kind: "invalid", Code: 101, Details: map[string]string{"a": "required"}}
+	if !reflect.DeepEqual(body, want) {
+		t.Errorf("got body:%+v", body)
+	}
+	// client还原的错误与原错误errors.Is相等
+	if got := body.Err(); !errors.Is(got, err) || IsRetryable(got) || len(From(got).Details) != 1 {
+		t.Errorf("got err:%+v", got)
+	}
+	if (HTTPBody{}).Err() != nil {
+		t.Error("empty body should be nil err")
+	}
+
+	// 建议的重试间隔
+	w = httptest.NewRecorder()
+	EncodeHTTPError(context.Background(), Unavailable("overloaded").WithRetryAfter(1500*time.Millisecond), w)
+	body = HTTPBody{}
+	_ = json.Unmarshal(w.Body.Bytes(), &body)
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "2" || RetryAfterOf(body.Err()) != 1500*time.Millisecond {
+		t.Errorf("got code:%d header:%v body:%+v", w.Code, w.Header(), body)
+	}
+	// 不可重试的错误没有重试间隔
+	if RetryAfterOf(Invalid("x").WithRetryAfter(time.Second)) != 0 || RetryAfterOf(nil) != 0 {
+		t.Error("RetryAfterOf should be 0")
+	}
+
+	if HTTPStatus(nil) != http.StatusOK || HTTPStatus(errors.New("x")) != http.StatusInternalServerError || HTTPStatus(Timeout("t")) != http.StatusGatewayTimeout {
+		t.Error("wrong http status")
+	}
+}
+
+func TestLogKeyvals(t *testing.T) {
+	got := LogKeyvals(errTwoZeroes)
+	want := []interface{}{"err", "can't sum two zeroes", "err_kind", "invalid", "err_code", 1001, "retryable", false}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v", got)
+	}
+	if got := LogKeyvals(nil); len(got) != 2 || got[1] != nil {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestMapper(t *testing.T) {
+	m, err := ParseMapper("not_found=:410, 2001=FAILED_PRECONDITION:409,1001=:422")
+	if err != nil {
+		t.Fatal(err)
+	}
+	outOfStock := Invalid("out of stock").WithCode(2001)
+	test := []struct {
+		name     string
+		err      error
+		wantGRPC codes.Code
+		wantHTTP int
+	}{
+		{name: "[code]", err: outOfStock, wantGRPC: codes.FailedPrecondition, wantHTTP: http.StatusConflict},
+		{name: "[code http only]", err: errTwoZeroes, wantGRPC: codes.InvalidArgument, wantHTTP: http.StatusUnprocessableEntity},
+		{name: "[kind]", err: NotFound("user not found"), wantGRPC: codes.NotFound, wantHTTP: http.StatusGone},
+		{name: "[default]", err: Invalid("x"), wantGRPC: codes.InvalidArgument, wantHTTP: http.StatusBadRequest},
+		{name: "[plain]", err: errors.New("x"), wantGRPC: codes.Internal, wantHTTP: http.StatusInternalServerError},
+	}
+	for _, tt := range test {
+		if got := status.Code(m.ToGRPC(tt.err)); got != tt.wantGRPC {
+			t.Errorf("name:%s got grpc code:%v", tt.name, got)
+		}
+		if got := m.HTTPStatus(tt.err); got != tt.wantHTTP {
+			t.Errorf("name:%s got http status:%d", tt.name, got)
+		}
+	}
+	// 只影响status code，client还原的错误不变
+	if got := From(FromGRPC(m.ToGRPC(outOfStock))); got.Kind != KindInvalid || got.Code != 2001 {
+		t.Errorf("got %+v", got)
+	}
+	w := httptest.NewRecorder()
+	m.EncodeHTTPError(context.Background(), outOfStock, w)
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), `"kind":"invalid"`) {
+		t.Errorf("got code:%d body:%s", w.Code, w.Body)
+	}
+
+	for _, spec := range []string{"1001", "1001=:200", "1001=OK:", "0=:422", "unknown=:422", "1001=NO_SUCH:", "1001=:"} {
+		if _, err := ParseMapper(spec); err == nil {
+			t.Errorf("spec %q: want err", spec)
+		}
+	}
+
+	// 没有注册时为默认映射
+	Register("addsvc", m)
+	defer Register("addsvc", nil)
+	if For("addsvc").HTTPStatus(outOfStock) != http.StatusConflict || For("usersvc").HTTPStatus(outOfStock) != http.StatusBadRequest {
+		t.Error("wrong mapper")
+	}
+	if HTTPStatus(outOfStock) != http.StatusBadRequest {
+		t.Error("default mapper should not be changed")
+	}
+}
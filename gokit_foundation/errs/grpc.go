@@ -0,0 +1,139 @@
+package errs
+
+import (
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+*Error与grpc status的转换，server使用ToGRPC，client使用FromGRPC还原
+	Kind => status code
+	Msg => status message
+	Kind、Code => ErrorInfo详情(Domain为Kind，Reason为Code)，Details也放在ErrorInfo.Metadata
+	Details(KindInvalid) => 额外的BadRequest详情，每个字段一个FieldViolation，非go client也能识别
+	Retryable => RetryInfo详情，没有该详情表示不可重试，RetryAfter为RetryInfo.RetryDelay
+*/
+
+// ErrorInfo.Domain使用Kind，与其他来源的ErrorInfo区分
+const errorInfoDomainPrefix = "errs/"
+
+var kindToGRPC = map[Kind]codes.Code{
+	KindInternal:          codes.Internal,
+	KindInvalid:           codes.InvalidArgument,
+	KindNotFound:          codes.NotFound,
+	KindForbidden:         codes.PermissionDenied,
+	KindUnauthenticated:   codes.Unauthenticated,
+	KindResourceExhausted: codes.ResourceExhausted,
+	KindUnavailable:       codes.Unavailable,
+	KindTimeout:           codes.DeadlineExceeded,
+}
+
+func grpcToKind(c codes.Code) Kind {
+	for k, gc := range kindToGRPC {
+		if gc == c {
+			return k
+		}
+	}
+	return KindInternal
+}
+
+// ToGRPC 将err转为grpc status error，nil返回nil，status code见Mapper
+func ToGRPC(err error) error {
+	return defaultMapper.ToGRPC(err)
+}
+
+// ToGRPC 与包级别的ToGRPC相同，status code由m决定
+func (m *Mapper) ToGRPC(err error) error {
+	e := From(err)
+	if e == nil {
+		return nil
+	}
+	st := status.New(m.GRPCCode(e), e.Msg)
+
+	info := &errdetails.ErrorInfo{
+		Domain:   errorInfoDomainPrefix + e.Kind.String(),
+		Reason:   strconv.Itoa(e.Code),
+		Metadata: e.Details,
+	}
+	details := []proto.Message{info}
+	if e.Kind == KindInvalid && len(e.Details) > 0 {
+		fields := make([]string, 0, len(e.Details))
+		for f := range e.Details {
+			fields = append(fields, f)
+		}
+		sort.Strings(fields)
+		br := &errdetails.BadRequest{}
+		for _, f := range fields {
+			br.FieldViolations = append(br.FieldViolations, &errdetails.BadRequest_FieldViolation{
+				Field:       f,
+				Description: e.Details[f],
+			})
+		}
+		details = append(details, br)
+	}
+	if e.Retryable {
+		ri := &errdetails.RetryInfo{}
+		if e.RetryAfter > 0 {
+			ri.RetryDelay = ptypes.DurationProto(e.RetryAfter)
+		}
+		details = append(details, ri)
+	}
+
+	// WithDetails只在details无法序列化时失败，此时退化为不带详情的status
+	if withDetails, err := st.WithDetails(details...); err == nil {
+		st = withDetails
+	}
+	return st.Err()
+}
+
+// FromGRPC 将grpc client得到的err还原为*Error，不是grpc status的err原样返回
+func FromGRPC(err error) error {
+	if _, ok := status.FromError(err); !ok || err == nil {
+		return err
+	}
+	return fromStatus(err)
+}
+
+func fromStatus(err error) *Error {
+	st, _ := status.FromError(err)
+	e := New(grpcToKind(st.Code()), st.Message())
+	e.cause = err
+	var fromInfo, retryable bool
+	for _, d := range st.Details() {
+		switch d := d.(type) {
+		case *errdetails.ErrorInfo:
+			if !strings.HasPrefix(d.Domain, errorInfoDomainPrefix) {
+				continue
+			}
+			fromInfo = true
+			e.Kind = kindFromString(strings.TrimPrefix(d.Domain, errorInfoDomainPrefix))
+			e.Code, _ = strconv.Atoi(d.Reason)
+			if len(d.Metadata) > 0 {
+				e.Details = d.Metadata
+			}
+		case *errdetails.BadRequest:
+			if e.Details == nil && len(d.FieldViolations) > 0 {
+				e.Details = make(map[string]string, len(d.FieldViolations))
+				for _, fv := range d.FieldViolations {
+					e.Details[fv.Field] = fv.Description
+				}
+			}
+		case *errdetails.RetryInfo:
+			retryable = true
+			if d.RetryDelay != nil {
+				e.RetryAfter, _ = ptypes.Duration(d.RetryDelay)
+			}
+		}
+	}
+	// 由ToGRPC生成的status以RetryInfo为准，其他status有RetryInfo或Kind默认可重试时可重试
+	if fromInfo || retryable {
+		e.Retryable = retryable
+	}
+	return e
+}
@@ -0,0 +1,78 @@
+package errs
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var kindToHTTP = map[Kind]int{
+	KindInternal:          http.StatusInternalServerError,
+	KindInvalid:           http.StatusBadRequest,
+	KindNotFound:          http.StatusNotFound,
+	KindForbidden:         http.StatusForbidden,
+	KindUnauthenticated:   http.StatusUnauthorized,
+	KindResourceExhausted: http.StatusTooManyRequests,
+	KindUnavailable:       http.StatusServiceUnavailable,
+	KindTimeout:           http.StatusGatewayTimeout,
+}
+
+// HTTPStatus 返回err对应的http状态码，nil返回200，见Mapper
+func HTTPStatus(err error) int {
+	return defaultMapper.HTTPStatus(err)
+}
+
+// http响应中的错误格式
+type HTTPBody struct {
+	Error        string            `json:"error"`
+	Kind         string            `json:"kind"`
+	Code         int               `json:"code"`
+	Details      map[string]string `json:"details,omitempty"`
+	Retryable    bool              `json:"retryable"`
+	RetryAfterMs int64             `json:"retry_after_ms,omitempty"` // 不足1ms的按1ms
+}
+
+func NewHTTPBody(err error) HTTPBody {
+	e := From(err)
+	return HTTPBody{
+		Error:        e.Msg,
+		Kind:         e.Kind.String(),
+		Code:         e.Code,
+		Details:      e.Details,
+		Retryable:    e.Retryable,
+		RetryAfterMs: int64((e.RetryAfter + time.Millisecond - 1) / time.Millisecond),
+	}
+}
+
+// Err 将HTTPBody还原为*Error，用于client解析server返回的错误，Error为空时返回nil
+func (b HTTPBody) Err() error {
+	if b.Error == "" {
+		return nil
+	}
+	return &Error{
+		Kind:       kindFromString(b.Kind),
+		Code:       b.Code,
+		Msg:        b.Error,
+		Details:    b.Details,
+		Retryable:  b.Retryable,
+		RetryAfter: time.Duration(b.RetryAfterMs) * time.Millisecond,
+	}
+}
+
+// EncodeHTTPError 以HTTPStatus为状态码、HTTPBody为body响应err，签名与go-kit的httptransport.ErrorEncoder一致
+// 有RetryAfter时同时设置Retry-After header(秒，向上取整)，body中的retry_after_ms更精确
+func EncodeHTTPError(ctx context.Context, err error, w http.ResponseWriter) {
+	defaultMapper.EncodeHTTPError(ctx, err, w)
+}
+
+// EncodeHTTPError 与包级别的EncodeHTTPError相同，状态码由m决定
+func (m *Mapper) EncodeHTTPError(_ context.Context, err error, w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if d := RetryAfterOf(err); d > 0 {
+		w.Header().Set("Retry-After", strconv.FormatInt(int64((d+time.Second-1)/time.Second), 10))
+	}
+	w.WriteHeader(m.HTTPStatus(err))
+	_ = json.NewEncoder(w).Encode(NewHTTPBody(err))
+}
@@ -0,0 +1,33 @@
+package errs
+
+import (
+	"context"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/transport"
+)
+
+// LogKeyvals 返回记录err时使用的日志字段，err为nil时只有 "err", nil
+func LogKeyvals(err error) []interface{} {
+	if err == nil {
+		return []interface{}{"err", nil}
+	}
+	e := From(err)
+	kv := []interface{}{"err", err.Error(), "err_kind", e.Kind.String(), "err_code", e.Code, "retryable", e.Retryable}
+	if len(e.Details) > 0 {
+		kv = append(kv, "err_details", e.Details)
+	}
+	return kv
+}
+
+type logErrorHandler struct {
+	logger log.Logger
+}
+
+// NewLogErrorHandler 与go-kit的transport.NewLogErrorHandler相同，但日志中包含LogKeyvals的字段
+func NewLogErrorHandler(logger log.Logger) transport.ErrorHandler {
+	return logErrorHandler{logger: logger}
+}
+
+func (h logErrorHandler) Handle(_ context.Context, err error) {
+	_ = h.logger.Log(LogKeyvals(err)...)
+}
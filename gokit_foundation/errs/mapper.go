@@ -0,0 +1,180 @@
+package errs
+
+import (
+	"fmt"
+	"google.golang.org/grpc/codes"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/*
+Mapper 决定*Error在transport层使用的grpc code和http status，ToGRPC、HTTPStatus、EncodeHTTPError使用默认的Mapper：
+-	默认按Kind映射(见kindToGRPC、kindToHTTP)
+-	MapKind修改某一类错误的映射，MapCode为某个业务错误码单独指定(优先于Kind)，
+	如库存不足(KindInvalid, 2001)按FailedPrecondition/409响应，而不是InvalidArgument/400
+-	每个服务启动时通过Register注册自己的Mapper(一般由ParseMapper解析配置得到)，transport层通过For(服务名)获取，没有注册时为默认的Mapper
+只影响status code，ErrorInfo详情和HTTPBody中仍然是Kind和Code，client还原的*Error不受影响
+*/
+
+type Mapper struct {
+	kindGRPC map[Kind]codes.Code
+	kindHTTP map[Kind]int
+	codeGRPC map[int]codes.Code
+	codeHTTP map[int]int
+}
+
+// NewMapper 返回默认映射的副本，Register之后不应再修改
+func NewMapper() *Mapper {
+	m := &Mapper{
+		kindGRPC: make(map[Kind]codes.Code, len(kindToGRPC)),
+		kindHTTP: make(map[Kind]int, len(kindToHTTP)),
+		codeGRPC: map[int]codes.Code{},
+		codeHTTP: map[int]int{},
+	}
+	for k, c := range kindToGRPC {
+		m.kindGRPC[k] = c
+	}
+	for k, s := range kindToHTTP {
+		m.kindHTTP[k] = s
+	}
+	return m
+}
+
+// MapKind grpcCode为codes.OK、httpStatus为0时不修改对应的映射
+func (m *Mapper) MapKind(kind Kind, grpcCode codes.Code, httpStatus int) *Mapper {
+	if grpcCode != codes.OK {
+		m.kindGRPC[kind] = grpcCode
+	}
+	if httpStatus != 0 {
+		m.kindHTTP[kind] = httpStatus
+	}
+	return m
+}
+
+// MapCode 为业务错误码code指定映射，不论其Kind，参数含义同MapKind
+func (m *Mapper) MapCode(code int, grpcCode codes.Code, httpStatus int) *Mapper {
+	if grpcCode != codes.OK {
+		m.codeGRPC[code] = grpcCode
+	}
+	if httpStatus != 0 {
+		m.codeHTTP[code] = httpStatus
+	}
+	return m
+}
+
+// GRPCCode 返回err对应的grpc code，nil返回codes.OK
+func (m *Mapper) GRPCCode(err error) codes.Code {
+	e := From(err)
+	if e == nil {
+		return codes.OK
+	}
+	if c, ok := m.codeGRPC[e.Code]; ok && e.Code != 0 {
+		return c
+	}
+	if c, ok := m.kindGRPC[e.Kind]; ok {
+		return c
+	}
+	return codes.Internal
+}
+
+// HTTPStatus 返回err对应的http状态码，nil返回200
+func (m *Mapper) HTTPStatus(err error) int {
+	e := From(err)
+	if e == nil {
+		return http.StatusOK
+	}
+	if s, ok := m.codeHTTP[e.Code]; ok && e.Code != 0 {
+		return s
+	}
+	if s, ok := m.kindHTTP[e.Kind]; ok {
+		return s
+	}
+	return http.StatusInternalServerError
+}
+
+/*
+ParseMapper 在默认映射的基础上解析spec，格式为逗号分隔的 <kind或业务错误码>=<grpc code>:<http status>，
+grpc code为大写的名称(如FAILED_PRECONDITION)，两者都可以省略其一，如：
+
+	not_found=:410,2001=FAILED_PRECONDITION:409,1001=:422
+
+spec为空时返回默认映射
+*/
+func ParseMapper(spec string) (*Mapper, error) {
+	m := NewMapper()
+	for _, item := range strings.Split(spec, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("errs: mapping %q must be <kind|code>=<grpc code>:<http status>", item)
+		}
+		grpcCode, httpStatus, err := parseTarget(kv[1])
+		if err != nil {
+			return nil, fmt.Errorf("errs: mapping %q: %v", item, err)
+		}
+		key := strings.TrimSpace(kv[0])
+		if code, err := strconv.Atoi(key); err == nil {
+			if code == 0 {
+				return nil, fmt.Errorf("errs: mapping %q: code 0 means unspecified", item)
+			}
+			m.MapCode(code, grpcCode, httpStatus)
+			continue
+		}
+		kind, ok := parseKind(key)
+		if !ok {
+			return nil, fmt.Errorf("errs: mapping %q: unknown kind %q", item, key)
+		}
+		m.MapKind(kind, grpcCode, httpStatus)
+	}
+	return m, nil
+}
+
+func parseTarget(s string) (grpcCode codes.Code, httpStatus int, err error) {
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) != 2 || (parts[0] == "" && parts[1] == "") {
+		return 0, 0, fmt.Errorf("want <grpc code>:<http status>")
+	}
+	if parts[0] != "" {
+		if err = grpcCode.UnmarshalJSON([]byte(strconv.Quote(strings.ToUpper(parts[0])))); err != nil || grpcCode == codes.OK {
+			return 0, 0, fmt.Errorf("invalid grpc code %q", parts[0])
+		}
+	}
+	if parts[1] != "" {
+		if httpStatus, err = strconv.Atoi(parts[1]); err != nil || httpStatus < 400 || httpStatus > 599 {
+			return 0, 0, fmt.Errorf("invalid http status %q, must be 4xx or 5xx", parts[1])
+		}
+	}
+	return grpcCode, httpStatus, nil
+}
+
+var (
+	defaultMapper = NewMapper()
+
+	mappersMu sync.RWMutex
+	mappers   = map[string]*Mapper{}
+)
+
+// Register 注册service使用的Mapper，m为nil时恢复为默认映射
+func Register(service string, m *Mapper) {
+	mappersMu.Lock()
+	defer mappersMu.Unlock()
+	if m == nil {
+		delete(mappers, service)
+		return
+	}
+	mappers[service] = m
+}
+
+// For 返回service注册的Mapper，没有注册时为默认映射，transport层应在每次编码时获取，而不是在初始化时保存
+func For(service string) *Mapper {
+	mappersMu.RLock()
+	defer mappersMu.RUnlock()
+	if m, ok := mappers[service]; ok {
+		return m
+	}
+	return defaultMapper
+}
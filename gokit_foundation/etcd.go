@@ -0,0 +1,461 @@
+package gokit_foundation
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/sd"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+etcd服务注册与发现
+	go-kit的sd/etcdv3依赖的etcd clientv3与本项目使用的grpc版本不兼容，所以这里直接使用etcd v3的HTTP/JSON网关(/v3/*)
+	实例信息保存在 /gokit_svc/<svc_name>/<svc_id>，value为实例地址(host:port)，与go-kit etcdv3的约定一致
+	key绑定lease，进程异常退出不再续约时，lease过期后key被etcd自动删除
+*/
+
+// etcd地址，为空时读取环境变量ETCD_ADDR，仍为空时使用127.0.0.1:2379
+var EtcdAddr string
+
+func etcdAddr() string {
+	if EtcdAddr != "" {
+		return EtcdAddr
+	}
+	if addr := os.Getenv("ETCD_ADDR"); addr != "" {
+		return addr
+	}
+	return "127.0.0.1:2379"
+}
+
+const etcdKeyPrefix = "/gokit_svc/"
+
+// 服务实例key的前缀
+func etcdSvcPrefix(svcName string) string {
+	return etcdKeyPrefix + svcName + "/"
+}
+
+// 前缀查询的range_end：前缀最后一个字节加1
+func etcdPrefixEnd(prefix string) string {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return string(end[:i+1])
+		}
+	}
+	return "\x00"
+}
+
+func b64(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+type etcdClient struct {
+	addr string
+	http *http.Client
+}
+
+func newEtcdClient(addr string) *etcdClient {
+	if !strings.HasPrefix(addr, "http://") && !strings.HasPrefix(addr, "https://") {
+		addr = "http://" + addr
+	}
+	// watch是长连接，超时由调用者通过ctx控制
+	return &etcdClient{addr: strings.TrimSuffix(addr, "/"), http: &http.Client{}}
+}
+
+type etcdError struct {
+	Error   string `json:"error"`
+	Message string `json:"message"`
+}
+
+func (c *etcdClient) do(ctx context.Context, path string, req interface{}) (*http.Response, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequest(http.MethodPost, c.addr+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	rsp, err := c.http.Do(httpReq.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if rsp.StatusCode != http.StatusOK {
+		defer rsp.Body.Close()
+		var e etcdError
+		_ = json.NewDecoder(rsp.Body).Decode(&e)
+		if e.Message == "" {
+			e.Message = e.Error
+		}
+		return nil, fmt.Errorf("etcd %s: %s %s", path, rsp.Status, e.Message)
+	}
+	return rsp, nil
+}
+
+func (c *etcdClient) call(ctx context.Context, path string, req, rsp interface{}) error {
+	httpRsp, err := c.do(ctx, path, req)
+	if err != nil {
+		return err
+	}
+	defer httpRsp.Body.Close()
+	if rsp == nil {
+		return nil
+	}
+	return json.NewDecoder(httpRsp.Body).Decode(rsp)
+}
+
+// grpc-gateway将int64编码为字符串
+type etcdLease struct {
+	ID  int64 `json:"ID,string"`
+	TTL int64 `json:"TTL,string"`
+}
+
+func (c *etcdClient) grantLease(ctx context.Context, ttl time.Duration) (int64, error) {
+	var rsp etcdLease
+	if err := c.call(ctx, "/v3/lease/grant", etcdLease{TTL: int64(ttl / time.Second)}, &rsp); err != nil {
+		return 0, err
+	}
+	if rsp.ID == 0 {
+		return 0, errors.New("etcd /v3/lease/grant: empty lease id")
+	}
+	return rsp.ID, nil
+}
+
+// 续约一次，返回剩余TTL，lease已过期时TTL为0
+func (c *etcdClient) keepAlive(ctx context.Context, id int64) (int64, error) {
+	var rsp struct {
+		Result etcdLease `json:"result"`
+	}
+	if err := c.call(ctx, "/v3/lease/keepalive", etcdLease{ID: id}, &rsp); err != nil {
+		return 0, err
+	}
+	return rsp.Result.TTL, nil
+}
+
+func (c *etcdClient) revokeLease(ctx context.Context, id int64) error {
+	return c.call(ctx, "/v3/lease/revoke", etcdLease{ID: id}, nil)
+}
+
+func (c *etcdClient) put(ctx context.Context, key, value string, lease int64) error {
+	req := struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+		Lease int64  `json:"lease,string"`
+	}{b64(key), b64(value), lease}
+	return c.call(ctx, "/v3/kv/put", req, nil)
+}
+
+// key不存在时写入，返回是否写入成功以及当前revision
+func (c *etcdClient) putIfAbsent(ctx context.Context, key, value string, lease int64) (bool, int64, error) {
+	type compare struct {
+		Key            string `json:"key"`
+		Target         string `json:"target"`
+		CreateRevision int64  `json:"create_revision,string"`
+	}
+	type requestPut struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+		Lease int64  `json:"lease,string"`
+	}
+	type requestOp struct {
+		RequestPut requestPut `json:"request_put"`
+	}
+	req := struct {
+		Compare []compare   `json:"compare"`
+		Success []requestOp `json:"success"`
+	}{
+		[]compare{{Key: b64(key), Target: "CREATE", CreateRevision: 0}},
+		[]requestOp{{requestPut{b64(key), b64(value), lease}}},
+	}
+	var rsp struct {
+		Header    etcdHeader `json:"header"`
+		Succeeded bool       `json:"succeeded"`
+	}
+	if err := c.call(ctx, "/v3/kv/txn", req, &rsp); err != nil {
+		return false, 0, err
+	}
+	return rsp.Succeeded, rsp.Header.Revision, nil
+}
+
+type etcdKV struct {
+	Key   []byte `json:"key"` // base64由encoding/json自动解码
+	Value []byte `json:"value"`
+}
+
+type etcdHeader struct {
+	Revision int64 `json:"revision,string"`
+}
+
+// 查询前缀下的所有value，返回当前revision用于之后的watch
+func (c *etcdClient) rangePrefix(ctx context.Context, prefix string) ([]string, int64, error) {
+	req := struct {
+		Key      string `json:"key"`
+		RangeEnd string `json:"range_end"`
+	}{b64(prefix), b64(etcdPrefixEnd(prefix))}
+	var rsp struct {
+		Header etcdHeader `json:"header"`
+		Kvs    []etcdKV   `json:"kvs"`
+	}
+	if err := c.call(ctx, "/v3/kv/range", req, &rsp); err != nil {
+		return nil, 0, err
+	}
+	values := make([]string, 0, len(rsp.Kvs))
+	for _, kv := range rsp.Kvs {
+		values = append(values, string(kv.Value))
+	}
+	sort.Strings(values)
+	return values, rsp.Header.Revision, nil
+}
+
+// 监听前缀下revision之后的变化，收到变化或出错时返回
+func (c *etcdClient) watchOnce(ctx context.Context, prefix string, revision int64) error {
+	type createRequest struct {
+		Key           string `json:"key"`
+		RangeEnd      string `json:"range_end"`
+		StartRevision int64  `json:"start_revision,string"`
+	}
+	req := struct {
+		CreateRequest createRequest `json:"create_request"`
+	}{createRequest{b64(prefix), b64(etcdPrefixEnd(prefix)), revision + 1}}
+	rsp, err := c.do(ctx, "/v3/watch", req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	dec := json.NewDecoder(rsp.Body)
+	for {
+		var msg struct {
+			Result struct {
+				Canceled     bool              `json:"canceled"`
+				CancelReason string            `json:"cancel_reason"`
+				Events       []json.RawMessage `json:"events"`
+			} `json:"result"`
+			Error *etcdError `json:"error"`
+		}
+		if err = dec.Decode(&msg); err != nil {
+			return err
+		}
+		if msg.Error != nil {
+			return fmt.Errorf("etcd /v3/watch: %s", msg.Error.Message)
+		}
+		if msg.Result.Canceled {
+			return fmt.Errorf("etcd /v3/watch: canceled: %s", msg.Result.CancelReason)
+		}
+		if len(msg.Result.Events) > 0 {
+			return nil
+		}
+	}
+}
+
+// EtcdRegistry 基于lease的etcd服务注册，实现Registry
+type EtcdRegistry struct {
+	cli *etcdClient
+	ttl time.Duration
+
+	mu    sync.Mutex
+	key   string
+	value string
+	lease int64
+}
+
+// lease默认TTL，KeepRegistered的续约间隔不会超过TTL的1/3
+const defEtcdLeaseTTL = 10 * time.Second
+
+func NewEtcdRegistry(addr string) *EtcdRegistry {
+	return &EtcdRegistry{cli: newEtcdClient(addr), ttl: defEtcdLeaseTTL}
+}
+
+func (r *EtcdRegistry) Register(svcName, svcHost string, port int, tags []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.key != "" {
+		return nil
+	}
+	// etcd中只保存地址，tags不参与发现
+	key := etcdSvcPrefix(svcName) + fmt.Sprintf(consulSvcIDFormat, "grpc", svcName, svcHost, port)
+	value := fmt.Sprintf("%s:%d", svcHost, port)
+	lease, err := r.putWithLease(key, value)
+	if err != nil {
+		return err
+	}
+	r.key, r.value, r.lease = key, value, lease
+	return nil
+}
+
+func (r *EtcdRegistry) putWithLease(key, value string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	lease, err := r.cli.grantLease(ctx, r.ttl)
+	if err != nil {
+		return 0, err
+	}
+	if err = r.cli.put(ctx, key, value, lease); err != nil {
+		return 0, err
+	}
+	return lease, nil
+}
+
+// 撤销lease，绑定的key随之删除
+func (r *EtcdRegistry) Deregister() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.lease == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := r.cli.revokeLease(ctx, r.lease); err != nil {
+		return err
+	}
+	r.key, r.value, r.lease = "", "", 0
+	return nil
+}
+
+func (r *EtcdRegistry) ID() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.key[strings.LastIndex(r.key, "/")+1:]
+}
+
+// 定期续约，lease已过期(如与etcd长时间断开)时重新注册
+func (r *EtcdRegistry) KeepRegistered(ctx context.Context, logger log.Logger, interval, backoff time.Duration) error {
+	if interval > r.ttl/3 {
+		interval = r.ttl / 3
+	}
+	wait, nextBackoff := interval, backoff
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(wait):
+		}
+		if err := r.reassert(ctx, logger); err != nil {
+			wait = nextBackoff
+			if nextBackoff *= 2; nextBackoff > interval {
+				nextBackoff = interval
+			}
+			logger.Log("EtcdKeepRegistered", "failed", "svc_id", r.ID(), "err", err, "retry_after", wait)
+			continue
+		}
+		wait, nextBackoff = interval, backoff
+	}
+}
+
+func (r *EtcdRegistry) reassert(ctx context.Context, logger log.Logger) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.lease == 0 {
+		return nil
+	}
+	kaCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	ttl, err := r.cli.keepAlive(kaCtx, r.lease)
+	cancel()
+	if err != nil || ttl > 0 {
+		return err
+	}
+	logger.Log("EtcdKeepRegistered", "lease expired, re-register", "svc_id", r.key)
+	lease, err := r.putWithLease(r.key, r.value)
+	if err != nil {
+		return err
+	}
+	r.lease = lease
+	return nil
+}
+
+// EtcdInstancer 监听etcd中服务的实例列表，实现sd.Instancer
+type EtcdInstancer struct {
+	cli    *etcdClient
+	prefix string
+	logger log.Logger
+	cancel func()
+
+	mu    sync.Mutex
+	state sd.Event
+	subs  map[chan<- sd.Event]struct{}
+}
+
+func NewEtcdInstancer(addr, svcName string, logger log.Logger) *EtcdInstancer {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &EtcdInstancer{
+		cli:    newEtcdClient(addr),
+		prefix: etcdSvcPrefix(svcName),
+		logger: logger,
+		cancel: cancel,
+		subs:   map[chan<- sd.Event]struct{}{},
+	}
+	go s.loop(ctx)
+	return s
+}
+
+// 每次变化后重新查询完整的实例列表，出错时等待后重试
+func (s *EtcdInstancer) loop(ctx context.Context) {
+	backoff := 100 * time.Millisecond
+	for {
+		instances, rev, err := s.cli.rangePrefix(ctx, s.prefix)
+		if err == nil {
+			s.update(sd.Event{Instances: instances})
+			err = s.cli.watchOnce(ctx, s.prefix, rev)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			backoff = 100 * time.Millisecond
+			continue
+		}
+		s.logger.Log("EtcdInstancer", "failed", "prefix", s.prefix, "err", err, "retry_after", backoff)
+		s.update(sd.Event{Err: err})
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > 5*time.Second {
+			backoff = 5 * time.Second
+		}
+	}
+}
+
+// 出错时保留之前的实例列表，与go-kit sd/internal/instance.Cache的行为一致
+func (s *EtcdInstancer) update(ev sd.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ev.Err != nil {
+		ev.Instances = s.state.Instances
+	} else if s.state.Err == nil && s.state.Instances != nil && strings.Join(ev.Instances, ",") == strings.Join(s.state.Instances, ",") {
+		// 实例列表没有变化
+		return
+	}
+	s.state = ev
+	for ch := range s.subs {
+		ch <- ev
+	}
+}
+
+func (s *EtcdInstancer) Register(ch chan<- sd.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subs[ch] = struct{}{}
+	ch <- s.state
+}
+
+func (s *EtcdInstancer) Deregister(ch chan<- sd.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.subs, ch)
+}
+
+func (s *EtcdInstancer) Stop() {
+	s.cancel()
+}
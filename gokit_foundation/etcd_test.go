@@ -0,0 +1,237 @@
+package gokit_foundation
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/sd"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 模拟etcd的HTTP/JSON网关，只实现用到的接口，key绑定的lease被撤销或过期(expire)时删除key
+type fakeEtcd struct {
+	mu       sync.Mutex
+	kvs      map[string]string
+	leaseOf  map[string]int64
+	leases   map[int64]bool
+	nextID   int64
+	revision int64
+	changed  chan struct{} // 每次变化时关闭并替换，用于唤醒watch
+}
+
+func newFakeEtcd() (*fakeEtcd, *httptest.Server) {
+	e := &fakeEtcd{
+		kvs:     map[string]string{},
+		leaseOf: map[string]int64{},
+		leases:  map[int64]bool{},
+		changed: make(chan struct{}),
+	}
+	return e, httptest.NewServer(e)
+}
+
+func unb64(s string) string {
+	b, _ := base64.StdEncoding.DecodeString(s)
+	return string(b)
+}
+
+func (e *fakeEtcd) bump() {
+	e.revision++
+	close(e.changed)
+	e.changed = make(chan struct{})
+}
+
+// 模拟lease过期
+func (e *fakeEtcd) expire() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for k, id := range e.leaseOf {
+		delete(e.kvs, k)
+		delete(e.leaseOf, k)
+		delete(e.leases, id)
+	}
+	e.bump()
+}
+
+func (e *fakeEtcd) values() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var ret []string
+	for _, v := range e.kvs {
+		ret = append(ret, v)
+	}
+	return ret
+}
+
+func (e *fakeEtcd) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req map[string]interface{}
+	_ = json.NewDecoder(r.Body).Decode(&req)
+	str := func(k string) string { s, _ := req[k].(string); return s }
+	e.mu.Lock()
+	switch r.URL.Path {
+	case "/v3/lease/grant":
+		e.nextID++
+		e.leases[e.nextID] = true
+		json.NewEncoder(w).Encode(map[string]string{"ID": strconv.FormatInt(e.nextID, 10), "TTL": str("TTL")})
+	case "/v3/lease/keepalive":
+		id, _ := strconv.ParseInt(str("ID"), 10, 64)
+		result := map[string]string{"ID": str("ID")}
+		if e.leases[id] {
+			result["TTL"] = "10"
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"result": result})
+	case "/v3/lease/revoke":
+		id, _ := strconv.ParseInt(str("ID"), 10, 64)
+		delete(e.leases, id)
+		for k, l := range e.leaseOf {
+			if l == id {
+				delete(e.kvs, k)
+				delete(e.leaseOf, k)
+			}
+		}
+		e.bump()
+		w.Write([]byte("{}"))
+	case "/v3/kv/put":
+		id, _ := strconv.ParseInt(str("lease"), 10, 64)
+		if !e.leases[id] {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"etcdserver: requested lease not found","message":"etcdserver: requested lease not found"}`))
+			break
+		}
+		key := unb64(str("key"))
+		e.kvs[key], e.leaseOf[key] = unb64(str("value")), id
+		e.bump()
+		w.Write([]byte("{}"))
+	case "/v3/kv/txn":
+		// 只支持create_revision为0的比较
+		cmp := req["compare"].([]interface{})[0].(map[string]interface{})
+		put := req["success"].([]interface{})[0].(map[string]interface{})["request_put"].(map[string]interface{})
+		rsp := map[string]interface{}{"header": map[string]string{"revision": strconv.FormatInt(e.revision, 10)}}
+		if _, ok := e.kvs[unb64(cmp["key"].(string))]; !ok {
+			id, _ := strconv.ParseInt(put["lease"].(string), 10, 64)
+			key := unb64(put["key"].(string))
+			e.kvs[key], e.leaseOf[key] = unb64(put["value"].(string)), id
+			e.bump()
+			rsp["succeeded"] = true
+		}
+		json.NewEncoder(w).Encode(rsp)
+	case "/v3/kv/range":
+		prefix := unb64(str("key"))
+		var kvs []map[string]string
+		for k, v := range e.kvs {
+			if strings.HasPrefix(k, prefix) {
+				kvs = append(kvs, map[string]string{"key": base64.StdEncoding.EncodeToString([]byte(k)), "value": base64.StdEncoding.EncodeToString([]byte(v))})
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"header": map[string]string{"revision": strconv.FormatInt(e.revision, 10)}, "kvs": kvs})
+	case "/v3/watch":
+		create, _ := req["create_request"].(map[string]interface{})
+		start, _ := strconv.ParseInt(fmt.Sprint(create["start_revision"]), 10, 64)
+		w.Write([]byte(`{"result":{"created":true}}` + "\n"))
+		w.(http.Flusher).Flush()
+		// 等到有start_revision之后的变化
+		for e.revision < start {
+			ch := e.changed
+			e.mu.Unlock()
+			select {
+			case <-ch:
+			case <-r.Context().Done():
+				return
+			}
+			e.mu.Lock()
+		}
+		w.Write([]byte(`{"result":{"events":[{"type":"PUT"}]}}` + "\n"))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+	e.mu.Unlock()
+}
+
+func TestEtcdRegistry(t *testing.T) {
+	e, srv := newFakeEtcd()
+	defer srv.Close()
+
+	r := NewEtcdRegistry(srv.URL)
+	if err := r.Register("TestSvc", "127.0.0.1", 8080, nil); err != nil {
+		t.Fatal(err)
+	}
+	if id := r.ID(); id != "grpc-TestSvc-127.0.0.1:8080" {
+		t.Errorf("got id:%s", id)
+	}
+	if v := e.values(); len(v) != 1 || v[0] != "127.0.0.1:8080" {
+		t.Errorf("got values:%v", v)
+	}
+
+	// lease过期后重新注册
+	r.ttl = 30 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- r.KeepRegistered(ctx, log.NewNopLogger(), time.Second, time.Millisecond) }()
+	e.expire()
+	time.Sleep(100 * time.Millisecond)
+	if v := e.values(); len(v) != 1 {
+		t.Errorf("not re-registered after lease expired, got values:%v", v)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("KeepRegistered got err:%v", err)
+	}
+
+	if err := DeregisterWithRetry(r, log.NewNopLogger(), 2, time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if v := e.values(); len(v) != 0 || r.ID() != "" {
+		t.Errorf("not deregistered, got values:%v id:%s", v, r.ID())
+	}
+}
+
+func TestEtcdInstancer(t *testing.T) {
+	_, srv := newFakeEtcd()
+	defer srv.Close()
+
+	s := NewEtcdInstancer(srv.URL, "TestSvc", log.NewNopLogger())
+	defer s.Stop()
+	ch := make(chan sd.Event, 10)
+	s.Register(ch)
+	defer s.Deregister(ch)
+
+	// 等待实例列表变为want
+	wait := func(want string) {
+		timeout := time.After(time.Second)
+		for {
+			select {
+			case ev := <-ch:
+				if ev.Err == nil && strings.Join(ev.Instances, ",") == want {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("instances not updated to %q", want)
+			}
+		}
+	}
+
+	r1, r2 := NewEtcdRegistry(srv.URL), NewEtcdRegistry(srv.URL)
+	if err := r1.Register("TestSvc", "10.0.0.1", 8080, nil); err != nil {
+		t.Fatal(err)
+	}
+	wait("10.0.0.1:8080")
+	if err := r2.Register("TestSvc", "10.0.0.2", 8080, nil); err != nil {
+		t.Fatal(err)
+	}
+	// 其他服务的实例不影响
+	if err := NewEtcdRegistry(srv.URL).Register("OtherSvc", "10.0.0.3", 8080, nil); err != nil {
+		t.Fatal(err)
+	}
+	wait("10.0.0.1:8080,10.0.0.2:8080")
+	if err := r1.Deregister(); err != nil {
+		t.Fatal(err)
+	}
+	wait("10.0.0.2:8080")
+}
@@ -0,0 +1,230 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
+	"gokit_foundation/idgen"
+	"strings"
+	"time"
+)
+
+/*
+领域事件(如SumComputed)的异步发布：
+-	Publish只将事件放入缓冲区，不等待投递结果，不影响接口耗时；缓冲区满时丢弃并返回ErrBufferFull
+-	后台任务(Run)按topic攒批，达到BatchSize或每隔BatchTimeout写入Sink(如Kafka，见NewKafkaSink)，退出时通过Flush写入剩余的事件
+-	事件类型到topic的映射见Config.Topics，未映射的类型发往DefaultTopic，DefaultTopic也为空时丢弃
+-	丢弃和写入失败的事件数记录在failures指标上，标签为topic和reason(buffer_full、encode、write)
+投递是at-most-once的：写入失败不会重试(Sink自身的重试除外)，需要可靠投递时应使用outbox等方案(见usersvc的outbox.Dispatcher)
+*/
+
+var ErrBufferFull = errors.New("events: buffer full")
+
+type Event struct {
+	// 事件的唯一id，可靠投递(at-least-once，如outbox)时同一个事件可能被投递多次，消费方据此去重
+	ID     string    `json:"id,omitempty"`
+	Type   string    `json:"type"`
+	Source string    `json:"source"` // 产生事件的服务名
+	Time   time.Time `json:"time"`
+	// 为空时由Sink决定分区，相同Key的事件会进入同一个分区，保证顺序
+	Key     string      `json:"key,omitempty"`
+	Payload interface{} `json:"payload"`
+}
+
+// NewID 生成一个32位十六进制的事件id
+func NewID() string {
+	return idGen.NewID()
+}
+
+var idGen = idgen.Random(16)
+
+type Publisher interface {
+	Publish(ctx context.Context, e Event) error
+}
+
+// Message 写入Sink的一条消息，领域事件的Value为Event的JSON
+type Message struct {
+	Key     []byte
+	Value   []byte
+	Headers map[string]string // 领域事件不使用，重试和死信消息的header见gokit_foundation/deadletter
+}
+
+type Sink interface {
+	Write(ctx context.Context, topic string, msgs []Message) error
+	Close() error
+}
+
+type Config struct {
+	Topics       map[string]string // 事件类型 => topic
+	DefaultTopic string
+	BufferSize   int
+	BatchSize    int
+	BatchTimeout time.Duration
+	WriteTimeout time.Duration // 每次写入Sink的超时
+}
+
+func DefaultConfig() Config {
+	return Config{
+		BufferSize:   1000,
+		BatchSize:    100,
+		BatchTimeout: time.Second,
+		WriteTimeout: 5 * time.Second,
+	}
+}
+
+// ParseTopics 解析事件类型到topic的映射，格式为 type=topic,type=topic，空字符串返回空map
+func ParseTopics(s string) (map[string]string, error) {
+	topics := map[string]string{}
+	for _, kv := range strings.Split(s, ",") {
+		if kv = strings.TrimSpace(kv); kv == "" {
+			continue
+		}
+		i := strings.Index(kv, "=")
+		if i <= 0 || i == len(kv)-1 {
+			return nil, fmt.Errorf("events: invalid topic mapping %q, want type=topic", kv)
+		}
+		topics[strings.TrimSpace(kv[:i])] = strings.TrimSpace(kv[i+1:])
+	}
+	return topics, nil
+}
+
+type pending struct {
+	topic string
+	msg   Message
+}
+
+type AsyncPublisher struct {
+	sink     Sink
+	conf     Config
+	logger   log.Logger
+	failures metrics.Counter
+	ch       chan pending
+}
+
+// NewAsyncPublisher failures为nil时不上报，conf中为0的字段使用DefaultConfig的值
+func NewAsyncPublisher(sink Sink, conf Config, logger log.Logger, failures metrics.Counter) *AsyncPublisher {
+	def := DefaultConfig()
+	if conf.BufferSize <= 0 {
+		conf.BufferSize = def.BufferSize
+	}
+	if conf.BatchSize <= 0 {
+		conf.BatchSize = def.BatchSize
+	}
+	if conf.BatchTimeout <= 0 {
+		conf.BatchTimeout = def.BatchTimeout
+	}
+	if conf.WriteTimeout <= 0 {
+		conf.WriteTimeout = def.WriteTimeout
+	}
+	if failures == nil {
+		failures = discard.NewCounter()
+	}
+	return &AsyncPublisher{
+		sink:     sink,
+		conf:     conf,
+		logger:   logger,
+		failures: failures,
+		ch:       make(chan pending, conf.BufferSize),
+	}
+}
+
+func (p *AsyncPublisher) topicOf(eventType string) string {
+	if t, ok := p.conf.Topics[eventType]; ok {
+		return t
+	}
+	return p.conf.DefaultTopic
+}
+
+// Publish 事件没有对应的topic时直接忽略，返回nil
+func (p *AsyncPublisher) Publish(_ context.Context, e Event) error {
+	topic := p.topicOf(e.Type)
+	if topic == "" {
+		return nil
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		p.failures.With("topic", topic, "reason", "encode").Add(1)
+		return err
+	}
+	select {
+	case p.ch <- pending{topic: topic, msg: Message{Key: []byte(e.Key), Value: b}}:
+		return nil
+	default:
+		p.failures.With("topic", topic, "reason", "buffer_full").Add(1)
+		return ErrBufferFull
+	}
+}
+
+func (p *AsyncPublisher) write(topic string, msgs []Message) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.conf.WriteTimeout)
+	defer cancel()
+	if err := p.sink.Write(ctx, topic, msgs); err != nil {
+		p.failures.With("topic", topic, "reason", "write").Add(float64(len(msgs)))
+		p.logger.Log("AsyncPublisher", "write failed", "topic", topic, "n", len(msgs), "err", err)
+	}
+}
+
+// 按topic攒批，每个topic的消息达到BatchSize时写入
+type batcher struct {
+	p       *AsyncPublisher
+	batches map[string][]Message
+}
+
+func (b *batcher) add(m pending) {
+	b.batches[m.topic] = append(b.batches[m.topic], m.msg)
+	if len(b.batches[m.topic]) >= b.p.conf.BatchSize {
+		b.p.write(m.topic, b.batches[m.topic])
+		delete(b.batches, m.topic)
+	}
+}
+
+func (b *batcher) flush() {
+	for topic, msgs := range b.batches {
+		b.p.write(topic, msgs)
+		delete(b.batches, topic)
+	}
+}
+
+// Run 在后台攒批写入Sink，ctx结束时写入已攒的批次后返回，返回后需调用Flush写入缓冲区中剩余的事件
+func (p *AsyncPublisher) Run(ctx context.Context) error {
+	b := &batcher{p: p, batches: map[string][]Message{}}
+	ticker := time.NewTicker(p.conf.BatchTimeout)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			b.flush()
+			return nil
+		case m := <-p.ch:
+			b.add(m)
+		case <-ticker.C:
+			b.flush()
+		}
+	}
+}
+
+// Flush 写入缓冲区中剩余的事件，需要在产生事件的任务(如grpc/http服务)都退出后调用，否则之后Publish的事件会丢失
+func (p *AsyncPublisher) Flush() {
+	b := &batcher{p: p, batches: map[string][]Message{}}
+	for {
+		select {
+		case m := <-p.ch:
+			b.add(m)
+		default:
+			b.flush()
+			return
+		}
+	}
+}
+
+// Close 关闭Sink，在Flush之后调用
+func (p *AsyncPublisher) Close() error {
+	return p.sink.Close()
+}
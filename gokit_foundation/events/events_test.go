@@ -0,0 +1,165 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type memSink struct {
+	mu     sync.Mutex
+	writes map[string][][]Message
+	err    error
+}
+
+func newMemSink() *memSink {
+	return &memSink{writes: map[string][][]Message{}}
+}
+
+func (s *memSink) Write(_ context.Context, topic string, msgs []Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.writes[topic] = append(s.writes[topic], msgs)
+	return nil
+}
+
+func (s *memSink) Close() error { return nil }
+
+// 每个topic每次写入的消息数
+func (s *memSink) batchSizes(topic string) []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n []int
+	for _, msgs := range s.writes[topic] {
+		n = append(n, len(msgs))
+	}
+	return n
+}
+
+func TestAsyncPublisher(t *testing.T) {
+	sink := newMemSink()
+	conf := Config{
+		Topics:       map[string]string{"SumComputed": "sum"},
+		DefaultTopic: "events",
+		BatchSize:    2,
+		BatchTimeout: time.Hour,
+	}
+	p := NewAsyncPublisher(sink, conf, log.NewNopLogger(), nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		_ = p.Run(ctx)
+		close(done)
+	}()
+
+	for i := 0; i < 3; i++ {
+		if err := p.Publish(ctx, Event{Type: "SumComputed", Key: "k", Payload: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = p.Publish(ctx, Event{Type: "Other", Payload: "x"})
+
+	// 达到BatchSize的批次立即写入，其余的在退出时写入
+	time.Sleep(50 * time.Millisecond)
+	if got := sink.batchSizes("sum"); !reflect.DeepEqual(got, []int{2}) {
+		t.Errorf("before exit got batches:%v", got)
+	}
+	cancel()
+	<-done
+	p.Flush()
+	if got := sink.batchSizes("sum"); !reflect.DeepEqual(got, []int{2, 1}) {
+		t.Errorf("after exit got batches:%v", got)
+	}
+	if got := sink.batchSizes("events"); !reflect.DeepEqual(got, []int{1}) {
+		t.Errorf("default topic got batches:%v", got)
+	}
+
+	var e struct {
+		Type    string
+		Key     string
+		Time    time.Time
+		Payload int
+	}
+	msg := sink.writes["sum"][0][1]
+	if err := json.Unmarshal(msg.Value, &e); err != nil {
+		t.Fatal(err)
+	}
+	if string(msg.Key) != "k" || e.Type != "SumComputed" || e.Payload != 1 || e.Time.IsZero() {
+		t.Errorf("got msg key:%s event:%+v", msg.Key, e)
+	}
+}
+
+// 记录每次Add的标签
+type labelCounter struct {
+	mu   *sync.Mutex
+	lvs  []string
+	adds *[]string
+}
+
+func newLabelCounter() labelCounter {
+	return labelCounter{mu: &sync.Mutex{}, adds: new([]string)}
+}
+
+func (c labelCounter) With(lvs ...string) metrics.Counter {
+	return labelCounter{mu: c.mu, lvs: append(c.lvs[:len(c.lvs):len(c.lvs)], lvs...), adds: c.adds}
+}
+
+func (c labelCounter) Add(delta float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := 0; i < int(delta); i++ {
+		*c.adds = append(*c.adds, strings.Join(c.lvs, ","))
+	}
+}
+
+func TestAsyncPublisherFailures(t *testing.T) {
+	sink := newMemSink()
+	failures := newLabelCounter()
+	p := NewAsyncPublisher(sink, Config{Topics: map[string]string{"A": "a"}, BufferSize: 1}, log.NewNopLogger(), failures)
+
+	// 没有对应topic的事件直接忽略
+	if err := p.Publish(context.Background(), Event{Type: "B"}); err != nil {
+		t.Errorf("unmapped event got err:%v", err)
+	}
+	// Run未启动，缓冲区满时丢弃
+	_ = p.Publish(context.Background(), Event{Type: "A"})
+	if err := p.Publish(context.Background(), Event{Type: "A"}); err != ErrBufferFull {
+		t.Errorf("got err:%v want ErrBufferFull", err)
+	}
+	if err := p.Publish(context.Background(), Event{Type: "A", Payload: func() {}}); err == nil {
+		t.Error("want encode err")
+	}
+
+	sink.err = errors.New("broker down")
+	p.Flush()
+	want := []string{"topic,a,reason,buffer_full", "topic,a,reason,encode", "topic,a,reason,write"}
+	if !reflect.DeepEqual(*failures.adds, want) {
+		t.Errorf("got failures:%v", *failures.adds)
+	}
+}
+
+func TestParseTopics(t *testing.T) {
+	got, err := ParseTopics(" SumComputed=addsvc.sum, ConcatComputed=addsvc.concat,")
+	want := map[string]string{"SumComputed": "addsvc.sum", "ConcatComputed": "addsvc.concat"}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("got:%v err:%v", got, err)
+	}
+	if got, err := ParseTopics(""); err != nil || len(got) != 0 {
+		t.Errorf("empty got:%v err:%v", got, err)
+	}
+	for _, s := range []string{"a", "=b", "a="} {
+		if _, err := ParseTopics(s); err == nil {
+			t.Errorf("%q want err", s)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package events
+
+import (
+	"context"
+	"github.com/segmentio/kafka-go"
+	"sync"
+	"time"
+)
+
+// KafkaSink 每个topic一个kafka.Writer，第一次写入时创建
+// 攒批由AsyncPublisher完成，Writer同步写入，失败时按MaxAttempts重试
+type KafkaSink struct {
+	brokers []string
+
+	mu      sync.Mutex
+	writers map[string]*kafka.Writer
+}
+
+func NewKafkaSink(brokers []string) *KafkaSink {
+	return &KafkaSink{brokers: brokers, writers: map[string]*kafka.Writer{}}
+}
+
+func (s *KafkaSink) writer(topic string) *kafka.Writer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w, ok := s.writers[topic]
+	if !ok {
+		w = &kafka.Writer{
+			Addr:  kafka.TCP(s.brokers...),
+			Topic: topic,
+			// 相同Key的事件进入同一分区，Key为空时轮询
+			Balancer:    &kafka.Hash{},
+			MaxAttempts: 3,
+			// 传入的msgs已经是一批，不需要Writer再等待凑满BatchSize
+			BatchTimeout: 10 * time.Millisecond,
+			RequiredAcks: kafka.RequireOne,
+		}
+		s.writers[topic] = w
+	}
+	return w
+}
+
+func (s *KafkaSink) Write(ctx context.Context, topic string, msgs []Message) error {
+	kmsgs := make([]kafka.Message, len(msgs))
+	for i, m := range msgs {
+		kmsgs[i] = kafka.Message{Key: m.Key, Value: m.Value}
+		for k, v := range m.Headers {
+			kmsgs[i].Headers = append(kmsgs[i].Headers, kafka.Header{Key: k, Value: []byte(v)})
+		}
+	}
+	return s.writer(topic).WriteMessages(ctx, kmsgs...)
+}
+
+func (s *KafkaSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var err error
+	for topic, w := range s.writers {
+		if e := w.Close(); e != nil && err == nil {
+			err = e
+		}
+		delete(s.writers, topic)
+	}
+	return err
+}
@@ -0,0 +1,187 @@
+package featureflag
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-kit/kit/endpoint"
+	"hash/fnv"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+/*
+轻量的feature flag(功能开关)，用于新功能的灰度发布和快速关闭，不需要重新部署：
+-	flag配置按名称设置，可以来自配置文件或consul KV(如new_addsvc的dynamic配置中的feature_flags)，也可以在运行时通过Store.Handler修改
+-	Store.Middleware在每次请求时按subject(一般为用户ID)计算全部flag，结果写入ctx，service层通过Enabled读取，
+	同一个请求内flag的结果不会因为配置变化而改变
+-	subject由调用方决定，默认从X-User-Id header(grpc metadata为x-user-id)读取，见HTTPToContext
+-	按比例开启时使用flag名称+subject的hash，同一用户的结果稳定，不同flag的用户分布互相独立
+*/
+
+// Flag 一个功能开关的配置
+//
+//	enabled: false                    对所有人关闭(紧急关闭时只需要改这一项)
+//	enabled: true, percent: 100       对所有人开启
+//	enabled: true, users: [alice]     只对alice开启
+//	enabled: true, percent: 10        对10%的用户开启，没有subject的请求不开启
+type Flag struct {
+	Enabled bool     `json:"enabled" yaml:"enabled"`
+	Users   []string `json:"users,omitempty" yaml:"users"`     // 总是开启的subject
+	Percent float64  `json:"percent,omitempty" yaml:"percent"` // 其余subject中开启的比例，0~100
+}
+
+func (f Flag) Validate() error {
+	if f.Percent < 0 || f.Percent > 100 {
+		return fmt.Errorf("featureflag: percent %v must be in [0, 100]", f.Percent)
+	}
+	return nil
+}
+
+// Evaluate 返回flag对subject(flag名称为name)是否开启
+func (f Flag) Evaluate(name, subject string) bool {
+	if !f.Enabled {
+		return false
+	}
+	if f.Percent >= 100 {
+		return true
+	}
+	if subject == "" {
+		return false
+	}
+	for _, u := range f.Users {
+		if u == subject {
+			return true
+		}
+	}
+	return f.Percent > 0 && float64(bucket(name, subject)) < f.Percent*100
+}
+
+// 0~9999，精度为0.01%
+func bucket(name, subject string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(name + ":" + subject))
+	return h.Sum32() % 10000
+}
+
+type Store struct {
+	flags atomic.Value // map[string]Flag，整体替换，不修改
+}
+
+func NewStore() *Store {
+	s := &Store{}
+	s.flags.Store(map[string]Flag{})
+	return s
+}
+
+// Set 替换全部flag的配置，flags为空时所有flag关闭
+func (s *Store) Set(flags map[string]Flag) error {
+	cp := make(map[string]Flag, len(flags))
+	for name, f := range flags {
+		if err := f.Validate(); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		cp[name] = f
+	}
+	s.flags.Store(cp)
+	return nil
+}
+
+// Flags 当前的配置，不要修改返回的map
+func (s *Store) Flags() map[string]Flag {
+	return s.flags.Load().(map[string]Flag)
+}
+
+// Evaluate 返回subject开启的全部flag
+func (s *Store) Evaluate(subject string) map[string]bool {
+	on := map[string]bool{}
+	for name, f := range s.Flags() {
+		if f.Evaluate(name, subject) {
+			on[name] = true
+		}
+	}
+	return on
+}
+
+// Middleware 计算本次请求的flag并写入ctx，subject为nil时使用SubjectFromContext
+// 需要安装在写入subject的中间件(如JWT认证)内层、依赖flag结果的中间件(如响应缓存)外层
+func (s *Store) Middleware(subject func(ctx context.Context) string) endpoint.Middleware {
+	if subject == nil {
+		subject = SubjectFromContext
+	}
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			return next(withState(ctx, s.Evaluate(subject(ctx))), request)
+		}
+	}
+}
+
+// Handler 运行时查看/修改flag配置，安装在管理用的http端口上：
+//
+//	GET /featureflags                                                   返回当前配置
+//	GET /featureflags?subject=alice                                     返回alice开启的flag
+//	PUT /featureflags -d '{"concat_separator": {"enabled": true, "percent": 50}}' 替换全部配置
+//	DELETE /featureflags                                                关闭全部flag
+func (s *Store) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var v interface{}
+		switch r.Method {
+		case http.MethodGet:
+			if subject := r.URL.Query().Get("subject"); subject != "" {
+				v = s.Evaluate(subject)
+			}
+		case http.MethodPut, http.MethodPost:
+			var flags map[string]Flag
+			if err := json.NewDecoder(r.Body).Decode(&flags); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := s.Set(flags); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		case http.MethodDelete:
+			_ = s.Set(nil)
+		default:
+			w.Header().Set("Allow", "GET, PUT, POST, DELETE")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		if v == nil {
+			v = s.Flags()
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(v)
+	})
+}
+
+type ctxKeyState struct{}
+
+type state struct {
+	on          map[string]bool
+	fingerprint string
+}
+
+func withState(ctx context.Context, on map[string]bool) context.Context {
+	names := make([]string, 0, len(on))
+	for name := range on {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return context.WithValue(ctx, ctxKeyState{}, state{on: on, fingerprint: strings.Join(names, ",")})
+}
+
+// Enabled 返回本次请求中flag是否开启，没有经过Store.Middleware时总是false
+func Enabled(ctx context.Context, name string) bool {
+	st, _ := ctx.Value(ctxKeyState{}).(state)
+	return st.on[name]
+}
+
+// Fingerprint 本次请求开启的全部flag(排序后以,连接)，没有开启的flag时为空字符串
+// 结果受flag影响的接口需要将它加入缓存key，见cache.Config.Vary
+func Fingerprint(ctx context.Context) string {
+	st, _ := ctx.Value(ctxKeyState{}).(state)
+	return st.fingerprint
+}
@@ -0,0 +1,121 @@
+package featureflag
+
+import (
+	"context"
+	"fmt"
+	"google.golang.org/grpc/metadata"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestEvaluate(t *testing.T) {
+	test := []struct {
+		name    string
+		flag    Flag
+		subject string
+		want    bool
+	}{
+		{name: "[disabled]", flag: Flag{Users: []string{"alice"}, Percent: 100}, subject: "alice", want: false},
+		{name: "[all]", flag: Flag{Enabled: true, Percent: 100}, want: true},
+		{name: "[user]", flag: Flag{Enabled: true, Users: []string{"alice"}}, subject: "alice", want: true},
+		{name: "[other user]", flag: Flag{Enabled: true, Users: []string{"alice"}}, subject: "bob", want: false},
+		{name: "[no subject]", flag: Flag{Enabled: true, Percent: 99}, want: false},
+		{name: "[enabled only]", flag: Flag{Enabled: true}, subject: "bob", want: false},
+	}
+	for _, tt := range test {
+		if got := tt.flag.Evaluate("f", tt.subject); got != tt.want {
+			t.Errorf("%s: got %v want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// 按比例开启时结果稳定，比例大致准确
+	f := Flag{Enabled: true, Percent: 30}
+	on := 0
+	for i := 0; i < 10000; i++ {
+		subject := fmt.Sprintf("user%d", i)
+		got := f.Evaluate("f", subject)
+		if got != f.Evaluate("f", subject) {
+			t.Fatalf("%s: not stable", subject)
+		}
+		if got {
+			on++
+		}
+	}
+	if on < 2700 || on > 3300 {
+		t.Errorf("percent 30 got %d/10000", on)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	s := NewStore()
+	if err := s.Set(map[string]Flag{"f": {Percent: 101}}); err == nil {
+		t.Error("want err for percent 101")
+	}
+	_ = s.Set(map[string]Flag{
+		"a": {Enabled: true, Percent: 100},
+		"b": {Enabled: true, Users: []string{"alice"}},
+		"c": {Enabled: false, Percent: 100},
+	})
+	var got []string
+	ep := s.Middleware(nil)(func(ctx context.Context, _ interface{}) (interface{}, error) {
+		got = append(got, fmt.Sprintf("a:%v b:%v c:%v %s", Enabled(ctx, "a"), Enabled(ctx, "b"), Enabled(ctx, "c"), Fingerprint(ctx)))
+		return nil, nil
+	})
+	_, _ = ep(WithSubject(context.Background(), "alice"), nil)
+	_, _ = ep(context.Background(), nil)
+	want := []string{"a:true b:true c:false a,b", "a:true b:false c:false a"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got %v want %v", got, want)
+	}
+	if Enabled(context.Background(), "a") || Fingerprint(context.Background()) != "" {
+		t.Error("want no flag without Middleware")
+	}
+}
+
+func TestHandler(t *testing.T) {
+	s := NewStore()
+	h := s.Handler()
+	do := func(method, target, body string) (int, string) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return w.Code, strings.TrimSpace(w.Body.String())
+	}
+	if code, body := do(http.MethodPut, "/featureflags", `{"f": {"enabled": true, "users": ["alice"]}}`); code != 200 ||
+		body != `{"f":{"enabled":true,"users":["alice"]}}` {
+		t.Errorf("PUT got %d %s", code, body)
+	}
+	if code, body := do(http.MethodGet, "/featureflags?subject=alice", ""); code != 200 || body != `{"f":true}` {
+		t.Errorf("GET subject got %d %s", code, body)
+	}
+	if code, _ := do(http.MethodPut, "/featureflags", `{"f": {"percent": -1}}`); code != http.StatusBadRequest {
+		t.Errorf("PUT invalid got %d", code)
+	}
+	if code, body := do(http.MethodDelete, "/featureflags", ""); code != 200 || body != `{}` {
+		t.Errorf("DELETE got %d %s", code, body)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	r := httptest.NewRequest("POST", "/concat", nil)
+	r.Header.Set(Header, "alice")
+	if s := SubjectFromContext(HTTPToContext()(context.Background(), r)); s != "alice" {
+		t.Errorf("http got subject:%q", s)
+	}
+	r.Header.Set(Header, strings.Repeat("x", maxSubject+1))
+	if s := SubjectFromContext(HTTPToContext()(context.Background(), r)); s != "" {
+		t.Errorf("http too long got subject:%q", s)
+	}
+
+	md := metadata.MD{}
+	ContextToGRPC()(WithSubject(context.Background(), "bob"), &md)
+	if s := SubjectFromContext(GRPCToContext()(context.Background(), md)); s != "bob" {
+		t.Errorf("grpc got subject:%q md:%v", s, md)
+	}
+	r = httptest.NewRequest("POST", "/concat", nil)
+	ContextToHTTP()(WithSubject(context.Background(), "bob"), r)
+	if r.Header.Get(Header) != "bob" {
+		t.Errorf("http client got header:%v", r.Header)
+	}
+}
@@ -0,0 +1,72 @@
+package featureflag
+
+import (
+	"context"
+	grpctransport "github.com/go-kit/kit/transport/grpc"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"google.golang.org/grpc/metadata"
+	"net/http"
+)
+
+const (
+	Header     = "X-User-Id"
+	mdKey      = "x-user-id" // grpc metadata的key是小写的
+	maxSubject = 128
+)
+
+type ctxKeySubject struct{}
+
+// WithSubject 设置计算flag时使用的subject(一般为用户ID)
+func WithSubject(ctx context.Context, subject string) context.Context {
+	return context.WithValue(ctx, ctxKeySubject{}, subject)
+}
+
+// SubjectFromContext ctx中没有subject时返回空字符串
+func SubjectFromContext(ctx context.Context) string {
+	s, _ := ctx.Value(ctxKeySubject{}).(string)
+	return s
+}
+
+func toContext(ctx context.Context, subject string) context.Context {
+	if subject == "" || len(subject) > maxSubject {
+		return ctx
+	}
+	return WithSubject(ctx, subject)
+}
+
+// HTTPToContext 用于httptransport.ServerBefore
+func HTTPToContext() httptransport.RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		return toContext(ctx, r.Header.Get(Header))
+	}
+}
+
+// GRPCToContext 用于grpctransport.ServerBefore
+func GRPCToContext() grpctransport.ServerRequestFunc {
+	return func(ctx context.Context, md metadata.MD) context.Context {
+		if vs := md.Get(mdKey); len(vs) > 0 {
+			return toContext(ctx, vs[0])
+		}
+		return ctx
+	}
+}
+
+// ContextToHTTP 用于httptransport.ClientBefore
+func ContextToHTTP() httptransport.RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		if s := SubjectFromContext(ctx); s != "" {
+			r.Header.Set(Header, s)
+		}
+		return ctx
+	}
+}
+
+// ContextToGRPC 用于grpctransport.ClientBefore
+func ContextToGRPC() grpctransport.ClientRequestFunc {
+	return func(ctx context.Context, md *metadata.MD) context.Context {
+		if s := SubjectFromContext(ctx); s != "" {
+			md.Set(mdKey, s)
+		}
+		return ctx
+	}
+}
@@ -1,30 +1,44 @@
 package gateway
 
 import (
+	"context"
 	"fmt"
-	"gopkg.in/jose.v1/crypto"
-	"gopkg.in/jose.v1/jws"
+	"github.com/dgrijalva/jwt-go"
+	"gokit_foundation/auth"
 	"net/http"
-	"time"
 )
 
 /*
 身份验证相关方法
+	验签复用auth.JWTMiddleware(与后端服务的endpoint层一致)，header格式为 Authorization: Bearer <token>
+	注：之前使用的gopkg.in/jose.v1在init时调用crypto.RegisterHash(0)，新版本go会直接panic，所以不再使用
 */
 
-func authViaJwt(httpReq *http.Request) error {
-	t, err := jws.ParseJWTFromRequest(httpReq)
-	if err != nil {
-		return fmt.Errorf("gateway: authViaJwt.ParseJWT err:%v", err)
-	}
-	// 填充自己业务需要的字段
-	requiredCls := jws.Claims{
-		"aud": "example_aud",
-		"sub": "example_sub",
-		"iss": "example_iss",
+// 填充自己业务需要的字段
+const (
+	jwtSecret   = "your_secret"
+	jwtIssuer   = "example_iss"
+	jwtAudience = "example_aud"
+	jwtSubject  = "example_sub"
+)
+
+var jwtVerify = auth.JWTMiddleware(auth.Config{
+	Key:      auth.StaticKey([]byte(jwtSecret)),
+	Method:   jwt.SigningMethodHS512,
+	Issuer:   jwtIssuer,
+	Audience: jwtAudience,
+}, "")(func(ctx context.Context, _ interface{}) (interface{}, error) {
+	claims, _ := auth.ClaimsFromContext(ctx)
+	if sub, _ := claims["sub"].(string); sub != jwtSubject {
+		return nil, auth.ErrTokenInvalid
 	}
-	validator := jws.NewValidator(requiredCls, time.Duration(0), time.Duration(0), nil)
+	return nil, nil
+})
 
-	err = t.Validate([]byte("your_secret"), crypto.SigningMethodHS512, validator)
-	return err
+func authViaJwt(httpReq *http.Request) error {
+	ctx := auth.HTTPToContext()(httpReq.Context(), httpReq)
+	if _, err := jwtVerify(ctx, nil); err != nil {
+		return fmt.Errorf("gateway: authViaJwt err:%v", err)
+	}
+	return nil
 }
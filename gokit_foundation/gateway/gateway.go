@@ -14,7 +14,6 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
-	"runtime/debug"
 	"syscall"
 	"time"
 )
@@ -84,14 +83,11 @@ func (g *Gateway) Run() error {
 	g.onStart()
 	defer g.onStop()
 
-	srv := &http.Server{
-		Addr: g.addr,
-		// Good practice to set timeouts to avoid Slowloris attacks.
-		WriteTimeout: time.Second * 15,
-		ReadTimeout:  time.Second * 15,
-		IdleTimeout:  time.Second * 60,
-		Handler:      g.r,
-	}
+	// Good practice to set timeouts to avoid Slowloris attacks.
+	conf := gokit_foundation.DefaultHTTPServerConfig()
+	conf.WriteTimeout, conf.ReadTimeout, conf.IdleTimeout = time.Second*15, time.Second*15, time.Second*60
+	srv := gokit_foundation.NewHTTPServer(g.r, conf)
+	srv.Addr = g.addr
 
 	sc := make(chan os.Signal, 1)
 	signal.Notify(sc,
@@ -99,12 +95,19 @@ func (g *Gateway) Run() error {
 		syscall.SIGTERM,
 	)
 
-	var err error
+	// 使用srv启动，Shutdown才能关闭它；启动失败(如端口被占用)时直接返回
+	errc := make(chan error, 1)
 	go func() {
-		err = http.ListenAndServe(g.addr, g.r)
+		errc <- srv.ListenAndServe()
 	}()
 
-	s := <-sc
+	var s os.Signal
+	select {
+	case s = <-sc:
+	case err := <-errc:
+		g.Log("Gateway.Run", "ListenAndServe failed", "err", err)
+		return err
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
 	defer cancel()
@@ -112,25 +115,13 @@ func (g *Gateway) Run() error {
 	_ = srv.Shutdown(ctx)
 
 	g.Log("Gateway.Run", "Stopped", "Signal", s)
-	return err
+	return nil
 }
 
 // setupMW 安装中间件
 func (g *Gateway) setupMW() {
-	recoverMW := func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-			defer func() {
-				if err := recover(); err != nil {
-					g.Log("Gateway.recover_mw", "==================== PANIC ====================")
-					err = g.Log("Gateway.recover_mw", err)
-					err = g.Log("Gateway.recover_mw", "===============================================")
-					// 有些时候仍然有必要打印堆栈信息
-					debug.PrintStack()
-				}
-			}()
-			next.ServeHTTP(w, req)
-		})
-	}
+	// panic时返回500并打印带请求上下文的堆栈，网关不上报指标
+	recoverMW := gokit_foundation.RecoveryHTTPHandler(g.Logger, nil)
 
 	/*
 		mux 使用mw的顺序与安装的顺序相反
@@ -152,11 +143,15 @@ var defGogojsonpbM = &gogojsonpb.Marshaler{
 }
 
 // JSON 直接封装+响应json数据.
+// Content-Type与WriteError、errs.EncodeHTTPError相同，必须在WriteHeader之前设置
 func (g *Gateway) JSON(w http.ResponseWriter, rsp interface{}) error {
 	var (
 		b   []byte
 		err error
 	)
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	}
 	defer func() {
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
@@ -0,0 +1,205 @@
+package gateway
+
+import (
+	"encoding/json"
+	"github.com/go-kit/kit/log"
+	"github.com/gorilla/mux"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"gokit_foundation/reqid"
+	"golang.org/x/time/rate"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+/*
+网关层的http中间件，与后端服务无关，通过mux.Router.Use安装：
+-	AccessLog：为每个请求分配request_id并输出访问日志
+-	Tracing：为每个请求创建server span，后端服务的client从ctx取得并传给下游，网关与后端的span属于同一个trace
+-	RateLimiter：按客户端(默认为ip)限速，超出时返回429
+-	Gateway.AuthMiddleware：JWT身份验证，失败时返回401，一般只安装在需要登录的子路由上
+注意mux只对匹配到路由的请求执行中间件，404/405不会经过这里
+*/
+
+const RequestIDHeader = reqid.Header
+
+// 记录status和写入的字节数
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+	return n, err
+}
+
+// AccessLog 请求header中没有X-Request-Id时生成一个，写入ctx(gokit_foundation.CtxKeyRequestID)和响应header，见reqid.HTTPMiddleware
+func AccessLog(logger log.Logger) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return reqid.HTTPMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			begin := time.Now()
+			reqID := reqid.FromContext(r.Context())
+
+			sw := &statusWriter{ResponseWriter: w}
+			next.ServeHTTP(sw, r)
+			if sw.status == 0 {
+				sw.status = http.StatusOK
+			}
+			logger.Log(
+				"access", "gateway",
+				"request_id", reqID,
+				"method", r.Method,
+				"path", r.URL.Path,
+				"status", sw.status,
+				"bytes", sw.bytes,
+				"remote", r.RemoteAddr,
+				"took", time.Since(begin),
+			)
+		}))
+	}
+}
+
+// Tracing span名为 <method> <路由模板>(如 POST /addsvc/sum)，请求header中带有上游的span时作为其child，
+// 需安装在AccessLog内层；tracer为NoopTracer时不上报
+func Tracing(tracer stdopentracing.Tracer) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path := r.URL.Path
+			if route := mux.CurrentRoute(r); route != nil {
+				if tpl, err := route.GetPathTemplate(); err == nil {
+					path = tpl
+				}
+			}
+			parent, _ := tracer.Extract(stdopentracing.HTTPHeaders, stdopentracing.HTTPHeadersCarrier(r.Header))
+			span := tracer.StartSpan(r.Method+" "+path, ext.RPCServerOption(parent))
+			defer span.Finish()
+			ext.Component.Set(span, "gateway")
+			ext.HTTPMethod.Set(span, r.Method)
+			ext.HTTPUrl.Set(span, r.URL.Path)
+			if reqID := reqid.FromContext(r.Context()); reqID != "" {
+				span.SetTag("request_id", reqID)
+			}
+
+			sw := &statusWriter{ResponseWriter: w}
+			next.ServeHTTP(sw, r.WithContext(stdopentracing.ContextWithSpan(r.Context(), span)))
+			if sw.status == 0 {
+				sw.status = http.StatusOK
+			}
+			ext.HTTPStatusCode.Set(span, uint16(sw.status))
+			if sw.status >= http.StatusInternalServerError {
+				ext.Error.Set(span, true)
+			}
+		})
+	}
+}
+
+// ClientIP 返回请求的来源ip(不含端口)，网关部署在LB之后时应使用LB设置的header替换
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// 超过这个时间没有请求的客户端，其限速器会被清理
+const limiterIdleTTL = 3 * time.Minute
+
+type RateLimiter struct {
+	limit rate.Limit
+	burst int
+	keyFn func(*http.Request) string
+
+	mu        sync.Mutex
+	limiters  map[string]*clientLimiter
+	lastSweep time.Time
+	now       func() time.Time // 测试时替换
+}
+
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// NewRateLimiter 每个客户端一个令牌桶，keyFn为nil时使用ClientIP区分客户端
+func NewRateLimiter(limit rate.Limit, burst int, keyFn func(*http.Request) string) *RateLimiter {
+	if keyFn == nil {
+		keyFn = ClientIP
+	}
+	return &RateLimiter{
+		limit:     limit,
+		burst:     burst,
+		keyFn:     keyFn,
+		limiters:  map[string]*clientLimiter{},
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+func (rl *RateLimiter) Allow(key string) bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	now := rl.now()
+	// 顺带清理长时间没有请求的客户端，避免map无限增长
+	if now.Sub(rl.lastSweep) > limiterIdleTTL {
+		for k, cl := range rl.limiters {
+			if now.Sub(cl.lastSeen) > limiterIdleTTL {
+				delete(rl.limiters, k)
+			}
+		}
+		rl.lastSweep = now
+	}
+	cl, ok := rl.limiters[key]
+	if !ok {
+		cl = &clientLimiter{limiter: rate.NewLimiter(rl.limit, rl.burst)}
+		rl.limiters[key] = cl
+	}
+	cl.lastSeen = now
+	return cl.limiter.AllowN(now, 1)
+}
+
+func (rl *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !rl.Allow(rl.keyFn(r)) {
+			WriteError(w, http.StatusTooManyRequests, "rate limited")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// AuthMiddleware 对请求做身份验证(见authenticate)，失败时返回401
+func (g *Gateway) AuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := g.authenticate(r); err != nil {
+			g.Log("Gateway.AuthMiddleware->err", err, "method", r.Method, "path", r.URL.Path)
+			WriteError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type errorBody struct {
+	Error string `json:"error"`
+}
+
+// WriteError 网关自身的错误(如限速、认证失败、后端服务不可用)统一以 {"error": msg} 响应
+func WriteError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(errorBody{Error: gatewayErrPrefix + " " + msg})
+}
@@ -0,0 +1,161 @@
+package gateway
+
+import (
+	"bytes"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/go-kit/kit/log"
+	"github.com/gorilla/mux"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"gokit_foundation"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAccessLog(t *testing.T) {
+	buf := new(bytes.Buffer)
+	r := mux.NewRouter()
+	r.Use(AccessLog(log.NewLogfmtLogger(buf)))
+	var gotID interface{}
+	r.HandleFunc("/x", func(w http.ResponseWriter, r *http.Request) {
+		gotID = r.Context().Value(gokit_foundation.CtxKeyRequestID)
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	// 沿用请求中的request_id
+	req := httptest.NewRequest("GET", "/x", nil)
+	req.Header.Set(RequestIDHeader, "abc")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if gotID != "abc" || w.Header().Get(RequestIDHeader) != "abc" {
+		t.Errorf("got ctx id:%v header id:%s", gotID, w.Header().Get(RequestIDHeader))
+	}
+	if s := buf.String(); !strings.Contains(s, "request_id=abc") || !strings.Contains(s, "status=418") {
+		t.Errorf("got log:%s", s)
+	}
+
+	// 没有时生成
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/x", nil))
+	if id := w.Header().Get(RequestIDHeader); len(id) != 16 || gotID != id {
+		t.Errorf("got generated id:%s ctx id:%v", id, gotID)
+	}
+}
+
+func TestTracing(t *testing.T) {
+	tracer := mocktracer.New()
+	r := mux.NewRouter()
+	r.Use(AccessLog(log.NewNopLogger()), Tracing(tracer))
+	var inCtx stdopentracing.Span
+	r.PathPrefix("/addsvc").Subrouter().HandleFunc("/sum/{id}", func(w http.ResponseWriter, r *http.Request) {
+		inCtx = stdopentracing.SpanFromContext(r.Context())
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	// 上游的span通过header传入
+	parent := tracer.StartSpan("upstream")
+	req := httptest.NewRequest("POST", "/addsvc/sum/1", nil)
+	req.Header.Set(RequestIDHeader, "abc")
+	_ = tracer.Inject(parent.Context(), stdopentracing.HTTPHeaders, stdopentracing.HTTPHeadersCarrier(req.Header))
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := tracer.FinishedSpans()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans", len(spans))
+	}
+	sp := spans[0]
+	if sp.OperationName != "POST /addsvc/sum/{id}" || sp.ParentID != parent.Context().(mocktracer.MockSpanContext).SpanID {
+		t.Errorf("got span:%s parent:%d", sp.OperationName, sp.ParentID)
+	}
+	if inCtx == nil || inCtx.Context().(mocktracer.MockSpanContext).SpanID != sp.SpanContext.SpanID {
+		t.Error("span is not in request ctx")
+	}
+	tags := sp.Tags()
+	if tags["span.kind"] != ext.SpanKindRPCServerEnum || tags["http.url"] != "/addsvc/sum/1" || tags["http.status_code"] != uint16(503) ||
+		tags["error"] != true || tags["request_id"] != "abc" {
+		t.Errorf("got tags:%v", tags)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	rl := NewRateLimiter(1, 2, nil)
+	now := time.Now()
+	rl.now = func() time.Time { return now }
+	h := rl.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	do := func(remote string) int {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = remote
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code
+	}
+	// burst为2，同一ip的端口不同也算同一个客户端
+	got := []int{do("1.1.1.1:1000"), do("1.1.1.1:1001"), do("1.1.1.1:1002"), do("2.2.2.2:1000")}
+	want := []int{200, 200, 429, 200}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got codes:%v want:%v", got, want)
+		}
+	}
+	// 1秒后补充一个令牌
+	now = now.Add(time.Second)
+	if c := do("1.1.1.1:1000"); c != 200 {
+		t.Errorf("got code:%d after refill", c)
+	}
+
+	// 空闲的客户端被清理
+	now = now.Add(limiterIdleTTL * 2)
+	do("3.3.3.3:1000")
+	if n := len(rl.limiters); n != 1 {
+		t.Errorf("got %d limiters after sweep, want 1", n)
+	}
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	g := New(mux.NewRouter(), "", gokit_foundation.NewLogger(log.NewNopLogger()))
+	called := false
+	h := g.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true }))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusUnauthorized || called {
+		t.Errorf("got code:%d called:%v", w.Code, called)
+	}
+	if !strings.Contains(w.Body.String(), `"error":"gateway: unauthorized"`) {
+		t.Errorf("got body:%s", w.Body.String())
+	}
+}
+
+func genToken(claims jwt.MapClaims, method jwt.SigningMethod) string {
+	s, _ := jwt.NewWithClaims(method, claims).SignedString([]byte(jwtSecret))
+	return s
+}
+
+func TestAuthViaJwt(t *testing.T) {
+	ok := jwt.MapClaims{"aud": jwtAudience, "sub": jwtSubject, "iss": jwtIssuer}
+	test := []struct {
+		name    string
+		header  string
+		wantErr bool
+	}{
+		{"[ok]", "Bearer " + genToken(ok, jwt.SigningMethodHS512), false},
+		{"[upper case bearer]", "BEARER " + genToken(ok, jwt.SigningMethodHS512), false},
+		{"[missing]", "", true},
+		{"[wrong alg]", "Bearer " + genToken(ok, jwt.SigningMethodHS256), true},
+		{"[wrong sub]", "Bearer " + genToken(jwt.MapClaims{"aud": jwtAudience, "sub": "x", "iss": jwtIssuer}, jwt.SigningMethodHS512), true},
+	}
+	for _, tt := range test {
+		req := httptest.NewRequest("GET", "/", nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		if err := authViaJwt(req); (err != nil) != tt.wantErr {
+			t.Errorf("name:%s got err:%v", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package gokit_foundation
+
+import (
+	"context"
+	"github.com/go-kit/kit/metrics"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+	"gokit_foundation/metricsx"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"io"
+	"sync"
+	"time"
+)
+
+/*
+grpc client的指标，与GRPCServerMetrics对应，通过UnaryClientInterceptor/StreamClientInterceptor安装：
+-	grpc_client_handled_total：完成的调用数，标签method、type、code
+-	grpc_client_handling_seconds：调用耗时(直方图，包括重试时为所有重试的总耗时，取决于安装位置)，标签method、type、code
+-	grpc_client_in_flight：正在进行的调用数，标签method、type
+-	grpc_client_msg_received_total/grpc_client_msg_sent_total：流式调用收发的消息数，标签method、type
+流式调用在收到最后一条响应(io.EOF或err)时结束，调用方没有读完响应就放弃的流不会被记录为完成
+*/
+
+type GRPCClientMetrics struct {
+	handled     metrics.Counter
+	handling    metrics.Histogram
+	inFlight    metrics.Gauge
+	msgReceived metrics.Counter
+	msgSent     metrics.Counter
+}
+
+// NewGRPCClientMetrics 注册失败时的处理与NewGRPCServerMetrics相同
+func NewGRPCClientMetrics(reg stdprometheus.Registerer, namespace, subsystem string) (*GRPCClientMetrics, error) {
+	p := metricsx.NewPrometheus(registererOnly{reg}, nil)
+	m := NewGRPCClientMetricsWith(p, namespace, subsystem)
+	return m, p.Err()
+}
+
+// NewGRPCClientMetricsWith 与NewGRPCServerMetricsWith相同，指标由p创建
+func NewGRPCClientMetricsWith(p metricsx.Provider, namespace, subsystem string) *GRPCClientMetrics {
+	opts := func(name, help string, labelNames ...string) metricsx.Opts {
+		return metricsx.Opts{Namespace: namespace, Subsystem: subsystem, Name: name, Help: help, LabelNames: labelNames}
+	}
+	return &GRPCClientMetrics{
+		handled: p.NewCounter(opts("grpc_client_handled_total",
+			"Total number of RPCs completed by the client, regardless of success or failure.", "method", "type", "code")),
+		handling: p.NewHistogram(opts("grpc_client_handling_seconds",
+			"Histogram of response latency (seconds) of the gRPC until it is finished by the application.", "method", "type", "code"),
+			stdprometheus.DefBuckets),
+		inFlight: p.NewGauge(opts("grpc_client_in_flight",
+			"Number of RPCs currently in flight on the client.", "method", "type")),
+		msgReceived: p.NewCounter(opts("grpc_client_msg_received_total",
+			"Total number of stream messages received from the server.", "method", "type")),
+		msgSent: p.NewCounter(opts("grpc_client_msg_sent_total",
+			"Total number of stream messages sent by the client.", "method", "type")),
+	}
+}
+
+func (m *GRPCClientMetrics) begin(method, typ string) func(err error) {
+	begin := time.Now()
+	inFlight := m.inFlight.With("method", method, "type", typ)
+	inFlight.Add(1)
+	return func(err error) {
+		inFlight.Add(-1)
+		code := status.Code(err).String()
+		m.handled.With("method", method, "type", typ, "code", code).Add(1)
+		m.handling.With("method", method, "type", typ, "code", code).Observe(time.Since(begin).Seconds())
+	}
+}
+
+func (m *GRPCClientMetrics) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		end := m.begin(method, grpcTypeUnary)
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		end(err)
+		return err
+	}
+}
+
+func (m *GRPCClientMetrics) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		typ := clientStreamType(desc)
+		end := m.begin(method, typ)
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			end(err)
+			return nil, err
+		}
+		return &monitoredClientStream{
+			ClientStream:  cs,
+			serverStreams: desc.ServerStreams,
+			end:           end,
+			received:      m.msgReceived.With("method", method, "type", typ),
+			sent:          m.msgSent.With("method", method, "type", typ),
+		}, nil
+	}
+}
+
+func clientStreamType(desc *grpc.StreamDesc) string {
+	switch {
+	case desc.ClientStreams && desc.ServerStreams:
+		return grpcTypeBidiStream
+	case desc.ClientStreams:
+		return grpcTypeClientStream
+	}
+	return grpcTypeServerStream
+}
+
+type monitoredClientStream struct {
+	grpc.ClientStream
+	serverStreams  bool // 为false时收到唯一的响应后调用结束
+	once           sync.Once
+	end            func(err error)
+	received, sent metrics.Counter
+}
+
+func (s *monitoredClientStream) SendMsg(m interface{}) error {
+	err := s.ClientStream.SendMsg(m)
+	if err == nil {
+		s.sent.Add(1)
+	}
+	return err
+}
+
+func (s *monitoredClientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	switch {
+	case err == nil:
+		s.received.Add(1)
+		if !s.serverStreams {
+			s.once.Do(func() { s.end(nil) })
+		}
+	case err == io.EOF:
+		s.once.Do(func() { s.end(nil) })
+	default:
+		s.once.Do(func() { s.end(err) })
+	}
+	return err
+}
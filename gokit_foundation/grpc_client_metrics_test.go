@@ -0,0 +1,95 @@
+package gokit_foundation
+
+import (
+	"context"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+	"testing"
+)
+
+func TestGRPCClientMetricsUnary(t *testing.T) {
+	reg := stdprometheus.NewRegistry()
+	m, err := NewGRPCClientMetrics(reg, "test", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	interceptor := m.UnaryClientInterceptor()
+	for _, err := range []error{nil, status.Error(codes.Unavailable, "down")} {
+		_ = interceptor(context.Background(), "/test/Method", nil, nil, nil, func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			if g := findMetric(t, reg, "test_grpc_client_in_flight", map[string]string{"method": "/test/Method", "type": "unary"}); g.GetGauge().GetValue() != 1 {
+				t.Errorf("in_flight got:%v want:1", g.GetGauge().GetValue())
+			}
+			return err
+		})
+	}
+	for _, code := range []string{"OK", "Unavailable"} {
+		labels := map[string]string{"method": "/test/Method", "type": "unary", "code": code}
+		if c := findMetric(t, reg, "test_grpc_client_handled_total", labels); c.GetCounter().GetValue() != 1 {
+			t.Errorf("code:%s handled got:%v want:1", code, c.GetCounter().GetValue())
+		}
+		if h := findMetric(t, reg, "test_grpc_client_handling_seconds", labels); h.GetHistogram().GetSampleCount() != 1 {
+			t.Errorf("code:%s handling got:%v want:1", code, h.GetHistogram().GetSampleCount())
+		}
+	}
+}
+
+type fakeClientStream struct {
+	grpc.ClientStream
+	recv int // 返回io.EOF之前可以接收的消息数
+}
+
+func (s *fakeClientStream) SendMsg(m interface{}) error { return nil }
+
+func (s *fakeClientStream) RecvMsg(m interface{}) error {
+	if s.recv == 0 {
+		return io.EOF
+	}
+	s.recv--
+	return nil
+}
+
+func TestGRPCClientMetricsStream(t *testing.T) {
+	reg := stdprometheus.NewRegistry()
+	m, _ := NewGRPCClientMetrics(reg, "test", "")
+	open := func(desc *grpc.StreamDesc, recv int) grpc.ClientStream {
+		cs, err := m.StreamClientInterceptor()(context.Background(), desc, nil, "/test/Stream", func(context.Context, *grpc.StreamDesc, *grpc.ClientConn, string, ...grpc.CallOption) (grpc.ClientStream, error) {
+			return &fakeClientStream{recv: recv}, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cs
+	}
+	// server stream：收到2条消息后io.EOF
+	cs := open(&grpc.StreamDesc{ServerStreams: true}, 2)
+	for cs.RecvMsg(nil) == nil {
+	}
+	labels := map[string]string{"method": "/test/Stream", "type": "server_stream"}
+	if c := findMetric(t, reg, "test_grpc_client_msg_received_total", labels); c.GetCounter().GetValue() != 2 {
+		t.Errorf("received got:%v want:2", c.GetCounter().GetValue())
+	}
+	labels["code"] = "OK"
+	if c := findMetric(t, reg, "test_grpc_client_handled_total", labels); c.GetCounter().GetValue() != 1 {
+		t.Errorf("handled got:%v want:1", c.GetCounter().GetValue())
+	}
+
+	// client stream：发送3条，收到唯一的响应时结束
+	cs = open(&grpc.StreamDesc{ClientStreams: true}, 1)
+	for i := 0; i < 3; i++ {
+		_ = cs.SendMsg(nil)
+	}
+	labels = map[string]string{"method": "/test/Stream", "type": "client_stream"}
+	if g := findMetric(t, reg, "test_grpc_client_in_flight", labels); g.GetGauge().GetValue() != 1 {
+		t.Errorf("in_flight got:%v want:1", g.GetGauge().GetValue())
+	}
+	_ = cs.RecvMsg(nil)
+	if c := findMetric(t, reg, "test_grpc_client_msg_sent_total", labels); c.GetCounter().GetValue() != 3 {
+		t.Errorf("sent got:%v want:3", c.GetCounter().GetValue())
+	}
+	if g := findMetric(t, reg, "test_grpc_client_in_flight", labels); g.GetGauge().GetValue() != 0 {
+		t.Errorf("in_flight got:%v want:0", g.GetGauge().GetValue())
+	}
+}
@@ -0,0 +1,63 @@
+package gokit_foundation
+
+import (
+	"context"
+	"github.com/go-kit/kit/metrics"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/stats"
+)
+
+/*
+grpc的gzip压缩：
+-	导入google.golang.org/grpc/encoding/gzip即注册了gzip编码，server自动解压gzip压缩的请求，并使用与请求相同的编码压缩响应，
+	client通过grpc.UseCompressor(gzip.Name)(调用选项或grpc.WithDefaultCallOptions)启用，没有启用的client不受影响
+-	SetGRPCGzipLevel设置压缩级别，是进程全局的(grpc的限制)，server和client共用
+-	GRPCCompressionStatsHandler统计消息压缩前(uncompressed)和线路上(wire，不包括5字节的消息头)的字节数，两者的比值即压缩率，
+	labels: direction(in、out)、kind(wire、uncompressed)，没有压缩的消息两者相等
+*/
+
+const GRPCGzip = gzip.Name
+
+// SetGRPCGzipLevel level为gzip.DefaultCompression(-1)或1~9
+func SetGRPCGzipLevel(level int) error {
+	return gzip.SetLevel(level)
+}
+
+// grpc的消息头：1字节的压缩标志 + 4字节长度
+const grpcMsgHeaderLen = 5
+
+type grpcCompressionStats struct {
+	inWire, inRaw, outWire, outRaw metrics.Counter
+}
+
+// NewGRPCCompressionStatsHandler 通过grpc.StatsHandler安装，server和client都可以使用
+func NewGRPCCompressionStatsHandler(bytes metrics.Counter) stats.Handler {
+	return &grpcCompressionStats{
+		inWire:  bytes.With("direction", "in", "kind", "wire"),
+		inRaw:   bytes.With("direction", "in", "kind", "uncompressed"),
+		outWire: bytes.With("direction", "out", "kind", "wire"),
+		outRaw:  bytes.With("direction", "out", "kind", "uncompressed"),
+	}
+}
+
+func (h *grpcCompressionStats) HandleRPC(_ context.Context, s stats.RPCStats) {
+	switch p := s.(type) {
+	case *stats.InPayload:
+		h.inWire.Add(float64(p.WireLength))
+		h.inRaw.Add(float64(p.Length))
+	case *stats.OutPayload:
+		// 与InPayload不同，OutPayload的WireLength包括消息头
+		h.outWire.Add(float64(p.WireLength - grpcMsgHeaderLen))
+		h.outRaw.Add(float64(p.Length))
+	}
+}
+
+func (h *grpcCompressionStats) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (h *grpcCompressionStats) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (h *grpcCompressionStats) HandleConn(context.Context, stats.ConnStats) {}
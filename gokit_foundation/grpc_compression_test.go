@@ -0,0 +1,76 @@
+package gokit_foundation
+
+import (
+	"context"
+	"github.com/go-kit/kit/metrics"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 按所有label的值分别计数
+type bytesCounter struct {
+	mu     *sync.Mutex
+	counts map[string]float64
+	labels string
+}
+
+func (c bytesCounter) With(lvs ...string) metrics.Counter {
+	return bytesCounter{mu: c.mu, counts: c.counts, labels: c.labels + strings.Join(lvs, "/")}
+}
+
+func (c bytesCounter) Add(d float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts[c.labels] += d
+}
+
+func (c bytesCounter) get(labels string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.counts[labels]
+}
+
+func TestGRPCCompression(t *testing.T) {
+	counter := bytesCounter{mu: new(sync.Mutex), counts: map[string]float64{}}
+	srv := NewGRPCServerBuilder(GRPCServerConfig{}).Options(grpc.StatsHandler(NewGRPCCompressionStatsHandler(counter))).Build()
+	RegisterGRPCHealthSrv(srv).SetServing(true)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	cli := healthpb.NewHealthClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// 未启用压缩时线路上的字节数与压缩前相同
+	if _, err = cli.Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	in, out := counter.get("direction/in/kind/uncompressed"), counter.get("direction/out/kind/uncompressed")
+	if out == 0 || counter.get("direction/in/kind/wire") != in || counter.get("direction/out/kind/wire") != out {
+		t.Fatalf("got counts:%v", counter.counts)
+	}
+
+	// 启用gzip后请求被压缩，不存在的服务名返回NotFound，不影响请求的统计
+	_, _ = cli.Check(ctx, &healthpb.HealthCheckRequest{Service: strings.Repeat("compressible", 100)}, grpc.UseCompressor(GRPCGzip))
+	rawIn, wireIn := counter.get("direction/in/kind/uncompressed")-in, counter.get("direction/in/kind/wire")-in
+	if rawIn < 1200 || wireIn <= 0 || wireIn >= rawIn/10 {
+		t.Errorf("got uncompressed:%v wire:%v", rawIn, wireIn)
+	}
+	if err := SetGRPCGzipLevel(10); err == nil {
+		t.Error("want err for invalid level")
+	}
+}
@@ -5,17 +5,35 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/health/grpc_health_v1"
 	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 /*
 grpc的健康检查接口，提供给consul调用
+可以通过AddChecker注册依赖检查(见health.go)，所有依赖都可用且没有提前下线时才返回SERVING
+http的/healthz、/readyz(见HealthzHandler、ReadyzHandler)使用同一组依赖检查
 */
-type HealthCheckServer struct{}
+type HealthCheckServer struct {
+	// 零值表示SERVING，服务退出前可通过SetServing(false)提前下线(lame duck)
+	notServing int32
+	// 零值表示启动完成，预热期间(见Warmup)通过SetWarmingUp(true)置为NOT_SERVING，与SetServing互不影响
+	warmingUp int32
 
-func (s *HealthCheckServer) Check(_ context.Context, _ *grpc_health_v1.HealthCheckRequest) (*grpc_health_v1.HealthCheckResponse, error) {
+	mu       sync.RWMutex
+	checkers map[string]HealthChecker
+}
+
+// 每个依赖检查的超时时间
+var HealthCheckTimeout = time.Second * 2
+
+func (s *HealthCheckServer) Check(ctx context.Context, _ *grpc_health_v1.HealthCheckRequest) (*grpc_health_v1.HealthCheckResponse, error) {
 	log.Println("health Checking...")
+	status, _ := s.Ready(ctx)
 	return &grpc_health_v1.HealthCheckResponse{
-		Status: grpc_health_v1.HealthCheckResponse_SERVING,
+		Status: status,
 	}, nil
 }
 
@@ -23,7 +41,96 @@ func (s *HealthCheckServer) Watch(*grpc_health_v1.HealthCheckRequest, grpc_healt
 	return nil
 }
 
-func RegisterGRPCHealthSrv(srv *grpc.Server) {
+func (s *HealthCheckServer) SetServing(serving bool) {
+	var v int32
+	if !serving {
+		v = 1
+	}
+	atomic.StoreInt32(&s.notServing, v)
+}
+
+// SetWarmingUp 预热结束前不接收流量，退出时的SetServing(false)不会因为预热结束而被覆盖
+func (s *HealthCheckServer) SetWarmingUp(warmingUp bool) {
+	var v int32
+	if warmingUp {
+		v = 1
+	}
+	atomic.StoreInt32(&s.warmingUp, v)
+}
+
+// Status 只反映SetServing、SetWarmingUp设置的状态，不执行依赖检查
+func (s *HealthCheckServer) Status() grpc_health_v1.HealthCheckResponse_ServingStatus {
+	if atomic.LoadInt32(&s.notServing) == 1 || atomic.LoadInt32(&s.warmingUp) == 1 {
+		return grpc_health_v1.HealthCheckResponse_NOT_SERVING
+	}
+	return grpc_health_v1.HealthCheckResponse_SERVING
+}
+
+// AddChecker 注册一个依赖检查，name重复时覆盖之前的
+func (s *HealthCheckServer) AddChecker(name string, checker HealthChecker) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.checkers == nil {
+		s.checkers = map[string]HealthChecker{}
+	}
+	s.checkers[name] = checker
+}
+
+// RunCheckers 并发执行所有依赖检查，返回每个依赖的结果(nil表示可用)
+func (s *HealthCheckServer) RunCheckers(ctx context.Context) map[string]error {
+	s.mu.RLock()
+	names := make([]string, 0, len(s.checkers))
+	for name := range s.checkers {
+		names = append(names, name)
+	}
+	checkers := make([]HealthChecker, len(names))
+	sort.Strings(names)
+	for i, name := range names {
+		checkers[i] = s.checkers[name]
+	}
+	s.mu.RUnlock()
+
+	errs := make([]error, len(names))
+	var wg sync.WaitGroup
+	for i := range checkers {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, HealthCheckTimeout)
+			defer cancel()
+			errs[i] = checkers[i](ctx)
+		}(i)
+	}
+	wg.Wait()
+
+	results := make(map[string]error, len(names))
+	for i, name := range names {
+		results[name] = errs[i]
+	}
+	return results
+}
+
+// Ready 汇总SetServing的状态和所有依赖检查的结果，任一不满足时为NOT_SERVING
+// 已提前下线时不再执行依赖检查，results为nil
+func (s *HealthCheckServer) Ready(ctx context.Context) (grpc_health_v1.HealthCheckResponse_ServingStatus, map[string]error) {
+	if s.Status() != grpc_health_v1.HealthCheckResponse_SERVING {
+		return grpc_health_v1.HealthCheckResponse_NOT_SERVING, nil
+	}
+	results := s.RunCheckers(ctx)
+	return aggregateStatus(results), results
+}
+
+func aggregateStatus(results map[string]error) grpc_health_v1.HealthCheckResponse_ServingStatus {
+	for _, err := range results {
+		if err != nil {
+			return grpc_health_v1.HealthCheckResponse_NOT_SERVING
+		}
+	}
+	return grpc_health_v1.HealthCheckResponse_SERVING
+}
+
+func RegisterGRPCHealthSrv(srv *grpc.Server) *HealthCheckServer {
 	s := &HealthCheckServer{}
 	grpc_health_v1.RegisterHealthServer(srv, s)
+	return s
 }
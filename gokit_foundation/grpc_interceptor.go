@@ -0,0 +1,49 @@
+package gokit_foundation
+
+import (
+	"context"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"time"
+)
+
+/*
+grpc server的一元调用拦截器，在transport层之前执行(此时请求还未decode)，
+所以decode失败、panic的调用也能被记录
+*/
+
+// ChainUnaryInterceptors 将多个拦截器合并为一个，执行顺序与参数顺序一致：
+// 第一个在最外层，最先执行、最后返回，最后一个紧挨着handler执行
+// 如 ChainUnaryInterceptors(recovery, metrics, logging, kitgrpc.Interceptor)
+// 执行顺序为 recovery -> metrics -> logging -> kitgrpc.Interceptor -> handler
+func ChainUnaryInterceptors(interceptors ...grpc.UnaryServerInterceptor) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		// 从最后一个开始往外包装handler
+		next := handler
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			interceptor, h := interceptors[i], next
+			next = func(ctx context.Context, req interface{}) (interface{}, error) {
+				return interceptor(ctx, req, info, h)
+			}
+		}
+		return next(ctx, req)
+	}
+}
+
+// MetricsUnaryInterceptor 记录每个rpc调用的耗时，标签为method(完整方法名)和code(grpc状态码)
+func MetricsUnaryInterceptor(duration metrics.Histogram) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		begin := time.Now()
+		rsp, err := handler(ctx, req)
+		duration.With("method", info.FullMethod, "code", status.Code(err).String()).Observe(time.Since(begin).Seconds())
+		return rsp, err
+	}
+}
+
+// LoggingUnaryInterceptor 每个rpc调用打印一行日志
+// Deprecated: 使用AccessLogUnaryInterceptor，日志中多了peer和请求/响应大小
+func LoggingUnaryInterceptor(logger log.Logger) grpc.UnaryServerInterceptor {
+	return AccessLogUnaryInterceptor(logger)
+}
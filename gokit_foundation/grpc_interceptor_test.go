@@ -0,0 +1,37 @@
+package gokit_foundation
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"reflect"
+	"testing"
+)
+
+func TestChainUnaryInterceptors(t *testing.T) {
+	var order []string
+	record := func(name string) grpc.UnaryServerInterceptor {
+		return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			order = append(order, name+".before")
+			rsp, err := handler(ctx, req)
+			order = append(order, name+".after")
+			return rsp, err
+		}
+	}
+	chain := ChainUnaryInterceptors(record("a"), record("b"), record("c"))
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		order = append(order, "handler")
+		return "rsp", nil
+	}
+
+	for i := 0; i < 2; i++ {
+		order = nil
+		rsp, err := chain(context.Background(), "req", &grpc.UnaryServerInfo{FullMethod: "/test/Method"}, handler)
+		if err != nil || rsp != "rsp" {
+			t.Fatalf("got rsp:%v err:%v", rsp, err)
+		}
+		want := []string{"a.before", "b.before", "c.before", "handler", "c.after", "b.after", "a.after"}
+		if !reflect.DeepEqual(order, want) {
+			t.Errorf("call:%d got order:%v want:%v", i, order, want)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package gokit_foundation
+
+import (
+	"context"
+	"github.com/go-kit/kit/metrics"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"gokit_foundation/metricsx"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"time"
+)
+
+/*
+grpc server的指标(默认为prometheus，其他后端见NewGRPCServerMetricsWith)，通过UnaryServerInterceptor/StreamServerInterceptor安装，指标名(加上namespace和subsystem前缀)：
+-	grpc_server_handled_total：完成的调用数，标签method、type、code
+-	grpc_server_handling_seconds：调用耗时(直方图)，标签method、type、code
+-	grpc_server_in_flight：正在处理的调用数，标签method、type
+-	grpc_server_msg_received_total/grpc_server_msg_sent_total：流式调用收发的消息数，标签method、type
+method为完整方法名(如/addsvcpb.Add/Sum)，type为unary、client_stream、server_stream或bidi_stream，code为grpc状态码
+*/
+
+const (
+	grpcTypeUnary        = "unary"
+	grpcTypeClientStream = "client_stream"
+	grpcTypeServerStream = "server_stream"
+	grpcTypeBidiStream   = "bidi_stream"
+)
+
+type GRPCServerMetrics struct {
+	handled     metrics.Counter
+	handling    metrics.Histogram
+	inFlight    metrics.Gauge
+	msgReceived metrics.Counter
+	msgSent     metrics.Counter
+}
+
+// NewGRPCServerMetrics 创建指标并注册到reg，注册失败的指标退化为discard(不上报)，
+// 此时返回第一个注册失败的err，返回的对象仍然可以使用
+func NewGRPCServerMetrics(reg stdprometheus.Registerer, namespace, subsystem string) (*GRPCServerMetrics, error) {
+	p := metricsx.NewPrometheus(registererOnly{reg}, nil)
+	m := NewGRPCServerMetricsWith(p, namespace, subsystem)
+	return m, p.Err()
+}
+
+// NewGRPCServerMetricsWith 指标由p创建，后端可以是prometheus以外的statsd、otlp等(见metricsx)
+func NewGRPCServerMetricsWith(p metricsx.Provider, namespace, subsystem string) *GRPCServerMetrics {
+	opts := func(name, help string, labelNames ...string) metricsx.Opts {
+		return metricsx.Opts{Namespace: namespace, Subsystem: subsystem, Name: name, Help: help, LabelNames: labelNames}
+	}
+	return &GRPCServerMetrics{
+		handled: p.NewCounter(opts("grpc_server_handled_total",
+			"Total number of RPCs completed on the server, regardless of success or failure.", "method", "type", "code")),
+		handling: p.NewHistogram(opts("grpc_server_handling_seconds",
+			"Histogram of response latency (seconds) of gRPC that had been application-level handled by the server.", "method", "type", "code"),
+			stdprometheus.DefBuckets),
+		inFlight: p.NewGauge(opts("grpc_server_in_flight",
+			"Number of RPCs currently being handled by the server.", "method", "type")),
+		msgReceived: p.NewCounter(opts("grpc_server_msg_received_total",
+			"Total number of stream messages received from the client.", "method", "type")),
+		msgSent: p.NewCounter(opts("grpc_server_msg_sent_total",
+			"Total number of stream messages sent by the server.", "method", "type")),
+	}
+}
+
+// 只用于注册，NewGRPCServerMetrics不需要Gather
+type registererOnly struct {
+	stdprometheus.Registerer
+}
+
+func (registererOnly) Gather() ([]*dto.MetricFamily, error) {
+	return nil, nil
+}
+
+// 开始一次调用，返回的函数在调用结束时执行
+func (m *GRPCServerMetrics) begin(method, typ string) func(err error) {
+	begin := time.Now()
+	inFlight := m.inFlight.With("method", method, "type", typ)
+	inFlight.Add(1)
+	return func(err error) {
+		inFlight.Add(-1)
+		code := status.Code(err).String()
+		m.handled.With("method", method, "type", typ, "code", code).Add(1)
+		m.handling.With("method", method, "type", typ, "code", code).Observe(time.Since(begin).Seconds())
+	}
+}
+
+// UnaryServerInterceptor 一般安装在RecoveryUnaryInterceptor之后，这样panic的调用也会以codes.Internal记录
+func (m *GRPCServerMetrics) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		end := m.begin(info.FullMethod, grpcTypeUnary)
+		rsp, err := handler(ctx, req)
+		end(err)
+		return rsp, err
+	}
+}
+
+func (m *GRPCServerMetrics) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		typ := streamType(info)
+		end := m.begin(info.FullMethod, typ)
+		err := handler(srv, &monitoredStream{
+			ServerStream: ss,
+			received:     m.msgReceived.With("method", info.FullMethod, "type", typ),
+			sent:         m.msgSent.With("method", info.FullMethod, "type", typ),
+		})
+		end(err)
+		return err
+	}
+}
+
+func streamType(info *grpc.StreamServerInfo) string {
+	switch {
+	case info.IsClientStream && info.IsServerStream:
+		return grpcTypeBidiStream
+	case info.IsClientStream:
+		return grpcTypeClientStream
+	}
+	return grpcTypeServerStream
+}
+
+// 统计流式调用收发的消息数
+type monitoredStream struct {
+	grpc.ServerStream
+	received, sent metrics.Counter
+}
+
+func (s *monitoredStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.sent.Add(1)
+	}
+	return err
+}
+
+func (s *monitoredStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.received.Add(1)
+	}
+	return err
+}
@@ -0,0 +1,134 @@
+package gokit_foundation
+
+import (
+	"context"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+)
+
+// 返回name指标中标签完全匹配labels的样本，不存在时返回nil
+func findMetric(t *testing.T, reg *stdprometheus.Registry, name string, labels map[string]string) *dto.Metric {
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() != name {
+			continue
+		}
+	next:
+		for _, m := range mf.GetMetric() {
+			if len(m.GetLabel()) != len(labels) {
+				continue
+			}
+			for _, l := range m.GetLabel() {
+				if labels[l.GetName()] != l.GetValue() {
+					continue next
+				}
+			}
+			return m
+		}
+	}
+	return nil
+}
+
+func TestGRPCServerMetricsUnary(t *testing.T) {
+	reg := stdprometheus.NewRegistry()
+	m, err := NewGRPCServerMetrics(reg, "test", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: "/test/Method"}
+	interceptor := m.UnaryServerInterceptor()
+	for _, err := range []error{nil, nil, status.Error(codes.InvalidArgument, "bad")} {
+		_, _ = interceptor(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			// 处理中in_flight为1
+			if g := findMetric(t, reg, "test_grpc_server_in_flight", map[string]string{"method": "/test/Method", "type": "unary"}); g.GetGauge().GetValue() != 1 {
+				t.Errorf("in_flight got:%v want:1", g.GetGauge().GetValue())
+			}
+			return nil, err
+		})
+	}
+
+	test := []struct {
+		code string
+		want float64
+	}{
+		{code: "OK", want: 2},
+		{code: "InvalidArgument", want: 1},
+	}
+	for _, tt := range test {
+		labels := map[string]string{"method": "/test/Method", "type": "unary", "code": tt.code}
+		if c := findMetric(t, reg, "test_grpc_server_handled_total", labels); c.GetCounter().GetValue() != tt.want {
+			t.Errorf("code:%s handled got:%v want:%v", tt.code, c.GetCounter().GetValue(), tt.want)
+		}
+		if h := findMetric(t, reg, "test_grpc_server_handling_seconds", labels); h.GetHistogram().GetSampleCount() != uint64(tt.want) {
+			t.Errorf("code:%s handling got:%v want:%v", tt.code, h.GetHistogram().GetSampleCount(), tt.want)
+		}
+	}
+	if g := findMetric(t, reg, "test_grpc_server_in_flight", map[string]string{"method": "/test/Method", "type": "unary"}); g.GetGauge().GetValue() != 0 {
+		t.Errorf("in_flight got:%v want:0", g.GetGauge().GetValue())
+	}
+}
+
+type fakeServerStream struct {
+	grpc.ServerStream
+	recv int // 可以接收的消息数
+}
+
+func (s *fakeServerStream) SendMsg(m interface{}) error { return nil }
+
+func (s *fakeServerStream) RecvMsg(m interface{}) error {
+	if s.recv == 0 {
+		return status.Error(codes.Aborted, "eof")
+	}
+	s.recv--
+	return nil
+}
+
+func TestGRPCServerMetricsStream(t *testing.T) {
+	reg := stdprometheus.NewRegistry()
+	m, _ := NewGRPCServerMetrics(reg, "test", "")
+	info := &grpc.StreamServerInfo{FullMethod: "/test/Stream", IsClientStream: true, IsServerStream: true}
+	// 收到3条、返回2条消息后结束
+	err := m.StreamServerInterceptor()(nil, &fakeServerStream{recv: 3}, info, func(srv interface{}, ss grpc.ServerStream) error {
+		for i := 0; ; i++ {
+			if err := ss.RecvMsg(nil); err != nil {
+				return nil
+			}
+			if i < 2 {
+				_ = ss.SendMsg(nil)
+			}
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	labels := map[string]string{"method": "/test/Stream", "type": "bidi_stream"}
+	if c := findMetric(t, reg, "test_grpc_server_msg_received_total", labels); c.GetCounter().GetValue() != 3 {
+		t.Errorf("received got:%v want:3", c.GetCounter().GetValue())
+	}
+	if c := findMetric(t, reg, "test_grpc_server_msg_sent_total", labels); c.GetCounter().GetValue() != 2 {
+		t.Errorf("sent got:%v want:2", c.GetCounter().GetValue())
+	}
+	labels["code"] = "OK"
+	if c := findMetric(t, reg, "test_grpc_server_handled_total", labels); c.GetCounter().GetValue() != 1 {
+		t.Errorf("handled got:%v want:1", c.GetCounter().GetValue())
+	}
+}
+
+func TestGRPCServerMetricsRegisterFailed(t *testing.T) {
+	reg := stdprometheus.NewRegistry()
+	_, _ = NewGRPCServerMetrics(reg, "test", "")
+	// 重复注册失败时返回err，指标退化为discard，拦截器仍可正常调用
+	m, err := NewGRPCServerMetrics(reg, "test", "")
+	if err == nil {
+		t.Fatal("want err on duplicate registration")
+	}
+	_, _ = m.UnaryServerInterceptor()(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/test/Method"},
+		func(ctx context.Context, req interface{}) (interface{}, error) { return nil, nil })
+}
@@ -0,0 +1,183 @@
+package gokit_foundation
+
+import (
+	"errors"
+	kitgrpc "github.com/go-kit/kit/transport/grpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
+	"sort"
+	"time"
+)
+
+/*
+grpc server的构建器，与NewHTTPServer一样，example的grpc服务统一使用它创建：
+-	keepalive：定期回收连接(重新负载均衡)、检测死连接，并限制client的ping频率
+-	MaxRecvMsgSize/MaxSendMsgSize：单个消息的大小限制，超出时返回ResourceExhausted
+-	拦截器按Stage排序(相同Stage按添加顺序)，Stage小的在外层，与添加的先后无关：
+	recovery -> request id -> metrics -> logging -> tracing -> auth -> kitgrpc.Interceptor -> handler
+	kitgrpc.Interceptor总是在最内层(go-kit的grpc transport需要从ctx中读取方法名)
+*/
+
+type GRPCServerConfig struct {
+	Keepalive       keepalive.ServerParameters
+	KeepalivePolicy keepalive.EnforcementPolicy
+	MaxRecvMsgSize  int // 为0时使用grpc的默认值(4MB)
+	MaxSendMsgSize  int // 为0时使用grpc的默认值(不限制)
+}
+
+func DefaultGRPCServerConfig() GRPCServerConfig {
+	return GRPCServerConfig{
+		Keepalive: keepalive.ServerParameters{
+			// 连接存活超过这个时间后server会发送GOAWAY，使得LB后面的长连接client重新建立连接，从而重新负载均衡
+			MaxConnectionAge: 5 * time.Minute,
+			// 发送GOAWAY后，留给连接上正在处理的请求完成的时间，超时后强制关闭连接
+			MaxConnectionAgeGrace: 10 * time.Second,
+			// 连接上没有任何活动达到这个时间后，server发送ping检查连接是否存活
+			Time: 1 * time.Minute,
+			// ping的ack超时时间，超时后关闭连接
+			Timeout: 20 * time.Second,
+		},
+		KeepalivePolicy: keepalive.EnforcementPolicy{
+			// client发送ping的最小间隔，比这个频繁的client会被断开连接(防止恶意client)
+			MinTime: 10 * time.Second,
+			// 允许client在没有活跃stream时发送ping
+			PermitWithoutStream: true,
+		},
+		MaxRecvMsgSize: 4 << 20,
+		MaxSendMsgSize: 4 << 20,
+	}
+}
+
+func (c GRPCServerConfig) Validate() error {
+	if c.MaxRecvMsgSize < 0 || c.MaxSendMsgSize < 0 {
+		return errors.New("grpc server max_recv_msg_size and max_send_msg_size must not be negative")
+	}
+	k := c.Keepalive
+	if k.MaxConnectionAge < 0 || k.MaxConnectionAgeGrace < 0 || k.Time < 0 || k.Timeout < 0 || c.KeepalivePolicy.MinTime < 0 {
+		return errors.New("grpc server keepalive durations must not be negative")
+	}
+	return nil
+}
+
+// InterceptorStage 拦截器在链中的位置，小的在外层
+type InterceptorStage int
+
+const (
+	StageRecovery  InterceptorStage = iota // 捕获内层所有拦截器和handler的panic
+	StageRequestID                         // 在日志之前写入request id
+	StageMetrics
+	StageLogging
+	StageTracing
+	StageAuth // 认证失败的调用也会被记录日志和指标
+)
+
+type unaryEntry struct {
+	stage       InterceptorStage
+	interceptor grpc.UnaryServerInterceptor
+}
+
+type streamEntry struct {
+	stage       InterceptorStage
+	interceptor grpc.StreamServerInterceptor
+}
+
+type GRPCServerBuilder struct {
+	conf   GRPCServerConfig
+	creds  credentials.TransportCredentials
+	unary  []unaryEntry
+	stream []streamEntry
+	opts   []grpc.ServerOption
+}
+
+func NewGRPCServerBuilder(conf GRPCServerConfig) *GRPCServerBuilder {
+	return &GRPCServerBuilder{conf: conf}
+}
+
+// Creds 为nil时不启用TLS
+func (b *GRPCServerBuilder) Creds(creds credentials.TransportCredentials) *GRPCServerBuilder {
+	b.creds = creds
+	return b
+}
+
+// Unary 在stage添加一元调用的拦截器，nil被忽略
+func (b *GRPCServerBuilder) Unary(stage InterceptorStage, interceptors ...grpc.UnaryServerInterceptor) *GRPCServerBuilder {
+	for _, i := range interceptors {
+		if i != nil {
+			b.unary = append(b.unary, unaryEntry{stage, i})
+		}
+	}
+	return b
+}
+
+// Stream 在stage添加流式调用的拦截器，nil被忽略
+func (b *GRPCServerBuilder) Stream(stage InterceptorStage, interceptors ...grpc.StreamServerInterceptor) *GRPCServerBuilder {
+	for _, i := range interceptors {
+		if i != nil {
+			b.stream = append(b.stream, streamEntry{stage, i})
+		}
+	}
+	return b
+}
+
+// Options 其他的grpc.ServerOption，不要包含拦截器
+func (b *GRPCServerBuilder) Options(opts ...grpc.ServerOption) *GRPCServerBuilder {
+	b.opts = append(b.opts, opts...)
+	return b
+}
+
+// 按Stage排序后的一元调用拦截器，最后是kitgrpc.Interceptor
+func (b *GRPCServerBuilder) sortedUnary() []grpc.UnaryServerInterceptor {
+	entries := append([]unaryEntry(nil), b.unary...)
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].stage < entries[j].stage })
+	chain := make([]grpc.UnaryServerInterceptor, 0, len(entries)+1)
+	for _, e := range entries {
+		chain = append(chain, e.interceptor)
+	}
+	return append(chain, kitgrpc.Interceptor)
+}
+
+func (b *GRPCServerBuilder) sortedStream() []grpc.StreamServerInterceptor {
+	entries := append([]streamEntry(nil), b.stream...)
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].stage < entries[j].stage })
+	chain := make([]grpc.StreamServerInterceptor, 0, len(entries))
+	for _, e := range entries {
+		chain = append(chain, e.interceptor)
+	}
+	return chain
+}
+
+func (b *GRPCServerBuilder) Build() *grpc.Server {
+	opts := []grpc.ServerOption{
+		grpc.UnaryInterceptor(ChainUnaryInterceptors(b.sortedUnary()...)),
+		grpc.KeepaliveParams(b.conf.Keepalive),
+		grpc.KeepaliveEnforcementPolicy(b.conf.KeepalivePolicy),
+	}
+	if stream := b.sortedStream(); len(stream) > 0 {
+		opts = append(opts, grpc.StreamInterceptor(ChainStreamInterceptors(stream...)))
+	}
+	if b.conf.MaxRecvMsgSize > 0 {
+		opts = append(opts, grpc.MaxRecvMsgSize(b.conf.MaxRecvMsgSize))
+	}
+	if b.conf.MaxSendMsgSize > 0 {
+		opts = append(opts, grpc.MaxSendMsgSize(b.conf.MaxSendMsgSize))
+	}
+	if b.creds != nil {
+		opts = append(opts, grpc.Creds(b.creds))
+	}
+	return grpc.NewServer(append(opts, b.opts...)...)
+}
+
+// ChainStreamInterceptors 与ChainUnaryInterceptors相同，第一个在最外层
+func ChainStreamInterceptors(interceptors ...grpc.StreamServerInterceptor) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		next := handler
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			interceptor, h := interceptors[i], next
+			next = func(srv interface{}, ss grpc.ServerStream) error {
+				return interceptor(srv, ss, info, h)
+			}
+		}
+		return next(srv, ss)
+	}
+}
@@ -0,0 +1,145 @@
+package gokit_foundation
+
+import (
+	"context"
+	"errors"
+	"golang.org/x/net/http2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/status"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGRPCServerMaxConnectionAge(t *testing.T) {
+	srv := NewGRPCServerBuilder(GRPCServerConfig{Keepalive: keepalive.ServerParameters{
+		MaxConnectionAge:      time.Millisecond * 200,
+		MaxConnectionAgeGrace: time.Millisecond * 200,
+	}}).Build()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	// 直接使用http2连接，观察server发出的帧
+	conn, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	start := time.Now()
+	_, _ = conn.Write([]byte(http2.ClientPreface))
+	framer := http2.NewFramer(conn, conn)
+	_ = framer.WriteSettings()
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second * 3))
+
+	for {
+		f, err := framer.ReadFrame()
+		if err != nil {
+			t.Fatalf("no GOAWAY received before read err:%v", err)
+		}
+		switch f := f.(type) {
+		case *http2.SettingsFrame:
+			if !f.IsAck() {
+				_ = framer.WriteSettingsAck()
+			}
+		case *http2.PingFrame:
+			if !f.IsAck() {
+				_ = framer.WritePing(true, f.Data)
+			}
+		case *http2.GoAwayFrame:
+			// MaxConnectionAge有±10%的随机抖动
+			if elapsed := time.Since(start); elapsed < time.Millisecond*150 {
+				t.Errorf("GOAWAY too early: %v", elapsed)
+			}
+			return
+		}
+	}
+}
+
+// 拦截器按Stage排序，与添加顺序无关，kitgrpc.Interceptor在最内层
+func TestGRPCServerBuilderOrder(t *testing.T) {
+	var order []string
+	unary := func(name string) grpc.UnaryServerInterceptor {
+		return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			order = append(order, name)
+			return handler(ctx, req)
+		}
+	}
+	stream := func(name string) grpc.StreamServerInterceptor {
+		return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			order = append(order, name)
+			return handler(srv, ss)
+		}
+	}
+	b := NewGRPCServerBuilder(DefaultGRPCServerConfig()).
+		Unary(StageAuth, unary("auth")).
+		Unary(StageMetrics, unary("metrics1"), nil, unary("metrics2")).
+		Unary(StageRecovery, unary("recovery")).
+		Stream(StageLogging, stream("logging")).
+		Stream(StageRecovery, stream("recovery"))
+	if b.Build() == nil {
+		t.Fatal("nil server")
+	}
+
+	chain := ChainUnaryInterceptors(b.sortedUnary()...)
+	_, _ = chain(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/test/Method"}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		order = append(order, "handler")
+		return nil, nil
+	})
+	if want := []string{"recovery", "metrics1", "metrics2", "auth", "handler"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("got unary order:%v want:%v", order, want)
+	}
+	order = nil
+	err := ChainStreamInterceptors(b.sortedStream()...)(nil, nil, &grpc.StreamServerInfo{}, func(srv interface{}, ss grpc.ServerStream) error {
+		order = append(order, "handler")
+		return errors.New("x")
+	})
+	if want := []string{"recovery", "logging", "handler"}; err == nil || !reflect.DeepEqual(order, want) {
+		t.Errorf("got stream order:%v err:%v want:%v", order, err, want)
+	}
+}
+
+func TestGRPCServerConfigValidate(t *testing.T) {
+	conf := DefaultGRPCServerConfig()
+	if err := conf.Validate(); err != nil {
+		t.Error(err)
+	}
+	conf.Keepalive.Time = -1
+	if err := conf.Validate(); err == nil {
+		t.Error("want err")
+	}
+}
+
+// 超出MaxRecvMsgSize的请求返回ResourceExhausted
+func TestGRPCServerMaxRecvMsgSize(t *testing.T) {
+	srv := NewGRPCServerBuilder(GRPCServerConfig{MaxRecvMsgSize: 8}).Build()
+	RegisterGRPCHealthSrv(srv)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	cli := healthpb.NewHealthClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	if _, err = cli.Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatalf("small request got err:%v", err)
+	}
+	if _, err = cli.Check(ctx, &healthpb.HealthCheckRequest{Service: "a-very-long-service-name"}); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("got err:%v want ResourceExhausted", err)
+	}
+}
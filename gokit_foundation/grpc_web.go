@@ -0,0 +1,59 @@
+package gokit_foundation
+
+import (
+	"github.com/improbable-eng/grpc-web/go/grpcweb"
+	"google.golang.org/grpc"
+	"net/http"
+	"strings"
+)
+
+/*
+gRPC-Web(见github.com/improbable-eng/grpc-web)：浏览器无法直接发送HTTP/2的grpc请求(读不到trailer)，
+grpc-web把消息帧和trailer都放在HTTP/1.1的body中，GRPCWebHandler转换后交给同一个*grpc.Server处理，
+拦截器(日志、指标、认证等)与grpc完全相同，但不经过grpc server的TLS(由监听grpc-web的http server或前面的代理负责)：
+-	一元调用和服务端流可以通过fetch/XHR调用，客户端流和双向流需要websocket(WebSockets)
+-	CORS：AllowedOrigins为允许跨域调用的Origin(如http://localhost:3000)，"*"表示全部，为空时只允许同源的页面调用
+-	不是grpc-web的请求交给fallback(如健康检查)，为nil时返回404
+*/
+
+type GRPCWebConfig struct {
+	AllowedOrigins []string
+	WebSockets     bool
+}
+
+func (c GRPCWebConfig) allowOrigin(origin string) bool {
+	for _, o := range c.AllowedOrigins {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewGRPCWebHandler srv上的服务可以在之后注册，每次请求时才读取
+func NewGRPCWebHandler(srv *grpc.Server, conf GRPCWebConfig, fallback http.Handler) http.Handler {
+	if fallback == nil {
+		fallback = http.NotFoundHandler()
+	}
+	wrapped := grpcweb.WrapServer(srv,
+		grpcweb.WithOriginFunc(conf.allowOrigin),
+		grpcweb.WithWebsockets(conf.WebSockets),
+		// 浏览器的websocket请求总是带有Origin，同源时也需要检查
+		grpcweb.WithWebsocketOriginFunc(func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			return origin == "" || conf.allowOrigin(origin) || sameOrigin(r, origin)
+		}),
+	)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if wrapped.IsGrpcWebRequest(r) || wrapped.IsAcceptableGrpcCorsRequest(r) || wrapped.IsGrpcWebSocketRequest(r) {
+			wrapped.ServeHTTP(w, r)
+			return
+		}
+		fallback.ServeHTTP(w, r)
+	})
+}
+
+func sameOrigin(r *http.Request, origin string) bool {
+	i := strings.Index(origin, "://")
+	return i >= 0 && strings.EqualFold(origin[i+3:], r.Host)
+}
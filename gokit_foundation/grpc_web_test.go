@@ -0,0 +1,71 @@
+package gokit_foundation
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/golang/protobuf/proto"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// grpc-web的消息帧：1字节flag(0x80为trailer) + 4字节长度 + 内容
+func grpcWebFrame(flag byte, b []byte) []byte {
+	frame := make([]byte, 5, 5+len(b))
+	frame[0] = flag
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(b)))
+	return append(frame, b...)
+}
+
+func TestGRPCWebHandler(t *testing.T) {
+	srv := NewGRPCServerBuilder(GRPCServerConfig{}).Build()
+	h := NewGRPCWebHandler(srv, GRPCWebConfig{AllowedOrigins: []string{"http://localhost:3000"}}, nil)
+	// 服务在创建handler之后注册
+	RegisterGRPCHealthSrv(srv).SetServing(true)
+
+	req, _ := proto.Marshal(&healthpb.HealthCheckRequest{})
+	r := httptest.NewRequest(http.MethodPost, "/grpc.health.v1.Health/Check", bytes.NewReader(grpcWebFrame(0, req)))
+	r.Header.Set("Content-Type", "application/grpc-web+proto")
+	r.Header.Set("Origin", "http://localhost:3000")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	body, _ := ioutil.ReadAll(rec.Body)
+	if rec.Code != 200 || len(body) < 5 || body[0] != 0 {
+		t.Fatalf("got code:%d body:%q", rec.Code, body)
+	}
+	n := binary.BigEndian.Uint32(body[1:5])
+	rsp := new(healthpb.HealthCheckResponse)
+	if err := proto.Unmarshal(body[5:5+n], rsp); err != nil || rsp.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("got rsp:%v err:%v", rsp, err)
+	}
+	// 之后是trailer帧，带有grpc-status
+	if trailer := body[5+n:]; len(trailer) < 5 || trailer[0] != 0x80 || !strings.Contains(string(trailer[5:]), "grpc-status: 0") {
+		t.Errorf("got trailer:%q", trailer)
+	}
+	if o := rec.Header().Get("Access-Control-Allow-Origin"); o != "http://localhost:3000" {
+		t.Errorf("got allow origin:%q", o)
+	}
+
+	// 预检请求：只允许配置的Origin
+	for origin, allowed := range map[string]bool{"http://localhost:3000": true, "http://evil.com": false} {
+		r = httptest.NewRequest(http.MethodOptions, "/grpc.health.v1.Health/Check", nil)
+		r.Header.Set("Origin", origin)
+		r.Header.Set("Access-Control-Request-Method", "POST")
+		r.Header.Set("Access-Control-Request-Headers", "content-type,x-grpc-web")
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		if got := rec.Header().Get("Access-Control-Allow-Origin") == origin; got != allowed {
+			t.Errorf("origin:%s got headers:%v", origin, rec.Header())
+		}
+	}
+
+	// 不是grpc-web的请求交给fallback
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("got code:%d", rec.Code)
+	}
+}
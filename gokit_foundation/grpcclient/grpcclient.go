@@ -0,0 +1,201 @@
+package grpcclient
+
+import (
+	"context"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+	kitot "github.com/go-kit/kit/tracing/opentracing"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	otlog "github.com/opentracing/opentracing-go/log"
+	"gokit_foundation"
+	"gokit_foundation/auth"
+	"gokit_foundation/errs"
+	"gokit_foundation/otel"
+	"gokit_foundation/propagation"
+	"gokit_foundation/reqid"
+	"gokit_foundation/sdclient"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"time"
+)
+
+/*
+不经过go-kit endpoint、直接使用生成的grpc client(如addsvcpb.NewAddClient)时的client侧拦截器，
+与server侧的中间件对应，调用方不需要自己组合也能得到一致的可观测性和上下文传递，一元调用从外到内依次为：
+	request id(见reqid，ctx中没有时生成，所有重试使用同一个) -> 指标(见gokit_foundation.GRPCClientMetrics，包括所有重试) ->
+	链路(otel和opentracing的client span，包括所有重试) -> 重试(与sdclient的重试规则相同) ->
+	token(ctx中没有token时调用Config.Token) -> 跨服务传递的上下文(见propagation.Fields) -> 发出请求
+流式调用不重试，也不创建span(span的结束时间取决于调用方何时读完)，其他与一元调用相同
+负载均衡、连接管理交给grpc自身(如dns resolver加round_robin)，需要服务发现时使用sdclient
+*/
+
+// Retry 一元调用的重试，MaxAttempts不大于1时不重试
+type Retry struct {
+	MaxAttempts int           // 最多调用次数，包括第一次
+	Timeout     time.Duration // 包括所有重试的总时间，调用方ctx的deadline更早时以它为准，为0时不限制
+	BackoffBase time.Duration // 见sdclient.WithRetryBackoff
+	BackoffMax  time.Duration
+	Retryable   func(error) bool // 为nil时使用sdclient.DefaultRetryable
+	Counter     metrics.Counter  // 标签为event(见sdclient.RetryEventXxx)，为nil时不上报
+}
+
+type Config struct {
+	Metrics *gokit_foundation.GRPCClientMetrics // 为nil时不上报
+	Tracer  stdopentracing.Tracer               // 为nil时不创建opentracing span，otel span总是创建(未启用时为noop)
+	Retry   Retry
+	// 服务自身的token(如从配置读取或者签发的JWT)，ctx中已有token(如server收到的token继续传给下游)
+	// 或调用方已在outgoing metadata中设置了authorization时不调用
+	// 为nil时只发送ctx中的token，返回err时不发出请求
+	Token  func(ctx context.Context) (string, error)
+	Logger log.Logger // opentracing inject失败时的日志，为nil时不打印
+}
+
+func (c Config) logger() log.Logger {
+	if c.Logger == nil {
+		return log.NewNopLogger()
+	}
+	return c.Logger
+}
+
+// UnaryInterceptors 按上面的顺序返回，用于grpc.WithChainUnaryInterceptor
+func UnaryInterceptors(c Config) []grpc.UnaryClientInterceptor {
+	is := []grpc.UnaryClientInterceptor{reqid.UnaryClientInterceptor()}
+	if c.Metrics != nil {
+		is = append(is, c.Metrics.UnaryClientInterceptor())
+	}
+	is = append(is, otel.UnaryClientInterceptor(otel.Tracer()))
+	if c.Tracer != nil {
+		is = append(is, opentracingInterceptor(c.Tracer, c.logger()))
+	}
+	if c.Retry.MaxAttempts > 1 {
+		is = append(is, retryInterceptor(c.Retry))
+	}
+	if c.Token != nil {
+		is = append(is, tokenInterceptor(c.Token))
+	}
+	return append(is, propagation.UnaryClientInterceptor())
+}
+
+// StreamInterceptors 用于grpc.WithChainStreamInterceptor
+func StreamInterceptors(c Config) []grpc.StreamClientInterceptor {
+	is := []grpc.StreamClientInterceptor{reqid.StreamClientInterceptor()}
+	if c.Metrics != nil {
+		is = append(is, c.Metrics.StreamClientInterceptor())
+	}
+	if c.Token != nil {
+		token := c.Token
+		is = append(is, func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			ctx, err := withToken(ctx, token)
+			if err != nil {
+				return nil, err
+			}
+			return streamer(ctx, desc, cc, method, opts...)
+		})
+	}
+	return append(is, propagation.StreamClientInterceptor())
+}
+
+// DialOptions 安装UnaryInterceptors和StreamInterceptors，与调用方的其他拨号选项(如TLS)一起传给grpc.Dial
+func DialOptions(c Config) []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(UnaryInterceptors(c)...),
+		grpc.WithChainStreamInterceptor(StreamInterceptors(c)...),
+	}
+}
+
+// span写入outgoing metadata，重试时不变
+func opentracingInterceptor(tracer stdopentracing.Tracer, logger log.Logger) grpc.UnaryClientInterceptor {
+	inject := kitot.ContextToGRPC(tracer, logger)
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		span, ctx := stdopentracing.StartSpanFromContextWithTracer(ctx, tracer, method, ext.SpanKindRPCClient)
+		defer span.Finish()
+		md, _ := metadata.FromOutgoingContext(ctx)
+		md = md.Copy()
+		ctx = inject(ctx, &md)
+		err := invoker(metadata.NewOutgoingContext(ctx, md), method, req, reply, cc, opts...)
+		if err != nil {
+			ext.Error.Set(span, true)
+			span.LogFields(otlog.Error(err))
+		}
+		return err
+	}
+}
+
+func withToken(ctx context.Context, token func(ctx context.Context) (string, error)) (context.Context, error) {
+	if _, ok := auth.TokenFromContext(ctx); ok {
+		return ctx, nil
+	}
+	if md, _ := metadata.FromOutgoingContext(ctx); len(md.Get("authorization")) > 0 {
+		return ctx, nil
+	}
+	tok, err := token(ctx)
+	if err != nil {
+		return ctx, errs.Unauthenticated("grpcclient: get token").Wrap(err)
+	}
+	return auth.WithToken(ctx, tok), nil
+}
+
+// 每次重试都调用，token过期后重试可以拿到新的
+func tokenInterceptor(token func(ctx context.Context) (string, error)) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, err := withToken(ctx, token)
+		if err != nil {
+			return err
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// 规则与sdclient的重试相同(见sdclient/retry.go)，只是每次都调用同一个连接
+func retryInterceptor(r Retry) grpc.UnaryClientInterceptor {
+	retryable := r.Retryable
+	if retryable == nil {
+		retryable = sdclient.DefaultRetryable
+	}
+	count := func(event string) {
+		if r.Counter != nil {
+			r.Counter.With("event", event).Add(1)
+		}
+	}
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if r.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+			defer cancel()
+		}
+		for attempt := 1; ; attempt++ {
+			err := invoker(ctx, method, req, reply, cc, opts...)
+			if err == nil || !retryable(err) {
+				return err
+			}
+			if ctx.Err() != nil {
+				count(sdclient.RetryEventBudgetExhausted)
+				return err
+			}
+			if attempt >= r.MaxAttempts {
+				count(sdclient.RetryEventAttemptsExhausted)
+				return err
+			}
+			wait := sdclient.Backoff(r.BackoffBase, r.BackoffMax, attempt)
+			if d := errs.RetryAfterOf(err); d > wait {
+				wait = d
+			}
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= wait {
+				count(sdclient.RetryEventBudgetExhausted)
+				return err
+			}
+			if wait > 0 {
+				t := time.NewTimer(wait)
+				select {
+				case <-ctx.Done():
+					t.Stop()
+					count(sdclient.RetryEventBudgetExhausted)
+					return err
+				case <-t.C:
+				}
+			}
+			count(sdclient.RetryEventRetry)
+		}
+	}
+}
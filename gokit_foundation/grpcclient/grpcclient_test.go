@@ -0,0 +1,195 @@
+package grpcclient
+
+import (
+	"context"
+	"errors"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+	"gokit_foundation"
+	"gokit_foundation/errs"
+	"gokit_foundation/memtransport"
+	"gokit_foundation/reqid"
+	"gokit_foundation/sdclient"
+	"gokit_foundation/tenant"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// server记录每次调用收到的metadata，前fail次调用返回Unavailable
+type recorder struct {
+	mu   sync.Mutex
+	fail int
+	mds  []metadata.MD
+}
+
+func (r *recorder) unary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	r.mu.Lock()
+	r.mds = append(r.mds, md)
+	fail := len(r.mds) <= r.fail
+	r.mu.Unlock()
+	if fail {
+		return nil, status.Error(codes.Unavailable, "try again")
+	}
+	return handler(ctx, req)
+}
+
+func (r *recorder) stream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	md, _ := metadata.FromIncomingContext(ss.Context())
+	r.mu.Lock()
+	r.mds = append(r.mds, md)
+	r.mu.Unlock()
+	return handler(srv, ss)
+}
+
+func (r *recorder) received() []metadata.MD {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.mds
+}
+
+func dial(t *testing.T, rec *recorder, c Config) (*grpc.ClientConn, func()) {
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer(grpc.UnaryInterceptor(rec.unary), grpc.StreamInterceptor(rec.stream))
+	hs := health.NewServer()
+	healthpb.RegisterHealthServer(srv, hs)
+	go srv.Serve(lis)
+	opts := append(DialOptions(c), grpc.WithInsecure(), grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+		return lis.Dial()
+	}))
+	cc, err := grpc.Dial("bufconn", opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cc, func() {
+		cc.Close()
+		srv.Stop()
+	}
+}
+
+func TestUnary(t *testing.T) {
+	reg := stdprometheus.NewRegistry()
+	m, _ := gokit_foundation.NewGRPCClientMetrics(reg, "test", "")
+	tracer := mocktracer.New()
+	retries := memtransport.NewCounter()
+	var tokens int
+	rec := &recorder{fail: 2}
+	cc, stop := dial(t, rec, Config{
+		Metrics: m,
+		Tracer:  tracer,
+		Retry:   Retry{MaxAttempts: 3, Timeout: time.Second, BackoffBase: time.Millisecond, Counter: retries},
+		Token:   func(context.Context) (string, error) { tokens++; return "svc-token", nil },
+	})
+	defer stop()
+
+	ctx := tenant.WithTenant(context.Background(), "t1")
+	if _, err := healthpb.NewHealthClient(cc).Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	mds := rec.received()
+	if len(mds) != 3 || tokens != 3 || len(retries.Values("event", sdclient.RetryEventRetry)) != 2 {
+		t.Fatalf("got %d calls, %d tokens, %d retries", len(mds), tokens, len(retries.Values("event", sdclient.RetryEventRetry)))
+	}
+	id := mds[0].Get("x-request-id")
+	for i, md := range mds {
+		// 所有重试使用同一个request id
+		if got := md.Get("x-request-id"); len(id) != 1 || len(got) != 1 || got[0] != id[0] {
+			t.Errorf("call %d request id got:%v want:%v", i, got, id)
+		}
+		for k, want := range map[string]string{"authorization": "Bearer svc-token", "x-tenant-id": "t1"} {
+			if got := md.Get(k); len(got) != 1 || got[0] != want {
+				t.Errorf("call %d metadata %s got:%v want:%s", i, k, got, want)
+			}
+		}
+		if len(md.Get("mockpfx-ids-traceid")) != 1 {
+			t.Errorf("call %d no opentracing span in metadata:%v", i, md)
+		}
+	}
+	if spans := tracer.FinishedSpans(); len(spans) != 1 || spans[0].OperationName != "/grpc.health.v1.Health/Check" {
+		t.Errorf("got spans:%v", spans)
+	}
+	// 指标包括所有重试，只记录一次
+	mfs, _ := reg.Gather()
+	var handled float64
+	for _, mf := range mfs {
+		if mf.GetName() == "test_grpc_client_handled_total" {
+			for _, m := range mf.GetMetric() {
+				handled += m.GetCounter().GetValue()
+			}
+		}
+	}
+	if handled != 1 {
+		t.Errorf("handled got:%v want:1", handled)
+	}
+}
+
+func TestKeepExisting(t *testing.T) {
+	rec := &recorder{}
+	cc, stop := dial(t, rec, Config{Token: func(context.Context) (string, error) { return "svc-token", nil }})
+	defer stop()
+	// 调用方已有的request id、token和metadata不被覆盖
+	ctx := reqid.WithRequestID(context.Background(), "rid1")
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer user-token", "x-other", "1")
+	if _, err := healthpb.NewHealthClient(cc).Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	md := rec.received()[0]
+	for k, want := range map[string]string{"x-request-id": "rid1", "authorization": "Bearer user-token", "x-other": "1"} {
+		if got := md.Get(k); len(got) != 1 || got[0] != want {
+			t.Errorf("metadata %s got:%v want:%s", k, got, want)
+		}
+	}
+}
+
+func TestNoRetry(t *testing.T) {
+	rec := &recorder{fail: 5}
+	cc, stop := dial(t, rec, Config{Retry: Retry{MaxAttempts: 3, Retryable: func(error) bool { return false }}})
+	defer stop()
+	_, err := healthpb.NewHealthClient(cc).Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if status.Code(err) != codes.Unavailable || len(rec.received()) != 1 {
+		t.Errorf("got err:%v calls:%d", err, len(rec.received()))
+	}
+}
+
+func TestTokenError(t *testing.T) {
+	rec := &recorder{}
+	errNoToken := errors.New("no token")
+	cc, stop := dial(t, rec, Config{
+		Retry: Retry{MaxAttempts: 3},
+		Token: func(context.Context) (string, error) { return "", errNoToken },
+	})
+	defer stop()
+	// token失败时不发出请求，也不重试
+	_, err := healthpb.NewHealthClient(cc).Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if !errors.Is(err, errNoToken) || errs.KindOf(err) != errs.KindUnauthenticated || len(rec.received()) != 0 {
+		t.Errorf("got err:%v calls:%d", err, len(rec.received()))
+	}
+}
+
+func TestStream(t *testing.T) {
+	rec := &recorder{}
+	cc, stop := dial(t, rec, Config{Token: func(context.Context) (string, error) { return "svc-token", nil }})
+	defer stop()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ws, err := healthpb.NewHealthClient(cc).Watch(tenant.WithTenant(ctx, "t1"), &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ws.Recv(); err != nil {
+		t.Fatal(err)
+	}
+	md := rec.received()[0]
+	if len(md.Get("x-request-id")) != 1 || len(md.Get("authorization")) != 1 || len(md.Get("x-tenant-id")) != 1 {
+		t.Errorf("got md:%v", md)
+	}
+}
@@ -0,0 +1,126 @@
+package gokit_foundation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	stdconsul "github.com/hashicorp/consul/api"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"net"
+	"net/http"
+)
+
+/*
+依赖检查以及http健康检查接口：
+-	/healthz：存活检查，只看依赖是否可用，服务提前下线(lame duck)时仍返回200，避免k8s在退出过程中重启容器
+-	/readyz：就绪检查，与grpc的Check相同，提前下线或任一依赖不可用时返回503
+两者的响应都是 {"status": "SERVING", "checks": {"redis": "ok"}}
+*/
+
+// HealthChecker 检查一个依赖是否可用，不可用时返回err，ctx带有超时(见HealthCheckTimeout)
+type HealthChecker func(ctx context.Context) error
+
+// Pinger 如*sql.DB、*sqlx.DB
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// PingChecker 用于数据库等提供PingContext的依赖
+func PingChecker(p Pinger) HealthChecker {
+	return p.PingContext
+}
+
+// ConsulChecker 检查consul agent是否可以访问并且集群有leader，addr为空时与注册使用相同的地址(见ConsulAddr)
+func ConsulChecker(addr string) HealthChecker {
+	if addr == "" {
+		addr = consulAddr()
+	}
+	return func(ctx context.Context) error {
+		client, err := stdconsul.NewClient(&stdconsul.Config{
+			Address:    addr,
+			HttpClient: &http.Client{Timeout: HealthCheckTimeout},
+		})
+		if err != nil {
+			return err
+		}
+		leader, err := client.Status().Leader()
+		if err != nil {
+			return err
+		}
+		if leader == "" {
+			return errors.New("consul has no leader")
+		}
+		return nil
+	}
+}
+
+// GRPCDialChecker 检查下游grpc服务是否可以建立连接，opts为空时使用非TLS连接
+func GRPCDialChecker(target string, opts ...grpc.DialOption) HealthChecker {
+	if len(opts) == 0 {
+		opts = []grpc.DialOption{grpc.WithInsecure()}
+	}
+	return func(ctx context.Context) error {
+		conn, err := grpc.DialContext(ctx, target, append(opts, grpc.WithBlock())...)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
+
+// TCPDialChecker 检查addrs(host:port)中至少有一个可以建立TCP连接，用于没有client的依赖(如kafka brokers、etcd)
+func TCPDialChecker(addrs ...string) HealthChecker {
+	return func(ctx context.Context) error {
+		var err error
+		for _, addr := range addrs {
+			var conn net.Conn
+			if conn, err = new(net.Dialer).DialContext(ctx, "tcp", addr); err == nil {
+				return conn.Close()
+			}
+		}
+		if err == nil {
+			return errors.New("no address")
+		}
+		return err
+	}
+}
+
+type healthBody struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+func writeHealth(w http.ResponseWriter, status grpc_health_v1.HealthCheckResponse_ServingStatus, results map[string]error) {
+	body := healthBody{Status: status.String()}
+	if len(results) > 0 {
+		body.Checks = make(map[string]string, len(results))
+		for name, err := range results {
+			body.Checks[name] = "ok"
+			if err != nil {
+				body.Checks[name] = err.Error()
+			}
+		}
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if status != grpc_health_v1.HealthCheckResponse_SERVING {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// HealthzHandler 存活检查，不受SetServing影响
+func (s *HealthCheckServer) HealthzHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		results := s.RunCheckers(r.Context())
+		writeHealth(w, aggregateStatus(results), results)
+	})
+}
+
+// ReadyzHandler 就绪检查，结果与grpc的Check一致
+func (s *HealthCheckServer) ReadyzHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status, results := s.Ready(r.Context())
+		writeHealth(w, status, results)
+	})
+}
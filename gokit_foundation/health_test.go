@@ -0,0 +1,185 @@
+package gokit_foundation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHealthCheckServerCheckers(t *testing.T) {
+	s := &HealthCheckServer{}
+	var redisErr error
+	s.AddChecker("db", func(context.Context) error { return nil })
+	s.AddChecker("redis", func(context.Context) error { return redisErr })
+
+	check := func() grpc_health_v1.HealthCheckResponse_ServingStatus {
+		rsp, _ := s.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+		return rsp.Status
+	}
+	if got := check(); got != grpc_health_v1.HealthCheckResponse_SERVING {
+		t.Errorf("got %s want SERVING", got)
+	}
+	redisErr = errors.New("connection refused")
+	if got := check(); got != grpc_health_v1.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("got %s want NOT_SERVING when a checker fails", got)
+	}
+	redisErr = nil
+	s.SetServing(false)
+	if got := check(); got != grpc_health_v1.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("got %s want NOT_SERVING after SetServing(false)", got)
+	}
+	// 预热结束不会恢复已经下线的服务
+	s.SetWarmingUp(true)
+	s.SetServing(true)
+	if got := check(); got != grpc_health_v1.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("got %s want NOT_SERVING when warming up", got)
+	}
+	s.SetServing(false)
+	s.SetWarmingUp(false)
+	if got := check(); got != grpc_health_v1.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("got %s want NOT_SERVING after warmed up but SetServing(false)", got)
+	}
+}
+
+func TestHealthCheckerTimeout(t *testing.T) {
+	old := HealthCheckTimeout
+	HealthCheckTimeout = time.Millisecond * 50
+	defer func() { HealthCheckTimeout = old }()
+
+	s := &HealthCheckServer{}
+	s.AddChecker("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	start := time.Now()
+	results := s.RunCheckers(context.Background())
+	if results["slow"] != context.DeadlineExceeded || time.Since(start) > time.Second {
+		t.Errorf("got %v after %s", results["slow"], time.Since(start))
+	}
+}
+
+func TestHealthHTTPHandlers(t *testing.T) {
+	s := &HealthCheckServer{}
+	var dbErr error
+	s.AddChecker("db", func(context.Context) error { return dbErr })
+
+	get := func(h http.Handler) (int, healthBody) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+		var body healthBody
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		return rec.Code, body
+	}
+
+	test := []struct {
+		name        string
+		dbErr       error
+		serving     bool
+		wantHealthz int
+		wantReadyz  int
+	}{
+		{name: "[ok]", serving: true, wantHealthz: 200, wantReadyz: 200},
+		{name: "[db down]", dbErr: errors.New("db down"), serving: true, wantHealthz: 503, wantReadyz: 503},
+		// 提前下线时仍然存活
+		{name: "[lame duck]", serving: false, wantHealthz: 200, wantReadyz: 503},
+	}
+	for _, tt := range test {
+		dbErr = tt.dbErr
+		s.SetServing(tt.serving)
+		code, body := get(s.HealthzHandler())
+		if code != tt.wantHealthz {
+			t.Errorf("%s healthz got %d want %d", tt.name, code, tt.wantHealthz)
+		}
+		want := "ok"
+		if tt.dbErr != nil {
+			want = tt.dbErr.Error()
+		}
+		if body.Checks["db"] != want {
+			t.Errorf("%s got checks %v", tt.name, body.Checks)
+		}
+		if code, _ = get(s.ReadyzHandler()); code != tt.wantReadyz {
+			t.Errorf("%s readyz got %d want %d", tt.name, code, tt.wantReadyz)
+		}
+	}
+}
+
+func TestConsulChecker(t *testing.T) {
+	leader := `"10.0.0.1:8300"`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/status/leader" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(leader))
+	}))
+	defer srv.Close()
+
+	checker := ConsulChecker(strings.TrimPrefix(srv.URL, "http://"))
+	if err := checker(context.Background()); err != nil {
+		t.Errorf("got %v", err)
+	}
+	leader = `""`
+	if err := checker(context.Background()); err == nil {
+		t.Error("want err when consul has no leader")
+	}
+}
+
+func TestGRPCDialChecker(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer()
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := GRPCDialChecker(lis.Addr().String())(ctx); err != nil {
+		t.Errorf("got %v", err)
+	}
+
+	// 没有服务监听的端口
+	closed, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := closed.Addr().String()
+	closed.Close()
+	ctx2, cancel2 := context.WithTimeout(context.Background(), time.Millisecond*200)
+	defer cancel2()
+	if err := GRPCDialChecker(addr)(ctx2); err == nil {
+		t.Error("want err when dial a closed port")
+	}
+}
+
+func TestTCPDialChecker(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	closed, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := closed.Addr().String()
+	closed.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	// 任一地址可以连接即可
+	if err := TCPDialChecker(addr, lis.Addr().String())(ctx); err != nil {
+		t.Errorf("got %v", err)
+	}
+	if err := TCPDialChecker(addr)(ctx); err == nil {
+		t.Error("want err when dial a closed port")
+	}
+	if err := TCPDialChecker()(ctx); err == nil {
+		t.Error("want err without address")
+	}
+}
@@ -0,0 +1,95 @@
+package gokit_foundation
+
+import (
+	"errors"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"golang.org/x/net/netutil"
+	"net"
+	"net/http"
+	"time"
+)
+
+/*
+&http.Server{}的所有超时默认都是0(不限制)，慢速client(如Slowloris)可以一直占用连接和goroutine，
+所以example的http服务统一使用NewHTTPServer创建：
+-	ReadHeaderTimeout/ReadTimeout 读取请求头/整个请求的超时
+-	WriteTimeout 从读完请求头到写完响应的超时，handler的执行时间也计入其中，需大于最慢接口的耗时
+-	IdleTimeout keep-alive连接的空闲超时
+-	MaxConns 同时处理的最大连接数，超出后新连接在accept队列中等待，为0时不限制
+-	H2C 不使用TLS的HTTP/2(h2c)，供内网的grpc-gateway、envoy等使用，HTTP/1.1的请求不受影响
+*/
+
+type HTTPServerConfig struct {
+	ReadHeaderTimeout time.Duration `json:"read_header_timeout" yaml:"read_header_timeout"`
+	ReadTimeout       time.Duration `json:"read_timeout" yaml:"read_timeout"`
+	WriteTimeout      time.Duration `json:"write_timeout" yaml:"write_timeout"`
+	IdleTimeout       time.Duration `json:"idle_timeout" yaml:"idle_timeout"`
+	MaxHeaderBytes    int           `json:"max_header_bytes" yaml:"max_header_bytes"`
+	MaxConns          int           `json:"max_conns" yaml:"max_conns"`
+	H2C               bool          `json:"h2c" yaml:"h2c"`
+}
+
+func DefaultHTTPServerConfig() HTTPServerConfig {
+	return HTTPServerConfig{
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       120 * time.Second,
+		MaxHeaderBytes:    1 << 20,
+	}
+}
+
+func (c HTTPServerConfig) Validate() error {
+	if c.ReadHeaderTimeout < 0 || c.ReadTimeout < 0 || c.WriteTimeout < 0 || c.IdleTimeout < 0 {
+		return errors.New("http server timeouts must not be negative")
+	}
+	if c.MaxHeaderBytes < 0 || c.MaxConns < 0 {
+		return errors.New("http server max_header_bytes and max_conns must not be negative")
+	}
+	return nil
+}
+
+// HTTPServer 内嵌*http.Server，Shutdown、Close等方法不变，Serve时按MaxConns限制连接数
+type HTTPServer struct {
+	*http.Server
+	maxConns int
+}
+
+// NewHTTPServer handler在创建时确定(H2C需要封装handler)，conf中为0的超时表示不限制
+func NewHTTPServer(handler http.Handler, conf HTTPServerConfig) *HTTPServer {
+	if conf.H2C {
+		handler = h2c.NewHandler(handler, &http2.Server{IdleTimeout: conf.IdleTimeout})
+	}
+	return &HTTPServer{
+		Server: &http.Server{
+			Handler:           handler,
+			ReadHeaderTimeout: conf.ReadHeaderTimeout,
+			ReadTimeout:       conf.ReadTimeout,
+			WriteTimeout:      conf.WriteTimeout,
+			IdleTimeout:       conf.IdleTimeout,
+			MaxHeaderBytes:    conf.MaxHeaderBytes,
+		},
+		maxConns: conf.MaxConns,
+	}
+}
+
+func (s *HTTPServer) Serve(lis net.Listener) error {
+	if s.maxConns > 0 {
+		lis = netutil.LimitListener(lis, s.maxConns)
+	}
+	return s.Server.Serve(lis)
+}
+
+// ListenAndServe 监听Addr，与http.Server.ListenAndServe相同，但经过Serve的连接数限制
+func (s *HTTPServer) ListenAndServe() error {
+	addr := s.Addr
+	if addr == "" {
+		addr = ":http"
+	}
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(lis)
+}
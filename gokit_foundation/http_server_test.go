@@ -0,0 +1,115 @@
+package gokit_foundation
+
+import (
+	"bufio"
+	"crypto/tls"
+	"golang.org/x/net/http2"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func serveTest(t *testing.T, srv *HTTPServer) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(lis)
+	return lis.Addr().String()
+}
+
+func TestHTTPServerMaxConns(t *testing.T) {
+	conf := DefaultHTTPServerConfig()
+	conf.MaxConns = 1
+	srv := NewHTTPServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), conf)
+	defer srv.Close()
+	addr := serveTest(t, srv)
+
+	// 第一个连接保持打开，第二个连接的请求在第一个关闭后才被处理
+	c1, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c1.Write([]byte("GET / HTTP/1.1\r\nHost: x\r\n\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	if rsp, err := http.ReadResponse(bufio.NewReader(c1), nil); err != nil || rsp.StatusCode != 200 {
+		t.Fatalf("got rsp:%v err:%v", rsp, err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		cli := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+		rsp, err := cli.Get("http://" + addr)
+		if err == nil {
+			rsp.Body.Close()
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("second conn served while the first is open, err:%v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	c1.Close()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("second conn not served after the first closed")
+	}
+}
+
+func TestHTTPServerH2C(t *testing.T) {
+	conf := DefaultHTTPServerConfig()
+	conf.H2C = true
+	srv := NewHTTPServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}), conf)
+	defer srv.Close()
+	addr := serveTest(t, srv)
+
+	// 不使用TLS直接以HTTP/2连接(prior knowledge)
+	cli := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+			return net.Dial(network, addr)
+		},
+	}}
+	rsp, err := cli.Get("http://" + addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsp.Body.Close()
+	if rsp.ProtoMajor != 2 {
+		t.Errorf("got proto:%s", rsp.Proto)
+	}
+	// HTTP/1.1不受影响
+	rsp, err = http.Get("http://" + addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsp.Body.Close()
+	if rsp.ProtoMajor != 1 {
+		t.Errorf("got proto:%s", rsp.Proto)
+	}
+}
+
+func TestHTTPServerConfig(t *testing.T) {
+	conf := DefaultHTTPServerConfig()
+	srv := NewHTTPServer(http.NotFoundHandler(), conf)
+	if srv.ReadHeaderTimeout != conf.ReadHeaderTimeout || srv.WriteTimeout != conf.WriteTimeout ||
+		srv.IdleTimeout != conf.IdleTimeout || srv.MaxHeaderBytes != conf.MaxHeaderBytes {
+		t.Errorf("got srv:%+v", srv.Server)
+	}
+	if err := conf.Validate(); err != nil {
+		t.Error(err)
+	}
+	conf.MaxConns = -1
+	if err := conf.Validate(); err == nil {
+		t.Error("want err")
+	}
+}
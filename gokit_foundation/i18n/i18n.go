@@ -0,0 +1,244 @@
+package i18n
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+按调用方的语言本地化返回给调用方的错误描述：
+-	Catalog：语言 => 消息key => 消息模板，每种语言一个json文件，文件名为语言(如zh-CN.json)，
+	内置的catalog(locales目录，kind.*和validation.*)最先加载，之后依次为New的fsyss(一般是服务嵌入的catalog)以及LoadDir的目录，
+	后加载的覆盖先加载的同名key；目录中的文件可以在运行时修改，Reload/Watch重新加载
+-	调用方的语言来自HTTP的Accept-Language header或grpc metadata的accept-language，由propagation.Fields传递给下游
+-	消息key：*errs.Error的Msg为Key(为空时为code.<Code>，Code为0时为kind.<Kind>)，
+	Details中的字段为validation.<Rule>(见errs.Violation)，模板中的{name}替换为参数，{field}为字段名
+-	调用方没有指定语言、没有匹配的语言或没有对应的key时保持原来的描述，所以原来的描述(英文)就是默认语言
+-	业务错误通过response返回时(如usersvc的RetCode、Msg)，response实现Response后同样由Middleware本地化
+*/
+
+//go:embed locales/*.json
+var builtin embed.FS
+
+type Catalog struct {
+	base map[string]map[string]string // 内置和New传入的catalog
+
+	mu     sync.RWMutex
+	dir    string
+	stamps map[string]fileStamp
+	msgs   map[string]map[string]string // 合并了dir之后的catalog，语言为小写
+}
+
+// 用于判断目录中的文件是否变化
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// New fsyss中任意目录下的*.json都会加载，文件格式不对时返回err
+func New(fsyss ...fs.FS) (*Catalog, error) {
+	base := map[string]map[string]string{}
+	for _, fsys := range append([]fs.FS{builtin}, fsyss...) {
+		if err := loadFS(base, fsys); err != nil {
+			return nil, err
+		}
+	}
+	return &Catalog{base: base, msgs: base}, nil
+}
+
+// MustNew 用于初始化包级别的变量，catalog是嵌入的，出错说明文件本身有问题
+func MustNew(fsyss ...fs.FS) *Catalog {
+	c, err := New(fsyss...)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+func loadFS(msgs map[string]map[string]string, fsys fs.FS) error {
+	return fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || path.Ext(p) != ".json" {
+			return err
+		}
+		b, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return err
+		}
+		return merge(msgs, strings.TrimSuffix(path.Base(p), ".json"), b)
+	})
+}
+
+func merge(msgs map[string]map[string]string, locale string, b []byte) error {
+	var m map[string]string
+	if err := json.Unmarshal(b, &m); err != nil {
+		return fmt.Errorf("i18n: %s: %v", locale, err)
+	}
+	locale = normalize(locale)
+	if msgs[locale] == nil {
+		msgs[locale] = map[string]string{}
+	}
+	for k, v := range m {
+		msgs[locale][k] = v
+	}
+	return nil
+}
+
+// zh_CN、zh-cn都作为zh-cn
+func normalize(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+}
+
+// LoadDir 设置运行时可修改的目录并立即加载，dir为空时只使用嵌入的catalog
+func (c *Catalog) LoadDir(dir string) error {
+	c.mu.Lock()
+	c.dir, c.stamps = dir, nil
+	c.mu.Unlock()
+	_, err := c.Reload()
+	return err
+}
+
+// Reload 目录中的文件有变化时重新加载，返回是否重新加载了，失败时保留之前的catalog
+func (c *Catalog) Reload() (bool, error) {
+	c.mu.RLock()
+	dir, old := c.dir, c.stamps
+	c.mu.RUnlock()
+	if dir == "" {
+		return false, nil
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return false, err
+	}
+	stamps := map[string]fileStamp{}
+	for _, f := range files {
+		fi, err := os.Stat(f)
+		if err != nil {
+			return false, fmt.Errorf("i18n: %v", err)
+		}
+		stamps[f] = fileStamp{fi.ModTime(), fi.Size()}
+	}
+	if old != nil && sameStamps(old, stamps) {
+		return false, nil
+	}
+
+	msgs := make(map[string]map[string]string, len(c.base))
+	for locale, m := range c.base {
+		msgs[locale] = make(map[string]string, len(m))
+		for k, v := range m {
+			msgs[locale][k] = v
+		}
+	}
+	for _, f := range files {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			return false, fmt.Errorf("i18n: %v", err)
+		}
+		if err := merge(msgs, strings.TrimSuffix(filepath.Base(f), ".json"), b); err != nil {
+			return false, err
+		}
+	}
+	c.mu.Lock()
+	c.msgs, c.stamps = msgs, stamps
+	c.mu.Unlock()
+	return true, nil
+}
+
+func sameStamps(a, b map[string]fileStamp) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || !v.modTime.Equal(w.modTime) || v.size != w.size {
+			return false
+		}
+	}
+	return true
+}
+
+// Watch 每隔interval检查一次LoadDir的目录，直到ctx结束，加载失败只打印日志
+func (c *Catalog) Watch(ctx context.Context, interval time.Duration, logger log.Logger) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			changed, err := c.Reload()
+			if err != nil {
+				logger.Log("i18n", "reload failed, keep using the old catalog", "err", err)
+			} else if changed {
+				logger.Log("i18n", "catalog reloaded", "locales", strings.Join(c.Locales(), ","))
+			}
+		}
+	}
+}
+
+// Locales 已加载的语言(小写)
+func (c *Catalog) Locales() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	ls := make([]string, 0, len(c.msgs))
+	for l := range c.msgs {
+		ls = append(ls, l)
+	}
+	sort.Strings(ls)
+	return ls
+}
+
+// Match 按Accept-Language的格式(如 zh-TW,zh;q=0.9,en;q=0.8)选出最匹配的已加载语言，都不匹配时返回空
+// 每个语言依次尝试：完全相同 => 主语言相同(zh-TW => zh) => 主语言相同的其他地区(zh => zh-cn)
+func (c *Catalog) Match(accept string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, want := range parseAcceptLanguage(accept) {
+		if _, ok := c.msgs[want]; ok {
+			return want
+		}
+		primary := strings.SplitN(want, "-", 2)[0]
+		if _, ok := c.msgs[primary]; ok {
+			return primary
+		}
+		var region []string
+		for l := range c.msgs {
+			if strings.HasPrefix(l, primary+"-") {
+				region = append(region, l)
+			}
+		}
+		if len(region) > 0 {
+			sort.Strings(region)
+			return region[0]
+		}
+	}
+	return ""
+}
+
+// Lookup 返回locale(Match的结果)中key的消息，模板中的{name}替换为args[name]
+func (c *Catalog) Lookup(locale, key string, args map[string]string) (string, bool) {
+	c.mu.RLock()
+	tmpl, ok := c.msgs[locale][key]
+	c.mu.RUnlock()
+	if !ok {
+		return "", false
+	}
+	if len(args) == 0 {
+		return tmpl, true
+	}
+	oldnew := make([]string, 0, 2*len(args))
+	for k, v := range args {
+		oldnew = append(oldnew, "{"+k+"}", v)
+	}
+	return strings.NewReplacer(oldnew...).Replace(tmpl), true
+}
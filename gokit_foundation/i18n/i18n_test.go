@@ -0,0 +1,164 @@
+package i18n
+
+import (
+	"context"
+	"errors"
+	"gokit_foundation/errs"
+	"google.golang.org/grpc/metadata"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+var svcCatalog = fstest.MapFS{
+	"locales/zh-CN.json": {Data: []byte(`{"code.3": "参数错误", "sum.overflow": "结果溢出"}`)},
+	"locales/ja.json":    {Data: []byte(`{"code.3": "パラメータが不正です"}`)},
+}
+
+func TestMatch(t *testing.T) {
+	c := MustNew(svcCatalog)
+	for accept, want := range map[string]string{
+		"zh-CN":                           "zh-cn",
+		"zh_cn":                           "zh-cn",
+		"zh-TW,zh;q=0.9":                  "zh-cn", // 主语言相同的其他地区
+		"fr;q=0.5,ja;q=0.8,en":            "en",
+		"fr,ja-JP;q=0.8":                  "ja", // 主语言
+		"ja;q=0,en;q=0.1":                 "en",
+		"fr":                              "",
+		"*":                               "",
+		"":                                "",
+		strings.Repeat("fr,", 200) + "ja": "",
+	} {
+		if got := c.Match(accept); got != want {
+			t.Errorf("%q got %q want %q", accept, got, want)
+		}
+	}
+}
+
+func TestLocalizeError(t *testing.T) {
+	c := MustNew(svcCatalog)
+	errInvalid := errs.Invalid("invalid request").WithCode(3)
+	err := errInvalid.WithDetails(map[string]string{"a": "must be at most 10", "b": "custom message"}).
+		WithViolations(map[string]errs.Violation{"a": {Rule: "max", Args: map[string]string{"param": "10"}}})
+
+	l := c.LocalizeError("zh-cn", err)
+	e := errs.From(l)
+	if e.Msg != "参数错误" || e.Details["a"] != "不能大于10" || e.Details["b"] != "custom message" {
+		t.Errorf("got msg:%q details:%v", e.Msg, e.Details)
+	}
+	if !errors.Is(l, errInvalid) || errs.From(err).Details["a"] != "must be at most 10" {
+		t.Errorf("original err changed or lost: %v", errs.From(err).Details)
+	}
+	// 只有Msg有翻译
+	if e := errs.From(c.LocalizeError("ja", err)); e.Msg != "パラメータが不正です" || e.Details["a"] != "must be at most 10" {
+		t.Errorf("ja got msg:%q details:%v", e.Msg, e.Details)
+	}
+	// Key优先，Code为0时按Kind
+	if e := errs.From(c.LocalizeError("zh-cn", errs.Invalid("overflow").WithCode(4).WithKey("sum.overflow"))); e.Msg != "结果溢出" {
+		t.Errorf("got %q", e.Msg)
+	}
+	if e := errs.From(c.LocalizeError("zh-cn", errs.Unavailable("down"))); e.Msg != "服务暂时不可用，请稍后重试" {
+		t.Errorf("got %q", e.Msg)
+	}
+	plain := errors.New("plain")
+	if c.LocalizeError("zh-cn", plain) != plain || c.LocalizeError("", err) != err {
+		t.Error("want original err")
+	}
+}
+
+type bizResponse struct {
+	V       int
+	RetCode int
+	Msg     string
+}
+
+func (r *bizResponse) ErrorMessage() (string, string) {
+	if r.RetCode == 0 {
+		return "", ""
+	}
+	return "code.3", r.Msg
+}
+
+func (r *bizResponse) WithErrorMessage(msg string) interface{} {
+	c := *r
+	c.Msg = msg
+	return &c
+}
+
+func TestMiddleware(t *testing.T) {
+	c := MustNew(svcCatalog)
+	cached := &bizResponse{RetCode: 3, Msg: "bad"}
+	var retErr error
+	ep := Middleware(c)(func(context.Context, interface{}) (interface{}, error) { return cached, retErr })
+
+	ctx := WithAcceptLanguage(context.Background(), "zh-CN,en;q=0.5")
+	rsp, _ := ep(ctx, nil)
+	if rsp.(*bizResponse).Msg != "参数错误" || cached.Msg != "bad" {
+		t.Errorf("got %+v, cached %+v", rsp, cached)
+	}
+	if rsp, _ := ep(context.Background(), nil); rsp != cached {
+		t.Errorf("no accept language got %+v", rsp)
+	}
+	retErr = errs.Invalid("invalid").WithCode(3)
+	if _, err := ep(ctx, nil); err.Error() != "参数错误" {
+		t.Errorf("got err:%v", err)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	ContextToHTTP()(WithAcceptLanguage(context.Background(), "zh-CN"), r)
+	ctx := HTTPToContext()(context.Background(), r)
+	md := metadata.MD{}
+	ContextToGRPC()(ctx, &md)
+	if got := AcceptLanguageFromContext(GRPCToContext()(context.Background(), md)); got != "zh-CN" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "i18n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name, s string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(s), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("zh-CN.json", `{"code.3": "参数有误"}`)
+	c := MustNew(svcCatalog)
+	if err := c.LoadDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	// 目录覆盖嵌入的catalog，其他key不受影响
+	if s, _ := c.Lookup("zh-cn", "code.3", nil); s != "参数有误" {
+		t.Errorf("got %q", s)
+	}
+	if s, _ := c.Lookup("zh-cn", "sum.overflow", nil); s != "结果溢出" {
+		t.Errorf("got %q", s)
+	}
+	if changed, err := c.Reload(); changed || err != nil {
+		t.Errorf("changed:%v err:%v", changed, err)
+	}
+
+	write("fr.json", `{"code.3": "paramètre invalide"}`)
+	if changed, err := c.Reload(); !changed || err != nil || c.Match("fr") != "fr" {
+		t.Errorf("changed:%v err:%v locales:%v", changed, err, c.Locales())
+	}
+	// 格式错误时保留之前的catalog
+	write("fr.json", `{"code.3": `)
+	_ = os.Chtimes(filepath.Join(dir, "fr.json"), time.Now(), time.Now().Add(time.Second))
+	if _, err := c.Reload(); err == nil {
+		t.Error("want err")
+	}
+	if s, _ := c.Lookup("fr", "code.3", nil); s != "paramètre invalide" {
+		t.Errorf("got %q", s)
+	}
+}
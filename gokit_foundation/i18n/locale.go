@@ -0,0 +1,108 @@
+package i18n
+
+import (
+	"context"
+	grpctransport "github.com/go-kit/kit/transport/grpc"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"google.golang.org/grpc/metadata"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	Header = "Accept-Language"
+	mdKey  = "accept-language"
+
+	// 过长的header只取前面的部分，避免解析大量的语言
+	maxAcceptLength = 256
+	maxLanguages    = 8
+)
+
+type ctxKey struct{}
+
+// WithAcceptLanguage ctx中保存原始的Accept-Language，由Catalog.Match选择语言，原样传给下游
+func WithAcceptLanguage(ctx context.Context, accept string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, accept)
+}
+
+func AcceptLanguageFromContext(ctx context.Context) string {
+	s, _ := ctx.Value(ctxKey{}).(string)
+	return s
+}
+
+func HTTPToContext() httptransport.RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		if s := r.Header.Get(Header); s != "" {
+			return WithAcceptLanguage(ctx, s)
+		}
+		return ctx
+	}
+}
+
+func GRPCToContext() grpctransport.ServerRequestFunc {
+	return func(ctx context.Context, md metadata.MD) context.Context {
+		if vs := md.Get(mdKey); len(vs) > 0 && vs[0] != "" {
+			return WithAcceptLanguage(ctx, vs[0])
+		}
+		return ctx
+	}
+}
+
+func ContextToHTTP() httptransport.RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		if s := AcceptLanguageFromContext(ctx); s != "" {
+			r.Header.Set(Header, s)
+		}
+		return ctx
+	}
+}
+
+func ContextToGRPC() grpctransport.ClientRequestFunc {
+	return func(ctx context.Context, md *metadata.MD) context.Context {
+		if s := AcceptLanguageFromContext(ctx); s != "" {
+			md.Set(mdKey, s)
+		}
+		return ctx
+	}
+}
+
+// 按q值从高到低返回小写的语言，q=0和*忽略
+func parseAcceptLanguage(accept string) []string {
+	if len(accept) > maxAcceptLength {
+		accept = accept[:maxAcceptLength]
+	}
+	type lang struct {
+		tag string
+		q   float64
+	}
+	var langs []lang
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		tag := normalize(fields[0])
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		for _, f := range fields[1:] {
+			if v := strings.TrimSpace(f); strings.HasPrefix(v, "q=") {
+				if n, err := strconv.ParseFloat(v[2:], 64); err == nil {
+					q = n
+				}
+			}
+		}
+		if q > 0 {
+			langs = append(langs, lang{tag, q})
+		}
+		if len(langs) == maxLanguages {
+			break
+		}
+	}
+	sort.SliceStable(langs, func(i, j int) bool { return langs[i].q > langs[j].q })
+	tags := make([]string, len(langs))
+	for i, l := range langs {
+		tags[i] = l.tag
+	}
+	return tags
+}
@@ -0,0 +1,96 @@
+package i18n
+
+import (
+	"context"
+	"errors"
+	"github.com/go-kit/kit/endpoint"
+	"gokit_foundation/errs"
+	"strconv"
+)
+
+// Response 业务错误通过response(而不是err)返回时由response实现，Middleware据此本地化其中的错误描述
+type Response interface {
+	// ErrorMessage 返回错误描述的消息key和原来的描述，没有错误时key为空
+	ErrorMessage() (key, msg string)
+	// WithErrorMessage 返回替换了错误描述的副本，不能修改原来的response(可能被缓存)
+	WithErrorMessage(msg string) interface{}
+}
+
+// MessageKey *errs.Error的Msg对应的消息key
+func MessageKey(e *errs.Error) string {
+	switch {
+	case e.Key != "":
+		return e.Key
+	case e.Code != 0:
+		return "code." + strconv.Itoa(e.Code)
+	}
+	return "kind." + e.Kind.String()
+}
+
+// LocalizeError 返回Msg、Details替换为locale语言的*errs.Error，原来的err可以通过errors.Unwrap取得(errors.Is仍然成立)，
+// err不是*errs.Error、locale为空或没有对应的key时原样返回
+func (c *Catalog) LocalizeError(locale string, err error) error {
+	var e *errs.Error
+	if locale == "" || !errors.As(err, &e) {
+		return err
+	}
+	msg, msgOK := c.Lookup(locale, MessageKey(e), nil)
+	var details map[string]string
+	for field, v := range e.Violations {
+		args := map[string]string{"field": field}
+		for k, a := range v.Args {
+			args[k] = a
+		}
+		s, ok := c.Lookup(locale, "validation."+v.Rule, args)
+		if !ok {
+			continue
+		}
+		if details == nil {
+			details = make(map[string]string, len(e.Details))
+			for k, d := range e.Details {
+				details[k] = d
+			}
+		}
+		details[field] = s
+	}
+	if !msgOK && details == nil {
+		return err
+	}
+	l := *e
+	if msgOK {
+		l.Msg = msg
+	}
+	if details != nil {
+		l.Details = details
+	}
+	return l.Wrap(err)
+}
+
+// Middleware 按ctx中的Accept-Language本地化返回的err以及实现了Response的response，
+// 安装在最外层(见mwchain.LayerI18n)，endpoint层的日志、指标记录的仍然是原来的描述
+func Middleware(c *Catalog) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			response, err := next(ctx, request)
+			accept := AcceptLanguageFromContext(ctx)
+			if accept == "" {
+				return response, err
+			}
+			locale := c.Match(accept)
+			if locale == "" {
+				return response, err
+			}
+			if err != nil {
+				return response, c.LocalizeError(locale, err)
+			}
+			if r, ok := response.(Response); ok {
+				if key, _ := r.ErrorMessage(); key != "" {
+					if msg, ok := c.Lookup(locale, key, nil); ok {
+						return r.WithErrorMessage(msg), nil
+					}
+				}
+			}
+			return response, nil
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package idempotency
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	grpctransport "github.com/go-kit/kit/transport/grpc"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"gokit_foundation/errs"
+	"google.golang.org/grpc/metadata"
+	"net/http"
+	"time"
+)
+
+/*
+幂等键，用于有副作用的接口(如创建用户)，使client可以安全地重试：
+-	client在请求中带上Idempotency-Key(http header)或idempotency-key(grpc metadata)，重试时使用同一个key
+-	第一次调用成功(endpoint没有返回err)后保存response，TTL内相同key的调用直接返回保存的response，不再执行
+-	调用返回err时删除记录，client可以用同一个key重试
+-	相同key的调用正在进行时，并发的重试返回ErrInProgress(可重试)，避免同时执行两次
+-	相同key但request不同(如重试时修改了参数)时返回ErrKeyReused
+-	没有key的请求不受影响，Store不可用时退化为直接调用next
+key不区分调用方，多个client共用时应使用足够随机的key(如UUID)
+*/
+
+const (
+	Header = "Idempotency-Key"
+	mdKey  = "idempotency-key"
+	maxLen = 255
+)
+
+var (
+	ErrKeyReused  = errs.Invalid("idempotency: key reused with a different request")
+	ErrInProgress = errs.Unavailable("idempotency: a request with the same key is in progress")
+)
+
+type ctxKey struct{}
+
+func WithKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, key)
+}
+
+func KeyFromContext(ctx context.Context) string {
+	k, _ := ctx.Value(ctxKey{}).(string)
+	return k
+}
+
+// HTTPToContext 读取Idempotency-Key，超过最大长度的key忽略，用于httptransport.ServerBefore
+func HTTPToContext() httptransport.RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		if k := r.Header.Get(Header); k != "" && len(k) <= maxLen {
+			return WithKey(ctx, k)
+		}
+		return ctx
+	}
+}
+
+// GRPCToContext 与HTTPToContext相同，从metadata中读取，用于grpctransport.ServerBefore
+func GRPCToContext() grpctransport.ServerRequestFunc {
+	return func(ctx context.Context, md metadata.MD) context.Context {
+		if vs := md.Get(mdKey); len(vs) > 0 && vs[0] != "" && len(vs[0]) <= maxLen {
+			return WithKey(ctx, vs[0])
+		}
+		return ctx
+	}
+}
+
+// ContextToGRPC 将ctx中的key写入metadata，用于grpctransport.ClientBefore
+func ContextToGRPC() grpctransport.ClientRequestFunc {
+	return func(ctx context.Context, md *metadata.MD) context.Context {
+		if k := KeyFromContext(ctx); k != "" {
+			md.Set(mdKey, k)
+		}
+		return ctx
+	}
+}
+
+// ContextToHTTP 将ctx中的key写入header，用于httptransport.ClientBefore
+func ContextToHTTP() httptransport.RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		if k := KeyFromContext(ctx); k != "" {
+			r.Header.Set(Header, k)
+		}
+		return ctx
+	}
+}
+
+type Config struct {
+	Method string
+	TTL    time.Duration // 成功的response保存的时间
+	// 调用进行中的占位保存的时间，应大于接口的超时时间，进程在调用过程中退出时占位在此之后过期，为0时与TTL相同
+	LockTTL time.Duration
+	Prefix  string
+	// 返回response类型的零值(指针)，重放时将保存的JSON解析到其中，它必须与next返回的类型一致
+	New func() interface{}
+	// 不为nil时返回值(如租户id)加到key中，不同Scope的调用方使用相同的key互不影响
+	Scope func(ctx context.Context) string
+}
+
+// 保存在Store中的记录，Response为空表示调用进行中
+type record struct {
+	Fingerprint string          `json:"fingerprint"`
+	Response    json.RawMessage `json:"response,omitempty"`
+}
+
+// request的JSON的sha1，用于检查相同key的request是否相同
+func fingerprint(request interface{}) (string, error) {
+	b, err := json.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+	sum := sha1.Sum(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func Middleware(store Store, conf Config, logger log.Logger) endpoint.Middleware {
+	lockTTL := conf.LockTTL
+	if lockTTL <= 0 {
+		lockTTL = conf.TTL
+	}
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			k := KeyFromContext(ctx)
+			if k == "" {
+				return next(ctx, request)
+			}
+			key := conf.Prefix + conf.Method + ":" + k
+			if conf.Scope != nil {
+				key = conf.Prefix + conf.Method + ":" + conf.Scope(ctx) + ":" + k
+			}
+			fp, err := fingerprint(request)
+			if err != nil {
+				logger.Log("idempotency", conf.Method, "err", err)
+				return next(ctx, request)
+			}
+			pending, _ := json.Marshal(record{Fingerprint: fp})
+			ok, err := store.SetNX(ctx, key, pending, lockTTL)
+			if err != nil {
+				logger.Log("idempotency", conf.Method, "op", "setnx", "err", err)
+				return next(ctx, request)
+			}
+			if !ok {
+				return replay(ctx, store, key, fp, conf.New)
+			}
+
+			response, err := next(ctx, request)
+			if err != nil {
+				if err := store.Delete(ctx, key); err != nil {
+					logger.Log("idempotency", conf.Method, "op", "delete", "err", err)
+				}
+				return response, err
+			}
+			b, err := json.Marshal(response)
+			if err == nil {
+				b, _ = json.Marshal(record{Fingerprint: fp, Response: b})
+				err = store.Set(ctx, key, b, conf.TTL)
+			}
+			if err != nil {
+				logger.Log("idempotency", conf.Method, "op", "set", "err", err)
+			}
+			return response, nil
+		}
+	}
+}
+
+// 返回已保存的response，记录在SetNX之后过期(不存在)时视为调用进行中，client重试即可
+func replay(ctx context.Context, store Store, key, fp string, newResponse func() interface{}) (interface{}, error) {
+	b, err := store.Get(ctx, key)
+	if err == ErrNotFound {
+		return nil, ErrInProgress
+	}
+	if err != nil {
+		return nil, errs.Unavailable("idempotency: get record").Wrap(err)
+	}
+	var rec record
+	if err := json.Unmarshal(b, &rec); err != nil {
+		return nil, errs.Internal("idempotency: invalid record").Wrap(err)
+	}
+	if rec.Fingerprint != fp {
+		return nil, ErrKeyReused
+	}
+	if len(rec.Response) == 0 {
+		return nil, ErrInProgress
+	}
+	response := newResponse()
+	if err := json.Unmarshal(rec.Response, response); err != nil {
+		return nil, errs.Internal("idempotency: invalid response").Wrap(err)
+	}
+	return response, nil
+}
@@ -0,0 +1,168 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"github.com/go-kit/kit/log"
+	"gokit_foundation/clock"
+	"google.golang.org/grpc/metadata"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type request struct {
+	Name string `json:"name"`
+}
+
+type response struct {
+	ID int64 `json:"id"`
+}
+
+func TestMiddleware(t *testing.T) {
+	var calls int64
+	fail := false
+	next := func(_ context.Context, req interface{}) (interface{}, error) {
+		n := atomic.AddInt64(&calls, 1)
+		if fail {
+			return nil, errors.New("db down")
+		}
+		return &response{ID: n}, nil
+	}
+	ep := Middleware(NewMemStore(10), Config{Method: "CreateUser", TTL: time.Minute, New: func() interface{} { return new(response) }}, log.NewNopLogger())(next)
+	ctx := WithKey(context.Background(), "k1")
+
+	// 没有key时每次都调用
+	for i := 0; i < 2; i++ {
+		_, _ = ep(context.Background(), &request{Name: "a"})
+	}
+	if calls != 2 {
+		t.Fatalf("no key got calls:%d", calls)
+	}
+
+	// 相同key重放第一次的response
+	rsp1, err1 := ep(ctx, &request{Name: "a"})
+	rsp2, err2 := ep(ctx, &request{Name: "a"})
+	if err1 != nil || err2 != nil || rsp1.(*response).ID != 3 || rsp2.(*response).ID != 3 || calls != 3 {
+		t.Errorf("replay got rsp1:%v rsp2:%v err1:%v err2:%v calls:%d", rsp1, rsp2, err1, err2, calls)
+	}
+	// 相同key不同request
+	if _, err := ep(ctx, &request{Name: "b"}); err != ErrKeyReused {
+		t.Errorf("reused key got err:%v", err)
+	}
+
+	// 失败后可以用同一个key重试
+	fail = true
+	ctx2 := WithKey(context.Background(), "k2")
+	if _, err := ep(ctx2, &request{Name: "a"}); err == nil {
+		t.Fatal("want err")
+	}
+	fail = false
+	if rsp, err := ep(ctx2, &request{Name: "a"}); err != nil || rsp.(*response).ID != 5 {
+		t.Errorf("retry after failure got rsp:%v err:%v", rsp, err)
+	}
+}
+
+// 第一次调用进行中时，相同key的调用返回ErrInProgress
+func TestMiddlewareInProgress(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	next := func(context.Context, interface{}) (interface{}, error) {
+		close(started)
+		<-release
+		return &response{ID: 1}, nil
+	}
+	ep := Middleware(NewMemStore(10), Config{Method: "CreateUser", TTL: time.Minute, New: func() interface{} { return new(response) }}, log.NewNopLogger())(next)
+	ctx := WithKey(context.Background(), "k1")
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := ep(ctx, &request{Name: "a"})
+		done <- err
+	}()
+	<-started
+	if _, err := ep(ctx, &request{Name: "a"}); err != ErrInProgress {
+		t.Errorf("got err:%v", err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if rsp, err := ep(ctx, &request{Name: "a"}); err != nil || rsp.(*response).ID != 1 {
+		t.Errorf("got rsp:%v err:%v", rsp, err)
+	}
+}
+
+// 不同Scope(如租户)的相同key互不影响
+func TestMiddlewareScope(t *testing.T) {
+	type ctxKeyScope struct{}
+	var calls int64
+	next := func(context.Context, interface{}) (interface{}, error) {
+		return &response{ID: atomic.AddInt64(&calls, 1)}, nil
+	}
+	ep := Middleware(NewMemStore(10), Config{
+		Method: "CreateUser",
+		TTL:    time.Minute,
+		New:    func() interface{} { return new(response) },
+		Scope:  func(ctx context.Context) string { s, _ := ctx.Value(ctxKeyScope{}).(string); return s },
+	}, log.NewNopLogger())(next)
+	ctx := WithKey(context.Background(), "k1")
+	a, b := context.WithValue(ctx, ctxKeyScope{}, "a"), context.WithValue(ctx, ctxKeyScope{}, "b")
+	rspA, _ := ep(a, &request{Name: "x"})
+	rspB, _ := ep(b, &request{Name: "x"})
+	replayA, _ := ep(a, &request{Name: "x"})
+	if rspA.(*response).ID != 1 || rspB.(*response).ID != 2 || replayA.(*response).ID != 1 {
+		t.Errorf("got a:%v b:%v replay a:%v", rspA, rspB, replayA)
+	}
+}
+
+func TestMemStore(t *testing.T) {
+	now := clock.NewFake(time.Now())
+	s := NewMemStore(2, MemStoreClock(now))
+	ctx := context.Background()
+
+	if ok, _ := s.SetNX(ctx, "a", []byte("1"), time.Second); !ok {
+		t.Fatal("SetNX a want ok")
+	}
+	if ok, _ := s.SetNX(ctx, "a", []byte("2"), time.Second); ok {
+		t.Error("SetNX existing key want not ok")
+	}
+	_ = s.Set(ctx, "b", []byte("1"), time.Minute)
+	// a最近被访问，c写入后淘汰b
+	_, _ = s.Get(ctx, "a")
+	_ = s.Set(ctx, "c", []byte("1"), time.Minute)
+	if _, err := s.Get(ctx, "b"); err != ErrNotFound {
+		t.Errorf("b want evicted, got err:%v", err)
+	}
+	// 过期
+	now.Advance(2 * time.Second)
+	if _, err := s.Get(ctx, "a"); err != ErrNotFound {
+		t.Errorf("a want expired, got err:%v", err)
+	}
+	if ok, _ := s.SetNX(ctx, "a", []byte("3"), time.Second); !ok {
+		t.Error("SetNX expired key want ok")
+	}
+	_ = s.Delete(ctx, "c")
+	if _, err := s.Get(ctx, "c"); err != ErrNotFound {
+		t.Errorf("c want deleted, got err:%v", err)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	r := httptest.NewRequest("POST", "/users", nil)
+	r.Header.Set(Header, "abc")
+	if k := KeyFromContext(HTTPToContext()(context.Background(), r)); k != "abc" {
+		t.Errorf("http got key:%q", k)
+	}
+	r.Header.Set(Header, strings.Repeat("x", maxLen+1))
+	if k := KeyFromContext(HTTPToContext()(context.Background(), r)); k != "" {
+		t.Errorf("too long key got:%q", k)
+	}
+
+	md := metadata.MD{}
+	ContextToGRPC()(WithKey(context.Background(), "abc"), &md)
+	if k := KeyFromContext(GRPCToContext()(context.Background(), md)); k != "abc" {
+		t.Errorf("grpc got key:%q", k)
+	}
+}
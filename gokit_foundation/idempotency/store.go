@@ -0,0 +1,148 @@
+package idempotency
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"github.com/go-redis/redis"
+	"gokit_foundation/clock"
+	"sync"
+	"time"
+)
+
+// Store 保存幂等记录，Get在key不存在(或已过期)时返回ErrNotFound
+type Store interface {
+	// SetNX 只在key不存在时写入，返回是否写入
+	SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error)
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+}
+
+var ErrNotFound = errors.New("idempotency: record not found")
+
+// RedisStore 多个实例共用记录，client重试到其他实例时也能重放
+type RedisStore struct {
+	cli *redis.Client
+}
+
+func NewRedisStore(cli *redis.Client) *RedisStore {
+	return &RedisStore{cli: cli}
+}
+
+func (s *RedisStore) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	return s.cli.WithContext(ctx).SetNX(key, value, ttl).Result()
+}
+
+func (s *RedisStore) Get(ctx context.Context, key string) ([]byte, error) {
+	b, err := s.cli.WithContext(ctx).Get(key).Bytes()
+	if err == redis.Nil {
+		return nil, ErrNotFound
+	}
+	return b, err
+}
+
+func (s *RedisStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return s.cli.WithContext(ctx).Set(key, value, ttl).Err()
+}
+
+func (s *RedisStore) Delete(ctx context.Context, key string) error {
+	return s.cli.WithContext(ctx).Del(key).Err()
+}
+
+// MemStore 进程内的LRU，超过size条时淘汰最久未使用的记录，只适用于单实例(或client总是重试到同一个实例)
+type MemStore struct {
+	mu    sync.Mutex
+	size  int
+	ll    *list.List // 最近使用的在前面
+	items map[string]*list.Element
+	clock clock.Clock
+}
+
+type memEntry struct {
+	key      string
+	value    []byte
+	expireAt time.Time
+}
+
+type MemStoreOption func(*MemStore)
+
+// 判断记录是否过期使用的时间，默认clock.Real
+func MemStoreClock(c clock.Clock) MemStoreOption {
+	return func(s *MemStore) { s.clock = c }
+}
+
+func NewMemStore(size int, options ...MemStoreOption) *MemStore {
+	s := &MemStore{size: size, ll: list.New(), items: make(map[string]*list.Element), clock: clock.Real}
+	for _, opt := range options {
+		opt(s)
+	}
+	return s
+}
+
+// 返回未过期的记录，过期的顺便删除，需要持有锁
+func (s *MemStore) get(key string) *list.Element {
+	e, ok := s.items[key]
+	if !ok {
+		return nil
+	}
+	if !s.clock.Now().Before(e.Value.(*memEntry).expireAt) {
+		s.ll.Remove(e)
+		delete(s.items, key)
+		return nil
+	}
+	return e
+}
+
+func (s *MemStore) set(key string, value []byte, ttl time.Duration) {
+	entry := &memEntry{key: key, value: value, expireAt: s.clock.Now().Add(ttl)}
+	if e, ok := s.items[key]; ok {
+		e.Value = entry
+		s.ll.MoveToFront(e)
+		return
+	}
+	s.items[key] = s.ll.PushFront(entry)
+	for s.ll.Len() > s.size {
+		oldest := s.ll.Back()
+		s.ll.Remove(oldest)
+		delete(s.items, oldest.Value.(*memEntry).key)
+	}
+}
+
+func (s *MemStore) SetNX(_ context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.get(key) != nil {
+		return false, nil
+	}
+	s.set(key, value, ttl)
+	return true, nil
+}
+
+func (s *MemStore) Get(_ context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := s.get(key)
+	if e == nil {
+		return nil, ErrNotFound
+	}
+	s.ll.MoveToFront(e)
+	return e.Value.(*memEntry).value, nil
+}
+
+func (s *MemStore) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.set(key, value, ttl)
+	return nil
+}
+
+func (s *MemStore) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.items[key]; ok {
+		s.ll.Remove(e)
+		delete(s.items, key)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package idgen
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"sync"
+)
+
+/*
+id生成的抽象，需要生成id(事件id、request id等)的组件通过构造函数注入Generator而不是直接读取随机数，
+测试时注入Sequence，生成的id可以预知
+*/
+
+type Generator interface {
+	NewID() string
+}
+
+// GeneratorFunc 将函数转为Generator
+type GeneratorFunc func() string
+
+func (f GeneratorFunc) NewID() string { return f() }
+
+// Random 生成n个随机字节的十六进制字符串(长度为2n)
+func Random(n int) Generator {
+	return GeneratorFunc(func() string {
+		b := make([]byte, n)
+		_, _ = rand.Read(b)
+		return hex.EncodeToString(b)
+	})
+}
+
+// OrDefault g为nil时返回def，用于可选的Generator参数
+func OrDefault(g, def Generator) Generator {
+	if g == nil {
+		return def
+	}
+	return g
+}
+
+// Sequence 依次生成prefix1、prefix2...，并发安全
+type Sequence struct {
+	prefix string
+
+	mu sync.Mutex
+	n  int
+}
+
+func NewSequence(prefix string) *Sequence {
+	return &Sequence{prefix: prefix}
+}
+
+func (s *Sequence) NewID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.n++
+	return s.prefix + strconv.Itoa(s.n)
+}
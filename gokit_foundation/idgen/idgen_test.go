@@ -0,0 +1,17 @@
+package idgen
+
+import "testing"
+
+func TestGenerators(t *testing.T) {
+	r := Random(8)
+	if a, b := r.NewID(), r.NewID(); len(a) != 16 || a == b {
+		t.Errorf("got ids:%q %q", a, b)
+	}
+	s := NewSequence("evt-")
+	if a, b := s.NewID(), s.NewID(); a != "evt-1" || b != "evt-2" {
+		t.Errorf("got ids:%q %q", a, b)
+	}
+	if OrDefault(nil, s) != Generator(s) {
+		t.Error("OrDefault")
+	}
+}
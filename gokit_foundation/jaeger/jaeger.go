@@ -0,0 +1,135 @@
+package jaeger
+
+import (
+	"fmt"
+	"github.com/go-kit/kit/log"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	jaegerclient "github.com/uber/jaeger-client-go"
+	jaegercfg "github.com/uber/jaeger-client-go/config"
+	"io"
+	"time"
+)
+
+/*
+基于jaeger-client-go的opentracing tracer，span上报方式二选一：
+-	AgentAddr：通过UDP发送给本机/sidecar的jaeger-agent(默认端口6831)，开销最小
+-	CollectorEndpoint：通过HTTP直接发送给jaeger-collector，如 http://jaeger:14268/api/traces，不需要部署agent
+两者都为空时不启用，返回opentracing.NoopTracer
+采样策略见Sampler*常量，由SamplerType和SamplerParam决定
+*/
+
+const (
+	// SamplerParam为1时全部采样，为0时全部不采样
+	SamplerConst = jaegerclient.SamplerTypeConst
+	// SamplerParam为采样率，取值[0, 1]
+	SamplerProbabilistic = jaegerclient.SamplerTypeProbabilistic
+	// SamplerParam为每秒最多采样的trace数
+	SamplerRateLimiting = jaegerclient.SamplerTypeRateLimiting
+	// 定期从agent拉取采样策略(由collector统一配置)，拉取成功前使用SamplerParam作为采样率
+	SamplerRemote = jaegerclient.SamplerTypeRemote
+)
+
+type Config struct {
+	AgentAddr         string
+	CollectorEndpoint string
+	SamplerType       string
+	SamplerParam      float64
+}
+
+// DefaultConfig 默认以0.1的采样率采样
+func DefaultConfig() Config {
+	return Config{SamplerType: SamplerProbabilistic, SamplerParam: 0.1}
+}
+
+func (c Config) Enabled() bool {
+	return c.AgentAddr != "" || c.CollectorEndpoint != ""
+}
+
+// Validate 检查采样配置，未启用时不检查
+func (c Config) Validate() error {
+	if !c.Enabled() {
+		return nil
+	}
+	switch c.SamplerType {
+	case SamplerConst:
+		if c.SamplerParam != 0 && c.SamplerParam != 1 {
+			return fmt.Errorf("jaeger: param of %s sampler must be 0 or 1, got %v", c.SamplerType, c.SamplerParam)
+		}
+	case SamplerProbabilistic, SamplerRemote:
+		if c.SamplerParam < 0 || c.SamplerParam > 1 {
+			return fmt.Errorf("jaeger: param of %s sampler must be in [0, 1], got %v", c.SamplerType, c.SamplerParam)
+		}
+	case SamplerRateLimiting:
+		if c.SamplerParam < 0 {
+			return fmt.Errorf("jaeger: param of %s sampler must not be negative, got %v", c.SamplerType, c.SamplerParam)
+		}
+	default:
+		return fmt.Errorf("jaeger: unknown sampler type %q, must be %s, %s, %s or %s",
+			c.SamplerType, SamplerConst, SamplerProbabilistic, SamplerRateLimiting, SamplerRemote)
+	}
+	return nil
+}
+
+// remote采样时拉取采样策略的地址，jaeger-agent的HTTP端口默认为5778
+const agentSamplingPort = "5778"
+
+func (c Config) configuration(serviceName string) jaegercfg.Configuration {
+	sampler := &jaegercfg.SamplerConfig{Type: c.SamplerType, Param: c.SamplerParam}
+	if c.SamplerType == SamplerRemote && c.AgentAddr != "" {
+		sampler.SamplingServerURL = "http://" + hostOf(c.AgentAddr) + ":" + agentSamplingPort + "/sampling"
+	}
+	return jaegercfg.Configuration{
+		ServiceName: serviceName,
+		Sampler:     sampler,
+		Reporter: &jaegercfg.ReporterConfig{
+			LocalAgentHostPort:  c.AgentAddr,
+			CollectorEndpoint:   c.CollectorEndpoint, // 不为空时优先使用
+			BufferFlushInterval: time.Second,
+		},
+	}
+}
+
+func hostOf(addr string) string {
+	for i := len(addr) - 1; i >= 0; i-- {
+		if addr[i] == ':' {
+			return addr[:i]
+		}
+	}
+	return addr
+}
+
+// New 按conf创建tracer，返回的io.Closer在进程退出前调用，会发送缓存中的span
+// 未启用时返回NoopTracer，一般在之后调用opentracing.SetGlobalTracer
+func New(serviceName string, conf Config, logger log.Logger) (stdopentracing.Tracer, io.Closer, error) {
+	if !conf.Enabled() {
+		logger.Log("jaeger", "disabled", "reason", "neither agent nor collector configured")
+		return stdopentracing.NoopTracer{}, nopCloser{}, nil
+	}
+	if err := conf.Validate(); err != nil {
+		return nil, nil, err
+	}
+	tracer, closer, err := conf.configuration(serviceName).NewTracer(jaegercfg.Logger(kitLogger{logger}))
+	if err != nil {
+		return nil, nil, fmt.Errorf("jaeger: %v", err)
+	}
+	logger.Log("jaeger", "enabled", "agent", conf.AgentAddr, "collector", conf.CollectorEndpoint,
+		"sampler", conf.SamplerType, "param", conf.SamplerParam)
+	return tracer, closer, nil
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
+// 将jaeger-client的日志输出到go-kit logger
+type kitLogger struct {
+	logger log.Logger
+}
+
+func (l kitLogger) Error(msg string) {
+	l.logger.Log("jaeger", "error", "err", msg)
+}
+
+func (l kitLogger) Infof(msg string, args ...interface{}) {
+	l.logger.Log("jaeger", fmt.Sprintf(msg, args...))
+}
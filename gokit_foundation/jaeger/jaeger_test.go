@@ -0,0 +1,62 @@
+package jaeger
+
+import (
+	"github.com/go-kit/kit/log"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	test := []struct {
+		name    string
+		conf    Config
+		wantErr bool
+	}{
+		{name: "[disabled]", conf: Config{SamplerType: "unknown"}},
+		{name: "[default]", conf: Config{AgentAddr: "127.0.0.1:6831", SamplerType: SamplerProbabilistic, SamplerParam: 0.1}},
+		{name: "[const]", conf: Config{AgentAddr: "127.0.0.1:6831", SamplerType: SamplerConst, SamplerParam: 1}},
+		{name: "[const 0.5]", conf: Config{AgentAddr: "127.0.0.1:6831", SamplerType: SamplerConst, SamplerParam: 0.5}, wantErr: true},
+		{name: "[probabilistic 2]", conf: Config{AgentAddr: "127.0.0.1:6831", SamplerType: SamplerProbabilistic, SamplerParam: 2}, wantErr: true},
+		{name: "[ratelimiting]", conf: Config{CollectorEndpoint: "http://127.0.0.1:14268/api/traces", SamplerType: SamplerRateLimiting, SamplerParam: 100}},
+		{name: "[ratelimiting -1]", conf: Config{AgentAddr: "127.0.0.1:6831", SamplerType: SamplerRateLimiting, SamplerParam: -1}, wantErr: true},
+		{name: "[unknown]", conf: Config{AgentAddr: "127.0.0.1:6831", SamplerType: "unknown"}, wantErr: true},
+	}
+	for _, tt := range test {
+		if err := tt.conf.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: wantErr %v, got %v", tt.name, tt.wantErr, err)
+		}
+	}
+}
+
+func TestRemoteSamplingURL(t *testing.T) {
+	c := Config{AgentAddr: "jaeger:6831", SamplerType: SamplerRemote, SamplerParam: 0.1}
+	if got := c.configuration("test").Sampler.SamplingServerURL; got != "http://jaeger:5778/sampling" {
+		t.Errorf("unexpected sampling url %s", got)
+	}
+}
+
+func TestNew(t *testing.T) {
+	tracer, closer, err := New("test", Config{}, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tracer.(stdopentracing.NoopTracer); !ok {
+		t.Errorf("want NoopTracer when disabled, got %T", tracer)
+	}
+	_ = closer.Close()
+
+	// UDP不需要连接，没有agent也能创建成功
+	conf := DefaultConfig()
+	conf.AgentAddr = "127.0.0.1:6831"
+	tracer, closer, err = New("test", conf, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tracer.(stdopentracing.NoopTracer); ok {
+		t.Error("want jaeger tracer when agent configured")
+	}
+	tracer.StartSpan("op").Finish()
+	if err := closer.Close(); err != nil {
+		t.Error(err)
+	}
+}
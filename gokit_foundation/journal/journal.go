@@ -0,0 +1,242 @@
+package journal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
+	bolt "go.etcd.io/bbolt"
+	"gokit_foundation/deadletter"
+	"sync"
+	"time"
+)
+
+/*
+worker的本地预写日志(write-ahead journal)，基于bbolt，用于进程崩溃后恢复处理了一半的消息
+-	处理消息之前写入in-flight记录(Begin，每次写入都fsync)，处理结果确定后删除(Done/Discard)，进程崩溃时记录留在文件中
+-	下次启动时在开始消费之前调用Replay：对每条遗留的记录调用complete重新完成，complete失败或记录超过MaxAge时调用compensate补偿
+	(如转入死信队列)，compensate返回ErrRequeue时交还给队列重新投递，两者都失败的记录保留到下一次启动
+-	Done的消息同时记下完成标记(保留DoneTTL)，队列重新投递同一条消息(如崩溃前没来得及ack)时用Completed判断后直接ack，不再处理
+-	日志只在本机，重新投递到其他实例的消息仍会被再次处理，endpoint依然需要是幂等的
+-	同一个文件只能被一个进程打开，Open等待文件锁最多1s
+*/
+
+var (
+	inflightBucket = []byte("inflight")
+	doneBucket     = []byte("done")
+)
+
+var (
+	// ErrExpired 记录超过MaxAge，Replay不再重新完成，直接补偿
+	ErrExpired = errors.New("journal: entry expired")
+	// ErrRequeue 由compensate返回，删除记录但不记完成标记，队列重新投递时正常处理
+	ErrRequeue = errors.New("journal: requeue")
+)
+
+// Entry 一条处理中的消息
+type Entry struct {
+	Message deadletter.Message `json:"message"`
+	Started time.Time          `json:"started"`
+}
+
+type Metrics struct {
+	Size           metrics.Gauge     // in-flight记录数
+	Replayed       metrics.Counter   // 标签result(completed、compensated、requeued、failed)
+	ReplayDuration metrics.Histogram // 一次Replay的总耗时(秒)
+}
+
+type Journal struct {
+	db *bolt.DB
+	m  Metrics
+	// 超过MaxAge的记录不再重新完成，为0时不限制
+	MaxAge time.Duration
+	// 完成标记保留多久，应大于队列重新投递的时间(如SQS的可见时间)，默认1h
+	DoneTTL time.Duration
+
+	mu        sync.Mutex
+	lastPrune time.Time
+}
+
+// Open 打开或创建path，Metrics中为nil的指标不上报
+func Open(path string, m Metrics) (*Journal, error) {
+	if m.Size == nil {
+		m.Size = discard.NewGauge()
+	}
+	if m.Replayed == nil {
+		m.Replayed = discard.NewCounter()
+	}
+	if m.ReplayDuration == nil {
+		m.ReplayDuration = discard.NewHistogram()
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{inflightBucket, doneBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	j := &Journal{db: db, m: m, DoneTTL: time.Hour}
+	j.updateSize()
+	return j, nil
+}
+
+func (j *Journal) Close() error {
+	return j.db.Close()
+}
+
+// Begin 写入in-flight记录，返回后才能开始处理，ID相同的记录被覆盖
+func (j *Journal) Begin(e Entry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	err = j.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(inflightBucket).Put([]byte(e.Message.ID), b)
+	})
+	j.updateSize()
+	return err
+}
+
+// Done 处理完成(包括确定不再重试的失败)，删除in-flight记录并记下完成标记
+func (j *Journal) Done(id string) error {
+	now := time.Now()
+	err := j.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(inflightBucket).Delete([]byte(id)); err != nil {
+			return err
+		}
+		return tx.Bucket(doneBucket).Put([]byte(id), []byte(now.Format(time.RFC3339Nano)))
+	})
+	j.updateSize()
+	j.maybePrune(now)
+	return err
+}
+
+// Discard 删除in-flight记录，不记完成标记，用于交还给队列重试的消息
+func (j *Journal) Discard(id string) error {
+	err := j.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(inflightBucket).Delete([]byte(id))
+	})
+	j.updateSize()
+	return err
+}
+
+// Completed id在DoneTTL内是否已完成
+func (j *Journal) Completed(id string) bool {
+	var done bool
+	_ = j.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(doneBucket).Get([]byte(id))
+		if v == nil {
+			return nil
+		}
+		at, err := time.Parse(time.RFC3339Nano, string(v))
+		done = err == nil && time.Since(at) < j.DoneTTL
+		return nil
+	})
+	return done
+}
+
+// Pending 遗留的in-flight记录，按ID排序
+func (j *Journal) Pending() ([]Entry, error) {
+	var entries []Entry
+	err := j.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(inflightBucket).ForEach(func(_, v []byte) error {
+			var e Entry
+			if err := json.Unmarshal(v, &e); err != nil {
+				return err
+			}
+			entries = append(entries, e)
+			return nil
+		})
+	})
+	return entries, err
+}
+
+// Replay 处理遗留的in-flight记录，在开始消费之前调用，返回补偿也失败的记录数，
+// 这些记录保留到下一次Replay，不影响其他记录
+func (j *Journal) Replay(ctx context.Context, complete func(context.Context, Entry) error,
+	compensate func(context.Context, Entry, error) error) (failed int, err error) {
+	start := time.Now()
+	defer func() { j.m.ReplayDuration.Observe(time.Since(start).Seconds()) }()
+	entries, err := j.Pending()
+	if err != nil {
+		return 0, err
+	}
+	for _, e := range entries {
+		if ctx.Err() != nil {
+			return failed, ctx.Err()
+		}
+		result := "completed"
+		cause := ErrExpired
+		if j.MaxAge <= 0 || time.Since(e.Started) < j.MaxAge {
+			cause = complete(ctx, e)
+		}
+		if cause != nil {
+			switch compensate(ctx, e, cause) {
+			case nil:
+				result = "compensated"
+			case ErrRequeue:
+				result = "requeued"
+			default:
+				result = "failed"
+			}
+		}
+		j.m.Replayed.With("result", result).Add(1)
+		switch result {
+		case "failed":
+			failed++
+		case "requeued":
+			err = j.Discard(e.Message.ID)
+		default:
+			err = j.Done(e.Message.ID)
+		}
+		if err != nil {
+			return failed, err
+		}
+	}
+	return failed, nil
+}
+
+func (j *Journal) updateSize() {
+	_ = j.db.View(func(tx *bolt.Tx) error {
+		j.m.Size.Set(float64(tx.Bucket(inflightBucket).Stats().KeyN))
+		return nil
+	})
+}
+
+// 每DoneTTL/2清理一次过期的完成标记
+func (j *Journal) maybePrune(now time.Time) {
+	j.mu.Lock()
+	if now.Sub(j.lastPrune) < j.DoneTTL/2 {
+		j.mu.Unlock()
+		return
+	}
+	j.lastPrune = now
+	j.mu.Unlock()
+	_ = j.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(doneBucket)
+		// 遍历时删除会跳过元素，先收集再删除
+		var expired [][]byte
+		_ = b.ForEach(func(k, v []byte) error {
+			if at, err := time.Parse(time.RFC3339Nano, string(v)); err != nil || now.Sub(at) >= j.DoneTTL {
+				expired = append(expired, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		for _, k := range expired {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
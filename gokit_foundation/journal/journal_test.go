@@ -0,0 +1,136 @@
+package journal
+
+import (
+	"context"
+	"errors"
+	"github.com/go-kit/kit/metrics/generic"
+	"gokit_foundation/deadletter"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openTemp(t *testing.T, m Metrics) (*Journal, string, func()) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "worker.db")
+	j, err := Open(path, m)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return j, path, func() { j.Close(); os.RemoveAll(dir) }
+}
+
+func entry(id string, started time.Time) Entry {
+	return Entry{Message: deadletter.Message{ID: id, Topic: "q", Value: []byte(id)}, Started: started}
+}
+
+func TestJournal(t *testing.T) {
+	size := generic.NewGauge("size")
+	j, path, cleanup := openTemp(t, Metrics{Size: size})
+	defer cleanup()
+
+	for _, id := range []string{"a", "b", "c"} {
+		if err := j.Begin(entry(id, time.Now())); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := j.Done("a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Discard("b"); err != nil {
+		t.Fatal(err)
+	}
+	if !j.Completed("a") || j.Completed("b") || j.Completed("c") || size.Value() != 1 {
+		t.Errorf("got completed a:%v b:%v c:%v size:%v", j.Completed("a"), j.Completed("b"), j.Completed("c"), size.Value())
+	}
+
+	// 模拟崩溃后重新打开，in-flight记录和完成标记都还在
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+	j, err := Open(path, Metrics{Size: size})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending, err := j.Pending()
+	if err != nil || len(pending) != 1 || pending[0].Message.ID != "c" || string(pending[0].Message.Value) != "c" || !j.Completed("a") {
+		t.Errorf("got pending:%+v err:%v", pending, err)
+	}
+	// 另一个进程打不开同一个文件
+	if other, err := Open(path, Metrics{}); err == nil {
+		other.Close()
+		t.Error("want err when opened twice")
+	}
+
+	// 完成标记过期后清理
+	j.DoneTTL = time.Millisecond
+	time.Sleep(2 * time.Millisecond)
+	if j.Completed("a") {
+		t.Error("a should expire")
+	}
+	_ = j.Done("c")
+	j.DoneTTL = time.Hour
+	if !j.Completed("c") || j.Completed("a") {
+		t.Errorf("got completed a:%v c:%v after prune", j.Completed("a"), j.Completed("c"))
+	}
+	j.Close()
+}
+
+func TestReplay(t *testing.T) {
+	duration := generic.NewHistogram("duration", 10)
+	j, _, cleanup := openTemp(t, Metrics{ReplayDuration: duration})
+	defer cleanup()
+	j.MaxAge = time.Hour
+	for _, e := range []Entry{
+		entry("ok", time.Now()), entry("fail", time.Now()), entry("requeue", time.Now()),
+		entry("stuck", time.Now()), entry("old", time.Now().Add(-2*time.Hour)),
+	} {
+		if err := j.Begin(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var completed []string
+	causes := map[string]error{}
+	complete := func(_ context.Context, e Entry) error {
+		completed = append(completed, e.Message.ID)
+		if e.Message.ID == "ok" {
+			return nil
+		}
+		return errors.New("boom")
+	}
+	compensate := func(_ context.Context, e Entry, cause error) error {
+		causes[e.Message.ID] = cause
+		switch e.Message.ID {
+		case "requeue":
+			return ErrRequeue
+		case "stuck":
+			return errors.New("dlq down")
+		}
+		return nil
+	}
+	failed, err := j.Replay(context.Background(), complete, compensate)
+	if err != nil || failed != 1 {
+		t.Fatalf("got failed:%d err:%v", failed, err)
+	}
+	// 超过MaxAge的记录不再重新完成
+	if len(completed) != 4 || len(causes) != 4 || causes["old"] != ErrExpired {
+		t.Errorf("got completed:%v causes:%v", completed, causes)
+	}
+	if !j.Completed("ok") || !j.Completed("fail") || !j.Completed("old") || j.Completed("requeue") || j.Completed("stuck") {
+		t.Error("got wrong done markers")
+	}
+	// 补偿失败的记录留到下一次
+	if pending, _ := j.Pending(); len(pending) != 1 || pending[0].Message.ID != "stuck" {
+		t.Errorf("got pending:%+v", pending)
+	}
+	if duration.Quantile(0.5) <= 0 {
+		t.Error("replay duration not observed")
+	}
+}
@@ -0,0 +1,64 @@
+package gokit_foundation
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/sd/dnssrv"
+	"net"
+	"os"
+	"time"
+)
+
+/*
+Kubernetes集群内的服务发现，不需要consul/etcd等外部注册中心：
+-	服务以headless service(clusterIP: None)暴露，k8s为每个ready的pod维护一条DNS SRV记录
+	_<port_name>._tcp.<svc>.<namespace>.svc.<cluster_domain>
+-	pod是否ready由readinessProbe(grpc健康检查)决定，所以注册/注销不需要做什么(见k8sRegistry)
+	退出时lame duck置为NOT_SERVING后pod变为not ready，DNS记录随之删除
+-	client侧定期解析SRV记录得到实例列表(go-kit sd/dnssrv)
+*/
+
+const SDBackendK8s = "k8s"
+
+// 测试时替换
+var lookupSRV dnssrv.Lookup = net.LookupSRV
+
+// K8sSRVName 返回headless service的SRV记录名
+// namespace为空时读取环境变量POD_NAMESPACE(通过downward API注入)，仍为空时使用default；portName为空时使用grpc
+// 集群域名读取环境变量K8S_CLUSTER_DOMAIN，为空时使用cluster.local
+func K8sSRVName(svc, namespace, portName string) string {
+	if namespace == "" {
+		namespace = os.Getenv("POD_NAMESPACE")
+	}
+	if namespace == "" {
+		namespace = "default"
+	}
+	if portName == "" {
+		portName = "grpc"
+	}
+	domain := os.Getenv("K8S_CLUSTER_DOMAIN")
+	if domain == "" {
+		domain = "cluster.local"
+	}
+	return fmt.Sprintf("_%s._tcp.%s.%s.svc.%s", portName, svc, namespace, domain)
+}
+
+// NewK8sInstancer 每隔refresh解析一次headless service的SRV记录，实现sd.Instancer
+func NewK8sInstancer(svc, namespace, portName string, refresh time.Duration, logger log.Logger) *dnssrv.Instancer {
+	return dnssrv.NewInstancerDetailed(K8sSRVName(svc, namespace, portName), time.NewTicker(refresh), lookupSRV, logger)
+}
+
+// 实例由k8s根据readinessProbe管理，不需要注册
+type k8sRegistry struct{}
+
+func (k8sRegistry) Register(svcName, svcHost string, port int, tags []string) error { return nil }
+
+func (k8sRegistry) Deregister() error { return nil }
+
+func (k8sRegistry) ID() string { return "" }
+
+func (k8sRegistry) KeepRegistered(ctx context.Context, logger log.Logger, interval, backoff time.Duration) error {
+	<-ctx.Done()
+	return nil
+}
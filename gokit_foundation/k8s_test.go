@@ -0,0 +1,43 @@
+package gokit_foundation
+
+import (
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/sd"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestK8sSRVName(t *testing.T) {
+	os.Setenv("POD_NAMESPACE", "prod")
+	defer os.Unsetenv("POD_NAMESPACE")
+	if got := K8sSRVName("addsvc", "", ""); got != "_grpc._tcp.addsvc.prod.svc.cluster.local" {
+		t.Errorf("got:%s", got)
+	}
+	if got := K8sSRVName("addsvc", "test", "http"); got != "_http._tcp.addsvc.test.svc.cluster.local" {
+		t.Errorf("got:%s", got)
+	}
+}
+
+func TestK8sInstancer(t *testing.T) {
+	old := lookupSRV
+	defer func() { lookupSRV = old }()
+	var gotName string
+	lookupSRV = func(service, proto, name string) (string, []*net.SRV, error) {
+		gotName = name
+		return "", []*net.SRV{
+			{Target: "10-0-0-1.addsvc.default.svc.cluster.local.", Port: 8080},
+			{Target: "10-0-0-2.addsvc.default.svc.cluster.local.", Port: 8080},
+		}, nil
+	}
+
+	s := NewK8sInstancer("addsvc", "default", "grpc", time.Hour, log.NewNopLogger())
+	defer s.Stop()
+	ch := make(chan sd.Event, 1)
+	s.Register(ch)
+	ev := <-ch
+	if gotName != "_grpc._tcp.addsvc.default.svc.cluster.local" || ev.Err != nil || len(ev.Instances) != 2 {
+		t.Errorf("got name:%s event:%+v", gotName, ev)
+	}
+}
@@ -0,0 +1,310 @@
+package gokit_foundation
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
+	stdconsul "github.com/hashicorp/consul/api"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+/*
+选主：多实例部署时，只能在一个实例上运行的后台任务(outbox投递、定时结算等)只在leader上运行
+-	consul：session(TTL)+KV锁(见stdconsul.Lock)，session过期或被删除时失去leader，key为gokit_leader/<name>
+-	etcd：lease+事务创建key(key不存在时才写入)，续约失败超过TTL时失去leader，key为/gokit_leader/<name>
+leader正常退出时Resign，其他实例立即当选；进程异常退出时要等session/lease过期(默认15s)
+网络分区时旧leader发现失去身份之前，新leader可能已经当选，任务本身仍需要幂等或有其他保护(如数据库锁)
+*/
+
+// Elector 选主的后端
+type Elector interface {
+	// 阻塞直到当选或ctx结束(返回nil, nil)，当选后lost在失去leader身份时关闭
+	Campaign(ctx context.Context) (lost <-chan struct{}, err error)
+	// 放弃leader身份，未当选时直接返回nil
+	Resign(ctx context.Context) error
+}
+
+// session/lease的TTL
+const defLeaderTTL = 15 * time.Second
+
+// NewElector 后端见NewRegistry，为空时读取环境变量SD_BACKEND，k8s没有选主，返回err
+func NewElector(backend, name string) (Elector, error) {
+	if backend == "" {
+		backend = os.Getenv("SD_BACKEND")
+	}
+	switch backend {
+	case "", SDBackendConsul:
+		return NewConsulElector(name)
+	case SDBackendEtcd:
+		return NewEtcdElector(etcdAddr(), name), nil
+	}
+	return nil, fmt.Errorf("unsupported leader election backend %q, want %s or %s", backend, SDBackendConsul, SDBackendEtcd)
+}
+
+// value为主机名和pid，用于查看当前的leader
+func leaderValue() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s:%d", host, os.Getpid())
+}
+
+// ConsulElector 基于consul session的选主，consul地址见ConsulAddr
+type ConsulElector struct {
+	lock *stdconsul.Lock
+}
+
+func NewConsulElector(name string) (*ConsulElector, error) {
+	cli, err := stdconsul.NewClient(&stdconsul.Config{
+		Address: consulAddr(),
+		// 等待锁时使用blocking query，超时需要大于LockWaitTime
+		HttpClient: &http.Client{Timeout: time.Minute},
+		Scheme:     "http",
+	})
+	if err != nil {
+		return nil, err
+	}
+	lock, err := cli.LockOpts(&stdconsul.LockOptions{
+		Key:          "gokit_leader/" + name,
+		Value:        []byte(leaderValue()),
+		SessionName:  "gokit_leader-" + name,
+		SessionTTL:   defLeaderTTL.String(),
+		LockWaitTime: 30 * time.Second,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &ConsulElector{lock: lock}, nil
+}
+
+func (e *ConsulElector) Campaign(ctx context.Context) (<-chan struct{}, error) {
+	lost, err := e.lock.Lock(ctx.Done())
+	if err != nil || lost == nil {
+		return nil, err
+	}
+	return lost, nil
+}
+
+// 释放锁并删除session
+func (e *ConsulElector) Resign(context.Context) error {
+	if err := e.lock.Unlock(); err != nil && err != stdconsul.ErrLockNotHeld {
+		return err
+	}
+	return nil
+}
+
+// EtcdElector 基于etcd lease的选主
+type EtcdElector struct {
+	cli   *etcdClient
+	key   string
+	value string
+	ttl   time.Duration
+
+	mu     sync.Mutex
+	lease  int64
+	cancel func() // 停止续约
+}
+
+func NewEtcdElector(addr, name string) *EtcdElector {
+	return &EtcdElector{cli: newEtcdClient(addr), key: "/gokit_leader/" + name, value: leaderValue(), ttl: defLeaderTTL}
+}
+
+func (e *EtcdElector) Campaign(ctx context.Context) (<-chan struct{}, error) {
+	for {
+		lease, err := e.cli.grantLease(ctx, e.ttl)
+		if err != nil {
+			return nil, ignoreCanceled(ctx, err)
+		}
+		ok, rev, err := e.cli.putIfAbsent(ctx, e.key, e.value, lease)
+		if err == nil && ok {
+			return e.keepLeader(lease), nil
+		}
+		e.revoke(lease)
+		if err != nil {
+			return nil, ignoreCanceled(ctx, err)
+		}
+		// 等待key被删除(leader Resign或lease过期)，最长等待一个TTL后重新尝试
+		wctx, cancel := context.WithTimeout(ctx, e.ttl)
+		err = e.cli.watchOnce(wctx, e.key, rev)
+		cancel()
+		if ctx.Err() != nil {
+			return nil, nil
+		}
+		if err != nil && wctx.Err() == nil {
+			return nil, err
+		}
+	}
+}
+
+// ctx结束导致的err与Campaign被取消相同
+func ignoreCanceled(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// 每TTL/3续约一次，lease已过期或超过TTL没有续约成功时关闭lost
+func (e *EtcdElector) keepLeader(lease int64) <-chan struct{} {
+	ctx, cancel := context.WithCancel(context.Background())
+	e.mu.Lock()
+	e.lease, e.cancel = lease, cancel
+	e.mu.Unlock()
+	lost := make(chan struct{})
+	go func() {
+		defer close(lost)
+		last := time.Now()
+		ticker := time.NewTicker(e.ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			kaCtx, kaCancel := context.WithTimeout(ctx, e.ttl/3)
+			ttl, err := e.cli.keepAlive(kaCtx, lease)
+			kaCancel()
+			if err == nil && ttl == 0 {
+				return
+			}
+			if err == nil {
+				last = time.Now()
+			} else if time.Since(last) >= e.ttl {
+				return
+			}
+		}
+	}()
+	return lost
+}
+
+func (e *EtcdElector) revoke(lease int64) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	_ = e.cli.revokeLease(ctx, lease)
+}
+
+// 撤销lease，key随之删除
+func (e *EtcdElector) Resign(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.lease == 0 {
+		return nil
+	}
+	// lease已过期时撤销失败，也不再续约
+	e.cancel()
+	lease := e.lease
+	e.lease, e.cancel = 0, nil
+	return e.cli.revokeLease(ctx, lease)
+}
+
+// Leadership 循环竞选leader，当选/失去leader时调用回调，Run作为TaskGroup的一个任务运行
+type Leadership struct {
+	elector Elector
+	logger  log.Logger
+	gauge   metrics.Gauge
+	// 竞选出错(如consul/etcd不可用)后等待多久重试
+	Retry time.Duration
+
+	mu        sync.Mutex
+	leader    bool
+	onAcquire []func(ctx context.Context)
+	onLose    []func()
+}
+
+// NewLeadership gauge为1表示本实例是leader，为nil时不上报
+func NewLeadership(e Elector, logger log.Logger, gauge metrics.Gauge) *Leadership {
+	if gauge == nil {
+		gauge = discard.NewGauge()
+	}
+	return &Leadership{elector: e, logger: logger, gauge: gauge, Retry: 5 * time.Second}
+}
+
+// OnAcquire 每次当选后在新的goroutine中调用fn，失去leader身份或Run退出时ctx结束，需要在Run之前调用
+func (l *Leadership) OnAcquire(fn func(ctx context.Context)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.onAcquire = append(l.onAcquire, fn)
+}
+
+// OnLose 每次失去leader身份后(OnAcquire的fn都已返回)调用，需要在Run之前调用
+func (l *Leadership) OnLose(fn func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.onLose = append(l.onLose, fn)
+}
+
+func (l *Leadership) IsLeader() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.leader
+}
+
+// Run 竞选直到ctx结束，失去leader身份后重新竞选，退出前Resign
+func (l *Leadership) Run(ctx context.Context) error {
+	for {
+		lost, err := l.elector.Campaign(ctx)
+		if err == nil && lost == nil {
+			return nil
+		}
+		if err != nil {
+			l.logger.Log("Leadership", "campaign failed", "err", err, "retry_after", l.Retry)
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(l.Retry):
+			}
+			continue
+		}
+		l.lead(ctx, lost)
+		resignCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		err = l.elector.Resign(resignCtx)
+		cancel()
+		if err != nil {
+			l.logger.Log("Leadership", "resign failed", "err", err)
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+// 运行OnAcquire的fn直到lost关闭或ctx结束
+func (l *Leadership) lead(ctx context.Context, lost <-chan struct{}) {
+	l.mu.Lock()
+	l.leader = true
+	onAcquire, onLose := l.onAcquire, l.onLose
+	l.mu.Unlock()
+	l.gauge.Set(1)
+	l.logger.Log("Leadership", "acquired")
+
+	leadCtx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	for _, fn := range onAcquire {
+		wg.Add(1)
+		go func(fn func(context.Context)) {
+			defer wg.Done()
+			fn(leadCtx)
+		}(fn)
+	}
+	reason := "lost"
+	select {
+	case <-lost:
+	case <-ctx.Done():
+		reason = "stopped"
+	}
+	// 先标记，IsLeader的调用方尽早停止
+	l.mu.Lock()
+	l.leader = false
+	l.mu.Unlock()
+	l.gauge.Set(0)
+	cancel()
+	wg.Wait()
+	l.logger.Log("Leadership", "released", "reason", reason)
+	for _, fn := range onLose {
+		fn()
+	}
+}
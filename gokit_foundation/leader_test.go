@@ -0,0 +1,154 @@
+package gokit_foundation
+
+import (
+	"context"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics/generic"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEtcdElector(t *testing.T) {
+	e, srv := newFakeEtcd()
+	defer srv.Close()
+	a, b := NewEtcdElector(srv.URL, "test"), NewEtcdElector(srv.URL, "test")
+	a.ttl, b.ttl = 30*time.Millisecond, 30*time.Millisecond
+	a.value, b.value = "a", "b"
+
+	ctx := context.Background()
+	lostA, err := a.Campaign(ctx)
+	if err != nil || lostA == nil {
+		t.Fatalf("a got err:%v", err)
+	}
+	// b一直等到a Resign
+	type result struct {
+		lost <-chan struct{}
+		err  error
+	}
+	done := make(chan result)
+	go func() {
+		lost, err := b.Campaign(ctx)
+		done <- result{lost, err}
+	}()
+	select {
+	case <-done:
+		t.Fatal("b elected while a is leader")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if v := e.values(); len(v) != 1 || v[0] != "a" {
+		t.Errorf("got values:%v", v)
+	}
+	if err := a.Resign(ctx); err != nil {
+		t.Fatal(err)
+	}
+	<-lostA
+	r := <-done
+	if r.err != nil || r.lost == nil {
+		t.Fatalf("b got err:%v", r.err)
+	}
+	if v := e.values(); len(v) != 1 || v[0] != "b" {
+		t.Errorf("got values:%v", v)
+	}
+
+	// lease过期时失去leader
+	e.expire()
+	select {
+	case <-r.lost:
+	case <-time.After(time.Second):
+		t.Fatal("b not lost after lease expired")
+	}
+
+	// ctx结束时返回nil, nil
+	lostA, _ = a.Campaign(ctx)
+	cctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if lost, err := b.Campaign(cctx); lost != nil || err != nil {
+		t.Errorf("got lost:%v err:%v", lost, err)
+	}
+	_ = a.Resign(ctx)
+}
+
+// 由测试控制当选和失去leader
+type fakeElector struct {
+	mu       sync.Mutex
+	lost     chan struct{}
+	elect    chan struct{}
+	resigned int
+}
+
+func (e *fakeElector) Campaign(ctx context.Context) (<-chan struct{}, error) {
+	select {
+	case <-ctx.Done():
+		return nil, nil
+	case <-e.elect:
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.lost = make(chan struct{})
+	return e.lost, nil
+}
+
+func (e *fakeElector) Resign(context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.resigned++
+	return nil
+}
+
+func (e *fakeElector) loseLeader() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	close(e.lost)
+}
+
+func TestLeadership(t *testing.T) {
+	e := &fakeElector{elect: make(chan struct{})}
+	gauge := generic.NewGauge("leader")
+	l := NewLeadership(e, log.NewNopLogger(), gauge)
+	acquired, lost := make(chan struct{}, 2), make(chan struct{}, 2)
+	l.OnAcquire(func(ctx context.Context) {
+		acquired <- struct{}{}
+		<-ctx.Done()
+	})
+	l.OnLose(func() { lost <- struct{}{} })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- l.Run(ctx) }()
+	if l.IsLeader() {
+		t.Error("leader before elected")
+	}
+	e.elect <- struct{}{}
+	<-acquired
+	if !l.IsLeader() || gauge.Value() != 1 {
+		t.Errorf("got leader:%v gauge:%v", l.IsLeader(), gauge.Value())
+	}
+	// 失去leader后OnAcquire的ctx结束，之后重新竞选
+	e.loseLeader()
+	<-lost
+	if l.IsLeader() || gauge.Value() != 0 {
+		t.Errorf("got leader:%v gauge:%v after lost", l.IsLeader(), gauge.Value())
+	}
+	e.elect <- struct{}{}
+	<-acquired
+	// Run返回前等待OnAcquire的fn返回
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(lost) != 1 || e.resigned != 2 {
+		t.Errorf("got lost:%d resigned:%d", len(lost), e.resigned)
+	}
+}
+
+func TestNewElector(t *testing.T) {
+	if _, err := NewElector(SDBackendK8s, "test"); err == nil {
+		t.Error("want err for k8s")
+	}
+	if e, err := NewElector(SDBackendEtcd, "test"); err != nil || e.(*EtcdElector).key != "/gokit_leader/test" {
+		t.Errorf("got err:%v", err)
+	}
+}
@@ -0,0 +1,230 @@
+package loadshed
+
+import (
+	"context"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
+	grpctransport "github.com/go-kit/kit/transport/grpc"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"gokit_foundation/errs"
+	"google.golang.org/grpc/metadata"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+/*
+按优先级的过载保护(load shedding)，过载时先拒绝低优先级的请求，保证高优先级的请求：
+-	优先级来自调用方的X-Priority header(grpc metadata为x-priority)：low、normal、high、critical，没有或不合法时为normal
+-	负载 = max(处理中的请求数/MaxInFlight, 耗时的EWMA/TargetLatency)，处理中的请求数不包括当前请求，
+	没有处理中的请求时不看耗时(否则全部被拒绝后耗时不再更新，服务恢复后也一直拒绝)
+-	负载达到优先级的阈值时拒绝(low 0.6、normal 0.8、high 1.0，critical不拒绝)，
+	返回可重试的Unavailable错误，RetryAfter为建议的重试间隔(见errs.RetryAfterOf，HTTP为Retry-After header)
+-	所有接口共用一个Shedder(进程的处理能力是共用的)，与MaxInFlightMiddleware(每个接口的硬上限，不区分优先级)互补
+labels: method、priority
+*/
+
+const (
+	Header = "X-Priority"
+	mdKey  = "x-priority" // grpc metadata的key是小写的
+)
+
+type Priority int
+
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityHigh
+	PriorityCritical // 健康检查、运维操作等，不会被拒绝
+	numPriorities
+)
+
+var priorityNames = [numPriorities]string{"low", "normal", "high", "critical"}
+
+// 负载达到阈值时拒绝，critical为0表示不拒绝
+var thresholds = [numPriorities]float64{0.6, 0.8, 1.0, 0}
+
+func (p Priority) String() string {
+	if p < 0 || p >= numPriorities {
+		return "unknown"
+	}
+	return priorityNames[p]
+}
+
+// ParsePriority 不区分大小写，不合法时返回false
+func ParsePriority(s string) (Priority, bool) {
+	for p, name := range priorityNames {
+		if strings.EqualFold(s, name) {
+			return Priority(p), true
+		}
+	}
+	return PriorityNormal, false
+}
+
+type ctxKeyPriority struct{}
+
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, ctxKeyPriority{}, p)
+}
+
+func fromContext(ctx context.Context) (Priority, bool) {
+	p, ok := ctx.Value(ctxKeyPriority{}).(Priority)
+	return p, ok
+}
+
+// FromContext ctx中没有优先级时返回PriorityNormal
+func FromContext(ctx context.Context) Priority {
+	if p, ok := fromContext(ctx); ok {
+		return p
+	}
+	return PriorityNormal
+}
+
+// HTTPToContext 用于httptransport.ServerBefore，header不合法时忽略
+func HTTPToContext() httptransport.RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		if p, ok := ParsePriority(r.Header.Get(Header)); ok {
+			ctx = WithPriority(ctx, p)
+		}
+		return ctx
+	}
+}
+
+// GRPCToContext 用于grpctransport.ServerBefore
+func GRPCToContext() grpctransport.ServerRequestFunc {
+	return func(ctx context.Context, md metadata.MD) context.Context {
+		if vs := md.Get(mdKey); len(vs) > 0 {
+			if p, ok := ParsePriority(vs[0]); ok {
+				ctx = WithPriority(ctx, p)
+			}
+		}
+		return ctx
+	}
+}
+
+// ContextToHTTP 用于httptransport.ClientBefore，ctx中没有优先级时不设置
+func ContextToHTTP() httptransport.RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		if p, ok := fromContext(ctx); ok {
+			r.Header.Set(Header, p.String())
+		}
+		return ctx
+	}
+}
+
+// ContextToGRPC 用于grpctransport.ClientBefore
+func ContextToGRPC() grpctransport.ClientRequestFunc {
+	return func(ctx context.Context, md *metadata.MD) context.Context {
+		if p, ok := fromContext(ctx); ok {
+			md.Set(mdKey, p.String())
+		}
+		return ctx
+	}
+}
+
+// 被拒绝时返回的err为它的副本(带上RetryAfter)，进程内可以用errors.Is判断
+var ErrOverloaded = errs.Unavailable("service overloaded, retry later")
+
+// Config MaxInFlight和TargetLatency都为0时不启用
+type Config struct {
+	MaxInFlight   int           // 所有接口处理中的请求数达到它时负载为1
+	TargetLatency time.Duration // 耗时的EWMA达到它时负载为1
+	RetryAfter    time.Duration // 建议的重试间隔，为0时使用1s
+}
+
+// Metrics 为nil的字段不统计
+type Metrics struct {
+	Shed metrics.Counter // 被拒绝的请求数，labels: method、priority
+	Load metrics.Gauge   // 每次请求时的负载
+}
+
+// 耗时EWMA的平滑系数，越大越快跟上最近的耗时
+const ewmaAlpha = 0.2
+
+type Shedder struct {
+	conf     func() Config
+	shed     metrics.Counter
+	load     metrics.Gauge
+	inFlight int64
+	latency  int64 // 耗时的EWMA，纳秒
+}
+
+// New conf每次请求时调用(热更新立即生效)
+func New(conf func() Config, m Metrics) *Shedder {
+	s := &Shedder{conf: conf, shed: m.Shed, load: m.Load}
+	if s.shed == nil {
+		s.shed = discard.NewCounter()
+	}
+	if s.load == nil {
+		s.load = discard.NewGauge()
+	}
+	return s
+}
+
+// Load 当前的负载，达到1表示饱和
+func (s *Shedder) Load() float64 {
+	return s.loadOf(s.conf(), atomic.LoadInt64(&s.inFlight))
+}
+
+func (s *Shedder) loadOf(c Config, inFlight int64) float64 {
+	var load float64
+	if c.MaxInFlight > 0 {
+		load = float64(inFlight) / float64(c.MaxInFlight)
+	}
+	if c.TargetLatency > 0 && inFlight > 0 {
+		if l := float64(atomic.LoadInt64(&s.latency)) / float64(c.TargetLatency); l > load {
+			load = l
+		}
+	}
+	return load
+}
+
+func (s *Shedder) observe(d time.Duration) {
+	for {
+		old := atomic.LoadInt64(&s.latency)
+		v := int64(d)
+		if old > 0 {
+			v = old + int64(ewmaAlpha*float64(int64(d)-old))
+		}
+		if atomic.CompareAndSwapInt64(&s.latency, old, v) {
+			return
+		}
+	}
+}
+
+// Middleware 所有接口使用同一个Shedder的Middleware
+func (s *Shedder) Middleware(method string) endpoint.Middleware {
+	var shed [numPriorities]metrics.Counter
+	for p := range shed {
+		shed[p] = s.shed.With("method", method, "priority", Priority(p).String())
+	}
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			c := s.conf()
+			if c.MaxInFlight <= 0 && c.TargetLatency <= 0 {
+				return next(ctx, request)
+			}
+			p := FromContext(ctx)
+			if p < 0 || p >= numPriorities {
+				p = PriorityNormal
+			}
+			n := atomic.AddInt64(&s.inFlight, 1)
+			defer atomic.AddInt64(&s.inFlight, -1)
+			load := s.loadOf(c, n-1)
+			s.load.Set(load)
+			if t := thresholds[p]; t > 0 && load >= t {
+				shed[p].Add(1)
+				retryAfter := c.RetryAfter
+				if retryAfter <= 0 {
+					retryAfter = time.Second
+				}
+				return nil, ErrOverloaded.WithRetryAfter(retryAfter).Wrap(ErrOverloaded)
+			}
+			start := time.Now()
+			defer func() { s.observe(time.Since(start)) }()
+			return next(ctx, request)
+		}
+	}
+}
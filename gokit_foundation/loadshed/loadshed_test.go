@@ -0,0 +1,167 @@
+package loadshed
+
+import (
+	"context"
+	"errors"
+	"github.com/go-kit/kit/metrics"
+	"gokit_foundation/errs"
+	"google.golang.org/grpc/metadata"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 按labels分别计数
+type labelCounter struct {
+	mu     *sync.Mutex
+	counts map[string]float64
+	labels string
+}
+
+func (c labelCounter) With(lvs ...string) metrics.Counter {
+	return labelCounter{mu: c.mu, counts: c.counts, labels: lvs[1] + "/" + lvs[3]}
+}
+func (c labelCounter) Add(d float64) {
+	c.mu.Lock()
+	c.counts[c.labels] += d
+	c.mu.Unlock()
+}
+
+// 阻塞直到release被关闭，用于制造处理中的请求
+func blocking(release chan struct{}) func(context.Context, interface{}) (interface{}, error) {
+	return func(context.Context, interface{}) (interface{}, error) {
+		<-release
+		return "ok", nil
+	}
+}
+
+func TestMiddlewareInFlight(t *testing.T) {
+	counter := labelCounter{mu: new(sync.Mutex), counts: map[string]float64{}}
+	s := New(func() Config { return Config{MaxInFlight: 10, RetryAfter: 200 * time.Millisecond} }, Metrics{Shed: counter})
+	release := make(chan struct{})
+	ep := s.Middleware("Sum")(blocking(release))
+
+	// 8个处理中的请求，负载0.8
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = ep(WithPriority(context.Background(), PriorityCritical), nil)
+		}()
+	}
+	for deadline := time.Now().Add(time.Second); s.Load() < 0.8 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	if l := s.Load(); l != 0.8 {
+		t.Fatalf("got load:%v", l)
+	}
+
+	// low、normal被拒绝，high、critical不受影响
+	for _, tt := range []struct {
+		p        Priority
+		wantShed bool
+	}{{PriorityLow, true}, {PriorityNormal, true}, {PriorityHigh, false}, {PriorityCritical, false}} {
+		p, wantShed := tt.p, tt.wantShed
+		done := make(chan error, 1)
+		go func() {
+			_, err := ep(WithPriority(context.Background(), p), nil)
+			done <- err
+		}()
+		if wantShed {
+			err := <-done
+			if !errors.Is(err, ErrOverloaded) || errs.KindOf(err) != errs.KindUnavailable || errs.RetryAfterOf(err) != 200*time.Millisecond {
+				t.Errorf("priority:%v got err:%v", p, err)
+			}
+			continue
+		}
+		select {
+		case err := <-done:
+			t.Errorf("priority:%v got err:%v, want admitted", p, err)
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+	// 没有优先级时为normal
+	if _, err := ep(context.Background(), nil); !errors.Is(err, ErrOverloaded) {
+		t.Errorf("got err:%v", err)
+	}
+	close(release)
+	wg.Wait()
+	counter.mu.Lock()
+	if counter.counts["Sum/low"] != 1 || counter.counts["Sum/normal"] != 2 || counter.counts["Sum/high"] != 0 {
+		t.Errorf("got counts:%v", counter.counts)
+	}
+	counter.mu.Unlock()
+
+	// 负载下降后不再拒绝
+	for deadline := time.Now().Add(time.Second); s.Load() != 0 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := ep(WithPriority(context.Background(), PriorityLow), nil); err != nil {
+		t.Errorf("got err:%v", err)
+	}
+}
+
+func TestMiddlewareLatency(t *testing.T) {
+	s := New(func() Config { return Config{TargetLatency: 10 * time.Millisecond} }, Metrics{})
+	slow := s.Middleware("Sum")(func(context.Context, interface{}) (interface{}, error) {
+		time.Sleep(20 * time.Millisecond)
+		return "ok", nil
+	})
+	if _, err := slow(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	// 没有处理中的请求时不看耗时
+	if l := s.Load(); l != 0 {
+		t.Errorf("got load:%v", l)
+	}
+	release := make(chan struct{})
+	ep := s.Middleware("Concat")(blocking(release))
+	go ep(WithPriority(context.Background(), PriorityCritical), nil)
+	for deadline := time.Now().Add(time.Second); s.Load() == 0 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	// 耗时是目标的2倍左右，除了critical都被拒绝
+	if _, err := ep(WithPriority(context.Background(), PriorityHigh), nil); !errors.Is(err, ErrOverloaded) || errs.RetryAfterOf(err) != time.Second {
+		t.Errorf("got err:%v load:%v", err, s.Load())
+	}
+	close(release)
+
+	// 未启用
+	off := New(func() Config { return Config{} }, Metrics{}).Middleware("Sum")(blocking(release))
+	if _, err := off(WithPriority(context.Background(), PriorityLow), nil); err != nil {
+		t.Errorf("got err:%v", err)
+	}
+}
+
+func TestPropagation(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/sum", nil)
+	ContextToHTTP()(WithPriority(context.Background(), PriorityHigh), r)
+	if h := r.Header.Get(Header); h != "high" {
+		t.Fatalf("got header:%q", h)
+	}
+	if p := FromContext(HTTPToContext()(context.Background(), r)); p != PriorityHigh {
+		t.Errorf("got priority:%v", p)
+	}
+	md := metadata.MD{}
+	ContextToGRPC()(WithPriority(context.Background(), PriorityLow), &md)
+	if p := FromContext(GRPCToContext()(context.Background(), md)); p != PriorityLow {
+		t.Errorf("got priority:%v md:%v", p, md)
+	}
+
+	// 没有设置时不传递，不合法的值被忽略
+	r = httptest.NewRequest(http.MethodPost, "/sum", nil)
+	ContextToHTTP()(context.Background(), r)
+	if h := r.Header.Get(Header); h != "" {
+		t.Errorf("got header:%q", h)
+	}
+	r.Header.Set(Header, "urgent")
+	if _, ok := fromContext(HTTPToContext()(context.Background(), r)); ok {
+		t.Error("invalid header should be ignored")
+	}
+	if p, ok := ParsePriority("CRITICAL"); !ok || p != PriorityCritical {
+		t.Errorf("got priority:%v", p)
+	}
+}
@@ -1,11 +1,18 @@
 package gokit_foundation
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"io"
+	"net/http"
 	"os"
 	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -25,11 +32,88 @@ func NewLogger(logger log.Logger) *Logger {
 	}
 }
 
+// KvLogger 在log.Logger基础上支持With(ctx)，从ctx中提取已注册的字段(见RegisterLogContextKey)
+type KvLogger struct {
+	log.Logger
+}
+
+type logContextKey struct {
+	field string
+	key   interface{}
+}
+
+// 已注册的ctx字段，只在启动时注册，之后只读，所以不加锁
+var logContextKeys []logContextKey
+
+// 常用的ctx key，在ctx中写入这些key的值，日志会自动带上对应字段(需先注册)
+type ContextKey string
+
+const (
+	CtxKeyRequestID ContextKey = "request_id"
+	CtxKeyTraceID   ContextKey = "trace_id"
+	CtxKeyTenant    ContextKey = "tenant"
+)
+
+// 注册一个ctx key，With(ctx)时若ctx中存在key对应的值，则以field为字段名写入日志，需在程序启动时调用
+func RegisterLogContextKey(field string, key interface{}) {
+	logContextKeys = append(logContextKeys, logContextKey{field: field, key: key})
+}
+
+// 返回预先带上ctx中已注册字段的logger，每个请求开始时调用一次即可
+func (l *KvLogger) With(ctx context.Context) log.Logger {
+	var kvs []interface{}
+	for _, k := range logContextKeys {
+		if v := ctx.Value(k.key); v != nil {
+			kvs = append(kvs, k.field, v)
+		}
+	}
+	if len(kvs) == 0 {
+		return l.Logger
+	}
+	return log.With(l.Logger, kvs...)
+}
+
+// logger为KvLogger时调用其With(ctx)，否则原样返回，方便只持有log.Logger的地方(如中间件)使用
+func LoggerWithContext(logger log.Logger, ctx context.Context) log.Logger {
+	if l, ok := logger.(*KvLogger); ok {
+		return l.With(ctx)
+	}
+	return logger
+}
+
 // 实现log.Logger接口来自定义其底层行为
-func NewKvLogger(logger log.Logger) log.Logger {
+func NewKvLogger(logger log.Logger) *KvLogger {
 	if logger != nil {
-		return logger
+		if l, ok := logger.(*KvLogger); ok {
+			return l
+		}
+		return &KvLogger{Logger: logger}
 	}
+	return newKvLogger(os.Stdout)
+}
+
+func newKvLogger(w io.Writer) *KvLogger {
+	return NewKvLoggerWithOptions(w, LogOptions{})
+}
+
+// LogOptions NewKvLoggerWithOptions的选项，零值与NewKvLogger(nil)相同
+type LogOptions struct {
+	JSON     bool         // 输出JSON(一行一个对象)，默认logfmt
+	Sampling *LogSampling // 为nil时不采样
+}
+
+// LogSampling 每个请求一行的日志(如LoggingUnaryInterceptor)在流量大时会刷屏，按字段值分组采样：
+// 每个周期内每组的前First条全部输出，之后每Thereafter条输出1条(为0时全部丢弃)
+// error级别的日志不采样
+type LogSampling struct {
+	Keys       []string // 分组的字段，取日志中第一个出现的字段的值(如"rpc"、"path")，都没有的日志不采样
+	First      int
+	Thereafter int
+	Tick       time.Duration // 周期，默认1s
+}
+
+// NewKvLoggerWithOptions 输出到w，日志级别同样由SetLogLevel控制
+func NewKvLoggerWithOptions(w io.Writer, opts LogOptions) *KvLogger {
 	var (
 		ts                = log.TimestampFormat(time.Now, TimeCommonLayout)
 		hommizationCaller = log.Valuer(func() interface{} {
@@ -52,8 +136,149 @@ func NewKvLogger(logger log.Logger) log.Logger {
 	)
 
 	var l log.Logger
-	l = log.NewLogfmtLogger(os.Stdout)
+	if opts.JSON {
+		l = log.NewJSONLogger(w)
+	} else {
+		l = log.NewLogfmtLogger(w)
+	}
+	// 级别过滤和采样放在最内层，不影响caller的depth；先过滤级别，被过滤的日志不参与采样计数
+	if opts.Sampling != nil {
+		l = newSampler(l, *opts.Sampling)
+	}
+	l = levelFilter{next: l}
 	l = log.With(l, "ts", ts)
 	l = log.With(l, "caller", hommizationCaller)
-	return l
+	return &KvLogger{Logger: l}
+}
+
+// 日志级别从低到高，低于当前级别的日志不输出
+var levelOrder = map[string]int32{"debug": 0, "info": 1, "warn": 2, "error": 3}
+
+// 当前级别，默认debug(全部输出)
+var minLogLevel int32
+
+// SetLogLevel 设置NewKvLogger(nil)创建的logger的日志级别，可以在运行时调用(如配置热更新)
+// 只过滤使用level.Debug/Info/Warn/Error打印的日志，未指定级别的日志总是输出
+func SetLogLevel(lvl string) error {
+	order, ok := levelOrder[lvl]
+	if !ok {
+		return fmt.Errorf("gokit_foundation: unknown log level %q", lvl)
+	}
+	atomic.StoreInt32(&minLogLevel, order)
+	return nil
+}
+
+// LogLevel 返回当前的日志级别
+func LogLevel() string {
+	min := atomic.LoadInt32(&minLogLevel)
+	for lvl, order := range levelOrder {
+		if order == min {
+			return lvl
+		}
+	}
+	return "debug"
+}
+
+// LogLevelHandler 运行时查看/修改日志级别，安装在管理用的http端口上：
+//
+//	GET /loglevel            返回 {"level":"info"}
+//	PUT /loglevel?level=warn 修改级别，也可以是POST表单
+func LogLevelHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut, http.MethodPost:
+			if err := SetLogLevel(r.FormValue("level")); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, PUT, POST")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(map[string]string{"level": LogLevel()})
+	})
+}
+
+type levelFilter struct {
+	next log.Logger
+}
+
+func (l levelFilter) Log(keyvals ...interface{}) error {
+	if min := atomic.LoadInt32(&minLogLevel); min > 0 {
+		for i := 0; i < len(keyvals)-1; i += 2 {
+			if keyvals[i] != level.Key() {
+				continue
+			}
+			if v, ok := keyvals[i+1].(level.Value); ok && levelOrder[v.String()] < min {
+				return nil
+			}
+			break
+		}
+	}
+	return l.next.Log(keyvals...)
+}
+
+type sampler struct {
+	next log.Logger
+	conf LogSampling
+
+	mu     sync.Mutex
+	start  time.Time      // 当前周期的开始时间
+	counts map[string]int // 当前周期内每组的条数，每个周期重新创建，字段值再多也不会无限增长
+}
+
+func newSampler(next log.Logger, conf LogSampling) *sampler {
+	if conf.Tick <= 0 {
+		conf.Tick = time.Second
+	}
+	return &sampler{next: next, conf: conf, counts: map[string]int{}}
+}
+
+func (s *sampler) Log(keyvals ...interface{}) error {
+	key, ok := s.key(keyvals)
+	if !ok {
+		return s.next.Log(keyvals...)
+	}
+	now := time.Now()
+	s.mu.Lock()
+	if now.Sub(s.start) >= s.conf.Tick {
+		s.start, s.counts = now, map[string]int{}
+	}
+	s.counts[key]++
+	n := s.counts[key]
+	s.mu.Unlock()
+
+	if n <= s.conf.First || s.conf.Thereafter > 0 && (n-s.conf.First)%s.conf.Thereafter == 0 {
+		return s.next.Log(keyvals...)
+	}
+	return nil
+}
+
+// key 返回分组的key(级别+字段值)，不需要采样时返回false
+func (s *sampler) key(keyvals []interface{}) (string, bool) {
+	var lvl, group string
+	found := false
+	for i := 0; i < len(keyvals)-1; i += 2 {
+		k := keyvals[i]
+		if k == level.Key() {
+			lvl = fmt.Sprint(keyvals[i+1])
+			if lvl == level.ErrorValue().String() {
+				return "", false
+			}
+			continue
+		}
+		if found {
+			continue
+		}
+		for _, want := range s.conf.Keys {
+			if k == want {
+				group, found = fmt.Sprint(keyvals[i+1]), true
+				break
+			}
+		}
+	}
+	return lvl + "|" + group, found
 }
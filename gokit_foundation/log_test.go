@@ -0,0 +1,168 @@
+package gokit_foundation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/go-kit/kit/log/level"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKvLoggerWithContext(t *testing.T) {
+	logContextKeys = nil
+	defer func() { logContextKeys = nil }()
+	RegisterLogContextKey("request_id", CtxKeyRequestID)
+	RegisterLogContextKey("tenant", CtxKeyTenant)
+	RegisterLogContextKey("trace_id", CtxKeyTraceID)
+
+	buf := &bytes.Buffer{}
+	logger := newKvLogger(buf)
+
+	ctx := context.WithValue(context.Background(), CtxKeyRequestID, "req-1")
+	ctx = context.WithValue(ctx, CtxKeyTenant, "t1")
+	l := LoggerWithContext(logger, ctx)
+	l.Log("msg", "first")
+	l.Log("msg", "second")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("want 2 lines, got:%q", buf.String())
+	}
+	for _, line := range lines {
+		for _, want := range []string{"request_id=req-1", "tenant=t1", "gokit_foundation/log_test.go:"} {
+			if !strings.Contains(line, want) {
+				t.Errorf("line:%s want contain:%s", line, want)
+			}
+		}
+		// ctx中没有的字段不输出
+		if strings.Contains(line, "trace_id") {
+			t.Errorf("line:%s should not contain trace_id", line)
+		}
+	}
+
+	buf.Reset()
+	logger.With(context.Background()).Log("msg", "no ctx values")
+	if strings.Contains(buf.String(), "request_id") {
+		t.Errorf("got:%s", buf.String())
+	}
+}
+
+func TestSetLogLevel(t *testing.T) {
+	defer SetLogLevel("debug")
+
+	buf := &bytes.Buffer{}
+	logger := newKvLogger(buf)
+	if err := SetLogLevel("warn"); err != nil {
+		t.Fatal(err)
+	}
+	level.Debug(logger).Log("msg", "debug")
+	level.Info(logger).Log("msg", "info")
+	level.Warn(logger).Log("msg", "warn")
+	logger.Log("msg", "no level")
+
+	out := buf.String()
+	for _, s := range []string{"msg=debug", "msg=info"} {
+		if strings.Contains(out, s) {
+			t.Errorf("%s should be filtered, got:%s", s, out)
+		}
+	}
+	for _, s := range []string{"level=warn msg=warn", `msg="no level"`, "gokit_foundation/log_test.go:"} {
+		if !strings.Contains(out, s) {
+			t.Errorf("want %s in:%s", s, out)
+		}
+	}
+
+	// 运行时调低级别后立即生效
+	_ = SetLogLevel("debug")
+	level.Debug(logger).Log("msg", "debug")
+	if !strings.Contains(buf.String(), "msg=debug") {
+		t.Errorf("debug log not output after SetLogLevel(debug)")
+	}
+
+	if err := SetLogLevel("verbose"); err == nil {
+		t.Error("want err for unknown level")
+	}
+}
+
+func TestJSONLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	NewKvLoggerWithOptions(buf, LogOptions{JSON: true}).Log("msg", "hello", "n", 1)
+	var m map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &m); err != nil {
+		t.Fatalf("not json:%s err:%v", buf.String(), err)
+	}
+	if m["msg"] != "hello" || m["n"] != 1.0 || !strings.Contains(m["caller"].(string), "gokit_foundation/log_test.go:") {
+		t.Errorf("got:%v", m)
+	}
+}
+
+func TestLogSampling(t *testing.T) {
+	count := func(out, s string) int {
+		n := 0
+		for _, line := range strings.Split(out, "\n") {
+			if strings.Contains(line, s) {
+				n++
+			}
+		}
+		return n
+	}
+
+	buf := &bytes.Buffer{}
+	logger := NewKvLoggerWithOptions(buf, LogOptions{Sampling: &LogSampling{
+		Keys: []string{"rpc", "path"}, First: 2, Thereafter: 3, Tick: time.Hour,
+	}})
+	for i := 0; i < 10; i++ {
+		logger.Log("rpc", "/Sum")
+		logger.Log("path", "/concat")
+		level.Error(logger).Log("rpc", "/Sum", "err", "x")
+		logger.Log("msg", "no key")
+	}
+	out := buf.String()
+	// 每组输出前2条，之后每3条输出1条(第5、8条)；error级别和没有分组字段的日志全部输出
+	for s, want := range map[string]int{"rpc=/Sum err": 10, "path=/concat": 4, `msg="no key"`: 10} {
+		if got := count(out, s); got != want {
+			t.Errorf("%s got %d lines want %d", s, got, want)
+		}
+	}
+	if got := count(out, "rpc=/Sum") - 10; got != 4 {
+		t.Errorf("rpc=/Sum got %d lines want 4", got)
+	}
+
+	// 新的周期重新计数
+	buf.Reset()
+	logger = NewKvLoggerWithOptions(buf, LogOptions{Sampling: &LogSampling{Keys: []string{"rpc"}, First: 1, Tick: 20 * time.Millisecond}})
+	logger.Log("rpc", "/Sum")
+	logger.Log("rpc", "/Sum")
+	time.Sleep(30 * time.Millisecond)
+	logger.Log("rpc", "/Sum")
+	if got := count(buf.String(), "rpc=/Sum"); got != 2 {
+		t.Errorf("after tick got %d lines want 2", got)
+	}
+}
+
+func TestLogLevelHandler(t *testing.T) {
+	defer SetLogLevel("debug")
+	h := LogLevelHandler()
+
+	do := func(method, target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+		return w
+	}
+	if w := do(http.MethodPut, "/loglevel?level=warn"); w.Code != http.StatusOK || LogLevel() != "warn" {
+		t.Fatalf("put got code:%d level:%s", w.Code, LogLevel())
+	}
+	if w := do(http.MethodGet, "/loglevel"); !strings.Contains(w.Body.String(), `"level":"warn"`) {
+		t.Errorf("get got:%s", w.Body.String())
+	}
+	if w := do(http.MethodPut, "/loglevel?level=verbose"); w.Code != http.StatusBadRequest || LogLevel() != "warn" {
+		t.Errorf("invalid level got code:%d level:%s", w.Code, LogLevel())
+	}
+	if w := do(http.MethodDelete, "/loglevel"); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("delete got code:%d", w.Code)
+	}
+}
@@ -0,0 +1,70 @@
+package logging
+
+import (
+	"context"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	"gokit_foundation"
+	"gokit_foundation/audit"
+	"gokit_foundation/reqid"
+	"gokit_foundation/tenant"
+)
+
+/*
+请求级别的logger：endpoint中间件为每次调用创建一个logger放入ctx，业务代码通过FromContext取得，
+不再为了request_id之类的字段把logger一路传进构造函数：
+-	Middleware预先带上request_id、method、tenant、trace_id(为空的字段不带)，安装在认证、租户之后(见mwchain.LayerReqLogger)，
+	tenant为确定后的租户；字段直接从ctx读取，不需要gokit_foundation.RegisterLogContextKey
+-	FromContext在ctx中没有logger(如未经过endpoint的后台任务)时返回Default带上ctx中已注册字段的logger
+-	同一个请求调用下游时ctx原样传递，下游服务的logger由它自己的Middleware重新创建
+*/
+
+// Default ctx中没有logger时使用，在程序启动时设置为服务的logger
+var Default log.Logger = gokit_foundation.NewKvLogger(nil)
+
+type ctxKeyLogger struct{}
+
+// NewContext 把logger放入ctx
+func NewContext(ctx context.Context, logger log.Logger) context.Context {
+	return context.WithValue(ctx, ctxKeyLogger{}, logger)
+}
+
+// FromContext 返回ctx中的请求级别logger，没有时返回Default
+func FromContext(ctx context.Context) log.Logger {
+	if logger, ok := ctx.Value(ctxKeyLogger{}).(log.Logger); ok {
+		return logger
+	}
+	return gokit_foundation.LoggerWithContext(Default, ctx)
+}
+
+// With 在ctx中的logger上追加字段，之后FromContext(ctx)取得的logger都带上这些字段
+func With(ctx context.Context, keyvals ...interface{}) context.Context {
+	return NewContext(ctx, log.With(FromContext(ctx), keyvals...))
+}
+
+// Middleware 为接口method的每次调用创建请求级别的logger，logger为nil时使用Default
+func Middleware(logger log.Logger, method string) endpoint.Middleware {
+	if logger == nil {
+		logger = Default
+	}
+	// 与KvLogger.With相同，在内层的logger上追加字段，log.With合并为一层，caller的depth不变
+	if l, ok := logger.(*gokit_foundation.KvLogger); ok {
+		logger = l.Logger
+	}
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			kvs := make([]interface{}, 0, 8)
+			if id := reqid.FromContext(ctx); id != "" {
+				kvs = append(kvs, "request_id", id)
+			}
+			kvs = append(kvs, "method", method)
+			if t := tenant.FromContext(ctx); t != "" {
+				kvs = append(kvs, "tenant", t)
+			}
+			if id := audit.TraceID(ctx); id != "" {
+				kvs = append(kvs, "trace_id", id)
+			}
+			return next(NewContext(ctx, log.With(logger, kvs...)), request)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/go-kit/kit/log"
+	"gokit_foundation"
+	"gokit_foundation/reqid"
+	"gokit_foundation/tenant"
+	"strings"
+	"testing"
+)
+
+func decode(t *testing.T, buf *bytes.Buffer) map[string]interface{} {
+	var m map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &m); err != nil {
+		t.Fatalf("decode %q: %v", buf.String(), err)
+	}
+	buf.Reset()
+	return m
+}
+
+func TestMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	logger := gokit_foundation.NewKvLoggerWithOptions(&buf, gokit_foundation.LogOptions{JSON: true})
+	ep := Middleware(logger, "Sum")(func(ctx context.Context, _ interface{}) (interface{}, error) {
+		FromContext(ctx).Log("msg", "summing")
+		FromContext(With(ctx, "a", 1)).Log("msg", "with a")
+		return nil, nil
+	})
+	ctx := tenant.WithTenant(reqid.WithRequestID(context.Background(), "req-1"), "acme")
+	if _, err := ep(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.SplitAfter(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got logs:%s", buf.String())
+	}
+	buf.Reset()
+	buf.WriteString(lines[0])
+	m := decode(t, &buf)
+	if m["request_id"] != "req-1" || m["method"] != "Sum" || m["tenant"] != "acme" || m["msg"] != "summing" {
+		t.Errorf("got:%v", m)
+	}
+	// trace_id为空时不带
+	if _, ok := m["trace_id"]; ok {
+		t.Errorf("got trace_id:%v", m["trace_id"])
+	}
+	// caller仍然是调用Log的位置
+	if caller, _ := m["caller"].(string); !strings.Contains(caller, "logging/logging_test.go:") {
+		t.Errorf("got caller:%v", m["caller"])
+	}
+	buf.WriteString(lines[1])
+	if m := decode(t, &buf); m["a"] != float64(1) || m["request_id"] != "req-1" {
+		t.Errorf("got:%v", m)
+	}
+}
+
+func TestFromContextDefault(t *testing.T) {
+	var buf bytes.Buffer
+	defer func(l log.Logger) { Default = l }(Default)
+	Default = log.NewJSONLogger(&buf)
+	FromContext(context.Background()).Log("msg", "no request")
+	if m := decode(t, &buf); m["msg"] != "no request" {
+		t.Errorf("got:%v", m)
+	}
+}
@@ -0,0 +1,212 @@
+package lru
+
+import (
+	"errors"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
+	"gokit_foundation/clock"
+	"sync"
+	"time"
+)
+
+/*
+分片的进程内LRU缓存(需要go1.18)，用于读多写少的热点数据(如按id查询用户)：
+-	key由Hash分到Shards个分片，每个分片一把锁和一个LRU链表，并发访问只在同一个分片内竞争
+-	每个分片最多保存 Size/Shards(向上取整) 条，超出时淘汰最久未使用的
+-	TTL大于0时过期的记录在Get时删除，不主动扫描，过期但没有被访问的记录会在容量满时被淘汰
+-	lookups按result(hit、miss)上报，evictions按reason(capacity、expired)上报，Delete不计入
+只在本进程内，多实例部署时其他实例的写入不会使本地缓存失效，旧数据最多保留TTL
+*/
+
+type Config struct {
+	Size   int           // 总容量
+	Shards int           // 分片数，向上取整为2的幂，为0时为16
+	TTL    time.Duration // 为0时不过期，只按容量淘汰
+	Clock  clock.Clock   // 判断过期使用的时间，为nil时为clock.Real
+}
+
+func (c Config) Validate() error {
+	if c.Size <= 0 {
+		return errors.New("lru: size must be positive")
+	}
+	if c.Shards < 0 || c.TTL < 0 {
+		return errors.New("lru: shards and ttl must not be negative")
+	}
+	return nil
+}
+
+type Cache[K comparable, V any] struct {
+	shards  []*shard[K, V]
+	mask    uint64
+	hash    func(K) uint64
+	ttl     time.Duration
+	clock   clock.Clock
+	hits    metrics.Counter
+	misses  metrics.Counter
+	evicted metrics.Counter
+	expired metrics.Counter
+}
+
+// New conf需已通过Validate，hash决定key所在的分片(见HashString、HashInt64)，lookups、evictions为nil时不上报
+func New[K comparable, V any](conf Config, hash func(K) uint64, lookups, evictions metrics.Counter) *Cache[K, V] {
+	if lookups == nil {
+		lookups = discard.NewCounter()
+	}
+	if evictions == nil {
+		evictions = discard.NewCounter()
+	}
+	n := 1
+	for n < conf.Shards || (conf.Shards == 0 && n < 16) {
+		n <<= 1
+	}
+	c := &Cache[K, V]{
+		shards:  make([]*shard[K, V], n),
+		mask:    uint64(n - 1),
+		hash:    hash,
+		ttl:     conf.TTL,
+		clock:   clock.OrReal(conf.Clock),
+		hits:    lookups.With("result", "hit"),
+		misses:  lookups.With("result", "miss"),
+		evicted: evictions.With("reason", "capacity"),
+		expired: evictions.With("reason", "expired"),
+	}
+	size := (conf.Size + n - 1) / n
+	for i := range c.shards {
+		s := &shard[K, V]{size: size, items: make(map[K]*entry[K, V])}
+		s.root.prev, s.root.next = &s.root, &s.root
+		c.shards[i] = s
+	}
+	return c
+}
+
+func (c *Cache[K, V]) shard(key K) *shard[K, V] {
+	return c.shards[c.hash(key)&c.mask]
+}
+
+// Get 未命中或已过期时返回false
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	s := c.shard(key)
+	s.mu.Lock()
+	e, ok := s.items[key]
+	if ok && c.ttl > 0 && !c.clock.Now().Before(e.expireAt) {
+		s.remove(e)
+		ok = false
+		c.expired.Add(1)
+	}
+	if !ok {
+		s.mu.Unlock()
+		c.misses.Add(1)
+		var zero V
+		return zero, false
+	}
+	s.moveToFront(e)
+	v := e.value
+	s.mu.Unlock()
+	c.hits.Add(1)
+	return v, true
+}
+
+// Set 写入或覆盖，重新计算过期时间
+func (c *Cache[K, V]) Set(key K, value V) {
+	var expireAt time.Time
+	if c.ttl > 0 {
+		expireAt = c.clock.Now().Add(c.ttl)
+	}
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.items[key]; ok {
+		e.value, e.expireAt = value, expireAt
+		s.moveToFront(e)
+		return
+	}
+	e := &entry[K, V]{key: key, value: value, expireAt: expireAt}
+	s.items[key] = e
+	s.pushFront(e)
+	for len(s.items) > s.size {
+		s.remove(s.root.prev)
+		c.evicted.Add(1)
+	}
+}
+
+// Delete 用于写入后使缓存失效，key不存在时什么也不做
+func (c *Cache[K, V]) Delete(key K) {
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.items[key]; ok {
+		s.remove(e)
+	}
+}
+
+// Len 所有分片的记录数，包括已过期但还没有删除的
+func (c *Cache[K, V]) Len() int {
+	n := 0
+	for _, s := range c.shards {
+		s.mu.Lock()
+		n += len(s.items)
+		s.mu.Unlock()
+	}
+	return n
+}
+
+type entry[K comparable, V any] struct {
+	key        K
+	value      V
+	expireAt   time.Time
+	prev, next *entry[K, V]
+}
+
+// 双向循环链表，root.next为最近使用的，root.prev为最久未使用的
+type shard[K comparable, V any] struct {
+	mu    sync.Mutex
+	size  int
+	items map[K]*entry[K, V]
+	root  entry[K, V]
+}
+
+func (s *shard[K, V]) pushFront(e *entry[K, V]) {
+	e.prev, e.next = &s.root, s.root.next
+	s.root.next.prev = e
+	s.root.next = e
+}
+
+func (s *shard[K, V]) unlink(e *entry[K, V]) {
+	e.prev.next = e.next
+	e.next.prev = e.prev
+	e.prev, e.next = nil, nil
+}
+
+func (s *shard[K, V]) moveToFront(e *entry[K, V]) {
+	if s.root.next == e {
+		return
+	}
+	s.unlink(e)
+	s.pushFront(e)
+}
+
+func (s *shard[K, V]) remove(e *entry[K, V]) {
+	s.unlink(e)
+	delete(s.items, e.key)
+}
+
+// HashString FNV-1a，用于string类型的key
+func HashString(s string) uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= 1099511628211
+	}
+	return h
+}
+
+// HashInt64 用于自增id等int64类型的key，打散连续的值
+func HashInt64(i int64) uint64 {
+	x := uint64(i)
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
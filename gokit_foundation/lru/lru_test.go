@@ -0,0 +1,111 @@
+package lru
+
+import (
+	"gokit_foundation/clock"
+	"gokit_foundation/memtransport"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 所有key都在同一个分片，方便验证淘汰顺序
+func sameShard(string) uint64 { return 0 }
+
+func TestCache(t *testing.T) {
+	lookups, evictions := memtransport.NewCounter(), memtransport.NewCounter()
+	c := New[string, int](Config{Size: 2, Shards: 1}, sameShard, lookups, evictions)
+	c.Set("a", 1)
+	c.Set("b", 2)
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Fatalf("got %v %v", v, ok)
+	}
+	// b最久未使用，被淘汰
+	c.Set("c", 3)
+	if _, ok := c.Get("b"); ok {
+		t.Error("b should be evicted")
+	}
+	if v, ok := c.Get("c"); !ok || v != 3 || c.Len() != 2 {
+		t.Errorf("got %v %v len:%d", v, ok, c.Len())
+	}
+	// 覆盖不淘汰其他记录
+	c.Set("a", 10)
+	if v, _ := c.Get("a"); v != 10 || c.Len() != 2 {
+		t.Errorf("got %v len:%d", v, c.Len())
+	}
+	c.Delete("a")
+	c.Delete("x")
+	if _, ok := c.Get("a"); ok || c.Len() != 1 {
+		t.Errorf("a should be deleted, len:%d", c.Len())
+	}
+	if hits, misses := len(lookups.Values("result", "hit")), len(lookups.Values("result", "miss")); hits != 3 || misses != 2 || lookups.Count() != 5 {
+		t.Errorf("got lookups hit:%d miss:%d total:%d", hits, misses, lookups.Count())
+	}
+	if n := len(evictions.Values("reason", "capacity")); n != 1 || evictions.Count() != 1 {
+		t.Errorf("got evictions capacity:%d total:%d", n, evictions.Count())
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1600000000, 0))
+	evictions := memtransport.NewCounter()
+	c := New[int64, string](Config{Size: 100, TTL: time.Minute, Clock: fake}, HashInt64, nil, evictions)
+	c.Set(1, "Jack")
+	fake.Advance(59 * time.Second)
+	if v, ok := c.Get(1); !ok || v != "Jack" {
+		t.Fatalf("got %v %v", v, ok)
+	}
+	// Set重新计算过期时间
+	c.Set(2, "Rose")
+	fake.Advance(time.Second)
+	if _, ok := c.Get(1); ok {
+		t.Error("1 should be expired")
+	}
+	if _, ok := c.Get(2); !ok {
+		t.Error("2 should not be expired")
+	}
+	if n := len(evictions.Values("reason", "expired")); c.Len() != 1 || n != 1 {
+		t.Errorf("got len:%d expired evictions:%d", c.Len(), n)
+	}
+}
+
+func TestCacheShards(t *testing.T) {
+	c := New[string, int](Config{Size: 1000, Shards: 5}, HashString, nil, nil)
+	if len(c.shards) != 8 || c.shards[0].size != 125 {
+		t.Errorf("got shards:%d size:%d", len(c.shards), c.shards[0].size)
+	}
+	if d := New[string, int](Config{Size: 10}, HashString, nil, nil); len(d.shards) != 16 || d.shards[0].size != 1 {
+		t.Errorf("got shards:%d size:%d", len(d.shards), d.shards[0].size)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 500; j++ {
+				k := strconv.Itoa(i*500 + j)
+				c.Set(k, j)
+				c.Get(k)
+				if j%3 == 0 {
+					c.Delete(k)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if n := c.Len(); n == 0 || n > 1000 {
+		t.Errorf("got len:%d", n)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, conf := range []Config{{}, {Size: 1, Shards: -1}, {Size: 1, TTL: -time.Second}} {
+		if conf.Validate() == nil {
+			t.Errorf("%+v: want err", conf)
+		}
+	}
+	if err := (Config{Size: 1}).Validate(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,178 @@
+package memtransport
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-kit/kit/endpoint"
+	grpctransport "github.com/go-kit/kit/transport/grpc"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"reflect"
+	"sync"
+)
+
+/*
+进程内的transport，不经过网络直接调用server端，但仍然执行两端的encode/decode函数和before/after函数，
+用于在单元测试中覆盖完整的调用链(client中间件 -> 编解码 -> server拦截器 -> endpoint中间件 -> service)：
+-	grpc：request和reply经过proto编解码(与网络上相同，不能编码的字段会报错)，
+	client写入的metadata作为server的incoming metadata，server写入的header/trailer交给client的after函数，
+	server返回的err转为grpc status(非status的err为codes.Unknown，与grpc相同)
+-	http：见HTTPClient，请求直接交给http.Handler处理
+*/
+
+// GRPCClient 与grpctransport.Client对应，handler为server端一个接口的实现，
+// 如 func(ctx context.Context, req interface{}) (interface{}, error) { return srv.Sum(ctx, req.(*pb.SumRequest)) }
+// 只有go-kit的grpctransport.Handler时使用GRPCHandler
+type GRPCClient struct {
+	handler      grpc.UnaryHandler
+	method       string
+	enc          grpctransport.EncodeRequestFunc
+	dec          grpctransport.DecodeResponseFunc
+	grpcReply    reflect.Type
+	before       []grpctransport.ClientRequestFunc
+	after        []grpctransport.ClientResponseFunc
+	interceptors []grpc.UnaryServerInterceptor
+}
+
+type GRPCClientOption func(*GRPCClient)
+
+func GRPCClientBefore(before ...grpctransport.ClientRequestFunc) GRPCClientOption {
+	return func(c *GRPCClient) { c.before = append(c.before, before...) }
+}
+
+func GRPCClientAfter(after ...grpctransport.ClientResponseFunc) GRPCClientOption {
+	return func(c *GRPCClient) { c.after = append(c.after, after...) }
+}
+
+// server端的拦截器，按顺序执行(第一个在最外层)
+func GRPCServerInterceptor(interceptors ...grpc.UnaryServerInterceptor) GRPCClientOption {
+	return func(c *GRPCClient) { c.interceptors = append(c.interceptors, interceptors...) }
+}
+
+// method为完整的方法名(如/pb.Add/Sum)，server端通过grpc.Method(ctx)获取，grpcReply与grpctransport.NewClient相同
+func NewGRPCClient(handler grpc.UnaryHandler, method string, enc grpctransport.EncodeRequestFunc, dec grpctransport.DecodeResponseFunc, grpcReply interface{}, options ...GRPCClientOption) *GRPCClient {
+	c := &GRPCClient{
+		handler:   handler,
+		method:    method,
+		enc:       enc,
+		dec:       dec,
+		grpcReply: reflect.TypeOf(reflect.Indirect(reflect.ValueOf(grpcReply)).Interface()),
+	}
+	for _, opt := range options {
+		opt(c)
+	}
+	return c
+}
+
+// GRPCHandler 将go-kit的grpctransport.Handler转为grpc.UnaryHandler
+func GRPCHandler(h grpctransport.Handler) grpc.UnaryHandler {
+	return func(ctx context.Context, req interface{}) (interface{}, error) {
+		_, rep, err := h.ServeGRPC(ctx, req)
+		return rep, err
+	}
+}
+
+func (c *GRPCClient) Endpoint() endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		ctx = context.WithValue(ctx, grpctransport.ContextKeyRequestMethod, c.method)
+
+		req, err := c.enc(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+		md := &metadata.MD{}
+		for _, f := range c.before {
+			ctx = f(ctx, md)
+		}
+
+		// server端的ctx只保留取消和截止时间，client ctx中的值(如token)只能通过metadata传递
+		srvReq, err := copyProto(req, reflect.TypeOf(req).Elem())
+		if err != nil {
+			return nil, err
+		}
+		stream := &serverStream{method: c.method}
+		srvCtx := grpc.NewContextWithServerTransportStream(metadata.NewIncomingContext(valueless{ctx}, md.Copy()), stream)
+		rep, err := c.serve(srvCtx, srvReq)
+		if err != nil {
+			return nil, status.Convert(err).Err()
+		}
+		grpcReply, err := copyProto(rep, c.grpcReply)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, f := range c.after {
+			ctx = f(ctx, stream.header, stream.trailer)
+		}
+		return c.dec(ctx, grpcReply)
+	}
+}
+
+func (c *GRPCClient) serve(ctx context.Context, req interface{}) (interface{}, error) {
+	h := c.handler
+	info := &grpc.UnaryServerInfo{FullMethod: c.method}
+	for i := len(c.interceptors) - 1; i >= 0; i-- {
+		next, interceptor := h, c.interceptors[i]
+		h = func(ctx context.Context, req interface{}) (interface{}, error) {
+			return interceptor(ctx, req, info, next)
+		}
+	}
+	return h(ctx, req)
+}
+
+// 经过proto编码再解码到typ的新对象中，与网络传输一样
+func copyProto(v interface{}, typ reflect.Type) (interface{}, error) {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("memtransport: %T is not a proto.Message", v)
+	}
+	b, err := proto.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	cp := reflect.New(typ).Interface().(proto.Message)
+	if err = proto.Unmarshal(b, cp); err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+// 只保留取消和截止时间的ctx
+type valueless struct {
+	context.Context
+}
+
+func (valueless) Value(interface{}) interface{} { return nil }
+
+// 记录server端写入的header/trailer，实现grpc.ServerTransportStream
+type serverStream struct {
+	method string
+
+	mu      sync.Mutex
+	header  metadata.MD
+	trailer metadata.MD
+}
+
+func (s *serverStream) Method() string { return s.method }
+
+func (s *serverStream) SetHeader(md metadata.MD) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func (s *serverStream) SendHeader(md metadata.MD) error {
+	return s.SetHeader(md)
+}
+
+func (s *serverStream) SetTrailer(md metadata.MD) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.trailer = metadata.Join(s.trailer, md)
+	return nil
+}
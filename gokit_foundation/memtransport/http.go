@@ -0,0 +1,47 @@
+package memtransport
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+)
+
+// HTTPClient 返回的client将请求直接交给h处理，url中的host不会被解析，
+// 可以传给httptransport.SetClient，client和server两端的编解码、before/after函数都会执行；
+// 与grpc一样，server端的ctx只保留取消和截止时间
+func HTTPClient(h http.Handler) *http.Client {
+	return &http.Client{Transport: roundTripper{h}}
+}
+
+type roundTripper struct {
+	h http.Handler
+}
+
+func (rt roundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	ctx := r.Context()
+	// 读取完整的body，server端可以看到ContentLength
+	var body []byte
+	if r.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(r.Body); err != nil {
+			return nil, err
+		}
+		r.Body.Close()
+	}
+	srvReq := httptest.NewRequest(r.Method, r.URL.String(), bytes.NewReader(body))
+	srvReq.Header = r.Header.Clone()
+	if r.Host != "" {
+		srvReq.Host = r.Host
+	}
+	srvReq = srvReq.WithContext(valueless{ctx})
+
+	rec := httptest.NewRecorder()
+	rt.h.ServeHTTP(rec, srvReq)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	resp := rec.Result()
+	resp.Request = r
+	return resp, nil
+}
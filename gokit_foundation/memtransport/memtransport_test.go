@@ -0,0 +1,179 @@
+package memtransport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/go-kit/kit/endpoint"
+	grpctransport "github.com/go-kit/kit/transport/grpc"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type (
+	ctxKey  struct{}
+	userKey struct{}
+)
+
+func TestGRPCClient(t *testing.T) {
+	var got struct {
+		service, user, method string
+		leaked                interface{}
+		order                 []string
+	}
+	ep := func(ctx context.Context, req interface{}) (interface{}, error) {
+		got.service = req.(string)
+		got.user, _ = ctx.Value(userKey{}).(string)
+		got.method, _ = grpc.Method(ctx)
+		got.leaked = ctx.Value(ctxKey{})
+		if got.service == "fail" {
+			return nil, errors.New("boom")
+		}
+		return healthpb.HealthCheckResponse_SERVING, nil
+	}
+	server := grpctransport.NewServer(endpoint.Endpoint(ep),
+		func(_ context.Context, req interface{}) (interface{}, error) {
+			return req.(*healthpb.HealthCheckRequest).Service, nil
+		},
+		func(_ context.Context, resp interface{}) (interface{}, error) {
+			return &healthpb.HealthCheckResponse{Status: resp.(healthpb.HealthCheckResponse_ServingStatus)}, nil
+		},
+		grpctransport.ServerBefore(func(ctx context.Context, md metadata.MD) context.Context {
+			if v := md.Get("x-user"); len(v) > 0 {
+				ctx = context.WithValue(ctx, userKey{}, v[0])
+			}
+			return ctx
+		}),
+		grpctransport.ServerAfter(func(ctx context.Context, header *metadata.MD, _ *metadata.MD) context.Context {
+			*header = metadata.Pairs("x-server", "1")
+			return ctx
+		}),
+	)
+	interceptor := func(name string) grpc.UnaryServerInterceptor {
+		return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			got.order = append(got.order, name+":"+info.FullMethod)
+			return handler(ctx, req)
+		}
+	}
+	var header metadata.MD
+	cli := NewGRPCClient(GRPCHandler(server), "/grpc.health.v1.Health/Check",
+		func(_ context.Context, req interface{}) (interface{}, error) {
+			return &healthpb.HealthCheckRequest{Service: req.(string)}, nil
+		},
+		func(_ context.Context, reply interface{}) (interface{}, error) {
+			return reply.(*healthpb.HealthCheckResponse).Status, nil
+		},
+		healthpb.HealthCheckResponse{},
+		GRPCClientBefore(func(ctx context.Context, md *metadata.MD) context.Context {
+			md.Set("x-user", "jack")
+			return ctx
+		}),
+		GRPCClientAfter(func(ctx context.Context, h metadata.MD, _ metadata.MD) context.Context {
+			header = h
+			return ctx
+		}),
+		GRPCServerInterceptor(interceptor("a"), interceptor("b")),
+	).Endpoint()
+
+	ctx := context.WithValue(context.Background(), ctxKey{}, "client only")
+	rep, err := cli(ctx, "addsvc")
+	if err != nil || rep != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("got rep:%v err:%v", rep, err)
+	}
+	if got.service != "addsvc" || got.user != "jack" || got.method != "/grpc.health.v1.Health/Check" || got.leaked != nil {
+		t.Errorf("server got:%+v", got)
+	}
+	if want := []string{"a:/grpc.health.v1.Health/Check", "b:/grpc.health.v1.Health/Check"}; !reflect.DeepEqual(got.order, want) {
+		t.Errorf("got interceptor order:%v", got.order)
+	}
+	if v := header.Get("x-server"); len(v) != 1 || v[0] != "1" {
+		t.Errorf("got header:%v", header)
+	}
+
+	// 与grpc一样，普通的err为codes.Unknown
+	if _, err = cli(ctx, "fail"); status.Code(err) != codes.Unknown || status.Convert(err).Message() != "boom" {
+		t.Errorf("got err:%v", err)
+	}
+}
+
+// request不是proto.Message时报错，与网络上的编码失败一样
+func TestGRPCClientNotProto(t *testing.T) {
+	cli := NewGRPCClient(
+		func(context.Context, interface{}) (interface{}, error) { return nil, nil }, "/x",
+		func(_ context.Context, req interface{}) (interface{}, error) { return req, nil },
+		func(_ context.Context, reply interface{}) (interface{}, error) { return reply, nil },
+		healthpb.HealthCheckResponse{},
+	).Endpoint()
+	if _, err := cli(context.Background(), &struct{}{}); err == nil || !strings.Contains(err.Error(), "not a proto.Message") {
+		t.Errorf("got err:%v", err)
+	}
+}
+
+func TestHTTPClient(t *testing.T) {
+	type req struct{ A, B int }
+	server := httptransport.NewServer(
+		func(ctx context.Context, r interface{}) (interface{}, error) {
+			if ctx.Value(ctxKey{}) != nil {
+				t.Error("client ctx value leaked to server")
+			}
+			return r.(req).A + r.(req).B, nil
+		},
+		func(_ context.Context, r *http.Request) (interface{}, error) {
+			var v req
+			err := json.NewDecoder(r.Body).Decode(&v)
+			return v, err
+		},
+		httptransport.EncodeJSONResponse,
+	)
+	u, _ := url.Parse("http://addsvc/sum")
+	cli := httptransport.NewClient(http.MethodPost, u, httptransport.EncodeJSONRequest,
+		func(_ context.Context, r *http.Response) (interface{}, error) {
+			var v int
+			err := json.NewDecoder(r.Body).Decode(&v)
+			return v, err
+		},
+		httptransport.SetClient(HTTPClient(server)),
+	).Endpoint()
+	ctx := context.WithValue(context.Background(), ctxKey{}, "client only")
+	if v, err := cli(ctx, req{1, 2}); err != nil || v != 3 {
+		t.Errorf("got v:%v err:%v", v, err)
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	logger := &Logger{}
+	logger.Log("method", "Sum", "err", nil)
+	logger.Log("method", "Concat", "odd")
+	if got := logger.Records("method", "Concat"); len(got) != 1 || got[0]["odd"] != "(MISSING)" {
+		t.Errorf("got records:%v", got)
+	}
+	if len(logger.Records("", nil)) != 2 {
+		t.Errorf("got records:%v", logger.Records("", nil))
+	}
+
+	h := NewHistogram()
+	h.With("method", "Sum").With("success", "true").Observe(1)
+	h.With("success", "true", "method", "Sum").Observe(2)
+	h.With("method", "Concat").Observe(3)
+	if got := h.Values("method", "Sum", "success", "true"); !reflect.DeepEqual(got, []float64{1, 2}) {
+		t.Errorf("got values:%v", got)
+	}
+	if h.Count() != 3 {
+		t.Errorf("got count:%d", h.Count())
+	}
+	c := NewCounter()
+	c.Add(1)
+	c.Add(2)
+	if got := c.Values(); !reflect.DeepEqual(got, []float64{1, 2}) {
+		t.Errorf("got counter values:%v", got)
+	}
+}
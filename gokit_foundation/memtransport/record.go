@@ -0,0 +1,131 @@
+package memtransport
+
+import (
+	"fmt"
+	"github.com/go-kit/kit/metrics"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Logger 记录所有日志，用于断言中间件输出的日志
+type Logger struct {
+	mu      sync.Mutex
+	records []map[string]interface{}
+}
+
+func (l *Logger) Log(keyvals ...interface{}) error {
+	rec := make(map[string]interface{}, len(keyvals)/2)
+	for i := 0; i < len(keyvals); i += 2 {
+		var v interface{} = "(MISSING)"
+		if i+1 < len(keyvals) {
+			v = keyvals[i+1]
+		}
+		rec[fmt.Sprint(keyvals[i])] = v
+	}
+	l.mu.Lock()
+	l.records = append(l.records, rec)
+	l.mu.Unlock()
+	return nil
+}
+
+// Records 按顺序返回key=value的日志，key为空时返回所有日志
+func (l *Logger) Records(key string, value interface{}) []map[string]interface{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var ret []map[string]interface{}
+	for _, rec := range l.records {
+		if key == "" || rec[key] == value {
+			ret = append(ret, rec)
+		}
+	}
+	return ret
+}
+
+func (l *Logger) Reset() {
+	l.mu.Lock()
+	l.records = nil
+	l.mu.Unlock()
+}
+
+// Metric 记录每次Add/Set/Observe的值及label，Counter、Gauge、Histogram共用
+type Metric struct {
+	lvs []string
+	s   *metricStore
+}
+
+type metricStore struct {
+	mu     sync.Mutex
+	values map[string][]float64 // label(k=v,k=v，按k排序) -> 按顺序的值
+}
+
+type (
+	Counter   struct{ *Metric }
+	Gauge     struct{ *Metric }
+	Histogram struct{ *Metric }
+)
+
+var (
+	_ metrics.Counter   = Counter{}
+	_ metrics.Gauge     = Gauge{}
+	_ metrics.Histogram = Histogram{}
+)
+
+func newMetric() *Metric {
+	return &Metric{s: &metricStore{values: map[string][]float64{}}}
+}
+
+func NewCounter() Counter     { return Counter{newMetric()} }
+func NewGauge() Gauge         { return Gauge{newMetric()} }
+func NewHistogram() Histogram { return Histogram{newMetric()} }
+
+func (c Counter) With(labelValues ...string) metrics.Counter { return Counter{c.with(labelValues)} }
+func (c Counter) Add(delta float64)                          { c.record(delta) }
+
+func (g Gauge) With(labelValues ...string) metrics.Gauge { return Gauge{g.with(labelValues)} }
+func (g Gauge) Set(value float64)                        { g.record(value) }
+func (g Gauge) Add(delta float64)                        { g.record(delta) }
+
+func (h Histogram) With(labelValues ...string) metrics.Histogram {
+	return Histogram{h.with(labelValues)}
+}
+func (h Histogram) Observe(value float64) { h.record(value) }
+
+func (m *Metric) with(labelValues []string) *Metric {
+	return &Metric{lvs: append(append([]string(nil), m.lvs...), labelValues...), s: m.s}
+}
+
+func (m *Metric) record(v float64) {
+	key := labelKey(m.lvs)
+	m.s.mu.Lock()
+	m.s.values[key] = append(m.s.values[key], v)
+	m.s.mu.Unlock()
+}
+
+// Values 返回label完全相同的所有值，labelValues为k,v,k,v...(与With的顺序无关)
+func (m *Metric) Values(labelValues ...string) []float64 {
+	key := labelKey(labelValues)
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+	return append([]float64(nil), m.s.values[key]...)
+}
+
+// Count 所有label的值的个数(如histogram的观测次数)
+func (m *Metric) Count() int {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+	n := 0
+	for _, vs := range m.s.values {
+		n += len(vs)
+	}
+	return n
+}
+
+func labelKey(lvs []string) string {
+	pairs := make([]string, 0, len(lvs)/2)
+	for i := 0; i+1 < len(lvs); i += 2 {
+		pairs = append(pairs, lvs[i]+"="+lvs[i+1])
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
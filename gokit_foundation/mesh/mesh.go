@@ -0,0 +1,119 @@
+package mesh
+
+import (
+	"context"
+	grpctransport "github.com/go-kit/kit/transport/grpc"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"gokit_foundation/propagation"
+	"google.golang.org/grpc/metadata"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+service mesh(Envoy sidecar、xDS)兼容模式，用于和sdclient的库内服务发现、负载均衡对比：
+-	client：sdclient.NewMesh以grpc的dial target代替注册中心，服务发现和负载均衡由grpc的xDS resolver(xds:///addsvc)
+	或Envoy sidecar(出站监听地址)完成，endpoint层的中间件(超时预算、重试、断路器、限流等)不变
+-	Envoy的链路追踪要求应用把入站请求的trace header原样带到出站请求上，由Field传递(X-Request-Id已由reqid传递)：
+	server读取Headers写入ctx，client写回下游请求的header/metadata
+-	client同时把ctx的剩余时间写入x-envoy-upstream-rq-timeout-ms，Envoy的路由超时与调用方的deadline一致(Envoy默认15s)；
+	Envoy的路由配置了重试时应减少client的重试(如sdclient.WithRetry(1, ...))，两层重试的次数是相乘的
+-	默认不启用，启动时追加：propagation.Fields = append(propagation.Fields, mesh.Field)；
+	b3 header由Envoy生成，不要同时启用zipkin tracer(它也会写b3 header)
+*/
+
+// Headers Envoy链路追踪使用的header，grpc metadata的key为其小写形式
+var Headers = []string{"X-B3-Traceid", "X-B3-Spanid", "X-B3-Parentspanid", "X-B3-Sampled", "X-B3-Flags", "B3", "X-Ot-Span-Context"}
+
+// TimeoutHeader Envoy的路由超时(毫秒)
+const TimeoutHeader = "X-Envoy-Upstream-Rq-Timeout-Ms"
+
+// Field 追加到propagation.Fields后启用
+var Field = propagation.Field{
+	Name:          "mesh",
+	Headers:       Headers,
+	HTTPToContext: HTTPToContext(),
+	GRPCToContext: GRPCToContext(),
+	ContextToHTTP: ContextToHTTP(),
+	ContextToGRPC: ContextToGRPC(),
+}
+
+type ctxKeyHeaders struct{}
+
+// WithHeaders 记录入站请求的trace header，key为Headers中的名字
+func WithHeaders(ctx context.Context, headers map[string]string) context.Context {
+	return context.WithValue(ctx, ctxKeyHeaders{}, headers)
+}
+
+// FromContext ctx中没有时返回nil
+func FromContext(ctx context.Context) map[string]string {
+	headers, _ := ctx.Value(ctxKeyHeaders{}).(map[string]string)
+	return headers
+}
+
+// HTTPToContext 用于httptransport.ServerBefore
+func HTTPToContext() httptransport.RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		return toContext(ctx, r.Header.Get)
+	}
+}
+
+// GRPCToContext 用于grpctransport.ServerBefore
+func GRPCToContext() grpctransport.ServerRequestFunc {
+	return func(ctx context.Context, md metadata.MD) context.Context {
+		return toContext(ctx, func(h string) string {
+			if vs := md.Get(strings.ToLower(h)); len(vs) > 0 {
+				return vs[0]
+			}
+			return ""
+		})
+	}
+}
+
+func toContext(ctx context.Context, get func(string) string) context.Context {
+	var headers map[string]string
+	for _, h := range Headers {
+		if v := get(h); v != "" {
+			if headers == nil {
+				headers = make(map[string]string, len(Headers))
+			}
+			headers[h] = v
+		}
+	}
+	if headers == nil {
+		return ctx
+	}
+	return WithHeaders(ctx, headers)
+}
+
+// ContextToHTTP 用于httptransport.ClientBefore
+func ContextToHTTP() httptransport.RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		fromContext(ctx, r.Header.Set)
+		return ctx
+	}
+}
+
+// ContextToGRPC 用于grpctransport.ClientBefore
+func ContextToGRPC() grpctransport.ClientRequestFunc {
+	return func(ctx context.Context, md *metadata.MD) context.Context {
+		fromContext(ctx, func(h, v string) { md.Set(strings.ToLower(h), v) })
+		return ctx
+	}
+}
+
+// ctx没有deadline时不设置超时，使用Envoy路由的配置
+func fromContext(ctx context.Context, set func(h, v string)) {
+	for h, v := range FromContext(ctx) {
+		set(h, v)
+	}
+	if dl, ok := ctx.Deadline(); ok {
+		left := time.Until(dl).Milliseconds()
+		if left < 1 {
+			left = 1 // 0表示不限制，已经超时的请求也不能变成不限制
+		}
+		set(TimeoutHeader, strconv.FormatInt(left, 10))
+	}
+}
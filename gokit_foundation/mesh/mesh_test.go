@@ -0,0 +1,59 @@
+package mesh
+
+import (
+	"context"
+	"google.golang.org/grpc/metadata"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestHTTP(t *testing.T) {
+	in := httptest.NewRequest("GET", "/", nil)
+	in.Header.Set("x-b3-traceid", "463ac35c9f6413ad")
+	in.Header.Set("X-B3-Sampled", "1")
+	ctx := HTTPToContext()(context.Background(), in)
+	if got := FromContext(ctx); len(got) != 2 || got["X-B3-Traceid"] != "463ac35c9f6413ad" {
+		t.Fatalf("got headers:%v", got)
+	}
+
+	out := httptest.NewRequest("GET", "/", nil)
+	ContextToHTTP()(ctx, out)
+	if out.Header.Get("X-B3-Traceid") != "463ac35c9f6413ad" || out.Header.Get("X-B3-Sampled") != "1" {
+		t.Errorf("got header:%v", out.Header)
+	}
+	// 没有deadline时不设置路由超时
+	if v := out.Header.Get(TimeoutHeader); v != "" {
+		t.Errorf("got timeout:%s", v)
+	}
+}
+
+func TestGRPC(t *testing.T) {
+	ctx := GRPCToContext()(context.Background(), metadata.Pairs("b3", "80f198ee56343ba8-e457b5a2e4d86bd1-1"))
+	ctx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+
+	md := metadata.MD{}
+	ContextToGRPC()(ctx, &md)
+	if vs := md.Get("b3"); len(vs) != 1 || vs[0] != "80f198ee56343ba8-e457b5a2e4d86bd1-1" {
+		t.Errorf("got md:%v", md)
+	}
+	vs := md.Get("x-envoy-upstream-rq-timeout-ms")
+	if len(vs) != 1 {
+		t.Fatalf("got md:%v", md)
+	}
+	if ms, err := strconv.Atoi(vs[0]); err != nil || ms <= 100 || ms > 200 {
+		t.Errorf("got timeout:%s", vs[0])
+	}
+}
+
+func TestExpiredDeadline(t *testing.T) {
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	md := metadata.MD{}
+	ContextToGRPC()(ctx, &md)
+	if vs := md.Get("x-envoy-upstream-rq-timeout-ms"); len(vs) != 1 || vs[0] != "1" {
+		t.Errorf("got md:%v", md)
+	}
+}
@@ -0,0 +1,105 @@
+package metricspush
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+/*
+把指标主动推送到prometheus pushgateway，用于prometheus拉取不到实例的环境(serverless、NAT后面、短生命周期的任务)：
+-	每Interval把gatherer中的所有指标PUT到 <URL>/metrics/job/<Job>/instance/<Instance>，替换这个分组之前的指标
+-	Run返回后调用Flush再推送一次，保证退出前的计数不丢失；DeleteOnStop时改为删除这个分组，避免pushgateway里留下已退出实例的指标
+	(pushgateway不会让指标过期，扩缩容频繁时需要删除，代价是最后一个Interval内的增量丢失)
+-	推送失败只输出日志，不影响服务，下一次推送的是累计值，不需要补推
+-	与/metrics拉取可以同时使用，prometheus应只选一种，否则同一个实例会有两份时间序列
+*/
+
+type Config struct {
+	URL      string // pushgateway地址，如 http://pushgateway:9091，为空时不启用
+	Job      string
+	Instance string        // 分组的instance标签，同一个job的多个实例必须不同，为空时使用主机名
+	Interval time.Duration // 推送间隔，应与prometheus拉取pushgateway的间隔接近
+	Timeout  time.Duration // 每次推送的超时
+	// 退出时删除分组而不是最后推送一次
+	DeleteOnStop bool
+}
+
+func DefaultConfig() Config {
+	return Config{Interval: 15 * time.Second, Timeout: 10 * time.Second}
+}
+
+func (c Config) Enabled() bool {
+	return c.URL != ""
+}
+
+// Validate 未启用时不检查
+func (c Config) Validate() error {
+	if !c.Enabled() {
+		return nil
+	}
+	if u, err := url.Parse(c.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("metricspush: url %q must be http(s)://host:port", c.URL)
+	}
+	if c.Job == "" {
+		return errors.New("metricspush: job is required")
+	}
+	if c.Interval <= 0 || c.Timeout <= 0 {
+		return errors.New("metricspush: interval and timeout must be positive")
+	}
+	return nil
+}
+
+type Pusher struct {
+	conf   Config
+	pusher *push.Pusher
+	logger log.Logger
+}
+
+// New conf需已通过Validate，gatherer一般为服务自己的registry
+func New(conf Config, gatherer stdprometheus.Gatherer, logger log.Logger) *Pusher {
+	if conf.Instance == "" {
+		conf.Instance, _ = os.Hostname()
+	}
+	p := push.New(conf.URL, conf.Job).
+		Gatherer(gatherer).
+		Grouping("instance", conf.Instance).
+		Client(&http.Client{Timeout: conf.Timeout})
+	return &Pusher{conf: conf, pusher: p, logger: logger}
+}
+
+// Run 启动后立即推送一次，之后每Interval推送一次，ctx结束时返回，返回后需调用Flush
+func (p *Pusher) Run(ctx context.Context) error {
+	p.logger.Log("metricspush", "started", "url", p.conf.URL, "job", p.conf.Job, "instance", p.conf.Instance, "interval", p.conf.Interval)
+	t := time.NewTicker(p.conf.Interval)
+	defer t.Stop()
+	for {
+		p.push()
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+		}
+	}
+}
+
+// Flush 最后推送一次，DeleteOnStop时删除分组
+func (p *Pusher) Flush() error {
+	if p.conf.DeleteOnStop {
+		return p.pusher.Delete()
+	}
+	return p.pusher.Push()
+}
+
+func (p *Pusher) push() {
+	if err := p.pusher.Push(); err != nil {
+		p.logger.Log("metricspush", "failed", "url", p.conf.URL, "err", err)
+	}
+}
@@ -0,0 +1,118 @@
+package metricspush
+
+import (
+	"context"
+	"github.com/go-kit/kit/log"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	ok := Config{URL: "http://127.0.0.1:9091", Job: "addsvc", Instance: "10.0.0.1:8080", Interval: time.Second, Timeout: time.Second}
+	test := []struct {
+		name    string
+		conf    func(c *Config)
+		wantErr bool
+	}{
+		{name: "[ok]", conf: func(c *Config) {}},
+		{name: "[disabled]", conf: func(c *Config) { *c = Config{} }},
+		{name: "[bad url]", conf: func(c *Config) { c.URL = "127.0.0.1:9091" }, wantErr: true},
+		{name: "[no job]", conf: func(c *Config) { c.Job = "" }, wantErr: true},
+		{name: "[no instance]", conf: func(c *Config) { c.Instance = "" }},
+		{name: "[no interval]", conf: func(c *Config) { c.Interval = 0 }, wantErr: true},
+	}
+	for _, tt := range test {
+		conf := ok
+		tt.conf(&conf)
+		if err := conf.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: wantErr %v, got %v", tt.name, tt.wantErr, err)
+		}
+	}
+}
+
+type pushRequest struct {
+	method, path, body string
+}
+
+func newGateway() (*httptest.Server, chan pushRequest) {
+	reqs := make(chan pushRequest, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		reqs <- pushRequest{method: r.Method, path: r.URL.Path, body: string(b)}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	return srv, reqs
+}
+
+func TestPusher(t *testing.T) {
+	srv, reqs := newGateway()
+	defer srv.Close()
+	reg := stdprometheus.NewRegistry()
+	c := stdprometheus.NewCounter(stdprometheus.CounterOpts{Name: "test_calls_total"})
+	reg.MustRegister(c)
+	c.Add(3)
+
+	conf := Config{URL: srv.URL, Job: "addsvc", Instance: "host1", Interval: 20 * time.Millisecond, Timeout: time.Second}
+	p := New(conf, reg, log.NewNopLogger())
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- p.Run(ctx) }()
+
+	// 启动后立即推送，之后按Interval推送
+	for i := 0; i < 2; i++ {
+		select {
+		case r := <-reqs:
+			if r.method != http.MethodPut || r.path != "/metrics/job/addsvc/instance/host1" {
+				t.Fatalf("want PUT /metrics/job/addsvc/instance/host1, got %s %s", r.method, r.path)
+			}
+			if !strings.Contains(r.body, "test_calls_total") {
+				t.Fatalf("metric not pushed, body %q", r.body)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("push %d not received", i)
+		}
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	for len(reqs) > 0 {
+		<-reqs
+	}
+	if err := p.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if r := <-reqs; r.method != http.MethodPut {
+		t.Errorf("want final PUT, got %s", r.method)
+	}
+}
+
+func TestPusherDeleteOnStop(t *testing.T) {
+	srv, reqs := newGateway()
+	defer srv.Close()
+	conf := Config{URL: srv.URL, Job: "addsvc", Instance: "host1", Interval: time.Second, Timeout: time.Second, DeleteOnStop: true}
+	p := New(conf, stdprometheus.NewRegistry(), log.NewNopLogger())
+	if err := p.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if r := <-reqs; r.method != http.MethodDelete || r.path != "/metrics/job/addsvc/instance/host1" {
+		t.Errorf("want DELETE /metrics/job/addsvc/instance/host1, got %s %s", r.method, r.path)
+	}
+}
+
+func TestPusherFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	conf := Config{URL: srv.URL, Job: "addsvc", Instance: "host1", Interval: time.Second, Timeout: time.Second}
+	p := New(conf, stdprometheus.NewRegistry(), log.NewNopLogger())
+	if err := p.Flush(); err == nil {
+		t.Error("want err when pushgateway is unavailable")
+	}
+}
@@ -0,0 +1,130 @@
+package metricsx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+	"gokit_foundation/otel"
+	"os"
+	"strings"
+	"time"
+)
+
+/*
+指标后端的抽象，基于go-kit的metrics.Counter/Gauge/Histogram，业务代码和中间件只依赖这三个接口，后端由配置选择(见Config)：
+-	prometheus(默认)：注册到独立的registry，由/metrics拉取(见Prometheus.Handler)或推送到pushgateway(见metricspush)，
+	histogram带trace_id exemplar(见otel.Histogram)，另外可以注册go runtime、进程等prometheus collector
+-	statsd：定期通过UDP发送，statsd协议不支持标签，With的标签被忽略(同名指标的所有标签合并为一个)；
+	histogram以timing发送，名字以_seconds结尾的改为_milliseconds并换算为毫秒
+-	dogstatsd：与statsd相同，标签作为DogStatsD的tag，用于Datadog agent
+-	otlp：定期通过OTLP(grpc)推送到OpenTelemetry collector，地址为空时与链路追踪相同(见otel.EnvEndpoint)，
+	所有histogram使用同一组bucket(HistogramBuckets)，gauge以ValueObserver上报最后一次的值
+prometheus以外的后端都是推送模式(见Pusher)，没有/metrics，需要由调用方运行Run并在退出时Stop
+指标名在所有后端中相同(namespace_subsystem_name，见Opts.FullName)，告警规则等只需要按后端调整语法
+*/
+
+const (
+	BackendPrometheus = "prometheus"
+	BackendStatsd     = "statsd"
+	BackendDogStatsd  = "dogstatsd"
+	BackendOTLP       = "otlp"
+)
+
+// Opts 与prometheus的CounterOpts等相同，LabelNames只有prometheus需要，其他后端按With传入的标签上报
+type Opts struct {
+	Namespace  string
+	Subsystem  string
+	Name       string
+	Help       string
+	LabelNames []string
+}
+
+// FullName 与prometheus.BuildFQName相同，如example_addsvc_panics_total
+func (o Opts) FullName() string {
+	parts := make([]string, 0, 3)
+	for _, p := range []string{o.Namespace, o.Subsystem, o.Name} {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, "_")
+}
+
+// Provider 创建指标，创建失败(如prometheus重复注册)时返回discard的指标并打印警告，不影响服务启动
+type Provider interface {
+	NewCounter(o Opts) metrics.Counter
+	NewGauge(o Opts) metrics.Gauge
+	// buckets为nil时使用后端的默认值，statsd/dogstatsd忽略
+	NewHistogram(o Opts, buckets []float64) metrics.Histogram
+}
+
+// Pusher 推送模式的后端
+type Pusher interface {
+	// Run 每隔Config.Interval推送一次，直到ctx结束
+	Run(ctx context.Context) error
+	// Stop 最后推送一次并释放连接，在所有指标写入之后(如BufferedHistogram.Flush之后)调用
+	Stop() error
+}
+
+// HistogramBuckets otlp所有histogram的bucket，与prometheus.DefBuckets相同
+var HistogramBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type Config struct {
+	Backend  string        // prometheus(默认)、statsd、dogstatsd、otlp
+	Addr     string        // statsd/dogstatsd的UDP地址，为空时为127.0.0.1:8125；otlp的collector地址，为空时使用环境变量OTEL_EXPORTER_OTLP_ENDPOINT
+	Interval time.Duration // 推送模式的推送间隔，<=0时为10s
+}
+
+func (c Config) Validate() error {
+	switch c.Backend {
+	case "", BackendPrometheus:
+		if c.Addr != "" {
+			return errors.New("metrics: addr can not be used with prometheus backend, metrics are served on /metrics")
+		}
+	case BackendStatsd, BackendDogStatsd:
+	case BackendOTLP:
+		if c.Addr == "" && os.Getenv(otel.EnvEndpoint) == "" {
+			return fmt.Errorf("metrics: otlp backend requires addr or %s", otel.EnvEndpoint)
+		}
+	default:
+		return fmt.Errorf("metrics: unknown backend %q, must be prometheus, statsd, dogstatsd or otlp", c.Backend)
+	}
+	return nil
+}
+
+// IsPrometheus 后端为prometheus(包括未设置)
+func (c Config) IsPrometheus() bool {
+	return c.Backend == "" || c.Backend == BackendPrometheus
+}
+
+func (c Config) interval() time.Duration {
+	if c.Interval <= 0 {
+		return time.Second * 10
+	}
+	return c.Interval
+}
+
+// New 按c.Backend创建Provider，serviceName作为otlp的service.name以及dogstatsd的service tag
+// prometheus使用新的registry(而不是全局的)，需要使用其他registry时直接调用NewPrometheus
+func New(c Config, serviceName string, logger log.Logger) (Provider, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	switch c.Backend {
+	case BackendStatsd, BackendDogStatsd:
+		addr := c.Addr
+		if addr == "" {
+			addr = "127.0.0.1:8125"
+		}
+		return NewStatsd(c.Backend == BackendDogStatsd, addr, c.interval(), serviceName, logger), nil
+	case BackendOTLP:
+		endpoint := c.Addr
+		if endpoint == "" {
+			endpoint = os.Getenv(otel.EnvEndpoint)
+		}
+		return NewOTLP(endpoint, c.interval(), serviceName, logger)
+	}
+	return NewPrometheus(nil, logger), nil
+}
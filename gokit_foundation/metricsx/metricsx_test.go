@@ -0,0 +1,175 @@
+package metricsx
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics/discard"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/label"
+	export "go.opentelemetry.io/otel/sdk/export/metric"
+	"go.opentelemetry.io/otel/sdk/export/metric/aggregation"
+	"gokit_foundation/otel"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOptsFullName(t *testing.T) {
+	if got := (Opts{Namespace: "example", Subsystem: "addsvc", Name: "panics_total"}).FullName(); got != "example_addsvc_panics_total" {
+		t.Errorf("got %s", got)
+	}
+	if got := (Opts{Namespace: "example", Name: "leader"}).FullName(); got != "example_leader" {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	t.Setenv(otel.EnvEndpoint, "")
+	test := []struct {
+		conf    Config
+		wantErr string
+	}{
+		{conf: Config{}},
+		{conf: Config{Backend: BackendDogStatsd, Addr: "127.0.0.1:8125"}},
+		{conf: Config{Backend: BackendOTLP, Addr: "otel-collector:4317"}},
+		{conf: Config{Backend: BackendOTLP}, wantErr: "requires addr"},
+		{conf: Config{Backend: BackendPrometheus, Addr: "127.0.0.1:9090"}, wantErr: "can not be used with prometheus"},
+		{conf: Config{Backend: "influx"}, wantErr: "unknown backend"},
+	}
+	for _, tt := range test {
+		err := tt.conf.Validate()
+		if (tt.wantErr == "") != (err == nil) || err != nil && !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("conf:%+v got err:%v want:%s", tt.conf, err, tt.wantErr)
+		}
+	}
+}
+
+type failingRegistry struct {
+	*stdprometheus.Registry
+}
+
+func (r failingRegistry) Register(stdprometheus.Collector) error {
+	return errors.New("registry unavailable")
+}
+
+func TestPrometheus(t *testing.T) {
+	p := NewPrometheus(nil, nil)
+	p.NewCounter(Opts{Namespace: "test", Name: "calls_total", LabelNames: []string{"method"}}).With("method", "Sum").Add(2)
+	p.NewGauge(Opts{Namespace: "test", Name: "in_flight"}).Set(3)
+	h := p.NewHistogram(Opts{Namespace: "test", Name: "duration_seconds"}, []float64{1})
+	if _, ok := h.(otel.ContextObserver); !ok {
+		t.Errorf("want histogram with exemplar, got %T", h)
+	}
+	h.Observe(0.5)
+	// 重复注册退化为discard
+	if c := p.NewCounter(Opts{Namespace: "test", Name: "calls_total", LabelNames: []string{"method"}}); c != discard.NewCounter() || p.Err() == nil {
+		t.Errorf("want discard, got %T err:%v", c, p.Err())
+	}
+
+	rec := httptest.NewRecorder()
+	p.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	for _, want := range []string{`test_calls_total{method="Sum"} 2`, "test_in_flight 3", `test_duration_seconds_bucket{le="1"} 1`} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("want %q in:\n%s", want, rec.Body.String())
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	p = NewPrometheus(failingRegistry{stdprometheus.NewRegistry()}, log.NewLogfmtLogger(buf))
+	p.NewGauge(Opts{Name: "leader"}).Set(1)
+	if !strings.Contains(buf.String(), "WARNING") || p.Err() == nil {
+		t.Errorf("want warning, got log:%s err:%v", buf.String(), p.Err())
+	}
+}
+
+func TestStatsd(t *testing.T) {
+	s := NewStatsd(false, "127.0.0.1:8125", time.Second, "addsvc", log.NewNopLogger())
+	s.NewCounter(Opts{Namespace: "example", Name: "calls_total"}).With("method", "Sum").Add(2)
+	s.NewHistogram(Opts{Namespace: "example", Name: "duration_seconds"}, nil).Observe(0.25)
+	buf := &bytes.Buffer{}
+	if _, err := s.writeTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	// 标签被忽略，秒换算为毫秒
+	for _, want := range []string{"example_calls_total:2.000000|c\n", "example_duration_milliseconds:250.000000|ms\n"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("want %q in:\n%s", want, buf.String())
+		}
+	}
+
+	d := NewStatsd(true, "127.0.0.1:8125", time.Second, "addsvc", log.NewNopLogger())
+	d.NewCounter(Opts{Namespace: "example", Name: "calls_total"}).With("method", "Sum").Add(2)
+	buf.Reset()
+	if _, err := d.writeTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	if want := "example_calls_total:2.000000|c|#service:addsvc,method:Sum\n"; buf.String() != want {
+		t.Errorf("got %q want %q", buf.String(), want)
+	}
+}
+
+// 保存最后一次导出的值
+type memExporter struct {
+	export.ExportKind
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+func (e *memExporter) Export(_ context.Context, cps export.CheckpointSet) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return cps.ForEach(e, func(r export.Record) error {
+		enc := label.DefaultEncoder()
+		key := r.Descriptor().Name() + "{" + r.Labels().Encoded(enc) + "}"
+		kind := r.Descriptor().NumberKind()
+		switch agg := r.Aggregation().(type) {
+		case aggregation.Histogram:
+			n, _ := agg.Count()
+			e.values[key+"count"] = float64(n)
+		case aggregation.LastValue:
+			v, _, _ := agg.LastValue()
+			e.values[key] = v.CoerceToFloat64(kind)
+		case aggregation.Sum:
+			v, _ := agg.Sum()
+			e.values[key] = v.CoerceToFloat64(kind)
+		}
+		return nil
+	})
+}
+
+func TestOTLP(t *testing.T) {
+	exp := &memExporter{ExportKind: export.CumulativeExporter, values: map[string]float64{}}
+	buf := &bytes.Buffer{}
+	o := newOTLP(exp, time.Hour, "addsvc", log.NewLogfmtLogger(buf))
+	c := o.NewCounter(Opts{Namespace: "example", Name: "calls_total"})
+	c.With("method", "Sum").Add(1)
+	c.With("method", "Sum").Add(2)
+	g := o.NewGauge(Opts{Namespace: "example", Name: "in_flight"})
+	g.With("method", "Sum").Set(3)
+	g.With("method", "Sum").Add(-1)
+	h := o.NewHistogram(Opts{Namespace: "example", Name: "duration_seconds"}, nil)
+	h.With("method", "Sum").Observe(0.1)
+	h.With("method", "Sum").Observe(0.2)
+	// 同名不同类型的指标创建失败，打印警告
+	if c := o.NewHistogram(Opts{Namespace: "example", Name: "calls_total"}, nil); !strings.Contains(buf.String(), "WARNING") {
+		t.Errorf("want warning, got %T log:%s", c, buf.String())
+	}
+	// Stop时导出最后一次
+	if err := o.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]float64{
+		"example_calls_total{method=Sum}":           3,
+		"example_in_flight{method=Sum}":             2,
+		"example_duration_seconds{method=Sum}count": 2,
+	}
+	for k, v := range want {
+		if exp.values[k] != v {
+			t.Errorf("%s got %v want %v, all:%v", k, exp.values[k], v, exp.values)
+		}
+	}
+}
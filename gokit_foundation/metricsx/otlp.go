@@ -0,0 +1,200 @@
+package metricsx
+
+import (
+	"context"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
+	"go.opentelemetry.io/otel/api/metric"
+	"go.opentelemetry.io/otel/label"
+	export "go.opentelemetry.io/otel/sdk/export/metric"
+	"go.opentelemetry.io/otel/sdk/metric/controller/push"
+	"go.opentelemetry.io/otel/sdk/metric/processor/basic"
+	"go.opentelemetry.io/otel/sdk/metric/selector/simple"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"go.opentelemetry.io/otel/semconv"
+	"gokit_foundation/otel"
+	"strings"
+	"sync"
+	"time"
+)
+
+const instrumentationName = "gokit_foundation/metricsx"
+
+// OTLP 指标通过OpenTelemetry SDK汇总，由push controller定期导出，与链路追踪使用各自的exporter(连接)
+type OTLP struct {
+	cont   *push.Controller
+	meter  metric.Meter
+	logger log.Logger
+	// 退出时关闭，为nil时不需要关闭(测试)
+	shutdown func(ctx context.Context) error
+}
+
+// NewOTLP endpoint的格式与otel.EnvEndpoint相同，连接在后台建立，collector暂时不可用时不影响启动
+// logger为nil时创建指标失败不打印警告
+func NewOTLP(endpoint string, interval time.Duration, serviceName string, logger log.Logger) (*OTLP, error) {
+	exp, err := otel.NewExporter(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	o := newOTLP(exp, interval, serviceName, logger)
+	o.shutdown = exp.Shutdown
+	return o, nil
+}
+
+func newOTLP(exp export.Exporter, interval time.Duration, serviceName string, logger log.Logger) *OTLP {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	cont := push.New(
+		basic.New(simple.NewWithHistogramDistribution(HistogramBuckets), exp),
+		exp,
+		push.WithPeriod(interval),
+		push.WithResource(resource.New(semconv.ServiceNameKey.String(serviceName))),
+	)
+	return &OTLP{cont: cont, meter: cont.MeterProvider().Meter(instrumentationName), logger: logger}
+}
+
+// 创建失败(如同名的指标类型不同)时与Prometheus.Register相同，打印警告
+func (o *OTLP) warn(name string, err error) {
+	o.logger.Log("metricsx", "WARNING", "metric", name, "err", err, "hint", "该指标不会被上报")
+}
+
+func (o *OTLP) NewCounter(opts Opts) metrics.Counter {
+	c, err := o.meter.NewFloat64Counter(opts.FullName(), metric.WithDescription(opts.Help))
+	if err != nil {
+		o.warn(opts.FullName(), err)
+		return discard.NewCounter()
+	}
+	return &otlpCounter{c: c}
+}
+
+func (o *OTLP) NewGauge(opts Opts) metrics.Gauge {
+	values := &gaugeValues{m: map[string]*gaugeValue{}}
+	_, err := o.meter.NewFloat64ValueObserver(opts.FullName(), values.observe, metric.WithDescription(opts.Help))
+	if err != nil {
+		o.warn(opts.FullName(), err)
+		return discard.NewGauge()
+	}
+	return &otlpGauge{values: values}
+}
+
+// NewHistogram bucket由HistogramBuckets统一决定，忽略buckets
+func (o *OTLP) NewHistogram(opts Opts, _ []float64) metrics.Histogram {
+	r, err := o.meter.NewFloat64ValueRecorder(opts.FullName(), metric.WithDescription(opts.Help))
+	if err != nil {
+		o.warn(opts.FullName(), err)
+		return discard.NewHistogram()
+	}
+	return &otlpHistogram{r: r}
+}
+
+// Run 由push controller在后台定期导出，这里只等待ctx结束
+func (o *OTLP) Run(ctx context.Context) error {
+	o.cont.Start()
+	<-ctx.Done()
+	return nil
+}
+
+// Stop 最后导出一次，然后关闭exporter的连接
+func (o *OTLP) Stop() error {
+	// Start是幂等的，没有Run过(如启动失败)时controller也需要先Start才能Stop
+	o.cont.Start()
+	o.cont.Stop()
+	if o.shutdown == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+	defer cancel()
+	return o.shutdown(ctx)
+}
+
+// label的处理与go-kit的其他实现相同：key、value交替，奇数个时最后一个value为unknown
+func otlpLabels(labelValues []string) []label.KeyValue {
+	if len(labelValues)%2 != 0 {
+		labelValues = append(labelValues, "unknown")
+	}
+	labels := make([]label.KeyValue, 0, len(labelValues)/2)
+	for i := 0; i < len(labelValues); i += 2 {
+		labels = append(labels, label.String(labelValues[i], labelValues[i+1]))
+	}
+	return labels
+}
+
+func appendLabelValues(lvs []string, labelValues ...string) []string {
+	return append(lvs[:len(lvs):len(lvs)], labelValues...)
+}
+
+type otlpCounter struct {
+	c   metric.Float64Counter
+	lvs []string
+}
+
+func (c *otlpCounter) With(labelValues ...string) metrics.Counter {
+	return &otlpCounter{c: c.c, lvs: appendLabelValues(c.lvs, labelValues...)}
+}
+
+func (c *otlpCounter) Add(delta float64) {
+	c.c.Add(context.Background(), delta, otlpLabels(c.lvs)...)
+}
+
+type otlpHistogram struct {
+	r   metric.Float64ValueRecorder
+	lvs []string
+}
+
+func (h *otlpHistogram) With(labelValues ...string) metrics.Histogram {
+	return &otlpHistogram{r: h.r, lvs: appendLabelValues(h.lvs, labelValues...)}
+}
+
+func (h *otlpHistogram) Observe(value float64) {
+	h.r.Record(context.Background(), value, otlpLabels(h.lvs)...)
+}
+
+// OpenTelemetry没有同步的gauge，保存每组标签最后的值，导出时由ValueObserver的回调上报
+type gaugeValues struct {
+	mu sync.Mutex
+	m  map[string]*gaugeValue
+}
+
+type gaugeValue struct {
+	labels []label.KeyValue
+	value  float64
+}
+
+func (g *gaugeValues) update(lvs []string, f func(v float64) float64) {
+	key := strings.Join(lvs, "\x00")
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	v, ok := g.m[key]
+	if !ok {
+		v = &gaugeValue{labels: otlpLabels(lvs)}
+		g.m[key] = v
+	}
+	v.value = f(v.value)
+}
+
+func (g *gaugeValues) observe(_ context.Context, result metric.Float64ObserverResult) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, v := range g.m {
+		result.Observe(v.value, v.labels...)
+	}
+}
+
+type otlpGauge struct {
+	values *gaugeValues
+	lvs    []string
+}
+
+func (g *otlpGauge) With(labelValues ...string) metrics.Gauge {
+	return &otlpGauge{values: g.values, lvs: appendLabelValues(g.lvs, labelValues...)}
+}
+
+func (g *otlpGauge) Set(value float64) {
+	g.values.update(g.lvs, func(float64) float64 { return value })
+}
+
+func (g *otlpGauge) Add(delta float64) {
+	g.values.update(g.lvs, func(v float64) float64 { return v + delta })
+}
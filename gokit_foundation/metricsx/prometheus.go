@@ -0,0 +1,110 @@
+package metricsx
+
+import (
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
+	"github.com/go-kit/kit/metrics/prometheus"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"gokit_foundation/otel"
+	"net/http"
+	"sync"
+)
+
+// Registry 指标注册到的registry，一般为prometheus.NewRegistry()
+type Registry interface {
+	stdprometheus.Registerer
+	stdprometheus.Gatherer
+}
+
+type Prometheus struct {
+	reg    Registry
+	logger log.Logger
+
+	mu       sync.Mutex
+	firstErr error
+}
+
+// NewPrometheus reg为nil时使用新的registry，logger为nil时注册失败不打印警告(见Err)
+func NewPrometheus(reg Registry, logger log.Logger) *Prometheus {
+	if reg == nil {
+		reg = stdprometheus.NewRegistry()
+	}
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	return &Prometheus{reg: reg, logger: logger}
+}
+
+// Register 注册其他collector(如go runtime、进程指标)，失败时打印警告并返回false
+func (p *Prometheus) Register(name string, c stdprometheus.Collector) bool {
+	if err := p.reg.Register(c); err != nil {
+		p.logger.Log("metricsx", "WARNING", "metric", name, "err", err, "hint", "该指标不会被上报")
+		p.mu.Lock()
+		if p.firstErr == nil {
+			p.firstErr = err
+		}
+		p.mu.Unlock()
+		return false
+	}
+	return true
+}
+
+// Err 第一个注册失败的err
+func (p *Prometheus) Err() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.firstErr
+}
+
+func (p *Prometheus) NewCounter(o Opts) metrics.Counter {
+	vec := stdprometheus.NewCounterVec(stdprometheus.CounterOpts{
+		Namespace: o.Namespace,
+		Subsystem: o.Subsystem,
+		Name:      o.Name,
+		Help:      o.Help,
+	}, o.LabelNames)
+	if !p.Register(o.Name, vec) {
+		return discard.NewCounter()
+	}
+	return prometheus.NewCounter(vec)
+}
+
+func (p *Prometheus) NewGauge(o Opts) metrics.Gauge {
+	vec := stdprometheus.NewGaugeVec(stdprometheus.GaugeOpts{
+		Namespace: o.Namespace,
+		Subsystem: o.Subsystem,
+		Name:      o.Name,
+		Help:      o.Help,
+	}, o.LabelNames)
+	if !p.Register(o.Name, vec) {
+		return discard.NewGauge()
+	}
+	return prometheus.NewGauge(vec)
+}
+
+// NewHistogram buckets为nil时为prometheus.DefBuckets，ObserveContext时带上exemplar
+func (p *Prometheus) NewHistogram(o Opts, buckets []float64) metrics.Histogram {
+	vec := stdprometheus.NewHistogramVec(stdprometheus.HistogramOpts{
+		Namespace: o.Namespace,
+		Subsystem: o.Subsystem,
+		Name:      o.Name,
+		Help:      o.Help,
+		Buckets:   buckets,
+	}, o.LabelNames)
+	if !p.Register(o.Name, vec) {
+		return discard.NewHistogram()
+	}
+	return otel.NewHistogram(vec)
+}
+
+// Handler /metrics接口，请求的Accept为OpenMetrics时输出exemplar，否则为原来的text格式
+func (p *Prometheus) Handler() http.Handler {
+	return promhttp.HandlerFor(p.reg, promhttp.HandlerOpts{EnableOpenMetrics: true})
+}
+
+// Gatherer 所有指标所在的registry，用于推送到pushgateway(见metricspush)
+func (p *Prometheus) Gatherer() stdprometheus.Gatherer {
+	return p.reg
+}
@@ -0,0 +1,110 @@
+package metricsx
+
+import (
+	"context"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/dogstatsd"
+	"github.com/go-kit/kit/metrics/statsd"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// Statsd statsd/dogstatsd后端，指标先在内存中汇总，每次推送时以UDP发送并清空(见go-kit的Statsd.WriteTo)
+type Statsd struct {
+	plain    *statsd.Statsd
+	dog      *dogstatsd.Dogstatsd
+	addr     string
+	interval time.Duration
+	logger   log.Logger
+}
+
+// NewStatsd dog为true时为DogStatsD，serviceName作为所有指标的service tag(statsd忽略)
+func NewStatsd(dog bool, addr string, interval time.Duration, serviceName string, logger log.Logger) *Statsd {
+	s := &Statsd{addr: addr, interval: interval, logger: logger}
+	if dog {
+		s.dog = dogstatsd.New("", logger, "service", serviceName)
+	} else {
+		s.plain = statsd.New("", logger)
+	}
+	return s
+}
+
+func (s *Statsd) NewCounter(o Opts) metrics.Counter {
+	if s.dog != nil {
+		return s.dog.NewCounter(o.FullName(), 1)
+	}
+	return s.plain.NewCounter(o.FullName(), 1)
+}
+
+func (s *Statsd) NewGauge(o Opts) metrics.Gauge {
+	if s.dog != nil {
+		return s.dog.NewGauge(o.FullName())
+	}
+	return s.plain.NewGauge(o.FullName())
+}
+
+func (s *Statsd) NewHistogram(o Opts, _ []float64) metrics.Histogram {
+	if s.dog != nil {
+		return s.dog.NewHistogram(o.FullName(), 1)
+	}
+	name := o.FullName()
+	if !strings.HasSuffix(name, "_seconds") {
+		return s.plain.NewTiming(name, 1)
+	}
+	return scaledHistogram{next: s.plain.NewTiming(strings.TrimSuffix(name, "_seconds")+"_milliseconds", 1), factor: 1000}
+}
+
+func (s *Statsd) writeTo(w io.Writer) (int64, error) {
+	if s.dog != nil {
+		return s.dog.WriteTo(w)
+	}
+	return s.plain.WriteTo(w)
+}
+
+// Run 推送失败只打印日志，数据已经清空，不会在下次重复发送
+func (s *Statsd) Run(ctx context.Context) error {
+	t := time.NewTicker(s.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+			if err := s.send(); err != nil {
+				s.logger.Log("metricsx", "statsd send failed", "addr", s.addr, "err", err)
+			}
+		}
+	}
+}
+
+func (s *Statsd) Stop() error {
+	return s.send()
+}
+
+// 每行(一个指标)一个UDP包
+func (s *Statsd) send() error {
+	conn, err := net.Dial("udp", s.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = s.writeTo(conn)
+	return err
+}
+
+// statsd的timing单位为毫秒
+type scaledHistogram struct {
+	next   metrics.Histogram
+	factor float64
+}
+
+func (h scaledHistogram) With(labelValues ...string) metrics.Histogram {
+	return scaledHistogram{next: h.next.With(labelValues...), factor: h.factor}
+}
+
+func (h scaledHistogram) Observe(value float64) {
+	h.next.Observe(value * h.factor)
+}
@@ -0,0 +1,275 @@
+package mtls
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"google.golang.org/grpc/credentials"
+)
+
+/*
+grpc的TLS/mTLS，证书文件更新(如cert-manager续期、k8s secret轮换)后自动生效，不需要重启：
+-	Reloader定期检查证书文件的修改时间和大小(见Watch)，变化时重新加载，加载失败时继续使用旧证书
+-	ServerCredentials/ClientCredentials每次握手都使用最新的证书和CA，已建立的连接不受影响
+-	SPIFFEIDs不为空时，握手后检查对端证书的URI SAN(如spiffe://example.org/ns/default/sa/gateway)，不在其中则拒绝连接
+使用轮询而不是fsnotify：k8s secret通过替换符号链接更新，监听文件本身会丢失事件
+*/
+
+// Config 文件均为PEM格式
+type Config struct {
+	// 本端证书，server必须设置；client设置后会向server出示证书(mTLS)
+	CertFile string
+	KeyFile  string
+	// server：校验client证书的CA，设置后要求client出示证书(mTLS)，为空时为单向TLS
+	// client：校验server证书的CA，为空时使用系统CA
+	CAFile string
+	// 允许的对端SPIFFE ID，为空时不检查
+	SPIFFEIDs []string
+	// client：校验server证书时使用的域名，为空时使用拨号地址中的host
+	ServerName string
+}
+
+func (c Config) Validate(server bool) error {
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return errors.New("mtls: cert and key must be set together")
+	}
+	if server && c.CertFile == "" {
+		return errors.New("mtls: cert is required by server")
+	}
+	if server && len(c.SPIFFEIDs) > 0 && c.CAFile == "" {
+		return errors.New("mtls: client ca is required to verify spiffe ids")
+	}
+	for _, id := range c.SPIFFEIDs {
+		if !strings.HasPrefix(id, "spiffe://") {
+			return fmt.Errorf("mtls: invalid spiffe id %q", id)
+		}
+	}
+	return nil
+}
+
+// 用于判断文件是否变化
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+type Reloader struct {
+	conf   Config
+	logger log.Logger
+
+	mu     sync.RWMutex
+	cert   *tls.Certificate
+	pool   *x509.CertPool
+	stamps map[string]fileStamp
+}
+
+// NewReloader 立即加载一次证书，失败时返回err，server为true时按server的要求校验conf
+func NewReloader(conf Config, server bool, logger log.Logger) (*Reloader, error) {
+	if err := conf.Validate(server); err != nil {
+		return nil, err
+	}
+	r := &Reloader{conf: conf, logger: logger}
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload 文件有变化时重新加载，返回是否重新加载了，失败时保留之前的证书
+func (r *Reloader) Reload() (bool, error) {
+	stamps := map[string]fileStamp{}
+	for _, f := range []string{r.conf.CertFile, r.conf.KeyFile, r.conf.CAFile} {
+		if f == "" {
+			continue
+		}
+		fi, err := os.Stat(f)
+		if err != nil {
+			return false, fmt.Errorf("mtls: %v", err)
+		}
+		stamps[f] = fileStamp{fi.ModTime(), fi.Size()}
+	}
+	r.mu.RLock()
+	changed := !sameStamps(r.stamps, stamps)
+	r.mu.RUnlock()
+	if !changed {
+		return false, nil
+	}
+
+	var cert *tls.Certificate
+	if r.conf.CertFile != "" {
+		c, err := tls.LoadX509KeyPair(r.conf.CertFile, r.conf.KeyFile)
+		if err != nil {
+			return false, fmt.Errorf("mtls: load cert: %v", err)
+		}
+		cert = &c
+	}
+	var pool *x509.CertPool
+	if r.conf.CAFile != "" {
+		pem, err := ioutil.ReadFile(r.conf.CAFile)
+		if err != nil {
+			return false, fmt.Errorf("mtls: %v", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return false, fmt.Errorf("mtls: no certificate found in %s", r.conf.CAFile)
+		}
+	}
+	r.mu.Lock()
+	r.cert, r.pool, r.stamps = cert, pool, stamps
+	r.mu.Unlock()
+	return true, nil
+}
+
+func sameStamps(a, b map[string]fileStamp) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || !v.modTime.Equal(w.modTime) || v.size != w.size {
+			return false
+		}
+	}
+	return true
+}
+
+// Watch 每隔interval检查一次证书文件，直到ctx结束，加载失败只打印日志
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			changed, err := r.Reload()
+			if err != nil {
+				r.logger.Log("mtls", "reload failed, keep using the old certificate", "err", err)
+			} else if changed {
+				r.logger.Log("mtls", "certificate reloaded", "cert", r.conf.CertFile)
+			}
+		}
+	}
+}
+
+func (r *Reloader) load() (*tls.Certificate, *x509.CertPool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, r.pool
+}
+
+func (r *Reloader) serverConfig() *tls.Config {
+	cert, pool := r.load()
+	conf := &tls.Config{MinVersion: tls.VersionTLS12, Certificates: []tls.Certificate{*cert}}
+	if pool != nil {
+		conf.ClientCAs = pool
+		conf.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return conf
+}
+
+func (r *Reloader) clientConfig(serverName string) *tls.Config {
+	cert, pool := r.load()
+	conf := &tls.Config{MinVersion: tls.VersionTLS12, RootCAs: pool, ServerName: serverName}
+	if cert != nil {
+		conf.Certificates = []tls.Certificate{*cert}
+	}
+	return conf
+}
+
+// ServerCredentials 用于grpc.Creds
+func (r *Reloader) ServerCredentials() credentials.TransportCredentials {
+	return &reloadingCreds{r: r}
+}
+
+// ClientCredentials 用于grpc.WithTransportCredentials
+func (r *Reloader) ClientCredentials() credentials.TransportCredentials {
+	return &reloadingCreds{r: r, serverName: r.conf.ServerName}
+}
+
+// 每次握手时使用Reloader中最新的证书创建credentials
+type reloadingCreds struct {
+	r          *Reloader
+	serverName string
+}
+
+func (c *reloadingCreds) ClientHandshake(ctx context.Context, authority string, conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	tc, info, err := credentials.NewTLS(c.r.clientConfig(c.serverName)).ClientHandshake(ctx, authority, conn)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = c.verifySPIFFE(info); err != nil {
+		tc.Close()
+		return nil, nil, err
+	}
+	return tc, info, nil
+}
+
+func (c *reloadingCreds) ServerHandshake(conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	tc, info, err := credentials.NewTLS(c.r.serverConfig()).ServerHandshake(conn)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = c.verifySPIFFE(info); err != nil {
+		tc.Close()
+		return nil, nil, err
+	}
+	return tc, info, nil
+}
+
+func (c *reloadingCreds) verifySPIFFE(info credentials.AuthInfo) error {
+	if len(c.r.conf.SPIFFEIDs) == 0 {
+		return nil
+	}
+	tlsInfo, ok := info.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.PeerCertificates) == 0 {
+		return errors.New("mtls: no peer certificate")
+	}
+	id, err := SPIFFEID(tlsInfo.State.PeerCertificates[0])
+	if err != nil {
+		return err
+	}
+	for _, allowed := range c.r.conf.SPIFFEIDs {
+		if id == allowed {
+			return nil
+		}
+	}
+	return fmt.Errorf("mtls: spiffe id %s is not allowed", id)
+}
+
+func (c *reloadingCreds) Info() credentials.ProtocolInfo {
+	return credentials.ProtocolInfo{SecurityProtocol: "tls", SecurityVersion: "1.2", ServerName: c.serverName}
+}
+
+func (c *reloadingCreds) Clone() credentials.TransportCredentials {
+	cp := *c
+	return &cp
+}
+
+func (c *reloadingCreds) OverrideServerName(name string) error {
+	c.serverName = name
+	return nil
+}
+
+// SPIFFEID 返回证书中spiffe://开头的URI SAN，SPIFFE规定一个证书只能有一个
+func SPIFFEID(cert *x509.Certificate) (string, error) {
+	var ids []string
+	for _, u := range cert.URIs {
+		if u.Scheme == "spiffe" {
+			ids = append(ids, u.String())
+		}
+	}
+	if len(ids) != 1 {
+		return "", fmt.Errorf("mtls: want 1 spiffe id in peer certificate, got %d", len(ids))
+	}
+	return ids[0], nil
+}
@@ -0,0 +1,267 @@
+package mtls
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue 签发证书，spiffeID不为空时写入URI SAN，返回证书和私钥的PEM
+func (ca *testCA) issue(t *testing.T, spiffeID string) (certPEM, keyPEM []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if spiffeID != "" {
+		u, _ := url.Parse(spiffeID)
+		tmpl.URIs = []*url.URL{u}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// writeFiles 将证书写入dir/prefix.{crt,key,ca}，返回对应的Config
+func writeFiles(t *testing.T, dir, prefix string, ca *testCA, certPEM, keyPEM []byte) Config {
+	conf := Config{
+		CertFile: filepath.Join(dir, prefix+".crt"),
+		KeyFile:  filepath.Join(dir, prefix+".key"),
+		CAFile:   filepath.Join(dir, prefix+".ca"),
+	}
+	for path, b := range map[string][]byte{conf.CertFile: certPEM, conf.KeyFile: keyPEM, conf.CAFile: ca.pem} {
+		if err := ioutil.WriteFile(path, b, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return conf
+}
+
+func startServer(t *testing.T, r *Reloader) (addr string, stop func()) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer(grpc.Creds(r.ServerCredentials()))
+	grpc_health_v1.RegisterHealthServer(srv, health.NewServer())
+	go srv.Serve(lis)
+	return lis.Addr().String(), srv.Stop
+}
+
+func check(addr string, r *Reloader) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, addr, grpc.WithTransportCredentials(r.ClientCredentials()), grpc.WithBlock())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+	return err
+}
+
+func tempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "mtls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+const (
+	serverID = "spiffe://example.org/addsvc"
+	clientID = "spiffe://example.org/gateway"
+)
+
+func TestMTLS(t *testing.T) {
+	dir, clean := tempDir(t)
+	defer clean()
+	ca := newTestCA(t)
+	logger := log.NewNopLogger()
+
+	crt, key := ca.issue(t, serverID)
+	serverConf := writeFiles(t, dir, "server", ca, crt, key)
+	serverConf.SPIFFEIDs = []string{clientID}
+	sr, err := NewReloader(serverConf, true, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, stop := startServer(t, sr)
+	defer stop()
+
+	crt, key = ca.issue(t, clientID)
+	clientConf := writeFiles(t, dir, "client", ca, crt, key)
+	clientConf.SPIFFEIDs = []string{serverID}
+	cr, err := NewReloader(clientConf, false, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := check(addr, cr); err != nil {
+		t.Fatalf("mtls: %v", err)
+	}
+
+	// client不出示证书
+	noCert, err := NewReloader(Config{CAFile: clientConf.CAFile}, false, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := check(addr, noCert); err == nil {
+		t.Error("client without certificate want err")
+	}
+
+	// client的SPIFFE ID不在server允许的列表中
+	crt, key = ca.issue(t, "spiffe://example.org/other")
+	otherConf := writeFiles(t, dir, "other", ca, crt, key)
+	other, err := NewReloader(otherConf, false, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := check(addr, other); err == nil {
+		t.Error("client with unexpected spiffe id want err")
+	}
+
+	// server的SPIFFE ID不是client期望的
+	clientConf.SPIFFEIDs = []string{"spiffe://example.org/other"}
+	wrongServer, err := NewReloader(clientConf, false, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := check(addr, wrongServer); err == nil {
+		t.Error("server with unexpected spiffe id want err")
+	}
+}
+
+// 证书轮换(换成新CA签发的证书)后，Reload之前新client无法连接，之后可以
+func TestReload(t *testing.T) {
+	dir, clean := tempDir(t)
+	defer clean()
+	logger := log.NewNopLogger()
+	oldCA, newCA := newTestCA(t), newTestCA(t)
+
+	crt, key := oldCA.issue(t, "")
+	sr, err := NewReloader(writeFiles(t, dir, "server", oldCA, crt, key), true, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, stop := startServer(t, sr)
+	defer stop()
+
+	crt, key = newCA.issue(t, "")
+	cr, err := NewReloader(writeFiles(t, dir, "client", newCA, crt, key), false, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := check(addr, cr); err == nil {
+		t.Fatal("before rotation want err")
+	}
+
+	// 修改时间精度可能较低，文件大小也可能不变，这里显式修改mtime
+	crt, key = newCA.issue(t, "")
+	conf := writeFiles(t, dir, "server", newCA, crt, key)
+	future := time.Now().Add(time.Minute)
+	for _, f := range []string{conf.CertFile, conf.KeyFile, conf.CAFile} {
+		if err := os.Chtimes(f, future, future); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if changed, err := sr.Reload(); err != nil || !changed {
+		t.Fatalf("reload got changed:%v err:%v", changed, err)
+	}
+	if err := check(addr, cr); err != nil {
+		t.Fatalf("after rotation: %v", err)
+	}
+	if changed, err := sr.Reload(); err != nil || changed {
+		t.Errorf("reload again got changed:%v err:%v", changed, err)
+	}
+
+	// 写入无效的证书，保留之前的证书
+	if err := ioutil.WriteFile(conf.CertFile, []byte("invalid"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sr.Reload(); err == nil {
+		t.Error("invalid cert want err")
+	}
+	if err := check(addr, cr); err != nil {
+		t.Errorf("after invalid reload: %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for name, c := range map[string]struct {
+		conf   Config
+		server bool
+		ok     bool
+	}{
+		"server":            {Config{CertFile: "a", KeyFile: "b"}, true, true},
+		"server no cert":    {Config{CAFile: "c"}, true, false},
+		"cert without key":  {Config{CertFile: "a"}, false, false},
+		"client ca only":    {Config{CAFile: "c"}, false, true},
+		"spiffe without ca": {Config{CertFile: "a", KeyFile: "b", SPIFFEIDs: []string{clientID}}, true, false},
+		"invalid spiffe id": {Config{CertFile: "a", KeyFile: "b", CAFile: "c", SPIFFEIDs: []string{"example.org/x"}}, true, false},
+		"client spiffe ids": {Config{SPIFFEIDs: []string{serverID}}, false, true},
+	} {
+		if err := c.conf.Validate(c.server); (err == nil) != c.ok {
+			t.Errorf("%s got err:%v", name, err)
+		}
+	}
+}
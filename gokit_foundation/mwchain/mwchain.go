@@ -0,0 +1,272 @@
+package mwchain
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/tracing/opentracing"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"gokit_foundation"
+	"gokit_foundation/auth"
+	"gokit_foundation/authz"
+	"gokit_foundation/chaos"
+	"gokit_foundation/featureflag"
+	"gokit_foundation/i18n"
+	"gokit_foundation/logging"
+	"gokit_foundation/payloadlog"
+	"gokit_foundation/tenant"
+	"strings"
+)
+
+/*
+endpoint中间件的组合，所有示例的endpoint.New都通过Builder安装中间件：
+-	每种中间件属于固定的层(Layer)，Build时按层的顺序封装，With*的调用顺序不影响结果，
+	同一层只能有一个中间件(LayerTracing除外，先添加的在外层)
+-	推荐顺序(从外到内)见Layer的定义，主要考虑：
+	被拒绝的请求也要记录日志、指标和span；断路器只统计endpoint本身的失败(超时算失败)，不统计限流、参数校验的拒绝；
+	缓存命中时不经过限流和断路器；panic在最内层转为err，和其他失败一样被统计
+-	Build前检查不兼容的组合，如故障注入没有panic恢复、ACL没有认证、同一接口同时使用响应缓存和幂等键
+示例：
+	eps := mwchain.New().
+		WithRecovery(logger, panics).
+		WithTracing(otTracer).
+		WithMetrics(func(method string) endpoint.Middleware { return InstrumentingMiddleware(duration.With("method", method)) }).
+		MustBuild(map[string]endpoint.Endpoint{"Sum": MakeSumEndpoint(svc)})
+*/
+
+type Layer int
+
+// 从外到内
+const (
+	LayerI18n        Layer = iota // 按调用方的语言本地化返回的错误描述(见gokit_foundation/i18n)，内层记录的都是原来的描述
+	LayerPayloadLog               // 请求/响应日志，err为分类后的错误
+	LayerErrors                   // err分类(见errs)，transport层据此编码
+	LayerMetrics                  // 耗时指标，被拒绝的请求也统计
+	LayerLogging                  // 每次调用的日志
+	LayerTracing                  // span覆盖认证、限流等，可以有多个(如opentracing、OpenTelemetry、span tags)
+	LayerAuth                     // 认证，写入claims/subject
+	LayerACL                      // 需要认证写入的角色
+	LayerAuthz                    // 按权限授权，需要认证写入的claims
+	LayerTenant                   // 需要认证写入的claims
+	LayerReqLogger                // 请求级别的logger，需要确定后的租户(见gokit_foundation/logging)
+	LayerAudit                    // 审计日志，需要调用方和租户，参数校验失败等被拒绝的调用也记录
+	LayerValidation               // 参数校验
+	LayerFeatureFlag              // 需要subject，在缓存外层确定(缓存key包含开启的flag)
+	LayerCache                    // 响应缓存，命中时不经过限流和断路器
+	LayerIdempotency              // 幂等键，重放时不经过限流和断路器
+	LayerDeadline                 // 默认超时、剩余时间不足时拒绝，被拒绝的请求不占用限流配额
+	LayerResGuard                 // goroutine、fd、内存超过软上限时拒绝(见gokit_foundation/resguard)，同上
+	LayerLoadShed                 // 过载时按优先级拒绝，同上
+	LayerRateLimit
+	LayerMaxInFlight
+	LayerBreaker // 只统计内层(endpoint本身)返回的err
+	LayerTimeout // 超时算作断路器的失败
+	LayerRecovery
+	LayerChaos // 注入的延迟受超时控制，注入的错误被断路器统计，注入的panic被recover
+	numLayers
+)
+
+var layerNames = [numLayers]string{"i18n", "payloadlog", "errors", "metrics", "logging", "tracing", "auth", "acl", "authz", "tenant", "reqlogger",
+	"audit", "validation", "featureflag", "cache", "idempotency", "deadline", "resguard", "loadshed", "ratelimit", "maxinflight", "breaker", "timeout", "recovery", "chaos"}
+
+func (l Layer) String() string {
+	if l < 0 || l >= numLayers {
+		return fmt.Sprintf("Layer(%d)", int(l))
+	}
+	return layerNames[l]
+}
+
+// MiddlewareFunc 为接口method创建中间件，返回nil表示该接口不安装
+type MiddlewareFunc func(method string) endpoint.Middleware
+
+// 所有接口使用同一个中间件
+func Static(mw endpoint.Middleware) MiddlewareFunc {
+	return func(string) endpoint.Middleware { return mw }
+}
+
+// 只有methods中的接口安装
+func Only(f MiddlewareFunc, methods ...string) MiddlewareFunc {
+	return func(method string) endpoint.Middleware {
+		for _, m := range methods {
+			if m == method {
+				return f(method)
+			}
+		}
+		return nil
+	}
+}
+
+type Builder struct {
+	layers [numLayers][]MiddlewareFunc
+	errs   []string
+}
+
+func New() *Builder {
+	return &Builder{}
+}
+
+// Use 在layer中添加中间件，f为nil时忽略
+func (b *Builder) Use(layer Layer, f MiddlewareFunc) *Builder {
+	switch {
+	case layer < 0 || layer >= numLayers:
+		b.errs = append(b.errs, fmt.Sprintf("unknown layer %d", int(layer)))
+	case f == nil:
+	case len(b.layers[layer]) > 0 && layer != LayerTracing:
+		b.errs = append(b.errs, fmt.Sprintf("layer %s used twice", layer))
+	default:
+		b.layers[layer] = append(b.layers[layer], f)
+	}
+	return b
+}
+
+// 以下为gokit_foundation中的中间件
+
+func (b *Builder) WithPayloadLog(r *payloadlog.Recorder, logger log.Logger) *Builder {
+	return b.Use(LayerPayloadLog, func(method string) endpoint.Middleware { return r.Middleware(logger, method) })
+}
+
+// WithI18n c为nil时不安装
+func (b *Builder) WithI18n(c *i18n.Catalog) *Builder {
+	if c == nil {
+		return b
+	}
+	return b.Use(LayerI18n, Static(i18n.Middleware(c)))
+}
+
+// WithTracing 使用go-kit的opentracing.TraceServer，span名为接口名
+func (b *Builder) WithTracing(otTracer stdopentracing.Tracer) *Builder {
+	return b.Use(LayerTracing, func(method string) endpoint.Middleware { return opentracing.TraceServer(otTracer, method) })
+}
+
+func (b *Builder) WithJWT(conf auth.Config) *Builder {
+	return b.Use(LayerAuth, func(method string) endpoint.Middleware { return auth.JWTMiddleware(conf, method) })
+}
+
+func (b *Builder) WithAuthz(conf authz.Config) *Builder {
+	return b.Use(LayerAuthz, func(method string) endpoint.Middleware { return authz.Middleware(conf, method) })
+}
+
+func (b *Builder) WithTenant(conf tenant.Config) *Builder {
+	return b.Use(LayerTenant, func(method string) endpoint.Middleware { return tenant.Middleware(conf, method) })
+}
+
+// WithFeatureFlags subject为nil时使用featureflag.SubjectFromContext
+// WithRequestLogger 业务代码通过logging.FromContext取得带request_id、method等字段的logger
+func (b *Builder) WithRequestLogger(logger log.Logger) *Builder {
+	return b.Use(LayerReqLogger, func(method string) endpoint.Middleware { return logging.Middleware(logger, method) })
+}
+
+func (b *Builder) WithFeatureFlags(s *featureflag.Store, subject func(ctx context.Context) string) *Builder {
+	return b.Use(LayerFeatureFlag, Static(s.Middleware(subject)))
+}
+
+// WithRecovery panics为nil时不计数
+func (b *Builder) WithRecovery(logger log.Logger, panics metrics.Counter) *Builder {
+	return b.Use(LayerRecovery, func(method string) endpoint.Middleware {
+		return gokit_foundation.RecoveryMiddleware(logger, panics, method)
+	})
+}
+
+func (b *Builder) WithChaos(i *chaos.Injector) *Builder {
+	return b.Use(LayerChaos, i.Middleware)
+}
+
+// 以下为各服务自己实现的中间件
+
+func (b *Builder) WithErrors(f MiddlewareFunc) *Builder      { return b.Use(LayerErrors, f) }
+func (b *Builder) WithMetrics(f MiddlewareFunc) *Builder     { return b.Use(LayerMetrics, f) }
+func (b *Builder) WithLogging(f MiddlewareFunc) *Builder     { return b.Use(LayerLogging, f) }
+func (b *Builder) WithAuth(f MiddlewareFunc) *Builder        { return b.Use(LayerAuth, f) }
+func (b *Builder) WithACL(f MiddlewareFunc) *Builder         { return b.Use(LayerACL, f) }
+func (b *Builder) WithValidation(f MiddlewareFunc) *Builder  { return b.Use(LayerValidation, f) }
+func (b *Builder) WithCache(f MiddlewareFunc) *Builder       { return b.Use(LayerCache, f) }
+func (b *Builder) WithIdempotency(f MiddlewareFunc) *Builder { return b.Use(LayerIdempotency, f) }
+func (b *Builder) WithAudit(f MiddlewareFunc) *Builder       { return b.Use(LayerAudit, f) }
+func (b *Builder) WithDeadline(f MiddlewareFunc) *Builder    { return b.Use(LayerDeadline, f) }
+func (b *Builder) WithResGuard(f MiddlewareFunc) *Builder    { return b.Use(LayerResGuard, f) }
+func (b *Builder) WithLoadShed(f MiddlewareFunc) *Builder    { return b.Use(LayerLoadShed, f) }
+func (b *Builder) WithRateLimit(f MiddlewareFunc) *Builder   { return b.Use(LayerRateLimit, f) }
+func (b *Builder) WithMaxInFlight(f MiddlewareFunc) *Builder { return b.Use(LayerMaxInFlight, f) }
+func (b *Builder) WithBreaker(f MiddlewareFunc) *Builder     { return b.Use(LayerBreaker, f) }
+func (b *Builder) WithTimeout(f MiddlewareFunc) *Builder     { return b.Use(LayerTimeout, f) }
+
+func (b *Builder) has(l Layer) bool { return len(b.layers[l]) > 0 }
+
+// Validate 检查不兼容的组合
+func (b *Builder) Validate() error {
+	errs := append([]string(nil), b.errs...)
+	if b.has(LayerChaos) && !b.has(LayerRecovery) {
+		errs = append(errs, "chaos requires recovery, injected panics would crash the process")
+	}
+	if b.has(LayerACL) && !b.has(LayerAuth) {
+		errs = append(errs, "acl requires auth to provide the role")
+	}
+	if b.has(LayerAuthz) && !b.has(LayerAuth) {
+		errs = append(errs, "authz requires auth to provide the claims")
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("mwchain: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Middlewares 返回每个接口的中间件，从内到外排列(与gk生成的endpoint.New相同，依次封装)
+func (b *Builder) Middlewares(methods ...string) (map[string][]endpoint.Middleware, error) {
+	if err := b.Validate(); err != nil {
+		return nil, err
+	}
+	mws := make(map[string][]endpoint.Middleware, len(methods))
+	for _, method := range methods {
+		var (
+			list      []endpoint.Middleware
+			installed [numLayers]bool
+		)
+		// 每个MiddlewareFunc只调用一次，有的会注册状态(如限速器)
+		for l := numLayers - 1; l >= 0; l-- {
+			fs := b.layers[l]
+			for i := len(fs) - 1; i >= 0; i-- {
+				if mw := fs[i](method); mw != nil {
+					list = append(list, mw)
+					installed[l] = true
+				}
+			}
+		}
+		// 响应缓存和幂等键都会重放之前的response，同时使用时行为难以预期
+		if installed[LayerCache] && installed[LayerIdempotency] {
+			return nil, fmt.Errorf("mwchain: %s: cache and idempotency can not be used together", method)
+		}
+		mws[method] = list
+	}
+	return mws, nil
+}
+
+// Build 为每个接口(接口名 => 未封装的endpoint)安装中间件
+func (b *Builder) Build(eps map[string]endpoint.Endpoint) (map[string]endpoint.Endpoint, error) {
+	methods := make([]string, 0, len(eps))
+	for method := range eps {
+		methods = append(methods, method)
+	}
+	mws, err := b.Middlewares(methods...)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]endpoint.Endpoint, len(eps))
+	for method, ep := range eps {
+		for _, mw := range mws[method] {
+			ep = mw(ep)
+		}
+		out[method] = ep
+	}
+	return out, nil
+}
+
+// MustBuild 与Build相同，组合不兼容时panic，用于启动时固定的中间件配置
+func (b *Builder) MustBuild(eps map[string]endpoint.Endpoint) map[string]endpoint.Endpoint {
+	out, err := b.Build(eps)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
@@ -0,0 +1,93 @@
+package mwchain
+
+import (
+	"context"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	"gokit_foundation/authz"
+	"gokit_foundation/chaos"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// 调用时记录name，用于检查封装的顺序
+func record(calls *[]string, name string) MiddlewareFunc {
+	return func(method string) endpoint.Middleware {
+		return func(next endpoint.Endpoint) endpoint.Endpoint {
+			return func(ctx context.Context, request interface{}) (interface{}, error) {
+				*calls = append(*calls, name)
+				return next(ctx, request)
+			}
+		}
+	}
+}
+
+func nop(context.Context, interface{}) (interface{}, error) { return "ok", nil }
+
+// With*的调用顺序不影响封装顺序
+func TestOrder(t *testing.T) {
+	var calls []string
+	eps := New().
+		WithBreaker(record(&calls, "breaker")).
+		WithRateLimit(record(&calls, "ratelimit")).
+		WithDeadline(record(&calls, "deadline")).
+		WithLoadShed(record(&calls, "loadshed")).
+		WithResGuard(record(&calls, "resguard")).
+		Use(LayerTracing, record(&calls, "otel")).
+		WithMetrics(record(&calls, "metrics")).
+		WithTimeout(record(&calls, "timeout")).
+		Use(LayerTracing, record(&calls, "opentracing")).
+		WithErrors(record(&calls, "errors")).
+		WithRecovery(log.NewNopLogger(), nil).
+		WithValidation(record(&calls, "validation")).
+		Use(LayerI18n, record(&calls, "i18n")).
+		MustBuild(map[string]endpoint.Endpoint{"Sum": nop})
+	if _, err := eps["Sum"](context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"i18n", "errors", "metrics", "otel", "opentracing", "validation", "deadline", "resguard", "loadshed", "ratelimit", "breaker", "timeout"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("got calls:%v", calls)
+	}
+}
+
+func TestOnly(t *testing.T) {
+	var calls []string
+	mws, err := New().WithIdempotency(Only(record(&calls, "idempotency"), "CreateUser")).Middlewares("CreateUser", "GetUser")
+	if err != nil || len(mws["CreateUser"]) != 1 || len(mws["GetUser"]) != 0 {
+		t.Errorf("got mws:%v err:%v", mws, err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	f := func(string) endpoint.Middleware {
+		return func(next endpoint.Endpoint) endpoint.Endpoint { return next }
+	}
+	for name, c := range map[string]struct {
+		b    *Builder
+		want string
+	}{
+		"ok":                     {New().WithChaos(chaos.NewInjector()).WithRecovery(log.NewNopLogger(), nil).WithACL(f).WithAuth(f), ""},
+		"chaos without recovery": {New().WithChaos(chaos.NewInjector()), "chaos requires recovery"},
+		"acl without auth":       {New().WithACL(f), "acl requires auth"},
+		"authz without auth":     {New().WithAuthz(authz.Config{Policy: authz.Claims()}), "authz requires auth"},
+		"used twice":             {New().WithRateLimit(f).WithRateLimit(f), "layer ratelimit used twice"},
+		"unknown layer":          {New().Use(numLayers, f), "unknown layer"},
+		"cache and idempotency":  {New().WithCache(f).WithIdempotency(Only(f, "Sum")), "Sum: cache and idempotency"},
+	} {
+		_, err := c.b.Build(map[string]endpoint.Endpoint{"Sum": nop, "Concat": nop})
+		if c.want == "" && err != nil || c.want != "" && (err == nil || !strings.Contains(err.Error(), c.want)) {
+			t.Errorf("%s: got err:%v", name, err)
+		}
+	}
+}
+
+func TestMustBuildPanic(t *testing.T) {
+	defer func() {
+		if p := recover(); p == nil {
+			t.Error("want panic")
+		}
+	}()
+	New().WithChaos(chaos.NewInjector()).MustBuild(map[string]endpoint.Endpoint{"Sum": nop})
+}
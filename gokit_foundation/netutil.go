@@ -0,0 +1,136 @@
+package gokit_foundation
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+)
+
+/*
+自动探测注册到consul的advertise地址，优先级从高到低：
+	1. 显式指定的地址(如 --advertise 参数)
+	2. 环境变量 ADVERTISE_ADDR
+	3. 指定网卡(preferIface)上的IPv4地址
+	4. 其他已启用的非回环网卡上的IPv4地址，私有地址(RFC1918)优先
+	5. 都没有时使用127.0.0.1，仅适用于consul和服务在同一台机器上
+*/
+
+const AdvertiseAddrEnv = "ADVERTISE_ADDR"
+
+var ErrNoAdvertiseAddr = errors.New("no usable advertise address found")
+
+// 网卡信息，与系统解耦方便测试
+type netInterface struct {
+	name  string
+	flags net.Flags
+	addrs []net.Addr
+}
+
+var listInterfaces = func() ([]netInterface, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	var ret []netInterface
+	for _, i := range ifaces {
+		addrs, err := i.Addrs()
+		if err != nil {
+			// 单个网卡读取失败不影响其他网卡
+			continue
+		}
+		ret = append(ret, netInterface{name: i.Name, flags: i.Flags, addrs: addrs})
+	}
+	return ret, nil
+}
+
+// AdvertiseAddr 按上面的优先级返回advertise地址，addr为显式指定的地址，preferIface为优先使用的网卡名(可为空)
+// 指定的网卡不存在或没有可用地址时返回错误，而不是悄悄地使用其他网卡
+func AdvertiseAddr(addr, preferIface string) (string, error) {
+	if addr != "" {
+		return addr, nil
+	}
+	if addr = os.Getenv(AdvertiseAddrEnv); addr != "" {
+		return addr, nil
+	}
+	ifaces, err := listInterfaces()
+	if err != nil {
+		return "", err
+	}
+	ip, err := detectIP(ifaces, preferIface)
+	if err == ErrNoAdvertiseAddr && preferIface == "" {
+		return "127.0.0.1", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return ip.String(), nil
+}
+
+func detectIP(ifaces []netInterface, preferIface string) (net.IP, error) {
+	if preferIface != "" {
+		for _, i := range ifaces {
+			if i.name == preferIface {
+				if ip := firstIPv4(i, false); ip != nil {
+					return ip, nil
+				}
+				return nil, fmt.Errorf("interface %s has no usable IPv4 address", preferIface)
+			}
+		}
+		return nil, fmt.Errorf("interface %s not found", preferIface)
+	}
+	var public net.IP
+	for _, i := range ifaces {
+		if i.flags&net.FlagUp == 0 || i.flags&net.FlagLoopback != 0 {
+			continue
+		}
+		if ip := firstIPv4(i, true); ip != nil {
+			return ip, nil
+		}
+		if public == nil {
+			public = firstIPv4(i, false)
+		}
+	}
+	if public != nil {
+		return public, nil
+	}
+	return nil, ErrNoAdvertiseAddr
+}
+
+// 返回网卡上第一个可用的IPv4地址，privateOnly为true时只返回私有地址
+func firstIPv4(i netInterface, privateOnly bool) net.IP {
+	for _, a := range i.addrs {
+		var ip net.IP
+		switch v := a.(type) {
+		case *net.IPNet:
+			ip = v.IP
+		case *net.IPAddr:
+			ip = v.IP
+		}
+		ip = ip.To4()
+		if ip == nil || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() {
+			continue
+		}
+		if privateOnly && !isRFC1918(ip) {
+			continue
+		}
+		return ip
+	}
+	return nil
+}
+
+var rfc1918Nets = []*net.IPNet{
+	{IP: net.IPv4(10, 0, 0, 0).To4(), Mask: net.CIDRMask(8, 32)},
+	{IP: net.IPv4(172, 16, 0, 0).To4(), Mask: net.CIDRMask(12, 32)},
+	{IP: net.IPv4(192, 168, 0, 0).To4(), Mask: net.CIDRMask(16, 32)},
+}
+
+// net.IP.IsPrivate在go1.17才加入
+func isRFC1918(ip net.IP) bool {
+	for _, n := range rfc1918Nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+package gokit_foundation
+
+import (
+	"net"
+	"os"
+	"testing"
+)
+
+func ipNet(s string) net.Addr {
+	ip, n, _ := net.ParseCIDR(s)
+	n.IP = ip
+	return n
+}
+
+func TestDetectIP(t *testing.T) {
+	up := net.FlagUp
+	lo := netInterface{name: "lo", flags: up | net.FlagLoopback, addrs: []net.Addr{ipNet("127.0.0.1/8")}}
+	docker := netInterface{name: "docker0", flags: up, addrs: []net.Addr{ipNet("172.17.0.1/16")}}
+	eth0 := netInterface{name: "eth0", flags: up, addrs: []net.Addr{ipNet("fe80::1/64"), ipNet("169.254.1.1/16"), ipNet("8.8.8.8/24")}}
+	eth1 := netInterface{name: "eth1", flags: up, addrs: []net.Addr{ipNet("192.168.1.10/24")}}
+	down := netInterface{name: "eth2", addrs: []net.Addr{ipNet("10.0.0.2/8")}}
+
+	test := []struct {
+		name    string
+		ifaces  []netInterface
+		prefer  string
+		want    string
+		wantErr bool
+	}{
+		{name: "[private first]", ifaces: []netInterface{lo, eth0, eth1}, want: "192.168.1.10"},
+		{name: "[skip down]", ifaces: []netInterface{lo, down, eth0}, want: "8.8.8.8"},
+		{name: "[prefer iface]", ifaces: []netInterface{lo, eth1, docker}, prefer: "docker0", want: "172.17.0.1"},
+		{name: "[prefer public iface]", ifaces: []netInterface{eth1, eth0}, prefer: "eth0", want: "8.8.8.8"},
+		{name: "[prefer not found]", ifaces: []netInterface{eth1}, prefer: "eth9", wantErr: true},
+		{name: "[prefer no addr]", ifaces: []netInterface{lo}, prefer: "lo", wantErr: true},
+		{name: "[only loopback]", ifaces: []netInterface{lo}, wantErr: true},
+	}
+	for _, tt := range test {
+		ip, err := detectIP(tt.ifaces, tt.prefer)
+		if (err != nil) != tt.wantErr || (err == nil && ip.String() != tt.want) {
+			t.Errorf("name:%s got ip:%v err:%v want:%s", tt.name, ip, err, tt.want)
+		}
+	}
+}
+
+func TestAdvertiseAddr(t *testing.T) {
+	old := listInterfaces
+	defer func() { listInterfaces = old }()
+	listInterfaces = func() ([]netInterface, error) {
+		return []netInterface{{name: "eth0", flags: net.FlagUp, addrs: []net.Addr{ipNet("10.1.2.3/8")}}}, nil
+	}
+
+	os.Setenv(AdvertiseAddrEnv, "")
+	defer os.Unsetenv(AdvertiseAddrEnv)
+	// 显式指定 > 环境变量 > 自动探测
+	if addr, err := AdvertiseAddr("", ""); err != nil || addr != "10.1.2.3" {
+		t.Errorf("detect got:%s err:%v", addr, err)
+	}
+	os.Setenv(AdvertiseAddrEnv, "svc.local")
+	if addr, err := AdvertiseAddr("", ""); err != nil || addr != "svc.local" {
+		t.Errorf("env got:%s err:%v", addr, err)
+	}
+	if addr, err := AdvertiseAddr("1.2.3.4", ""); err != nil || addr != "1.2.3.4" {
+		t.Errorf("explicit got:%s err:%v", addr, err)
+	}
+
+	// 没有可用网卡时退回到127.0.0.1，但指定的网卡不可用时报错
+	os.Unsetenv(AdvertiseAddrEnv)
+	listInterfaces = func() ([]netInterface, error) { return nil, nil }
+	if addr, err := AdvertiseAddr("", ""); err != nil || addr != "127.0.0.1" {
+		t.Errorf("fallback got:%s err:%v", addr, err)
+	}
+	if _, err := AdvertiseAddr("", "eth0"); err == nil {
+		t.Error("want err for missing preferred interface")
+	}
+}
@@ -0,0 +1,445 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"html/template"
+	"net/http"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+根据请求/响应的struct生成OpenAPI 3.0文档，不需要额外的注解：
+-	字段名取json tag(规则与encoding/json相同：未导出的字段和"-"跳过，匿名嵌入的struct展开)，doc tag为字段的说明
+-	validate tag(go-playground/validator，与endpoint的参数校验相同)转换为约束：required => required，
+	min/max/len => 数值的minimum/maximum、字符串的minLength/maxLength、数组的minItems/maxItems，oneof => enum，
+	其他规则(如required_without)写入description
+-	具名的struct放在components/schemas中引用，protobuf的enum列出所有的值
+SwaggerUIHandler提供Swagger UI页面，静态文件来自CDN(go 1.12不能使用embed)
+*/
+
+// Operation 一个HTTP接口
+type Operation struct {
+	Method   string // 为空时为POST
+	Path     string
+	Summary  string
+	Request  interface{} // 请求body的类型(如SumRequest{})，为nil时没有body
+	Response interface{} // 200时响应body的类型
+}
+
+type Doc struct {
+	title, version string
+	servers        []string
+	errResponse    interface{}
+	ops            []Operation
+}
+
+func New(title, version string) *Doc {
+	return &Doc{title: title, version: version}
+}
+
+// Add 按添加的顺序输出
+func (d *Doc) Add(ops ...Operation) *Doc {
+	d.ops = append(d.ops, ops...)
+	return d
+}
+
+// ErrorResponse 非200时响应body的类型(如errs.HTTPBody{})，所有接口相同
+func (d *Doc) ErrorResponse(v interface{}) *Doc {
+	d.errResponse = v
+	return d
+}
+
+// WithServers 返回servers为urls的副本，为空时相对于文档所在的地址
+func (d *Doc) WithServers(urls ...string) *Doc {
+	c := *d
+	c.servers = urls
+	return &c
+}
+
+type Spec struct {
+	OpenAPI    string                               `json:"openapi"`
+	Info       Info                                 `json:"info"`
+	Servers    []Server                             `json:"servers,omitempty"`
+	Paths      map[string]map[string]*SpecOperation `json:"paths"`
+	Components Components                           `json:"components"`
+}
+
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type Server struct {
+	URL string `json:"url"`
+}
+
+// SpecOperation 文档中的operation对象
+type SpecOperation struct {
+	Summary     string               `json:"summary,omitempty"`
+	OperationID string               `json:"operationId"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+type RequestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Components struct {
+	Schemas map[string]*Schema `json:"schemas,omitempty"`
+}
+
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+}
+
+const jsonContentType = "application/json"
+
+func jsonContent(s *Schema) map[string]*MediaType {
+	return map[string]*MediaType{jsonContentType: {Schema: s}}
+}
+
+// Spec 每次调用重新生成
+func (d *Doc) Spec() *Spec {
+	g := &generator{schemas: map[string]*Schema{}, names: map[reflect.Type]string{}}
+	spec := &Spec{
+		OpenAPI: "3.0.3",
+		Info:    Info{Title: d.title, Version: d.version},
+		Paths:   map[string]map[string]*SpecOperation{},
+	}
+	for _, u := range d.servers {
+		spec.Servers = append(spec.Servers, Server{URL: u})
+	}
+	var errSchema *Schema
+	if d.errResponse != nil {
+		errSchema = g.schemaOf(reflect.TypeOf(d.errResponse))
+	}
+	for _, op := range d.ops {
+		method := strings.ToLower(op.Method)
+		if method == "" {
+			method = "post"
+		}
+		o := &SpecOperation{
+			Summary:     op.Summary,
+			OperationID: operationID(method, op.Path),
+			Responses:   map[string]*Response{"200": {Description: "OK"}},
+		}
+		if op.Request != nil {
+			o.RequestBody = &RequestBody{Required: true, Content: jsonContent(g.schemaOf(reflect.TypeOf(op.Request)))}
+		}
+		if op.Response != nil {
+			o.Responses["200"].Content = jsonContent(g.schemaOf(reflect.TypeOf(op.Response)))
+		}
+		if errSchema != nil {
+			o.Responses["default"] = &Response{Description: "error", Content: jsonContent(errSchema)}
+		}
+		if spec.Paths[op.Path] == nil {
+			spec.Paths[op.Path] = map[string]*SpecOperation{}
+		}
+		spec.Paths[op.Path][method] = o
+	}
+	if len(g.schemas) > 0 {
+		spec.Components.Schemas = g.schemas
+	}
+	return spec
+}
+
+// 如post /batch_sum => postBatchSum
+func operationID(method, p string) string {
+	id := method
+	for _, part := range strings.FieldsFunc(p, func(r rune) bool { return r == '/' || r == '_' || r == '-' || r == '{' || r == '}' }) {
+		id += strings.ToUpper(part[:1]) + part[1:]
+	}
+	return id
+}
+
+// Handler 返回/openapi.json
+func (d *Doc) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(d.Spec())
+	})
+}
+
+var swaggerUITmpl = template.Must(template.New("swagger").Parse(`<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <title>{{.Title}}</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@3/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="https://unpkg.com/swagger-ui-dist@3/swagger-ui-bundle.js"></script>
+<script>
+  window.ui = SwaggerUIBundle({url: "{{.SpecURL}}", dom_id: "#swagger-ui"});
+</script>
+</body>
+</html>
+`))
+
+// SwaggerUIHandler specURL为/openapi.json的地址，可以是相对路径
+func SwaggerUIHandler(title, specURL string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_ = swaggerUITmpl.Execute(w, struct{ Title, SpecURL string }{title, specURL})
+	})
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+type generator struct {
+	schemas map[string]*Schema
+	names   map[reflect.Type]string
+}
+
+func (g *generator) schemaOf(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if s := enumSchema(t); s != nil {
+		return s
+	}
+	if t == timeType {
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Int8, reflect.Int16, reflect.Int32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Uint, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64", Minimum: float(0)}
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32", Minimum: float(0)}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"} // encoding/json编码为base64
+		}
+		return &Schema{Type: "array", Items: g.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + g.register(t)}
+	}
+	return &Schema{} // interface{}等，任意类型
+}
+
+// 具名的struct只生成一次，不同pkg的同名struct带上pkg名
+func (g *generator) register(t reflect.Type) string {
+	if name, ok := g.names[t]; ok {
+		return name
+	}
+	name := t.Name()
+	if _, ok := g.schemas[name]; ok {
+		name = path.Base(t.PkgPath()) + "." + name
+	}
+	g.names[t] = name
+	g.schemas[name] = &Schema{} // 先占位，自引用的struct(如树)不会无限递归
+	*g.schemas[name] = *g.structSchema(t)
+	return name
+}
+
+func (g *generator) structSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	g.addFields(s, t)
+	sort.Strings(s.Required)
+	return s
+}
+
+func (g *generator) addFields(s *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if j := strings.Index(tag, ","); j >= 0 {
+			name, opts = tag[:j], tag[j+1:]
+		}
+		ft := f.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			g.addFields(s, ft)
+			continue
+		}
+		if f.PkgPath != "" { // 未导出
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fs := g.schemaOf(f.Type)
+		if strings.Contains(","+opts+",", ",string,") && (fs.Type == "integer" || fs.Type == "number" || fs.Type == "boolean") {
+			fs = &Schema{Type: "string", Format: fs.Type}
+		}
+		required := applyValidate(fs, ft.Kind(), f.Tag.Get("validate"))
+		if doc := f.Tag.Get("doc"); doc != "" {
+			fs = describe(fs, doc)
+		}
+		if required {
+			s.Required = append(s.Required, name)
+		}
+		s.Properties[name] = fs
+	}
+}
+
+// OpenAPI 3.0中$ref旁的属性会被忽略，只对非引用设置description
+func describe(s *Schema, doc string) *Schema {
+	if s.Ref != "" {
+		return s
+	}
+	if s.Description != "" {
+		doc += "; " + s.Description
+	}
+	s.Description = doc
+	return s
+}
+
+// 把validate tag转换为约束，返回是否必填
+func applyValidate(s *Schema, kind reflect.Kind, tag string) bool {
+	if tag == "" || s.Ref != "" {
+		return strings.Contains(","+tag+",", ",required,")
+	}
+	var (
+		required bool
+		others   []string
+	)
+	for _, rule := range strings.Split(tag, ",") {
+		if rule == "dive" { // 之后的规则作用于数组的元素
+			break
+		}
+		name, param := rule, ""
+		if i := strings.Index(rule, "="); i >= 0 {
+			name, param = rule[:i], rule[i+1:]
+		}
+		switch name {
+		case "required":
+			required = true
+		case "omitempty", "":
+		case "min", "gte", "max", "lte", "len":
+			if !applyBound(s, kind, name, param) {
+				others = append(others, rule)
+			}
+		case "oneof":
+			for _, v := range strings.Fields(param) {
+				if n, err := strconv.ParseFloat(v, 64); err == nil && (s.Type == "integer" || s.Type == "number") {
+					s.Enum = append(s.Enum, n)
+				} else {
+					s.Enum = append(s.Enum, v)
+				}
+			}
+		default:
+			others = append(others, rule)
+		}
+	}
+	if len(others) > 0 {
+		s.Description = "validate: " + strings.Join(others, ",")
+	}
+	return required
+}
+
+func applyBound(s *Schema, kind reflect.Kind, name, param string) bool {
+	n, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return false
+	}
+	lower, upper := name == "min" || name == "gte" || name == "len", name == "max" || name == "lte" || name == "len"
+	switch kind {
+	case reflect.String:
+		if lower {
+			s.MinLength = intp(int(n))
+		}
+		if upper {
+			s.MaxLength = intp(int(n))
+		}
+	case reflect.Slice, reflect.Array, reflect.Map:
+		if s.Type != "array" {
+			return false
+		}
+		if lower {
+			s.MinItems = intp(int(n))
+		}
+		if upper {
+			s.MaxItems = intp(int(n))
+		}
+	default:
+		if s.Type != "integer" && s.Type != "number" {
+			return false
+		}
+		if lower {
+			s.Minimum = float(n)
+		}
+		if upper {
+			s.Maximum = float(n)
+		}
+	}
+	return true
+}
+
+// protobuf生成的enum类型，如resultcode.RESULT_CODE
+func enumSchema(t reflect.Type) *Schema {
+	e, ok := reflect.Zero(t).Interface().(protoreflect.Enum)
+	if !ok {
+		return nil
+	}
+	s := &Schema{Type: "integer", Format: "int32"}
+	values := e.Descriptor().Values()
+	names := make([]string, 0, values.Len())
+	for i := 0; i < values.Len(); i++ {
+		v := values.Get(i)
+		s.Enum = append(s.Enum, int32(v.Number()))
+		names = append(names, fmt.Sprintf("%d: %s", v.Number(), v.Name()))
+	}
+	s.Description = strings.Join(names, ", ")
+	return s
+}
+
+func float(f float64) *float64 { return &f }
+
+func intp(n int) *int { return &n }
@@ -0,0 +1,115 @@
+package openapi
+
+import (
+	"encoding/json"
+	"google.golang.org/protobuf/types/known/structpb"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type item struct {
+	A int `json:"a" validate:"min=-10,max=10" doc:"加数"`
+	B int `json:"b"`
+}
+
+type batch struct {
+	Items   []*item            `json:"items" validate:"required,min=1,max=100"`
+	Name    string             `json:"name,omitempty" validate:"required_without=Items,max=10"`
+	Kind    string             `json:"kind" validate:"oneof=a b"`
+	Data    []byte             `json:"data"`
+	At      time.Time          `json:"at"`
+	Labels  map[string]string  `json:"labels"`
+	Null    structpb.NullValue `json:"null"`
+	Skipped string             `json:"-"`
+	hidden  string
+	Node    *node `json:"node"`
+}
+
+// 自引用
+type node struct {
+	Next *node `json:"next"`
+	meta
+}
+
+type meta struct {
+	ID uint `json:"id,string"`
+}
+
+func TestSpec(t *testing.T) {
+	spec := New("test", "v1").
+		Add(Operation{Path: "/batch_sum", Summary: "sum", Request: batch{}, Response: &item{}}).
+		Add(Operation{Method: http.MethodGet, Path: "/ping"}).
+		ErrorResponse(struct {
+			Error string `json:"error"`
+		}{}).
+		WithServers("http://localhost:8080").Spec()
+
+	op := spec.Paths["/batch_sum"]["post"]
+	if op == nil || op.OperationID != "postBatchSum" || op.RequestBody.Content["application/json"].Schema.Ref != "#/components/schemas/batch" ||
+		op.Responses["200"].Content["application/json"].Schema.Ref != "#/components/schemas/item" || op.Responses["default"] == nil {
+		b, _ := json.Marshal(op)
+		t.Fatalf("got op:%s", b)
+	}
+	if op := spec.Paths["/ping"]["get"]; op == nil || op.RequestBody != nil || op.Responses["200"].Content != nil {
+		t.Errorf("got op:%+v", op)
+	}
+	if len(spec.Servers) != 1 || spec.Servers[0].URL != "http://localhost:8080" {
+		t.Errorf("got servers:%v", spec.Servers)
+	}
+
+	schemas := spec.Components.Schemas
+	a := schemas["item"].Properties["a"]
+	if a.Type != "integer" || *a.Minimum != -10 || *a.Maximum != 10 || a.Description != "加数" {
+		t.Errorf("got a:%+v", a)
+	}
+	b := schemas["batch"]
+	if !reflect.DeepEqual(b.Required, []string{"items"}) {
+		t.Errorf("got required:%v", b.Required)
+	}
+	p := b.Properties
+	if s := p["items"]; s.Type != "array" || *s.MinItems != 1 || *s.MaxItems != 100 || s.Items.Ref != "#/components/schemas/item" {
+		t.Errorf("got items:%+v", s)
+	}
+	if s := p["name"]; s.Type != "string" || *s.MaxLength != 10 || s.Description != "validate: required_without=Items" {
+		t.Errorf("got name:%+v", s)
+	}
+	if s := p["kind"]; !reflect.DeepEqual(s.Enum, []interface{}{"a", "b"}) {
+		t.Errorf("got kind:%+v", s)
+	}
+	if p["data"].Format != "byte" || p["at"].Format != "date-time" || p["labels"].AdditionalProperties.Type != "string" {
+		t.Errorf("got data:%+v at:%+v labels:%+v", p["data"], p["at"], p["labels"])
+	}
+	if s := p["null"]; s.Type != "integer" || !strings.Contains(s.Description, "0: NULL_VALUE") || len(s.Enum) != 1 {
+		t.Errorf("got null:%+v", s)
+	}
+	for _, name := range []string{"Skipped", "-", "hidden"} {
+		if _, ok := p[name]; ok {
+			t.Errorf("%s should be skipped", name)
+		}
+	}
+	// 嵌入的struct展开，",string"编码为字符串
+	n := schemas["node"]
+	if n.Properties["next"].Ref != "#/components/schemas/node" || n.Properties["id"].Type != "string" {
+		t.Errorf("got node:%+v", n)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	doc := New("test", "v1").Add(Operation{Path: "/sum", Request: item{}, Response: item{}})
+	rec := httptest.NewRecorder()
+	doc.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	var spec map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &spec); err != nil || spec["openapi"] != "3.0.3" {
+		t.Fatalf("got err:%v body:%s", err, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	SwaggerUIHandler("test", "/openapi.json").ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/swagger/", nil))
+	if body := rec.Body.String(); !strings.Contains(body, `url: "\/openapi.json"`) || !strings.Contains(body, "<title>test</title>") {
+		t.Errorf("got body:%s", body)
+	}
+}
@@ -0,0 +1,37 @@
+package otel
+
+import (
+	"context"
+	"github.com/go-kit/kit/endpoint"
+	"go.opentelemetry.io/otel/api/trace"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// TraceServer 在server端的endpoint外创建SpanKindServer的span，
+// 需在transport层安装GRPCToContext或HTTPToContext，span才能成为上游span的子span
+func TraceServer(tracer trace.Tracer, operationName string) endpoint.Middleware {
+	return traceEndpoint(tracer, operationName, trace.SpanKindServer)
+}
+
+// TraceClient 在client端的endpoint外创建SpanKindClient的span，
+// 需在transport层安装ContextToGRPC或ContextToHTTP，才能把span传递给下游
+func TraceClient(tracer trace.Tracer, operationName string) endpoint.Middleware {
+	return traceEndpoint(tracer, operationName, trace.SpanKindClient)
+}
+
+func traceEndpoint(tracer trace.Tracer, operationName string, kind trace.SpanKind) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+			ctx, span := tracer.Start(ctx, operationName, trace.WithSpanKind(kind))
+			captureSpan(ctx, span)
+			defer func() {
+				if err != nil {
+					span.RecordError(ctx, err)
+					span.SetStatus(codes.Error, err.Error())
+				}
+				span.End()
+			}()
+			return next(ctx, request)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package otel
+
+import (
+	"context"
+	"github.com/go-kit/kit/metrics"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/api/trace"
+	"sync"
+)
+
+/*
+prometheus exemplar：观测耗时时将当前trace的id作为exemplar(trace_id)附在所在的bucket上，
+grafana中可以从慢的bucket直接跳转到对应的trace
+-	Histogram：go-kit的metrics.Histogram，ObserveContext时带上exemplar，Observe与kitprometheus.Histogram相同
+-	ObserveContext：指标中间件使用，histogram不支持exemplar时(如discard、summary)等同于Observe
+-	CaptureSpan：指标中间件一般在tracing中间件外层，观测时ctx中还没有server span，
+	在ctx中放入一个容器，内层TraceServer/TraceClient创建的第一个span写入其中
+只有采样的trace才会附加exemplar(未采样的trace在后端查不到)；exemplar只在OpenMetrics格式中输出，
+/metrics需要开启promhttp.HandlerOpts.EnableOpenMetrics，prometheus需要开启--enable-feature=exemplar-storage
+*/
+
+const ExemplarTraceIDLabel = "trace_id"
+
+// Histogram labels的处理与kitprometheus.Histogram相同
+type Histogram struct {
+	hv  *stdprometheus.HistogramVec
+	lvs []string
+}
+
+func NewHistogram(hv *stdprometheus.HistogramVec) *Histogram {
+	return &Histogram{hv: hv}
+}
+
+func (h *Histogram) With(labelValues ...string) metrics.Histogram {
+	if len(labelValues)%2 != 0 {
+		labelValues = append(labelValues, "unknown")
+	}
+	lvs := make([]string, 0, len(h.lvs)+len(labelValues))
+	return &Histogram{hv: h.hv, lvs: append(append(lvs, h.lvs...), labelValues...)}
+}
+
+func (h *Histogram) Observe(value float64) {
+	h.hv.With(makeLabels(h.lvs...)).Observe(value)
+}
+
+func (h *Histogram) ObserveContext(ctx context.Context, value float64) {
+	o := h.hv.With(makeLabels(h.lvs...))
+	if id, ok := SampledTraceID(ctx); ok {
+		if eo, ok := o.(stdprometheus.ExemplarObserver); ok {
+			eo.ObserveWithExemplar(value, stdprometheus.Labels{ExemplarTraceIDLabel: id})
+			return
+		}
+	}
+	o.Observe(value)
+}
+
+func makeLabels(labelValues ...string) stdprometheus.Labels {
+	labels := stdprometheus.Labels{}
+	for i := 0; i < len(labelValues); i += 2 {
+		labels[labelValues[i]] = labelValues[i+1]
+	}
+	return labels
+}
+
+// ContextObserver 能从ctx中提取exemplar的histogram
+type ContextObserver interface {
+	ObserveContext(ctx context.Context, value float64)
+}
+
+// ObserveContext h实现了ContextObserver时传入ctx，否则调用h.Observe
+func ObserveContext(ctx context.Context, h metrics.Histogram, value float64) {
+	if co, ok := h.(ContextObserver); ok {
+		co.ObserveContext(ctx, value)
+		return
+	}
+	h.Observe(value)
+}
+
+type ctxKeySpanHolder struct{}
+
+type spanHolder struct {
+	mu sync.Mutex
+	sc trace.SpanContext
+}
+
+// CaptureSpan 返回的ctx传给内层endpoint后，内层创建的第一个span可以通过SampledTraceID(ctx)获取
+func CaptureSpan(ctx context.Context) context.Context {
+	return context.WithValue(ctx, ctxKeySpanHolder{}, &spanHolder{})
+}
+
+// 在traceEndpoint中调用，内层endpoint可能并发调用(如BatchSum)，只保留第一个span
+func captureSpan(ctx context.Context, span trace.Span) {
+	if h, ok := ctx.Value(ctxKeySpanHolder{}).(*spanHolder); ok {
+		h.mu.Lock()
+		if !h.sc.IsValid() {
+			h.sc = span.SpanContext()
+		}
+		h.mu.Unlock()
+	}
+}
+
+// SampledTraceID 依次从CaptureSpan捕获的span、ctx中的span、上游传入的span(见GRPCToContext)中
+// 获取trace id(32位十六进制)，没有trace或未采样时返回false
+func SampledTraceID(ctx context.Context) (string, bool) {
+	for _, sc := range []trace.SpanContext{
+		capturedSpan(ctx),
+		trace.SpanFromContext(ctx).SpanContext(),
+		trace.RemoteSpanContextFromContext(ctx),
+	} {
+		if sc.IsValid() {
+			if !sc.IsSampled() {
+				return "", false
+			}
+			return sc.TraceID.String(), true
+		}
+	}
+	return "", false
+}
+
+func capturedSpan(ctx context.Context) trace.SpanContext {
+	if h, ok := ctx.Value(ctxKeySpanHolder{}).(*spanHolder); ok {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		return h.sc
+	}
+	return trace.EmptySpanContext()
+}
@@ -0,0 +1,122 @@
+package otel
+
+import (
+	"context"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/metrics/discard"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"go.opentelemetry.io/otel/api/trace"
+	"go.opentelemetry.io/otel/api/trace/tracetest"
+	"testing"
+)
+
+// 返回method label对应的所有bucket上的exemplar trace_id
+func exemplarTraceIDs(t *testing.T, reg *stdprometheus.Registry, method string) []string {
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			if !hasLabel(m, "method", method) {
+				continue
+			}
+			for _, b := range m.GetHistogram().GetBucket() {
+				if e := b.GetExemplar(); e != nil {
+					for _, l := range e.GetLabel() {
+						if l.GetName() == ExemplarTraceIDLabel {
+							ids = append(ids, l.GetValue())
+						}
+					}
+				}
+			}
+		}
+	}
+	return ids
+}
+
+func hasLabel(m *dto.Metric, name, value string) bool {
+	for _, l := range m.GetLabel() {
+		if l.GetName() == name && l.GetValue() == value {
+			return true
+		}
+	}
+	return false
+}
+
+func TestHistogramExemplar(t *testing.T) {
+	reg := stdprometheus.NewRegistry()
+	hv := stdprometheus.NewHistogramVec(stdprometheus.HistogramOpts{Name: "duration", Buckets: []float64{1}}, []string{"method"})
+	reg.MustRegister(hv)
+	h := NewHistogram(hv)
+
+	sampled := &tracetest.MockTracer{Sampled: true, StartSpanID: new(uint64)}
+	unsampled := &tracetest.MockTracer{StartSpanID: new(uint64)}
+	test := []struct {
+		method string
+		ctx    func() (context.Context, string)
+		want   bool
+	}{
+		{method: "none", ctx: func() (context.Context, string) { return context.Background(), "" }},
+		{method: "sampled", want: true, ctx: func() (context.Context, string) {
+			ctx, span := sampled.Start(context.Background(), "x")
+			return ctx, span.SpanContext().TraceID.String()
+		}},
+		{method: "unsampled", ctx: func() (context.Context, string) {
+			ctx, _ := unsampled.Start(context.Background(), "x")
+			return ctx, ""
+		}},
+		// 上游传入的span(还没有创建server span)
+		{method: "remote", want: true, ctx: func() (context.Context, string) {
+			_, span := sampled.Start(context.Background(), "x")
+			return trace.ContextWithRemoteSpanContext(context.Background(), span.SpanContext()), span.SpanContext().TraceID.String()
+		}},
+	}
+	for _, tt := range test {
+		ctx, traceID := tt.ctx()
+		ObserveContext(ctx, h.With("method", tt.method), 0.5)
+		ids := exemplarTraceIDs(t, reg, tt.method)
+		if tt.want && (len(ids) != 1 || ids[0] != traceID) {
+			t.Errorf("%s: want exemplar %s, got %v", tt.method, traceID, ids)
+		}
+		if !tt.want && len(ids) != 0 {
+			t.Errorf("%s: want no exemplar, got %v", tt.method, ids)
+		}
+	}
+
+	// 不支持exemplar的histogram
+	ObserveContext(context.Background(), discard.NewHistogram(), 1)
+}
+
+// 指标中间件在tracing中间件外层时，通过CaptureSpan获取内层创建的span
+func TestCaptureSpan(t *testing.T) {
+	tracer := &tracetest.MockTracer{Sampled: true, StartSpanID: new(uint64)}
+	var inner string
+	ep := TraceServer(tracer, "Sum")(TraceClient(tracer, "downstream")(func(ctx context.Context, _ interface{}) (interface{}, error) {
+		inner = trace.SpanFromContext(ctx).SpanContext().SpanID.String()
+		return nil, nil
+	}))
+	var got, gotSpan string
+	metricsMW := func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			ctx = CaptureSpan(ctx)
+			defer func() {
+				got, _ = SampledTraceID(ctx)
+				gotSpan = capturedSpan(ctx).SpanID.String()
+			}()
+			return next(ctx, request)
+		}
+	}
+	if _, err := metricsMW(ep)(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if got == "" {
+		t.Fatal("want captured trace id")
+	}
+	// 捕获的是最外层的server span
+	if gotSpan == inner {
+		t.Errorf("captured inner span %s", gotSpan)
+	}
+}
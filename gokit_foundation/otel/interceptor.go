@@ -0,0 +1,25 @@
+package otel
+
+import (
+	"context"
+	"go.opentelemetry.io/otel/api/trace"
+	"go.opentelemetry.io/otel/codes"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryClientInterceptor 直接使用grpc client的调用方使用，与TraceClient相同，span名为完整方法名，
+// 需在它之后(内层)安装propagation.UnaryClientInterceptor，才能把span传递给下游
+func UnaryClientInterceptor(tracer trace.Tracer) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, span := tracer.Start(ctx, method, trace.WithSpanKind(trace.SpanKindClient))
+		defer span.End()
+		captureSpan(ctx, span)
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		if err != nil {
+			span.RecordError(ctx, err)
+			span.SetStatus(codes.Error, status.Convert(err).Message())
+		}
+		return err
+	}
+}
@@ -0,0 +1,105 @@
+package otel
+
+import (
+	"context"
+	"crypto/tls"
+	"github.com/go-kit/kit/log"
+	otelapi "go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/api/global"
+	"go.opentelemetry.io/otel/api/trace"
+	"go.opentelemetry.io/otel/exporters/otlp"
+	"go.opentelemetry.io/otel/propagators"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/semconv"
+	"google.golang.org/grpc/credentials"
+	"net/url"
+	"os"
+	"strings"
+)
+
+/*
+OpenTelemetry链路追踪，与opentracing并存：
+-	Setup：按环境变量OTEL_EXPORTER_OTLP_ENDPOINT创建OTLP(grpc)exporter并设置为全局TracerProvider，未设置时不启用
+-	TraceServer/TraceClient：endpoint中间件，为每次调用创建span，调用返回err时记录到span
+-	UnaryClientInterceptor：不经过go-kit的grpc client使用，与TraceClient相同
+-	GRPCToContext/ContextToGRPC/HTTPToContext/ContextToHTTP：transport层的Before函数，
+	通过W3C traceparent/baggage在grpc metadata和http header中传递链路信息
+未启用时全局TracerProvider为noop，中间件和Before函数仍可以安装，开销可以忽略
+*/
+
+const (
+	// 如 localhost:4317、http://otel-collector:4317，https://开头时使用TLS连接
+	EnvEndpoint = "OTEL_EXPORTER_OTLP_ENDPOINT"
+
+	instrumentationName = "gokit_foundation/otel"
+)
+
+// Tracer 返回本包使用的tracer(来自全局TracerProvider)，Setup前后获取的都可以使用
+func Tracer() trace.Tracer {
+	return global.Tracer(instrumentationName)
+}
+
+// Setup 按EnvEndpoint初始化全局TracerProvider和propagator，返回的shutdown在进程退出前调用，
+// 会发送缓存中的span并关闭exporter；未设置EnvEndpoint时返回的shutdown什么也不做
+func Setup(serviceName string, logger log.Logger) (shutdown func(context.Context) error, err error) {
+	// 即使不导出span，也要设置propagator，让上游的链路信息能透传给下游
+	global.SetTextMapPropagator(otelapi.NewCompositeTextMapPropagator(propagators.TraceContext{}, propagators.Baggage{}))
+
+	endpoint := os.Getenv(EnvEndpoint)
+	if endpoint == "" {
+		logger.Log("otel", "disabled", "reason", EnvEndpoint+" not set")
+		return func(context.Context) error { return nil }, nil
+	}
+	addr, secure, err := parseEndpoint(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	exp, err := NewExporter(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	bsp := sdktrace.NewBatchSpanProcessor(exp)
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(bsp),
+		// 上游已决定采样与否时跟随上游，否则全部采样
+		sdktrace.WithConfig(sdktrace.Config{DefaultSampler: sdktrace.ParentBased(sdktrace.AlwaysSample())}),
+		sdktrace.WithResource(resource.New(semconv.ServiceNameKey.String(serviceName))),
+	)
+	global.SetTracerProvider(tp)
+	logger.Log("otel", "enabled", "endpoint", addr, "tls", secure)
+
+	return func(ctx context.Context) error {
+		// 先停止processor(会导出剩余的span)，再关闭exporter
+		bsp.Shutdown()
+		return exp.Shutdown(ctx)
+	}, nil
+}
+
+// NewExporter 创建连接到endpoint(格式与EnvEndpoint相同)的OTLP(grpc)exporter，链路追踪和指标(见metricsx)共用
+func NewExporter(endpoint string) (*otlp.Exporter, error) {
+	addr, secure, err := parseEndpoint(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	opts := []otlp.ExporterOption{otlp.WithAddress(addr)}
+	if secure {
+		opts = append(opts, otlp.WithTLSCredentials(credentials.NewTLS(&tls.Config{})))
+	} else {
+		opts = append(opts, otlp.WithInsecure())
+	}
+	return otlp.NewExporter(opts...)
+}
+
+// 返回host:port，以及是否使用TLS
+func parseEndpoint(endpoint string) (addr string, secure bool, err error) {
+	if !strings.Contains(endpoint, "://") {
+		return endpoint, false, nil
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", false, err
+	}
+	return u.Host, u.Scheme == "https", nil
+}
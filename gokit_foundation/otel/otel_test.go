@@ -0,0 +1,143 @@
+package otel
+
+import (
+	"context"
+	"errors"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	"go.opentelemetry.io/otel/api/trace"
+	"go.opentelemetry.io/otel/api/trace/tracetest"
+	"go.opentelemetry.io/otel/codes"
+	"google.golang.org/grpc"
+	grpccodes "google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"os"
+	"testing"
+)
+
+func newTestTracer() (trace.Tracer, *tracetest.StandardSpanRecorder) {
+	sr := &tracetest.StandardSpanRecorder{}
+	return tracetest.NewTracerProvider(tracetest.WithSpanRecorder(sr)).Tracer("test"), sr
+}
+
+func TestSetupDisabled(t *testing.T) {
+	_ = os.Unsetenv(EnvEndpoint)
+	shutdown, err := Setup("test", log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseEndpoint(t *testing.T) {
+	test := []struct {
+		endpoint   string
+		wantAddr   string
+		wantSecure bool
+	}{
+		{endpoint: "localhost:4317", wantAddr: "localhost:4317"},
+		{endpoint: "http://otel-collector:4317", wantAddr: "otel-collector:4317"},
+		{endpoint: "https://otel-collector:4317", wantAddr: "otel-collector:4317", wantSecure: true},
+	}
+	for _, tt := range test {
+		addr, secure, err := parseEndpoint(tt.endpoint)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.endpoint, err)
+		}
+		if addr != tt.wantAddr || secure != tt.wantSecure {
+			t.Errorf("%s: want %s %v, got %s %v", tt.endpoint, tt.wantAddr, tt.wantSecure, addr, secure)
+		}
+	}
+}
+
+func TestTraceEndpointError(t *testing.T) {
+	tracer, sr := newTestTracer()
+	errFail := errors.New("fail")
+	ep := TraceServer(tracer, "Sum")(func(context.Context, interface{}) (interface{}, error) {
+		return nil, errFail
+	})
+	if _, err := ep(context.Background(), nil); err != errFail {
+		t.Fatalf("want %v, got %v", errFail, err)
+	}
+	spans := sr.Completed()
+	if len(spans) != 1 {
+		t.Fatalf("want 1 span, got %d", len(spans))
+	}
+	if s := spans[0]; s.Name() != "Sum" || s.SpanKind() != trace.SpanKindServer || s.StatusCode() != codes.Error {
+		t.Errorf("unexpected span: name=%s kind=%s status=%s", s.Name(), s.SpanKind(), s.StatusCode())
+	}
+}
+
+// client端的span经过transport传递后，应该是server端span的父span
+func TestPropagation(t *testing.T) {
+	_ = os.Unsetenv(EnvEndpoint)
+	if _, err := Setup("test", log.NewNopLogger()); err != nil {
+		t.Fatal(err)
+	}
+	test := []struct {
+		name      string
+		transport func(ctx context.Context) context.Context
+	}{
+		{name: "[grpc]", transport: func(ctx context.Context) context.Context {
+			md := metadata.MD{}
+			ContextToGRPC()(ctx, &md)
+			return GRPCToContext()(context.Background(), md)
+		}},
+		{name: "[http]", transport: func(ctx context.Context) context.Context {
+			r, _ := http.NewRequest("GET", "http://localhost/", nil)
+			ContextToHTTP()(ctx, r)
+			return HTTPToContext()(context.Background(), r)
+		}},
+	}
+	for _, tt := range test {
+		tracer, sr := newTestTracer()
+		server := TraceServer(tracer, "server")(endpoint.Nop)
+		client := TraceClient(tracer, "client")(func(ctx context.Context, request interface{}) (interface{}, error) {
+			return server(tt.transport(ctx), request)
+		})
+		if _, err := client(context.Background(), nil); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		spans := map[string]*tracetest.Span{}
+		for _, s := range sr.Completed() {
+			spans[s.Name()] = s
+		}
+		c, s := spans["client"], spans["server"]
+		if c == nil || s == nil {
+			t.Fatalf("%s: want client and server spans, got %d spans", tt.name, len(spans))
+		}
+		if s.ParentSpanID() != c.SpanContext().SpanID || s.SpanContext().TraceID != c.SpanContext().TraceID {
+			t.Errorf("%s: server span is not a child of client span", tt.name)
+		}
+	}
+}
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	// Setup设置全局的propagator
+	_ = os.Unsetenv(EnvEndpoint)
+	if _, err := Setup("test", log.NewNopLogger()); err != nil {
+		t.Fatal(err)
+	}
+	tracer, sr := newTestTracer()
+	var md metadata.MD
+	err := UnaryClientInterceptor(tracer)(context.Background(), "/a.B/C", nil, nil, nil, func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md = metadata.MD{}
+		ContextToGRPC()(ctx, &md)
+		return status.Error(grpccodes.Unavailable, "down")
+	})
+	if status.Code(err) != grpccodes.Unavailable {
+		t.Fatalf("got err:%v", err)
+	}
+	spans := sr.Completed()
+	if len(spans) != 1 || spans[0].Name() != "/a.B/C" || spans[0].SpanKind() != trace.SpanKindClient || spans[0].StatusCode() != codes.Error {
+		t.Fatalf("got spans:%v", spans)
+	}
+	if len(md.Get("traceparent")) != 1 {
+		t.Errorf("got md:%v", md)
+	}
+}
@@ -0,0 +1,55 @@
+package otel
+
+import (
+	"context"
+	grpctransport "github.com/go-kit/kit/transport/grpc"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"go.opentelemetry.io/otel/api/global"
+	"google.golang.org/grpc/metadata"
+	"net/http"
+	"strings"
+)
+
+// grpc metadata的key都是小写的，Get/Set时统一转换
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	if v := metadata.MD(c).Get(strings.ToLower(key)); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(strings.ToLower(key), value)
+}
+
+// GRPCToContext 从grpc请求的metadata中提取链路信息，用于grpctransport.ServerBefore
+func GRPCToContext() grpctransport.ServerRequestFunc {
+	return func(ctx context.Context, md metadata.MD) context.Context {
+		return global.TextMapPropagator().Extract(ctx, metadataCarrier(md))
+	}
+}
+
+// ContextToGRPC 将ctx中的链路信息写入grpc请求的metadata，用于grpctransport.ClientBefore
+func ContextToGRPC() grpctransport.ClientRequestFunc {
+	return func(ctx context.Context, md *metadata.MD) context.Context {
+		global.TextMapPropagator().Inject(ctx, metadataCarrier(*md))
+		return ctx
+	}
+}
+
+// HTTPToContext 从http请求header中提取链路信息，用于httptransport.ServerBefore
+func HTTPToContext() httptransport.RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		return global.TextMapPropagator().Extract(ctx, r.Header)
+	}
+}
+
+// ContextToHTTP 将ctx中的链路信息写入http请求header，用于httptransport.ClientBefore
+func ContextToHTTP() httptransport.RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		global.TextMapPropagator().Inject(ctx, r.Header)
+		return ctx
+	}
+}
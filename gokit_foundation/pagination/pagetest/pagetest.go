@@ -0,0 +1,97 @@
+package pagetest
+
+import (
+	"context"
+	"gokit_foundation/pagination"
+	"testing"
+)
+
+// Lister 调用被测的列表接口(service、gRPC或HTTP client)，返回本页每条记录的id，参数错误时返回err
+type Lister func(ctx context.Context, p pagination.Params) (ids []string, nextPageToken string, err error)
+
+type Config struct {
+	Total       int      // 调用前已写入的记录数，最好大于DefaultSize，且没有其他写入
+	DefaultSize int      // 与接口的pagination.Spec一致
+	MaxSize     int      // 同上
+	OrderBy     []string // 需要翻页验证的order_by，如 "name desc"，空字符串为默认排序，其他的需与默认排序不同
+}
+
+// Contract 所有使用pagination约定的列表接口都必须满足的行为：
+// 每种排序翻完所有页得到全部记录且不重复，每页不超过page_size，最后一页的next_page_token为空，
+// page_size的默认值和上限，以及负数page_size、无效的token、未知的order_by、换了order_by的token都返回错误
+func Contract(t *testing.T, list Lister, conf Config) {
+	t.Helper()
+	ctx := context.Background()
+	for _, orderBy := range conf.OrderBy {
+		seen := map[string]bool{}
+		p := pagination.Params{PageSize: 2, OrderBy: orderBy}
+		for pages := 0; ; pages++ {
+			if pages > conf.Total {
+				t.Fatalf("order_by %q: more than %d pages", orderBy, conf.Total)
+			}
+			ids, next, err := list(ctx, p)
+			if err != nil {
+				t.Fatalf("order_by %q page %d got err:%v", orderBy, pages, err)
+			}
+			if len(ids) > p.PageSize || (next != "" && len(ids) == 0) {
+				t.Errorf("order_by %q page %d got %d items next:%q", orderBy, pages, len(ids), next)
+			}
+			for _, id := range ids {
+				if seen[id] {
+					t.Errorf("order_by %q: duplicate id %s", orderBy, id)
+				}
+				seen[id] = true
+			}
+			if next == "" {
+				break
+			}
+			p.PageToken = next
+		}
+		if len(seen) != conf.Total {
+			t.Errorf("order_by %q got %d items, want %d", orderBy, len(seen), conf.Total)
+		}
+	}
+
+	min := func(a, b int) int {
+		if a < b {
+			return a
+		}
+		return b
+	}
+	for _, size := range []struct{ pageSize, want int }{
+		{0, min(conf.Total, conf.DefaultSize)},
+		{conf.MaxSize + 1000, min(conf.Total, conf.MaxSize)},
+	} {
+		ids, _, err := list(ctx, pagination.Params{PageSize: size.pageSize})
+		if err != nil || len(ids) != size.want {
+			t.Errorf("page_size %d got %d items err:%v, want %d", size.pageSize, len(ids), err, size.want)
+		}
+	}
+
+	// 同样的参数两次返回相同的第一页
+	first, next, err := list(ctx, pagination.Params{PageSize: 1})
+	if err != nil || len(first) != 1 || next == "" {
+		t.Fatalf("page_size 1 got %v next:%q err:%v", first, next, err)
+	}
+	if again, _, err := list(ctx, pagination.Params{PageSize: 1}); err != nil || len(again) != 1 || again[0] != first[0] {
+		t.Errorf("first page changed: %v then %v err:%v", first, again, err)
+	}
+
+	invalid := []pagination.Params{
+		{PageSize: -1},
+		{PageToken: "not a token"},
+		{PageToken: "e30"}, // {}
+		{OrderBy: "no_such_field"},
+		{OrderBy: conf.OrderBy[0] + " sideways"},
+	}
+	for _, orderBy := range conf.OrderBy {
+		if orderBy != "" {
+			invalid = append(invalid, pagination.Params{PageToken: next, OrderBy: orderBy})
+		}
+	}
+	for _, p := range invalid {
+		if _, _, err := list(ctx, p); err == nil {
+			t.Errorf("%+v: want err", p)
+		}
+	}
+}
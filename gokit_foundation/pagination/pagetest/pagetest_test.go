@@ -0,0 +1,71 @@
+package pagetest
+
+import (
+	"context"
+	"gokit_foundation/pagination"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+type item struct {
+	id   int
+	name string
+}
+
+// 内存中按keyset分页的参考实现
+func memLister(items []item) Lister {
+	spec := pagination.Spec{DefaultSize: 3, MaxSize: 4, Sorts: []string{"id", "name"}, DefaultSort: pagination.Sort{Field: "id"}}
+	key := func(it item, field string) string {
+		if field == "name" {
+			return it.name
+		}
+		return ""
+	}
+	return func(_ context.Context, p pagination.Params) ([]string, string, error) {
+		r, err := spec.Parse(p, "")
+		if err != nil {
+			return nil, "", err
+		}
+		less := func(a, b item) bool {
+			ka, kb := key(a, r.Sort.Field), key(b, r.Sort.Field)
+			if r.Sort.Desc {
+				a, b, ka, kb = b, a, kb, ka
+			}
+			return ka < kb || (ka == kb && a.id < b.id)
+		}
+		sorted := append([]item(nil), items...)
+		sort.Slice(sorted, func(i, j int) bool { return less(sorted[i], sorted[j]) })
+		var page []item
+		for _, it := range sorted {
+			if r.After != nil {
+				id, err := strconv.Atoi(r.After.ID)
+				if err != nil {
+					return nil, "", pagination.ErrInvalidToken
+				}
+				if !less(item{id: id, name: r.After.Key}, it) {
+					continue
+				}
+			}
+			if page = append(page, it); len(page) > r.Size {
+				break
+			}
+		}
+		page, next := pagination.Page(r, page, func(it item) pagination.Cursor {
+			return pagination.Cursor{Key: key(it, r.Sort.Field), ID: strconv.Itoa(it.id)}
+		})
+		ids := make([]string, len(page))
+		for i, it := range page {
+			ids[i] = strconv.Itoa(it.id)
+		}
+		return ids, next, nil
+	}
+}
+
+func TestContract(t *testing.T) {
+	var items []item
+	for i, name := range []string{"dave", "bob", "carol", "bob", "alice", "erin", "bob"} {
+		items = append(items, item{id: i + 1, name: name})
+	}
+	Contract(t, memLister(items), Config{Total: len(items), DefaultSize: 3, MaxSize: 4, OrderBy: []string{"", "name", "name desc", "id desc"}})
+}
@@ -0,0 +1,193 @@
+package pagination
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"gokit_foundation/errs"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+/*
+列表接口统一的分页、排序、过滤约定(需要go1.18)，各服务的gRPC和HTTP接口使用相同的参数：
+-	page_size：每页条数，为0时为DefaultSize，超过MaxSize时按MaxSize返回，负数为参数错误
+-	page_token：上一页返回的next_page_token，为空表示第一页；最后一页的next_page_token为空
+-	order_by：排序字段，如 "name" 或 "created_at desc"，只允许Sorts中的字段，为空时为DefaultSort
+-	过滤条件由各接口自己定义(如name_prefix)，规范化后传给Parse
+page_token是不透明的游标(base64url编码，调用方不应解析)，记录上一页最后一条的排序值和id(keyset分页)，
+翻页时不受中间插入、删除的影响，不会重复或遗漏翻页之前已存在的记录；
+token与生成它的order_by和过滤条件绑定，换了order_by或过滤条件后继续使用旧token为参数错误
+排序值相同的记录按id排序，存储层按 (排序值, id) 比较游标(见Request.After)
+参数错误为errs.KindInvalid，各服务可以转为自己的业务错误
+*/
+
+// Params 列表接口的分页参数，由transport层从请求中解码
+type Params struct {
+	PageSize  int
+	PageToken string
+	OrderBy   string
+}
+
+const (
+	queryPageSize  = "page_size"
+	queryPageToken = "page_token"
+	queryOrderBy   = "order_by"
+)
+
+// ParamsFromQuery 解码HTTP接口的query参数 page_size、page_token、order_by
+func ParamsFromQuery(q url.Values) (Params, error) {
+	p := Params{PageToken: q.Get(queryPageToken), OrderBy: q.Get(queryOrderBy)}
+	if s := q.Get(queryPageSize); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return Params{}, errs.Invalid("invalid page_size: " + s)
+		}
+		p.PageSize = n
+	}
+	return p, nil
+}
+
+// SetQuery 将p编码到HTTP接口的query参数中，零值不编码
+func (p Params) SetQuery(q url.Values) {
+	if p.PageSize != 0 {
+		q.Set(queryPageSize, strconv.Itoa(p.PageSize))
+	}
+	if p.PageToken != "" {
+		q.Set(queryPageToken, p.PageToken)
+	}
+	if p.OrderBy != "" {
+		q.Set(queryOrderBy, p.OrderBy)
+	}
+}
+
+type Sort struct {
+	Field string
+	Desc  bool
+}
+
+// String 返回order_by的规范写法，如 name、created_at desc
+func (s Sort) String() string {
+	if s.Desc {
+		return s.Field + " desc"
+	}
+	return s.Field
+}
+
+// Cursor 上一页最后一条记录的排序值和id，排序值的编码由存储层决定(需要与排序顺序一致，或由存储层解码后比较)
+type Cursor struct {
+	Key string `json:"k,omitempty"`
+	ID  string `json:"i"`
+}
+
+// Spec 一个列表接口的分页约定，DefaultSort.Field需在Sorts中，0 < DefaultSize <= MaxSize
+type Spec struct {
+	DefaultSize int
+	MaxSize     int
+	Sorts       []string // 允许排序的字段
+	DefaultSort Sort
+}
+
+// Request 解析后的分页参数，传给存储层
+type Request struct {
+	Size   int     // 本页条数，存储层应多取一条用于判断是否还有下一页(见Page)
+	Sort   Sort    // 存储层按 (Sort.Field, id) 排序，Desc时两者都为降序
+	After  *Cursor // 为nil时从第一条开始，否则返回排在After之后的记录
+	filter string
+}
+
+var (
+	ErrInvalidToken = errs.Invalid("invalid page_token")
+	// token与当前的order_by或过滤条件不一致
+	ErrTokenMismatch = errs.Invalid("page_token does not match order_by or filter")
+)
+
+// 编码到page_token中，过滤条件只保存摘要
+type token struct {
+	Sort   string `json:"s"`
+	Filter string `json:"f,omitempty"`
+	Cursor
+}
+
+// ParseSort 解析order_by，为空时为DefaultSort
+func (s Spec) ParseSort(orderBy string) (Sort, error) {
+	f := strings.Fields(orderBy)
+	if len(f) == 0 {
+		return s.DefaultSort, nil
+	}
+	var sort Sort
+	switch {
+	case len(f) == 2 && strings.EqualFold(f[1], "desc"):
+		sort.Desc = true
+	case len(f) == 2 && strings.EqualFold(f[1], "asc"):
+	case len(f) != 1:
+		return Sort{}, errs.Invalid("invalid order_by: " + orderBy)
+	}
+	for _, field := range s.Sorts {
+		if f[0] == field {
+			sort.Field = field
+			return sort, nil
+		}
+	}
+	return Sort{}, errs.Invalid(fmt.Sprintf("invalid order_by: %s, allowed fields: %s", orderBy, strings.Join(s.Sorts, ", ")))
+}
+
+// Parse 解析分页参数，filter为过滤条件的规范化表示(如 name_prefix=j)，相同的过滤条件需要得到相同的filter
+func (s Spec) Parse(p Params, filter string) (Request, error) {
+	if p.PageSize < 0 {
+		return Request{}, errs.Invalid("page_size must not be negative")
+	}
+	sort, err := s.ParseSort(p.OrderBy)
+	if err != nil {
+		return Request{}, err
+	}
+	r := Request{Size: p.PageSize, Sort: sort, filter: digest(filter)}
+	if r.Size == 0 {
+		r.Size = s.DefaultSize
+	}
+	if r.Size > s.MaxSize {
+		r.Size = s.MaxSize
+	}
+	if p.PageToken == "" {
+		return r, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(p.PageToken)
+	if err != nil {
+		return Request{}, ErrInvalidToken
+	}
+	var t token
+	if err = json.Unmarshal(b, &t); err != nil || t.ID == "" {
+		return Request{}, ErrInvalidToken
+	}
+	if t.Sort != sort.String() || t.Filter != r.filter {
+		return Request{}, ErrTokenMismatch
+	}
+	r.After = &t.Cursor
+	return r, nil
+}
+
+func digest(filter string) string {
+	if filter == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(filter))
+	return hex.EncodeToString(sum[:8])
+}
+
+// NextToken 返回以c为游标的next_page_token
+func (r Request) NextToken(c Cursor) string {
+	b, _ := json.Marshal(token{Sort: r.Sort.String(), Filter: r.filter, Cursor: c})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Page items为存储层按r返回的最多r.Size+1条记录，返回本页的记录和next_page_token，没有下一页时token为空
+func Page[T any](r Request, items []T, cursor func(T) Cursor) ([]T, string) {
+	if len(items) <= r.Size {
+		return items, ""
+	}
+	items = items[:r.Size]
+	return items, r.NextToken(cursor(items[len(items)-1]))
+}
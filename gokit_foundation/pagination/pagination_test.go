@@ -0,0 +1,97 @@
+package pagination
+
+import (
+	"gokit_foundation/errs"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+var spec = Spec{DefaultSize: 2, MaxSize: 3, Sorts: []string{"id", "name"}, DefaultSort: Sort{Field: "id"}}
+
+func TestParse(t *testing.T) {
+	for _, tt := range []struct {
+		p    Params
+		size int
+		sort Sort
+	}{
+		{Params{}, 2, Sort{Field: "id"}},
+		{Params{PageSize: 1, OrderBy: "name"}, 1, Sort{Field: "name"}},
+		{Params{PageSize: 100, OrderBy: " name  DESC "}, 3, Sort{Field: "name", Desc: true}},
+		{Params{OrderBy: "id asc"}, 2, Sort{Field: "id"}},
+	} {
+		r, err := spec.Parse(tt.p, "")
+		if err != nil || r.Size != tt.size || r.Sort != tt.sort || r.After != nil {
+			t.Errorf("%+v got %+v err:%v", tt.p, r, err)
+		}
+	}
+	for _, p := range []Params{
+		{PageSize: -1},
+		{OrderBy: "email"},
+		{OrderBy: "name up"},
+		{OrderBy: "name desc x"},
+		{PageToken: "!"},
+		{PageToken: "e30"},
+	} {
+		if _, err := spec.Parse(p, ""); errs.KindOf(err) != errs.KindInvalid {
+			t.Errorf("%+v got err:%v", p, err)
+		}
+	}
+}
+
+func TestToken(t *testing.T) {
+	r, _ := spec.Parse(Params{OrderBy: "name desc"}, "name_prefix=j")
+	c := Cursor{Key: "jack", ID: "7"}
+	p := Params{PageToken: r.NextToken(c), OrderBy: "name desc"}
+	next, err := spec.Parse(p, "name_prefix=j")
+	if err != nil || next.After == nil || *next.After != c || next.Sort != r.Sort {
+		t.Fatalf("got %+v err:%v", next, err)
+	}
+
+	// 换了排序或过滤条件
+	for _, tt := range []struct {
+		orderBy, filter string
+	}{
+		{"name", "name_prefix=j"},
+		{"name desc", "name_prefix=r"},
+		{"name desc", ""},
+	} {
+		if _, err := spec.Parse(Params{PageToken: p.PageToken, OrderBy: tt.orderBy}, tt.filter); err != ErrTokenMismatch {
+			t.Errorf("%+v got err:%v", tt, err)
+		}
+	}
+}
+
+func TestPage(t *testing.T) {
+	r, _ := spec.Parse(Params{}, "")
+	cursor := func(id int) Cursor { return Cursor{ID: string(rune('0' + id))} }
+	items, next := Page(r, []int{1, 2}, cursor)
+	if !reflect.DeepEqual(items, []int{1, 2}) || next != "" {
+		t.Errorf("got %v %q", items, next)
+	}
+	items, next = Page(r, []int{1, 2, 3}, cursor)
+	if !reflect.DeepEqual(items, []int{1, 2}) || next == "" {
+		t.Fatalf("got %v %q", items, next)
+	}
+	if n, err := spec.Parse(Params{PageToken: next}, ""); err != nil || n.After.ID != "2" {
+		t.Errorf("got %+v err:%v", n, err)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	p := Params{PageSize: 10, PageToken: "abc", OrderBy: "name desc"}
+	q := url.Values{}
+	p.SetQuery(q)
+	got, err := ParamsFromQuery(q)
+	if err != nil || got != p {
+		t.Errorf("got %+v err:%v", got, err)
+	}
+	if _, err := ParamsFromQuery(url.Values{"page_size": {"ten"}}); errs.KindOf(err) != errs.KindInvalid {
+		t.Errorf("got err:%v", err)
+	}
+	q = url.Values{}
+	Params{}.SetQuery(q)
+	if len(q) != 0 {
+		t.Errorf("got %v", q)
+	}
+}
@@ -0,0 +1,197 @@
+package payloadlog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	"gokit_foundation"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+/*
+请求/响应payload日志，用于开发环境排查问题，默认关闭：
+-	Recorder.Middleware安装在endpoint的最外层，开启后每次调用输出一行日志，包括request、response(或err)和耗时
+-	payload先编码为json，字段名(不区分大小写)在Redact中的值替换为"***"，支持嵌套的对象和数组
+-	编码后超过MaxBytes的部分被截断，避免大payload刷屏
+-	运行时通过Recorder.Handler开关和修改配置(如new_addsvc管理端口的/payloadlog)，关闭时只有一次原子读取的开销
+注意：payload可能包含用户数据，不应在生产环境长期开启
+*/
+
+const (
+	DefaultMaxBytes = 2048
+	redacted        = "***"
+)
+
+// DefaultRedact 默认脱敏的字段
+var DefaultRedact = []string{"password", "token", "access_token", "refresh_token", "secret", "authorization"}
+
+type Config struct {
+	Enabled  bool     `json:"enabled"`
+	Redact   []string `json:"redact,omitempty"`    // 为空时使用DefaultRedact
+	MaxBytes int      `json:"max_bytes,omitempty"` // 为0时使用DefaultMaxBytes
+}
+
+func (c Config) Validate() error {
+	if c.MaxBytes < 0 {
+		return fmt.Errorf("payloadlog: negative max_bytes %d", c.MaxBytes)
+	}
+	return nil
+}
+
+// 补全默认值，redact转为小写的集合
+type state struct {
+	conf   Config
+	redact map[string]bool
+}
+
+type Recorder struct {
+	state atomic.Value // *state，整体替换
+}
+
+func NewRecorder() *Recorder {
+	r := &Recorder{}
+	_ = r.Set(Config{})
+	return r
+}
+
+// Set 替换配置，非法配置不生效
+func (r *Recorder) Set(conf Config) error {
+	s, err := newState(conf)
+	if err != nil {
+		return err
+	}
+	r.state.Store(s)
+	return nil
+}
+
+func newState(conf Config) (*state, error) {
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+	if len(conf.Redact) == 0 {
+		conf.Redact = DefaultRedact
+	}
+	if conf.MaxBytes == 0 {
+		conf.MaxBytes = DefaultMaxBytes
+	}
+	s := &state{conf: conf, redact: make(map[string]bool, len(conf.Redact))}
+	for _, f := range conf.Redact {
+		s.redact[strings.ToLower(f)] = true
+	}
+	return s, nil
+}
+
+// Config 当前配置(已补全默认值)
+func (r *Recorder) Config() Config {
+	return r.state.Load().(*state).conf
+}
+
+// Middleware 每次调用时读取当前配置，关闭时直接调用next，日志输出到logger
+func (r *Recorder) Middleware(logger log.Logger, method string) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			s := r.state.Load().(*state)
+			if !s.conf.Enabled {
+				return next(ctx, request)
+			}
+			begin := time.Now()
+			response, err := next(ctx, request)
+			kvs := []interface{}{"payload", method, "request", s.format(request)}
+			if err != nil {
+				kvs = append(kvs, "err", err)
+			} else {
+				kvs = append(kvs, "response", s.format(response))
+			}
+			gokit_foundation.LoggerWithContext(logger, ctx).Log(append(kvs, "took", time.Since(begin))...)
+			return response, err
+		}
+	}
+}
+
+// Format 编码v并按conf脱敏、截断，conf为零值时使用默认配置
+func Format(v interface{}, conf Config) string {
+	s, err := newState(conf)
+	if err != nil {
+		return err.Error()
+	}
+	return s.format(v)
+}
+
+func (s *state) format(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("<%T: %v>", v, err)
+	}
+	// 解码为通用类型后脱敏，不是对象或数组的payload无需处理
+	if len(b) > 0 && (b[0] == '{' || b[0] == '[') {
+		var tree interface{}
+		if json.Unmarshal(b, &tree) == nil {
+			if out, err := json.Marshal(s.redactValue(tree)); err == nil {
+				b = out
+			}
+		}
+	}
+	if n := s.conf.MaxBytes; len(b) > n {
+		// 不截断多字节字符
+		for n > 0 && !utf8.RuneStart(b[n]) {
+			n--
+		}
+		return fmt.Sprintf("%s...(truncated %d bytes)", b[:n], len(b)-n)
+	}
+	return string(b)
+}
+
+func (s *state) redactValue(v interface{}) interface{} {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		for k, val := range x {
+			if s.redact[strings.ToLower(k)] {
+				x[k] = redacted
+			} else {
+				x[k] = s.redactValue(val)
+			}
+		}
+	case []interface{}:
+		for i := range x {
+			x[i] = s.redactValue(x[i])
+		}
+	}
+	return v
+}
+
+// Handler 运行时查看/修改配置，安装在管理用的http端口上：
+//
+//	GET /payloadlog                                                      返回当前配置
+//	PUT /payloadlog -d '{"enabled": true, "redact": ["email"], "max_bytes": 512}' 替换配置
+//	DELETE /payloadlog                                                   关闭
+func (r *Recorder) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case http.MethodGet:
+		case http.MethodPut, http.MethodPost:
+			var conf Config
+			if err := json.NewDecoder(req.Body).Decode(&conf); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := r.Set(conf); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		case http.MethodDelete:
+			_ = r.Set(Config{})
+		default:
+			w.Header().Set("Allow", "GET, PUT, POST, DELETE")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(r.Config())
+	})
+}
@@ -0,0 +1,95 @@
+package payloadlog
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/go-kit/kit/log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type loginRequest struct {
+	User     string `json:"user"`
+	Password string `json:"password"`
+	Profile  struct {
+		Tokens []map[string]string `json:"tokens"`
+	} `json:"profile"`
+}
+
+func TestFormat(t *testing.T) {
+	req := loginRequest{User: "alice", Password: "p@ss"}
+	req.Profile.Tokens = []map[string]string{{"Token": "t1", "name": "web"}}
+	got := Format(req, Config{})
+	if want := `{"password":"***","profile":{"tokens":[{"Token":"***","name":"web"}]},"user":"alice"}`; got != want {
+		t.Errorf("got:%s want:%s", got, want)
+	}
+	// 自定义字段时不再使用DefaultRedact
+	if got = Format(req, Config{Redact: []string{"USER"}}); !strings.Contains(got, `"user":"***"`) || !strings.Contains(got, `"p@ss"`) {
+		t.Errorf("custom redact got:%s", got)
+	}
+	// 非对象的payload原样编码
+	if got = Format(3, Config{}); got != "3" {
+		t.Errorf("got:%s", got)
+	}
+
+	if got = Format(strings.Repeat("a", 20), Config{MaxBytes: 10}); got != `"aaaaaaaaa...(truncated 12 bytes)` {
+		t.Errorf("truncate got:%s", got)
+	}
+	// 截断位置落在多字节字符中间时向前对齐
+	if got = Format("中文", Config{MaxBytes: 3}); got != `"...(truncated 7 bytes)` {
+		t.Errorf("truncate utf8 got:%s", got)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewRecorder()
+	ep := r.Middleware(log.NewLogfmtLogger(&buf), "Login")(func(_ context.Context, request interface{}) (interface{}, error) {
+		if request.(loginRequest).User == "" {
+			return nil, errors.New("empty user")
+		}
+		return map[string]string{"access_token": "abc"}, nil
+	})
+
+	// 默认关闭
+	if _, err := ep(context.Background(), loginRequest{User: "alice"}); err != nil || buf.Len() != 0 {
+		t.Fatalf("disabled got err:%v log:%s", err, buf.String())
+	}
+
+	if err := r.Set(Config{Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = ep(context.Background(), loginRequest{User: "alice", Password: "p@ss"})
+	out := buf.String()
+	if !strings.Contains(out, "payload=Login") || strings.Contains(out, "p@ss") || strings.Contains(out, "abc") ||
+		!strings.Contains(out, `access_token`) {
+		t.Errorf("got log:%s", out)
+	}
+	buf.Reset()
+	if _, err := ep(context.Background(), loginRequest{}); err == nil || !strings.Contains(buf.String(), `err="empty user"`) {
+		t.Errorf("got err:%v log:%s", err, buf.String())
+	}
+}
+
+func TestHandler(t *testing.T) {
+	r := NewRecorder()
+	h := r.Handler()
+	do := func(method, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, "/payloadlog", strings.NewReader(body)))
+		return w
+	}
+	if w := do(http.MethodPut, `{"enabled": true, "max_bytes": 512}`); w.Code != 200 || !r.Config().Enabled || r.Config().MaxBytes != 512 {
+		t.Errorf("put got code:%d conf:%+v", w.Code, r.Config())
+	}
+	// 非法配置不生效
+	if w := do(http.MethodPut, `{"enabled": true, "max_bytes": -1}`); w.Code != 400 || r.Config().MaxBytes != 512 {
+		t.Errorf("invalid got code:%d conf:%+v", w.Code, r.Config())
+	}
+	if w := do(http.MethodDelete, ""); w.Code != 200 || r.Config().Enabled || !strings.Contains(w.Body.String(), `"max_bytes":2048`) {
+		t.Errorf("delete got code:%d body:%s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,177 @@
+package gokit_foundation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	stdconsul "github.com/hashicorp/consul/api"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+/*
+启动前检查(preflight)：在创建任何服务之前执行所有检查，全部执行完后把失败项汇总成一个err返回，
+而不是启动到一半时在某个task里失败(此时可能已经注册到consul、连上了redis等)，
+一次启动就能看到所有问题，常见的有：
+-	端口已被占用(另一个实例或其他进程)，见CheckPortFree
+-	advertise地址从consul agent访问不到(NAT、容器网络、防火墙)，注册后健康检查一直critical，见ConsulProbe
+平滑升级(见Upgrader)启动的新进程继承了旧进程的监听，端口必然被占用，不应执行这些检查
+*/
+
+// PreflightError 所有失败的检查
+type PreflightError struct {
+	Failures []PreflightFailure
+}
+
+type PreflightFailure struct {
+	Name string
+	Err  error
+}
+
+func (e *PreflightError) Error() string {
+	lines := make([]string, 0, len(e.Failures)+1)
+	lines = append(lines, fmt.Sprintf("preflight: %d check(s) failed", len(e.Failures)))
+	for _, f := range e.Failures {
+		lines = append(lines, fmt.Sprintf("  - %s: %v", f.Name, f.Err))
+	}
+	return strings.Join(lines, "\n")
+}
+
+type preflightCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+type Preflight struct {
+	checks []preflightCheck
+}
+
+// Add 按添加顺序执行，name用于输出，如 port grpc
+func (p *Preflight) Add(name string, check func(ctx context.Context) error) *Preflight {
+	p.checks = append(p.checks, preflightCheck{name: name, check: check})
+	return p
+}
+
+// Run 执行所有检查，有失败时返回*PreflightError，某一项失败不影响其他检查
+func (p *Preflight) Run(ctx context.Context) error {
+	var e PreflightError
+	for _, c := range p.checks {
+		if err := c.check(ctx); err != nil {
+			e.Failures = append(e.Failures, PreflightFailure{Name: c.name, Err: err})
+		}
+	}
+	if len(e.Failures) > 0 {
+		return &e
+	}
+	return nil
+}
+
+// CheckPortFree 检查addr(host:port)当前可以监听，只在检查时短暂监听一下
+func CheckPortFree(addr string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		lis, err := net.Listen("tcp", addr)
+		if err != nil {
+			if errors.Is(err, syscall.EADDRINUSE) {
+				return fmt.Errorf("%s already in use, is another instance running? (find it with `ss -ltnp 'sport = :%s'`)", addr, portOf(addr))
+			}
+			return err
+		}
+		return lis.Close()
+	}
+}
+
+func portOf(addr string) string {
+	_, port, _ := net.SplitHostPort(addr)
+	return port
+}
+
+// consul agent上探测用到的方法，方便测试
+type consulProbeAgent interface {
+	ServiceRegister(service *stdconsul.AgentServiceRegistration) error
+	ServiceDeregister(serviceID string) error
+	Checks() (map[string]*stdconsul.AgentCheck, error)
+}
+
+// ConsulProbe 主动探测consul agent能否访问advertiseAddr：临时监听listenAddr，注册一个带TCP检查的临时服务，
+// 等待consul执行检查，结束后注销；超过timeout还没有结果时同样视为失败，consul地址见ConsulAddr
+// listenAddr一般就是之后grpc server监听的地址，需要先通过CheckPortFree
+func ConsulProbe(listenAddr, advertiseAddr string, timeout time.Duration) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		client, err := stdconsul.NewClient(&stdconsul.Config{
+			Address:    consulAddr(),
+			HttpClient: &http.Client{Timeout: time.Second * 2},
+			Scheme:     "http",
+		})
+		if err != nil {
+			return err
+		}
+		return consulProbe(ctx, client.Agent(), listenAddr, advertiseAddr, timeout, time.Millisecond*200)
+	}
+}
+
+func consulProbe(ctx context.Context, agent consulProbeAgent, listenAddr, advertiseAddr string, timeout, poll time.Duration) error {
+	lis, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		return err
+	}
+	defer lis.Close()
+	// TCP检查只需要完成握手
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.Close()
+		}
+	}()
+
+	id := fmt.Sprintf("gokit-preflight-%s", strings.NewReplacer(":", "-", "[", "", "]", "").Replace(advertiseAddr))
+	err = agent.ServiceRegister(&stdconsul.AgentServiceRegistration{
+		ID:   id,
+		Name: "gokit-preflight",
+		Check: &stdconsul.AgentServiceCheck{
+			TCP:      advertiseAddr,
+			Interval: "1s",
+			Timeout:  "1s",
+			// 默认为critical，与检查失败区分不开
+			Status: stdconsul.HealthWarning,
+			// 注销失败(如进程在探测期间被kill)时由consul自己清理
+			DeregisterCriticalServiceAfter: "1m",
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("consul unavailable: %v", err)
+	}
+	defer agent.ServiceDeregister(id)
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	t := time.NewTicker(poll)
+	defer t.Stop()
+	for {
+		checks, err := agent.Checks()
+		if err != nil {
+			return fmt.Errorf("consul unavailable: %v", err)
+		}
+		for _, c := range checks {
+			if c.ServiceID != id {
+				continue
+			}
+			switch c.Status {
+			case stdconsul.HealthPassing:
+				return nil
+			case stdconsul.HealthCritical:
+				return fmt.Errorf("consul agent can not reach %s: %s", advertiseAddr, strings.TrimSpace(c.Output))
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("consul agent did not check %s within %v", advertiseAddr, timeout)
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package gokit_foundation
+
+import (
+	"context"
+	stdconsul "github.com/hashicorp/consul/api"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPreflight(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+
+	free, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	freeAddr := free.Addr().String()
+	free.Close()
+
+	var p Preflight
+	p.Add("port grpc", CheckPortFree(lis.Addr().String())).
+		Add("port http", CheckPortFree(freeAddr)).
+		Add("port bad", CheckPortFree("127.0.0.1:-1"))
+	err = p.Run(context.Background())
+	e, ok := err.(*PreflightError)
+	if !ok {
+		t.Fatalf("want *PreflightError, got %v", err)
+	}
+	// 某一项失败不影响其他检查
+	if len(e.Failures) != 2 || e.Failures[0].Name != "port grpc" || e.Failures[1].Name != "port bad" {
+		t.Fatalf("got %+v", e.Failures)
+	}
+	if !strings.Contains(err.Error(), "2 check(s) failed") || !strings.Contains(err.Error(), "already in use") {
+		t.Errorf("got %s", err)
+	}
+
+	if err = new(Preflight).Add("port http", CheckPortFree(freeAddr)).Run(context.Background()); err != nil {
+		t.Errorf("want nil, got %v", err)
+	}
+}
+
+// 模拟consul agent：Checks时自己连接一次TCP检查的地址
+type fakeProbeAgent struct {
+	mu       sync.Mutex
+	services map[string]*stdconsul.AgentServiceRegistration
+}
+
+func (a *fakeProbeAgent) ServiceRegister(s *stdconsul.AgentServiceRegistration) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.services == nil {
+		a.services = map[string]*stdconsul.AgentServiceRegistration{}
+	}
+	a.services[s.ID] = s
+	return nil
+}
+
+func (a *fakeProbeAgent) ServiceDeregister(id string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.services, id)
+	return nil
+}
+
+func (a *fakeProbeAgent) Checks() (map[string]*stdconsul.AgentCheck, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	checks := map[string]*stdconsul.AgentCheck{}
+	for id, s := range a.services {
+		c := &stdconsul.AgentCheck{ServiceID: id, Status: stdconsul.HealthPassing}
+		conn, err := net.DialTimeout("tcp", s.Check.TCP, time.Second)
+		if err != nil {
+			c.Status, c.Output = stdconsul.HealthCritical, err.Error()
+		} else {
+			conn.Close()
+		}
+		checks["service:"+id] = c
+	}
+	return checks, nil
+}
+
+func TestConsulProbe(t *testing.T) {
+	free, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := free.Addr().String()
+	free.Close()
+
+	agent := &fakeProbeAgent{}
+	if err = consulProbe(context.Background(), agent, addr, addr, time.Second, time.Millisecond*10); err != nil {
+		t.Fatal(err)
+	}
+	if len(agent.services) != 0 {
+		t.Errorf("probe service not deregistered: %v", agent.services)
+	}
+
+	// advertise地址上没有监听，consul访问不到
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unreachable := closed.Addr().String()
+	closed.Close()
+	err = consulProbe(context.Background(), agent, addr, unreachable, time.Second, time.Millisecond*10)
+	if err == nil || !strings.Contains(err.Error(), "can not reach "+unreachable) {
+		t.Errorf("want unreachable err, got %v", err)
+	}
+}
@@ -0,0 +1,223 @@
+package propagation
+
+import (
+	"context"
+	grpctransport "github.com/go-kit/kit/transport/grpc"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"gokit_foundation/auth"
+	"gokit_foundation/cache"
+	"gokit_foundation/deadline"
+	"gokit_foundation/featureflag"
+	"gokit_foundation/i18n"
+	"gokit_foundation/loadshed"
+	"gokit_foundation/otel"
+	"gokit_foundation/reqid"
+	"gokit_foundation/tenant"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"net/http"
+)
+
+/*
+跨服务传递的上下文：哪些header/metadata在每一跳之间传递，由这里统一定义，所有示例服务的transport都使用它，
+避免各服务各自挑选(如某个服务漏掉了租户id，下游就会落到空租户)：
+-	server侧：HTTPServerBefore/GRPCServerBefore从请求中读取Fields的每一项写入ctx，
+	流式接口不经过grpctransport.Server，使用GRPCToContext
+-	client侧：HTTPClientBefore/GRPCClientBefore把ctx中的每一项写入下游请求，
+	server收到的ctx直接传给client即可继续传递
+-	不经过go-kit的grpc client使用UnaryClientInterceptor/StreamClientInterceptor(见gokit_foundation/grpcclient)
+-	grpc metadata的key为Headers的小写形式，HTTP转grpc的代理(如grpc-gateway)可以用GRPCHeaders决定转发哪些header
+
+每一项的读写由各自的包实现，这里只负责组合；opentracing的span需要接口名，仍由各transport按接口安装，
+Idempotency-Key只对某一次调用有效，不在这里传递(见gokit_foundation/idempotency)
+*/
+
+// Field 一项跨服务传递的上下文，某个transport的func为nil时表示不经过这种transport传递
+type Field struct {
+	Name    string
+	Headers []string // HTTP header，grpc metadata的key为其小写形式
+
+	HTTPToContext httptransport.RequestFunc
+	GRPCToContext grpctransport.ServerRequestFunc
+	ContextToHTTP httptransport.RequestFunc
+	ContextToGRPC grpctransport.ClientRequestFunc
+}
+
+// Fields 按顺序执行，在程序启动时修改(如追加自定义的项)
+var Fields = []Field{
+	{
+		// Authorization: Bearer <token>，由endpoint层的auth.JWTMiddleware校验
+		Name:          "auth",
+		Headers:       []string{"Authorization"},
+		HTTPToContext: auth.HTTPToContext(),
+		GRPCToContext: auth.GRPCToContext(),
+		ContextToHTTP: auth.ContextToHTTP(),
+		ContextToGRPC: auth.ContextToGRPC(),
+	},
+	{
+		// W3C traceparent以及baggage(当前版本的otel使用otcorrelations)，见gokit_foundation/otel
+		Name:          "trace",
+		Headers:       []string{"Traceparent", "Tracestate", "Otcorrelations"},
+		HTTPToContext: otel.HTTPToContext(),
+		GRPCToContext: otel.GRPCToContext(),
+		ContextToHTTP: otel.ContextToHTTP(),
+		ContextToGRPC: otel.ContextToGRPC(),
+	},
+	{
+		// 没有时生成一个，日志中可以串起整条调用链
+		Name:          "request_id",
+		Headers:       []string{reqid.Header},
+		HTTPToContext: reqid.HTTPToContext(),
+		GRPCToContext: reqid.GRPCToContext(),
+		ContextToHTTP: reqid.ContextToHTTP(),
+		ContextToGRPC: reqid.ContextToGRPC(),
+	},
+	{
+		// 未经校验，由tenant.Middleware确定租户
+		Name:          "tenant",
+		Headers:       []string{tenant.Header},
+		HTTPToContext: tenant.HTTPToContext(),
+		GRPCToContext: tenant.GRPCToContext(),
+		ContextToHTTP: tenant.ContextToHTTP(),
+		ContextToGRPC: tenant.ContextToGRPC(),
+	},
+	{
+		// 功能开关按用户定向，启用认证时以JWT中的sub为准
+		Name:          "subject",
+		Headers:       []string{featureflag.Header},
+		HTTPToContext: featureflag.HTTPToContext(),
+		GRPCToContext: featureflag.GRPCToContext(),
+		ContextToHTTP: featureflag.ContextToHTTP(),
+		ContextToGRPC: featureflag.ContextToGRPC(),
+	},
+	{
+		// 过载时低优先级的请求先被拒绝
+		Name:          "priority",
+		Headers:       []string{loadshed.Header},
+		HTTPToContext: loadshed.HTTPToContext(),
+		GRPCToContext: loadshed.GRPCToContext(),
+		ContextToHTTP: loadshed.ContextToHTTP(),
+		ContextToGRPC: loadshed.ContextToGRPC(),
+	},
+	{
+		// Cache-Control: no-cache时跳过endpoint层的响应缓存
+		Name:          "cache",
+		Headers:       []string{"Cache-Control"},
+		HTTPToContext: cache.HTTPToContext(),
+		GRPCToContext: cache.GRPCToContext(),
+		ContextToHTTP: cache.ContextToHTTP(),
+		ContextToGRPC: cache.ContextToGRPC(),
+	},
+	{
+		// 调用方的语言，下游返回的错误描述同样按它本地化
+		Name:          "locale",
+		Headers:       []string{i18n.Header},
+		HTTPToContext: i18n.HTTPToContext(),
+		GRPCToContext: i18n.GRPCToContext(),
+		ContextToHTTP: i18n.ContextToHTTP(),
+		ContextToGRPC: i18n.ContextToGRPC(),
+	},
+	{
+		// 调用方的剩余时间，由endpoint层的deadline.Middleware设置为deadline，grpc由grpc-timeout自动传递
+		Name:          "deadline",
+		Headers:       []string{deadline.Header},
+		HTTPToContext: deadline.HTTPToContext(),
+		ContextToHTTP: deadline.ContextToHTTP(),
+	},
+}
+
+// HTTPToContext 依次执行Fields的HTTPToContext
+func HTTPToContext() httptransport.RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		for _, f := range Fields {
+			if f.HTTPToContext != nil {
+				ctx = f.HTTPToContext(ctx, r)
+			}
+		}
+		return ctx
+	}
+}
+
+// GRPCToContext 依次执行Fields的GRPCToContext，流式接口从metadata.FromIncomingContext取得md后调用
+func GRPCToContext() grpctransport.ServerRequestFunc {
+	return func(ctx context.Context, md metadata.MD) context.Context {
+		for _, f := range Fields {
+			if f.GRPCToContext != nil {
+				ctx = f.GRPCToContext(ctx, md)
+			}
+		}
+		return ctx
+	}
+}
+
+// ContextToHTTP 依次执行Fields的ContextToHTTP
+func ContextToHTTP() httptransport.RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		for _, f := range Fields {
+			if f.ContextToHTTP != nil {
+				ctx = f.ContextToHTTP(ctx, r)
+			}
+		}
+		return ctx
+	}
+}
+
+// ContextToGRPC 依次执行Fields的ContextToGRPC
+func ContextToGRPC() grpctransport.ClientRequestFunc {
+	return func(ctx context.Context, md *metadata.MD) context.Context {
+		for _, f := range Fields {
+			if f.ContextToGRPC != nil {
+				ctx = f.ContextToGRPC(ctx, md)
+			}
+		}
+		return ctx
+	}
+}
+
+func HTTPServerBefore() httptransport.ServerOption {
+	return httptransport.ServerBefore(HTTPToContext())
+}
+
+func GRPCServerBefore() grpctransport.ServerOption {
+	return grpctransport.ServerBefore(GRPCToContext())
+}
+
+func HTTPClientBefore() httptransport.ClientOption {
+	return httptransport.ClientBefore(ContextToHTTP())
+}
+
+func GRPCClientBefore() grpctransport.ClientOption {
+	return grpctransport.ClientBefore(ContextToGRPC())
+}
+
+// UnaryClientInterceptor 直接使用grpc client的调用方使用，与GRPCClientBefore相同，
+// ctx中已有的outgoing metadata(如调用方自己设置的)被保留，同名的key被覆盖
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(outgoing(ctx), method, req, reply, cc, opts...)
+	}
+}
+
+func StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(outgoing(ctx), desc, cc, method, opts...)
+	}
+}
+
+func outgoing(ctx context.Context) context.Context {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+	ctx = ContextToGRPC()(ctx, &md)
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// GRPCHeaders 经过grpc传递的header，HTTP转grpc时将它们转为metadata(key为小写)
+func GRPCHeaders() []string {
+	var hs []string
+	for _, f := range Fields {
+		if f.GRPCToContext != nil {
+			hs = append(hs, f.Headers...)
+		}
+	}
+	return hs
+}
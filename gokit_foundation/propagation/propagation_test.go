@@ -0,0 +1,95 @@
+package propagation
+
+import (
+	"context"
+	"gokit_foundation/auth"
+	"gokit_foundation/cache"
+	"gokit_foundation/featureflag"
+	"gokit_foundation/i18n"
+	"gokit_foundation/loadshed"
+	"gokit_foundation/reqid"
+	"gokit_foundation/tenant"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// HTTP => grpc => HTTP，每一跳的server收到的ctx直接传给client
+func TestRoundTrip(t *testing.T) {
+	ctx := auth.WithToken(context.Background(), "tk")
+	ctx = reqid.WithRequestID(ctx, "rid1")
+	ctx = tenant.WithTenant(ctx, "t1")
+	ctx = featureflag.WithSubject(ctx, "u1")
+	ctx = loadshed.WithPriority(ctx, loadshed.PriorityLow)
+	ctx = cache.WithBypass(ctx)
+	ctx = i18n.WithAcceptLanguage(ctx, "zh-CN")
+
+	r := httptest.NewRequest("GET", "/", nil)
+	ContextToHTTP()(ctx, r)
+	for h, want := range map[string]string{"Authorization": "Bearer tk", reqid.Header: "rid1", tenant.Header: "t1",
+		featureflag.Header: "u1", loadshed.Header: "low", "Cache-Control": "no-cache", i18n.Header: "zh-CN"} {
+		if got := r.Header.Get(h); got != want {
+			t.Errorf("header %s got:%q want:%q", h, got, want)
+		}
+	}
+
+	// 第一跳的server
+	ctx = HTTPToContext()(context.Background(), r)
+	// 租户经tenant.Middleware校验后才会写入ctx
+	ctx = tenant.WithTenant(ctx, "t1")
+	md := metadata.MD{}
+	ContextToGRPC()(ctx, &md)
+	for h := range r.Header {
+		if got := md.Get(strings.ToLower(h)); len(got) != 1 || got[0] != r.Header.Get(h) {
+			t.Errorf("metadata %s got:%v want:%s", h, got, r.Header.Get(h))
+		}
+	}
+
+	// 第二跳的server
+	ctx = GRPCToContext()(context.Background(), md)
+	if reqid.FromContext(ctx) != "rid1" || featureflag.SubjectFromContext(ctx) != "u1" ||
+		loadshed.FromContext(ctx) != loadshed.PriorityLow || !cache.BypassFromContext(ctx) || i18n.AcceptLanguageFromContext(ctx) != "zh-CN" {
+		t.Errorf("got ctx:%v", ctx)
+	}
+	// grpc的deadline不经过header，HTTP client从ctx的deadline写入X-Request-Timeout
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	r = httptest.NewRequest("GET", "/", nil)
+	ContextToHTTP()(ctx, r)
+	if r.Header.Get("Authorization") != "Bearer tk" || r.Header.Get(reqid.Header) != "rid1" || r.Header.Get("X-Request-Timeout") == "" {
+		t.Errorf("got header:%v", r.Header)
+	}
+}
+
+func TestGRPCHeaders(t *testing.T) {
+	hs := strings.Join(GRPCHeaders(), ",")
+	if !strings.Contains(hs, tenant.Header) || !strings.Contains(hs, "Traceparent") || strings.Contains(hs, "X-Request-Timeout") {
+		t.Errorf("got headers:%s", hs)
+	}
+}
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	ctx := auth.WithToken(context.Background(), "tk")
+	ctx = tenant.WithTenant(ctx, "t1")
+	ctx = metadata.AppendToOutgoingContext(ctx, "x-other", "1")
+	var md metadata.MD
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md, _ = metadata.FromOutgoingContext(ctx)
+		return nil
+	}
+	if err := UnaryClientInterceptor()(ctx, "/a.B/C", nil, nil, nil, invoker); err != nil {
+		t.Fatal(err)
+	}
+	for k, want := range map[string]string{"authorization": "Bearer tk", "x-tenant-id": "t1", "x-other": "1"} {
+		if got := md.Get(k); len(got) != 1 || got[0] != want {
+			t.Errorf("metadata %s got:%v want:%s", k, got, want)
+		}
+	}
+	// 调用方的outgoing metadata没有被修改
+	if orig, _ := metadata.FromOutgoingContext(ctx); len(orig) != 1 {
+		t.Errorf("got orig:%v", orig)
+	}
+}
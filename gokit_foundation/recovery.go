@@ -0,0 +1,96 @@
+package gokit_foundation
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+	"gokit_foundation/errs"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"runtime/debug"
+)
+
+/*
+panic恢复，endpoint层和transport层各有一个，两者都捕获时以内层(endpoint)为准：
+-	RecoveryMiddleware 安装在endpoint链的内层(故障注入之外)，panic转为errs.Internal后经过断路器、指标等中间件，
+	与普通的系统错误一样被统计，NATS、thrift等没有transport层recover的调用也不会导致进程退出
+-	RecoveryUnaryInterceptor/RecoveryStreamInterceptor/RecoveryHTTPHandler 安装在transport的最外层，
+	捕获decode、其他拦截器中的panic，返回codes.Internal/HTTP 500
+每次panic都会打印带请求上下文(request id等)的堆栈，并在panics上计数，labels: layer(endpoint、grpc、http)、method
+*/
+
+// keyvals 附加在日志中，不作为指标的label
+func logPanic(ctx context.Context, logger log.Logger, panics metrics.Counter, layer, method string, p interface{}, keyvals ...interface{}) {
+	kvs := append([]interface{}{"msg", "panic recovered", "layer", layer, "method", method}, keyvals...)
+	LoggerWithContext(logger, ctx).Log(append(kvs, "panic", fmt.Sprint(p), "stack", string(debug.Stack()))...)
+	if panics != nil {
+		panics.With("layer", layer, "method", method).Add(1)
+	}
+}
+
+// RecoveryMiddleware 捕获method的endpoint中的panic，返回errs.Internal，panics为nil时不计数
+func RecoveryMiddleware(logger log.Logger, panics metrics.Counter, method string) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+			defer func() {
+				if p := recover(); p != nil {
+					logPanic(ctx, logger, panics, "endpoint", method, p)
+					response, err = nil, errs.Internal(fmt.Sprintf("panic: %v", p))
+				}
+			}()
+			return next(ctx, request)
+		}
+	}
+}
+
+// RecoveryUnaryInterceptor 捕获handler中的panic，打印堆栈后返回codes.Internal，避免整个进程退出
+// 应该作为最外层的拦截器(StageRecovery)
+func RecoveryUnaryInterceptor(logger log.Logger, panics metrics.Counter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (rsp interface{}, err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				logPanic(ctx, logger, panics, "grpc", info.FullMethod, p)
+				rsp, err = nil, status.Errorf(codes.Internal, "panic: %v", p)
+			}
+		}()
+		return handler(ctx, req)
+	}
+}
+
+// RecoveryStreamInterceptor 与RecoveryUnaryInterceptor相同，用于流式调用
+func RecoveryStreamInterceptor(logger log.Logger, panics metrics.Counter) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				logPanic(ss.Context(), logger, panics, "grpc", info.FullMethod, p)
+				err = status.Errorf(codes.Internal, "panic: %v", p)
+			}
+		}()
+		return handler(srv, ss)
+	}
+}
+
+// RecoveryHTTPHandler 捕获handler中的panic，返回500(errs.EncodeHTTPError的格式)
+// net/http本身也会recover，但只是断开连接，且没有请求上下文和指标
+// http.ErrAbortHandler是主动中止请求，不做处理继续panic
+func RecoveryHTTPHandler(logger log.Logger, panics metrics.Counter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				if p := recover(); p != nil {
+					if p == http.ErrAbortHandler {
+						panic(p)
+					}
+					// path可能包含id等，只记录在日志中
+					logPanic(r.Context(), logger, panics, "http", r.Method, p, "path", r.URL.Path)
+					errs.EncodeHTTPError(r.Context(), errs.Internal("panic"), w)
+				}
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
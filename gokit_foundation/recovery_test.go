@@ -0,0 +1,92 @@
+package gokit_foundation
+
+import (
+	"context"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+	"gokit_foundation/errs"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// 忽略标签，累加所有的Add(generic.Counter的With返回的是副本)
+type sumCounter struct{ v float64 }
+
+func (c *sumCounter) With(...string) metrics.Counter { return c }
+func (c *sumCounter) Add(delta float64)              { c.v += delta }
+
+func TestRecoveryUnaryInterceptor(t *testing.T) {
+	panics := &sumCounter{}
+	chain := ChainUnaryInterceptors(RecoveryUnaryInterceptor(log.NewNopLogger(), panics), LoggingUnaryInterceptor(log.NewNopLogger()))
+	_, err := chain(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/test/Method"}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		panic("decode failed")
+	})
+	if status.Code(err) != codes.Internal {
+		t.Errorf("want codes.Internal, got err:%v", err)
+	}
+	if panics.v != 1 {
+		t.Errorf("got panics:%v", panics.v)
+	}
+}
+
+type testServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *testServerStream) Context() context.Context { return s.ctx }
+
+func TestRecoveryStreamInterceptor(t *testing.T) {
+	panics := &sumCounter{}
+	interceptor := RecoveryStreamInterceptor(log.NewNopLogger(), panics)
+	err := interceptor(nil, &testServerStream{ctx: context.Background()}, &grpc.StreamServerInfo{FullMethod: "/test/Stream"},
+		func(srv interface{}, ss grpc.ServerStream) error { panic("boom") })
+	if status.Code(err) != codes.Internal || panics.v != 1 {
+		t.Errorf("got err:%v panics:%v", err, panics.v)
+	}
+}
+
+func TestRecoveryHTTPHandler(t *testing.T) {
+	panics := &sumCounter{}
+	h := RecoveryHTTPHandler(log.NewNopLogger(), panics)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/1", nil))
+	if w.Code != http.StatusInternalServerError || panics.v != 1 {
+		t.Errorf("got code:%d panics:%v", w.Code, panics.v)
+	}
+
+	// ErrAbortHandler继续向上panic，交给net/http处理
+	h = RecoveryHTTPHandler(log.NewNopLogger(), panics)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	defer func() {
+		if p := recover(); p != http.ErrAbortHandler || panics.v != 1 {
+			t.Errorf("got panic:%v panics:%v", p, panics.v)
+		}
+	}()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
+
+func TestRecoveryMiddleware(t *testing.T) {
+	panics := &sumCounter{}
+	ep := RecoveryMiddleware(log.NewNopLogger(), panics, "Sum")(func(context.Context, interface{}) (interface{}, error) {
+		panic("boom")
+	})
+	rsp, err := ep(context.Background(), nil)
+	if rsp != nil || errs.KindOf(err) != errs.KindInternal || panics.v != 1 {
+		t.Errorf("got rsp:%v err:%v panics:%v", rsp, err, panics.v)
+	}
+	// panics为nil时不计数
+	ep = RecoveryMiddleware(log.NewNopLogger(), nil, "Sum")(func(context.Context, interface{}) (interface{}, error) {
+		panic("boom")
+	})
+	if _, err = ep(context.Background(), nil); errs.KindOf(err) != errs.KindInternal {
+		t.Errorf("got err:%v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package gokit_foundation
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"os"
+	"time"
+)
+
+/*
+服务注册的抽象，后端可选consul、etcd或k8s：
+-	consul：实例由consul通过grpc健康检查判断是否存活，或者由实例定期上报TTL检查(见ConsulRegisterOptions)
+-	etcd：实例key绑定lease，由KeepRegistered定期续约，进程挂掉后lease过期自动删除
+-	k8s：实例由k8s根据readinessProbe维护在headless service中，见k8s.go
+后端由NewRegistry的参数指定，为空时读取环境变量SD_BACKEND，仍为空时使用consul
+*/
+
+const (
+	SDBackendConsul = "consul"
+	SDBackendEtcd   = "etcd"
+)
+
+type Registry interface {
+	// 注册实例，重复调用时只注册一次
+	Register(svcName, svcHost string, port int, tags []string) error
+	// 注销实例，未注册时直接返回nil
+	Deregister() error
+	// 已注册的实例ID，未注册时为空
+	ID() string
+	// 保持注册状态直到ctx结束，注册信息丢失时重新注册，interval为检查间隔，失败时从backoff开始翻倍重试
+	KeepRegistered(ctx context.Context, logger log.Logger, interval, backoff time.Duration) error
+}
+
+func NewRegistry(backend string) (Registry, error) {
+	if backend == "" {
+		backend = os.Getenv("SD_BACKEND")
+	}
+	switch backend {
+	case "", SDBackendConsul:
+		return NewConsulRegistry(ConsulRegisterOptions{}), nil
+	case SDBackendEtcd:
+		return NewEtcdRegistry(etcdAddr()), nil
+	case SDBackendK8s:
+		return k8sRegistry{}, nil
+	}
+	return nil, fmt.Errorf("unknown sd backend %q, want %s, %s or %s", backend, SDBackendConsul, SDBackendEtcd, SDBackendK8s)
+}
+
+// 使用consul.go中的默认consul注册
+type consulRegistry struct {
+	opts ConsulRegisterOptions
+}
+
+// NewConsulRegistry Register的tags追加在opts.Tags之后
+func NewConsulRegistry(opts ConsulRegisterOptions) Registry {
+	return consulRegistry{opts: opts}
+}
+
+func (r consulRegistry) Register(svcName, svcHost string, port int, tags []string) error {
+	opts := r.opts
+	opts.Tags = append(append([]string{}, opts.Tags...), tags...)
+	return RegisterSvcWithOptions(svcName, svcHost, port, opts)
+}
+
+func (consulRegistry) Deregister() error {
+	return ConsulDeregister()
+}
+
+func (consulRegistry) ID() string {
+	if defRegistration == nil {
+		return ""
+	}
+	return defRegistration.ID
+}
+
+func (consulRegistry) KeepRegistered(ctx context.Context, logger log.Logger, interval, backoff time.Duration) error {
+	return ConsulKeepRegistered(ctx, logger, interval, backoff)
+}
+
+// 注销失败时实例会作为"幽灵"残留在注册中心（consul直到健康检查失败达到DeregisterCriticalServiceAfter，etcd直到lease过期），所以这里需要重试
+// retry为失败后的重试次数，backoff为首次重试前的等待时间，之后每次翻倍
+func DeregisterWithRetry(r Registry, logger log.Logger, retry int, backoff time.Duration) (err error) {
+	for i := 0; i <= retry; i++ {
+		if i > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		if err = r.Deregister(); err == nil {
+			return nil
+		}
+		logger.Log("Deregister", "failed", "attempt", i+1, "err", err)
+	}
+	logger.Log("Deregister", "==================== WARNING ====================")
+	logger.Log("Deregister", "gave up", "svc_id", r.ID(), "err", err, "hint", "实例可能残留在注册中心，请检查并手动注销")
+	logger.Log("Deregister", "=================================================")
+	return err
+}
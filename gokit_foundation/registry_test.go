@@ -0,0 +1,18 @@
+package gokit_foundation
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestNewRegistry(t *testing.T) {
+	for backend, want := range map[string]string{"": "gokit_foundation.consulRegistry", "consul": "gokit_foundation.consulRegistry", "etcd": "*gokit_foundation.EtcdRegistry", "k8s": "gokit_foundation.k8sRegistry"} {
+		r, err := NewRegistry(backend)
+		if err != nil || fmt.Sprintf("%T", r) != want {
+			t.Errorf("backend:%q got:%T err:%v", backend, r, err)
+		}
+	}
+	if _, err := NewRegistry("zk"); err == nil {
+		t.Error("want err for unknown backend")
+	}
+}
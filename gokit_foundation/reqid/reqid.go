@@ -0,0 +1,155 @@
+package reqid
+
+import (
+	"context"
+	grpctransport "github.com/go-kit/kit/transport/grpc"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"gokit_foundation"
+	"gokit_foundation/idgen"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"net/http"
+)
+
+/*
+request id(correlation id)的传递，一次请求经过的所有服务使用同一个id，日志中按request_id即可串起整条调用链：
+-	server：从X-Request-Id header(grpc metadata为x-request-id)读取，没有或不合法时生成一个，写入ctx(gokit_foundation.CtxKeyRequestID)
+-	client：将ctx中的id写入header/metadata，传给下游服务
+日志自动带上request_id需要先注册：gokit_foundation.RegisterLogContextKey("request_id", gokit_foundation.CtxKeyRequestID)
+*/
+
+const (
+	Header = "X-Request-Id"
+	mdKey  = "x-request-id" // grpc metadata的key是小写的
+	maxLen = 64
+)
+
+// New 生成一个16位十六进制的id
+func New() string {
+	return idGen.NewID()
+}
+
+var idGen = idgen.Random(8)
+
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, gokit_foundation.CtxKeyRequestID, id)
+}
+
+// FromContext ctx中没有id时返回空字符串
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(gokit_foundation.CtxKeyRequestID).(string)
+	return id
+}
+
+// id来自调用方，会原样写入日志，只接受有限长度的常见字符，避免日志注入
+func valid(id string) bool {
+	if id == "" || len(id) > maxLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == ':') {
+			return false
+		}
+	}
+	return true
+}
+
+// ensure ctx中已有id(如外层的中间件已处理)时直接返回，否则使用id，id不合法时生成一个新的
+func ensure(ctx context.Context, id string) (context.Context, string) {
+	if cur := FromContext(ctx); cur != "" {
+		return ctx, cur
+	}
+	if !valid(id) {
+		id = New()
+	}
+	return WithRequestID(ctx, id), id
+}
+
+// HTTPToContext 用于httptransport.ServerBefore
+func HTTPToContext() httptransport.RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		ctx, _ = ensure(ctx, r.Header.Get(Header))
+		return ctx
+	}
+}
+
+// GRPCToContext 用于grpctransport.ServerBefore
+func GRPCToContext() grpctransport.ServerRequestFunc {
+	return func(ctx context.Context, md metadata.MD) context.Context {
+		var id string
+		if vs := md.Get(mdKey); len(vs) > 0 {
+			id = vs[0]
+		}
+		ctx, _ = ensure(ctx, id)
+		return ctx
+	}
+}
+
+// ContextToHTTP 用于httptransport.ClientBefore
+func ContextToHTTP() httptransport.RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		if id := FromContext(ctx); id != "" {
+			r.Header.Set(Header, id)
+		}
+		return ctx
+	}
+}
+
+// ContextToGRPC 用于grpctransport.ClientBefore
+func ContextToGRPC() grpctransport.ClientRequestFunc {
+	return func(ctx context.Context, md *metadata.MD) context.Context {
+		if id := FromContext(ctx); id != "" {
+			md.Set(mdKey, id)
+		}
+		return ctx
+	}
+}
+
+// HTTPMiddleware 安装在mux和访问日志外层，在请求处理之前写入ctx，同时写入响应header方便调用方排查问题
+func HTTPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, id := ensure(r.Context(), r.Header.Get(Header))
+		w.Header().Set(Header, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// UnaryServerInterceptor 安装在日志拦截器外层(见gokit_foundation.ChainUnaryInterceptors)，使得拦截器和transport层的日志都带上request_id
+// id同时写入响应header metadata
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		var id string
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if vs := md.Get(mdKey); len(vs) > 0 {
+				id = vs[0]
+			}
+		}
+		ctx, id = ensure(ctx, id)
+		_ = grpc.SetHeader(ctx, metadata.Pairs(mdKey, id))
+		return handler(ctx, req)
+	}
+}
+
+// UnaryClientInterceptor 直接使用grpc client(不经过go-kit endpoint)的调用方使用，ctx中没有id时生成一个，
+// 安装在重试外层(见gokit_foundation/grpcclient)，所有重试使用同一个id
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(outgoing(ctx), method, req, reply, cc, opts...)
+	}
+}
+
+func StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(outgoing(ctx), desc, cc, method, opts...)
+	}
+}
+
+// 写入ctx和outgoing metadata，已有的metadata不被修改
+func outgoing(ctx context.Context) context.Context {
+	ctx, id := ensure(ctx, "")
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+	md.Set(mdKey, id)
+	return metadata.NewOutgoingContext(ctx, md)
+}
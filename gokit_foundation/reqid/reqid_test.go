@@ -0,0 +1,111 @@
+package reqid
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestHTTPMiddleware(t *testing.T) {
+	var got string
+	h := HTTPMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = FromContext(r.Context())
+	}))
+	for name, c := range map[string]struct {
+		in       string
+		generate bool
+	}{
+		"extract":   {"abc-123", false},
+		"missing":   {"", true},
+		"too long":  {strings.Repeat("a", maxLen+1), true},
+		"injection": {"a\nlevel=error", true},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if c.in != "" {
+			r.Header.Set(Header, c.in)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if got == "" || w.Header().Get(Header) != got {
+			t.Errorf("%s: ctx id:%q header:%q", name, got, w.Header().Get(Header))
+		}
+		if (got != c.in) != c.generate {
+			t.Errorf("%s: got id:%q", name, got)
+		}
+	}
+}
+
+// 外层已写入ctx的id不被覆盖
+func TestKeepExisting(t *testing.T) {
+	ctx := WithRequestID(context.Background(), "outer")
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(Header, "inner")
+	if id := FromContext(HTTPToContext()(ctx, r)); id != "outer" {
+		t.Errorf("http got:%s", id)
+	}
+	if id := FromContext(GRPCToContext()(ctx, metadata.Pairs(mdKey, "inner"))); id != "outer" {
+		t.Errorf("grpc got:%s", id)
+	}
+}
+
+// client写入的id在server端被读取
+func TestPropagate(t *testing.T) {
+	ctx := WithRequestID(context.Background(), "abc")
+
+	md := metadata.MD{}
+	ContextToGRPC()(ctx, &md)
+	if id := FromContext(GRPCToContext()(context.Background(), md)); id != "abc" {
+		t.Errorf("grpc got:%s", id)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	ContextToHTTP()(ctx, r)
+	if id := FromContext(HTTPToContext()(context.Background(), r)); id != "abc" {
+		t.Errorf("http got:%s", id)
+	}
+
+	// ctx中没有id时不写入
+	md = metadata.MD{}
+	ContextToGRPC()(context.Background(), &md)
+	if len(md) != 0 {
+		t.Errorf("got md:%v", md)
+	}
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	var got string
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		got = FromContext(ctx)
+		return nil, nil
+	}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(mdKey, "abc"))
+	if _, err := UnaryServerInterceptor()(ctx, nil, &grpc.UnaryServerInfo{}, handler); err != nil || got != "abc" {
+		t.Errorf("got id:%s err:%v", got, err)
+	}
+	if _, _ = UnaryServerInterceptor()(context.Background(), nil, &grpc.UnaryServerInfo{}, handler); len(got) != 16 {
+		t.Errorf("generated id:%s", got)
+	}
+}
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	var got []string
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		got = append(md.Get(mdKey), FromContext(ctx))
+		return nil
+	}
+	ctx := metadata.AppendToOutgoingContext(WithRequestID(context.Background(), "abc"), "x-other", "1")
+	if err := UnaryClientInterceptor()(ctx, "/a.B/C", nil, nil, nil, invoker); err != nil || len(got) != 2 || got[0] != "abc" || got[1] != "abc" {
+		t.Errorf("got:%v err:%v", got, err)
+	}
+	// 没有id时生成一个，metadata与ctx中的相同
+	_ = UnaryClientInterceptor()(context.Background(), "/a.B/C", nil, nil, nil, invoker)
+	if len(got) != 2 || len(got[0]) != 16 || got[0] != got[1] {
+		t.Errorf("generated:%v", got)
+	}
+}
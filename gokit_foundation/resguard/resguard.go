@@ -0,0 +1,323 @@
+package resguard
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
+	"gokit_foundation/clock"
+	"gokit_foundation/errs"
+	"gokit_foundation/loadshed"
+	"io"
+	"net/http"
+	"os"
+	"runtime/pprof"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+goroutine数、打开的fd数、内存的软上限，在被OOM kill或fd耗尽之前自我保护：
+-	Guard.Run作为后台任务每Interval采样一次，使用量和上限上报为指标(labels: resource)
+-	使用量达到上限时该资源进入超限状态，降到上限的ResumeRatio以下才恢复(避免在上限附近反复切换)
+-	超限时执行Config.Actions中的动作：
+	-	reject：Middleware拒绝新请求(critical优先级除外，见loadshed.Priority)，返回可重试的Unavailable错误
+	-	dump：把goroutine堆栈(按堆栈合并)写入stderr，每个资源超限时写一次，两次之间至少间隔DumpInterval
+	-	restart：持续超限RestartAfter后调用restart(如平滑升级，启动新进程接管监听)，失败时再过RestartAfter重试
+-	MaxFDs、MaxMemory为0时使用系统上限(RLIMIT_NOFILE、cgroup内存上限)的LimitRatio，取不到系统上限时不检查
+-	内存为go runtime从系统申请且未归还的内存(/memory/classes/total减去已释放的heap)，不包括cgo等runtime之外的内存
+fd数和系统上限从/proc、/sys/fs/cgroup读取，只在linux上可用，其他系统上只检查goroutine数和设置了MaxMemory时的内存
+*/
+
+type Action string
+
+const (
+	ActionReject  Action = "reject"
+	ActionDump    Action = "dump"
+	ActionRestart Action = "restart"
+)
+
+func ParseAction(s string) (Action, error) {
+	switch a := Action(strings.ToLower(s)); a {
+	case ActionReject, ActionDump, ActionRestart:
+		return a, nil
+	}
+	return "", fmt.Errorf("resguard: unknown action %q", s)
+}
+
+const (
+	ResourceGoroutines = "goroutines"
+	ResourceFDs        = "fds"
+	ResourceMemory     = "memory"
+)
+
+var resources = []string{ResourceGoroutines, ResourceFDs, ResourceMemory}
+
+const (
+	DefaultInterval     = 5 * time.Second
+	DefaultRestartAfter = 30 * time.Second
+	DumpInterval        = time.Minute
+	ResumeRatio         = 0.9
+)
+
+// Config 各上限为0时不检查(MaxFDs、MaxMemory见LimitRatio)，Actions为空时只上报指标
+type Config struct {
+	MaxGoroutines int
+	MaxFDs        int
+	MaxMemory     uint64  // 字节
+	LimitRatio    float64 // MaxFDs、MaxMemory为0时使用系统上限的这个比例(0~1)，为0时不使用系统上限
+	Interval      time.Duration
+	RestartAfter  time.Duration
+	Actions       []Action
+}
+
+func (c Config) has(a Action) bool {
+	for _, x := range c.Actions {
+		if x == a {
+			return true
+		}
+	}
+	return false
+}
+
+func (c Config) Validate() error {
+	if c.MaxGoroutines < 0 || c.MaxFDs < 0 {
+		return fmt.Errorf("resguard: max_goroutines and max_fds must not be negative")
+	}
+	if c.LimitRatio < 0 || c.LimitRatio > 1 {
+		return fmt.Errorf("resguard: limit_ratio %v must be in [0, 1]", c.LimitRatio)
+	}
+	if c.Interval < 0 || c.RestartAfter < 0 {
+		return fmt.Errorf("resguard: interval and restart_after must not be negative")
+	}
+	return nil
+}
+
+// Usage 一次采样的结果，FDs为-1表示取不到
+type Usage struct {
+	Goroutines int    `json:"goroutines"`
+	FDs        int    `json:"fds"`
+	Memory     uint64 `json:"memory"`
+}
+
+func (u Usage) of(resource string) float64 {
+	switch resource {
+	case ResourceGoroutines:
+		return float64(u.Goroutines)
+	case ResourceFDs:
+		return float64(u.FDs)
+	}
+	return float64(u.Memory)
+}
+
+// 系统上限，为0表示取不到
+type sysLimits struct {
+	fds    int
+	memory uint64
+}
+
+// Metrics 为nil的字段不上报
+type Metrics struct {
+	Usage   metrics.Gauge   // labels: resource
+	Limit   metrics.Gauge   // 生效的上限，0为不检查，labels: resource
+	Tripped metrics.Gauge   // 1为超限，labels: resource
+	Actions metrics.Counter // 执行的动作数(reject为拒绝的请求数)，labels: action
+}
+
+// 被拒绝时返回的err为它的副本(带上RetryAfter)，进程内可以用errors.Is判断
+var ErrOverLimit = errs.Unavailable("resource soft limit exceeded, retry later")
+
+type Guard struct {
+	conf    func() Config
+	logger  log.Logger
+	restart func() error
+	clock   clock.Clock
+	sample  func() Usage
+	sys     sysLimits
+	dumpTo  io.Writer
+
+	usage, limit, tripped metrics.Gauge
+	actions               map[Action]metrics.Counter
+
+	rejecting  int32 // 有资源超限且配置了reject
+	retryAfter int64 // 拒绝时建议的重试间隔(采样间隔)，纳秒
+
+	mu       sync.Mutex
+	last     Usage
+	limits   map[string]float64
+	since    map[string]time.Time // 超限的资源 => 开始超限(或上次restart)的时间
+	lastDump time.Time
+}
+
+// New conf每次采样时调用(热更新下一次采样生效)，restart为nil时忽略restart动作
+func New(conf func() Config, logger log.Logger, restart func() error, m Metrics) *Guard {
+	g := &Guard{
+		conf: conf, logger: logger, restart: restart, clock: clock.Real,
+		sample: sample, sys: readSysLimits(), dumpTo: os.Stderr,
+		usage: m.Usage, limit: m.Limit, tripped: m.Tripped,
+		limits: map[string]float64{}, since: map[string]time.Time{},
+	}
+	if g.usage == nil {
+		g.usage = discard.NewGauge()
+	}
+	if g.limit == nil {
+		g.limit = discard.NewGauge()
+	}
+	if g.tripped == nil {
+		g.tripped = discard.NewGauge()
+	}
+	if m.Actions == nil {
+		m.Actions = discard.NewCounter()
+	}
+	g.actions = map[Action]metrics.Counter{}
+	for _, a := range []Action{ActionReject, ActionDump, ActionRestart} {
+		g.actions[a] = m.Actions.With("action", string(a))
+	}
+	return g
+}
+
+func (g *Guard) effectiveLimits(c Config) map[string]float64 {
+	l := map[string]float64{
+		ResourceGoroutines: float64(c.MaxGoroutines),
+		ResourceFDs:        float64(c.MaxFDs),
+		ResourceMemory:     float64(c.MaxMemory),
+	}
+	if c.MaxFDs == 0 && g.sys.fds > 0 {
+		l[ResourceFDs] = float64(g.sys.fds) * c.LimitRatio
+	}
+	if c.MaxMemory == 0 && g.sys.memory > 0 {
+		l[ResourceMemory] = float64(g.sys.memory) * c.LimitRatio
+	}
+	return l
+}
+
+// Run 每Interval采样一次直到ctx结束，用于TaskGroup
+func (g *Guard) Run(ctx context.Context) error {
+	for {
+		interval := g.Check()
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Check 采样一次并执行需要的动作，返回下一次采样的间隔
+func (g *Guard) Check() time.Duration {
+	c := g.conf()
+	interval := c.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	restartAfter := c.RestartAfter
+	if restartAfter <= 0 {
+		restartAfter = DefaultRestartAfter
+	}
+	u := g.sample()
+	limits := g.effectiveLimits(c)
+	now := g.clock.Now()
+
+	g.mu.Lock()
+	g.last, g.limits = u, limits
+	var newly []string
+	restart := false
+	for _, r := range resources {
+		used, limit := u.of(r), limits[r]
+		g.usage.With("resource", r).Set(used)
+		g.limit.With("resource", r).Set(limit)
+		since, over := g.since[r]
+		switch {
+		case limit <= 0 || used < 0 || (over && used < limit*ResumeRatio):
+			if over {
+				delete(g.since, r)
+				g.logger.Log("resguard", "recovered", "resource", r, "usage", used, "limit", limit)
+			}
+		case !over && used >= limit:
+			g.since[r] = now
+			newly = append(newly, r)
+			g.logger.Log("resguard", "limit exceeded", "resource", r, "usage", used, "limit", limit, "actions", fmt.Sprint(c.Actions))
+		case over && now.Sub(since) >= restartAfter && c.has(ActionRestart) && g.restart != nil:
+			g.since[r] = now
+			restart = true
+		}
+		_, over = g.since[r]
+		g.tripped.With("resource", r).Set(boolGauge(over))
+	}
+	dump := len(newly) > 0 && c.has(ActionDump) && (g.lastDump.IsZero() || now.Sub(g.lastDump) >= DumpInterval)
+	if dump {
+		g.lastDump = now
+	}
+	rejecting := len(g.since) > 0 && c.has(ActionReject)
+	g.mu.Unlock()
+
+	atomic.StoreInt64(&g.retryAfter, int64(interval))
+	var v int32
+	if rejecting {
+		v = 1
+	}
+	atomic.StoreInt32(&g.rejecting, v)
+	if dump {
+		g.actions[ActionDump].Add(1)
+		g.logger.Log("resguard", "dump goroutines", "resources", strings.Join(newly, ","), "err", pprof.Lookup("goroutine").WriteTo(g.dumpTo, 1))
+	}
+	// restart返回(如平滑升级的新进程就绪或超时)之后才进行下一次采样
+	if restart {
+		g.actions[ActionRestart].Add(1)
+		err := g.restart()
+		g.logger.Log("resguard", "restart", "err", err)
+	}
+	return interval
+}
+
+func boolGauge(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Rejecting 是否正在拒绝新请求
+func (g *Guard) Rejecting() bool {
+	return atomic.LoadInt32(&g.rejecting) == 1
+}
+
+// Middleware 超限且配置了reject时拒绝critical以外的请求
+func (g *Guard) Middleware(method string) endpoint.Middleware {
+	rejected := g.actions[ActionReject]
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			if g.Rejecting() && loadshed.FromContext(ctx) != loadshed.PriorityCritical {
+				rejected.Add(1)
+				return nil, ErrOverLimit.WithRetryAfter(time.Duration(atomic.LoadInt64(&g.retryAfter))).Wrap(ErrOverLimit)
+			}
+			return next(ctx, request)
+		}
+	}
+}
+
+type state struct {
+	Usage     Usage              `json:"usage"`
+	Limits    map[string]float64 `json:"limits"`
+	Tripped   map[string]string  `json:"tripped"` // 资源 => 开始超限的时间
+	Rejecting bool               `json:"rejecting"`
+}
+
+// Handler 最近一次采样的使用量、生效的上限和超限的资源，用于管理端口
+func (g *Guard) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		g.mu.Lock()
+		s := state{Usage: g.last, Limits: g.limits, Tripped: map[string]string{}, Rejecting: g.Rejecting()}
+		for r, t := range g.since {
+			s.Tripped[r] = t.Format(time.RFC3339)
+		}
+		g.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(s)
+	})
+}
@@ -0,0 +1,207 @@
+package resguard
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/go-kit/kit/log"
+	"gokit_foundation/clock"
+	"gokit_foundation/errs"
+	"gokit_foundation/loadshed"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestGuard(conf Config, usage *Usage, restart func() error) (*Guard, *clock.Fake, *bytes.Buffer) {
+	g := New(func() Config { return conf }, log.NewNopLogger(), restart, Metrics{})
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	dump := new(bytes.Buffer)
+	g.clock, g.sample, g.sys, g.dumpTo = clk, func() Usage { return *usage }, sysLimits{}, dump
+	return g, clk, dump
+}
+
+func TestReject(t *testing.T) {
+	usage := &Usage{Goroutines: 50, FDs: -1}
+	g, _, _ := newTestGuard(Config{MaxGoroutines: 100, Interval: time.Second, Actions: []Action{ActionReject}}, usage, nil)
+	ep := g.Middleware("Sum")(func(context.Context, interface{}) (interface{}, error) { return "ok", nil })
+	call := func(p loadshed.Priority) error {
+		_, err := ep(loadshed.WithPriority(context.Background(), p), nil)
+		return err
+	}
+
+	g.Check()
+	if g.Rejecting() || call(loadshed.PriorityNormal) != nil {
+		t.Fatal("rejected under the limit")
+	}
+	usage.Goroutines = 100
+	g.Check()
+	err := call(loadshed.PriorityHigh)
+	if !errors.Is(err, ErrOverLimit) || !errs.IsRetryable(err) || errs.RetryAfterOf(err) != time.Second {
+		t.Fatalf("got err:%v", err)
+	}
+	if err := call(loadshed.PriorityCritical); err != nil {
+		t.Errorf("critical got err:%v", err)
+	}
+	// 降到ResumeRatio以下才恢复
+	usage.Goroutines = 95
+	g.Check()
+	if !g.Rejecting() {
+		t.Error("resumed above ResumeRatio")
+	}
+	usage.Goroutines = 89
+	g.Check()
+	if g.Rejecting() || call(loadshed.PriorityNormal) != nil {
+		t.Error("still rejecting")
+	}
+}
+
+func TestNoActions(t *testing.T) {
+	usage := &Usage{Goroutines: 200, FDs: -1}
+	g, _, dump := newTestGuard(Config{MaxGoroutines: 100}, usage, nil)
+	g.Check()
+	if g.Rejecting() || dump.Len() != 0 {
+		t.Errorf("rejecting:%v dump:%d", g.Rejecting(), dump.Len())
+	}
+	rec := httptest.NewRecorder()
+	g.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/resguard", nil))
+	if body := rec.Body.String(); !strings.Contains(body, `"goroutines":200`) || !strings.Contains(body, `"tripped":{"goroutines"`) {
+		t.Errorf("got %s", body)
+	}
+}
+
+func TestDump(t *testing.T) {
+	usage := &Usage{FDs: 10}
+	g, clk, dump := newTestGuard(Config{MaxFDs: 10, Actions: []Action{ActionDump}}, usage, nil)
+	g.Check()
+	if !strings.Contains(dump.String(), "goroutine profile:") {
+		t.Fatalf("got dump %q", dump.String())
+	}
+	// 仍然超限时不再写
+	n := dump.Len()
+	g.Check()
+	// 恢复后很快再次超限，间隔不足DumpInterval
+	usage.FDs = 1
+	g.Check()
+	usage.FDs = 10
+	clk.Advance(DumpInterval / 2)
+	g.Check()
+	if dump.Len() != n {
+		t.Errorf("dumped again within DumpInterval")
+	}
+	usage.FDs = 1
+	g.Check()
+	usage.FDs = 10
+	clk.Advance(DumpInterval)
+	g.Check()
+	if dump.Len() == n {
+		t.Errorf("not dumped after DumpInterval")
+	}
+}
+
+func TestRestart(t *testing.T) {
+	usage := &Usage{Memory: 2 << 20, FDs: -1}
+	var restarts int
+	restartErr := errors.New("new process not ready")
+	g, clk, _ := newTestGuard(Config{MaxMemory: 1 << 20, RestartAfter: time.Minute, Actions: []Action{ActionRestart}}, usage,
+		func() error { restarts++; return restartErr })
+	g.Check()
+	clk.Advance(time.Minute - time.Second)
+	g.Check()
+	if restarts != 0 {
+		t.Fatalf("restarted after %d checks", restarts)
+	}
+	clk.Advance(time.Second)
+	g.Check()
+	if restarts != 1 {
+		t.Fatalf("got %d restarts", restarts)
+	}
+	// 失败后再过RestartAfter重试
+	clk.Advance(time.Second)
+	g.Check()
+	clk.Advance(time.Minute)
+	g.Check()
+	if restarts != 2 {
+		t.Errorf("got %d restarts", restarts)
+	}
+}
+
+func TestLimitRatio(t *testing.T) {
+	usage := &Usage{FDs: 850, Memory: 850}
+	g, _, _ := newTestGuard(Config{LimitRatio: 0.8, Actions: []Action{ActionReject}}, usage, nil)
+	g.Check()
+	if g.Rejecting() {
+		t.Fatal("rejected without system limits")
+	}
+	g.sys = sysLimits{fds: 1000, memory: 2000}
+	g.Check()
+	if !g.Rejecting() || g.limits[ResourceFDs] != 800 || g.limits[ResourceMemory] != 1600 {
+		t.Errorf("rejecting:%v limits:%v", g.Rejecting(), g.limits)
+	}
+}
+
+func TestSample(t *testing.T) {
+	u := sample()
+	if u.Goroutines <= 0 || u.Memory == 0 {
+		t.Errorf("got %+v", u)
+	}
+	if _, err := os.Stat("/proc/self/fd"); err == nil && u.FDs <= 0 {
+		t.Errorf("got fds %d", u.FDs)
+	}
+}
+
+func TestSysLimits(t *testing.T) {
+	dir, err := ioutil.TempDir("", "resguard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name, s string) {
+		_ = os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755)
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(s), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("limits", "Limit                     Soft Limit           Hard Limit           Units\n"+
+		"Max processes             63436                63436                processes\n"+
+		"Max open files            1024                 524288               files\n")
+	if n := fdLimit(filepath.Join(dir, "limits")); n != 1024 {
+		t.Errorf("got fd limit %d", n)
+	}
+	if n := fdLimit(filepath.Join(dir, "missing")); n != 0 {
+		t.Errorf("got fd limit %d", n)
+	}
+
+	for _, tt := range []struct {
+		file, content string
+		want          uint64
+	}{
+		{"v2/memory.max", "536870912\n", 512 << 20},
+		{"v2max/memory.max", "max\n", 0},
+		{"v1/memory/memory.limit_in_bytes", "268435456\n", 256 << 20},
+		{"v1max/memory/memory.limit_in_bytes", "9223372036854771712\n", 0},
+	} {
+		write(tt.file, tt.content)
+		root := filepath.Join(dir, strings.SplitN(tt.file, "/", 2)[0])
+		if got := cgroupMemoryLimit(root); got != tt.want {
+			t.Errorf("%s got %d, want %d", tt.file, got, tt.want)
+		}
+	}
+	if got := cgroupMemoryLimit(filepath.Join(dir, "none")); got != 0 {
+		t.Errorf("got %d", got)
+	}
+}
+
+func TestParseAction(t *testing.T) {
+	if a, err := ParseAction("Restart"); err != nil || a != ActionRestart {
+		t.Errorf("got %q err:%v", a, err)
+	}
+	if _, err := ParseAction("kill"); err == nil {
+		t.Error("want err")
+	}
+}
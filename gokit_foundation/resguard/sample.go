@@ -0,0 +1,83 @@
+package resguard
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"runtime/metrics"
+	"strconv"
+	"strings"
+)
+
+var memSamples = []string{"/memory/classes/total:bytes", "/memory/classes/heap/released:bytes"}
+
+func sample() Usage {
+	u := Usage{Goroutines: runtime.NumGoroutine(), FDs: -1}
+	if n, err := openFDs(); err == nil {
+		u.FDs = n
+	}
+	s := []metrics.Sample{{Name: memSamples[0]}, {Name: memSamples[1]}}
+	metrics.Read(s)
+	if s[0].Value.Kind() == metrics.KindUint64 && s[1].Value.Kind() == metrics.KindUint64 {
+		u.Memory = s[0].Value.Uint64() - s[1].Value.Uint64()
+	}
+	return u
+}
+
+// 不包括读目录时打开的fd
+func openFDs() (int, error) {
+	f, err := os.Open("/proc/self/fd")
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	names, err := f.Readdirnames(-1)
+	if err != nil {
+		return 0, err
+	}
+	return len(names) - 1, nil
+}
+
+func readSysLimits() sysLimits {
+	return sysLimits{fds: fdLimit("/proc/self/limits"), memory: cgroupMemoryLimit("/sys/fs/cgroup")}
+}
+
+// Max open files的soft limit，unlimited或取不到时为0
+func fdLimit(path string) int {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		// Max open files            1048576              1048576              files
+		if rest := strings.TrimPrefix(s.Text(), "Max open files"); rest != s.Text() {
+			if fields := strings.Fields(rest); len(fields) > 0 {
+				n, _ := strconv.Atoi(fields[0])
+				return n
+			}
+		}
+	}
+	return 0
+}
+
+// 超过它的v1 memory.limit_in_bytes表示不限制(页对齐后的int64最大值)
+const cgroupV1Unlimited = 1 << 62
+
+// cgroup v2的memory.max或v1的memory/memory.limit_in_bytes，不限制或取不到时为0
+func cgroupMemoryLimit(root string) uint64 {
+	for _, path := range []string{root + "/memory.max", root + "/memory/memory.limit_in_bytes"} {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		n, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+		if err != nil || n >= cgroupV1Unlimited { // v2不限制时为"max"
+			return 0
+		}
+		return n
+	}
+	return 0
+}
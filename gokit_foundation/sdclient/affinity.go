@@ -0,0 +1,138 @@
+package sdclient
+
+import (
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/sd"
+	"github.com/go-kit/kit/sd/lb"
+	"sync"
+)
+
+/*
+按实例的tag优先选择实例(如同一可用区、金丝雀版本)：
+	每组tags对应一个只包含这些tag的consul Instancer(tag由服务注册时带上，见gokit_foundation.ConsulRegisterOptions)，
+	调用时依次从各组中选择，某一组没有健康实例时才降级到下一组，最后是所有实例(WithTags的筛选仍然生效)
+	重试同样按这个顺序选择，优先的一组有实例但调用失败时在这一组内重试，不会降级
+也可以排除带某些tag的实例(见WithoutTags)，如灰度发布时stable的client不调用canary实例，对每一组都生效
+*/
+
+// WithAffinity 优先使用同时包含tags的实例，可以多次调用，按调用顺序依次降级，
+// 如依次传入("version=v1.3.0", "zone=cn-sh-a")、("version=v1.3.0")：同一可用区的新版本 => 其他可用区的新版本 => 所有实例
+// 只对consul生效，etcd、k8s中没有tag
+func WithAffinity(tags ...string) Option {
+	return func(o *options) {
+		if len(tags) > 0 {
+			o.affinities = append(o.affinities, tags)
+		}
+	}
+}
+
+// 依次从各个Balancer选择，没有实例时使用下一个
+type affinityBalancer []lb.Balancer
+
+func (b affinityBalancer) Endpoint() (endpoint.Endpoint, error) {
+	for _, balancer := range b[:len(b)-1] {
+		if ep, err := balancer.Endpoint(); err == nil {
+			return ep, nil
+		}
+	}
+	return b[len(b)-1].Endpoint()
+}
+
+// WithoutTags 不使用同时包含tags的实例(与WithTags相反)，如灰度发布时stable的client排除canary实例
+// 只对consul生效，被排除的实例查询失败时沿用上一次的结果
+func WithoutTags(tags ...string) Option {
+	return func(o *options) { o.withoutTags = tags }
+}
+
+// 从all的实例中去掉excluded中的实例，excluded由Client停止(多个excludeInstancer共用)
+type excludeInstancer struct {
+	all, excluded sd.Instancer
+	allc, excc    chan sd.Event
+	quit          chan struct{}
+
+	mu    sync.Mutex
+	state sd.Event
+	regs  map[chan<- sd.Event]struct{}
+}
+
+func newExcludeInstancer(all, excluded sd.Instancer) *excludeInstancer {
+	e := &excludeInstancer{
+		all:      all,
+		excluded: excluded,
+		allc:     make(chan sd.Event, 1),
+		excc:     make(chan sd.Event, 1),
+		quit:     make(chan struct{}),
+		regs:     map[chan<- sd.Event]struct{}{},
+	}
+	// 注册时立即收到当前的实例(consul Instancer创建时已经查询过一次)，先同步取出，创建后就有正确的实例列表
+	all.Register(e.allc)
+	excluded.Register(e.excc)
+	allEvent, excEvent := <-e.allc, <-e.excc
+	e.state = exclude(allEvent, excEvent)
+	go e.loop(allEvent, excEvent)
+	return e
+}
+
+func (e *excludeInstancer) loop(all, excluded sd.Event) {
+	for {
+		select {
+		case all = <-e.allc:
+		case event := <-e.excc:
+			if event.Err != nil {
+				continue
+			}
+			excluded = event
+		case <-e.quit:
+			return
+		}
+		e.mu.Lock()
+		e.state = exclude(all, excluded)
+		for ch := range e.regs {
+			ch <- copyEvent(e.state)
+		}
+		e.mu.Unlock()
+	}
+}
+
+func exclude(all, excluded sd.Event) sd.Event {
+	if all.Err != nil {
+		return all
+	}
+	skip := make(map[string]bool, len(excluded.Instances))
+	for _, instance := range excluded.Instances {
+		skip[instance] = true
+	}
+	event := sd.Event{Instances: make([]string, 0, len(all.Instances))}
+	for _, instance := range all.Instances {
+		if !skip[instance] {
+			event.Instances = append(event.Instances, instance)
+		}
+	}
+	return event
+}
+
+func copyEvent(e sd.Event) sd.Event {
+	e.Instances = append([]string(nil), e.Instances...)
+	return e
+}
+
+// Register 与consul Instancer一样，注册时立即发送当前的实例
+func (e *excludeInstancer) Register(ch chan<- sd.Event) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.regs[ch] = struct{}{}
+	ch <- copyEvent(e.state)
+}
+
+func (e *excludeInstancer) Deregister(ch chan<- sd.Event) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.regs, ch)
+}
+
+func (e *excludeInstancer) Stop() {
+	e.all.Deregister(e.allc)
+	e.excluded.Deregister(e.excc)
+	close(e.quit)
+	e.all.Stop()
+}
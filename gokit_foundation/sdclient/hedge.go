@@ -0,0 +1,209 @@
+package sdclient
+
+import (
+	"context"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/sd"
+	"github.com/go-kit/kit/sd/lb"
+	"google.golang.org/grpc"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+对冲请求(hedged request)，用于幂等的只读接口降低长尾耗时：
+-	调用一个实例后等待delay，还没有返回时再调用另一个实例，最多再调用maxHedges个(不超过实例数)，使用最先成功的response，其他调用的ctx被取消
+-	budget限制对冲的比例：每次调用存入budget个令牌(最多存10个)，每次对冲取走一个，令牌不够时不对冲，如0.1表示长期平均最多10%的调用会对冲，
+	避免实例整体变慢时对冲把负载放大数倍
+-	一次对冲调用算作一次调用，全部失败后由重试处理(见retry.go)，每个实例的调用仍然受WithCallTimeout限制
+-	只对HedgedEndpoint/HedgedGRPCEndpoint创建的endpoint生效；有写操作的接口不能对冲，两个实例可能都执行成功
+-	被取消的调用可能在返回后仍在进行，request在调用返回后也不能修改
+*/
+
+// 对冲事件，用于WithHedgeMetrics的event标签
+const (
+	HedgeEventHedge           = "hedge"            // 发起了一次对冲
+	HedgeEventWon             = "won"              // 使用了对冲调用的response
+	HedgeEventBudgetExhausted = "budget_exhausted" // 到了delay但令牌不够，没有对冲
+)
+
+// 令牌最多存这么多，长时间没有对冲之后的突发也不会超过
+const hedgeBudgetMax = 10
+
+// WithHedging 对冲请求的delay、最多对冲次数和比例，见hedge.go，delay为0时不对冲
+// delay一般取接口耗时的p95左右，budget<=0时不限制比例
+func WithHedging(delay time.Duration, maxHedges int, budget float64) Option {
+	return func(o *options) {
+		o.hedgeDelay = delay
+		o.maxHedges = maxHedges
+		o.hedgeBudget = budget
+	}
+}
+
+// 每次对冲、对冲胜出以及令牌不够时counter加1，标签为event(见HedgeEventXxx)
+func WithHedgeMetrics(counter metrics.Counter) Option {
+	return func(o *options) { o.hedgeCounter = counter }
+}
+
+// HedgedEndpoint 与Endpoint相同，设置了WithHedging时对调用慢的实例发起对冲，只用于幂等的接口
+func (c *Client) HedgedEndpoint(factory sd.Factory) endpoint.Endpoint {
+	if c.opts.hedgeDelay <= 0 || c.opts.maxHedges <= 0 {
+		return c.Endpoint(factory)
+	}
+	factory = c.withCallTimeout(factory)
+	var balancer lb.Balancer = c.hedgeBalancer(c.instancer, factory)
+	if len(c.preferred) > 0 {
+		tiers := make(affinityBalancer, 0, len(c.preferred)+1)
+		for _, instancer := range c.preferred {
+			tiers = append(tiers, c.hedgeBalancer(instancer, factory))
+		}
+		balancer = append(tiers, balancer)
+	}
+	return c.retry(balancer)
+}
+
+// HedgedGRPCEndpoint 与GRPCEndpoint相同，见HedgedEndpoint
+func (c *Client) HedgedGRPCEndpoint(makeEndpoint func(conn *grpc.ClientConn) endpoint.Endpoint) endpoint.Endpoint {
+	return c.HedgedEndpoint(c.pool.Factory(makeEndpoint))
+}
+
+func (c *Client) hedgeBalancer(instancer sd.Instancer, factory sd.Factory) *hedgeBalancer {
+	return &hedgeBalancer{endpointer: c.endpointer(instancer, factory), opts: c.opts, budget: c.hedges}
+}
+
+// 按轮询选择第一个实例，对冲依次使用之后的实例，保证与之前的实例不同
+type hedgeBalancer struct {
+	endpointer sd.Endpointer
+	opts       options
+	budget     *hedgeBudget
+	counter    uint64
+}
+
+func (b *hedgeBalancer) Endpoint() (endpoint.Endpoint, error) {
+	eps, err := b.endpointer.Endpoints()
+	if err != nil {
+		return nil, err
+	}
+	if len(eps) == 0 {
+		return nil, lb.ErrNoEndpoints
+	}
+	start := int(atomic.AddUint64(&b.counter, 1) - 1)
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		return b.call(ctx, request, eps, start)
+	}, nil
+}
+
+func (b *hedgeBalancer) count(event string) {
+	if b.opts.hedgeCounter != nil {
+		b.opts.hedgeCounter.With("event", event).Add(1)
+	}
+}
+
+type hedgeResult struct {
+	rsp   interface{}
+	err   error
+	hedge bool
+}
+
+func (b *hedgeBalancer) call(ctx context.Context, request interface{}, eps []endpoint.Endpoint, start int) (interface{}, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	maxCalls := b.opts.maxHedges + 1
+	if maxCalls > len(eps) {
+		maxCalls = len(eps)
+	}
+	// 有缓冲，返回后仍在进行的调用不会阻塞
+	results := make(chan hedgeResult, maxCalls)
+	launch := func(i int) {
+		go func(ep endpoint.Endpoint, hedge bool) {
+			rsp, err := ep(ctx, request)
+			results <- hedgeResult{rsp: rsp, err: err, hedge: hedge}
+		}(eps[(start+i)%len(eps)], i > 0)
+	}
+	b.budget.deposit()
+	launch(0)
+	calls, inflight := 1, 1
+	var timer <-chan time.Time
+	if maxCalls > 1 {
+		t := time.NewTicker(b.opts.hedgeDelay)
+		defer t.Stop()
+		timer = t.C
+	}
+	var lastErr error
+	for {
+		select {
+		case r := <-results:
+			inflight--
+			if r.err == nil {
+				if r.hedge {
+					b.count(HedgeEventWon)
+				}
+				return r.rsp, nil
+			}
+			// 还有调用在进行时等待它们的结果
+			lastErr = r.err
+			if inflight == 0 {
+				return nil, lastErr
+			}
+		case <-timer:
+			if calls >= maxCalls {
+				timer = nil
+				continue
+			}
+			// 令牌不够时这次调用不再对冲
+			if !b.budget.withdraw() {
+				b.count(HedgeEventBudgetExhausted)
+				timer = nil
+				continue
+			}
+			b.count(HedgeEventHedge)
+			launch(calls)
+			calls++
+			inflight++
+		case <-ctx.Done():
+			if lastErr == nil {
+				lastErr = ctx.Err()
+			}
+			return nil, lastErr
+		}
+	}
+}
+
+// 令牌桶，同一个Client的所有对冲endpoint共用，ratio<=0时不限制
+type hedgeBudget struct {
+	ratio float64
+
+	mu     sync.Mutex
+	tokens float64
+}
+
+func newHedgeBudget(ratio float64) *hedgeBudget {
+	return &hedgeBudget{ratio: ratio, tokens: hedgeBudgetMax}
+}
+
+func (b *hedgeBudget) deposit() {
+	if b.ratio <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens += b.ratio
+	if b.tokens > hedgeBudgetMax {
+		b.tokens = hedgeBudgetMax
+	}
+}
+
+func (b *hedgeBudget) withdraw() bool {
+	if b.ratio <= 0 {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -0,0 +1,130 @@
+package sdclient
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestHedgedEndpoint(t *testing.T) {
+	events := map[string]float64{}
+	c, stop := newTestClient(newFakeConsulClient("10.0.0.1", "10.0.0.2", "10.0.0.3"),
+		WithHedging(10*time.Millisecond, 2, 0), WithHedgeMetrics(eventCounter{events: events}))
+	defer stop()
+	// 两个实例一直不返回，最多对冲2次时总能调用到10.0.0.3
+	ep := c.HedgedEndpoint(testFactory(nil, map[string]bool{"10.0.0.1:8080": true, "10.0.0.2:8080": true}))
+	if _, err := waitCall(ep); err != nil {
+		t.Fatal(err)
+	}
+	for k := range events {
+		delete(events, k)
+	}
+
+	for i := 0; i < 3; i++ {
+		start := time.Now()
+		rsp, err := ep(context.Background(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rsp != "10.0.0.3:8080" {
+			t.Errorf("got %v, want 10.0.0.3:8080", rsp)
+		}
+		if d := time.Since(start); d > 200*time.Millisecond {
+			t.Errorf("hedged call took %v", d)
+		}
+	}
+	// 轮询3次，分别从3个实例开始，需要对冲0、1、2次
+	if events[HedgeEventHedge] != 3 || events[HedgeEventWon] != 2 {
+		t.Errorf("events: %v", events)
+	}
+}
+
+func TestHedgedEndpointMaxHedges(t *testing.T) {
+	c, stop := newTestClient(newFakeConsulClient("10.0.0.1", "10.0.0.2", "10.0.0.3"),
+		WithHedging(5*time.Millisecond, 1, 0), WithRetry(0, 100*time.Millisecond))
+	defer stop()
+	ep := c.HedgedEndpoint(testFactory(nil, map[string]bool{"10.0.0.1:8080": true, "10.0.0.2:8080": true}))
+	if _, err := waitCall(ep); err != nil {
+		t.Fatal(err)
+	}
+	// 只对冲1次，从10.0.0.1开始的调用到不了10.0.0.3
+	var failed int
+	for i := 0; i < 3; i++ {
+		if _, err := ep(context.Background(), nil); err != nil {
+			failed++
+		}
+	}
+	if failed != 1 {
+		t.Errorf("failed %d calls, want 1", failed)
+	}
+}
+
+func TestHedgedEndpointDisabled(t *testing.T) {
+	c, stop := newTestClient(newFakeConsulClient("10.0.0.1", "10.0.0.2"),
+		WithRetry(0, 50*time.Millisecond))
+	defer stop()
+	ep := c.HedgedEndpoint(testFactory(nil, map[string]bool{"10.0.0.1:8080": true}))
+	if _, err := waitCall(ep); err != nil {
+		t.Fatal(err)
+	}
+	var failed int
+	for i := 0; i < 2; i++ {
+		if _, err := ep(context.Background(), nil); err != nil {
+			failed++
+		}
+	}
+	if failed != 1 {
+		t.Errorf("failed %d calls, want 1", failed)
+	}
+}
+
+func TestHedgeBudget(t *testing.T) {
+	b := newHedgeBudget(0.5)
+	for i := 0; i < hedgeBudgetMax; i++ {
+		if !b.withdraw() {
+			t.Fatalf("withdraw %d failed", i)
+		}
+	}
+	if b.withdraw() {
+		t.Fatal("withdraw succeeded with empty budget")
+	}
+	b.deposit()
+	b.deposit()
+	if !b.withdraw() || b.withdraw() {
+		t.Error("two deposits of 0.5 should allow exactly one hedge")
+	}
+
+	unlimited := newHedgeBudget(0)
+	for i := 0; i < 2*hedgeBudgetMax; i++ {
+		if !unlimited.withdraw() {
+			t.Fatal("unlimited budget exhausted")
+		}
+	}
+}
+
+func TestHedgeBudgetExhausted(t *testing.T) {
+	events := map[string]float64{}
+	c, stop := newTestClient(newFakeConsulClient("10.0.0.1", "10.0.0.2"),
+		WithHedging(5*time.Millisecond, 1, 0.01), WithHedgeMetrics(eventCounter{events: events}),
+		WithRetry(0, 50*time.Millisecond))
+	defer stop()
+	ep := c.HedgedEndpoint(testFactory(nil, map[string]bool{"10.0.0.1:8080": true}))
+	if _, err := waitCall(ep); err != nil {
+		t.Fatal(err)
+	}
+	for k := range events {
+		delete(events, k)
+	}
+
+	// 只剩1个令牌，第二次从10.0.0.1开始的调用不能对冲
+	c.hedges.tokens = 1
+	var failed int
+	for i := 0; i < 4; i++ {
+		if _, err := ep(context.Background(), nil); err != nil {
+			failed++
+		}
+	}
+	if failed != 1 || events[HedgeEventHedge] != 1 || events[HedgeEventBudgetExhausted] != 1 {
+		t.Errorf("failed:%d events:%v", failed, events)
+	}
+}
@@ -0,0 +1,67 @@
+package sdclient
+
+import (
+	"context"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
+	"net"
+	"testing"
+)
+
+// 启动带health服务的grpc server
+func listenHealth(t *testing.T) (string, func()) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer()
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	go srv.Serve(lis)
+	return lis.Addr().String(), srv.Stop
+}
+
+// 返回的endpoint响应处理请求的server地址
+func peerEndpoint(conn *grpc.ClientConn) endpoint.Endpoint {
+	return func(ctx context.Context, _ interface{}) (interface{}, error) {
+		var p peer.Peer
+		if _, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}, grpc.Peer(&p)); err != nil {
+			return nil, err
+		}
+		return p.Addr.String(), nil
+	}
+}
+
+// 实例由resolver提供(模拟xds resolver)，默认使用round_robin
+func TestNewMesh(t *testing.T) {
+	addr1, stop1 := listenHealth(t)
+	defer stop1()
+	addr2, stop2 := listenHealth(t)
+	defer stop2()
+	r := manual.NewBuilderWithScheme("meshtest")
+	r.InitialState(resolver.State{Addresses: []resolver.Address{{Addr: addr1}, {Addr: addr2}}})
+
+	c := NewMesh(r.Scheme()+":///addsvc", log.NewNopLogger(), WithDialOptions(grpc.WithInsecure(), grpc.WithResolvers(r)))
+	defer c.Stop()
+	ep := c.GRPCEndpoint(peerEndpoint)
+	got := map[interface{}]bool{}
+	for i := 0; i < 100 && len(got) < 2; i++ {
+		rsp, err := ep(context.Background(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[rsp] = true
+	}
+	if !got[addr1] || !got[addr2] {
+		t.Errorf("not balanced by resolver, got:%v", got)
+	}
+	// sdclient只看到target一个实例，所有接口共用一个连接
+	if n := len(c.pool.entries); n != 1 {
+		t.Errorf("got %d pool entries", n)
+	}
+}
@@ -0,0 +1,212 @@
+package sdclient
+
+import (
+	"context"
+	"errors"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/sd"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+/*
+grpc连接池，由Client.GRPCEndpoint使用，按实例地址管理连接：
+-	同一个实例的所有接口(每个接口各有一个sd.Endpointer)共用连接，每个实例最多WithPoolSize个连接，调用时轮流使用
+-	实例出现在注册中心时不拨号，第一次调用用到某个连接时才拨号(grpc.Dial本身不阻塞)
+-	调用前检查连接状态，TransientFailure(grpc自身重连失败)或Shutdown的连接被关闭，下次用到时重新拨号
+-	实例从注册中心消失时(如健康检查失败)连接不会立即关闭，最多保留WithMaxIdleConns个，实例很快恢复时直接复用；
+	超过时关闭最早闲置的实例的连接
+Client.Stop时关闭所有连接
+*/
+
+var ErrPoolClosed = errors.New("sdclient: connection pool closed")
+
+type ConnPool struct {
+	dialOpts []grpc.DialOption
+	size     int
+	maxIdle  int
+	logger   log.Logger
+
+	mu      sync.Mutex
+	entries map[string]*poolEntry
+	idle    []*poolEntry // 没有被引用的实例，按闲置的先后排列
+	closed  bool
+}
+
+// 一个实例的连接
+type poolEntry struct {
+	instance string
+	refs     int // 引用这个实例的endpoint数，见ConnPool.Factory
+	next     uint32
+
+	mu    sync.Mutex
+	conns []*grpc.ClientConn // 长度为size，nil表示还未拨号或已被淘汰
+}
+
+// dialOpts为空时使用grpc.WithInsecure，size<=0时为1，maxIdle<0时为0
+func NewConnPool(dialOpts []grpc.DialOption, size, maxIdle int, logger log.Logger) *ConnPool {
+	if len(dialOpts) == 0 {
+		dialOpts = []grpc.DialOption{grpc.WithInsecure()}
+	}
+	if size <= 0 {
+		size = 1
+	}
+	if maxIdle < 0 {
+		maxIdle = 0
+	}
+	return &ConnPool{dialOpts: dialOpts, size: size, maxIdle: maxIdle, logger: logger, entries: map[string]*poolEntry{}}
+}
+
+// Factory 返回的sd.Factory为实例创建endpoint，makeEndpoint为一个连接创建该接口的endpoint，每个连接只调用一次
+// 返回的io.Closer释放对实例的引用，由sd.Endpointer在实例消失时调用
+func (p *ConnPool) Factory(makeEndpoint func(conn *grpc.ClientConn) endpoint.Endpoint) sd.Factory {
+	return func(instance string) (endpoint.Endpoint, io.Closer, error) {
+		e, err := p.acquire(instance)
+		if err != nil {
+			return nil, nil, err
+		}
+		var (
+			mu    sync.Mutex
+			built = make([]*grpc.ClientConn, p.size) // eps[i]基于的连接，连接被替换后需要重新创建endpoint
+			eps   = make([]endpoint.Endpoint, p.size)
+		)
+		ep := func(ctx context.Context, request interface{}) (interface{}, error) {
+			i, conn, err := p.conn(e)
+			if err != nil {
+				return nil, err
+			}
+			mu.Lock()
+			if built[i] != conn {
+				built[i], eps[i] = conn, makeEndpoint(conn)
+			}
+			next := eps[i]
+			mu.Unlock()
+			return next(ctx, request)
+		}
+		return ep, closerFunc(func() error { p.release(e); return nil }), nil
+	}
+}
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error { return f() }
+
+func (p *ConnPool) acquire(instance string) (*poolEntry, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil, ErrPoolClosed
+	}
+	e, ok := p.entries[instance]
+	if !ok {
+		e = &poolEntry{instance: instance, conns: make([]*grpc.ClientConn, p.size)}
+		p.entries[instance] = e
+	}
+	if e.refs == 0 {
+		p.removeIdle(e)
+	}
+	e.refs++
+	return e, nil
+}
+
+func (p *ConnPool) release(e *poolEntry) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if e.refs--; e.refs > 0 || p.closed {
+		return
+	}
+	if e.dialed() == 0 {
+		delete(p.entries, e.instance)
+		e.close()
+		return
+	}
+	p.idle = append(p.idle, e)
+	// 超过maxIdle时从最早闲置的实例开始关闭
+	for len(p.idle) > 0 && p.idleConns() > p.maxIdle {
+		oldest := p.idle[0]
+		p.idle = p.idle[1:]
+		delete(p.entries, oldest.instance)
+		oldest.close()
+	}
+}
+
+func (p *ConnPool) removeIdle(e *poolEntry) {
+	for i, idle := range p.idle {
+		if idle == e {
+			p.idle = append(p.idle[:i], p.idle[i+1:]...)
+			return
+		}
+	}
+}
+
+func (p *ConnPool) idleConns() (n int) {
+	for _, e := range p.idle {
+		n += e.dialed()
+	}
+	return n
+}
+
+// 轮流选择实例的一个连接，连接不可用时重新拨号
+func (p *ConnPool) conn(e *poolEntry) (int, *grpc.ClientConn, error) {
+	i := int(atomic.AddUint32(&e.next, 1) % uint32(p.size))
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.conns == nil {
+		return 0, nil, ErrPoolClosed
+	}
+	if conn := e.conns[i]; conn != nil {
+		switch state := conn.GetState(); state {
+		case connectivity.TransientFailure, connectivity.Shutdown:
+			p.logger.Log("instance", e.instance, "conn", i, "state", state.String(), "msg", "evict grpc connection")
+			_ = conn.Close()
+			e.conns[i] = nil
+		default:
+			return i, conn, nil
+		}
+	}
+	conn, err := grpc.Dial(e.instance, p.dialOpts...)
+	if err != nil {
+		return 0, nil, err
+	}
+	e.conns[i] = conn
+	return i, conn, nil
+}
+
+func (e *poolEntry) dialed() (n int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, conn := range e.conns {
+		if conn != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// 关闭后conn返回ErrPoolClosed
+func (e *poolEntry) close() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, conn := range e.conns {
+		if conn != nil {
+			_ = conn.Close()
+		}
+	}
+	e.conns = nil
+}
+
+// Close 关闭所有连接，之后的调用返回ErrPoolClosed
+func (p *ConnPool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	for _, e := range p.entries {
+		e.close()
+	}
+	p.entries = map[string]*poolEntry{}
+	p.idle = nil
+}
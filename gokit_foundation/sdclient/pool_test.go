@@ -0,0 +1,133 @@
+package sdclient
+
+import (
+	"context"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/sd"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"net"
+	"testing"
+)
+
+// 启动一个空的grpc server，连接可以进入Ready状态
+func listenGRPC(t *testing.T) (string, func()) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer()
+	go srv.Serve(lis)
+	return lis.Addr().String(), srv.Stop
+}
+
+// 返回的endpoint响应使用的连接
+func connEndpoint(made *int) func(*grpc.ClientConn) endpoint.Endpoint {
+	return func(conn *grpc.ClientConn) endpoint.Endpoint {
+		*made++
+		return func(context.Context, interface{}) (interface{}, error) { return conn, nil }
+	}
+}
+
+func callConn(t *testing.T, ep endpoint.Endpoint) *grpc.ClientConn {
+	rsp, err := waitCall(ep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rsp.(*grpc.ClientConn)
+}
+
+// 同一个实例的所有接口共用连接，第一次调用时才拨号
+func TestGRPCEndpointSharedConn(t *testing.T) {
+	addr, stop := listenGRPC(t)
+	defer stop()
+	c := NewWithInstancer(sd.FixedInstancer{addr}, log.NewNopLogger())
+	var sumMade, concatMade int
+	sum, concat := c.GRPCEndpoint(connEndpoint(&sumMade)), c.GRPCEndpoint(connEndpoint(&concatMade))
+
+	conn := callConn(t, sum)
+	for i := 0; i < 3; i++ {
+		if got := callConn(t, concat); got != conn {
+			t.Errorf("got another conn")
+		}
+		callConn(t, sum)
+	}
+	if sumMade != 1 || concatMade != 1 {
+		t.Errorf("got endpoints made sum:%d concat:%d", sumMade, concatMade)
+	}
+
+	c.Stop()
+	if state := conn.GetState(); state != connectivity.Shutdown {
+		t.Errorf("after stop got state:%v", state)
+	}
+}
+
+// 不可用的连接被关闭，下次调用时重新拨号并创建endpoint
+func TestConnPoolEvict(t *testing.T) {
+	addr, stop := listenGRPC(t)
+	defer stop()
+	p := NewConnPool(nil, 2, 0, log.NewNopLogger())
+	defer p.Close()
+	var made int
+	ep, _, err := p.Factory(connEndpoint(&made))(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := p.entries[addr].dialed(); n != 0 {
+		t.Errorf("dialed %d conns before call", n)
+	}
+	c1, c2 := callConn(t, ep), callConn(t, ep)
+	if c1 == c2 || callConn(t, ep) != c1 {
+		t.Errorf("conns not used in turn")
+	}
+
+	_ = c1.Close()
+	if callConn(t, ep) != c2 {
+		t.Errorf("ready conn evicted")
+	}
+	if c3 := callConn(t, ep); c3 == c1 || c3.GetState() == connectivity.Shutdown {
+		t.Errorf("shutdown conn not evicted")
+	}
+	if made != 3 {
+		t.Errorf("got endpoints made:%d", made)
+	}
+}
+
+// 实例消失后保留最多maxIdle个连接，实例恢复时复用
+func TestConnPoolIdle(t *testing.T) {
+	addr1, stop1 := listenGRPC(t)
+	defer stop1()
+	addr2, stop2 := listenGRPC(t)
+	defer stop2()
+	p := NewConnPool(nil, 1, 1, log.NewNopLogger())
+	var made int
+	factory := p.Factory(connEndpoint(&made))
+
+	ep1, closer1, _ := factory(addr1)
+	ep2, closer2, _ := factory(addr2)
+	c1, c2 := callConn(t, ep1), callConn(t, ep2)
+	_ = closer1.Close()
+	if c1.GetState() == connectivity.Shutdown {
+		t.Error("idle conn closed")
+	}
+	ep1, closer1, _ = factory(addr1)
+	if callConn(t, ep1) != c1 {
+		t.Error("idle conn not reused")
+	}
+
+	// addr1先闲置，addr2闲置后超过maxIdle，关闭addr1的连接
+	_ = closer1.Close()
+	_ = closer2.Close()
+	if c1.GetState() != connectivity.Shutdown || c2.GetState() == connectivity.Shutdown {
+		t.Errorf("got state addr1:%v addr2:%v", c1.GetState(), c2.GetState())
+	}
+
+	p.Close()
+	if _, err := ep2(context.Background(), nil); err != ErrPoolClosed {
+		t.Errorf("got err:%v", err)
+	}
+	if _, _, err := factory(addr1); err != ErrPoolClosed {
+		t.Errorf("got err:%v", err)
+	}
+}
@@ -0,0 +1,163 @@
+package sdclient
+
+import (
+	"context"
+	"errors"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/sd/lb"
+	"gokit_foundation/errs"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"math/rand"
+	"time"
+)
+
+/*
+替代lb.Retry的重试：
+-	只重试可重试的错误(见DefaultRetryable)，参数错误等业务错误重试也不会成功
+-	两次调用之间按指数退避等待，并加上随机的jitter，避免大量client同时重试；server建议了重试间隔(见errs.RetryAfterOf，如过载保护)时至少等待这么久
+-	总时间(包括退避)不超过budget(见WithRetry)和调用方ctx的deadline中较早的一个，剩余时间不够下一次退避时直接返回
+-	每次调用都在调用方的goroutine中完成，返回后不会有仍在进行的调用(lb.Retry超时返回时它的goroutine可能还在调用)
+-	全部失败时返回最后一次的err，不像lb.RetryError那样丢失err的类型
+*/
+
+// 重试事件，用于WithRetryMetrics的event标签
+const (
+	RetryEventRetry             = "retry"              // 发起了一次重试
+	RetryEventAttemptsExhausted = "attempts_exhausted" // 达到最多调用次数后放弃
+	RetryEventBudgetExhausted   = "budget_exhausted"   // 剩余时间不够下一次调用后放弃
+)
+
+// 第n次重试前的退避时间为base*2^(n-1)(不超过max)，实际等待[d/2, d]之间的随机时间，base为0时不等待
+func WithRetryBackoff(base, max time.Duration) Option {
+	return func(o *options) {
+		o.backoffBase = base
+		o.backoffMax = max
+	}
+}
+
+// 判断err是否需要重试，默认为DefaultRetryable
+func WithRetryable(retryable func(error) bool) Option {
+	return func(o *options) { o.retryable = retryable }
+}
+
+// 每次重试、放弃重试时counter加1，标签为event(见RetryEventXxx)
+func WithRetryMetrics(counter metrics.Counter) Option {
+	return func(o *options) { o.retryCounter = counter }
+}
+
+// 默认重试的grpc状态码
+var defaultRetryCodes = []codes.Code{codes.Unavailable, codes.ResourceExhausted, codes.DeadlineExceeded, codes.Aborted}
+
+// DefaultRetryable 按以下规则判断：
+//
+//	*errs.Error(如new_addsvc client侧ErrorsMiddleware转换后的err)：使用其Retryable
+//	grpc status：状态码为Unavailable、ResourceExhausted、DeadlineExceeded、Aborted时重试
+//	其他err：一般是连接失败、没有可用实例(lb.ErrNoEndpoints)、单次调用超时等，重试
+func DefaultRetryable(err error) bool {
+	var e *errs.Error
+	if errors.As(err, &e) {
+		return e.Retryable
+	}
+	if s, ok := status.FromError(err); ok {
+		return hasCode(defaultRetryCodes, s.Code())
+	}
+	return true
+}
+
+// RetryOnCodes 与DefaultRetryable相同，但只重试指定的grpc状态码，*errs.Error按其对应的状态码判断(见errs.ToGRPC)
+func RetryOnCodes(cs ...codes.Code) func(error) bool {
+	return func(err error) bool {
+		var e *errs.Error
+		if _, ok := status.FromError(err); !ok && !errors.As(err, &e) {
+			return true
+		}
+		return hasCode(cs, status.Code(errs.ToGRPC(err)))
+	}
+}
+
+func hasCode(cs []codes.Code, c codes.Code) bool {
+	for _, x := range cs {
+		if x == c {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Client) retry(balancer lb.Balancer) endpoint.Endpoint {
+	o := c.opts
+	retryable := o.retryable
+	if retryable == nil {
+		retryable = DefaultRetryable
+	}
+	count := func(event string) {
+		if o.retryCounter != nil {
+			o.retryCounter.With("event", event).Add(1)
+		}
+	}
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		if o.retryTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, o.retryTimeout)
+			defer cancel()
+		}
+		var lastErr error
+		for attempt := 1; ; attempt++ {
+			ep, err := balancer.Endpoint()
+			if err == nil {
+				var rsp interface{}
+				if rsp, err = ep(ctx, request); err == nil {
+					return rsp, nil
+				}
+			}
+			lastErr = err
+			if !retryable(err) {
+				return nil, err
+			}
+			if ctx.Err() != nil {
+				count(RetryEventBudgetExhausted)
+				return nil, lastErr
+			}
+			if attempt >= o.retryMax {
+				count(RetryEventAttemptsExhausted)
+				return nil, lastErr
+			}
+			wait := Backoff(o.backoffBase, o.backoffMax, attempt)
+			if d := errs.RetryAfterOf(err); d > wait {
+				wait = d
+			}
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= wait {
+				count(RetryEventBudgetExhausted)
+				return nil, lastErr
+			}
+			if wait > 0 {
+				t := time.NewTimer(wait)
+				select {
+				case <-ctx.Done():
+					t.Stop()
+					count(RetryEventBudgetExhausted)
+					return nil, lastErr
+				case <-t.C:
+				}
+			}
+			count(RetryEventRetry)
+		}
+	}
+}
+
+// Backoff 第attempt次调用失败后的等待时间(见WithRetryBackoff)，grpcclient的重试也使用它
+func Backoff(base, max time.Duration, attempt int) time.Duration {
+	if base <= 0 {
+		return 0
+	}
+	d := base
+	for i := 1; i < attempt && (max <= 0 || d < max); i++ {
+		d *= 2
+	}
+	if max > 0 && d > max {
+		d = max
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
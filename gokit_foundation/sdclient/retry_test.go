@@ -0,0 +1,127 @@
+package sdclient
+
+import (
+	"context"
+	"errors"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/sd"
+	"gokit_foundation/errs"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 以计数的方式模拟实例，前fails次调用返回err
+func failingFactory(fails int32, err error, calls *int32) sd.Factory {
+	return func(string) (endpoint.Endpoint, io.Closer, error) {
+		return func(ctx context.Context, _ interface{}) (interface{}, error) {
+			if atomic.AddInt32(calls, 1) <= fails {
+				return nil, err
+			}
+			return "ok", nil
+		}, nil, nil
+	}
+}
+
+// generic.Counter的With会复制当前值，这里按event分别记录，返回的counter共享events
+type eventCounter struct {
+	event  string
+	events map[string]float64
+}
+
+func (c eventCounter) With(lvs ...string) metrics.Counter {
+	return eventCounter{event: lvs[1], events: c.events}
+}
+
+func (c eventCounter) Add(delta float64) { c.events[c.event] += delta }
+
+func TestRetryPolicy(t *testing.T) {
+	unavailable := errs.Unavailable("down")
+	invalid := errs.Invalid("bad args")
+	for name, tt := range map[string]struct {
+		err       error
+		fails     int32
+		opts      []Option
+		wantErr   error
+		wantCalls int32
+	}{
+		"retryable":          {err: unavailable, fails: 2, wantCalls: 3},
+		"not retryable":      {err: invalid, fails: 2, wantErr: invalid, wantCalls: 1},
+		"attempts exhausted": {err: unavailable, fails: 5, wantErr: unavailable, wantCalls: 3},
+		"plain err":          {err: errors.New("connection refused"), fails: 1, wantCalls: 2},
+		"grpc status":        {err: status.Error(codes.InvalidArgument, "x"), fails: 1, wantErr: status.Error(codes.InvalidArgument, "x"), wantCalls: 1},
+		"retry on codes": {err: unavailable, fails: 1, opts: []Option{WithRetryable(RetryOnCodes(codes.Aborted))},
+			wantErr: unavailable, wantCalls: 1},
+	} {
+		var calls int32
+		opts := append([]Option{WithRetry(3, time.Second), WithRetryBackoff(time.Millisecond, 2*time.Millisecond)}, tt.opts...)
+		c := NewWithInstancer(sd.FixedInstancer{"10.0.0.1:8080"}, log.NewNopLogger(), opts...)
+		_, err := c.Endpoint(failingFactory(tt.fails, tt.err, &calls))(context.Background(), nil)
+		if (tt.wantErr == nil) != (err == nil) || (err != nil && err.Error() != tt.wantErr.Error()) || calls != tt.wantCalls {
+			t.Errorf("%s: got err:%v calls:%d want err:%v calls:%d", name, err, calls, tt.wantErr, tt.wantCalls)
+		}
+		c.Stop()
+	}
+}
+
+// 退避时间超过剩余的时间时不再重试，总耗时不超过调用方ctx的deadline
+func TestRetryBudget(t *testing.T) {
+	counter := eventCounter{events: map[string]float64{}}
+	var calls int32
+	c := NewWithInstancer(sd.FixedInstancer{"10.0.0.1:8080"}, log.NewNopLogger(), WithRetryMetrics(counter),
+		WithRetry(10, time.Second), WithRetryBackoff(40*time.Millisecond, 40*time.Millisecond))
+	defer c.Stop()
+	ep := c.Endpoint(failingFactory(100, errs.Unavailable("down"), &calls))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := ep(ctx, nil)
+	if cost := time.Since(start); err == nil || cost > 130*time.Millisecond {
+		t.Errorf("got err:%v cost:%v", err, cost)
+	}
+	// 每次退避20~40ms，100ms内最多5次调用
+	if calls < 2 || calls > 5 {
+		t.Errorf("got calls:%d", calls)
+	}
+	if counter.events[RetryEventRetry] != float64(calls-1) || counter.events[RetryEventBudgetExhausted] != 1 {
+		t.Errorf("got events:%v calls:%d", counter.events, calls)
+	}
+}
+
+// 按server建议的重试间隔等待，剩余时间不够时直接返回
+func TestRetryAfter(t *testing.T) {
+	var calls int32
+	c := NewWithInstancer(sd.FixedInstancer{"10.0.0.1:8080"}, log.NewNopLogger(), WithRetry(3, time.Second), WithRetryBackoff(time.Millisecond, time.Millisecond))
+	defer c.Stop()
+	ep := c.Endpoint(failingFactory(1, errs.Unavailable("overloaded").WithRetryAfter(30*time.Millisecond), &calls))
+	start := time.Now()
+	if _, err := ep(context.Background(), nil); err != nil || time.Since(start) < 30*time.Millisecond || calls != 2 {
+		t.Errorf("got err:%v cost:%v calls:%d", err, time.Since(start), calls)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	calls = 0
+	if _, err := ep(ctx, nil); errs.RetryAfterOf(err) != 30*time.Millisecond || calls != 1 {
+		t.Errorf("got err:%v calls:%d", err, calls)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for attempt, want := range map[int]time.Duration{1: 10 * time.Millisecond, 2: 20 * time.Millisecond, 3: 40 * time.Millisecond, 10: 50 * time.Millisecond} {
+		for i := 0; i < 20; i++ {
+			if d := Backoff(10*time.Millisecond, 50*time.Millisecond, attempt); d < want/2 || d > want {
+				t.Errorf("attempt:%d got %v want in [%v, %v]", attempt, d, want/2, want)
+			}
+		}
+	}
+	if d := Backoff(0, time.Second, 3); d != 0 {
+		t.Errorf("zero base got %v", d)
+	}
+}
@@ -0,0 +1,296 @@
+package sdclient
+
+import (
+	"context"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/sd"
+	"github.com/go-kit/kit/sd/consul"
+	"github.com/go-kit/kit/sd/lb"
+	stdconsul "github.com/hashicorp/consul/api"
+	"gokit_foundation"
+	"google.golang.org/grpc"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+/*
+client侧的服务发现与负载均衡
+	从consul(或etcd、k8s headless service)获取服务的健康实例，每个接口的endpoint依次封装：
+	sd.Factory(实例地址 => endpoint) -> 单次调用超时 -> sd.Endpointer -> lb.Balancer(轮询/随机，可以按tag优先选择，见affinity.go) -> 重试(见retry.go)
+	幂等的接口可以使用HedgedEndpoint，实例调用慢时对冲到另一个实例(见hedge.go)
+	client只需要提供Factory，拿到的还是endpoint，对调用者隐藏了服务发现的细节
+	grpc client可以只提供连接 => endpoint的函数(见GRPCEndpoint)，连接由连接池复用(见pool.go)
+	也可以把服务发现和负载均衡交给grpc的xDS resolver或Envoy sidecar(见NewMesh)，用于对比库内和service mesh两种方式
+*/
+
+type BalancerType int
+
+const (
+	RoundRobin BalancerType = iota
+	Random
+)
+
+type options struct {
+	tags         []string
+	affinities   [][]string
+	withoutTags  []string
+	passingOnly  bool
+	balancer     BalancerType
+	retryMax     int
+	retryTimeout time.Duration
+	callTimeout  time.Duration
+	dialOpts     []grpc.DialOption
+	backoffBase  time.Duration
+	backoffMax   time.Duration
+	retryable    func(error) bool
+	retryCounter metrics.Counter
+	middlewares  []endpoint.Middleware
+	poolSize     int
+	maxIdleConns int
+	hedgeDelay   time.Duration
+	maxHedges    int
+	hedgeBudget  float64
+	hedgeCounter metrics.Counter
+}
+
+type Option func(*options)
+
+// 只使用包含全部tags的实例
+func WithTags(tags ...string) Option {
+	return func(o *options) { o.tags = tags }
+}
+
+// 是否只使用健康检查通过的实例，默认true
+func WithPassingOnly(passingOnly bool) Option {
+	return func(o *options) { o.passingOnly = passingOnly }
+}
+
+func WithBalancer(b BalancerType) Option {
+	return func(o *options) { o.balancer = b }
+}
+
+// max为最多调用次数(包括第一次)，timeout为包括重试在内的总超时时间，调用方ctx的deadline更早时以ctx为准，为0时只受ctx限制
+func WithRetry(max int, timeout time.Duration) Option {
+	return func(o *options) {
+		o.retryMax = max
+		o.retryTimeout = timeout
+	}
+}
+
+// 单次调用的超时时间，超时后换一个实例重试，为0时不限制
+func WithCallTimeout(d time.Duration) Option {
+	return func(o *options) { o.callTimeout = d }
+}
+
+// factory连接实例时使用的grpc.DialOption，如TLS(见mtls.Reloader.ClientCredentials)，通过Client.DialOptions获取
+// 为空时由factory自行决定(一般是grpc.WithInsecure)，GRPCEndpoint的连接池使用grpc.WithInsecure
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(o *options) { o.dialOpts = append(o.dialOpts, opts...) }
+}
+
+// 安装在每个实例的endpoint上(在单次调用超时之内)，每次重试都会经过，如注入故障(见new_addsvc/client.InjectFailures)
+func WithEndpointMiddleware(mws ...endpoint.Middleware) Option {
+	return func(o *options) { o.middlewares = append(o.middlewares, mws...) }
+}
+
+// 每个实例的grpc连接数，默认1(grpc连接是多路复用的，并发很高时才需要多个)，只对GRPCEndpoint生效
+func WithPoolSize(n int) Option {
+	return func(o *options) { o.poolSize = n }
+}
+
+// 从注册中心消失的实例最多保留的grpc连接数(所有实例合计)，默认8，实例恢复时复用，只对GRPCEndpoint生效
+func WithMaxIdleConns(n int) Option {
+	return func(o *options) { o.maxIdleConns = n }
+}
+
+type Client struct {
+	instancer sd.Instancer
+	preferred []sd.Instancer // 见WithAffinity，与affinities一一对应
+	excluded  sd.Instancer   // 见WithoutTags，没有设置时为nil
+	logger    log.Logger
+	opts      options
+	pool      *ConnPool
+	hedges    *hedgeBudget // 所有对冲endpoint共用，见WithHedging
+
+	mu          sync.Mutex
+	endpointers []*sd.DefaultEndpointer
+}
+
+// consulAddr为consul agent地址，svcName为服务在consul中注册的名字
+func New(consulAddr, svcName string, logger log.Logger, opts ...Option) (*Client, error) {
+	apiClient, err := stdconsul.NewClient(&stdconsul.Config{
+		Address: consulAddr,
+		// consul的blocking query会在服务变化前一直挂起(默认最长5min)，所以这里不能设置Timeout
+		HttpClient: &http.Client{},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return NewWithClient(consul.NewClient(apiClient), svcName, logger, opts...), nil
+}
+
+// 使用已有的consul client创建，方便测试时传入fake client
+func NewWithClient(client consul.Client, svcName string, logger log.Logger, opts ...Option) *Client {
+	o := newOptions(opts)
+	var excluded sd.Instancer
+	if len(o.withoutTags) > 0 {
+		excluded = consul.NewInstancer(client, logger, svcName, append(append([]string{}, o.tags...), o.withoutTags...), o.passingOnly)
+	}
+	newInstancer := func(tags []string) sd.Instancer {
+		var instancer sd.Instancer = consul.NewInstancer(client, logger, svcName, tags, o.passingOnly)
+		if excluded != nil {
+			instancer = newExcludeInstancer(instancer, excluded)
+		}
+		return instancer
+	}
+	c := NewWithInstancer(newInstancer(o.tags), logger, opts...)
+	c.excluded = excluded
+	for _, tags := range o.affinities {
+		c.preferred = append(c.preferred, newInstancer(append(append([]string{}, o.tags...), tags...)))
+	}
+	return c
+}
+
+// 从etcd发现实例(见gokit_foundation.EtcdInstancer)，etcd中没有tags和健康状态，WithTags/WithPassingOnly不生效
+func NewEtcd(etcdAddr, svcName string, logger log.Logger, opts ...Option) *Client {
+	return NewWithInstancer(gokit_foundation.NewEtcdInstancer(etcdAddr, svcName, logger), logger, opts...)
+}
+
+// 在k8s集群内通过headless service的DNS SRV记录发现实例(见gokit_foundation.NewK8sInstancer)，每隔refresh解析一次
+// 只有ready的pod才会出现在SRV记录中，WithTags/WithPassingOnly不生效
+func NewK8s(svc, namespace, portName string, refresh time.Duration, logger log.Logger, opts ...Option) *Client {
+	return NewWithInstancer(gokit_foundation.NewK8sInstancer(svc, namespace, portName, refresh, logger), logger, opts...)
+}
+
+// NewMesh 服务发现和负载均衡交给grpc resolver或Envoy sidecar(见gokit_foundation/mesh)，target为grpc的dial target，如：
+// xds:///addsvc(需要引入google.golang.org/grpc/xds并设置GRPC_XDS_BOOTSTRAP)、127.0.0.1:15001(sidecar的出站监听)、dns:///addsvc:8081
+// 对sdclient来说只有target一个实例：WithTags/WithAffinity/WithBalancer不生效，对冲需要多个实例也不生效；
+// 重试、单次调用超时和WithEndpointMiddleware不变，每次重试由resolver/Envoy重新选择实例。
+// resolver没有下发service config时使用round_robin(grpc默认为pick_first，只用一个实例)
+func NewMesh(target string, logger log.Logger, opts ...Option) *Client {
+	o := newOptions(opts)
+	dialOpts := o.dialOpts
+	if len(dialOpts) == 0 {
+		dialOpts = []grpc.DialOption{grpc.WithInsecure()}
+	}
+	dialOpts = append(dialOpts[:len(dialOpts):len(dialOpts)], grpc.WithDefaultServiceConfig(`{"loadBalancingConfig": [{"round_robin": {}}]}`))
+	return NewWithInstancer(sd.FixedInstancer{target}, logger, append(opts[:len(opts):len(opts)], func(o *options) { o.dialOpts = dialOpts })...)
+}
+
+// 使用任意的sd.Instancer创建，Stop时会一起停止instancer
+func NewWithInstancer(instancer sd.Instancer, logger log.Logger, opts ...Option) *Client {
+	o := newOptions(opts)
+	return &Client{
+		instancer: instancer,
+		logger:    logger,
+		opts:      o,
+		pool:      NewConnPool(o.dialOpts, o.poolSize, o.maxIdleConns, logger),
+		hedges:    newHedgeBudget(o.hedgeBudget),
+	}
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		passingOnly:  true,
+		retryMax:     3,
+		retryTimeout: 500 * time.Millisecond,
+		backoffBase:  10 * time.Millisecond,
+		backoffMax:   100 * time.Millisecond,
+		poolSize:     1,
+		maxIdleConns: 8,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// 为一个接口创建endpoint，factory负责将实例地址转为该接口的endpoint
+// 每个接口单独调用，可以在返回的endpoint上继续安装该接口需要的中间件(如断路器、限速)
+func (c *Client) Endpoint(factory sd.Factory) endpoint.Endpoint {
+	factory = c.withCallTimeout(factory)
+	balancer := c.balancer(c.instancer, factory)
+	if len(c.preferred) > 0 {
+		tiers := make(affinityBalancer, 0, len(c.preferred)+1)
+		for _, instancer := range c.preferred {
+			tiers = append(tiers, c.balancer(instancer, factory))
+		}
+		balancer = append(tiers, balancer)
+	}
+	return c.retry(balancer)
+}
+
+func (c *Client) balancer(instancer sd.Instancer, factory sd.Factory) lb.Balancer {
+	endpointer := c.endpointer(instancer, factory)
+	switch c.opts.balancer {
+	case Random:
+		return lb.NewRandom(endpointer, time.Now().UnixNano())
+	default:
+		return lb.NewRoundRobin(endpointer)
+	}
+}
+
+// Stop时关闭
+func (c *Client) endpointer(instancer sd.Instancer, factory sd.Factory) *sd.DefaultEndpointer {
+	endpointer := sd.NewEndpointer(instancer, factory, c.logger)
+	c.mu.Lock()
+	c.endpointers = append(c.endpointers, endpointer)
+	c.mu.Unlock()
+	return endpointer
+}
+
+// GRPCEndpoint 与Endpoint相同，实例的grpc连接由连接池管理(见ConnPool)，同一个实例的所有接口共用连接
+// makeEndpoint为一个连接创建该接口的endpoint，拨号使用WithDialOptions设置的选项
+func (c *Client) GRPCEndpoint(makeEndpoint func(conn *grpc.ClientConn) endpoint.Endpoint) endpoint.Endpoint {
+	return c.Endpoint(c.pool.Factory(makeEndpoint))
+}
+
+func (c *Client) withCallTimeout(factory sd.Factory) sd.Factory {
+	if c.opts.callTimeout <= 0 && len(c.opts.middlewares) == 0 {
+		return factory
+	}
+	return func(instance string) (endpoint.Endpoint, io.Closer, error) {
+		ep, closer, err := factory(instance)
+		if err != nil {
+			return nil, nil, err
+		}
+		for i := len(c.opts.middlewares) - 1; i >= 0; i-- {
+			ep = c.opts.middlewares[i](ep)
+		}
+		if c.opts.callTimeout <= 0 {
+			return ep, closer, nil
+		}
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			ctx, cancel := context.WithTimeout(ctx, c.opts.callTimeout)
+			defer cancel()
+			return ep(ctx, request)
+		}, closer, nil
+	}
+}
+
+// WithDialOptions设置的选项，factory拨号时使用
+func (c *Client) DialOptions() []grpc.DialOption {
+	return c.opts.dialOpts
+}
+
+// 停止监听注册中心，之后不会再更新实例列表，连接池中的连接全部关闭
+func (c *Client) Stop() {
+	c.instancer.Stop()
+	for _, instancer := range c.preferred {
+		instancer.Stop()
+	}
+	if c.excluded != nil {
+		c.excluded.Stop()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, e := range c.endpointers {
+		e.Close()
+	}
+	c.endpointers = nil
+	c.pool.Close()
+}
@@ -0,0 +1,245 @@
+package sdclient
+
+import (
+	"context"
+	"errors"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/sd"
+	stdconsul "github.com/hashicorp/consul/api"
+	"google.golang.org/grpc"
+	"io"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// 第一次查询立即返回实例列表，之后的blocking query一直挂起直到测试结束
+type fakeConsulClient struct {
+	entries []*stdconsul.ServiceEntry
+	block   chan struct{}
+}
+
+func newFakeConsulClient(addrs ...string) *fakeConsulClient {
+	c := &fakeConsulClient{block: make(chan struct{})}
+	for i, addr := range addrs {
+		c.entries = append(c.entries, &stdconsul.ServiceEntry{
+			Node:    &stdconsul.Node{},
+			Service: &stdconsul.AgentService{ID: strconv.Itoa(i), Service: "TestSvc", Address: addr, Port: 8080},
+		})
+	}
+	return c
+}
+
+func (c *fakeConsulClient) Register(*stdconsul.AgentServiceRegistration) error   { return nil }
+func (c *fakeConsulClient) Deregister(*stdconsul.AgentServiceRegistration) error { return nil }
+
+// 为第i个实例设置tag，需要在创建client之前调用
+func (c *fakeConsulClient) withTags(i int, tags ...string) *fakeConsulClient {
+	c.entries[i].Service.Tags = tags
+	return c
+}
+
+// 与consul一样只按一个tag筛选，其他tag由consul.Instancer筛选
+func (c *fakeConsulClient) Service(_, tag string, _ bool, opts *stdconsul.QueryOptions) ([]*stdconsul.ServiceEntry, *stdconsul.QueryMeta, error) {
+	if opts != nil && opts.WaitIndex > 0 {
+		<-c.block
+		return nil, nil, errors.New("fake consul: stopped")
+	}
+	var entries []*stdconsul.ServiceEntry
+	for _, e := range c.entries {
+		for _, t := range e.Service.Tags {
+			if t == tag {
+				entries = append(entries, e)
+				break
+			}
+		}
+		if tag == "" {
+			entries = append(entries, e)
+		}
+	}
+	return entries, &stdconsul.QueryMeta{LastIndex: 1}, nil
+}
+
+// 返回的endpoint响应实例地址，bad中的实例调用失败，slow中的实例等待ctx结束
+func testFactory(bad, slow map[string]bool) func(string) (endpoint.Endpoint, io.Closer, error) {
+	return func(instance string) (endpoint.Endpoint, io.Closer, error) {
+		return func(ctx context.Context, _ interface{}) (interface{}, error) {
+			if bad[instance] {
+				return nil, errors.New("bad instance")
+			}
+			if slow[instance] {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+			return instance, nil
+		}, nil, nil
+	}
+}
+
+func newTestClient(cli *fakeConsulClient, opts ...Option) (*Client, func()) {
+	c := NewWithClient(cli, "TestSvc", log.NewNopLogger(), opts...)
+	return c, func() {
+		c.Stop()
+		close(cli.block)
+	}
+}
+
+// 实例列表是异步更新的，等待endpoint可用
+func waitCall(ep endpoint.Endpoint) (interface{}, error) {
+	var (
+		rsp interface{}
+		err error
+	)
+	for i := 0; i < 100; i++ {
+		if rsp, err = ep(context.Background(), nil); err == nil {
+			return rsp, nil
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return rsp, err
+}
+
+func TestRoundRobin(t *testing.T) {
+	c, stop := newTestClient(newFakeConsulClient("10.0.0.1", "10.0.0.2"))
+	defer stop()
+	ep := c.Endpoint(testFactory(nil, nil))
+	if _, err := waitCall(ep); err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[interface{}]int{}
+	for i := 0; i < 4; i++ {
+		rsp, err := ep(context.Background(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[rsp]++
+	}
+	if got["10.0.0.1:8080"] != 2 || got["10.0.0.2:8080"] != 2 {
+		t.Errorf("not balanced, got:%v", got)
+	}
+}
+
+func TestAffinity(t *testing.T) {
+	cli := newFakeConsulClient("10.0.0.1", "10.0.0.2", "10.0.0.3").
+		withTags(0, "gokit_svc", "zone=a").withTags(1, "gokit_svc", "zone=a", "version=v2").withTags(2, "gokit_svc", "zone=b")
+	for _, tt := range []struct {
+		name string
+		opts []Option
+		want map[interface{}]bool
+	}{
+		{name: "[same zone]", opts: []Option{WithAffinity("zone=a")}, want: map[interface{}]bool{"10.0.0.1:8080": true, "10.0.0.2:8080": true}},
+		{name: "[canary first]", opts: []Option{WithAffinity("version=v2", "zone=b"), WithAffinity("version=v2"), WithAffinity("zone=b")},
+			want: map[interface{}]bool{"10.0.0.2:8080": true}},
+		// 没有匹配的实例时使用所有实例
+		{name: "[fallback]", opts: []Option{WithAffinity("zone=c")}, want: map[interface{}]bool{"10.0.0.1:8080": true, "10.0.0.2:8080": true, "10.0.0.3:8080": true}},
+	} {
+		c := NewWithClient(cli, "TestSvc", log.NewNopLogger(), append(tt.opts, WithTags("gokit_svc"))...)
+		ep := c.Endpoint(testFactory(nil, nil))
+		// 各组的实例列表是分别异步更新的，等到优先的一组可用
+		for i := 0; i < 100; i++ {
+			if rsp, err := ep(context.Background(), nil); err == nil && tt.want[rsp] {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		got := map[interface{}]bool{}
+		for i := 0; i < 6; i++ {
+			rsp, err := ep(context.Background(), nil)
+			if err != nil || !tt.want[rsp] {
+				t.Errorf("name:%s got rsp:%v err:%v", tt.name, rsp, err)
+			}
+			got[rsp] = true
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("name:%s got instances:%v", tt.name, got)
+		}
+		c.Stop()
+	}
+	close(cli.block)
+}
+
+func TestWithoutTags(t *testing.T) {
+	cli := newFakeConsulClient("10.0.0.1", "10.0.0.2", "10.0.0.3").
+		withTags(0, "gokit_svc", "zone=a").withTags(1, "gokit_svc", "zone=a", "canary").withTags(2, "gokit_svc", "zone=b")
+	for _, tt := range []struct {
+		name string
+		opts []Option
+		want map[interface{}]bool
+	}{
+		{name: "[stable]", opts: []Option{WithoutTags("canary")}, want: map[interface{}]bool{"10.0.0.1:8080": true, "10.0.0.3:8080": true}},
+		// 优先的一组同样排除
+		{name: "[stable same zone]", opts: []Option{WithoutTags("canary"), WithAffinity("zone=a")}, want: map[interface{}]bool{"10.0.0.1:8080": true}},
+	} {
+		c := NewWithClient(cli, "TestSvc", log.NewNopLogger(), append(tt.opts, WithTags("gokit_svc"))...)
+		ep := c.Endpoint(testFactory(nil, nil))
+		got := map[interface{}]bool{}
+		for i := 0; i < 6; i++ {
+			rsp, err := waitCall(ep)
+			if err != nil || !tt.want[rsp] {
+				t.Errorf("name:%s got rsp:%v err:%v", tt.name, rsp, err)
+			}
+			got[rsp] = true
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("name:%s got instances:%v", tt.name, got)
+		}
+		c.Stop()
+	}
+	close(cli.block)
+}
+
+func TestRetry(t *testing.T) {
+	c, stop := newTestClient(newFakeConsulClient("10.0.0.1", "10.0.0.2"), WithBalancer(Random), WithRetry(5, time.Second))
+	defer stop()
+	ep := c.Endpoint(testFactory(map[string]bool{"10.0.0.1:8080": true}, nil))
+	for i := 0; i < 10; i++ {
+		rsp, err := waitCall(ep)
+		if err != nil || rsp != "10.0.0.2:8080" {
+			t.Fatalf("got rsp:%v err:%v", rsp, err)
+		}
+	}
+}
+
+func TestCallTimeout(t *testing.T) {
+	c, stop := newTestClient(newFakeConsulClient("10.0.0.1", "10.0.0.2"),
+		WithRetry(3, time.Second), WithCallTimeout(20*time.Millisecond))
+	defer stop()
+	ep := c.Endpoint(testFactory(nil, map[string]bool{"10.0.0.1:8080": true}))
+	if _, err := waitCall(ep); err != nil {
+		t.Fatal(err)
+	}
+
+	// 慢实例超时后换一个实例重试，总耗时远小于重试的总超时时间
+	for i := 0; i < 4; i++ {
+		start := time.Now()
+		rsp, err := ep(context.Background(), nil)
+		if err != nil || rsp != "10.0.0.2:8080" {
+			t.Fatalf("got rsp:%v err:%v", rsp, err)
+		}
+		if cost := time.Since(start); cost > 500*time.Millisecond {
+			t.Errorf("call timeout not applied, cost:%v", cost)
+		}
+	}
+}
+
+func TestNewWithInstancer(t *testing.T) {
+	c := NewWithInstancer(sd.FixedInstancer{"10.0.0.1:8080"}, log.NewNopLogger())
+	defer c.Stop()
+	rsp, err := waitCall(c.Endpoint(testFactory(nil, nil)))
+	if err != nil || rsp != "10.0.0.1:8080" {
+		t.Errorf("got rsp:%v err:%v", rsp, err)
+	}
+}
+
+func TestDialOptions(t *testing.T) {
+	c := NewWithInstancer(sd.FixedInstancer{}, log.NewNopLogger(), WithDialOptions(grpc.WithInsecure()), WithDialOptions(grpc.WithBlock()))
+	defer c.Stop()
+	if n := len(c.DialOptions()); n != 2 {
+		t.Errorf("got %d dial options", n)
+	}
+	if opts := NewWithInstancer(sd.FixedInstancer{}, log.NewNopLogger()).DialOptions(); opts != nil {
+		t.Errorf("got default dial options:%v", opts)
+	}
+}
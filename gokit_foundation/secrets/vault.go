@@ -0,0 +1,387 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"gokit_foundation/auth"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+从HashiCorp Vault读取密钥(数据库密码、JWT签名key等)，直接调用Vault的HTTP API，不依赖vault的go client：
+-	认证：token(VAULT_TOKEN)或kubernetes(VAULT_K8S_ROLE，使用pod的service account token登录)
+-	Get读取的secret缓存在进程内，Run在后台续期：有lease的secret在lease过去2/3时续期，不能续期或续期失败时重新读取，
+	没有lease的secret(如KV)每RefreshInterval重新读取；kubernetes登录得到的token同样在过期前续期，失败时重新登录
+-	secret内容变化(如数据库动态凭据轮换、KV中的key更新)时调用OnChange注册的回调
+Run一般作为TaskGroup的后台任务，Run退出后缓存不再更新但仍可以读取
+*/
+
+const (
+	EnvAddr    = "VAULT_ADDR"
+	EnvToken   = "VAULT_TOKEN"
+	EnvK8sRole = "VAULT_K8S_ROLE"
+
+	DefaultK8sTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+)
+
+var ErrNotFound = errors.New("secrets: not found")
+
+type Config struct {
+	Addr  string // 如 http://127.0.0.1:8200，为空时不启用
+	Token string
+	// 设置后使用kubernetes auth登录，忽略Token
+	K8sRole      string
+	K8sMount     string // kubernetes auth的挂载路径，默认kubernetes
+	K8sTokenPath string // service account token文件，默认DefaultK8sTokenPath
+	// 没有lease的secret重新读取的间隔，默认5分钟
+	RefreshInterval time.Duration
+}
+
+// ConfigFromEnv 环境变量与vault命令行工具的约定一致
+func ConfigFromEnv() Config {
+	return Config{Addr: os.Getenv(EnvAddr), Token: os.Getenv(EnvToken), K8sRole: os.Getenv(EnvK8sRole)}
+}
+
+func (c Config) Enabled() bool {
+	return c.Addr != ""
+}
+
+func (c Config) Validate() error {
+	if c.Enabled() && c.Token == "" && c.K8sRole == "" {
+		return fmt.Errorf("secrets: either %s or %s is required", EnvToken, EnvK8sRole)
+	}
+	return nil
+}
+
+type Secret struct {
+	Data          map[string]interface{}
+	LeaseID       string
+	LeaseDuration time.Duration
+	Renewable     bool
+
+	fetched time.Time // 读取或最近一次续期的时间
+}
+
+// String 返回Data中key对应的字符串，不存在或不是字符串时返回err
+func (s *Secret) String(key string) (string, error) {
+	v, ok := s.Data[key].(string)
+	if !ok {
+		return "", fmt.Errorf("secrets: key %q not found or not a string", key)
+	}
+	return v, nil
+}
+
+type Vault struct {
+	conf   Config
+	client *http.Client
+	logger log.Logger
+	now    func() time.Time
+
+	mu        sync.Mutex
+	token     string
+	tokenTTL  time.Duration // 0表示不过期(如root token)
+	tokenAt   time.Time
+	renewable bool
+	cache     map[string]*Secret
+	callbacks map[string][]func(*Secret)
+}
+
+// New 完成认证，token认证时通过lookup-self校验token并获取其有效期
+func New(ctx context.Context, conf Config, logger log.Logger) (*Vault, error) {
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+	if !conf.Enabled() {
+		return nil, fmt.Errorf("secrets: %s not set", EnvAddr)
+	}
+	if conf.K8sMount == "" {
+		conf.K8sMount = "kubernetes"
+	}
+	if conf.K8sTokenPath == "" {
+		conf.K8sTokenPath = DefaultK8sTokenPath
+	}
+	if conf.RefreshInterval <= 0 {
+		conf.RefreshInterval = 5 * time.Minute
+	}
+	v := &Vault{
+		conf:      conf,
+		client:    &http.Client{Timeout: 5 * time.Second},
+		logger:    logger,
+		now:       time.Now,
+		token:     conf.Token,
+		cache:     map[string]*Secret{},
+		callbacks: map[string][]func(*Secret){},
+	}
+	if err := v.login(ctx); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+type vaultResponse struct {
+	Data          map[string]interface{} `json:"data"`
+	LeaseID       string                 `json:"lease_id"`
+	LeaseDuration int64                  `json:"lease_duration"`
+	Renewable     bool                   `json:"renewable"`
+	Auth          *struct {
+		ClientToken   string `json:"client_token"`
+		LeaseDuration int64  `json:"lease_duration"`
+		Renewable     bool   `json:"renewable"`
+	} `json:"auth"`
+	Errors []string `json:"errors"`
+}
+
+func (v *Vault) do(ctx context.Context, method, path string, body interface{}) (*vaultResponse, error) {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, strings.TrimSuffix(v.conf.Addr, "/")+"/v1/"+strings.TrimPrefix(path, "/"), reader)
+	if err != nil {
+		return nil, err
+	}
+	v.mu.Lock()
+	token := v.token
+	v.mu.Unlock()
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	rsp, err := v.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("secrets: %s %s: %v", method, path, err)
+	}
+	defer rsp.Body.Close()
+	b, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var vr vaultResponse
+	if len(b) > 0 {
+		if err = json.Unmarshal(b, &vr); err != nil {
+			return nil, fmt.Errorf("secrets: %s %s: decode response: %v", method, path, err)
+		}
+	}
+	if rsp.StatusCode == http.StatusNotFound && len(vr.Errors) == 0 {
+		return nil, ErrNotFound
+	}
+	if rsp.StatusCode >= 400 {
+		return nil, fmt.Errorf("secrets: %s %s: status %d: %s", method, path, rsp.StatusCode, strings.Join(vr.Errors, "; "))
+	}
+	return &vr, nil
+}
+
+// token认证时查询token的有效期，kubernetes认证时登录获取token
+func (v *Vault) login(ctx context.Context) error {
+	if v.conf.K8sRole == "" {
+		rsp, err := v.do(ctx, http.MethodGet, "auth/token/lookup-self", nil)
+		if err != nil {
+			return err
+		}
+		ttl, _ := rsp.Data["ttl"].(float64)
+		renewable, _ := rsp.Data["renewable"].(bool)
+		v.setToken(v.conf.Token, time.Duration(ttl)*time.Second, renewable)
+		return nil
+	}
+	jwt, err := ioutil.ReadFile(v.conf.K8sTokenPath)
+	if err != nil {
+		return fmt.Errorf("secrets: read service account token: %v", err)
+	}
+	rsp, err := v.do(ctx, http.MethodPost, "auth/"+v.conf.K8sMount+"/login",
+		map[string]string{"role": v.conf.K8sRole, "jwt": strings.TrimSpace(string(jwt))})
+	if err != nil {
+		return err
+	}
+	if rsp.Auth == nil || rsp.Auth.ClientToken == "" {
+		return errors.New("secrets: kubernetes login returned no token")
+	}
+	v.setToken(rsp.Auth.ClientToken, time.Duration(rsp.Auth.LeaseDuration)*time.Second, rsp.Auth.Renewable)
+	return nil
+}
+
+func (v *Vault) setToken(token string, ttl time.Duration, renewable bool) {
+	v.mu.Lock()
+	v.token, v.tokenTTL, v.renewable, v.tokenAt = token, ttl, renewable, v.now()
+	v.mu.Unlock()
+}
+
+// Read 直接从vault读取path，不经过缓存；KV v2(路径形如secret/data/xxx)的数据会自动去掉外层的data/metadata
+func (v *Vault) Read(ctx context.Context, path string) (*Secret, error) {
+	rsp, err := v.do(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if rsp.Data == nil {
+		return nil, ErrNotFound
+	}
+	data := rsp.Data
+	if inner, ok := data["data"].(map[string]interface{}); ok && data["metadata"] != nil && len(data) == 2 {
+		data = inner
+	}
+	return &Secret{
+		Data:          data,
+		LeaseID:       rsp.LeaseID,
+		LeaseDuration: time.Duration(rsp.LeaseDuration) * time.Second,
+		Renewable:     rsp.Renewable,
+		fetched:       v.now(),
+	}, nil
+}
+
+// Get 读取path，读取成功后缓存并由Run负责续期/刷新，不要修改返回的Secret
+func (v *Vault) Get(ctx context.Context, path string) (*Secret, error) {
+	v.mu.Lock()
+	s, ok := v.cache[path]
+	v.mu.Unlock()
+	if ok {
+		return s, nil
+	}
+	s, err := v.Read(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	v.mu.Lock()
+	// 并发读取时以先缓存的为准
+	if cached, ok := v.cache[path]; ok {
+		s = cached
+	} else {
+		v.cache[path] = s
+	}
+	v.mu.Unlock()
+	return s, nil
+}
+
+// GetString 读取path中key对应的字符串，如数据库凭据的password
+func (v *Vault) GetString(ctx context.Context, path, key string) (string, error) {
+	s, err := v.Get(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	return s.String(key)
+}
+
+// KeySource 从path中的key读取JWT签名key(见auth.JWTMiddleware)，每次验签读取缓存，vault中的key更新后自动使用新的key
+func (v *Vault) KeySource(path, key string) auth.KeySource {
+	return func() ([]byte, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		s, err := v.GetString(ctx, path, key)
+		return []byte(s), err
+	}
+}
+
+// OnChange 注册path的secret内容变化时的回调，在Run的goroutine中调用，不要阻塞
+func (v *Vault) OnChange(path string, fn func(*Secret)) {
+	v.mu.Lock()
+	v.callbacks[path] = append(v.callbacks[path], fn)
+	v.mu.Unlock()
+}
+
+// Run 定期续期/刷新token和缓存的secret，直到ctx结束，失败时只打印日志，下次检查时重试
+func (v *Vault) Run(ctx context.Context, checkInterval time.Duration) error {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		v.renewToken(ctx)
+		v.mu.Lock()
+		paths := make([]string, 0, len(v.cache))
+		for path := range v.cache {
+			paths = append(paths, path)
+		}
+		v.mu.Unlock()
+		for _, path := range paths {
+			v.refresh(ctx, path)
+		}
+	}
+}
+
+// 经过了有效期的2/3时需要续期
+func (v *Vault) due(since time.Time, ttl time.Duration) bool {
+	return v.now().Sub(since) >= ttl*2/3
+}
+
+func (v *Vault) renewToken(ctx context.Context) {
+	v.mu.Lock()
+	ttl, at, renewable := v.tokenTTL, v.tokenAt, v.renewable
+	v.mu.Unlock()
+	if ttl == 0 || !v.due(at, ttl) {
+		return
+	}
+	if renewable {
+		rsp, err := v.do(ctx, http.MethodPost, "auth/token/renew-self", map[string]string{})
+		if err == nil && rsp.Auth != nil {
+			v.setToken(rsp.Auth.ClientToken, time.Duration(rsp.Auth.LeaseDuration)*time.Second, rsp.Auth.Renewable)
+			return
+		}
+		v.logger.Log("secrets", "renew token failed", "err", err)
+	}
+	// 不能续期(达到max_ttl)时只有kubernetes认证可以重新登录
+	if v.conf.K8sRole != "" {
+		err := v.login(ctx)
+		v.logger.Log("secrets", "re-login", "err", err)
+	}
+}
+
+func (v *Vault) refresh(ctx context.Context, path string) {
+	v.mu.Lock()
+	old := v.cache[path]
+	v.mu.Unlock()
+	if old.LeaseDuration == 0 {
+		if v.now().Sub(old.fetched) < v.conf.RefreshInterval {
+			return
+		}
+	} else if !v.due(old.fetched, old.LeaseDuration) {
+		return
+	}
+	if old.Renewable && old.LeaseID != "" {
+		rsp, err := v.do(ctx, http.MethodPut, "sys/leases/renew", map[string]interface{}{
+			"lease_id": old.LeaseID, "increment": int64(old.LeaseDuration / time.Second)})
+		// 达到max_ttl时续期后的有效期会变短，很短时不如重新读取
+		if err == nil && time.Duration(rsp.LeaseDuration)*time.Second >= old.LeaseDuration/3 {
+			renewed := *old
+			renewed.LeaseDuration = time.Duration(rsp.LeaseDuration) * time.Second
+			renewed.fetched = v.now()
+			v.mu.Lock()
+			v.cache[path] = &renewed
+			v.mu.Unlock()
+			return
+		}
+		if err != nil {
+			v.logger.Log("secrets", "renew lease failed, read again", "path", path, "err", err)
+		}
+	}
+	s, err := v.Read(ctx, path)
+	if err != nil {
+		v.logger.Log("secrets", "refresh failed", "path", path, "err", err)
+		return
+	}
+	v.mu.Lock()
+	v.cache[path] = s
+	callbacks := v.callbacks[path]
+	v.mu.Unlock()
+	if reflect.DeepEqual(s.Data, old.Data) {
+		return
+	}
+	v.logger.Log("secrets", "changed", "path", path)
+	for _, fn := range callbacks {
+		fn(s)
+	}
+}
@@ -0,0 +1,210 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 模拟vault，数据库凭据每次读取都生成新的用户名，renewFail为true时续期失败
+type fakeVault struct {
+	mu        sync.Mutex
+	reads     int
+	renews    int
+	renewFail bool
+	jwtKey    string
+}
+
+func (f *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	reply := func(v interface{}) { _ = json.NewEncoder(w).Encode(v) }
+	token := r.Header.Get("X-Vault-Token")
+	if r.URL.Path != "/v1/auth/kubernetes/login" && token != "root" && token != "k8s-token" {
+		w.WriteHeader(http.StatusForbidden)
+		reply(map[string]interface{}{"errors": []string{"permission denied"}})
+		return
+	}
+	switch r.Method + " " + r.URL.Path {
+	case "GET /v1/auth/token/lookup-self":
+		reply(map[string]interface{}{"data": map[string]interface{}{"ttl": 0, "renewable": false}})
+	case "POST /v1/auth/kubernetes/login":
+		var req map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if req["role"] != "usersvc" || req["jwt"] != "sa-jwt" {
+			w.WriteHeader(http.StatusBadRequest)
+			reply(map[string]interface{}{"errors": []string{"invalid role or jwt"}})
+			return
+		}
+		reply(map[string]interface{}{"auth": map[string]interface{}{"client_token": "k8s-token", "lease_duration": 3600, "renewable": true}})
+	case "GET /v1/secret/data/usersvc":
+		reply(map[string]interface{}{"data": map[string]interface{}{
+			"data": map[string]interface{}{"jwt_key": f.jwtKey}, "metadata": map[string]interface{}{"version": 1}}})
+	case "GET /v1/database/creds/usersvc":
+		f.reads++
+		reply(map[string]interface{}{"lease_id": fmt.Sprintf("database/creds/usersvc/%d", f.reads), "lease_duration": 60, "renewable": true,
+			"data": map[string]interface{}{"username": fmt.Sprintf("u%d", f.reads), "password": "p"}})
+	case "PUT /v1/sys/leases/renew":
+		f.renews++
+		if f.renewFail {
+			w.WriteHeader(http.StatusBadRequest)
+			reply(map[string]interface{}{"errors": []string{"lease not found"}})
+			return
+		}
+		reply(map[string]interface{}{"lease_duration": 60, "renewable": true})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// 可以手动推进的时钟
+type fakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) add(d time.Duration) {
+	c.mu.Lock()
+	c.t = c.t.Add(d)
+	c.mu.Unlock()
+}
+
+func TestVaultGet(t *testing.T) {
+	fv := &fakeVault{jwtKey: "k1"}
+	srv := httptest.NewServer(fv)
+	defer srv.Close()
+
+	if _, err := New(context.Background(), Config{Addr: srv.URL, Token: "bad"}, log.NewNopLogger()); err == nil {
+		t.Error("want err for bad token")
+	}
+	v, err := New(context.Background(), Config{Addr: srv.URL, Token: "root"}, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// KV v2去掉外层的data/metadata
+	if key, err := v.KeySource("secret/data/usersvc", "jwt_key")(); err != nil || string(key) != "k1" {
+		t.Errorf("got key:%s err:%v", key, err)
+	}
+	if _, err := v.GetString(context.Background(), "secret/data/usersvc", "no_such_key"); err == nil {
+		t.Error("want err for missing key")
+	}
+	if _, err := v.Get(context.Background(), "secret/data/none"); err != ErrNotFound {
+		t.Errorf("got err:%v want ErrNotFound", err)
+	}
+	// 缓存
+	for i := 0; i < 3; i++ {
+		if user, err := v.GetString(context.Background(), "database/creds/usersvc", "username"); err != nil || user != "u1" {
+			t.Errorf("got user:%s err:%v", user, err)
+		}
+	}
+}
+
+func TestVaultRun(t *testing.T) {
+	fv := &fakeVault{jwtKey: "k1"}
+	srv := httptest.NewServer(fv)
+	defer srv.Close()
+
+	v, err := New(context.Background(), Config{Addr: srv.URL, Token: "root", RefreshInterval: time.Minute}, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := &fakeClock{t: time.Now()}
+	v.now = clock.now
+	ctx := context.Background()
+	_, _ = v.Get(ctx, "database/creds/usersvc")
+	_, _ = v.Get(ctx, "secret/data/usersvc")
+	changed := make(chan *Secret, 10)
+	v.OnChange("database/creds/usersvc", func(s *Secret) { changed <- s })
+	v.OnChange("secret/data/usersvc", func(s *Secret) { changed <- s })
+
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan error)
+	go func() { done <- v.Run(runCtx, time.Millisecond*5) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	waitFor := func(what string, cond func() bool) {
+		deadline := time.Now().Add(time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("%s not happened within 1s", what)
+			}
+			time.Sleep(time.Millisecond * 5)
+		}
+	}
+
+	// lease过去2/3时续期，凭据不变
+	clock.add(41 * time.Second)
+	waitFor("renew", func() bool { fv.mu.Lock(); defer fv.mu.Unlock(); return fv.renews == 1 })
+	time.Sleep(time.Millisecond * 20)
+	if user, _ := v.GetString(ctx, "database/creds/usersvc", "username"); user != "u1" || len(changed) != 0 {
+		t.Errorf("got user:%s changes:%d after renew", user, len(changed))
+	}
+
+	// 续期失败时重新读取，得到新的凭据
+	fv.mu.Lock()
+	fv.renewFail = true
+	fv.mu.Unlock()
+	clock.add(41 * time.Second)
+	select {
+	case s := <-changed:
+		if user, _ := s.String("username"); user != "u2" {
+			t.Errorf("got changed user:%s", user)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("change not notified")
+	}
+
+	// 没有lease的KV每RefreshInterval重新读取，内容变化时通知
+	fv.mu.Lock()
+	fv.jwtKey = "k2"
+	fv.mu.Unlock()
+	clock.add(time.Minute)
+	waitFor("jwt key refresh", func() bool {
+		key, _ := v.KeySource("secret/data/usersvc", "jwt_key")()
+		return string(key) == "k2"
+	})
+}
+
+func TestVaultK8sLogin(t *testing.T) {
+	srv := httptest.NewServer(&fakeVault{})
+	defer srv.Close()
+	dir, err := ioutil.TempDir("", "secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tokenPath := dir + "/token"
+	if err := ioutil.WriteFile(tokenPath, []byte("sa-jwt\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := New(context.Background(), Config{Addr: srv.URL, K8sRole: "usersvc", K8sTokenPath: tokenPath}, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.token != "k8s-token" || v.tokenTTL != time.Hour || !v.renewable {
+		t.Errorf("got token:%s ttl:%v renewable:%v", v.token, v.tokenTTL, v.renewable)
+	}
+	if _, err := New(context.Background(), Config{Addr: srv.URL, K8sRole: "other", K8sTokenPath: tokenPath}, log.NewNopLogger()); err == nil {
+		t.Error("want err for bad role")
+	}
+	if err := (Config{Addr: srv.URL}).Validate(); err == nil {
+		t.Error("want err without token and role")
+	}
+}
@@ -0,0 +1,235 @@
+package slo
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+/*
+根据每个接口声明的SLO生成prometheus的recording/alerting rules(多窗口burn rate，见google SRE workbook第5章)，
+SLO与定义endpoint的代码放在一起，修改接口后重新生成，告警不会与代码脱节：
+-	SLI基于endpoint层的耗时histogram(labels: method、success)：成功且耗时不超过Latency的调用为good，
+	Latency为0时只统计成功率；Latency必须是histogram的某个bucket上界，否则无法从_bucket中准确计算
+-	recording rule：每个窗口一条slo:sli_error:ratio_rate<窗口>，labels为service、method
+-	alerting rule：长短两个窗口的错误率都超过burn rate * 错误预算时告警，短窗口使告警在恢复后尽快消失
+	page：1h/5m 14.4倍(2%的月预算)、6h/30m 6倍(5%)；ticket：1d/2h 3倍(10%)、3d/6h 1倍(10%)
+*/
+
+// Objective 一个接口的SLO，如Sum: 99.9%的调用在50ms内成功
+type Objective struct {
+	Method  string
+	Target  float64       // 0到1之间，如0.999
+	Latency time.Duration // 为0时只要求成功
+}
+
+// Metric endpoint层的耗时histogram
+type Metric struct {
+	Name         string    // 不含_bucket等后缀，如example_addsvc_request_duration_seconds
+	MethodLabel  string    // 为空时为method
+	SuccessLabel string    // 为空时为success，值为"true"、"false"
+	Buckets      []float64 // histogram的bucket上界(秒)，用于校验Latency
+}
+
+// Window 一组长短窗口
+type Window struct {
+	Long, Short string
+	BurnRate    float64
+	For         string
+	Severity    string
+}
+
+// DefaultWindows 30天的SLO窗口
+var DefaultWindows = []Window{
+	{Long: "1h", Short: "5m", BurnRate: 14.4, For: "2m", Severity: "page"},
+	{Long: "6h", Short: "30m", BurnRate: 6, For: "15m", Severity: "page"},
+	{Long: "1d", Short: "2h", BurnRate: 3, For: "1h", Severity: "ticket"},
+	{Long: "3d", Short: "6h", BurnRate: 1, For: "3h", Severity: "ticket"},
+}
+
+type Rule struct {
+	Record, Alert string
+	Expr          string
+	For           string
+	Labels        map[string]string
+	Annotations   map[string]string
+}
+
+// Rules 生成prometheus rule文件的内容(一个group)，service写入所有rule的labels
+func Rules(service string, m Metric, objectives []Objective) ([]byte, error) {
+	rules, err := build(service, m, objectives, DefaultWindows)
+	if err != nil {
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	err = fileTmpl.Execute(buf, struct {
+		Group string
+		Rules []Rule
+	}{Group: service + "-slo", Rules: rules})
+	return buf.Bytes(), err
+}
+
+func build(service string, m Metric, objectives []Objective, windows []Window) ([]Rule, error) {
+	if m.Name == "" {
+		return nil, fmt.Errorf("slo: metric name is empty")
+	}
+	if m.MethodLabel == "" {
+		m.MethodLabel = "method"
+	}
+	if m.SuccessLabel == "" {
+		m.SuccessLabel = "success"
+	}
+	// 同一个窗口可能被多组使用，只生成一次
+	var ranges []string
+	for _, w := range windows {
+		ranges = appendUnique(ranges, w.Long, w.Short)
+	}
+	seen := map[string]bool{}
+	var records, alerts []Rule
+	for _, o := range objectives {
+		if o.Method == "" || seen[o.Method] {
+			return nil, fmt.Errorf("slo: empty or duplicate method %q", o.Method)
+		}
+		seen[o.Method] = true
+		if o.Target <= 0 || o.Target >= 1 {
+			return nil, fmt.Errorf("slo: %s: target %v must be between 0 and 1", o.Method, o.Target)
+		}
+		le, err := bucket(m.Buckets, o.Latency)
+		if err != nil {
+			return nil, fmt.Errorf("slo: %s: %v", o.Method, err)
+		}
+
+		labels := map[string]string{"service": service, "method": o.Method}
+		sel := fmt.Sprintf(`%s=%q`, m.MethodLabel, o.Method)
+		good := fmt.Sprintf(`%s_count{%s,%s="true"}`, m.Name, sel, m.SuccessLabel)
+		if le != "" {
+			good = fmt.Sprintf(`%s_bucket{%s,%s="true",le=%q}`, m.Name, sel, m.SuccessLabel, le)
+		}
+		for _, r := range ranges {
+			records = append(records, Rule{
+				Record: recordName(r),
+				Expr:   fmt.Sprintf(`1 - (sum(rate(%s[%s])) / sum(rate(%s_count{%s}[%s])))`, good, r, m.Name, sel, r),
+				Labels: labels,
+			})
+		}
+
+		budget := 1 - o.Target
+		objective := fmt.Sprintf("%s%%成功", round(o.Target*100))
+		if o.Latency > 0 {
+			objective = fmt.Sprintf("%s%%在%s内成功", round(o.Target*100), o.Latency)
+		}
+		for _, w := range windows {
+			threshold := round(w.BurnRate * budget)
+			match := fmt.Sprintf(`{service=%q,method=%q}`, service, o.Method)
+			alerts = append(alerts, Rule{
+				Alert: "SLOErrorBudgetBurn",
+				Expr: fmt.Sprintf("%s%s > %s\nand\n%s%s > %s",
+					recordName(w.Long), match, threshold, recordName(w.Short), match, threshold),
+				For: w.For,
+				Labels: map[string]string{
+					"service": service, "method": o.Method, "severity": w.Severity, "long_window": w.Long,
+				},
+				Annotations: map[string]string{
+					"summary":     fmt.Sprintf("%s %s的错误预算消耗过快", service, o.Method),
+					"description": fmt.Sprintf("SLO: %s，%s和%s内的错误率超过%s倍的错误预算(%s)", objective, w.Long, w.Short, round(w.BurnRate), threshold),
+				},
+			})
+		}
+	}
+	return append(records, alerts...), nil
+}
+
+// Latency对应的le label值，Latency为0时为空
+func bucket(buckets []float64, latency time.Duration) (string, error) {
+	if latency == 0 {
+		return "", nil
+	}
+	s := latency.Seconds()
+	for _, b := range buckets {
+		if math.Abs(b-s) < 1e-9 {
+			return formatFloat(b), nil
+		}
+	}
+	return "", fmt.Errorf("latency %s is not a bucket boundary of %v", latency, buckets)
+}
+
+func recordName(window string) string {
+	return "slo:sli_error:ratio_rate" + window
+}
+
+func appendUnique(list []string, items ...string) []string {
+	for _, it := range items {
+		found := false
+		for _, l := range list {
+			found = found || l == it
+		}
+		if !found {
+			list = append(list, it)
+		}
+	}
+	return list
+}
+
+// 与prometheus的le label格式相同(如0.05、1、+Inf)
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// 去掉浮点运算的误差，如(1-0.999)*14.4输出0.0144
+func round(f float64) string {
+	return strconv.FormatFloat(f, 'g', 12, 64)
+}
+
+// yaml的双引号字符串与json的转义规则兼容
+func quote(s string) string {
+	return strconv.Quote(s)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func indent(n int, s string) string {
+	pad := strings.Repeat(" ", n)
+	return pad + strings.Replace(s, "\n", "\n"+pad, -1)
+}
+
+var fileTmpl = template.Must(template.New("rules").Funcs(template.FuncMap{
+	"quote": quote, "keys": sortedKeys, "indent": indent,
+}).Parse(`# Code generated by slo.Rules. DO NOT EDIT.
+groups:
+- name: {{.Group}}
+  rules:
+{{- range $r := .Rules}}
+{{- if .Record}}
+  - record: {{.Record}}
+{{- else}}
+  - alert: {{.Alert}}
+{{- end}}
+    expr: |-
+{{indent 6 .Expr}}
+{{- if .For}}
+    for: {{.For}}
+{{- end}}
+    labels:
+{{- range $k := keys .Labels}}
+      {{$k}}: {{quote (index $r.Labels $k)}}
+{{- end}}
+{{- if .Annotations}}
+    annotations:
+{{- range $k := keys .Annotations}}
+      {{$k}}: {{quote (index $r.Annotations $k)}}
+{{- end}}
+{{- end}}
+{{- end}}
+`))
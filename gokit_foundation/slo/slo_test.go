@@ -0,0 +1,89 @@
+package slo
+
+import (
+	"gopkg.in/yaml.v2"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testMetric = Metric{Name: "example_addsvc_request_duration_seconds", Buckets: []float64{.005, .01, .025, .05, .1}}
+
+type ruleFile struct {
+	Groups []struct {
+		Name  string
+		Rules []struct {
+			Record, Alert, Expr, For string
+			Labels, Annotations      map[string]string
+		}
+	}
+}
+
+func TestRules(t *testing.T) {
+	out, err := Rules("addsvc", testMetric, []Objective{
+		{Method: "Sum", Target: 0.999, Latency: 50 * time.Millisecond},
+		{Method: "Concat", Target: 0.99},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var f ruleFile
+	if err := yaml.Unmarshal(out, &f); err != nil {
+		t.Fatalf("invalid yaml: %v\n%s", err, out)
+	}
+	if len(f.Groups) != 1 || f.Groups[0].Name != "addsvc-slo" {
+		t.Fatalf("got groups:%+v", f.Groups)
+	}
+	// 每个接口7个窗口的recording rule和4条alert
+	rules := f.Groups[0].Rules
+	if len(rules) != 2*(7+4) {
+		t.Fatalf("got %d rules", len(rules))
+	}
+
+	want := map[string]string{
+		"Sum:slo:sli_error:ratio_rate5m": `1 - (sum(rate(example_addsvc_request_duration_seconds_bucket{method="Sum",success="true",le="0.05"}[5m])) / ` +
+			`sum(rate(example_addsvc_request_duration_seconds_count{method="Sum"}[5m])))`,
+		// 没有Latency时只统计成功率
+		"Concat:slo:sli_error:ratio_rate3d": `1 - (sum(rate(example_addsvc_request_duration_seconds_count{method="Concat",success="true"}[3d])) / ` +
+			`sum(rate(example_addsvc_request_duration_seconds_count{method="Concat"}[3d])))`,
+		"Sum:1h":    "slo:sli_error:ratio_rate1h{service=\"addsvc\",method=\"Sum\"} > 0.0144\nand\nslo:sli_error:ratio_rate5m{service=\"addsvc\",method=\"Sum\"} > 0.0144",
+		"Concat:3d": "slo:sli_error:ratio_rate3d{service=\"addsvc\",method=\"Concat\"} > 0.01\nand\nslo:sli_error:ratio_rate6h{service=\"addsvc\",method=\"Concat\"} > 0.01",
+	}
+	for _, r := range rules {
+		if r.Labels["service"] != "addsvc" {
+			t.Errorf("got labels:%v", r.Labels)
+		}
+		key := r.Labels["method"] + ":" + r.Record
+		if r.Alert != "" {
+			key = r.Labels["method"] + ":" + r.Labels["long_window"]
+			if r.For == "" || r.Labels["severity"] == "" || !strings.Contains(r.Annotations["description"], "SLO") {
+				t.Errorf("got alert:%+v", r)
+			}
+		}
+		if w, ok := want[key]; ok {
+			if r.Expr != w {
+				t.Errorf("%s: got expr:\n%s\nwant:\n%s", key, r.Expr, w)
+			}
+			delete(want, key)
+		}
+	}
+	if len(want) != 0 {
+		t.Errorf("rules not found:%v", want)
+	}
+}
+
+func TestRulesInvalid(t *testing.T) {
+	for name, objectives := range map[string][]Objective{
+		"target":    {{Method: "Sum", Target: 1}},
+		"duplicate": {{Method: "Sum", Target: 0.9}, {Method: "Sum", Target: 0.99}},
+		// bucket中没有40ms
+		"latency": {{Method: "Sum", Target: 0.9, Latency: 40 * time.Millisecond}},
+	} {
+		if _, err := Rules("addsvc", testMetric, objectives); err == nil {
+			t.Errorf("%s: want error", name)
+		}
+	}
+	if _, err := Rules("addsvc", Metric{}, nil); err == nil {
+		t.Error("want error for empty metric name")
+	}
+}
@@ -0,0 +1,206 @@
+package sqlmw
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"gokit_foundation/logging"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+database/sql的driver包装，对每次查询记录耗时指标、创建span、输出慢查询日志，适用于任意driver(见Wrap)：
+-	statement名由调用方通过WithStatement放入ctx(如repository的每个方法一个名称)，没有时为sql的第一个关键字(select、insert等)，
+	作为指标标签和span名(sql <statement>)，不使用sql原文，避免标签基数过大
+-	Duration按statement、success上报，事务的begin、commit、rollback也计入(statement为begin、commit、rollback)
+-	ctx中有span时才创建子span(db.statement为sql原文，不带参数)，没有上游span的后台查询(如outbox投递)不产生孤立的trace
+-	耗时超过SlowThreshold时通过logging.FromContext输出日志(带上request_id等)，只输出sql原文，参数可能包含个人信息
+耗时只包括driver执行并返回第一批结果的时间，不包括调用方遍历rows的时间；显式Prepare的语句不经过这里
+*/
+
+type Config struct {
+	Tracer        stdopentracing.Tracer // 为nil时不创建span
+	Duration      metrics.Histogram     // 为nil时不上报
+	SlowThreshold time.Duration         // 为0时不输出慢查询日志
+}
+
+var errUnsupportedTxOptions = errors.New("sqlmw: driver does not support non-default transaction options")
+
+type ctxKeyStatement struct{}
+
+// WithStatement 设置之后在ctx上执行的sql的名称，如 users.get
+func WithStatement(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, ctxKeyStatement{}, name)
+}
+
+func statementName(ctx context.Context, query string) string {
+	if name, ok := ctx.Value(ctxKeyStatement{}).(string); ok {
+		return name
+	}
+	if f := strings.Fields(query); len(f) > 0 {
+		return strings.ToLower(f[0])
+	}
+	return "unknown"
+}
+
+// Wrap 包装connector，通过sql.OpenDB(Wrap(c, conf))使用
+func Wrap(c driver.Connector, conf Config) driver.Connector {
+	if conf.Duration == nil {
+		conf.Duration = discard.NewHistogram()
+	}
+	return &connector{Connector: c, obs: &observer{conf: conf}}
+}
+
+type observer struct {
+	conf Config
+}
+
+// start 返回结束时调用的函数，err为driver.ErrSkip时不记录(database/sql会改用其他方式再执行一次)
+func (o *observer) start(ctx context.Context, name, query string) func(err error) {
+	begin := time.Now()
+	var span stdopentracing.Span
+	if o.conf.Tracer != nil && stdopentracing.SpanFromContext(ctx) != nil {
+		span, _ = stdopentracing.StartSpanFromContextWithTracer(ctx, o.conf.Tracer, "sql "+name)
+		ext.DBType.Set(span, "sql")
+		if query != "" {
+			ext.DBStatement.Set(span, query)
+		}
+	}
+	return func(err error) {
+		if err == driver.ErrSkip {
+			if span != nil {
+				span.SetTag("skipped", true)
+				span.Finish()
+			}
+			return
+		}
+		took := time.Since(begin)
+		o.conf.Duration.With("statement", name, "success", strconv.FormatBool(err == nil)).Observe(took.Seconds())
+		if span != nil {
+			if err != nil {
+				ext.Error.Set(span, true)
+				span.LogKV("error", err.Error())
+			}
+			span.Finish()
+		}
+		if o.conf.SlowThreshold > 0 && took >= o.conf.SlowThreshold {
+			logging.FromContext(ctx).Log("sql", name, "slow", true, "took", took, "threshold", o.conf.SlowThreshold, "query", query, "err", err)
+		}
+	}
+}
+
+type connector struct {
+	driver.Connector
+	obs *observer
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	cn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{Conn: cn, obs: c.obs}, nil
+}
+
+type conn struct {
+	driver.Conn
+	obs *observer
+}
+
+var (
+	_ driver.ExecerContext      = (*conn)(nil)
+	_ driver.QueryerContext     = (*conn)(nil)
+	_ driver.ConnBeginTx        = (*conn)(nil)
+	_ driver.ConnPrepareContext = (*conn)(nil)
+	_ driver.Pinger             = (*conn)(nil)
+	_ driver.SessionResetter    = (*conn)(nil)
+)
+
+// 底层driver没有实现ExecerContext时返回ErrSkip，由database/sql改为Prepare后执行
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (res driver.Result, err error) {
+	e, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	end := c.obs.start(ctx, statementName(ctx, query), query)
+	defer func() { end(err) }()
+	return e.ExecContext(ctx, query, args)
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (rows driver.Rows, err error) {
+	q, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	end := c.obs.start(ctx, statementName(ctx, query), query)
+	defer func() { end(err) }()
+	return q.QueryContext(ctx, query, args)
+}
+
+func (c *conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return p.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (_ driver.Tx, err error) {
+	b, ok := c.Conn.(driver.ConnBeginTx)
+	if !ok {
+		// 与database/sql的处理相同，不支持ConnBeginTx的driver只能使用默认选项
+		if opts.Isolation != driver.IsolationLevel(0) || opts.ReadOnly {
+			return nil, errUnsupportedTxOptions
+		}
+	}
+	end := c.obs.start(ctx, "begin", "")
+	defer func() { end(err) }()
+	var tx driver.Tx
+	if ok {
+		tx, err = b.BeginTx(ctx, opts)
+	} else {
+		tx, err = c.Conn.Begin()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &txWrapper{Tx: tx, ctx: ctx, obs: c.obs}, nil
+}
+
+func (c *conn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *conn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+// commit、rollback没有ctx参数，使用BeginTx时的ctx
+type txWrapper struct {
+	driver.Tx
+	ctx context.Context
+	obs *observer
+}
+
+func (t *txWrapper) Commit() (err error) {
+	end := t.obs.start(t.ctx, "commit", "")
+	defer func() { end(err) }()
+	return t.Tx.Commit()
+}
+
+func (t *txWrapper) Rollback() (err error) {
+	end := t.obs.start(t.ctx, "rollback", "")
+	defer func() { end(err) }()
+	return t.Tx.Rollback()
+}
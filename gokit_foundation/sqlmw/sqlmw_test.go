@@ -0,0 +1,172 @@
+package sqlmw
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"github.com/go-kit/kit/log"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"gokit_foundation/logging"
+	"gokit_foundation/memtransport"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 只实现Exec、Query、BeginTx的driver，sleep模拟慢查询
+type fakeConnector struct {
+	sleep time.Duration
+}
+
+func (c fakeConnector) Connect(context.Context) (driver.Conn, error) {
+	return &fakeConn{sleep: c.sleep}, nil
+}
+func (c fakeConnector) Driver() driver.Driver { return nil }
+
+type fakeConn struct {
+	sleep time.Duration
+}
+
+var errFake = errors.New("fake: syntax error")
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("fake: prepare") }
+func (c *fakeConn) Close() error                        { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error)           { return fakeTx{}, nil }
+
+func (c *fakeConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	time.Sleep(c.sleep)
+	if strings.Contains(query, "bad") {
+		return nil, errFake
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c *fakeConn) QueryContext(context.Context, string, []driver.NamedValue) (driver.Rows, error) {
+	return &fakeRows{}, nil
+}
+
+func (c *fakeConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	return fakeTx{}, nil
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeRows struct {
+	done bool
+}
+
+func (r *fakeRows) Columns() []string { return []string{"id"} }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = int64(1)
+	return nil
+}
+
+func TestWrap(t *testing.T) {
+	h := memtransport.NewHistogram()
+	tracer := mocktracer.New()
+	db := sql.OpenDB(Wrap(fakeConnector{}, Config{Tracer: tracer, Duration: h}))
+	defer db.Close()
+
+	// 没有上游span时不创建span
+	ctx := context.Background()
+	if _, err := db.ExecContext(WithStatement(ctx, "users.create"), "INSERT INTO users VALUES ($1)", 1); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(tracer.FinishedSpans()); n != 0 {
+		t.Errorf("got %d spans", n)
+	}
+
+	parent := tracer.StartSpan("GetUser")
+	ctx = stdopentracing.ContextWithSpan(ctx, parent)
+	var id int
+	if err := db.QueryRowContext(WithStatement(ctx, "users.get"), "SELECT id FROM users WHERE id=$1", 1).Scan(&id); err != nil || id != 1 {
+		t.Fatalf("got %d %v", id, err)
+	}
+	if _, err := db.ExecContext(ctx, "  update users SET bad=1"); err != errFake {
+		t.Errorf("got err:%v", err)
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []struct{ statement, success string }{
+		{"users.create", "true"},
+		{"users.get", "true"},
+		{"update", "false"},
+		{"begin", "true"},
+		{"commit", "true"},
+	} {
+		if n := len(h.Values("statement", want.statement, "success", want.success)); n != 1 {
+			t.Errorf("%s success:%s got %d observations", want.statement, want.success, n)
+		}
+	}
+	if h.Count() != 5 {
+		t.Errorf("got %d observations", h.Count())
+	}
+
+	spans := tracer.FinishedSpans()
+	var names []string
+	for _, s := range spans {
+		names = append(names, s.OperationName)
+		if s.ParentID != parent.Context().(mocktracer.MockSpanContext).SpanID {
+			t.Errorf("%s: not a child of parent", s.OperationName)
+		}
+	}
+	if want := []string{"sql users.get", "sql update", "sql begin", "sql commit"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got spans:%v", names)
+	}
+	if s := spans[0]; s.Tag("db.statement") != "SELECT id FROM users WHERE id=$1" || s.Tag("db.type") != "sql" {
+		t.Errorf("got tags:%v", s.Tags())
+	}
+	if spans[1].Tag("error") != true || spans[0].Tag("error") != nil {
+		t.Errorf("got error tags:%v %v", spans[1].Tag("error"), spans[0].Tag("error"))
+	}
+}
+
+func TestSlowQuery(t *testing.T) {
+	var buf bytes.Buffer
+	ctx := logging.NewContext(context.Background(), log.With(log.NewLogfmtLogger(&buf), "request_id", "r1"))
+
+	db := sql.OpenDB(Wrap(fakeConnector{sleep: 20 * time.Millisecond}, Config{SlowThreshold: 10 * time.Millisecond}))
+	defer db.Close()
+	if _, err := db.ExecContext(WithStatement(ctx, "users.delete"), "DELETE FROM users WHERE email=$1", "jack@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, s := range []string{"request_id=r1", "sql=users.delete", "slow=true", `query="DELETE FROM users WHERE email=$1"`} {
+		if !strings.Contains(out, s) {
+			t.Errorf("missing %q in %q", s, out)
+		}
+	}
+	// 不输出参数
+	if strings.Contains(out, "jack@example.com") {
+		t.Errorf("args leaked: %q", out)
+	}
+
+	buf.Reset()
+	fast := sql.OpenDB(Wrap(fakeConnector{}, Config{SlowThreshold: time.Second}))
+	defer fast.Close()
+	if _, err := fast.ExecContext(ctx, "DELETE FROM users"); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("got %q", buf.String())
+	}
+}
@@ -0,0 +1,504 @@
+package sqstransport
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/transport"
+	"gokit_foundation/deadletter"
+	"gokit_foundation/dedup"
+	"gokit_foundation/errs"
+	"gokit_foundation/journal"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/*
+SQS transport，从队列中消费请求交给go-kit endpoint处理，与grpc/http transport共用同一套endpoint(包括中间件)，
+用于worker类型的服务(如异步任务)。也可以使用兼容SQS API的本地模拟器(如ElasticMQ、LocalStack)
+-	消息属性method(MethodAttribute)指定接口，body由该接口的DecodeRequestFunc解码
+-	接收时消息对其他consumer不可见(VisibilityTimeout)，处理期间每隔visibilityTimeout/2延长一次，
+	处理时间超过visibilityTimeout也不会被重复投递，处理时间的上限见ConsumerTimeout
+-	ack/nack：处理成功后删除消息；可重试的错误(包括KindInternal，如依赖暂时不可用)将可见时间改为退避时间，
+	之后重新投递，重试次数由队列的redrive policy(maxReceiveCount)控制，超过后进入死信队列；
+	不可重试的错误(参数错误、解码失败、未知method等)重试也不会成功，记录后直接删除
+-	设置ConsumerDeadLetter后由consumer自己转入死信队列：不可重试的错误以及处理次数(ApproximateReceiveCount)达到maxAttempts的消息
+	带上最初的队列、处理次数、错误和时间(见deadletter.Dead)发送到死信队列后删除，可以用cmd/dlq-inspector查看和重放；
+	队列同时配置了redrive policy时maxReceiveCount应大于maxAttempts
+-	消息属性reply_to不为空时，response编码后发送到该队列，属性correlation_id为请求的MessageId，回复失败时不重试
+-	设置ConsumerDedup后以MessageId去重，窗口内重复投递的消息(如处理完成后删除失败、标准队列本身的重复)直接删除
+-	设置ConsumerJournal后处理前先写入本地journal，进程崩溃后在Run之前调用Recover完成遗留的消息，
+	失败的转入死信队列(没有设置ConsumerDeadLetter时可重试的交还给SQS重新投递)，之后重新投递的同一条消息直接删除
+*/
+
+const (
+	MethodAttribute        = "method"
+	ReplyToAttribute       = "reply_to"
+	CorrelationIDAttribute = "correlation_id"
+)
+
+// API 为consumer用到的SQS接口，*sqs.SQS(sqsiface.SQSAPI)实现了这个接口
+type API interface {
+	ReceiveMessageWithContext(aws.Context, *sqs.ReceiveMessageInput, ...request.Option) (*sqs.ReceiveMessageOutput, error)
+	DeleteMessageWithContext(aws.Context, *sqs.DeleteMessageInput, ...request.Option) (*sqs.DeleteMessageOutput, error)
+	ChangeMessageVisibilityWithContext(aws.Context, *sqs.ChangeMessageVisibilityInput, ...request.Option) (*sqs.ChangeMessageVisibilityOutput, error)
+	SendMessageWithContext(aws.Context, *sqs.SendMessageInput, ...request.Option) (*sqs.SendMessageOutput, error)
+}
+
+type DecodeRequestFunc func(ctx context.Context, msg *sqs.Message) (request interface{}, err error)
+
+// EncodeResponseFunc 编码回复消息的body，为nil时不回复
+type EncodeResponseFunc func(ctx context.Context, response interface{}) (body string, err error)
+
+// RequestFunc 从消息中读取信息写入ctx，如request id
+type RequestFunc func(ctx context.Context, msg *sqs.Message) context.Context
+
+type EndpointCodec struct {
+	Endpoint endpoint.Endpoint
+	Decode   DecodeRequestFunc
+	Encode   EncodeResponseFunc
+}
+
+// method => codec
+type EndpointCodecMap map[string]EndpointCodec
+
+type Consumer struct {
+	api      API
+	queueURL string
+	ecm      EndpointCodecMap
+	logger   log.Logger
+
+	visibilityTimeout time.Duration
+	waitTime          time.Duration
+	maxMessages       int64
+	pollers           int
+	timeout           time.Duration
+	backoffBase       time.Duration
+	backoffMax        time.Duration
+	before            []RequestFunc
+	errorHandler      transport.ErrorHandler
+	deadLetterURL     string
+	maxAttempts       int
+	journal           *journal.Journal
+	dedup             *dedup.Deduper
+}
+
+type ConsumerOption func(*Consumer)
+
+// 接收时的可见时间，默认30s
+func ConsumerVisibilityTimeout(d time.Duration) ConsumerOption {
+	return func(c *Consumer) { c.visibilityTimeout = d }
+}
+
+// 长轮询的等待时间，默认20s(SQS允许的最大值)
+func ConsumerWaitTime(d time.Duration) ConsumerOption {
+	return func(c *Consumer) { c.waitTime = d }
+}
+
+// 每次接收的最大消息数(1~10)，一次接收的消息并发处理，默认10
+func ConsumerMaxMessages(n int64) ConsumerOption {
+	return func(c *Consumer) { c.maxMessages = n }
+}
+
+// 同时接收的goroutine数，默认1
+func ConsumerPollers(n int) ConsumerOption {
+	return func(c *Consumer) { c.pollers = n }
+}
+
+// 一条消息的最长处理时间，超时后ctx被取消(按可重试的错误处理)，默认5min
+func ConsumerTimeout(d time.Duration) ConsumerOption {
+	return func(c *Consumer) { c.timeout = d }
+}
+
+// nack后的退避时间base*2^(receiveCount-1)，不超过max，默认1s和15min
+func ConsumerRetryBackoff(base, max time.Duration) ConsumerOption {
+	return func(c *Consumer) { c.backoffBase, c.backoffMax = base, max }
+}
+
+// 处理失败的消息转入死信队列dlqURL，maxAttempts包括第一次处理
+func ConsumerDeadLetter(dlqURL string, maxAttempts int) ConsumerOption {
+	return func(c *Consumer) { c.deadLetterURL, c.maxAttempts = dlqURL, maxAttempts }
+}
+
+// 处理前写入j，崩溃后由Recover恢复，见journal.Journal
+func ConsumerJournal(j *journal.Journal) ConsumerOption {
+	return func(c *Consumer) { c.journal = j }
+}
+
+// 以MessageId去重，窗口内重复投递的消息直接删除，不调用endpoint，也不再回复，见dedup.Deduper
+func ConsumerDedup(d *dedup.Deduper) ConsumerOption {
+	return func(c *Consumer) { c.dedup = d }
+}
+
+func ConsumerBefore(before ...RequestFunc) ConsumerOption {
+	return func(c *Consumer) { c.before = append(c.before, before...) }
+}
+
+// 处理失败(包括删除、回复失败)时调用，默认记录日志
+func ConsumerErrorHandler(h transport.ErrorHandler) ConsumerOption {
+	return func(c *Consumer) { c.errorHandler = h }
+}
+
+func NewConsumer(api API, queueURL string, ecm EndpointCodecMap, logger log.Logger, options ...ConsumerOption) *Consumer {
+	c := &Consumer{
+		api:               api,
+		queueURL:          queueURL,
+		ecm:               ecm,
+		logger:            logger,
+		visibilityTimeout: 30 * time.Second,
+		waitTime:          20 * time.Second,
+		maxMessages:       10,
+		pollers:           1,
+		timeout:           5 * time.Minute,
+		backoffBase:       time.Second,
+		backoffMax:        15 * time.Minute,
+		errorHandler:      errs.NewLogErrorHandler(logger),
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// Run 持续接收并处理消息，ctx结束后等待处理中的消息完成再返回
+// 取消ctx不会中断处理中的endpoint(它们的ctx只受ConsumerTimeout控制)，避免优雅退出时把处理了一半的消息当作失败
+func (c *Consumer) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < c.pollers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.poll(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+func (c *Consumer) poll(ctx context.Context) {
+	for ctx.Err() == nil {
+		out, err := c.api.ReceiveMessageWithContext(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:              aws.String(c.queueURL),
+			MaxNumberOfMessages:   aws.Int64(c.maxMessages),
+			VisibilityTimeout:     aws.Int64(seconds(c.visibilityTimeout)),
+			WaitTimeSeconds:       aws.Int64(seconds(c.waitTime)),
+			AttributeNames:        aws.StringSlice([]string{sqs.MessageSystemAttributeNameApproximateReceiveCount}),
+			MessageAttributeNames: aws.StringSlice([]string{sqs.QueueAttributeNameAll}),
+		})
+		if err != nil {
+			if ctx.Err() == nil {
+				c.logger.Log("queue", c.queueURL, "err", err, "msg", "receive failed")
+				// 避免SQS不可用时空转
+				select {
+				case <-ctx.Done():
+				case <-time.After(time.Second):
+				}
+			}
+			continue
+		}
+		var wg sync.WaitGroup
+		for _, msg := range out.Messages {
+			wg.Add(1)
+			go func(msg *sqs.Message) {
+				defer wg.Done()
+				c.handle(msg)
+			}(msg)
+		}
+		wg.Wait()
+	}
+}
+
+// 处理一条消息并ack/nack
+func (c *Consumer) handle(msg *sqs.Message) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	for _, f := range c.before {
+		ctx = f(ctx, msg)
+	}
+	if c.journal != nil {
+		if c.journal.Completed(aws.StringValue(msg.MessageId)) {
+			// 崩溃前或Recover时已经完成，只是没有删除
+			c.delete(ctx, ctx, msg)
+			return
+		}
+		if err := c.journal.Begin(journal.Entry{Message: c.journalMessage(msg), Started: time.Now()}); err != nil {
+			// 没有记录时不处理，避免崩溃后无法恢复
+			c.errorHandler.Handle(ctx, err)
+			c.nack(ctx, msg)
+			return
+		}
+	}
+
+	stop := c.heartbeat(ctx, msg)
+	var (
+		codec EndpointCodec
+		rsp   interface{}
+	)
+	// 没有设置ConsumerDedup时直接处理
+	skipped, err := c.dedup.Do(ctx, aws.StringValue(msg.MessageId), func(ctx context.Context) (err error) {
+		codec, rsp, err = c.serve(ctx, msg)
+		return err
+	})
+	stop()
+
+	// 使用新的ctx，处理超时后仍然可以nack
+	ackCtx, ackCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer ackCancel()
+	if skipped {
+		// 已经处理过，回复也已发送
+		c.logger.Log("queue", c.queueURL, "message_id", aws.StringValue(msg.MessageId), "msg", "duplicate message deleted")
+	} else if err != nil {
+		c.errorHandler.Handle(ctx, err)
+		if c.deadLetterURL != "" {
+			if (deadletter.Policy{MaxAttempts: c.maxAttempts}).Retry(err, receiveCount(msg)) {
+				c.retry(ctx, ackCtx, msg)
+				return
+			}
+			if err := c.deadLetter(ackCtx, msg, err); err != nil {
+				// 没有进入死信队列，不删除，退避后重新投递
+				c.errorHandler.Handle(ctx, err)
+				c.retry(ctx, ackCtx, msg)
+				return
+			}
+		} else if retryable(err) {
+			c.retry(ctx, ackCtx, msg)
+			return
+		}
+	} else if err := c.reply(ackCtx, msg, codec, rsp); err != nil {
+		// 已经处理成功，重试会再次调用endpoint，所以回复失败时仍然删除
+		c.errorHandler.Handle(ctx, err)
+	}
+	if c.journal != nil {
+		// 先记下完成，删除失败或删除前崩溃时重新投递的消息不再处理
+		if err := c.journal.Done(aws.StringValue(msg.MessageId)); err != nil {
+			c.errorHandler.Handle(ctx, err)
+		}
+	}
+	c.delete(ctx, ackCtx, msg)
+}
+
+// 交还给SQS，退避后重新投递
+func (c *Consumer) retry(ctx, ackCtx context.Context, msg *sqs.Message) {
+	if c.journal != nil {
+		if err := c.journal.Discard(aws.StringValue(msg.MessageId)); err != nil {
+			c.errorHandler.Handle(ctx, err)
+		}
+	}
+	c.nack(ackCtx, msg)
+}
+
+func (c *Consumer) delete(ctx, ackCtx context.Context, msg *sqs.Message) {
+	if _, err := c.api.DeleteMessageWithContext(ackCtx, &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(c.queueURL),
+		ReceiptHandle: msg.ReceiptHandle,
+	}); err != nil {
+		// 删除失败时消息在可见时间后重新投递，endpoint需要是幂等的
+		c.errorHandler.Handle(ctx, err)
+	}
+}
+
+func (c *Consumer) serve(ctx context.Context, msg *sqs.Message) (EndpointCodec, interface{}, error) {
+	method := attribute(msg, MethodAttribute)
+	codec, ok := c.ecm[method]
+	if !ok {
+		return codec, nil, errs.Invalid("sqs: unknown method " + strconv.Quote(method))
+	}
+	req, err := codec.Decode(ctx, msg)
+	if err != nil {
+		return codec, nil, errs.Invalid("sqs: decode request: " + err.Error()).Wrap(err)
+	}
+	rsp, err := codec.Endpoint(ctx, req)
+	return codec, rsp, err
+}
+
+// Recover 处理上次崩溃时留在journal中的消息(见journal.Journal.Replay)，需要在Run之前调用，返回没能处理的消息数
+// 重新调用endpoint并回复，失败时与handle一样转入死信队列或交还给SQS；原来的receipt handle已经失效，
+// 不删除消息，重新投递后由完成标记判断直接删除
+func (c *Consumer) Recover(ctx context.Context) (failed int, err error) {
+	if c.journal == nil {
+		return 0, nil
+	}
+	complete := func(ctx context.Context, e journal.Entry) error {
+		msg := fromJournal(e.Message)
+		ctx, cancel := context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+		for _, f := range c.before {
+			ctx = f(ctx, msg)
+		}
+		codec, rsp, err := c.serve(ctx, msg)
+		if err != nil {
+			return err
+		}
+		if err := c.reply(ctx, msg, codec, rsp); err != nil {
+			c.errorHandler.Handle(ctx, err)
+		}
+		return nil
+	}
+	compensate := func(ctx context.Context, e journal.Entry, cause error) error {
+		c.errorHandler.Handle(ctx, cause)
+		if c.deadLetterURL != "" {
+			return c.deadLetter(ctx, fromJournal(e.Message), cause)
+		}
+		if retryable(cause) || cause == journal.ErrExpired {
+			return journal.ErrRequeue
+		}
+		return nil
+	}
+	return c.journal.Replay(ctx, complete, compensate)
+}
+
+// 处理次数记在AttemptHeader中
+func (c *Consumer) journalMessage(msg *sqs.Message) deadletter.Message {
+	m := FromSQS(c.queueURL, msg)
+	m.Headers[deadletter.AttemptHeader] = strconv.Itoa(receiveCount(msg))
+	return m
+}
+
+func fromJournal(m deadletter.Message) *sqs.Message {
+	headers := make(map[string]string, len(m.Headers))
+	for k, v := range m.Headers {
+		headers[k] = v
+	}
+	attempt := headers[deadletter.AttemptHeader]
+	delete(headers, deadletter.AttemptHeader)
+	return &sqs.Message{
+		MessageId:         aws.String(m.ID),
+		Body:              aws.String(string(m.Value)),
+		MessageAttributes: Attributes(headers),
+		Attributes:        map[string]*string{sqs.MessageSystemAttributeNameApproximateReceiveCount: aws.String(attempt)},
+	}
+}
+
+// 消息带有reply_to时回复response
+func (c *Consumer) reply(ctx context.Context, msg *sqs.Message, codec EndpointCodec, rsp interface{}) error {
+	replyTo := attribute(msg, ReplyToAttribute)
+	if replyTo == "" || codec.Encode == nil {
+		return nil
+	}
+	body, err := codec.Encode(ctx, rsp)
+	if err != nil {
+		return err
+	}
+	_, err = c.api.SendMessageWithContext(ctx, &sqs.SendMessageInput{
+		QueueUrl:    aws.String(replyTo),
+		MessageBody: aws.String(body),
+		MessageAttributes: map[string]*sqs.MessageAttributeValue{
+			CorrelationIDAttribute: {DataType: aws.String("String"), StringValue: msg.MessageId},
+		},
+	})
+	return err
+}
+
+// 原来的消息属性加上死信的header
+func (c *Consumer) deadLetter(ctx context.Context, msg *sqs.Message, cause error) error {
+	m := FromSQS(c.queueURL, msg)
+	m.Headers[deadletter.AttemptHeader] = strconv.Itoa(receiveCount(msg))
+	m = deadletter.Dead(m, cause, time.Now())
+	_, err := c.api.SendMessageWithContext(ctx, &sqs.SendMessageInput{
+		QueueUrl:          aws.String(c.deadLetterURL),
+		MessageBody:       msg.Body,
+		MessageAttributes: Attributes(m.Headers),
+	})
+	return err
+}
+
+// FromSQS String类型的消息属性作为Headers，ID为MessageId
+func FromSQS(queueURL string, msg *sqs.Message) deadletter.Message {
+	m := deadletter.Message{
+		ID:      aws.StringValue(msg.MessageId),
+		Topic:   queueURL,
+		Value:   []byte(aws.StringValue(msg.Body)),
+		Headers: map[string]string{},
+	}
+	for k, v := range msg.MessageAttributes {
+		if aws.StringValue(v.DataType) == "String" {
+			m.Headers[k] = aws.StringValue(v.StringValue)
+		}
+	}
+	return m
+}
+
+// Attributes headers转为String类型的消息属性
+func Attributes(headers map[string]string) map[string]*sqs.MessageAttributeValue {
+	if len(headers) == 0 {
+		return nil
+	}
+	attrs := make(map[string]*sqs.MessageAttributeValue, len(headers))
+	for k, v := range headers {
+		attrs[k] = &sqs.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(v)}
+	}
+	return attrs
+}
+
+// 处理期间定期延长可见时间，返回的函数停止延长
+func (c *Consumer) heartbeat(ctx context.Context, msg *sqs.Message) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(c.visibilityTimeout / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := c.changeVisibility(ctx, msg, c.visibilityTimeout); err != nil {
+					c.logger.Log("queue", c.queueURL, "message_id", aws.StringValue(msg.MessageId), "err", err, "msg", "extend visibility failed")
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// 可见时间改为退避时间，之后重新投递
+func (c *Consumer) nack(ctx context.Context, msg *sqs.Message) {
+	if err := c.changeVisibility(ctx, msg, c.backoff(msg)); err != nil {
+		c.errorHandler.Handle(ctx, err)
+	}
+}
+
+func (c *Consumer) backoff(msg *sqs.Message) time.Duration {
+	return deadletter.Policy{BackoffBase: c.backoffBase, BackoffMax: c.backoffMax}.Backoff(receiveCount(msg))
+}
+
+// 第几次接收，即处理次数
+func receiveCount(msg *sqs.Message) int {
+	n, _ := strconv.Atoi(aws.StringValue(msg.Attributes[sqs.MessageSystemAttributeNameApproximateReceiveCount]))
+	return n
+}
+
+func (c *Consumer) changeVisibility(ctx context.Context, msg *sqs.Message, d time.Duration) error {
+	_, err := c.api.ChangeMessageVisibilityWithContext(ctx, &sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          aws.String(c.queueURL),
+		ReceiptHandle:     msg.ReceiptHandle,
+		VisibilityTimeout: aws.Int64(seconds(d)),
+	})
+	return err
+}
+
+// KindInternal也重试：worker中的意外错误多数是依赖暂时不可用，超过maxReceiveCount后进入死信队列
+func retryable(err error) bool {
+	return deadletter.Retryable(err)
+}
+
+func attribute(msg *sqs.Message, name string) string {
+	if v, ok := msg.MessageAttributes[name]; ok {
+		return aws.StringValue(v.StringValue)
+	}
+	return ""
+}
+
+// SQS的时间参数以秒为单位
+func seconds(d time.Duration) int64 {
+	return int64(d / time.Second)
+}
@@ -0,0 +1,403 @@
+package sqstransport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/go-kit/kit/log"
+	"gokit_foundation/deadletter"
+	"gokit_foundation/dedup"
+	"gokit_foundation/errs"
+	"gokit_foundation/idempotency"
+	"gokit_foundation/journal"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type fakeMessage struct {
+	msg       *sqs.Message
+	visibleAt time.Time
+	received  int
+}
+
+// 内存中的SQS，只实现consumer用到的部分
+type fakeSQS struct {
+	mu         sync.Mutex
+	queues     map[string][]*fakeMessage
+	nextID     int
+	visibility []int64 // ChangeMessageVisibility的参数
+}
+
+func newFakeSQS() *fakeSQS {
+	return &fakeSQS{queues: map[string][]*fakeMessage{}}
+}
+
+func (f *fakeSQS) send(queue, method, body string, attrs map[string]string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nextID++
+	id := strconv.Itoa(f.nextID)
+	ma := map[string]*sqs.MessageAttributeValue{
+		MethodAttribute: {DataType: aws.String("String"), StringValue: aws.String(method)},
+	}
+	for k, v := range attrs {
+		ma[k] = &sqs.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(v)}
+	}
+	f.queues[queue] = append(f.queues[queue], &fakeMessage{msg: &sqs.Message{MessageId: aws.String(id), Body: aws.String(body), MessageAttributes: ma}})
+}
+
+func (f *fakeSQS) len(queue string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.queues[queue])
+}
+
+func (f *fakeSQS) ReceiveMessageWithContext(ctx aws.Context, in *sqs.ReceiveMessageInput, _ ...request.Option) (*sqs.ReceiveMessageOutput, error) {
+	f.mu.Lock()
+	now := time.Now()
+	out := &sqs.ReceiveMessageOutput{}
+	for _, m := range f.queues[*in.QueueUrl] {
+		if len(out.Messages) == int(*in.MaxNumberOfMessages) || m.visibleAt.After(now) {
+			continue
+		}
+		m.received++
+		m.visibleAt = now.Add(time.Duration(*in.VisibilityTimeout) * time.Second)
+		msg := *m.msg
+		msg.ReceiptHandle = aws.String(*m.msg.MessageId + "-" + strconv.Itoa(m.received))
+		msg.Attributes = map[string]*string{sqs.MessageSystemAttributeNameApproximateReceiveCount: aws.String(strconv.Itoa(m.received))}
+		out.Messages = append(out.Messages, &msg)
+	}
+	f.mu.Unlock()
+	if len(out.Messages) == 0 {
+		// 代替长轮询
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+	return out, nil
+}
+
+// 只有最近一次接收的receipt handle有效
+func (f *fakeSQS) find(queue string, handle *string) (int, *fakeMessage) {
+	for i, m := range f.queues[queue] {
+		if *m.msg.MessageId+"-"+strconv.Itoa(m.received) == *handle {
+			return i, m
+		}
+	}
+	return -1, nil
+}
+
+func (f *fakeSQS) DeleteMessageWithContext(_ aws.Context, in *sqs.DeleteMessageInput, _ ...request.Option) (*sqs.DeleteMessageOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	i, _ := f.find(*in.QueueUrl, in.ReceiptHandle)
+	if i < 0 {
+		return nil, errors.New("invalid receipt handle")
+	}
+	q := f.queues[*in.QueueUrl]
+	f.queues[*in.QueueUrl] = append(q[:i:i], q[i+1:]...)
+	return &sqs.DeleteMessageOutput{}, nil
+}
+
+func (f *fakeSQS) ChangeMessageVisibilityWithContext(_ aws.Context, in *sqs.ChangeMessageVisibilityInput, _ ...request.Option) (*sqs.ChangeMessageVisibilityOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, m := f.find(*in.QueueUrl, in.ReceiptHandle)
+	if m == nil {
+		return nil, errors.New("invalid receipt handle")
+	}
+	m.visibleAt = time.Now().Add(time.Duration(*in.VisibilityTimeout) * time.Second)
+	f.visibility = append(f.visibility, *in.VisibilityTimeout)
+	return &sqs.ChangeMessageVisibilityOutput{}, nil
+}
+
+func (f *fakeSQS) SendMessageWithContext(_ aws.Context, in *sqs.SendMessageInput, _ ...request.Option) (*sqs.SendMessageOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nextID++
+	id := aws.String(strconv.Itoa(f.nextID))
+	f.queues[*in.QueueUrl] = append(f.queues[*in.QueueUrl], &fakeMessage{msg: &sqs.Message{MessageId: id, Body: in.MessageBody, MessageAttributes: in.MessageAttributes}})
+	return &sqs.SendMessageOutput{MessageId: id}, nil
+}
+
+type sumRequest struct{ A, B int }
+
+func sumCodec(sum func(ctx context.Context, a, b int) (int, error)) EndpointCodec {
+	return EndpointCodec{
+		Endpoint: func(ctx context.Context, request interface{}) (interface{}, error) {
+			req := request.(sumRequest)
+			return sum(ctx, req.A, req.B)
+		},
+		Decode: func(_ context.Context, msg *sqs.Message) (interface{}, error) {
+			var req sumRequest
+			err := json.Unmarshal([]byte(aws.StringValue(msg.Body)), &req)
+			return req, err
+		},
+		Encode: func(_ context.Context, response interface{}) (string, error) {
+			return strconv.Itoa(response.(int)), nil
+		},
+	}
+}
+
+type countErrors struct{ n int32 }
+
+func (h *countErrors) Handle(context.Context, error) { atomic.AddInt32(&h.n, 1) }
+
+// 运行consumer直到done返回true
+func runUntil(t *testing.T, c *Consumer, done func() bool) {
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		c.Run(ctx)
+		close(stopped)
+	}()
+	deadline := time.Now().Add(3 * time.Second)
+	for !done() {
+		if time.Now().After(deadline) {
+			t.Error("timeout")
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-stopped
+}
+
+func TestConsumer(t *testing.T) {
+	api := newFakeSQS()
+	var calls int32
+	sum := func(_ context.Context, a, b int) (int, error) {
+		// 第一次调用返回可重试的错误
+		if atomic.AddInt32(&calls, 1) == 1 {
+			return 0, errs.Unavailable("db down")
+		}
+		return a + b, nil
+	}
+	h := &countErrors{}
+	c := NewConsumer(api, "req", EndpointCodecMap{"Sum": sumCodec(sum)}, log.NewNopLogger(),
+		ConsumerRetryBackoff(0, 0), ConsumerErrorHandler(h))
+	api.send("req", "Sum", `{"A":1,"B":2}`, map[string]string{ReplyToAttribute: "rsp"})
+	// 不可重试的错误直接删除
+	api.send("req", "Sum", `{"A":`, nil)
+	api.send("req", "Mul", `{}`, nil)
+
+	runUntil(t, c, func() bool { return api.len("req") == 0 })
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("got calls:%d", n)
+	}
+	if n := atomic.LoadInt32(&h.n); n != 3 {
+		t.Errorf("got errors:%d", n)
+	}
+	if len(api.visibility) != 1 || api.visibility[0] != 0 {
+		t.Errorf("got visibility changes:%v", api.visibility)
+	}
+	rsp := api.queues["rsp"]
+	if len(rsp) != 1 || *rsp[0].msg.Body != "3" || *rsp[0].msg.MessageAttributes[CorrelationIDAttribute].StringValue != "1" {
+		t.Errorf("got reply:%v", rsp)
+	}
+}
+
+// 不可重试的错误直接进入死信队列，可重试的错误在第maxAttempts次处理失败后进入
+func TestConsumerDeadLetter(t *testing.T) {
+	api := newFakeSQS()
+	var calls int32
+	sum := func(_ context.Context, a, b int) (int, error) {
+		atomic.AddInt32(&calls, 1)
+		return 0, errs.Unavailable("db down")
+	}
+	c := NewConsumer(api, "req", EndpointCodecMap{"Sum": sumCodec(sum)}, log.NewNopLogger(),
+		ConsumerRetryBackoff(0, 0), ConsumerErrorHandler(&countErrors{}), ConsumerDeadLetter("dlq", 3))
+	api.send("req", "Sum", `{"A":1,"B":2}`, map[string]string{ReplyToAttribute: "rsp"})
+	api.send("req", "Sum", `{"A":`, nil)
+
+	runUntil(t, c, func() bool { return api.len("req") == 0 })
+	if n := atomic.LoadInt32(&calls); n != 3 {
+		t.Errorf("got calls:%d", n)
+	}
+	dlq := api.queues["dlq"]
+	if len(dlq) != 2 {
+		t.Fatalf("got dlq:%d", len(dlq))
+	}
+	for _, m := range dlq {
+		dm := FromSQS("dlq", m.msg)
+		want := map[string]string{MethodAttribute: "Sum", deadletter.OriginHeader: "req"}
+		if *m.msg.Body == `{"A":` {
+			want[deadletter.AttemptHeader] = "1"
+		} else {
+			want[deadletter.AttemptHeader] = "3"
+			want[ReplyToAttribute] = "rsp"
+		}
+		for k, v := range want {
+			if dm.Headers[k] != v {
+				t.Errorf("body:%s header %s got:%q want:%q", *m.msg.Body, k, dm.Headers[k], v)
+			}
+		}
+		if dm.Error() == "" || dm.FailedAt().IsZero() {
+			t.Errorf("got headers:%v", dm.Headers)
+		}
+	}
+	if api.len("rsp") != 0 {
+		t.Errorf("got reply:%d", api.len("rsp"))
+	}
+}
+
+// 崩溃时处理中的消息由Recover完成，重新投递后直接删除
+func TestConsumerJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sqs-journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	j, err := journal.Open(filepath.Join(dir, "worker.db"), journal.Metrics{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	api := newFakeSQS()
+	var calls, down int32
+	sum := func(_ context.Context, a, b int) (int, error) {
+		atomic.AddInt32(&calls, 1)
+		if atomic.LoadInt32(&down) == 1 && a == 0 {
+			return 0, errs.Unavailable("db down")
+		}
+		return a + b, nil
+	}
+	c := NewConsumer(api, "req", EndpointCodecMap{"Sum": sumCodec(sum)}, log.NewNopLogger(),
+		ConsumerRetryBackoff(0, 0), ConsumerErrorHandler(&countErrors{}), ConsumerJournal(j))
+	api.send("req", "Sum", `{"A":1,"B":2}`, map[string]string{ReplyToAttribute: "rsp"})
+	api.send("req", "Sum", `{"A":`, nil)
+	api.send("req", "Sum", `{"A":0,"B":5}`, map[string]string{ReplyToAttribute: "rsp"})
+	// 接收后还没处理完就崩溃了，可见时间为0，消息立即可以重新投递
+	out, _ := api.ReceiveMessageWithContext(context.Background(), &sqs.ReceiveMessageInput{
+		QueueUrl: aws.String("req"), MaxNumberOfMessages: aws.Int64(10), VisibilityTimeout: aws.Int64(0)})
+	for _, msg := range out.Messages {
+		if err := j.Begin(journal.Entry{Message: c.journalMessage(msg), Started: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 第1条完成并回复，第2条不可重试直接结束，第3条可重试的错误交还给SQS
+	atomic.StoreInt32(&down, 1)
+	if failed, err := c.Recover(context.Background()); failed != 0 || err != nil {
+		t.Fatalf("got failed:%d err:%v", failed, err)
+	}
+	if pending, _ := j.Pending(); len(pending) != 0 || !j.Completed("1") || !j.Completed("2") || j.Completed("3") {
+		t.Errorf("got pending:%v", pending)
+	}
+	if rsp := api.queues["rsp"]; len(rsp) != 1 || *rsp[0].msg.Body != "3" {
+		t.Errorf("got reply:%v", rsp)
+	}
+
+	// 重新投递后1、2直接删除，3正常处理
+	atomic.StoreInt32(&down, 0)
+	runUntil(t, c, func() bool { return api.len("req") == 0 })
+	if n := atomic.LoadInt32(&calls); n != 3 {
+		t.Errorf("got calls:%d", n)
+	}
+	if rsp := api.queues["rsp"]; len(rsp) != 2 || *rsp[1].msg.Body != "5" {
+		t.Errorf("got reply:%v", rsp)
+	}
+	if pending, _ := j.Pending(); len(pending) != 0 || !j.Completed("3") {
+		t.Errorf("got pending:%v", pending)
+	}
+}
+
+// 窗口内重复投递的消息直接删除，不再调用endpoint，也不再回复
+func TestConsumerDedup(t *testing.T) {
+	api := newFakeSQS()
+	var calls int32
+	sum := func(_ context.Context, a, b int) (int, error) {
+		atomic.AddInt32(&calls, 1)
+		return a + b, nil
+	}
+	d := dedup.New(idempotency.NewMemStore(10), "", dedup.Config{Group: "sqs", Window: time.Minute}, nil, log.NewNopLogger())
+	c := NewConsumer(api, "req", EndpointCodecMap{"Sum": sumCodec(sum)}, log.NewNopLogger(), ConsumerDedup(d))
+	api.send("req", "Sum", `{"A":1,"B":2}`, map[string]string{ReplyToAttribute: "rsp"})
+	first := *api.queues["req"][0].msg
+	runUntil(t, c, func() bool { return api.len("req") == 0 })
+
+	// 同一个MessageId再次投递
+	api.mu.Lock()
+	api.queues["req"] = append(api.queues["req"], &fakeMessage{msg: &first})
+	api.mu.Unlock()
+	runUntil(t, c, func() bool { return api.len("req") == 0 })
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("got calls:%d", n)
+	}
+	if api.len("rsp") != 1 {
+		t.Errorf("got reply:%d", api.len("rsp"))
+	}
+}
+
+// 处理时间超过visibilityTimeout/2时延长可见时间，不会被重复投递
+func TestConsumerHeartbeat(t *testing.T) {
+	api := newFakeSQS()
+	var calls int32
+	sum := func(ctx context.Context, a, b int) (int, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(1100 * time.Millisecond)
+		return a + b, nil
+	}
+	c := NewConsumer(api, "req", EndpointCodecMap{"Sum": sumCodec(sum)}, log.NewNopLogger(), ConsumerVisibilityTimeout(2*time.Second))
+	api.send("req", "Sum", `{"A":1,"B":2}`, nil)
+	runUntil(t, c, func() bool { return api.len("req") == 0 })
+	if n := atomic.LoadInt32(&calls); n != 1 || len(api.visibility) != 1 || api.visibility[0] != 2 {
+		t.Errorf("got calls:%d visibility changes:%v", n, api.visibility)
+	}
+}
+
+// 超过ConsumerTimeout时ctx被取消，按可重试的错误nack
+func TestConsumerTimeout(t *testing.T) {
+	api := newFakeSQS()
+	sum := func(ctx context.Context, a, b int) (int, error) {
+		<-ctx.Done()
+		return 0, ctx.Err()
+	}
+	c := NewConsumer(api, "req", EndpointCodecMap{"Sum": sumCodec(sum)}, log.NewNopLogger(),
+		ConsumerTimeout(10*time.Millisecond), ConsumerRetryBackoff(time.Minute, time.Hour), ConsumerErrorHandler(&countErrors{}))
+	api.send("req", "Sum", `{}`, nil)
+	runUntil(t, c, func() bool {
+		api.mu.Lock()
+		defer api.mu.Unlock()
+		return len(api.visibility) > 0
+	})
+	if api.len("req") != 1 || api.visibility[0] != 60 {
+		t.Errorf("got queue:%d visibility changes:%v", api.len("req"), api.visibility)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	c := NewConsumer(nil, "", nil, log.NewNopLogger(), ConsumerRetryBackoff(time.Second, time.Minute))
+	for count, want := range map[string]time.Duration{"": time.Second, "1": time.Second, "3": 4 * time.Second, "100": time.Minute} {
+		msg := &sqs.Message{Attributes: map[string]*string{sqs.MessageSystemAttributeNameApproximateReceiveCount: aws.String(count)}}
+		if got := c.backoff(msg); got != want {
+			t.Errorf("receive count:%s got:%v", count, got)
+		}
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	for err, want := range map[error]bool{
+		errors.New("db down"):           true,
+		errs.Timeout("timeout"):         true,
+		errs.ResourceExhausted("limit"): true,
+		errs.Invalid("bad request"):     false,
+		errs.NotFound("no user"):        false,
+	} {
+		if got := retryable(err); got != want {
+			t.Errorf("err:%v got:%v", err, got)
+		}
+	}
+}
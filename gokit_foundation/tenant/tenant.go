@@ -0,0 +1,169 @@
+package tenant
+
+import (
+	"context"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/metrics"
+	grpctransport "github.com/go-kit/kit/transport/grpc"
+	httptransport "github.com/go-kit/kit/transport/http"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"gokit_foundation"
+	"gokit_foundation/auth"
+	"gokit_foundation/errs"
+	"google.golang.org/grpc/metadata"
+	"net/http"
+)
+
+/*
+多租户：每个请求属于一个租户，租户id写入ctx后由各层读取(如usersvc的repository按租户隔离数据)：
+-	transport层只把X-Tenant-Id header(grpc metadata为x-tenant-id)原样放入ctx(见HTTPToContext、GRPCToContext)，
+	由Middleware确定租户：JWT claims中的tenant优先，header只在没有claims(未启用认证)时使用，两者不一致时拒绝
+-	租户id经过校验后写入ctx(gokit_foundation.CtxKeyTenant)，日志自动带上tenant字段(需先注册)，
+	同时作为当前span的tag，Config.Requests不为nil时按method、tenant计数
+-	client将ctx中的租户id写入header/metadata传给下游(见ContextToHTTP、ContextToGRPC)，
+	下游未启用认证时同样属于这个租户
+日志带上tenant需要先注册：gokit_foundation.RegisterLogContextKey("tenant", gokit_foundation.CtxKeyTenant)
+*/
+
+const (
+	Header   = "X-Tenant-Id"
+	mdKey    = "x-tenant-id"
+	ClaimKey = "tenant" // JWT claims中租户id的字段名
+	maxLen   = 64
+)
+
+var (
+	ErrMissing  = errs.Invalid("tenant: missing tenant id")
+	ErrInvalid  = errs.Invalid("tenant: invalid tenant id")
+	ErrMismatch = errs.Forbidden("tenant: tenant id does not match the token")
+	ErrUnknown  = errs.Forbidden("tenant: unknown tenant")
+)
+
+type Config struct {
+	// 为true时没有租户id的请求被拒绝，否则使用空租户(单租户部署)
+	Required bool
+	// 不为空时只允许其中的租户
+	Allowed []string
+	// 每个租户的调用数，labels: method、tenant，为nil时不计数
+	// 未启用认证且Allowed为空时租户id来自调用方，指标的基数不受控制
+	Requests metrics.Counter
+}
+
+func WithTenant(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, gokit_foundation.CtxKeyTenant, id)
+}
+
+// FromContext ctx中没有租户时返回空字符串
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(gokit_foundation.CtxKeyTenant).(string)
+	return id
+}
+
+// Valid 租户id会写入日志、指标和sql参数，只接受小写字母、数字以及'-'、'_'
+func Valid(id string) bool {
+	if id == "" || len(id) > maxLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if !('a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// transport层读取的header，未经校验
+type ctxKeyHeader struct{}
+
+func withHeader(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, ctxKeyHeader{}, id)
+}
+
+// HTTPToContext 用于httptransport.ServerBefore
+func HTTPToContext() httptransport.RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		return withHeader(ctx, r.Header.Get(Header))
+	}
+}
+
+// GRPCToContext 用于grpctransport.ServerBefore
+func GRPCToContext() grpctransport.ServerRequestFunc {
+	return func(ctx context.Context, md metadata.MD) context.Context {
+		if vs := md.Get(mdKey); len(vs) > 0 {
+			return withHeader(ctx, vs[0])
+		}
+		return ctx
+	}
+}
+
+// ContextToHTTP 用于httptransport.ClientBefore
+func ContextToHTTP() httptransport.RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		if id := FromContext(ctx); id != "" {
+			r.Header.Set(Header, id)
+		}
+		return ctx
+	}
+}
+
+// ContextToGRPC 用于grpctransport.ClientBefore
+func ContextToGRPC() grpctransport.ClientRequestFunc {
+	return func(ctx context.Context, md *metadata.MD) context.Context {
+		if id := FromContext(ctx); id != "" {
+			md.Set(mdKey, id)
+		}
+		return ctx
+	}
+}
+
+// resolve claims中的租户优先，没有claims时使用header
+func resolve(ctx context.Context) (string, error) {
+	header, _ := ctx.Value(ctxKeyHeader{}).(string)
+	claims, ok := auth.ClaimsFromContext(ctx)
+	if !ok {
+		return header, nil
+	}
+	id, _ := claims[ClaimKey].(string)
+	if header != "" && header != id {
+		return "", ErrMismatch
+	}
+	return id, nil
+}
+
+// Middleware 安装在认证mw内层(需要读取claims)，method为接口名
+func Middleware(conf Config, method string) endpoint.Middleware {
+	allowed := make(map[string]bool, len(conf.Allowed))
+	for _, id := range conf.Allowed {
+		allowed[id] = true
+	}
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			id, err := resolve(ctx)
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case id == "" && conf.Required:
+				return nil, ErrMissing
+			case id != "" && !Valid(id):
+				return nil, ErrInvalid
+			case len(allowed) > 0 && !allowed[id]:
+				return nil, ErrUnknown
+			}
+			if conf.Requests != nil {
+				conf.Requests.With("method", method, "tenant", id).Add(1)
+			}
+			if id == "" {
+				return next(ctx, request)
+			}
+			if span := stdopentracing.SpanFromContext(ctx); span != nil {
+				span.SetTag("tenant", id)
+			}
+			return next(WithTenant(ctx, id), request)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package tenant
+
+import (
+	"context"
+	"github.com/dgrijalva/jwt-go"
+	kitjwt "github.com/go-kit/kit/auth/jwt"
+	"github.com/go-kit/kit/metrics"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type labelCounter struct{ labels [][]string }
+
+func (c *labelCounter) With(lvs ...string) metrics.Counter {
+	c.labels = append(c.labels, lvs)
+	return c
+}
+func (c *labelCounter) Add(float64) {}
+
+func TestMiddleware(t *testing.T) {
+	var got string
+	next := func(ctx context.Context, request interface{}) (interface{}, error) {
+		got = FromContext(ctx)
+		return "ok", nil
+	}
+	withClaims := func(ctx context.Context, claims jwt.MapClaims) context.Context {
+		return context.WithValue(ctx, kitjwt.JWTClaimsContextKey, claims)
+	}
+	bg := context.Background()
+
+	for name, c := range map[string]struct {
+		conf Config
+		ctx  context.Context
+		want string
+		err  error
+	}{
+		"header":          {Config{}, withHeader(bg, "acme"), "acme", nil},
+		"none":            {Config{}, bg, "", nil},
+		"required":        {Config{Required: true}, bg, "", ErrMissing},
+		"invalid":         {Config{}, withHeader(bg, "Acme\n"), "", ErrInvalid},
+		"too long":        {Config{}, withHeader(bg, strings.Repeat("a", maxLen+1)), "", ErrInvalid},
+		"unknown":         {Config{Allowed: []string{"acme"}}, withHeader(bg, "other"), "", ErrUnknown},
+		"claims":          {Config{}, withClaims(bg, jwt.MapClaims{"tenant": "acme"}), "acme", nil},
+		"claims + header": {Config{}, withClaims(withHeader(bg, "acme"), jwt.MapClaims{"tenant": "acme"}), "acme", nil},
+		"mismatch":        {Config{}, withClaims(withHeader(bg, "other"), jwt.MapClaims{"tenant": "acme"}), "", ErrMismatch},
+		// token中没有租户时不能通过header指定
+		"claims without tenant": {Config{}, withClaims(withHeader(bg, "acme"), jwt.MapClaims{"sub": "alice"}), "", ErrMismatch},
+		"claims required":       {Config{Required: true}, withClaims(bg, jwt.MapClaims{"sub": "alice"}), "", ErrMissing},
+	} {
+		got = ""
+		_, err := Middleware(c.conf, "GetUser")(next)(c.ctx, nil)
+		if err != c.err || got != c.want {
+			t.Errorf("%s: got tenant:%q err:%v", name, got, err)
+		}
+	}
+}
+
+func TestMiddlewareMetrics(t *testing.T) {
+	requests := &labelCounter{}
+	ep := Middleware(Config{Requests: requests}, "GetUser")(func(context.Context, interface{}) (interface{}, error) { return nil, nil })
+	_, _ = ep(withHeader(context.Background(), "acme"), nil)
+	_, _ = ep(withHeader(context.Background(), "BAD"), nil)
+	if want := [][]string{{"method", "GetUser", "tenant", "acme"}}; !reflect.DeepEqual(requests.labels, want) {
+		t.Errorf("got labels:%v", requests.labels)
+	}
+}
+
+func TestHTTPPropagation(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(Header, "acme")
+	ctx := HTTPToContext()(context.Background(), r)
+	// 未经Middleware校验的header不会被当作租户，也不会传给下游
+	if FromContext(ctx) != "" {
+		t.Errorf("got tenant:%q", FromContext(ctx))
+	}
+	out := httptest.NewRequest(http.MethodGet, "/", nil)
+	ContextToHTTP()(WithTenant(ctx, "acme"), out)
+	if out.Header.Get(Header) != "acme" {
+		t.Errorf("got header:%q", out.Header.Get(Header))
+	}
+}
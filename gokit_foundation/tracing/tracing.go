@@ -0,0 +1,97 @@
+package tracing
+
+import (
+	"fmt"
+	"github.com/go-kit/kit/log"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"gokit_foundation/jaeger"
+	"gokit_foundation/otel"
+	"gokit_foundation/zipkin"
+	"io"
+	"sort"
+	"strings"
+)
+
+/*
+按Backend选择opentracing tracer的实现，服务只依赖opentracing接口，切换后端不需要修改代码：
+-	jaeger：见gokit_foundation/jaeger
+-	zipkin：见gokit_foundation/zipkin
+-	otlp：opentracing为NoopTracer，span由gokit_foundation/otel的中间件创建并通过OTLP导出(见otel.EnvEndpoint)
+所选后端未配置上报地址时同样为NoopTracer
+*/
+
+const (
+	EnvBackend = "TRACING_BACKEND"
+
+	BackendJaeger = "jaeger"
+	BackendZipkin = "zipkin"
+	BackendOTLP   = "otlp"
+)
+
+// Provider 创建某种后端的tracer，返回的io.Closer在进程退出前调用
+type Provider func(serviceName string, conf Config, logger log.Logger) (stdopentracing.Tracer, io.Closer, error)
+
+var providers = map[string]Provider{
+	BackendJaeger: func(serviceName string, conf Config, logger log.Logger) (stdopentracing.Tracer, io.Closer, error) {
+		return jaeger.New(serviceName, conf.Jaeger, logger)
+	},
+	BackendZipkin: func(serviceName string, conf Config, logger log.Logger) (stdopentracing.Tracer, io.Closer, error) {
+		return zipkin.New(serviceName, conf.Zipkin, logger)
+	},
+	BackendOTLP: func(serviceName string, conf Config, logger log.Logger) (stdopentracing.Tracer, io.Closer, error) {
+		logger.Log("tracing", "otlp", "msg", "opentracing disabled, spans are exported by otel if "+otel.EnvEndpoint+" is set")
+		return stdopentracing.NoopTracer{}, nopCloser{}, nil
+	},
+}
+
+type Config struct {
+	Backend string // 为空时为jaeger
+	Jaeger  jaeger.Config
+	Zipkin  zipkin.Config
+}
+
+func DefaultConfig() Config {
+	return Config{Backend: BackendJaeger, Jaeger: jaeger.DefaultConfig(), Zipkin: zipkin.DefaultConfig()}
+}
+
+func (c Config) backend() string {
+	if c.Backend == "" {
+		return BackendJaeger
+	}
+	return c.Backend
+}
+
+// Validate 只检查所选后端的配置
+func (c Config) Validate() error {
+	switch c.backend() {
+	case BackendJaeger:
+		return c.Jaeger.Validate()
+	case BackendZipkin:
+		return c.Zipkin.Validate()
+	case BackendOTLP:
+		return nil
+	}
+	return fmt.Errorf("tracing: unknown backend %q, must be %s", c.Backend, strings.Join(Backends(), ", "))
+}
+
+// Backends 返回所有支持的后端，已排序
+func Backends() []string {
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New 按conf.Backend创建tracer，一般在之后调用opentracing.SetGlobalTracer
+func New(serviceName string, conf Config, logger log.Logger) (stdopentracing.Tracer, io.Closer, error) {
+	if err := conf.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return providers[conf.backend()](serviceName, conf, logger)
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
@@ -0,0 +1,62 @@
+package tracing
+
+import (
+	"github.com/go-kit/kit/log"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"gokit_foundation/jaeger"
+	"gokit_foundation/zipkin"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	badZipkin := zipkin.Config{URL: "http://127.0.0.1:9411/api/v2/spans", SampleRate: 2}
+	test := []struct {
+		name    string
+		conf    Config
+		wantErr bool
+	}{
+		{name: "[default]", conf: DefaultConfig()},
+		{name: "[empty backend]", conf: Config{}},
+		{name: "[jaeger bad sampler]", conf: Config{Jaeger: jaeger.Config{AgentAddr: "127.0.0.1:6831"}}, wantErr: true},
+		// 只检查所选后端
+		{name: "[jaeger ignore zipkin]", conf: Config{Backend: BackendJaeger, Zipkin: badZipkin}},
+		{name: "[zipkin bad rate]", conf: Config{Backend: BackendZipkin, Zipkin: badZipkin}, wantErr: true},
+		{name: "[otlp]", conf: Config{Backend: BackendOTLP, Zipkin: badZipkin}},
+		{name: "[unknown]", conf: Config{Backend: "xray"}, wantErr: true},
+	}
+	for _, tt := range test {
+		if err := tt.conf.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: wantErr %v, got %v", tt.name, tt.wantErr, err)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	for _, backend := range Backends() {
+		tracer, closer, err := New("test", Config{Backend: backend}, log.NewNopLogger())
+		if err != nil {
+			t.Fatalf("%s: %v", backend, err)
+		}
+		// 都未配置上报地址
+		if _, ok := tracer.(stdopentracing.NoopTracer); !ok {
+			t.Errorf("%s: want NoopTracer, got %T", backend, tracer)
+		}
+		_ = closer.Close()
+	}
+
+	conf := DefaultConfig()
+	conf.Backend = BackendZipkin
+	conf.Zipkin.URL = "http://127.0.0.1:9411/api/v2/spans"
+	tracer, closer, err := New("test", conf, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tracer.(stdopentracing.NoopTracer); ok {
+		t.Error("want zipkin tracer when url configured")
+	}
+	_ = closer.Close()
+
+	if _, _, err := New("test", Config{Backend: "xray"}, log.NewNopLogger()); err == nil {
+		t.Error("want err for unknown backend")
+	}
+}
@@ -0,0 +1,219 @@
+package gokit_foundation
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"net"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+平滑升级(与cloudflare/tableflip的思路相同)：替换进程(如发布新版本的二进制)时不停止监听，进行中和新来的连接都不会失败
+	1. 旧进程收到SIGUSR2(见_util.SignalOptions.OnUpgrade)后调用Upgrade：以相同的参数启动可执行文件，
+	   监听的socket通过ExtraFiles传给新进程(环境变量GOKIT_UPGRADE_FDS记录名字和fd)
+	2. 新进程的Listen直接使用继承的socket，与旧进程共用内核中的监听队列，交接期间的新连接由任意一个进程accept
+	3. 新进程启动完成后调用Ready，通过管道通知旧进程，旧进程的Upgrade返回nil，随后停止accept并等待进行中的调用结束
+	4. 新进程在超时内没有Ready(包括启动失败退出)时Upgrade返回err，旧进程结束新进程并继续服务
+新旧进程的地址相同，在注册中心中是同一个实例：旧进程退出时不能注销、不能置为NOT_SERVING(见Drainer.Handover)；
+新进程的缓存、连接池都是冷的，可以先用较低的consul权重注册，预热后再恢复(见ConsulSetWeight)
+只支持unix(windows不支持ExtraFiles)；容器中运行时PID 1的进程不能被替换，需要一个init进程(如tini)或在k8s中使用滚动更新
+*/
+
+const (
+	EnvUpgradeFDs     = "GOKIT_UPGRADE_FDS"      // name=fd，逗号分隔
+	EnvUpgradeReadyFD = "GOKIT_UPGRADE_READY_FD" // 新进程启动完成后写入一个字节
+)
+
+var ErrUpgradeInProgress = errors.New("gokit_foundation: upgrade already in progress")
+
+type Upgrader struct {
+	logger log.Logger
+
+	mu          sync.Mutex
+	inherited   map[string]*os.File // 从旧进程继承、还没有被Listen使用的socket
+	files       map[string]*os.File // Listen返回的listener的fd，Upgrade时传给新进程
+	ready       *os.File            // Ready之前不为nil
+	fromUpgrade bool                // 由Upgrade启动
+	upgrading   bool
+}
+
+// NewUpgrader 读取从旧进程继承的socket，读取后清除环境变量，不会再传给之后启动的进程
+func NewUpgrader(logger log.Logger) (*Upgrader, error) {
+	u := &Upgrader{logger: logger, inherited: map[string]*os.File{}, files: map[string]*os.File{}}
+	if s := os.Getenv(EnvUpgradeFDs); s != "" {
+		for _, kv := range strings.Split(s, ",") {
+			i := strings.IndexByte(kv, '=')
+			fd, err := strconv.Atoi(kv[i+1:])
+			if i <= 0 || err != nil {
+				return nil, fmt.Errorf("gokit_foundation: invalid %s %q", EnvUpgradeFDs, s)
+			}
+			u.inherited[kv[:i]] = os.NewFile(uintptr(fd), kv[:i])
+		}
+	}
+	if s := os.Getenv(EnvUpgradeReadyFD); s != "" {
+		fd, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("gokit_foundation: invalid %s %q", EnvUpgradeReadyFD, s)
+		}
+		u.ready = os.NewFile(uintptr(fd), "upgrade-ready")
+		u.fromUpgrade = true
+	}
+	_ = os.Unsetenv(EnvUpgradeFDs)
+	_ = os.Unsetenv(EnvUpgradeReadyFD)
+	return u, nil
+}
+
+// Inherited 是否由旧进程的Upgrade启动
+func (u *Upgrader) Inherited() bool {
+	return u.fromUpgrade
+}
+
+// Listen 有从旧进程继承的同名socket时直接使用，否则监听addr(tcp)；name在进程内唯一，如grpc、http
+func (u *Upgrader) Listen(name, addr string) (net.Listener, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if _, ok := u.files[name]; ok {
+		return nil, fmt.Errorf("gokit_foundation: listener %q already exists", name)
+	}
+	var (
+		lis net.Listener
+		err error
+	)
+	if f, ok := u.inherited[name]; ok {
+		delete(u.inherited, name)
+		// FileListener复制了fd，f可以关闭
+		lis, err = net.FileListener(f)
+		_ = f.Close()
+		if err == nil {
+			u.logger.Log("Upgrader", "inherited listener", "name", name, "addr", lis.Addr())
+		}
+	} else {
+		lis, err = net.Listen("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	tl, ok := lis.(*net.TCPListener)
+	if !ok {
+		return lis, nil
+	}
+	f, err := tl.File()
+	if err != nil {
+		_ = lis.Close()
+		return nil, err
+	}
+	u.files[name] = f
+	return lis, nil
+}
+
+// Ready 新进程启动完成(所有服务开始监听)后调用，通知旧进程退出；不是由Upgrade启动时什么也不做
+// 没有被Listen使用的继承socket(如新版本去掉了某个端口)在这里关闭
+func (u *Upgrader) Ready() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for name, f := range u.inherited {
+		_ = f.Close()
+		delete(u.inherited, name)
+	}
+	if u.ready == nil {
+		return nil
+	}
+	_, err := u.ready.Write([]byte{1})
+	_ = u.ready.Close()
+	u.ready = nil
+	return err
+}
+
+// Upgrade 启动新进程并等待它Ready，超过timeout或新进程退出时结束新进程并返回err
+// 返回nil后调用方应停止accept(GracefulStop/Shutdown)并退出，不要注销实例
+func (u *Upgrader) Upgrade(timeout time.Duration) error {
+	u.mu.Lock()
+	if u.upgrading {
+		u.mu.Unlock()
+		return ErrUpgradeInProgress
+	}
+	u.upgrading = true
+	cmd, r, err := u.start()
+	u.mu.Unlock()
+	defer func() {
+		u.mu.Lock()
+		u.upgrading = false
+		u.mu.Unlock()
+	}()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		// 新进程退出时写端全部关闭，Read返回EOF
+		_, err := r.Read(make([]byte, 1))
+		done <- err
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err = <-done:
+		if err != nil {
+			err = fmt.Errorf("gokit_foundation: new process exited before ready: %v", err)
+		}
+	case <-timer.C:
+		err = fmt.Errorf("gokit_foundation: new process not ready in %s", timeout)
+	}
+	if err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return err
+	}
+	u.logger.Log("Upgrader", "new process ready", "pid", cmd.Process.Pid)
+	// 旧进程退出前回收，避免新进程先退出时成为僵尸进程
+	go func() { _ = cmd.Wait() }()
+	return nil
+}
+
+// 调用时需持有u.mu，返回的r用于等待新进程Ready
+func (u *Upgrader) start() (*exec.Cmd, *os.File, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, nil, err
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	names := make([]string, 0, len(u.files))
+	for name := range u.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	// ExtraFiles[i]在新进程中的fd为3+i
+	var fds []string
+	cmd := exec.Command(exe, os.Args[1:]...)
+	for i, name := range names {
+		cmd.ExtraFiles = append(cmd.ExtraFiles, u.files[name])
+		fds = append(fds, fmt.Sprintf("%s=%d", name, 3+i))
+	}
+	cmd.ExtraFiles = append(cmd.ExtraFiles, w)
+	cmd.Env = append(os.Environ(),
+		EnvUpgradeFDs+"="+strings.Join(fds, ","),
+		EnvUpgradeReadyFD+"="+strconv.Itoa(3+len(names)),
+	)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	err = cmd.Start()
+	// 只保留新进程中的写端
+	_ = w.Close()
+	if err != nil {
+		_ = r.Close()
+		return nil, nil, err
+	}
+	u.logger.Log("Upgrader", "started new process", "pid", cmd.Process.Pid, "exe", exe, "listeners", strings.Join(fds, ","))
+	return cmd, r, nil
+}
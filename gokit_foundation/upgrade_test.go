@@ -0,0 +1,164 @@
+//go:build !windows
+// +build !windows
+
+package gokit_foundation
+
+import (
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// 模拟旧进程传来的socket和管道
+func TestUpgraderInherit(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	// Upgrader会关闭继承的fd，这里传dup出来的，不与*os.File重复关闭
+	lisFD, wFD := dupFD(t, lis.(*net.TCPListener)), dupFD(t, w)
+	w.Close()
+	os.Setenv(EnvUpgradeFDs, fmt.Sprintf("http=%d", lisFD))
+	os.Setenv(EnvUpgradeReadyFD, fmt.Sprint(wFD))
+
+	u, err := NewUpgrader(log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if os.Getenv(EnvUpgradeFDs) != "" || os.Getenv(EnvUpgradeReadyFD) != "" {
+		t.Error("env not unset")
+	}
+	if !u.Inherited() {
+		t.Error("want inherited")
+	}
+	// 继承的socket不再监听addr
+	got, err := u.Listen("http", "127.0.0.1:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer got.Close()
+	if got.Addr().String() != lis.Addr().String() {
+		t.Errorf("got addr:%s want:%s", got.Addr(), lis.Addr())
+	}
+	if _, err := u.Listen("http", "127.0.0.1:0"); err == nil {
+		t.Error("want err for duplicate name")
+	}
+	other, err := u.Listen("grpc", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	if err := u.Ready(); err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 1)
+	if n, err := r.Read(b); n != 1 || err != nil {
+		t.Errorf("got n:%d err:%v", n, err)
+	}
+	// Ready之后仍可以判断是否由Upgrade启动(如决定consul的预热权重)
+	if !u.Inherited() {
+		t.Error("want inherited after ready")
+	}
+	if err := u.Ready(); err != nil {
+		t.Errorf("second Ready got err:%v", err)
+	}
+}
+
+func dupFD(t *testing.T, c syscall.Conn) int {
+	raw, err := c.SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd := -1
+	err = raw.Control(func(s uintptr) { fd, err = syscall.Dup(int(s)) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fd
+}
+
+func TestUpgraderInvalidEnv(t *testing.T) {
+	defer os.Unsetenv(EnvUpgradeFDs)
+	for _, s := range []string{"http", "=3", "http=x"} {
+		os.Setenv(EnvUpgradeFDs, s)
+		if _, err := NewUpgrader(log.NewNopLogger()); err == nil {
+			t.Errorf("env:%q want err", s)
+		}
+	}
+}
+
+// 新进程为测试程序自身，只运行本测试，由upgradeTestMode决定新进程的行为
+const upgradeTestMode = "GOKIT_UPGRADE_TEST_MODE"
+
+func TestUpgraderUpgrade(t *testing.T) {
+	if os.Getenv(EnvUpgradeReadyFD) != "" {
+		upgradeTestChild()
+		return
+	}
+	u, err := NewUpgrader(log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis, err := u.Listen("http", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	args := os.Args
+	defer func() { os.Args = args }()
+	os.Args = []string{args[0], "-test.run=^TestUpgraderUpgrade$"}
+	defer os.Unsetenv(upgradeTestMode)
+
+	for _, tt := range []struct {
+		mode    string
+		wantErr string
+	}{
+		{mode: "exit", wantErr: "exited before ready"},
+		{mode: "hang", wantErr: "not ready"},
+		{mode: "ready:" + lis.Addr().String()},
+	} {
+		os.Setenv(upgradeTestMode, tt.mode)
+		begin := time.Now()
+		err := u.Upgrade(time.Second)
+		if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("mode:%s got err:%v want:%q", tt.mode, err, tt.wantErr)
+		}
+		if time.Since(begin) > 3*time.Second {
+			t.Errorf("mode:%s Upgrade took %s", tt.mode, time.Since(begin))
+		}
+	}
+}
+
+// 继承的socket地址与旧进程相同时才Ready
+func upgradeTestChild() {
+	mode := os.Getenv(upgradeTestMode)
+	switch {
+	case mode == "exit":
+		os.Exit(1)
+	case mode == "hang":
+		time.Sleep(time.Minute)
+	case strings.HasPrefix(mode, "ready:"):
+		u, err := NewUpgrader(log.NewNopLogger())
+		if err != nil {
+			os.Exit(2)
+		}
+		lis, err := u.Listen("http", "127.0.0.1:0")
+		if err != nil || lis.Addr().String() != strings.TrimPrefix(mode, "ready:") {
+			os.Exit(3)
+		}
+		_ = u.Ready()
+	}
+	os.Exit(0)
+}
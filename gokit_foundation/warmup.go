@@ -0,0 +1,118 @@
+package gokit_foundation
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"sync"
+	"time"
+)
+
+/*
+启动预热(warmup)：grpc/http服务开始监听之后、注册到服务发现之前执行，减少每次发布后最初一批请求的延迟尖刺：
+-	预先建立到下游的连接(如redis连接池)，避免第一批请求同时建连，见WarmupParallel
+-	预热缓存(如响应缓存中的热点key)
+-	自己调用几次接口，触发各层的延迟初始化(sync.Once、连接池、反射/编解码缓存等)，见WarmupRepeat
+与Preflight不同，预热失败不影响启动：每一步的耗时和失败原因只写入日志，
+超过timeout后剩下的步骤不再执行，随后照常注册，所以每一步都应该在ctx结束时尽快返回
+预热期间服务已经在监听，应通过HealthCheckServer.SetWarmingUp使健康检查(k8s readinessProbe)为NOT_SERVING
+*/
+
+type warmupStep struct {
+	name string
+	step func(ctx context.Context) error
+}
+
+type Warmup struct {
+	logger  log.Logger
+	timeout time.Duration
+	steps   []warmupStep
+}
+
+// WarmupResult 一步预热的结果，Err为ctx.Err()时表示超时后没有执行
+type WarmupResult struct {
+	Name string
+	Took time.Duration
+	Err  error
+}
+
+// NewWarmup timeout为所有步骤加起来的最长时间，<=0时不限制
+func NewWarmup(logger log.Logger, timeout time.Duration) *Warmup {
+	return &Warmup{logger: logger, timeout: timeout}
+}
+
+// Add 按添加顺序执行，name用于日志，如 redis pool
+func (w *Warmup) Add(name string, step func(ctx context.Context) error) *Warmup {
+	w.steps = append(w.steps, warmupStep{name: name, step: step})
+	return w
+}
+
+// Len 添加的步骤数，为0时不需要执行
+func (w *Warmup) Len() int {
+	return len(w.steps)
+}
+
+// Run 依次执行所有步骤并返回每一步的结果，某一步失败不影响其他步骤
+func (w *Warmup) Run(ctx context.Context) []WarmupResult {
+	if w.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.timeout)
+		defer cancel()
+	}
+	start := time.Now()
+	results := make([]WarmupResult, 0, len(w.steps))
+	failed := 0
+	for _, s := range w.steps {
+		r := WarmupResult{Name: s.name}
+		if r.Err = ctx.Err(); r.Err == nil {
+			t := time.Now()
+			r.Err = s.step(ctx)
+			r.Took = time.Since(t)
+		}
+		if r.Err != nil {
+			failed++
+		}
+		w.logger.Log("warmup", s.name, "took", r.Took, "err", r.Err)
+		results = append(results, r)
+	}
+	w.logger.Log("warmup", "done", "steps", len(w.steps), "failed", failed, "took", time.Since(start))
+	return results
+}
+
+// WarmupRepeat 依次执行n次step(如自己调用接口)，返回第一个err，ctx结束时不再继续
+func WarmupRepeat(n int, step func(ctx context.Context) error) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		var firstErr error
+		for i := 0; i < n && ctx.Err() == nil; i++ {
+			if err := step(ctx); err != nil && firstErr == nil {
+				firstErr = fmt.Errorf("#%d: %v", i+1, err)
+			}
+		}
+		if firstErr == nil {
+			firstErr = ctx.Err()
+		}
+		return firstErr
+	}
+}
+
+// WarmupParallel 同时执行n次step，用于预先建立连接池中的连接(如同时n次redis PING会建立n个连接)，返回第一个err
+func WarmupParallel(n int, step func(ctx context.Context) error) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		var (
+			wg       sync.WaitGroup
+			once     sync.Once
+			firstErr error
+		)
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := step(ctx); err != nil {
+					once.Do(func() { firstErr = err })
+				}
+			}()
+		}
+		wg.Wait()
+		return firstErr
+	}
+}
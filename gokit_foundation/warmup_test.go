@@ -0,0 +1,50 @@
+package gokit_foundation
+
+import (
+	"context"
+	"errors"
+	"github.com/go-kit/kit/log"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWarmup(t *testing.T) {
+	var calls int32
+	count := func(ctx context.Context) error { atomic.AddInt32(&calls, 1); return nil }
+	w := NewWarmup(log.NewNopLogger(), time.Millisecond*200).
+		Add("pool", WarmupParallel(3, count)).
+		Add("self requests", WarmupRepeat(5, count)).
+		Add("bad", func(ctx context.Context) error { return errors.New("boom") }).
+		Add("slow", func(ctx context.Context) error { <-ctx.Done(); return ctx.Err() }).
+		Add("skipped", count)
+	results := w.Run(context.Background())
+	if len(results) != 5 || atomic.LoadInt32(&calls) != 8 {
+		t.Fatalf("calls:%d results:%+v", calls, results)
+	}
+	// 某一步失败不影响之后的步骤，超时后剩下的步骤不再执行
+	if results[0].Err != nil || results[1].Err != nil || results[2].Err == nil ||
+		results[3].Err != context.DeadlineExceeded || results[4].Err != context.DeadlineExceeded || results[4].Took != 0 {
+		t.Errorf("got %+v", results)
+	}
+}
+
+func TestWarmupRepeat(t *testing.T) {
+	n := 0
+	err := WarmupRepeat(3, func(ctx context.Context) error {
+		n++
+		if n == 2 {
+			return errors.New("boom")
+		}
+		return nil
+	})(context.Background())
+	if n != 3 || err == nil || err.Error() != "#2: boom" {
+		t.Errorf("n:%d err:%v", n, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := WarmupRepeat(3, func(ctx context.Context) error { return nil })(ctx); err != context.Canceled {
+		t.Errorf("want canceled, got %v", err)
+	}
+}
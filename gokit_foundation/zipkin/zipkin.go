@@ -0,0 +1,80 @@
+package zipkin
+
+import (
+	"fmt"
+	"github.com/go-kit/kit/log"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	zipkinot "github.com/openzipkin-contrib/zipkin-go-opentracing"
+	zipkingo "github.com/openzipkin/zipkin-go"
+	zipkinhttp "github.com/openzipkin/zipkin-go/reporter/http"
+	"io"
+	stdlog "log"
+	"time"
+)
+
+/*
+基于zipkin-go的opentracing tracer(通过zipkin-go-opentracing桥接)，span通过HTTP批量上报给zipkin，
+如 http://zipkin:9411/api/v2/spans，URL为空时不启用，返回opentracing.NoopTracer
+span在进程内使用B3格式在grpc metadata和http header中传递(由opentracing的Inject/Extract完成)
+*/
+
+type Config struct {
+	URL        string
+	SampleRate float64 // 采样率，0表示全部不采样，1表示全部采样，其他取值[0.0001, 1)
+	LocalAddr  string  // 本服务的地址(host:port)，作为span的local endpoint，可为空
+}
+
+// DefaultConfig 默认以0.1的采样率采样，与jaeger.DefaultConfig一致
+func DefaultConfig() Config {
+	return Config{SampleRate: 0.1}
+}
+
+func (c Config) Enabled() bool {
+	return c.URL != ""
+}
+
+// Validate 检查采样率，未启用时不检查
+func (c Config) Validate() error {
+	if !c.Enabled() {
+		return nil
+	}
+	if c.SampleRate != 0 && (c.SampleRate < 0.0001 || c.SampleRate > 1) {
+		return fmt.Errorf("zipkin: sample rate must be 0 or in [0.0001, 1], got %v", c.SampleRate)
+	}
+	return nil
+}
+
+// New 按conf创建tracer，返回的io.Closer在进程退出前调用，会发送缓存中的span
+// 未启用时返回NoopTracer，一般在之后调用opentracing.SetGlobalTracer
+func New(serviceName string, conf Config, logger log.Logger) (stdopentracing.Tracer, io.Closer, error) {
+	if !conf.Enabled() {
+		logger.Log("zipkin", "disabled", "reason", "url not configured")
+		return stdopentracing.NoopTracer{}, nopCloser{}, nil
+	}
+	if err := conf.Validate(); err != nil {
+		return nil, nil, err
+	}
+	ep, err := zipkingo.NewEndpoint(serviceName, conf.LocalAddr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("zipkin: %v", err)
+	}
+	sampler, err := zipkingo.NewBoundarySampler(conf.SampleRate, time.Now().UnixNano())
+	if err != nil {
+		return nil, nil, fmt.Errorf("zipkin: %v", err)
+	}
+	// 上报失败只输出日志，不影响业务
+	reporter := zipkinhttp.NewReporter(conf.URL,
+		zipkinhttp.BatchInterval(time.Second),
+		zipkinhttp.Logger(stdlog.New(log.NewStdlibAdapter(log.With(logger, "zipkin", "reporter")), "", 0)))
+	tracer, err := zipkingo.NewTracer(reporter, zipkingo.WithLocalEndpoint(ep), zipkingo.WithSampler(sampler))
+	if err != nil {
+		_ = reporter.Close()
+		return nil, nil, fmt.Errorf("zipkin: %v", err)
+	}
+	logger.Log("zipkin", "enabled", "url", conf.URL, "sample_rate", conf.SampleRate)
+	return zipkinot.Wrap(tracer), reporter, nil
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
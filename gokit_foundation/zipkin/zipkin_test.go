@@ -0,0 +1,68 @@
+package zipkin
+
+import (
+	"github.com/go-kit/kit/log"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	test := []struct {
+		name    string
+		conf    Config
+		wantErr bool
+	}{
+		{name: "[disabled]", conf: Config{SampleRate: 2}},
+		{name: "[default]", conf: Config{URL: "http://127.0.0.1:9411/api/v2/spans", SampleRate: 0.1}},
+		{name: "[never]", conf: Config{URL: "http://127.0.0.1:9411/api/v2/spans"}},
+		{name: "[always]", conf: Config{URL: "http://127.0.0.1:9411/api/v2/spans", SampleRate: 1}},
+		{name: "[too small]", conf: Config{URL: "http://127.0.0.1:9411/api/v2/spans", SampleRate: 0.00001}, wantErr: true},
+		{name: "[2]", conf: Config{URL: "http://127.0.0.1:9411/api/v2/spans", SampleRate: 2}, wantErr: true},
+	}
+	for _, tt := range test {
+		if err := tt.conf.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: wantErr %v, got %v", tt.name, tt.wantErr, err)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	tracer, closer, err := New("test", Config{}, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tracer.(stdopentracing.NoopTracer); !ok {
+		t.Errorf("want NoopTracer when disabled, got %T", tracer)
+	}
+	_ = closer.Close()
+
+	bodies := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		bodies <- string(b)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	tracer, closer, err = New("test", Config{URL: srv.URL, SampleRate: 1, LocalAddr: "127.0.0.1:8080"}, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracer.StartSpan("op").Finish()
+	// Close时发送缓存中的span
+	if err := closer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case body := <-bodies:
+		if !strings.Contains(body, `"name":"op"`) || !strings.Contains(body, `"serviceName":"test"`) {
+			t.Errorf("got:%s", body)
+		}
+	default:
+		t.Error("span not reported")
+	}
+}
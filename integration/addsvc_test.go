@@ -0,0 +1,397 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis"
+	stdconsul "github.com/hashicorp/consul/api"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	jaegerclient "github.com/uber/jaeger-client-go"
+	"gokit_foundation/jaeger"
+	"gokit_foundation/sdclient"
+	"gokit_foundation/tracing"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"new_addsvc/client"
+	"new_addsvc/config"
+	"new_addsvc/pkg/service"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// 真实的addsvc进程：由cmd/addsvc编译，通过参数和环境变量连接测试容器，
+// endpoint中间件、指标、注册以及下线流程与部署时完全相同，测试只能通过grpc、/metrics、consul和信号观察它
+type addsvc struct {
+	addr        string // grpc
+	httpURL     string // http端口，/metrics在这里
+	dynamicConf string // 可热更新的配置文件，修改后发送SIGHUP
+	dir         string
+	cmd         *exec.Cmd
+	exited      chan error // 进程退出时的err，exit code为0时为nil
+	redisCli    *redis.Client
+}
+
+// consul中只注册这一个实例
+func startAddsvc(t *testing.T) *addsvc {
+	dir, err := ioutil.TempDir("", "addsvc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &addsvc{dir: dir, dynamicConf: filepath.Join(dir, "dynamic.json"), exited: make(chan error, 1)}
+	bin := filepath.Join(dir, "addsvc")
+	build := exec.Command("go", "build", "-o", bin, "./cmd/addsvc")
+	build.Dir = filepath.Join("..", "demo_project", "new_addsvc")
+	if out, err := build.CombinedOutput(); err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("build addsvc: %v\n%s", err, out)
+	}
+	if err := ioutil.WriteFile(a.dynamicConf, []byte("{}"), 0644); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	grpcPort, httpPort := freePort(t), freePort(t)
+	a.addr = fmt.Sprintf("127.0.0.1:%d", grpcPort)
+	a.httpURL = fmt.Sprintf("http://127.0.0.1:%d", httpPort)
+
+	// 容器中的consul访问不到宿主机的端口，使用TTL检查；每个span都上报
+	a.cmd = exec.Command(bin,
+		"-listen.host", "127.0.0.1", "-advertise.host", "127.0.0.1",
+		"-grpc.port", strconv.Itoa(grpcPort), "-http.port", strconv.Itoa(httpPort), "-admin.port", "0",
+		"-consul.addr", consulAddr, "-consul.check.ttl", "3s",
+		"-lame.duck", "1s", "-stop.timeout", "5s",
+		"-dynamic.conf", a.dynamicConf,
+		"-tracing.backend", "jaeger", "-jaeger.collector", jaegerCollector, "-jaeger.sampler", "const", "-jaeger.sampler.param", "1",
+	)
+	a.cmd.Env = append(os.Environ(), "CONSUL_ADDR="+consulAddr, "ADDSVC_REDIS_ADDR="+redisAddr, "ADDSVC_REDIS_PASSWORD=")
+	logFile, err := os.Create(filepath.Join(dir, "addsvc.log"))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	a.cmd.Stdout, a.cmd.Stderr = logFile, logFile
+	if err := a.cmd.Start(); err != nil {
+		logFile.Close()
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	go func() {
+		a.exited <- a.cmd.Wait()
+		logFile.Close()
+	}()
+	a.redisCli = redis.NewClient(&redis.Options{Addr: redisAddr})
+	return a
+}
+
+func freePort(t *testing.T) int {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	return lis.Addr().(*net.TCPAddr).Port
+}
+
+// 修改可热更新的配置并通知进程重新加载
+func (a *addsvc) reload(conf string) error {
+	if err := ioutil.WriteFile(a.dynamicConf, []byte(conf), 0644); err != nil {
+		return err
+	}
+	return a.cmd.Process.Signal(syscall.SIGHUP)
+}
+
+// 进程的输出，测试失败时打印
+func (a *addsvc) logs() string {
+	b, _ := ioutil.ReadFile(filepath.Join(a.dir, "addsvc.log"))
+	return string(b)
+}
+
+// shutdown 与部署时一样发送SIGTERM，返回进程是否在stop.timeout内正常退出(exit code为0)
+func (a *addsvc) shutdown() bool {
+	defer os.RemoveAll(a.dir)
+	defer a.redisCli.Close()
+	if err := a.cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		return false
+	}
+	select {
+	case err := <-a.exited:
+		return err == nil
+	case <-time.After(10 * time.Second):
+		_ = a.cmd.Process.Kill()
+		<-a.exited
+		return false
+	}
+}
+
+// 每个span都上报，BufferFlushInterval为1s
+func jaegerConfig() tracing.Config {
+	return tracing.Config{Backend: tracing.BackendJaeger, Jaeger: jaeger.Config{
+		CollectorEndpoint: jaegerCollector,
+		SamplerType:       jaeger.SamplerConst,
+		SamplerParam:      1,
+	}}
+}
+
+func passingInstances() ([]*stdconsul.ServiceEntry, error) {
+	cli, err := stdconsul.NewClient(&stdconsul.Config{Address: consulAddr})
+	if err != nil {
+		return nil, err
+	}
+	entries, _, err := cli.Health().Service(config.SvcName, "gokit_svc", true, nil)
+	return entries, err
+}
+
+// 子测试按顺序共用一个实例，最后一个子测试将其关闭
+func TestAddsvc(t *testing.T) {
+	a := startAddsvc(t)
+	stopped := false
+	defer func() {
+		if !stopped {
+			a.shutdown()
+		}
+	}()
+
+	// client读取的是全局tracer，需要在client.New之前设置
+	clientTracer, clientCloser, err := tracing.New("integration", jaegerConfig(), logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clientCloser.Close()
+	stdopentracing.SetGlobalTracer(clientTracer)
+	defer stdopentracing.SetGlobalTracer(stdopentracing.NoopTracer{})
+	// 总超时需要大于GracefulShutdown中注入的延迟
+	svc, stop, err := client.New(consulAddr, logger, sdclient.WithRetry(3, 5*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+	ctx := context.Background()
+
+	t.Run("Discovery", func(t *testing.T) {
+		// 第一次TTL上报之后才是passing
+		eventually(t, 10*time.Second, func() error {
+			entries, err := passingInstances()
+			if err != nil {
+				return err
+			}
+			if len(entries) != 1 || fmt.Sprintf("%s:%d", entries[0].Service.Address, entries[0].Service.Port) != a.addr {
+				return fmt.Errorf("got %d passing instances", len(entries))
+			}
+			return nil
+		})
+		// client的实例列表是异步从consul获取的
+		eventually(t, 10*time.Second, func() error {
+			v, err := svc.Sum(ctx, 1, 2)
+			if err == nil && v != 3 {
+				err = fmt.Errorf("got sum:%d", v)
+			}
+			return err
+		})
+		if _, err := svc.Sum(ctx, 0, 0); !errors.Is(err, service.ErrTwoZeroes) {
+			t.Errorf("got err:%v want ErrTwoZeroes", err)
+		}
+	})
+
+	t.Run("TracingPropagation", func(t *testing.T) {
+		sp := clientTracer.StartSpan("integration")
+		if _, err := svc.Sum(stdopentracing.ContextWithSpan(ctx, sp), 3, 4); err != nil {
+			t.Fatal(err)
+		}
+		sp.Finish()
+		traceID := sp.Context().(jaegerclient.SpanContext).TraceID().String()
+		// client和server的span都上报后，trace中有两个服务
+		eventually(t, 15*time.Second, func() error {
+			services, err := traceServices(traceID)
+			if err != nil {
+				return err
+			}
+			if !services["integration"] || !services[config.SvcName] {
+				return fmt.Errorf("trace %s got services:%v", traceID, services)
+			}
+			return nil
+		})
+	})
+
+	t.Run("Cache", func(t *testing.T) {
+		// Concat的response缓存在redis中，见config.GetCacheTTLs
+		for i := 0; i < 2; i++ {
+			if v, err := svc.Concat(ctx, "foo", "bar"); err != nil || v != "foobar" {
+				t.Fatalf("#%d got concat:%q err:%v", i, v, err)
+			}
+		}
+		keys, err := a.redisCli.Keys(config.SvcName + ":cache:Concat:*").Result()
+		if err != nil || len(keys) == 0 {
+			t.Errorf("got cache keys:%v err:%v", keys, err)
+		}
+	})
+
+	// 与demo_project/gateway一样，网关的span和addsvc client的span都由全局tracer创建
+	gw := startGateway(svc, clientTracer)
+	defer gw.Close()
+
+	t.Run("GatewayTracing", func(t *testing.T) {
+		sp := clientTracer.StartSpan("integration")
+		header := gatewayAuthHeader()
+		_ = clientTracer.Inject(sp.Context(), stdopentracing.HTTPHeaders, stdopentracing.HTTPHeadersCarrier(header))
+		rsp, err := postJSON(gw.URL+"/addsvc/sum", map[string]int{"a": 7, "b": 8}, header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body struct{ V int }
+		err = json.NewDecoder(rsp.Body).Decode(&body)
+		rsp.Body.Close()
+		if err != nil || rsp.StatusCode != http.StatusOK || body.V != 15 {
+			t.Fatalf("got status:%d sum:%d err:%v", rsp.StatusCode, body.V, err)
+		}
+		sp.Finish()
+		traceID := sp.Context().(jaegerclient.SpanContext).TraceID().String()
+		// 网关 → addsvc client → addsvc server，每一层是上一层的child
+		want := []wantSpan{
+			{service: "integration", operation: "integration"},
+			{service: "integration", operation: "POST /addsvc/sum",
+				tags: map[string]string{"span.kind": "server", "component": "gateway", "http.status_code": "200", "request_id": ""}},
+			{service: "integration", operation: "Sum", tags: map[string]string{"span.kind": "client"}},
+			{service: config.SvcName, operation: "Sum", tags: map[string]string{"span.kind": "server", "sum.a": "7", "sum.b": "8"}},
+		}
+		eventually(t, 15*time.Second, func() error {
+			spans, err := traceSpans(traceID)
+			if err != nil {
+				return err
+			}
+			return checkSpanChain(spans, want)
+		})
+	})
+
+	t.Run("Metrics", func(t *testing.T) {
+		// 之前的子测试已经通过网关和client调用过Sum
+		families, err := scrapeMetrics(a.httpURL + "/metrics")
+		if err != nil {
+			t.Fatal(err)
+		}
+		histograms := []struct {
+			name   string
+			labels map[string]string
+		}{
+			{"example_addsvc_request_duration_seconds", map[string]string{"method": "Sum", "success": "true"}},
+			{"example_addsvc_grpc_server_handling_seconds", map[string]string{"method": "/addsvcpb.Add/Sum", "type": "unary", "code": "OK"}},
+		}
+		for _, h := range histograms {
+			m, err := findMetric(families, h.name, h.labels)
+			if err != nil {
+				t.Error(err)
+			} else if m.GetHistogram().GetSampleCount() == 0 {
+				t.Errorf("%s%v got no samples", h.name, h.labels)
+			}
+		}
+		counters := []struct {
+			name   string
+			labels map[string]string
+		}{
+			{"example_addsvc_grpc_server_handled_total", map[string]string{"method": "/addsvcpb.Add/Sum", "type": "unary", "code": "OK"}},
+			{"example_addsvc_grpc_server_handled_total", map[string]string{"method": "/addsvcpb.Add/Concat", "type": "unary", "code": "OK"}},
+			{"example_addsvc_integers_summed", map[string]string{}},
+			{"example_addsvc_cache_lookups_total", map[string]string{"method": "Concat", "result": "hit"}},
+		}
+		for _, c := range counters {
+			m, err := findMetric(families, c.name, c.labels)
+			if err != nil {
+				t.Error(err)
+			} else if m.GetCounter().GetValue() == 0 {
+				t.Errorf("%s%v got 0", c.name, c.labels)
+			}
+		}
+		// Discovery中Sum(0, 0)返回的业务错误记为success=false
+		if _, err := findMetric(families, "example_addsvc_request_duration_seconds", map[string]string{"method": "Sum", "success": "false"}); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("GracefulShutdown", func(t *testing.T) {
+		// Sum注入延迟(超过lame.duck)，在下线期间仍在进行中
+		if err := a.reload(`{"chaos": {"Sum": {"latency": "1500ms", "latency_rate": 1}}, "timeouts": {"Sum": "3s"}}`); err != nil {
+			t.Fatal(err)
+		}
+		// 重新加载是异步的，调用变慢时已生效
+		eventually(t, 10*time.Second, func() error {
+			start := time.Now()
+			if _, err := svc.Sum(ctx, 1, 1); err != nil {
+				return err
+			}
+			if took := time.Since(start); took < time.Second {
+				return fmt.Errorf("chaos not applied, Sum took %v", took)
+			}
+			return nil
+		})
+		inflight := make(chan error, 1)
+		go func() {
+			v, err := svc.Sum(ctx, 5, 6)
+			if err == nil && v != 11 {
+				err = fmt.Errorf("got sum:%d", v)
+			}
+			inflight <- err
+		}()
+		time.Sleep(300 * time.Millisecond)
+
+		done := make(chan bool, 1)
+		go func() { done <- a.shutdown() }()
+		stopped = true
+		// Drain期间已经从consul注销
+		eventually(t, time.Second, func() error {
+			entries, err := passingInstances()
+			if err == nil && len(entries) != 0 {
+				err = fmt.Errorf("got %d passing instances", len(entries))
+			}
+			return err
+		})
+		if err := <-inflight; err != nil {
+			t.Errorf("in-flight call got err:%v", err)
+		}
+		if graceful := <-done; !graceful {
+			t.Errorf("addsvc did not exit cleanly, logs:\n%s", a.logs())
+		}
+		conn, err := net.DialTimeout("tcp", a.addr, time.Second)
+		if err == nil {
+			conn.Close()
+			t.Errorf("%s still accepts connections", a.addr)
+		}
+	})
+}
+
+// traceServices 从jaeger查询接口获取trace中的服务名
+func traceServices(traceID string) (map[string]bool, error) {
+	rsp, err := http.Get(jaegerQuery + "/api/traces/" + traceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", rsp.StatusCode)
+	}
+	var body struct {
+		Data []struct {
+			Processes map[string]struct {
+				ServiceName string `json:"serviceName"`
+			} `json:"processes"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(rsp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	services := make(map[string]bool)
+	for _, tr := range body.Data {
+		for _, p := range tr.Processes {
+			services[p.ServiceName] = true
+		}
+	}
+	return services, nil
+}
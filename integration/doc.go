@@ -0,0 +1,19 @@
+/*
+Package integration 端到端测试：通过dockertest启动consul、redis、postgres、jaeger容器，
+编译并启动真实的addsvc进程(与部署相同的参数和中间件)，网关使用gateway/routes中与部署相同的路由，
+usersvc的http服务在测试进程内启动，覆盖以下场景：
+  - addsvc注册到consul(TTL检查，容器中的consul不需要访问宿主机端口)，client从consul发现实例并调用
+  - client与server的span属于同一个trace，从jaeger的查询接口确认
+  - 经过网关(见gateway.Tracing)调用时，网关 → client → server的span层级和标签，以及/metrics中指标的标签(见observability_test.go)
+  - 幂等接口的response缓存在redis中(见config.GetCacheTTLs)
+  - 优雅退出：收到SIGTERM后从consul注销、等待进行中的调用结束、正常退出(见gokit_foundation.Drainer)
+  - usersvc的数据库迁移、CRUD、幂等键(redis)以及outbox在真实的postgres上执行
+
+测试文件带有integration构建标签，默认的go test ./...不会执行，需要本机可以访问docker：
+
+	cd integration && go test -tags=integration -v ./...
+
+DOCKER_HOST为空时使用本机的unix socket，docker不可用时跳过所有测试；容器在测试结束后删除，
+测试进程异常退出时最多保留10分钟(见containerTTL)
+*/
+package integration
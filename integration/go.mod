@@ -0,0 +1,32 @@
+module integration
+
+go 1.12
+
+require (
+	gateway v0.0.0-00010101000000-000000000000
+	github.com/dgrijalva/jwt-go v3.2.0+incompatible
+	github.com/go-kit/kit v0.10.0
+	github.com/go-redis/redis v6.15.9+incompatible
+	github.com/gorilla/mux v1.7.3
+	github.com/hashicorp/consul/api v1.7.0
+	github.com/opentracing/opentracing-go v1.1.0
+	github.com/ory/dockertest/v3 v3.6.0
+	github.com/prometheus/client_model v0.2.0
+	github.com/prometheus/common v0.10.0
+	github.com/uber/jaeger-client-go v2.25.0+incompatible
+	go-util v0.0.0-00010101000000-000000000000
+	gokit_foundation v0.0.0-00010101000000-000000000000
+	golang.org/x/time v0.0.0-20191024005414-555d28b269f0
+	google.golang.org/grpc v1.32.0
+	new_addsvc v0.0.0-00010101000000-000000000000
+	usersvc v0.0.0-00010101000000-000000000000
+)
+
+replace (
+	gateway => ../demo_project/gateway
+	go-util => ../go-util
+	gokit_foundation => ../gokit_foundation
+	hello => ../demo_project/hello
+	new_addsvc => ../demo_project/new_addsvc
+	usersvc => ../demo_project/usersvc
+)
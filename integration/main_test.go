@@ -0,0 +1,176 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"github.com/go-redis/redis"
+	"github.com/ory/dockertest/v3"
+	"github.com/ory/dockertest/v3/docker"
+	"gokit_foundation"
+	"gokit_foundation/sqlmw"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+	"usersvc/pkg/repository"
+)
+
+// 容器的过期时间(秒)，测试进程异常退出没有删除容器时由docker删除
+const containerTTL = 600
+
+// 由TestMain在容器启动后设置
+var (
+	consulAddr      string // host:port
+	redisAddr       string // host:port
+	postgresDSN     string
+	jaegerQuery     string // http://host:port
+	jaegerCollector string // http://host:port/api/traces
+	logger          = log.NewNopLogger()
+)
+
+type container struct {
+	name  string
+	opts  dockertest.RunOptions
+	ready func(r *dockertest.Resource) error // 返回nil时容器可用，之前会一直重试(见dockertest.Pool.Retry)
+}
+
+var containers = []container{
+	{
+		name: "consul",
+		opts: dockertest.RunOptions{Repository: "consul", Tag: "1.8", Cmd: []string{"agent", "-dev", "-client", "0.0.0.0"}},
+		ready: func(r *dockertest.Resource) error {
+			consulAddr = r.GetHostPort("8500/tcp")
+			// 选出leader后才能注册服务
+			return httpOK("http://"+consulAddr+"/v1/status/leader", `""`)
+		},
+	},
+	{
+		name: "redis",
+		opts: dockertest.RunOptions{Repository: "redis", Tag: "6-alpine"},
+		ready: func(r *dockertest.Resource) error {
+			redisAddr = r.GetHostPort("6379/tcp")
+			cli := redis.NewClient(&redis.Options{Addr: redisAddr})
+			defer cli.Close()
+			return cli.Ping().Err()
+		},
+	},
+	{
+		name: "postgres",
+		opts: dockertest.RunOptions{Repository: "postgres", Tag: "12-alpine", Env: []string{"POSTGRES_PASSWORD=secret", "POSTGRES_DB=usersvc"}},
+		ready: func(r *dockertest.Resource) error {
+			postgresDSN = fmt.Sprintf("postgres://postgres:secret@%s/usersvc?sslmode=disable", r.GetHostPort("5432/tcp"))
+			db, err := repository.Open(context.Background(), postgresDSN, sqlmw.Config{})
+			if err != nil {
+				return err
+			}
+			return db.Close()
+		},
+	},
+	{
+		name: "jaeger",
+		opts: dockertest.RunOptions{Repository: "jaegertracing/all-in-one", Tag: "1.20"},
+		ready: func(r *dockertest.Resource) error {
+			jaegerQuery = "http://" + r.GetHostPort("16686/tcp")
+			jaegerCollector = "http://" + r.GetHostPort("14268/tcp") + "/api/traces"
+			return httpOK(jaegerQuery+"/api/services", "")
+		},
+	},
+}
+
+// httpOK GET url返回200且body不为notBody时返回nil
+func httpOK(url, notBody string) error {
+	rsp, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: status %d", url, rsp.StatusCode)
+	}
+	b, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return err
+	}
+	if notBody != "" && strings.TrimSpace(string(b)) == notBody {
+		return errors.New(url + ": not ready")
+	}
+	return nil
+}
+
+func TestMain(m *testing.M) {
+	os.Exit(run(m))
+}
+
+func run(m *testing.M) int {
+	flag.Parse()
+	if testing.Verbose() {
+		logger = log.NewLogfmtLogger(log.NewSyncWriter(os.Stderr))
+	}
+	// 为空时使用DOCKER_HOST或本机的unix socket
+	pool, err := dockertest.NewPool("")
+	if err == nil {
+		err = pool.Client.Ping()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "integration: docker unavailable, skip all tests:", err)
+		return 0
+	}
+	pool.MaxWait = 2 * time.Minute
+
+	var resources []*dockertest.Resource
+	defer func() {
+		for _, r := range resources {
+			if err := pool.Purge(r); err != nil {
+				fmt.Fprintln(os.Stderr, "integration: purge container:", err)
+			}
+		}
+	}()
+	// 先全部启动再依次等待，各容器的初始化时间可以重叠
+	for _, c := range containers {
+		opts := c.opts
+		r, err := pool.RunWithOptions(&opts, func(hc *docker.HostConfig) {
+			hc.AutoRemove = true
+			hc.RestartPolicy = docker.RestartPolicy{Name: "no"}
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "integration: start %s: %v\n", c.name, err)
+			return 1
+		}
+		_ = r.Expire(containerTTL)
+		resources = append(resources, r)
+	}
+	for i, c := range containers {
+		r := resources[i]
+		if err := pool.Retry(func() error { return c.ready(r) }); err != nil {
+			fmt.Fprintf(os.Stderr, "integration: %s not ready: %v\n", c.name, err)
+			return 1
+		}
+		logger.Log("integration", "container ready", "name", c.name, "id", r.Container.ID[:12])
+	}
+	gokit_foundation.ConsulAddr = consulAddr
+	return m.Run()
+}
+
+// eventually 在timeout内重试fn直到返回nil，用于等待异步的结果(服务发现、span上报等)
+func eventually(t *testing.T, timeout time.Duration, fn func() error) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for {
+		err := fn()
+		if err == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("not satisfied after %s: %v", timeout, err)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
@@ -0,0 +1,197 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"gateway/routes"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gorilla/mux"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"gokit_foundation"
+	"gokit_foundation/gateway"
+	"golang.org/x/time/rate"
+	"net/http"
+	"net/http/httptest"
+	addservice "new_addsvc/pkg/service"
+	"sort"
+	"strings"
+)
+
+/*
+可观测性的约定：经过网关调用addsvc后，从jaeger的查询接口和addsvc的/metrics确认span的层级、标签以及指标的标签，
+告警规则、dashboard、trace查询依赖这些名字，修改时这里的测试会失败
+*/
+
+// 与demo_project/gateway相同的路由和中间件(见gateway/routes)，包括身份验证，不限速
+func startGateway(add addservice.Service, tracer stdopentracing.Tracer) *httptest.Server {
+	r := mux.NewRouter()
+	gw := gateway.New(r, "", gokit_foundation.NewLogger(nil))
+	routes.Use(r, gw, tracer, gateway.NewRateLimiter(rate.Inf, 1, nil))
+	routes.AddSvc(r, gw, add)
+	return httptest.NewServer(r)
+}
+
+// 与demo_project/gateway/main_test.go的genJWToken相同，密钥等见gokit_foundation/gateway
+func gatewayAuthHeader() http.Header {
+	cls := jwt.MapClaims{"aud": "example_aud", "sub": "example_sub", "iss": "example_iss"}
+	s, _ := jwt.NewWithClaims(jwt.SigningMethodHS512, cls).SignedString([]byte("your_secret"))
+	return http.Header{"Authorization": []string{"Bearer " + s}}
+}
+
+// jaeger查询接口返回的span，只保留需要检查的字段
+type jaegerSpan struct {
+	SpanID        string `json:"spanID"`
+	OperationName string `json:"operationName"`
+	References    []struct {
+		RefType string `json:"refType"`
+		SpanID  string `json:"spanID"`
+	} `json:"references"`
+	Tags []struct {
+		Key   string      `json:"key"`
+		Value interface{} `json:"value"`
+	} `json:"tags"`
+	ProcessID string `json:"processID"`
+
+	service string
+}
+
+func (s *jaegerSpan) parent() string {
+	for _, ref := range s.References {
+		if ref.RefType == "CHILD_OF" {
+			return ref.SpanID
+		}
+	}
+	return ""
+}
+
+// tag的值统一转为字符串比较，jaeger中数字为float64、bool为bool
+func (s *jaegerSpan) tag(key string) (string, bool) {
+	for _, t := range s.Tags {
+		if t.Key == key {
+			return fmt.Sprint(t.Value), true
+		}
+	}
+	return "", false
+}
+
+func (s *jaegerSpan) String() string {
+	return s.service + "/" + s.OperationName
+}
+
+// traceSpans 从jaeger查询接口获取trace中的所有span
+func traceSpans(traceID string) ([]*jaegerSpan, error) {
+	rsp, err := http.Get(jaegerQuery + "/api/traces/" + traceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", rsp.StatusCode)
+	}
+	var body struct {
+		Data []struct {
+			Spans     []*jaegerSpan `json:"spans"`
+			Processes map[string]struct {
+				ServiceName string `json:"serviceName"`
+			} `json:"processes"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(rsp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	var spans []*jaegerSpan
+	for _, tr := range body.Data {
+		for _, sp := range tr.Spans {
+			sp.service = tr.Processes[sp.ProcessID].ServiceName
+			spans = append(spans, sp)
+		}
+	}
+	return spans, nil
+}
+
+// 期望的一个span，tags中的值为空表示只要求存在
+type wantSpan struct {
+	service   string
+	operation string
+	tags      map[string]string
+}
+
+// checkSpanChain want[0]为root，之后每个span都是前一个的child
+func checkSpanChain(spans []*jaegerSpan, want []wantSpan) error {
+	parent := ""
+	for i, w := range want {
+		var found *jaegerSpan
+		for _, sp := range spans {
+			if sp.service == w.service && sp.OperationName == w.operation && sp.parent() == parent {
+				found = sp
+				break
+			}
+		}
+		if found == nil {
+			return fmt.Errorf("#%d %s/%s not found as child of %q in %v", i, w.service, w.operation, parent, spans)
+		}
+		for k, v := range w.tags {
+			if got, ok := found.tag(k); !ok || (v != "" && got != v) {
+				return fmt.Errorf("#%d %s got tag %s:%q want:%q", i, found, k, got, v)
+			}
+		}
+		parent = found.SpanID
+	}
+	return nil
+}
+
+// scrapeMetrics 以prometheus的text格式读取/metrics
+func scrapeMetrics(url string) (map[string]*dto.MetricFamily, error) {
+	rsp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", rsp.StatusCode)
+	}
+	var parser expfmt.TextParser
+	return parser.TextToMetricFamilies(rsp.Body)
+}
+
+// findMetric 返回标签与labels完全相同(不能多也不能少)的指标
+func findMetric(families map[string]*dto.MetricFamily, name string, labels map[string]string) (*dto.Metric, error) {
+	mf, ok := families[name]
+	if !ok {
+		return nil, fmt.Errorf("metric %s not found", name)
+	}
+	var got []string
+	for _, m := range mf.GetMetric() {
+		pairs := make(map[string]string, len(m.GetLabel()))
+		for _, l := range m.GetLabel() {
+			pairs[l.GetName()] = l.GetValue()
+		}
+		if fmt.Sprint(pairs) == fmt.Sprint(labels) {
+			return m, nil
+		}
+		got = append(got, fmt.Sprint(pairs))
+	}
+	sort.Strings(got)
+	return nil, fmt.Errorf("metric %s%v not found, got labels: %s", name, labels, strings.Join(got, " "))
+}
+
+func postJSON(url string, body interface{}, header http.Header) (*http.Response, error) {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", url, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	return http.DefaultClient.Do(req)
+}
@@ -0,0 +1,114 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"github.com/go-redis/redis"
+	stdopentracing "github.com/opentracing/opentracing-go"
+	"gokit_foundation/audit"
+	"gokit_foundation/idempotency"
+	"gokit_foundation/sqlmw"
+	"gokit_foundation/tenant"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+	"usersvc/pkg/endpoint"
+	"usersvc/pkg/repository"
+	"usersvc/pkg/repository/repotest"
+	"usersvc/pkg/service"
+	"usersvc/pkg/transport"
+)
+
+// usersvc的http服务使用真实的postgres(迁移、唯一索引、outbox)和redis(幂等键)
+func TestUsersvc(t *testing.T) {
+	ctx := context.Background()
+	db, err := repository.Open(ctx, postgresDSN, sqlmw.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if current, latest, err := repository.SchemaVersion(ctx, db); err != nil || current != 0 || latest == 0 {
+		t.Fatalf("fresh database got version:%d/%d err:%v", current, latest, err)
+	}
+	// 重复执行时不会再次迁移
+	if n, err := repository.Migrate(ctx, db); err != nil || n == 0 {
+		t.Fatalf("migrate got n:%d err:%v", n, err)
+	}
+	if n, err := repository.Migrate(ctx, db); err != nil || n != 0 {
+		t.Fatalf("migrate again got n:%d err:%v", n, err)
+	}
+	if current, latest, err := repository.SchemaVersion(ctx, db); err != nil || current != latest {
+		t.Fatalf("migrated database got version:%d/%d err:%v", current, latest, err)
+	}
+	redisCli := redis.NewClient(&redis.Options{Addr: redisAddr})
+	defer redisCli.Close()
+
+	tracer := stdopentracing.NoopTracer{}
+	svc := service.New(logger, repository.NewPostgres(db), true)
+	auditSink := repository.NewPostgresAuditSink(db)
+	eps := endpoint.New(svc, nil, nil, tracer, idempotency.NewRedisStore(redisCli), nil, tenant.Config{},
+		audit.NewChain("integration", auditSink, ""), logger)
+	srv := httptest.NewServer(transport.NewHTTPHandler(eps, tracer, logger))
+	defer srv.Close()
+	cli, err := transport.MakeHTTPClientEndpoints(srv.URL, 5*time.Second, tracer, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 带上幂等键的重试不会重复创建
+	var id int64
+	for i := 0; i < 2; i++ {
+		u, err := cli.CreateUser(idempotency.WithKey(ctx, "integration-create"), "Jack", "jack@example.com")
+		if err != nil || (id != 0 && u.ID != id) {
+			t.Fatalf("#%d CreateUser got user:%+v err:%v", i, u, err)
+		}
+		id = u.ID
+	}
+	if _, err := cli.CreateUser(ctx, "Jack2", "jack@example.com"); err != service.ErrEmailExists {
+		t.Errorf("CreateUser got err:%v want ErrEmailExists", err)
+	}
+	name := "Rose"
+	if u, err := cli.UpdateUser(ctx, id, &name, nil); err != nil || u.Name != name || u.Email != "jack@example.com" {
+		t.Errorf("UpdateUser got user:%+v err:%v", u, err)
+	}
+	if u, err := cli.GetUser(ctx, id); err != nil || u.Name != name {
+		t.Errorf("GetUser got user:%+v err:%v", u, err)
+	}
+	if err := cli.DeleteUser(ctx, id); err != nil {
+		t.Errorf("DeleteUser got err:%v", err)
+	}
+	if _, err := cli.GetUser(ctx, id); err != service.ErrUserNotFound {
+		t.Errorf("GetUser got err:%v want ErrUserNotFound", err)
+	}
+
+	// 创建、修改、删除各写入一条领域事件，没有运行outbox.Dispatcher所以都还在outbox表中
+	var events []string
+	err = db.SelectContext(ctx, &events, "SELECT event_type FROM outbox ORDER BY id")
+	if want := []string{service.EventUserCreated, service.EventUserUpdated, service.EventUserDeleted}; err != nil || !reflect.DeepEqual(events, want) {
+		t.Errorf("got outbox events:%v err:%v want %v", events, err, want)
+	}
+
+	// 修改类接口(包括重放和业务错误)都记录在audit_log表中，hash链完整且表只能追加
+	records, err := auditSink.Records(ctx)
+	if err != nil || len(records) != 5 {
+		t.Fatalf("got audit records:%+v err:%v", records, err)
+	}
+	if r := records[2]; r.Method != "CreateUser" || r.Result != "ret_code="+strconv.Itoa(service.ErrorToRetCode(service.ErrEmailExists)) {
+		t.Errorf("got audit record:%+v", r)
+	}
+	if err := audit.Verify(records); err != nil {
+		t.Error(err)
+	}
+	if _, err := db.ExecContext(ctx, "DELETE FROM audit_log"); err == nil {
+		t.Error("audit_log should be append-only")
+	}
+
+	// 每个子测试使用单独的租户，不影响上面的数据(outbox已检查完)
+	t.Run("RepositoryContract", func(t *testing.T) {
+		repotest.Contract(t, repository.NewPostgres(db))
+	})
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// 缓存History、WordFrequency的结果(如排序所有单词的开销较大)，与instrumentingMiddleware一样是service中间件
+// 结果在ttl后过期，Uppercase成功后状态改变，清空缓存，所以同一个实例内不会读到旧的结果
+type cachingMiddleware struct {
+	ttl  time.Duration
+	next StringService
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	gen     int // 每次清空缓存时加1
+}
+
+type cacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+func newCachingMiddleware(ttl time.Duration, next StringService) *cachingMiddleware {
+	return &cachingMiddleware{ttl: ttl, next: next, entries: map[string]cacheEntry{}}
+}
+
+func (mw *cachingMiddleware) Uppercase(s string) (string, error) {
+	v, err := mw.next.Uppercase(s)
+	if err == nil {
+		mw.mu.Lock()
+		mw.entries = map[string]cacheEntry{}
+		mw.gen++
+		mw.mu.Unlock()
+	}
+	return v, err
+}
+
+func (mw *cachingMiddleware) Count(s string) int {
+	return mw.next.Count(s)
+}
+
+func (mw *cachingMiddleware) Hash(ctx context.Context, s string, rounds int) (string, error) {
+	return mw.next.Hash(ctx, s, rounds)
+}
+
+func (mw *cachingMiddleware) History(n int) ([]HistoryEntry, error) {
+	v, err := mw.get(fmt.Sprintf("history:%d", n), func() (interface{}, error) { return mw.next.History(n) })
+	h, _ := v.([]HistoryEntry)
+	return h, err
+}
+
+func (mw *cachingMiddleware) WordFrequency(n int) ([]WordCount, error) {
+	v, err := mw.get(fmt.Sprintf("wordfreq:%d", n), func() (interface{}, error) { return mw.next.WordFrequency(n) })
+	wc, _ := v.([]WordCount)
+	return wc, err
+}
+
+// 未命中时调用load，err不缓存；load期间缓存被清空时不保存结果，避免缓存旧的状态
+func (mw *cachingMiddleware) get(key string, load func() (interface{}, error)) (interface{}, error) {
+	mw.mu.Lock()
+	e, ok := mw.entries[key]
+	gen := mw.gen
+	mw.mu.Unlock()
+	if ok && time.Now().Before(e.expires) {
+		return e.value, nil
+	}
+	v, err := load()
+	if err != nil {
+		return nil, err
+	}
+	mw.mu.Lock()
+	if gen == mw.gen {
+		mw.entries[key] = cacheEntry{value: v, expires: time.Now().Add(mw.ttl)}
+	}
+	mw.mu.Unlock()
+	return v, nil
+}
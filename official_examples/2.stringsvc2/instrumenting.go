@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -36,3 +37,36 @@ func (mw instrumentingMiddleware) Count(s string) (n int) {
 	n = mw.next.Count(s)
 	return
 }
+
+func (mw instrumentingMiddleware) History(n int) (h []HistoryEntry, err error) {
+	defer func(begin time.Time) {
+		lvs := []string{"method", "history", "error", fmt.Sprint(err != nil)}
+		mw.requestCount.With(lvs...).Add(1)
+		mw.requestLatency.With(lvs...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	h, err = mw.next.History(n)
+	return
+}
+
+func (mw instrumentingMiddleware) WordFrequency(n int) (wc []WordCount, err error) {
+	defer func(begin time.Time) {
+		lvs := []string{"method", "wordfreq", "error", fmt.Sprint(err != nil)}
+		mw.requestCount.With(lvs...).Add(1)
+		mw.requestLatency.With(lvs...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	wc, err = mw.next.WordFrequency(n)
+	return
+}
+
+func (mw instrumentingMiddleware) Hash(ctx context.Context, s string, rounds int) (v string, err error) {
+	defer func(begin time.Time) {
+		lvs := []string{"method", "hash", "error", fmt.Sprint(err != nil)}
+		mw.requestCount.With(lvs...).Add(1)
+		mw.requestLatency.With(lvs...).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	v, err = mw.next.Hash(ctx, s, rounds)
+	return
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/transport/http/jsonrpc"
+	"go-util/_go"
+)
+
+/*
+JSON-RPC 2.0 transport，与HTTP transport共用同一个svc，method为uppercase、count、history、wordfreq和hash
+-	go-kit的jsonrpc.Server只处理单个请求对象，批量请求(JSON数组)和通知(没有id的请求)由batchHandler处理：
+	拆开后逐个交给jsonrpc.Server，再把响应合并成数组，通知不返回响应
+-	错误映射为JSON-RPC的error对象(见rpcError)，ErrEmpty、ErrInvalidLimit等使用业务错误码(见errCodeEmpty等)
+-	jsonrpc.Server返回的error响应中id为null，batchHandler会补上请求的id
+*/
+
+// JSON-RPC保留了-32768到-32000的错误码，业务错误使用其它值
+const (
+	errCodeEmpty         = 1
+	errCodeInvalidLimit  = 2
+	errCodeInvalidRounds = 3
+	errCodeBusy          = 4 // hash的队列已满，稍后重试
+)
+
+func makeJSONRPCHandler(svc StringService, logger log.Logger) http.Handler {
+	ecm := jsonrpc.EndpointCodecMap{
+		"uppercase": jsonrpc.EndpointCodec{
+			Endpoint: makeRPCUppercaseEndpoint(svc),
+			Decode:   decodeUppercaseParams,
+			Encode:   encodeResult,
+		},
+		"count": jsonrpc.EndpointCodec{
+			Endpoint: makeCountEndpoint(svc),
+			Decode:   decodeCountParams,
+			Encode:   encodeResult,
+		},
+		"history": jsonrpc.EndpointCodec{
+			Endpoint: makeRPCHistoryEndpoint(svc),
+			Decode:   decodeLimitParams,
+			Encode:   encodeResult,
+		},
+		"wordfreq": jsonrpc.EndpointCodec{
+			Endpoint: makeRPCWordFrequencyEndpoint(svc),
+			Decode:   decodeLimitParams,
+			Encode:   encodeResult,
+		},
+		"hash": jsonrpc.EndpointCodec{
+			Endpoint: makeRPCHashEndpoint(svc),
+			Decode:   decodeHashParams,
+			Encode:   encodeResult,
+		},
+	}
+	srv := jsonrpc.NewServer(ecm,
+		jsonrpc.ServerErrorEncoder(encodeRPCError),
+		jsonrpc.ServerErrorLogger(logger),
+	)
+	return batchHandler{next: srv}
+}
+
+// 与makeUppercaseEndpoint不同，业务错误通过err返回，由encodeRPCError映射为error对象
+func makeRPCUppercaseEndpoint(svc StringService) endpoint.Endpoint {
+	return func(_ context.Context, request interface{}) (interface{}, error) {
+		req := request.(uppercaseRequest)
+		v, err := svc.Uppercase(req.S)
+		if err != nil {
+			return nil, err
+		}
+		return uppercaseResponse{V: v}, nil
+	}
+}
+
+func makeRPCHistoryEndpoint(svc StringService) endpoint.Endpoint {
+	return func(_ context.Context, request interface{}) (interface{}, error) {
+		v, err := svc.History(request.(limitRequest).N)
+		if err != nil {
+			return nil, err
+		}
+		return historyResponse{V: v}, nil
+	}
+}
+
+func makeRPCWordFrequencyEndpoint(svc StringService) endpoint.Endpoint {
+	return func(_ context.Context, request interface{}) (interface{}, error) {
+		v, err := svc.WordFrequency(request.(limitRequest).N)
+		if err != nil {
+			return nil, err
+		}
+		return wordFrequencyResponse{V: v}, nil
+	}
+}
+
+func makeRPCHashEndpoint(svc StringService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(hashRequest)
+		v, err := svc.Hash(ctx, req.S, req.Rounds)
+		if err != nil {
+			return nil, err
+		}
+		return hashResponse{V: v}, nil
+	}
+}
+
+func decodeUppercaseParams(_ context.Context, params json.RawMessage) (interface{}, error) {
+	var request uppercaseRequest
+	if err := json.Unmarshal(params, &request); err != nil {
+		return nil, jsonrpc.Error{Code: jsonrpc.InvalidParamsError, Message: err.Error()}
+	}
+	return request, nil
+}
+
+func decodeCountParams(_ context.Context, params json.RawMessage) (interface{}, error) {
+	var request countRequest
+	if err := json.Unmarshal(params, &request); err != nil {
+		return nil, jsonrpc.Error{Code: jsonrpc.InvalidParamsError, Message: err.Error()}
+	}
+	return request, nil
+}
+
+func decodeLimitParams(_ context.Context, params json.RawMessage) (interface{}, error) {
+	var request limitRequest
+	if err := json.Unmarshal(params, &request); err != nil {
+		return nil, jsonrpc.Error{Code: jsonrpc.InvalidParamsError, Message: err.Error()}
+	}
+	return request, nil
+}
+
+func decodeHashParams(_ context.Context, params json.RawMessage) (interface{}, error) {
+	var request hashRequest
+	if err := json.Unmarshal(params, &request); err != nil {
+		return nil, jsonrpc.Error{Code: jsonrpc.InvalidParamsError, Message: err.Error()}
+	}
+	return request, nil
+}
+
+func encodeResult(_ context.Context, result interface{}) (json.RawMessage, error) {
+	return json.Marshal(result)
+}
+
+func rpcError(err error) jsonrpc.Error {
+	switch err {
+	case ErrEmpty:
+		return jsonrpc.Error{Code: errCodeEmpty, Message: err.Error()}
+	case ErrInvalidLimit:
+		return jsonrpc.Error{Code: errCodeInvalidLimit, Message: err.Error()}
+	case ErrInvalidRounds:
+		return jsonrpc.Error{Code: errCodeInvalidRounds, Message: err.Error()}
+	case _go.ErrPoolFull:
+		return jsonrpc.Error{Code: errCodeBusy, Message: err.Error()}
+	}
+	switch e := err.(type) {
+	case jsonrpc.Error:
+		return e
+	case jsonrpc.ErrorCoder:
+		return jsonrpc.Error{Code: e.ErrorCode(), Message: err.Error()}
+	}
+	return jsonrpc.Error{Code: jsonrpc.InternalError, Message: err.Error()}
+}
+
+// 与jsonrpc.DefaultErrorEncoder一样http状态码为200，错误信息在error对象中
+func encodeRPCError(_ context.Context, err error, w http.ResponseWriter) {
+	e := rpcError(err)
+	w.Header().Set("Content-Type", jsonrpc.ContentType)
+	_ = json.NewEncoder(w).Encode(rpcResponse{JSONRPC: jsonrpc.Version, Error: &e})
+}
+
+// 与jsonrpc.Response相同，只是id保留请求中的原始JSON
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *jsonrpc.Error  `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+func errorResponse(id json.RawMessage, code int) json.RawMessage {
+	b, _ := json.Marshal(rpcResponse{
+		JSONRPC: jsonrpc.Version,
+		Error:   &jsonrpc.Error{Code: code, Message: jsonrpc.ErrorMessage(code)},
+		ID:      id,
+	})
+	return b
+}
+
+type batchHandler struct {
+	next http.Handler
+}
+
+func (h batchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	body = bytes.TrimSpace(body)
+	if err != nil || !json.Valid(body) {
+		writeRPC(w, errorResponse(nil, jsonrpc.ParseError))
+		return
+	}
+
+	if body[0] != '[' {
+		if resp := h.serveOne(r, body); resp != nil {
+			writeRPC(w, resp)
+		} else {
+			w.WriteHeader(http.StatusNoContent)
+		}
+		return
+	}
+
+	var reqs []json.RawMessage
+	_ = json.Unmarshal(body, &reqs) // 已经校验过是合法的JSON
+	if len(reqs) == 0 {
+		writeRPC(w, errorResponse(nil, jsonrpc.InvalidRequestError))
+		return
+	}
+	resps := make([]json.RawMessage, 0, len(reqs))
+	for _, req := range reqs {
+		if resp := h.serveOne(r, req); resp != nil {
+			resps = append(resps, resp)
+		}
+	}
+	// 全部是通知时不返回响应
+	if len(resps) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	b, _ := json.Marshal(resps)
+	writeRPC(w, b)
+}
+
+// serveOne 将单个请求交给jsonrpc.Server处理，请求是通知时返回nil
+func (h batchHandler) serveOne(r *http.Request, raw json.RawMessage) json.RawMessage {
+	var req struct {
+		JSONRPC string          `json:"jsonrpc"`
+		ID      json.RawMessage `json:"id"` // 没有id字段时为nil，"id":null时为null
+	}
+	if err := json.Unmarshal(raw, &req); err != nil || req.JSONRPC != jsonrpc.Version {
+		return errorResponse(req.ID, jsonrpc.InvalidRequestError)
+	}
+
+	sub := r.WithContext(r.Context())
+	sub.Body = ioutil.NopCloser(bytes.NewReader(raw))
+	sub.ContentLength = int64(len(raw))
+	bw := &bufferedWriter{header: http.Header{}}
+	h.next.ServeHTTP(bw, sub)
+	if req.ID == nil {
+		return nil
+	}
+
+	var resp rpcResponse
+	if err := json.Unmarshal(bw.buf.Bytes(), &resp); err != nil {
+		return errorResponse(req.ID, jsonrpc.InternalError)
+	}
+	resp.ID = req.ID
+	b, _ := json.Marshal(resp)
+	return b
+}
+
+func writeRPC(w http.ResponseWriter, b []byte) {
+	w.Header().Set("Content-Type", jsonrpc.ContentType)
+	_, _ = w.Write(append(b, '\n'))
+}
+
+// 缓存jsonrpc.Server对单个请求的响应
+type bufferedWriter struct {
+	header http.Header
+	buf    bytes.Buffer
+}
+
+func (w *bufferedWriter) Header() http.Header         { return w.header }
+func (w *bufferedWriter) Write(b []byte) (int, error) { return w.buf.Write(b) }
+func (w *bufferedWriter) WriteHeader(int)             {}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestJSONRPC(t *testing.T) {
+	h := makeJSONRPCHandler(newStringService(newMemStore(10)), log.NewNopLogger())
+
+	cases := []struct {
+		name     string
+		body     string
+		wantCode int
+		want     string
+	}{
+		{name: "[uppercase]", body: `{"jsonrpc":"2.0","method":"uppercase","params":{"s":"hello"},"id":1}`,
+			wantCode: 200, want: `{"jsonrpc":"2.0","result":{"v":"HELLO"},"id":1}`},
+		{name: "[empty string]", body: `{"jsonrpc":"2.0","method":"uppercase","params":{"s":""},"id":"a"}`,
+			wantCode: 200, want: `{"jsonrpc":"2.0","error":{"code":1,"message":"empty string"},"id":"a"}`},
+		{name: "[wordfreq]", body: `{"jsonrpc":"2.0","method":"wordfreq","params":{"n":1},"id":5}`,
+			wantCode: 200, want: `{"jsonrpc":"2.0","result":{"v":[{"word":"hello","count":1}]},"id":5}`},
+		{name: "[invalid limit]", body: `{"jsonrpc":"2.0","method":"history","params":{"n":0},"id":6}`,
+			wantCode: 200, want: `{"jsonrpc":"2.0","error":{"code":2,"message":"n must be positive"},"id":6}`},
+		{name: "[method not found]", body: `{"jsonrpc":"2.0","method":"lower","id":2}`,
+			wantCode: 200, want: `{"jsonrpc":"2.0","error":{"code":-32601,"message":"Method lower was not found."},"id":2}`},
+		{name: "[invalid params]", body: `{"jsonrpc":"2.0","method":"count","params":[1],"id":3}`,
+			wantCode: 200, want: `"code":-32602`},
+		{name: "[parse error]", body: `{"jsonrpc"`,
+			wantCode: 200, want: `{"jsonrpc":"2.0","error":{"code":-32700,"message":"An error occurred on the server while parsing the JSON text."},"id":null}`},
+		{name: "[invalid request]", body: `{"method":"count","id":4}`,
+			wantCode: 200, want: `{"jsonrpc":"2.0","error":{"code":-32600,"message":"The JSON sent is not a valid Request object."},"id":4}`},
+		{name: "[empty batch]", body: `[]`,
+			wantCode: 200, want: `"code":-32600`},
+		{name: "[notification]", body: `{"jsonrpc":"2.0","method":"count","params":{"s":"abc"}}`,
+			wantCode: http.StatusNoContent},
+		{name: "[batch]", body: `[
+			{"jsonrpc":"2.0","method":"count","params":{"s":"hello"},"id":1},
+			{"jsonrpc":"2.0","method":"count","params":{"s":"x"}},
+			1,
+			{"jsonrpc":"2.0","method":"uppercase","params":{"s":""},"id":2}
+		]`,
+			wantCode: 200, want: `[{"jsonrpc":"2.0","result":{"v":5},"id":1},` +
+				`{"jsonrpc":"2.0","error":{"code":-32600,"message":"The JSON sent is not a valid Request object."},"id":null},` +
+				`{"jsonrpc":"2.0","error":{"code":1,"message":"empty string"},"id":2}]`},
+	}
+	for _, c := range cases {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(c.body)))
+		got := strings.TrimSpace(rec.Body.String())
+		if rec.Code != c.wantCode || !strings.Contains(got, c.want) || (c.want == "" && got != "") {
+			t.Errorf("%s got code:%d body:%s", c.name, rec.Code, got)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/rpc", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET got code:%d", rec.Code)
+	}
+}
@@ -1,42 +1,70 @@
 package main
 
 import (
+	"io"
+	"net/http"
 	"time"
 
 	"github.com/go-kit/kit/log"
 )
 
-type loggingMiddleware struct {
-	logger log.Logger
-	next   StringService
+// transport层的访问日志，每个请求一行，包括decode失败等没有到达service的请求
+// 之前在service层为每个接口写一个日志中间件，接口越多越麻烦，也记录不到transport层的错误
+
+type accessLogWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int
 }
 
-func (mw loggingMiddleware) Uppercase(s string) (output string, err error) {
-	defer func(begin time.Time) {
-		// e.g. method=uppercase input="hello, world" output="HELLO, WORLD" err=null took=2.927ms
-		_ = mw.logger.Log(
-			"method", "uppercase",
-			"input", s,
-			"output", output,
-			"err", err,
-			"took", time.Since(begin),
-		)
-	}(time.Now())
+func (w *accessLogWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
 
-	output, err = mw.next.Uppercase(s)
-	return
+func (w *accessLogWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+	return n, err
 }
 
-func (mw loggingMiddleware) Count(s string) (n int) {
-	defer func(begin time.Time) {
-		_ = mw.logger.Log(
-			"method", "count",
-			"input", s,
-			"n", n,
+type countingBody struct {
+	io.ReadCloser
+	bytes int
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.bytes += n
+	return n, err
+}
+
+// e.g. method=POST path=/uppercase peer=127.0.0.1:52614 req_bytes=20 resp_bytes=21 status=200 took=52.1µs
+func accessLogMiddleware(logger log.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/metrics" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		begin := time.Now()
+		body := &countingBody{ReadCloser: r.Body}
+		r.Body = body
+		aw := &accessLogWriter{ResponseWriter: w}
+		next.ServeHTTP(aw, r)
+		if aw.status == 0 {
+			aw.status = http.StatusOK
+		}
+		_ = logger.Log(
+			"method", r.Method,
+			"path", r.URL.Path,
+			"peer", r.RemoteAddr,
+			"req_bytes", body.bytes,
+			"resp_bytes", aw.bytes,
+			"status", aw.status,
 			"took", time.Since(begin),
 		)
-	}(time.Now())
-
-	n = mw.next.Count(s)
-	return
+	})
 }
@@ -3,6 +3,7 @@ package main
 import (
 	"net/http"
 	"os"
+	"time"
 
 	stdprometheus "github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -10,6 +11,7 @@ import (
 	"github.com/go-kit/kit/log"
 	kitprometheus "github.com/go-kit/kit/metrics/prometheus"
 	httptransport "github.com/go-kit/kit/transport/http"
+	"go-util/_go"
 )
 
 func main() {
@@ -38,11 +40,38 @@ func main() {
 		Help:      "The result of each count method.",
 	}, []string{}) // no fields here
 
+	// Hash的worker数为GOMAXPROCS，最多64个请求排队
+	hashPool := _go.NewPool("hash", 0, 64, _go.PoolMetrics{
+		WaitTime: kitprometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+			Namespace: "my_group",
+			Subsystem: "string_service",
+			Name:      "pool_wait_seconds",
+			Help:      "Time tasks spent waiting in the worker pool queue.",
+			Buckets:   []float64{.001, .005, .01, .05, .1, .5, 1},
+		}, []string{}),
+		QueueLength: kitprometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+			Namespace: "my_group",
+			Subsystem: "string_service",
+			Name:      "pool_queue_length",
+			Help:      "Number of tasks waiting in the worker pool queue.",
+		}, []string{}),
+		Rejected: kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: "my_group",
+			Subsystem: "string_service",
+			Name:      "pool_rejected_total",
+			Help:      "Number of tasks rejected because the worker pool queue is full.",
+		}, []string{}),
+	})
+
 	var svc StringService
-	svc = stringService{}
+	// 状态保存在内存中，最多保留1000条历史记录
+	svc = newStringService(newMemStore(1000))
+	// 在指标内层，耗时包括排队等待的时间
+	svc = workerPoolMiddleware{hashPool, svc}
 
-	// 日志和指标采集均通过中间件（装饰器）方式嵌入svc
-	svc = loggingMiddleware{logger, svc}
+	// 缓存同样是一个service中间件，安装在指标内层，命中缓存的调用也会被统计
+	svc = newCachingMiddleware(time.Second*5, svc)
+	// 指标采集通过中间件（装饰器）方式嵌入svc，日志在transport层记录，见accessLogMiddleware
 	svc = instrumentingMiddleware{requestCount, requestLatency, countResult, svc}
 
 	uppercaseHandler := httptransport.NewServer(
@@ -57,11 +86,35 @@ func main() {
 		encodeResponse,
 	)
 
+	historyHandler := httptransport.NewServer(
+		makeHistoryEndpoint(svc),
+		decodeLimitRequest,
+		encodeResponse,
+	)
+
+	wordFrequencyHandler := httptransport.NewServer(
+		makeWordFrequencyEndpoint(svc),
+		decodeLimitRequest,
+		encodeResponse,
+	)
+
+	hashHandler := httptransport.NewServer(
+		makeHashEndpoint(svc),
+		decodeHashRequest,
+		encodeResponse,
+		httptransport.ServerErrorEncoder(encodeHashError),
+	)
+
 	http.Handle("/uppercase", uppercaseHandler)
 	http.Handle("/count", countHandler)
+	http.Handle("/history", historyHandler)
+	http.Handle("/wordfreq", wordFrequencyHandler)
+	http.Handle("/hash", hashHandler)
+	// JSON-RPC 2.0，支持批量请求
+	http.Handle("/rpc", makeJSONRPCHandler(svc, logger))
 	http.Handle("/metrics", promhttp.Handler())
 	logger.Log("msg", "HTTP", "addr", ":8081")
-	logger.Log("err", http.ListenAndServe(":8081", nil))
+	logger.Log("err", http.ListenAndServe(":8081", accessLogMiddleware(logger, http.DefaultServeMux)))
 }
 
 /*
@@ -70,4 +123,14 @@ $ curl -XPOST -d'{"s":"hello, world"}' localhost:8080/uppercase
 {"v":"HELLO, WORLD"}
 $ curl -XPOST -d'{"s":"hello, world"}' localhost:8080/count
 {"v":12}
+$ curl -XPOST -d'{"n":2}' localhost:8081/history
+{"v":[{"s":"hello, world","v":"HELLO, WORLD","at":"2020-11-08T10:00:00.123+08:00"}]}
+$ curl -XPOST -d'{"n":2}' localhost:8081/wordfreq
+{"v":[{"word":"hello","count":1},{"word":"world","count":1}]}
+$ curl -XPOST -d'{"s":"hello","rounds":1}' localhost:8081/hash
+{"v":"2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"}
+$ curl -XPOST -d'{"jsonrpc":"2.0","method":"uppercase","params":{"s":"hello"},"id":1}' localhost:8081/rpc
+{"jsonrpc":"2.0","result":{"v":"HELLO"},"id":1}
+$ curl -XPOST -d'[{"jsonrpc":"2.0","method":"count","params":{"s":"hello"},"id":1},{"jsonrpc":"2.0","method":"uppercase","params":{"s":""},"id":2}]' localhost:8081/rpc
+[{"jsonrpc":"2.0","result":{"v":5},"id":1},{"jsonrpc":"2.0","error":{"code":1,"message":"empty string"},"id":2}]
 */
@@ -1,31 +1,106 @@
 package main
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"strings"
 	"time"
+	"unicode"
 )
 
 // StringService provides operations on strings.
 type StringService interface {
 	Uppercase(string) (string, error)
 	Count(string) int
+	// 最近n次Uppercase的输入和结果
+	History(n int) ([]HistoryEntry, error)
+	// 所有Uppercase输入中出现次数最多的n个单词(不区分大小写)
+	WordFrequency(n int) ([]WordCount, error)
+	// s经过rounds次sha256后的十六进制，CPU密集，通过workerPoolMiddleware限制并发
+	Hash(ctx context.Context, s string, rounds int) (string, error)
 }
 
-type stringService struct{}
+type stringService struct {
+	store Store
+}
 
-func (stringService) Uppercase(s string) (string, error) {
-	if s == "" {
+func newStringService(store Store) StringService {
+	return stringService{store: store}
+}
+
+func (s stringService) Uppercase(str string) (string, error) {
+	if str == "" {
 		return "", ErrEmpty
 	}
 	// to observe log and metric
 	time.Sleep(time.Millisecond * 2)
-	return strings.ToUpper(s), nil
+	v := strings.ToUpper(str)
+	if err := s.store.AddHistory(HistoryEntry{S: str, V: v, At: time.Now()}); err != nil {
+		return "", err
+	}
+	if err := s.store.AddWords(splitWords(str)); err != nil {
+		return "", err
+	}
+	return v, nil
 }
 
 func (stringService) Count(s string) int {
 	return len(s)
 }
 
+func (s stringService) History(n int) ([]HistoryEntry, error) {
+	if n <= 0 {
+		return nil, ErrInvalidLimit
+	}
+	return s.store.RecentHistory(n)
+}
+
+func (s stringService) WordFrequency(n int) ([]WordCount, error) {
+	if n <= 0 {
+		return nil, ErrInvalidLimit
+	}
+	return s.store.TopWords(n)
+}
+
+// 每计算hashCheckEvery次检查一次ctx，client断开后尽快释放worker
+const (
+	maxHashRounds  = 1 << 20
+	hashCheckEvery = 1 << 12
+)
+
+func (stringService) Hash(ctx context.Context, s string, rounds int) (string, error) {
+	if s == "" {
+		return "", ErrEmpty
+	}
+	if rounds <= 0 || rounds > maxHashRounds {
+		return "", ErrInvalidRounds
+	}
+	sum := sha256.Sum256([]byte(s))
+	for i := 1; i < rounds; i++ {
+		if i%hashCheckEvery == 0 && ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		sum = sha256.Sum256(sum[:])
+	}
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// 按非字母、数字的字符切分，转为小写
+func splitWords(s string) []string {
+	words := strings.FieldsFunc(s, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsNumber(r) })
+	for i, w := range words {
+		words[i] = strings.ToLower(w)
+	}
+	return words
+}
+
 // ErrEmpty is returned when an input string is empty.
 var ErrEmpty = errors.New("empty string")
+
+// History、WordFrequency的n必须大于0
+var ErrInvalidLimit = errors.New("n must be positive")
+
+// Hash的rounds必须在1到maxHashRounds之间
+var ErrInvalidRounds = errors.New("rounds must be between 1 and 1048576")
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	httptransport "github.com/go-kit/kit/transport/http"
+	"go-util/_go"
+)
+
+func TestStringService(t *testing.T) {
+	svc := newStringService(newMemStore(2))
+	for _, s := range []string{"Hello world", "hello, Go-kit", "go go"} {
+		if _, err := svc.Uppercase(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := svc.Uppercase(""); err != ErrEmpty {
+		t.Errorf("got err:%v", err)
+	}
+
+	// 只保留最近2条，新的在前
+	h, err := svc.History(5)
+	if err != nil || len(h) != 2 || h[0].V != "GO GO" || h[1].V != "HELLO, GO-KIT" {
+		t.Errorf("got history:%v err:%v", h, err)
+	}
+	wc, err := svc.WordFrequency(3)
+	want := []WordCount{{"go", 3}, {"hello", 2}, {"kit", 1}}
+	if err != nil || !reflect.DeepEqual(wc, want) {
+		t.Errorf("got words:%v err:%v", wc, err)
+	}
+	if _, err := svc.WordFrequency(0); err != ErrInvalidLimit {
+		t.Errorf("got err:%v", err)
+	}
+}
+
+// 命中缓存时不访问store，Uppercase后缓存失效
+func TestCachingMiddleware(t *testing.T) {
+	store := newMemStore(10)
+	svc := newCachingMiddleware(time.Minute, newStringService(store))
+	_, _ = svc.Uppercase("a")
+	if h, _ := svc.History(10); len(h) != 1 {
+		t.Fatalf("got history:%v", h)
+	}
+
+	_ = store.AddHistory(HistoryEntry{S: "b", V: "B"})
+	if h, _ := svc.History(10); len(h) != 1 {
+		t.Errorf("cache not used, got history:%v", h)
+	}
+	_, _ = svc.Uppercase("c")
+	if h, _ := svc.History(10); len(h) != 3 {
+		t.Errorf("cache not invalidated, got history:%v", h)
+	}
+
+	// err不缓存
+	if _, err := svc.History(0); err != ErrInvalidLimit {
+		t.Errorf("got err:%v", err)
+	}
+	if len(svc.entries) != 1 {
+		t.Errorf("got entries:%v", svc.entries)
+	}
+}
+
+func TestHash(t *testing.T) {
+	svc := newStringService(newMemStore(1))
+	ctx := context.Background()
+	sum := sha256.Sum256([]byte("hello"))
+	if v, err := svc.Hash(ctx, "hello", 1); err != nil || v != hex.EncodeToString(sum[:]) {
+		t.Errorf("got v:%s err:%v", v, err)
+	}
+	sum = sha256.Sum256(sum[:])
+	if v, err := svc.Hash(ctx, "hello", 2); err != nil || v != hex.EncodeToString(sum[:]) {
+		t.Errorf("got v:%s err:%v", v, err)
+	}
+	for _, rounds := range []int{0, maxHashRounds + 1} {
+		if _, err := svc.Hash(ctx, "hello", rounds); err != ErrInvalidRounds {
+			t.Errorf("rounds:%d got err:%v", rounds, err)
+		}
+	}
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := svc.Hash(canceled, "hello", maxHashRounds); err != context.Canceled {
+		t.Errorf("got err:%v want Canceled", err)
+	}
+}
+
+// worker都在计算且队列已满时，http返回503
+func TestWorkerPoolMiddleware(t *testing.T) {
+	pool := _go.NewPool("test", 1, 0, _go.PoolMetrics{})
+	defer pool.Close()
+	block := make(chan struct{})
+	started := make(chan struct{})
+	svc := workerPoolMiddleware{pool, &blockingHashService{StringService: newStringService(newMemStore(1)), started: started, block: block}}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = svc.Hash(context.Background(), "a", 1)
+	}()
+	<-started
+
+	srv := httptest.NewServer(httptransport.NewServer(makeHashEndpoint(svc), decodeHashRequest, encodeResponse,
+		httptransport.ServerErrorEncoder(encodeHashError)))
+	defer srv.Close()
+	rsp, err := http.Post(srv.URL, "application/json", strings.NewReader(`{"s":"b","rounds":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusServiceUnavailable || rsp.Header.Get("Retry-After") == "" {
+		t.Errorf("got status:%d header:%v", rsp.StatusCode, rsp.Header)
+	}
+
+	close(block)
+	<-done
+	if v, err := svc.Hash(context.Background(), "b", 1); err != nil || v == "" {
+		t.Errorf("got v:%s err:%v", v, err)
+	}
+}
+
+// 第一次Hash阻塞直到block关闭
+type blockingHashService struct {
+	StringService
+	once    sync.Once
+	started chan struct{}
+	block   chan struct{}
+}
+
+func (s *blockingHashService) Hash(ctx context.Context, str string, rounds int) (string, error) {
+	s.once.Do(func() {
+		close(s.started)
+		<-s.block
+	})
+	return s.StringService.Hash(ctx, str, rounds)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Store 保存service的状态，通过newStringService注入，换成redis、db等实现时service不需要修改
+type Store interface {
+	// 记录一次Uppercase的结果
+	AddHistory(e HistoryEntry) error
+	// 最近的n条记录，新的在前
+	RecentHistory(n int) ([]HistoryEntry, error)
+	// 每个单词的出现次数加1
+	AddWords(words []string) error
+	// 出现次数最多的n个单词，次数相同时按单词排序
+	TopWords(n int) ([]WordCount, error)
+}
+
+type HistoryEntry struct {
+	S  string    `json:"s"`
+	V  string    `json:"v"`
+	At time.Time `json:"at"`
+}
+
+type WordCount struct {
+	Word  string `json:"word"`
+	Count int    `json:"count"`
+}
+
+// 内存实现，只保留最近maxHistory条记录
+type memStore struct {
+	maxHistory int
+
+	mu      sync.Mutex
+	history []HistoryEntry // 环形缓冲
+	next    int
+	words   map[string]int
+}
+
+func newMemStore(maxHistory int) *memStore {
+	return &memStore{maxHistory: maxHistory, words: map[string]int{}}
+}
+
+func (s *memStore) AddHistory(e HistoryEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.history) < s.maxHistory {
+		s.history = append(s.history, e)
+	} else {
+		s.history[s.next] = e
+	}
+	s.next = (s.next + 1) % s.maxHistory
+	return nil
+}
+
+func (s *memStore) RecentHistory(n int) ([]HistoryEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n > len(s.history) {
+		n = len(s.history)
+	}
+	out := make([]HistoryEntry, 0, n)
+	for i := 1; i <= n; i++ {
+		out = append(out, s.history[(s.next-i+len(s.history))%len(s.history)])
+	}
+	return out, nil
+}
+
+func (s *memStore) AddWords(words []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, w := range words {
+		s.words[w]++
+	}
+	return nil
+}
+
+func (s *memStore) TopWords(n int) ([]WordCount, error) {
+	s.mu.Lock()
+	out := make([]WordCount, 0, len(s.words))
+	for w, c := range s.words {
+		out = append(out, WordCount{Word: w, Count: c})
+	}
+	s.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Word < out[j].Word
+	})
+	if n < len(out) {
+		out = out[:n]
+	}
+	return out, nil
+}
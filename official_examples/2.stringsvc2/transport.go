@@ -6,6 +6,8 @@ import (
 	"net/http"
 
 	"github.com/go-kit/kit/endpoint"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"go-util/_go"
 )
 
 func makeUppercaseEndpoint(svc StringService) endpoint.Endpoint {
@@ -27,6 +29,63 @@ func makeCountEndpoint(svc StringService) endpoint.Endpoint {
 	}
 }
 
+func makeHistoryEndpoint(svc StringService) endpoint.Endpoint {
+	return func(_ context.Context, request interface{}) (interface{}, error) {
+		req := request.(limitRequest)
+		v, err := svc.History(req.N)
+		if err != nil {
+			return historyResponse{Err: err.Error()}, nil
+		}
+		return historyResponse{V: v}, nil
+	}
+}
+
+func makeWordFrequencyEndpoint(svc StringService) endpoint.Endpoint {
+	return func(_ context.Context, request interface{}) (interface{}, error) {
+		req := request.(limitRequest)
+		v, err := svc.WordFrequency(req.N)
+		if err != nil {
+			return wordFrequencyResponse{Err: err.Error()}, nil
+		}
+		return wordFrequencyResponse{V: v}, nil
+	}
+}
+
+// 业务错误放在response中，队列已满、ctx结束等作为err返回，由encodeHashError映射http状态码
+func makeHashEndpoint(svc StringService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(hashRequest)
+		v, err := svc.Hash(ctx, req.S, req.Rounds)
+		switch err {
+		case nil:
+			return hashResponse{V: v}, nil
+		case ErrEmpty, ErrInvalidRounds:
+			return hashResponse{Err: err.Error()}, nil
+		}
+		return nil, err
+	}
+}
+
+func decodeHashRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request hashRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// 队列已满时返回503，client稍后重试；其他错误与httptransport.DefaultErrorEncoder相同
+func encodeHashError(ctx context.Context, err error, w http.ResponseWriter) {
+	if err != _go.ErrPoolFull {
+		httptransport.DefaultErrorEncoder(ctx, err, w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Retry-After", "1")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	_ = json.NewEncoder(w).Encode(hashResponse{Err: err.Error()})
+}
+
 func decodeUppercaseRequest(_ context.Context, r *http.Request) (interface{}, error) {
 	var request uppercaseRequest
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
@@ -43,6 +102,14 @@ func decodeCountRequest(_ context.Context, r *http.Request) (interface{}, error)
 	return request, nil
 }
 
+func decodeLimitRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request limitRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
 func encodeResponse(_ context.Context, w http.ResponseWriter, response interface{}) error {
 	return json.NewEncoder(w).Encode(response)
 }
@@ -63,3 +130,27 @@ type countRequest struct {
 type countResponse struct {
 	V int `json:"v"`
 }
+
+type hashRequest struct {
+	S      string `json:"s"`
+	Rounds int    `json:"rounds"`
+}
+
+type hashResponse struct {
+	V   string `json:"v"`
+	Err string `json:"err,omitempty"`
+}
+
+type limitRequest struct {
+	N int `json:"n"`
+}
+
+type historyResponse struct {
+	V   []HistoryEntry `json:"v"`
+	Err string         `json:"err,omitempty"`
+}
+
+type wordFrequencyResponse struct {
+	V   []WordCount `json:"v"`
+	Err string      `json:"err,omitempty"`
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"go-util/_go"
+)
+
+// CPU密集的Hash在固定数量的worker中执行(见_go.Pool)，其他接口不受影响
+// 大量并发Hash请求时排队等待，队列满时返回_go.ErrPoolFull(http为503)，调度器和其他接口仍能正常响应
+type workerPoolMiddleware struct {
+	pool *_go.Pool
+	next StringService
+}
+
+func (mw workerPoolMiddleware) Uppercase(s string) (string, error) {
+	return mw.next.Uppercase(s)
+}
+
+func (mw workerPoolMiddleware) Count(s string) int {
+	return mw.next.Count(s)
+}
+
+func (mw workerPoolMiddleware) History(n int) ([]HistoryEntry, error) {
+	return mw.next.History(n)
+}
+
+func (mw workerPoolMiddleware) WordFrequency(n int) ([]WordCount, error) {
+	return mw.next.WordFrequency(n)
+}
+
+// ctx结束时Do立即返回，已开始的计算在下一次检查ctx时退出，v和err只在Do返回nil时读取
+func (mw workerPoolMiddleware) Hash(ctx context.Context, s string, rounds int) (string, error) {
+	var (
+		v   string
+		err error
+	)
+	if perr := mw.pool.Do(ctx, func(ctx context.Context) error {
+		v, err = mw.next.Hash(ctx, s, rounds)
+		return nil
+	}); perr != nil {
+		return "", perr
+	}
+	return v, err
+}
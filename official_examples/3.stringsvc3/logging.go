@@ -1,47 +1,69 @@
 package main
 
 import (
+	"io"
+	"net/http"
 	"time"
 
 	"github.com/go-kit/kit/log"
 )
 
-func loggingMiddleware(logger log.Logger) ServiceMiddleware {
-	return func(next StringService) StringService {
-		return logmw{logger, next}
-	}
+// transport层的访问日志，代理到其他实例的uppercase请求也只记录一行，上游的调用情况见proxying.go中的日志
+
+type accessLogWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int
 }
 
-type logmw struct {
-	logger log.Logger
-	StringService
+func (w *accessLogWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
 }
 
-func (mw logmw) Uppercase(s string) (output string, err error) {
-	defer func(begin time.Time) {
-		_ = mw.logger.Log(
-			"method", "uppercase",
-			"input", s,
-			"output", output,
-			"err", err,
-			"took", time.Since(begin),
-		)
-	}(time.Now())
+func (w *accessLogWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+	return n, err
+}
+
+type countingBody struct {
+	io.ReadCloser
+	bytes int
+}
 
-	output, err = mw.StringService.Uppercase(s)
-	return
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.bytes += n
+	return n, err
 }
 
-func (mw logmw) Count(s string) (n int) {
-	defer func(begin time.Time) {
-		_ = mw.logger.Log(
-			"method", "count",
-			"input", s,
-			"n", n,
+// e.g. listen=:8080 caller=logging.go:59 method=POST path=/count peer=127.0.0.1:52614 req_bytes=20 resp_bytes=9 status=200 took=31.7µs
+func accessLogMiddleware(logger log.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/metrics" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		begin := time.Now()
+		body := &countingBody{ReadCloser: r.Body}
+		r.Body = body
+		aw := &accessLogWriter{ResponseWriter: w}
+		next.ServeHTTP(aw, r)
+		if aw.status == 0 {
+			aw.status = http.StatusOK
+		}
+		_ = logger.Log(
+			"method", r.Method,
+			"path", r.URL.Path,
+			"peer", r.RemoteAddr,
+			"req_bytes", body.bytes,
+			"resp_bytes", aw.bytes,
+			"status", aw.status,
 			"took", time.Since(begin),
 		)
-	}(time.Now())
-
-	n = mw.StringService.Count(s)
-	return
+	})
 }
@@ -16,8 +16,10 @@ import (
 
 func main() {
 	var (
-		listen = flag.String("listen", ":8080", "HTTP listen address")
-		proxy  = flag.String("proxy", "", "Optional comma-separated list of URLs to proxy uppercase requests")
+		listen        = flag.String("listen", ":8080", "HTTP listen address")
+		proxy         = flag.String("proxy", "", "Optional comma-separated list of URLs to proxy uppercase requests")
+		consulAddr    = flag.String("consul.addr", "", "Optional Consul agent address, discover instances to proxy uppercase requests")
+		consulService = flag.String("consul.service", "stringsvc", "Service name of the proxied instances registered in Consul")
 	)
 	flag.Parse()
 
@@ -47,8 +49,12 @@ func main() {
 
 	var svc StringService
 	svc = stringService{}
-	svc = proxyingMiddleware(context.Background(), *proxy, logger)(svc)
-	svc = loggingMiddleware(logger)(svc)
+	instancer, err := newInstancer(*proxy, *consulAddr, *consulService, logger)
+	if err != nil {
+		logger.Log("err", err)
+		os.Exit(1)
+	}
+	svc = proxyingMiddleware(context.Background(), instancer, logger)(svc)
 	svc = instrumentingMiddleware(requestCount, requestLatency, countResult)(svc)
 
 	uppercaseHandler := httptransport.NewServer(
@@ -66,5 +72,5 @@ func main() {
 	http.Handle("/count", countHandler)
 	http.Handle("/metrics", promhttp.Handler())
 	logger.Log("msg", "HTTP", "addr", *listen)
-	logger.Log("err", http.ListenAndServe(*listen, nil))
+	logger.Log("err", http.ListenAndServe(*listen, accessLogMiddleware(logger, http.DefaultServeMux)))
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net/url"
 	"strings"
 	"time"
@@ -17,13 +18,23 @@ import (
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/ratelimit"
 	"github.com/go-kit/kit/sd"
+	consulsd "github.com/go-kit/kit/sd/consul"
 	"github.com/go-kit/kit/sd/lb"
 	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/hashicorp/consul/api"
 )
 
-func proxyingMiddleware(ctx context.Context, instances string, logger log.Logger) ServiceMiddleware {
-	// If instances is empty, don't proxy.
-	if instances == "" {
+/*
+proxy中间件：Uppercase转发给其他实例，Count仍在本地处理
+-	实例列表来自sd.Instancer：-proxy指定固定的列表(sd.FixedInstancer)，或-consul.addr从consul发现-consul.service服务的健康实例
+-	每个实例的endpoint由uppercaseFactory创建，各自有断路器和限流，实例变化时sd.Endpointer自动增减
+-	lb.RoundRobin轮流选择实例，lb.Retry在maxTime内最多尝试maxAttempts次(每次换一个实例)
+-	所有实例都失败时(包括没有可用实例)回退到本地的next.Uppercase，业务错误(如ErrEmpty)不回退
+*/
+
+func proxyingMiddleware(ctx context.Context, instancer sd.Instancer, logger log.Logger) ServiceMiddleware {
+	// If instancer is nil, don't proxy.
+	if instancer == nil {
 		logger.Log("proxy_to", "none")
 		return func(next StringService) StringService { return next }
 	}
@@ -35,22 +46,9 @@ func proxyingMiddleware(ctx context.Context, instances string, logger log.Logger
 		maxTime     = 250 * time.Millisecond // wallclock time, before giving up
 	)
 
-	// Otherwise, construct an endpoint for each instance in the list, and add
-	// it to a fixed set of endpoints. In a real service, rather than doing this
-	// by hand, you'd probably use package sd's support for your service
-	// discovery system.
-	var (
-		instanceList = split(instances)
-		endpointer   sd.FixedEndpointer
-	)
-	logger.Log("proxy_to", fmt.Sprint(instanceList))
-	for _, instance := range instanceList {
-		var e endpoint.Endpoint
-		e = makeUppercaseProxy(ctx, instance)
-		e = circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(gobreaker.Settings{}))(e)
-		e = ratelimit.NewErroringLimiter(rate.NewLimiter(rate.Every(time.Second), qps))(e)
-		endpointer = append(endpointer, e)
-	}
+	// Construct an endpoint for each instance reported by the instancer. The
+	// endpointer keeps the set up to date as instances come and go.
+	endpointer := sd.NewEndpointer(instancer, uppercaseFactory(ctx, qps), logger)
 
 	// Now, build a single, retrying, load-balancing endpoint out of all of
 	// those individual endpoints.
@@ -59,7 +57,20 @@ func proxyingMiddleware(ctx context.Context, instances string, logger log.Logger
 
 	// And finally, return the ServiceMiddleware, implemented by proxymw.
 	return func(next StringService) StringService {
-		return proxymw{ctx, next, retry}
+		return proxymw{ctx, next, retry, logger}
+	}
+}
+
+// 为每个实例创建endpoint，断路器打开或超过qps时返回err，由lb.Retry换下一个实例
+func uppercaseFactory(ctx context.Context, qps int) sd.Factory {
+	return func(instance string) (endpoint.Endpoint, io.Closer, error) {
+		e, err := makeUppercaseProxy(ctx, instance)
+		if err != nil {
+			return nil, nil, err
+		}
+		e = circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(gobreaker.Settings{}))(e)
+		e = ratelimit.NewErroringLimiter(rate.NewLimiter(rate.Every(time.Second), qps))(e)
+		return e, nil, nil
 	}
 }
 
@@ -70,6 +81,7 @@ type proxymw struct {
 	ctx       context.Context
 	next      StringService     // Serve most requests via this service...
 	uppercase endpoint.Endpoint // ...except Uppercase, which gets served by this endpoint
+	logger    log.Logger
 }
 
 func (mw proxymw) Count(s string) int {
@@ -79,7 +91,9 @@ func (mw proxymw) Count(s string) int {
 func (mw proxymw) Uppercase(s string) (string, error) {
 	response, err := mw.uppercase(mw.ctx, uppercaseRequest{S: s})
 	if err != nil {
-		return "", err
+		// 远程实例都不可用，本地处理
+		mw.logger.Log("proxy", "uppercase", "err", err, "fallback", "local")
+		return mw.next.Uppercase(s)
 	}
 
 	resp := response.(uppercaseResponse)
@@ -89,13 +103,13 @@ func (mw proxymw) Uppercase(s string) (string, error) {
 	return resp.V, nil
 }
 
-func makeUppercaseProxy(ctx context.Context, instance string) endpoint.Endpoint {
+func makeUppercaseProxy(ctx context.Context, instance string) (endpoint.Endpoint, error) {
 	if !strings.HasPrefix(instance, "http") {
 		instance = "http://" + instance
 	}
 	u, err := url.Parse(instance)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	if u.Path == "" {
 		u.Path = "/uppercase"
@@ -105,7 +119,25 @@ func makeUppercaseProxy(ctx context.Context, instance string) endpoint.Endpoint
 		u,
 		encodeRequest,
 		decodeUppercaseResponse,
-	).Endpoint()
+	).Endpoint(), nil
+}
+
+// 根据参数创建sd.Instancer，consulAddr和instances都为空时返回nil(不转发)
+func newInstancer(instances, consulAddr, service string, logger log.Logger) (sd.Instancer, error) {
+	if consulAddr == "" {
+		if instances == "" {
+			return nil, nil
+		}
+		logger.Log("proxy_to", fmt.Sprint(split(instances)))
+		return sd.FixedInstancer(split(instances)), nil
+	}
+	consulClient, err := api.NewClient(&api.Config{Address: consulAddr})
+	if err != nil {
+		return nil, err
+	}
+	logger.Log("proxy_to", "consul", "service", service)
+	// 只使用通过健康检查的实例
+	return consulsd.NewInstancer(consulsd.NewClient(consulClient), logger, service, nil, true), nil
 }
 
 func split(s string) []string {
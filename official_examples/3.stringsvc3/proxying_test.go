@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/sd"
+	httptransport "github.com/go-kit/kit/transport/http"
+)
+
+// 记录本地处理的次数
+type localService struct {
+	stringService
+	calls int
+}
+
+func (s *localService) Uppercase(str string) (string, error) {
+	s.calls++
+	return s.stringService.Uppercase(str)
+}
+
+func newRemote() *httptest.Server {
+	return httptest.NewServer(httptransport.NewServer(makeUppercaseEndpoint(stringService{}), decodeUppercaseRequest, encodeResponse))
+}
+
+func TestProxying(t *testing.T) {
+	remote := newRemote()
+	defer remote.Close()
+	down := newRemote()
+	down.Close()
+
+	local := &localService{}
+	svc := proxyingMiddleware(context.Background(), sd.FixedInstancer{down.URL, remote.URL}, log.NewNopLogger())(local)
+	// 不可用的实例由lb.Retry换下一个实例重试
+	for i := 0; i < 4; i++ {
+		if v, err := svc.Uppercase("hi"); v != "HI" || err != nil {
+			t.Errorf("got v:%s err:%v", v, err)
+		}
+	}
+	// 远程返回的业务错误不回退
+	if _, err := svc.Uppercase(""); err == nil || err.Error() != ErrEmpty.Error() {
+		t.Errorf("got err:%v", err)
+	}
+	if local.calls != 0 {
+		t.Errorf("got local calls:%d", local.calls)
+	}
+	if n := svc.Count("abc"); n != 3 {
+		t.Errorf("got count:%d", n)
+	}
+}
+
+// 所有实例都不可用时本地处理
+func TestProxyingFallback(t *testing.T) {
+	down := newRemote()
+	down.Close()
+	for name, instancer := range map[string]sd.Instancer{
+		"[all down]":     sd.FixedInstancer{down.URL},
+		"[no instances]": sd.FixedInstancer{},
+	} {
+		local := &localService{}
+		svc := proxyingMiddleware(context.Background(), instancer, log.NewNopLogger())(local)
+		if v, err := svc.Uppercase("hi"); v != "HI" || err != nil || local.calls != 1 {
+			t.Errorf("%s got v:%s err:%v local calls:%d", name, v, err, local.calls)
+		}
+	}
+
+	local := &localService{}
+	if svc := proxyingMiddleware(context.Background(), nil, log.NewNopLogger())(local); svc != StringService(local) {
+		t.Errorf("nil instancer got proxy")
+	}
+}
+
+func TestNewInstancer(t *testing.T) {
+	logger := log.NewNopLogger()
+	if i, err := newInstancer("", "", "stringsvc", logger); i != nil || err != nil {
+		t.Errorf("got instancer:%v err:%v", i, err)
+	}
+	i, err := newInstancer("a:8080, b:8080", "", "stringsvc", logger)
+	if fixed, ok := i.(sd.FixedInstancer); err != nil || !ok || len(fixed) != 2 || fixed[1] != "b:8080" {
+		t.Errorf("got instancer:%v err:%v", i, err)
+	}
+}